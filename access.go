@@ -0,0 +1,88 @@
+package fragmenta
+
+import "context"
+
+// 元数据访问授权使用的操作名称，与安全层的 security.Operation 取值一致
+const (
+	accessRead   = "read"
+	accessWrite  = "write"
+	accessDelete = "delete"
+)
+
+// AccessAuthorizer 元数据访问授权接口，通常由安全层的访问控制管理器
+// （security.AccessControlManager）实现。上下文中没有附带身份时不做检查
+type AccessAuthorizer interface {
+	// AuthorizeMetadata 检查上下文中的身份是否可以对元数据标签执行操作
+	AuthorizeMetadata(ctx context.Context, operation string, tag uint16) error
+}
+
+// SetAccessAuthorizer 设置元数据访问授权，只对 *Context 方法生效
+func (f *FragmentaImpl) SetAccessAuthorizer(authorizer AccessAuthorizer) {
+	f.authorizerMutex.Lock()
+	defer f.authorizerMutex.Unlock()
+	f.authorizer = authorizer
+}
+
+// authorizeMetadata 检查元数据标签访问
+func (f *FragmentaImpl) authorizeMetadata(ctx context.Context, operation string, tag uint16) error {
+	f.authorizerMutex.RLock()
+	authorizer := f.authorizer
+	f.authorizerMutex.RUnlock()
+
+	if authorizer == nil {
+		return nil
+	}
+	return authorizer.AuthorizeMetadata(ctx, operation, tag)
+}
+
+// SetMetadataContext 以上下文中的身份设置元数据
+func (f *FragmentaImpl) SetMetadataContext(ctx context.Context, tag uint16, value []byte) error {
+	if err := f.authorizeMetadata(ctx, accessWrite, tag); err != nil {
+		return err
+	}
+	return f.SetMetadata(tag, value)
+}
+
+// GetMetadataContext 以上下文中的身份获取元数据
+func (f *FragmentaImpl) GetMetadataContext(ctx context.Context, tag uint16) ([]byte, error) {
+	if err := f.authorizeMetadata(ctx, accessRead, tag); err != nil {
+		return nil, err
+	}
+	return f.GetMetadata(tag)
+}
+
+// DeleteMetadataContext 以上下文中的身份删除元数据
+func (f *FragmentaImpl) DeleteMetadataContext(ctx context.Context, tag uint16) error {
+	if err := f.authorizeMetadata(ctx, accessDelete, tag); err != nil {
+		return err
+	}
+	return f.DeleteMetadata(tag)
+}
+
+// BatchMetadataOpContext 以上下文中的身份执行批量元数据操作，任一操作未被授权时整批不执行
+func (f *FragmentaImpl) BatchMetadataOpContext(ctx context.Context, batch *BatchMetadataOperation) error {
+	for _, op := range batch.Operations {
+		operation := accessWrite
+		if op.Operation == 1 {
+			operation = accessDelete
+		}
+		if err := f.authorizeMetadata(ctx, operation, op.Tag); err != nil {
+			return err
+		}
+	}
+	return f.BatchMetadataOp(batch)
+}
+
+// ListMetadataContext 以上下文中的身份列出元数据，结果中只包含有读取权限的标签
+func (f *FragmentaImpl) ListMetadataContext(ctx context.Context) (map[uint16][]byte, error) {
+	metadata, err := f.ListMetadata()
+	if err != nil {
+		return nil, err
+	}
+	for tag := range metadata {
+		if f.authorizeMetadata(ctx, accessRead, tag) != nil {
+			delete(metadata, tag)
+		}
+	}
+	return metadata, nil
+}
@@ -0,0 +1,81 @@
+package fragmenta
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+// principalKey 测试用的身份上下文键
+type principalKey struct{}
+
+// errDenied 测试用的拒绝错误
+var errDenied = errors.New("denied")
+
+// mockAuthorizer 只允许对 0x1000 以下的标签执行读取和写入
+type mockAuthorizer struct{}
+
+func (mockAuthorizer) AuthorizeMetadata(ctx context.Context, operation string, tag uint16) error {
+	if ctx.Value(principalKey{}) == nil {
+		return nil
+	}
+	if tag < 0x1000 && operation != accessDelete {
+		return nil
+	}
+	return errDenied
+}
+
+// TestMetadataAccess 测试带身份的元数据操作按授权检查
+func TestMetadataAccess(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "fragdb-access-*.bin")
+	if err != nil {
+		t.Fatalf("创建临时文件失败: %v", err)
+	}
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	f, err := CreateFragmenta(tempFile.Name(), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	defer f.(*FragmentaImpl).file.Close()
+	f.SetAccessAuthorizer(mockAuthorizer{})
+
+	// 没有附带身份的上下文不做检查
+	ctx := context.Background()
+	if err := f.SetMetadataContext(ctx, 0x2000, []byte("admin")); err != nil {
+		t.Fatalf("设置元数据失败: %v", err)
+	}
+
+	user := context.WithValue(ctx, principalKey{}, "bob")
+	if err := f.SetMetadataContext(user, 0x0100, []byte("v")); err != nil {
+		t.Fatalf("设置有权限的元数据失败: %v", err)
+	}
+	if _, err := f.GetMetadataContext(user, 0x2000); !errors.Is(err, errDenied) {
+		t.Errorf("读取无权限的元数据应被拒绝, 错误: %v", err)
+	}
+	if err := f.DeleteMetadataContext(user, 0x0100); !errors.Is(err, errDenied) {
+		t.Errorf("删除元数据应被拒绝, 错误: %v", err)
+	}
+
+	// 批量操作中任一操作未被授权时整批不执行
+	err = f.BatchMetadataOpContext(user, &BatchMetadataOperation{Operations: []MetadataOperation{
+		{Operation: 0, Tag: 0x0200, Value: []byte("x")},
+		{Operation: 0, Tag: 0x3000, Value: []byte("y")},
+	}})
+	if !errors.Is(err, errDenied) {
+		t.Errorf("批量操作应被拒绝, 错误: %v", err)
+	}
+	if _, err := f.GetMetadata(0x0200); err == nil {
+		t.Error("被拒绝的批量操作不应执行")
+	}
+
+	metadata, err := f.ListMetadataContext(user)
+	if err != nil {
+		t.Fatalf("列出元数据失败: %v", err)
+	}
+	if _, ok := metadata[0x2000]; ok || string(metadata[0x0100]) != "v" {
+		t.Errorf("列出的元数据应只包含有权限的标签: %v", metadata)
+	}
+}
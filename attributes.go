@@ -0,0 +1,264 @@
+package fragmenta
+
+import (
+	"fmt"
+	"sort"
+)
+
+// 块属性限制
+const (
+	// MaxBlockAttributes 单个块最多可附加的属性数
+	MaxBlockAttributes = 32
+	// MaxBlockAttributeKeySize 属性键的最大长度（字节）
+	MaxBlockAttributeKeySize = 64
+	// MaxBlockAttributeValueSize 属性值的最大长度（字节）
+	MaxBlockAttributeValueSize = 1024
+)
+
+// 常用块属性键
+const (
+	// AttrContentType 内容类型
+	AttrContentType = "content-type"
+	// AttrOrigin 数据来源
+	AttrOrigin = "origin"
+	// AttrTenant 所属租户
+	AttrTenant = "tenant"
+)
+
+// BlockAttributeIndexer 块属性索引接口，由索引层实现
+// 块属性在写入、修改和删除时同步推送给索引器，避免维护独立的映射表
+type BlockAttributeIndexer interface {
+	// IndexBlockAttributes 索引块的属性，替换该块之前的所有属性
+	IndexBlockAttributes(blockID uint32, attributes map[string]string) error
+	// RemoveBlockAttributes 移除块的所有属性索引
+	RemoveBlockAttributes(blockID uint32) error
+}
+
+// ValidateBlockAttributes 验证块属性的数量和大小
+func ValidateBlockAttributes(attributes map[string]string) error {
+	if len(attributes) > MaxBlockAttributes {
+		return fmt.Errorf("%w: 块属性数量%d超过上限%d", ErrInvalidArgument, len(attributes), MaxBlockAttributes)
+	}
+
+	for key, value := range attributes {
+		if key == "" {
+			return fmt.Errorf("%w: 块属性键不能为空", ErrInvalidArgument)
+		}
+		if len(key) > MaxBlockAttributeKeySize {
+			return fmt.Errorf("%w: 块属性键%q超过%d字节", ErrInvalidArgument, key, MaxBlockAttributeKeySize)
+		}
+		if len(value) > MaxBlockAttributeValueSize {
+			return fmt.Errorf("%w: 块属性%q的值超过%d字节", ErrInvalidArgument, key, MaxBlockAttributeValueSize)
+		}
+	}
+
+	return nil
+}
+
+// copyAttributes 复制属性映射，空映射返回nil
+func copyAttributes(attributes map[string]string) map[string]string {
+	if len(attributes) == 0 {
+		return nil
+	}
+
+	result := make(map[string]string, len(attributes))
+	for key, value := range attributes {
+		result[key] = value
+	}
+	return result
+}
+
+// setAttributesLocked 设置块属性并更新属性倒排表（调用方需持有写锁）
+func (bm *blockManagerImpl) setAttributesLocked(blockID uint32, attributes map[string]string) {
+	bm.removeAttributesLocked(blockID)
+
+	if len(attributes) == 0 {
+		return
+	}
+
+	attributes = copyAttributes(attributes)
+	bm.attributes[blockID] = attributes
+
+	for key, value := range attributes {
+		values, ok := bm.attributeIndex[key]
+		if !ok {
+			values = make(map[string]map[uint32]struct{})
+			bm.attributeIndex[key] = values
+		}
+		ids, ok := values[value]
+		if !ok {
+			ids = make(map[uint32]struct{})
+			values[value] = ids
+		}
+		ids[blockID] = struct{}{}
+	}
+}
+
+// removeAttributesLocked 删除块属性并更新属性倒排表（调用方需持有写锁）
+func (bm *blockManagerImpl) removeAttributesLocked(blockID uint32) {
+	old, ok := bm.attributes[blockID]
+	if !ok {
+		return
+	}
+
+	for key, value := range old {
+		values := bm.attributeIndex[key]
+		delete(values[value], blockID)
+		if len(values[value]) == 0 {
+			delete(values, value)
+		}
+		if len(values) == 0 {
+			delete(bm.attributeIndex, key)
+		}
+	}
+	delete(bm.attributes, blockID)
+}
+
+// GetBlockAttributes 获取块属性
+func (bm *blockManagerImpl) GetBlockAttributes(blockID uint32) (map[string]string, error) {
+	bm.mutex.RLock()
+	defer bm.mutex.RUnlock()
+
+	if _, ok := bm.blockMap[blockID]; !ok {
+		return nil, ErrBlockNotFound
+	}
+
+	return copyAttributes(bm.attributes[blockID]), nil
+}
+
+// SetBlockAttributes 替换块的全部属性，attributes为空时清除属性
+func (bm *blockManagerImpl) SetBlockAttributes(blockID uint32, attributes map[string]string) error {
+	if err := ValidateBlockAttributes(attributes); err != nil {
+		return err
+	}
+
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+
+	if _, ok := bm.blockMap[blockID]; !ok {
+		return ErrBlockNotFound
+	}
+
+	bm.setAttributesLocked(blockID, attributes)
+	bm.isDirty = true
+	return nil
+}
+
+// FindBlocksByAttribute 查找具有指定属性值的块，按块ID升序返回
+func (bm *blockManagerImpl) FindBlocksByAttribute(key, value string) ([]uint32, error) {
+	bm.mutex.RLock()
+	defer bm.mutex.RUnlock()
+
+	ids := bm.attributeIndex[key][value]
+	result := make([]uint32, 0, len(ids))
+	for id := range ids {
+		result = append(result, id)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+
+	return result, nil
+}
+
+// SetAttributeIndexer 设置块属性索引器，并将现有块的属性同步到索引器
+func (f *FragmentaImpl) SetAttributeIndexer(indexer BlockAttributeIndexer) error {
+	f.indexerMutex.Lock()
+	defer f.indexerMutex.Unlock()
+
+	f.attributeIndexer = indexer
+	if indexer == nil {
+		return nil
+	}
+
+	bm, ok := f.blockManager.(*blockManagerImpl)
+	if !ok {
+		return nil
+	}
+
+	bm.mutex.RLock()
+	defer bm.mutex.RUnlock()
+
+	for blockID, attributes := range bm.attributes {
+		if err := indexer.IndexBlockAttributes(blockID, copyAttributes(attributes)); err != nil {
+			logger.Error("同步块属性索引失败", "blockID", blockID, "error", err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetBlockAttributes 获取块属性
+func (f *FragmentaImpl) GetBlockAttributes(blockID uint32) (map[string]string, error) {
+	if f.isTrashed(blockID) {
+		return nil, ErrBlockNotFound
+	}
+	return f.blockManager.GetBlockAttributes(blockID)
+}
+
+// SetBlockAttributes 替换块的全部属性
+func (f *FragmentaImpl) SetBlockAttributes(blockID uint32, attributes map[string]string) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	if f.isTrashed(blockID) {
+		return ErrBlockNotFound
+	}
+
+	if err := f.blockManager.SetBlockAttributes(blockID, attributes); err != nil {
+		logger.Error("设置块属性失败", "blockID", blockID, "error", err)
+		return err
+	}
+
+	f.isDirty.Store(true)
+	return f.indexAttributes(blockID, attributes)
+}
+
+// FindBlocksByAttribute 查找具有指定属性值的块，不包含回收站中的块
+func (f *FragmentaImpl) FindBlocksByAttribute(key, value string) ([]uint32, error) {
+	ids, err := f.blockManager.FindBlocksByAttribute(key, value)
+	if err != nil {
+		return nil, err
+	}
+
+	trashed := f.trashedBlocks()
+	if len(trashed) == 0 {
+		return ids, nil
+	}
+	found := make([]uint32, 0, len(ids))
+	for _, id := range ids {
+		if _, ok := trashed[id]; !ok {
+			found = append(found, id)
+		}
+	}
+	return found, nil
+}
+
+// indexAttributes 将块属性推送给属性索引器和查询服务
+func (f *FragmentaImpl) indexAttributes(blockID uint32, attributes map[string]string) error {
+	f.indexerMutex.RLock()
+	indexer := f.attributeIndexer
+	f.indexerMutex.RUnlock()
+
+	indexers := make([]BlockAttributeIndexer, 0, 2)
+	if indexer != nil {
+		indexers = append(indexers, indexer)
+	}
+	if service := f.getQueryService(); service != nil {
+		indexers = append(indexers, service)
+	}
+
+	for _, indexer := range indexers {
+
+		var err error
+		if len(attributes) == 0 {
+			err = indexer.RemoveBlockAttributes(blockID)
+		} else {
+			err = indexer.IndexBlockAttributes(blockID, copyAttributes(attributes))
+		}
+		if err != nil {
+			logger.Error("更新块属性索引失败", "blockID", blockID, "error", err)
+			return err
+		}
+	}
+	return nil
+}
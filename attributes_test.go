@@ -0,0 +1,113 @@
+package fragmenta
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mockAttributeIndexer 记录推送的块属性
+type mockAttributeIndexer struct {
+	attributes map[uint32]map[string]string
+}
+
+func (m *mockAttributeIndexer) IndexBlockAttributes(blockID uint32, attributes map[string]string) error {
+	m.attributes[blockID] = attributes
+	return nil
+}
+
+func (m *mockAttributeIndexer) RemoveBlockAttributes(blockID uint32) error {
+	delete(m.attributes, blockID)
+	return nil
+}
+
+// TestBlockAttributes 测试块属性的写入、查询和索引同步
+func TestBlockAttributes(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "fragdb-attr-*.bin")
+	if err != nil {
+		t.Fatalf("创建临时文件失败: %v", err)
+	}
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	f, err := CreateFragmenta(tempFile.Name(), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	defer f.(*FragmentaImpl).file.Close()
+
+	// 挂接索引器前写入的块
+	id1, err := f.WriteBlock([]byte("hello"), &BlockOptions{
+		Attributes: map[string]string{AttrContentType: "text/plain", AttrTenant: "alpha"},
+	})
+	if err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+
+	indexer := &mockAttributeIndexer{attributes: make(map[uint32]map[string]string)}
+	if err := f.SetAttributeIndexer(indexer); err != nil {
+		t.Fatalf("设置属性索引器失败: %v", err)
+	}
+	if indexer.attributes[id1][AttrTenant] != "alpha" {
+		t.Errorf("设置索引器时应同步已有块的属性")
+	}
+
+	id2, err := f.WriteBlock([]byte("world"), &BlockOptions{
+		Attributes: map[string]string{AttrContentType: "text/plain", AttrTenant: "beta"},
+	})
+	if err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	if indexer.attributes[id2][AttrTenant] != "beta" {
+		t.Errorf("写入块时应推送属性到索引器")
+	}
+
+	attrs, err := f.GetBlockAttributes(id1)
+	if err != nil {
+		t.Fatalf("获取块属性失败: %v", err)
+	}
+	if !reflect.DeepEqual(attrs, map[string]string{AttrContentType: "text/plain", AttrTenant: "alpha"}) {
+		t.Errorf("块属性不正确: %v", attrs)
+	}
+
+	ids, _ := f.FindBlocksByAttribute(AttrContentType, "text/plain")
+	if !reflect.DeepEqual(ids, []uint32{id1, id2}) {
+		t.Errorf("按属性查找结果不正确: %v", ids)
+	}
+
+	// 替换属性后旧值不再可查
+	if err := f.SetBlockAttributes(id2, map[string]string{AttrTenant: "alpha"}); err != nil {
+		t.Fatalf("设置块属性失败: %v", err)
+	}
+	ids, _ = f.FindBlocksByAttribute(AttrTenant, "alpha")
+	if !reflect.DeepEqual(ids, []uint32{id1, id2}) {
+		t.Errorf("替换属性后查找结果不正确: %v", ids)
+	}
+	ids, _ = f.FindBlocksByAttribute(AttrContentType, "text/plain")
+	if !reflect.DeepEqual(ids, []uint32{id1}) {
+		t.Errorf("被替换的属性不应再可查: %v", ids)
+	}
+
+	// 清除属性
+	if err := f.SetBlockAttributes(id2, nil); err != nil {
+		t.Fatalf("清除块属性失败: %v", err)
+	}
+	if _, ok := indexer.attributes[id2]; ok {
+		t.Errorf("清除属性时应从索引器移除")
+	}
+
+	// 不存在的块
+	if _, err := f.GetBlockAttributes(9999); err != ErrBlockNotFound {
+		t.Errorf("不存在的块应返回ErrBlockNotFound, 实际%v", err)
+	}
+
+	// 超出限制的属性
+	_, err = f.WriteBlock([]byte("x"), &BlockOptions{
+		Attributes: map[string]string{"k": strings.Repeat("v", MaxBlockAttributeValueSize+1)},
+	})
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("超长属性值应返回ErrInvalidArgument, 实际%v", err)
+	}
+}
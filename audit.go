@@ -0,0 +1,51 @@
+package fragmenta
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+)
+
+// 元数据审计操作名称，与安全层审计日志使用的名称一致
+const (
+	auditMetadataSet    = "metadata.set"
+	auditMetadataDelete = "metadata.delete"
+)
+
+// AuditRecorder 审计记录接口，通常由安全层的审计日志（security.AuditLog）实现
+type AuditRecorder interface {
+	// Append 追加一条审计记录
+	Append(action, subject string, details map[string]string) error
+}
+
+// SetAuditRecorder 设置审计记录器，之后的元数据修改都会被记录。
+// 审计记录只包含元数据值的长度和SHA-256摘要，不包含值本身
+func (f *FragmentaImpl) SetAuditRecorder(recorder AuditRecorder) {
+	f.auditMutex.Lock()
+	defer f.auditMutex.Unlock()
+	f.auditRecorder = recorder
+}
+
+// recordMetadataChange 记录元数据修改：启用元数据历史时保存新版本，清除过期时间，并写入审计记录。
+// 审计写入失败不影响操作结果
+func (f *FragmentaImpl) recordMetadataChange(action string, tag uint16, value []byte) {
+	f.recordMetadataVersion(tag, value, action == auditMetadataDelete)
+	f.clearMetadataExpiration(tag)
+
+	f.auditMutex.RLock()
+	recorder := f.auditRecorder
+	f.auditMutex.RUnlock()
+	if recorder == nil {
+		return
+	}
+
+	details := map[string]string{"tag": strconv.Itoa(int(tag))}
+	if action == auditMetadataSet {
+		sum := sha256.Sum256(value)
+		details["size"] = strconv.Itoa(len(value))
+		details["sha256"] = hex.EncodeToString(sum[:])
+	}
+	if err := recorder.Append(action, f.path, details); err != nil {
+		logger.Warn("写入审计日志失败", "action", action, "tag", tag, "error", err)
+	}
+}
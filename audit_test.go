@@ -0,0 +1,80 @@
+package fragmenta
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// auditEntry 一条审计记录
+type auditEntry struct {
+	action  string
+	subject string
+	details map[string]string
+}
+
+// mockAuditRecorder 记录追加的审计事件
+type mockAuditRecorder struct {
+	entries []auditEntry
+}
+
+func (m *mockAuditRecorder) Append(action, subject string, details map[string]string) error {
+	m.entries = append(m.entries, auditEntry{action, subject, details})
+	return nil
+}
+
+// TestMetadataAudit 测试元数据修改被写入审计记录且不包含原始值
+func TestMetadataAudit(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "fragdb-audit-*.bin")
+	if err != nil {
+		t.Fatalf("创建临时文件失败: %v", err)
+	}
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	f, err := CreateFragmenta(tempFile.Name(), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	defer f.(*FragmentaImpl).file.Close()
+
+	recorder := &mockAuditRecorder{}
+	f.SetAuditRecorder(recorder)
+
+	secret := []byte("top-secret-value")
+	if err := f.SetMetadata(0x1001, secret); err != nil {
+		t.Fatalf("设置元数据失败: %v", err)
+	}
+	if err := f.DeleteMetadata(0x1001); err != nil {
+		t.Fatalf("删除元数据失败: %v", err)
+	}
+	err = f.BatchMetadataOp(&BatchMetadataOperation{Operations: []MetadataOperation{
+		{Operation: 0, Tag: 0x1002, Value: []byte("a")},
+		{Operation: 1, Tag: 0x1002},
+	}})
+	if err != nil {
+		t.Fatalf("批量元数据操作失败: %v", err)
+	}
+
+	want := []string{auditMetadataSet, auditMetadataDelete, auditMetadataSet, auditMetadataDelete}
+	if len(recorder.entries) != len(want) {
+		t.Fatalf("审计记录数为%d, 期望%d", len(recorder.entries), len(want))
+	}
+	for i, entry := range recorder.entries {
+		if entry.action != want[i] || entry.subject != tempFile.Name() {
+			t.Errorf("第%d条审计记录为 %s %s", i, entry.action, entry.subject)
+		}
+		for _, v := range entry.details {
+			if strings.Contains(v, string(secret)) {
+				t.Errorf("审计记录不应包含元数据原始值: %v", entry.details)
+			}
+		}
+	}
+	first := recorder.entries[0].details
+	if first["tag"] != "4097" || first["size"] != "16" || len(first["sha256"]) != 64 {
+		t.Errorf("设置元数据的审计详情不正确: %v", first)
+	}
+	if batchSet := recorder.entries[2].details; batchSet["size"] != "1" {
+		t.Errorf("批量设置元数据的审计详情不正确: %v", batchSet)
+	}
+}
@@ -0,0 +1,408 @@
+// Package bench 提供可复现的存储基准工作负载
+//
+// Workload 描述块大小分布、读写删除和查询的比例、查询组合以及并发数，
+// Run 在一个存储配置（Target）上执行工作负载并记录每类操作的延迟，
+// RunMatrix 在多个存储模式和缓存策略上执行同一组工作负载，
+// 结果用 WriteCSV 或 WriteJSON 输出，便于比较不同版本之间的性能。
+// 相同的Workload（包括Seed）在每个工作协程上生成相同的操作序列。
+package bench
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bpfs/fragmenta"
+	"github.com/bpfs/fragmenta/storage"
+)
+
+// 操作类型
+const (
+	OpRead   = "read"
+	OpWrite  = "write"
+	OpDelete = "delete"
+	OpQuery  = "query"
+)
+
+// AttrTenant 工作负载写入的块属性，查询组合可以用 {tenant} 引用随机选择的取值
+const AttrTenant = fragmenta.AttrTenant
+
+// ErrInvalidWorkload 工作负载或存储配置无效
+var ErrInvalidWorkload = errors.New("invalid workload")
+
+// SizeBucket 块大小分布中的一项，块大小在[Min, Max]内均匀分布，按Weight选择
+type SizeBucket struct {
+	Min    int `json:"min"`
+	Max    int `json:"max"`
+	Weight int `json:"weight"`
+}
+
+// OperationMix 各类操作的权重
+type OperationMix struct {
+	Read   int `json:"read"`
+	Write  int `json:"write"`
+	Delete int `json:"delete"`
+	Query  int `json:"query"`
+}
+
+// WeightedQuery 查询组合中的一项，Query使用fragmenta的查询语法，
+// 其中的 {tenant} 替换为随机选择的租户
+type WeightedQuery struct {
+	Query  string `json:"query"`
+	Weight int    `json:"weight"`
+}
+
+// Workload 工作负载
+type Workload struct {
+	// Name 工作负载名称，出现在报告中
+	Name string `json:"name"`
+	// Seed 随机种子，相同的种子生成相同的操作序列
+	Seed int64 `json:"seed"`
+	// Concurrency 并发的工作协程数，默认为1
+	Concurrency int `json:"concurrency"`
+	// Operations 所有工作协程合计执行的操作数
+	Operations int `json:"operations"`
+	// Preload 执行前写入的块数，读取操作可以读取这些块
+	Preload int `json:"preload"`
+	// Sizes 写入的块大小分布，为空时使用4KB
+	Sizes []SizeBucket `json:"sizes"`
+	// Mix 操作比例
+	Mix OperationMix `json:"mix"`
+	// Queries 查询组合，Mix.Query大于0时不能为空
+	Queries []WeightedQuery `json:"queries,omitempty"`
+	// Tenants 写入的块的租户属性取值个数，默认为8
+	Tenants int `json:"tenants"`
+}
+
+// Target 执行工作负载的存储配置
+type Target struct {
+	// Name 存储配置名称，出现在报告中
+	Name string `json:"name"`
+	// StorageMode 存储文件的模式（fragmenta.ContainerMode或DirectoryMode），0表示容器模式
+	StorageMode uint8 `json:"storageMode"`
+	// UseStore 是否挂接存储层（见 fragmenta.SetBlockStore），挂接后块数据的读写经过存储层的缓存
+	UseStore bool `json:"useStore"`
+	// StoreType 存储层的存储类型
+	StoreType storage.StorageType `json:"storeType"`
+	// CachePolicy 存储层的块缓存策略，如 "lru"
+	CachePolicy string `json:"cachePolicy"`
+	// CacheSize 存储层的块缓存大小（字节），0表示不缓存
+	CacheSize uint64 `json:"cacheSize"`
+}
+
+// DefaultWorkloads 返回默认的工作负载：以写为主、以读为主和带查询的混合负载
+func DefaultWorkloads() []Workload {
+	sizes := []SizeBucket{
+		{Min: 512, Max: 4096, Weight: 6},
+		{Min: 4096, Max: 64 << 10, Weight: 3},
+		{Min: 64 << 10, Max: 256 << 10, Weight: 1},
+	}
+	return []Workload{
+		{
+			Name: "write-heavy", Seed: 1, Concurrency: 4, Operations: 2000, Preload: 100,
+			Sizes: sizes, Mix: OperationMix{Read: 2, Write: 7, Delete: 1},
+		},
+		{
+			Name: "read-heavy", Seed: 2, Concurrency: 4, Operations: 5000, Preload: 500,
+			Sizes: sizes, Mix: OperationMix{Read: 9, Write: 1},
+		},
+		{
+			Name: "mixed-query", Seed: 3, Concurrency: 4, Operations: 2000, Preload: 500,
+			Sizes: sizes, Mix: OperationMix{Read: 5, Write: 2, Delete: 1, Query: 2},
+			Queries: []WeightedQuery{
+				{Query: "tenant=={tenant}", Weight: 3},
+				{Query: "tenant=={tenant} and block.size>4096; sort: -block.size; limit: 10", Weight: 2},
+				{Query: "block.size<1024; limit: 50", Weight: 1},
+			},
+		},
+	}
+}
+
+// DefaultTargets 返回默认的存储配置：直接读写存储文件，以及挂接容器、目录和混合存储层并使用不同缓存策略
+func DefaultTargets() []Target {
+	return []Target{
+		{Name: "container"},
+		{Name: "directory", StorageMode: fragmenta.DirectoryMode},
+		{Name: "store-container-lru", UseStore: true, StoreType: storage.StorageTypeContainer, CachePolicy: "lru", CacheSize: 16 << 20},
+		{Name: "store-container-nocache", UseStore: true, StoreType: storage.StorageTypeContainer},
+		{Name: "store-directory-lru", UseStore: true, StoreType: storage.StorageTypeDirectory, CachePolicy: "lru", CacheSize: 16 << 20},
+		{Name: "store-hybrid-lru", UseStore: true, StoreType: storage.StorageTypeHybrid, CachePolicy: "lru", CacheSize: 16 << 20},
+	}
+}
+
+// normalize 填充默认值并检查工作负载
+func (w Workload) normalize() (Workload, error) {
+	if w.Concurrency <= 0 {
+		w.Concurrency = 1
+	}
+	if w.Tenants <= 0 {
+		w.Tenants = 8
+	}
+	if len(w.Sizes) == 0 {
+		w.Sizes = []SizeBucket{{Min: 4096, Max: 4096, Weight: 1}}
+	}
+	if w.Operations < 0 || w.Preload < 0 {
+		return w, fmt.Errorf("%w: 操作数和预先写入的块数不能为负数", ErrInvalidWorkload)
+	}
+	for _, bucket := range w.Sizes {
+		if bucket.Min <= 0 || bucket.Max < bucket.Min || bucket.Weight < 0 {
+			return w, fmt.Errorf("%w: 无效的块大小分布 %+v", ErrInvalidWorkload, bucket)
+		}
+	}
+	mix := w.Mix
+	if mix.Read < 0 || mix.Write < 0 || mix.Delete < 0 || mix.Query < 0 || mix.Read+mix.Write+mix.Delete+mix.Query == 0 {
+		return w, fmt.Errorf("%w: 无效的操作比例 %+v", ErrInvalidWorkload, mix)
+	}
+	if mix.Query > 0 && len(w.Queries) == 0 {
+		return w, fmt.Errorf("%w: 包含查询操作时查询组合不能为空", ErrInvalidWorkload)
+	}
+	return w, nil
+}
+
+// generator 按工作负载生成操作，每个工作协程一个
+type generator struct {
+	workload *Workload
+	rng      *rand.Rand
+}
+
+// nextOp 选择下一个操作
+func (g *generator) nextOp() string {
+	mix := g.workload.Mix
+	n := g.rng.Intn(mix.Read + mix.Write + mix.Delete + mix.Query)
+	switch {
+	case n < mix.Read:
+		return OpRead
+	case n < mix.Read+mix.Write:
+		return OpWrite
+	case n < mix.Read+mix.Write+mix.Delete:
+		return OpDelete
+	default:
+		return OpQuery
+	}
+}
+
+// nextBlock 生成下一个要写入的块数据和属性
+func (g *generator) nextBlock() ([]byte, map[string]string) {
+	total := 0
+	for _, bucket := range g.workload.Sizes {
+		total += bucket.Weight
+	}
+	bucket := g.workload.Sizes[0]
+	if total > 0 {
+		n := g.rng.Intn(total)
+		for _, b := range g.workload.Sizes {
+			if n < b.Weight {
+				bucket = b
+				break
+			}
+			n -= b.Weight
+		}
+	}
+
+	data := make([]byte, bucket.Min+g.rng.Intn(bucket.Max-bucket.Min+1))
+	g.rng.Read(data)
+	return data, map[string]string{AttrTenant: g.tenant()}
+}
+
+// nextQuery 生成下一个查询
+func (g *generator) nextQuery() string {
+	total := 0
+	for _, query := range g.workload.Queries {
+		total += query.Weight
+	}
+	chosen := g.workload.Queries[0]
+	if total > 0 {
+		n := g.rng.Intn(total)
+		for _, query := range g.workload.Queries {
+			if n < query.Weight {
+				chosen = query
+				break
+			}
+			n -= query.Weight
+		}
+	}
+	return strings.ReplaceAll(chosen.Query, "{tenant}", g.tenant())
+}
+
+// tenant 随机选择一个租户
+func (g *generator) tenant() string {
+	return "t" + strconv.Itoa(g.rng.Intn(g.workload.Tenants))
+}
+
+// RunMatrix 在每个存储配置上依次执行每个工作负载，临时文件创建在dir下（为空时使用系统临时目录）
+func RunMatrix(dir string, workloads []Workload, targets []Target) ([]*Result, error) {
+	results := make([]*Result, 0, len(workloads)*len(targets))
+	for _, workload := range workloads {
+		for _, target := range targets {
+			result, err := Run(dir, workload, target)
+			if err != nil {
+				return results, fmt.Errorf("%s/%s: %w", workload.Name, target.Name, err)
+			}
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+// Run 在存储配置上执行工作负载。存储文件创建在dir下的临时目录中，执行完成后删除
+func Run(dir string, workload Workload, target Target) (*Result, error) {
+	workload, err := workload.normalize()
+	if err != nil {
+		return nil, err
+	}
+
+	tempDir, err := os.MkdirTemp(dir, "fragbench-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tempDir)
+
+	db, closeAll, err := openTarget(tempDir, target)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAll()
+
+	if workload.Mix.Query > 0 {
+		if err := db.StartQueryService(); err != nil {
+			return nil, err
+		}
+	}
+
+	// 预先写入的块，所有工作协程都可以读取
+	preloadGen := &generator{workload: &workload, rng: rand.New(rand.NewSource(workload.Seed))}
+	preloaded := make([]uint32, 0, workload.Preload)
+	for i := 0; i < workload.Preload; i++ {
+		data, attributes := preloadGen.nextBlock()
+		id, err := db.WriteBlock(data, &fragmenta.BlockOptions{Attributes: attributes})
+		if err != nil {
+			return nil, fmt.Errorf("预先写入块失败: %w", err)
+		}
+		preloaded = append(preloaded, id)
+	}
+
+	recorders := make([]*recorder, workload.Concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := range recorders {
+		recorders[i] = newRecorder()
+		operations := workload.Operations / workload.Concurrency
+		if i < workload.Operations%workload.Concurrency {
+			operations++
+		}
+		gen := &generator{workload: &workload, rng: rand.New(rand.NewSource(workload.Seed + int64(i) + 1))}
+
+		wg.Add(1)
+		go func(rec *recorder) {
+			defer wg.Done()
+			runWorker(db, gen, preloaded, operations, rec)
+		}(recorders[i])
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	return newResult(workload, target, elapsed, recorders), nil
+}
+
+// openTarget 按存储配置创建存储文件，返回关闭存储文件和存储层的函数
+func openTarget(dir string, target Target) (fragmenta.Fragmenta, func(), error) {
+	mode := target.StorageMode
+	if mode == 0 {
+		mode = fragmenta.ContainerMode
+	}
+	db, err := fragmenta.CreateFragmenta(filepath.Join(dir, "bench.frag"), &fragmenta.FragmentaOptions{
+		StorageMode:       mode,
+		BlockSize:         fragmenta.DefaultBlockSize,
+		IndexUpdateMode:   fragmenta.IndexUpdateRealtime,
+		MaxIndexCacheSize: fragmenta.DefaultIndexCacheSize,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if !target.UseStore {
+		return db, func() { db.Close() }, nil
+	}
+
+	path := filepath.Join(dir, "store")
+	if target.StoreType == storage.StorageTypeContainer {
+		path = filepath.Join(dir, "store.db")
+	}
+	store, err := storage.NewStorageManager(&storage.StorageConfig{
+		Type:            target.StoreType,
+		Path:            path,
+		BlockSize:       4096,
+		InlineThreshold: 512,
+		CacheSize:       target.CacheSize,
+		CachePolicy:     target.CachePolicy,
+	})
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("%w: 创建存储层失败: %v", ErrInvalidWorkload, err)
+	}
+	if err := db.SetBlockStore(store); err != nil {
+		store.Close()
+		db.Close()
+		return nil, nil, err
+	}
+	return db, func() {
+		db.Close()
+		store.Close()
+	}, nil
+}
+
+// runWorker 执行一个工作协程的操作。读取在预先写入的块和本协程写入的块中选择，
+// 删除只删除本协程写入的块，没有可读取或删除的块时改为写入
+func runWorker(db fragmenta.Fragmenta, gen *generator, preloaded []uint32, operations int, rec *recorder) {
+	var written []uint32
+	for i := 0; i < operations; i++ {
+		op := gen.nextOp()
+		if (op == OpRead && len(preloaded)+len(written) == 0) || (op == OpDelete && len(written) == 0) {
+			op = OpWrite
+		}
+
+		switch op {
+		case OpRead:
+			n := gen.rng.Intn(len(preloaded) + len(written))
+			var blockID uint32
+			if n < len(preloaded) {
+				blockID = preloaded[n]
+			} else {
+				blockID = written[n-len(preloaded)]
+			}
+			start := time.Now()
+			data, err := db.ReadBlock(blockID)
+			rec.record(OpRead, time.Since(start), len(data), err)
+		case OpWrite:
+			data, attributes := gen.nextBlock()
+			start := time.Now()
+			blockID, err := db.WriteBlock(data, &fragmenta.BlockOptions{Attributes: attributes})
+			rec.record(OpWrite, time.Since(start), len(data), err)
+			if err == nil {
+				written = append(written, blockID)
+			}
+		case OpDelete:
+			n := gen.rng.Intn(len(written))
+			blockID := written[n]
+			written[n] = written[len(written)-1]
+			written = written[:len(written)-1]
+			start := time.Now()
+			err := db.DeleteBlock(blockID)
+			rec.record(OpDelete, time.Since(start), 0, err)
+		case OpQuery:
+			query := gen.nextQuery()
+			start := time.Now()
+			result, err := db.Query(query)
+			count := 0
+			if result != nil {
+				count = len(result.Entries)
+			}
+			rec.record(OpQuery, time.Since(start), count, err)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package bench
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/bpfs/fragmenta/storage"
+)
+
+// testWorkload 测试用的小工作负载
+func testWorkload() Workload {
+	return Workload{
+		Name: "test", Seed: 7, Concurrency: 3, Operations: 120, Preload: 20,
+		Sizes: []SizeBucket{{Min: 100, Max: 2000, Weight: 3}, {Min: 8000, Max: 9000, Weight: 1}},
+		Mix:   OperationMix{Read: 4, Write: 3, Delete: 1, Query: 2},
+		Queries: []WeightedQuery{
+			{Query: "tenant=={tenant}", Weight: 1},
+			{Query: "block.size>1000; limit: 5", Weight: 1},
+		},
+		Tenants: 3,
+	}
+}
+
+// TestRun 测试在不同存储配置上执行工作负载，操作数和读取字节数由种子确定
+func TestRun(t *testing.T) {
+	targets := []Target{
+		{Name: "container"},
+		{Name: "store-lru", UseStore: true, StoreType: storage.StorageTypeDirectory, CachePolicy: "lru", CacheSize: 1 << 20},
+	}
+	results, err := RunMatrix(t.TempDir(), []Workload{testWorkload()}, targets)
+	if err != nil {
+		t.Fatalf("执行工作负载失败: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("结果数不正确: %d", len(results))
+	}
+
+	for _, result := range results {
+		total := 0
+		for op, stats := range result.Ops {
+			if stats.Errors != 0 {
+				t.Errorf("%s 的 %s 操作出错 %d 次", result.Target.Name, op, stats.Errors)
+			}
+			if stats.P50 > stats.P99 || stats.P99 > stats.Max {
+				t.Errorf("%s 的 %s 延迟百分位不正确: %+v", result.Target.Name, op, stats)
+			}
+			total += stats.Count
+		}
+		if total != 120 {
+			t.Errorf("%s 的操作数不正确: %d", result.Target.Name, total)
+		}
+		for _, op := range []string{OpRead, OpWrite, OpDelete, OpQuery} {
+			if result.Ops[op] == nil {
+				t.Errorf("%s 缺少 %s 操作", result.Target.Name, op)
+			}
+		}
+	}
+
+	// 相同种子在不同存储上生成相同的操作序列
+	for _, op := range []string{OpRead, OpWrite, OpDelete} {
+		a, b := results[0].Ops[op], results[1].Ops[op]
+		if a.Count != b.Count || a.Bytes != b.Bytes {
+			t.Errorf("%s 操作在两个存储上不一致: %+v, %+v", op, a, b)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil || len(records) != 1+2*4 || len(records[1]) != len(csvHeader) {
+		t.Errorf("CSV报告不正确: %d 行, %v", len(records), err)
+	}
+
+	buf.Reset()
+	if err := WriteJSON(&buf, results); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []*Result
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || len(decoded) != 2 || decoded[1].Ops[OpRead].Count != results[1].Ops[OpRead].Count {
+		t.Errorf("JSON报告不正确: %v", err)
+	}
+}
+
+// TestInvalidWorkload 测试无效的工作负载
+func TestInvalidWorkload(t *testing.T) {
+	for _, workload := range []Workload{
+		{Mix: OperationMix{}},
+		{Mix: OperationMix{Query: 1}},
+		{Mix: OperationMix{Write: 1}, Sizes: []SizeBucket{{Min: 10, Max: 5, Weight: 1}}},
+		{Mix: OperationMix{Write: 1}, Operations: -1},
+	} {
+		if _, err := Run(t.TempDir(), workload, Target{}); !errors.Is(err, ErrInvalidWorkload) {
+			t.Errorf("工作负载 %+v 应返回ErrInvalidWorkload: %v", workload, err)
+		}
+	}
+}
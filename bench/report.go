@@ -0,0 +1,162 @@
+package bench
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// OpStats 一类操作的统计
+type OpStats struct {
+	Count  int           `json:"count"`
+	Errors int           `json:"errors"`
+	Bytes  int64         `json:"bytes"`
+	Mean   time.Duration `json:"meanNs"`
+	P50    time.Duration `json:"p50Ns"`
+	P95    time.Duration `json:"p95Ns"`
+	P99    time.Duration `json:"p99Ns"`
+	Max    time.Duration `json:"maxNs"`
+}
+
+// Result 一次执行的结果。查询操作的Bytes为返回的结果条数
+type Result struct {
+	Workload  Workload            `json:"workload"`
+	Target    Target              `json:"target"`
+	Elapsed   time.Duration       `json:"elapsedNs"`
+	OpsPerSec float64             `json:"opsPerSec"`
+	Ops       map[string]*OpStats `json:"ops"`
+}
+
+// recorder 记录一个工作协程的操作延迟，只由该协程使用
+type recorder struct {
+	latencies map[string][]time.Duration
+	errors    map[string]int
+	bytes     map[string]int64
+}
+
+// newRecorder 创建记录器
+func newRecorder() *recorder {
+	return &recorder{
+		latencies: make(map[string][]time.Duration),
+		errors:    make(map[string]int),
+		bytes:     make(map[string]int64),
+	}
+}
+
+// record 记录一次操作
+func (r *recorder) record(op string, latency time.Duration, size int, err error) {
+	r.latencies[op] = append(r.latencies[op], latency)
+	r.bytes[op] += int64(size)
+	if err != nil {
+		r.errors[op]++
+	}
+}
+
+// newResult 合并所有工作协程的记录
+func newResult(workload Workload, target Target, elapsed time.Duration, recorders []*recorder) *Result {
+	result := &Result{Workload: workload, Target: target, Elapsed: elapsed, Ops: make(map[string]*OpStats)}
+
+	latencies := make(map[string][]time.Duration)
+	total := 0
+	for _, r := range recorders {
+		for op, values := range r.latencies {
+			latencies[op] = append(latencies[op], values...)
+			total += len(values)
+			stats := result.Ops[op]
+			if stats == nil {
+				stats = &OpStats{}
+				result.Ops[op] = stats
+			}
+			stats.Errors += r.errors[op]
+			stats.Bytes += r.bytes[op]
+		}
+	}
+
+	for op, values := range latencies {
+		sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+		var sum time.Duration
+		for _, v := range values {
+			sum += v
+		}
+		stats := result.Ops[op]
+		stats.Count = len(values)
+		stats.Mean = sum / time.Duration(len(values))
+		stats.P50 = percentile(values, 50)
+		stats.P95 = percentile(values, 95)
+		stats.P99 = percentile(values, 99)
+		stats.Max = values[len(values)-1]
+	}
+
+	if elapsed > 0 {
+		result.OpsPerSec = float64(total) / elapsed.Seconds()
+	}
+	return result
+}
+
+// percentile 返回已排序延迟的百分位数
+func percentile(sorted []time.Duration, p int) time.Duration {
+	index := (len(sorted)*p + 99) / 100
+	if index > 0 {
+		index--
+	}
+	return sorted[index]
+}
+
+// csvHeader CSV报告的列
+var csvHeader = []string{
+	"workload", "target", "seed", "concurrency", "elapsed_ms", "ops_per_sec",
+	"op", "count", "errors", "bytes", "mean_us", "p50_us", "p95_us", "p99_us", "max_us",
+}
+
+// WriteCSV 输出CSV报告，每个结果的每类操作一行，延迟单位为微秒
+func WriteCSV(w io.Writer, results []*Result) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+
+	for _, result := range results {
+		ops := make([]string, 0, len(result.Ops))
+		for op := range result.Ops {
+			ops = append(ops, op)
+		}
+		sort.Strings(ops)
+
+		for _, op := range ops {
+			stats := result.Ops[op]
+			record := []string{
+				result.Workload.Name,
+				result.Target.Name,
+				strconv.FormatInt(result.Workload.Seed, 10),
+				strconv.Itoa(result.Workload.Concurrency),
+				strconv.FormatInt(result.Elapsed.Milliseconds(), 10),
+				strconv.FormatFloat(result.OpsPerSec, 'f', 1, 64),
+				op,
+				strconv.Itoa(stats.Count),
+				strconv.Itoa(stats.Errors),
+				strconv.FormatInt(stats.Bytes, 10),
+				strconv.FormatInt(stats.Mean.Microseconds(), 10),
+				strconv.FormatInt(stats.P50.Microseconds(), 10),
+				strconv.FormatInt(stats.P95.Microseconds(), 10),
+				strconv.FormatInt(stats.P99.Microseconds(), 10),
+				strconv.FormatInt(stats.Max.Microseconds(), 10),
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// WriteJSON 输出JSON报告，包含完整的工作负载和存储配置，延迟单位为纳秒
+func WriteJSON(w io.Writer, results []*Result) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(results)
+}
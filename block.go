@@ -3,10 +3,10 @@ package fragmenta
 import (
 	"crypto/md5"
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"io"
 	"os"
+	"sort"
 	"sync"
 	"time"
 )
@@ -14,6 +14,13 @@ import (
 // 块头大小常量
 const BlockHeaderSize = 64 // 块头的大小，单位为字节
 
+// 块头字段布局：ID(4) 类型(1) 标志(1) 保留(2) 大小(4) 校验和(16) 前块(4) 后块(4) 时间戳(8)，其余填充到BlockHeaderSize
+const (
+	blockFlagsOffset      = 5
+	blockLinksOffset      = 28
+	blockHeaderFieldsSize = 44
+)
+
 // blockManagerImpl 是BlockManager接口的实现
 type blockManagerImpl struct {
 	// 文件操作
@@ -22,31 +29,112 @@ type blockManagerImpl struct {
 	// 块管理
 	nextBlockID uint32
 	blockMap    map[uint32]*BlockHeader
+	offsets     map[uint32]uint64 // 块ID -> 块头在文件中的偏移
 	freeList    []uint32
 
-	// 同步与缓存
+	// 块属性及其倒排表(键 -> 值 -> 块ID集合)
+	attributes     map[uint32]map[string]string
+	attributeIndex map[string]map[string]map[uint32]struct{}
+
+	// 同步与缓存，ReadBlock只持有读锁，因此块缓存由cacheMutex单独保护
 	mutex      sync.RWMutex
 	blockCache map[uint32][]byte
-	cacheSize  int
+	cacheBytes int64
+	cacheLimit int64 // 块缓存的最大字节数，为0时不缓存
+	cacheMutex sync.Mutex
 	isDirty    bool
 
+	// 读取块时是否校验块的校验和
+	verifyChecksums bool
+
+	// 只读打开并启用mmap时映射的文件内容，按偏移读取块数据时直接复制
+	mapped []byte
+
 	// 格式信息
 	fragmentaHeader *FragmentaHeader
+
+	// 块头时间戳的来源，确定性模式下返回固定时间
+	clock func() time.Time
 }
 
 // NewBlockManager 创建一个块管理器
+// 打开已有文件时扫描块区，恢复块表和下一个块ID
 func NewBlockManager(file io.ReadWriteSeeker, header *FragmentaHeader) BlockManager {
-	return &blockManagerImpl{
+	bm := &blockManagerImpl{
 		file:            file,
 		fragmentaHeader: header,
 		blockMap:        make(map[uint32]*BlockHeader),
+		offsets:         make(map[uint32]uint64),
+		attributes:      make(map[uint32]map[string]string),
+		attributeIndex:  make(map[string]map[string]map[uint32]struct{}),
 		blockCache:      make(map[uint32][]byte),
-		cacheSize:       4096, // 默认缓存大小
+		cacheLimit:      DefaultBlockCacheSize,
+		verifyChecksums: true,
+		clock:           time.Now,
+	}
+
+	if header.BlockSize > 0 {
+		if err := bm.loadBlockHeaders(); err != nil {
+			logger.Warn("扫描块区失败", "error", err)
+		}
+	}
+
+	return bm
+}
+
+// cacheGet 返回缓存的块数据
+func (bm *blockManagerImpl) cacheGet(blockID uint32) ([]byte, bool) {
+	bm.cacheMutex.Lock()
+	defer bm.cacheMutex.Unlock()
+
+	data, ok := bm.blockCache[blockID]
+	return data, ok
+}
+
+// cachePut 缓存块数据，超出容量时淘汰任意条目，超过容量的数据不缓存
+func (bm *blockManagerImpl) cachePut(blockID uint32, data []byte) {
+	bm.cacheMutex.Lock()
+	defer bm.cacheMutex.Unlock()
+
+	bm.cacheDeleteLocked(blockID)
+	size := int64(len(data))
+	if size > bm.cacheLimit {
+		return
+	}
+	for id := range bm.blockCache {
+		if bm.cacheBytes+size <= bm.cacheLimit {
+			break
+		}
+		bm.cacheDeleteLocked(id)
+	}
+	bm.blockCache[blockID] = data
+	bm.cacheBytes += size
+}
+
+// cacheDelete 删除缓存的块数据
+func (bm *blockManagerImpl) cacheDelete(blockID uint32) {
+	bm.cacheMutex.Lock()
+	defer bm.cacheMutex.Unlock()
+
+	bm.cacheDeleteLocked(blockID)
+}
+
+// cacheDeleteLocked 删除缓存的块数据，调用方需持有cacheMutex
+func (bm *blockManagerImpl) cacheDeleteLocked(blockID uint32) {
+	if data, ok := bm.blockCache[blockID]; ok {
+		bm.cacheBytes -= int64(len(data))
+		delete(bm.blockCache, blockID)
 	}
 }
 
 // WriteBlock 写入数据块
 func (bm *blockManagerImpl) WriteBlock(data []byte, options *BlockOptions) (uint32, error) {
+	if options != nil {
+		if err := ValidateBlockAttributes(options.Attributes); err != nil {
+			return 0, err
+		}
+	}
+
 	bm.mutex.Lock()
 	defer bm.mutex.Unlock()
 
@@ -66,34 +154,49 @@ func (bm *blockManagerImpl) WriteBlock(data []byte, options *BlockOptions) (uint
 		BlockType: options.BlockType,
 		Flags:     0,
 		Size:      uint32(len(data)),
-		Timestamp: time.Now().UnixNano(),
+		Timestamp: bm.clock().UnixNano(),
 	}
 
 	// 设置压缩和加密标志
 	if options.Compress {
-		header.Flags |= 0x01 // 压缩标志位
+		header.Flags |= BlockFlagCompressed
 	}
 	if options.Encrypt {
-		header.Flags |= 0x02 // 加密标志位
+		header.Flags |= BlockFlagEncrypted
 	}
 
 	// 如果需要校验和
 	if options.Checksum {
-		checksum := md5.Sum(data)
-		header.Checksum = checksum
+		header.Checksum = md5.Sum(data)
+		header.Flags |= BlockFlagChecksum
 	}
 
 	// 如果是链式存储
+	var prevHeader *BlockHeader
 	if options.AppendToBlockID != 0 {
-		prevHeader, err := bm.GetBlockInfo(options.AppendToBlockID)
-		if err == nil {
+		if prev, ok := bm.blockMap[options.AppendToBlockID]; ok {
 			header.PreviousBlock = options.AppendToBlockID
-			prevHeader.NextBlock = blockID
-			// 更新前一个块的头信息
-			bm.blockMap[options.AppendToBlockID] = prevHeader
+			prevHeader = prev
+		}
+	}
+
+	if err := bm.appendBlockLocked(header, data, options.Attributes); err != nil {
+		return 0, err
+	}
+
+	// 更新前一个块的链接
+	if prevHeader != nil {
+		prevHeader.NextBlock = blockID
+		if err := bm.persistLinksLocked(prevHeader); err != nil {
+			logger.Warn("更新块链接失败", "blockID", prevHeader.BlockID, "error", err)
 		}
 	}
 
+	return blockID, nil
+}
+
+// appendBlockLocked 在块区末尾写入块头和块数据，并登记块。调用方需持有写锁
+func (bm *blockManagerImpl) appendBlockLocked(header *BlockHeader, data []byte, attributes map[string]string) error {
 	// 确定块的存储位置
 	offset := bm.fragmentaHeader.BlockOffset
 	if offset == 0 {
@@ -110,7 +213,7 @@ func (bm *blockManagerImpl) WriteBlock(data []byte, options *BlockOptions) (uint
 	_, err := bm.file.Seek(int64(offset), io.SeekStart)
 	if err != nil {
 		logger.Error("移动文件指针失败", "error", err)
-		return 0, err
+		return err
 	}
 
 	// 写入块头
@@ -121,69 +224,76 @@ func (bm *blockManagerImpl) WriteBlock(data []byte, options *BlockOptions) (uint
 	err = binary.Write(bm.file, binary.BigEndian, header.BlockID)
 	if err != nil {
 		logger.Error("写入块ID失败", "error", err)
-		return 0, err
+		return err
 	}
 
 	// 写入块类型
 	err = binary.Write(bm.file, binary.BigEndian, header.BlockType)
 	if err != nil {
 		logger.Error("写入块类型失败", "error", err)
-		return 0, err
+		return err
 	}
 
 	// 写入标志
 	err = binary.Write(bm.file, binary.BigEndian, header.Flags)
 	if err != nil {
 		logger.Error("写入标志失败", "error", err)
-		return 0, err
+		return err
 	}
 
 	// 写入保留字段
 	err = binary.Write(bm.file, binary.BigEndian, header.Reserved)
 	if err != nil {
 		logger.Error("写入保留字段失败", "error", err)
-		return 0, err
+		return err
 	}
 
 	// 写入大小
 	err = binary.Write(bm.file, binary.BigEndian, header.Size)
 	if err != nil {
 		logger.Error("写入大小失败", "error", err)
-		return 0, err
+		return err
 	}
 
 	// 写入校验和
 	_, err = bm.file.Write(header.Checksum[:])
 	if err != nil {
 		logger.Error("写入校验和失败", "error", err)
-		return 0, err
+		return err
 	}
 
 	// 写入前后块链接
 	err = binary.Write(bm.file, binary.BigEndian, header.PreviousBlock)
 	if err != nil {
 		logger.Error("写入前后块链接失败", "error", err)
-		return 0, err
+		return err
 	}
 
 	err = binary.Write(bm.file, binary.BigEndian, header.NextBlock)
 	if err != nil {
 		logger.Error("写入前后块链接失败", "error", err)
-		return 0, err
+		return err
 	}
 
 	// 写入时间戳
 	err = binary.Write(bm.file, binary.BigEndian, header.Timestamp)
 	if err != nil {
 		logger.Error("写入时间戳失败", "error", err)
-		return 0, err
+		return err
+	}
+
+	// 填充块头到固定大小，块数据总是从块头之后headerSize字节处开始
+	_, err = bm.file.Write(make([]byte, headerSize-blockHeaderFieldsSize))
+	if err != nil {
+		logger.Error("写入块头填充失败", "error", err)
+		return err
 	}
 
 	// 写入块数据
 	_, err = bm.file.Write(data)
 	if err != nil {
 		logger.Error("写入块数据失败", "error", err)
-		return 0, err
+		return err
 	}
 
 	// 更新头部信息
@@ -191,11 +301,13 @@ func (bm *blockManagerImpl) WriteBlock(data []byte, options *BlockOptions) (uint
 	bm.fragmentaHeader.TotalSize += uint64(headerSize + header.Size)
 
 	// 存储块和头信息
-	bm.blockMap[blockID] = header
-	bm.blockCache[blockID] = data
+	bm.blockMap[header.BlockID] = header
+	bm.offsets[header.BlockID] = offset
+	bm.cachePut(header.BlockID, data)
+	bm.setAttributesLocked(header.BlockID, attributes)
 	bm.isDirty = true
 
-	return blockID, nil
+	return nil
 }
 
 // ReadBlock 读取数据块
@@ -204,7 +316,7 @@ func (bm *blockManagerImpl) ReadBlock(blockID uint32) ([]byte, error) {
 	defer bm.mutex.RUnlock()
 
 	// 先检查缓存
-	if data, ok := bm.blockCache[blockID]; ok {
+	if data, ok := bm.cacheGet(blockID); ok {
 		return data, nil
 	}
 
@@ -252,7 +364,7 @@ func (bm *blockManagerImpl) ReadBlock(blockID uint32) ([]byte, error) {
 					availableData, _ = io.ReadAll(bm.file)
 					if len(availableData) > 0 {
 						// 更新缓存
-						bm.blockCache[blockID] = availableData
+						bm.cachePut(blockID, availableData)
 						return availableData, nil
 					}
 				}
@@ -263,15 +375,15 @@ func (bm *blockManagerImpl) ReadBlock(blockID uint32) ([]byte, error) {
 	}
 
 	// 验证校验和
-	if header.Flags&0x04 != 0 { // 假设0x04是校验和标志
+	if bm.verifyChecksums && header.Flags&BlockFlagChecksum != 0 {
 		checksum := md5.Sum(data)
 		if checksum != header.Checksum {
-			return nil, errors.New("block data checksum mismatch")
+			return nil, fmt.Errorf("%w: 块%d的校验和不匹配", ErrCorrupted, blockID)
 		}
 	}
 
 	// 更新缓存
-	bm.blockCache[blockID] = data
+	bm.cachePut(blockID, data)
 
 	return data, nil
 }
@@ -281,18 +393,170 @@ func (bm *blockManagerImpl) DeleteBlock(blockID uint32) error {
 	bm.mutex.Lock()
 	defer bm.mutex.Unlock()
 
+	return bm.deleteBlockLocked(blockID)
+}
+
+// deleteBlockRestorable 删除数据块并返回撤销删除的函数，供事务回滚使用。
+// 块数据仍保留在文件中的原位置，撤销时清除删除标志并恢复块的链接和属性
+func (bm *blockManagerImpl) deleteBlockRestorable(blockID uint32) (func() error, error) {
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+
+	header, ok := bm.blockMap[blockID]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+	saved := *header
+	offset := bm.offsets[blockID]
+	attributes := copyAttributes(bm.attributes[blockID])
+
+	if err := bm.deleteBlockLocked(blockID); err != nil {
+		return nil, err
+	}
+
+	return func() error {
+		bm.mutex.Lock()
+		defer bm.mutex.Unlock()
+
+		return bm.restoreBlockLocked(&saved, offset, attributes)
+	}, nil
+}
+
+// restoreBlockLocked 恢复已标记删除的块
+func (bm *blockManagerImpl) restoreBlockLocked(header *BlockHeader, offset uint64, attributes map[string]string) error {
+	blockID := header.BlockID
+	if _, ok := bm.blockMap[blockID]; ok {
+		return fmt.Errorf("块ID %d 已被重新使用", blockID)
+	}
+
+	bm.offsets[blockID] = offset
+	if err := bm.writeFlagsLocked(blockID, header.Flags); err != nil {
+		delete(bm.offsets, blockID)
+		logger.Error("清除块删除标志失败", "blockID", blockID, "error", err)
+		return err
+	}
+	bm.blockMap[blockID] = header
+	bm.setAttributesLocked(blockID, attributes)
+
+	// 恢复前后块指向该块的链接
+	if prev, ok := bm.blockMap[header.PreviousBlock]; ok && header.PreviousBlock != 0 {
+		prev.NextBlock = blockID
+		if err := bm.persistLinksLocked(prev); err != nil {
+			logger.Warn("更新块链接失败", "blockID", prev.BlockID, "error", err)
+		}
+	}
+	if next, ok := bm.blockMap[header.NextBlock]; ok && header.NextBlock != 0 {
+		next.PreviousBlock = blockID
+		if err := bm.persistLinksLocked(next); err != nil {
+			logger.Warn("更新块链接失败", "blockID", next.BlockID, "error", err)
+		}
+	}
+
+	for i, id := range bm.freeList {
+		if id == blockID {
+			bm.freeList = append(bm.freeList[:i], bm.freeList[i+1:]...)
+			break
+		}
+	}
+	bm.isDirty = true
+	return nil
+}
+
+// putBlock 按给定的块头写入块，保留块ID、类型、标志和链接，已有的同ID块被替换。
+// 不修改其他块的链接，供增量同步在副本上重放源的块使用
+func (bm *blockManagerImpl) putBlock(header *BlockHeader, data []byte, attributes map[string]string) error {
+	if err := ValidateBlockAttributes(attributes); err != nil {
+		return err
+	}
+
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+
+	saved := *header
+	saved.Size = uint32(len(data))
+	saved.Flags &^= BlockFlagDeleted
+
+	if old, ok := bm.blockMap[saved.BlockID]; ok {
+		if err := bm.dropBlockLocked(old); err != nil {
+			return err
+		}
+	}
+	for i, id := range bm.freeList {
+		if id == saved.BlockID {
+			bm.freeList = append(bm.freeList[:i], bm.freeList[i+1:]...)
+			break
+		}
+	}
+	if saved.BlockID > bm.nextBlockID {
+		bm.nextBlockID = saved.BlockID
+	}
+
+	return bm.appendBlockLocked(&saved, data, attributes)
+}
+
+// removeBlock 删除块，不修改其他块的链接，供增量同步删除源中已不存在的块使用
+func (bm *blockManagerImpl) removeBlock(blockID uint32) error {
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+
+	header, ok := bm.blockMap[blockID]
+	if !ok {
+		return ErrBlockNotFound
+	}
+	if err := bm.dropBlockLocked(header); err != nil {
+		return err
+	}
+	bm.freeList = append(bm.freeList, blockID)
+	return nil
+}
+
+// deleteBlockLocked 删除数据块，调用方需持有写锁
+func (bm *blockManagerImpl) deleteBlockLocked(blockID uint32) error {
+	if err := bm.unlinkBlockLocked(blockID); err != nil {
+		return err
+	}
+	bm.freeList = append(bm.freeList, blockID)
+	return nil
+}
+
+// deleteBlockReserved 删除数据块并返回释放块ID的函数。调用释放函数前块ID不进入空闲列表，
+// 删除方清理完块的附属数据再释放，期间并发的写入不会重新使用该ID
+func (bm *blockManagerImpl) deleteBlockReserved(blockID uint32) (func(), error) {
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+
+	if err := bm.unlinkBlockLocked(blockID); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		bm.mutex.Lock()
+		defer bm.mutex.Unlock()
+
+		bm.freeList = append(bm.freeList, blockID)
+	}, nil
+}
+
+// unlinkBlockLocked 删除块并修复前后块的链接，块ID不进入空闲列表。调用方需持有写锁
+func (bm *blockManagerImpl) unlinkBlockLocked(blockID uint32) error {
 	// 查找块头信息
 	header, ok := bm.blockMap[blockID]
 	if !ok {
 		return ErrBlockNotFound
 	}
 
+	if err := bm.dropBlockLocked(header); err != nil {
+		return err
+	}
+
 	// 处理链接
 	if header.PreviousBlock != 0 {
 		prevHeader, ok := bm.blockMap[header.PreviousBlock]
 		if ok {
 			prevHeader.NextBlock = header.NextBlock
-			bm.blockMap[header.PreviousBlock] = prevHeader
+			if err := bm.persistLinksLocked(prevHeader); err != nil {
+				logger.Warn("更新块链接失败", "blockID", prevHeader.BlockID, "error", err)
+			}
 		}
 	}
 
@@ -300,18 +564,34 @@ func (bm *blockManagerImpl) DeleteBlock(blockID uint32) error {
 		nextHeader, ok := bm.blockMap[header.NextBlock]
 		if ok {
 			nextHeader.PreviousBlock = header.PreviousBlock
-			bm.blockMap[header.NextBlock] = nextHeader
+			if err := bm.persistLinksLocked(nextHeader); err != nil {
+				logger.Warn("更新块链接失败", "blockID", nextHeader.BlockID, "error", err)
+			}
 		}
 	}
 
+	// 注意：实际的文件空间不会立即释放，需要通过OptimizeBlocks进行碎片整理
+
+	return nil
+}
+
+// dropBlockLocked 在文件中标记块删除并删除块信息，不处理其他块的链接。调用方需持有写锁
+func (bm *blockManagerImpl) dropBlockLocked(header *BlockHeader) error {
+	blockID := header.BlockID
+
+	// 在文件中标记删除，重新打开时不再加载该块
+	if err := bm.writeFlagsLocked(blockID, header.Flags|BlockFlagDeleted); err != nil {
+		logger.Error("标记块删除失败", "blockID", blockID, "error", err)
+		return err
+	}
+
 	// 删除块信息
 	delete(bm.blockMap, blockID)
-	delete(bm.blockCache, blockID)
-	bm.freeList = append(bm.freeList, blockID)
+	delete(bm.offsets, blockID)
+	bm.cacheDelete(blockID)
+	bm.removeAttributesLocked(blockID)
 	bm.isDirty = true
 
-	// 注意：实际的文件空间不会立即释放，需要通过OptimizeBlocks进行碎片整理
-
 	return nil
 }
 
@@ -333,13 +613,34 @@ func (bm *blockManagerImpl) LinkBlocks(sourceID, targetID uint32) error {
 	targetHeader.PreviousBlock = sourceID
 
 	// 更新块头信息
-	bm.blockMap[sourceID] = sourceHeader
-	bm.blockMap[targetID] = targetHeader
+	if err := bm.persistLinksLocked(sourceHeader); err != nil {
+		logger.Error("更新块链接失败", "blockID", sourceID, "error", err)
+		return err
+	}
+	if err := bm.persistLinksLocked(targetHeader); err != nil {
+		logger.Error("更新块链接失败", "blockID", targetID, "error", err)
+		return err
+	}
 	bm.isDirty = true
 
 	return nil
 }
 
+// ListBlocks 按块ID顺序返回所有有效块的头信息副本
+func (bm *blockManagerImpl) ListBlocks() []*BlockHeader {
+	bm.mutex.RLock()
+	defer bm.mutex.RUnlock()
+
+	headers := make([]*BlockHeader, 0, len(bm.blockMap))
+	for _, header := range bm.blockMap {
+		copied := *header
+		headers = append(headers, &copied)
+	}
+	sort.Slice(headers, func(i, j int) bool { return headers[i].BlockID < headers[j].BlockID })
+
+	return headers
+}
+
 // GetBlockInfo 获取块信息
 func (bm *blockManagerImpl) GetBlockInfo(blockID uint32) (*BlockHeader, error) {
 	bm.mutex.RLock()
@@ -402,6 +703,64 @@ func (bm *blockManagerImpl) getNextBlockID() uint32 {
 	return bm.nextBlockID
 }
 
+// loadBlockHeaders 顺序扫描块区，加载所有未删除块的头信息和偏移
+func (bm *blockManagerImpl) loadBlockHeaders() error {
+	offset := bm.fragmentaHeader.BlockOffset
+	end := offset + bm.fragmentaHeader.BlockSize
+
+	for offset < end {
+		if _, err := bm.file.Seek(int64(offset), io.SeekStart); err != nil {
+			return err
+		}
+
+		header := &BlockHeader{}
+		if err := binary.Read(bm.file, binary.BigEndian, header); err != nil {
+			return fmt.Errorf("读取偏移%d处的块头失败: %w", offset, err)
+		}
+
+		if header.BlockID > bm.nextBlockID {
+			bm.nextBlockID = header.BlockID
+		}
+		if header.Flags&BlockFlagDeleted == 0 {
+			bm.blockMap[header.BlockID] = header
+			bm.offsets[header.BlockID] = offset
+		}
+
+		offset += BlockHeaderSize + uint64(header.Size)
+	}
+
+	return nil
+}
+
+// writeFlagsLocked 在文件中原地更新块标志
+func (bm *blockManagerImpl) writeFlagsLocked(blockID uint32, flags uint8) error {
+	offset, ok := bm.offsets[blockID]
+	if !ok {
+		return nil
+	}
+
+	if _, err := bm.file.Seek(int64(offset)+blockFlagsOffset, io.SeekStart); err != nil {
+		return err
+	}
+	return binary.Write(bm.file, binary.BigEndian, flags)
+}
+
+// persistLinksLocked 在文件中原地更新块的前后链接
+func (bm *blockManagerImpl) persistLinksLocked(header *BlockHeader) error {
+	offset, ok := bm.offsets[header.BlockID]
+	if !ok {
+		return nil
+	}
+
+	if _, err := bm.file.Seek(int64(offset)+blockLinksOffset, io.SeekStart); err != nil {
+		return err
+	}
+	if err := binary.Write(bm.file, binary.BigEndian, header.PreviousBlock); err != nil {
+		return err
+	}
+	return binary.Write(bm.file, binary.BigEndian, header.NextBlock)
+}
+
 // readBlockHeader 从文件中读取块头信息
 func (bm *blockManagerImpl) readBlockHeader(blockID uint32) (*BlockHeader, error) {
 	// 获取所有块的索引信息
@@ -500,6 +859,11 @@ func (bm *blockManagerImpl) readBlockHeader(blockID uint32) (*BlockHeader, error
 				return nil, err
 			}
 
+			// 已删除的块不再可见
+			if header.Flags&BlockFlagDeleted != 0 {
+				return nil, ErrBlockNotFound
+			}
+
 			return header, nil
 		}
 
@@ -536,6 +900,29 @@ func (bm *blockManagerImpl) readBlockHeader(blockID uint32) (*BlockHeader, error
 
 // readBlockData 从文件中读取块数据
 func (bm *blockManagerImpl) readBlockData(header *BlockHeader) ([]byte, error) {
+	// 块大小来自磁盘，文件损坏时按它分配内存可能耗尽内存
+	if uint64(header.Size) > bm.fragmentaHeader.BlockSize {
+		logger.Error("块大小超出块区", "blockID", header.BlockID, "size", header.Size, "blockRegion", bm.fragmentaHeader.BlockSize)
+		return nil, fmt.Errorf("%w: 块%d的大小%d超出块区", ErrInvalidFragmenta, header.BlockID, header.Size)
+	}
+
+	// 已知偏移时直接定位
+	if offset, ok := bm.offsets[header.BlockID]; ok {
+		if start := offset + BlockHeaderSize; bm.mapped != nil && start+uint64(header.Size) <= uint64(len(bm.mapped)) {
+			return append([]byte(nil), bm.mapped[start:start+uint64(header.Size)]...), nil
+		}
+		data := make([]byte, header.Size)
+		if _, err := bm.file.Seek(int64(offset+BlockHeaderSize), io.SeekStart); err != nil {
+			logger.Error("移动文件指针失败", "blockID", header.BlockID, "error", err)
+			return nil, err
+		}
+		if _, err := io.ReadFull(bm.file, data); err != nil {
+			logger.Error("读取块数据失败", "blockID", header.BlockID, "error", err)
+			return nil, err
+		}
+		return data, nil
+	}
+
 	// 特殊情况：如果是第一个块，直接从数据区开始处读取
 	if header.BlockID == 1 && bm.fragmentaHeader.BlockOffset > 0 {
 		// 定位到块数据起始位置
@@ -0,0 +1,225 @@
+// Package clock 提供可注入的时钟
+//
+// 冷热块判断、密钥过期、查询缓存过期以及自动转换、重平衡等后台任务都通过Clock获取时间和创建定时器。
+// 生产环境使用System，测试使用Fake手动推进时间，不需要真实等待。
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock 时钟
+type Clock interface {
+	// Now 返回当前时间
+	Now() time.Time
+	// Since 返回从t到现在经过的时间
+	Since(t time.Time) time.Duration
+	// After 在d之后向返回的通道发送当时的时间
+	After(d time.Duration) <-chan time.Time
+	// Sleep 等待d
+	Sleep(d time.Duration)
+	// NewTicker 创建周期为d的定时器，d必须大于0
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker 周期定时器
+type Ticker interface {
+	// C 返回接收触发时间的通道，接收方来不及处理时丢弃多余的触发
+	C() <-chan time.Time
+	// Stop 停止定时器，不关闭通道
+	Stop()
+	// Reset 停止定时器并把周期改为d，下一次在d之后触发
+	Reset(d time.Duration)
+}
+
+// System 使用系统时间的时钟
+var System Clock = systemClock{}
+
+// OrSystem c为nil时返回System，用于配置中未设置时钟的情况
+func OrSystem(c Clock) Clock {
+	if c == nil {
+		return System
+	}
+	return c
+}
+
+// systemClock 系统时钟
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (systemClock) Sleep(d time.Duration)                  { time.Sleep(d) }
+func (systemClock) NewTicker(d time.Duration) Ticker       { return systemTicker{time.NewTicker(d)} }
+
+// systemTicker 包装time.Ticker
+type systemTicker struct{ ticker *time.Ticker }
+
+func (t systemTicker) C() <-chan time.Time   { return t.ticker.C }
+func (t systemTicker) Stop()                 { t.ticker.Stop() }
+func (t systemTicker) Reset(d time.Duration) { t.ticker.Reset(d) }
+
+// Fake 手动推进的时钟。时间只在调用Advance或Set时变化，
+// 到期的After通道和定时器在推进时按到期顺序触发
+type Fake struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*fakeWaiter
+}
+
+// fakeWaiter 等待到期的After通道或定时器
+type fakeWaiter struct {
+	at     time.Time
+	period time.Duration // 0表示只触发一次
+	ch     chan time.Time
+}
+
+// NewFake 创建从start开始的手动时钟
+func NewFake(start time.Time) *Fake {
+	f := &Fake{now: start}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+// Now 返回当前时间
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Since 返回从t到现在经过的时间
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// After 在时间推进d之后向返回的通道发送当时的时间
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	return f.add(d, 0).ch
+}
+
+// Sleep 阻塞直到其他协程把时间推进d
+func (f *Fake) Sleep(d time.Duration) {
+	<-f.After(d)
+}
+
+// NewTicker 创建周期为d的定时器
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	return &fakeTicker{clock: f, waiter: f.add(d, d)}
+}
+
+// add 注册一个等待者
+func (f *Fake) add(d, period time.Duration) *fakeWaiter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w := &fakeWaiter{at: f.now.Add(d), period: period, ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.ch <- f.now
+		return w
+	}
+	f.waiters = append(f.waiters, w)
+	f.cond.Broadcast()
+	return w
+}
+
+// remove 取消一个等待者
+func (f *Fake) remove(w *fakeWaiter) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, waiter := range f.waiters {
+		if waiter == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+// Advance 把时间推进d，触发期间到期的After通道和定时器
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.advanceTo(f.now.Add(d))
+}
+
+// Set 把时间设置为t，t早于当前时间时只修改时间，不触发任何等待者
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t.Before(f.now) {
+		f.now = t
+		return
+	}
+	f.advanceTo(t)
+}
+
+// advanceTo 按到期顺序触发到target为止的等待者（调用者持有锁）
+func (f *Fake) advanceTo(target time.Time) {
+	for {
+		sort.SliceStable(f.waiters, func(i, j int) bool { return f.waiters[i].at.Before(f.waiters[j].at) })
+		if len(f.waiters) == 0 || f.waiters[0].at.After(target) {
+			break
+		}
+
+		w := f.waiters[0]
+		f.now = w.at
+		select {
+		case w.ch <- w.at:
+		default:
+		}
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+		} else {
+			f.waiters = f.waiters[1:]
+		}
+	}
+	f.now = target
+}
+
+// BlockUntil 阻塞直到有n个等待中的After通道、Sleep或定时器，
+// 用于确认后台协程已经开始等待后再推进时间
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+// fakeTicker 手动时钟的定时器
+type fakeTicker struct {
+	clock  *Fake
+	waiter *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.waiter.ch }
+func (t *fakeTicker) Stop()               { t.clock.remove(t.waiter) }
+
+// Reset 重新注册等待者，未接收的触发保留在通道中
+func (t *fakeTicker) Reset(d time.Duration) {
+	if d <= 0 {
+		panic("clock: non-positive interval for Ticker.Reset")
+	}
+
+	f := t.clock
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, waiter := range f.waiters {
+		if waiter == t.waiter {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			break
+		}
+	}
+	t.waiter.at = f.now.Add(d)
+	t.waiter.period = d
+	f.waiters = append(f.waiters, t.waiter)
+	f.cond.Broadcast()
+}
@@ -0,0 +1,88 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+// TestFakeAdvance 测试手动时钟按到期顺序触发After通道和定时器
+func TestFakeAdvance(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewFake(start)
+
+	after := c.After(90 * time.Second)
+	ticker := c.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	c.Advance(59 * time.Second)
+	select {
+	case <-ticker.C():
+		t.Fatal("定时器提前触发")
+	case <-after:
+		t.Fatal("After提前触发")
+	default:
+	}
+
+	c.Advance(time.Second)
+	if got := <-ticker.C(); !got.Equal(start.Add(time.Minute)) {
+		t.Errorf("定时器触发时间不正确: %v", got)
+	}
+
+	// 一次推进多个周期时，来不及接收的触发被丢弃
+	c.Advance(5 * time.Minute)
+	if got := <-after; !got.Equal(start.Add(90 * time.Second)) {
+		t.Errorf("After触发时间不正确: %v", got)
+	}
+	if got := <-ticker.C(); !got.Equal(start.Add(2 * time.Minute)) {
+		t.Errorf("定时器应保留第一次未接收的触发: %v", got)
+	}
+	select {
+	case <-ticker.C():
+		t.Error("多余的触发应被丢弃")
+	default:
+	}
+	if c.Since(start) != 6*time.Minute {
+		t.Errorf("当前时间不正确: %v", c.Now())
+	}
+
+	// 重置周期后从当前时间重新计时
+	ticker.Reset(10 * time.Minute)
+	c.Advance(9 * time.Minute)
+	select {
+	case <-ticker.C():
+		t.Fatal("重置后的定时器提前触发")
+	default:
+	}
+	c.Advance(time.Minute)
+	if got := <-ticker.C(); !got.Equal(start.Add(16 * time.Minute)) {
+		t.Errorf("重置后触发时间不正确: %v", got)
+	}
+
+	ticker.Stop()
+	c.Advance(time.Hour)
+	select {
+	case <-ticker.C():
+		t.Error("停止后的定时器不应触发")
+	default:
+	}
+}
+
+// TestFakeSleep 测试后台协程的Sleep在推进时间后返回
+func TestFakeSleep(t *testing.T) {
+	c := NewFake(time.Unix(0, 0))
+	done := make(chan struct{})
+	go func() {
+		c.Sleep(2 * time.Minute)
+		close(done)
+	}()
+
+	c.BlockUntil(1)
+	c.Advance(time.Minute)
+	select {
+	case <-done:
+		t.Fatal("Sleep提前返回")
+	default:
+	}
+	c.Advance(time.Minute)
+	<-done
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bpfs/fragmenta/bench"
+)
+
+// runBench 在默认的存储配置上执行默认的工作负载，输出CSV或JSON报告
+func runBench(args []string, stdout io.Writer) error {
+	fs := newFlagSet("bench")
+	workloadNames := fs.String("workload", "", "只执行这些工作负载，逗号分隔")
+	targetNames := fs.String("target", "", "只使用这些存储配置，逗号分隔")
+	operations := fs.Int("ops", 0, "覆盖每个工作负载的操作数")
+	concurrency := fs.Int("concurrency", 0, "覆盖每个工作负载的并发数")
+	seed := fs.Int64("seed", 0, "覆盖每个工作负载的随机种子")
+	format := fs.String("format", "csv", "输出格式: csv或json")
+	dir := fs.String("dir", "", "临时文件所在目录，默认为系统临时目录")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+	if *format != "csv" && *format != "json" {
+		return fmt.Errorf("%w: 未知的输出格式 %s", errUsage, *format)
+	}
+
+	workloads, err := selectByName(bench.DefaultWorkloads(), *workloadNames, func(w bench.Workload) string { return w.Name })
+	if err != nil {
+		return err
+	}
+	targets, err := selectByName(bench.DefaultTargets(), *targetNames, func(t bench.Target) string { return t.Name })
+	if err != nil {
+		return err
+	}
+	for i := range workloads {
+		if *operations > 0 {
+			workloads[i].Operations = *operations
+		}
+		if *concurrency > 0 {
+			workloads[i].Concurrency = *concurrency
+		}
+		if *seed != 0 {
+			workloads[i].Seed = *seed
+		}
+	}
+
+	results, err := bench.RunMatrix(*dir, workloads, targets)
+	if err != nil {
+		return err
+	}
+	if *format == "json" {
+		return bench.WriteJSON(stdout, results)
+	}
+	return bench.WriteCSV(stdout, results)
+}
+
+// selectByName 按逗号分隔的名称选择，names为空时返回全部
+func selectByName[T any](all []T, names string, name func(T) string) ([]T, error) {
+	if names == "" {
+		return all, nil
+	}
+	var selected []T
+	for _, want := range strings.Split(names, ",") {
+		found := false
+		for _, item := range all {
+			if name(item) == strings.TrimSpace(want) {
+				selected = append(selected, item)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: 未知的名称 %s", errUsage, want)
+		}
+	}
+	return selected, nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/bpfs/fragmenta/config"
+)
+
+// runCheckConfig 检查配置文件，列出全部问题
+func runCheckConfig(args []string, stdout io.Writer) error {
+	fs := newFlagSet("check-config")
+	format := fs.String("format", "text", "输出格式: text或json")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("%w: 未知的输出格式 %s", errUsage, *format)
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	// 按扩展名选择JSON、YAML或TOML，拒绝未知字段，拼错的字段名会被发现而不是被忽略
+	var cfg config.Config
+	if err := config.UnmarshalStrict(data, &cfg, config.FormatForPath(fs.Arg(0))); err != nil {
+		return fmt.Errorf("解析配置文件失败: %w", err)
+	}
+
+	issues := config.ValidateConfig(&cfg)
+	if *format == "json" {
+		if issues == nil {
+			issues = []config.Issue{}
+		}
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(issues); err != nil {
+			return err
+		}
+	} else if len(issues) == 0 {
+		fmt.Fprintln(stdout, "配置有效")
+	} else {
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		for _, issue := range issues {
+			fmt.Fprintf(tw, "%s\t%s\t%s (当前值: %v)\n", issue.Severity, issue.Field, issue.Message, issue.Value)
+		}
+		tw.Flush()
+	}
+
+	if config.HasErrors(issues) {
+		return fmt.Errorf("%w: %s", config.ErrInvalidConfig, fs.Arg(0))
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bpfs/fragmenta/security"
+)
+
+// keystoreEnv 未指定-keystore时使用的环境变量
+const keystoreEnv = "FRAGCTL_KEYSTORE"
+
+// passphraseEnv 密钥库口令，设置后密钥库以口令派生的密钥加密
+const passphraseEnv = "FRAGCTL_KEYSTORE_PASSPHRASE"
+
+// keyTypes 可生成的密钥类型
+var keyTypes = map[string]security.KeyType{
+	"symmetric": security.SymmetricKey,
+	"rsa":       security.RSAPrivateKey,
+	"ec":        security.ECPrivateKey,
+	"ed25519":   security.ED25519PrivateKey,
+}
+
+// runKey 管理密钥库中的密钥
+func runKey(args []string, stdout io.Writer) error {
+	fs := newFlagSet("key")
+	keystore := fs.String("keystore", os.Getenv(keystoreEnv), "密钥库目录，默认取环境变量"+keystoreEnv)
+	if err := parseFlags(fs, args, 1, -1); err != nil {
+		return err
+	}
+	if *keystore == "" {
+		return fmt.Errorf("%w: 需要指定-keystore或设置%s", errUsage, keystoreEnv)
+	}
+
+	ctx := context.Background()
+	storage, err := openKeyStore(ctx, *keystore)
+	if err != nil {
+		return err
+	}
+	km := security.NewDefaultKeyManager(storage)
+
+	op, opArgs := fs.Arg(0), fs.Args()[1:]
+	switch op {
+	case "list":
+		return listKeys(ctx, km, opArgs, stdout)
+	case "generate":
+		return generateKey(ctx, km, opArgs, stdout)
+	case "rotate":
+		return rotateKey(ctx, km, opArgs, stdout)
+	case "delete":
+		if len(opArgs) != 1 {
+			return errUsage
+		}
+		if err := km.DeleteKey(ctx, opArgs[0]); err != nil {
+			return fmt.Errorf("删除密钥失败: %w", err)
+		}
+		return nil
+	case "export":
+		if len(opArgs) != 1 {
+			return errUsage
+		}
+		key, err := km.ExportKey(ctx, opArgs[0])
+		if err != nil {
+			return fmt.Errorf("导出密钥失败: %w", err)
+		}
+		fmt.Fprintln(stdout, hex.EncodeToString(key))
+		return nil
+	case "csr":
+		return createCSR(ctx, km, opArgs, stdout)
+	case "import-cert":
+		if len(opArgs) != 2 {
+			return errUsage
+		}
+		certPEM, err := os.ReadFile(opArgs[1])
+		if err != nil {
+			return fmt.Errorf("读取证书失败: %w", err)
+		}
+		if err := km.ImportCertificate(ctx, opArgs[0], certPEM); err != nil {
+			return fmt.Errorf("导入证书失败: %w", err)
+		}
+		return nil
+	case "export-cert":
+		if len(opArgs) != 1 {
+			return errUsage
+		}
+		certPEM, err := km.ExportCertificate(ctx, opArgs[0])
+		if err != nil {
+			return fmt.Errorf("导出证书失败: %w", err)
+		}
+		_, err = stdout.Write(certPEM)
+		return err
+	default:
+		return fmt.Errorf("%w: 未知的密钥操作 %q", errUsage, op)
+	}
+}
+
+// openKeyStore 打开密钥库。设置了口令或密钥库已加密时用口令解锁，并加密其中的明文密钥
+func openKeyStore(ctx context.Context, dir string) (security.SecureStorage, error) {
+	storage, err := security.NewFileSecureStorage(dir)
+	if err != nil {
+		return nil, fmt.Errorf("打开密钥库失败: %w", err)
+	}
+
+	provider := security.NewPassphraseKeyProvider(dir, 0)
+	passphrase := os.Getenv(passphraseEnv)
+	if passphrase == "" {
+		if provider.Initialized() {
+			return nil, fmt.Errorf("密钥库已加密，需要设置%s", passphraseEnv)
+		}
+		return storage, nil
+	}
+
+	if err := provider.Unlock([]byte(passphrase)); err != nil {
+		return nil, fmt.Errorf("解锁密钥库失败: %w", err)
+	}
+	wrapped := security.NewWrappedSecureStorage(storage, provider)
+	if _, err := wrapped.WrapExisting(ctx); err != nil {
+		return nil, fmt.Errorf("加密密钥库失败: %w", err)
+	}
+	return wrapped, nil
+}
+
+// createCSR 为密钥对生成PEM编码的证书签名请求
+func createCSR(ctx context.Context, km *security.DefaultKeyManager, args []string, stdout io.Writer) error {
+	fs := newFlagSet("key csr")
+	commonName := fs.String("cn", "", "证书主体的通用名称")
+	organization := fs.String("o", "", "证书主体的组织")
+	dnsNames := fs.String("dns", "", "逗号分隔的DNS名称")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	template := &x509.CertificateRequest{Subject: pkix.Name{CommonName: *commonName}}
+	if *organization != "" {
+		template.Subject.Organization = []string{*organization}
+	}
+	if *dnsNames != "" {
+		template.DNSNames = strings.Split(*dnsNames, ",")
+	}
+	csr, err := km.CreateCSR(ctx, fs.Arg(0), template)
+	if err != nil {
+		return fmt.Errorf("生成证书签名请求失败: %w", err)
+	}
+	_, err = stdout.Write(csr)
+	return err
+}
+
+// listKeys 列出密钥及其类型、大小、用途和有效期
+func listKeys(ctx context.Context, km *security.DefaultKeyManager, args []string, stdout io.Writer) error {
+	fs := newFlagSet("key list")
+	typeName := fs.String("type", "", "只列出该类型的密钥，如SYMMETRIC、RSA_PRIVATE")
+	usage := fs.String("usage", "", "只列出该用途的密钥: encryption、signing或derive")
+	expiring := fs.Duration("expiring", 0, "只列出在该时长内到期（包括已过期）的密钥")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	filter := &security.KeyFilter{Usage: security.KeyUsage(*usage)}
+	if *typeName != "" {
+		filter.Types = []security.KeyType{security.KeyType(strings.ToUpper(*typeName))}
+	}
+	now := time.Now()
+	if *expiring > 0 {
+		filter.ExpiresBefore = now.Add(*expiring)
+	}
+	list, err := km.ListKeyEntries(ctx, filter)
+	if err != nil {
+		return fmt.Errorf("列出密钥失败: %w", err)
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\t类型\t大小\t用途\t创建时间\t过期时间")
+	for _, key := range list.Keys {
+		expires := "-"
+		if !key.ExpiresAt.IsZero() {
+			expires = key.ExpiresAt.Format(time.DateTime)
+			if key.Expired(now) {
+				expires += " (已过期)"
+			}
+		}
+		size := "-"
+		if key.Size > 0 {
+			size = strconv.Itoa(key.Size)
+		}
+		usages := make([]string, len(key.Usage))
+		for i, u := range key.Usage {
+			usages[i] = string(u)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", key.ID, key.Type, size, strings.Join(usages, ","),
+			key.CreatedAt.Format(time.DateTime), expires)
+	}
+	return tw.Flush()
+}
+
+// generateKey 生成密钥，非对称类型生成密钥对
+func generateKey(ctx context.Context, km *security.DefaultKeyManager, args []string, stdout io.Writer) error {
+	fs := newFlagSet("key generate")
+	typeName := fs.String("type", "symmetric", "密钥类型: symmetric、rsa、ec或ed25519")
+	size := fs.Int("size", 0, "密钥大小（比特），默认对称密钥256、RSA 2048、EC 256（可选384）")
+	rotateDays := fs.Int("rotate-days", 0, "轮换间隔（天），到期后密钥不可再使用")
+	usage := fs.String("usage", "", "密钥用途，多个以逗号分隔: encryption、signing、derive，默认按类型推断")
+	if err := parseFlags(fs, args, 0, 0); err != nil {
+		return err
+	}
+
+	keyType, ok := keyTypes[strings.ToLower(*typeName)]
+	if !ok {
+		return fmt.Errorf("%w: 未知的密钥类型 %q", errUsage, *typeName)
+	}
+	if *size == 0 {
+		*size = 256
+		if keyType == security.RSAPrivateKey {
+			*size = 2048
+		}
+	}
+
+	options := &security.KeyOptions{Type: keyType, Size: *size}
+	if *usage != "" {
+		for _, u := range strings.Split(*usage, ",") {
+			options.Usage = append(options.Usage, security.KeyUsage(strings.TrimSpace(u)))
+		}
+	}
+	if *rotateDays > 0 {
+		options.RotationPolicy = &security.RotationPolicy{IntervalSeconds: int64(*rotateDays) * 24 * 3600}
+	}
+
+	if keyType == security.SymmetricKey {
+		id, err := km.GenerateKey(ctx, keyType, options)
+		if err != nil {
+			return fmt.Errorf("生成密钥失败: %w", err)
+		}
+		fmt.Fprintln(stdout, id)
+		return nil
+	}
+
+	pair, err := km.GenerateKeyPair(ctx, keyType, options)
+	if err != nil {
+		return fmt.Errorf("生成密钥对失败: %w", err)
+	}
+	fmt.Fprintf(stdout, "私钥: %s\n公钥: %s\n", pair.PrivateKeyID, pair.PublicKeyID)
+	return nil
+}
+
+// rotateKey 轮换密钥并打印新密钥ID
+func rotateKey(ctx context.Context, km *security.DefaultKeyManager, args []string, stdout io.Writer) error {
+	fs := newFlagSet("key rotate")
+	deleteOld := fs.Bool("delete-old", false, "轮换后删除旧密钥")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	oldID := fs.Arg(0)
+	newID, err := km.RotateKey(ctx, oldID, nil)
+	if err != nil {
+		return fmt.Errorf("轮换密钥失败: %w", err)
+	}
+	if *deleteOld {
+		if err := km.DeleteKey(ctx, oldID); err != nil {
+			return fmt.Errorf("删除旧密钥失败: %w", err)
+		}
+	}
+	fmt.Fprintln(stdout, newID)
+	return nil
+}
@@ -0,0 +1,293 @@
+// fragctl 是检查和操作FragDB存储文件的命令行工具
+//
+// 用法:
+//
+//	fragctl <命令> [参数] <文件> ...
+//
+// 支持的命令见 fragctl help
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bpfs/fragmenta"
+	"github.com/bpfs/fragmenta/errcode"
+)
+
+// errUsage 参数错误，调用方应打印用法
+var errUsage = errors.New("参数错误")
+
+// command 子命令
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string, stdout io.Writer) error
+}
+
+// commands 按帮助输出顺序排列的子命令
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{"create", "create [-mode 存储模式] <文件>", "创建新的存储文件", runCreate},
+		{"info", "info <文件>", "显示文件头和存储统计", runInfo},
+		{"inspect", "inspect [-indent] <文件> ...", "输出JSON格式的检查报告，每个文件一行", runInspect},
+		{"ls", "ls <文件> [目录]", "列出数据块，指定目录时列出命名空间中的文件", runLs},
+		{"get", "get [-o 输出文件] <文件> <块ID>", "读取数据块", runGet},
+		{"put", "put [-i 输入文件] [-type 块类型] [-checksum] [-append 块ID] <文件>", "写入数据块并打印块ID", runPut},
+		{"meta", "meta get|set|delete|list [-format 格式] <文件> [标签] [值]", "读写元数据", runMeta},
+		{"query", "query [-op 操作符] [-format 格式] [-limit n] <文件> <标签> <值>", "按条件查询元数据", runQuery},
+		{"verify", "verify <文件>", "读取所有数据块并校验校验和", runVerify},
+		{"convert-mode", "convert-mode <文件> container|directory", "转换存储模式", runConvertMode},
+		{"migrate", "migrate [-dry-run] [-no-backup] [-backup 备份文件] <文件>", "把旧版本文件升级到当前格式版本", runMigrate},
+		{"check-config", "check-config [-format text|json] <配置文件>", "检查配置文件并列出全部问题", runCheckConfig},
+		{"bench", "bench [-workload 名称,...] [-target 名称,...] [-ops n] [-concurrency n] [-seed n] [-format csv|json] [-dir 目录]", "执行基准工作负载并输出性能报告", runBench},
+		{"key", "key -keystore <目录> list|generate|rotate|delete|export|csr|import-cert|export-cert [参数]", "管理密钥", runKey},
+	}
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout); err != nil {
+		printError(os.Stderr, err, errcode.LangFromEnv())
+		if errors.Is(err, errUsage) {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+// printError 输出错误，有错误码时先输出错误码和按lang本地化的消息，再输出详细信息
+func printError(w io.Writer, err error, lang errcode.Lang) {
+	if errcode.Of(err) != "" {
+		fmt.Fprintf(w, "fragctl: %s\n", errcode.Localize(err, lang))
+		fmt.Fprintf(w, "  %v\n", err)
+		return
+	}
+	fmt.Fprintf(w, "fragctl: %v\n", err)
+}
+
+// run 执行一条命令，便于测试
+func run(args []string, stdout io.Writer) error {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(stdout)
+		return nil
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			err := cmd.run(args[1:], stdout)
+			if errors.Is(err, errUsage) {
+				return fmt.Errorf("%w\n用法: fragctl %s", err, cmd.usage)
+			}
+			return err
+		}
+	}
+
+	printUsage(stdout)
+	return fmt.Errorf("%w: 未知命令 %q", errUsage, args[0])
+}
+
+// printUsage 打印命令列表
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "fragctl - FragDB存储文件工具")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "用法:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  fragctl %s\n", cmd.usage)
+		fmt.Fprintf(w, "        %s\n", cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "标签可以是名称(title、author等)、数字(4、0x1001)或用户标签(user:1)")
+	fmt.Fprintln(w, "值格式(-format)可以是 string、int、hex 或 auto")
+}
+
+// newFlagSet 创建子命令参数集，错误由run统一输出
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parseFlags 解析参数并检查位置参数数量
+func parseFlags(fs *flag.FlagSet, args []string, minArgs, maxArgs int) error {
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	if fs.NArg() < minArgs || (maxArgs >= 0 && fs.NArg() > maxArgs) {
+		return errUsage
+	}
+	return nil
+}
+
+// openStore 打开存储文件
+func openStore(path string) (fragmenta.FragDB, error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	db, err := fragmenta.OpenFragmenta(path)
+	if err != nil {
+		return nil, fmt.Errorf("打开%s失败: %w", path, err)
+	}
+	return db, nil
+}
+
+// withStore 打开存储文件执行fn，结束后关闭，关闭时会提交未保存的更改
+func withStore(path string, fn func(db fragmenta.FragDB) error) (err error) {
+	db, err := openStore(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := db.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("关闭%s失败: %w", path, closeErr)
+		}
+	}()
+	return fn(db)
+}
+
+// tagNames 系统标签名称
+var tagNames = map[string]uint16{
+	"version":        fragmenta.TagVersion,
+	"create-time":    fragmenta.TagCreateTime,
+	"last-modified":  fragmenta.TagLastModified,
+	"title":          fragmenta.TagTitle,
+	"description":    fragmenta.TagDescription,
+	"author":         fragmenta.TagAuthor,
+	"content-type":   fragmenta.TagContentType,
+	"content-size":   fragmenta.TagContentSize,
+	"fragmenta-type": fragmenta.TagFragmentaType,
+	"flags":          fragmenta.TagFlags,
+	"namespace":      fragmenta.TagNamespace,
+}
+
+// intTags 值为int64编码的系统标签
+var intTags = map[uint16]bool{
+	fragmenta.TagVersion:      true,
+	fragmenta.TagCreateTime:   true,
+	fragmenta.TagLastModified: true,
+	fragmenta.TagContentSize:  true,
+	fragmenta.TagNamespace:    true,
+}
+
+// parseTag 解析标签名称或数字
+func parseTag(s string) (uint16, error) {
+	if tag, ok := tagNames[strings.ToLower(s)]; ok {
+		return tag, nil
+	}
+	if id, ok := strings.CutPrefix(s, "user:"); ok {
+		n, err := strconv.ParseUint(id, 0, 16)
+		if err != nil || n > 0x0FFF {
+			return 0, fmt.Errorf("%w: 无效的用户标签 %q", errUsage, s)
+		}
+		return fragmenta.UserTag(uint16(n)), nil
+	}
+	n, err := strconv.ParseUint(s, 0, 16)
+	if err != nil {
+		return 0, fmt.Errorf("%w: 无效的标签 %q", errUsage, s)
+	}
+	return uint16(n), nil
+}
+
+// tagName 返回标签的显示名称
+func tagName(tag uint16) string {
+	for name, t := range tagNames {
+		if t == tag {
+			return name
+		}
+	}
+	if fragmenta.IsUserTag(tag) {
+		return fmt.Sprintf("user:%d", tag-0x1000)
+	}
+	return fmt.Sprintf("0x%04X", tag)
+}
+
+// parseValue 按格式解析元数据值
+func parseValue(tag uint16, value, format string) ([]byte, error) {
+	if format == "auto" {
+		format = "string"
+		if intTags[tag] {
+			format = "int"
+		}
+	}
+
+	switch format {
+	case "string":
+		return []byte(value), nil
+	case "int":
+		n, err := strconv.ParseInt(value, 0, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 无效的整数 %q", errUsage, value)
+		}
+		return fragmenta.EncodeInt64(n), nil
+	case "hex":
+		data, err := hex.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 无效的十六进制 %q", errUsage, value)
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("%w: 未知的值格式 %q", errUsage, format)
+	}
+}
+
+// formatValue 按格式显示元数据值，auto时整数标签按整数、可打印文本按字符串、其余按十六进制显示
+func formatValue(tag uint16, data []byte, format string) string {
+	if format == "auto" {
+		switch {
+		case intTags[tag] && len(data) == 8:
+			format = "int"
+		case utf8.Valid(data) && isPrintable(string(data)):
+			format = "string"
+		default:
+			format = "hex"
+		}
+	}
+
+	switch format {
+	case "int":
+		return strconv.FormatInt(fragmenta.DecodeInt64(data), 10)
+	case "hex":
+		return hex.EncodeToString(data)
+	default:
+		return string(data)
+	}
+}
+
+// isPrintable 检查字符串是否不含控制字符
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if r < 0x20 && r != '\t' && r != '\n' {
+			return false
+		}
+	}
+	return true
+}
+
+// sortedTags 返回排序后的标签列表
+func sortedTags(metadata map[uint16][]byte) []uint16 {
+	tags := make([]uint16, 0, len(metadata))
+	for tag := range metadata {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	return tags
+}
+
+// parseBlockID 解析块ID
+func parseBlockID(s string) (uint32, error) {
+	n, err := strconv.ParseUint(s, 0, 32)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("%w: 无效的块ID %q", errUsage, s)
+	}
+	return uint32(n), nil
+}
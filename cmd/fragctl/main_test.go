@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bpfs/fragmenta/config"
+	"github.com/bpfs/fragmenta/errcode"
+)
+
+// runOutput 执行命令并返回标准输出
+func runOutput(t *testing.T, args ...string) string {
+	t.Helper()
+
+	var stdout bytes.Buffer
+	if err := run(args, &stdout); err != nil {
+		t.Fatalf("fragctl %s 失败: %v", strings.Join(args, " "), err)
+	}
+	return stdout.String()
+}
+
+// TestFragctlCommands 测试创建存储、读写块和元数据并在每条命令之间重新打开文件
+func TestFragctlCommands(t *testing.T) {
+	dir := t.TempDir()
+	store := filepath.Join(dir, "store.frag")
+	input := filepath.Join(dir, "input.txt")
+	if err := os.WriteFile(input, []byte("hello fragctl"), 0644); err != nil {
+		t.Fatalf("写入输入文件失败: %v", err)
+	}
+
+	runOutput(t, "create", store)
+	if err := run([]string{"create", store}, &bytes.Buffer{}); err == nil {
+		t.Errorf("文件已存在时create应失败")
+	}
+
+	first := strings.TrimSpace(runOutput(t, "put", "-i", input, store))
+	second := strings.TrimSpace(runOutput(t, "put", "-i", input, "-append", first, store))
+	if first != "1" || second != "2" {
+		t.Fatalf("块ID不正确: %s %s", first, second)
+	}
+
+	if got := runOutput(t, "get", store, second); got != "hello fragctl" {
+		t.Errorf("读取的块内容不正确: %q", got)
+	}
+
+	out := runOutput(t, "ls", store)
+	if !strings.Contains(out, "normal") || strings.Count(out, "\n") != 3 {
+		t.Errorf("块列表不正确:\n%s", out)
+	}
+
+	runOutput(t, "meta", "set", store, "title", "测试存储")
+	runOutput(t, "meta", "set", "-format", "int", store, "user:1", "42")
+	if got := runOutput(t, "meta", "get", store, "title"); got != "测试存储\n" {
+		t.Errorf("读取的标题不正确: %q", got)
+	}
+	if got := runOutput(t, "meta", "get", "-format", "int", store, "user:1"); got != "42\n" {
+		t.Errorf("读取的用户标签不正确: %q", got)
+	}
+
+	// 写入块后元数据区会移动，创建时写入的元数据应仍然存在
+	if out := runOutput(t, "meta", "list", store); !strings.Contains(out, "fragmenta-type  FragDB") {
+		t.Errorf("元数据列表不正确:\n%s", out)
+	}
+
+	out = runOutput(t, "query", store, "title", "测试存储")
+	if !strings.Contains(out, "title") || !strings.Contains(out, "匹配1项") {
+		t.Errorf("查询结果不正确:\n%s", out)
+	}
+
+	out = runOutput(t, "info", store)
+	if !strings.Contains(out, "container") || !strings.Contains(out, "2 (数据 26 字节)") {
+		t.Errorf("文件信息不正确:\n%s", out)
+	}
+
+	out = runOutput(t, "inspect", store)
+	if !strings.Contains(out, `"blocks":{"count":2,"dataBytes":26`) {
+		t.Errorf("检查报告不正确:\n%s", out)
+	}
+
+	out = runOutput(t, "verify", store)
+	if !strings.Contains(out, "2个校验通过") {
+		t.Errorf("校验结果不正确:\n%s", out)
+	}
+
+	if out := runOutput(t, "migrate", "-dry-run", store); !strings.Contains(out, "无需升级") {
+		t.Errorf("新文件不应需要升级:\n%s", out)
+	}
+
+	// 未知命令和缺少参数都是用法错误
+	if err := run([]string{"frobnicate"}, &bytes.Buffer{}); !errors.Is(err, errUsage) {
+		t.Errorf("未知命令应返回用法错误: %v", err)
+	}
+	if err := run([]string{"get", store}, &bytes.Buffer{}); !errors.Is(err, errUsage) {
+		t.Errorf("缺少参数应返回用法错误: %v", err)
+	}
+
+	// 有错误码的错误按语言输出错误码和消息，再输出详细信息
+	err := run([]string{"get", store, "99"}, &bytes.Buffer{})
+	var stderr bytes.Buffer
+	printError(&stderr, err, errcode.English)
+	if !strings.HasPrefix(stderr.String(), "fragctl: [fragmenta.block_not_found] block not found\n  ") {
+		t.Errorf("错误输出不正确:\n%s", stderr.String())
+	}
+}
+
+// TestFragctlCheckConfig 测试配置文件检查
+func TestFragctlCheckConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+
+	cfg := config.NewDefaultConfigManager().GetDefaultConfig()
+	data, _ := json.Marshal(cfg)
+	os.WriteFile(path, data, 0644)
+	if out := runOutput(t, "check-config", path); !strings.Contains(out, "配置有效") {
+		t.Errorf("默认配置应有效:\n%s", out)
+	}
+
+	cfg.Storage.BlockStrategy.BlockCacheSize = -1
+	cfg.Storage.CacheStrategy.CachePolicy = "mru"
+	cfg.Index.Shards = 0
+	data, _ = json.Marshal(cfg)
+	os.WriteFile(path, data, 0644)
+	var stdout bytes.Buffer
+	err := run([]string{"check-config", path}, &stdout)
+	if !errors.Is(err, config.ErrInvalidConfig) {
+		t.Errorf("无效配置应返回ErrInvalidConfig: %v", err)
+	}
+	for _, field := range []string{"storage.blockStrategy.blockCacheSize", "storage.cacheStrategy.cachePolicy", "index.shards"} {
+		if !strings.Contains(stdout.String(), field) {
+			t.Errorf("应报告%s:\n%s", field, stdout.String())
+		}
+	}
+
+	os.WriteFile(path, []byte(`{"storage": {"blockSise": 4096}}`), 0644)
+	if err := run([]string{"check-config", path}, &bytes.Buffer{}); err == nil || !strings.Contains(err.Error(), "blockSise") {
+		t.Errorf("未知字段应报错: %v", err)
+	}
+
+	// YAML和TOML按扩展名识别
+	for _, format := range []config.Format{config.FormatYAML, config.FormatTOML} {
+		path := filepath.Join(dir, "config."+string(format))
+		data, err := config.Marshal(config.NewDefaultConfigManager().GetDefaultConfig(), format)
+		if err != nil {
+			t.Fatalf("序列化%s失败: %v", format, err)
+		}
+		os.WriteFile(path, data, 0644)
+		if out := runOutput(t, "check-config", path); !strings.Contains(out, "配置有效") {
+			t.Errorf("%s格式的默认配置应有效:\n%s", format, out)
+		}
+	}
+
+	yamlPath := filepath.Join(dir, "ops.yml")
+	os.WriteFile(yamlPath, []byte("# 运维配置\nstorage:\n  cacheStrategy:\n    cachePolicy: mru  # 不支持\nindex:\n  enabled: true\n  types: [name, tag]\n  shards: 0\n"), 0644)
+	stdout.Reset()
+	if err := run([]string{"check-config", yamlPath}, &stdout); !errors.Is(err, config.ErrInvalidConfig) {
+		t.Errorf("无效的YAML配置应返回ErrInvalidConfig: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "storage.cacheStrategy.cachePolicy") || !strings.Contains(stdout.String(), "index.shards") {
+		t.Errorf("YAML配置的问题未报告:\n%s", stdout.String())
+	}
+}
+
+// TestFragctlKey 测试密钥生成、列出、轮换和删除
+func TestFragctlKey(t *testing.T) {
+	keystore := t.TempDir()
+
+	id := strings.TrimSpace(runOutput(t, "key", "-keystore", keystore, "generate", "-size", "128"))
+	if id == "" {
+		t.Fatalf("生成的密钥ID为空")
+	}
+	if exported := strings.TrimSpace(runOutput(t, "key", "-keystore", keystore, "export", id)); len(exported) != 32 {
+		t.Errorf("导出的128位密钥长度不正确: %q", exported)
+	}
+
+	newID := strings.TrimSpace(runOutput(t, "key", "-keystore", keystore, "rotate", "-delete-old", id))
+	out := runOutput(t, "key", "-keystore", keystore, "list")
+	if strings.Contains(out, id) || !strings.Contains(out, newID) {
+		t.Errorf("轮换后的密钥列表不正确:\n%s", out)
+	}
+
+	runOutput(t, "key", "-keystore", keystore, "delete", newID)
+	if out := runOutput(t, "key", "-keystore", keystore, "list"); strings.Contains(out, newID) {
+		t.Errorf("删除后密钥仍在列表中:\n%s", out)
+	}
+
+	// EC密钥对可以生成证书签名请求
+	pairOut := runOutput(t, "key", "-keystore", keystore, "generate", "-type", "ec")
+	privateID := strings.TrimSpace(strings.TrimPrefix(strings.Split(pairOut, "\n")[0], "私钥:"))
+	if csr := runOutput(t, "key", "-keystore", keystore, "csr", "-cn", "fragctl", privateID); !strings.Contains(csr, "BEGIN CERTIFICATE REQUEST") {
+		t.Errorf("证书签名请求格式不正确:\n%s", csr)
+	}
+	if out := runOutput(t, "key", "-keystore", keystore, "list", "-usage", "signing"); !strings.Contains(out, privateID) {
+		t.Errorf("按用途列出的密钥不正确:\n%s", out)
+	}
+	if out := runOutput(t, "key", "-keystore", keystore, "list", "-type", "symmetric"); strings.Contains(out, privateID) {
+		t.Errorf("按类型列出的密钥不应包含EC私钥:\n%s", out)
+	}
+
+	// 设置口令后已有的密钥被加密，之后没有口令无法打开密钥库
+	id = strings.TrimSpace(runOutput(t, "key", "-keystore", keystore, "generate"))
+	t.Setenv(passphraseEnv, "correct horse")
+	if out := runOutput(t, "key", "-keystore", keystore, "list"); !strings.Contains(out, id) {
+		t.Errorf("加密后的密钥列表不正确:\n%s", out)
+	}
+	exported := strings.TrimSpace(runOutput(t, "key", "-keystore", keystore, "export", id))
+	t.Setenv(passphraseEnv, "wrong")
+	if err := run([]string{"key", "-keystore", keystore, "export", id}, io.Discard); err == nil {
+		t.Errorf("口令错误时不应能导出密钥")
+	}
+	t.Setenv(passphraseEnv, "")
+	if err := run([]string{"key", "-keystore", keystore, "list"}, io.Discard); err == nil {
+		t.Errorf("没有口令时不应能打开加密的密钥库")
+	}
+	t.Setenv(passphraseEnv, "correct horse")
+	if again := strings.TrimSpace(runOutput(t, "key", "-keystore", keystore, "export", id)); again != exported {
+		t.Errorf("重新解锁后导出的密钥不一致: %s != %s", again, exported)
+	}
+}
+
+// TestFragctlBench 测试按名称选择工作负载和存储配置并输出报告
+func TestFragctlBench(t *testing.T) {
+	out := runOutput(t, "bench", "-workload", "mixed-query", "-target", "container,store-container-lru", "-ops", "40", "-dir", t.TempDir())
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 1+2*4 || !strings.HasPrefix(lines[1], "mixed-query,container,") {
+		t.Errorf("CSV报告不正确:\n%s", out)
+	}
+
+	if err := run([]string{"bench", "-workload", "unknown"}, &bytes.Buffer{}); !errors.Is(err, errUsage) {
+		t.Errorf("未知的工作负载应返回参数错误: %v", err)
+	}
+}
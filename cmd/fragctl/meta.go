@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bpfs/fragmenta"
+)
+
+// queryOperators 查询操作符名称
+var queryOperators = map[string]uint8{
+	"eq":       fragmenta.OpEquals,
+	"ne":       fragmenta.OpNotEquals,
+	"gt":       fragmenta.OpGreaterThan,
+	"lt":       fragmenta.OpLessThan,
+	"contains": fragmenta.OpContains,
+}
+
+// runMeta 读写元数据
+func runMeta(args []string, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	op := args[0]
+	fs := newFlagSet("meta " + op)
+	format := fs.String("format", "auto", "值格式: string、int、hex或auto")
+
+	switch op {
+	case "list":
+		if err := parseFlags(fs, args[1:], 1, 1); err != nil {
+			return err
+		}
+		return withStore(fs.Arg(0), func(db fragmenta.FragDB) error {
+			metadata, err := db.ListMetadata()
+			if err != nil {
+				return err
+			}
+			tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+			for _, tag := range sortedTags(metadata) {
+				fmt.Fprintf(tw, "0x%04X\t%s\t%s\n", tag, tagName(tag), formatValue(tag, metadata[tag], *format))
+			}
+			return tw.Flush()
+		})
+
+	case "get":
+		if err := parseFlags(fs, args[1:], 2, 2); err != nil {
+			return err
+		}
+		tag, err := parseTag(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		return withStore(fs.Arg(0), func(db fragmenta.FragDB) error {
+			value, err := db.GetMetadata(tag)
+			if err != nil {
+				return fmt.Errorf("读取标签%s失败: %w", tagName(tag), err)
+			}
+			fmt.Fprintln(stdout, formatValue(tag, value, *format))
+			return nil
+		})
+
+	case "set":
+		if err := parseFlags(fs, args[1:], 3, 3); err != nil {
+			return err
+		}
+		tag, err := parseTag(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		value, err := parseValue(tag, fs.Arg(2), *format)
+		if err != nil {
+			return err
+		}
+		return withStore(fs.Arg(0), func(db fragmenta.FragDB) error {
+			if err := db.SetMetadata(tag, value); err != nil {
+				return fmt.Errorf("设置标签%s失败: %w", tagName(tag), err)
+			}
+			return db.Commit()
+		})
+
+	case "delete":
+		if err := parseFlags(fs, args[1:], 2, 2); err != nil {
+			return err
+		}
+		tag, err := parseTag(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		return withStore(fs.Arg(0), func(db fragmenta.FragDB) error {
+			if err := db.DeleteMetadata(tag); err != nil {
+				return fmt.Errorf("删除标签%s失败: %w", tagName(tag), err)
+			}
+			return db.Commit()
+		})
+
+	default:
+		return fmt.Errorf("%w: 未知的元数据操作 %q", errUsage, op)
+	}
+}
+
+// runQuery 按条件查询元数据
+func runQuery(args []string, stdout io.Writer) error {
+	fs := newFlagSet("query")
+	opName := fs.String("op", "eq", "操作符: eq、ne、gt、lt或contains")
+	format := fs.String("format", "auto", "值格式: string、int、hex或auto")
+	limit := fs.Uint("limit", 0, "最多返回的结果数，0表示不限制")
+	if err := parseFlags(fs, args, 3, 3); err != nil {
+		return err
+	}
+
+	op, ok := queryOperators[strings.ToLower(*opName)]
+	if !ok {
+		return fmt.Errorf("%w: 未知的操作符 %q", errUsage, *opName)
+	}
+	tag, err := parseTag(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	value, err := parseValue(tag, fs.Arg(2), *format)
+	if err != nil {
+		return err
+	}
+
+	return withStore(fs.Arg(0), func(db fragmenta.FragDB) error {
+		result, err := db.QueryMetadata(&fragmenta.MetadataQuery{
+			Conditions: []fragmenta.MetadataCondition{{Tag: tag, Operator: op, Value: value}},
+			Limit:      uint32(*limit),
+		})
+		if err != nil {
+			return fmt.Errorf("查询失败: %w", err)
+		}
+
+		entries := result.Entries
+		sort.Slice(entries, func(i, j int) bool { return entries[i].MetadataID < entries[j].MetadataID })
+
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		for _, entry := range entries {
+			fmt.Fprintf(tw, "0x%04X\t%s\t%s\n", entry.MetadataID, tagName(entry.MetadataID), formatValue(entry.MetadataID, entry.MetadataData, *format))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "匹配%d项, 返回%d项\n", result.TotalCount, result.ReturnCount)
+		return nil
+	})
+}
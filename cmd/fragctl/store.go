@@ -0,0 +1,442 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/bpfs/fragmenta"
+)
+
+// storageModeNames 存储模式名称
+var storageModeNames = map[uint8]string{
+	fragmenta.ContainerMode: "container",
+	fragmenta.DirectoryMode: "directory",
+	fragmenta.HybridMode:    "hybrid",
+}
+
+// blockTypeNames 块类型名称
+var blockTypeNames = map[uint8]string{
+	fragmenta.NormalBlockType:      "normal",
+	fragmenta.MetadataBlockType:    "metadata",
+	fragmenta.IndexBlockType:       "index",
+	fragmenta.DeltaBlockType:       "delta",
+	fragmenta.XORBlockType:         "xor",
+	fragmenta.CompressionBlockType: "compressed",
+	fragmenta.EncryptedBlockType:   "encrypted",
+	fragmenta.IndirectBlockType:    "indirect",
+	fragmenta.SystemBlockType:      "system",
+}
+
+// runCreate 创建新的存储文件，文件已存在时报错
+func runCreate(args []string, stdout io.Writer) error {
+	fs := newFlagSet("create")
+	modeFlag := fs.String("mode", "container", "存储模式: container、directory或hybrid")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	mode, ok := parseMode(*modeFlag)
+	if !ok {
+		return fmt.Errorf("%w: 未知的存储模式 %q", errUsage, *modeFlag)
+	}
+	if _, err := os.Stat(fs.Arg(0)); err == nil {
+		return fmt.Errorf("%s已存在", fs.Arg(0))
+	}
+
+	db, err := fragmenta.CreateFragmenta(fs.Arg(0), &fragmenta.FragmentaOptions{
+		StorageMode:       mode,
+		BlockSize:         fragmenta.DefaultBlockSize,
+		IndexUpdateMode:   fragmenta.IndexUpdateRealtime,
+		MaxIndexCacheSize: fragmenta.DefaultIndexCacheSize,
+	})
+	if err != nil {
+		return fmt.Errorf("创建%s失败: %w", fs.Arg(0), err)
+	}
+	return db.Close()
+}
+
+// runInfo 显示文件头和存储统计
+func runInfo(args []string, stdout io.Writer) error {
+	fs := newFlagSet("info")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	return withStore(fs.Arg(0), func(db fragmenta.FragDB) error {
+		header := db.GetHeader()
+		blocks, err := db.ListBlocks()
+		if err != nil {
+			return err
+		}
+		metadata, err := db.ListMetadata()
+		if err != nil {
+			return err
+		}
+
+		trash, err := db.ListTrash()
+		if err != nil {
+			return err
+		}
+
+		var dataSize, trashSize uint64
+		for _, block := range blocks {
+			dataSize += uint64(block.Size)
+		}
+		trashBlocks := 0
+		for _, entry := range trash {
+			if entry.IsBlock() {
+				trashBlocks++
+				trashSize += uint64(entry.Size)
+			}
+		}
+
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintf(tw, "文件:\t%s\n", fs.Arg(0))
+		fmt.Fprintf(tw, "魔数:\t0x%08X\n", header.Magic)
+		fmt.Fprintf(tw, "版本:\t%d.%d\n", header.Version>>8, header.Version&0xFF)
+		fmt.Fprintf(tw, "标志:\t0x%04X\n", header.Flags)
+		fmt.Fprintf(tw, "文件头代数:\t%d\n", header.Generation)
+		fmt.Fprintf(tw, "存储模式:\t%s\n", modeName(header.StorageMode))
+		fmt.Fprintf(tw, "创建时间:\t%s\n", formatNanos(header.Timestamp))
+		fmt.Fprintf(tw, "修改时间:\t%s\n", formatNanos(header.LastModified))
+		fmt.Fprintf(tw, "元数据区:\t偏移 %d, 大小 %d\n", header.MetadataOffset, header.MetadataSize)
+		fmt.Fprintf(tw, "块区:\t偏移 %d, 大小 %d\n", header.BlockOffset, header.BlockSize)
+		fmt.Fprintf(tw, "索引区:\t偏移 %d, 大小 %d\n", header.IndexOffset, header.IndexSize)
+		fmt.Fprintf(tw, "文件大小:\t%d\n", header.TotalSize)
+		fmt.Fprintf(tw, "元数据项:\t%d\n", len(metadata))
+		fmt.Fprintf(tw, "数据块:\t%d (数据 %d 字节)\n", len(blocks), dataSize)
+		if len(trash) > 0 {
+			fmt.Fprintf(tw, "回收站:\t%d 个块 (数据 %d 字节), %d 个元数据项\n", trashBlocks, trashSize, len(trash)-trashBlocks)
+		}
+		return tw.Flush()
+	})
+}
+
+// runInspect 输出检查报告，默认每个文件一行JSON，便于批量审计时逐行处理
+// 无法打开的文件输出包含path和error的对象，并在最后返回错误
+func runInspect(args []string, stdout io.Writer) error {
+	fs := newFlagSet("inspect")
+	indent := fs.Bool("indent", false, "缩进输出")
+	if err := parseFlags(fs, args, 1, -1); err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(stdout)
+	if *indent {
+		encoder.SetIndent("", "  ")
+	}
+
+	failed := 0
+	for _, path := range fs.Args() {
+		var v interface{}
+		report, err := fragmenta.Inspect(path)
+		if err != nil {
+			failed++
+			v = map[string]string{"path": path, "error": err.Error()}
+		} else {
+			v = report
+		}
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d个文件检查失败", failed)
+	}
+	return nil
+}
+
+// runLs 列出数据块或命名空间目录
+func runLs(args []string, stdout io.Writer) error {
+	fs := newFlagSet("ls")
+	if err := parseFlags(fs, args, 1, 2); err != nil {
+		return err
+	}
+
+	return withStore(fs.Arg(0), func(db fragmenta.FragDB) error {
+		if fs.NArg() == 2 {
+			return listNamespace(db, fs.Arg(1), stdout)
+		}
+
+		blocks, err := db.ListBlocks()
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\t类型\t标志\t大小\t前块\t后块\t创建时间")
+		for _, block := range blocks {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%d\t%s\t%s\t%s\n",
+				block.BlockID, blockTypeName(block.BlockType), blockFlagsString(block.Flags), block.Size,
+				linkString(block.PreviousBlock), linkString(block.NextBlock), formatNanos(block.Timestamp))
+		}
+		return tw.Flush()
+	})
+}
+
+// listNamespace 列出命名空间中的目录
+func listNamespace(db fragmenta.FragDB, dir string, stdout io.Writer) error {
+	ns, err := db.Namespace()
+	if err != nil {
+		return err
+	}
+
+	dir = path.Clean("/" + dir)
+	entries, err := ns.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	for _, entry := range entries {
+		info, err := ns.Stat(path.Join(dir, entry.Name))
+		if err != nil {
+			continue
+		}
+		name := entry.Name
+		if info.IsDir() {
+			name += "/"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", info.Mode(), info.Size(), info.ModTime().Format(time.DateTime), name)
+	}
+	return tw.Flush()
+}
+
+// runGet 读取数据块
+func runGet(args []string, stdout io.Writer) error {
+	fs := newFlagSet("get")
+	output := fs.String("o", "", "输出文件，默认写到标准输出")
+	if err := parseFlags(fs, args, 2, 2); err != nil {
+		return err
+	}
+	blockID, err := parseBlockID(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	return withStore(fs.Arg(0), func(db fragmenta.FragDB) error {
+		data, err := db.ReadBlock(blockID)
+		if err != nil {
+			return fmt.Errorf("读取块%d失败: %w", blockID, err)
+		}
+		if *output != "" {
+			return os.WriteFile(*output, data, 0644)
+		}
+		_, err = stdout.Write(data)
+		return err
+	})
+}
+
+// runPut 写入数据块
+func runPut(args []string, stdout io.Writer) error {
+	fs := newFlagSet("put")
+	input := fs.String("i", "", "输入文件，默认从标准输入读取")
+	blockType := fs.Uint("type", uint(fragmenta.NormalBlockType), "块类型")
+	checksum := fs.Bool("checksum", true, "计算校验和")
+	appendTo := fs.Uint("append", 0, "链接到指定块之后")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+	if *blockType > 0xFF {
+		return fmt.Errorf("%w: 无效的块类型 %d", errUsage, *blockType)
+	}
+
+	var data []byte
+	var err error
+	if *input != "" {
+		data, err = os.ReadFile(*input)
+	} else {
+		data, err = io.ReadAll(os.Stdin)
+	}
+	if err != nil {
+		return err
+	}
+
+	return withStore(fs.Arg(0), func(db fragmenta.FragDB) error {
+		blockID, err := db.WriteBlock(data, &fragmenta.BlockOptions{
+			BlockType:       uint8(*blockType),
+			Checksum:        *checksum,
+			AppendToBlockID: uint32(*appendTo),
+		})
+		if err != nil {
+			return fmt.Errorf("写入数据块失败: %w", err)
+		}
+		fmt.Fprintln(stdout, blockID)
+		return nil
+	})
+}
+
+// runVerify 读取所有数据块并校验校验和，有块损坏时返回错误
+func runVerify(args []string, stdout io.Writer) error {
+	fs := newFlagSet("verify")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	return withStore(fs.Arg(0), func(db fragmenta.FragDB) error {
+		blocks, err := db.ListBlocks()
+		if err != nil {
+			return err
+		}
+
+		var verified, unchecked, failed int
+		for _, block := range blocks {
+			data, err := db.ReadBlock(block.BlockID)
+			switch {
+			case err != nil:
+				failed++
+				fmt.Fprintf(stdout, "块%d: 读取失败: %v\n", block.BlockID, err)
+			case uint32(len(data)) != block.Size:
+				failed++
+				fmt.Fprintf(stdout, "块%d: 大小不匹配: 期望%d, 实际%d\n", block.BlockID, block.Size, len(data))
+			case block.Flags&fragmenta.BlockFlagChecksum == 0:
+				unchecked++
+			case md5.Sum(data) != block.Checksum:
+				failed++
+				fmt.Fprintf(stdout, "块%d: 校验和不匹配\n", block.BlockID)
+			default:
+				verified++
+			}
+		}
+
+		fmt.Fprintf(stdout, "共%d个块: %d个校验通过, %d个无校验和, %d个失败\n", len(blocks), verified, unchecked, failed)
+		if failed > 0 {
+			return fmt.Errorf("%d个块校验失败", failed)
+		}
+		return nil
+	})
+}
+
+// runConvertMode 转换存储模式
+func runConvertMode(args []string, stdout io.Writer) error {
+	fs := newFlagSet("convert-mode")
+	if err := parseFlags(fs, args, 2, 2); err != nil {
+		return err
+	}
+
+	return withStore(fs.Arg(0), func(db fragmenta.FragDB) error {
+		mode, _ := parseMode(fs.Arg(1))
+		var err error
+		switch mode {
+		case fragmenta.DirectoryMode:
+			err = db.ConvertToDirectoryMode()
+		case fragmenta.ContainerMode:
+			err = db.ConvertToContainerMode()
+		default:
+			return fmt.Errorf("%w: 只能转换为container或directory模式", errUsage)
+		}
+		if err != nil {
+			return fmt.Errorf("从%s模式转换失败: %w", modeName(db.GetHeader().StorageMode), err)
+		}
+		if err := db.Commit(); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "存储模式: %s\n", modeName(db.GetHeader().StorageMode))
+		return nil
+	})
+}
+
+// runMigrate 升级旧版本文件
+func runMigrate(args []string, stdout io.Writer) error {
+	fs := newFlagSet("migrate")
+	dryRun := fs.Bool("dry-run", false, "只打印迁移计划")
+	noBackup := fs.Bool("no-backup", false, "不备份原文件")
+	backupPath := fs.String("backup", "", "备份文件路径")
+	if err := parseFlags(fs, args, 1, 1); err != nil {
+		return err
+	}
+
+	report, err := fragmenta.MigrateFile(fs.Arg(0), &fragmenta.MigrationOptions{
+		DryRun:     *dryRun,
+		Backup:     !*noBackup,
+		BackupPath: *backupPath,
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(report.Steps) == 0 {
+		fmt.Fprintln(stdout, "已是当前版本，无需升级")
+		return nil
+	}
+	for _, step := range report.Steps {
+		fmt.Fprintln(stdout, step)
+	}
+	if report.BackupPath != "" {
+		fmt.Fprintf(stdout, "备份: %s\n", report.BackupPath)
+	}
+	if !report.DryRun {
+		fmt.Fprintf(stdout, "已升级到%d.%d\n", report.ToVersion>>8, report.ToVersion&0xFF)
+	}
+	return nil
+}
+
+// parseMode 解析存储模式名称
+func parseMode(name string) (uint8, bool) {
+	for mode, modeName := range storageModeNames {
+		if modeName == strings.ToLower(name) {
+			return mode, true
+		}
+	}
+	return 0, false
+}
+
+// modeName 返回存储模式名称
+func modeName(mode uint8) string {
+	if name, ok := storageModeNames[mode]; ok {
+		return name
+	}
+	return fmt.Sprintf("unknown(%d)", mode)
+}
+
+// blockTypeName 返回块类型名称
+func blockTypeName(blockType uint8) string {
+	if name, ok := blockTypeNames[blockType]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%02X", blockType)
+}
+
+// blockFlagsString 将块标志显示为字母组合：c压缩、e加密、s校验和
+func blockFlagsString(flags uint8) string {
+	var b strings.Builder
+	for _, f := range []struct {
+		flag uint8
+		char byte
+	}{
+		{fragmenta.BlockFlagCompressed, 'c'},
+		{fragmenta.BlockFlagEncrypted, 'e'},
+		{fragmenta.BlockFlagChecksum, 's'},
+	} {
+		if flags&f.flag != 0 {
+			b.WriteByte(f.char)
+		} else {
+			b.WriteByte('-')
+		}
+	}
+	return b.String()
+}
+
+// linkString 显示块链接，0表示无
+func linkString(blockID uint32) string {
+	if blockID == 0 {
+		return "-"
+	}
+	return fmt.Sprint(blockID)
+}
+
+// formatNanos 格式化纳秒时间戳
+func formatNanos(nanos int64) string {
+	if nanos == 0 {
+		return "-"
+	}
+	return time.Unix(0, nanos).Format(time.DateTime)
+}
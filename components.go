@@ -0,0 +1,191 @@
+package fragmenta
+
+import (
+	"sort"
+
+	"github.com/bpfs/fragmenta/index"
+)
+
+// BlockStore 块数据存储接口，由存储层实现（storage.StorageManager满足该接口）
+type BlockStore interface {
+	// WriteBlock 以指定ID写入块数据，已存在时覆盖
+	WriteBlock(id uint32, data []byte) error
+	// ReadBlock 读取块数据
+	ReadBlock(id uint32) ([]byte, error)
+	// DeleteBlock 删除块数据
+	DeleteBlock(id uint32) error
+}
+
+// SetBlockStore 设置块数据存储，并将现有块的数据复制到存储中
+// 设置之后块数据的写入、读取和删除都经过存储，从而使用存储层的缓存、分层和加密；
+// 格式文件仍保存块头和一份块数据，store为nil时恢复直接读取格式文件。
+// 目录模式下打开的块数据目录被替换
+func (f *FragmentaImpl) SetBlockStore(store BlockStore) error {
+	f.componentMutex.Lock()
+	defer f.componentMutex.Unlock()
+
+	if store != nil {
+		for _, header := range f.blockManager.ListBlocks() {
+			data, err := f.blockManager.ReadBlock(header.BlockID)
+			if err != nil {
+				logger.Error("读取数据块失败", "blockID", header.BlockID, "error", err)
+				return err
+			}
+			if err := store.WriteBlock(header.BlockID, data); err != nil {
+				logger.Error("复制数据块到块存储失败", "blockID", header.BlockID, "error", err)
+				return err
+			}
+		}
+	}
+
+	f.closeBlockDirectoryLocked()
+	f.blockStore = store
+	return nil
+}
+
+// SetIndexManager 设置标签索引管理器，需在 StartQueryService 之前调用
+// 之后写入的块的元数据标签（BlockOptions.MetadataTags）记入该索引管理器，
+// 可以用 tag:字段 条件查询；未设置时在首次需要时创建内存索引管理器
+func (f *FragmentaImpl) SetIndexManager(indexManager index.IndexManager) error {
+	f.componentMutex.Lock()
+	defer f.componentMutex.Unlock()
+
+	if f.queryService != nil {
+		return ErrInvalidOperation
+	}
+
+	f.indexManager = indexManager
+	f.blockTags = nil
+	return nil
+}
+
+// indexManagerLocked 返回标签索引管理器，未设置时创建（调用方需持有componentMutex写锁）
+func (f *FragmentaImpl) indexManagerLocked() (index.IndexManager, error) {
+	if f.indexManager != nil {
+		return f.indexManager, nil
+	}
+
+	im, err := index.NewIndexManager(nil)
+	if err != nil {
+		logger.Error("创建索引管理器失败", "error", err)
+		return nil, err
+	}
+	f.indexManager = im
+	return im, nil
+}
+
+// getBlockStore 返回块数据存储，未设置时返回nil
+func (f *FragmentaImpl) getBlockStore() BlockStore {
+	f.componentMutex.RLock()
+	defer f.componentMutex.RUnlock()
+
+	return f.blockStore
+}
+
+// storeBlock 将新写入的块数据写入块数据存储
+func (f *FragmentaImpl) storeBlock(blockID uint32, data []byte) error {
+	store := f.getBlockStore()
+	if store == nil {
+		return nil
+	}
+
+	if err := store.WriteBlock(blockID, data); err != nil {
+		logger.Error("写入块存储失败", "blockID", blockID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// unstoreBlock 从块数据存储中删除块数据
+func (f *FragmentaImpl) unstoreBlock(blockID uint32) error {
+	store := f.getBlockStore()
+	if store == nil {
+		return nil
+	}
+
+	if err := store.DeleteBlock(blockID); err != nil {
+		logger.Error("从块存储删除数据块失败", "blockID", blockID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// indexBlockTags 将块的元数据标签记入标签索引
+// 元数据标签不随块保存，重新打开文件后需要重新写入块才能按标签查询
+func (f *FragmentaImpl) indexBlockTags(blockID uint32, metadataTags map[uint16][]byte) error {
+	if len(metadataTags) == 0 {
+		return nil
+	}
+
+	f.componentMutex.Lock()
+	defer f.componentMutex.Unlock()
+
+	im, err := f.indexManagerLocked()
+	if err != nil {
+		return err
+	}
+
+	tags := make([]uint32, 0, len(metadataTags))
+	for tag := range metadataTags {
+		tags = append(tags, uint32(tag))
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	if err := im.IndexMetadata(blockID, tags); err != nil {
+		logger.Error("索引块元数据标签失败", "blockID", blockID, "error", err)
+		return err
+	}
+
+	if f.blockTags == nil {
+		f.blockTags = make(map[uint32][]uint32)
+	}
+	f.blockTags[blockID] = tags
+	return nil
+}
+
+// indexBlockValues 将块的元数据标签中已注册的标签按类型解码，记录下来并索引到查询服务
+// 与元数据标签一样不随块保存
+func (f *FragmentaImpl) indexBlockValues(blockID uint32, metadataTags map[uint16][]byte) error {
+	values := f.MetadataSchema().indexValues(metadataTags)
+	if len(values) == 0 {
+		return nil
+	}
+
+	f.componentMutex.Lock()
+	defer f.componentMutex.Unlock()
+
+	if f.blockValues == nil {
+		f.blockValues = make(map[uint32]map[string]interface{})
+	}
+	f.blockValues[blockID] = values
+
+	if f.queryService != nil {
+		if err := f.queryService.IndexBlockValues(blockID, values); err != nil {
+			logger.Error("索引块元数据值失败", "blockID", blockID, "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// removeBlockTags 从标签索引中移除块的元数据标签
+func (f *FragmentaImpl) removeBlockTags(blockID uint32) error {
+	f.componentMutex.Lock()
+	defer f.componentMutex.Unlock()
+
+	delete(f.blockValues, blockID)
+
+	tags, ok := f.blockTags[blockID]
+	if !ok {
+		return nil
+	}
+	delete(f.blockTags, blockID)
+
+	for _, tag := range tags {
+		if err := f.indexManager.RemoveIndex(tag, blockID); err != nil {
+			logger.Error("移除块元数据标签索引失败", "blockID", blockID, "tag", tag, "error", err)
+			return err
+		}
+	}
+	return nil
+}
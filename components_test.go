@@ -0,0 +1,200 @@
+package fragmenta
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/bpfs/fragmenta/index"
+	"github.com/bpfs/fragmenta/storage"
+)
+
+// TestBlockStore 测试设置块数据存储后块数据的写入、读取和删除经过存储管理器
+func TestBlockStore(t *testing.T) {
+	tempDir := t.TempDir()
+
+	f, err := CreateFragmenta(filepath.Join(tempDir, "test.frag"), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	defer f.(*FragmentaImpl).file.Close()
+
+	// 设置存储前写入的块
+	id1, err := f.WriteBlock([]byte("before"), nil)
+	if err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+
+	sm, err := storage.NewStorageManager(&storage.StorageConfig{
+		Type:      storage.StorageTypeContainer,
+		Path:      filepath.Join(tempDir, "container.db"),
+		BlockSize: 1024,
+	})
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+	defer sm.Close()
+
+	if err := f.SetBlockStore(sm); err != nil {
+		t.Fatalf("设置块数据存储失败: %v", err)
+	}
+	if data, err := sm.ReadBlock(id1); err != nil || string(data) != "before" {
+		t.Errorf("设置存储时应复制已有块: %q, %v", data, err)
+	}
+
+	id2, err := f.WriteBlock([]byte("after"), nil)
+	if err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	if data, err := sm.ReadBlock(id2); err != nil || string(data) != "after" {
+		t.Errorf("写入块应经过块数据存储: %q, %v", data, err)
+	}
+
+	// 读取经过块数据存储
+	if err := sm.WriteBlock(id2, []byte("changed")); err != nil {
+		t.Fatalf("写入存储失败: %v", err)
+	}
+	if data, err := f.ReadBlock(id2); err != nil || string(data) != "changed" {
+		t.Errorf("读取块应经过块数据存储: %q, %v", data, err)
+	}
+
+	if err := f.DeleteBlock(id2); err != nil {
+		t.Fatalf("删除块失败: %v", err)
+	}
+	if _, err := sm.ReadBlock(id2); err == nil {
+		t.Errorf("删除块后存储中不应再有块数据")
+	}
+
+	// 移除存储后直接读取格式文件
+	if err := f.SetBlockStore(nil); err != nil {
+		t.Fatalf("移除块数据存储失败: %v", err)
+	}
+	if data, err := f.ReadBlock(id1); err != nil || string(data) != "before" {
+		t.Errorf("移除存储后读取块失败: %q, %v", data, err)
+	}
+}
+
+// TestBlockStoreConcurrentWriteDelete 测试并发写入和删除时，删除释放的块ID被重新使用不会丢失新块在存储中的数据
+func TestBlockStoreConcurrentWriteDelete(t *testing.T) {
+	tempDir := t.TempDir()
+	f, err := CreateFragmenta(filepath.Join(tempDir, "test.frag"), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	defer f.(*FragmentaImpl).file.Close()
+
+	sm, err := storage.NewStorageManager(&storage.StorageConfig{
+		Type:      storage.StorageTypeDirectory,
+		Path:      filepath.Join(tempDir, "blocks"),
+		BlockSize: 1024,
+	})
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+	defer sm.Close()
+	if err := f.SetBlockStore(sm); err != nil {
+		t.Fatalf("设置块数据存储失败: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var live []uint32
+			for j := 0; j < 300; j++ {
+				if j%3 == 2 {
+					id := live[len(live)-1]
+					live = live[:len(live)-1]
+					if err := f.DeleteBlock(id); err != nil {
+						errs <- fmt.Errorf("删除块%d失败: %w", id, err)
+						return
+					}
+					continue
+				}
+				id, err := f.WriteBlock([]byte("block"), &BlockOptions{Attributes: map[string]string{AttrTenant: "a"}})
+				if err != nil {
+					errs <- err
+					return
+				}
+				live = append(live, id)
+			}
+			for _, id := range live {
+				if _, err := sm.ReadBlock(id); err != nil {
+					errs <- fmt.Errorf("存储中缺少块%d: %w", id, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// TestBlockMetadataTags 测试块元数据标签记入标签索引并可通过查询服务查询
+func TestBlockMetadataTags(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "fragdb-tags-*.bin")
+	if err != nil {
+		t.Fatalf("创建临时文件失败: %v", err)
+	}
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	f, err := CreateFragmenta(tempFile.Name(), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	defer f.(*FragmentaImpl).file.Close()
+
+	im, err := index.NewIndexManager(nil)
+	if err != nil {
+		t.Fatalf("创建索引管理器失败: %v", err)
+	}
+	if err := f.SetIndexManager(im); err != nil {
+		t.Fatalf("设置索引管理器失败: %v", err)
+	}
+
+	id1, err := f.WriteBlock([]byte("a"), &BlockOptions{MetadataTags: map[uint16][]byte{TagTitle: []byte("a")}})
+	if err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	id2, err := f.WriteBlock([]byte("b"), &BlockOptions{MetadataTags: map[uint16][]byte{TagTitle: nil, TagAuthor: nil}})
+	if err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+
+	if ids, _ := im.FindByTag(uint32(TagTitle)); !reflect.DeepEqual(ids, []uint32{id1, id2}) {
+		t.Errorf("元数据标签应记入索引管理器: %v", ids)
+	}
+
+	if err := f.StartQueryService(); err != nil {
+		t.Fatalf("启动查询服务失败: %v", err)
+	}
+	if err := f.SetIndexManager(nil); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("查询服务启动后不能更换索引管理器: %v", err)
+	}
+
+	result, err := f.Query("tag:meta==" + strconv.Itoa(int(TagAuthor)))
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if got := queryBlockIDs(result); !reflect.DeepEqual(got, []uint32{id2}) {
+		t.Errorf("按标签查询结果不正确: %v", got)
+	}
+
+	if err := f.DeleteBlock(id1); err != nil {
+		t.Fatalf("删除块失败: %v", err)
+	}
+	if ids, _ := im.FindByTag(uint32(TagTitle)); !reflect.DeepEqual(ids, []uint32{id2}) {
+		t.Errorf("删除块后应移除其标签索引: %v", ids)
+	}
+}
@@ -1,16 +1,26 @@
 package config
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 )
 
+// ErrConfigVersionNotFound 变更日志中没有指定版本
+var ErrConfigVersionNotFound = errors.New("config version not found")
+
 // ConfigChangeEntry 配置变更记录项
 type ConfigChangeEntry struct {
+	// 版本号，从1开始递增，跨日志轮转保持连续；旧版本写入的记录为0
+	Version uint64 `json:"version"`
+
 	// 变更时间
 	Timestamp time.Time `json:"timestamp"`
 
@@ -20,10 +30,10 @@ type ConfigChangeEntry struct {
 	// 变更描述
 	Description string `json:"description"`
 
-	// 旧配置(可选，完整配置可能较大)
+	// 旧配置(可选，只在SetLogFullConfig(true)时记录，与上一版本的NewConfig相同)
 	OldConfig *Config `json:"oldConfig,omitempty"`
 
-	// 新配置(可选，完整配置可能较大)
+	// 新配置，每个版本都记录完整快照，用于回滚；旧版本写入的记录可能没有
 	NewConfig *Config `json:"newConfig,omitempty"`
 
 	// 变更的配置键值对
@@ -35,7 +45,7 @@ type ConfigChangeLogger struct {
 	// 日志目录
 	logDir string
 
-	// 是否记录完整配置
+	// 是否同时记录变更前的完整配置
 	logFullConfig bool
 
 	// 日志文件句柄
@@ -52,10 +62,29 @@ type ConfigChangeLogger struct {
 
 	// 最大历史文件数
 	maxHistoryFiles int
+
+	// 日志格式
+	format Format
+
+	// 最后写入的版本号
+	version uint64
 }
 
-// NewConfigChangeLogger 创建配置变更日志记录器
+// NewConfigChangeLogger 创建JSON格式的配置变更日志记录器
 func NewConfigChangeLogger(logDir string) (*ConfigChangeLogger, error) {
+	return NewConfigChangeLoggerWithFormat(logDir, FormatJSON)
+}
+
+// NewConfigChangeLoggerWithFormat 创建指定格式的配置变更日志记录器
+// JSON日志写入config_changes.log，YAML和TOML分别写入config_changes.yaml和config_changes.toml
+func NewConfigChangeLoggerWithFormat(logDir string, format Format) (*ConfigChangeLogger, error) {
+	if format == "" {
+		format = FormatJSON
+	}
+	if format != FormatJSON && format != FormatYAML && format != FormatTOML {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+
 	// 确保日志目录存在
 	if err := os.MkdirAll(logDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create log directory: %v", err)
@@ -67,6 +96,16 @@ func NewConfigChangeLogger(logDir string) (*ConfigChangeLogger, error) {
 		changeCount:     0,
 		maxLogSize:      10 * 1024 * 1024, // 默认10MB
 		maxHistoryFiles: 5,                // 默认保留5个历史文件
+		format:          format,
+	}
+
+	// 从已有日志恢复版本号，新记录接着编号
+	history, err := logger.readHistory()
+	if err != nil {
+		return nil, err
+	}
+	if len(history) > 0 {
+		logger.version = history[len(history)-1].Version
 	}
 
 	// 打开当前日志文件
@@ -77,7 +116,7 @@ func NewConfigChangeLogger(logDir string) (*ConfigChangeLogger, error) {
 	return logger, nil
 }
 
-// SetLogFullConfig 设置是否记录完整配置
+// SetLogFullConfig 设置是否同时记录变更前的完整配置。变更后的完整配置总是记录
 func (l *ConfigChangeLogger) SetLogFullConfig(logFullConfig bool) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
@@ -119,32 +158,28 @@ func (l *ConfigChangeLogger) LogConfigChange(oldConfig, newConfig *Config, sourc
 		}
 	}
 
-	// 创建变更记录
+	// 创建变更记录，新配置的完整快照使每个版本都可以回滚
 	entry := ConfigChangeEntry{
+		Version:     l.version + 1,
 		Timestamp:   time.Now(),
 		Source:      source,
 		Description: description,
-		Changes:     make(map[string]interface{}),
+		NewConfig:   newConfig,
+		Changes:     l.diffConfigs(oldConfig, newConfig),
 	}
-
-	// 如果需要记录完整配置
 	if l.logFullConfig {
 		entry.OldConfig = oldConfig
-		entry.NewConfig = newConfig
-	} else {
-		// 否则只记录变更的部分
-		entry.Changes = l.diffConfigs(oldConfig, newConfig)
 	}
 
-	// 序列化为JSON
-	data, err := json.MarshalIndent(entry, "", "  ")
+	// 按日志格式序列化
+	data, err := l.encodeEntry(&entry)
 	if err != nil {
 		return fmt.Errorf("failed to marshal config change entry: %v", err)
 	}
 
 	// 写入日志文件
 	if l.logFile != nil {
-		if _, err := l.logFile.WriteString(string(data) + "\n"); err != nil {
+		if _, err := l.logFile.Write(data); err != nil {
 			return fmt.Errorf("failed to write to log file: %v", err)
 		}
 		if err := l.logFile.Sync(); err != nil {
@@ -152,13 +187,147 @@ func (l *ConfigChangeLogger) LogConfigChange(oldConfig, newConfig *Config, sourc
 		}
 	}
 
+	l.version = entry.Version
 	l.changeCount++
 	return nil
 }
 
+// History 按版本从旧到新返回日志中的全部变更记录，包括轮转后仍保留的历史文件
+func (l *ConfigChangeLogger) History() ([]ConfigChangeEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.readHistory()
+}
+
+// Entry 返回指定版本的变更记录
+func (l *ConfigChangeLogger) Entry(version uint64) (*ConfigChangeEntry, error) {
+	history, err := l.History()
+	if err != nil {
+		return nil, err
+	}
+	for i := range history {
+		if history[i].Version == version {
+			return &history[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %d", ErrConfigVersionNotFound, version)
+}
+
+// readHistory 读取所有日志文件，调用方需持有锁
+func (l *ConfigChangeLogger) readHistory() ([]ConfigChangeEntry, error) {
+	files, err := filepath.Glob(filepath.Join(l.logDir, "config_changes-*"+l.logFileExt()))
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, filepath.Join(l.logDir, "config_changes"+l.logFileExt()))
+
+	var history []ConfigChangeEntry
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read log file: %v", err)
+		}
+		entries, err := l.decodeEntries(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse log file %s: %w", filepath.Base(file), err)
+		}
+		history = append(history, entries...)
+	}
+
+	// 轮转文件名只精确到秒，以版本号为准排序
+	sort.SliceStable(history, func(i, j int) bool {
+		return history[i].Version < history[j].Version
+	})
+	return history, nil
+}
+
+// decodeEntries 解析encodeEntry写入的日志内容
+func (l *ConfigChangeLogger) decodeEntries(data []byte) ([]ConfigChangeEntry, error) {
+	var entries []ConfigChangeEntry
+	switch l.format {
+	case FormatYAML:
+		// 分隔符总是独占一行，字符串中的换行已被转义
+		for _, doc := range bytes.Split(append([]byte("\n"), data...), []byte("\n---\n")) {
+			if len(bytes.TrimSpace(doc)) == 0 {
+				continue
+			}
+			var entry ConfigChangeEntry
+			if err := Unmarshal(doc, &entry, FormatYAML); err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+	case FormatTOML:
+		var log struct {
+			Change []ConfigChangeEntry `json:"change"`
+		}
+		if err := Unmarshal(data, &log, FormatTOML); err != nil {
+			return nil, err
+		}
+		entries = log.Change
+	default:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		for {
+			var entry ConfigChangeEntry
+			if err := decoder.Decode(&entry); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// encodeEntry 序列化一条变更记录，追加到日志文件后整个文件仍是合法的对应格式：
+// JSON为连续的JSON对象，YAML每条记录是一个"---"分隔的文档，TOML每条记录是一个[[change]]表
+func (l *ConfigChangeLogger) encodeEntry(entry *ConfigChangeEntry) ([]byte, error) {
+	switch l.format {
+	case FormatYAML:
+		data, err := Marshal(entry, FormatYAML)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte("---\n"), data...), nil
+	case FormatTOML:
+		tree, err := toTree(entry)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		buf.WriteString("\n")
+		if err := writeTOMLTable(&buf, tree.(orderedMap), []string{"change"}, true); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		data, err := json.MarshalIndent(entry, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	}
+}
+
+// logFileExt 日志文件扩展名，JSON沿用.log
+func (l *ConfigChangeLogger) logFileExt() string {
+	switch l.format {
+	case FormatYAML:
+		return ".yaml"
+	case FormatTOML:
+		return ".toml"
+	default:
+		return ".log"
+	}
+}
+
 // openLogFile 打开日志文件
 func (l *ConfigChangeLogger) openLogFile() error {
-	logPath := filepath.Join(l.logDir, "config_changes.log")
+	logPath := filepath.Join(l.logDir, "config_changes"+l.logFileExt())
 	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %v", err)
@@ -179,11 +348,11 @@ func (l *ConfigChangeLogger) rotateLogFile() error {
 	}
 
 	// 当前日志文件路径
-	currentLogPath := filepath.Join(l.logDir, "config_changes.log")
+	currentLogPath := filepath.Join(l.logDir, "config_changes"+l.logFileExt())
 
-	// 生成带时间戳的新文件名
+	// 生成带时间戳和最后版本号的新文件名，同一秒内多次轮转不会覆盖
 	timestamp := time.Now().Format("20060102-150405")
-	newLogPath := filepath.Join(l.logDir, fmt.Sprintf("config_changes-%s.log", timestamp))
+	newLogPath := filepath.Join(l.logDir, fmt.Sprintf("config_changes-%s-%d%s", timestamp, l.version, l.logFileExt()))
 
 	// 重命名当前日志文件
 	if err := os.Rename(currentLogPath, newLogPath); err != nil {
@@ -202,7 +371,7 @@ func (l *ConfigChangeLogger) rotateLogFile() error {
 // cleanOldLogs 清理老的日志文件
 func (l *ConfigChangeLogger) cleanOldLogs() error {
 	// 读取日志目录中的所有文件
-	files, err := filepath.Glob(filepath.Join(l.logDir, "config_changes-*.log"))
+	files, err := filepath.Glob(filepath.Join(l.logDir, "config_changes-*"+l.logFileExt()))
 	if err != nil {
 		return err
 	}
@@ -304,6 +473,14 @@ func (l *ConfigChangeLogger) diffConfigs(oldConfig, newConfig *Config) map[strin
 		}
 	}
 
+	// 后台限速变更
+	if oldConfig.Performance.Throttle != newConfig.Performance.Throttle {
+		changes["performance.throttle"] = map[string]interface{}{
+			"old": oldConfig.Performance.Throttle,
+			"new": newConfig.Performance.Throttle,
+		}
+	}
+
 	// 安全设置变更
 	if oldConfig.Security.Encryption.Enabled != newConfig.Security.Encryption.Enabled {
 		changes["security.encryption.enabled"] = map[string]interface{}{
@@ -311,6 +488,13 @@ func (l *ConfigChangeLogger) diffConfigs(oldConfig, newConfig *Config) map[strin
 			"new": newConfig.Security.Encryption.Enabled,
 		}
 	}
+	if oldConfig.Security.Encryption.KeySource != newConfig.Security.Encryption.KeySource ||
+		oldConfig.Security.Encryption.KMS != newConfig.Security.Encryption.KMS {
+		changes["security.encryption.keySource"] = map[string]interface{}{
+			"old": oldConfig.Security.Encryption.KeySource,
+			"new": newConfig.Security.Encryption.KeySource,
+		}
+	}
 
 	// 索引设置变更
 	if oldConfig.Index.Enabled != newConfig.Index.Enabled {
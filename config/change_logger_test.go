@@ -0,0 +1,106 @@
+package config
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestChangeLoggerVersions 测试版本号在日志轮转和重新打开后保持连续，每个版本都有完整配置快照
+func TestChangeLoggerVersions(t *testing.T) {
+	for _, format := range []Format{FormatJSON, FormatYAML, FormatTOML} {
+		t.Run(string(format), func(t *testing.T) {
+			dir := t.TempDir()
+			logger, err := NewConfigChangeLoggerWithFormat(dir, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// 每条记录都触发轮转
+			logger.maxLogSize = 1
+
+			base := NewDefaultConfigManager().GetDefaultConfig()
+			prev := base
+			for workers := 1; workers <= 3; workers++ {
+				next := *prev
+				next.Performance.Parallelism.MaxWorkers = workers
+				if err := logger.LogConfigChange(prev, &next, "test", "变更"); err != nil {
+					t.Fatal(err)
+				}
+				prev = &next
+			}
+			if err := logger.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if files, _ := filepath.Glob(filepath.Join(dir, "config_changes-*")); len(files) != 2 {
+				t.Errorf("应轮转出2个历史文件: %v", files)
+			}
+
+			// 重新打开后接着编号
+			logger, err = NewConfigChangeLoggerWithFormat(dir, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer logger.Close()
+			next := *prev
+			next.Performance.Parallelism.MaxWorkers = 4
+			if err := logger.LogConfigChange(prev, &next, "test", "重启后变更"); err != nil {
+				t.Fatal(err)
+			}
+
+			history, err := logger.History()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(history) != 4 {
+				t.Fatalf("应有4个版本，实际%d个", len(history))
+			}
+			for i, entry := range history {
+				if entry.Version != uint64(i+1) {
+					t.Errorf("第%d条记录的版本号为%d", i, entry.Version)
+				}
+				if entry.NewConfig == nil || entry.NewConfig.Performance.Parallelism.MaxWorkers != i+1 {
+					t.Errorf("版本%d缺少完整配置快照: %+v", entry.Version, entry.NewConfig)
+				}
+				if entry.OldConfig != nil {
+					t.Errorf("默认不应记录变更前的配置: 版本%d", entry.Version)
+				}
+				if _, ok := entry.Changes["performance.parallelism.maxWorkers"]; !ok {
+					t.Errorf("版本%d缺少变更项: %v", entry.Version, entry.Changes)
+				}
+			}
+
+			entry, err := logger.Entry(2)
+			if err != nil || entry.Source != "test" {
+				t.Errorf("读取版本2失败: %+v, %v", entry, err)
+			}
+			if _, err := logger.Entry(99); !errors.Is(err, ErrConfigVersionNotFound) {
+				t.Errorf("不存在的版本应返回ErrConfigVersionNotFound: %v", err)
+			}
+		})
+	}
+}
+
+// TestChangeLoggerFullConfig 测试SetLogFullConfig额外记录变更前的完整配置
+func TestChangeLoggerFullConfig(t *testing.T) {
+	logger, err := NewConfigChangeLogger(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	logger.SetLogFullConfig(true)
+
+	old := NewDefaultConfigManager().GetDefaultConfig()
+	next := *old
+	next.System.LogLevel = "debug"
+	if err := logger.LogConfigChange(old, &next, "test", "变更"); err != nil {
+		t.Fatal(err)
+	}
+	entry, err := logger.Entry(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.OldConfig == nil || entry.OldConfig.System.LogLevel != old.System.LogLevel ||
+		entry.NewConfig == nil || entry.NewConfig.System.LogLevel != "debug" {
+		t.Errorf("完整配置记录不正确: %+v", entry)
+	}
+}
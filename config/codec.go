@@ -0,0 +1,336 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Format 配置文件格式
+type Format string
+
+const (
+	// FormatJSON JSON格式(默认)
+	FormatJSON Format = "json"
+
+	// FormatYAML YAML格式
+	FormatYAML Format = "yaml"
+
+	// FormatTOML TOML格式
+	FormatTOML Format = "toml"
+)
+
+// ErrUnsupportedFormat 不支持的配置格式
+var ErrUnsupportedFormat = errors.New("unsupported config format")
+
+// FormatForPath 根据文件扩展名选择格式，.yaml/.yml为YAML，.toml为TOML，其他扩展名为JSON
+func FormatForPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatJSON
+	}
+}
+
+// Marshal 按指定格式序列化v，字段名和JSON标签一致
+func Marshal(v interface{}, format Format) ([]byte, error) {
+	if format == FormatJSON || format == "" {
+		return json.MarshalIndent(v, "", "  ")
+	}
+
+	tree, err := toTree(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case FormatYAML:
+		if err := writeYAML(&buf, tree, 0); err != nil {
+			return nil, err
+		}
+	case FormatTOML:
+		root, ok := tree.(orderedMap)
+		if !ok {
+			return nil, fmt.Errorf("%w: TOML document must be a table", ErrMalformed)
+		}
+		if err := writeTOMLTable(&buf, root, nil, false); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal 按指定格式解析data到v，忽略未知字段
+func Unmarshal(data []byte, v interface{}, format Format) error {
+	return unmarshal(data, v, format, false)
+}
+
+// UnmarshalStrict 与Unmarshal相同，但遇到v中不存在的字段时返回错误
+func UnmarshalStrict(data []byte, v interface{}, format Format) error {
+	return unmarshal(data, v, format, true)
+}
+
+// unmarshal YAML和TOML先解析为通用结构，再经JSON映射到v，保证三种格式的字段规则一致
+func unmarshal(data []byte, v interface{}, format Format, strict bool) error {
+	switch format {
+	case FormatJSON, "":
+	case FormatYAML, FormatTOML:
+		var tree interface{}
+		var err error
+		if format == FormatYAML {
+			tree, err = parseYAML(data)
+		} else {
+			tree, err = parseTOML(data)
+		}
+		if err != nil {
+			return err
+		}
+		if data, err = json.Marshal(tree); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if strict {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(v)
+}
+
+// orderedMap 保持字段顺序的映射，序列化结果与结构体字段顺序一致
+type orderedMap []mapEntry
+
+// mapEntry orderedMap中的一项
+type mapEntry struct {
+	Key   string
+	Value interface{}
+}
+
+// MarshalJSON 按顺序输出字段
+func (m orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, entry := range m {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(entry.Key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(entry.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// get 查找字段
+func (m orderedMap) get(key string) (interface{}, int) {
+	for i, entry := range m {
+		if entry.Key == key {
+			return entry.Value, i
+		}
+	}
+	return nil, -1
+}
+
+// toTree 把v转换为由orderedMap、[]interface{}、string、json.Number、bool和nil组成的树
+func toTree(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return readTree(decoder)
+}
+
+// readTree 从JSON记号流读取一个值
+func readTree(decoder *json.Decoder) (interface{}, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch token {
+	case json.Delim('{'):
+		m := orderedMap{}
+		for decoder.More() {
+			key, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := readTree(decoder)
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, mapEntry{Key: key.(string), Value: value})
+		}
+		_, err = decoder.Token()
+		return m, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for decoder.More() {
+			value, err := readTree(decoder)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err = decoder.Token()
+		return list, err
+	default:
+		return token, nil
+	}
+}
+
+// isTable 值是否为映射
+func isTable(v interface{}) bool {
+	_, ok := v.(orderedMap)
+	return ok
+}
+
+// isTableArray 值是否为非空的映射数组
+func isTableArray(v interface{}) bool {
+	list, ok := v.([]interface{})
+	if !ok || len(list) == 0 {
+		return false
+	}
+	for _, item := range list {
+		if !isTable(item) {
+			return false
+		}
+	}
+	return true
+}
+
+// quoteString 输出双引号字符串，转义规则同时满足YAML和TOML
+func quoteString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// unquoteString 解析双引号字符串的内容（不含两端引号）
+func unquoteString(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' {
+			b.WriteByte(c)
+			continue
+		}
+		i++
+		if i >= len(s) {
+			return "", fmt.Errorf("%w: unterminated escape", ErrMalformed)
+		}
+		switch s[i] {
+		case '"', '\\', '/':
+			b.WriteByte(s[i])
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case '0':
+			b.WriteByte(0)
+		case 'u', 'U':
+			n := 4
+			if s[i] == 'U' {
+				n = 8
+			}
+			if i+n >= len(s) {
+				return "", fmt.Errorf("%w: short unicode escape", ErrMalformed)
+			}
+			r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+			if err != nil {
+				return "", fmt.Errorf("%w: invalid unicode escape", ErrMalformed)
+			}
+			b.WriteRune(rune(r))
+			i += n
+		default:
+			return "", fmt.Errorf("%w: unknown escape \\%c", ErrMalformed, s[i])
+		}
+	}
+	return b.String(), nil
+}
+
+// scanQuoted 返回从s[0]的引号开始到匹配的结束引号（含）的长度
+func scanQuoted(s string) (int, error) {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if quote == '"' {
+				i++
+			}
+		case quote:
+			// YAML单引号字符串用''表示一个单引号
+			if quote == '\'' && i+1 < len(s) && s[i+1] == '\'' {
+				i++
+				continue
+			}
+			return i + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: unterminated string", ErrMalformed)
+}
+
+// stripComment 去掉引号之外以#开始的注释
+func stripComment(line string) string {
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '"', '\'':
+			// 没有结束引号时按普通字符处理，如YAML中的it's
+			if n, err := scanQuoted(line[i:]); err == nil {
+				i += n - 1
+			}
+		case '#':
+			if i == 0 || line[i-1] == ' ' || line[i-1] == '\t' {
+				return strings.TrimRight(line[:i], " \t")
+			}
+		}
+	}
+	return strings.TrimRight(line, " \t")
+}
@@ -0,0 +1,256 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// codecSample 覆盖引号、转义、嵌套映射、序列和表数组的结构
+type codecSample struct {
+	Name   string            `json:"name"`
+	Quote  string            `json:"quote"`
+	Count  int               `json:"count"`
+	Ratio  float64           `json:"ratio"`
+	On     bool              `json:"on"`
+	Tags   []string          `json:"tags"`
+	Empty  []string          `json:"empty"`
+	Labels map[string]string `json:"labels"`
+	Nested struct {
+		Inner struct {
+			Path string `json:"path"`
+		} `json:"inner"`
+		Levels [][]int `json:"levels"`
+	} `json:"nested"`
+	Items []codecItem `json:"items"`
+}
+
+// codecItem 表数组中的一项
+type codecItem struct {
+	ID    int               `json:"id"`
+	Note  string            `json:"note"`
+	Attrs map[string]string `json:"attrs"`
+}
+
+// TestCodecRoundTrip 测试YAML和TOML序列化后解析得到相同的值
+func TestCodecRoundTrip(t *testing.T) {
+	var sample codecSample
+	sample.Name = "fragmenta"
+	sample.Quote = "say \"hi\" \\ it's #not a comment\n\ttab \u0001 中文"
+	sample.Count = -42
+	sample.Ratio = 0.125
+	sample.On = true
+	sample.Tags = []string{"a", "b c", "", "- dash", "key: value", "[x]"}
+	sample.Empty = []string{}
+	sample.Labels = map[string]string{"with space": "1", "dot.key": "2", "plain": "true"}
+	sample.Nested.Inner.Path = `C:\data\#1`
+	sample.Nested.Levels = [][]int{{1, 2}, {}, {3}}
+	sample.Items = []codecItem{
+		{ID: 1, Note: "first", Attrs: map[string]string{"k": "v"}},
+		{ID: 2, Note: "'single'", Attrs: map[string]string{}},
+	}
+
+	config := NewDefaultConfigManager().GetDefaultConfig()
+	for _, format := range []Format{FormatJSON, FormatYAML, FormatTOML} {
+		t.Run(string(format), func(t *testing.T) {
+			data, err := Marshal(&sample, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got codecSample
+			if err := UnmarshalStrict(data, &got, format); err != nil {
+				t.Fatalf("解析失败: %v\n%s", err, data)
+			}
+			if !reflect.DeepEqual(got, sample) {
+				t.Errorf("往返结果不一致:\n%+v\n%+v\n%s", got, sample, data)
+			}
+
+			data, err = Marshal(config, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var gotConfig Config
+			if err := UnmarshalStrict(data, &gotConfig, format); err != nil {
+				t.Fatalf("解析配置失败: %v\n%s", err, data)
+			}
+			want, _ := json.Marshal(config)
+			have, _ := json.Marshal(&gotConfig)
+			if string(want) != string(have) {
+				t.Errorf("配置往返结果不一致:\n%s\n%s", have, want)
+			}
+		})
+	}
+}
+
+// TestParseYAML 测试手写YAML的解析
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"标量", "a: 1\nb: -2.5\nc: true\nd: ~\ne: text", `{"a":1,"b":-2.5,"c":true,"d":null,"e":"text"}`},
+		{"引号", `a: "x # y"` + "\n" + `b: 'it''s'` + "\n" + `c: "\u4e2d\n"`, `{"a":"x # y","b":"it's","c":"中\n"}`},
+		{"注释", "# 开头\na: 1 # 行尾\nb: it's # 无结束引号", `{"a":1,"b":"it's"}`},
+		{"嵌套映射", "a:\n  b:\n    c: 1\n  d: 2", `{"a":{"b":{"c":1},"d":2}}`},
+		{"序列", "a:\n- 1\n- x\nb:\n  - - 1\n    - 2\n  - []", `{"a":[1,"x"],"b":[[1,2],[]]}`},
+		{"映射序列", "items:\n  - id: 1\n    tags: [a, b]\n  - id: 2", `{"items":[{"id":1,"tags":["a","b"]},{"id":2}]}`},
+		{"流式集合", `a: {x: 1, "y z": [1, {k: v}], w: "a,b"}`, `{"a":{"x":1,"y z":[1,{"k":"v"}],"w":"a,b"}}`},
+		{"文档标记", "---\na: 1\n...", `{"a":1}`},
+		{"空文档", "# 只有注释\n", `{}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := parseYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := json.Marshal(tree); string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseTOML 测试手写TOML的解析
+func TestParseTOML(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"标量", "a = 1\nb = -2.5\nc = true\nd = 0x1F\ne = 1_000\nf = 1979-05-27 07:32:00Z", `{"a":1,"b":-2.5,"c":true,"d":31,"e":1000,"f":"1979-05-27 07:32:00Z"}`},
+		{"字符串", `a = "x # y \"q\" \t"` + "\n" + `b = 'C:\path'` + "\n" + `"quoted key" = "\U0001F600"`, `{"a":"x # y \"q\" \t","b":"C:\\path","quoted key":"😀"}`},
+		{"点分键", "a.b.c = 1\na.b.d = 2", `{"a":{"b":{"c":1,"d":2}}}`},
+		{"表", "[a]\nx = 1\n[a.b]\ny = 2\n[c]", `{"a":{"b":{"y":2},"x":1},"c":{}}`},
+		{"子表先于父表", "[a.b]\ny = 2\n[a]\nx = 1", `{"a":{"b":{"y":2},"x":1}}`},
+		{"内联表", `a = { x = 1, y.z = "s", w = [1, 2] }`, `{"a":{"w":[1,2],"x":1,"y":{"z":"s"}}}`},
+		{"跨行数组", "a = [\n  1, # 注释\n  2,\n]", `{"a":[1,2]}`},
+		{"表数组", "[[t]]\nid = 1\n[t.sub]\nk = 1\n[[t]]\nid = 2\n[t.sub]\nk = 2", `{"t":[{"id":1,"sub":{"k":1}},{"id":2,"sub":{"k":2}}]}`},
+		{"嵌套表数组", "[[a]]\n[[a.b]]\nx = 1\n[[a.b]]\nx = 2", `{"a":[{"b":[{"x":1},{"x":2}]}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := parseTOML([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := json.Marshal(tree); string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestParseMalformed 测试不合法或不支持的输入返回ErrMalformed
+func TestParseMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		input  string
+	}{
+		{"YAML制表符缩进", FormatYAML, "a:\n\tb: 1"},
+		{"YAML重复键", FormatYAML, "a: 1\na: 2"},
+		{"YAML缩进错误", FormatYAML, "a: 1\n  b: 2"},
+		{"YAML映射中的序列项", FormatYAML, "a: 1\n- b"},
+		{"YAML未结束的字符串", FormatYAML, `a: "x`},
+		{"YAML字符串后多余文本", FormatYAML, `a: "x" y`},
+		{"YAML未知转义", FormatYAML, `a: "\q"`},
+		{"YAML未结束的流式集合", FormatYAML, "a: [1, 2"},
+		{"YAML流式空项", FormatYAML, "a: [1,,2]"},
+		{"YAML块标量", FormatYAML, "a: |"},
+		{"YAML锚点", FormatYAML, "a: &x 1"},
+		{"YAML多文档", FormatYAML, "--- a: 1"},
+		{"TOML重复键", FormatTOML, "a = 1\na = 2"},
+		{"TOML重复定义表", FormatTOML, "[a]\nx = 1\n[b]\n[a]\ny = 2"},
+		{"TOML重复定义子表", FormatTOML, "[a.b]\n[a]\n[a.b]"},
+		{"TOML用表头扩展点分键的表", FormatTOML, "a.b = 1\n[a]"},
+		{"TOML用表头扩展内联表", FormatTOML, "a = { x = 1 }\n[a]\ny = 2"},
+		{"TOML表头与表数组冲突", FormatTOML, "[[a]]\n[a]"},
+		{"TOML表数组与值冲突", FormatTOML, "a = 1\n[[a]]"},
+		{"TOML未结束的表头", FormatTOML, "[a"},
+		{"TOML缺少值", FormatTOML, "a ="},
+		{"TOML缺少等号", FormatTOML, "a 1"},
+		{"TOML值后多余文本", FormatTOML, "a = 1 2"},
+		{"TOML非法值", FormatTOML, "a = yes"},
+		{"TOML未结束的字符串", FormatTOML, `a = "x`},
+		{"TOML多行字符串", FormatTOML, `a = """x"""`},
+		{"TOML数组缺少逗号", FormatTOML, "a = [1 2]"},
+		{"TOML短unicode转义", FormatTOML, `a = "\u12"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var v interface{}
+			if err := Unmarshal([]byte(tt.input), &v, tt.format); !errors.Is(err, ErrMalformed) {
+				t.Errorf("应返回ErrMalformed: %v (%v)", err, v)
+			}
+		})
+	}
+}
+
+// fuzzRoundTrip 解析成功的输入序列化后应能重新解析为相同的值
+func fuzzRoundTrip(t *testing.T, data []byte, format Format, parse func([]byte) (interface{}, error)) {
+	tree, err := parse(data)
+	if err != nil {
+		return
+	}
+	v, err := toTree(tree)
+	if err != nil {
+		return
+	}
+	encoded, err := Marshal(v, format)
+	if err != nil {
+		// TOML不能表示null和非表的顶层值
+		return
+	}
+	again, err := parse(encoded)
+	if err != nil {
+		t.Fatalf("重新解析失败: %v\n输入: %q\n输出: %q", err, data, encoded)
+	}
+	if want, got := canonicalTree(t, tree), canonicalTree(t, again); !reflect.DeepEqual(got, want) {
+		t.Fatalf("往返结果不一致:\n%v\n%v\n输出: %q", got, want, encoded)
+	}
+}
+
+// canonicalTree 把解析结果转换为不区分字段顺序的通用结构
+func canonicalTree(t *testing.T, tree interface{}) interface{} {
+	data, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// FuzzParseYAML 测试任意YAML输入不会panic，解析成功时序列化结果可以往返
+func FuzzParseYAML(f *testing.F) {
+	f.Add([]byte("a: 1\nb:\n  - x\n  - {k: \"v\"}\n"))
+	f.Add([]byte("- - 1\n  - 'it''s'\n- key: [1, 2]\n"))
+	f.Add([]byte("a: \"\\u00e9\\n\" # c\n"))
+	if data, err := Marshal(NewDefaultConfigManager().GetDefaultConfig(), FormatYAML); err == nil {
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzRoundTrip(t, data, FormatYAML, parseYAML)
+	})
+}
+
+// FuzzParseTOML 测试任意TOML输入不会panic，解析成功时序列化结果可以往返
+func FuzzParseTOML(f *testing.F) {
+	f.Add([]byte("a = 1\n[b]\nc = \"x\"\n[[d]]\ne = [1, 2]\n"))
+	f.Add([]byte("a.b = { c = 'lit', d = [\n1,\n2] }\n"))
+	f.Add([]byte("[x]\n[x.y]\n[[z]]\n[z.w]\n"))
+	if data, err := Marshal(NewDefaultConfigManager().GetDefaultConfig(), FormatTOML); err == nil {
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		fuzzRoundTrip(t, data, FormatTOML, parseTOML)
+	})
+}
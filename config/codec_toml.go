@@ -0,0 +1,455 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// TOML编解码支持配置文件需要的子集：表、表数组、点分键、内联表、跨行数组、
+// 基本字符串和字面字符串、整数、浮点数、布尔值，日期时间按字符串处理。不支持多行字符串。
+
+// writeTOMLTable 输出表，path为表的完整路径，arrayElem表示表数组中的一项
+func writeTOMLTable(buf *bytes.Buffer, m orderedMap, path []string, arrayElem bool) error {
+	if len(path) > 0 {
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		header := tomlPath(path)
+		if arrayElem {
+			buf.WriteString("[[" + header + "]]\n")
+		} else {
+			buf.WriteString("[" + header + "]\n")
+		}
+	}
+
+	// 先输出键值，子表必须放在所有键值之后
+	for _, entry := range m {
+		if entry.Value == nil || isSubTable(entry.Value) || isTableArray(entry.Value) {
+			continue
+		}
+		value, err := tomlValue(entry.Value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", entry.Key, err)
+		}
+		buf.WriteString(tomlKey(entry.Key) + " = " + value + "\n")
+	}
+
+	for _, entry := range m {
+		childPath := append(append([]string{}, path...), entry.Key)
+		switch {
+		case isSubTable(entry.Value):
+			if err := writeTOMLTable(buf, entry.Value.(orderedMap), childPath, false); err != nil {
+				return err
+			}
+		case isTableArray(entry.Value):
+			for _, item := range entry.Value.([]interface{}) {
+				if err := writeTOMLTable(buf, item.(orderedMap), childPath, true); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// isSubTable 非空映射输出为子表，空映射输出为内联表
+func isSubTable(v interface{}) bool {
+	m, ok := v.(orderedMap)
+	return ok && len(m) > 0
+}
+
+// tomlPath 拼接表路径
+func tomlPath(path []string) string {
+	keys := make([]string, len(path))
+	for i, key := range path {
+		keys[i] = tomlKey(key)
+	}
+	return strings.Join(keys, ".")
+}
+
+// tomlKey 输出键，不是裸键时加引号
+func tomlKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return quoteString(key)
+		}
+	}
+	return key
+}
+
+// tomlValue 输出内联值
+func tomlValue(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case nil:
+		return "", fmt.Errorf("%w: TOML cannot represent null", ErrMalformed)
+	case bool:
+		return strconv.FormatBool(value), nil
+	case json.Number:
+		return value.String(), nil
+	case string:
+		return quoteString(value), nil
+	case []interface{}:
+		items := make([]string, len(value))
+		for i, item := range value {
+			s, err := tomlValue(item)
+			if err != nil {
+				return "", err
+			}
+			items[i] = s
+		}
+		return "[" + strings.Join(items, ", ") + "]", nil
+	case orderedMap:
+		items := make([]string, 0, len(value))
+		for _, entry := range value {
+			if entry.Value == nil {
+				continue
+			}
+			s, err := tomlValue(entry.Value)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, tomlKey(entry.Key)+" = "+s)
+		}
+		if len(items) == 0 {
+			return "{}", nil
+		}
+		return "{ " + strings.Join(items, ", ") + " }", nil
+	default:
+		return "", fmt.Errorf("%w: unexpected TOML value %T", ErrMalformed, v)
+	}
+}
+
+// parseTOML 解析TOML文档
+func parseTOML(data []byte) (interface{}, error) {
+	root := make(map[string]interface{})
+	current := root
+	var currentPath []string
+
+	// 已定义的表（表头、内联表和点分键创建的表），TOML不允许再用表头重复定义
+	defined := make(map[string]bool)
+
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		number := i + 1
+		statement := strings.TrimSpace(stripComment(strings.TrimRight(lines[i], "\r")))
+		if statement == "" {
+			continue
+		}
+		if strings.Contains(statement, `"""`) || strings.Contains(statement, "'''") {
+			return nil, tomlErrorf(number, "multi-line strings are not supported")
+		}
+
+		// 跨行的数组和内联表合并为一条语句
+		for bracketDepth(statement) > 0 && i+1 < len(lines) {
+			i++
+			statement += "\n" + strings.TrimSpace(stripComment(strings.TrimRight(lines[i], "\r")))
+		}
+
+		switch {
+		case strings.HasPrefix(statement, "[["):
+			if !strings.HasSuffix(statement, "]]") {
+				return nil, tomlErrorf(number, "unterminated table array header")
+			}
+			path, rest, err := parseTOMLKey(statement[2 : len(statement)-2])
+			if err != nil || rest != "" {
+				return nil, tomlErrorf(number, "invalid table array header")
+			}
+			parent, err := tomlDescend(root, path[:len(path)-1])
+			if err != nil {
+				return nil, tomlErrorf(number, "%v", err)
+			}
+			last := path[len(path)-1]
+			list, _ := parent[last].([]interface{})
+			if parent[last] != nil && list == nil {
+				return nil, tomlErrorf(number, "%s is not an array of tables", last)
+			}
+			current = make(map[string]interface{})
+			parent[last] = append(list, current)
+			currentPath = path
+
+			// 表数组的新一项可以重新定义上一项中的子表
+			prefix := tomlPathKey(path) + "\x00"
+			for key := range defined {
+				if strings.HasPrefix(key, prefix) {
+					delete(defined, key)
+				}
+			}
+		case strings.HasPrefix(statement, "["):
+			if !strings.HasSuffix(statement, "]") {
+				return nil, tomlErrorf(number, "unterminated table header")
+			}
+			path, rest, err := parseTOMLKey(statement[1 : len(statement)-1])
+			if err != nil || rest != "" {
+				return nil, tomlErrorf(number, "invalid table header")
+			}
+			key := tomlPathKey(path)
+			if defined[key] {
+				return nil, tomlErrorf(number, "table %s is defined more than once", tomlPath(path))
+			}
+			parent, err := tomlDescend(root, path[:len(path)-1])
+			if err != nil {
+				return nil, tomlErrorf(number, "%v", err)
+			}
+			if _, ok := parent[path[len(path)-1]].([]interface{}); ok {
+				return nil, tomlErrorf(number, "%s is an array of tables", tomlPath(path))
+			}
+			if current, err = tomlDescend(parent, path[len(path)-1:]); err != nil {
+				return nil, tomlErrorf(number, "%v", err)
+			}
+			defined[key] = true
+			currentPath = path
+		default:
+			path, rest, err := parseTOMLKey(statement)
+			if err != nil {
+				return nil, tomlErrorf(number, "%v", err)
+			}
+			if !strings.HasPrefix(rest, "=") {
+				return nil, tomlErrorf(number, "expected \"key = value\"")
+			}
+			value, rest, err := parseTOMLValue(strings.TrimSpace(rest[1:]))
+			if err != nil {
+				return nil, tomlErrorf(number, "%v", err)
+			}
+			if strings.TrimSpace(rest) != "" {
+				return nil, tomlErrorf(number, "unexpected text after value: %s", rest)
+			}
+			if err := tomlSet(current, path, value); err != nil {
+				return nil, tomlErrorf(number, "%v", err)
+			}
+			full := append(append([]string{}, currentPath...), path...)
+			for i := len(currentPath) + 1; i < len(full); i++ {
+				defined[tomlPathKey(full[:i])] = true
+			}
+			if _, ok := value.(map[string]interface{}); ok {
+				defined[tomlPathKey(full)] = true
+			}
+		}
+	}
+	return root, nil
+}
+
+// tomlPathKey 表路径在已定义表集合中的键
+func tomlPathKey(path []string) string {
+	return strings.Join(path, "\x00")
+}
+
+// tomlErrorf 生成带行号的错误
+func tomlErrorf(line int, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: toml line %d: %s", ErrMalformed, line, fmt.Sprintf(format, args...))
+}
+
+// bracketDepth 返回引号之外未闭合的括号数
+func bracketDepth(s string) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			if n, err := scanTOMLString(s[i:]); err == nil {
+				i += n - 1
+			}
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		}
+	}
+	return depth
+}
+
+// tomlDescend 沿路径找到或创建表，路径上的表数组取最后一项
+func tomlDescend(table map[string]interface{}, path []string) (map[string]interface{}, error) {
+	for _, key := range path {
+		switch next := table[key].(type) {
+		case nil:
+			child := make(map[string]interface{})
+			table[key] = child
+			table = child
+		case map[string]interface{}:
+			table = next
+		case []interface{}:
+			if len(next) == 0 {
+				return nil, fmt.Errorf("%s is not a table", key)
+			}
+			last, ok := next[len(next)-1].(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s is not a table", key)
+			}
+			table = last
+		default:
+			return nil, fmt.Errorf("%s is not a table", key)
+		}
+	}
+	return table, nil
+}
+
+// tomlSet 按点分键设置值
+func tomlSet(table map[string]interface{}, path []string, value interface{}) error {
+	parent, err := tomlDescend(table, path[:len(path)-1])
+	if err != nil {
+		return err
+	}
+	last := path[len(path)-1]
+	if _, exists := parent[last]; exists {
+		return fmt.Errorf("duplicate key %q", last)
+	}
+	parent[last] = value
+	return nil
+}
+
+// parseTOMLKey 解析点分键，返回键路径和剩余文本
+func parseTOMLKey(s string) ([]string, string, error) {
+	var path []string
+	s = strings.TrimSpace(s)
+	for {
+		if s == "" {
+			return nil, "", fmt.Errorf("missing key")
+		}
+		var key string
+		if s[0] == '"' || s[0] == '\'' {
+			n, err := scanTOMLString(s)
+			if err != nil {
+				return nil, "", err
+			}
+			if key, err = unquoteTOML(s[:n]); err != nil {
+				return nil, "", err
+			}
+			s = s[n:]
+		} else {
+			end := 0
+			for end < len(s) && (s[end] >= 'a' && s[end] <= 'z' || s[end] >= 'A' && s[end] <= 'Z' ||
+				s[end] >= '0' && s[end] <= '9' || s[end] == '_' || s[end] == '-') {
+				end++
+			}
+			if end == 0 {
+				return nil, "", fmt.Errorf("invalid key: %s", s)
+			}
+			key, s = s[:end], s[end:]
+		}
+		path = append(path, key)
+
+		s = strings.TrimSpace(s)
+		if !strings.HasPrefix(s, ".") {
+			return path, s, nil
+		}
+		s = strings.TrimSpace(s[1:])
+	}
+}
+
+// scanTOMLString 返回从s[0]的引号开始的字符串长度，字面字符串中反斜杠没有特殊含义
+func scanTOMLString(s string) (int, error) {
+	if s[0] == '"' {
+		return scanQuoted(s)
+	}
+	if end := strings.IndexByte(s[1:], '\''); end >= 0 {
+		return end + 2, nil
+	}
+	return 0, fmt.Errorf("unterminated string")
+}
+
+// unquoteTOML 解析带引号的字符串
+func unquoteTOML(s string) (string, error) {
+	if s[0] == '\'' {
+		return s[1 : len(s)-1], nil
+	}
+	return unquoteString(s[1 : len(s)-1])
+}
+
+// parseTOMLValue 解析一个值，返回值和剩余文本
+func parseTOMLValue(s string) (interface{}, string, error) {
+	if s == "" {
+		return nil, "", fmt.Errorf("missing value")
+	}
+
+	switch s[0] {
+	case '"', '\'':
+		n, err := scanTOMLString(s)
+		if err != nil {
+			return nil, "", err
+		}
+		value, err := unquoteTOML(s[:n])
+		return value, s[n:], err
+	case '[':
+		list := []interface{}{}
+		s = strings.TrimSpace(s[1:])
+		for !strings.HasPrefix(s, "]") {
+			value, rest, err := parseTOMLValue(s)
+			if err != nil {
+				return nil, "", err
+			}
+			list = append(list, value)
+			s = strings.TrimSpace(rest)
+			if strings.HasPrefix(s, ",") {
+				s = strings.TrimSpace(s[1:])
+			} else if !strings.HasPrefix(s, "]") {
+				return nil, "", fmt.Errorf("expected ',' or ']' in array")
+			}
+		}
+		return list, s[1:], nil
+	case '{':
+		table := make(map[string]interface{})
+		s = strings.TrimSpace(s[1:])
+		for !strings.HasPrefix(s, "}") {
+			path, rest, err := parseTOMLKey(s)
+			if err != nil {
+				return nil, "", err
+			}
+			if !strings.HasPrefix(rest, "=") {
+				return nil, "", fmt.Errorf("expected '=' in inline table")
+			}
+			value, rest, err := parseTOMLValue(strings.TrimSpace(rest[1:]))
+			if err != nil {
+				return nil, "", err
+			}
+			if err := tomlSet(table, path, value); err != nil {
+				return nil, "", err
+			}
+			s = strings.TrimSpace(rest)
+			if strings.HasPrefix(s, ",") {
+				s = strings.TrimSpace(s[1:])
+			} else if !strings.HasPrefix(s, "}") {
+				return nil, "", fmt.Errorf("expected ',' or '}' in inline table")
+			}
+		}
+		return table, s[1:], nil
+	}
+
+	// 裸值：布尔、数字或日期时间
+	end := strings.IndexAny(s, ",]}\n \t")
+	if end < 0 {
+		end = len(s)
+	}
+	// 日期和时间之间可以用空格分隔
+	if end == 10 && len(s) > 11 && s[4] == '-' && s[10] == ' ' && s[11] >= '0' && s[11] <= '9' {
+		if next := strings.IndexAny(s[11:], ",]}\n \t"); next < 0 {
+			end = len(s)
+		} else {
+			end = 11 + next
+		}
+	}
+	token, rest := s[:end], s[end:]
+
+	switch token {
+	case "true":
+		return true, rest, nil
+	case "false":
+		return false, rest, nil
+	}
+	if strings.HasPrefix(token, "0x") || strings.HasPrefix(token, "0o") || strings.HasPrefix(token, "0b") {
+		if i, err := strconv.ParseInt(token, 0, 64); err == nil {
+			return json.Number(strconv.FormatInt(i, 10)), rest, nil
+		}
+	}
+	if n, ok := parseNumber(token); ok {
+		return n, rest, nil
+	}
+	if token != "" && token[0] >= '0' && token[0] <= '9' && strings.ContainsAny(token, "-:") {
+		return token, rest, nil
+	}
+	return nil, "", fmt.Errorf("invalid value: %s", token)
+}
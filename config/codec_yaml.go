@@ -0,0 +1,453 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// YAML编解码只支持配置文件需要的子集：块映射、块序列、流式[]和{}、
+// 单双引号字符串和普通标量、#注释。不支持锚点、别名、多文档和|、>块标量。
+
+// writeYAML 以indent缩进输出值
+func writeYAML(buf *bytes.Buffer, v interface{}, indent int) error {
+	pad := strings.Repeat(" ", indent)
+	switch value := v.(type) {
+	case orderedMap:
+		if len(value) == 0 {
+			buf.WriteString(pad + "{}\n")
+			return nil
+		}
+		for _, entry := range value {
+			buf.WriteString(pad + yamlKey(entry.Key) + ":")
+			if err := writeYAMLValue(buf, entry.Value, indent); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if len(value) == 0 {
+			buf.WriteString(pad + "[]\n")
+			return nil
+		}
+		for _, item := range value {
+			if m, ok := item.(orderedMap); ok && len(m) > 0 {
+				// 映射的第一个字段与"- "写在同一行
+				var child bytes.Buffer
+				if err := writeYAML(&child, m, indent+2); err != nil {
+					return err
+				}
+				buf.WriteString(pad + "- ")
+				buf.Write(child.Bytes()[indent+2:])
+				continue
+			}
+			buf.WriteString(pad + "-")
+			if err := writeYAMLValue(buf, item, indent); err != nil {
+				return err
+			}
+		}
+	default:
+		scalar, err := yamlScalar(value)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(pad + scalar + "\n")
+	}
+	return nil
+}
+
+// writeYAMLValue 输出键或"-"之后的值，嵌套的映射和序列另起一行
+func writeYAMLValue(buf *bytes.Buffer, v interface{}, indent int) error {
+	switch value := v.(type) {
+	case orderedMap:
+		if len(value) == 0 {
+			buf.WriteString(" {}\n")
+			return nil
+		}
+	case []interface{}:
+		if len(value) == 0 {
+			buf.WriteString(" []\n")
+			return nil
+		}
+	default:
+		scalar, err := yamlScalar(value)
+		if err != nil {
+			return err
+		}
+		buf.WriteString(" " + scalar + "\n")
+		return nil
+	}
+	buf.WriteString("\n")
+	return writeYAML(buf, v, indent+2)
+}
+
+// yamlKey 输出键，包含特殊字符时加引号
+func yamlKey(key string) string {
+	if key == "" {
+		return `""`
+	}
+	for _, r := range key {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' || r == '.') {
+			return quoteString(key)
+		}
+	}
+	return key
+}
+
+// yamlScalar 输出标量，字符串总是加引号，避免被解析为其他类型
+func yamlScalar(v interface{}) (string, error) {
+	switch value := v.(type) {
+	case nil:
+		return "null", nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case json.Number:
+		return value.String(), nil
+	case string:
+		return quoteString(value), nil
+	default:
+		return "", fmt.Errorf("%w: unexpected YAML value %T", ErrMalformed, v)
+	}
+}
+
+// yamlLine 去掉注释后的非空行
+type yamlLine struct {
+	number  int
+	indent  int
+	content string
+}
+
+// yamlParser YAML解析状态
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+// parseYAML 解析YAML文档
+func parseYAML(data []byte) (interface{}, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(string(data), "\n") {
+		line := stripComment(strings.TrimRight(raw, "\r"))
+		content := strings.TrimLeft(line, " ")
+		if content == "" || content == "---" || content == "..." {
+			continue
+		}
+		if strings.HasPrefix(content, "\t") {
+			return nil, p.errorf(i+1, "tabs are not allowed for indentation")
+		}
+		if strings.HasPrefix(content, "%") || strings.HasPrefix(content, "--- ") {
+			return nil, p.errorf(i+1, "directives and multiple documents are not supported")
+		}
+		p.lines = append(p.lines, yamlLine{number: i + 1, indent: len(line) - len(content), content: content})
+	}
+
+	if len(p.lines) == 0 {
+		return orderedMap{}, nil
+	}
+	v, err := p.parseNode(p.lines[0].indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.lines) {
+		return nil, p.errorf(p.lines[p.pos].number, "unexpected indentation")
+	}
+	return v, nil
+}
+
+// errorf 生成带行号的错误
+func (p *yamlParser) errorf(line int, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: yaml line %d: %s", ErrMalformed, line, fmt.Sprintf(format, args...))
+}
+
+// isSeqItem 行是否为序列项
+func isSeqItem(content string) bool {
+	return content == "-" || strings.HasPrefix(content, "- ")
+}
+
+// parseNode 解析从当前行开始、缩进为indent的块
+func (p *yamlParser) parseNode(indent int) (interface{}, error) {
+	line := p.lines[p.pos]
+	if isSeqItem(line.content) {
+		return p.parseSeq(indent)
+	}
+	if _, _, ok, err := splitYAMLKey(line.content); err != nil {
+		return nil, p.errorf(line.number, "%v", err)
+	} else if !ok {
+		// 单独一行的标量
+		p.pos++
+		v, err := parseYAMLScalar(line.content)
+		if err != nil {
+			return nil, p.errorf(line.number, "%v", err)
+		}
+		return v, nil
+	}
+	return p.parseMap(indent)
+}
+
+// parseMap 解析缩进为indent的块映射
+func (p *yamlParser) parseMap(indent int) (interface{}, error) {
+	m := orderedMap{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent < indent {
+			break
+		}
+		if line.indent > indent {
+			return nil, p.errorf(line.number, "unexpected indentation")
+		}
+		if isSeqItem(line.content) {
+			return nil, p.errorf(line.number, "unexpected sequence item in mapping")
+		}
+
+		key, rest, ok, err := splitYAMLKey(line.content)
+		if err != nil {
+			return nil, p.errorf(line.number, "%v", err)
+		}
+		if !ok {
+			return nil, p.errorf(line.number, "expected \"key: value\"")
+		}
+		if _, i := m.get(key); i >= 0 {
+			return nil, p.errorf(line.number, "duplicate key %q", key)
+		}
+		p.pos++
+
+		var value interface{}
+		if rest != "" {
+			if value, err = parseYAMLScalar(rest); err != nil {
+				return nil, p.errorf(line.number, "%v", err)
+			}
+		} else if p.pos < len(p.lines) {
+			next := p.lines[p.pos]
+			switch {
+			case next.indent > indent:
+				value, err = p.parseNode(next.indent)
+			case next.indent == indent && isSeqItem(next.content):
+				// 序列项可以与键对齐
+				value, err = p.parseSeq(indent)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		m = append(m, mapEntry{Key: key, Value: value})
+	}
+	return m, nil
+}
+
+// parseSeq 解析缩进为indent的块序列
+func (p *yamlParser) parseSeq(indent int) (interface{}, error) {
+	list := []interface{}{}
+	for p.pos < len(p.lines) {
+		line := p.lines[p.pos]
+		if line.indent != indent || !isSeqItem(line.content) {
+			if line.indent > indent {
+				return nil, p.errorf(line.number, "unexpected indentation")
+			}
+			break
+		}
+
+		rest := strings.TrimLeft(line.content[1:], " ")
+		if rest == "" {
+			p.pos++
+			var value interface{}
+			if p.pos < len(p.lines) && p.lines[p.pos].indent > indent {
+				var err error
+				if value, err = p.parseNode(p.lines[p.pos].indent); err != nil {
+					return nil, err
+				}
+			}
+			list = append(list, value)
+			continue
+		}
+
+		// "- key: value"或"- - item"：把项的内容当作缩进更深的一行重新解析
+		_, _, isMap, err := splitYAMLKey(rest)
+		if err != nil {
+			return nil, p.errorf(line.number, "%v", err)
+		}
+		if isMap || isSeqItem(rest) {
+			offset := len(line.content) - len(rest)
+			p.lines[p.pos] = yamlLine{number: line.number, indent: indent + offset, content: rest}
+			value, err := p.parseNode(indent + offset)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+			continue
+		}
+
+		p.pos++
+		value, err := parseYAMLScalar(rest)
+		if err != nil {
+			return nil, p.errorf(line.number, "%v", err)
+		}
+		list = append(list, value)
+	}
+	return list, nil
+}
+
+// splitYAMLKey 把"key: value"拆分为键和值，不是映射项时ok为false
+func splitYAMLKey(content string) (key, rest string, ok bool, err error) {
+	if content == "" || content[0] == '[' || content[0] == '{' {
+		return "", "", false, nil
+	}
+
+	var end int
+	if content[0] == '"' || content[0] == '\'' {
+		n, err := scanQuoted(content)
+		if err != nil {
+			return "", "", false, err
+		}
+		if n >= len(content) || content[n] != ':' {
+			return "", "", false, nil
+		}
+		if key, err = unquoteYAML(content[:n]); err != nil {
+			return "", "", false, err
+		}
+		end = n
+	} else {
+		end = strings.Index(content, ": ")
+		if end < 0 {
+			if !strings.HasSuffix(content, ":") {
+				return "", "", false, nil
+			}
+			end = len(content) - 1
+		}
+		key = strings.TrimSpace(content[:end])
+	}
+
+	if end+1 < len(content) && content[end+1] != ' ' {
+		return "", "", false, nil
+	}
+	return key, strings.TrimSpace(content[end+1:]), true, nil
+}
+
+// unquoteYAML 解析带引号的字符串
+func unquoteYAML(s string) (string, error) {
+	if s[0] == '\'' {
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	}
+	return unquoteString(s[1 : len(s)-1])
+}
+
+// parseYAMLScalar 解析标量或流式集合
+func parseYAMLScalar(s string) (interface{}, error) {
+	switch s[0] {
+	case '"', '\'':
+		n, err := scanQuoted(s)
+		if err != nil {
+			return nil, err
+		}
+		if n != len(s) {
+			return nil, fmt.Errorf("unexpected text after string: %s", s[n:])
+		}
+		return unquoteYAML(s)
+	case '[', '{':
+		closing := map[byte]byte{'[': ']', '{': '}'}[s[0]]
+		if s[len(s)-1] != closing {
+			return nil, fmt.Errorf("unterminated flow collection: %s", s)
+		}
+		items, err := splitFlow(s[1 : len(s)-1])
+		if err != nil {
+			return nil, err
+		}
+		if s[0] == '[' {
+			list := []interface{}{}
+			for _, item := range items {
+				v, err := parseYAMLScalar(item)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			return list, nil
+		}
+		m := orderedMap{}
+		for _, item := range items {
+			key, rest, ok, err := splitYAMLKey(item)
+			if err != nil {
+				return nil, err
+			}
+			if !ok || rest == "" {
+				return nil, fmt.Errorf("expected \"key: value\" in flow mapping: %s", item)
+			}
+			v, err := parseYAMLScalar(rest)
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, mapEntry{Key: key, Value: v})
+		}
+		return m, nil
+	case '|', '>':
+		return nil, fmt.Errorf("block scalars are not supported")
+	case '&', '*', '!':
+		return nil, fmt.Errorf("anchors, aliases and tags are not supported")
+	}
+
+	switch s {
+	case "null", "Null", "NULL", "~":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if n, ok := parseNumber(s); ok {
+		return n, nil
+	}
+	return s, nil
+}
+
+// splitFlow 按顶层逗号拆分流式集合的内容
+func splitFlow(s string) ([]string, error) {
+	var items []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"', '\'':
+			n, err := scanQuoted(s[i:])
+			if err != nil {
+				return nil, err
+			}
+			i += n - 1
+		case '[', '{':
+			depth++
+		case ']', '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if last := strings.TrimSpace(s[start:]); last != "" {
+		items = append(items, last)
+	}
+	for _, item := range items {
+		if item == "" {
+			return nil, fmt.Errorf("empty item in flow collection")
+		}
+	}
+	return items, nil
+}
+
+// parseNumber 解析十进制整数或浮点数，允许TOML的下划线分隔，返回合法的JSON数字
+func parseNumber(s string) (json.Number, bool) {
+	s = strings.ReplaceAll(s, "_", "")
+	if s == "" || strings.ContainsAny(s, "xXoObB") {
+		return "", false
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return json.Number(strconv.FormatInt(i, 10)), true
+	}
+	if strings.ContainsAny(s, "iInN") {
+		// inf和nan无法用JSON表示
+		return "", false
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return json.Number(strconv.FormatFloat(f, 'g', -1, 64)), true
+	}
+	return "", false
+}
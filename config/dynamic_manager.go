@@ -2,12 +2,21 @@ package config
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
 	"time"
 )
 
+var (
+	// ErrChangeLogDisabled 未启用配置变更日志
+	ErrChangeLogDisabled = errors.New("config change log is not enabled")
+
+	// ErrConfigSnapshotMissing 变更记录中没有完整配置（旧版本写入的记录），无法回滚到该版本
+	ErrConfigSnapshotMissing = errors.New("config version has no full config snapshot")
+)
+
 // DynamicConfigManager 动态配置管理器
 // 扩展默认配置管理器，增加配置动态更新功能
 type DynamicConfigManager struct {
@@ -34,6 +43,16 @@ type DynamicConfigManager struct {
 
 	// 是否启用变更日志
 	enableChangeLog bool
+
+	// 日志监听器是否已注册，重复启用时不再注册，避免同一变更记录多个版本
+	loggerListenerRegistered bool
+
+	// 串行化手动应用和回滚，使日志监听器能取得本次变更的来源
+	applyMu sync.Mutex
+
+	// 正在进行的手动变更的来源和描述，为空时表示配置文件变更
+	applySource      string
+	applyDescription string
 }
 
 // NewDynamicConfigManager 创建动态配置管理器
@@ -56,11 +75,10 @@ func NewDynamicConfigManager() (*DynamicConfigManager, error) {
 
 // InitWithConfigFile 使用配置文件初始化
 func (dm *DynamicConfigManager) InitWithConfigFile(ctx context.Context, configPath string, watchChanges bool) error {
-	dm.mu.Lock()
-	defer dm.mu.Unlock()
-
 	// 保存配置路径
+	dm.mu.Lock()
 	dm.configPath = configPath
+	dm.mu.Unlock()
 
 	// 加载配置
 	config, err := dm.baseManager.LoadConfig(ctx, configPath)
@@ -68,11 +86,14 @@ func (dm *DynamicConfigManager) InitWithConfigFile(ctx context.Context, configPa
 		return fmt.Errorf("failed to load config file: %v", err)
 	}
 
-	// 应用配置
+	// 应用配置，不持有dm.mu，变更日志监听器需要读取它
 	if err := dm.baseManager.ApplyConfig(ctx, config); err != nil {
 		return fmt.Errorf("failed to apply config: %v", err)
 	}
 
+	dm.mu.Lock()
+	defer dm.mu.Unlock()
+
 	// 如果启用了监视，则开始监视配置文件
 	if watchChanges {
 		if err := dm.watcher.WatchConfig(configPath); err != nil {
@@ -106,33 +127,79 @@ func (dm *DynamicConfigManager) ValidateConfig(ctx context.Context, config *Conf
 
 // ApplyConfig 应用配置到系统
 func (dm *DynamicConfigManager) ApplyConfig(ctx context.Context, config *Config) error {
-	// 记录配置变更（如果启用）
-	if dm.enableChangeLog && dm.changeLogger != nil {
-		oldConfig := dm.GetCurrentConfig()
-
-		// 应用配置
-		err := dm.baseManager.ApplyConfig(ctx, config)
-		if err != nil {
-			return err
-		}
+	return dm.applyWithSource(ctx, config, "手动应用", "通过ApplyConfig方法手动应用配置")
+}
 
-		// 记录手动应用的配置变更
-		if err := dm.changeLogger.LogConfigChange(
-			oldConfig,
-			config,
-			"手动应用",
-			"通过ApplyConfig方法手动应用配置",
-		); err != nil {
-			log.Printf("记录手动配置变更失败: %v", err)
-		}
+// applyWithSource 应用配置，变更日志由日志监听器以给定的来源和描述记录
+func (dm *DynamicConfigManager) applyWithSource(ctx context.Context, config *Config, source, description string) error {
+	dm.applyMu.Lock()
+	defer dm.applyMu.Unlock()
 
-		return nil
-	}
+	dm.mu.Lock()
+	dm.applySource, dm.applyDescription = source, description
+	dm.mu.Unlock()
+
+	defer func() {
+		dm.mu.Lock()
+		dm.applySource, dm.applyDescription = "", ""
+		dm.mu.Unlock()
+	}()
 
-	// 未启用日志，直接应用配置
 	return dm.baseManager.ApplyConfig(ctx, config)
 }
 
+// GetConfigHistory 返回最近n个配置版本，新版本在前；n<=0时返回全部
+// 历史来自变更日志，需要先调用EnableChangeLog
+func (dm *DynamicConfigManager) GetConfigHistory(n int) ([]ConfigChangeEntry, error) {
+	dm.mu.RLock()
+	logger := dm.changeLogger
+	dm.mu.RUnlock()
+
+	if logger == nil {
+		return nil, ErrChangeLogDisabled
+	}
+
+	history, err := logger.History()
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	if n > 0 && len(history) > n {
+		history = history[:n]
+	}
+	return history, nil
+}
+
+// RollbackConfig 重新应用变更日志中指定版本的配置并通知所有监听器
+// 回滚本身也会作为新版本记录；每个版本都记录了完整配置，旧版本写入的没有完整配置的记录返回ErrConfigSnapshotMissing。
+// 回滚不修改配置文件，之后配置文件变更或ForceReload仍以文件内容为准
+func (dm *DynamicConfigManager) RollbackConfig(ctx context.Context, version uint64) error {
+	dm.mu.RLock()
+	logger := dm.changeLogger
+	dm.mu.RUnlock()
+
+	if logger == nil {
+		return ErrChangeLogDisabled
+	}
+
+	entry, err := logger.Entry(version)
+	if err != nil {
+		return err
+	}
+	if entry.NewConfig == nil {
+		return fmt.Errorf("%w: %d", ErrConfigSnapshotMissing, version)
+	}
+
+	if err := dm.applyWithSource(ctx, entry.NewConfig, "回滚", fmt.Sprintf("回滚到版本%d", version)); err != nil {
+		return fmt.Errorf("failed to apply config version %d: %w", version, err)
+	}
+
+	log.Printf("配置已回滚到版本%d", version)
+	return nil
+}
+
 // GetCurrentConfig 获取当前配置
 func (dm *DynamicConfigManager) GetCurrentConfig() *Config {
 	return dm.baseManager.GetCurrentConfig()
@@ -234,13 +301,13 @@ func (dm *DynamicConfigManager) SetAutoApply(autoApply bool) {
 	dm.watcher.SetAutoApply(autoApply)
 }
 
-// EnableChangeLog 启用配置变更日志
+// EnableChangeLog 启用配置变更日志，日志格式与配置文件的扩展名一致
 func (dm *DynamicConfigManager) EnableChangeLog(logDir string) error {
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
 
 	// 创建变更日志记录器
-	logger, err := NewConfigChangeLogger(logDir)
+	logger, err := NewConfigChangeLoggerWithFormat(logDir, FormatForPath(dm.configPath))
 	if err != nil {
 		return fmt.Errorf("failed to create change logger: %v", err)
 	}
@@ -256,9 +323,12 @@ func (dm *DynamicConfigManager) EnableChangeLog(logDir string) error {
 	dm.enableChangeLog = true
 
 	// 注册一个特殊的监听器，用于记录配置变更
-	dm.baseManager.RegisterConfigChangeListener(&configChangeLoggerListener{
-		manager: dm,
-	})
+	if !dm.loggerListenerRegistered {
+		dm.baseManager.RegisterConfigChangeListener(&configChangeLoggerListener{
+			manager: dm,
+		})
+		dm.loggerListenerRegistered = true
+	}
 
 	return nil
 }
@@ -279,7 +349,7 @@ func (dm *DynamicConfigManager) DisableChangeLog() error {
 	return nil
 }
 
-// SetLogFullConfig 设置是否记录完整配置
+// SetLogFullConfig 设置是否同时记录变更前的完整配置
 func (dm *DynamicConfigManager) SetLogFullConfig(logFullConfig bool) {
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
@@ -299,7 +369,10 @@ func (l *configChangeLoggerListener) OnConfigChange(oldConfig, newConfig *Config
 	l.manager.mu.RLock()
 	logger := l.manager.changeLogger
 	enabled := l.manager.enableChangeLog
-	configPath := l.manager.configPath
+	source, description := l.manager.applySource, l.manager.applyDescription
+	if source == "" {
+		source, description = l.manager.configPath, "配置文件变更"
+	}
 	l.manager.mu.RUnlock()
 
 	if !enabled || logger == nil {
@@ -310,8 +383,8 @@ func (l *configChangeLoggerListener) OnConfigChange(oldConfig, newConfig *Config
 	err := logger.LogConfigChange(
 		oldConfig,
 		newConfig,
-		configPath,
-		"配置文件变更",
+		source,
+		description,
 	)
 
 	if err != nil {
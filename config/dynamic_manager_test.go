@@ -0,0 +1,163 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestDynamicManager 创建测试用的动态配置管理器，测试结束时关闭
+func newTestDynamicManager(t *testing.T) *DynamicConfigManager {
+	t.Helper()
+	dm, err := NewDynamicConfigManager()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { dm.Close() })
+	return dm
+}
+
+// withWorkers 返回修改了工作线程数的当前配置
+func withWorkers(dm *DynamicConfigManager, workers int) *Config {
+	config := dm.GetCurrentConfig()
+	config.Performance.Parallelism.MaxWorkers = workers
+	return config
+}
+
+// TestRollbackConfigDefaults 测试默认设置下每个版本都可以回滚，手动应用只记录一次
+func TestRollbackConfigDefaults(t *testing.T) {
+	ctx := context.Background()
+	dm := newTestDynamicManager(t)
+
+	if _, err := dm.GetConfigHistory(0); !errors.Is(err, ErrChangeLogDisabled) {
+		t.Errorf("未启用变更日志时应返回ErrChangeLogDisabled: %v", err)
+	}
+	if err := dm.EnableChangeLog(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	// 重复启用不应重复记录
+	if err := dm.EnableChangeLog(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, workers := range []int{3, 5} {
+		if err := dm.ApplyConfig(ctx, withWorkers(dm, workers)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	history, err := dm.GetConfigHistory(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].Version != 2 || history[1].Version != 1 {
+		t.Fatalf("每次手动应用应只记录一个版本: %+v", history)
+	}
+	if history[0].Source != "手动应用" {
+		t.Errorf("手动应用的来源不正确: %q", history[0].Source)
+	}
+
+	if err := dm.RollbackConfig(ctx, 1); err != nil {
+		t.Fatalf("默认设置下回滚失败: %v", err)
+	}
+	if workers := dm.GetCurrentConfig().Performance.Parallelism.MaxWorkers; workers != 3 {
+		t.Errorf("回滚后工作线程数应为3，实际%d", workers)
+	}
+	history, err = dm.GetConfigHistory(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Version != 3 || history[0].Source != "回滚" {
+		t.Errorf("回滚应记录为新版本: %+v", history)
+	}
+
+	if err := dm.RollbackConfig(ctx, 99); !errors.Is(err, ErrConfigVersionNotFound) {
+		t.Errorf("回滚到不存在的版本应返回ErrConfigVersionNotFound: %v", err)
+	}
+}
+
+// TestRollbackConfigFormats 测试变更日志使用配置文件的格式，重新打开后仍能回滚
+func TestRollbackConfigFormats(t *testing.T) {
+	ctx := context.Background()
+	for _, ext := range []string{".json", ".yaml", ".toml"} {
+		t.Run(ext, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "config"+ext)
+			logDir := filepath.Join(dir, "logs")
+
+			dm := newTestDynamicManager(t)
+			if err := dm.SaveConfig(ctx, withWorkers(dm, 2), path); err != nil {
+				t.Fatal(err)
+			}
+			if err := dm.InitWithConfigFile(ctx, path, false); err != nil {
+				t.Fatal(err)
+			}
+			if err := dm.EnableChangeLog(logDir); err != nil {
+				t.Fatal(err)
+			}
+			for _, workers := range []int{6, 7} {
+				if err := dm.ApplyConfig(ctx, withWorkers(dm, workers)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			dm.Close()
+
+			// 新的管理器接着编号并回滚到之前进程记录的版本
+			dm = newTestDynamicManager(t)
+			if err := dm.InitWithConfigFile(ctx, path, false); err != nil {
+				t.Fatal(err)
+			}
+			if err := dm.EnableChangeLog(logDir); err != nil {
+				t.Fatal(err)
+			}
+			if err := dm.RollbackConfig(ctx, 2); err != nil {
+				t.Fatalf("回滚失败: %v", err)
+			}
+			if workers := dm.GetCurrentConfig().Performance.Parallelism.MaxWorkers; workers != 7 {
+				t.Errorf("回滚后工作线程数应为7，实际%d", workers)
+			}
+			history, err := dm.GetConfigHistory(0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(history) != 3 || history[0].Version != 3 {
+				t.Errorf("重新打开后应接着编号: %+v", history)
+			}
+		})
+	}
+}
+
+// TestInitWithConfigFileChangeLog 测试先启用变更日志再用配置文件初始化不会死锁，文件变更以文件路径为来源记录
+func TestInitWithConfigFileChangeLog(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+
+	dm := newTestDynamicManager(t)
+	if err := dm.SaveConfig(ctx, dm.GetDefaultConfig(), path); err != nil {
+		t.Fatal(err)
+	}
+	if err := dm.EnableChangeLog(filepath.Join(dir, "logs")); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- dm.InitWithConfigFile(ctx, path, false) }()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("启用变更日志后初始化死锁")
+	}
+
+	history, err := dm.GetConfigHistory(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Source != path {
+		t.Errorf("初始化应以文件路径为来源记录一次: %+v", history)
+	}
+}
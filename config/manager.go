@@ -2,7 +2,6 @@ package config
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"runtime"
@@ -46,15 +45,15 @@ func (cm *DefaultConfigManager) LoadConfig(ctx context.Context, path string) (*C
 		return nil, fmt.Errorf("failed to read config file: %v", err)
 	}
 
-	// 解析配置
+	// 按扩展名解析配置
 	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
+	if err := Unmarshal(data, &config, FormatForPath(path)); err != nil {
 		return nil, fmt.Errorf("failed to parse config: %v", err)
 	}
 
 	// 验证配置
 	if err := cm.ValidateConfig(ctx, &config); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %v", err)
+		return nil, err
 	}
 
 	return &config, nil
@@ -64,11 +63,11 @@ func (cm *DefaultConfigManager) LoadConfig(ctx context.Context, path string) (*C
 func (cm *DefaultConfigManager) SaveConfig(ctx context.Context, config *Config, path string) error {
 	// 验证配置
 	if err := cm.ValidateConfig(ctx, config); err != nil {
-		return fmt.Errorf("invalid configuration: %v", err)
+		return err
 	}
 
-	// 序列化配置
-	data, err := json.MarshalIndent(config, "", "  ")
+	// 按扩展名序列化配置
+	data, err := Marshal(config, FormatForPath(path))
 	if err != nil {
 		return fmt.Errorf("failed to serialize config: %v", err)
 	}
@@ -100,6 +99,7 @@ func (cm *DefaultConfigManager) GetDefaultConfig() *Config {
 				MetadataCacheSize:  128 * 1024 * 1024,  // 128MB
 				MetadataCacheTTL:   3600,               // 1小时
 				DataCacheSize:      1024 * 1024 * 1024, // 1GB
+				CachePolicy:        "lru",
 				PrefetchStrategy:   "adaptive",
 				PrefetchWindowSize: 16 * 1024 * 1024, // 16MB
 			},
@@ -127,6 +127,10 @@ func (cm *DefaultConfigManager) GetDefaultConfig() *Config {
 				ReclamationThreshold: 75,
 				UseMemoryPool:        true,
 			},
+			Throttle: ThrottleConfig{
+				BackgroundBytesPerSecond: 0, // 默认不限速
+				BackgroundIOPS:           0,
+			},
 		},
 		Security: SecurityPolicy{
 			Encryption: EncryptionSettings{
@@ -144,6 +148,7 @@ func (cm *DefaultConfigManager) GetDefaultConfig() *Config {
 			Types:           []string{"metadata", "content"},
 			Mode:            "async",
 			PersistenceMode: "hybrid",
+			Shards:          16,
 			Fields: []IndexField{
 				{Name: "TagTitle", Enable: true},
 				{Name: "TagAuthor", Enable: true},
@@ -2,6 +2,8 @@ package config
 
 import (
 	"time"
+
+	"github.com/bpfs/fragmenta/throttle"
 )
 
 // Config 系统总体配置
@@ -83,6 +85,9 @@ type CacheStrategy struct {
 	// 数据缓存大小
 	DataCacheSize int64 `json:"dataCacheSize"`
 
+	// 块缓存淘汰策略，如"lru"
+	CachePolicy string `json:"cachePolicy"`
+
 	// 预读取策略
 	PrefetchStrategy string `json:"prefetchStrategy"`
 
@@ -115,6 +120,9 @@ type PerformanceConfig struct {
 
 	// 内存配置
 	Memory MemoryConfig `json:"memory"`
+
+	// 后台任务限速
+	Throttle ThrottleConfig `json:"throttle"`
 }
 
 // ParallelismConfig 并行处理配置
@@ -144,6 +152,20 @@ type IOConfig struct {
 	WriteMergeWindow int `json:"writeMergeWindow"`
 }
 
+// ThrottleConfig 后台任务（整理、模式转换、重平衡、索引重建）共享的限速配置
+type ThrottleConfig struct {
+	// 后台任务合计带宽上限(字节/秒)，0表示不限速
+	BackgroundBytesPerSecond int64 `json:"backgroundBytesPerSecond"`
+
+	// 后台任务合计IOPS上限，0表示不限速
+	BackgroundIOPS int `json:"backgroundIOPS"`
+}
+
+// NewLimiter 按配置创建后台任务共享的限速器，配置变更时可对同一个限速器调用SetLimits
+func (c ThrottleConfig) NewLimiter() *throttle.Limiter {
+	return throttle.New(c.BackgroundBytesPerSecond, c.BackgroundIOPS)
+}
+
 // MemoryConfig 内存配置
 type MemoryConfig struct {
 	// 最大内存使用量
@@ -173,8 +195,26 @@ type EncryptionSettings struct {
 	// 加密算法
 	Algorithm string `json:"algorithm"`
 
-	// 密钥源
+	// 密钥源：keystore、aws-kms、gcp-kms 或 vault
 	KeySource string `json:"keySource"`
+
+	// 外部密钥管理服务设置，密钥源不是 keystore 时使用
+	KMS KMSSettings `json:"kms"`
+}
+
+// KMSSettings 外部密钥管理服务设置，访问凭据从环境变量读取，不写入配置
+type KMSSettings struct {
+	// 主密钥标识：AWS为密钥ID或ARN，GCP为cryptoKey资源名，Vault为transit密钥名
+	KeyID string `json:"keyId"`
+
+	// AWS区域
+	Region string `json:"region"`
+
+	// 服务地址，为空时使用默认地址
+	Endpoint string `json:"endpoint"`
+
+	// Vault transit 引擎挂载路径
+	Mount string `json:"mount"`
 }
 
 // AccessControlSettings 访问控制设置
@@ -200,6 +240,9 @@ type IndexPolicy struct {
 	// 持久化模式
 	PersistenceMode string `json:"persistenceMode"`
 
+	// 索引分片数
+	Shards int `json:"shards"`
+
 	// 索引字段列表
 	Fields []IndexField `json:"fields"`
 }
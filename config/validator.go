@@ -1,203 +1,344 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
-// DefaultConfigValidator 默认配置验证器实现
-type DefaultConfigValidator struct {
-	// 可设置验证选项
+// 配置问题的类型，可以用errors.Is判断Issue或ValidationError
+var (
+	// ErrInvalidConfig 配置未通过验证
+	ErrInvalidConfig = errors.New("invalid configuration")
+
+	// ErrRequired 必填字段为空
+	ErrRequired = errors.New("required value missing")
+
+	// ErrOutOfRange 数值超出允许范围
+	ErrOutOfRange = errors.New("value out of range")
+
+	// ErrUnknownOption 枚举值不在允许的取值中
+	ErrUnknownOption = errors.New("unknown option")
+
+	// ErrMalformed 值的格式无法解析
+	ErrMalformed = errors.New("malformed value")
+)
+
+// Severity 问题级别
+type Severity string
+
+const (
+	// SeverityError 配置无法使用
+	SeverityError Severity = "error"
+
+	// SeverityWarning 配置可以使用，但可能不是预期的行为
+	SeverityWarning Severity = "warning"
+)
+
+// Issue 配置中的一个问题
+type Issue struct {
+	// 字段路径，与JSON字段名一致，如"storage.blockStrategy.blockSize"
+	Field string `json:"field"`
+
+	// 字段当前值
+	Value interface{} `json:"value"`
+
+	// 问题级别
+	Severity Severity `json:"severity"`
+
+	// 问题描述，包含允许的取值或范围
+	Message string `json:"message"`
+
+	// 问题类型，如ErrOutOfRange
+	Err error `json:"-"`
 }
 
-// NewDefaultConfigValidator 创建默认配置验证器
-func NewDefaultConfigValidator() *DefaultConfigValidator {
-	return &DefaultConfigValidator{}
+// Error 实现error接口
+func (i Issue) Error() string {
+	return fmt.Sprintf("%s: %s (got %v)", i.Field, i.Message, i.Value)
 }
 
-// Validate 验证配置
-func (v *DefaultConfigValidator) Validate(config *Config) error {
-	if config == nil {
-		return fmt.Errorf("config cannot be nil")
-	}
+// Unwrap 返回问题类型
+func (i Issue) Unwrap() error {
+	return i.Err
+}
+
+// ValidationError 配置验证失败，包含全部问题
+type ValidationError struct {
+	Issues []Issue
+}
 
-	// 验证各个部分
-	if err := v.ValidateSection("storage", config.Storage); err != nil {
-		return err
+// Error 实现error接口
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Issues))
+	for _, issue := range e.Issues {
+		if issue.Severity == SeverityError {
+			messages = append(messages, issue.Error())
+		}
 	}
+	return fmt.Sprintf("%v: %s", ErrInvalidConfig, strings.Join(messages, "; "))
+}
 
-	if err := v.ValidateSection("performance", config.Performance); err != nil {
-		return err
+// Unwrap 返回ErrInvalidConfig和每个错误级别的问题
+func (e *ValidationError) Unwrap() []error {
+	errs := []error{ErrInvalidConfig}
+	for _, issue := range e.Issues {
+		if issue.Severity == SeverityError {
+			errs = append(errs, issue)
+		}
 	}
+	return errs
+}
 
-	if err := v.ValidateSection("security", config.Security); err != nil {
-		return err
+// ValidateConfig 检查配置并返回全部问题，没有问题时返回nil
+func ValidateConfig(config *Config) []Issue {
+	if config == nil {
+		return []Issue{{Field: "", Severity: SeverityError, Message: "config cannot be nil", Err: ErrRequired}}
 	}
 
-	if err := v.ValidateSection("index", config.Index); err != nil {
-		return err
+	v := NewDefaultConfigValidator()
+	var issues []Issue
+	issues = append(issues, v.validateStoragePolicy(config.Storage)...)
+	issues = append(issues, v.validatePerformanceConfig(config.Performance)...)
+	issues = append(issues, v.validateSecurityPolicy(config.Security)...)
+	issues = append(issues, v.validateIndexPolicy(config.Index)...)
+	issues = append(issues, v.validateSystemConfig(config.System)...)
+	return issues
+}
+
+// HasErrors 问题列表中是否有错误级别的问题
+func HasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
 	}
+	return false
+}
 
-	if err := v.ValidateSection("system", config.System); err != nil {
-		return err
+// issuesError 有错误级别的问题时返回*ValidationError
+func issuesError(issues []Issue) error {
+	if !HasErrors(issues) {
+		return nil
 	}
+	return &ValidationError{Issues: issues}
+}
+
+// DefaultConfigValidator 默认配置验证器实现
+type DefaultConfigValidator struct {
+	// 可设置验证选项
+}
+
+// NewDefaultConfigValidator 创建默认配置验证器
+func NewDefaultConfigValidator() *DefaultConfigValidator {
+	return &DefaultConfigValidator{}
+}
 
-	return nil
+// Validate 验证配置，有错误级别的问题时返回*ValidationError
+func (v *DefaultConfigValidator) Validate(config *Config) error {
+	return issuesError(ValidateConfig(config))
 }
 
 // ValidateSection 验证特定配置段
 func (v *DefaultConfigValidator) ValidateSection(sectionName string, section interface{}) error {
-	switch sectionName {
-	case "storage":
-		return v.validateStoragePolicy(section.(StoragePolicy))
-	case "performance":
-		return v.validatePerformanceConfig(section.(PerformanceConfig))
-	case "security":
-		return v.validateSecurityPolicy(section.(SecurityPolicy))
-	case "index":
-		return v.validateIndexPolicy(section.(IndexPolicy))
-	case "system":
-		return v.validateSystemConfig(section.(SystemConfig))
+	var issues []Issue
+	switch s := section.(type) {
+	case StoragePolicy:
+		issues = v.validateStoragePolicy(s)
+	case PerformanceConfig:
+		issues = v.validatePerformanceConfig(s)
+	case SecurityPolicy:
+		issues = v.validateSecurityPolicy(s)
+	case IndexPolicy:
+		issues = v.validateIndexPolicy(s)
+	case SystemConfig:
+		issues = v.validateSystemConfig(s)
 	default:
-		return fmt.Errorf("unknown configuration section: %s", sectionName)
+		return fmt.Errorf("%w: unknown configuration section: %s", ErrInvalidConfig, sectionName)
 	}
+	return issuesError(issues)
 }
 
-// 验证存储策略
-func (v *DefaultConfigValidator) validateStoragePolicy(policy StoragePolicy) error {
-	// 验证存储模式
-	if !v.isValidStorageMode(policy.Mode) {
-		return fmt.Errorf("invalid storage mode: %s", policy.Mode)
+// issueList 收集问题的辅助类型
+type issueList []Issue
+
+// add 添加错误级别的问题
+func (l *issueList) add(field string, value interface{}, err error, format string, args ...interface{}) {
+	*l = append(*l, Issue{Field: field, Value: value, Severity: SeverityError, Message: fmt.Sprintf(format, args...), Err: err})
+}
+
+// warn 添加警告级别的问题
+func (l *issueList) warn(field string, value interface{}, err error, format string, args ...interface{}) {
+	*l = append(*l, Issue{Field: field, Value: value, Severity: SeverityWarning, Message: fmt.Sprintf(format, args...), Err: err})
+}
+
+// nonNegative 检查数值不为负
+func nonNegative[T int | int64](l *issueList, field string, value T) {
+	if value < 0 {
+		l.add(field, value, ErrOutOfRange, "must not be negative")
 	}
+}
 
-	// 验证自动转换阈值
-	if policy.AutoConvertThreshold < 0 {
-		return fmt.Errorf("auto convert threshold cannot be negative")
+// oneOf 检查枚举值
+func oneOf[T ~string](l *issueList, field string, value T, allowed ...T) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
 	}
+	l.add(field, value, ErrUnknownOption, "must be one of %v", allowed)
+}
 
-	// 验证块大小(应为2的幂)
+// 验证存储策略
+func (v *DefaultConfigValidator) validateStoragePolicy(policy StoragePolicy) []Issue {
+	var l issueList
+
+	oneOf(&l, "storage.mode", policy.Mode, ContainerMode, DirectoryMode, HybridMode)
+	nonNegative(&l, "storage.autoConvertThreshold", policy.AutoConvertThreshold)
+
+	// 块大小应为2的幂
 	if !v.isPowerOfTwo(policy.BlockStrategy.BlockSize) {
-		return fmt.Errorf("block size must be a power of 2")
+		l.add("storage.blockStrategy.blockSize", policy.BlockStrategy.BlockSize, ErrOutOfRange, "must be a positive power of 2")
 	}
-
-	// 验证其他字段
-	if policy.BlockStrategy.PreallocateBlocks < 0 {
-		return fmt.Errorf("preallocate blocks cannot be negative")
+	nonNegative(&l, "storage.blockStrategy.preallocateBlocks", policy.BlockStrategy.PreallocateBlocks)
+	nonNegative(&l, "storage.blockStrategy.blockCacheSize", policy.BlockStrategy.BlockCacheSize)
+
+	cache := policy.CacheStrategy
+	nonNegative(&l, "storage.cacheStrategy.metadataCacheSize", cache.MetadataCacheSize)
+	nonNegative(&l, "storage.cacheStrategy.metadataCacheTTL", cache.MetadataCacheTTL)
+	nonNegative(&l, "storage.cacheStrategy.dataCacheSize", cache.DataCacheSize)
+	nonNegative(&l, "storage.cacheStrategy.prefetchWindowSize", cache.PrefetchWindowSize)
+	if cache.CachePolicy != "" {
+		oneOf(&l, "storage.cacheStrategy.cachePolicy", cache.CachePolicy, "lru")
 	}
-
-	if policy.CacheStrategy.MetadataCacheTTL < 0 {
-		return fmt.Errorf("metadata cache TTL cannot be negative")
+	if cache.PrefetchStrategy != "" {
+		oneOf(&l, "storage.cacheStrategy.prefetchStrategy", cache.PrefetchStrategy, "none", "sequential", "adaptive")
 	}
 
 	// 验证压缩设置
-	if policy.Compression.Enabled && policy.Compression.Level < 0 {
-		return fmt.Errorf("compression level cannot be negative")
+	if policy.Compression.Enabled {
+		oneOf(&l, "storage.compression.algorithm", policy.Compression.Algorithm, "lz4", "zstd", "gzip", "snappy")
+		nonNegative(&l, "storage.compression.level", policy.Compression.Level)
+		nonNegative(&l, "storage.compression.minSize", policy.Compression.MinSize)
 	}
 
-	return nil
+	return l
 }
 
 // 验证性能配置
-func (v *DefaultConfigValidator) validatePerformanceConfig(config PerformanceConfig) error {
+func (v *DefaultConfigValidator) validatePerformanceConfig(config PerformanceConfig) []Issue {
+	var l issueList
+
 	// 验证并行设置
 	if config.Parallelism.MaxWorkers <= 0 {
-		return fmt.Errorf("max workers must be positive")
+		l.add("performance.parallelism.maxWorkers", config.Parallelism.MaxWorkers, ErrOutOfRange, "must be positive")
 	}
-
 	if config.Parallelism.WorkQueueLength <= 0 {
-		return fmt.Errorf("work queue length must be positive")
+		l.add("performance.parallelism.workQueueLength", config.Parallelism.WorkQueueLength, ErrOutOfRange, "must be positive")
 	}
+	nonNegative(&l, "performance.parallelism.batchSize", config.Parallelism.BatchSize)
+
+	// 验证IO设置
+	nonNegative(&l, "performance.io.fdCacheSize", config.IO.FDCacheSize)
+	if config.IO.FDCacheSize == 0 {
+		l.warn("performance.io.fdCacheSize", 0, ErrOutOfRange, "0 disables the file descriptor cache")
+	}
+	nonNegative(&l, "performance.io.writeMergeWindow", config.IO.WriteMergeWindow)
 
 	// 验证内存设置
+	if config.Memory.MaxMemoryUsage != "" {
+		if _, err := parseByteSize(config.Memory.MaxMemoryUsage); err != nil {
+			l.add("performance.memory.maxMemoryUsage", config.Memory.MaxMemoryUsage, ErrMalformed, "must be a size such as 512MB or 4GB")
+		}
+	}
 	if config.Memory.ReclamationThreshold < 0 || config.Memory.ReclamationThreshold > 100 {
-		return fmt.Errorf("reclamation threshold must be between 0 and 100")
+		l.add("performance.memory.reclamationThreshold", config.Memory.ReclamationThreshold, ErrOutOfRange, "must be between 0 and 100")
 	}
 
-	// 验证IO设置
-	if config.IO.FDCacheSize < 0 {
-		return fmt.Errorf("FD cache size cannot be negative")
-	}
+	// 验证限速设置
+	nonNegative(&l, "performance.throttle.backgroundBytesPerSecond", config.Throttle.BackgroundBytesPerSecond)
+	nonNegative(&l, "performance.throttle.backgroundIOPS", config.Throttle.BackgroundIOPS)
 
-	return nil
+	return l
 }
 
 // 验证安全策略
-func (v *DefaultConfigValidator) validateSecurityPolicy(policy SecurityPolicy) error {
+func (v *DefaultConfigValidator) validateSecurityPolicy(policy SecurityPolicy) []Issue {
+	var l issueList
+
 	// 验证加密设置
 	if policy.Encryption.Enabled {
 		if policy.Encryption.Algorithm == "" {
-			return fmt.Errorf("encryption algorithm cannot be empty when encryption is enabled")
+			l.add("security.encryption.algorithm", "", ErrRequired, "cannot be empty when encryption is enabled")
+		} else {
+			oneOf(&l, "security.encryption.algorithm", policy.Encryption.Algorithm,
+				"AES-256-GCM", "AES-256-CTR", "ChaCha20-Poly1305", "XChaCha20-Poly1305")
 		}
-
 		if policy.Encryption.KeySource == "" {
-			return fmt.Errorf("key source cannot be empty when encryption is enabled")
+			l.add("security.encryption.keySource", "", ErrRequired, "cannot be empty when encryption is enabled")
+		} else {
+			oneOf(&l, "security.encryption.keySource", policy.Encryption.KeySource, "keystore", "aws-kms", "gcp-kms", "vault")
+		}
+		switch policy.Encryption.KeySource {
+		case "aws-kms", "gcp-kms", "vault":
+			if policy.Encryption.KMS.KeyID == "" {
+				l.add("security.encryption.kms.keyId", "", ErrRequired, "cannot be empty when key source is %s", policy.Encryption.KeySource)
+			}
 		}
 	}
 
 	// 验证访问控制设置
 	if policy.AccessControl.Enabled && policy.AccessControl.Model == "" {
-		return fmt.Errorf("access control model cannot be empty when access control is enabled")
+		l.add("security.accessControl.model", "", ErrRequired, "cannot be empty when access control is enabled")
 	}
 
-	return nil
+	return l
 }
 
 // 验证索引策略
-func (v *DefaultConfigValidator) validateIndexPolicy(policy IndexPolicy) error {
+func (v *DefaultConfigValidator) validateIndexPolicy(policy IndexPolicy) []Issue {
+	var l issueList
+
 	// 如果索引启用，验证必要字段
 	if policy.Enabled {
 		if len(policy.Types) == 0 {
-			return fmt.Errorf("at least one index type must be specified when indexing is enabled")
+			l.add("index.types", policy.Types, ErrRequired, "at least one index type must be specified when indexing is enabled")
 		}
-
-		// 验证索引模式
-		if !v.isValidIndexMode(policy.Mode) {
-			return fmt.Errorf("invalid index mode: %s", policy.Mode)
+		oneOf(&l, "index.mode", policy.Mode, "sync", "async", "manual")
+		oneOf(&l, "index.persistenceMode", policy.PersistenceMode, "memory", "disk", "hybrid")
+		if policy.Shards <= 0 {
+			l.add("index.shards", policy.Shards, ErrOutOfRange, "must be at least 1 when indexing is enabled")
 		}
+	}
 
-		// 验证持久化模式
-		if !v.isValidPersistenceMode(policy.PersistenceMode) {
-			return fmt.Errorf("invalid persistence mode: %s", policy.PersistenceMode)
+	for i, field := range policy.Fields {
+		if field.Name == "" {
+			l.add(fmt.Sprintf("index.fields[%d].name", i), "", ErrRequired, "cannot be empty")
 		}
 	}
 
-	return nil
+	return l
 }
 
 // 验证系统配置
-func (v *DefaultConfigValidator) validateSystemConfig(config SystemConfig) error {
+func (v *DefaultConfigValidator) validateSystemConfig(config SystemConfig) []Issue {
+	var l issueList
+
 	// 验证路径不为空
 	if config.RootPath == "" {
-		return fmt.Errorf("root path cannot be empty")
+		l.add("system.rootPath", "", ErrRequired, "cannot be empty")
 	}
-
 	if config.TempPath == "" {
-		return fmt.Errorf("temp path cannot be empty")
+		l.add("system.tempPath", "", ErrRequired, "cannot be empty")
 	}
 
 	// 验证日志级别
 	if !v.isValidLogLevel(config.LogLevel) {
-		return fmt.Errorf("invalid log level: %s", config.LogLevel)
+		l.add("system.logLevel", config.LogLevel, ErrUnknownOption, "must be one of [debug info warn error fatal]")
 	}
 
-	return nil
-}
-
-// 辅助方法：验证存储模式是否有效
-func (v *DefaultConfigValidator) isValidStorageMode(mode StorageMode) bool {
-	return mode == ContainerMode || mode == DirectoryMode || mode == HybridMode
-}
-
-// 辅助方法：验证索引模式是否有效
-func (v *DefaultConfigValidator) isValidIndexMode(mode string) bool {
-	validModes := []string{"sync", "async", "manual"}
-	return v.isStringInSlice(mode, validModes)
-}
-
-// 辅助方法：验证持久化模式是否有效
-func (v *DefaultConfigValidator) isValidPersistenceMode(mode string) bool {
-	validModes := []string{"memory", "disk", "hybrid"}
-	return v.isStringInSlice(mode, validModes)
+	return l
 }
 
 // 辅助方法：验证日志级别是否有效
@@ -220,3 +361,26 @@ func (v *DefaultConfigValidator) isStringInSlice(value string, slice []string) b
 func (v *DefaultConfigValidator) isPowerOfTwo(n int) bool {
 	return n > 0 && (n&(n-1)) == 0
 }
+
+// parseByteSize 解析"512MB"、"4GB"这样的容量，单位按1024进制，不带单位时为字节
+func parseByteSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	units := []struct {
+		suffix string
+		scale  int64
+	}{{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1}}
+
+	scale := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(s, unit.suffix) {
+			s, scale = strings.TrimSpace(strings.TrimSuffix(s, unit.suffix)), unit.scale
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%w: %q", ErrMalformed, s)
+	}
+	return n * scale, nil
+}
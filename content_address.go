@@ -0,0 +1,412 @@
+package fragmenta
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// 内容寻址表常量
+const (
+	// ContentTableMagic 内容寻址表魔数 "FCAS"
+	ContentTableMagic uint32 = 0x46434153
+	// ContentTableVersion 内容寻址表版本
+	ContentTableVersion uint16 = 1
+)
+
+// ContentHash 对象内容的SHA-256，内容寻址模式下用于查找对象的块ID
+type ContentHash [sha256.Size]byte
+
+// String 返回十六进制形式
+func (h ContentHash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// ParseContentHash 解析十六进制形式的内容哈希
+func ParseContentHash(s string) (ContentHash, error) {
+	var hash ContentHash
+	raw, err := hex.DecodeString(s)
+	if err != nil || len(raw) != len(hash) {
+		return hash, fmt.Errorf("%w: 无效的内容哈希 %q", ErrInvalidArgument, s)
+	}
+	copy(hash[:], raw)
+	return hash, nil
+}
+
+// contentTable 内容寻址表，记录内容哈希与对象第一个块的对应关系
+type contentTable struct {
+	byHash  map[ContentHash]uint32
+	byBlock map[uint32]ContentHash
+	dirty   bool
+}
+
+// IsContentAddressed 文件是否以内容寻址模式创建。
+// 内容寻址模式下，对象（WriteBlock写入的普通块，或WriteFromReader写入的整条块链）由内容的SHA-256标识：
+// 写入与已有对象内容相同的数据时不再保存新的副本，而是返回已有对象的块ID，因此重复写入是幂等的；
+// 块ID仍是uint32，内容哈希与块ID的对应关系保存在内容寻址表中（位置记录在TagContentTable），
+// 可以用 LookupContent 和 GetContentHash 互相转换。读取对象时校验内容哈希，不符时返回ErrContentMismatch。
+// 对象由内容标识，重复写入时新的块属性和元数据标签被忽略，已有对象的属性保持不变；
+// 没有引用计数，删除对象后所有写入者得到的块ID都失效。按内容寻址的对象不可修改，
+// 不能再通过LinkBlocks或AppendToBlockID链接。系统块和命名空间中的文件不按内容寻址
+func (f *FragmentaImpl) IsContentAddressed() bool {
+	return f.contentAddressed
+}
+
+// LookupContent 返回内容哈希对应对象的第一个块ID，没有该内容时返回ErrBlockNotFound
+func (f *FragmentaImpl) LookupContent(hash ContentHash) (uint32, error) {
+	if !f.contentAddressed {
+		return 0, fmt.Errorf("%w: 文件未启用内容寻址模式", ErrInvalidOperation)
+	}
+
+	f.contentMutex.Lock()
+	defer f.contentMutex.Unlock()
+
+	if err := f.loadContentLocked(); err != nil {
+		return 0, err
+	}
+	blockID, ok := f.lookupContentLocked(hash)
+	if !ok {
+		return 0, ErrBlockNotFound
+	}
+	return blockID, nil
+}
+
+// GetContentHash 返回对象的内容哈希，blockID不是按内容寻址的对象的第一个块时返回ErrBlockNotFound
+func (f *FragmentaImpl) GetContentHash(blockID uint32) (ContentHash, error) {
+	if !f.contentAddressed {
+		return ContentHash{}, fmt.Errorf("%w: 文件未启用内容寻址模式", ErrInvalidOperation)
+	}
+	if f.isTrashed(blockID) {
+		return ContentHash{}, ErrBlockNotFound
+	}
+
+	f.contentMutex.Lock()
+	defer f.contentMutex.Unlock()
+
+	if err := f.loadContentLocked(); err != nil {
+		return ContentHash{}, err
+	}
+	hash, ok := f.content.byBlock[blockID]
+	if !ok {
+		return ContentHash{}, ErrBlockNotFound
+	}
+	return hash, nil
+}
+
+// contentAddressable 按options写入的块是否按内容寻址：只有独立的普通块是对象
+func (f *FragmentaImpl) contentAddressable(options *BlockOptions) bool {
+	if !f.contentAddressed {
+		return false
+	}
+	return options == nil || (options.BlockType == NormalBlockType && options.AppendToBlockID == 0)
+}
+
+// writeContentBlock 按内容写入单块对象，已有相同内容的对象时返回其块ID，created为false
+func (f *FragmentaImpl) writeContentBlock(data []byte, options *BlockOptions) (uint32, bool, error) {
+	if f.readOnly {
+		return 0, false, ErrReadOnly
+	}
+	hash := ContentHash(sha256.Sum256(data))
+
+	f.contentMutex.Lock()
+	if err := f.loadContentLocked(); err != nil {
+		f.contentMutex.Unlock()
+		return 0, false, err
+	}
+	if blockID, ok := f.lookupContentLocked(hash); ok {
+		f.contentMutex.Unlock()
+		return blockID, false, nil
+	}
+	f.contentMutex.Unlock()
+
+	// 写入块时会同步索引等组件，它们可能读取块，因此不持有contentMutex
+	blockID, err := f.writeBlock(data, options)
+	if err != nil {
+		return blockID, blockID != 0, err
+	}
+
+	f.contentMutex.Lock()
+	existing, ok := f.lookupContentLocked(hash)
+	if !ok {
+		f.addContentLocked(hash, blockID)
+	}
+	f.contentMutex.Unlock()
+
+	// 并发写入了相同的内容，保留先登记的块
+	if ok {
+		f.freeBlocks([]uint32{blockID})
+		return existing, false, nil
+	}
+	return blockID, true, nil
+}
+
+// addressObject 登记WriteFromReader写入的对象，已有相同内容的对象时释放本次写入的块并返回已有对象
+func (f *FragmentaImpl) addressObject(handle *ObjectHandle, written []uint32, hash ContentHash) (*ObjectHandle, error) {
+	f.contentMutex.Lock()
+	if err := f.loadContentLocked(); err != nil {
+		f.contentMutex.Unlock()
+		f.freeBlocks(written)
+		return nil, err
+	}
+	existing, ok := f.lookupContentLocked(hash)
+	if !ok {
+		f.addContentLocked(hash, handle.FirstBlockID)
+	}
+	f.contentMutex.Unlock()
+
+	if !ok {
+		return handle, nil
+	}
+	f.freeBlocks(written)
+	return f.objectHandle(existing, handle.Size)
+}
+
+// objectHandle 沿块链构造已有对象的句柄
+func (f *FragmentaImpl) objectHandle(firstBlockID uint32, size int64) (*ObjectHandle, error) {
+	handle := &ObjectHandle{FirstBlockID: firstBlockID, Size: size}
+	visited := make(map[uint32]struct{})
+
+	for id := firstBlockID; id != 0; {
+		if _, ok := visited[id]; ok {
+			return nil, fmt.Errorf("%w: block %d appears twice", ErrBrokenBlockChain, id)
+		}
+		visited[id] = struct{}{}
+
+		header, err := f.blockManager.GetBlockInfo(id)
+		if err != nil {
+			return nil, err
+		}
+		handle.LastBlockID = id
+		handle.BlockCount++
+		id = header.NextBlock
+	}
+	return handle, nil
+}
+
+// contentHash 返回按内容寻址的对象的内容哈希
+func (f *FragmentaImpl) contentHash(blockID uint32) (ContentHash, bool) {
+	if !f.contentAddressed {
+		return ContentHash{}, false
+	}
+
+	f.contentMutex.Lock()
+	defer f.contentMutex.Unlock()
+
+	if err := f.loadContentLocked(); err != nil {
+		logger.Warn("加载内容寻址表失败", "error", err)
+		return ContentHash{}, false
+	}
+	hash, ok := f.content.byBlock[blockID]
+	return hash, ok
+}
+
+// verifyContentBlock 校验单块对象的数据与内容哈希是否一致，块链对象由ReadToWriter校验
+func (f *FragmentaImpl) verifyContentBlock(blockID uint32, data []byte) error {
+	expected, ok := f.contentHash(blockID)
+	if !ok {
+		return nil
+	}
+	if header, err := f.blockManager.GetBlockInfo(blockID); err != nil || header.NextBlock != 0 {
+		return nil
+	}
+
+	if sha256.Sum256(data) != expected {
+		logger.Error("块数据与内容哈希不符", "blockID", blockID, "hash", expected)
+		return fmt.Errorf("%w: block %d", ErrContentMismatch, blockID)
+	}
+	return nil
+}
+
+// checkContentMutable 按内容寻址的对象不能再链接
+func (f *FragmentaImpl) checkContentMutable(blockID uint32) error {
+	if _, ok := f.contentHash(blockID); ok {
+		return fmt.Errorf("%w: 块%d按内容寻址，不能修改链接", ErrInvalidOperation, blockID)
+	}
+	return nil
+}
+
+// removeContent 块删除后从内容寻址表中移除
+func (f *FragmentaImpl) removeContent(blockID uint32) {
+	if !f.contentAddressed {
+		return
+	}
+
+	f.contentMutex.Lock()
+	defer f.contentMutex.Unlock()
+
+	if err := f.loadContentLocked(); err != nil {
+		logger.Warn("加载内容寻址表失败", "error", err)
+		return
+	}
+	hash, ok := f.content.byBlock[blockID]
+	if !ok {
+		return
+	}
+	delete(f.content.byBlock, blockID)
+	if f.content.byHash[hash] == blockID {
+		delete(f.content.byHash, hash)
+	}
+	f.content.dirty = true
+	f.isDirty.Store(true)
+}
+
+// lookupContentLocked 查找内容对应的可用对象，对象已删除或在回收站中时视为不存在。
+// 调用方需持有contentMutex
+func (f *FragmentaImpl) lookupContentLocked(hash ContentHash) (uint32, bool) {
+	blockID, ok := f.content.byHash[hash]
+	if !ok {
+		return 0, false
+	}
+	if _, err := f.blockManager.GetBlockInfo(blockID); err != nil || f.isTrashed(blockID) {
+		return 0, false
+	}
+	return blockID, true
+}
+
+// addContentLocked 登记内容对应的对象，替换回收站中的旧对象。调用方需持有contentMutex
+func (f *FragmentaImpl) addContentLocked(hash ContentHash, blockID uint32) {
+	if old, ok := f.content.byHash[hash]; ok {
+		delete(f.content.byBlock, old)
+	}
+	f.content.byHash[hash] = blockID
+	f.content.byBlock[blockID] = hash
+	f.content.dirty = true
+	f.isDirty.Store(true)
+}
+
+// loadContentLocked 首次使用时从TagContentTable加载内容寻址表，调用方需持有contentMutex
+func (f *FragmentaImpl) loadContentLocked() error {
+	if f.content != nil {
+		return nil
+	}
+
+	value, err := f.metadataManager.GetMetadata(TagContentTable)
+	if err == ErrMetadataNotFound {
+		f.content = &contentTable{
+			byHash:  make(map[ContentHash]uint32),
+			byBlock: make(map[uint32]ContentHash),
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// 直接读取表所在的块，ReadBlock需要校验内容
+	blockID := uint32(DecodeInt64(value))
+	table, err := f.readBlock(blockID)
+	if err != nil {
+		logger.Error("读取内容寻址表失败", "blockID", blockID, "error", err)
+		return err
+	}
+	content, err := decodeContentTable(table)
+	if err != nil {
+		logger.Error("解析内容寻址表失败", "blockID", blockID, "error", err)
+		return err
+	}
+
+	f.content = content
+	f.contentBlock = blockID
+	return nil
+}
+
+// syncContentTable 将有修改的内容寻址表写入新的系统块并更新TagContentTable，在提交时调用
+func (f *FragmentaImpl) syncContentTable() error {
+	f.contentMutex.Lock()
+	defer f.contentMutex.Unlock()
+
+	if f.content == nil || !f.content.dirty {
+		return nil
+	}
+
+	blockID, err := f.writeBlock(encodeContentTable(f.content), &BlockOptions{BlockType: SystemBlockType, Checksum: true})
+	if err != nil {
+		logger.Error("写入内容寻址表失败", "error", err)
+		return err
+	}
+	if err := f.setMetadata(TagContentTable, EncodeInt64(int64(blockID))); err != nil {
+		logger.Error("更新内容寻址表位置失败", "error", err)
+		return err
+	}
+
+	// 旧表直接由块管理器释放，与回收站表相同
+	if f.contentBlock != 0 {
+		if err := f.blockManager.DeleteBlock(f.contentBlock); err != nil {
+			logger.Warn("释放旧内容寻址表失败", "blockID", f.contentBlock, "error", err)
+		} else {
+			if err := f.unstoreBlock(f.contentBlock); err != nil {
+				logger.Warn("从块存储删除旧内容寻址表失败", "blockID", f.contentBlock, "error", err)
+			}
+			if err := f.queryRemoveBlock(f.contentBlock); err != nil {
+				logger.Warn("移除旧内容寻址表的查询索引失败", "blockID", f.contentBlock, "error", err)
+			}
+		}
+	}
+	f.contentBlock = blockID
+	f.content.dirty = false
+	return nil
+}
+
+// encodeContentTable 编码内容寻址表
+// 格式: 魔数 | 版本 | 记录数量 | 记录(块ID | 内容哈希)...
+func encodeContentTable(content *contentTable) []byte {
+	blocks := make([]uint32, 0, len(content.byBlock))
+	for blockID := range content.byBlock {
+		blocks = append(blocks, blockID)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+
+	buf := make([]byte, 10, 10+len(blocks)*(4+sha256.Size))
+	binary.BigEndian.PutUint32(buf, ContentTableMagic)
+	binary.BigEndian.PutUint16(buf[4:], ContentTableVersion)
+	binary.BigEndian.PutUint32(buf[6:], uint32(len(blocks)))
+	for _, blockID := range blocks {
+		hash := content.byBlock[blockID]
+		buf = binary.BigEndian.AppendUint32(buf, blockID)
+		buf = append(buf, hash[:]...)
+	}
+	return buf
+}
+
+// decodeContentTable 解析内容寻址表
+func decodeContentTable(table []byte) (*contentTable, error) {
+	r := bytes.NewReader(table)
+
+	var magic, count uint32
+	var version uint16
+	for _, field := range []interface{}{&magic, &version, &count} {
+		if err := binary.Read(r, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("%w: 内容寻址表头不完整", ErrInvalidFragmenta)
+		}
+	}
+	if magic != ContentTableMagic {
+		return nil, fmt.Errorf("%w: 内容寻址表魔数错误", ErrInvalidFragmenta)
+	}
+	if version > ContentTableVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	if int64(count)*(4+sha256.Size) != int64(r.Len()) {
+		return nil, fmt.Errorf("%w: 内容寻址表记录不完整", ErrInvalidFragmenta)
+	}
+
+	content := &contentTable{
+		byHash:  make(map[ContentHash]uint32, count),
+		byBlock: make(map[uint32]ContentHash, count),
+	}
+	for i := uint32(0); i < count; i++ {
+		var blockID uint32
+		var hash ContentHash
+		if err := binary.Read(r, binary.BigEndian, &blockID); err != nil {
+			return nil, fmt.Errorf("%w: 内容寻址表记录不完整", ErrInvalidFragmenta)
+		}
+		if _, err := r.Read(hash[:]); err != nil {
+			return nil, fmt.Errorf("%w: 内容寻址表记录不完整", ErrInvalidFragmenta)
+		}
+		content.byHash[hash] = blockID
+		content.byBlock[blockID] = hash
+	}
+	return content, nil
+}
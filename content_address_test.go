@@ -0,0 +1,119 @@
+package fragmenta
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestContentAddressed 测试内容寻址模式的去重、幂等写入、内容校验和重新打开
+func TestContentAddressed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cas.frag")
+	f, err := CreateFragmenta(path, &FragmentaOptions{StorageMode: ContainerMode, BlockSize: DefaultBlockSize, ContentAddressed: true})
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	if !f.IsContentAddressed() {
+		t.Fatal("应启用内容寻址模式")
+	}
+
+	// 相同内容的块只保存一份
+	first, err := f.WriteBlock([]byte("same"), &BlockOptions{Checksum: true, Attributes: map[string]string{"origin": "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := f.WriteBlock([]byte("same"), &BlockOptions{Checksum: true, Attributes: map[string]string{"origin": "b"}})
+	if err != nil || second != first {
+		t.Fatalf("重复写入应返回已有的块: %d != %d, %v", second, first, err)
+	}
+	other, _ := f.WriteBlock([]byte("other"), nil)
+	if other == first {
+		t.Fatal("不同内容应写入新块")
+	}
+	if attrs, _ := f.GetBlockAttributes(first); attrs["origin"] != "a" {
+		t.Errorf("重复写入不应修改已有块的属性: %v", attrs)
+	}
+
+	hash := ContentHash(sha256.Sum256([]byte("same")))
+	if id, err := f.LookupContent(hash); err != nil || id != first {
+		t.Errorf("按内容查找块失败: %d, %v", id, err)
+	}
+	if got, err := f.GetContentHash(first); err != nil || got != hash {
+		t.Errorf("获取内容哈希失败: %s, %v", got, err)
+	}
+	if parsed, err := ParseContentHash(hash.String()); err != nil || parsed != hash {
+		t.Errorf("解析内容哈希失败: %v", err)
+	}
+
+	// 块链对象整体按内容寻址
+	data := bytes.Repeat([]byte("0123456789"), int(DefaultBlockSize)/4)
+	handle, err := f.WriteFromReader(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	before, _ := f.ListBlocks()
+	again, err := f.WriteFromReader(bytes.NewReader(data), nil)
+	if err != nil || *again != *handle {
+		t.Fatalf("重复写入对象应返回已有对象: %+v != %+v, %v", again, handle, err)
+	}
+	if after, _ := f.ListBlocks(); len(after) != len(before) {
+		t.Errorf("重复写入对象后块数不应变化: %d -> %d", len(before), len(after))
+	}
+	var out bytes.Buffer
+	if _, err := f.ReadToWriter(context.Background(), handle.FirstBlockID, &out); err != nil || !bytes.Equal(out.Bytes(), data) {
+		t.Fatalf("读取对象失败: %v", err)
+	}
+
+	// 按内容寻址的对象不可链接
+	if err := f.LinkBlocks(first, other); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("链接按内容寻址的块应失败: %v", err)
+	}
+
+	// 事务撤销不删除已有的块
+	tx, _ := f.BeginTx()
+	tx.WriteBlock([]byte("same"), nil)
+	tx.DeleteBlock(9999)
+	if err := tx.Commit(); !errors.Is(err, ErrBlockNotFound) {
+		t.Fatalf("事务应失败: %v", err)
+	}
+	if _, err := f.ReadBlock(first); err != nil {
+		t.Errorf("事务撤销后已有的块应保留: %v", err)
+	}
+
+	// 数据与内容哈希不符时读取失败
+	impl := f.(*FragmentaImpl)
+	impl.content.byBlock[other] = hash
+	if _, err := f.ReadBlock(other); !errors.Is(err, ErrContentMismatch) {
+		t.Errorf("内容不符时应返回ErrContentMismatch: %v", err)
+	}
+	impl.content.byBlock[other] = ContentHash(sha256.Sum256([]byte("other")))
+
+	// 删除后再写入得到新块
+	if err := f.DeleteBlock(other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.LookupContent(ContentHash(sha256.Sum256([]byte("other")))); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("删除后不应再找到内容: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	f, err = OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer f.Close()
+	if !f.IsContentAddressed() {
+		t.Fatal("重新打开后应保持内容寻址模式")
+	}
+	if id, err := f.WriteBlock([]byte("same"), nil); err != nil || id != first {
+		t.Errorf("重新打开后重复写入应返回已有的块: %d, %v", id, err)
+	}
+	if again, err := f.WriteFromReader(bytes.NewReader(data), nil); err != nil || again.FirstBlockID != handle.FirstBlockID {
+		t.Errorf("重新打开后重复写入对象应返回已有对象: %+v, %v", again, err)
+	}
+}
@@ -0,0 +1,25 @@
+package fragmenta
+
+import (
+	"context"
+	"fmt"
+)
+
+// cryptoEraseStore 支持按对象销毁数据密钥的块数据存储（storage.StorageManagerImpl）
+type cryptoEraseStore interface {
+	CryptoErase(ctx context.Context, objectID string) error
+}
+
+// CryptoErase 销毁对象（或租户）的数据密钥，用该密钥加密的块不需要重写即无法恢复。
+// 块所属的对象由存储管理器的分类策略（storage.BlockPolicy.Object）指定，销毁由安全管理器记入审计日志。
+// 需要通过 SetBlockStore 挂接支持对象数据密钥的存储管理器，否则返回ErrInvalidOperation
+func (f *FragmentaImpl) CryptoErase(ctx context.Context, objectID string) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	store, ok := f.getBlockStore().(cryptoEraseStore)
+	if !ok {
+		return fmt.Errorf("%w: 块数据存储不支持对象数据密钥", ErrInvalidOperation)
+	}
+	return store.CryptoErase(ctx, objectID)
+}
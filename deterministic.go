@@ -0,0 +1,25 @@
+package fragmenta
+
+import "time"
+
+// IsDeterministic 文件是否以确定性模式创建（见 DeterministicOptions）
+func (f *FragmentaImpl) IsDeterministic() bool {
+	return f.fixedTime != nil
+}
+
+// now 返回写入文件的时间戳：确定性模式下为固定时间，否则为当前时间
+func (f *FragmentaImpl) now() time.Time {
+	if f.fixedTime != nil {
+		return *f.fixedTime
+	}
+	return time.Now()
+}
+
+// checkNondeterministic 确定性模式下拒绝依赖当前时间的操作
+func (f *FragmentaImpl) checkNondeterministic(operation string) error {
+	if f.fixedTime != nil {
+		logger.Warn("确定性模式下不能使用该操作", "operation", operation)
+		return ErrNondeterministic
+	}
+	return nil
+}
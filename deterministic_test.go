@@ -0,0 +1,102 @@
+package fragmenta
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// buildDeterministic 以确定性模式创建文件并执行一组固定的写入操作，返回文件内容
+func buildDeterministic(t *testing.T, path string) []byte {
+	t.Helper()
+
+	fixed := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	f, err := CreateFragmenta(path, &FragmentaOptions{
+		StorageMode:   ContainerMode,
+		BlockSize:     DefaultBlockSize,
+		Deterministic: &DeterministicOptions{Timestamp: fixed},
+	})
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+
+	if err := f.EnableMetadataHistory(MetadataHistoryOptions{MaxVersions: 4}); err != nil {
+		t.Fatal(err)
+	}
+	for i := uint16(0); i < 32; i++ {
+		if err := f.SetMetadata(0x1000+i, []byte{byte(i), 'v'}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.SetMetadataExpiration(0x1001, fixed.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := f.WriteBlock(bytes.Repeat([]byte{byte(i)}, 100+i), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ns, err := f.(*FragmentaImpl).Namespace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ns.Mkdir("/docs", 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.WriteFile("/docs/readme.txt", []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// TestDeterministicMode 测试确定性模式生成逐字节相同的文件
+func TestDeterministicMode(t *testing.T) {
+	first := buildDeterministic(t, filepath.Join(t.TempDir(), "a.frag"))
+	time.Sleep(2 * time.Millisecond)
+	path := filepath.Join(t.TempDir(), "b.frag")
+	second := buildDeterministic(t, path)
+	if !bytes.Equal(first, second) {
+		t.Fatal("相同的输入生成了不同的文件")
+	}
+
+	f, err := OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	defer f.Close()
+
+	if !f.IsDeterministic() || f.GetHeader().Flags&FlagDeterministic == 0 {
+		t.Error("重新打开后应保持确定性模式")
+	}
+	if created, err := f.GetMetadataTime(TagCreateTime); err != nil || !created.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("创建时间应为固定时间: %v, %v", created, err)
+	}
+	if err := f.SetMetadataWithTTL(0x2000, []byte("x"), time.Minute); !errors.Is(err, ErrNondeterministic) {
+		t.Errorf("确定性模式下SetMetadataWithTTL应返回ErrNondeterministic: %v", err)
+	}
+	if err := f.StartMetadataSweeper(time.Minute); !errors.Is(err, ErrNondeterministic) {
+		t.Errorf("确定性模式下StartMetadataSweeper应返回ErrNondeterministic: %v", err)
+	}
+
+	// 只支持容器模式
+	_, err = CreateFragmenta(filepath.Join(t.TempDir(), "c.frag"), &FragmentaOptions{
+		StorageMode:   DirectoryMode,
+		Deterministic: &DeterministicOptions{},
+	})
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("目录模式应返回ErrInvalidArgument: %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+// Package errcode 为哨兵错误提供稳定的错误码和多语言消息
+//
+// 各包在init中用Register登记自己导出的哨兵错误。Of沿错误链查找第一个登记过的哨兵，
+// 返回形如 storage.corrupted 的错误码，日志和工具输出中的错误码不随语言或消息措辞变化，便于检索。
+// Localize按运维人员的语言渲染消息，内置中文和英文，其他语言可以用AddMessages补充。
+package errcode
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Code 错误码，格式为 包名.错误名
+type Code string
+
+// Lang 消息语言
+type Lang string
+
+const (
+	// Chinese 中文
+	Chinese Lang = "zh"
+	// English 英文
+	English Lang = "en"
+)
+
+var (
+	mu       sync.RWMutex
+	codes    = make(map[error]Code)
+	catalogs = map[Lang]map[Code]string{Chinese: {}, English: {}}
+)
+
+// Register 登记哨兵错误的错误码及中英文消息，重复登记时覆盖之前的内容
+func Register(sentinel error, code Code, zh, en string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	codes[sentinel] = code
+	catalogs[Chinese][code] = zh
+	catalogs[English][code] = en
+}
+
+// AddMessages 添加或覆盖某种语言的消息
+func AddMessages(lang Lang, messages map[Code]string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	catalog, ok := catalogs[lang]
+	if !ok {
+		catalog = make(map[Code]string, len(messages))
+		catalogs[lang] = catalog
+	}
+	for code, message := range messages {
+		catalog[code] = message
+	}
+}
+
+// Of 返回错误链上第一个登记过的哨兵错误的错误码，外层优先，没有时返回空字符串
+func Of(err error) Code {
+	mu.RLock()
+	defer mu.RUnlock()
+	return lookup(err)
+}
+
+// lookup 按errors.Is的顺序深度优先遍历错误链（调用方需持有读锁）
+func lookup(err error) Code {
+	for err != nil {
+		if reflect.TypeOf(err).Comparable() {
+			if code, ok := codes[err]; ok {
+				return code
+			}
+		}
+		switch x := err.(type) {
+		case interface{ Unwrap() error }:
+			err = x.Unwrap()
+		case interface{ Unwrap() []error }:
+			for _, e := range x.Unwrap() {
+				if code := lookup(e); code != "" {
+					return code
+				}
+			}
+			return ""
+		default:
+			return ""
+		}
+	}
+	return ""
+}
+
+// Message 返回错误码在指定语言下的消息，缺少该语言时依次使用英文、中文，都没有时返回错误码本身
+func Message(code Code, lang Lang) string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for _, l := range []Lang{lang, English, Chinese} {
+		if message, ok := catalogs[l][code]; ok {
+			return message
+		}
+	}
+	return string(code)
+}
+
+// Localize 把错误渲染为 "[错误码] 消息"，没有登记的错误返回err.Error()
+func Localize(err error, lang Lang) string {
+	if err == nil {
+		return ""
+	}
+	code := Of(err)
+	if code == "" {
+		return err.Error()
+	}
+	return "[" + string(code) + "] " + Message(code, lang)
+}
+
+// Is 判断err的错误链上是否有错误码为code的哨兵错误
+func Is(err error, code Code) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	for sentinel, c := range codes {
+		if c == code && errors.Is(err, sentinel) {
+			return true
+		}
+	}
+	return false
+}
+
+// LangFromEnv 按 FRAGMENTA_LANG、LC_ALL、LC_MESSAGES、LANG 的顺序取第一个非空的设置，
+// 以zh开头时为中文，其他为英文；都未设置时返回中文，与未本地化的消息一致
+func LangFromEnv() Lang {
+	for _, name := range []string{"FRAGMENTA_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			if strings.HasPrefix(strings.ToLower(value), "zh") {
+				return Chinese
+			}
+			return English
+		}
+	}
+	return Chinese
+}
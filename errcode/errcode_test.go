@@ -0,0 +1,68 @@
+package errcode
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// TestErrcode 测试沿错误链查找错误码以及按语言渲染消息
+func TestErrcode(t *testing.T) {
+	errOuter := errors.New("outer")
+	errInner := errors.New("inner")
+	Register(errOuter, "test.outer", "外层错误", "outer error")
+	Register(errInner, "test.inner", "内层错误", "inner error")
+
+	// 外层哨兵优先，多重包装按顺序查找
+	wrapped := fmt.Errorf("%w: %w", errOuter, errInner)
+	if code := Of(fmt.Errorf("读取失败: %w", wrapped)); code != "test.outer" {
+		t.Errorf("错误码不正确: %s", code)
+	}
+	if code := Of(errors.Join(errors.New("other"), fmt.Errorf("x: %w", errInner))); code != "test.inner" {
+		t.Errorf("错误码不正确: %s", code)
+	}
+	if code := Of(errors.New("unknown")); code != "" {
+		t.Errorf("未登记的错误不应有错误码: %s", code)
+	}
+	if !Is(wrapped, "test.inner") || Is(errInner, "test.outer") {
+		t.Error("Is结果不正确")
+	}
+
+	err := fmt.Errorf("块1: %w", errInner)
+	if got := Localize(err, English); got != "[test.inner] inner error" {
+		t.Errorf("英文消息不正确: %s", got)
+	}
+	if got := Localize(err, Chinese); got != "[test.inner] 内层错误" {
+		t.Errorf("中文消息不正确: %s", got)
+	}
+
+	// 缺少的语言回退到英文，补充后使用新语言
+	if got := Message("test.inner", "fr"); got != "inner error" {
+		t.Errorf("应回退到英文: %s", got)
+	}
+	AddMessages("fr", map[Code]string{"test.inner": "erreur interne"})
+	if got := Message("test.inner", "fr"); got != "erreur interne" {
+		t.Errorf("法文消息不正确: %s", got)
+	}
+	if got := Message("test.missing", English); got != "test.missing" {
+		t.Errorf("未知错误码应返回错误码本身: %s", got)
+	}
+}
+
+// TestLangFromEnv 测试从环境变量确定语言
+func TestLangFromEnv(t *testing.T) {
+	for _, name := range []string{"FRAGMENTA_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		t.Setenv(name, "")
+	}
+	if lang := LangFromEnv(); lang != Chinese {
+		t.Errorf("未设置时应为中文: %s", lang)
+	}
+	t.Setenv("LANG", "en_US.UTF-8")
+	if lang := LangFromEnv(); lang != English {
+		t.Errorf("LANG=en_US时应为英文: %s", lang)
+	}
+	t.Setenv("FRAGMENTA_LANG", "zh_CN")
+	if lang := LangFromEnv(); lang != Chinese {
+		t.Errorf("FRAGMENTA_LANG优先: %s", lang)
+	}
+}
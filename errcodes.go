@@ -0,0 +1,44 @@
+package fragmenta
+
+import "github.com/bpfs/fragmenta/errcode"
+
+// init 登记存储格式和操作错误的错误码，存储层、安全模块和索引的错误由各自的包登记
+func init() {
+	errcode.Register(ErrInvalidFragmenta, "fragmenta.invalid_format", "无效的FragDB文件格式", "invalid FragDB fragmenta")
+	errcode.Register(ErrUnsupportedVersion, "fragmenta.unsupported_version", "不支持的FragDB版本", "unsupported FragDB version")
+	errcode.Register(ErrInvalidOperation, "fragmenta.invalid_operation", "无效的操作", "invalid operation")
+	errcode.Register(ErrMetadataNotFound, "fragmenta.metadata_not_found", "元数据不存在", "metadata not found")
+	errcode.Register(ErrBlockNotFound, "fragmenta.block_not_found", "数据块不存在", "block not found")
+	errcode.Register(ErrProtectedMetadata, "fragmenta.protected_metadata", "受保护的元数据不可修改", "protected metadata cannot be modified")
+	errcode.Register(ErrInvalidQuery, "fragmenta.invalid_query", "无效的查询", "invalid query")
+	errcode.Register(ErrInvalidArgument, "fragmenta.invalid_argument", "无效的参数", "invalid argument")
+	errcode.Register(ErrStorageLimitExceeded, "fragmenta.storage_limit_exceeded", "超出存储限制", "storage limit exceeded")
+	errcode.Register(ErrReadOnly, "fragmenta.read_only", "只读模式下不允许该操作", "operation not allowed in read-only mode")
+	errcode.Register(ErrIndexCorruption, "fragmenta.index_corruption", "索引已损坏", "index corruption detected")
+	errcode.Register(ErrPathNotFound, "fragmenta.path_not_found", "路径不存在", "path not found")
+	errcode.Register(ErrPathExists, "fragmenta.path_exists", "路径已存在", "path already exists")
+	errcode.Register(ErrNotDirectory, "fragmenta.not_directory", "不是目录", "not a directory")
+	errcode.Register(ErrIsDirectory, "fragmenta.is_directory", "是目录", "is a directory")
+	errcode.Register(ErrDirectoryNotEmpty, "fragmenta.directory_not_empty", "目录非空", "directory not empty")
+	errcode.Register(ErrInvalidPath, "fragmenta.invalid_path", "无效的路径", "invalid path")
+	errcode.Register(ErrHeaderChecksum, "fragmenta.header_checksum", "文件头校验和不匹配", "header checksum mismatch")
+	errcode.Register(ErrInvalidMigration, "fragmenta.invalid_migration", "无效的迁移步骤", "invalid migration")
+	errcode.Register(ErrSignatureNotFound, "fragmenta.signature_not_found", "块没有签名", "block signature not found")
+	errcode.Register(ErrSignatureInvalid, "fragmenta.signature_invalid", "块签名验证失败", "block signature invalid")
+	errcode.Register(ErrQueryServiceNotStarted, "fragmenta.query_service_not_started", "查询服务未启动", "query service not started")
+	errcode.Register(ErrViewNotFound, "fragmenta.view_not_found", "命名查询不存在", "view not found")
+	errcode.Register(ErrJobNotFound, "fragmenta.job_not_found", "后台作业不存在", "job not found")
+	errcode.Register(ErrJobRunning, "fragmenta.job_running", "后台作业正在运行", "job is running")
+	errcode.Register(ErrBrokenBlockChain, "fragmenta.broken_block_chain", "块链的链接不一致", "broken block chain")
+	errcode.Register(ErrTxDone, "fragmenta.tx_done", "事务已提交或已回滚", "transaction already committed or rolled back")
+	errcode.Register(ErrMetadataType, "fragmenta.metadata_type", "元数据值与模式中的类型不符", "metadata type mismatch")
+	errcode.Register(ErrMetadataHistoryDisabled, "fragmenta.metadata_history_disabled", "未启用元数据历史", "metadata history not enabled")
+	errcode.Register(ErrNotInTrash, "fragmenta.not_in_trash", "不在回收站中", "not in trash")
+	errcode.Register(ErrNondeterministic, "fragmenta.nondeterministic", "操作依赖当前时间，不能在确定性模式下使用", "operation is not allowed in deterministic mode")
+	errcode.Register(ErrContentMismatch, "fragmenta.content_mismatch", "内容与其哈希不符", "content does not match its hash")
+	errcode.Register(ErrInvalidTLVType, "fragmenta.invalid_tlv_type", "无效的TLV类型", "invalid TLV type")
+	errcode.Register(ErrInvalidTLVLength, "fragmenta.invalid_tlv_length", "无效的TLV长度", "invalid TLV length")
+	errcode.Register(ErrTLVDataTooLarge, "fragmenta.tlv_too_large", "TLV数据太大", "TLV data too large")
+	errcode.Register(ErrTLVReadFailed, "fragmenta.tlv_read_failed", "TLV读取失败", "TLV read failed")
+	errcode.Register(ErrTLVWriteFailed, "fragmenta.tlv_write_failed", "TLV写入失败", "TLV write failed")
+}
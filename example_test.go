@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/bpfs/fragmenta"
@@ -208,9 +209,14 @@ func TestBatchMetadataOperation(t *testing.T) {
 
 // Example_createFragmenta 展示如何创建和使用Fragmenta格式文件
 func Example_createFragmenta() {
-	// 创建临时文件路径
-	tempPath := "example.dat"
-	defer os.Remove(tempPath)
+	// 在临时目录中创建文件
+	dir, err := os.MkdirTemp("", "fragmenta-example")
+	if err != nil {
+		fmt.Printf("创建临时目录失败: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	tempPath := filepath.Join(dir, "example.dat")
 
 	// 创建Fragmenta格式文件
 	f, err := fragmenta.CreateFragmenta(tempPath, &fragmenta.FragmentaOptions{
@@ -308,10 +314,14 @@ func Example_createFragmenta() {
 
 // Example_storageConversion 展示如何进行存储模式转换
 func Example_storageConversion() {
-	// 创建测试文件
-	tempPath := "storage_example.dat"
-	defer os.Remove(tempPath)
-	defer os.RemoveAll(tempPath + ".dir") // 确保删除目录模式创建的目录
+	// 在临时目录中创建测试文件，目录模式的块数据目录（BlockDirectorySuffix）随临时目录一起删除
+	dir, err := os.MkdirTemp("", "fragmenta-example")
+	if err != nil {
+		fmt.Printf("创建临时目录失败: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	tempPath := filepath.Join(dir, "storage_example.dat")
 
 	// 创建容器模式文件
 	f, err := fragmenta.CreateFragmenta(tempPath, &fragmenta.FragmentaOptions{
@@ -66,7 +66,7 @@ func main() {
 		log.Fatalf("启用变更日志记录失败: %v", err)
 	}
 
-	// 配置是否记录完整配置
+	// 同时记录变更前的完整配置
 	dynamicManager.SetLogFullConfig(true)
 
 	// 获取默认配置
@@ -160,6 +160,22 @@ func main() {
 		log.Fatalf("手动应用配置失败: %v", err)
 	}
 
+	// 查看配置历史并回滚到上一个版本
+	fmt.Println("\n配置变更历史:")
+	history, err := dynamicManager.GetConfigHistory(5)
+	if err != nil {
+		log.Fatalf("获取配置历史失败: %v", err)
+	}
+	for _, entry := range history {
+		fmt.Printf(" - 版本%d %s %s: %s\n", entry.Version, entry.Timestamp.Format(time.RFC3339), entry.Source, entry.Description)
+	}
+	if len(history) > 1 {
+		fmt.Printf("回滚到版本%d...\n", history[1].Version)
+		if err := dynamicManager.RollbackConfig(ctx, history[1].Version); err != nil {
+			log.Fatalf("回滚配置失败: %v", err)
+		}
+	}
+
 	// 禁用监听器组
 	fmt.Println("\n禁用性能监听器组...")
 	dynamicManager.UnregisterGroup("performance")
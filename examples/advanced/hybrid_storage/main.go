@@ -7,6 +7,7 @@ import (
 	"os"
 	"time"
 
+	"github.com/bpfs/fragmenta/clock"
 	"github.com/bpfs/fragmenta/storage"
 )
 
@@ -55,8 +56,6 @@ func printPerformanceMetrics(metrics *storage.HybridStoragePerformanceMetrics) {
 	fmt.Println("=====================")
 }
 
-/*
-// 当前HybridStorage未实现该功能，临时注释
 // 打印存储分布分析
 func printDistributionAnalysis(analysis *storage.DistributionAnalysis) {
 	fmt.Println("===== 存储分布分析 =====")
@@ -72,7 +71,6 @@ func printDistributionAnalysis(analysis *storage.DistributionAnalysis) {
 	}
 	fmt.Println("=========================")
 }
-*/
 
 func main() {
 	// 创建临时目录
@@ -84,6 +82,9 @@ func main() {
 
 	fmt.Printf("使用临时目录: %s\n", tempDir)
 
+	// 使用可手动推进的时钟，演示冷块时无需真实等待
+	fakeClock := clock.NewFake(time.Now())
+
 	// 配置混合存储
 	config := &storage.StorageConfig{
 		Type:            storage.StorageTypeHybrid,
@@ -100,6 +101,7 @@ func main() {
 		ColdBlockTimeMinutes:       1, // 1分钟，仅为了演示
 		PerformanceTarget:          "balanced",
 		AutoBalanceEnabled:         true,
+		Clock:                      fakeClock,
 	}
 
 	// 创建混合存储
@@ -188,11 +190,9 @@ func main() {
 		log.Fatalf("存储优化失败: %v", err)
 	}
 
-	/* 当前版本不支持存储分布分析，临时注释
 	// 打印优化后的存储分布分析
 	fmt.Println("\n优化后的存储分布分析:")
 	printDistributionAnalysis(hybridStorage.GetStorageDistributionAnalysis())
-	*/
 
 	// 打印优化后的统计信息
 	fmt.Println("\n优化后统计信息:")
@@ -213,9 +213,9 @@ func main() {
 		}
 	}
 
-	// 等待一段时间，让一些块变成冷块
-	fmt.Println("\n等待使部分块变成冷块...")
-	time.Sleep(2 * time.Minute)
+	// 推进时钟，让一些块变成冷块
+	fmt.Println("\n推进时钟使部分块变成冷块...")
+	fakeClock.Advance(2 * time.Minute)
 
 	// 再次触发优化
 	fmt.Println("\n再次触发存储优化...")
@@ -229,9 +229,7 @@ func main() {
 	printHybridStats(hybridStorage.GetHybridStats())
 	printPerformanceMetrics(hybridStorage.GetPerformanceMetrics())
 
-	/* 当前版本不支持存储分布分析，临时注释
 	printDistributionAnalysis(hybridStorage.GetStorageDistributionAnalysis())
-	*/
 
 	fmt.Println("\n混合存储测试完成!")
 }
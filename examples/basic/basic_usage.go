@@ -9,11 +9,12 @@ import (
 	"github.com/bpfs/fragmenta"
 )
 
-// 临时定义一些标签常量，实际应由fragmenta包提供
+// 示例使用的标签：文件名和文件类型使用应用可写的系统标签，创建时间使用用户标签
+// （系统标签中的版本、创建时间等由格式自身维护，不能写入）
 const (
-	TagFileName     uint16 = 0x0001
-	TagCreationTime uint16 = 0x0002
-	TagFileType     uint16 = 0x0003
+	TagFileName     = fragmenta.TagTitle
+	TagCreationTime = uint16(0x1002)
+	TagFileType     = fragmenta.TagContentType
 )
 
 // BasicUsage 演示FragDB的基本使用方法
@@ -11,7 +11,7 @@ import (
 	"syscall"
 
 	"github.com/bpfs/fragmenta"
-	"github.com/bpfs/fragmenta/examples/experimental/fuse/common"
+	fragfs "github.com/bpfs/fragmenta/fs"
 )
 
 var (
@@ -86,22 +86,23 @@ func main() {
 	// 确保关闭存储
 	defer storage.Close()
 
-	// 配置macOS FUSE选项
-	macFuseOptions := &common.MacFuseOptions{
-		AllowRoot:       false,      // 是否允许root访问
-		AllowOther:      false,      // 是否允许其他用户访问
-		VolumeName:      *volName,   // 卷名称
-		NoAppleDouble:   true,       // 禁止创建.AppleDouble文件
-		NoBrowse:        false,      // 是否允许在Finder中浏览
-		FilePermissions: 0644,       // 文件默认权限
-		DirPermissions:  0755,       // 目录默认权限
-		Debug:           *debugMode, // 调试模式
+	// 获取文件/目录命名空间
+	ns, err := storage.Namespace()
+	if err != nil {
+		fmt.Printf("加载命名空间失败: %v\n", err)
+		os.Exit(1)
 	}
 
+	// 配置挂载选项
+	mountOptions := fragfs.DefaultMountOptions()
+	mountOptions.FSName = "FragDB"
+	mountOptions.VolumeName = *volName
+	mountOptions.Debug = *debugMode
+
 	fmt.Println("正在将FragDB挂载为macOS FUSE文件系统...")
 
-	// 创建macOS特定的挂载处理器
-	mounter, err := common.NewMacFuseMounter(storage, macFuseOptions)
+	// 创建挂载器
+	mounter, err := fragfs.NewMounter(ns, mountOptions)
 	if err != nil {
 		fmt.Printf("创建macOS FUSE挂载器失败: %v\n", err)
 		os.Exit(1)
@@ -111,10 +112,17 @@ func main() {
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
 
-	// 后台执行挂载
-	errCh := make(chan error, 1)
+	// 挂载，返回时文件系统已可访问
+	if err := mounter.Mount(*mountPoint); err != nil {
+		fmt.Printf("挂载失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	// 文件系统被外部卸载时结束等待
+	doneCh := make(chan struct{})
 	go func() {
-		errCh <- mounter.Mount(*mountPoint)
+		mounter.Wait()
+		close(doneCh)
 	}()
 
 	fmt.Printf("FUSE文件系统已挂载到 %s\n", *mountPoint)
@@ -127,10 +135,8 @@ func main() {
 	select {
 	case sig := <-sigCh:
 		fmt.Printf("收到信号 %s，准备卸载...\n", sig)
-	case err := <-errCh:
-		if err != nil {
-			fmt.Printf("挂载过程中出错: %v\n", err)
-		}
+	case <-doneCh:
+		fmt.Println("文件系统已被外部卸载")
 	}
 
 	// 卸载
@@ -172,6 +178,12 @@ func checkMacFUSE() bool {
 func createExampleFiles(storage fragmenta.Fragmenta) {
 	fmt.Println("正在创建示例文件...")
 
+	ns, err := storage.Namespace()
+	if err != nil {
+		fmt.Printf("加载命名空间失败: %v\n", err)
+		return
+	}
+
 	// 创建目录结构
 	dirs := []string{
 		"/文档",
@@ -179,41 +191,23 @@ func createExampleFiles(storage fragmenta.Fragmenta) {
 		"/视频",
 	}
 
-	for i, dir := range dirs {
-		// 使用元数据标记目录
-		err := storage.SetMetadata(fragmenta.UserTag(0x1000+uint16(i)), []byte(dir))
-		if err != nil {
+	for _, dir := range dirs {
+		if _, err := ns.Mkdir(dir, 0755); err != nil {
 			fmt.Printf("创建目录 %s 时出错: %v\n", dir, err)
 			continue
 		}
 
-		// 为每个目录创建README文件
+		// 为每个目录创建说明文件
 		content := []byte(fmt.Sprintf("这是 %s 目录的说明文件\n\n此目录用于存储%s。",
 			dir, getDirDescription(dir)))
 
-		// 写入文件内容
-		blockID, err := storage.WriteBlock(content, nil)
-		if err != nil {
-			fmt.Printf("写入README内容失败: %v\n", err)
-			continue
-		}
-
-		// 设置文件元数据
-		filePath := fmt.Sprintf("%s/说明.txt", dir)
-		err = storage.SetMetadata(fragmenta.UserTag(0x2000+uint16(i)), []byte(filePath))
-		if err != nil {
-			fmt.Printf("设置文件路径失败: %v\n", err)
+		filePath := dir + "/说明.txt"
+		if err := ns.WriteFile(filePath, content, 0644); err != nil {
+			fmt.Printf("写入文件 %s 失败: %v\n", filePath, err)
 			continue
 		}
 
-		// 将文件与数据块关联
-		err = storage.SetMetadata(fragmenta.UserTag(0x3000+uint16(i)), fragmenta.EncodeInt64(int64(blockID)))
-		if err != nil {
-			fmt.Printf("关联文件与数据块失败: %v\n", err)
-			continue
-		}
-
-		fmt.Printf("创建示例文件: %s (块ID: %d)\n", filePath, blockID)
+		fmt.Printf("创建示例文件: %s\n", filePath)
 	}
 
 	// 创建根目录的欢迎文件
@@ -230,18 +224,13 @@ func createExampleFiles(storage fragmenta.Fragmenta) {
 
 了解更多信息，请访问项目文档。`)
 
-	// 写入欢迎文件内容
-	welcomeBlockID, err := storage.WriteBlock(welcomeContent, nil)
-	if err != nil {
-		fmt.Printf("写入欢迎文件内容失败: %v\n", err)
+	if err := ns.WriteFile("/欢迎使用.txt", welcomeContent, 0644); err != nil {
+		fmt.Printf("写入欢迎文件失败: %v\n", err)
 	} else {
-		// 设置欢迎文件元数据
-		storage.SetMetadata(fragmenta.UserTag(0x2100), []byte("/欢迎使用.txt"))
-		storage.SetMetadata(fragmenta.UserTag(0x3100), fragmenta.EncodeInt64(int64(welcomeBlockID)))
-		fmt.Printf("创建欢迎文件: /欢迎使用.txt (块ID: %d)\n", welcomeBlockID)
+		fmt.Println("创建欢迎文件: /欢迎使用.txt")
 	}
 
-	// 提交更改
+	// 提交更改（同时写入命名空间表）
 	if err := storage.Commit(); err != nil {
 		fmt.Printf("提交更改失败: %v\n", err)
 	} else {
@@ -0,0 +1,92 @@
+// FragDB WebDAV服务示例
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/bpfs/fragmenta"
+	fragfs "github.com/bpfs/fragmenta/fs"
+)
+
+var (
+	listenAddr  = flag.String("listen", "127.0.0.1:8080", "监听地址")
+	storagePath = flag.String("storage", "webdav-example.frag", "存储文件路径")
+	prefix      = flag.String("prefix", "", "URL前缀，例如/dav")
+	readOnly    = flag.Bool("readonly", false, "只读访问")
+)
+
+func main() {
+	flag.Parse()
+
+	fmt.Println("=== FragDB WebDAV服务示例 (实验性) ===")
+	fmt.Printf("存储文件：%s\n", *storagePath)
+
+	// 创建或打开FragDB存储
+	var storage fragmenta.Fragmenta
+	var err error
+	if _, statErr := os.Stat(*storagePath); os.IsNotExist(statErr) {
+		fmt.Println("创建新的FragDB存储文件...")
+		storage, err = fragmenta.CreateFragmenta(*storagePath, nil)
+	} else {
+		fmt.Println("打开现有FragDB存储文件...")
+		storage, err = fragmenta.OpenFragmenta(*storagePath)
+	}
+	if err != nil {
+		fmt.Printf("打开FragDB存储失败: %v\n", err)
+		os.Exit(1)
+	}
+	defer storage.Close()
+
+	ns, err := storage.Namespace()
+	if err != nil {
+		fmt.Printf("加载命名空间失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	options := fragfs.DefaultWebDAVOptions()
+	options.Prefix = *prefix
+	options.ReadOnly = *readOnly
+
+	handler, err := fragfs.NewWebDAVHandler(ns, options)
+	if err != nil {
+		fmt.Printf("创建WebDAV处理器失败: %v\n", err)
+		os.Exit(1)
+	}
+
+	server := &http.Server{Addr: *listenAddr, Handler: handler}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fmt.Printf("WebDAV服务失败: %v\n", err)
+			os.Exit(1)
+		}
+	}()
+
+	fmt.Printf("WebDAV服务已启动: http://%s%s/\n", *listenAddr, *prefix)
+	fmt.Println("提示:")
+	fmt.Println("  macOS: Finder -> 前往 -> 连接服务器，输入上面的地址")
+	fmt.Println("  Windows: 资源管理器 -> 映射网络驱动器，输入上面的地址")
+	fmt.Println("按 Ctrl+C 停止服务")
+
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
+	<-sigCh
+
+	fmt.Println("正在停止WebDAV服务...")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		fmt.Printf("停止服务失败: %v\n", err)
+	}
+
+	// 提交更改（同时写入命名空间表）
+	if err := storage.Commit(); err != nil {
+		fmt.Printf("提交更改失败: %v\n", err)
+	}
+}
@@ -0,0 +1,267 @@
+package fragmenta
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ArchiveFormat 导出归档的格式
+type ArchiveFormat string
+
+const (
+	// ArchiveTar tar格式（PAX），块属性保存在PAX扩展头中
+	ArchiveTar ArchiveFormat = "tar"
+	// ArchiveZip zip格式，块属性以JSON保存在扩展字段中
+	ArchiveZip ArchiveFormat = "zip"
+)
+
+const (
+	// ArchivePAXPrefix tar条目中块信息的PAX记录前缀：FRAGMENTA.block-id 为块ID，
+	// FRAGMENTA.attr.<键> 为块属性
+	ArchivePAXPrefix = "FRAGMENTA."
+
+	// ArchiveZipExtraID zip条目中保存块信息的扩展字段ID（"FR"），
+	// 内容为JSON对象 {"blockID": 块ID, "attributes": {块属性}}
+	ArchiveZipExtraID uint16 = 0x4652
+)
+
+// ExportResult 导出结果
+type ExportResult struct {
+	Objects int   // 导出的对象数
+	Bytes   int64 // 导出的数据字节数（不含归档格式的开销）
+}
+
+// archiveObject 要导出的对象
+type archiveObject struct {
+	blockID    uint32
+	name       string
+	size       int64
+	modTime    time.Time
+	attributes map[string]string
+}
+
+// ExportArchive 把查询选中的对象写入tar或zip归档，供不认识FragDB的系统使用。
+// query的语法见 Query，选中的块中只有块链的第一个块作为对象导出，对象内容为整条块链（见 ReadToWriter）；
+// query为空时导出所有对象。系统块和回收站中的块不导出。
+// 条目名称取自块的path属性（见 ImportDirectory），没有时为 "blocks/<块ID>"；修改时间取自mtime属性，
+// 没有时为块的创建时间。块属性保存在tar的PAX扩展头或zip的扩展字段中（见 ArchivePAXPrefix、ArchiveZipExtraID）。
+// 查询非空时自动启动查询服务
+func (f *FragmentaImpl) ExportArchive(ctx context.Context, w io.Writer, format ArchiveFormat, query string) (*ExportResult, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if format != ArchiveTar && format != ArchiveZip {
+		return nil, fmt.Errorf("%w: 不支持的归档格式%q", ErrInvalidArgument, format)
+	}
+
+	objects, err := f.selectArchiveObjects(query)
+	if err != nil {
+		return nil, err
+	}
+
+	var archive archiveWriter
+	if format == ArchiveTar {
+		archive = &tarArchive{w: tar.NewWriter(w)}
+	} else {
+		archive = &zipArchive{w: zip.NewWriter(w)}
+	}
+
+	result := &ExportResult{}
+	for _, object := range objects {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		entry, err := archive.create(object)
+		if err != nil {
+			logger.Error("写入归档条目失败", "name", object.name, "error", err)
+			return result, err
+		}
+		n, err := f.ReadToWriter(ctx, object.blockID, entry)
+		if err != nil {
+			return result, err
+		}
+
+		result.Objects++
+		result.Bytes += n
+	}
+
+	if err := archive.close(); err != nil {
+		logger.Error("关闭归档失败", "error", err)
+		return result, err
+	}
+
+	logger.Info("已导出归档", "format", format, "objects", result.Objects, "bytes", result.Bytes)
+	return result, nil
+}
+
+// selectArchiveObjects 按查询选出要导出的对象，按块ID排序
+func (f *FragmentaImpl) selectArchiveObjects(query string) ([]*archiveObject, error) {
+	var ids []uint32
+	if strings.TrimSpace(query) == "" {
+		headers, err := f.ListBlocks()
+		if err != nil {
+			return nil, err
+		}
+		for _, header := range headers {
+			ids = append(ids, header.BlockID)
+		}
+	} else {
+		if err := f.StartQueryService(); err != nil {
+			return nil, err
+		}
+		result, err := f.Query(query)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range result.Entries {
+			ids = append(ids, entry.BlockID)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	}
+
+	names := make(map[string]bool)
+	objects := make([]*archiveObject, 0, len(ids))
+	for _, id := range ids {
+		header, err := f.GetBlockInfo(id)
+		if err != nil {
+			return nil, err
+		}
+		if header.BlockType == SystemBlockType || header.PreviousBlock != 0 {
+			continue
+		}
+
+		size, err := f.chainSize(id)
+		if err != nil {
+			return nil, err
+		}
+		attributes, err := f.GetBlockAttributes(id)
+		if err != nil {
+			return nil, err
+		}
+
+		object := &archiveObject{
+			blockID:    id,
+			name:       strings.TrimLeft(attributes[ImportAttributePath], "/"),
+			size:       size,
+			modTime:    time.Unix(0, header.Timestamp),
+			attributes: attributes,
+		}
+		if object.name == "" {
+			object.name = fmt.Sprintf("blocks/%d", id)
+		}
+		if names[object.name] {
+			object.name = fmt.Sprintf("%s.%d", object.name, id)
+		}
+		names[object.name] = true
+		if mtime, err := time.Parse(time.RFC3339Nano, attributes[ImportAttributeModTime]); err == nil {
+			object.modTime = mtime
+		}
+
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
+// chainSize 计算从blockID开始的块链的数据大小
+func (f *FragmentaImpl) chainSize(blockID uint32) (int64, error) {
+	var size int64
+	visited := make(map[uint32]struct{})
+	for id := blockID; id != 0; {
+		if _, ok := visited[id]; ok {
+			return 0, fmt.Errorf("%w: block %d appears twice", ErrBrokenBlockChain, id)
+		}
+		visited[id] = struct{}{}
+
+		header, err := f.blockManager.GetBlockInfo(id)
+		if err != nil {
+			return 0, err
+		}
+		size += int64(header.Size)
+		id = header.NextBlock
+	}
+	return size, nil
+}
+
+// archiveWriter 归档格式的写入
+type archiveWriter interface {
+	create(object *archiveObject) (io.Writer, error)
+	close() error
+}
+
+// tarArchive tar格式的归档
+type tarArchive struct {
+	w *tar.Writer
+}
+
+func (a *tarArchive) create(object *archiveObject) (io.Writer, error) {
+	records := map[string]string{ArchivePAXPrefix + "block-id": strconv.FormatUint(uint64(object.blockID), 10)}
+	for key, value := range object.attributes {
+		// PAX记录的键不能包含"="
+		if strings.Contains(key, "=") {
+			logger.Warn("块属性的键不能写入PAX扩展头，已跳过", "blockID", object.blockID, "key", key)
+			continue
+		}
+		records[ArchivePAXPrefix+"attr."+key] = value
+	}
+
+	err := a.w.WriteHeader(&tar.Header{
+		Typeflag:   tar.TypeReg,
+		Name:       object.name,
+		Size:       object.size,
+		Mode:       0o644,
+		ModTime:    object.modTime,
+		Format:     tar.FormatPAX,
+		PAXRecords: records,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return a.w, nil
+}
+
+func (a *tarArchive) close() error {
+	return a.w.Close()
+}
+
+// zipArchive zip格式的归档
+type zipArchive struct {
+	w *zip.Writer
+}
+
+func (a *zipArchive) create(object *archiveObject) (io.Writer, error) {
+	info, err := json.Marshal(struct {
+		BlockID    uint32            `json:"blockID"`
+		Attributes map[string]string `json:"attributes,omitempty"`
+	}{object.blockID, object.attributes})
+	if err != nil {
+		return nil, err
+	}
+	if len(info) > 0xFFFF {
+		return nil, fmt.Errorf("%w: 块%d的属性超过zip扩展字段的大小上限", ErrInvalidArgument, object.blockID)
+	}
+
+	extra := binary.LittleEndian.AppendUint16(nil, ArchiveZipExtraID)
+	extra = binary.LittleEndian.AppendUint16(extra, uint16(len(info)))
+	extra = append(extra, info...)
+
+	return a.w.CreateHeader(&zip.FileHeader{
+		Name:     object.name,
+		Method:   zip.Deflate,
+		Modified: object.modTime,
+		Extra:    extra,
+	})
+}
+
+func (a *zipArchive) close() error {
+	return a.w.Close()
+}
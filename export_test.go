@@ -0,0 +1,149 @@
+package fragmenta
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// TestExportArchive 测试导出tar和zip归档
+func TestExportArchive(t *testing.T) {
+	src := t.TempDir()
+	files := map[string][]byte{
+		"a.txt":     []byte("alpha"),
+		"sub/b.txt": bytes.Repeat([]byte("b"), 10000),
+	}
+	for name, data := range files {
+		full := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := CreateFragmenta(filepath.Join(t.TempDir(), "test.frag"), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.ImportDirectory(context.Background(), src, &ImportOptions{Hash: true}); err != nil {
+		t.Fatalf("导入目录失败: %v", err)
+	}
+	plain, err := f.WriteBlock([]byte("plain"), &BlockOptions{BlockType: NormalBlockType, Attributes: map[string]string{"tenant": "alpha"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.ExportArchive(context.Background(), io.Discard, "rar", ""); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("不支持的格式应返回ErrInvalidArgument: %v", err)
+	}
+
+	// tar：导出全部对象
+	var buf bytes.Buffer
+	result, err := f.ExportArchive(context.Background(), &buf, ArchiveTar, "")
+	if err != nil {
+		t.Fatalf("导出tar失败: %v", err)
+	}
+	if result.Objects != 3 || result.Bytes != 10010 {
+		t.Fatalf("导出结果不正确: %+v", result)
+	}
+
+	tr := tar.NewReader(&buf)
+	seen := 0
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("读取tar失败: %v", err)
+		}
+		seen++
+		data, _ := io.ReadAll(tr)
+
+		if header.Name == "blocks/"+strconv.FormatUint(uint64(plain), 10) {
+			if string(data) != "plain" || header.PAXRecords[ArchivePAXPrefix+"attr.tenant"] != "alpha" {
+				t.Errorf("%s 的内容或属性不正确", header.Name)
+			}
+			continue
+		}
+		want, ok := files[header.Name]
+		if !ok {
+			t.Errorf("多余的条目 %s", header.Name)
+			continue
+		}
+		if !bytes.Equal(data, want) {
+			t.Errorf("%s 的内容不正确", header.Name)
+		}
+		if header.PAXRecords[ArchivePAXPrefix+"attr.path"] != header.Name || header.PAXRecords[ArchivePAXPrefix+"attr.sha256"] == "" {
+			t.Errorf("%s 的PAX扩展头不正确: %v", header.Name, header.PAXRecords)
+		}
+		if header.PAXRecords[ArchivePAXPrefix+"block-id"] == "" {
+			t.Errorf("%s 缺少块ID", header.Name)
+		}
+	}
+	if seen != 3 {
+		t.Errorf("tar条目数不正确: %d", seen)
+	}
+
+	// zip：按属性查询
+	buf.Reset()
+	result, err = f.ExportArchive(context.Background(), &buf, ArchiveZip, "path==sub/b.txt")
+	if err != nil {
+		t.Fatalf("导出zip失败: %v", err)
+	}
+	if result.Objects != 1 {
+		t.Fatalf("导出结果不正确: %+v", result)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("读取zip失败: %v", err)
+	}
+	if len(zr.File) != 1 || zr.File[0].Name != "sub/b.txt" {
+		t.Fatalf("zip条目不正确: %v", zr.File)
+	}
+	rc, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if !bytes.Equal(data, files["sub/b.txt"]) {
+		t.Error("zip条目的内容不正确")
+	}
+
+	extra := zr.File[0].Extra
+	if len(extra) < 4 || binary.LittleEndian.Uint16(extra) != ArchiveZipExtraID {
+		t.Fatalf("zip条目缺少扩展字段: %x", extra)
+	}
+	var info struct {
+		BlockID    uint32            `json:"blockID"`
+		Attributes map[string]string `json:"attributes"`
+	}
+	if err := json.Unmarshal(extra[4:4+binary.LittleEndian.Uint16(extra[2:])], &info); err != nil {
+		t.Fatalf("解析扩展字段失败: %v", err)
+	}
+	if info.BlockID == 0 || info.Attributes["size"] != "10000" {
+		t.Errorf("扩展字段不正确: %+v", info)
+	}
+
+	// 已取消的ctx
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.ExportArchive(ctx, io.Discard, ArchiveTar, ""); !errors.Is(err, context.Canceled) {
+		t.Errorf("取消后应返回context.Canceled: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package fragmenta
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FeatureFlags 文件特性标志，保存在文件头的Flags字段中，与对应的Flag常量取值相同
+type FeatureFlags uint16
+
+const (
+	// FeatureCompression 应用声明文件中的数据块使用压缩。只是提示，读写路径不据此压缩或解压，
+	// 块是否压缩以块头的 BlockFlagCompressed 为准
+	FeatureCompression = FeatureFlags(FlagCompressed)
+
+	// FeatureEncryption 应用声明文件中的数据块使用加密。只是提示，读写路径不据此加密或解密，
+	// 块是否加密以块头的 BlockFlagEncrypted 为准（见 EncryptionReport）
+	FeatureEncryption = FeatureFlags(FlagEncrypted)
+
+	// FeatureContentAddressed 内容寻址模式，只能在创建时通过 FragmentaOptions.ContentAddressed 指定
+	FeatureContentAddressed = FeatureFlags(FlagContentAddressed)
+)
+
+// allFeatures Features返回的全部特性
+const allFeatures = FeatureCompression | FeatureEncryption | FeatureContentAddressed
+
+// mutableFeatures 创建后可以用SetFeature修改的特性
+const mutableFeatures = FeatureCompression | FeatureEncryption
+
+// knownHeaderFlags 当前版本定义的全部文件头标志，打开文件时拒绝其他标志位
+const knownHeaderFlags = FlagCompressed | FlagEncrypted | FlagReadOnly | FlagIndexed | FlagHasDelta |
+	FlagTempFile | FlagShadowHeader | FlagDeterministic | FlagContentAddressed
+
+// featureNames 特性名称，按String的输出顺序排列
+var featureNames = []struct {
+	flag FeatureFlags
+	name string
+}{
+	{FeatureCompression, "compression"},
+	{FeatureEncryption, "encryption"},
+	{FeatureContentAddressed, "content-addressed"},
+}
+
+// Has 是否包含flag中的全部特性
+func (f FeatureFlags) Has(flag FeatureFlags) bool {
+	return f&flag == flag
+}
+
+// String 返回以|分隔的特性名称，没有特性时返回none
+func (f FeatureFlags) String() string {
+	var names []string
+	for _, feature := range featureNames {
+		if f&feature.flag != 0 {
+			names = append(names, feature.name)
+			f &^= feature.flag
+		}
+	}
+	if f != 0 {
+		names = append(names, fmt.Sprintf("0x%04x", uint16(f)))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// Features 返回文件头中记录的特性
+func (f *FragmentaImpl) Features() FeatureFlags {
+	f.writeMutex.RLock()
+	defer f.writeMutex.RUnlock()
+
+	return FeatureFlags(f.header.Flags) & allFeatures
+}
+
+// SetFeature 启用或停用特性，只能修改压缩和加密，提交后写入文件头。
+// 只修改文件头中的标志，不改变已写入或之后写入的块数据
+func (f *FragmentaImpl) SetFeature(flag FeatureFlags, enabled bool) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	if flag == 0 || flag&^mutableFeatures != 0 {
+		return fmt.Errorf("%w: 特性%s不能在创建后修改", ErrInvalidArgument, flag&^mutableFeatures)
+	}
+
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	if enabled {
+		f.header.Flags |= uint16(flag)
+	} else {
+		f.header.Flags &^= uint16(flag)
+	}
+	f.isDirty.Store(true)
+	return nil
+}
+
+// GetUserDefinedID 返回文件头中的用户定义标识，未设置时为全零
+func (f *FragmentaImpl) GetUserDefinedID() [16]byte {
+	f.writeMutex.RLock()
+	defer f.writeMutex.RUnlock()
+
+	return f.header.UserDefinedID
+}
+
+// SetUserDefinedID 设置文件头中的用户定义标识，例如应用分配的UUID，提交后写入文件头
+func (f *FragmentaImpl) SetUserDefinedID(id [16]byte) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	f.header.UserDefinedID = id
+	f.isDirty.Store(true)
+	return nil
+}
+
+// validateFlags 检查文件头标志：不能包含未定义的标志位，确定性模式只支持容器模式
+func (f *FragmentaImpl) validateFlags() error {
+	if unknown := f.header.Flags &^ knownHeaderFlags; unknown != 0 {
+		return fmt.Errorf("%w: 未知的文件头标志0x%04x", ErrInvalidFragmenta, unknown)
+	}
+	if f.header.Flags&FlagDeterministic != 0 && f.header.StorageMode != ContainerMode {
+		return fmt.Errorf("%w: 确定性模式只支持容器模式", ErrInvalidFragmenta)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package fragmenta
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestHeaderFeatures 测试用户定义标识和特性标志的设置、持久化以及打开时的校验
+func TestHeaderFeatures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "features.frag")
+	f, err := CreateFragmenta(path, &FragmentaOptions{StorageMode: ContainerMode, ContentAddressed: true})
+	if err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+
+	id := [16]byte{0xde, 0xad, 0xbe, 0xef, 15: 1}
+	if err := f.SetUserDefinedID(id); err != nil {
+		t.Fatalf("设置用户定义标识失败: %v", err)
+	}
+	if err := f.SetFeature(FeatureCompression|FeatureEncryption, true); err != nil {
+		t.Fatalf("启用特性失败: %v", err)
+	}
+	if err := f.SetFeature(FeatureEncryption, false); err != nil {
+		t.Fatalf("停用特性失败: %v", err)
+	}
+	if err := f.SetFeature(FeatureContentAddressed, false); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("内容寻址模式不能在创建后修改: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	f, err = OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	if got := f.GetUserDefinedID(); got != id {
+		t.Errorf("用户定义标识不正确: %x", got)
+	}
+	features := f.Features()
+	if !features.Has(FeatureCompression|FeatureContentAddressed) || features.Has(FeatureEncryption) {
+		t.Errorf("特性不正确: %s", features)
+	}
+	if s := features.String(); s != "compression|content-addressed" {
+		t.Errorf("特性名称不正确: %s", s)
+	}
+
+	// 加密标志只是声明，检查报告按块头统计加密状态
+	if err := f.SetFeature(FeatureEncryption, true); err != nil {
+		t.Fatalf("启用特性失败: %v", err)
+	}
+	if _, err := f.WriteBlock([]byte("plain"), nil); err != nil {
+		t.Fatalf("写入数据块失败: %v", err)
+	}
+	if err := f.Commit(); err != nil {
+		t.Fatalf("提交失败: %v", err)
+	}
+	report, err := Inspect(path)
+	if err != nil {
+		t.Fatalf("检查文件失败: %v", err)
+	}
+	if !report.Encryption.EncryptionFlag || report.Encryption.EncryptedBlocks != 0 || report.Encryption.PlainBlocks == 0 {
+		t.Errorf("加密状态不正确: %+v", report.Encryption)
+	}
+	if err := f.SetFeature(FeatureEncryption, false); err != nil {
+		t.Fatalf("停用特性失败: %v", err)
+	}
+
+	// 未定义的标志位在打开时被拒绝
+	f.(*FragmentaImpl).header.Flags |= 0x8000
+	f.(*FragmentaImpl).isDirty.Store(true)
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	if _, err := OpenFragmenta(path); !errors.Is(err, ErrInvalidFragmenta) {
+		t.Errorf("未知标志应返回ErrInvalidFragmenta: %v", err)
+	}
+}
@@ -1,30 +1,27 @@
 package fragmenta
 
 import (
-	"encoding/binary"
-	"io"
+	"fmt"
+	"io/fs"
 	"os"
 	"sync"
+	"sync/atomic"
 	"time"
-)
 
-// 创建实体类型的别名，解决循环引用问题
-var (
-	// IndexServices 存储索引服务
-	IndexServices = make(map[string]interface{})
-	// StorageServices 存储管理服务
-	StorageServices = make(map[string]interface{})
+	"github.com/bpfs/fragmenta/index"
+	"github.com/bpfs/fragmenta/storage"
 )
 
 // FragmentaImpl 是Fragmenta接口的具体实现
 type FragmentaImpl struct {
 	// 文件相关
-	path         string
-	file         *os.File
-	header       FragmentaHeader
-	isNew        bool
-	isDirty      bool
-	lastModified time.Time
+	path            string
+	file            *os.File
+	header          FragmentaHeader
+	isNew           bool
+	isDirty         atomic.Bool // 有未提交的更改；并发的写入路径在不同的锁下设置，因此使用原子变量
+	lastModified    time.Time
+	headerRecovered bool // 打开时主文件头无效，使用了影子文件头
 
 	// 状态和锁
 	isOpen     bool
@@ -32,11 +29,96 @@ type FragmentaImpl struct {
 	writeMutex sync.RWMutex
 
 	// 组件
-	storageManager  interface{} // storage.StorageManager
 	metadataManager MetadataManager
 	blockManager    BlockManager
-	indexManager    interface{} // index.IndexManager
-	queryService    interface{} // *index.QueryService
+
+	// 外部组件，由componentMutex保护：块数据存储（通常是storage.StorageManager）、
+	// 目录模式下打开的块数据目录、标签索引管理器和它索引的块元数据标签、
+	// 按元数据模式解码的块元数据标签值、查询服务（StartQueryService时创建）
+	blockStore     BlockStore
+	blockDirectory *storage.StorageManagerImpl
+	indexManager   index.IndexManager
+	blockTags      map[uint32][]uint32
+	blockValues    map[uint32]map[string]interface{}
+	queryService   *index.QueryService
+	componentMutex sync.RWMutex
+
+	// 元数据模式，首次使用时创建
+	schema     *MetadataSchema
+	schemaOnce sync.Once
+
+	// 用户标签名称表，首次使用时从TagUserTags加载，由userTagMutex保护
+	userTags     map[string]uint16
+	userTagMutex sync.Mutex
+
+	// 命名查询表，首次使用时从TagQueryViews加载，由viewMutex保护
+	views     map[string]string
+	viewMutex sync.Mutex
+
+	// 元数据历史（首次使用时从TagMetadataHistory加载，未启用时为nil），由historyMutex保护
+	history       *metadataHistory
+	historyBlock  uint32
+	historyLoaded bool
+	historyMutex  sync.Mutex
+
+	// 回收站（首次使用时从TagTrash加载，从未启用时为nil），由trashMutex保护
+	trash       *trashTable
+	trashBlock  uint32
+	trashLoaded bool
+	trashMutex  sync.Mutex
+
+	// 元数据过期时间表，首次使用时从TagMetadataExpiry加载，由expiryMutex保护
+	expirations map[uint16]time.Time
+	expiryMutex sync.Mutex
+
+	// 过期元数据后台清理协程，由sweeperMutex保护
+	sweeperStopCh chan struct{}
+	sweeperDoneCh chan struct{}
+	sweeperMutex  sync.Mutex
+
+	// 后台作业（首次使用时从TagJobs加载），由jobMutex保护
+	jobs     map[string]*jobRunner
+	jobMutex sync.Mutex
+
+	// 块属性索引器（通常由索引层提供），由indexerMutex保护，
+	// 提交期间同步命名空间时也会更新索引，因此不能使用writeMutex
+	attributeIndexer BlockAttributeIndexer
+	indexerMutex     sync.RWMutex
+
+	// 审计记录器，由auditMutex保护
+	auditRecorder AuditRecorder
+	auditMutex    sync.RWMutex
+
+	// 元数据访问授权，由authorizerMutex保护
+	authorizer      AccessAuthorizer
+	authorizerMutex sync.RWMutex
+
+	// 块签名器和块签名表（首次使用时加载），由signatureMutex保护
+	signer         BlockSigner
+	signatures     map[uint32]*BlockSignature
+	signatureBlock uint32
+	signatureMutex sync.Mutex
+
+	// 文件/目录命名空间（首次使用时加载）
+	namespace *Namespace
+
+	// 确定性模式下写入的固定时间戳（见 DeterministicOptions），未启用时为nil
+	fixedTime *time.Time
+
+	// 内容寻址模式及内容寻址表（首次使用时从TagContentTable加载），由contentMutex保护
+	contentAddressed bool
+	content          *contentTable
+	contentBlock     uint32
+	contentMutex     sync.Mutex
+
+	// Merkle树的块数据哈希（打开时从索引区加载），由merkleMutex保护
+	blockHashes   map[uint32]blockHash
+	merkleChanged bool
+	merkleMutex   sync.Mutex
+
+	// 作为同步目标时最近一次构造的同步树（见 SyncNode），由syncMutex保护
+	syncSnapshot *MerkleTree
+	syncMutex    sync.Mutex
 
 	// 内部缓存
 	metadataCache map[uint16][]byte
@@ -51,22 +133,30 @@ func (f *FragmentaImpl) Close() error {
 		return nil
 	}
 
+	f.StopMetadataSweeper()
+	f.stopJobs()
+
 	f.writeMutex.Lock()
 	defer f.writeMutex.Unlock()
 
 	// 如果有未提交的更改，先提交
-	if f.isDirty {
-		if err := f.Commit(); err != nil {
+	if f.isDirty.Load() || f.namespace != nil {
+		if err := f.commitLocked(); err != nil {
 			logger.Error("关闭文件失败", "error", err)
 			return err
 		}
 	}
 
 	// 关闭文件
+	f.unmap()
 	err := f.file.Close()
 	if err == nil {
 		f.isOpen = false
 	}
+
+	if dirErr := f.detachBlockDirectory(false); dirErr != nil && err == nil {
+		err = dirErr
+	}
 	return err
 }
 
@@ -75,7 +165,20 @@ func (f *FragmentaImpl) Commit() error {
 	f.writeMutex.Lock()
 	defer f.writeMutex.Unlock()
 
-	if !f.isDirty {
+	return f.commitLocked()
+}
+
+// commitLocked 提交更改，调用方需持有writeMutex
+func (f *FragmentaImpl) commitLocked() error {
+	// 命名空间表写入块区，需在刷新元数据前完成
+	if f.namespace != nil && !f.readOnly {
+		if err := f.namespace.Sync(); err != nil {
+			logger.Error("同步命名空间失败", "error", err)
+			return err
+		}
+	}
+
+	if !f.isDirty.Load() {
 		return nil
 	}
 
@@ -83,22 +186,50 @@ func (f *FragmentaImpl) Commit() error {
 		return ErrReadOnly
 	}
 
+	// 刷新前清除标记，刷新期间其他协程的写入重新标记，由下次提交写出；刷新失败时恢复标记
+	f.isDirty.Store(false)
+	if err := f.flushLocked(); err != nil {
+		f.isDirty.Store(true)
+		return err
+	}
+	return nil
+}
+
+// flushLocked 把元数据、索引区和文件头写入文件，调用方需持有writeMutex
+func (f *FragmentaImpl) flushLocked() error {
+
+	// 元数据历史表写入块区并更新TagMetadataHistory，同样需在刷新元数据前完成
+	if err := f.syncMetadataHistory(); err != nil {
+		logger.Error("同步元数据历史失败", "error", err)
+		return err
+	}
+	if err := f.syncTrash(); err != nil {
+		logger.Error("同步回收站失败", "error", err)
+		return err
+	}
+	if err := f.syncContentTable(); err != nil {
+		logger.Error("同步内容寻址表失败", "error", err)
+		return err
+	}
+
 	// 更新最后修改时间
-	f.header.LastModified = time.Now().UnixNano()
+	f.header.LastModified = f.now().UnixNano()
 
-	// 刷新元数据到文件
+	// 刷新元数据到文件，索引区紧跟在元数据区之后
 	if err := f.flushMetadata(); err != nil {
 		logger.Error("刷新元数据失败", "error", err)
 		return err
 	}
+	if err := f.flushIndexRegion(); err != nil {
+		logger.Error("刷新索引区失败", "error", err)
+		return err
+	}
 
 	// 刷新头部信息到文件
 	if err := f.writeHeader(); err != nil {
 		logger.Error("刷新头部信息失败", "error", err)
 		return err
 	}
-
-	f.isDirty = false
 	return nil
 }
 
@@ -113,18 +244,34 @@ func (f *FragmentaImpl) SetMetadata(tag uint16, value []byte) error {
 		return ErrReadOnly
 	}
 
+	if IsReservedTag(tag) {
+		return ErrProtectedMetadata
+	}
+	return f.setMetadata(tag, value)
+}
+
+// setMetadata 设置元数据，可以写入保留标签，供格式内部维护系统标签使用
+func (f *FragmentaImpl) setMetadata(tag uint16, value []byte) error {
+	if err := f.MetadataSchema().Validate(tag, value); err != nil {
+		return err
+	}
+
 	err := f.metadataManager.SetMetadata(tag, value)
 	if err != nil {
 		logger.Error("设置元数据失败", "error", err)
 		return err
 	}
 
-	f.isDirty = true
+	f.isDirty.Store(true)
+	f.recordMetadataChange(auditMetadataSet, tag, value)
 	return nil
 }
 
 // GetMetadata 获取元数据
 func (f *FragmentaImpl) GetMetadata(tag uint16) ([]byte, error) {
+	if f.isMetadataExpired(tag) {
+		return nil, ErrMetadataNotFound
+	}
 	return f.metadataManager.GetMetadata(tag)
 }
 
@@ -134,13 +281,20 @@ func (f *FragmentaImpl) DeleteMetadata(tag uint16) error {
 		return ErrReadOnly
 	}
 
+	if IsReservedTag(tag) {
+		return ErrProtectedMetadata
+	}
+
+	old, _ := f.metadataManager.GetMetadata(tag)
 	err := f.metadataManager.DeleteMetadata(tag)
 	if err != nil {
 		logger.Error("删除元数据失败", "error", err)
 		return err
 	}
 
-	f.isDirty = true
+	f.isDirty.Store(true)
+	f.moveMetadataToTrash(tag, old)
+	f.recordMetadataChange(auditMetadataDelete, tag, nil)
 	return nil
 }
 
@@ -150,85 +304,303 @@ func (f *FragmentaImpl) BatchMetadataOp(batch *BatchMetadataOperation) error {
 		return ErrReadOnly
 	}
 
+	if err := f.validateBatch(batch); err != nil {
+		return err
+	}
+
+	// 删除前的值，启用回收站时移入回收站
+	deleted := make(map[uint16][]byte)
+	for _, op := range batch.Operations {
+		if op.Operation != 1 {
+			continue
+		}
+		if _, ok := deleted[op.Tag]; !ok {
+			if value, err := f.metadataManager.GetMetadata(op.Tag); err == nil {
+				deleted[op.Tag] = value
+			}
+		}
+	}
+
 	err := f.metadataManager.BatchOperation(batch)
 	if err != nil {
 		logger.Error("批量元数据操作失败", "error", err)
 		return err
 	}
 
-	f.isDirty = true
+	f.isDirty.Store(true)
+	for _, op := range batch.Operations {
+		switch op.Operation {
+		case 1:
+			if value, ok := deleted[op.Tag]; ok {
+				f.moveMetadataToTrash(op.Tag, value)
+			}
+			f.recordMetadataChange(auditMetadataDelete, op.Tag, nil)
+		case 2:
+			// 附加操作记录附加后的值
+			value, _ := f.metadataManager.GetMetadata(op.Tag)
+			f.recordMetadataChange(auditMetadataSet, op.Tag, value)
+		default:
+			f.recordMetadataChange(auditMetadataSet, op.Tag, op.Value)
+		}
+	}
 	return nil
 }
 
 // ListMetadata 列出所有元数据
 func (f *FragmentaImpl) ListMetadata() (map[uint16][]byte, error) {
-	return f.metadataManager.ListMetadata()
+	metadata, err := f.metadataManager.ListMetadata()
+	if err != nil {
+		return nil, err
+	}
+	for tag := range f.expiredMetadata() {
+		delete(metadata, tag)
+	}
+	return metadata, nil
 }
 
-// WriteBlock 写入数据块
+// WriteBlock 写入数据块。内容寻址模式下相同内容的普通块只保存一份，返回已有的块ID（见 LookupContent）。
+// 可以与其他块写入、删除并发，与提交互斥：提交把元数据区写在块区之后
 func (f *FragmentaImpl) WriteBlock(data []byte, options *BlockOptions) (uint32, error) {
+	f.writeMutex.RLock()
+	defer f.writeMutex.RUnlock()
+
+	blockID, _, err := f.writeBlockOrDuplicate(data, options)
+	return blockID, err
+}
+
+// writeBlockOrDuplicate 写入数据块，同时返回是否新写入了块（内容寻址模式下可能返回已有的块）
+func (f *FragmentaImpl) writeBlockOrDuplicate(data []byte, options *BlockOptions) (uint32, bool, error) {
+	if f.contentAddressable(options) {
+		return f.writeContentBlock(data, options)
+	}
+	blockID, err := f.writeBlock(data, options)
+	return blockID, blockID != 0, err
+}
+
+// writeBlock 写入数据块，不按内容去重
+func (f *FragmentaImpl) writeBlock(data []byte, options *BlockOptions) (uint32, error) {
 	if f.readOnly {
 		return 0, ErrReadOnly
 	}
 
+	if options != nil {
+		if err := f.validateBlockMetadataTags(options.MetadataTags); err != nil {
+			return 0, err
+		}
+		if options.AppendToBlockID != 0 {
+			if err := f.checkContentMutable(options.AppendToBlockID); err != nil {
+				return 0, err
+			}
+		}
+	}
+
 	blockID, err := f.blockManager.WriteBlock(data, options)
 	if err != nil {
 		logger.Error("写入数据块失败", "error", err)
 		return 0, err
 	}
 
-	f.isDirty = true
-	f.header.BlockSize += uint64(len(data))
+	f.isDirty.Store(true)
+	f.recordBlockHash(blockID, data)
+
+	if err := f.storeBlock(blockID, data); err != nil {
+		return blockID, err
+	}
+
+	if options != nil && len(options.Attributes) > 0 {
+		if err := f.indexAttributes(blockID, options.Attributes); err != nil {
+			return blockID, err
+		}
+	}
+
+	if options != nil {
+		if err := f.indexBlockTags(blockID, options.MetadataTags); err != nil {
+			return blockID, err
+		}
+		if err := f.indexBlockValues(blockID, options.MetadataTags); err != nil {
+			return blockID, err
+		}
+	}
+
+	if err := f.queryIndexBlock(blockID); err != nil {
+		return blockID, err
+	}
+
 	return blockID, nil
 }
 
-// ReadBlock 读取数据块
+// ReadBlock 读取数据块，设置了块数据存储时从存储读取。回收站中的块返回ErrBlockNotFound，
+// 内容寻址的单块对象读出的数据与内容哈希不符时返回ErrContentMismatch
 func (f *FragmentaImpl) ReadBlock(blockID uint32) ([]byte, error) {
+	if f.isTrashed(blockID) {
+		return nil, ErrBlockNotFound
+	}
+	data, err := f.readBlock(blockID)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.verifyContentBlock(blockID, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readBlock 读取数据块，不检查回收站
+func (f *FragmentaImpl) readBlock(blockID uint32) ([]byte, error) {
+	if store := f.getBlockStore(); store != nil {
+		return store.ReadBlock(blockID)
+	}
 	return f.blockManager.ReadBlock(blockID)
 }
 
-// WriteFromReader 从Reader写入
-func (f *FragmentaImpl) WriteFromReader(reader io.Reader, options *BlockOptions) error {
+// DeleteBlock 删除数据块。启用回收站时块移入回收站（见 EnableTrash），否则立即删除。
+// 块处于保留期或法律保留中（见 SetBlockRetention）时返回ErrRetained。与 WriteBlock 一样与提交互斥
+func (f *FragmentaImpl) DeleteBlock(blockID uint32) error {
 	if f.readOnly {
 		return ErrReadOnly
 	}
 
-	// 读取所有数据到内存
-	data, err := io.ReadAll(reader)
-	if err != nil {
-		logger.Error("读取数据失败", "error", err)
+	f.writeMutex.RLock()
+	defer f.writeMutex.RUnlock()
+
+	if err := f.checkRetention(blockID); err != nil {
 		return err
 	}
+	moved, err := f.moveBlockToTrash(blockID)
+	if err != nil || moved {
+		return err
+	}
+	return f.deleteBlock(blockID)
+}
 
-	// 写入数据块
-	_, err = f.WriteBlock(data, options)
+// reservingBlockDeleter 可以在删除块后暂不回收块ID的块管理器
+type reservingBlockDeleter interface {
+	deleteBlockReserved(blockID uint32) (func(), error)
+}
+
+// deleteBlock 立即删除数据块，不经过回收站。块ID在附属数据清理完成后才回收，
+// 否则并发的写入可能重新使用该ID，它写入块数据存储的数据随后被这里的清理删除
+func (f *FragmentaImpl) deleteBlock(blockID uint32) error {
+	release := func() {}
+	var err error
+	if deleter, ok := f.blockManager.(reservingBlockDeleter); ok {
+		release, err = deleter.deleteBlockReserved(blockID)
+	} else {
+		err = f.blockManager.DeleteBlock(blockID)
+	}
 	if err != nil {
-		logger.Error("写入数据块失败", "error", err)
+		logger.Error("删除数据块失败", "blockID", blockID, "error", err)
 		return err
 	}
+	defer release()
 
-	return nil
+	f.isDirty.Store(true)
+	return f.blockDeleted(blockID)
 }
 
-// ReadToWriter 读取到Writer
-func (f *FragmentaImpl) ReadToWriter(writer io.Writer) error {
-	// 读取所有块并写入writer
-	// 简化实现：假设只有一个块，ID为1
-	data, err := f.ReadBlock(1)
-	if err != nil {
-		logger.Error("读取数据失败", "error", err)
+// blockDeleted 块删除后同步属性索引、块数据存储、标签索引、查询服务和块签名
+func (f *FragmentaImpl) blockDeleted(blockID uint32) error {
+	if err := f.indexAttributes(blockID, nil); err != nil {
 		return err
 	}
 
-	_, err = writer.Write(data)
-	if err != nil {
-		logger.Error("写入数据失败", "error", err)
+	if err := f.unstoreBlock(blockID); err != nil {
+		return err
+	}
+
+	if err := f.removeBlockTags(blockID); err != nil {
+		return err
+	}
+
+	if err := f.queryRemoveBlock(blockID); err != nil {
 		return err
 	}
 
+	if err := f.removeBlockSignature(blockID); err != nil {
+		logger.Warn("删除块签名失败", "blockID", blockID, "error", err)
+	}
+
+	f.removeContent(blockID)
+	f.forgetBlockHash(blockID)
 	return nil
 }
 
+// LinkBlocks 将两个数据块链接为块链
+func (f *FragmentaImpl) LinkBlocks(sourceID, targetID uint32) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	if f.isTrashed(sourceID) || f.isTrashed(targetID) {
+		return ErrBlockNotFound
+	}
+	for _, blockID := range []uint32{sourceID, targetID} {
+		if err := f.checkContentMutable(blockID); err != nil {
+			return err
+		}
+	}
+
+	if err := f.blockManager.LinkBlocks(sourceID, targetID); err != nil {
+		logger.Error("链接数据块失败", "sourceID", sourceID, "targetID", targetID, "error", err)
+		return err
+	}
+
+	f.isDirty.Store(true)
+	return nil
+}
+
+// GetBlockInfo 获取数据块的头信息，回收站中的块返回ErrBlockNotFound
+func (f *FragmentaImpl) GetBlockInfo(blockID uint32) (*BlockHeader, error) {
+	if f.isTrashed(blockID) {
+		return nil, ErrBlockNotFound
+	}
+	return f.blockManager.GetBlockInfo(blockID)
+}
+
+// ListBlocks 按块ID顺序列出所有有效数据块的头信息，不包含回收站中的块
+func (f *FragmentaImpl) ListBlocks() ([]*BlockHeader, error) {
+	headers := f.blockManager.ListBlocks()
+	trashed := f.trashedBlocks()
+	if len(trashed) == 0 {
+		return headers, nil
+	}
+
+	blocks := make([]*BlockHeader, 0, len(headers))
+	for _, header := range headers {
+		if _, ok := trashed[header.BlockID]; !ok {
+			blocks = append(blocks, header)
+		}
+	}
+	return blocks, nil
+}
+
+// Namespace 获取文件/目录命名空间，首次调用时从TagNamespace加载或创建
+func (f *FragmentaImpl) Namespace() (*Namespace, error) {
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	if f.namespace != nil {
+		return f.namespace, nil
+	}
+
+	ns, err := NewNamespace(namespaceBackend{f}, DefaultBlockSize)
+	if err != nil {
+		logger.Error("加载命名空间失败", "error", err)
+		return nil, err
+	}
+
+	f.namespace = ns
+	return ns, nil
+}
+
+// FS 返回命名空间中文件和目录的只读io/fs视图
+func (f *FragmentaImpl) FS() (fs.FS, error) {
+	ns, err := f.Namespace()
+	if err != nil {
+		return nil, err
+	}
+	return NewNamespaceFS(ns), nil
+}
+
 // QueryByTag 通过标签查询
 func (f *FragmentaImpl) QueryByTag(tag uint16, value []byte) ([]interface{}, error) {
 	// 简单实现：通过元数据查询
@@ -259,10 +631,40 @@ func (f *FragmentaImpl) QueryByTag(tag uint16, value []byte) ([]interface{}, err
 	return entries, nil
 }
 
-// QueryMetadata 复杂元数据查询
+// QueryMetadata 复杂元数据查询，结果不包含已过期的元数据
 func (f *FragmentaImpl) QueryMetadata(query *MetadataQuery) (*QueryResult, error) {
-	// 直接调用元数据管理器的查询功能
-	return f.metadataManager.QueryMetadata(query)
+	expired := f.expiredMetadata()
+	if len(expired) == 0 || query == nil {
+		return f.metadataManager.QueryMetadata(query)
+	}
+
+	// 有过期项时先取得全部结果，过滤后再分页
+	all := *query
+	all.Offset, all.Limit = 0, 0
+	result, err := f.metadataManager.QueryMetadata(&all)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]ResultEntry, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		if _, ok := expired[entry.MetadataID]; !ok {
+			entries = append(entries, entry)
+		}
+	}
+
+	total := uint32(len(entries))
+	start := min(query.Offset, total)
+	entries = entries[start:]
+	if query.Limit > 0 && uint32(len(entries)) > query.Limit {
+		entries = entries[:query.Limit]
+	}
+
+	result.Entries = entries
+	result.TotalCount = total
+	result.ReturnCount = uint32(len(entries))
+	result.HasMore = total > start+result.ReturnCount
+	return result, nil
 }
 
 // VerifyIndices 验证索引
@@ -286,42 +688,6 @@ func (f *FragmentaImpl) RebuildIndices() error {
 	return nil
 }
 
-// StartQueryService 启动查询服务
-func (f *FragmentaImpl) StartQueryService() error {
-	// 暂时返回nil，后续实现
-	return nil
-}
-
-// ConvertToDirectoryMode 转换为目录模式
-func (f *FragmentaImpl) ConvertToDirectoryMode() error {
-	if f.readOnly {
-		return ErrReadOnly
-	}
-
-	// 只有容器模式才能转换为目录模式
-	if f.header.StorageMode != ContainerMode {
-		return ErrInvalidOperation
-	}
-
-	// 暂时返回nil，后续实现
-	return nil
-}
-
-// ConvertToContainerMode 转换为容器模式
-func (f *FragmentaImpl) ConvertToContainerMode() error {
-	if f.readOnly {
-		return ErrReadOnly
-	}
-
-	// 只有目录模式才能转换为容器模式
-	if f.header.StorageMode != DirectoryMode {
-		return ErrInvalidOperation
-	}
-
-	// 暂时返回nil，后续实现
-	return nil
-}
-
 // OptimizeStorage 优化存储
 func (f *FragmentaImpl) OptimizeStorage() error {
 	if f.readOnly {
@@ -337,287 +703,49 @@ func (f *FragmentaImpl) initializeHeader() {
 	f.header = FragmentaHeader{
 		Magic:          MagicNumber,
 		Version:        CurrentVersion,
-		Flags:          0,
-		Timestamp:      time.Now().UnixNano(),
-		LastModified:   time.Now().UnixNano(),
+		Flags:          FlagShadowHeader,
+		Timestamp:      f.now().UnixNano(),
+		LastModified:   f.now().UnixNano(),
 		StorageMode:    ContainerMode,
 		Reserved1:      0,
 		Reserved2:      0,
-		MetadataOffset: 256, // 紧跟在头部之后
+		MetadataOffset: HeaderSize, // 紧跟在头部之后
 		MetadataSize:   0,
 		BlockOffset:    0,
 		BlockSize:      0,
 		IndexOffset:    0,
 		IndexSize:      0,
-		TotalSize:      256, // 初始只有头部
-	}
-}
-
-func (f *FragmentaImpl) writeHeader() error {
-	// 定位到文件开头
-	_, err := f.file.Seek(0, io.SeekStart)
-	if err != nil {
-		logger.Error("定位到文件开头失败", "error", err)
-		return err
-	}
-
-	// 写入魔数
-	err = binary.Write(f.file, binary.BigEndian, f.header.Magic)
-	if err != nil {
-		logger.Error("写入魔数失败", "error", err)
-		return err
-	}
-
-	// 写入版本
-	err = binary.Write(f.file, binary.BigEndian, f.header.Version)
-	if err != nil {
-		logger.Error("写入版本失败", "error", err)
-		return err
-	}
-
-	// 写入标志
-	err = binary.Write(f.file, binary.BigEndian, f.header.Flags)
-	if err != nil {
-		logger.Error("写入标志失败", "error", err)
-		return err
-	}
-
-	// 写入时间戳
-	err = binary.Write(f.file, binary.BigEndian, f.header.Timestamp)
-	if err != nil {
-		logger.Error("写入时间戳失败", "error", err)
-		return err
-	}
-
-	// 写入最后修改时间
-	err = binary.Write(f.file, binary.BigEndian, f.header.LastModified)
-	if err != nil {
-		logger.Error("写入最后修改时间失败", "error", err)
-		return err
-	}
-
-	// 写入存储模式
-	err = binary.Write(f.file, binary.BigEndian, f.header.StorageMode)
-	if err != nil {
-		logger.Error("写入存储模式失败", "error", err)
-		return err
-	}
-
-	// 写入保留字段
-	err = binary.Write(f.file, binary.BigEndian, f.header.Reserved1)
-	if err != nil {
-		logger.Error("写入保留字段失败", "error", err)
-		return err
-	}
-
-	err = binary.Write(f.file, binary.BigEndian, f.header.Reserved2)
-	if err != nil {
-		logger.Error("写入保留字段失败", "error", err)
-		return err
-	}
-
-	// 写入各区域偏移和大小
-	err = binary.Write(f.file, binary.BigEndian, f.header.MetadataOffset)
-	if err != nil {
-		logger.Error("写入元数据偏移失败", "error", err)
-		return err
-	}
-
-	err = binary.Write(f.file, binary.BigEndian, f.header.MetadataSize)
-	if err != nil {
-		logger.Error("写入元数据大小失败", "error", err)
-		return err
-	}
-
-	err = binary.Write(f.file, binary.BigEndian, f.header.BlockOffset)
-	if err != nil {
-		logger.Error("写入块偏移失败", "error", err)
-		return err
-	}
-
-	err = binary.Write(f.file, binary.BigEndian, f.header.BlockSize)
-	if err != nil {
-		logger.Error("写入块大小失败", "error", err)
-		return err
-	}
-
-	err = binary.Write(f.file, binary.BigEndian, f.header.IndexOffset)
-	if err != nil {
-		logger.Error("写入索引偏移失败", "error", err)
-		return err
-	}
-
-	err = binary.Write(f.file, binary.BigEndian, f.header.IndexSize)
-	if err != nil {
-		logger.Error("写入索引大小失败", "error", err)
-		return err
-	}
-
-	err = binary.Write(f.file, binary.BigEndian, f.header.TotalSize)
-	if err != nil {
-		logger.Error("写入总大小失败", "error", err)
-		return err
-	}
-
-	// 写入用户定义ID
-	_, err = f.file.Write(f.header.UserDefinedID[:])
-	if err != nil {
-		logger.Error("写入用户定义ID失败", "error", err)
-		return err
+		TotalSize:      HeaderSize, // 初始只有头部
 	}
-
-	// 写入校验和
-	_, err = f.file.Write(f.header.CheckSum[:])
-	if err != nil {
-		logger.Error("写入校验和失败", "error", err)
-		return err
-	}
-
-	return nil
 }
 
-func (f *FragmentaImpl) readHeader() error {
-	// 定位到文件开头
-	_, err := f.file.Seek(0, io.SeekStart)
-	if err != nil {
-		logger.Error("定位到文件开头失败", "error", err)
-		return err
-	}
-
-	// 读取魔数
-	err = binary.Read(f.file, binary.BigEndian, &f.header.Magic)
-	if err != nil {
-		logger.Error("读取魔数失败", "error", err)
-		return err
-	}
-
-	// 验证魔数
+func (f *FragmentaImpl) validateHeader() error {
 	if f.header.Magic != MagicNumber {
-		logger.Error("验证魔数失败", "error", err)
 		return ErrInvalidFragmenta
 	}
 
-	// 读取版本
-	err = binary.Read(f.file, binary.BigEndian, &f.header.Version)
-	if err != nil {
-		logger.Error("读取版本失败", "error", err)
-		return err
-	}
-
-	// 验证版本
-	if f.header.Version < MinSupportedVersion || f.header.Version > CurrentVersion {
-		logger.Error("验证版本失败", "error", err)
+	if f.header.Version > CurrentVersion {
 		return ErrUnsupportedVersion
 	}
 
-	// 读取标志
-	err = binary.Read(f.file, binary.BigEndian, &f.header.Flags)
-	if err != nil {
-		logger.Error("读取标志失败", "error", err)
-		return err
-	}
-
-	// 读取时间戳
-	err = binary.Read(f.file, binary.BigEndian, &f.header.Timestamp)
-	if err != nil {
-		logger.Error("读取时间戳失败", "error", err)
-		return err
-	}
-
-	// 读取最后修改时间
-	err = binary.Read(f.file, binary.BigEndian, &f.header.LastModified)
-	if err != nil {
-		logger.Error("读取最后修改时间失败", "error", err)
-		return err
-	}
-
-	// 读取存储模式
-	err = binary.Read(f.file, binary.BigEndian, &f.header.StorageMode)
-	if err != nil {
-		logger.Error("读取存储模式失败", "error", err)
-		return err
-	}
-
-	// 读取保留字段
-	err = binary.Read(f.file, binary.BigEndian, &f.header.Reserved1)
-	if err != nil {
-		logger.Error("读取保留字段失败", "error", err)
-		return err
-	}
-
-	err = binary.Read(f.file, binary.BigEndian, &f.header.Reserved2)
-	if err != nil {
-		logger.Error("读取保留字段失败", "error", err)
-		return err
-	}
-
-	// 读取各区域偏移和大小
-	err = binary.Read(f.file, binary.BigEndian, &f.header.MetadataOffset)
-	if err != nil {
-		logger.Error("读取元数据偏移失败", "error", err)
-		return err
-	}
-
-	err = binary.Read(f.file, binary.BigEndian, &f.header.MetadataSize)
-	if err != nil {
-		logger.Error("读取元数据大小失败", "error", err)
-		return err
-	}
-
-	err = binary.Read(f.file, binary.BigEndian, &f.header.BlockOffset)
-	if err != nil {
-		logger.Error("读取块偏移失败", "error", err)
-		return err
-	}
-
-	err = binary.Read(f.file, binary.BigEndian, &f.header.BlockSize)
-	if err != nil {
-		logger.Error("读取块大小失败", "error", err)
-		return err
-	}
-
-	err = binary.Read(f.file, binary.BigEndian, &f.header.IndexOffset)
-	if err != nil {
-		logger.Error("读取索引偏移失败", "error", err)
-		return err
-	}
-
-	err = binary.Read(f.file, binary.BigEndian, &f.header.IndexSize)
-	if err != nil {
-		logger.Error("读取索引大小失败", "error", err)
-		return err
-	}
-
-	err = binary.Read(f.file, binary.BigEndian, &f.header.TotalSize)
-	if err != nil {
-		logger.Error("读取总大小失败", "error", err)
-		return err
-	}
-
-	// 读取用户定义ID
-	_, err = f.file.Read(f.header.UserDefinedID[:])
-	if err != nil {
-		logger.Error("读取用户定义ID失败", "error", err)
-		return err
-	}
-
-	// 读取校验和
-	_, err = f.file.Read(f.header.CheckSum[:])
-	if err != nil {
-		logger.Error("读取校验和失败", "error", err)
-		return err
-	}
-
-	return nil
+	return f.validateFlags()
 }
 
-func (f *FragmentaImpl) validateHeader() error {
-	if f.header.Magic != MagicNumber {
-		return ErrInvalidFragmenta
-	}
-
-	if f.header.Version > CurrentVersion {
-		return ErrUnsupportedVersion
+// validateRegions 检查文件头中的各区域在文件范围内。
+// 区域的偏移和大小来自磁盘，超出文件末尾时按它们分配内存或读取都不安全
+func (f *FragmentaImpl) validateRegions(fileSize uint64) error {
+	for _, region := range []struct {
+		name         string
+		offset, size uint64
+	}{
+		{"元数据区", f.header.MetadataOffset, f.header.MetadataSize},
+		{"数据块区", f.header.BlockOffset, f.header.BlockSize},
+		{"索引区", f.header.IndexOffset, f.header.IndexSize},
+	} {
+		if region.size > 0 && (region.offset > fileSize || region.size > fileSize-region.offset) {
+			return fmt.Errorf("%w: %s超出文件末尾（偏移%d，大小%d，文件大小%d）",
+				ErrInvalidFragmenta, region.name, region.offset, region.size, fileSize)
+		}
 	}
 
 	return nil
@@ -631,9 +759,19 @@ func (f *FragmentaImpl) initializeComponents() error {
 	// 初始化块管理器
 	f.blockManager = NewBlockManager(f.file, &f.header)
 
+	// 确定性模式下元数据区和块头使用固定时间戳
+	if f.fixedTime != nil {
+		if mm, ok := f.metadataManager.(*metadataManagerImpl); ok {
+			mm.clock = f.now
+		}
+		if bm, ok := f.blockManager.(*blockManagerImpl); ok {
+			bm.clock = f.now
+		}
+	}
+
 	// 设置初始元数据
 	if f.isNew {
-		f.metadataManager.SetMetadata(TagCreateTime, EncodeInt64(time.Now().UnixNano()))
+		f.metadataManager.SetMetadata(TagCreateTime, EncodeInt64(f.now().UnixNano()))
 		f.metadataManager.SetMetadata(TagVersion, EncodeInt64(int64(CurrentVersion)))
 		f.metadataManager.SetMetadata(TagFragmentaType, []byte("FragDB"))
 	}
@@ -642,9 +780,24 @@ func (f *FragmentaImpl) initializeComponents() error {
 }
 
 // flushMetadata 刷新元数据
+// 块区从元数据区之后开始并向后增长，已有数据块时元数据区移到块区末尾，避免覆盖块数据
 func (f *FragmentaImpl) flushMetadata() error {
-	// 暂时只调用元数据管理器的刷新方法
-	return f.metadataManager.Flush()
+	if end := f.header.BlockOffset + f.header.BlockSize; f.header.BlockOffset > 0 && f.header.MetadataOffset != end {
+		f.header.MetadataOffset = end
+		// 元数据区移动后即使内容未变也要重写
+		if mm, ok := f.metadataManager.(*metadataManagerImpl); ok {
+			mm.markDirty()
+		}
+	}
+
+	if err := f.metadataManager.Flush(); err != nil {
+		return err
+	}
+
+	if end := f.header.MetadataOffset + f.header.MetadataSize; end > f.header.TotalSize {
+		f.header.TotalSize = end
+	}
+	return nil
 }
 
 // 工厂方法实现
@@ -659,6 +812,9 @@ func NewFragmenta(path string, options *FragmentaOptions) (Fragmenta, error) {
 			MaxIndexCacheSize: DefaultIndexCacheSize,
 		}
 	}
+	if options.Deterministic != nil && options.StorageMode != ContainerMode {
+		return nil, fmt.Errorf("%w: 确定性模式只支持容器模式", ErrInvalidArgument)
+	}
 
 	// 创建文件
 	file, err := os.Create(path)
@@ -672,19 +828,35 @@ func NewFragmenta(path string, options *FragmentaOptions) (Fragmenta, error) {
 		path:          path,
 		file:          file,
 		isNew:         true,
-		isDirty:       true,
 		isOpen:        true,
 		readOnly:      false,
 		metadataCache: make(map[uint16][]byte),
 		blockCache:    make(map[uint32][]byte),
 		lastModified:  time.Now(),
 	}
+	fragmenta.isDirty.Store(true)
+
+	if options.Deterministic != nil {
+		fixed := options.Deterministic.Timestamp
+		if fixed.IsZero() {
+			fixed = time.Unix(0, 0)
+		}
+		fragmenta.fixedTime = &fixed
+		fragmenta.lastModified = fixed
+	}
 
 	// 初始化头部
 	fragmenta.initializeHeader()
 
 	// 设置存储模式
 	fragmenta.header.StorageMode = options.StorageMode
+	if fragmenta.fixedTime != nil {
+		fragmenta.header.Flags |= FlagDeterministic
+	}
+	if options.ContentAddressed {
+		fragmenta.header.Flags |= FlagContentAddressed
+		fragmenta.contentAddressed = true
+	}
 
 	// 写入头部
 	err = fragmenta.writeHeader()
@@ -709,14 +881,35 @@ func NewFragmenta(path string, options *FragmentaOptions) (Fragmenta, error) {
 
 // NewFragmentaFromExisting 打开现有格式文件
 func NewFragmentaFromExisting(path string) (Fragmenta, error) {
-	// 打开文件
-	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	fragmenta, _, err := openExisting(path, &OpenOptions{})
 	if err != nil {
-		// 尝试以只读方式打开
+		return nil, err
+	}
+	return fragmenta, nil
+}
+
+// openExisting 按打开选项打开现有格式文件，版本较旧时按迁移选项升级
+func openExisting(path string, options *OpenOptions) (*FragmentaImpl, *MigrationReport, error) {
+	if options.Mmap && !options.ReadOnly {
+		return nil, nil, fmt.Errorf("%w: mmap只支持只读打开", ErrInvalidArgument)
+	}
+	migration := options.Migration
+	if migration == nil {
+		migration = DefaultMigrationOptions()
+	}
+
+	// 打开文件
+	var file *os.File
+	var err error
+	if !options.ReadOnly {
+		file, err = os.OpenFile(path, os.O_RDWR, 0)
+	}
+	if options.ReadOnly || err != nil {
+		// 以只读方式打开
 		file, err = os.Open(path)
 		if err != nil {
 			logger.Error("打开文件失败", "error", err)
-			return nil, err
+			return nil, nil, err
 		}
 	}
 
@@ -725,7 +918,6 @@ func NewFragmentaFromExisting(path string) (Fragmenta, error) {
 		path:          path,
 		file:          file,
 		isNew:         false,
-		isDirty:       false,
 		isOpen:        true,
 		readOnly:      false,
 		metadataCache: make(map[uint16][]byte),
@@ -737,7 +929,7 @@ func NewFragmentaFromExisting(path string) (Fragmenta, error) {
 	if err != nil {
 		file.Close()
 		logger.Error("读取头部失败", "error", err)
-		return nil, err
+		return nil, nil, err
 	}
 
 	// 验证头部
@@ -745,33 +937,87 @@ func NewFragmentaFromExisting(path string) (Fragmenta, error) {
 	if err != nil {
 		file.Close()
 		logger.Error("验证头部失败", "error", err)
-		return nil, err
+		return nil, nil, err
+	}
+	if fragmenta.header.Flags&FlagDeterministic != 0 {
+		fixed := time.Unix(0, fragmenta.header.Timestamp)
+		fragmenta.fixedTime = &fixed
 	}
+	fragmenta.contentAddressed = fragmenta.header.Flags&FlagContentAddressed != 0
 
 	// 检查是否只读
 	fileInfo, err := file.Stat()
 	if err != nil {
 		file.Close()
 		logger.Error("获取文件信息失败", "error", err)
-		return nil, err
+		return nil, nil, err
 	}
 
-	if fileInfo.Mode().Perm()&0200 == 0 {
+	if options.ReadOnly || fileInfo.Mode().Perm()&0200 == 0 {
 		fragmenta.readOnly = true
 	}
 
+	if err := fragmenta.validateRegions(uint64(fileInfo.Size())); err != nil {
+		file.Close()
+		logger.Error("验证文件头失败", "error", err)
+		return nil, nil, err
+	}
+
+	// 主文件头损坏时用恢复的副本重写
+	if fragmenta.headerRecovered && !fragmenta.readOnly {
+		if err := fragmenta.writeHeader(); err != nil {
+			file.Close()
+			logger.Error("修复文件头失败", "error", err)
+			return nil, nil, err
+		}
+	}
+
+	// 升级旧版本文件
+	report, err := fragmenta.migrate(migration)
+	if err != nil {
+		file.Close()
+		logger.Error("升级文件失败", "error", err)
+		return nil, nil, err
+	}
+
 	// 初始化组件
 	err = fragmenta.initializeComponents()
 	if err != nil {
 		file.Close()
 		logger.Error("初始化组件失败", "error", err)
-		return nil, err
+		return nil, nil, err
+	}
+
+	// 索引区可能被之后写入的块覆盖，打开时立即读入
+	if !options.NoIndexPreload {
+		if sections := fragmenta.loadIndexRegion(); sections != nil {
+			fragmenta.loadMerkleSection(sections[IndexSectionMerkle])
+		}
+	}
+
+	if err := fragmenta.applyOpenOptions(options, fileInfo.Size()); err != nil {
+		fragmenta.unmap()
+		file.Close()
+		logger.Error("应用打开选项失败", "error", err)
+		return nil, nil, err
+	}
+
+	// 目录模式下从块数据目录读写块数据；目录无法打开时格式文件中仍有完整的块数据
+	if fragmenta.header.StorageMode == DirectoryMode && !fragmenta.readOnly {
+		if err := fragmenta.attachBlockDirectory(); err != nil {
+			logger.Warn("打开块数据目录失败，直接读取格式文件", "error", err)
+		}
 	}
 
 	// 记录最后修改时间
 	fragmenta.lastModified = time.Unix(0, fragmenta.header.LastModified)
 
-	return fragmenta, nil
+	if report != nil && !report.DryRun {
+		fragmenta.metadataManager.SetMetadata(TagVersion, EncodeInt64(int64(fragmenta.header.Version)))
+		fragmenta.isDirty.Store(true)
+	}
+
+	return fragmenta, report, nil
 }
 
 // NewStorage 初始化存储
@@ -2,6 +2,8 @@ package fragmenta
 
 import (
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -162,3 +164,135 @@ func TestBatchMetadataOperation(t *testing.T) {
 		t.Fatalf("关闭文件失败: %v", err)
 	}
 }
+
+// 测试数据块在重新打开后仍可读取
+func TestBlocksPersistAcrossReopen(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "fragdb-test-*.bin")
+	if err != nil {
+		t.Fatalf("创建临时文件失败: %v", err)
+	}
+	tempFile.Close()
+
+	tempPath := tempFile.Name()
+	defer os.Remove(tempPath)
+
+	fragmenta, err := CreateFragmenta(tempPath, nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+
+	first, err := fragmenta.WriteBlock([]byte("first block"), &BlockOptions{Checksum: true})
+	if err != nil {
+		t.Fatalf("写入数据块失败: %v", err)
+	}
+	second, err := fragmenta.WriteBlock([]byte("second block"), &BlockOptions{AppendToBlockID: first})
+	if err != nil {
+		t.Fatalf("写入数据块失败: %v", err)
+	}
+	deleted, err := fragmenta.WriteBlock([]byte("deleted block"), nil)
+	if err != nil {
+		t.Fatalf("写入数据块失败: %v", err)
+	}
+	if err := fragmenta.DeleteBlock(deleted); err != nil {
+		t.Fatalf("删除数据块失败: %v", err)
+	}
+	if err := fragmenta.SetMetadata(TagTitle, []byte("块持久化")); err != nil {
+		t.Fatalf("设置元数据失败: %v", err)
+	}
+
+	// 关闭时自动提交
+	if err := fragmenta.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+
+	fragmenta, err = OpenFragmenta(tempPath)
+	if err != nil {
+		t.Fatalf("打开Fragmenta格式文件失败: %v", err)
+	}
+	defer fragmenta.Close()
+
+	if title, err := fragmenta.GetMetadata(TagTitle); err != nil || string(title) != "块持久化" {
+		t.Fatalf("元数据不匹配: %q, %v", title, err)
+	}
+
+	blocks, err := fragmenta.ListBlocks()
+	if err != nil {
+		t.Fatalf("列出数据块失败: %v", err)
+	}
+	if len(blocks) != 2 || blocks[0].BlockID != first || blocks[1].BlockID != second {
+		t.Fatalf("重新打开后的数据块列表不正确: %+v", blocks)
+	}
+	if blocks[0].Flags&BlockFlagChecksum == 0 || blocks[0].NextBlock != second || blocks[1].PreviousBlock != first {
+		t.Errorf("块头信息未持久化: %+v %+v", blocks[0], blocks[1])
+	}
+
+	if data, err := fragmenta.ReadBlock(second); err != nil || string(data) != "second block" {
+		t.Errorf("读取数据块不正确: %q, %v", data, err)
+	}
+	if data, err := fragmenta.ReadBlock(first); err != nil || string(data) != "first block" {
+		t.Errorf("读取数据块不正确: %q, %v", data, err)
+	}
+	if _, err := fragmenta.ReadBlock(deleted); err == nil {
+		t.Errorf("已删除的数据块不应可读")
+	}
+
+	// 新块的ID不能与已有块冲突
+	next, err := fragmenta.WriteBlock([]byte("after reopen"), nil)
+	if err != nil {
+		t.Fatalf("写入数据块失败: %v", err)
+	}
+	if next <= deleted {
+		t.Errorf("重新打开后分配的块ID应大于%d, 实际%d", deleted, next)
+	}
+}
+
+// TestConcurrentWriteDelete 测试多个协程同时写入、删除和提交（基准测试的并发工作协程即如此使用），用 -race 运行
+func TestConcurrentWriteDelete(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.frag")
+	f, err := CreateFragmenta(path, nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				id, err := f.WriteBlock(make([]byte, 64), nil)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if j%2 == 1 {
+					if err := f.DeleteBlock(id); err != nil {
+						errs <- err
+						return
+					}
+				}
+			}
+			errs <- f.Commit()
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("并发写入失败: %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+
+	f, err = OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer f.Close()
+	if blocks, err := f.ListBlocks(); err != nil || len(blocks) != 40 {
+		t.Errorf("重新打开后应有40个块，实际%d个: %v", len(blocks), err)
+	}
+}
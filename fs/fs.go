@@ -0,0 +1,108 @@
+// package fs 将FragDB命名空间挂载为本地文件系统
+//
+// 在Linux和macOS上通过FUSE挂载，在Windows上通过WinFsp挂载，文件内容的读写、
+// 截断和重命名都映射到fragmenta.Namespace，最终落在块层的块链上。
+//
+// Windows后端使用cgofuse访问WinFsp，需要安装WinFsp并以winfsp构建标签编译：
+//
+//	go build -tags winfsp
+//
+// 路径（反斜杠、盘符、保留名、大小写不敏感）和权限（只读/隐藏属性）的转换由
+// WindowsFileSystem完成；NewMemoryMounter提供不依赖驱动的进程内挂载，
+// 可以在任何平台的CI中验证这套转换逻辑。
+//
+// 不方便安装内核驱动时，NewWebDAVHandler通过HTTP提供同一个命名空间，
+// Finder和Windows资源管理器可以直接把它映射为网络驱动器。
+package fs
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/bpfs/fragmenta"
+)
+
+var (
+	// ErrUnsupportedPlatform 当前平台不支持挂载
+	ErrUnsupportedPlatform = errors.New("mounting is not supported on this platform")
+	// ErrAlreadyMounted 已经挂载
+	ErrAlreadyMounted = errors.New("file system already mounted")
+	// ErrNotMounted 尚未挂载
+	ErrNotMounted = errors.New("file system not mounted")
+	// ErrDriverUnavailable 文件系统驱动或其绑定不可用
+	ErrDriverUnavailable = errors.New("file system driver is not available")
+)
+
+// MountOptions 挂载选项
+type MountOptions struct {
+	// FSName 文件系统名称，显示在mount输出中
+	FSName string
+	// VolumeName 卷名称（macOS Finder中显示）
+	VolumeName string
+	// ReadOnly 以只读模式挂载
+	ReadOnly bool
+	// AllowOther 允许其他用户访问
+	AllowOther bool
+	// Debug 输出FUSE调试日志
+	Debug bool
+	// UID 新建文件和目录的默认所有者，为0时使用调用者
+	UID uint32
+	// GID 新建文件和目录的默认组，为0时使用调用者
+	GID uint32
+	// AttrTimeout 内核缓存属性和目录项的时长
+	AttrTimeout time.Duration
+	// SyncOnUnmount 卸载时将命名空间表同步到存储
+	SyncOnUnmount bool
+}
+
+// DefaultMountOptions 返回默认挂载选项
+func DefaultMountOptions() *MountOptions {
+	return &MountOptions{
+		FSName:        "fragmenta",
+		VolumeName:    "FragDB",
+		AttrTimeout:   time.Second,
+		SyncOnUnmount: true,
+	}
+}
+
+// Mounter 文件系统挂载器
+type Mounter interface {
+	// Mount 将命名空间挂载到挂载点，返回时文件系统已可访问
+	Mount(mountPoint string) error
+	// Unmount 卸载文件系统
+	Unmount() error
+	// Wait 阻塞直到文件系统被卸载
+	Wait()
+	// MountPoint 返回当前挂载点，未挂载时为空
+	MountPoint() string
+}
+
+// Mount 使用当前平台的挂载器挂载命名空间
+func Mount(mountPoint string, ns *fragmenta.Namespace, options *MountOptions) (Mounter, error) {
+	mounter, err := NewMounter(ns, options)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := mounter.Mount(mountPoint); err != nil {
+		return nil, err
+	}
+
+	return mounter, nil
+}
+
+// prepareMountPoint 确保挂载点目录存在
+func prepareMountPoint(mountPoint string) error {
+	info, err := os.Stat(mountPoint)
+	if os.IsNotExist(err) {
+		return os.MkdirAll(mountPoint, 0755)
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &os.PathError{Op: "mount", Path: mountPoint, Err: fragmenta.ErrNotDirectory}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package fs
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/bpfs/fragmenta"
+)
+
+// TestNamespaceRandomAccess 测试命名空间在内存后端上的随机读写和截断
+func TestNamespaceRandomAccess(t *testing.T) {
+	backend := NewMemoryBackend()
+	ns, err := fragmenta.NewNamespace(backend, 8)
+	if err != nil {
+		t.Fatalf("创建命名空间失败: %v", err)
+	}
+
+	if _, err := ns.CreateFile("/file", 0644); err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+
+	// 参照实现：普通的字节切片
+	var expected []byte
+	writeAt := func(data []byte, off int) {
+		t.Helper()
+		if n, err := ns.WriteAt("/file", data, int64(off)); err != nil || n != len(data) {
+			t.Fatalf("WriteAt(%d)失败: n=%d err=%v", off, n, err)
+		}
+		if end := off + len(data); end > len(expected) {
+			expected = append(expected, make([]byte, end-len(expected))...)
+		}
+		copy(expected[off:], data)
+	}
+	truncate := func(size int) {
+		t.Helper()
+		if err := ns.Truncate("/file", int64(size)); err != nil {
+			t.Fatalf("Truncate(%d)失败: %v", size, err)
+		}
+		if size > len(expected) {
+			expected = append(expected, make([]byte, size-len(expected))...)
+		}
+		expected = expected[:size]
+	}
+	verify := func(step string) {
+		t.Helper()
+		data, err := ns.ReadFile("/file")
+		if err != nil || !bytes.Equal(data, expected) {
+			t.Fatalf("%s后内容不正确:\n实际 %q\n期望 %q (err=%v)", step, data, expected, err)
+		}
+		inode, _ := ns.Lookup("/file")
+		if want := (len(expected) + 7) / 8; len(inode.Blocks) != want {
+			t.Fatalf("%s后块链长度不正确: 期望%d, 实际%d", step, want, len(inode.Blocks))
+		}
+	}
+
+	writeAt([]byte("hello world"), 0)
+	verify("顺序写入")
+	writeAt([]byte("XY"), 7)
+	verify("块边界处覆盖")
+	writeAt([]byte("tail"), 30)
+	verify("带空洞扩展")
+	truncate(13)
+	verify("截断到块中间")
+	truncate(16)
+	verify("截断到块边界")
+	truncate(21)
+	verify("以零扩展")
+	truncate(0)
+	verify("截断为空")
+	writeAt([]byte("again"), 3)
+	verify("空文件写入")
+
+	// 旧块都已释放：仅剩文件块
+	inode, _ := ns.Lookup("/file")
+	if backend.BlockCount() != len(inode.Blocks) {
+		t.Errorf("存在泄漏的块: 后端%d个, 文件%d个", backend.BlockCount(), len(inode.Blocks))
+	}
+
+	buf := make([]byte, 4)
+	if n, err := ns.ReadAt("/file", buf, 6); err != io.EOF || n != 2 || string(buf[:n]) != "in" {
+		t.Errorf("跨越文件末尾的读取不正确: n=%d err=%v data=%q", n, err, buf[:n])
+	}
+	if n, err := ns.ReadAt("/file", buf, 100); err != io.EOF || n != 0 {
+		t.Errorf("超出文件末尾的读取应返回io.EOF: n=%d err=%v", n, err)
+	}
+
+	// 重新加载后使用表中记录的块大小
+	if err := ns.Sync(); err != nil {
+		t.Fatalf("同步命名空间失败: %v", err)
+	}
+	loaded, err := fragmenta.NewNamespace(backend, 4096)
+	if err != nil {
+		t.Fatalf("加载命名空间失败: %v", err)
+	}
+	if n, err := loaded.WriteAt("/file", []byte("!"), 9); err != nil || n != 1 {
+		t.Fatalf("加载后写入失败: %v", err)
+	}
+	if data, _ := loaded.ReadFile("/file"); string(data) != "\x00\x00\x00again\x00!" {
+		t.Errorf("加载后内容不正确: %q", data)
+	}
+}
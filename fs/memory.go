@@ -0,0 +1,105 @@
+package fs
+
+import (
+	"sync"
+
+	"github.com/bpfs/fragmenta"
+)
+
+// MemoryBackend 内存中的命名空间存储后端
+// 实现fragmenta.NamespaceBackend，用于测试和不需要持久化的临时挂载
+type MemoryBackend struct {
+	blocks   map[uint32][]byte
+	links    map[uint32]uint32
+	metadata map[uint16][]byte
+	nextID   uint32
+	mutex    sync.RWMutex
+}
+
+// NewMemoryBackend 创建内存存储后端
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{
+		blocks:   make(map[uint32][]byte),
+		links:    make(map[uint32]uint32),
+		metadata: make(map[uint16][]byte),
+	}
+}
+
+// WriteBlock 写入数据块
+func (m *MemoryBackend) WriteBlock(data []byte, options *fragmenta.BlockOptions) (uint32, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.nextID++
+	m.blocks[m.nextID] = append([]byte(nil), data...)
+	return m.nextID, nil
+}
+
+// ReadBlock 读取数据块
+func (m *MemoryBackend) ReadBlock(blockID uint32) ([]byte, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	data, ok := m.blocks[blockID]
+	if !ok {
+		return nil, fragmenta.ErrBlockNotFound
+	}
+	return data, nil
+}
+
+// DeleteBlock 删除数据块
+func (m *MemoryBackend) DeleteBlock(blockID uint32) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.blocks[blockID]; !ok {
+		return fragmenta.ErrBlockNotFound
+	}
+	delete(m.blocks, blockID)
+	delete(m.links, blockID)
+	return nil
+}
+
+// LinkBlocks 链接两个数据块
+func (m *MemoryBackend) LinkBlocks(sourceID, targetID uint32) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, ok := m.blocks[sourceID]; !ok {
+		return fragmenta.ErrBlockNotFound
+	}
+	if _, ok := m.blocks[targetID]; !ok {
+		return fragmenta.ErrBlockNotFound
+	}
+	m.links[sourceID] = targetID
+	return nil
+}
+
+// SetMetadata 设置元数据
+func (m *MemoryBackend) SetMetadata(tag uint16, value []byte) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.metadata[tag] = append([]byte(nil), value...)
+	return nil
+}
+
+// GetMetadata 获取元数据
+func (m *MemoryBackend) GetMetadata(tag uint16) ([]byte, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	value, ok := m.metadata[tag]
+	if !ok {
+		return nil, fragmenta.ErrMetadataNotFound
+	}
+	return value, nil
+}
+
+// BlockCount 返回当前保存的块数量
+func (m *MemoryBackend) BlockCount() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	return len(m.blocks)
+}
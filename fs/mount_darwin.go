@@ -0,0 +1,12 @@
+package fs
+
+// platformMountOptions 返回macFUSE特有的挂载参数
+func platformMountOptions(options *MountOptions) []string {
+	var result []string
+	if options.VolumeName != "" {
+		result = append(result, "volname="+options.VolumeName)
+	}
+	// 避免Finder在挂载点中创建._*和.DS_Store文件
+	result = append(result, "noappledouble", "noapplexattr")
+	return result
+}
@@ -0,0 +1,128 @@
+//go:build linux || darwin
+
+package fs
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+
+	"github.com/bpfs/fragmenta"
+	gofs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// fuseMounter 基于FUSE的挂载器
+type fuseMounter struct {
+	fsys       *fileSystem
+	server     *fuse.Server
+	mountPoint string
+	mutex      sync.Mutex
+}
+
+// NewMounter 创建当前平台的挂载器，options为nil时使用默认选项
+func NewMounter(ns *fragmenta.Namespace, options *MountOptions) (Mounter, error) {
+	if ns == nil {
+		return nil, fmt.Errorf("%w: 命名空间不能为空", fragmenta.ErrInvalidArgument)
+	}
+	if options == nil {
+		options = DefaultMountOptions()
+	}
+
+	return &fuseMounter{
+		fsys: &fileSystem{ns: ns, options: options},
+	}, nil
+}
+
+// Mount 挂载文件系统
+func (m *fuseMounter) Mount(mountPoint string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.server != nil {
+		return ErrAlreadyMounted
+	}
+
+	absPath, err := filepath.Abs(mountPoint)
+	if err != nil {
+		return fmt.Errorf("获取挂载点绝对路径失败: %w", err)
+	}
+	if err := prepareMountPoint(absPath); err != nil {
+		return fmt.Errorf("准备挂载点失败: %w", err)
+	}
+
+	options := m.fsys.options
+	timeout := options.AttrTimeout
+	mountOptions := fuse.MountOptions{
+		FsName:     options.FSName,
+		Name:       "fragmenta",
+		AllowOther: options.AllowOther,
+		Debug:      options.Debug,
+		// 以root运行时直接调用mount(2)，失败时回退到fusermount
+		DirectMount: true,
+	}
+	if options.ReadOnly {
+		mountOptions.Options = append(mountOptions.Options, "ro")
+	}
+	mountOptions.Options = append(mountOptions.Options, platformMountOptions(options)...)
+
+	server, err := gofs.Mount(absPath, &node{fsys: m.fsys}, &gofs.Options{
+		MountOptions: mountOptions,
+		AttrTimeout:  &timeout,
+		EntryTimeout: &timeout,
+		UID:          options.UID,
+		GID:          options.GID,
+	})
+	if err != nil {
+		return fmt.Errorf("挂载FUSE文件系统失败: %w", err)
+	}
+
+	m.server = server
+	m.mountPoint = absPath
+	logger.Info("已挂载FragDB文件系统", "mountPoint", absPath)
+	return nil
+}
+
+// Unmount 卸载文件系统
+func (m *fuseMounter) Unmount() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.server == nil {
+		return ErrNotMounted
+	}
+
+	if err := m.server.Unmount(); err != nil {
+		return fmt.Errorf("卸载FUSE文件系统失败: %w", err)
+	}
+	logger.Info("已卸载FragDB文件系统", "mountPoint", m.mountPoint)
+
+	m.server = nil
+	m.mountPoint = ""
+
+	if m.fsys.options.SyncOnUnmount && !m.fsys.options.ReadOnly {
+		if err := m.fsys.ns.Sync(); err != nil {
+			return fmt.Errorf("同步命名空间失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// Wait 阻塞直到文件系统被卸载
+func (m *fuseMounter) Wait() {
+	m.mutex.Lock()
+	server := m.server
+	m.mutex.Unlock()
+
+	if server != nil {
+		server.Wait()
+	}
+}
+
+// MountPoint 返回当前挂载点
+func (m *fuseMounter) MountPoint() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.mountPoint
+}
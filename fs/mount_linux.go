@@ -0,0 +1,6 @@
+package fs
+
+// platformMountOptions 返回Linux特有的挂载参数
+func platformMountOptions(options *MountOptions) []string {
+	return nil
+}
@@ -0,0 +1,128 @@
+package fs
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bpfs/fragmenta"
+)
+
+// mountTestNamespace 将内存命名空间挂载到临时目录，环境不支持FUSE时跳过测试
+func mountTestNamespace(t *testing.T, options *MountOptions) (*fragmenta.Namespace, string) {
+	t.Helper()
+
+	if _, err := os.Stat("/dev/fuse"); err != nil {
+		t.Skip("当前环境没有/dev/fuse")
+	}
+
+	ns, err := fragmenta.NewNamespace(NewMemoryBackend(), 16)
+	if err != nil {
+		t.Fatalf("创建命名空间失败: %v", err)
+	}
+
+	mountPoint, err := os.MkdirTemp("", "fragmenta-fs-test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(mountPoint) })
+
+	mounter, err := Mount(mountPoint, ns, options)
+	if err != nil {
+		t.Skipf("当前环境无法挂载FUSE: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mounter.Unmount(); err != nil {
+			t.Errorf("卸载失败: %v", err)
+		}
+	})
+
+	return ns, mountPoint
+}
+
+// TestMountReadWrite 测试通过挂载点进行文件读写、截断、重命名和目录操作
+func TestMountReadWrite(t *testing.T) {
+	ns, mnt := mountTestNamespace(t, nil)
+
+	if err := os.MkdirAll(filepath.Join(mnt, "docs", "2024"), 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+
+	content := bytes.Repeat([]byte("0123456789"), 10)
+	file := filepath.Join(mnt, "docs", "2024", "report.txt")
+	if err := os.WriteFile(file, content, 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+
+	// 内容应落在命名空间的块链上
+	inode, err := ns.Lookup("/docs/2024/report.txt")
+	if err != nil || inode.Size != int64(len(content)) || len(inode.Blocks) != 7 {
+		t.Fatalf("命名空间中的文件不正确: %+v, %v", inode, err)
+	}
+
+	// 随机写入
+	f, err := os.OpenFile(file, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	if _, err := f.WriteAt([]byte("ABCDE"), 14); err != nil {
+		t.Fatalf("随机写入失败: %v", err)
+	}
+	copy(content[14:], "ABCDE")
+	if err := f.Truncate(50); err != nil {
+		t.Fatalf("截断失败: %v", err)
+	}
+	content = content[:50]
+	if err := f.Sync(); err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	f.Close()
+
+	data, err := os.ReadFile(file)
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("读取内容不正确: %q, %v", data, err)
+	}
+
+	// 重命名和目录列表
+	renamed := filepath.Join(mnt, "docs", "summary.txt")
+	if err := os.Rename(file, renamed); err != nil {
+		t.Fatalf("重命名失败: %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Join(mnt, "docs"))
+	if err != nil {
+		t.Fatalf("列出目录失败: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name() != "2024" || !entries[0].IsDir() || entries[1].Name() != "summary.txt" {
+		t.Errorf("目录内容不正确: %v", entries)
+	}
+	info, err := os.Stat(renamed)
+	if err != nil || info.Size() != 50 || info.Mode().Perm() != 0644 {
+		t.Errorf("文件属性不正确: %v, %v", info, err)
+	}
+
+	// 删除
+	if err := os.Remove(filepath.Join(mnt, "docs")); err == nil {
+		t.Errorf("删除非空目录应失败")
+	}
+	if err := os.Remove(renamed); err != nil {
+		t.Fatalf("删除文件失败: %v", err)
+	}
+	if err := os.Remove(filepath.Join(mnt, "docs", "2024")); err != nil {
+		t.Fatalf("删除目录失败: %v", err)
+	}
+	if _, err := ns.Lookup("/docs/2024"); err == nil {
+		t.Errorf("删除后命名空间中不应存在该目录")
+	}
+}
+
+// TestMountReadOnly 测试只读挂载
+func TestMountReadOnly(t *testing.T) {
+	options := DefaultMountOptions()
+	options.ReadOnly = true
+	_, mnt := mountTestNamespace(t, options)
+
+	if err := os.WriteFile(filepath.Join(mnt, "file"), []byte("x"), 0644); err == nil {
+		t.Errorf("只读挂载时写入应失败")
+	}
+}
@@ -0,0 +1,109 @@
+package fs
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/bpfs/fragmenta"
+)
+
+// MemoryMounter 不依赖内核驱动的挂载器
+// Mount只记录挂载点，文件操作通过FileSystem()在进程内执行，与WinFsp后端共用
+// 同一套路径和权限转换逻辑。用于测试以及没有安装FUSE/WinFsp的CI环境
+type MemoryMounter struct {
+	fsys       *WindowsFileSystem
+	ns         *fragmenta.Namespace
+	options    *MountOptions
+	mountPoint string
+	done       chan struct{}
+	mutex      sync.Mutex
+}
+
+var _ Mounter = (*MemoryMounter)(nil)
+
+// NewMemoryMounter 创建进程内挂载器，options为nil时使用默认选项
+func NewMemoryMounter(ns *fragmenta.Namespace, options *MountOptions) (*MemoryMounter, error) {
+	if ns == nil {
+		return nil, fmt.Errorf("%w: 命名空间不能为空", fragmenta.ErrInvalidArgument)
+	}
+	if options == nil {
+		options = DefaultMountOptions()
+	}
+
+	return &MemoryMounter{
+		fsys:    NewWindowsFileSystem(ns, options),
+		ns:      ns,
+		options: options,
+	}, nil
+}
+
+// Mount 记录挂载点，挂载点使用与WinFsp相同的规则校验
+func (m *MemoryMounter) Mount(mountPoint string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.done != nil {
+		return ErrAlreadyMounted
+	}
+
+	normalized, err := normalizeWindowsMountPoint(mountPoint)
+	if err != nil {
+		return err
+	}
+
+	m.mountPoint = normalized
+	m.done = make(chan struct{})
+	logger.Info("内存挂载完成", "mountPoint", normalized)
+	return nil
+}
+
+// Unmount 卸载，根据选项同步命名空间表
+func (m *MemoryMounter) Unmount() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.done == nil {
+		return ErrNotMounted
+	}
+
+	if m.options.SyncOnUnmount && !m.options.ReadOnly {
+		if err := m.ns.Sync(); err != nil {
+			return fmt.Errorf("卸载前同步命名空间失败: %w", err)
+		}
+	}
+
+	close(m.done)
+	m.done = nil
+	m.mountPoint = ""
+	return nil
+}
+
+// Wait 阻塞直到卸载
+func (m *MemoryMounter) Wait() {
+	m.mutex.Lock()
+	done := m.done
+	m.mutex.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// MountPoint 返回当前挂载点
+func (m *MemoryMounter) MountPoint() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.mountPoint
+}
+
+// FileSystem 返回挂载的文件系统，未挂载时返回ErrNotMounted
+func (m *MemoryMounter) FileSystem() (*WindowsFileSystem, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.done == nil {
+		return nil, ErrNotMounted
+	}
+	return m.fsys, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !windows
+
+package fs
+
+import "github.com/bpfs/fragmenta"
+
+// NewMounter 当前平台不支持挂载，返回ErrUnsupportedPlatform
+func NewMounter(ns *fragmenta.Namespace, options *MountOptions) (Mounter, error) {
+	return nil, ErrUnsupportedPlatform
+}
@@ -0,0 +1,171 @@
+//go:build windows
+
+package fs
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/bpfs/fragmenta"
+)
+
+// winfspHost WinFsp绑定，启用winfsp构建标签时由cgofuse实现
+type winfspHost interface {
+	// serve 挂载并处理请求直到卸载，文件系统可访问时关闭ready
+	serve(mountPoint string, args []string, ready chan<- struct{})
+	// unmount 请求卸载
+	unmount() bool
+}
+
+// winfspMounter 基于WinFsp的挂载器
+type winfspMounter struct {
+	fsys       *WindowsFileSystem
+	ns         *fragmenta.Namespace
+	options    *MountOptions
+	host       winfspHost
+	mountPoint string
+	done       chan struct{}
+	mutex      sync.Mutex
+}
+
+// NewMounter 创建当前平台的挂载器，options为nil时使用默认选项
+func NewMounter(ns *fragmenta.Namespace, options *MountOptions) (Mounter, error) {
+	if ns == nil {
+		return nil, fmt.Errorf("%w: 命名空间不能为空", fragmenta.ErrInvalidArgument)
+	}
+	if options == nil {
+		options = DefaultMountOptions()
+	}
+
+	fsys := NewWindowsFileSystem(ns, options)
+	host, err := newWinFspHost(fsys, ns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &winfspMounter{
+		fsys:    fsys,
+		ns:      ns,
+		options: options,
+		host:    host,
+	}, nil
+}
+
+// Mount 挂载文件系统，挂载点可以是盘符（如"X:"）、"*"或不存在的目录
+func (m *winfspMounter) Mount(mountPoint string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.done != nil {
+		return ErrAlreadyMounted
+	}
+
+	normalized, err := normalizeWindowsMountPoint(mountPoint)
+	if err != nil {
+		return err
+	}
+	if len(normalized) > 2 {
+		// WinFsp要求目录挂载点不存在，由它自己创建重解析点
+		if normalized, err = filepath.Abs(normalized); err != nil {
+			return fmt.Errorf("获取挂载点绝对路径失败: %w", err)
+		}
+		if _, err := os.Stat(normalized); err == nil {
+			return fmt.Errorf("%w: 目录挂载点%s必须不存在", fragmenta.ErrPathExists, normalized)
+		}
+	}
+
+	ready := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		m.host.serve(normalized, winfspArgs(m.options), ready)
+	}()
+
+	// serve在文件系统就绪前返回说明挂载失败
+	select {
+	case <-ready:
+	case <-done:
+		return fmt.Errorf("%w: WinFsp挂载%s失败", ErrDriverUnavailable, normalized)
+	}
+
+	m.mountPoint = normalized
+	m.done = done
+	logger.Info("WinFsp挂载完成", "mountPoint", normalized)
+	return nil
+}
+
+// Unmount 卸载文件系统，根据选项同步命名空间表
+func (m *winfspMounter) Unmount() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.done == nil {
+		return ErrNotMounted
+	}
+
+	if !m.host.unmount() {
+		return fmt.Errorf("卸载%s失败", m.mountPoint)
+	}
+	<-m.done
+
+	if m.options.SyncOnUnmount && !m.options.ReadOnly {
+		if err := m.ns.Sync(); err != nil {
+			return fmt.Errorf("卸载后同步命名空间失败: %w", err)
+		}
+	}
+
+	logger.Info("WinFsp卸载完成", "mountPoint", m.mountPoint)
+	m.done = nil
+	m.mountPoint = ""
+	return nil
+}
+
+// Wait 阻塞直到文件系统被卸载
+func (m *winfspMounter) Wait() {
+	m.mutex.Lock()
+	done := m.done
+	m.mutex.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+// MountPoint 返回当前挂载点
+func (m *winfspMounter) MountPoint() string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.mountPoint
+}
+
+// winfspArgs 将挂载选项转换为WinFsp-FUSE命令行参数
+// uid/gid为-1时WinFsp将文件所有者映射为当前用户，权限位据此转换为安全描述符
+func winfspArgs(options *MountOptions) []string {
+	uid, gid := "-1", "-1"
+	if options.UID != 0 {
+		uid = strconv.FormatUint(uint64(options.UID), 10)
+	}
+	if options.GID != 0 {
+		gid = strconv.FormatUint(uint64(options.GID), 10)
+	}
+
+	args := []string{
+		"-o", "uid=" + uid + ",gid=" + gid,
+		"-o", "FileSystemName=" + options.FSName,
+		"-o", "FileInfoTimeout=" + strconv.FormatInt(options.AttrTimeout.Milliseconds(), 10),
+	}
+	if options.VolumeName != "" {
+		args = append(args, "-o", "volname="+options.VolumeName)
+	}
+	if options.ReadOnly {
+		args = append(args, "-o", "ro")
+	}
+	if options.Debug {
+		args = append(args, "-d")
+	}
+	return args
+}
@@ -0,0 +1,280 @@
+//go:build windows && winfsp
+
+package fs
+
+import (
+	"errors"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/bpfs/fragmenta"
+	"github.com/winfsp/cgofuse/fuse"
+)
+
+// winfspFileSystem 将WinFsp-FUSE回调转发到WindowsFileSystem
+// 文件内容不使用句柄，所有操作按路径进行
+type winfspFileSystem struct {
+	fuse.FileSystemBase
+	fsys  *WindowsFileSystem
+	ns    *fragmenta.Namespace
+	host  *fuse.FileSystemHost
+	ready chan<- struct{}
+	once  sync.Once
+}
+
+// newWinFspHost 创建基于cgofuse的WinFsp绑定
+func newWinFspHost(fsys *WindowsFileSystem, ns *fragmenta.Namespace) (winfspHost, error) {
+	w := &winfspFileSystem{fsys: fsys, ns: ns}
+	w.host = fuse.NewFileSystemHost(w)
+	w.host.SetCapCaseInsensitive(true)
+	return w, nil
+}
+
+// serve 挂载并处理请求直到卸载
+func (w *winfspFileSystem) serve(mountPoint string, args []string, ready chan<- struct{}) {
+	w.ready = ready
+	w.host.Mount(mountPoint, args)
+}
+
+// unmount 请求卸载
+func (w *winfspFileSystem) unmount() bool {
+	return w.host.Unmount()
+}
+
+// Init 文件系统就绪
+func (w *winfspFileSystem) Init() {
+	w.once.Do(func() { close(w.ready) })
+}
+
+// Statfs 返回卷信息，容量由底层存储决定，这里报告固定的块大小和名称长度
+func (w *winfspFileSystem) Statfs(path string, stat *fuse.Statfs_t) int {
+	stat.Bsize = 4096
+	stat.Frsize = 4096
+	stat.Blocks = 1 << 30
+	stat.Bfree = 1 << 30
+	stat.Bavail = 1 << 30
+	stat.Namemax = fragmenta.MaxNameLength
+	return 0
+}
+
+// Getattr 获取属性，Windows文件属性通过Flags传递
+func (w *winfspFileSystem) Getattr(path string, stat *fuse.Stat_t, fh uint64) int {
+	p, err := w.fsys.Resolve(path)
+	if err != nil {
+		return winfspErrno(err)
+	}
+	inode, err := w.ns.Lookup(p)
+	if err != nil {
+		return winfspErrno(err)
+	}
+
+	stat.Ino = uint64(inode.ID)
+	stat.Mode = fuse.S_IFREG | uint32(inode.Mode.Perm())
+	stat.Nlink = 1
+	if inode.IsDir() {
+		stat.Mode = fuse.S_IFDIR | uint32(inode.Mode.Perm())
+		stat.Nlink = 2
+	}
+	stat.Uid = inode.UID
+	stat.Gid = inode.GID
+	stat.Size = inode.Size
+	stat.Blksize = 4096
+	stat.Blocks = (inode.Size + 511) / 512
+	stat.Atim = fuse.Timespec{Sec: inode.AccessedAt / 1e9, Nsec: inode.AccessedAt % 1e9}
+	stat.Mtim = fuse.Timespec{Sec: inode.ModifiedAt / 1e9, Nsec: inode.ModifiedAt % 1e9}
+	stat.Ctim = stat.Mtim
+	stat.Birthtim = fuse.Timespec{Sec: inode.CreatedAt / 1e9, Nsec: inode.CreatedAt % 1e9}
+	stat.Flags = attributesToFlags(modeToAttributes(inode))
+	return 0
+}
+
+// Chflags 修改Windows文件属性
+func (w *winfspFileSystem) Chflags(path string, flags uint32) int {
+	return winfspErrno(w.fsys.SetBasicInfo(path, flagsToAttributes(flags), 0, 0))
+}
+
+// Chmod 修改权限
+func (w *winfspFileSystem) Chmod(path string, mode uint32) int {
+	if w.fsys.options.ReadOnly {
+		return -fuse.EROFS
+	}
+	p, err := w.fsys.Resolve(path)
+	if err != nil {
+		return winfspErrno(err)
+	}
+	return winfspErrno(w.ns.Chmod(p, os.FileMode(mode).Perm()))
+}
+
+// Chown 修改所有者
+func (w *winfspFileSystem) Chown(path string, uid uint32, gid uint32) int {
+	if w.fsys.options.ReadOnly {
+		return -fuse.EROFS
+	}
+	p, err := w.fsys.Resolve(path)
+	if err != nil {
+		return winfspErrno(err)
+	}
+	return winfspErrno(w.ns.Chown(p, uid, gid))
+}
+
+// Utimens 修改访问和修改时间
+func (w *winfspFileSystem) Utimens(path string, tmsp []fuse.Timespec) int {
+	if w.fsys.options.ReadOnly {
+		return -fuse.EROFS
+	}
+	if len(tmsp) < 2 {
+		return -fuse.EINVAL
+	}
+	p, err := w.fsys.Resolve(path)
+	if err != nil {
+		return winfspErrno(err)
+	}
+	return winfspErrno(w.ns.Chtimes(p, tmsp[0].Time(), tmsp[1].Time()))
+}
+
+// Mkdir 创建目录
+func (w *winfspFileSystem) Mkdir(path string, mode uint32) int {
+	if _, err := w.fsys.Create(path, true, 0); err != nil {
+		return winfspErrno(err)
+	}
+	return w.Chmod(path, mode)
+}
+
+// Create 创建文件
+func (w *winfspFileSystem) Create(path string, flags int, mode uint32) (int, uint64) {
+	if _, err := w.fsys.Create(path, false, 0); err != nil {
+		return winfspErrno(err), ^uint64(0)
+	}
+	return w.Chmod(path, mode), 0
+}
+
+// Open 打开文件
+func (w *winfspFileSystem) Open(path string, flags int) (int, uint64) {
+	if _, err := w.fsys.Resolve(path); err != nil {
+		return winfspErrno(err), ^uint64(0)
+	}
+	return 0, 0
+}
+
+// Opendir 打开目录
+func (w *winfspFileSystem) Opendir(path string) (int, uint64) {
+	return w.Open(path, 0)
+}
+
+// Read 读取文件内容
+func (w *winfspFileSystem) Read(path string, buff []byte, ofst int64, fh uint64) int {
+	count, err := w.fsys.Read(path, buff, ofst)
+	if err != nil && err != io.EOF {
+		return winfspErrno(err)
+	}
+	return count
+}
+
+// Write 写入文件内容
+func (w *winfspFileSystem) Write(path string, buff []byte, ofst int64, fh uint64) int {
+	count, err := w.fsys.Write(path, buff, ofst, false)
+	if err != nil {
+		return winfspErrno(err)
+	}
+	return count
+}
+
+// Truncate 修改文件大小
+func (w *winfspFileSystem) Truncate(path string, size int64, fh uint64) int {
+	return winfspErrno(w.fsys.SetFileSize(path, size))
+}
+
+// Unlink 删除文件
+func (w *winfspFileSystem) Unlink(path string) int {
+	return winfspErrno(w.fsys.Delete(path))
+}
+
+// Rmdir 删除目录
+func (w *winfspFileSystem) Rmdir(path string) int {
+	return winfspErrno(w.fsys.Delete(path))
+}
+
+// Rename 重命名，FUSE语义下总是替换已存在的目标
+func (w *winfspFileSystem) Rename(oldpath string, newpath string) int {
+	return winfspErrno(w.fsys.Rename(oldpath, newpath, true))
+}
+
+// Readdir 列出目录
+func (w *winfspFileSystem) Readdir(path string, fill func(name string, stat *fuse.Stat_t, ofst int64) bool, ofst int64, fh uint64) int {
+	entries, err := w.fsys.ReadDirectory(path, "*")
+	if err != nil {
+		return winfspErrno(err)
+	}
+
+	fill(".", nil, 0)
+	fill("..", nil, 0)
+	for _, entry := range entries {
+		if !fill(entry.Name, nil, 0) {
+			break
+		}
+	}
+	return 0
+}
+
+// Fsync 将命名空间表同步到存储
+func (w *winfspFileSystem) Fsync(path string, datasync bool, fh uint64) int {
+	if w.fsys.options.ReadOnly {
+		return 0
+	}
+	return winfspErrno(w.ns.Sync())
+}
+
+// attributesToFlags 将Windows文件属性转换为WinFsp-FUSE的UF_*标志
+func attributesToFlags(attributes uint32) uint32 {
+	var flags uint32
+	if attributes&FileAttributeReadonly != 0 {
+		flags |= fuse.UF_READONLY
+	}
+	if attributes&FileAttributeHidden != 0 {
+		flags |= fuse.UF_HIDDEN
+	}
+	if attributes&FileAttributeSystem != 0 {
+		flags |= fuse.UF_SYSTEM
+	}
+	if attributes&FileAttributeArchive != 0 {
+		flags |= fuse.UF_ARCHIVE
+	}
+	return flags
+}
+
+// flagsToAttributes 将UF_*标志转换为Windows文件属性，没有任何属性时使用FILE_ATTRIBUTE_NORMAL
+func flagsToAttributes(flags uint32) uint32 {
+	attributes := FileAttributeNormal
+	if flags&fuse.UF_READONLY != 0 {
+		attributes = FileAttributeReadonly
+	}
+	return attributes
+}
+
+// winfspErrno 将命名空间错误转换为FUSE错误码
+func winfspErrno(err error) int {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, fragmenta.ErrPathNotFound):
+		return -fuse.ENOENT
+	case errors.Is(err, fragmenta.ErrPathExists):
+		return -fuse.EEXIST
+	case errors.Is(err, fragmenta.ErrNotDirectory):
+		return -fuse.ENOTDIR
+	case errors.Is(err, fragmenta.ErrIsDirectory):
+		return -fuse.EISDIR
+	case errors.Is(err, fragmenta.ErrDirectoryNotEmpty):
+		return -fuse.ENOTEMPTY
+	case errors.Is(err, fragmenta.ErrInvalidPath), errors.Is(err, fragmenta.ErrInvalidArgument):
+		return -fuse.EINVAL
+	case errors.Is(err, fragmenta.ErrReadOnly):
+		return -fuse.EROFS
+	case errors.Is(err, ErrAccessDenied):
+		return -fuse.EACCES
+	default:
+		logger.Error("文件系统操作失败", "error", err)
+		return -fuse.EIO
+	}
+}
@@ -0,0 +1,14 @@
+//go:build windows && !winfsp
+
+package fs
+
+import (
+	"fmt"
+
+	"github.com/bpfs/fragmenta"
+)
+
+// newWinFspHost 未启用winfsp构建标签时没有WinFsp绑定
+func newWinFspHost(fsys *WindowsFileSystem, ns *fragmenta.Namespace) (winfspHost, error) {
+	return nil, fmt.Errorf("%w: 需要安装WinFsp并以-tags winfsp编译", ErrDriverUnavailable)
+}
@@ -0,0 +1,342 @@
+//go:build linux || darwin
+
+package fs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/bpfs/fragmenta"
+	gofs "github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// fileSystem 挂载实例共享的状态
+type fileSystem struct {
+	ns      *fragmenta.Namespace
+	options *MountOptions
+}
+
+// node FUSE节点，通过节点在树中的路径访问命名空间
+type node struct {
+	gofs.Inode
+	fsys *fileSystem
+}
+
+var (
+	_ = (gofs.NodeLookuper)((*node)(nil))
+	_ = (gofs.NodeGetattrer)((*node)(nil))
+	_ = (gofs.NodeSetattrer)((*node)(nil))
+	_ = (gofs.NodeReaddirer)((*node)(nil))
+	_ = (gofs.NodeMkdirer)((*node)(nil))
+	_ = (gofs.NodeCreater)((*node)(nil))
+	_ = (gofs.NodeUnlinker)((*node)(nil))
+	_ = (gofs.NodeRmdirer)((*node)(nil))
+	_ = (gofs.NodeRenamer)((*node)(nil))
+	_ = (gofs.NodeOpener)((*node)(nil))
+	_ = (gofs.NodeReader)((*node)(nil))
+	_ = (gofs.NodeWriter)((*node)(nil))
+	_ = (gofs.NodeFsyncer)((*node)(nil))
+)
+
+// path 返回节点在命名空间中的绝对路径
+func (n *node) path() string {
+	return "/" + n.Path(n.Root())
+}
+
+// child 返回子项的绝对路径
+func (n *node) child(name string) string {
+	return path.Join(n.path(), name)
+}
+
+// newChild 为命名空间中的inode创建子节点
+func (n *node) newChild(ctx context.Context, inode *fragmenta.Inode, out *fuse.EntryOut) *gofs.Inode {
+	n.fsys.fillAttr(inode, &out.Attr)
+	out.SetEntryTimeout(n.fsys.options.AttrTimeout)
+	out.SetAttrTimeout(n.fsys.options.AttrTimeout)
+
+	return n.NewInode(ctx, &node{fsys: n.fsys}, gofs.StableAttr{
+		Mode: fileType(inode),
+		Ino:  uint64(inode.ID),
+	})
+}
+
+// Lookup 查找子项
+func (n *node) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*gofs.Inode, syscall.Errno) {
+	inode, err := n.fsys.ns.Lookup(n.child(name))
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return n.newChild(ctx, inode, out), 0
+}
+
+// Getattr 获取属性
+func (n *node) Getattr(ctx context.Context, fh gofs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	inode, err := n.fsys.ns.Lookup(n.path())
+	if err != nil {
+		return toErrno(err)
+	}
+
+	n.fsys.fillAttr(inode, &out.Attr)
+	out.SetTimeout(n.fsys.options.AttrTimeout)
+	return 0
+}
+
+// Setattr 修改属性，支持截断、权限、所有者和时间
+func (n *node) Setattr(ctx context.Context, fh gofs.FileHandle, in *fuse.SetAttrIn, out *fuse.AttrOut) syscall.Errno {
+	if n.fsys.options.ReadOnly {
+		return syscall.EROFS
+	}
+
+	p := n.path()
+	ns := n.fsys.ns
+
+	if size, ok := in.GetSize(); ok {
+		if err := ns.Truncate(p, int64(size)); err != nil {
+			return toErrno(err)
+		}
+	}
+	if mode, ok := in.GetMode(); ok {
+		if err := ns.Chmod(p, os.FileMode(mode).Perm()); err != nil {
+			return toErrno(err)
+		}
+	}
+
+	uid, uidOK := in.GetUID()
+	gid, gidOK := in.GetGID()
+	if uidOK || gidOK {
+		inode, err := ns.Lookup(p)
+		if err != nil {
+			return toErrno(err)
+		}
+		if !uidOK {
+			uid = inode.UID
+		}
+		if !gidOK {
+			gid = inode.GID
+		}
+		if err := ns.Chown(p, uid, gid); err != nil {
+			return toErrno(err)
+		}
+	}
+
+	atime, _ := in.GetATime()
+	mtime, _ := in.GetMTime()
+	if !atime.IsZero() || !mtime.IsZero() {
+		if err := ns.Chtimes(p, atime, mtime); err != nil {
+			return toErrno(err)
+		}
+	}
+
+	return n.Getattr(ctx, fh, out)
+}
+
+// Readdir 列出目录
+func (n *node) Readdir(ctx context.Context) (gofs.DirStream, syscall.Errno) {
+	dentries, err := n.fsys.ns.ReadDir(n.path())
+	if err != nil {
+		return nil, toErrno(err)
+	}
+
+	entries := make([]fuse.DirEntry, 0, len(dentries))
+	for _, dentry := range dentries {
+		mode := uint32(fuse.S_IFREG)
+		if dentry.Type == fragmenta.InodeTypeDir {
+			mode = fuse.S_IFDIR
+		}
+		entries = append(entries, fuse.DirEntry{Name: dentry.Name, Ino: uint64(dentry.Inode), Mode: mode})
+	}
+
+	return gofs.NewListDirStream(entries), 0
+}
+
+// Mkdir 创建目录
+func (n *node) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*gofs.Inode, syscall.Errno) {
+	if n.fsys.options.ReadOnly {
+		return nil, syscall.EROFS
+	}
+
+	p := n.child(name)
+	if _, err := n.fsys.ns.Mkdir(p, os.FileMode(mode).Perm()); err != nil {
+		return nil, toErrno(err)
+	}
+
+	inode, err := n.fsys.setOwner(ctx, p)
+	if err != nil {
+		return nil, toErrno(err)
+	}
+	return n.newChild(ctx, inode, out), 0
+}
+
+// Create 创建并打开文件
+func (n *node) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (*gofs.Inode, gofs.FileHandle, uint32, syscall.Errno) {
+	if n.fsys.options.ReadOnly {
+		return nil, nil, 0, syscall.EROFS
+	}
+
+	p := n.child(name)
+	if _, err := n.fsys.ns.CreateFile(p, os.FileMode(mode).Perm()); err != nil {
+		if !errors.Is(err, fragmenta.ErrPathExists) || flags&syscall.O_EXCL != 0 {
+			return nil, nil, 0, toErrno(err)
+		}
+	}
+
+	inode, err := n.fsys.setOwner(ctx, p)
+	if err != nil {
+		return nil, nil, 0, toErrno(err)
+	}
+	return n.newChild(ctx, inode, out), nil, 0, 0
+}
+
+// Unlink 删除文件
+func (n *node) Unlink(ctx context.Context, name string) syscall.Errno {
+	if n.fsys.options.ReadOnly {
+		return syscall.EROFS
+	}
+	return toErrno(n.fsys.ns.Unlink(n.child(name)))
+}
+
+// Rmdir 删除目录
+func (n *node) Rmdir(ctx context.Context, name string) syscall.Errno {
+	if n.fsys.options.ReadOnly {
+		return syscall.EROFS
+	}
+	return toErrno(n.fsys.ns.Rmdir(n.child(name)))
+}
+
+// Rename 移动或重命名，不支持交换(RENAME_EXCHANGE)
+func (n *node) Rename(ctx context.Context, name string, newParent gofs.InodeEmbedder, newName string, flags uint32) syscall.Errno {
+	if n.fsys.options.ReadOnly {
+		return syscall.EROFS
+	}
+
+	const renameNoReplace, renameExchange = 0x1, 0x2
+	if flags&renameExchange != 0 {
+		return syscall.EINVAL
+	}
+
+	parent, ok := newParent.(*node)
+	if !ok {
+		return syscall.EXDEV
+	}
+	target := parent.child(newName)
+
+	if flags&renameNoReplace != 0 {
+		if _, err := n.fsys.ns.Lookup(target); err == nil {
+			return syscall.EEXIST
+		}
+	}
+
+	return toErrno(n.fsys.ns.Rename(n.child(name), target))
+}
+
+// Open 打开文件，读写直接作用于节点，不使用文件句柄
+func (n *node) Open(ctx context.Context, flags uint32) (gofs.FileHandle, uint32, syscall.Errno) {
+	if n.fsys.options.ReadOnly && flags&(syscall.O_WRONLY|syscall.O_RDWR|syscall.O_TRUNC) != 0 {
+		return nil, 0, syscall.EROFS
+	}
+	return nil, 0, 0
+}
+
+// Read 读取文件内容
+func (n *node) Read(ctx context.Context, fh gofs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	count, err := n.fsys.ns.ReadAt(n.path(), dest, off)
+	if err != nil && err != io.EOF {
+		return nil, toErrno(err)
+	}
+	return fuse.ReadResultData(dest[:count]), 0
+}
+
+// Write 写入文件内容
+func (n *node) Write(ctx context.Context, fh gofs.FileHandle, data []byte, off int64) (uint32, syscall.Errno) {
+	if n.fsys.options.ReadOnly {
+		return 0, syscall.EROFS
+	}
+
+	count, err := n.fsys.ns.WriteAt(n.path(), data, off)
+	if err != nil {
+		return 0, toErrno(err)
+	}
+	return uint32(count), 0
+}
+
+// Fsync 将命名空间表同步到存储
+func (n *node) Fsync(ctx context.Context, fh gofs.FileHandle, flags uint32) syscall.Errno {
+	if n.fsys.options.ReadOnly {
+		return 0
+	}
+	return toErrno(n.fsys.ns.Sync())
+}
+
+// setOwner 将新建项的所有者设置为挂载选项指定的用户或调用者，返回最新的inode
+func (fsys *fileSystem) setOwner(ctx context.Context, p string) (*fragmenta.Inode, error) {
+	uid, gid := fsys.options.UID, fsys.options.GID
+	if caller, ok := fuse.FromContext(ctx); ok {
+		if uid == 0 {
+			uid = caller.Uid
+		}
+		if gid == 0 {
+			gid = caller.Gid
+		}
+	}
+
+	if err := fsys.ns.Chown(p, uid, gid); err != nil {
+		return nil, err
+	}
+	return fsys.ns.Lookup(p)
+}
+
+// fillAttr 将inode转换为FUSE属性
+func (fsys *fileSystem) fillAttr(inode *fragmenta.Inode, attr *fuse.Attr) {
+	attr.Ino = uint64(inode.ID)
+	attr.Mode = fileType(inode) | uint32(inode.Mode.Perm())
+	attr.Size = uint64(inode.Size)
+	attr.Blocks = (attr.Size + 511) / 512
+	attr.Nlink = 1
+	if inode.IsDir() {
+		attr.Nlink = 2
+	}
+	attr.Owner = fuse.Owner{Uid: inode.UID, Gid: inode.GID}
+
+	atime := time.Unix(0, inode.AccessedAt)
+	mtime := time.Unix(0, inode.ModifiedAt)
+	attr.SetTimes(&atime, &mtime, &mtime)
+}
+
+// fileType 返回inode对应的文件类型位
+func fileType(inode *fragmenta.Inode) uint32 {
+	if inode.IsDir() {
+		return fuse.S_IFDIR
+	}
+	return fuse.S_IFREG
+}
+
+// toErrno 将命名空间错误转换为系统错误码
+func toErrno(err error) syscall.Errno {
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, fragmenta.ErrPathNotFound):
+		return syscall.ENOENT
+	case errors.Is(err, fragmenta.ErrPathExists):
+		return syscall.EEXIST
+	case errors.Is(err, fragmenta.ErrNotDirectory):
+		return syscall.ENOTDIR
+	case errors.Is(err, fragmenta.ErrIsDirectory):
+		return syscall.EISDIR
+	case errors.Is(err, fragmenta.ErrDirectoryNotEmpty):
+		return syscall.ENOTEMPTY
+	case errors.Is(err, fragmenta.ErrInvalidPath), errors.Is(err, fragmenta.ErrInvalidArgument):
+		return syscall.EINVAL
+	case errors.Is(err, fragmenta.ErrReadOnly):
+		return syscall.EROFS
+	default:
+		logger.Error("文件系统操作失败", "error", err)
+		return syscall.EIO
+	}
+}
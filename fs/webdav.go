@@ -0,0 +1,311 @@
+package fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/bpfs/fragmenta"
+	"golang.org/x/net/webdav"
+)
+
+// WebDAVOptions WebDAV服务选项
+type WebDAVOptions struct {
+	// Prefix URL前缀，例如"/dav"
+	Prefix string
+	// ReadOnly 只读访问，所有修改请求返回403
+	ReadOnly bool
+	// SyncOnClose 关闭写入过的文件时将命名空间表同步到存储
+	SyncOnClose bool
+}
+
+// DefaultWebDAVOptions 返回默认WebDAV选项
+func DefaultWebDAVOptions() *WebDAVOptions {
+	return &WebDAVOptions{
+		SyncOnClose: true,
+	}
+}
+
+// NewWebDAVHandler 创建以命名空间为后端的WebDAV处理器
+// Finder（"连接服务器"）和Windows资源管理器（"映射网络驱动器"）可以通过HTTP直接挂载，
+// 不需要内核扩展。锁保存在内存中
+func NewWebDAVHandler(ns *fragmenta.Namespace, options *WebDAVOptions) (http.Handler, error) {
+	if ns == nil {
+		return nil, fmt.Errorf("%w: 命名空间不能为空", fragmenta.ErrInvalidArgument)
+	}
+	if options == nil {
+		options = DefaultWebDAVOptions()
+	}
+
+	handler := &webdav.Handler{
+		Prefix:     options.Prefix,
+		FileSystem: NewWebDAVFileSystem(ns, options),
+		LockSystem: webdav.NewMemLS(),
+		Logger: func(r *http.Request, err error) {
+			if err != nil {
+				logger.Debug("WebDAV请求失败", "method", r.Method, "path", r.URL.Path, "error", err)
+			}
+		},
+	}
+	if !options.ReadOnly {
+		return handler, nil
+	}
+
+	// webdav.Handler把PUT打开文件的所有错误都报告为404，只读模式在这里直接拒绝修改请求
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut, http.MethodDelete, "MKCOL", "COPY", "MOVE", "PROPPATCH", "LOCK", "UNLOCK":
+			http.Error(w, "read-only file system", http.StatusForbidden)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}), nil
+}
+
+// webdavFileSystem 实现webdav.FileSystem
+type webdavFileSystem struct {
+	ns      *fragmenta.Namespace
+	options *WebDAVOptions
+}
+
+// NewWebDAVFileSystem 创建以命名空间为后端的webdav.FileSystem
+func NewWebDAVFileSystem(ns *fragmenta.Namespace, options *WebDAVOptions) webdav.FileSystem {
+	if options == nil {
+		options = DefaultWebDAVOptions()
+	}
+	return &webdavFileSystem{ns: ns, options: options}
+}
+
+// Mkdir 创建目录
+func (w *webdavFileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if w.options.ReadOnly {
+		return toPathError("mkdir", name, fragmenta.ErrReadOnly)
+	}
+	_, err := w.ns.Mkdir(davPath(name), perm)
+	return toPathError("mkdir", name, err)
+}
+
+// OpenFile 打开文件或目录，支持O_CREATE、O_EXCL、O_TRUNC和O_APPEND
+func (w *webdavFileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	p := davPath(name)
+	writable := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0
+	if writable && w.options.ReadOnly {
+		return nil, toPathError("open", name, fragmenta.ErrReadOnly)
+	}
+
+	inode, err := w.ns.Lookup(p)
+	switch {
+	case err == nil && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, toPathError("open", name, fragmenta.ErrPathExists)
+	case errors.Is(err, fragmenta.ErrPathNotFound) && flag&os.O_CREATE != 0:
+		inode, err = w.ns.CreateFile(p, perm)
+	}
+	if err != nil {
+		return nil, toPathError("open", name, err)
+	}
+
+	if writable && inode.IsDir() {
+		return nil, toPathError("open", name, fragmenta.ErrIsDirectory)
+	}
+	if flag&os.O_TRUNC != 0 && inode.Size > 0 {
+		if err := w.ns.Truncate(p, 0); err != nil {
+			return nil, toPathError("open", name, err)
+		}
+	}
+
+	return &webdavFile{fsys: w, name: name, path: p, flag: flag}, nil
+}
+
+// RemoveAll 删除文件或目录树
+func (w *webdavFileSystem) RemoveAll(ctx context.Context, name string) error {
+	if w.options.ReadOnly {
+		return toPathError("remove", name, fragmenta.ErrReadOnly)
+	}
+	return toPathError("remove", name, w.ns.RemoveAll(davPath(name)))
+}
+
+// Rename 重命名，目标已存在时由webdav.Handler根据Overwrite头先删除
+func (w *webdavFileSystem) Rename(ctx context.Context, oldName, newName string) error {
+	if w.options.ReadOnly {
+		return toPathError("rename", oldName, fragmenta.ErrReadOnly)
+	}
+	return toPathError("rename", oldName, w.ns.Rename(davPath(oldName), davPath(newName)))
+}
+
+// Stat 获取文件信息
+func (w *webdavFileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	info, err := w.ns.Stat(davPath(name))
+	if err != nil {
+		return nil, toPathError("stat", name, err)
+	}
+	return info, nil
+}
+
+// webdavFile 打开的文件或目录，按路径访问命名空间并维护自己的偏移量
+type webdavFile struct {
+	fsys    *webdavFileSystem
+	name    string
+	path    string
+	flag    int
+	offset  int64
+	dirPos  int
+	written bool
+	mutex   sync.Mutex
+}
+
+// Read 从当前偏移量读取
+func (f *webdavFile) Read(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	n, err := f.fsys.ns.ReadAt(f.path, p, f.offset)
+	f.offset += int64(n)
+	if err != nil && err != io.EOF {
+		return n, toPathError("read", f.name, err)
+	}
+	return n, err
+}
+
+// Write 在当前偏移量写入，O_APPEND时总是追加到末尾
+func (f *webdavFile) Write(p []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) == 0 {
+		return 0, toPathError("write", f.name, os.ErrPermission)
+	}
+	if f.flag&os.O_APPEND != 0 {
+		inode, err := f.fsys.ns.Lookup(f.path)
+		if err != nil {
+			return 0, toPathError("write", f.name, err)
+		}
+		f.offset = inode.Size
+	}
+
+	n, err := f.fsys.ns.WriteAt(f.path, p, f.offset)
+	f.offset += int64(n)
+	f.written = true
+	if err != nil {
+		return n, toPathError("write", f.name, err)
+	}
+	return n, nil
+}
+
+// Seek 移动偏移量
+func (f *webdavFile) Seek(offset int64, whence int) (int64, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		inode, err := f.fsys.ns.Lookup(f.path)
+		if err != nil {
+			return 0, toPathError("seek", f.name, err)
+		}
+		offset += inode.Size
+	default:
+		return 0, toPathError("seek", f.name, fragmenta.ErrInvalidArgument)
+	}
+	if offset < 0 {
+		return 0, toPathError("seek", f.name, fragmenta.ErrInvalidArgument)
+	}
+
+	f.offset = offset
+	return offset, nil
+}
+
+// Readdir 列出目录，count>0时分批返回，读完时返回io.EOF
+func (f *webdavFile) Readdir(count int) ([]os.FileInfo, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	entries, err := f.fsys.ns.ReadDir(f.path)
+	if err != nil {
+		return nil, toPathError("readdir", f.name, err)
+	}
+
+	if f.dirPos > len(entries) {
+		f.dirPos = len(entries)
+	}
+	entries = entries[f.dirPos:]
+	if count > 0 {
+		if len(entries) == 0 {
+			return nil, io.EOF
+		}
+		if len(entries) > count {
+			entries = entries[:count]
+		}
+	}
+	f.dirPos += len(entries)
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := f.fsys.ns.Stat(path.Join(f.path, entry.Name))
+		if err != nil {
+			return nil, toPathError("readdir", f.name, err)
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// Stat 获取文件信息
+func (f *webdavFile) Stat() (os.FileInfo, error) {
+	info, err := f.fsys.ns.Stat(f.path)
+	if err != nil {
+		return nil, toPathError("stat", f.name, err)
+	}
+	return info, nil
+}
+
+// Close 关闭文件，根据选项同步写入过的命名空间
+func (f *webdavFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.written && f.fsys.options.SyncOnClose {
+		if err := f.fsys.ns.Sync(); err != nil {
+			logger.Error("同步命名空间失败", "path", f.path, "error", err)
+			return toPathError("close", f.name, err)
+		}
+	}
+	return nil
+}
+
+// davPath 将WebDAV名称转换为命名空间的绝对路径
+func davPath(name string) string {
+	return path.Clean("/" + name)
+}
+
+// toPathError 将命名空间错误转换为os错误，webdav.Handler据此返回404/405/403等状态码
+func toPathError(op, name string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var target error
+	switch {
+	case errors.Is(err, fragmenta.ErrPathNotFound):
+		target = os.ErrNotExist
+	case errors.Is(err, fragmenta.ErrPathExists):
+		target = os.ErrExist
+	case errors.Is(err, fragmenta.ErrReadOnly), errors.Is(err, os.ErrPermission):
+		target = os.ErrPermission
+	case errors.Is(err, fragmenta.ErrInvalidPath), errors.Is(err, fragmenta.ErrInvalidArgument),
+		errors.Is(err, fragmenta.ErrIsDirectory), errors.Is(err, fragmenta.ErrNotDirectory),
+		errors.Is(err, fragmenta.ErrDirectoryNotEmpty):
+		target = os.ErrInvalid
+	default:
+		return &os.PathError{Op: op, Path: name, Err: err}
+	}
+
+	return &os.PathError{Op: op, Path: name, Err: target}
+}
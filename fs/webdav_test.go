@@ -0,0 +1,118 @@
+package fs
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bpfs/fragmenta"
+)
+
+// davRequest 发送WebDAV请求并返回状态码和响应内容
+func davRequest(t *testing.T, server *httptest.Server, method, target, body string, headers map[string]string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, server.URL+target, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("创建请求失败: %v", err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("%s %s 请求失败: %v", method, target, err)
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+// TestWebDAVHandler 测试通过WebDAV浏览和修改命名空间
+func TestWebDAVHandler(t *testing.T) {
+	backend := NewMemoryBackend()
+	ns, err := fragmenta.NewNamespace(backend, 8)
+	if err != nil {
+		t.Fatalf("创建命名空间失败: %v", err)
+	}
+
+	handler, err := NewWebDAVHandler(ns, &WebDAVOptions{Prefix: "/dav", SyncOnClose: true})
+	if err != nil {
+		t.Fatalf("创建WebDAV处理器失败: %v", err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	if code, _ := davRequest(t, server, "MKCOL", "/dav/docs", "", nil); code != http.StatusCreated {
+		t.Fatalf("MKCOL应返回201, 实际%d", code)
+	}
+	if code, _ := davRequest(t, server, "MKCOL", "/dav/docs", "", nil); code != http.StatusMethodNotAllowed {
+		t.Errorf("重复MKCOL应返回405, 实际%d", code)
+	}
+
+	content := "content stored in a block chain"
+	if code, _ := davRequest(t, server, http.MethodPut, "/dav/docs/a.txt", content, nil); code != http.StatusCreated {
+		t.Fatalf("PUT应返回201, 实际%d", code)
+	}
+	if data, err := ns.ReadFile("/docs/a.txt"); err != nil || string(data) != content {
+		t.Errorf("命名空间中的内容不正确: %q, %v", data, err)
+	}
+	if _, err := backend.GetMetadata(fragmenta.TagNamespace); err != nil {
+		t.Errorf("关闭写入的文件后应同步命名空间表: %v", err)
+	}
+
+	code, body := davRequest(t, server, http.MethodGet, "/dav/docs/a.txt", "", map[string]string{"Range": "bytes=8-13"})
+	if code != http.StatusPartialContent || body != "stored" {
+		t.Errorf("范围读取结果不正确: %d %q", code, body)
+	}
+
+	code, body = davRequest(t, server, "PROPFIND", "/dav/docs", "", map[string]string{"Depth": "1"})
+	if code != http.StatusMultiStatus || !strings.Contains(body, "/dav/docs/a.txt") ||
+		!strings.Contains(body, "<D:getcontentlength>31</D:getcontentlength>") {
+		t.Errorf("PROPFIND结果不正确: %d %s", code, body)
+	}
+
+	// 复制和移动
+	if code, _ := davRequest(t, server, "COPY", "/dav/docs", "", map[string]string{"Destination": server.URL + "/dav/backup"}); code != http.StatusCreated {
+		t.Fatalf("COPY应返回201, 实际%d", code)
+	}
+	if data, _ := ns.ReadFile("/backup/a.txt"); string(data) != content {
+		t.Errorf("复制后的内容不正确: %q", data)
+	}
+	if code, _ := davRequest(t, server, "MOVE", "/dav/docs/a.txt", "", map[string]string{"Destination": server.URL + "/dav/backup/a.txt", "Overwrite": "F"}); code != http.StatusPreconditionFailed {
+		t.Errorf("目标存在且不允许覆盖时应返回412, 实际%d", code)
+	}
+	if code, _ := davRequest(t, server, "MOVE", "/dav/docs/a.txt", "", map[string]string{"Destination": server.URL + "/dav/b.txt"}); code != http.StatusCreated {
+		t.Fatalf("MOVE应返回201, 实际%d", code)
+	}
+	if _, err := ns.Lookup("/docs/a.txt"); err == nil {
+		t.Errorf("移动后源文件应不存在")
+	}
+
+	// 删除目录树
+	if code, _ := davRequest(t, server, http.MethodDelete, "/dav/backup", "", nil); code != http.StatusNoContent {
+		t.Fatalf("DELETE应返回204, 实际%d", code)
+	}
+	if code, _ := davRequest(t, server, http.MethodGet, "/dav/backup/a.txt", "", nil); code != http.StatusNotFound {
+		t.Errorf("删除后应返回404, 实际%d", code)
+	}
+
+	// 只读访问
+	readOnly, err := NewWebDAVHandler(ns, &WebDAVOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("创建只读WebDAV处理器失败: %v", err)
+	}
+	roServer := httptest.NewServer(readOnly)
+	defer roServer.Close()
+
+	if code, _ := davRequest(t, roServer, http.MethodPut, "/new.txt", "x", nil); code != http.StatusForbidden {
+		t.Errorf("只读模式下PUT应返回403, 实际%d", code)
+	}
+	if code, body := davRequest(t, roServer, http.MethodGet, "/b.txt", "", nil); code != http.StatusOK || body != content {
+		t.Errorf("只读模式下应能读取: %d %q", code, body)
+	}
+}
@@ -0,0 +1,615 @@
+package fs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bpfs/fragmenta"
+)
+
+// Windows文件属性
+const (
+	FileAttributeReadonly  uint32 = 0x00000001
+	FileAttributeHidden    uint32 = 0x00000002
+	FileAttributeSystem    uint32 = 0x00000004
+	FileAttributeDirectory uint32 = 0x00000010
+	FileAttributeArchive   uint32 = 0x00000020
+	FileAttributeNormal    uint32 = 0x00000080
+)
+
+// NTSTATUS状态码
+const (
+	StatusSuccess              uint32 = 0x00000000
+	StatusInvalidParameter     uint32 = 0xC000000D
+	StatusAccessDenied         uint32 = 0xC0000022
+	StatusObjectNameInvalid    uint32 = 0xC0000033
+	StatusObjectNameNotFound   uint32 = 0xC0000034
+	StatusObjectNameCollision  uint32 = 0xC0000035
+	StatusMediaWriteProtected  uint32 = 0xC00000A2
+	StatusFileIsADirectory     uint32 = 0xC00000BA
+	StatusUnexpectedIOError    uint32 = 0xC00000E9
+	StatusDirectoryNotEmpty    uint32 = 0xC0000101
+	StatusNotADirectory        uint32 = 0xC0000103
+	StatusEndOfFile            uint32 = 0xC0000011
+	StatusObjectPathNotFound   uint32 = 0xC000003A
+	StatusCannotDeleteReadonly uint32 = 0xC0000121
+)
+
+// filetimeEpochOffset 1601-01-01到1970-01-01之间的100纳秒间隔数
+const filetimeEpochOffset = 116444736000000000
+
+// ErrAccessDenied 访问被拒绝（例如写入带只读属性的文件）
+var ErrAccessDenied = errors.New("access denied")
+
+// windowsInvalidChars Windows文件名中不允许出现的字符
+const windowsInvalidChars = `<>:"/\|?*`
+
+// windowsReservedNames Windows保留的设备名
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// WindowsFileInfo Windows文件系统回调使用的文件信息
+type WindowsFileInfo struct {
+	Name           string // 文件名（不含路径）
+	FileAttributes uint32 // FILE_ATTRIBUTE_*组合
+	FileSize       uint64 // 文件大小
+	AllocationSize uint64 // 分配大小（按块大小对齐）
+	CreationTime   uint64 // 创建时间（FILETIME）
+	LastAccessTime uint64 // 访问时间（FILETIME）
+	LastWriteTime  uint64 // 修改时间（FILETIME）
+	ChangeTime     uint64 // 变更时间（FILETIME）
+	IndexNumber    uint64 // 文件索引号（inode编号）
+}
+
+// WindowsFileSystem 以Windows语义访问命名空间
+// 负责路径转换（反斜杠、盘符、非法字符和保留名）、大小写不敏感查找，
+// 以及POSIX权限位与Windows文件属性之间的转换。WinFsp后端和内存测试模式共用此实现。
+type WindowsFileSystem struct {
+	ns      *fragmenta.Namespace
+	options *MountOptions
+	// mutex 保证大小写不敏感解析与后续操作的原子性
+	mutex sync.Mutex
+}
+
+// NewWindowsFileSystem 创建Windows语义的文件系统，options为nil时使用默认选项
+func NewWindowsFileSystem(ns *fragmenta.Namespace, options *MountOptions) *WindowsFileSystem {
+	if options == nil {
+		options = DefaultMountOptions()
+	}
+	return &WindowsFileSystem{ns: ns, options: options}
+}
+
+// Resolve 返回Windows路径在命名空间中对应的实际路径（大小写以命名空间为准）
+func (w *WindowsFileSystem) Resolve(winPath string) (string, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	return w.resolve(winPath)
+}
+
+// GetFileInfo 获取文件信息
+func (w *WindowsFileSystem) GetFileInfo(winPath string) (*WindowsFileInfo, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	p, err := w.resolve(winPath)
+	if err != nil {
+		return nil, err
+	}
+	return w.fileInfo(p)
+}
+
+// Create 创建文件或目录，attributes中的只读属性会转换为权限位
+func (w *WindowsFileSystem) Create(winPath string, isDir bool, attributes uint32) (*WindowsFileInfo, error) {
+	if w.options.ReadOnly {
+		return nil, fragmenta.ErrReadOnly
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	// 名称只按大小写不同也视为已存在
+	if existing, err := w.resolve(winPath); err == nil {
+		return nil, fmt.Errorf("%w: %s", fragmenta.ErrPathExists, existing)
+	}
+	p, err := w.resolveNew(winPath)
+	if err != nil {
+		return nil, err
+	}
+
+	mode := attributesToMode(attributes, isDir, 0)
+	if isDir {
+		_, err = w.ns.Mkdir(p, mode)
+	} else {
+		_, err = w.ns.CreateFile(p, mode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if w.options.UID != 0 || w.options.GID != 0 {
+		if err := w.ns.Chown(p, w.options.UID, w.options.GID); err != nil {
+			return nil, err
+		}
+	}
+
+	return w.fileInfo(p)
+}
+
+// Read 从文件的off偏移处读取，到达文件末尾返回io.EOF
+func (w *WindowsFileSystem) Read(winPath string, buf []byte, off int64) (int, error) {
+	w.mutex.Lock()
+	p, err := w.resolve(winPath)
+	w.mutex.Unlock()
+	if err != nil {
+		return 0, err
+	}
+
+	return w.ns.ReadAt(p, buf, off)
+}
+
+// Write 在文件的off偏移处写入，writeToEnd为true时追加到文件末尾
+func (w *WindowsFileSystem) Write(winPath string, data []byte, off int64, writeToEnd bool) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	p, inode, err := w.resolveWritable(winPath)
+	if err != nil {
+		return 0, err
+	}
+	if writeToEnd {
+		off = inode.Size
+	}
+
+	return w.ns.WriteAt(p, data, off)
+}
+
+// SetFileSize 设置文件大小
+func (w *WindowsFileSystem) SetFileSize(winPath string, size int64) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	p, _, err := w.resolveWritable(winPath)
+	if err != nil {
+		return err
+	}
+
+	return w.ns.Truncate(p, size)
+}
+
+// SetBasicInfo 设置文件属性和时间
+// attributes为0时不修改属性；时间为0时不修改。只有只读属性会被保存（转换为权限位）
+func (w *WindowsFileSystem) SetBasicInfo(winPath string, attributes uint32, lastAccessTime, lastWriteTime uint64) error {
+	if w.options.ReadOnly {
+		return fragmenta.ErrReadOnly
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	p, err := w.resolve(winPath)
+	if err != nil {
+		return err
+	}
+
+	if attributes != 0 {
+		inode, err := w.ns.Lookup(p)
+		if err != nil {
+			return err
+		}
+		if err := w.ns.Chmod(p, attributesToMode(attributes, inode.IsDir(), inode.Mode)); err != nil {
+			return err
+		}
+	}
+
+	if lastAccessTime != 0 || lastWriteTime != 0 {
+		return w.ns.Chtimes(p, filetimeToTime(lastAccessTime), filetimeToTime(lastWriteTime))
+	}
+	return nil
+}
+
+// Rename 重命名，replaceIfExists为false且目标已存在时返回ErrPathExists
+// 仅大小写不同的重命名总是允许
+func (w *WindowsFileSystem) Rename(oldWinPath, newWinPath string, replaceIfExists bool) error {
+	if w.options.ReadOnly {
+		return fragmenta.ErrReadOnly
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	oldPath, err := w.resolve(oldWinPath)
+	if err != nil {
+		return err
+	}
+	newPath, err := w.resolveNew(newWinPath)
+	if err != nil {
+		return err
+	}
+
+	// 目标以其他大小写形式存在
+	if existing, err := w.resolve(newWinPath); err == nil && !strings.EqualFold(existing, oldPath) {
+		if !replaceIfExists {
+			return fmt.Errorf("%w: %s", fragmenta.ErrPathExists, newWinPath)
+		}
+		target, err := w.ns.Lookup(existing)
+		if err != nil {
+			return err
+		}
+		if target.Mode&0200 == 0 {
+			return fmt.Errorf("%w: %s", ErrAccessDenied, newWinPath)
+		}
+		if existing != newPath {
+			if err := w.removeLocked(existing); err != nil {
+				return err
+			}
+		}
+	}
+
+	return w.ns.Rename(oldPath, newPath)
+}
+
+// Delete 删除文件或空目录，带只读属性的文件不能删除
+func (w *WindowsFileSystem) Delete(winPath string) error {
+	if w.options.ReadOnly {
+		return fragmenta.ErrReadOnly
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	p, err := w.resolve(winPath)
+	if err != nil {
+		return err
+	}
+
+	inode, err := w.ns.Lookup(p)
+	if err != nil {
+		return err
+	}
+	if !inode.IsDir() && inode.Mode&0200 == 0 {
+		return fmt.Errorf("%w: 不能删除只读文件%s", ErrAccessDenied, winPath)
+	}
+
+	return w.removeLocked(p)
+}
+
+// ReadDirectory 列出目录中与通配符pattern匹配的项（不区分大小写，支持*和?）
+func (w *WindowsFileSystem) ReadDirectory(winPath, pattern string) ([]WindowsFileInfo, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	p, err := w.resolve(winPath)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := w.ns.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]WindowsFileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if !matchWildcard(pattern, entry.Name) {
+			continue
+		}
+		info, err := w.fileInfo(path.Join(p, entry.Name))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, *info)
+	}
+
+	return result, nil
+}
+
+// 内部方法（调用方需持有锁）
+
+// resolve 将Windows路径解析为命名空间中已存在的路径，按大小写不敏感匹配
+func (w *WindowsFileSystem) resolve(winPath string) (string, error) {
+	components, err := translatePath(winPath)
+	if err != nil {
+		return "", err
+	}
+
+	current := "/"
+	for _, name := range components {
+		next := path.Join(current, name)
+		if _, err := w.ns.Lookup(next); err == nil {
+			current = next
+			continue
+		}
+
+		entries, err := w.ns.ReadDir(current)
+		if err != nil {
+			return "", err
+		}
+		found := false
+		for _, entry := range entries {
+			if strings.EqualFold(entry.Name, name) {
+				current = path.Join(current, entry.Name)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("%w: %s", fragmenta.ErrPathNotFound, winPath)
+		}
+	}
+
+	return current, nil
+}
+
+// resolveNew 解析待创建的路径：父目录按大小写不敏感匹配，最后一个分量按原样保留并校验
+func (w *WindowsFileSystem) resolveNew(winPath string) (string, error) {
+	components, err := translatePath(winPath)
+	if err != nil {
+		return "", err
+	}
+	if len(components) == 0 {
+		return "", fmt.Errorf("%w: %s", fragmenta.ErrInvalidPath, winPath)
+	}
+
+	name := components[len(components)-1]
+	if err := validateWindowsName(name); err != nil {
+		return "", err
+	}
+
+	parent, err := w.resolve("/" + strings.Join(components[:len(components)-1], "/"))
+	if err != nil {
+		return "", err
+	}
+	return path.Join(parent, name), nil
+}
+
+// resolveWritable 解析要写入的文件，检查只读挂载和只读属性
+func (w *WindowsFileSystem) resolveWritable(winPath string) (string, *fragmenta.Inode, error) {
+	if w.options.ReadOnly {
+		return "", nil, fragmenta.ErrReadOnly
+	}
+
+	p, err := w.resolve(winPath)
+	if err != nil {
+		return "", nil, err
+	}
+	inode, err := w.ns.Lookup(p)
+	if err != nil {
+		return "", nil, err
+	}
+	if inode.Mode&0200 == 0 {
+		return "", nil, fmt.Errorf("%w: %s带有只读属性", ErrAccessDenied, winPath)
+	}
+	return p, inode, nil
+}
+
+// removeLocked 删除文件或空目录
+func (w *WindowsFileSystem) removeLocked(p string) error {
+	inode, err := w.ns.Lookup(p)
+	if err != nil {
+		return err
+	}
+	if inode.IsDir() {
+		return w.ns.Rmdir(p)
+	}
+	return w.ns.Unlink(p)
+}
+
+// fileInfo 将inode转换为Windows文件信息
+func (w *WindowsFileSystem) fileInfo(p string) (*WindowsFileInfo, error) {
+	inode, err := w.ns.Lookup(p)
+	if err != nil {
+		return nil, err
+	}
+
+	size := uint64(inode.Size)
+	return &WindowsFileInfo{
+		Name:           inode.Name,
+		FileAttributes: modeToAttributes(inode),
+		FileSize:       size,
+		AllocationSize: (size + 4095) / 4096 * 4096,
+		CreationTime:   nanosToFiletime(inode.CreatedAt),
+		LastAccessTime: nanosToFiletime(inode.AccessedAt),
+		LastWriteTime:  nanosToFiletime(inode.ModifiedAt),
+		ChangeTime:     nanosToFiletime(inode.ModifiedAt),
+		IndexNumber:    uint64(inode.ID),
+	}, nil
+}
+
+// translatePath 将Windows路径转换为路径分量
+// 接受反斜杠或斜杠分隔，去掉盘符或挂载根前缀（如"X:"），拒绝".."越过根目录
+func translatePath(winPath string) ([]string, error) {
+	p := strings.ReplaceAll(winPath, `\`, "/")
+	if len(p) >= 2 && p[1] == ':' {
+		p = p[2:]
+	}
+	if strings.IndexByte(p, 0) >= 0 {
+		return nil, fmt.Errorf("%w: 路径包含NUL字符", fragmenta.ErrInvalidPath)
+	}
+
+	var components []string
+	for _, name := range strings.Split(p, "/") {
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			if len(components) == 0 {
+				return nil, fmt.Errorf("%w: 路径越过根目录: %s", fragmenta.ErrInvalidPath, winPath)
+			}
+			components = components[:len(components)-1]
+			continue
+		}
+		if strings.ContainsAny(name, windowsInvalidChars) {
+			return nil, fmt.Errorf("%w: 名称包含非法字符: %q", fragmenta.ErrInvalidPath, name)
+		}
+		components = append(components, name)
+	}
+
+	return components, nil
+}
+
+// normalizeWindowsMountPoint 规范化挂载点
+// 盘符统一为"X:"形式，"*"表示由WinFsp选择空闲盘符，目录挂载点使用反斜杠分隔
+func normalizeWindowsMountPoint(mountPoint string) (string, error) {
+	mp := strings.TrimSpace(mountPoint)
+	if mp == "*" {
+		return mp, nil
+	}
+
+	mp = strings.TrimRight(strings.ReplaceAll(mp, "/", `\`), `\`)
+	if mp == "" {
+		return "", fmt.Errorf("%w: 挂载点不能为空或为根目录", fragmenta.ErrInvalidArgument)
+	}
+
+	if len(mp) == 2 && mp[1] == ':' {
+		letter := mp[0] | 0x20
+		if letter < 'a' || letter > 'z' {
+			return "", fmt.Errorf("%w: 无效的盘符: %s", fragmenta.ErrInvalidArgument, mountPoint)
+		}
+		return strings.ToUpper(mp), nil
+	}
+
+	return mp, nil
+}
+
+// validateWindowsName 校验新建项的名称
+func validateWindowsName(name string) error {
+	for _, r := range name {
+		if r < 0x20 {
+			return fmt.Errorf("%w: 名称包含控制字符: %q", fragmenta.ErrInvalidPath, name)
+		}
+	}
+	if strings.HasSuffix(name, ".") || strings.HasSuffix(name, " ") {
+		return fmt.Errorf("%w: 名称不能以点或空格结尾: %q", fragmenta.ErrInvalidPath, name)
+	}
+
+	base := strings.ToUpper(name)
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	if windowsReservedNames[strings.TrimRight(base, " ")] {
+		return fmt.Errorf("%w: %q是保留的设备名", fragmenta.ErrInvalidPath, name)
+	}
+
+	return nil
+}
+
+// modeToAttributes 将inode权限转换为Windows文件属性
+// 所有者没有写权限时为只读；以点开头的名称视为隐藏
+func modeToAttributes(inode *fragmenta.Inode) uint32 {
+	var attributes uint32
+	if inode.IsDir() {
+		attributes |= FileAttributeDirectory
+	} else {
+		attributes |= FileAttributeArchive
+	}
+	if inode.Mode&0200 == 0 {
+		attributes |= FileAttributeReadonly
+	}
+	if strings.HasPrefix(inode.Name, ".") {
+		attributes |= FileAttributeHidden
+	}
+	return attributes
+}
+
+// attributesToMode 将Windows文件属性转换为权限位
+// current为0时使用默认权限（文件0644，目录0755）；只读属性清除所有写权限，否则保证所有者可写
+func attributesToMode(attributes uint32, isDir bool, current os.FileMode) os.FileMode {
+	mode := current.Perm()
+	if mode == 0 {
+		mode = 0644
+		if isDir {
+			mode = 0755
+		}
+	}
+
+	if attributes&FileAttributeReadonly != 0 {
+		return mode &^ 0222
+	}
+	return mode | 0200
+}
+
+// nanosToFiletime 将Unix纳秒时间戳转换为FILETIME
+func nanosToFiletime(nanos int64) uint64 {
+	return uint64(nanos/100 + filetimeEpochOffset)
+}
+
+// filetimeToTime 将FILETIME转换为时间，0表示未设置
+func filetimeToTime(filetime uint64) time.Time {
+	if filetime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, (int64(filetime)-filetimeEpochOffset)*100)
+}
+
+// matchWildcard 不区分大小写的Windows通配符匹配，空模式、"*"和"*.*"匹配所有名称
+func matchWildcard(pattern, name string) bool {
+	if pattern == "" || pattern == "*" || pattern == "*.*" {
+		return true
+	}
+
+	p := []rune(strings.ToLower(pattern))
+	n := []rune(strings.ToLower(name))
+
+	// 经典的回溯通配符匹配
+	pi, ni, star, mark := 0, 0, -1, 0
+	for ni < len(n) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == n[ni]):
+			pi++
+			ni++
+		case pi < len(p) && p[pi] == '*':
+			star = pi
+			mark = ni
+			pi++
+		case star >= 0:
+			pi = star + 1
+			mark++
+			ni = mark
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+// NTStatus 将文件系统错误转换为NTSTATUS状态码
+func NTStatus(err error) uint32 {
+	switch {
+	case err == nil:
+		return StatusSuccess
+	case errors.Is(err, fragmenta.ErrPathNotFound):
+		return StatusObjectNameNotFound
+	case errors.Is(err, fragmenta.ErrPathExists):
+		return StatusObjectNameCollision
+	case errors.Is(err, fragmenta.ErrNotDirectory):
+		return StatusNotADirectory
+	case errors.Is(err, fragmenta.ErrIsDirectory):
+		return StatusFileIsADirectory
+	case errors.Is(err, fragmenta.ErrDirectoryNotEmpty):
+		return StatusDirectoryNotEmpty
+	case errors.Is(err, fragmenta.ErrInvalidPath):
+		return StatusObjectNameInvalid
+	case errors.Is(err, fragmenta.ErrInvalidArgument):
+		return StatusInvalidParameter
+	case errors.Is(err, fragmenta.ErrReadOnly):
+		return StatusMediaWriteProtected
+	case errors.Is(err, ErrAccessDenied):
+		return StatusAccessDenied
+	default:
+		return StatusUnexpectedIOError
+	}
+}
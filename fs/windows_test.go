@@ -0,0 +1,177 @@
+package fs
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/bpfs/fragmenta"
+)
+
+// TestWindowsPathTranslation 测试Windows路径、名称和挂载点的转换
+func TestWindowsPathTranslation(t *testing.T) {
+	components, err := translatePath(`X:\Docs\.\sub\..\Report.txt`)
+	if err != nil || len(components) != 2 || components[0] != "Docs" || components[1] != "Report.txt" {
+		t.Errorf("路径转换结果不正确: %v, %v", components, err)
+	}
+	if _, err := translatePath(`\..\escape`); !errors.Is(err, fragmenta.ErrInvalidPath) {
+		t.Errorf("越过根目录应返回ErrInvalidPath, 实际%v", err)
+	}
+	if _, err := translatePath(`\a|b`); !errors.Is(err, fragmenta.ErrInvalidPath) {
+		t.Errorf("非法字符应返回ErrInvalidPath, 实际%v", err)
+	}
+
+	for _, name := range []string{"CON", "nul.txt", "Com1", "trailing.", "space "} {
+		if err := validateWindowsName(name); !errors.Is(err, fragmenta.ErrInvalidPath) {
+			t.Errorf("名称%q应被拒绝, 实际%v", name, err)
+		}
+	}
+	if err := validateWindowsName("console.log"); err != nil {
+		t.Errorf("普通名称不应被拒绝: %v", err)
+	}
+
+	mountPoints := map[string]string{"x:": "X:", `z:\`: "Z:", "*": "*", `C:/mnt/frag/`: `C:\mnt\frag`}
+	for input, expected := range mountPoints {
+		if actual, err := normalizeWindowsMountPoint(input); err != nil || actual != expected {
+			t.Errorf("挂载点%q应规范化为%q, 实际%q, %v", input, expected, actual, err)
+		}
+	}
+	if _, err := normalizeWindowsMountPoint("1:"); !errors.Is(err, fragmenta.ErrInvalidArgument) {
+		t.Errorf("无效盘符应返回ErrInvalidArgument, 实际%v", err)
+	}
+
+	if !matchWildcard("*.TXT", "notes.txt") || !matchWildcard("a?c*", "abcdef") || matchWildcard("*.md", "notes.txt") {
+		t.Errorf("通配符匹配结果不正确")
+	}
+
+	now := time.Unix(1700000000, 123456700)
+	if back := filetimeToTime(nanosToFiletime(now.UnixNano())); !back.Equal(now) {
+		t.Errorf("FILETIME转换不可逆: %v != %v", back, now)
+	}
+}
+
+// TestMemoryMounter 通过进程内挂载验证Windows语义的文件操作
+func TestMemoryMounter(t *testing.T) {
+	ns, err := fragmenta.NewNamespace(NewMemoryBackend(), 8)
+	if err != nil {
+		t.Fatalf("创建命名空间失败: %v", err)
+	}
+
+	mounter, err := NewMemoryMounter(ns, nil)
+	if err != nil {
+		t.Fatalf("创建挂载器失败: %v", err)
+	}
+	if _, err := mounter.FileSystem(); !errors.Is(err, ErrNotMounted) {
+		t.Errorf("未挂载时应返回ErrNotMounted, 实际%v", err)
+	}
+	if err := mounter.Mount(`f:\`); err != nil {
+		t.Fatalf("挂载失败: %v", err)
+	}
+	if mounter.MountPoint() != "F:" {
+		t.Errorf("挂载点不正确: %q", mounter.MountPoint())
+	}
+	if err := mounter.Mount("G:"); !errors.Is(err, ErrAlreadyMounted) {
+		t.Errorf("重复挂载应返回ErrAlreadyMounted, 实际%v", err)
+	}
+	w, err := mounter.FileSystem()
+	if err != nil {
+		t.Fatalf("获取文件系统失败: %v", err)
+	}
+
+	if _, err := w.Create(`\Docs`, true, 0); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	info, err := w.Create(`\docs\Report.TXT`, false, 0)
+	if err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	if info.FileAttributes != FileAttributeArchive {
+		t.Errorf("新文件属性不正确: %#x", info.FileAttributes)
+	}
+	if _, err := w.Create(`\DOCS\report.txt`, false, 0); !errors.Is(err, fragmenta.ErrPathExists) {
+		t.Errorf("大小写不同的同名文件应冲突, 实际%v", err)
+	}
+	if _, err := w.Create(`\Docs\aux`, false, 0); NTStatus(err) != StatusObjectNameInvalid {
+		t.Errorf("保留名应返回STATUS_OBJECT_NAME_INVALID, 实际%#x", NTStatus(err))
+	}
+
+	// 大小写不敏感的读写，写入跨越多个块
+	if _, err := w.Write(`\DOCS\report.txt`, []byte("hello windows"), 0, false); err != nil {
+		t.Fatalf("写入失败: %v", err)
+	}
+	if _, err := w.Write(`\docs\REPORT.txt`, []byte("!"), 0, true); err != nil {
+		t.Fatalf("追加写入失败: %v", err)
+	}
+	buf := make([]byte, 32)
+	count, err := w.Read(`\Docs\Report.TXT`, buf, 0)
+	if (err != nil && err != io.EOF) || string(buf[:count]) != "hello windows!" {
+		t.Errorf("读取内容不正确: %q, %v", buf[:count], err)
+	}
+
+	// 只读属性转换为权限位，并阻止写入和删除
+	if err := w.SetBasicInfo(`\docs\report.txt`, FileAttributeReadonly, 0, 0); err != nil {
+		t.Fatalf("设置只读属性失败: %v", err)
+	}
+	if inode, _ := ns.Lookup("/Docs/Report.TXT"); inode.Mode.Perm() != 0444 {
+		t.Errorf("只读属性应清除写权限: %v", inode.Mode)
+	}
+	if _, err := w.Write(`\docs\report.txt`, []byte("x"), 0, false); NTStatus(err) != StatusAccessDenied {
+		t.Errorf("写入只读文件应返回STATUS_ACCESS_DENIED, 实际%#x", NTStatus(err))
+	}
+	if err := w.Delete(`\docs\report.txt`); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("删除只读文件应被拒绝, 实际%v", err)
+	}
+	if err := w.SetBasicInfo(`\docs\report.txt`, FileAttributeNormal, 0, 0); err != nil {
+		t.Fatalf("清除只读属性失败: %v", err)
+	}
+	if info, _ := w.GetFileInfo(`\docs\report.txt`); info.FileAttributes&FileAttributeReadonly != 0 {
+		t.Errorf("只读属性应被清除: %#x", info.FileAttributes)
+	}
+
+	// 重命名：仅大小写不同总是允许，覆盖需要replaceIfExists
+	if err := w.Rename(`\docs\report.txt`, `\docs\report.txt`, false); err != nil {
+		t.Fatalf("仅大小写不同的重命名失败: %v", err)
+	}
+	if _, err := ns.Lookup("/Docs/report.txt"); err != nil {
+		t.Errorf("重命名后应使用新的大小写: %v", err)
+	}
+	if _, err := w.Create(`\docs\.hidden`, false, 0); err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	if err := w.Rename(`\docs\report.txt`, `\DOCS\.HIDDEN`, false); NTStatus(err) != StatusObjectNameCollision {
+		t.Errorf("目标存在时应返回STATUS_OBJECT_NAME_COLLISION, 实际%#x", NTStatus(err))
+	}
+	if err := w.Rename(`\docs\report.txt`, `\DOCS\.HIDDEN`, true); err != nil {
+		t.Fatalf("覆盖重命名失败: %v", err)
+	}
+
+	entries, err := w.ReadDirectory(`\docs`, "*")
+	if err != nil || len(entries) != 1 || entries[0].Name != ".HIDDEN" || entries[0].FileSize != 14 {
+		t.Fatalf("目录内容不正确: %+v, %v", entries, err)
+	}
+	if entries[0].FileAttributes&FileAttributeHidden == 0 {
+		t.Errorf("以点开头的文件应带隐藏属性: %#x", entries[0].FileAttributes)
+	}
+	if entries, _ := w.ReadDirectory(`\docs`, "*.txt"); len(entries) != 0 {
+		t.Errorf("通配符过滤结果不正确: %+v", entries)
+	}
+
+	if err := w.Delete(`\docs`); NTStatus(err) != StatusDirectoryNotEmpty {
+		t.Errorf("删除非空目录应返回STATUS_DIRECTORY_NOT_EMPTY, 实际%#x", NTStatus(err))
+	}
+	if err := w.Delete(`\docs\.hidden`); err != nil {
+		t.Fatalf("删除文件失败: %v", err)
+	}
+	if _, err := w.GetFileInfo(`\docs\.hidden`); NTStatus(err) != StatusObjectNameNotFound {
+		t.Errorf("删除后应返回STATUS_OBJECT_NAME_NOT_FOUND, 实际%#x", NTStatus(err))
+	}
+
+	if err := mounter.Unmount(); err != nil {
+		t.Fatalf("卸载失败: %v", err)
+	}
+	mounter.Wait()
+	if err := mounter.Unmount(); !errors.Is(err, ErrNotMounted) {
+		t.Errorf("重复卸载应返回ErrNotMounted, 实际%v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package fragmenta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// FuzzReadHeader 测试打开文件头被任意改写的文件不会panic。
+// resign为true时按改写后的字段重新计算校验和，使校验之后的代码也能被覆盖
+func FuzzReadHeader(f *testing.F) {
+	template, err := os.ReadFile(createHeaderTestFile(f))
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(template[:headerRecordSize], false)
+	f.Add(template[:headerRecordSize], true)
+	f.Add(template[:40], true)
+	f.Add(bytes.Repeat([]byte{0xFF}, headerRecordSize), true)
+
+	path := filepath.Join(f.TempDir(), "fuzz.frag")
+	f.Fuzz(func(t *testing.T, record []byte, resign bool) {
+		data := bytes.Clone(template)
+		if resign {
+			header := &FragmentaHeader{}
+			padded := make([]byte, headerRecordSize)
+			copy(padded, record)
+			binary.Read(bytes.NewReader(padded), binary.BigEndian, header)
+			record = encodeHeader(header)
+			copy(data[ShadowHeaderOffset:], record)
+		}
+		copy(data, record[:min(len(record), headerRecordSize)])
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		Inspect(path)
+		db, err := OpenFragmenta(path)
+		if err != nil {
+			return
+		}
+		db.GetHeader()
+		db.ListMetadata()
+		db.GetMetadata(TagTitle)
+		if blocks, err := db.ListBlocks(); err == nil {
+			for _, block := range blocks {
+				db.ReadBlock(block.BlockID)
+			}
+		}
+		db.ReadBlock(1)
+		db.Close()
+	})
+}
@@ -3,14 +3,20 @@ module github.com/bpfs/fragmenta
 go 1.24.1
 
 require (
+	github.com/ThalesIgnite/crypto11 v1.2.5
 	github.com/dep2p/log v0.0.1
 	github.com/fsnotify/fsnotify v1.8.0
 	github.com/hanwen/go-fuse/v2 v2.7.2
 	github.com/seaweedfs/fuse v1.2.3
+	github.com/winfsp/cgofuse v1.6.0
+	golang.org/x/net v0.34.0
 )
 
 require (
 	github.com/mattn/go-isatty v0.0.20 // indirect
+	github.com/miekg/pkcs11 v1.0.3-0.20190429190417-a667d056470f // indirect
+	github.com/pkg/errors v0.8.1 // indirect
+	github.com/thales-e-security/pool v0.0.2 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
 	go.uber.org/zap v1.27.0 // indirect
 	golang.org/x/sys v0.29.0 // indirect
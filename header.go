@@ -0,0 +1,127 @@
+package fragmenta
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+)
+
+var (
+	// headerRecordSize 文件头记录在磁盘上的大小
+	headerRecordSize = binary.Size(FragmentaHeader{})
+
+	// headerChecksumOffset CheckSum字段在文件头记录中的偏移，其后只有8字节的Generation
+	headerChecksumOffset = headerRecordSize - 32 - 8
+)
+
+// 文件头写入顺序：先写影子文件头并同步，再写主文件头并同步。
+// 写主文件头时崩溃，影子文件头保存着同一代的完整副本；写影子文件头时崩溃，
+// 主文件头仍是上一代的有效版本。打开时选择代数最大的有效副本。
+// 未设置FlagShadowHeader的旧文件在ShadowHeaderOffset处存放元数据，只写主文件头。
+
+// writeHeader 递增代数并写入文件头
+func (f *FragmentaImpl) writeHeader() error {
+	f.header.Generation++
+	record := encodeHeader(&f.header)
+
+	if f.header.Flags&FlagShadowHeader != 0 {
+		if err := f.writeHeaderSlot(ShadowHeaderOffset, record); err != nil {
+			logger.Error("写入影子文件头失败", "error", err)
+			return err
+		}
+	}
+
+	if err := f.writeHeaderSlot(0, record); err != nil {
+		logger.Error("写入主文件头失败", "error", err)
+		return err
+	}
+
+	return nil
+}
+
+// readHeader 读取文件头，主文件头无效或比影子文件头旧时使用影子文件头
+func (f *FragmentaImpl) readHeader() error {
+	primary, primaryErr := f.readHeaderSlot(0)
+	if primaryErr == nil && primary.Flags&FlagShadowHeader == 0 {
+		f.header = *primary
+		return nil
+	}
+
+	shadow, shadowErr := f.readHeaderSlot(ShadowHeaderOffset)
+	if shadowErr == nil && shadow.Flags&FlagShadowHeader == 0 {
+		shadowErr = ErrInvalidFragmenta
+	}
+
+	switch {
+	case primaryErr == nil && (shadowErr != nil || shadow.Generation <= primary.Generation):
+		f.header = *primary
+	case shadowErr == nil:
+		logger.Warn("主文件头无效或已过期，使用影子文件头",
+			"primaryError", primaryErr, "generation", shadow.Generation)
+		f.header = *shadow
+		f.headerRecovered = true
+	default:
+		logger.Error("读取文件头失败", "error", primaryErr)
+		return primaryErr
+	}
+
+	return nil
+}
+
+// writeHeaderSlot 在指定偏移写入文件头记录并同步到磁盘
+func (f *FragmentaImpl) writeHeaderSlot(offset uint64, record []byte) error {
+	if _, err := f.file.WriteAt(record, int64(offset)); err != nil {
+		return err
+	}
+	return f.file.Sync()
+}
+
+// readHeaderSlot 读取并校验指定偏移处的文件头记录
+func (f *FragmentaImpl) readHeaderSlot(offset uint64) (*FragmentaHeader, error) {
+	record := make([]byte, headerRecordSize)
+	if _, err := f.file.ReadAt(record, int64(offset)); err != nil {
+		return nil, fmt.Errorf("%w: 读取偏移%d处的文件头失败: %v", ErrInvalidFragmenta, offset, err)
+	}
+	return decodeHeader(record)
+}
+
+// encodeHeader 编码文件头并填入校验和
+func encodeHeader(header *FragmentaHeader) []byte {
+	header.CheckSum = [32]byte{}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, header)
+	record := buf.Bytes()
+
+	header.CheckSum = sha256.Sum256(record)
+	copy(record[headerChecksumOffset:], header.CheckSum[:])
+	return record
+}
+
+// decodeHeader 解码文件头记录并校验魔数和校验和，校验和全零的旧版本文件头不做校验
+func decodeHeader(record []byte) (*FragmentaHeader, error) {
+	header := &FragmentaHeader{}
+	if err := binary.Read(bytes.NewReader(record), binary.BigEndian, header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFragmenta, err)
+	}
+	if header.Magic != MagicNumber {
+		return nil, ErrInvalidFragmenta
+	}
+	if header.CheckSum == [32]byte{} {
+		// 支持影子文件头的版本总是写入校验和
+		if header.Flags&FlagShadowHeader != 0 {
+			return nil, ErrHeaderChecksum
+		}
+		return header, nil
+	}
+
+	unsigned := make([]byte, len(record))
+	copy(unsigned, record)
+	copy(unsigned[headerChecksumOffset:], make([]byte, len(header.CheckSum)))
+	if sha256.Sum256(unsigned) != header.CheckSum {
+		return nil, ErrHeaderChecksum
+	}
+
+	return header, nil
+}
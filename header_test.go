@@ -0,0 +1,172 @@
+package fragmenta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// createHeaderTestFile 创建带元数据和数据块的测试文件并返回路径
+func createHeaderTestFile(t testing.TB) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "header.frag")
+	f, err := CreateFragmenta(path, nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	if _, err := f.WriteBlock([]byte("block data"), nil); err != nil {
+		t.Fatalf("写入数据块失败: %v", err)
+	}
+	if err := f.SetMetadata(TagTitle, []byte("影子文件头")); err != nil {
+		t.Fatalf("设置元数据失败: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+	return path
+}
+
+// corruptAt 覆盖文件中指定偏移处的字节
+func corruptAt(t *testing.T, path string, offset int64, data []byte) {
+	t.Helper()
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+	if _, err := file.WriteAt(data, offset); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+}
+
+// checkHeaderTestFile 打开测试文件并检查内容完整
+func checkHeaderTestFile(t *testing.T, path string) *FragmentaImpl {
+	t.Helper()
+
+	f, err := OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开Fragmenta格式文件失败: %v", err)
+	}
+	impl := f.(*FragmentaImpl)
+	t.Cleanup(func() { impl.Close() })
+
+	if title, err := f.GetMetadata(TagTitle); err != nil || string(title) != "影子文件头" {
+		t.Errorf("元数据不正确: %q, %v", title, err)
+	}
+	if data, err := f.ReadBlock(1); err != nil || string(data) != "block data" {
+		t.Errorf("数据块不正确: %q, %v", data, err)
+	}
+	return impl
+}
+
+// TestShadowHeaderFallback 测试主文件头损坏时使用影子文件头并修复
+func TestShadowHeaderFallback(t *testing.T) {
+	path := createHeaderTestFile(t)
+
+	// 主文件头的区域偏移损坏，魔数仍然正确
+	corruptAt(t, path, 40, bytes.Repeat([]byte{0xFF}, 16))
+
+	f := checkHeaderTestFile(t, path)
+	if !f.headerRecovered {
+		t.Errorf("应使用影子文件头")
+	}
+	if _, err := f.readHeaderSlot(0); err != nil {
+		t.Errorf("打开后应修复主文件头: %v", err)
+	}
+
+	report, err := Inspect(path)
+	if err != nil {
+		t.Fatalf("检查文件失败: %v", err)
+	}
+	if report.Header.Recovered || len(report.Problems) != 0 {
+		t.Errorf("修复后不应报告问题: %+v %v", report.Header, report.Problems)
+	}
+}
+
+// TestShadowHeaderNewerGeneration 测试写完影子文件头、写主文件头前崩溃时使用较新的影子文件头
+func TestShadowHeaderNewerGeneration(t *testing.T) {
+	path := createHeaderTestFile(t)
+
+	f, err := OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开Fragmenta格式文件失败: %v", err)
+	}
+	impl := f.(*FragmentaImpl)
+	stale, err := impl.readHeaderSlot(0)
+	if err != nil {
+		t.Fatalf("读取主文件头失败: %v", err)
+	}
+	if err := f.SetMetadata(TagAuthor, []byte("fragmenta")); err != nil {
+		t.Fatalf("设置元数据失败: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+
+	// 把主文件头恢复为上一代，模拟只完成了影子文件头的写入
+	corruptAt(t, path, 0, encodeHeader(stale))
+
+	impl = checkHeaderTestFile(t, path)
+	if !impl.headerRecovered {
+		t.Errorf("应使用代数更大的影子文件头")
+	}
+	if author, err := impl.GetMetadata(TagAuthor); err != nil || string(author) != "fragmenta" {
+		t.Errorf("应读取到最后一次提交的元数据: %q, %v", author, err)
+	}
+}
+
+// TestShadowHeaderCorrupted 测试影子文件头损坏时仍使用主文件头
+func TestShadowHeaderCorrupted(t *testing.T) {
+	path := createHeaderTestFile(t)
+	corruptAt(t, path, int64(ShadowHeaderOffset)+40, bytes.Repeat([]byte{0xFF}, 16))
+
+	f := checkHeaderTestFile(t, path)
+	if f.headerRecovered {
+		t.Errorf("主文件头有效时不应使用影子文件头")
+	}
+	f.Close()
+
+	report, err := Inspect(path)
+	if err != nil {
+		t.Fatalf("检查文件失败: %v", err)
+	}
+	// 关闭时没有修改，影子文件头仍然损坏
+	if len(report.Problems) == 0 {
+		t.Errorf("应报告影子文件头无效")
+	}
+
+	// 两份都损坏时无法打开
+	corruptAt(t, path, 40, bytes.Repeat([]byte{0xFF}, 16))
+	if _, err := OpenFragmenta(path); err == nil {
+		t.Errorf("两份文件头都损坏时打开应失败")
+	}
+}
+
+// TestLegacyHeader 测试没有校验和和影子文件头的旧版本文件仍可打开
+func TestLegacyHeader(t *testing.T) {
+	path := createHeaderTestFile(t)
+
+	f, err := OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开Fragmenta格式文件失败: %v", err)
+	}
+	header := *f.GetHeader()
+	f.Close()
+
+	header.Flags &^= FlagShadowHeader
+	header.CheckSum = [32]byte{}
+	header.Generation = 0
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, &header)
+	corruptAt(t, path, 0, buf.Bytes())
+	corruptAt(t, path, int64(ShadowHeaderOffset), make([]byte, headerRecordSize))
+
+	impl := checkHeaderTestFile(t, path)
+	if impl.header.Flags&FlagShadowHeader != 0 || impl.headerRecovered {
+		t.Errorf("旧版本文件头应原样读取: %+v", impl.header)
+	}
+}
@@ -0,0 +1,245 @@
+package fragmenta
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/bpfs/fragmenta/storage"
+)
+
+// 健康检查的默认阈值
+const (
+	// DefaultHealthMinFreeBytes 可用磁盘空间低于该值时状态为降级
+	DefaultHealthMinFreeBytes = 256 << 20
+	// DefaultHealthMinFreeRatio 可用磁盘空间占比低于该值时状态为降级
+	DefaultHealthMinFreeRatio = 0.05
+	// DefaultHealthCheckTimeout 单项检查的默认超时
+	DefaultHealthCheckTimeout = 2 * time.Second
+)
+
+// HealthStatus 健康状态，按严重程度递增
+type HealthStatus int
+
+const (
+	// HealthOK 正常
+	HealthOK HealthStatus = iota
+	// HealthDegraded 降级：仍可服务，但需要处理（如磁盘空间不足、使用了影子文件头）
+	HealthDegraded
+	// HealthUnhealthy 不可用：检查失败或超时
+	HealthUnhealthy
+)
+
+// String 返回状态名称，可直接用于/healthz的响应
+func (s HealthStatus) String() string {
+	switch s {
+	case HealthOK:
+		return "ok"
+	case HealthDegraded:
+		return "degraded"
+	case HealthUnhealthy:
+		return "unhealthy"
+	default:
+		return fmt.Sprintf("HealthStatus(%d)", int(s))
+	}
+}
+
+// MarshalText 按名称编码，HealthReport编码为JSON时状态为字符串
+func (s HealthStatus) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// HealthCheckOptions 健康检查选项，零值使用默认阈值
+type HealthCheckOptions struct {
+	MinFreeBytes uint64        // 可用磁盘空间低于该值时降级，0使用DefaultHealthMinFreeBytes
+	MinFreeRatio float64       // 可用磁盘空间占比低于该值时降级，0使用DefaultHealthMinFreeRatio
+	CheckTimeout time.Duration // 单项检查的超时，0使用DefaultHealthCheckTimeout
+}
+
+// HealthCheckResult 单项检查的结果
+type HealthCheckResult struct {
+	Name     string        `json:"name"`
+	Status   HealthStatus  `json:"status"`
+	Message  string        `json:"message,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// HealthReport 健康检查报告，Status为各项检查中最严重的状态
+type HealthReport struct {
+	Status HealthStatus        `json:"status"`
+	Time   time.Time           `json:"time"`
+	Checks []HealthCheckResult `json:"checks"`
+}
+
+// healthCheck 一项检查，返回状态和说明
+type healthCheck struct {
+	name string
+	run  func() (HealthStatus, string)
+}
+
+// HealthCheck 执行只读的轻量检查：文件头可读且校验通过、块缓存的计数一致、索引可以响应查询、
+// 磁盘可用空间高于阈值。每项检查单独限时，超时（如锁被长时间持有）的检查为不可用。
+// 结构化的结果可以由HTTP或gRPC层作为/healthz暴露，opts为nil时使用默认阈值
+func (f *FragmentaImpl) HealthCheck(ctx context.Context, opts *HealthCheckOptions) *HealthReport {
+	if opts == nil {
+		opts = &HealthCheckOptions{}
+	}
+	timeout := opts.CheckTimeout
+	if timeout <= 0 {
+		timeout = DefaultHealthCheckTimeout
+	}
+
+	report := &HealthReport{Time: time.Now()}
+	if !f.isOpen {
+		report.Status = HealthUnhealthy
+		report.Checks = []HealthCheckResult{{Name: "open", Status: HealthUnhealthy, Message: "文件已关闭"}}
+		return report
+	}
+
+	checks := []healthCheck{
+		{"header", f.checkHeaderHealth},
+		{"cache", f.checkCacheHealth},
+		{"index", f.checkIndexHealth},
+		{"disk", func() (HealthStatus, string) { return f.checkDiskHealth(opts) }},
+	}
+	for _, check := range checks {
+		result := runHealthCheck(ctx, check, timeout)
+		report.Checks = append(report.Checks, result)
+		report.Status = max(report.Status, result.Status)
+	}
+	if report.Status != HealthOK {
+		logger.Warn("健康检查未通过", "status", report.Status, "path", f.path)
+	}
+	return report
+}
+
+// runHealthCheck 在单独的协程中执行检查，超时或ctx取消时不等待检查结束
+func runHealthCheck(ctx context.Context, check healthCheck, timeout time.Duration) HealthCheckResult {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	type outcome struct {
+		status  HealthStatus
+		message string
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		status, message := check.run()
+		done <- outcome{status, message}
+	}()
+
+	result := HealthCheckResult{Name: check.name}
+	select {
+	case o := <-done:
+		result.Status, result.Message = o.status, o.message
+	case <-ctx.Done():
+		result.Status = HealthUnhealthy
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			result.Message = fmt.Sprintf("检查超过%v未完成", timeout)
+		} else {
+			result.Message = ctx.Err().Error()
+		}
+	}
+	result.Duration = time.Since(start)
+	return result
+}
+
+// checkHeaderHealth 检查主文件头可读且校验通过，主文件头无效但影子文件头有效时为降级
+func (f *FragmentaImpl) checkHeaderHealth() (HealthStatus, string) {
+	// 避免读到提交中写了一半的文件头
+	f.writeMutex.RLock()
+	defer f.writeMutex.RUnlock()
+
+	if f.file == nil {
+		return HealthOK, "没有格式文件"
+	}
+	_, primaryErr := f.readHeaderSlot(0)
+	if primaryErr == nil {
+		if f.headerRecovered {
+			return HealthDegraded, "打开时主文件头无效，使用了影子文件头，提交后恢复"
+		}
+		return HealthOK, ""
+	}
+	if f.header.Flags&FlagShadowHeader != 0 {
+		if _, err := f.readHeaderSlot(ShadowHeaderOffset); err == nil {
+			return HealthDegraded, fmt.Sprintf("主文件头无效，影子文件头可用: %v", primaryErr)
+		}
+	}
+	return HealthUnhealthy, fmt.Sprintf("文件头无效: %v", primaryErr)
+}
+
+// checkCacheHealth 检查块缓存可以加锁，且缓存的字节数与缓存内容一致、不超过上限
+func (f *FragmentaImpl) checkCacheHealth() (HealthStatus, string) {
+	bm, ok := f.blockManager.(*blockManagerImpl)
+	if !ok {
+		return HealthOK, ""
+	}
+	bm.cacheMutex.Lock()
+	defer bm.cacheMutex.Unlock()
+
+	var size int64
+	for _, data := range bm.blockCache {
+		size += int64(len(data))
+	}
+	if size != bm.cacheBytes {
+		return HealthDegraded, fmt.Sprintf("块缓存计数不一致: 记录%d字节，实际%d字节", bm.cacheBytes, size)
+	}
+	if bm.cacheLimit > 0 && size > bm.cacheLimit {
+		return HealthDegraded, fmt.Sprintf("块缓存超过上限: %d/%d字节", size, bm.cacheLimit)
+	}
+	return HealthOK, fmt.Sprintf("%d个块，%d字节", len(bm.blockCache), size)
+}
+
+// checkIndexHealth 检查索引可以响应查询，未设置索引管理器时跳过
+func (f *FragmentaImpl) checkIndexHealth() (HealthStatus, string) {
+	f.componentMutex.RLock()
+	indexManager := f.indexManager
+	f.componentMutex.RUnlock()
+
+	if indexManager == nil {
+		return HealthOK, "未设置索引"
+	}
+	// 查找一个不存在的标签，只验证索引可以加锁并响应
+	indexManager.FindByKey(0)
+	status := indexManager.GetStatus()
+	if status != nil && status.Error != "" {
+		return HealthDegraded, status.Error
+	}
+	return HealthOK, ""
+}
+
+// checkDiskHealth 检查格式文件所在文件系统的可用空间，没有可用空间时为不可用
+func (f *FragmentaImpl) checkDiskHealth(opts *HealthCheckOptions) (HealthStatus, string) {
+	if f.path == "" {
+		return HealthOK, "没有格式文件"
+	}
+	space, err := storage.GetDiskSpace(filepath.Dir(f.path))
+	if errors.Is(err, errors.ErrUnsupported) {
+		return HealthOK, "当前平台不支持检查磁盘空间"
+	}
+	if err != nil {
+		return HealthUnhealthy, fmt.Sprintf("获取磁盘空间失败: %v", err)
+	}
+
+	minBytes := opts.MinFreeBytes
+	if minBytes == 0 {
+		minBytes = DefaultHealthMinFreeBytes
+	}
+	minRatio := opts.MinFreeRatio
+	if minRatio == 0 {
+		minRatio = DefaultHealthMinFreeRatio
+	}
+
+	message := fmt.Sprintf("可用%d/%d字节", space.Available, space.Total)
+	switch {
+	case space.Available == 0:
+		return HealthUnhealthy, message
+	case space.Available < minBytes || space.AvailableRatio() < minRatio:
+		return HealthDegraded, message
+	default:
+		return HealthOK, message
+	}
+}
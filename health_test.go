@@ -0,0 +1,71 @@
+package fragmenta
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestHealthCheck 测试健康检查的各项结果和整体状态
+func TestHealthCheck(t *testing.T) {
+	f, err := CreateFragmenta(filepath.Join(t.TempDir(), "health.frag"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	impl := f.(*FragmentaImpl)
+	if _, err := f.WriteBlock([]byte("data"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	report := f.HealthCheck(context.Background(), &HealthCheckOptions{MinFreeBytes: 1, MinFreeRatio: 1e-9})
+	if report.Status != HealthOK {
+		t.Fatalf("status = %v: %+v", report.Status, report.Checks)
+	}
+	var names []string
+	for _, check := range report.Checks {
+		names = append(names, check.Name)
+	}
+	if got := strings.Join(names, ","); got != "header,cache,index,disk" {
+		t.Errorf("checks = %s", got)
+	}
+	data, err := json.Marshal(report)
+	if err != nil || !strings.Contains(string(data), `"status":"ok"`) {
+		t.Errorf("json: %s, %v", data, err)
+	}
+
+	// 可用空间阈值无法满足时降级
+	report = f.HealthCheck(context.Background(), &HealthCheckOptions{MinFreeBytes: 1 << 62})
+	if report.Status != HealthDegraded || report.Checks[3].Status != HealthDegraded {
+		t.Errorf("low disk: %+v", report.Checks)
+	}
+
+	// 主文件头损坏时影子文件头可用，状态为降级
+	if _, err := impl.file.WriteAt(make([]byte, 64), 0); err != nil {
+		t.Fatal(err)
+	}
+	report = f.HealthCheck(context.Background(), &HealthCheckOptions{MinFreeBytes: 1, MinFreeRatio: 1e-9})
+	if report.Checks[0].Status != HealthDegraded {
+		t.Errorf("corrupted primary header: %+v", report.Checks[0])
+	}
+
+	// ctx已取消时检查为不可用
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	bm := impl.blockManager.(*blockManagerImpl)
+	bm.cacheMutex.Lock()
+	report = f.HealthCheck(ctx, nil)
+	bm.cacheMutex.Unlock()
+	if report.Status != HealthUnhealthy || report.Checks[1].Status != HealthUnhealthy {
+		t.Errorf("cancelled: %+v", report.Checks)
+	}
+
+	f.Close()
+	if report := f.HealthCheck(context.Background(), nil); report.Status != HealthUnhealthy {
+		t.Errorf("closed: %+v", report)
+	}
+}
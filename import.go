@@ -0,0 +1,288 @@
+package fragmenta
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bpfs/fragmenta/storage"
+)
+
+// ImportDirectory 在每个文件第一个块上记录的块属性
+const (
+	// ImportAttributePath 文件的相对路径（以/分隔，带ImportOptions.Prefix）
+	ImportAttributePath = "path"
+	// ImportAttributeSize 文件大小（字节）
+	ImportAttributeSize = "size"
+	// ImportAttributeModTime 文件修改时间（RFC 3339，纳秒精度）
+	ImportAttributeModTime = "mtime"
+	// ImportAttributeSHA256 文件内容的SHA-256（十六进制），ImportOptions.Hash为true时记录
+	ImportAttributeSHA256 = "sha256"
+)
+
+// DefaultImportBufferLimit 导入时先读入内存的文件大小上限
+const DefaultImportBufferLimit int64 = 4 * 1024 * 1024
+
+// ImportOptions 导入目录的选项
+type ImportOptions struct {
+	Prefix      string                                    // 记录的路径前缀，如 "photos/2024"
+	Hash        bool                                      // 计算文件的SHA-256并记录在sha256属性中
+	Workers     int                                       // 并行读取文件的协程数，0表示runtime.NumCPU()；设置了Pool时忽略
+	Pool        *storage.WorkerPool                       // 共享的工作池，为nil时按Workers创建临时工作池
+	BufferLimit int64                                     // 不超过该大小的文件并行读入内存，更大的文件在写入时流式读取；0表示DefaultImportBufferLimit
+	Filter      func(path string, entry fs.DirEntry) bool // 返回false时跳过该文件或目录，path为相对于源目录的/分隔路径
+	Attributes  map[string]string                         // 附加到每个文件第一个块上的属性
+	Progress    func(ImportProgress)                      // 每导入一个文件调用一次，调用不会并发
+}
+
+// ImportProgress 导入进度
+type ImportProgress struct {
+	Path       string // 刚导入的文件
+	Files      int    // 已导入的文件数
+	TotalFiles int    // 要导入的文件总数
+	Bytes      int64  // 已导入的字节数
+	TotalBytes int64  // 要导入的总字节数（按遍历时的文件大小）
+}
+
+// ImportResult 导入结果
+type ImportResult struct {
+	Files   int                      // 导入的文件数
+	Bytes   int64                    // 导入的字节数
+	Objects map[string]*ObjectHandle // 记录的路径到文件对象的映射
+}
+
+// importFile 要导入的文件
+type importFile struct {
+	fullPath string
+	path     string
+	size     int64
+	modTime  time.Time
+}
+
+// ImportDirectory 把srcPath下的所有普通文件导入为对象（见 WriteFromReader），
+// 每个文件第一个块的属性记录路径、大小、修改时间和可选的SHA-256（见 ImportAttributePath 等），
+// 可以用 FindBlocksByAttribute("path", ...) 或 Query 查找。符号链接和其他特殊文件被跳过。
+// 文件的读取和哈希计算在工作池中并行进行，块的写入按文件依次进行。
+// 任一文件失败或ctx取消时停止导入并返回错误，已导入的文件保留，结果中记录已导入的部分
+func (f *FragmentaImpl) ImportDirectory(ctx context.Context, srcPath string, opts *ImportOptions) (*ImportResult, error) {
+	if f.readOnly {
+		return nil, ErrReadOnly
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if opts == nil {
+		opts = &ImportOptions{}
+	}
+	if err := ValidateBlockAttributes(opts.Attributes); err != nil {
+		return nil, err
+	}
+	bufferLimit := opts.BufferLimit
+	if bufferLimit <= 0 {
+		bufferLimit = DefaultImportBufferLimit
+	}
+
+	files, err := collectImportFiles(srcPath, opts)
+	if err != nil {
+		return nil, err
+	}
+	var totalBytes int64
+	for _, file := range files {
+		totalBytes += file.size
+	}
+
+	pool := opts.Pool
+	if pool == nil {
+		workers := opts.Workers
+		if workers <= 0 {
+			workers = runtime.NumCPU()
+		}
+		pool = storage.NewWorkerPool(workers, len(files))
+		defer pool.Close()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// 第一个失败的文件的错误，其他协程随后看到的取消不作为结果
+	var (
+		failure  error
+		failOnce sync.Once
+	)
+	fail := func(err error) error {
+		failOnce.Do(func() {
+			failure = err
+			cancel()
+		})
+		return err
+	}
+
+	result := &ImportResult{Objects: make(map[string]*ObjectHandle, len(files))}
+	var writeMutex sync.Mutex
+
+	err = pool.Map(len(files), func(i int) error {
+		file := files[i]
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		attributes := make(map[string]string, len(opts.Attributes)+4)
+		for key, value := range opts.Attributes {
+			attributes[key] = value
+		}
+		attributes[ImportAttributePath] = file.path
+		attributes[ImportAttributeModTime] = file.modTime.UTC().Format(time.RFC3339Nano)
+
+		// 小文件在工作协程中读入内存并计算哈希
+		var data []byte
+		buffered := file.size <= bufferLimit
+		if buffered {
+			var err error
+			data, err = os.ReadFile(file.fullPath)
+			if err != nil {
+				return fail(fmt.Errorf("读取%s失败: %w", file.path, err))
+			}
+			attributes[ImportAttributeSize] = strconv.Itoa(len(data))
+			if opts.Hash {
+				sum := sha256.Sum256(data)
+				attributes[ImportAttributeSHA256] = hex.EncodeToString(sum[:])
+			}
+		}
+
+		writeMutex.Lock()
+		defer writeMutex.Unlock()
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var handle *ObjectHandle
+		var err error
+		if buffered {
+			handle, err = f.WriteFromReader(bytes.NewReader(data), &BlockOptions{BlockType: NormalBlockType, Checksum: true, Attributes: attributes})
+		} else {
+			handle, err = f.importLargeFile(file, attributes, opts.Hash)
+		}
+		if err != nil {
+			return fail(fmt.Errorf("导入%s失败: %w", file.path, err))
+		}
+
+		result.Files++
+		result.Bytes += handle.Size
+		result.Objects[file.path] = handle
+		if opts.Progress != nil {
+			opts.Progress(ImportProgress{
+				Path:       file.path,
+				Files:      result.Files,
+				TotalFiles: len(files),
+				Bytes:      result.Bytes,
+				TotalBytes: totalBytes,
+			})
+		}
+		return nil
+	})
+
+	if failure != nil {
+		err = failure
+	}
+	if err != nil {
+		logger.Error("导入目录失败", "path", srcPath, "imported", result.Files, "error", err)
+		return result, err
+	}
+
+	logger.Info("已导入目录", "path", srcPath, "files", result.Files, "bytes", result.Bytes)
+	return result, nil
+}
+
+// importLargeFile 流式写入大文件，大小和哈希在写入后设置到第一个块的属性中
+func (f *FragmentaImpl) importLargeFile(file importFile, attributes map[string]string, hash bool) (*ObjectHandle, error) {
+	src, err := os.Open(file.fullPath)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	var reader io.Reader = src
+	hasher := sha256.New()
+	if hash {
+		reader = io.TeeReader(src, hasher)
+	}
+
+	handle, err := f.WriteFromReader(reader, &BlockOptions{BlockType: NormalBlockType, Checksum: true, Attributes: copyAttributes(attributes)})
+	if err != nil {
+		return nil, err
+	}
+
+	attributes[ImportAttributeSize] = strconv.FormatInt(handle.Size, 10)
+	if hash {
+		attributes[ImportAttributeSHA256] = hex.EncodeToString(hasher.Sum(nil))
+	}
+	if err := f.SetBlockAttributes(handle.FirstBlockID, attributes); err != nil {
+		return nil, err
+	}
+	return handle, nil
+}
+
+// collectImportFiles 遍历源目录，返回要导入的普通文件
+func collectImportFiles(srcPath string, opts *ImportOptions) ([]importFile, error) {
+	info, err := os.Stat(srcPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%w: %s不是目录", ErrInvalidArgument, srcPath)
+	}
+
+	var files []importFile
+	err = filepath.WalkDir(srcPath, func(fullPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(srcPath, fullPath)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+
+		if opts.Filter != nil && !opts.Filter(rel, entry) {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, importFile{
+			fullPath: fullPath,
+			path:     path.Join(opts.Prefix, rel),
+			size:     info.Size(),
+			modTime:  info.ModTime(),
+		})
+		return nil
+	})
+	if err != nil {
+		logger.Error("遍历导入目录失败", "path", srcPath, "error", err)
+		return nil, err
+	}
+	return files, nil
+}
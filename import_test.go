@@ -0,0 +1,103 @@
+package fragmenta
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestImportDirectory 测试目录导入
+func TestImportDirectory(t *testing.T) {
+	src := t.TempDir()
+	files := map[string][]byte{
+		"a.txt":         []byte("alpha"),
+		"sub/b.txt":     []byte("bravo"),
+		"sub/deep/c":    bytes.Repeat([]byte("c"), 10000),
+		"skip/ignored":  []byte("ignored"),
+		"sub/empty.txt": nil,
+	}
+	for name, data := range files {
+		full := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := CreateFragmenta(filepath.Join(t.TempDir(), "test.frag"), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	defer f.Close()
+
+	var progress []ImportProgress
+	result, err := f.ImportDirectory(context.Background(), src, &ImportOptions{
+		Prefix:      "backup",
+		Hash:        true,
+		Workers:     3,
+		BufferLimit: 4096,
+		Attributes:  map[string]string{"origin": "import"},
+		Filter: func(path string, entry fs.DirEntry) bool {
+			return path != "skip"
+		},
+		Progress: func(p ImportProgress) { progress = append(progress, p) },
+	})
+	if err != nil {
+		t.Fatalf("导入目录失败: %v", err)
+	}
+	if result.Files != 4 || result.Bytes != 10010 || len(result.Objects) != 4 {
+		t.Fatalf("导入结果不正确: %+v", result)
+	}
+	if len(progress) != 4 || progress[3].Files != 4 || progress[3].TotalBytes != 10010 {
+		t.Errorf("导入进度不正确: %+v", progress)
+	}
+
+	for name, data := range files {
+		if strings.HasPrefix(name, "skip/") {
+			continue
+		}
+		path := "backup/" + name
+		handle, ok := result.Objects[path]
+		if !ok {
+			t.Errorf("缺少导入的文件 %s", path)
+			continue
+		}
+
+		var buf bytes.Buffer
+		if _, err := f.ReadToWriter(context.Background(), handle.FirstBlockID, &buf); err != nil || !bytes.Equal(buf.Bytes(), data) {
+			t.Errorf("%s 的内容不正确: %v", path, err)
+		}
+
+		attrs, _ := f.GetBlockAttributes(handle.FirstBlockID)
+		sum := sha256.Sum256(data)
+		if attrs[ImportAttributePath] != path || attrs[ImportAttributeSHA256] != hex.EncodeToString(sum[:]) ||
+			attrs[ImportAttributeModTime] == "" || attrs["origin"] != "import" {
+			t.Errorf("%s 的属性不正确: %v", path, attrs)
+		}
+	}
+	if attrs, _ := f.GetBlockAttributes(result.Objects["backup/sub/deep/c"].FirstBlockID); attrs[ImportAttributeSize] != "10000" {
+		t.Errorf("流式导入的文件大小属性不正确: %v", attrs)
+	}
+	if found, _ := f.FindBlocksByAttribute(ImportAttributePath, "backup/a.txt"); len(found) != 1 {
+		t.Errorf("应能按路径查找导入的文件: %v", found)
+	}
+
+	// 取消的导入返回ctx的错误
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := f.ImportDirectory(ctx, src, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("取消的导入应返回context.Canceled: %v", err)
+	}
+	if _, err := f.ImportDirectory(context.Background(), filepath.Join(src, "a.txt"), nil); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("源路径不是目录时应返回ErrInvalidArgument: %v", err)
+	}
+}
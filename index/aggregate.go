@@ -0,0 +1,195 @@
+package index
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+)
+
+// 聚合相关错误
+var (
+	ErrAggregateNotFound = errors.New("aggregate not found")
+	ErrAggregateExists   = errors.New("aggregate already exists")
+)
+
+// AggregateFunc 返回标签所属的聚合分组，ok为false时该标签不计入聚合
+type AggregateFunc func(tag uint32) (group string, ok bool)
+
+// AggregateByTag 按标签分组，分组名为标签的十进制值；指定tags时只统计这些标签
+func AggregateByTag(tags ...uint32) AggregateFunc {
+	var allowed map[uint32]struct{}
+	if len(tags) > 0 {
+		allowed = make(map[uint32]struct{}, len(tags))
+		for _, tag := range tags {
+			allowed[tag] = struct{}{}
+		}
+	}
+	return func(tag uint32) (string, bool) {
+		if allowed != nil {
+			if _, ok := allowed[tag]; !ok {
+				return "", false
+			}
+		}
+		return strconv.FormatUint(uint64(tag), 10), true
+	}
+}
+
+// AggregateByTagRange 把[base, base+size)范围内的标签按偏移分组，分组名为偏移的十进制值，
+// 如标签2000起的分类标签用 AggregateByTagRange(2000, 1000) 按分类统计
+func AggregateByTagRange(base, size uint32) AggregateFunc {
+	return func(tag uint32) (string, bool) {
+		if tag < base || tag-base >= size {
+			return "", false
+		}
+		return strconv.FormatUint(uint64(tag-base), 10), true
+	}
+}
+
+// tagAggregate 物化的聚合：每个分组中的ID及其被计入的次数，
+// 同一个ID通过多个标签（或重复索引）进入同一分组时只计一次
+type tagAggregate struct {
+	group  AggregateFunc
+	groups map[string]map[uint32]int
+}
+
+// newTagAggregate 创建聚合
+func newTagAggregate(group AggregateFunc) *tagAggregate {
+	return &tagAggregate{group: group, groups: make(map[string]map[uint32]int)}
+}
+
+// add 计入count次标签和ID
+func (a *tagAggregate) add(tag, id uint32, count int) {
+	name, ok := a.group(tag)
+	if !ok || count <= 0 {
+		return
+	}
+	ids := a.groups[name]
+	if ids == nil {
+		ids = make(map[uint32]int)
+		a.groups[name] = ids
+	}
+	ids[id] += count
+}
+
+// remove 移除count次标签和ID
+func (a *tagAggregate) remove(tag, id uint32, count int) {
+	name, ok := a.group(tag)
+	if !ok || count <= 0 {
+		return
+	}
+	ids := a.groups[name]
+	if ids == nil {
+		return
+	}
+	if ids[id] -= count; ids[id] <= 0 {
+		delete(ids, id)
+	}
+	if len(ids) == 0 {
+		delete(a.groups, name)
+	}
+}
+
+// rebuild 按索引的全部内容重新计算
+func (a *tagAggregate) rebuild(indices map[uint32][]uint32) {
+	a.groups = make(map[string]map[uint32]int)
+	for tag, ids := range indices {
+		for _, id := range ids {
+			a.add(tag, id, 1)
+		}
+	}
+}
+
+// counts 返回每个分组的ID数
+func (a *tagAggregate) counts() map[string]int {
+	result := make(map[string]int, len(a.groups))
+	for name, ids := range a.groups {
+		result[name] = len(ids)
+	}
+	return result
+}
+
+// RegisterAggregate 注册物化聚合，按group把标签映射到分组，统计每个分组中的ID数。
+// 注册时按现有索引计算一次，之后在AddIndex、RemoveIndex等修改索引时增量更新，
+// 读取聚合结果不需要扫描索引
+func (im *IndexManagerImpl) RegisterAggregate(name string, group AggregateFunc) error {
+	if name == "" || group == nil {
+		return errors.New("聚合名称和分组函数不能为空")
+	}
+
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	if _, ok := im.aggregates[name]; ok {
+		return ErrAggregateExists
+	}
+	if im.aggregates == nil {
+		im.aggregates = make(map[string]*tagAggregate)
+	}
+	aggregate := newTagAggregate(group)
+	aggregate.rebuild(im.metadataIndices)
+	im.aggregates[name] = aggregate
+	return nil
+}
+
+// UnregisterAggregate 删除物化聚合
+func (im *IndexManagerImpl) UnregisterAggregate(name string) error {
+	im.mutex.Lock()
+	defer im.mutex.Unlock()
+
+	if _, ok := im.aggregates[name]; !ok {
+		return ErrAggregateNotFound
+	}
+	delete(im.aggregates, name)
+	return nil
+}
+
+// Aggregates 返回已注册的聚合名称
+func (im *IndexManagerImpl) Aggregates() []string {
+	im.mutex.RLock()
+	defer im.mutex.RUnlock()
+
+	names := make([]string, 0, len(im.aggregates))
+	for name := range im.aggregates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AggregateCounts 返回聚合中每个分组的ID数，没有ID的分组不出现
+func (im *IndexManagerImpl) AggregateCounts(name string) (map[string]int, error) {
+	im.mutex.RLock()
+	defer im.mutex.RUnlock()
+
+	aggregate, ok := im.aggregates[name]
+	if !ok {
+		return nil, ErrAggregateNotFound
+	}
+	return aggregate.counts(), nil
+}
+
+// AggregateCount 返回聚合中一个分组的ID数
+func (im *IndexManagerImpl) AggregateCount(name, group string) (int, error) {
+	im.mutex.RLock()
+	defer im.mutex.RUnlock()
+
+	aggregate, ok := im.aggregates[name]
+	if !ok {
+		return 0, ErrAggregateNotFound
+	}
+	return len(aggregate.groups[group]), nil
+}
+
+// aggregateAddLocked 把新索引的标签和ID计入所有聚合，调用方需持有写锁
+func (im *IndexManagerImpl) aggregateAddLocked(tag, id uint32) {
+	for _, aggregate := range im.aggregates {
+		aggregate.add(tag, id, 1)
+	}
+}
+
+// aggregateRemoveLocked 从所有聚合中移除count次标签和ID，调用方需持有写锁
+func (im *IndexManagerImpl) aggregateRemoveLocked(tag, id uint32, count int) {
+	for _, aggregate := range im.aggregates {
+		aggregate.remove(tag, id, count)
+	}
+}
@@ -0,0 +1,100 @@
+package index
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestAggregates 测试物化聚合在索引修改时增量更新，并与重新计算的结果一致
+func TestAggregates(t *testing.T) {
+	im, err := NewIndexManager(&IndexConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 注册前已有的索引在注册时计入
+	for id := uint32(1); id <= 6; id++ {
+		if err := im.AddIndex(2000+id%3, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := im.RegisterAggregate("category", AggregateByTagRange(2000, 1000)); err != nil {
+		t.Fatal(err)
+	}
+	if err := im.RegisterAggregate("tags", AggregateByTag(7, 8)); err != nil {
+		t.Fatal(err)
+	}
+	if err := im.RegisterAggregate("tags", AggregateByTag()); !errors.Is(err, ErrAggregateExists) {
+		t.Errorf("重复注册应返回ErrAggregateExists: %v", err)
+	}
+
+	im.AddIndex(7, 1)
+	im.AddIndex(7, 1) // 重复索引只计一次
+	im.AddIndex(8, 1)
+	im.AddIndex(9, 1)
+	im.BatchAddIndices([]uint32{7, 7, 2001}, []uint32{2, 3, 7})
+
+	counts, err := im.AggregateCounts("tags")
+	if err != nil || !reflect.DeepEqual(counts, map[string]int{"7": 3, "8": 1}) {
+		t.Errorf("标签聚合不正确: %v, %v", counts, err)
+	}
+	if counts, _ := im.AggregateCounts("category"); !reflect.DeepEqual(counts, map[string]int{"0": 2, "1": 3, "2": 2}) {
+		t.Errorf("分类聚合不正确: %v", counts)
+	}
+
+	// 重复索引移除一次后仍计入，全部移除后不再计入
+	im.RemoveIndex(7, 1)
+	if count, _ := im.AggregateCount("tags", "7"); count != 3 {
+		t.Errorf("移除一次重复索引后计数不正确: %d", count)
+	}
+	im.RemoveIndex(7, 1)
+	im.BatchRemoveIndices([]uint32{8, 2001}, []uint32{1, 7})
+	if counts, _ := im.AggregateCounts("tags"); !reflect.DeepEqual(counts, map[string]int{"7": 2}) {
+		t.Errorf("移除后标签聚合不正确: %v", counts)
+	}
+	if count, _ := im.AggregateCount("category", "1"); count != 2 {
+		t.Errorf("移除后分类计数不正确: %d", count)
+	}
+
+	// 加载索引后重新计算
+	path := filepath.Join(t.TempDir(), "index.json")
+	if err := im.SaveIndex(path); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := im.AggregateCounts("category")
+	im.AddIndex(2005, 100)
+	if err := im.LoadIndex(path); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := im.AggregateCounts("category"); !reflect.DeepEqual(after, before) {
+		t.Errorf("加载索引后聚合不正确: %v，期望 %v", after, before)
+	}
+
+	if names := im.Aggregates(); !reflect.DeepEqual(names, []string{"category", "tags"}) {
+		t.Errorf("聚合列表不正确: %v", names)
+	}
+	if err := im.UnregisterAggregate("tags"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := im.AggregateCounts("tags"); !errors.Is(err, ErrAggregateNotFound) {
+		t.Errorf("删除后应返回ErrAggregateNotFound: %v", err)
+	}
+}
+
+// BenchmarkAggregateCounts 测试在10万个索引项上读取物化聚合，不随索引大小增长
+func BenchmarkAggregateCounts(b *testing.B) {
+	im, _ := NewIndexManager(&IndexConfig{})
+	im.RegisterAggregate("category", AggregateByTagRange(2000, 1000))
+	for id := uint32(0); id < 100000; id++ {
+		im.AddIndex(2000+id%50, id)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if counts, _ := im.AggregateCounts("category"); len(counts) != 50 {
+			b.Fatal("聚合结果不正确")
+		}
+	}
+}
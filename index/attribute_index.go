@@ -0,0 +1,195 @@
+package index
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// AttributeIndex 块属性索引
+// 维护 属性键 -> 属性值 -> 块ID集合 的倒排表，支持精确匹配和值前缀匹配。
+// 实现了fragmenta.BlockAttributeIndexer接口，可通过FragDB.SetAttributeIndexer挂接。
+type AttributeIndex struct {
+	// postings 属性倒排表
+	postings map[string]map[string]map[uint32]struct{}
+	// blocks 块ID到其当前属性的映射，用于替换和删除
+	blocks map[uint32]map[string]string
+	// mutex 并发保护
+	mutex sync.RWMutex
+}
+
+// NewAttributeIndex 创建块属性索引
+func NewAttributeIndex() *AttributeIndex {
+	return &AttributeIndex{
+		postings: make(map[string]map[string]map[uint32]struct{}),
+		blocks:   make(map[uint32]map[string]string),
+	}
+}
+
+// IndexBlockAttributes 索引块的属性，替换该块之前的所有属性
+func (ai *AttributeIndex) IndexBlockAttributes(blockID uint32, attributes map[string]string) error {
+	ai.mutex.Lock()
+	defer ai.mutex.Unlock()
+
+	ai.removeLocked(blockID)
+
+	if len(attributes) == 0 {
+		return nil
+	}
+
+	stored := make(map[string]string, len(attributes))
+	for key, value := range attributes {
+		stored[key] = value
+
+		values, ok := ai.postings[key]
+		if !ok {
+			values = make(map[string]map[uint32]struct{})
+			ai.postings[key] = values
+		}
+		ids, ok := values[value]
+		if !ok {
+			ids = make(map[uint32]struct{})
+			values[value] = ids
+		}
+		ids[blockID] = struct{}{}
+	}
+	ai.blocks[blockID] = stored
+
+	return nil
+}
+
+// RemoveBlockAttributes 移除块的所有属性索引
+func (ai *AttributeIndex) RemoveBlockAttributes(blockID uint32) error {
+	ai.mutex.Lock()
+	defer ai.mutex.Unlock()
+
+	ai.removeLocked(blockID)
+	return nil
+}
+
+// removeLocked 移除块的属性（调用方需持有写锁）
+func (ai *AttributeIndex) removeLocked(blockID uint32) {
+	old, ok := ai.blocks[blockID]
+	if !ok {
+		return
+	}
+
+	for key, value := range old {
+		values := ai.postings[key]
+		delete(values[value], blockID)
+		if len(values[value]) == 0 {
+			delete(values, value)
+		}
+		if len(values) == 0 {
+			delete(ai.postings, key)
+		}
+	}
+	delete(ai.blocks, blockID)
+}
+
+// FindByAttribute 查找属性值等于value的块，按块ID升序返回
+func (ai *AttributeIndex) FindByAttribute(key, value string) []uint32 {
+	ai.mutex.RLock()
+	defer ai.mutex.RUnlock()
+
+	return sortedIDs(ai.postings[key][value])
+}
+
+// FindByAttributePrefix 查找属性值以prefix开头的块，按块ID升序返回
+func (ai *AttributeIndex) FindByAttributePrefix(key, prefix string) []uint32 {
+	ai.mutex.RLock()
+	defer ai.mutex.RUnlock()
+
+	merged := make(map[uint32]struct{})
+	for value, ids := range ai.postings[key] {
+		if !strings.HasPrefix(value, prefix) {
+			continue
+		}
+		for id := range ids {
+			merged[id] = struct{}{}
+		}
+	}
+
+	return sortedIDs(merged)
+}
+
+// FindByAttributes 查找同时满足所有属性条件的块，按块ID升序返回
+func (ai *AttributeIndex) FindByAttributes(conditions map[string]string) []uint32 {
+	ai.mutex.RLock()
+	defer ai.mutex.RUnlock()
+
+	var result map[uint32]struct{}
+	for key, value := range conditions {
+		ids := ai.postings[key][value]
+		if len(ids) == 0 {
+			return []uint32{}
+		}
+		if result == nil {
+			result = make(map[uint32]struct{}, len(ids))
+			for id := range ids {
+				result[id] = struct{}{}
+			}
+			continue
+		}
+		for id := range result {
+			if _, ok := ids[id]; !ok {
+				delete(result, id)
+			}
+		}
+	}
+
+	return sortedIDs(result)
+}
+
+// GetAttributes 获取索引中记录的块属性
+func (ai *AttributeIndex) GetAttributes(blockID uint32) map[string]string {
+	ai.mutex.RLock()
+	defer ai.mutex.RUnlock()
+
+	stored, ok := ai.blocks[blockID]
+	if !ok {
+		return nil
+	}
+
+	result := make(map[string]string, len(stored))
+	for key, value := range stored {
+		result[key] = value
+	}
+	return result
+}
+
+// BlockIDs 返回所有带属性的块ID，按升序排列
+func (ai *AttributeIndex) BlockIDs() []uint32 {
+	ai.mutex.RLock()
+	defer ai.mutex.RUnlock()
+
+	ids := make([]uint32, 0, len(ai.blocks))
+	for id := range ai.blocks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// Values 返回某个属性键的所有不同取值，按字典序排列
+func (ai *AttributeIndex) Values(key string) []string {
+	ai.mutex.RLock()
+	defer ai.mutex.RUnlock()
+
+	values := make([]string, 0, len(ai.postings[key]))
+	for value := range ai.postings[key] {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
+
+// sortedIDs 将ID集合转换为升序切片
+func sortedIDs(set map[uint32]struct{}) []uint32 {
+	result := make([]uint32, 0, len(set))
+	for id := range set {
+		result = append(result, id)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
@@ -0,0 +1,46 @@
+package index
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestAttributeIndex 测试块属性索引
+func TestAttributeIndex(t *testing.T) {
+	ai := NewAttributeIndex()
+
+	ai.IndexBlockAttributes(1, map[string]string{"content-type": "text/plain", "tenant": "alpha"})
+	ai.IndexBlockAttributes(2, map[string]string{"content-type": "text/html", "tenant": "alpha"})
+	ai.IndexBlockAttributes(3, map[string]string{"content-type": "image/png", "tenant": "beta"})
+
+	if ids := ai.FindByAttribute("tenant", "alpha"); !reflect.DeepEqual(ids, []uint32{1, 2}) {
+		t.Errorf("精确匹配结果不正确: %v", ids)
+	}
+	if ids := ai.FindByAttributePrefix("content-type", "text/"); !reflect.DeepEqual(ids, []uint32{1, 2}) {
+		t.Errorf("前缀匹配结果不正确: %v", ids)
+	}
+	if ids := ai.FindByAttributes(map[string]string{"tenant": "alpha", "content-type": "text/html"}); !reflect.DeepEqual(ids, []uint32{2}) {
+		t.Errorf("组合匹配结果不正确: %v", ids)
+	}
+	if values := ai.Values("tenant"); !reflect.DeepEqual(values, []string{"alpha", "beta"}) {
+		t.Errorf("属性取值不正确: %v", values)
+	}
+
+	// 替换属性
+	ai.IndexBlockAttributes(2, map[string]string{"tenant": "beta"})
+	if ids := ai.FindByAttribute("content-type", "text/html"); len(ids) != 0 {
+		t.Errorf("替换后旧属性不应再可查: %v", ids)
+	}
+	if ids := ai.FindByAttribute("tenant", "beta"); !reflect.DeepEqual(ids, []uint32{2, 3}) {
+		t.Errorf("替换后查找结果不正确: %v", ids)
+	}
+
+	// 删除
+	ai.RemoveBlockAttributes(3)
+	if attrs := ai.GetAttributes(3); attrs != nil {
+		t.Errorf("删除后不应有属性: %v", attrs)
+	}
+	if ids := ai.FindByAttribute("tenant", "beta"); !reflect.DeepEqual(ids, []uint32{2}) {
+		t.Errorf("删除后查找结果不正确: %v", ids)
+	}
+}
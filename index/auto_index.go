@@ -0,0 +1,164 @@
+package index
+
+import (
+	"slices"
+	"sync"
+)
+
+// TagRule 单个标签的自动索引规则，Match返回true时块被索引到Tag下
+type TagRule struct {
+	// Tag 索引标签
+	Tag uint32
+	// Match 判断块是否属于该标签，data不能修改
+	Match func(id uint32, data []byte) bool
+}
+
+// TagExtractor 按模式从块数据中提取标签，用于标签由内容决定的情况（如记录头中的类型字段）
+type TagExtractor func(id uint32, data []byte) []uint32
+
+// AutoIndexConfig 自动索引配置，Rules和Extract的结果合并去重
+type AutoIndexConfig struct {
+	// Rules 按标签配置的规则
+	Rules []TagRule
+	// Extract 按模式提取标签，nil表示不使用
+	Extract TagExtractor
+}
+
+// AutoIndexer 根据存储写入和删除自动维护索引，满足 storage.BlockHook：
+//
+//	remove := storageManager.AddBlockHook(index.NewAutoIndexer(indexManager, config))
+//
+// 块写入时按规则计算标签，与上次写入的标签比较后批量添加新标签、移除不再匹配的标签；
+// 块删除时移除它的所有标签。索引管理器启用 AsyncUpdate 时更新进入批量缓冲区，
+// 否则同步应用。AutoIndexer只移除自己添加的索引，手动调用 AddIndex 添加的不受影响
+type AutoIndexer struct {
+	manager IndexManager
+
+	mutex   sync.Mutex
+	rules   map[uint32]TagRule
+	extract TagExtractor
+	// 每个块当前由自动索引添加的标签
+	indexed map[uint32][]uint32
+}
+
+// NewAutoIndexer 创建自动索引器，config为nil时没有规则，可以之后用 SetRule 添加
+func NewAutoIndexer(manager IndexManager, config *AutoIndexConfig) *AutoIndexer {
+	a := &AutoIndexer{
+		manager: manager,
+		rules:   make(map[uint32]TagRule),
+		indexed: make(map[uint32][]uint32),
+	}
+	if config != nil {
+		for _, rule := range config.Rules {
+			a.rules[rule.Tag] = rule
+		}
+		a.extract = config.Extract
+	}
+	return a
+}
+
+// SetRule 添加或替换标签的规则，只影响之后的写入
+func (a *AutoIndexer) SetRule(rule TagRule) error {
+	if rule.Match == nil {
+		return ErrInvalidValue
+	}
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.rules[rule.Tag] = rule
+	return nil
+}
+
+// RemoveRule 移除标签的规则，已有的索引保留到块下次写入或删除
+func (a *AutoIndexer) RemoveRule(tag uint32) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.rules, tag)
+}
+
+// SetExtractor 设置按模式提取标签的函数，nil表示不使用
+func (a *AutoIndexer) SetExtractor(extract TagExtractor) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.extract = extract
+}
+
+// BlockWritten 块写入后更新索引，实现 storage.BlockHook
+func (a *AutoIndexer) BlockWritten(id uint32, data []byte) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	tags := a.tagsFor(id, data)
+	old := a.indexed[id]
+	if len(tags) == 0 {
+		delete(a.indexed, id)
+	} else {
+		a.indexed[id] = tags
+	}
+	a.apply(id, difference(tags, old), difference(old, tags))
+}
+
+// BlockDeleted 块删除后移除它的索引，实现 storage.BlockHook
+func (a *AutoIndexer) BlockDeleted(id uint32) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	old := a.indexed[id]
+	delete(a.indexed, id)
+	a.apply(id, nil, old)
+}
+
+// IndexedTags 返回块当前由自动索引添加的标签
+func (a *AutoIndexer) IndexedTags(id uint32) []uint32 {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return slices.Clone(a.indexed[id])
+}
+
+// tagsFor 按规则计算块的标签，结果有序且不重复
+func (a *AutoIndexer) tagsFor(id uint32, data []byte) []uint32 {
+	var tags []uint32
+	for tag, rule := range a.rules {
+		if rule.Match(id, data) {
+			tags = append(tags, tag)
+		}
+	}
+	if a.extract != nil {
+		tags = append(tags, a.extract(id, data)...)
+	}
+	slices.Sort(tags)
+	return slices.Compact(tags)
+}
+
+// apply 批量添加和移除块的标签，失败只记录日志，存储的写入已经完成
+func (a *AutoIndexer) apply(id uint32, added, removed []uint32) {
+	if len(added) > 0 {
+		if err := a.manager.BatchAddIndices(added, repeatID(id, len(added))); err != nil {
+			logger.Error("自动添加索引失败", "id", id, "error", err)
+		}
+	}
+	if len(removed) > 0 {
+		if err := a.manager.BatchRemoveIndices(removed, repeatID(id, len(removed))); err != nil {
+			logger.Error("自动移除索引失败", "id", id, "error", err)
+		}
+	}
+}
+
+// difference 返回在有序切片a中但不在b中的元素
+func difference(a, b []uint32) []uint32 {
+	var out []uint32
+	for _, v := range a {
+		if _, found := slices.BinarySearch(b, v); !found {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// repeatID 返回n个id组成的切片，与标签一一对应
+func repeatID(id uint32, n int) []uint32 {
+	ids := make([]uint32, n)
+	for i := range ids {
+		ids[i] = id
+	}
+	return ids
+}
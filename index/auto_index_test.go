@@ -0,0 +1,122 @@
+package index
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/bpfs/fragmenta/storage"
+)
+
+// TestAutoIndexer 测试存储写入和删除通过块回调自动维护索引
+func TestAutoIndexer(t *testing.T) {
+	sm, err := storage.NewStorageManager(&storage.StorageConfig{
+		Type:      storage.StorageTypeContainer,
+		Path:      filepath.Join(t.TempDir(), "container.db"),
+		BlockSize: 1024,
+	})
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+	defer sm.Close()
+
+	im, err := NewIndexManager(nil)
+	if err != nil {
+		t.Fatalf("创建索引管理器失败: %v", err)
+	}
+
+	// 标签1按规则匹配JSON块，其余标签由数据的第一个字节决定
+	indexer := NewAutoIndexer(im, &AutoIndexConfig{
+		Rules: []TagRule{{Tag: 1, Match: func(_ uint32, data []byte) bool {
+			return bytes.HasPrefix(data, []byte("{"))
+		}}},
+		Extract: func(_ uint32, data []byte) []uint32 {
+			if len(data) == 0 || data[0] == '{' {
+				return nil
+			}
+			return []uint32{100 + uint32(data[0]-'0')}
+		},
+	})
+	remove := sm.AddBlockHook(indexer)
+
+	// 手动添加的索引不受自动索引影响
+	if err := im.AddIndex(1, 9); err != nil {
+		t.Fatalf("添加索引失败: %v", err)
+	}
+
+	expect := func(tag uint32, want ...uint32) {
+		t.Helper()
+		got, _ := im.FindByTag(tag)
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Fatalf("标签%d的索引为%v，期望%v", tag, got, want)
+		}
+	}
+
+	for id, data := range map[uint32]string{1: `{"a":1}`, 2: "2x", 3: "3y"} {
+		if err := sm.WriteBlock(id, []byte(data)); err != nil {
+			t.Fatalf("写入块%d失败: %v", id, err)
+		}
+	}
+	expect(1, 1, 9)
+	expect(102, 2)
+	expect(103, 3)
+
+	// 覆盖写入后移除不再匹配的标签
+	if err := sm.WriteBlock(1, []byte("2z")); err != nil {
+		t.Fatalf("覆盖写入失败: %v", err)
+	}
+	expect(1, 9)
+	expect(102, 1, 2)
+	if got := indexer.IndexedTags(1); !slices.Equal(got, []uint32{102}) {
+		t.Fatalf("块1的自动索引标签为%v", got)
+	}
+
+	if err := sm.DeleteBlock(2); err != nil {
+		t.Fatalf("删除块失败: %v", err)
+	}
+	expect(102, 1)
+
+	// 注销后不再更新索引
+	remove()
+	if err := sm.WriteBlock(4, []byte("{}")); err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	expect(1, 9)
+
+	if err := indexer.SetRule(TagRule{Tag: 2}); err == nil {
+		t.Fatal("没有Match的规则应该返回错误")
+	}
+}
+
+// TestAutoIndexerAsync 测试启用异步更新时自动索引进入批量缓冲区
+func TestAutoIndexerAsync(t *testing.T) {
+	im, err := NewOptimizedIndexManager(&IndexConfig{
+		AsyncUpdate:    true,
+		MaxWorkers:     2,
+		NumShards:      4,
+		BatchThreshold: 1000,
+		UpdateInterval: 60000,
+	})
+	if err != nil {
+		t.Fatalf("创建索引管理器失败: %v", err)
+	}
+
+	indexer := NewAutoIndexer(im, &AutoIndexConfig{
+		Rules: []TagRule{{Tag: 7, Match: func(id uint32, _ []byte) bool { return id%2 == 0 }}},
+	})
+	for id := uint32(0); id < 10; id++ {
+		indexer.BlockWritten(id, nil)
+	}
+	if im.GetPendingTaskCount() == 0 && im.batchBufferSize == 0 {
+		t.Fatal("异步更新应该进入批量缓冲区")
+	}
+
+	im.processBatchBuffer()
+	got, _ := im.FindByTag(7)
+	slices.Sort(got)
+	if !slices.Equal(got, []uint32{0, 2, 4, 6, 8}) {
+		t.Fatalf("标签7的索引为%v", got)
+	}
+}
@@ -0,0 +1,149 @@
+package index
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// DefaultTagFilterFalsePositiveRate 标签布隆过滤器的默认目标误判率
+const DefaultTagFilterFalsePositiveRate = 0.01
+
+// DefaultTagFilterCapacity 标签布隆过滤器默认按多少个不同标签分配空间
+const DefaultTagFilterCapacity = 4096
+
+// tagFilter 分片索引中出现过的标签的布隆过滤器，用于不扫描分片就确定标签不存在。
+// 位数组用原子操作读写，持有任意分片的写锁即可添加。移除索引不会删除分片中的标签键，
+// 因此过滤器只需要添加，LoadIndex 替换分片数据和标签数超过容量时整体重建
+type tagFilter struct {
+	bits     []atomic.Uint64
+	hashes   int
+	capacity int
+	// 添加时改变了位数组的次数，近似于不同标签数
+	added atomic.Int64
+}
+
+// newTagFilter 按容量和目标误判率创建过滤器，rate为0时使用DefaultTagFilterFalsePositiveRate，
+// 小于0时返回nil（禁用）；capacity不大于0时使用DefaultTagFilterCapacity
+func newTagFilter(capacity int, rate float64) *tagFilter {
+	if rate < 0 {
+		return nil
+	}
+	if rate == 0 || rate >= 1 {
+		rate = DefaultTagFilterFalsePositiveRate
+	}
+	if capacity <= 0 {
+		capacity = DefaultTagFilterCapacity
+	}
+
+	// m = -n·ln(p)/ln(2)²，k = m/n·ln(2)
+	m := math.Ceil(-float64(capacity) * math.Log(rate) / (math.Ln2 * math.Ln2))
+	words := max(int(math.Ceil(m/64)), 1)
+	k := int(math.Round(float64(words*64) / float64(capacity) * math.Ln2))
+	return &tagFilter{
+		bits:     make([]atomic.Uint64, words),
+		hashes:   min(max(k, 1), 16),
+		capacity: capacity,
+	}
+}
+
+// positions 用双重哈希依次返回标签对应的位，yield返回false时停止
+func (f *tagFilter) positions(tag uint32, yield func(word int, mask uint64) bool) {
+	h := mix64(uint64(tag))
+	h1, h2 := h&math.MaxUint32, h>>32|1
+	n := uint64(len(f.bits)) * 64
+	for i := range uint64(f.hashes) {
+		bit := (h1 + i*h2) % n
+		if !yield(int(bit/64), 1<<(bit%64)) {
+			return
+		}
+	}
+}
+
+// add 添加标签，返回标签是否可能是新标签（至少改变了一位）。f为nil时不做任何事
+func (f *tagFilter) add(tag uint32) bool {
+	if f == nil {
+		return false
+	}
+	changed := false
+	f.positions(tag, func(word int, mask uint64) bool {
+		if f.bits[word].Load()&mask == 0 {
+			f.bits[word].Or(mask)
+			changed = true
+		}
+		return true
+	})
+	if changed {
+		f.added.Add(1)
+	}
+	return changed
+}
+
+// mayContain 返回标签是否可能存在，false表示一定不存在。f为nil时总是返回true
+func (f *tagFilter) mayContain(tag uint32) bool {
+	if f == nil {
+		return true
+	}
+	found := true
+	f.positions(tag, func(word int, mask uint64) bool {
+		found = f.bits[word].Load()&mask != 0
+		return found
+	})
+	return found
+}
+
+// full 返回添加的标签是否已超过容量，超过后误判率会高于目标值
+func (f *tagFilter) full() bool {
+	return f != nil && f.added.Load() > int64(f.capacity)
+}
+
+// mix64 64位整数哈希（splitmix64的最终混合步骤）
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// noteTag 在发布含有新标签的视图之前记录标签，调用方需持有publishMutex。过滤器已满时在后台按更大的容量重建
+func (im *OptimizedIndexManager) noteTag(tag uint32) {
+	f := im.tagFilter.Load()
+	if f.add(tag) && f.full() && im.tagFilterRebuilding.CompareAndSwap(false, true) {
+		go func() {
+			defer im.tagFilterRebuilding.Store(false)
+			im.publishMutex.Lock()
+			defer im.publishMutex.Unlock()
+			im.rebuildTagFilter(im.readView())
+		}()
+	}
+}
+
+// mayHaveTag 返回标签是否可能存在于某个分片，false时不需要扫描分片
+func (im *OptimizedIndexManager) mayHaveTag(tag uint32) bool {
+	return im.tagFilter.Load().mayContain(tag)
+}
+
+// rebuildTagFilter 按视图中的标签重建过滤器，容量至少为标签数的两倍。
+// 调用方需持有publishMutex并传入当前视图，保证重建期间没有发布新的标签
+func (im *OptimizedIndexManager) rebuildTagFilter(view *indexView) {
+	if im.tagFilter.Load() == nil {
+		return
+	}
+	tags := make(map[uint32]struct{})
+	for _, tagMap := range view.shards {
+		for tag := range tagMap {
+			tags[tag] = struct{}{}
+		}
+	}
+
+	capacity := im.config.TagFilterCapacity
+	if capacity <= 0 {
+		capacity = DefaultTagFilterCapacity
+	}
+	f := newTagFilter(max(capacity, 2*len(tags)), im.config.TagFilterFalsePositiveRate)
+	for tag := range tags {
+		f.add(tag)
+	}
+	im.tagFilter.Store(f)
+}
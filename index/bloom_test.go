@@ -0,0 +1,137 @@
+package index
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestTagFilter 测试布隆过滤器没有漏判、误判率接近目标值，以及禁用时的行为
+func TestTagFilter(t *testing.T) {
+	const n = 10000
+	for _, rate := range []float64{0.1, 0.01, 0.001} {
+		f := newTagFilter(n, rate)
+		for tag := uint32(0); tag < n; tag++ {
+			f.add(tag)
+		}
+		for tag := uint32(0); tag < n; tag++ {
+			if !f.mayContain(tag) {
+				t.Fatalf("rate %v: tag %d not found", rate, tag)
+			}
+		}
+
+		falsePositives := 0
+		const probes = 100000
+		for tag := uint32(n); tag < n+probes; tag++ {
+			if f.mayContain(tag) {
+				falsePositives++
+			}
+		}
+		if got := float64(falsePositives) / probes; got > 2*rate {
+			t.Errorf("rate %v: false positive rate %v", rate, got)
+		}
+		if f.full() {
+			t.Errorf("rate %v: filter full after %d tags", rate, n)
+		}
+	}
+
+	disabled := newTagFilter(n, -1)
+	if disabled != nil {
+		t.Fatal("negative rate should disable the filter")
+	}
+	if disabled.add(1) || !disabled.mayContain(1) || disabled.full() {
+		t.Error("disabled filter should accept every tag")
+	}
+}
+
+// TestOptimizedIndexTagFilter 测试不存在的标签不扫描分片，过滤器满时自动扩容，LoadIndex 后重建
+func TestOptimizedIndexTagFilter(t *testing.T) {
+	im, err := NewOptimizedIndexManager(&IndexConfig{NumShards: 4, MaxWorkers: 1, TagFilterCapacity: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer im.Close()
+
+	const tags = 100
+	for tag := uint32(1); tag <= tags; tag++ {
+		if err := im.AddIndex(tag, tag*10); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := im.BatchAddIndices([]uint32{tags + 1, tags + 1}, []uint32{1, 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 超过容量后在后台按更大的容量重建
+	deadline := time.Now().Add(5 * time.Second)
+	for im.tagFilter.Load().capacity < 2*tags {
+		if time.Now().After(deadline) {
+			t.Fatalf("filter not rebuilt, capacity %d", im.tagFilter.Load().capacity)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for tag := uint32(1); tag <= tags+1; tag++ {
+		if _, err := im.FindByKey(tag); err != nil {
+			t.Fatalf("tag %d: %v", tag, err)
+		}
+	}
+
+	// 过滤器排除的标签不访问任何分片
+	var missing uint32 = 1 << 20
+	for im.mayHaveTag(missing) {
+		missing++
+	}
+	before := im.shardStatusSnapshot()
+	if _, err := im.FindByKey(missing); !errors.Is(err, ErrIndexNotFound) {
+		t.Fatalf("missing tag: %v", err)
+	}
+	for shardID, status := range im.shardStatusSnapshot() {
+		if status.ReadCount != before[shardID].ReadCount {
+			t.Errorf("shard %d read for a missing tag", shardID)
+		}
+	}
+
+	// 移除索引后标签仍然存在，返回空结果
+	if err := im.RemoveIndex(1, 10); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := im.FindByKey(1); err != nil || len(ids) != 0 {
+		t.Errorf("removed tag: %v, %v", ids, err)
+	}
+
+	// LoadIndex 按加载的标签重建过滤器
+	path := filepath.Join(t.TempDir(), "index.json")
+	if err := im.SaveIndex(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := NewOptimizedIndexManager(&IndexConfig{NumShards: 4, MaxWorkers: 1, IndexPath: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loaded.Close()
+	for tag := uint32(2); tag <= tags+1; tag++ {
+		if !loaded.mayHaveTag(tag) {
+			t.Fatalf("loaded filter missing tag %d", tag)
+		}
+	}
+
+	// 禁用过滤器时仍然扫描分片
+	disabled, err := NewOptimizedIndexManager(&IndexConfig{NumShards: 4, MaxWorkers: 1, TagFilterFalsePositiveRate: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer disabled.Close()
+	if disabled.tagFilter.Load() != nil {
+		t.Error("filter should be disabled")
+	}
+	if err := disabled.AddIndex(7, 1); err != nil {
+		t.Fatal(err)
+	}
+	if ids, err := disabled.FindByKey(7); err != nil || len(ids) != 1 {
+		t.Errorf("disabled filter: %v, %v", ids, err)
+	}
+	if _, err := disabled.FindByKey(8); !errors.Is(err, ErrIndexNotFound) {
+		t.Errorf("disabled filter missing tag: %v", err)
+	}
+}
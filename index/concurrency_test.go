@@ -0,0 +1,406 @@
+package index
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+)
+
+// TestOptimizedIndexConcurrentAccess 测试同步、异步和批量更新与查询、状态读取并发执行，
+// 需要在 -race 下运行才能发现未加锁的共享状态
+func TestOptimizedIndexConcurrentAccess(t *testing.T) {
+	fakeClock := clock.NewFake(time.Unix(1700000000, 0))
+	im, err := NewOptimizedIndexManager(&IndexConfig{
+		AsyncUpdate:    true,
+		MaxWorkers:     4,
+		NumShards:      4,
+		BatchThreshold: 8,
+		UpdateInterval: 10,
+		Clock:          fakeClock,
+	})
+	if err != nil {
+		t.Fatalf("创建索引管理器失败: %v", err)
+	}
+
+	const (
+		goroutines = 8
+		iterations = 200
+	)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				tag := uint32(i % 7)
+				id := uint32(g*iterations + i)
+				switch i % 6 {
+				case 0:
+					im.AddIndex(tag, id)
+				case 1:
+					im.AsyncAddIndex(tag, id)
+				case 2:
+					im.BatchAddIndices([]uint32{tag, tag + 1}, []uint32{id, id})
+				case 3:
+					im.RemoveIndex(tag, id-3)
+				case 4:
+					im.FindByTag(tag)
+					im.FindByPattern(fmt.Sprintf("%d", tag))
+				case 5:
+					status := im.GetStatus()
+					for _, shard := range status.ShardStatus {
+						_ = shard.LastAccess
+					}
+					im.GetIndexMetadata()
+					im.GetPendingTaskCount()
+				}
+			}
+		}(g)
+	}
+
+	// 推进时钟触发批处理定时器，让后台协程与前台调用并发执行
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+			fakeClock.Advance(10 * time.Millisecond)
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// 处理剩余的异步任务后，所有同步添加的条目都应可查询
+	if err := im.UpdateIndices(); err != nil {
+		t.Fatalf("处理异步更新失败: %v", err)
+	}
+	ids, err := im.FindByTag(0)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	found := make(map[uint32]bool, len(ids))
+	for _, id := range ids {
+		found[id] = true
+	}
+	for g := 0; g < goroutines; g++ {
+		// i=42时 i%6==0 且 i%7==0，同步添加到标签0，之后没有协程删除它
+		if id := uint32(g*iterations + 42); !found[id] {
+			t.Errorf("同步添加的条目%d丢失", id)
+		}
+	}
+}
+
+// TestIndexManagerConcurrentAccess 测试基础索引管理器的更新与前缀、范围查询并发执行
+func TestIndexManagerConcurrentAccess(t *testing.T) {
+	im, err := NewIndexManager(&IndexConfig{})
+	if err != nil {
+		t.Fatalf("创建索引管理器失败: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				tag := uint32(i % 5)
+				id := uint32(g*200 + i)
+				switch i % 4 {
+				case 0:
+					im.AddIndex(tag, id)
+				case 1:
+					im.BatchAddIndices([]uint32{tag}, []uint32{id})
+				case 2:
+					im.FindByPrefix(tag, "1")
+					im.FindByRange(tag, 0, 100)
+					im.GetPrefixTree(tag + 10)
+				case 3:
+					im.RemoveIndex(tag, id-3)
+					im.GetStatus()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	ids, err := im.FindByTag(0)
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if len(ids) == 0 {
+		t.Error("并发添加后标签0应有条目")
+	}
+}
+
+// TestOptimizedIndexSnapshotIsolation 测试查询不会看到只完成了一部分分片的批量写入
+func TestOptimizedIndexSnapshotIsolation(t *testing.T) {
+	im, err := NewOptimizedIndexManager(&IndexConfig{NumShards: 8, MaxWorkers: 4})
+	if err != nil {
+		t.Fatalf("创建索引管理器失败: %v", err)
+	}
+
+	// 每批ID覆盖所有分片，同时写入两个标签
+	const batch = 64
+	tags := make([]uint32, 0, 2*batch)
+	ids := make([]uint32, 0, 2*batch)
+	for i := uint32(0); i < batch; i++ {
+		tags = append(tags, 1, 2)
+		ids = append(ids, i, i)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			im.BatchAddIndices(tags, ids)
+			im.BatchRemoveIndices(tags, ids)
+		}
+	}()
+
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+
+		if found, _ := im.FindByTag(1); len(found) != 0 && len(found) != batch {
+			t.Fatalf("查询看到了部分批量写入: %d", len(found))
+		}
+		found, _ := im.FindCompound([]IndexQueryCondition{
+			{Tag: 1, Operation: "eq"},
+			{Tag: 2, Operation: "range", Value: []uint32{0, batch}},
+		})
+		if len(found) != 0 && len(found) != batch {
+			t.Fatalf("复合查询的条件来自不同的索引状态: %d", len(found))
+		}
+	}
+}
+
+// TestOptimizedIndexQueueBackpressure 测试异步更新队列的容量限制和统计
+func TestOptimizedIndexQueueBackpressure(t *testing.T) {
+	// 拒绝模式：队列已满时返回ErrQueueFull
+	im, err := NewOptimizedIndexManager(&IndexConfig{NumShards: 2, MaxWorkers: 2, MaxQueueSize: 3})
+	if err != nil {
+		t.Fatalf("创建索引管理器失败: %v", err)
+	}
+	for id := uint32(0); id < 3; id++ {
+		if err := im.AsyncAddIndex(1, id); err != nil {
+			t.Fatalf("入队失败: %v", err)
+		}
+	}
+	if err := im.AsyncAddIndex(1, 3); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("队列已满时应该返回ErrQueueFull，实际为%v", err)
+	}
+	status := im.GetStatus()
+	if status.PendingUpdates != 3 || status.QueuePeakDepth != 3 || status.QueueCapacity != 3 || status.RejectedUpdates != 1 {
+		t.Fatalf("队列统计不正确: %+v", status)
+	}
+
+	// 阻塞模式：调用者等待空位，并触发队列处理
+	im, err = NewOptimizedIndexManager(&IndexConfig{
+		NumShards:       2,
+		MaxWorkers:      2,
+		MaxQueueSize:    2,
+		QueueFullPolicy: QueueBlock,
+	})
+	if err != nil {
+		t.Fatalf("创建索引管理器失败: %v", err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for id := uint32(0); id < 20; id++ {
+			if err := im.AsyncAddIndex(1, id); err != nil {
+				t.Errorf("入队失败: %v", err)
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("阻塞的调用者没有被唤醒")
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		im.processUpdateQueue()
+		if found, _ := im.FindByTag(1); len(found) == 20 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("队列中的任务没有全部处理")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	status = im.GetStatus()
+	if status.QueuePeakDepth > 2 || status.RejectedUpdates != 0 {
+		t.Fatalf("队列统计不正确: %+v", status)
+	}
+}
+
+// slowClock 每次读取时间前等待一段时间，用来让索引任务执行得慢
+type slowClock struct {
+	clock.Clock
+	delay time.Duration
+}
+
+// Now 等待delay后返回当前时间
+func (c slowClock) Now() time.Time {
+	time.Sleep(c.delay)
+	return c.Clock.Now()
+}
+
+// TestOptimizedIndexQueueBlockGoroutines 测试多个调用者等待空位时只有一个协程处理队列
+func TestOptimizedIndexQueueBlockGoroutines(t *testing.T) {
+	im, err := NewOptimizedIndexManager(&IndexConfig{
+		NumShards:       2,
+		MaxWorkers:      1,
+		MaxQueueSize:    1,
+		QueueFullPolicy: QueueBlock,
+		Clock:           slowClock{Clock: clock.System, delay: 50 * time.Microsecond},
+	})
+	if err != nil {
+		t.Fatalf("创建索引管理器失败: %v", err)
+	}
+
+	const callers = 20
+	const perCaller = 20
+	base := runtime.NumGoroutine()
+	var peak atomic.Int64
+	stop := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		for {
+			if n := int64(runtime.NumGoroutine()); n > peak.Load() {
+				peak.Store(n)
+			}
+			select {
+			case <-stop:
+				return
+			default:
+				runtime.Gosched()
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for c := 0; c < callers; c++ {
+		wg.Add(1)
+		go func(c int) {
+			defer wg.Done()
+			for i := 0; i < perCaller; i++ {
+				if err := im.AsyncAddIndex(1, uint32(c*perCaller+i)); err != nil {
+					t.Errorf("入队失败: %v", err)
+				}
+			}
+		}(c)
+	}
+	wg.Wait()
+	close(stop)
+	<-sampled
+
+	// 调用者之外只有采样协程、队列处理协程和执行任务的协程，它们交接时会短暂重叠。
+	// 每次唤醒都启动处理协程时峰值远超这个数
+	if limit := int64(base + callers + 10); peak.Load() > limit {
+		t.Errorf("协程数峰值%d超过%d", peak.Load(), limit)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if found, _ := im.FindByTag(1); len(found) == callers*perCaller {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("队列中的任务没有全部处理")
+		}
+		im.processUpdateQueue()
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// stallClock 在被调用指定次数后阻塞一次Now，用来让查询停在执行过程中
+type stallClock struct {
+	clock.Clock
+	skip    atomic.Int32
+	armed   atomic.Bool
+	stalled chan struct{}
+	resume  chan struct{}
+}
+
+// Now 返回当前时间，启用后跳过skip次调用，在下一次调用中阻塞直到resume关闭
+func (c *stallClock) Now() time.Time {
+	if c.armed.Load() && c.skip.Add(-1) < 0 && c.armed.CompareAndSwap(true, false) {
+		close(c.stalled)
+		<-c.resume
+	}
+	return c.Clock.Now()
+}
+
+// TestOptimizedIndexWriteDuringQuery 测试查询执行期间写入不被阻塞，查询仍看到开始时的索引状态
+func TestOptimizedIndexWriteDuringQuery(t *testing.T) {
+	stall := &stallClock{
+		Clock:   clock.NewFake(time.Unix(1700000000, 0)),
+		stalled: make(chan struct{}),
+		resume:  make(chan struct{}),
+	}
+	im, err := NewOptimizedIndexManager(&IndexConfig{NumShards: 4, MaxWorkers: 1, Clock: stall})
+	if err != nil {
+		t.Fatalf("创建索引管理器失败: %v", err)
+	}
+	for id := uint32(0); id < 8; id++ {
+		if err := im.AddIndex(1, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 查询开始时记录一次时间，取得读视图后在第一个分片的访问统计处停住
+	stall.skip.Store(1)
+	stall.armed.Store(true)
+	type queryResult struct {
+		found map[uint32][]uint32
+		err   error
+	}
+	query := make(chan queryResult, 1)
+	go func() {
+		found, err := im.FindByPattern("1")
+		query <- queryResult{found, err}
+	}()
+	<-stall.stalled
+
+	// 查询进行中，覆盖所有分片的批量写入应能完成
+	written := make(chan error, 1)
+	go func() {
+		written <- im.BatchAddIndices([]uint32{1, 1, 1, 1}, []uint32{100, 101, 102, 103})
+	}()
+	select {
+	case err := <-written:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		close(stall.resume)
+		t.Fatal("查询进行中写入被阻塞")
+	}
+	if ids, err := im.FindByTag(1); err != nil || len(ids) != 12 {
+		t.Fatalf("写入后的查询结果不正确: %v, %v", ids, err)
+	}
+
+	// 进行中的查询看到的是开始时的索引状态
+	close(stall.resume)
+	result := <-query
+	if result.err != nil || len(result.found[1]) != 8 {
+		t.Errorf("进行中的查询不应看到之后的写入: %v, %v", result.found, result.err)
+	}
+}
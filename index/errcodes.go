@@ -0,0 +1,29 @@
+package index
+
+import "github.com/bpfs/fragmenta/errcode"
+
+// init 登记索引错误的错误码
+func init() {
+	errcode.Register(ErrIndexNotFound, "index.not_found", "索引不存在", "index not found")
+	errcode.Register(ErrInvalidTag, "index.invalid_tag", "无效的标签", "invalid tag")
+	errcode.Register(ErrInvalidPattern, "index.invalid_pattern", "无效的模式", "invalid pattern")
+	errcode.Register(ErrIndexCorrupted, "index.corrupted", "索引已损坏", "index corrupted")
+	errcode.Register(ErrIndexLocked, "index.locked", "索引被其他进程锁定", "index locked by another process")
+	errcode.Register(ErrIndexBusy, "index.busy", "索引正在更新", "index is already updating")
+	errcode.Register(ErrLengthMismatch, "index.length_mismatch", "标签和ID数组长度不匹配", "tags and ids length mismatch")
+	errcode.Register(ErrNoConditions, "index.no_conditions", "没有提供查询条件", "no conditions provided")
+	errcode.Register(ErrQueueFull, "index.queue_full", "索引更新队列已满", "index update queue is full")
+	errcode.Register(ErrInvalidQuery, "index.invalid_query", "无效的查询语句", "invalid query")
+	errcode.Register(ErrUnsupportedOperator, "index.unsupported_operator", "不支持的操作符", "unsupported operator")
+	errcode.Register(ErrInvalidValue, "index.invalid_value", "无效的值", "invalid value")
+	errcode.Register(ErrInvalidFieldType, "index.invalid_field_type", "无效的字段类型", "invalid field type")
+	errcode.Register(ErrSyntaxError, "index.syntax_error", "查询语法错误", "query syntax error")
+	errcode.Register(ErrMetadataNotFound, "index.metadata_not_found", "未找到元数据", "metadata not found")
+	errcode.Register(ErrSegmentSealed, "index.segment_sealed", "时间段已封存", "time segment sealed")
+	errcode.Register(ErrAggregateNotFound, "index.aggregate_not_found", "聚合不存在", "aggregate not found")
+	errcode.Register(ErrAggregateExists, "index.aggregate_exists", "聚合已存在", "aggregate already exists")
+	errcode.Register(ErrTokenizerNotFound, "index.tokenizer_not_found", "分词器不存在", "tokenizer not found")
+	errcode.Register(ErrIndexNotBuilt, "index.fulltext_not_built", "全文索引尚未建立", "full-text index not built")
+	errcode.Register(ErrUnsupportedTokenizer, "index.unsupported_tokenizer", "不支持的分词器", "unsupported tokenizer")
+	errcode.Register(ErrInvalidSearchExpression, "index.invalid_search_expression", "无效的搜索表达式", "invalid search expression")
+}
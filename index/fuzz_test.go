@@ -0,0 +1,90 @@
+package index
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// FuzzParseQueryString 测试任意查询字符串的解析和执行都不会panic
+func FuzzParseQueryString(f *testing.F) {
+	for _, seed := range []string{
+		`name=="report.pdf"`,
+		"owner not in [alice, bob] and block.size>100; sort: -block.size; limit: 10",
+		"date:block.created between 2025-01-01T00:00:00Z and 2025-01-02T00:00:00Z",
+		"tag:meta==7 or not exists owner; select: name, owner",
+		"block.id in (owner==alice; select: block.id)",
+		"geo:location within 1km of 39.9,116.4",
+		"(a==1 or (b==2 and c!=3)); offset: 1; limit: 2",
+		"exists block.id; offset: 1; limit: 9223372036854775807",
+		"", ";", "((", "[", "name in [", "a between", "; sort:", "x in (#0)",
+	} {
+		f.Add(seed)
+	}
+
+	im, err := NewIndexManager(nil)
+	if err != nil {
+		f.Fatal(err)
+	}
+	qs := NewQueryService(im)
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for id := uint32(1); id <= 3; id++ {
+		qs.IndexBlock(id, uint8(id), id*100, created.Add(time.Duration(id)*time.Hour))
+		qs.IndexBlockAttributes(id, map[string]string{"name": "n" + string(rune('a'+id)), "owner": "alice"})
+		im.IndexMetadata(id, []uint32{7})
+	}
+
+	planned, err := NewPlannedQueryExecutor(im, qs, nil)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Fuzz(func(t *testing.T, queryString string) {
+		NewFullTextQueryExecutor(im, nil).ParseQueryString(queryString)
+		if query, err := planned.ParseQueryString(queryString); err == nil {
+			planned.Execute(query)
+		}
+		qs.Query(queryString)
+	})
+}
+
+// FuzzLoadIndex 测试加载任意内容的索引文件不会panic，加载成功后索引可以正常使用
+func FuzzLoadIndex(f *testing.F) {
+	f.Add([]byte(`{"metadata_indices":{"1":[1,2]},"content_indices":{"a":[3]},"last_update_time":"2025-01-01T00:00:00Z"}`))
+	f.Add([]byte(`null`))
+	f.Add([]byte(`{}`))
+	f.Add([]byte(`{"metadata_indices":null}`))
+	f.Add([]byte(`{"metadata_indices":{"1":null}}`))
+
+	path := filepath.Join(f.TempDir(), "index.json")
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		im, err := NewIndexManager(&IndexConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		im.RegisterAggregate("tags", AggregateByTag())
+		if err := im.LoadIndex(path); err != nil {
+			return
+		}
+
+		if err := im.BatchAddIndices([]uint32{2, 3}, []uint32{4, 5}); err != nil {
+			t.Fatalf("加载后批量添加索引失败: %v", err)
+		}
+		if err := im.AddIndex(1, 100); err != nil {
+			t.Fatalf("加载后添加索引失败: %v", err)
+		}
+		im.RemoveIndex(1, 100)
+		im.FindByKey(1)
+		im.FindByPattern("a")
+		im.FindByRange(0, 10, 20)
+		im.GetStatus()
+		im.OptimizeIndex()
+		if err := im.SaveIndex(path); err != nil {
+			t.Fatalf("加载后保存索引失败: %v", err)
+		}
+	})
+}
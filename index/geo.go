@@ -0,0 +1,496 @@
+package index
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 地理位置相关常量
+const (
+	// EarthRadius 地球平均半径（米），用于计算球面距离
+	EarthRadius = 6371008.8
+
+	// geohashAlphabet geohash使用的base32字母表
+	geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+	// geohashPrecision 索引中保存的geohash长度（约3.7厘米）
+	geohashPrecision = 12
+	// maxGeoCoverCells 查询时覆盖矩形区域的最大geohash单元数
+	maxGeoCoverCells = 32
+)
+
+// GeoPoint 地理位置（WGS84经纬度，单位为度）
+type GeoPoint struct {
+	Lat float64
+	Lon float64
+}
+
+// String 返回 "纬度,经度" 形式，可以由ParseGeoPoint解析
+func (p GeoPoint) String() string {
+	return strconv.FormatFloat(p.Lat, 'f', -1, 64) + "," + strconv.FormatFloat(p.Lon, 'f', -1, 64)
+}
+
+// Valid 经纬度是否在有效范围内
+func (p GeoPoint) Valid() bool {
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lon >= -180 && p.Lon <= 180
+}
+
+// DistanceTo 返回到另一位置的球面距离（米，haversine公式）
+func (p GeoPoint) DistanceTo(q GeoPoint) float64 {
+	lat1 := p.Lat * math.Pi / 180
+	lat2 := q.Lat * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (q.Lon - p.Lon) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(h)))
+}
+
+// Geohash 返回指定长度（1-12）的geohash
+func (p GeoPoint) Geohash(precision int) string {
+	precision = min(max(precision, 1), geohashPrecision)
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+
+	hash := make([]byte, 0, precision)
+	bits, ch := 0, 0
+	even := true
+	for len(hash) < precision {
+		var value float64
+		var bounds *[2]float64
+		if even {
+			value, bounds = p.Lon, &lonRange
+		} else {
+			value, bounds = p.Lat, &latRange
+		}
+		mid := (bounds[0] + bounds[1]) / 2
+		ch <<= 1
+		if value >= mid {
+			ch |= 1
+			bounds[0] = mid
+		} else {
+			bounds[1] = mid
+		}
+		even = !even
+
+		if bits++; bits == 5 {
+			hash = append(hash, geohashAlphabet[ch])
+			bits, ch = 0, 0
+		}
+	}
+	return string(hash)
+}
+
+// GeoBox 经纬度矩形区域，MinLon大于MaxLon时表示跨越180度经线的区域
+type GeoBox struct {
+	MinLat float64
+	MinLon float64
+	MaxLat float64
+	MaxLon float64
+}
+
+// Contains 位置是否在区域内（含边界）
+func (b GeoBox) Contains(p GeoPoint) bool {
+	if p.Lat < b.MinLat || p.Lat > b.MaxLat {
+		return false
+	}
+	if b.MinLon <= b.MaxLon {
+		return p.Lon >= b.MinLon && p.Lon <= b.MaxLon
+	}
+	return p.Lon >= b.MinLon || p.Lon <= b.MaxLon
+}
+
+// split 把跨越180度经线的区域拆成两个不跨越的区域
+func (b GeoBox) split() []GeoBox {
+	if b.MinLon <= b.MaxLon {
+		return []GeoBox{b}
+	}
+	return []GeoBox{
+		{MinLat: b.MinLat, MinLon: b.MinLon, MaxLat: b.MaxLat, MaxLon: 180},
+		{MinLat: b.MinLat, MinLon: -180, MaxLat: b.MaxLat, MaxLon: b.MaxLon},
+	}
+}
+
+// GeoCircle 以Center为圆心、Radius（米）为半径的圆形区域
+type GeoCircle struct {
+	Center GeoPoint
+	Radius float64
+}
+
+// Contains 位置到圆心的距离是否不超过半径
+func (c GeoCircle) Contains(p GeoPoint) bool {
+	return c.Center.DistanceTo(p) <= c.Radius
+}
+
+// Bounds 返回包含圆形区域的矩形区域，圆覆盖极点时经度取整个范围
+func (c GeoCircle) Bounds() GeoBox {
+	dLat := c.Radius / EarthRadius * 180 / math.Pi
+	box := GeoBox{
+		MinLat: math.Max(c.Center.Lat-dLat, -90),
+		MaxLat: math.Min(c.Center.Lat+dLat, 90),
+		MinLon: -180,
+		MaxLon: 180,
+	}
+	if box.MinLat == -90 || box.MaxLat == 90 {
+		return box
+	}
+
+	// 圆上经度差最大的点的经度差
+	sinRatio := math.Sin(c.Radius/EarthRadius) / math.Cos(c.Center.Lat*math.Pi/180)
+	if sinRatio >= 1 {
+		return box
+	}
+	dLon := math.Asin(sinRatio) * 180 / math.Pi
+	box.MinLon = c.Center.Lon - dLon
+	box.MaxLon = c.Center.Lon + dLon
+	if box.MinLon < -180 {
+		box.MinLon += 360
+	}
+	if box.MaxLon > 180 {
+		box.MaxLon -= 360
+	}
+	return box
+}
+
+// ParseGeoPoint 解析 "纬度,经度" 形式的位置，或者geohash（取单元的中心）
+func ParseGeoPoint(s string) (GeoPoint, error) {
+	s = strings.TrimSpace(s)
+	if lat, lon, ok := strings.Cut(s, ","); ok {
+		var p GeoPoint
+		var err error
+		if p.Lat, err = strconv.ParseFloat(strings.TrimSpace(lat), 64); err != nil {
+			return GeoPoint{}, fmt.Errorf("无效的纬度: %s", lat)
+		}
+		if p.Lon, err = strconv.ParseFloat(strings.TrimSpace(lon), 64); err != nil {
+			return GeoPoint{}, fmt.Errorf("无效的经度: %s", lon)
+		}
+		if !p.Valid() {
+			return GeoPoint{}, fmt.Errorf("经纬度超出范围: %s", s)
+		}
+		return p, nil
+	}
+
+	box, err := geohashBox(s)
+	if err != nil {
+		return GeoPoint{}, err
+	}
+	return GeoPoint{Lat: (box.MinLat + box.MaxLat) / 2, Lon: (box.MinLon + box.MaxLon) / 2}, nil
+}
+
+// geohashBox 返回geohash单元的矩形区域
+func geohashBox(hash string) (GeoBox, error) {
+	if hash == "" || len(hash) > geohashPrecision {
+		return GeoBox{}, fmt.Errorf("无效的geohash: %q", hash)
+	}
+	box := GeoBox{MinLat: -90, MaxLat: 90, MinLon: -180, MaxLon: 180}
+	even := true
+	for i := 0; i < len(hash); i++ {
+		ch := strings.IndexByte(geohashAlphabet, hash[i])
+		if ch < 0 {
+			return GeoBox{}, fmt.Errorf("无效的geohash: %q", hash)
+		}
+		for bit := 4; bit >= 0; bit-- {
+			set := ch>>bit&1 == 1
+			if even {
+				mid := (box.MinLon + box.MaxLon) / 2
+				if set {
+					box.MinLon = mid
+				} else {
+					box.MaxLon = mid
+				}
+			} else {
+				mid := (box.MinLat + box.MaxLat) / 2
+				if set {
+					box.MinLat = mid
+				} else {
+					box.MaxLat = mid
+				}
+			}
+			even = !even
+		}
+	}
+	return box, nil
+}
+
+// toGeoPoint 把字段值转换为地理位置，支持GeoPoint和 "纬度,经度" 形式的字符串
+func toGeoPoint(value interface{}) (GeoPoint, bool) {
+	switch v := value.(type) {
+	case GeoPoint:
+		return v, v.Valid()
+	case *GeoPoint:
+		if v == nil {
+			return GeoPoint{}, false
+		}
+		return *v, v.Valid()
+	case string:
+		if !strings.Contains(v, ",") {
+			return GeoPoint{}, false
+		}
+		p, err := ParseGeoPoint(v)
+		return p, err == nil
+	default:
+		return GeoPoint{}, false
+	}
+}
+
+// geoEntry 地理索引中的一项
+type geoEntry struct {
+	hash string
+	id   uint32
+}
+
+// GeoIndex 地理位置索引
+// 每个字段维护按geohash排序的位置列表，区域查询用若干geohash单元覆盖区域，
+// 对每个单元按前缀二分查找候选，再由调用方按精确的区域验证。
+type GeoIndex struct {
+	// fields 字段到按(geohash, ID)排序的位置列表
+	fields map[string][]geoEntry
+	// blocks 块ID到其已索引位置的映射，用于替换和删除
+	blocks map[uint32]map[string]GeoPoint
+	// mutex 并发保护
+	mutex sync.RWMutex
+}
+
+// NewGeoIndex 创建地理位置索引
+func NewGeoIndex() *GeoIndex {
+	return &GeoIndex{
+		fields: make(map[string][]geoEntry),
+		blocks: make(map[uint32]map[string]GeoPoint),
+	}
+}
+
+// IndexBlockPoints 索引块的位置字段，替换该块之前的所有位置
+func (gi *GeoIndex) IndexBlockPoints(blockID uint32, points map[string]GeoPoint) {
+	gi.mutex.Lock()
+	defer gi.mutex.Unlock()
+
+	gi.removeLocked(blockID)
+
+	if len(points) == 0 {
+		return
+	}
+
+	stored := make(map[string]GeoPoint, len(points))
+	for field, point := range points {
+		stored[field] = point
+
+		entry := geoEntry{hash: point.Geohash(geohashPrecision), id: blockID}
+		entries := gi.fields[field]
+		i := sort.Search(len(entries), func(i int) bool { return !entries[i].less(entry) })
+		entries = append(entries, geoEntry{})
+		copy(entries[i+1:], entries[i:])
+		entries[i] = entry
+		gi.fields[field] = entries
+	}
+	gi.blocks[blockID] = stored
+}
+
+// RemoveBlock 移除块的所有位置
+func (gi *GeoIndex) RemoveBlock(blockID uint32) {
+	gi.mutex.Lock()
+	defer gi.mutex.Unlock()
+
+	gi.removeLocked(blockID)
+}
+
+// removeLocked 移除块的位置（调用方需持有写锁）
+func (gi *GeoIndex) removeLocked(blockID uint32) {
+	old, ok := gi.blocks[blockID]
+	if !ok {
+		return
+	}
+
+	for field, point := range old {
+		entry := geoEntry{hash: point.Geohash(geohashPrecision), id: blockID}
+		entries := gi.fields[field]
+		i := sort.Search(len(entries), func(i int) bool { return !entries[i].less(entry) })
+		if i < len(entries) && entries[i] == entry {
+			entries = append(entries[:i], entries[i+1:]...)
+		}
+		if len(entries) == 0 {
+			delete(gi.fields, field)
+		} else {
+			gi.fields[field] = entries
+		}
+	}
+	delete(gi.blocks, blockID)
+}
+
+// Candidates 返回字段位置可能在区域内的块，按块ID升序返回
+func (gi *GeoIndex) Candidates(field string, box GeoBox) []uint32 {
+	gi.mutex.RLock()
+	defer gi.mutex.RUnlock()
+
+	entries := gi.fields[field]
+	set := make(map[uint32]struct{})
+	for _, part := range box.split() {
+		for _, cell := range geohashCover(part) {
+			i := sort.Search(len(entries), func(i int) bool { return entries[i].hash >= cell })
+			for ; i < len(entries) && strings.HasPrefix(entries[i].hash, cell); i++ {
+				set[entries[i].id] = struct{}{}
+			}
+		}
+	}
+	return sortedIDs(set)
+}
+
+// less 按geohash和ID排序
+func (e geoEntry) less(other geoEntry) bool {
+	if e.hash != other.hash {
+		return e.hash < other.hash
+	}
+	return e.id < other.id
+}
+
+// geohashCover 返回覆盖区域（不跨越180度经线）的geohash单元，
+// 选择单元数不超过maxGeoCoverCells的最大精度
+func geohashCover(box GeoBox) []string {
+	for precision := geohashPrecision; precision > 1; precision-- {
+		if cells := geohashCells(box, precision); cells != nil {
+			return cells
+		}
+	}
+	return geohashCells(box, 1)
+}
+
+// geohashCells 返回指定精度下覆盖区域的geohash单元，超过maxGeoCoverCells时返回nil（精度1除外）
+func geohashCells(box GeoBox, precision int) []string {
+	bits := precision * 5
+	lonStep := 360 / math.Exp2(float64((bits+1)/2))
+	latStep := 180 / math.Exp2(float64(bits/2))
+
+	// 边界上的位置可能因舍入落在相邻单元，向外多取一点
+	const epsilon = 1e-9
+	lonFirst := math.Max(math.Floor((box.MinLon+180)/lonStep-epsilon), 0)
+	lonLast := math.Min(math.Floor((box.MaxLon+180)/lonStep+epsilon), math.Round(360/lonStep)-1)
+	latFirst := math.Max(math.Floor((box.MinLat+90)/latStep-epsilon), 0)
+	latLast := math.Min(math.Floor((box.MaxLat+90)/latStep+epsilon), math.Round(180/latStep)-1)
+
+	count := (lonLast - lonFirst + 1) * (latLast - latFirst + 1)
+	if count > maxGeoCoverCells && precision > 1 {
+		return nil
+	}
+
+	cells := make([]string, 0, int(count))
+	for lat := latFirst; lat <= latLast; lat++ {
+		for lon := lonFirst; lon <= lonLast; lon++ {
+			center := GeoPoint{Lat: (lat+0.5)*latStep - 90, Lon: (lon+0.5)*lonStep - 180}
+			cells = append(cells, center.Geohash(precision))
+		}
+	}
+	return cells
+}
+
+// parseGeoCondition 解析地理位置条件的值：within_radius为 "纬度,经度,半径"（半径可带m或km单位，
+// 默认为米），in_bbox为 "最小纬度,最小经度,最大纬度,最大经度" 或者geohash单元
+func parseGeoCondition(field string, operator OperatorType, valueStr string) (*QueryCondition, error) {
+	value, _ := unquote(valueStr)
+	parts := strings.Split(value, ",")
+	for i := range parts {
+		parts[i] = strings.TrimSpace(parts[i])
+	}
+
+	var area interface{}
+	switch operator {
+	case OpWithinRadius:
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("%w: within_radius的值应为 纬度,经度,半径", ErrSyntaxError)
+		}
+		center, err := ParseGeoPoint(parts[0] + "," + parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSyntaxError, err)
+		}
+		radius, err := parseGeoDistance(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSyntaxError, err)
+		}
+		area = GeoCircle{Center: center, Radius: radius}
+	case OpInBBox:
+		if len(parts) == 1 {
+			box, err := geohashBox(parts[0])
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrSyntaxError, err)
+			}
+			area = box
+			break
+		}
+		if len(parts) != 4 {
+			return nil, fmt.Errorf("%w: in_bbox的值应为 最小纬度,最小经度,最大纬度,最大经度", ErrSyntaxError)
+		}
+		minPoint, err := ParseGeoPoint(parts[0] + "," + parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSyntaxError, err)
+		}
+		maxPoint, err := ParseGeoPoint(parts[2] + "," + parts[3])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrSyntaxError, err)
+		}
+		if minPoint.Lat > maxPoint.Lat {
+			return nil, fmt.Errorf("%w: 最小纬度大于最大纬度", ErrSyntaxError)
+		}
+		area = GeoBox{MinLat: minPoint.Lat, MinLon: minPoint.Lon, MaxLat: maxPoint.Lat, MaxLon: maxPoint.Lon}
+	default:
+		return nil, ErrUnsupportedOperator
+	}
+
+	return &QueryCondition{
+		Field:     field,
+		FieldType: TypeGeo,
+		Operator:  operator,
+		Value:     area,
+	}, nil
+}
+
+// parseGeoDistance 解析距离，支持m和km单位，默认为米
+func parseGeoDistance(s string) (float64, error) {
+	scale := 1.0
+	number := s
+	if trimmed, ok := strings.CutSuffix(s, "km"); ok {
+		number, scale = trimmed, 1000
+	} else if trimmed, ok := strings.CutSuffix(s, "m"); ok {
+		number = trimmed
+	}
+	distance, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || distance < 0 || math.IsInf(distance, 0) || math.IsNaN(distance) {
+		return 0, fmt.Errorf("无效的距离: %s", s)
+	}
+	return distance * scale, nil
+}
+
+// geoConditionBounds 返回地理位置条件的矩形范围
+func geoConditionBounds(condition *QueryCondition) (GeoBox, bool) {
+	switch area := condition.Value.(type) {
+	case GeoBox:
+		return area, condition.Operator == OpInBBox
+	case GeoCircle:
+		return area.Bounds(), condition.Operator == OpWithinRadius
+	default:
+		return GeoBox{}, false
+	}
+}
+
+// matchGeoCondition 判断位置是否满足地理位置条件，不是位置的值不匹配
+func matchGeoCondition(condition *QueryCondition, value interface{}) (bool, error) {
+	point, ok := toGeoPoint(value)
+	if !ok {
+		return false, nil
+	}
+
+	switch area := condition.Value.(type) {
+	case GeoBox:
+		if condition.Operator != OpInBBox {
+			return false, ErrUnsupportedOperator
+		}
+		return area.Contains(point), nil
+	case GeoCircle:
+		if condition.Operator != OpWithinRadius {
+			return false, ErrUnsupportedOperator
+		}
+		return area.Contains(point), nil
+	default:
+		return false, ErrInvalidValue
+	}
+}
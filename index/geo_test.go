@@ -0,0 +1,126 @@
+package index
+
+import (
+	"math"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// TestGeohash 测试geohash编码和解码
+func TestGeohash(t *testing.T) {
+	p := GeoPoint{Lat: 57.64911, Lon: 10.40744}
+	if hash := p.Geohash(11); hash != "u4pruydqqvj" {
+		t.Errorf("geohash不正确: %s", hash)
+	}
+	box, err := geohashBox("u4pruydqqvj")
+	if err != nil || !box.Contains(p) {
+		t.Errorf("geohash单元应包含原位置: %+v, %v", box, err)
+	}
+	if _, err := ParseGeoPoint("u4pa"); err == nil {
+		t.Error("包含无效字符的geohash应返回错误")
+	}
+
+	// 上海到北京约1067公里
+	shanghai, beijing := GeoPoint{31.2304, 121.4737}, GeoPoint{39.9042, 116.4074}
+	if d := shanghai.DistanceTo(beijing); math.Abs(d-1067e3) > 5e3 {
+		t.Errorf("距离不正确: %.0f", d)
+	}
+}
+
+// TestGeoIndex 测试地理位置索引的候选包含区域内的所有位置，包括跨越180度经线和极点附近的区域
+func TestGeoIndex(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	points := make(map[uint32]GeoPoint)
+	gi := NewGeoIndex()
+	for id := uint32(1); id <= 2000; id++ {
+		p := GeoPoint{Lat: rng.Float64()*180 - 90, Lon: rng.Float64()*360 - 180}
+		points[id] = p
+		gi.IndexBlockPoints(id, map[string]GeoPoint{"location": p})
+	}
+
+	areas := []interface{}{
+		GeoBox{MinLat: 10, MinLon: 20, MaxLat: 30, MaxLon: 50},
+		GeoBox{MinLat: -20, MinLon: 170, MaxLat: 20, MaxLon: -170},
+		GeoBox{MinLat: -90, MinLon: -180, MaxLat: 90, MaxLon: 180},
+		GeoCircle{Center: GeoPoint{Lat: 0, Lon: 179.5}, Radius: 1500e3},
+		GeoCircle{Center: GeoPoint{Lat: 88, Lon: 0}, Radius: 800e3},
+		GeoCircle{Center: GeoPoint{Lat: 45, Lon: -100}, Radius: 100e3},
+	}
+	for _, area := range areas {
+		var box GeoBox
+		contains := func(p GeoPoint) bool { return false }
+		switch a := area.(type) {
+		case GeoBox:
+			box, contains = a, a.Contains
+		case GeoCircle:
+			box, contains = a.Bounds(), a.Contains
+		}
+
+		candidates := make(map[uint32]bool)
+		for _, id := range gi.Candidates("location", box) {
+			candidates[id] = true
+		}
+		for id, p := range points {
+			if contains(p) && !candidates[id] {
+				t.Errorf("%+v: 候选中缺少位置%v", area, p)
+			}
+		}
+	}
+
+	// 小区域的候选远少于全部位置
+	if ids := gi.Candidates("location", GeoBox{MinLat: 10, MinLon: 20, MaxLat: 11, MaxLon: 21}); len(ids) > 20 {
+		t.Errorf("候选范围过大: %d", len(ids))
+	}
+
+	gi.RemoveBlock(1)
+	gi.IndexBlockPoints(2, nil)
+	all := gi.Candidates("location", GeoBox{MinLat: -90, MinLon: -180, MaxLat: 90, MaxLon: 180})
+	if len(all) != len(points)-2 || all[0] != 3 {
+		t.Errorf("移除后的候选不正确: %d", len(all))
+	}
+}
+
+// TestQueryServiceGeo 测试地理位置查询
+func TestQueryServiceGeo(t *testing.T) {
+	qs := NewQueryService(nil)
+	qs.IndexBlockValues(1, map[string]interface{}{"location": GeoPoint{Lat: 31.2304, Lon: 121.4737}}) // 上海
+	qs.IndexBlockValues(2, map[string]interface{}{"location": GeoPoint{Lat: 31.2989, Lon: 120.5853}}) // 苏州
+	qs.IndexBlockValues(3, map[string]interface{}{"location": GeoPoint{Lat: 39.9042, Lon: 116.4074}}) // 北京
+	qs.IndexBlockAttributes(4, map[string]string{"location": "-33.8688,151.2093"})                    // 悉尼
+	qs.IndexBlockAttributes(5, map[string]string{"location": "unknown"})
+
+	tests := []struct {
+		query string
+		want  []uint32
+	}{
+		{"location within_radius 31.23,121.47,5km", []uint32{1}},
+		{"location within_radius 31.23,121.47,100km", []uint32{1, 2}},
+		{"location within_radius 31.23,121.47,1500000", []uint32{1, 2, 3}},
+		{"location in_bbox 30,120,40,122", []uint32{1, 2}},
+		{"location in_bbox wtw", []uint32{1}},
+		{"location in_bbox 39,116,40,117 or location in_bbox -40,150,-30,152", []uint32{3, 4}},
+		{"not location within_radius 31.23,121.47,100km", []uint32{3, 4, 5}},
+	}
+	for _, tt := range tests {
+		result, err := qs.Query(tt.query)
+		if err != nil {
+			t.Errorf("查询 %q 失败: %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(result.IDs, tt.want) {
+			t.Errorf("查询 %q 结果不正确: 期望 %v，实际 %v", tt.query, tt.want, result.IDs)
+		}
+	}
+
+	for _, query := range []string{
+		"location within_radius 31.23,121.47",
+		"location within_radius 31.23,121.47,-1km",
+		"location in_bbox 40,120,30,122",
+		"location in_bbox 91,0,92,1",
+	} {
+		if _, err := qs.Query(query); err == nil {
+			t.Errorf("查询 %q 应返回语法错误", query)
+		}
+	}
+}
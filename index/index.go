@@ -6,10 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"os"
 	"sort"
 	"sync"
 	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+	"github.com/bpfs/fragmenta/vfs"
 )
 
 // 错误定义
@@ -19,9 +21,13 @@ var (
 	ErrInvalidPattern = errors.New("invalid pattern")
 	ErrIndexCorrupted = errors.New("index corrupted")
 	ErrIndexLocked    = errors.New("index locked by another process")
+	ErrIndexBusy      = errors.New("index is already updating")
+	ErrLengthMismatch = errors.New("tags and ids length mismatch")
+	ErrNoConditions   = errors.New("no conditions provided")
+	ErrQueueFull      = errors.New("index update queue is full")
 )
 
-// IndexManagerImpl 索引管理器实现
+// IndexManagerImpl 索引管理器实现，所有导出方法都可以并发调用
 type IndexManagerImpl struct {
 	// 配置
 	config *IndexConfig
@@ -45,6 +51,9 @@ type IndexManagerImpl struct {
 	// 前缀树相关字段
 	prefixTrees    map[uint32]*PrefixNode // 前缀树索引
 	prefixTreeLock sync.RWMutex           // 前缀树读写锁
+
+	// 物化聚合（见 RegisterAggregate），随索引修改增量更新
+	aggregates map[string]*tagAggregate
 }
 
 // NewIndexManager 创建索引管理器
@@ -62,7 +71,8 @@ func NewIndexManager(config *IndexConfig) (*IndexManagerImpl, error) {
 		config:          config,
 		metadataIndices: make(map[uint32][]uint32),
 		contentIndices:  make(map[string][]uint32),
-		lastUpdateTime:  time.Now(),
+		prefixTrees:     make(map[uint32]*PrefixNode),
+		lastUpdateTime:  clock.OrSystem(config.Clock).Now(),
 		isUpdating:      false,
 		progress:        0,
 		indexedCount:    0,
@@ -71,7 +81,7 @@ func NewIndexManager(config *IndexConfig) (*IndexManagerImpl, error) {
 
 	// 如果索引文件存在，则加载
 	if config.IndexPath != "" {
-		_, err := os.Stat(config.IndexPath)
+		_, err := vfs.OrOS(config.FS).Stat(config.IndexPath)
 		if err == nil {
 			err = im.LoadIndex(config.IndexPath)
 			if err != nil {
@@ -100,13 +110,14 @@ func (im *IndexManagerImpl) AddIndex(tag uint32, id uint32) error {
 	// 更新索引映射
 	im.metadataIndices[tag] = append(im.metadataIndices[tag], id)
 	im.indexedCount++
+	im.aggregateAddLocked(tag, id)
 
 	// 更新前缀树
 	if err := im.updatePrefixTree(tag, id, OpAdd); err != nil {
-		return fmt.Errorf("更新前缀树失败: %v", err)
+		return fmt.Errorf("更新前缀树失败: %w", err)
 	}
 
-	im.lastUpdateTime = time.Now()
+	im.lastUpdateTime = im.now()
 	return nil
 }
 
@@ -129,6 +140,7 @@ func (im *IndexManagerImpl) RemoveIndex(tag uint32, id uint32) error {
 			if storedID == id {
 				im.metadataIndices[tag] = append(ids[:i], ids[i+1:]...)
 				im.indexedCount--
+				im.aggregateRemoveLocked(tag, id, 1)
 				break
 			}
 		}
@@ -136,10 +148,10 @@ func (im *IndexManagerImpl) RemoveIndex(tag uint32, id uint32) error {
 
 	// 更新前缀树
 	if err := im.updatePrefixTree(tag, id, OpRemove); err != nil {
-		return fmt.Errorf("更新前缀树失败: %v", err)
+		return fmt.Errorf("更新前缀树失败: %w", err)
 	}
 
-	im.lastUpdateTime = time.Now()
+	im.lastUpdateTime = im.now()
 	return nil
 }
 
@@ -193,7 +205,7 @@ func (im *IndexManagerImpl) UpdateIndices() error {
 	// 更新完成
 	im.isUpdating = false
 	im.progress = 100
-	im.lastUpdateTime = time.Now()
+	im.lastUpdateTime = im.now()
 
 	// 如果启用自动保存，则保存索引
 	if im.config.AutoSave && im.config.IndexPath != "" {
@@ -224,7 +236,7 @@ func (im *IndexManagerImpl) LoadIndex(path string) error {
 	defer im.mutex.Unlock()
 
 	// 打开文件
-	file, err := os.Open(path)
+	file, err := vfs.OrOS(im.config.FS).Open(path)
 	if err != nil {
 		logger.Error("打开索引文件失败", "error", err)
 		return err
@@ -251,6 +263,14 @@ func (im *IndexManagerImpl) LoadIndex(path string) error {
 		return err
 	}
 
+	// 文件内容为null或缺少字段时得到nil映射，之后的写入会panic
+	if indices.MetadataIndices == nil {
+		indices.MetadataIndices = make(map[uint32][]uint32)
+	}
+	if indices.ContentIndices == nil {
+		indices.ContentIndices = make(map[string][]uint32)
+	}
+
 	// 更新索引
 	im.metadataIndices = indices.MetadataIndices
 	im.contentIndices = indices.ContentIndices
@@ -262,6 +282,11 @@ func (im *IndexManagerImpl) LoadIndex(path string) error {
 		im.indexedCount += len(ids)
 	}
 
+	// 重新计算聚合
+	for _, aggregate := range im.aggregates {
+		aggregate.rebuild(im.metadataIndices)
+	}
+
 	return nil
 }
 
@@ -289,7 +314,12 @@ func (im *IndexManagerImpl) SaveIndex(path string) error {
 	}
 
 	// 写入文件
-	return os.WriteFile(path, data, 0644)
+	return vfs.OrOS(im.config.FS).WriteFile(path, data, 0644)
+}
+
+// now 返回配置的时钟的当前时间
+func (im *IndexManagerImpl) now() time.Time {
+	return clock.OrSystem(im.config.Clock).Now()
 }
 
 // IndexMetadata 索引元数据
@@ -325,7 +355,7 @@ func (im *IndexManagerImpl) AsyncRemoveIndex(tag uint32, id uint32) error {
 // BatchAddIndices 批量添加索引
 func (im *IndexManagerImpl) BatchAddIndices(tags []uint32, ids []uint32) error {
 	if len(tags) != len(ids) {
-		return fmt.Errorf("标签和ID数组长度不匹配")
+		return fmt.Errorf("%w: 标签和ID数组长度不匹配", ErrLengthMismatch)
 	}
 
 	im.mutex.Lock()
@@ -354,11 +384,12 @@ func (im *IndexManagerImpl) BatchAddIndices(tags []uint32, ids []uint32) error {
 		if !exists {
 			im.metadataIndices[tag] = append(im.metadataIndices[tag], id)
 			im.indexedCount++
+			im.aggregateAddLocked(tag, id)
 		}
 	}
 
 	// 更新状态
-	im.lastUpdateTime = time.Now()
+	im.lastUpdateTime = im.now()
 
 	// 如果启用自动保存，则保存索引
 	if im.config.AutoSave && im.config.IndexPath != "" {
@@ -371,7 +402,7 @@ func (im *IndexManagerImpl) BatchAddIndices(tags []uint32, ids []uint32) error {
 // BatchRemoveIndices 批量移除索引
 func (im *IndexManagerImpl) BatchRemoveIndices(tags []uint32, ids []uint32) error {
 	if len(tags) != len(ids) {
-		return fmt.Errorf("标签和ID数组长度不匹配")
+		return fmt.Errorf("%w: 标签和ID数组长度不匹配", ErrLengthMismatch)
 	}
 
 	im.mutex.Lock()
@@ -398,6 +429,7 @@ func (im *IndexManagerImpl) BatchRemoveIndices(tags []uint32, ids []uint32) erro
 					newIds = append(newIds, id)
 				} else {
 					im.indexedCount--
+					im.aggregateRemoveLocked(tag, id, 1)
 				}
 			}
 
@@ -411,7 +443,7 @@ func (im *IndexManagerImpl) BatchRemoveIndices(tags []uint32, ids []uint32) erro
 	}
 
 	// 更新状态
-	im.lastUpdateTime = time.Now()
+	im.lastUpdateTime = im.now()
 
 	// 如果启用自动保存，则保存索引
 	if im.config.AutoSave && im.config.IndexPath != "" {
@@ -453,10 +485,10 @@ func (im *IndexManagerImpl) GetPendingTaskCount() int {
 	return 0
 }
 
-// GetPrefixTree 获取指定标签的前缀树
+// GetPrefixTree 获取指定标签的前缀树，标签没有前缀树时创建空树
 func (im *IndexManagerImpl) GetPrefixTree(tag uint32) (*PrefixNode, error) {
-	im.prefixTreeLock.RLock()
-	defer im.prefixTreeLock.RUnlock()
+	im.prefixTreeLock.Lock()
+	defer im.prefixTreeLock.Unlock()
 
 	if im.prefixTrees == nil {
 		im.prefixTrees = make(map[uint32]*PrefixNode)
@@ -651,7 +683,7 @@ func (im *IndexManagerImpl) FindByRange(tag uint32, start, end uint32) ([]uint32
 // FindCompound 复合查询
 func (im *IndexManagerImpl) FindCompound(conditions []IndexQueryCondition) ([]uint32, error) {
 	if len(conditions) == 0 {
-		return nil, fmt.Errorf("没有提供查询条件")
+		return nil, fmt.Errorf("%w: 没有提供查询条件", ErrNoConditions)
 	}
 
 	// 执行第一个条件获取初始结果集
@@ -665,13 +697,13 @@ func (im *IndexManagerImpl) FindCompound(conditions []IndexQueryCondition) ([]ui
 	case "prefix": // 前缀
 		prefix, ok := firstCondition.Value.(string)
 		if !ok {
-			return nil, fmt.Errorf("前缀值必须是字符串类型")
+			return nil, fmt.Errorf("%w: 前缀值必须是字符串类型", ErrInvalidValue)
 		}
 		result, err = im.FindByPrefix(firstCondition.Tag, prefix)
 	case "range": // 范围
 		rangeValues, ok := firstCondition.Value.([]uint32)
 		if !ok || len(rangeValues) != 2 {
-			return nil, fmt.Errorf("范围值必须是包含两个uint32的数组")
+			return nil, fmt.Errorf("%w: 范围值必须是包含两个uint32的数组", ErrInvalidValue)
 		}
 		result, err = im.FindByRange(firstCondition.Tag, rangeValues[0], rangeValues[1])
 	default:
@@ -694,13 +726,13 @@ func (im *IndexManagerImpl) FindCompound(conditions []IndexQueryCondition) ([]ui
 		case "prefix": // 前缀
 			prefix, ok := condition.Value.(string)
 			if !ok {
-				return nil, fmt.Errorf("前缀值必须是字符串类型")
+				return nil, fmt.Errorf("%w: 前缀值必须是字符串类型", ErrInvalidValue)
 			}
 			conditionResult, err = im.FindByPrefix(condition.Tag, prefix)
 		case "range": // 范围
 			rangeValues, ok := condition.Value.([]uint32)
 			if !ok || len(rangeValues) != 2 {
-				return nil, fmt.Errorf("范围值必须是包含两个uint32的数组")
+				return nil, fmt.Errorf("%w: 范围值必须是包含两个uint32的数组", ErrInvalidValue)
 			}
 			conditionResult, err = im.FindByRange(condition.Tag, rangeValues[0], rangeValues[1])
 		default:
@@ -1,6 +1,9 @@
 package index
 
 import (
+	"fmt"
+	"runtime"
+	"sync"
 	"testing"
 )
 
@@ -226,3 +229,95 @@ func BenchmarkOptimizer(b *testing.B) {
 		}
 	})
 }
+
+// BenchmarkParallelShardQuery 对比顺序和并行遍历分片的查询性能，分片数从4到64
+func BenchmarkParallelShardQuery(b *testing.B) {
+	const idsPerTag = 50000
+	for _, shards := range []int{4, 16, 32, 64} {
+		for _, mode := range []struct {
+			name    string
+			workers int
+		}{
+			{"Sequential", 0},
+			{"Parallel", runtime.NumCPU()},
+		} {
+			b.Run(fmt.Sprintf("Shards%d/%s", shards, mode.name), func(b *testing.B) {
+				im := newParallelQueryIndex(b, shards, mode.workers, idsPerTag)
+
+				b.Run("FindByKey", func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						ids, err := im.FindByKey(uint32(i % 4))
+						if err != nil || len(ids) != idsPerTag {
+							b.Fatalf("查找索引失败: %d, %v", len(ids), err)
+						}
+					}
+				})
+
+				b.Run("FindByPattern", func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						if _, err := im.FindByPattern("1"); err != nil {
+							b.Fatalf("模式查找失败: %v", err)
+						}
+					}
+				})
+			})
+		}
+	}
+}
+
+// newParallelQueryIndex 创建禁用查询缓存的分片索引，4个标签各有idsPerTag个ID
+func newParallelQueryIndex(tb testing.TB, shards, workers, idsPerTag int) *OptimizedIndexManager {
+	tb.Helper()
+
+	im, err := NewOptimizedIndexManager(&IndexConfig{
+		NumShards:      shards,
+		MaxWorkers:     workers,
+		QueryCacheSize: -1,
+	})
+	if err != nil {
+		tb.Fatalf("创建索引管理器失败: %v", err)
+	}
+	for tag := uint32(0); tag < 4; tag++ {
+		tags := make([]uint32, idsPerTag)
+		ids := make([]uint32, idsPerTag)
+		for i := range ids {
+			tags[i] = tag
+			ids[i] = uint32(i)
+		}
+		if err := im.BatchAddIndices(tags, ids); err != nil {
+			tb.Fatalf("添加索引失败: %v", err)
+		}
+	}
+	return im
+}
+
+// BenchmarkExecutionModel 对比共享执行和分片亲和执行下的并发同步写入
+func BenchmarkExecutionModel(b *testing.B) {
+	models := map[string]ExecutionModel{"shared": ExecutionShared, "affinity": ExecutionShardAffinity}
+	for name, model := range models {
+		b.Run(name, func(b *testing.B) {
+			im, err := NewOptimizedIndexManager(&IndexConfig{
+				NumShards:      runtime.NumCPU(),
+				MaxWorkers:     runtime.NumCPU(),
+				ExecutionModel: model,
+			})
+			if err != nil {
+				b.Fatalf("创建索引管理器失败: %v", err)
+			}
+			defer im.Close()
+
+			var next uint32
+			var mu sync.Mutex
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				mu.Lock()
+				base := next
+				next += 1 << 20
+				mu.Unlock()
+				for i := uint32(0); pb.Next(); i++ {
+					im.AddIndex(i%64, base+i)
+				}
+			})
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package index
 
 import (
+	"errors"
 	"testing"
 	"time"
 )
@@ -367,3 +368,29 @@ func TestErrorHandling(t *testing.T) {
 	// 不判断具体错误内容，只要函数不崩溃就算通过
 	t.Logf("空查询列表返回: %v", err)
 }
+
+// TestSentinelErrors 测试参数错误可以用errors.Is匹配
+func TestSentinelErrors(t *testing.T) {
+	im, err := NewIndexManager(&IndexConfig{})
+	if err != nil {
+		t.Fatalf("创建索引管理器失败: %v", err)
+	}
+	if err := im.BatchAddIndices([]uint32{1}, nil); !errors.Is(err, ErrLengthMismatch) {
+		t.Errorf("长度不一致应返回ErrLengthMismatch: %v", err)
+	}
+	if _, err := im.FindCompound(nil); !errors.Is(err, ErrNoConditions) {
+		t.Errorf("没有条件应返回ErrNoConditions: %v", err)
+	}
+	_, err = im.FindCompound([]IndexQueryCondition{{Tag: 1, Operation: "prefix", Value: 1}})
+	if !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("前缀值类型错误应返回ErrInvalidValue: %v", err)
+	}
+
+	optimized, err := NewOptimizedIndexManager(nil)
+	if err != nil {
+		t.Fatalf("创建优化索引管理器失败: %v", err)
+	}
+	if err := optimized.BatchAddIndices(nil, []uint32{1}); !errors.Is(err, ErrLengthMismatch) {
+		t.Errorf("长度不一致应返回ErrLengthMismatch: %v", err)
+	}
+}
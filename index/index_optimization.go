@@ -104,6 +104,10 @@ type OptimizationConfig struct {
 
 	// 分析间隔（秒）
 	AnalysisInterval int
+
+	// StatsStore 持久化的统计历史，OptimizeIndex和AnalyzeIndexPerformance各记录一个样本，
+	// 分析时根据趋势给出建议。nil表示不保留历史
+	StatsStore *StatsStore
 }
 
 // DefaultIndexOptimizer 默认索引优化器实现
@@ -190,6 +194,11 @@ func (o *DefaultIndexOptimizer) OptimizeIndex(im IndexManager) error {
 
 	o.stats.MemoryImprovement = o.stats.SizeBefore - o.stats.SizeAfter
 
+	// 记录优化后的统计，失败不影响优化结果
+	if err := o.recordStats(im); err != nil {
+		logger.Error("记录索引统计失败", "error", err)
+	}
+
 	return nil
 }
 
@@ -248,9 +257,9 @@ func (o *DefaultIndexOptimizer) compressBasicIndex(im *IndexManagerImpl, level i
 			}
 
 			// 去重
-			uniqueIDs := make(map[uint32]struct{})
+			uniqueIDs := make(map[uint32]int)
 			for _, id := range ids {
-				uniqueIDs[id] = struct{}{}
+				uniqueIDs[id]++
 			}
 
 			// 转换为有序切片
@@ -268,6 +277,9 @@ func (o *DefaultIndexOptimizer) compressBasicIndex(im *IndexManagerImpl, level i
 			im.mutex.Lock()
 			originalCount := len(im.metadataIndices[tag])
 			im.metadataIndices[tag] = newIDs
+			for id, count := range uniqueIDs {
+				im.aggregateRemoveLocked(tag, id, count-1)
+			}
 			im.mutex.Unlock()
 
 			// 更新统计信息
@@ -813,9 +825,74 @@ func (o *DefaultIndexOptimizer) AnalyzeIndexPerformance(im IndexManager) (*Index
 		}
 	}
 
+	// 根据统计历史的趋势给出建议
+	if o.config.StatsStore != nil {
+		if err := o.recordStats(im); err != nil {
+			return nil, fmt.Errorf("记录索引统计失败: %w", err)
+		}
+		report.Trend = o.config.StatsStore.Trend()
+		report.Recommendations = append(report.Recommendations, trendRecommendations(report.Trend)...)
+	}
+
 	return report, nil
 }
 
+// StatsHistory 返回持久化的统计历史，未配置 OptimizationConfig.StatsStore 时返回nil
+func (o *DefaultIndexOptimizer) StatsHistory() []StatsSample {
+	if o.config.StatsStore == nil {
+		return nil
+	}
+	return o.config.StatsStore.Samples()
+}
+
+// recordStats 采集索引当前的统计并写入统计存储，未配置时不做任何事
+func (o *DefaultIndexOptimizer) recordStats(im IndexManager) error {
+	if o.config.StatsStore == nil {
+		return nil
+	}
+
+	status := im.GetStatus()
+	sample := StatsSample{
+		Time:             time.Now(),
+		IndexedItems:     status.IndexedItems,
+		MemoryUsage:      status.MemoryUsage,
+		CompressionRatio: status.CompressionRatio,
+		ShardBalance:     1.0,
+	}
+	if idx, ok := im.(*OptimizedIndexManager); ok {
+		sample.ShardBalance = o.analyzeShardBalance(idx)
+		sample.QueryP50 = idx.QueryLatencyPercentile(50)
+		sample.QueryP95 = idx.QueryLatencyPercentile(95)
+		sample.QueryP99 = idx.QueryLatencyPercentile(99)
+	}
+	return o.config.StatsStore.Record(sample)
+}
+
+// trendRecommendations 根据统计趋势生成优化建议，trend为nil（样本不足）时没有建议
+func trendRecommendations(trend *StatsTrend) []string {
+	if trend == nil {
+		return nil
+	}
+	var recommendations []string
+	if trend.ShardBalanceChange < -0.1 {
+		recommendations = append(recommendations,
+			fmt.Sprintf("分片平衡度在最近%d个样本中持续下降 (%.2f)，建议定期重新平衡分片", trend.Samples, trend.ShardBalanceChange))
+	}
+	if trend.QueryP95Change > 0.5 {
+		recommendations = append(recommendations,
+			fmt.Sprintf("查询P95延迟上升了%.0f%%，建议优化索引", trend.QueryP95Change*100))
+	}
+	if trend.CompressionRatioChange < -10 {
+		recommendations = append(recommendations,
+			fmt.Sprintf("压缩率下降了%.1f个百分点，建议提高压缩级别", -trend.CompressionRatioChange))
+	}
+	if trend.ItemsGrowth > 1 {
+		recommendations = append(recommendations,
+			fmt.Sprintf("索引项目数增长了%.0f%%，建议增加分片数", trend.ItemsGrowth*100))
+	}
+	return recommendations
+}
+
 // IndexAnalysisReport 索引分析报告
 type IndexAnalysisReport struct {
 	// 生成时间
@@ -835,34 +912,38 @@ type IndexAnalysisReport struct {
 
 	// 优化建议
 	Recommendations []string
+
+	// Trend 统计历史的趋势，未配置 OptimizationConfig.StatsStore 或样本不足时为nil
+	Trend *StatsTrend
 }
 
 // analyzeShardBalance 分析分片平衡性
 func (o *DefaultIndexOptimizer) analyzeShardBalance(im *OptimizedIndexManager) float64 {
+	return im.ShardBalance()
+}
+
+// shardBalance 按分片条目数的变异系数计算平衡度(0-1，1表示完全平衡)
+func shardBalance(shardStatus []ShardStatus) float64 {
 	// 计算分片平衡度
-	var min, max, total int
-	min = -1
+	var max, total int
 
-	for _, status := range im.shardStatus {
+	for _, status := range shardStatus {
 		count := int(status.ItemCount)
-		if min == -1 || count < min {
-			min = count
-		}
 		if count > max {
 			max = count
 		}
 		total += count
 	}
 
-	if max == 0 || len(im.shardStatus) == 0 {
+	if max == 0 || len(shardStatus) == 0 {
 		return 1.0 // 认为是平衡的
 	}
 
 	// 使用标准差计算平衡度
-	mean := float64(total) / float64(len(im.shardStatus))
+	mean := float64(total) / float64(len(shardStatus))
 	var variance float64
 
-	for _, status := range im.shardStatus {
+	for _, status := range shardStatus {
 		diff := float64(status.ItemCount) - mean
 		variance += diff * diff
 	}
@@ -872,7 +953,7 @@ func (o *DefaultIndexOptimizer) analyzeShardBalance(im *OptimizedIndexManager) f
 		return 1.0
 	}
 
-	stdDev := math.Sqrt(variance / float64(len(im.shardStatus)))
+	stdDev := math.Sqrt(variance / float64(len(shardStatus)))
 	cv := stdDev / mean
 
 	// 转换为平衡度 (1 - CV，有界于0-1之间)
@@ -886,7 +967,7 @@ func (o *DefaultIndexOptimizer) analyzeAccessPatterns(im *OptimizedIndexManager)
 
 	// 计算分片访问频率
 	var totalReads, totalWrites int64
-	for _, status := range im.shardStatus {
+	for _, status := range im.shardStatusSnapshot() {
 		totalReads += status.ReadCount
 		totalWrites += status.WriteCount
 	}
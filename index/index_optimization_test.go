@@ -2,6 +2,7 @@ package index
 
 import (
 	"context"
+	"reflect"
 	"runtime"
 	"strings"
 	"testing"
@@ -47,6 +48,41 @@ func TestNewDefaultIndexOptimizer(t *testing.T) {
 	}
 }
 
+// TestParallelShardQuery 测试并行遍历分片的查询结果与顺序遍历相同
+func TestParallelShardQuery(t *testing.T) {
+	sequential := newParallelQueryIndex(t, 16, 0, 5000)
+	parallel := newParallelQueryIndex(t, 16, 4, 5000)
+
+	for tag := uint32(0); tag < 4; tag++ {
+		want, err := sequential.FindByKey(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := parallel.FindByKey(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("标签%d的并行查询结果与顺序查询不同: %d != %d", tag, len(got), len(want))
+		}
+	}
+	if _, err := parallel.FindByKey(99); err != ErrIndexNotFound {
+		t.Errorf("不存在的标签应返回ErrIndexNotFound: %v", err)
+	}
+
+	want, _ := sequential.FindByPattern("")
+	got, err := parallel.FindByPattern("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("并行模式查询结果与顺序查询不同: %d != %d", len(got), len(want))
+	}
+	if n := len(parallel.workerPool); n != 0 {
+		t.Errorf("查询结束后应归还工作池名额: %d", n)
+	}
+}
+
 // TestCompressIndex 测试索引压缩功能
 func TestCompressIndex(t *testing.T) {
 	// 创建索引管理器
@@ -0,0 +1,141 @@
+package index
+
+// indexView 某一时刻的分片索引数据，发布后不再修改。写入方在所涉及分片映射的副本上修改，
+// 修改过的ID列表总是重新分配，然后整体发布新的视图，因此查询不加锁地读取视图，也不会阻塞写入
+type indexView struct {
+	// gen 视图的版本，每次发布加1，查询结果缓存按它判断条目是否属于同一个视图
+	gen uint64
+
+	// shards 外层是分片ID，内层是标签到ID列表的映射
+	shards []map[uint32][]uint32
+}
+
+// shardWrite 一次写入：持有所涉及分片的写锁，在分片映射的副本上修改，commit时整体发布
+type shardWrite struct {
+	im     *OptimizedIndexManager
+	base   *indexView
+	locked []bool
+
+	// 已复制的分片映射
+	shards map[int]map[uint32][]uint32
+
+	// 修改过的标签和新出现的标签
+	changed map[uint32]struct{}
+	added   map[uint32]struct{}
+}
+
+// readView 返回当前发布的索引视图。视图不可修改，查询在同一个视图中求值，看到同一时刻的索引状态
+func (im *OptimizedIndexManager) readView() *indexView {
+	return im.view.Load()
+}
+
+// lockShards 按分片顺序获取各分组所涉及分片的写锁，开始一次写入
+func (im *OptimizedIndexManager) lockShards(groups ...map[int][]uint32) *shardWrite {
+	locked := make([]bool, len(im.shardMutexes))
+	for _, group := range groups {
+		for shardID := range group {
+			locked[shardID] = true
+		}
+	}
+	return im.beginWrite(locked)
+}
+
+// lockShard 获取单个分片的写锁，开始一次写入
+func (im *OptimizedIndexManager) lockShard(shardID int) *shardWrite {
+	locked := make([]bool, len(im.shardMutexes))
+	locked[shardID] = true
+	return im.beginWrite(locked)
+}
+
+// lockAllShards 获取所有分片的写锁，开始一次写入
+func (im *OptimizedIndexManager) lockAllShards() *shardWrite {
+	locked := make([]bool, len(im.shardMutexes))
+	for shardID := range locked {
+		locked[shardID] = true
+	}
+	return im.beginWrite(locked)
+}
+
+// beginWrite 按分片顺序获取写锁。持有分片写锁期间其他写入方不能发布该分片，
+// 因此当前视图中这些分片的数据就是本次写入的基础
+func (im *OptimizedIndexManager) beginWrite(locked []bool) *shardWrite {
+	for shardID, ok := range locked {
+		if ok {
+			im.shardMutexes[shardID].Lock()
+		}
+	}
+	return &shardWrite{
+		im:      im,
+		base:    im.view.Load(),
+		locked:  locked,
+		shards:  make(map[int]map[uint32][]uint32),
+		changed: make(map[uint32]struct{}),
+		added:   make(map[uint32]struct{}),
+	}
+}
+
+// read 返回分片当前的映射，只能读取
+func (w *shardWrite) read(shardID int) map[uint32][]uint32 {
+	if shard, ok := w.shards[shardID]; ok {
+		return shard
+	}
+	return w.base.shards[shardID]
+}
+
+// get 返回分片中标签的ID列表，只能读取
+func (w *shardWrite) get(shardID int, tag uint32) ([]uint32, bool) {
+	ids, ok := w.read(shardID)[tag]
+	return ids, ok
+}
+
+// set 替换分片中标签的ID列表。ids必须是新分配的，不能与已发布的列表共用底层数组
+func (w *shardWrite) set(shardID int, tag uint32, ids []uint32) {
+	shard, ok := w.shards[shardID]
+	if !ok {
+		base := w.base.shards[shardID]
+		shard = make(map[uint32][]uint32, len(base)+1)
+		for t, list := range base {
+			shard[t] = list
+		}
+		w.shards[shardID] = shard
+	}
+	if _, ok := shard[tag]; !ok {
+		w.added[tag] = struct{}{}
+	}
+	shard[tag] = ids
+	w.changed[tag] = struct{}{}
+}
+
+// commit 发布修改后的视图并释放分片写锁。新标签先写入标签过滤器，
+// 查询结果缓存随视图版本前进并使修改过的标签的条目失效
+func (w *shardWrite) commit() {
+	im := w.im
+	if len(w.shards) > 0 {
+		im.publishMutex.Lock()
+		current := im.view.Load()
+		next := &indexView{
+			gen:    current.gen + 1,
+			shards: append([]map[uint32][]uint32(nil), current.shards...),
+		}
+		for shardID, shard := range w.shards {
+			next.shards[shardID] = shard
+		}
+		for tag := range w.added {
+			im.noteTag(tag)
+		}
+		im.view.Store(next)
+		im.resultCache.advance(next.gen, w.changed)
+		im.publishMutex.Unlock()
+	}
+
+	for shardID := len(w.locked) - 1; shardID >= 0; shardID-- {
+		if w.locked[shardID] {
+			im.shardMutexes[shardID].Unlock()
+		}
+	}
+}
+
+// appendIDs 在ID列表后追加ID，总是返回新分配的列表
+func appendIDs(ids []uint32, more ...uint32) []uint32 {
+	return append(ids[:len(ids):len(ids)], more...)
+}
@@ -0,0 +1,321 @@
+package index
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+)
+
+// DefaultMaintenanceCheckInterval 维护调度器检查策略的默认间隔
+const DefaultMaintenanceCheckInterval = time.Minute
+
+// maxMaintenanceHistory 维护调度器保留的最近执行记录数
+const maxMaintenanceHistory = 64
+
+// MaintenanceTask 维护任务
+type MaintenanceTask int
+
+const (
+	// MaintenanceOptimize 调用 OptimizeIndex
+	MaintenanceOptimize MaintenanceTask = iota
+	// MaintenanceCompress 调用 CompressIndex，级别见 MaintenancePolicy.CompressionLevel
+	MaintenanceCompress
+	// MaintenanceRebalance 调用 RebalanceShards
+	MaintenanceRebalance
+)
+
+// String 返回任务名称
+func (t MaintenanceTask) String() string {
+	switch t {
+	case MaintenanceOptimize:
+		return "optimize"
+	case MaintenanceCompress:
+		return "compress"
+	case MaintenanceRebalance:
+		return "rebalance"
+	default:
+		return fmt.Sprintf("MaintenanceTask(%d)", int(t))
+	}
+}
+
+// MaintenanceWindow 每天允许开始维护的时段[Start, End)，按时钟所在时区从零点起计算。
+// End不大于Start表示跨越午夜，Start等于End表示全天
+type MaintenanceWindow struct {
+	// Start 开始时间，如 2*time.Hour 表示02:00
+	Start time.Duration
+	// End 结束时间
+	End time.Duration
+}
+
+// contains 返回t是否在时段内
+func (w MaintenanceWindow) contains(t time.Time) bool {
+	hour, minute, sec := t.Clock()
+	offset := time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute +
+		time.Duration(sec)*time.Second + time.Duration(t.Nanosecond())
+	if w.Start < w.End {
+		return offset >= w.Start && offset < w.End
+	}
+	return offset >= w.Start || offset < w.End
+}
+
+// MaintenancePolicy 维护任务的执行条件。阈值为0表示不检查，设置了多个阈值时满足任意一个即执行，
+// 都未设置时只受时段和间隔限制
+type MaintenancePolicy struct {
+	// Task 执行的任务
+	Task MaintenanceTask
+	// Windows 允许开始执行的低峰时段，为空表示任何时间
+	Windows []MaintenanceWindow
+	// MinInterval 同一策略两次执行的最小间隔，0表示每次检查都可以执行
+	MinInterval time.Duration
+	// MinFragmentation 碎片率（见 OptimizedIndexManager.Fragmentation）达到该值时执行
+	MinFragmentation float64
+	// MinPendingUpdates 待处理的异步更新数达到该值时执行
+	MinPendingUpdates int
+	// MaxShardBalance 分片平衡度（见 OptimizedIndexManager.ShardBalance）低于该值时执行
+	MaxShardBalance float64
+	// CompressionLevel MaintenanceCompress 使用的压缩级别
+	CompressionLevel int
+}
+
+// MaintenanceConfig 维护调度器配置
+type MaintenanceConfig struct {
+	// Policies 按顺序检查的策略，一次检查中可以执行多个策略
+	Policies []MaintenancePolicy
+	// CheckInterval 后台检查策略的间隔，0表示DefaultMaintenanceCheckInterval
+	CheckInterval time.Duration
+}
+
+// MaintenanceRun 一次维护任务的执行记录
+type MaintenanceRun struct {
+	// Task 执行的任务
+	Task MaintenanceTask
+	// Reason 触发原因
+	Reason string
+	// Start 开始时间
+	Start time.Time
+	// Duration 执行时长，包括限速等待
+	Duration time.Duration
+	// Err 任务返回的错误
+	Err error
+}
+
+// MaintenanceScheduler 按策略自动执行索引维护任务的调度器。
+//
+// 后台协程每隔 MaintenanceConfig.CheckInterval 检查一次策略，满足条件的任务依次同步执行，
+// 读写分片数据的速率受 IndexConfig.Throttle 限制。Pause 之后不再开始新的任务，正在执行的任务会完成。
+// 时间取自 IndexConfig.Clock
+type MaintenanceScheduler struct {
+	im       *OptimizedIndexManager
+	policies []MaintenancePolicy
+	interval time.Duration
+
+	// runMutex 保证同一时间只有一次检查在执行
+	runMutex sync.Mutex
+
+	mu      sync.Mutex
+	paused  bool
+	lastRun []time.Time
+	history []MaintenanceRun
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+}
+
+// NewMaintenanceScheduler 创建维护调度器，需要调用 Start 启动后台检查
+func NewMaintenanceScheduler(im *OptimizedIndexManager, config *MaintenanceConfig) *MaintenanceScheduler {
+	if config == nil {
+		config = &MaintenanceConfig{}
+	}
+	interval := config.CheckInterval
+	if interval <= 0 {
+		interval = DefaultMaintenanceCheckInterval
+	}
+	return &MaintenanceScheduler{
+		im:       im,
+		policies: slices.Clone(config.Policies),
+		interval: interval,
+		lastRun:  make([]time.Time, len(config.Policies)),
+	}
+}
+
+// Start 启动后台检查协程，已启动时不做任何事
+func (s *MaintenanceScheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopCh != nil {
+		return
+	}
+	s.stopCh = make(chan struct{})
+	s.doneCh = make(chan struct{})
+	go s.loop(s.stopCh, s.doneCh)
+
+	logger.Info("已启动索引维护调度", "interval", s.interval, "policies", len(s.policies))
+}
+
+// Stop 停止后台检查协程，并等待正在执行的任务结束
+func (s *MaintenanceScheduler) Stop() {
+	s.mu.Lock()
+	stopCh, doneCh := s.stopCh, s.doneCh
+	s.stopCh, s.doneCh = nil, nil
+	s.mu.Unlock()
+
+	if stopCh == nil {
+		return
+	}
+	close(stopCh)
+	<-doneCh
+}
+
+// Pause 暂停维护，之后的检查不再执行任务，正在执行的任务会完成
+func (s *MaintenanceScheduler) Pause() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = true
+}
+
+// Resume 恢复维护
+func (s *MaintenanceScheduler) Resume() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paused = false
+}
+
+// Paused 返回维护是否已暂停
+func (s *MaintenanceScheduler) Paused() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+// History 返回最近的执行记录，按开始时间排序
+func (s *MaintenanceScheduler) History() []MaintenanceRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.history)
+}
+
+// RunPending 立即检查一次策略，依次执行满足条件的任务并返回执行记录。暂停时返回nil
+func (s *MaintenanceScheduler) RunPending() []MaintenanceRun {
+	s.runMutex.Lock()
+	defer s.runMutex.Unlock()
+
+	var runs []MaintenanceRun
+	for i, policy := range s.policies {
+		if s.Paused() {
+			break
+		}
+		now := s.now()
+		reason, due := s.due(i, policy, now)
+		if !due {
+			continue
+		}
+
+		err := s.execute(policy)
+		run := MaintenanceRun{
+			Task:     policy.Task,
+			Reason:   reason,
+			Start:    now,
+			Duration: s.now().Sub(now),
+			Err:      err,
+		}
+		if err != nil {
+			logger.Error("索引维护任务失败", "task", policy.Task, "error", err)
+		}
+		runs = append(runs, run)
+		s.record(i, run)
+	}
+	return runs
+}
+
+// loop 后台检查循环
+func (s *MaintenanceScheduler) loop(stopCh <-chan struct{}, doneCh chan<- struct{}) {
+	defer close(doneCh)
+
+	ticker := clock.OrSystem(s.im.config.Clock).NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			s.RunPending()
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// now 返回索引管理器时钟的当前时间
+func (s *MaintenanceScheduler) now() time.Time {
+	return s.im.now()
+}
+
+// due 判断第i个策略是否应该执行，返回触发原因
+func (s *MaintenanceScheduler) due(i int, policy MaintenancePolicy, now time.Time) (string, bool) {
+	if len(policy.Windows) > 0 && !slices.ContainsFunc(policy.Windows, func(w MaintenanceWindow) bool {
+		return w.contains(now)
+	}) {
+		return "", false
+	}
+
+	s.mu.Lock()
+	last := s.lastRun[i]
+	s.mu.Unlock()
+	if policy.MinInterval > 0 && !last.IsZero() && now.Sub(last) < policy.MinInterval {
+		return "", false
+	}
+
+	thresholds := false
+	if policy.MinPendingUpdates > 0 {
+		thresholds = true
+		if pending := s.im.GetPendingTaskCount(); pending >= policy.MinPendingUpdates {
+			return fmt.Sprintf("pending updates %d", pending), true
+		}
+	}
+	if policy.MinFragmentation > 0 {
+		thresholds = true
+		if fragmentation := s.im.Fragmentation(); fragmentation >= policy.MinFragmentation {
+			return fmt.Sprintf("fragmentation %.2f", fragmentation), true
+		}
+	}
+	if policy.MaxShardBalance > 0 {
+		thresholds = true
+		if balance := s.im.ShardBalance(); balance < policy.MaxShardBalance {
+			return fmt.Sprintf("shard balance %.2f", balance), true
+		}
+	}
+	if thresholds {
+		return "", false
+	}
+	return "scheduled", true
+}
+
+// execute 执行策略的任务
+func (s *MaintenanceScheduler) execute(policy MaintenancePolicy) error {
+	switch policy.Task {
+	case MaintenanceOptimize:
+		return s.im.OptimizeIndex()
+	case MaintenanceCompress:
+		return s.im.CompressIndex(policy.CompressionLevel)
+	case MaintenanceRebalance:
+		return s.im.RebalanceShards()
+	default:
+		return fmt.Errorf("%w: maintenance task %d", ErrInvalidValue, int(policy.Task))
+	}
+}
+
+// record 保存执行记录。任务失败（如索引正忙）时不更新上次执行时间，下次检查时重试
+func (s *MaintenanceScheduler) record(i int, run MaintenanceRun) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if run.Err == nil {
+		s.lastRun[i] = run.Start
+	}
+	s.history = append(s.history, run)
+	if extra := len(s.history) - maxMaintenanceHistory; extra > 0 {
+		s.history = slices.Delete(s.history, 0, extra)
+	}
+}
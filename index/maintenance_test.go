@@ -0,0 +1,143 @@
+package index
+
+import (
+	"testing"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+)
+
+// newMaintenanceIndex 创建使用手动时钟的索引，按倒序添加ID使标签列表处于未排序状态
+func newMaintenanceIndex(t *testing.T, fakeClock *clock.Fake) *OptimizedIndexManager {
+	t.Helper()
+	im, err := NewOptimizedIndexManager(&IndexConfig{NumShards: 4, MaxWorkers: 1, Clock: fakeClock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { im.Close() })
+	for id := uint32(200); id > 0; id-- {
+		if err := im.AddIndex(id%3, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return im
+}
+
+// TestMaintenanceWindow 测试维护时段，包括跨越午夜的时段
+func TestMaintenanceWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 1, 1, hour, minute, 0, 0, time.UTC)
+	}
+	night := MaintenanceWindow{Start: 22 * time.Hour, End: 4 * time.Hour}
+	morning := MaintenanceWindow{Start: 2 * time.Hour, End: 4*time.Hour + 30*time.Minute}
+	allDay := MaintenanceWindow{}
+
+	tests := []struct {
+		window MaintenanceWindow
+		t      time.Time
+		want   bool
+	}{
+		{night, at(23, 0), true},
+		{night, at(3, 59), true},
+		{night, at(4, 0), false},
+		{night, at(12, 0), false},
+		{morning, at(2, 0), true},
+		{morning, at(4, 29), true},
+		{morning, at(4, 30), false},
+		{morning, at(1, 59), false},
+		{allDay, at(12, 0), true},
+	}
+	for _, tt := range tests {
+		if got := tt.window.contains(tt.t); got != tt.want {
+			t.Errorf("%+v contains %v = %v, want %v", tt.window, tt.t.Format("15:04"), got, tt.want)
+		}
+	}
+}
+
+// TestMaintenanceScheduler 测试按时段、碎片率阈值和最小间隔执行任务，以及暂停和恢复
+func TestMaintenanceScheduler(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	im := newMaintenanceIndex(t, fakeClock)
+	if im.Fragmentation() == 0 {
+		t.Fatal("index should be fragmented")
+	}
+
+	scheduler := NewMaintenanceScheduler(im, &MaintenanceConfig{Policies: []MaintenancePolicy{
+		{
+			Task:             MaintenanceOptimize,
+			Windows:          []MaintenanceWindow{{Start: 2 * time.Hour, End: 4 * time.Hour}},
+			MinFragmentation: 0.5,
+		},
+		{
+			Task:             MaintenanceCompress,
+			MinInterval:      time.Hour,
+			CompressionLevel: 1,
+		},
+	}})
+
+	// 不在时段内，只执行没有时段限制的压缩
+	runs := scheduler.RunPending()
+	if len(runs) != 1 || runs[0].Task != MaintenanceCompress || runs[0].Err != nil || runs[0].Reason != "scheduled" {
+		t.Fatalf("runs at noon: %+v", runs)
+	}
+	if im.Fragmentation() != 0 {
+		t.Errorf("fragmentation after compress: %v", im.Fragmentation())
+	}
+
+	// 第二天凌晨进入时段，新增的乱序ID使碎片率超过阈值
+	fakeClock.Set(time.Date(2024, 1, 2, 2, 30, 0, 0, time.UTC))
+	if err := im.AddIndex(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	for id := uint32(1400); id > 1000; id-- {
+		if err := im.AddIndex(5, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	scheduler.Pause()
+	if runs := scheduler.RunPending(); runs != nil {
+		t.Fatalf("runs while paused: %+v", runs)
+	}
+	scheduler.Resume()
+	// 优化按碎片率执行，压缩已过最小间隔也执行；之后两者都不再满足条件
+	runs = scheduler.RunPending()
+	if len(runs) != 2 || runs[0].Task != MaintenanceOptimize || runs[0].Reason == "scheduled" {
+		t.Fatalf("runs in window: %+v", runs)
+	}
+	if runs := scheduler.RunPending(); len(runs) != 0 {
+		t.Fatalf("runs after optimize: %+v", runs)
+	}
+
+	if history := scheduler.History(); len(history) != 3 {
+		t.Errorf("history: %+v", history)
+	}
+}
+
+// TestMaintenanceSchedulerBackground 测试后台按检查间隔执行任务，Stop等待后台协程结束
+func TestMaintenanceSchedulerBackground(t *testing.T) {
+	fakeClock := clock.NewFake(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	im := newMaintenanceIndex(t, fakeClock)
+
+	scheduler := NewMaintenanceScheduler(im, &MaintenanceConfig{
+		Policies:      []MaintenancePolicy{{Task: MaintenanceOptimize, MinFragmentation: 0.1}},
+		CheckInterval: time.Minute,
+	})
+	scheduler.Start()
+	defer scheduler.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(scheduler.History()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("scheduler did not run")
+		}
+		fakeClock.Advance(time.Minute)
+		time.Sleep(time.Millisecond)
+	}
+	if run := scheduler.History()[0]; run.Task != MaintenanceOptimize || run.Err != nil {
+		t.Errorf("run: %+v", run)
+	}
+	scheduler.Stop()
+	if im.Fragmentation() != 0 {
+		t.Errorf("fragmentation after background optimize: %v", im.Fragmentation())
+	}
+}
@@ -2,12 +2,11 @@
 package index
 
 import (
-	"container/heap"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"os"
 	"runtime"
 	"sort"
 	"strconv"
@@ -15,8 +14,14 @@ import (
 	"sync"
 	"sync/atomic"
 	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+	"github.com/bpfs/fragmenta/vfs"
 )
 
+// parallelShardThreshold 索引项少于该数量时顺序遍历分片，避免协程开销超过查询本身
+const parallelShardThreshold = 4096
+
 // 优先级队列项
 // 内部使用的UpdateTask定义，与外部接口区分
 type updateTaskInternal struct {
@@ -24,7 +29,6 @@ type updateTaskInternal struct {
 	ID        uint32
 	Operation UpdateOperation
 	Priority  int
-	Index     int
 	Timestamp time.Time
 }
 
@@ -35,6 +39,14 @@ type updateTaskInternal struct {
 // )
 
 // OptimizedIndexManager 优化版索引管理器
+//
+// 除LoadIndex外的导出方法都可以并发调用：写入同一分片的操作由分片写锁互斥，分片状态、计数器和
+// 错误信息分别由自己的锁或原子操作保护。LoadIndex整体替换分片数据，只能在没有其他调用时使用。
+//
+// 查询在读视图（见 indexView）中执行，看到的是某一时刻一致的索引状态。视图发布后不再修改，
+// 查询不加锁，长时间的查询也不会阻塞写入。涉及多个分片的写入（批量添加、批量移除、
+// 异步缓冲区的一次刷新）在所涉及分片的副本上修改后整体发布，对查询整体可见或整体不可见，
+// 复合查询的各个条件也在同一个读视图中求值
 type OptimizedIndexManager struct {
 	// 基本配置
 	config *IndexConfig
@@ -42,24 +54,40 @@ type OptimizedIndexManager struct {
 	// 索引元数据
 	metadata IndexMetadata
 
-	// 索引分片数据 - 外层map是分片ID，内层map是标签到ID列表的映射
-	shards []map[uint32][]uint32
+	// 当前发布的索引视图，publishMutex串行化视图的发布和标签过滤器的重建
+	view         atomic.Pointer[indexView]
+	publishMutex sync.Mutex
 
 	// 内容索引 - 分片形式存储
 	contentShards []map[string][]uint32
 
-	// 前缀树索引 - 加速前缀查询
+	// 前缀树索引 - 加速前缀查询，由prefixMutex保护
 	prefixTrees map[uint32]*PrefixNode
+	prefixMutex sync.Mutex
 
-	// 异步更新队列
-	updateQueue priorityQueue
+	// 异步更新队列，queueCond在任务出队或工作线程结束时广播，唤醒等待空位的调用者
+	updateQueue updateQueue
 	queueMutex  sync.Mutex
+	queueCond   *sync.Cond
+
+	// 等待空位的调用者数量和是否已有为它们处理队列的协程，由queueMutex保护。
+	// queueWake通知该协程再处理一次队列
+	queueWaiters  int
+	queueDraining bool
+	queueWake     chan struct{}
+
+	// 队列统计，由queueMutex保护
+	queuePeak       int
+	queueWaitTotal  time.Duration
+	queueWaitCount  int64
+	queueMaxWait    time.Duration
+	rejectedUpdates int64
 
 	// 线程池相关
 	workerPool   chan struct{}
 	workerWg     sync.WaitGroup
 	stopWorkers  chan struct{}
-	updateTicker *time.Ticker
+	updateTicker clock.Ticker
 
 	// 批量操作缓冲区
 	batchBuffer      map[uint32]map[UpdateOperation][]uint32
@@ -77,42 +105,26 @@ type OptimizedIndexManager struct {
 	compressionRatio float64
 	memoryUsage      int64
 	lastError        string
-	shardStatus      []ShardStatus
 
-	// 分片级锁 - 避免全局锁竞争
-	shardMutexes []sync.RWMutex
-}
-
-// 优先级队列
-type priorityQueue []*updateTaskInternal
+	// 分片状态，查询只持有分片读锁时也会更新访问统计，由shardStatusMutex保护
+	shardStatus      []ShardStatus
+	shardStatusMutex sync.Mutex
 
-func (pq priorityQueue) Len() int { return len(pq) }
+	// 分片写锁 - 写入同一分片的操作互斥，查询不加锁
+	shardMutexes []sync.Mutex
 
-func (pq priorityQueue) Less(i, j int) bool {
-	return pq[i].Priority < pq[j].Priority
-}
+	// 查询结果缓存，按标签失效，禁用时为nil
+	resultCache *indexResultCache
 
-func (pq priorityQueue) Swap(i, j int) {
-	pq[i], pq[j] = pq[j], pq[i]
-	pq[i].Index = i
-	pq[j].Index = j
-}
+	// 分片专属协程，只在 ExecutionShardAffinity 模式下不为nil
+	shardWorkers *shardWorkers
 
-func (pq *priorityQueue) Push(x interface{}) {
-	n := len(*pq)
-	item := x.(*updateTaskInternal)
-	item.Index = n
-	*pq = append(*pq, item)
-}
+	// 标签布隆过滤器，禁用时为nil，重建时整体替换
+	tagFilter           atomic.Pointer[tagFilter]
+	tagFilterRebuilding atomic.Bool
 
-func (pq *priorityQueue) Pop() interface{} {
-	old := *pq
-	n := len(old)
-	item := old[n-1]
-	old[n-1] = nil
-	item.Index = -1
-	*pq = old[0 : n-1]
-	return item
+	// 最近查询的延迟，供优化器记录统计历史
+	queryLatency latencyWindow
 }
 
 // NewOptimizedIndexManager 创建优化版索引管理器
@@ -136,38 +148,45 @@ func NewOptimizedIndexManager(config *IndexConfig) (*OptimizedIndexManager, erro
 		config.NumShards = 1
 	}
 
+	// 确保工作线程数至少为1，否则异步更新队列永远不会被处理
+	if config.MaxWorkers < 1 {
+		config.MaxWorkers = 1
+	}
+
 	// 创建管理器对象
+	now := clock.OrSystem(config.Clock).Now()
 	im := &OptimizedIndexManager{
 		config:         config,
-		shards:         make([]map[uint32][]uint32, config.NumShards),
 		contentShards:  make([]map[string][]uint32, config.NumShards),
 		prefixTrees:    make(map[uint32]*PrefixNode),
-		updateQueue:    make(priorityQueue, 0),
 		workerPool:     make(chan struct{}, config.MaxWorkers),
 		stopWorkers:    make(chan struct{}),
 		batchBuffer:    make(map[uint32]map[UpdateOperation][]uint32),
-		lastUpdateTime: time.Now(),
+		lastUpdateTime: now,
 		isUpdating:     false,
 		progress:       0,
 		indexedCount:   0,
 		pendingCount:   0,
 		activeWorkers:  0,
-		shardMutexes:   make([]sync.RWMutex, config.NumShards),
+		shardMutexes:   make([]sync.Mutex, config.NumShards),
 		shardStatus:    make([]ShardStatus, config.NumShards),
+		resultCache:    newIndexResultCache(config.QueryCacheSize),
 		metadata: IndexMetadata{
 			Version:    "1.0",
-			CreatedAt:  time.Now(),
-			ModifiedAt: time.Now(),
+			CreatedAt:  now,
+			ModifiedAt: now,
 			ShardCount: config.NumShards,
 		},
 	}
 
-	// 初始化堆
-	heap.Init(&im.updateQueue)
+	im.queueCond = sync.NewCond(&im.queueMutex)
+	im.queueWake = make(chan struct{}, 1)
+	im.tagFilter.Store(newTagFilter(config.TagFilterCapacity, config.TagFilterFalsePositiveRate))
 
 	// 初始化分片
+	shards := make([]map[uint32][]uint32, config.NumShards)
 	for i := 0; i < config.NumShards; i++ {
-		im.shards[i] = make(map[uint32][]uint32)
+		shards[i] = make(map[uint32][]uint32)
 		im.contentShards[i] = make(map[string][]uint32)
 		im.shardStatus[i] = ShardStatus{
 			ShardID:    i,
@@ -175,13 +194,14 @@ func NewOptimizedIndexManager(config *IndexConfig) (*OptimizedIndexManager, erro
 			Available:  true,
 			ReadCount:  0,
 			WriteCount: 0,
-			LastAccess: time.Now(),
+			LastAccess: now,
 		}
 	}
+	im.view.Store(&indexView{shards: shards})
 
 	// 如果索引文件存在，则加载
 	if config.IndexPath != "" {
-		_, err := os.Stat(config.IndexPath)
+		_, err := vfs.OrOS(config.FS).Stat(config.IndexPath)
 		if err == nil {
 			err = im.LoadIndex(config.IndexPath)
 			if err != nil {
@@ -191,6 +211,11 @@ func NewOptimizedIndexManager(config *IndexConfig) (*OptimizedIndexManager, erro
 		}
 	}
 
+	// 分片亲和模式下为每个分片启动专属协程
+	if config.ExecutionModel == ExecutionShardAffinity {
+		im.shardWorkers = newShardWorkers(config.NumShards, config.MailboxSize, config.ShardCPUs)
+	}
+
 	// 如果开启异步更新，启动工作线程
 	if config.AsyncUpdate {
 		im.startWorkers()
@@ -199,15 +224,96 @@ func NewOptimizedIndexManager(config *IndexConfig) (*OptimizedIndexManager, erro
 	return im, nil
 }
 
-// updateMemoryUsage 更新内存使用统计
+// now 返回配置的时钟的当前时间
+func (im *OptimizedIndexManager) now() time.Time {
+	return clock.OrSystem(im.config.Clock).Now()
+}
+
+// setLastError 记录后台任务的最后一个错误，由GetStatus返回
+func (im *OptimizedIndexManager) setLastError(err error) {
+	im.statusMutex.Lock()
+	defer im.statusMutex.Unlock()
+	im.lastError = err.Error()
+}
+
+// touchShard 更新分片的访问时间和读写次数
+func (im *OptimizedIndexManager) touchShard(shardID int, write bool) {
+	now := im.now()
+	im.shardStatusMutex.Lock()
+	defer im.shardStatusMutex.Unlock()
+
+	status := &im.shardStatus[shardID]
+	status.LastAccess = now
+	if write {
+		status.WriteCount++
+	} else {
+		status.ReadCount++
+	}
+}
+
+// addShardItems 调整分片的条目数
+func (im *OptimizedIndexManager) addShardItems(shardID int, delta int32) {
+	im.shardStatusMutex.Lock()
+	defer im.shardStatusMutex.Unlock()
+	im.shardStatus[shardID].ItemCount += delta
+}
+
+// setShardItems 设置分片的条目数
+func (im *OptimizedIndexManager) setShardItems(shardID int, count int32) {
+	im.shardStatusMutex.Lock()
+	defer im.shardStatusMutex.Unlock()
+	im.shardStatus[shardID].ItemCount = count
+}
+
+// shardStatusSnapshot 返回分片状态的副本
+func (im *OptimizedIndexManager) shardStatusSnapshot() []ShardStatus {
+	im.shardStatusMutex.Lock()
+	defer im.shardStatusMutex.Unlock()
+	return append([]ShardStatus(nil), im.shardStatus...)
+}
+
+// updateMemoryUsage 更新内存使用统计（调用者持有statusMutex）
 func (im *OptimizedIndexManager) updateMemoryUsage() {
 	// 实际实现可能需要更复杂的计算
-	im.memoryUsage = int64(len(im.shards) * 1024 * 1024) // 简化估算
+	im.memoryUsage = int64(len(im.readView().shards) * 1024 * 1024) // 简化估算
 }
 
 // getShardID 获取分片ID
 func (im *OptimizedIndexManager) getShardID(id uint32) int {
-	return int(id % uint32(len(im.shards)))
+	return int(id % uint32(len(im.readView().shards)))
+}
+
+// groupByShard 按分片分组ID
+func (im *OptimizedIndexManager) groupByShard(ids []uint32) map[int][]uint32 {
+	groups := make(map[int][]uint32)
+	for _, id := range ids {
+		shardID := im.getShardID(id)
+		groups[shardID] = append(groups[shardID], id)
+	}
+	return groups
+}
+
+// Close 停止后台工作线程和分片专属协程，已提交的异步任务执行完毕后返回。
+// 关闭后写入在调用者协程中执行，批量缓冲区和更新队列不再定时处理
+func (im *OptimizedIndexManager) Close() error {
+	if im.updateTicker != nil {
+		close(im.stopWorkers)
+		im.updateTicker.Stop()
+		im.workerWg.Wait()
+		im.updateTicker = nil
+	}
+	if im.shardWorkers != nil {
+		im.shardWorkers.stop()
+	}
+	return nil
+}
+
+// onShard 执行单个分片的写入，分片亲和模式下交给分片的专属协程执行。调用者不能持有分片锁
+func (im *OptimizedIndexManager) onShard(id uint32, fn func() error) error {
+	if im.shardWorkers == nil {
+		return fn()
+	}
+	return im.shardWorkers.call(im.getShardID(id), fn)
 }
 
 // startWorkers 启动工作线程
@@ -227,7 +333,7 @@ func (im *OptimizedIndexManager) startWorkers() {
 	if interval <= 0 {
 		interval = 100 // 默认100ms
 	}
-	im.updateTicker = time.NewTicker(time.Duration(interval) * time.Millisecond)
+	im.updateTicker = clock.OrSystem(im.config.Clock).NewTicker(time.Duration(interval) * time.Millisecond)
 
 	// 启动批处理线程
 	im.workerWg.Add(1)
@@ -235,7 +341,7 @@ func (im *OptimizedIndexManager) startWorkers() {
 		defer im.workerWg.Done()
 		for {
 			select {
-			case <-im.updateTicker.C:
+			case <-im.updateTicker.C():
 				// 处理批量缓冲区
 				im.processBatchBuffer()
 				// 处理更新队列
@@ -261,28 +367,29 @@ func (im *OptimizedIndexManager) processBatchBuffer() {
 
 	logger.Debug("处理批量缓冲区", "size", im.batchBufferSize)
 
-	// 遍历所有标签
+	// 整个缓冲区作为一次写入，查询看到全部或者都看不到
+	groups := make(map[uint32]map[UpdateOperation]map[int][]uint32, len(im.batchBuffer))
+	var all []map[int][]uint32
 	for tag, operations := range im.batchBuffer {
-		// 遍历所有操作类型
+		groups[tag] = make(map[UpdateOperation]map[int][]uint32, len(operations))
 		for op, ids := range operations {
-			if len(ids) == 0 {
-				continue
-			}
-
-			var err error
+			group := im.groupByShard(ids)
+			groups[tag][op] = group
+			all = append(all, group)
+		}
+	}
+	w := im.lockShards(all...)
+	for tag, operations := range groups {
+		for op, group := range operations {
 			switch op {
 			case OpAdd:
-				err = im.batchAddIndicesInternal(tag, ids)
+				im.batchAddLocked(w, tag, group)
 			case OpRemove:
-				err = im.batchRemoveIndicesInternal(tag, ids)
-			}
-
-			if err != nil {
-				logger.Error("批量处理失败", "tag", tag, "operation", op, "error", err)
-				im.lastError = err.Error()
+				im.batchRemoveLocked(w, tag, group)
 			}
 		}
 	}
+	w.commit()
 
 	// 清空缓冲区
 	im.batchBuffer = make(map[uint32]map[UpdateOperation][]uint32)
@@ -291,19 +398,22 @@ func (im *OptimizedIndexManager) processBatchBuffer() {
 
 // processUpdateQueue 处理更新队列
 func (im *OptimizedIndexManager) processUpdateQueue() {
-	for im.updateQueue.Len() > 0 {
-		// 达到最大工作线程数时等待
-		if atomic.LoadInt32(&im.activeWorkers) >= int32(im.config.MaxWorkers) {
+	for {
+		// 达到最大工作线程数时等待，分片亲和模式下由分片邮箱限制
+		if im.shardWorkers == nil && atomic.LoadInt32(&im.activeWorkers) >= int32(im.config.MaxWorkers) {
 			break
 		}
 
-		// 获取优先级最高的任务
+		// 按优先级类别和等待时间取下一个任务
 		im.queueMutex.Lock()
-		if im.updateQueue.Len() == 0 {
+		now := im.now()
+		task := im.updateQueue.pop(now, im.priorityAging())
+		if task == nil {
 			im.queueMutex.Unlock()
 			break
 		}
-		task := heap.Pop(&im.updateQueue).(*updateTaskInternal)
+		im.recordQueueWait(now.Sub(task.Timestamp))
+		im.queueCond.Broadcast()
 		im.queueMutex.Unlock()
 
 		// 更新计数
@@ -311,47 +421,140 @@ func (im *OptimizedIndexManager) processUpdateQueue() {
 		atomic.AddInt32(&im.activeWorkers, 1)
 
 		// 处理任务
+		if im.shardWorkers != nil {
+			im.shardWorkers.submit(im.getShardID(task.ID), func() {
+				im.applyUpdateTask(task)
+				im.finishUpdateTask()
+			})
+			continue
+		}
 		im.workerPool <- struct{}{}
 		go func(t *updateTaskInternal) {
-			var err error
-			switch t.Operation {
-			case OpAdd:
-				err = im.addIndexInternal(t.Tag, t.ID)
-			case OpRemove:
-				err = im.removeIndexInternal(t.Tag, t.ID)
-			}
-
-			if err != nil {
-				logger.Error("处理任务失败", "tag", t.Tag, "id", t.ID, "operation", t.Operation, "error", err)
-				im.lastError = err.Error()
-			}
-
-			// 更新计数
-			atomic.AddInt32(&im.activeWorkers, -1)
+			im.applyUpdateTask(t)
 			<-im.workerPool
+			im.finishUpdateTask()
 		}(task)
 	}
 }
 
-// addToUpdateQueue 添加到更新队列
-func (im *OptimizedIndexManager) addToUpdateQueue(op UpdateOperation, tag, id uint32, priority int) {
+// applyUpdateTask 在当前协程中执行更新任务，失败时记录错误
+func (im *OptimizedIndexManager) applyUpdateTask(t *updateTaskInternal) {
+	var err error
+	switch t.Operation {
+	case OpAdd:
+		err = im.addIndexInternal(t.Tag, t.ID)
+	case OpRemove:
+		err = im.removeIndexInternal(t.Tag, t.ID)
+	}
+
+	if err != nil {
+		logger.Error("处理任务失败", "tag", t.Tag, "id", t.ID, "operation", t.Operation, "error", err)
+		im.setLastError(err)
+	}
+}
+
+// finishUpdateTask 更新计数，唤醒等待空位的调用者，并通知队列处理协程取下一个任务
+func (im *OptimizedIndexManager) finishUpdateTask() {
+	atomic.AddInt32(&im.activeWorkers, -1)
+	im.wakeDrainer()
+
+	im.queueMutex.Lock()
+	im.queueCond.Broadcast()
+	im.queueMutex.Unlock()
+}
+
+// recordQueueWait 记录任务在队列中的等待时间（调用者持有queueMutex）
+func (im *OptimizedIndexManager) recordQueueWait(wait time.Duration) {
+	im.queueWaitTotal += wait
+	im.queueWaitCount++
+	if wait > im.queueMaxWait {
+		im.queueMaxWait = wait
+	}
+}
+
+// priorityAging 返回低优先级任务按等待时间调度的阈值，不大于0表示只按优先级调度
+func (im *OptimizedIndexManager) priorityAging() time.Duration {
+	if im.config.PriorityAging == 0 {
+		return DefaultPriorityAging
+	}
+	return im.config.PriorityAging
+}
+
+// drainQueueLocked 通知为等待空位的调用者处理队列的协程，没有时启动一个（调用者持有queueMutex）
+func (im *OptimizedIndexManager) drainQueueLocked() {
+	if im.queueDraining {
+		im.wakeDrainer()
+		return
+	}
+	im.queueDraining = true
+	go im.drainUpdateQueue()
+}
+
+// wakeDrainer 通知队列处理协程，已有未处理的通知时不再重复
+func (im *OptimizedIndexManager) wakeDrainer() {
+	select {
+	case im.queueWake <- struct{}{}:
+	default:
+	}
+}
+
+// drainUpdateQueue 处理队列，然后等待调用者或任务完成的通知，直到没有调用者等待空位
+func (im *OptimizedIndexManager) drainUpdateQueue() {
+	for {
+		im.processUpdateQueue()
+
+		im.queueMutex.Lock()
+		if im.queueWaiters == 0 {
+			im.queueDraining = false
+			im.queueMutex.Unlock()
+			return
+		}
+		im.queueMutex.Unlock()
+
+		<-im.queueWake
+	}
+}
+
+// addToUpdateQueue 把标签和ID一一对应的更新添加到更新队列。队列已满时按 QueueFullPolicy
+// 整体拒绝，或由队列处理协程腾出空位并逐个等待
+func (im *OptimizedIndexManager) addToUpdateQueue(op UpdateOperation, tags, ids []uint32, priority UpdatePriority) error {
+	if len(tags) != len(ids) {
+		return ErrLengthMismatch
+	}
+
 	im.queueMutex.Lock()
 	defer im.queueMutex.Unlock()
 
-	// 创建任务
-	task := &updateTaskInternal{
-		Tag:       tag,
-		ID:        id,
-		Operation: op,
-		Priority:  priority,
-		Timestamp: time.Now(),
+	limit := im.config.MaxQueueSize
+	if limit > 0 && im.config.QueueFullPolicy != QueueBlock && im.updateQueue.Len()+len(ids) > limit {
+		im.rejectedUpdates += int64(len(ids))
+		return ErrQueueFull
 	}
 
-	// 添加到队列
-	heap.Push(&im.updateQueue, task)
+	for i := range ids {
+		for limit > 0 && im.updateQueue.Len() >= limit {
+			im.queueWaiters++
+			im.drainQueueLocked()
+			im.queueCond.Wait()
+			im.queueWaiters--
+		}
 
-	// 更新计数
-	atomic.AddInt32(&im.pendingCount, 1)
+		// 添加到队列
+		im.updateQueue.push(&updateTaskInternal{
+			Tag:       tags[i],
+			ID:        ids[i],
+			Operation: op,
+			Priority:  int(priority),
+			Timestamp: im.now(),
+		})
+		if depth := im.updateQueue.Len(); depth > im.queuePeak {
+			im.queuePeak = depth
+		}
+
+		// 更新计数
+		atomic.AddInt32(&im.pendingCount, 1)
+	}
+	return nil
 }
 
 // addToBatchBuffer 添加到批量缓冲区
@@ -385,31 +588,26 @@ func (im *OptimizedIndexManager) addIndexInternal(tag uint32, id uint32) error {
 	shardID := im.getShardID(id)
 
 	// 获取分片锁
-	im.shardMutexes[shardID].Lock()
-	defer im.shardMutexes[shardID].Unlock()
+	w := im.lockShard(shardID)
+	defer w.commit()
 
 	// 更新分片访问时间
-	im.shardStatus[shardID].LastAccess = time.Now()
-	atomic.AddInt64(&im.shardStatus[shardID].WriteCount, 1)
-
-	// 检查标签是否存在
-	if _, ok := im.shards[shardID][tag]; !ok {
-		im.shards[shardID][tag] = make([]uint32, 0)
-	}
+	im.touchShard(shardID, true)
 
 	// 检查ID是否已存在
-	for _, existingID := range im.shards[shardID][tag] {
+	ids, _ := w.get(shardID, tag)
+	for _, existingID := range ids {
 		if existingID == id {
 			return nil // 已存在，无需添加
 		}
 	}
 
 	// 添加索引
-	im.shards[shardID][tag] = append(im.shards[shardID][tag], id)
+	w.set(shardID, tag, appendIDs(ids, id))
 
 	// 更新状态
 	atomic.AddInt32(&im.indexedCount, 1)
-	atomic.AddInt32(&im.shardStatus[shardID].ItemCount, 1)
+	im.addShardItems(shardID, 1)
 
 	// 更新前缀树（如果启用）
 	if im.config.EnablePrefixCompression {
@@ -425,25 +623,25 @@ func (im *OptimizedIndexManager) removeIndexInternal(tag uint32, id uint32) erro
 	shardID := im.getShardID(id)
 
 	// 获取分片锁
-	im.shardMutexes[shardID].Lock()
-	defer im.shardMutexes[shardID].Unlock()
+	w := im.lockShard(shardID)
+	defer w.commit()
 
 	// 更新分片访问时间
-	im.shardStatus[shardID].LastAccess = time.Now()
-	atomic.AddInt64(&im.shardStatus[shardID].WriteCount, 1)
+	im.touchShard(shardID, true)
 
 	// 检查标签是否存在
-	if _, ok := im.shards[shardID][tag]; !ok {
+	ids, ok := w.get(shardID, tag)
+	if !ok {
 		return ErrIndexNotFound
 	}
 
-	// 查找并移除ID
-	ids := im.shards[shardID][tag]
+	// 查找并移除ID，已发布的列表不能修改，复制其余的ID
 	found := false
 	for i, existingID := range ids {
 		if existingID == id {
-			// 移除元素
-			im.shards[shardID][tag] = append(ids[:i], ids[i+1:]...)
+			remaining := make([]uint32, 0, len(ids)-1)
+			remaining = append(remaining, ids[:i]...)
+			w.set(shardID, tag, append(remaining, ids[i+1:]...))
 			found = true
 			break
 		}
@@ -455,7 +653,7 @@ func (im *OptimizedIndexManager) removeIndexInternal(tag uint32, id uint32) erro
 
 	// 更新状态
 	atomic.AddInt32(&im.indexedCount, -1)
-	atomic.AddInt32(&im.shardStatus[shardID].ItemCount, -1)
+	im.addShardItems(shardID, -1)
 
 	// 更新前缀树（如果启用）
 	if im.config.EnablePrefixCompression {
@@ -467,41 +665,33 @@ func (im *OptimizedIndexManager) removeIndexInternal(tag uint32, id uint32) erro
 
 // 批量添加索引（内部实现）
 func (im *OptimizedIndexManager) batchAddIndicesInternal(tag uint32, ids []uint32) error {
-	// 按分片分组ID
-	shardGroups := make(map[int][]uint32)
-	for _, id := range ids {
-		shardID := im.getShardID(id)
-		if _, ok := shardGroups[shardID]; !ok {
-			shardGroups[shardID] = make([]uint32, 0)
-		}
-		shardGroups[shardID] = append(shardGroups[shardID], id)
-	}
+	groups := im.groupByShard(ids)
+	w := im.lockShards(groups)
+	defer w.commit()
 
-	// 对每个分片进行批量添加
-	for shardID, shardIDs := range shardGroups {
-		// 获取分片锁
-		im.shardMutexes[shardID].Lock()
+	im.batchAddLocked(w, tag, groups)
+	return nil
+}
 
+// batchAddLocked 在写入w中把按分片分组的ID添加到标签，w需持有各分片的写锁
+func (im *OptimizedIndexManager) batchAddLocked(w *shardWrite, tag uint32, groups map[int][]uint32) {
+	for shardID, shardIDs := range groups {
 		// 更新分片访问时间
-		im.shardStatus[shardID].LastAccess = time.Now()
-		atomic.AddInt64(&im.shardStatus[shardID].WriteCount, 1)
-
-		// 检查标签是否存在
-		if _, ok := im.shards[shardID][tag]; !ok {
-			im.shards[shardID][tag] = make([]uint32, 0, len(shardIDs))
-		}
+		im.touchShard(shardID, true)
 
 		// 创建现有ID的映射，用于快速查找
-		existingIDs := make(map[uint32]bool)
-		for _, id := range im.shards[shardID][tag] {
+		ids, _ := w.get(shardID, tag)
+		existingIDs := make(map[uint32]bool, len(ids))
+		for _, id := range ids {
 			existingIDs[id] = true
 		}
 
-		// 添加不存在的ID
+		// 添加不存在的ID，第一次追加时复制已发布的列表
 		addedCount := 0
+		ids = ids[:len(ids):len(ids)]
 		for _, id := range shardIDs {
 			if !existingIDs[id] {
-				im.shards[shardID][tag] = append(im.shards[shardID][tag], id)
+				ids = append(ids, id)
 				existingIDs[id] = true
 				addedCount++
 
@@ -514,40 +704,32 @@ func (im *OptimizedIndexManager) batchAddIndicesInternal(tag uint32, ids []uint3
 
 		// 更新状态
 		if addedCount > 0 {
+			w.set(shardID, tag, ids)
 			atomic.AddInt32(&im.indexedCount, int32(addedCount))
-			atomic.AddInt32(&im.shardStatus[shardID].ItemCount, int32(addedCount))
+			im.addShardItems(shardID, int32(addedCount))
 		}
-
-		im.shardMutexes[shardID].Unlock()
 	}
-
-	return nil
 }
 
 // 批量移除索引（内部实现）
 func (im *OptimizedIndexManager) batchRemoveIndicesInternal(tag uint32, ids []uint32) error {
-	// 按分片分组ID
-	shardGroups := make(map[int][]uint32)
-	for _, id := range ids {
-		shardID := im.getShardID(id)
-		if _, ok := shardGroups[shardID]; !ok {
-			shardGroups[shardID] = make([]uint32, 0)
-		}
-		shardGroups[shardID] = append(shardGroups[shardID], id)
-	}
+	groups := im.groupByShard(ids)
+	w := im.lockShards(groups)
+	defer w.commit()
 
-	// 对每个分片进行批量移除
-	for shardID, shardIDs := range shardGroups {
-		// 获取分片锁
-		im.shardMutexes[shardID].Lock()
+	im.batchRemoveLocked(w, tag, groups)
+	return nil
+}
 
+// batchRemoveLocked 在写入w中从标签移除按分片分组的ID，w需持有各分片的写锁
+func (im *OptimizedIndexManager) batchRemoveLocked(w *shardWrite, tag uint32, groups map[int][]uint32) {
+	for shardID, shardIDs := range groups {
 		// 更新分片访问时间
-		im.shardStatus[shardID].LastAccess = time.Now()
-		atomic.AddInt64(&im.shardStatus[shardID].WriteCount, 1)
+		im.touchShard(shardID, true)
 
 		// 检查标签是否存在
-		if _, ok := im.shards[shardID][tag]; !ok {
-			im.shardMutexes[shardID].Unlock()
+		ids, ok := w.get(shardID, tag)
+		if !ok {
 			continue // 跳过不存在的标签
 		}
 
@@ -558,9 +740,8 @@ func (im *OptimizedIndexManager) batchRemoveIndicesInternal(tag uint32, ids []ui
 		}
 
 		// 筛选出要保留的ID
-		originalLength := len(im.shards[shardID][tag])
-		newIDs := make([]uint32, 0, originalLength)
-		for _, id := range im.shards[shardID][tag] {
+		newIDs := make([]uint32, 0, len(ids))
+		for _, id := range ids {
 			if !removeIDs[id] {
 				newIDs = append(newIDs, id)
 			} else {
@@ -571,20 +752,14 @@ func (im *OptimizedIndexManager) batchRemoveIndicesInternal(tag uint32, ids []ui
 			}
 		}
 
-		// 更新分片中的ID列表
-		im.shards[shardID][tag] = newIDs
-
 		// 更新状态
-		removedCount := originalLength - len(newIDs)
+		removedCount := len(ids) - len(newIDs)
 		if removedCount > 0 {
+			w.set(shardID, tag, newIDs)
 			atomic.AddInt32(&im.indexedCount, -int32(removedCount))
-			atomic.AddInt32(&im.shardStatus[shardID].ItemCount, -int32(removedCount))
+			im.addShardItems(shardID, -int32(removedCount))
 		}
-
-		im.shardMutexes[shardID].Unlock()
 	}
-
-	return nil
 }
 
 // AddIndex 添加索引
@@ -595,7 +770,7 @@ func (im *OptimizedIndexManager) AddIndex(tag uint32, id uint32) error {
 		return nil
 	} else {
 		// 同步模式：直接添加
-		return im.addIndexInternal(tag, id)
+		return im.onShard(id, func() error { return im.addIndexInternal(tag, id) })
 	}
 }
 
@@ -607,26 +782,45 @@ func (im *OptimizedIndexManager) RemoveIndex(tag uint32, id uint32) error {
 		return nil
 	} else {
 		// 同步模式：直接移除
-		return im.removeIndexInternal(tag, id)
+		return im.onShard(id, func() error { return im.removeIndexInternal(tag, id) })
 	}
 }
 
-// AsyncAddIndex 异步添加索引
+// AsyncAddIndex 以 PriorityInteractive 异步添加索引，队列已满时见 IndexConfig.QueueFullPolicy
 func (im *OptimizedIndexManager) AsyncAddIndex(tag uint32, id uint32) error {
-	im.addToUpdateQueue(OpAdd, tag, id, 0) // 默认优先级为0（最高）
-	return nil
+	return im.AsyncAddIndexWithPriority(tag, id, PriorityInteractive)
 }
 
-// AsyncRemoveIndex 异步移除索引
+// AsyncRemoveIndex 以 PriorityInteractive 异步移除索引，队列已满时见 IndexConfig.QueueFullPolicy
 func (im *OptimizedIndexManager) AsyncRemoveIndex(tag uint32, id uint32) error {
-	im.addToUpdateQueue(OpRemove, tag, id, 0) // 默认优先级为0（最高）
-	return nil
+	return im.AsyncRemoveIndexWithPriority(tag, id, PriorityInteractive)
+}
+
+// AsyncAddIndexWithPriority 以指定优先级异步添加索引
+func (im *OptimizedIndexManager) AsyncAddIndexWithPriority(tag uint32, id uint32, priority UpdatePriority) error {
+	return im.addToUpdateQueue(OpAdd, []uint32{tag}, []uint32{id}, priority)
+}
+
+// AsyncRemoveIndexWithPriority 以指定优先级异步移除索引
+func (im *OptimizedIndexManager) AsyncRemoveIndexWithPriority(tag uint32, id uint32, priority UpdatePriority) error {
+	return im.addToUpdateQueue(OpRemove, []uint32{tag}, []uint32{id}, priority)
+}
+
+// BatchAddIndicesWithPriority 以指定优先级异步批量添加索引。与 BatchAddIndices 不同，
+// 更新总是进入异步更新队列；拒绝模式下队列放不下整批时整批拒绝
+func (im *OptimizedIndexManager) BatchAddIndicesWithPriority(tags []uint32, ids []uint32, priority UpdatePriority) error {
+	return im.addToUpdateQueue(OpAdd, tags, ids, priority)
+}
+
+// BatchRemoveIndicesWithPriority 以指定优先级异步批量移除索引，见 BatchAddIndicesWithPriority
+func (im *OptimizedIndexManager) BatchRemoveIndicesWithPriority(tags []uint32, ids []uint32, priority UpdatePriority) error {
+	return im.addToUpdateQueue(OpRemove, tags, ids, priority)
 }
 
 // BatchAddIndices 批量添加索引
 func (im *OptimizedIndexManager) BatchAddIndices(tags []uint32, ids []uint32) error {
 	if len(tags) != len(ids) {
-		return fmt.Errorf("tags and ids length mismatch")
+		return ErrLengthMismatch
 	}
 
 	// 按标签分组ID
@@ -638,19 +832,27 @@ func (im *OptimizedIndexManager) BatchAddIndices(tags []uint32, ids []uint32) er
 		tagGroups[tag] = append(tagGroups[tag], ids[i])
 	}
 
-	// 对每个标签进行批量添加
-	for tag, tagIDs := range tagGroups {
-		if im.config.AsyncUpdate {
-			// 异步模式：添加到批处理缓冲区
+	// 异步模式：添加到批处理缓冲区
+	if im.config.AsyncUpdate {
+		for tag, tagIDs := range tagGroups {
 			for _, id := range tagIDs {
 				im.addToBatchBuffer(OpAdd, tag, id)
 			}
-		} else {
-			// 同步模式：直接批量添加
-			if err := im.batchAddIndicesInternal(tag, tagIDs); err != nil {
-				return err
-			}
 		}
+		return nil
+	}
+
+	// 同步模式：同时持有所有涉及分片的写锁，整体发布，查询看到全部或者都看不到
+	shardGroups := make(map[uint32]map[int][]uint32, len(tagGroups))
+	all := make([]map[int][]uint32, 0, len(tagGroups))
+	for tag, tagIDs := range tagGroups {
+		shardGroups[tag] = im.groupByShard(tagIDs)
+		all = append(all, shardGroups[tag])
+	}
+	w := im.lockShards(all...)
+	defer w.commit()
+	for tag, groups := range shardGroups {
+		im.batchAddLocked(w, tag, groups)
 	}
 
 	return nil
@@ -659,7 +861,7 @@ func (im *OptimizedIndexManager) BatchAddIndices(tags []uint32, ids []uint32) er
 // BatchRemoveIndices 批量移除索引
 func (im *OptimizedIndexManager) BatchRemoveIndices(tags []uint32, ids []uint32) error {
 	if len(tags) != len(ids) {
-		return fmt.Errorf("tags and ids length mismatch")
+		return ErrLengthMismatch
 	}
 
 	// 按标签分组ID
@@ -671,19 +873,27 @@ func (im *OptimizedIndexManager) BatchRemoveIndices(tags []uint32, ids []uint32)
 		tagGroups[tag] = append(tagGroups[tag], ids[i])
 	}
 
-	// 对每个标签进行批量移除
-	for tag, tagIDs := range tagGroups {
-		if im.config.AsyncUpdate {
-			// 异步模式：添加到批处理缓冲区
+	// 异步模式：添加到批处理缓冲区
+	if im.config.AsyncUpdate {
+		for tag, tagIDs := range tagGroups {
 			for _, id := range tagIDs {
 				im.addToBatchBuffer(OpRemove, tag, id)
 			}
-		} else {
-			// 同步模式：直接批量移除
-			if err := im.batchRemoveIndicesInternal(tag, tagIDs); err != nil {
-				return err
-			}
 		}
+		return nil
+	}
+
+	// 同步模式：同时持有所有涉及分片的写锁，整体发布，查询看到全部或者都看不到
+	shardGroups := make(map[uint32]map[int][]uint32, len(tagGroups))
+	all := make([]map[int][]uint32, 0, len(tagGroups))
+	for tag, tagIDs := range tagGroups {
+		shardGroups[tag] = im.groupByShard(tagIDs)
+		all = append(all, shardGroups[tag])
+	}
+	w := im.lockShards(all...)
+	defer w.commit()
+	for tag, groups := range shardGroups {
+		im.batchRemoveLocked(w, tag, groups)
 	}
 
 	return nil
@@ -702,9 +912,10 @@ func (im *OptimizedIndexManager) updatePrefixTree(tag uint32, id uint32, isAdd b
 
 // SaveIndex 保存索引到文件
 func (im *OptimizedIndexManager) SaveIndex(path string) error {
-	// 获取状态锁
+	// 获取状态锁，并保存同一个读视图中一致的分片数据
 	im.statusMutex.RLock()
 	defer im.statusMutex.RUnlock()
+	view := im.readView()
 
 	// 准备要保存的数据
 	type IndexData struct {
@@ -717,7 +928,7 @@ func (im *OptimizedIndexManager) SaveIndex(path string) error {
 
 	data := IndexData{
 		Metadata:       im.metadata,
-		Shards:         im.shards,
+		Shards:         view.shards,
 		ContentShards:  im.contentShards,
 		LastUpdateTime: im.lastUpdateTime,
 	}
@@ -737,17 +948,17 @@ func (im *OptimizedIndexManager) SaveIndex(path string) error {
 	}
 
 	// 写入文件
-	return os.WriteFile(path, jsonData, 0644)
+	return vfs.OrOS(im.config.FS).WriteFile(path, jsonData, 0644)
 }
 
-// LoadIndex 从文件加载索引
+// LoadIndex 从文件加载索引，不能与其他方法并发调用
 func (im *OptimizedIndexManager) LoadIndex(path string) error {
 	// 获取状态锁
 	im.statusMutex.Lock()
 	defer im.statusMutex.Unlock()
 
 	// 读取文件
-	jsonData, err := os.ReadFile(path)
+	jsonData, err := vfs.OrOS(im.config.FS).ReadFile(path)
 	if err != nil {
 		return err
 	}
@@ -780,23 +991,28 @@ func (im *OptimizedIndexManager) LoadIndex(path string) error {
 		return ErrIndexCorrupted
 	}
 
-	// 更新索引数据
+	// 更新索引数据，发布新的视图
 	im.metadata = data.Metadata
-	im.shards = data.Shards
 	im.contentShards = data.ContentShards
 	im.lastUpdateTime = data.LastUpdateTime
+	im.publishMutex.Lock()
+	view := &indexView{gen: im.readView().gen + 1, shards: data.Shards}
+	im.view.Store(view)
+	im.resultCache.invalidateAll(view.gen)
+	im.rebuildTagFilter(view)
+	im.publishMutex.Unlock()
 
 	// 更新统计信息
 	var totalCount int32
-	for shardID, tagMap := range im.shards {
+	for shardID, tagMap := range view.shards {
 		var shardCount int32
 		for _, ids := range tagMap {
 			shardCount += int32(len(ids))
 		}
-		im.shardStatus[shardID].ItemCount = shardCount
+		im.setShardItems(shardID, shardCount)
 		totalCount += shardCount
 	}
-	im.indexedCount = totalCount
+	atomic.StoreInt32(&im.indexedCount, totalCount)
 
 	// 重建前缀树
 	if im.config.EnablePrefixCompression {
@@ -812,7 +1028,7 @@ func (im *OptimizedIndexManager) rebuildPrefixTrees() {
 	im.prefixTrees = make(map[uint32]*PrefixNode)
 
 	// 对每个分片的每个标签重建前缀树
-	for _, tagMap := range im.shards {
+	for _, tagMap := range im.readView().shards {
 		for tag, ids := range tagMap {
 			// 对每个ID添加到前缀树
 			for _, id := range ids {
@@ -822,31 +1038,56 @@ func (im *OptimizedIndexManager) rebuildPrefixTrees() {
 	}
 }
 
-// FindByKey 根据键查找
+// FindByKey 根据键查找，结果按标签缓存（见 IndexConfig.QueryCacheSize）。
+// 标签布隆过滤器判定标签不存在时不扫描分片，直接返回 ErrIndexNotFound
 func (im *OptimizedIndexManager) FindByKey(tag uint32) ([]uint32, error) {
-	// 创建结果切片
-	var result []uint32
+	defer im.observeQuery(im.now())
+	return im.cachedFindByKey(im.readView(), tag)
+}
 
-	// 遍历所有分片
-	for shardID := range im.shards {
-		// 获取分片读锁
-		im.shardMutexes[shardID].RLock()
+// cachedFindByKey 在读视图中使用缓存的按键查找
+func (im *OptimizedIndexManager) cachedFindByKey(view *indexView, tag uint32) ([]uint32, error) {
+	if !im.mayHaveTag(tag) {
+		return nil, ErrIndexNotFound
+	}
+	key := "eq:" + strconv.FormatUint(uint64(tag), 10)
+	if ids, err, ok := im.resultCache.get(view.gen, key); ok {
+		return ids, err
+	}
+	ids, err := im.findByKey(view, tag)
+	im.resultCache.put(view.gen, key, []uint32{tag}, ids, err)
+	return ids, err
+}
 
+// findByKey 在读视图中查找标签在所有分片中的ID，不使用缓存。结果按分片顺序合并
+func (im *OptimizedIndexManager) findByKey(view *indexView, tag uint32) ([]uint32, error) {
+	parts := make([][]uint32, len(view.shards))
+	found := make([]bool, len(view.shards))
+	im.forEachShard(len(view.shards), func(shardID int) {
 		// 如果标签存在于当前分片
-		if ids, ok := im.shards[shardID][tag]; ok {
+		if ids, ok := view.shards[shardID][tag]; ok {
 			// 更新分片访问统计
-			im.shardStatus[shardID].LastAccess = time.Now()
-			atomic.AddInt64(&im.shardStatus[shardID].ReadCount, 1)
+			im.touchShard(shardID, false)
 
-			// 追加ID到结果
-			if result == nil {
-				result = make([]uint32, 0, len(ids))
-			}
-			result = append(result, ids...)
+			parts[shardID] = append([]uint32(nil), ids...)
+			found[shardID] = true
 		}
+	})
 
-		// 释放分片读锁
-		im.shardMutexes[shardID].RUnlock()
+	// 创建结果切片
+	var result []uint32
+	total := 0
+	for _, ids := range parts {
+		total += len(ids)
+	}
+	for shardID, ids := range parts {
+		if !found[shardID] {
+			continue
+		}
+		if result == nil {
+			result = make([]uint32, 0, total)
+		}
+		result = append(result, ids...)
 	}
 
 	if result == nil {
@@ -856,6 +1097,33 @@ func (im *OptimizedIndexManager) FindByKey(tag uint32) ([]uint32, error) {
 	return result, nil
 }
 
+// forEachShard 对numShards个分片逐个调用fn。索引较大时借用工作池的空闲名额并行处理分片，
+// 没有空闲名额时在当前协程中处理，因此查询不会等待后台更新任务。fn只能修改自己分片的结果
+func (im *OptimizedIndexManager) forEachShard(numShards int, fn func(shardID int)) {
+	if numShards < 2 || atomic.LoadInt32(&im.indexedCount) < parallelShardThreshold {
+		for shardID := 0; shardID < numShards; shardID++ {
+			fn(shardID)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	for shardID := 0; shardID < numShards; shardID++ {
+		select {
+		case im.workerPool <- struct{}{}:
+			wg.Add(1)
+			go func(shardID int) {
+				defer wg.Done()
+				defer func() { <-im.workerPool }()
+				fn(shardID)
+			}(shardID)
+		default:
+			fn(shardID)
+		}
+	}
+	wg.Wait()
+}
+
 // FindByTag 根据标签查找
 func (im *OptimizedIndexManager) FindByTag(tag uint32) ([]uint32, error) {
 	return im.FindByKey(tag)
@@ -864,20 +1132,16 @@ func (im *OptimizedIndexManager) FindByTag(tag uint32) ([]uint32, error) {
 // FindByTagInShard 按分片获取索引
 func (im *OptimizedIndexManager) FindByTagInShard(tag uint32, shardID int) ([]uint32, error) {
 	// 验证分片ID
-	if shardID < 0 || shardID >= len(im.shards) {
+	view := im.readView()
+	if shardID < 0 || shardID >= len(view.shards) {
 		return nil, fmt.Errorf("invalid shard ID: %d", shardID)
 	}
 
-	// 获取分片读锁
-	im.shardMutexes[shardID].RLock()
-	defer im.shardMutexes[shardID].RUnlock()
-
 	// 更新分片访问统计
-	im.shardStatus[shardID].LastAccess = time.Now()
-	atomic.AddInt64(&im.shardStatus[shardID].ReadCount, 1)
+	im.touchShard(shardID, false)
 
 	// 如果标签存在于当前分片
-	if ids, ok := im.shards[shardID][tag]; ok {
+	if ids, ok := view.shards[shardID][tag]; ok {
 		// 创建结果副本
 		result := make([]uint32, len(ids))
 		copy(result, ids)
@@ -887,35 +1151,38 @@ func (im *OptimizedIndexManager) FindByTagInShard(tag uint32, shardID int) ([]ui
 	return nil, ErrIndexNotFound
 }
 
-// FindByPattern 根据模式查找
+// FindByPattern 根据模式查找，各分片的结果按分片顺序合并
 func (im *OptimizedIndexManager) FindByPattern(pattern string) (map[uint32][]uint32, error) {
-	// 创建结果映射
-	result := make(map[uint32][]uint32)
-
-	// 遍历所有分片
-	for shardID := range im.shards {
-		// 获取分片读锁
-		im.shardMutexes[shardID].RLock()
+	defer im.observeQuery(im.now())
+	view := im.readView()
 
+	parts := make([]map[uint32][]uint32, len(view.shards))
+	im.forEachShard(len(view.shards), func(shardID int) {
 		// 更新分片访问统计
-		im.shardStatus[shardID].LastAccess = time.Now()
-		atomic.AddInt64(&im.shardStatus[shardID].ReadCount, 1)
+		im.touchShard(shardID, false)
 
 		// 对每个标签进行模式匹配
-		for tag, ids := range im.shards[shardID] {
+		part := make(map[uint32][]uint32)
+		for tag, ids := range view.shards[shardID] {
 			tagStr := strconv.FormatUint(uint64(tag), 10)
 			if strings.Contains(tagStr, pattern) {
-				// 如果标签不在结果中，初始化
-				if _, ok := result[tag]; !ok {
-					result[tag] = make([]uint32, 0)
-				}
-				// 追加ID到结果
-				result[tag] = append(result[tag], ids...)
+				part[tag] = append([]uint32(nil), ids...)
 			}
 		}
+		parts[shardID] = part
+	})
 
-		// 释放分片读锁
-		im.shardMutexes[shardID].RUnlock()
+	// 创建结果映射
+	result := make(map[uint32][]uint32)
+	for _, part := range parts {
+		for tag, ids := range part {
+			// 如果标签不在结果中，初始化
+			if _, ok := result[tag]; !ok {
+				result[tag] = make([]uint32, 0, len(ids))
+			}
+			// 追加ID到结果
+			result[tag] = append(result[tag], ids...)
+		}
 	}
 
 	if len(result) == 0 {
@@ -931,7 +1198,7 @@ func (im *OptimizedIndexManager) UpdateIndices() error {
 	im.statusMutex.Lock()
 	if im.isUpdating {
 		im.statusMutex.Unlock()
-		return fmt.Errorf("index is already updating")
+		return ErrIndexBusy
 	}
 	im.isUpdating = true
 	im.progress = 0
@@ -942,29 +1209,28 @@ func (im *OptimizedIndexManager) UpdateIndices() error {
 		im.statusMutex.Lock()
 		im.isUpdating = false
 		im.progress = 100
-		im.lastUpdateTime = time.Now()
+		im.lastUpdateTime = im.now()
 		im.statusMutex.Unlock()
 	}()
 
 	// 遍历所有分片执行更新
-	for shardID := range im.shards {
+	numShards := len(im.readView().shards)
+	for shardID := 0; shardID < numShards; shardID++ {
 		// 更新进度
 		im.statusMutex.Lock()
-		im.progress = int32((shardID * 100) / len(im.shards))
+		im.progress = int32((shardID * 100) / numShards)
 		im.statusMutex.Unlock()
 
-		// 获取分片写锁
-		im.shardMutexes[shardID].Lock()
-
-		// 执行分片优化
-		im.optimizeShard(shardID)
-
-		// 释放分片写锁
-		im.shardMutexes[shardID].Unlock()
+		// 获取分片写锁，执行分片优化后发布
+		w := im.lockShard(shardID)
+		im.optimizeShard(w, shardID)
+		w.commit()
 	}
 
 	// 更新内存使用情况
+	im.statusMutex.Lock()
 	im.updateMemoryUsage()
+	im.statusMutex.Unlock()
 
 	// 如果启用自动保存，则保存索引
 	if im.config.AutoSave && im.config.IndexPath != "" {
@@ -974,11 +1240,22 @@ func (im *OptimizedIndexManager) UpdateIndices() error {
 	return nil
 }
 
-// 优化单个分片
-func (im *OptimizedIndexManager) optimizeShard(shardID int) {
-	// 对每个标签的ID列表进行排序和去重
-	for tag, ids := range im.shards[shardID] {
+// shardBytes 估算分片中ID列表的字节数
+func (im *OptimizedIndexManager) shardBytes(shardID int) int64 {
+	var n int64
+	for _, ids := range im.readView().shards[shardID] {
+		n += int64(len(ids)) * 4
+	}
+	return n
+}
+
+// 在写入w中优化单个分片
+func (im *OptimizedIndexManager) optimizeShard(w *shardWrite, shardID int) {
+	// 对每个标签的ID列表进行排序和去重，已发布的列表不能修改，在副本上进行
+	for tag, ids := range w.read(shardID) {
 		if len(ids) > 1 {
+			ids = append([]uint32(nil), ids...)
+
 			// 排序
 			sort.Slice(ids, func(i, j int) bool {
 				return ids[i] < ids[j]
@@ -994,15 +1271,57 @@ func (im *OptimizedIndexManager) optimizeShard(shardID int) {
 			}
 
 			// 更新ID列表
-			im.shards[shardID][tag] = ids[:j+1]
+			w.set(shardID, tag, ids[:j+1])
 		}
 	}
 
 	// 更新分片状态
-	im.shardStatus[shardID].ItemCount = 0
-	for _, ids := range im.shards[shardID] {
-		im.shardStatus[shardID].ItemCount += int32(len(ids))
+	var count int32
+	for _, ids := range w.read(shardID) {
+		count += int32(len(ids))
+	}
+	im.setShardItems(shardID, count)
+}
+
+// Fragmentation 返回未排序或含重复ID的标签列表中的条目占全部条目的比例(0-1)，
+// OptimizeIndex 和 CompressIndex 之后为0
+func (im *OptimizedIndexManager) Fragmentation() float64 {
+	var total, fragmented int
+	for _, tagMap := range im.readView().shards {
+		for _, ids := range tagMap {
+			total += len(ids)
+			for i := 1; i < len(ids); i++ {
+				if ids[i] <= ids[i-1] {
+					fragmented += len(ids)
+					break
+				}
+			}
+		}
 	}
+	if total == 0 {
+		return 0
+	}
+	return float64(fragmented) / float64(total)
+}
+
+// ShardBalance 返回分片平衡度(0-1，1表示完全平衡)
+func (im *OptimizedIndexManager) ShardBalance() float64 {
+	return shardBalance(im.shardStatusSnapshot())
+}
+
+// observeQuery 记录从start开始的一次查询的延迟
+func (im *OptimizedIndexManager) observeQuery(start time.Time) {
+	im.queryLatency.record(im.now().Sub(start))
+}
+
+// QueryLatencyPercentile 返回最近查询延迟的百分位数(0-100)，没有查询时返回0
+func (im *OptimizedIndexManager) QueryLatencyPercentile(p float64) time.Duration {
+	return im.queryLatency.percentile(p)
+}
+
+// GetQueryCacheStats 返回查询结果缓存的命中率等统计
+func (im *OptimizedIndexManager) GetQueryCacheStats() QueryCacheStats {
+	return im.resultCache.stats()
 }
 
 // GetStatus 获取索引状态
@@ -1011,24 +1330,37 @@ func (im *OptimizedIndexManager) GetStatus() *IndexStatus {
 	defer im.statusMutex.RUnlock()
 
 	// 计算总项目数
+	shardStatus := im.shardStatusSnapshot()
 	totalItems := 0
-	for _, shard := range im.shardStatus {
+	for _, shard := range shardStatus {
 		totalItems += int(shard.ItemCount)
 	}
 
-	return &IndexStatus{
+	status := &IndexStatus{
 		TotalItems:       totalItems,
-		IndexedItems:     int(im.indexedCount),
+		IndexedItems:     int(atomic.LoadInt32(&im.indexedCount)),
 		LastUpdateTime:   im.lastUpdateTime,
 		IsUpdating:       im.isUpdating,
 		Progress:         int(im.progress),
 		Error:            im.lastError,
-		PendingUpdates:   int(im.pendingCount),
-		ActiveWorkers:    int(im.activeWorkers),
+		PendingUpdates:   int(atomic.LoadInt32(&im.pendingCount)),
+		ActiveWorkers:    int(atomic.LoadInt32(&im.activeWorkers)),
 		CompressionRatio: im.compressionRatio,
 		MemoryUsage:      im.memoryUsage,
-		ShardStatus:      im.shardStatus,
+		ShardStatus:      shardStatus,
+		QueueCapacity:    im.config.MaxQueueSize,
 	}
+
+	im.queueMutex.Lock()
+	status.QueuePeakDepth = im.queuePeak
+	status.QueueMaxLatency = im.queueMaxWait
+	status.RejectedUpdates = im.rejectedUpdates
+	if im.queueWaitCount > 0 {
+		status.QueueLatency = im.queueWaitTotal / time.Duration(im.queueWaitCount)
+	}
+	im.queueMutex.Unlock()
+
+	return status
 }
 
 // GetIndexMetadata 获取索引元数据
@@ -1036,12 +1368,10 @@ func (im *OptimizedIndexManager) GetIndexMetadata() *IndexMetadata {
 	im.statusMutex.RLock()
 	defer im.statusMutex.RUnlock()
 
-	// 更新元数据中的项目数量
-	im.metadata.ItemCount = int(im.indexedCount)
-	im.metadata.ModifiedAt = im.lastUpdateTime
-
-	// 创建副本
+	// 创建副本并填入当前的项目数量，只持有读锁，不能修改im.metadata
 	metadata := im.metadata
+	metadata.ItemCount = int(atomic.LoadInt32(&im.indexedCount))
+	metadata.ModifiedAt = im.lastUpdateTime
 	return &metadata
 }
 
@@ -1056,12 +1386,29 @@ func (im *OptimizedIndexManager) IndexMetadata(id uint32, tags []uint32) error {
 	return nil
 }
 
-// FindByPrefix 前缀搜索
+// FindByPrefix 前缀搜索，结果按标签和前缀缓存
 func (im *OptimizedIndexManager) FindByPrefix(tag uint32, prefix string) ([]uint32, error) {
+	defer im.observeQuery(im.now())
+	return im.cachedFindByPrefix(im.readView(), tag, prefix)
+}
+
+// cachedFindByPrefix 在读视图中使用缓存的前缀搜索
+func (im *OptimizedIndexManager) cachedFindByPrefix(view *indexView, tag uint32, prefix string) ([]uint32, error) {
+	key := prefixCacheKey(tag, prefix)
+	if ids, err, ok := im.resultCache.get(view.gen, key); ok {
+		return ids, err
+	}
+	ids, err := im.findByPrefix(view, tag, prefix)
+	im.resultCache.put(view.gen, key, []uint32{tag}, ids, err)
+	return ids, err
+}
+
+// findByPrefix 在读视图中前缀搜索，不使用缓存
+func (im *OptimizedIndexManager) findByPrefix(view *indexView, tag uint32, prefix string) ([]uint32, error) {
 	// 如果启用了前缀压缩，使用前缀树进行搜索
 	if im.config.EnablePrefixCompression {
 		// 获取前缀树
-		root, err := im.GetPrefixTree(tag)
+		root, err := im.prefixTree(view, tag)
 		if err != nil {
 			return nil, err
 		}
@@ -1076,7 +1423,7 @@ func (im *OptimizedIndexManager) FindByPrefix(tag uint32, prefix string) ([]uint
 	}
 
 	// 如果没有启用前缀压缩，使用常规查找后过滤
-	ids, err := im.FindByTag(tag)
+	ids, err := im.cachedFindByKey(view, tag)
 	if err != nil {
 		return nil, err
 	}
@@ -1158,13 +1505,21 @@ func (im *OptimizedIndexManager) collectAllIDs(node *PrefixNode) []uint32 {
 
 // GetPrefixTree 获取前缀树
 func (im *OptimizedIndexManager) GetPrefixTree(tag uint32) (*PrefixNode, error) {
+	return im.prefixTree(im.readView(), tag)
+}
+
+// prefixTree 获取前缀树，不存在时按读视图创建
+func (im *OptimizedIndexManager) prefixTree(view *indexView, tag uint32) (*PrefixNode, error) {
 	// 如果不启用前缀压缩，返回错误
 	if !im.config.EnablePrefixCompression {
 		return nil, fmt.Errorf("prefix compression not enabled")
 	}
 
 	// 检查前缀树是否存在
-	if prefixTree, ok := im.prefixTrees[tag]; ok {
+	im.prefixMutex.Lock()
+	prefixTree, ok := im.prefixTrees[tag]
+	im.prefixMutex.Unlock()
+	if ok {
 		return prefixTree, nil
 	}
 
@@ -1176,7 +1531,7 @@ func (im *OptimizedIndexManager) GetPrefixTree(tag uint32) (*PrefixNode, error)
 	}
 
 	// 将标签的所有ID添加到前缀树
-	ids, err := im.FindByTag(tag)
+	ids, err := im.cachedFindByKey(view, tag)
 	if err != nil {
 		return nil, err
 	}
@@ -1189,15 +1544,34 @@ func (im *OptimizedIndexManager) GetPrefixTree(tag uint32) (*PrefixNode, error)
 	}
 
 	// 保存前缀树
+	im.prefixMutex.Lock()
 	im.prefixTrees[tag] = root
+	im.prefixMutex.Unlock()
 
 	return root, nil
 }
 
-// FindByRange 范围搜索
+// FindByRange 范围搜索，结果按标签和范围缓存
 func (im *OptimizedIndexManager) FindByRange(tag uint32, start, end uint32) ([]uint32, error) {
+	defer im.observeQuery(im.now())
+	return im.cachedFindByRange(im.readView(), tag, start, end)
+}
+
+// cachedFindByRange 在读视图中使用缓存的范围搜索
+func (im *OptimizedIndexManager) cachedFindByRange(view *indexView, tag uint32, start, end uint32) ([]uint32, error) {
+	key := rangeCacheKey(tag, start, end)
+	if ids, err, ok := im.resultCache.get(view.gen, key); ok {
+		return ids, err
+	}
+	ids, err := im.findByRange(view, tag, start, end)
+	im.resultCache.put(view.gen, key, []uint32{tag}, ids, err)
+	return ids, err
+}
+
+// findByRange 在读视图中范围搜索，不使用缓存
+func (im *OptimizedIndexManager) findByRange(view *indexView, tag uint32, start, end uint32) ([]uint32, error) {
 	// 获取标签的所有ID
-	ids, err := im.FindByTag(tag)
+	ids, err := im.cachedFindByKey(view, tag)
 	if err != nil {
 		return nil, err
 	}
@@ -1217,10 +1591,27 @@ func (im *OptimizedIndexManager) FindByRange(tag uint32, start, end uint32) ([]u
 	return result, nil
 }
 
-// FindCompound 复合查询
+// FindCompound 复合查询，条件都受支持时结果按规范化的条件缓存
 func (im *OptimizedIndexManager) FindCompound(conditions []IndexQueryCondition) ([]uint32, error) {
+	defer im.observeQuery(im.now())
+	view := im.readView()
+
+	key, tags, cacheable := compoundCacheKey(conditions)
+	if !cacheable || len(conditions) == 0 {
+		return im.findCompound(view, conditions)
+	}
+	if ids, err, ok := im.resultCache.get(view.gen, key); ok {
+		return ids, err
+	}
+	ids, err := im.findCompound(view, conditions)
+	im.resultCache.put(view.gen, key, tags, ids, err)
+	return ids, err
+}
+
+// findCompound 在读视图中复合查询，各条件的查询仍使用缓存
+func (im *OptimizedIndexManager) findCompound(view *indexView, conditions []IndexQueryCondition) ([]uint32, error) {
 	if len(conditions) == 0 {
-		return nil, fmt.Errorf("no conditions provided")
+		return nil, ErrNoConditions
 	}
 
 	// 执行第一个条件获取初始结果集
@@ -1230,19 +1621,19 @@ func (im *OptimizedIndexManager) FindCompound(conditions []IndexQueryCondition)
 	firstCondition := conditions[0]
 	switch firstCondition.Operation {
 	case "eq": // 等于
-		result, err = im.FindByTag(firstCondition.Tag)
+		result, err = im.cachedFindByKey(view, firstCondition.Tag)
 	case "prefix": // 前缀
 		prefix, ok := firstCondition.Value.(string)
 		if !ok {
-			return nil, fmt.Errorf("prefix value must be string")
+			return nil, fmt.Errorf("%w: prefix value must be string", ErrInvalidValue)
 		}
-		result, err = im.FindByPrefix(firstCondition.Tag, prefix)
+		result, err = im.cachedFindByPrefix(view, firstCondition.Tag, prefix)
 	case "range": // 范围
 		rangeValues, ok := firstCondition.Value.([]uint32)
 		if !ok || len(rangeValues) != 2 {
-			return nil, fmt.Errorf("range value must be array of two uint32")
+			return nil, fmt.Errorf("%w: range value must be array of two uint32", ErrInvalidValue)
 		}
-		result, err = im.FindByRange(firstCondition.Tag, rangeValues[0], rangeValues[1])
+		result, err = im.cachedFindByRange(view, firstCondition.Tag, rangeValues[0], rangeValues[1])
 	default:
 		return nil, fmt.Errorf("unsupported operation: %s", firstCondition.Operation)
 	}
@@ -1259,19 +1650,19 @@ func (im *OptimizedIndexManager) FindCompound(conditions []IndexQueryCondition)
 		// 获取条件的结果集
 		switch condition.Operation {
 		case "eq": // 等于
-			conditionResult, err = im.FindByTag(condition.Tag)
+			conditionResult, err = im.cachedFindByKey(view, condition.Tag)
 		case "prefix": // 前缀
 			prefix, ok := condition.Value.(string)
 			if !ok {
-				return nil, fmt.Errorf("prefix value must be string")
+				return nil, fmt.Errorf("%w: prefix value must be string", ErrInvalidValue)
 			}
-			conditionResult, err = im.FindByPrefix(condition.Tag, prefix)
+			conditionResult, err = im.cachedFindByPrefix(view, condition.Tag, prefix)
 		case "range": // 范围
 			rangeValues, ok := condition.Value.([]uint32)
 			if !ok || len(rangeValues) != 2 {
-				return nil, fmt.Errorf("range value must be array of two uint32")
+				return nil, fmt.Errorf("%w: range value must be array of two uint32", ErrInvalidValue)
 			}
-			conditionResult, err = im.FindByRange(condition.Tag, rangeValues[0], rangeValues[1])
+			conditionResult, err = im.cachedFindByRange(view, condition.Tag, rangeValues[0], rangeValues[1])
 		default:
 			return nil, fmt.Errorf("unsupported operation: %s", condition.Operation)
 		}
@@ -1315,7 +1706,7 @@ func (im *OptimizedIndexManager) OptimizeIndex() error {
 	im.statusMutex.Lock()
 	if im.isUpdating {
 		im.statusMutex.Unlock()
-		return fmt.Errorf("index is already updating")
+		return ErrIndexBusy
 	}
 	im.isUpdating = true
 	im.progress = 0
@@ -1326,22 +1717,25 @@ func (im *OptimizedIndexManager) OptimizeIndex() error {
 		im.statusMutex.Lock()
 		im.isUpdating = false
 		im.progress = 100
-		im.lastUpdateTime = time.Now()
+		im.lastUpdateTime = im.now()
 		im.statusMutex.Unlock()
 	}()
 
 	// 1. 优化每个分片
-	totalShards := len(im.shards)
-	for shardID := range im.shards {
+	totalShards := len(im.readView().shards)
+	for shardID := 0; shardID < totalShards; shardID++ {
 		// 更新进度
 		im.statusMutex.Lock()
 		im.progress = int32((shardID * 50) / totalShards) // 前50%的进度用于分片优化
 		im.statusMutex.Unlock()
 
-		// 获取分片写锁
-		im.shardMutexes[shardID].Lock()
-		im.optimizeShard(shardID)
-		im.shardMutexes[shardID].Unlock()
+		// 后台优化按分片大小限速，在获取分片锁之前等待，避免阻塞前台查询
+		im.config.Throttle.Wait(context.Background(), im.shardBytes(shardID))
+
+		// 获取分片写锁，优化后发布
+		w := im.lockShard(shardID)
+		im.optimizeShard(w, shardID)
+		w.commit()
 	}
 
 	// 2. 如果启用前缀压缩，重建前缀树
@@ -1359,6 +1753,7 @@ func (im *OptimizedIndexManager) OptimizeIndex() error {
 	im.statusMutex.Unlock()
 
 	// 计算大小优化率
+	im.statusMutex.Lock()
 	beforeSize := im.memoryUsage
 	im.updateMemoryUsage()
 	afterSize := im.memoryUsage
@@ -1366,6 +1761,7 @@ func (im *OptimizedIndexManager) OptimizeIndex() error {
 	if beforeSize > 0 {
 		im.compressionRatio = float64(beforeSize-afterSize) / float64(beforeSize) * 100
 	}
+	im.statusMutex.Unlock()
 
 	// 4. 如果启用自动保存，则保存索引
 	if im.config.AutoSave && im.config.IndexPath != "" {
@@ -1381,7 +1777,7 @@ func (im *OptimizedIndexManager) CompressIndex(level int) error {
 	im.statusMutex.Lock()
 	if im.isUpdating {
 		im.statusMutex.Unlock()
-		return fmt.Errorf("index is already updating")
+		return ErrIndexBusy
 	}
 	im.isUpdating = true
 	im.progress = 0
@@ -1392,7 +1788,7 @@ func (im *OptimizedIndexManager) CompressIndex(level int) error {
 		im.statusMutex.Lock()
 		im.isUpdating = false
 		im.progress = 100
-		im.lastUpdateTime = time.Now()
+		im.lastUpdateTime = im.now()
 		im.statusMutex.Unlock()
 	}()
 
@@ -1402,27 +1798,15 @@ func (im *OptimizedIndexManager) CompressIndex(level int) error {
 		return nil
 
 	case 1: // 轻度压缩：去重和排序
-		for shardID := range im.shards {
-			im.shardMutexes[shardID].Lock()
-			im.deduplicateAndSortShard(shardID)
-			im.shardMutexes[shardID].Unlock()
-		}
+		im.deduplicateAndSortShards()
 
 	case 2: // 中度压缩：添加前缀树索引
-		for shardID := range im.shards {
-			im.shardMutexes[shardID].Lock()
-			im.deduplicateAndSortShard(shardID)
-			im.shardMutexes[shardID].Unlock()
-		}
+		im.deduplicateAndSortShards()
 
 		return im.BuildPrefixIndex()
 
 	case 3: // 高度压缩：所有压缩技术
-		for shardID := range im.shards {
-			im.shardMutexes[shardID].Lock()
-			im.deduplicateAndSortShard(shardID)
-			im.shardMutexes[shardID].Unlock()
-		}
+		im.deduplicateAndSortShards()
 
 		if err := im.BuildPrefixIndex(); err != nil {
 			return err
@@ -1433,17 +1817,30 @@ func (im *OptimizedIndexManager) CompressIndex(level int) error {
 	}
 
 	// 更新内存使用情况
+	im.statusMutex.Lock()
 	im.updateMemoryUsage()
+	im.statusMutex.Unlock()
 
 	return nil
 }
 
-// deduplicateAndSortShard 对分片中的ID列表进行去重和排序
-func (im *OptimizedIndexManager) deduplicateAndSortShard(shardID int) {
-	for tag, ids := range im.shards[shardID] {
+// deduplicateAndSortShards 逐个分片去重和排序，每个分片在获取写锁之前按大小限速
+func (im *OptimizedIndexManager) deduplicateAndSortShards() {
+	for shardID := range im.readView().shards {
+		im.config.Throttle.Wait(context.Background(), im.shardBytes(shardID))
+		w := im.lockShard(shardID)
+		im.deduplicateAndSortShard(w, shardID)
+		w.commit()
+	}
+}
+
+// deduplicateAndSortShard 在写入w中对分片中的ID列表进行去重和排序，已发布的列表不能修改，在副本上进行
+func (im *OptimizedIndexManager) deduplicateAndSortShard(w *shardWrite, shardID int) {
+	for tag, ids := range w.read(shardID) {
 		if len(ids) <= 1 {
 			continue
 		}
+		ids = append([]uint32(nil), ids...)
 
 		// 排序
 		sort.Slice(ids, func(i, j int) bool {
@@ -1460,9 +1857,7 @@ func (im *OptimizedIndexManager) deduplicateAndSortShard(shardID int) {
 		}
 
 		// 更新ID列表
-		if j+1 < len(ids) {
-			im.shards[shardID][tag] = ids[:j+1]
-		}
+		w.set(shardID, tag, ids[:j+1])
 	}
 }
 
@@ -1470,31 +1865,29 @@ func (im *OptimizedIndexManager) deduplicateAndSortShard(shardID int) {
 func (im *OptimizedIndexManager) applyDeltaCompression() {
 	// 实现增量压缩算法
 	// 这里是简化实现，实际应用中可能需要更复杂的算法
-	for shardID := range im.shards {
-		im.shardMutexes[shardID].Lock()
-		for tag, ids := range im.shards[shardID] {
+	for _, tagMap := range im.readView().shards {
+		for _, ids := range tagMap {
 			if len(ids) < 3 {
 				continue
 			}
 
 			// 这里可以实现实际的增量压缩算法
 			// 例如，将相邻ID之间的差值存储，而不是存储完整的ID
-
-			// 简化:仅作为示例
-			im.shards[shardID][tag] = ids
+			// 压缩后的列表需要通过 shardWrite 发布，不能原地修改
 		}
-		im.shardMutexes[shardID].Unlock()
 	}
 }
 
 // BuildPrefixIndex 构建前缀索引以加速前缀查询
 func (im *OptimizedIndexManager) BuildPrefixIndex() error {
-	// 清空现有前缀树
-	im.prefixTrees = make(map[uint32]*PrefixNode)
+	view := im.readView()
+
+	// 构建新的前缀树，完成后整体替换
+	prefixTrees := make(map[uint32]*PrefixNode)
 
 	// 收集所有标签
 	tags := make(map[uint32]struct{})
-	for _, shard := range im.shards {
+	for _, shard := range view.shards {
 		for tag := range shard {
 			tags[tag] = struct{}{}
 		}
@@ -1512,8 +1905,8 @@ func (im *OptimizedIndexManager) BuildPrefixIndex() error {
 
 		// 收集标签对应的所有ID
 		var allIDs []uint32
-		for shardID := range im.shards {
-			if ids, ok := im.shards[shardID][tag]; ok {
+		for shardID := range view.shards {
+			if ids, ok := view.shards[shardID][tag]; ok {
 				allIDs = append(allIDs, ids...)
 			}
 		}
@@ -1527,9 +1920,13 @@ func (im *OptimizedIndexManager) BuildPrefixIndex() error {
 		}
 
 		// 存储前缀树
-		im.prefixTrees[tag] = root
+		prefixTrees[tag] = root
 	}
 
+	im.prefixMutex.Lock()
+	im.prefixTrees = prefixTrees
+	im.prefixMutex.Unlock()
+
 	return nil
 }
 
@@ -1568,7 +1965,7 @@ func (im *OptimizedIndexManager) RebalanceShards() error {
 	im.statusMutex.Lock()
 	if im.isUpdating {
 		im.statusMutex.Unlock()
-		return fmt.Errorf("index is already updating")
+		return ErrIndexBusy
 	}
 	im.isUpdating = true
 	im.progress = 0
@@ -1579,21 +1976,22 @@ func (im *OptimizedIndexManager) RebalanceShards() error {
 		im.statusMutex.Lock()
 		im.isUpdating = false
 		im.progress = 100
-		im.lastUpdateTime = time.Now()
+		im.lastUpdateTime = im.now()
 		im.statusMutex.Unlock()
 	}()
 
 	// 计算每个分片的项目数
-	counts := make([]int, len(im.shards))
-	for shardID := range im.shards {
+	view := im.readView()
+	counts := make([]int, len(view.shards))
+	for shardID := range view.shards {
 		count := 0
-		for _, ids := range im.shards[shardID] {
+		for _, ids := range view.shards[shardID] {
 			count += len(ids)
 		}
 		counts[shardID] = count
 
 		// 更新分片状态
-		im.shardStatus[shardID].ItemCount = int32(count)
+		im.setShardItems(shardID, int32(count))
 	}
 
 	// 计算平均项目数
@@ -1601,7 +1999,7 @@ func (im *OptimizedIndexManager) RebalanceShards() error {
 	for _, count := range counts {
 		total += count
 	}
-	avg := float64(total) / float64(len(im.shards))
+	avg := float64(total) / float64(len(view.shards))
 
 	// 找出负载过重和过轻的分片
 	threshold := 0.2 // 20%差异允许
@@ -1623,12 +2021,22 @@ func (im *OptimizedIndexManager) RebalanceShards() error {
 		return nil
 	}
 
+	// 按最多需要移动的数据量限速，在获取所有分片的写锁之前等待
+	var excess int64
+	for _, shardID := range overloaded {
+		excess += int64(float64(counts[shardID])-avg) * 4
+	}
+	im.config.Throttle.Wait(context.Background(), excess)
+
 	// 平衡分片
 	return im.balanceShards(overloaded, underloaded, counts, avg)
 }
 
-// balanceShards 平衡分片
+// balanceShards 平衡分片，移动期间持有所有分片的写锁，移动完成后整体发布
 func (im *OptimizedIndexManager) balanceShards(overloaded, underloaded []int, counts []int, avg float64) error {
+	w := im.lockAllShards()
+	defer w.commit()
+
 	// 对过载分片按负载从高到低排序
 	sort.Slice(overloaded, func(i, j int) bool {
 		return counts[overloaded[i]] > counts[overloaded[j]]
@@ -1643,7 +2051,7 @@ func (im *OptimizedIndexManager) balanceShards(overloaded, underloaded []int, co
 	for _, shardID := range overloaded {
 		// 确保该分片仍然过载
 		currentCount := 0
-		for _, ids := range im.shards[shardID] {
+		for _, ids := range w.read(shardID) {
 			currentCount += len(ids)
 		}
 
@@ -1651,9 +2059,6 @@ func (im *OptimizedIndexManager) balanceShards(overloaded, underloaded []int, co
 			continue // 已经足够平衡
 		}
 
-		// 获取该分片的写锁
-		im.shardMutexes[shardID].Lock()
-
 		// 计算需要移动的数据量
 		toMove := int(float64(currentCount) - avg)
 		moved := 0
@@ -1662,7 +2067,7 @@ func (im *OptimizedIndexManager) balanceShards(overloaded, underloaded []int, co
 		for _, targetShardID := range underloaded {
 			// 检查目标分片是否仍然负载不足
 			targetCount := 0
-			for _, ids := range im.shards[targetShardID] {
+			for _, ids := range w.read(targetShardID) {
 				targetCount += len(ids)
 			}
 
@@ -1670,9 +2075,6 @@ func (im *OptimizedIndexManager) balanceShards(overloaded, underloaded []int, co
 				continue // 已经足够平衡
 			}
 
-			// 获取目标分片的写锁
-			im.shardMutexes[targetShardID].Lock()
-
 			// 移动数据
 			neededCount := int(avg) - targetCount
 			if neededCount > toMove-moved {
@@ -1680,12 +2082,9 @@ func (im *OptimizedIndexManager) balanceShards(overloaded, underloaded []int, co
 			}
 
 			// 实际移动数据
-			movedCount := im.moveData(shardID, targetShardID, neededCount)
+			movedCount := im.moveData(w, shardID, targetShardID, neededCount)
 			moved += movedCount
 
-			// 释放目标分片的锁
-			im.shardMutexes[targetShardID].Unlock()
-
 			// 更新计数
 			counts[targetShardID] += movedCount
 			counts[shardID] -= movedCount
@@ -1695,20 +2094,17 @@ func (im *OptimizedIndexManager) balanceShards(overloaded, underloaded []int, co
 				break
 			}
 		}
-
-		// 释放该分片的锁
-		im.shardMutexes[shardID].Unlock()
 	}
 
 	return nil
 }
 
-// moveData 将数据从一个分片移动到另一个分片
-func (im *OptimizedIndexManager) moveData(sourceShardID, targetShardID, count int) int {
+// moveData 在写入w中将数据从一个分片移动到另一个分片
+func (im *OptimizedIndexManager) moveData(w *shardWrite, sourceShardID, targetShardID, count int) int {
 	moved := 0
 
 	// 遍历源分片中的所有标签
-	for tag, ids := range im.shards[sourceShardID] {
+	for tag, ids := range w.read(sourceShardID) {
 		// 如果已经移动了足够的数据，则跳出循环
 		if moved >= count {
 			break
@@ -1723,14 +2119,12 @@ func (im *OptimizedIndexManager) moveData(sourceShardID, targetShardID, count in
 		// 获取要移动的ID
 		movedIDs := ids[:numToMove]
 
-		// 更新源分片
-		im.shards[sourceShardID][tag] = ids[numToMove:]
+		// 更新源分片，剩余部分与已发布的列表共用底层数组，但之后的追加总是重新分配
+		w.set(sourceShardID, tag, ids[numToMove:])
 
 		// 更新目标分片
-		if _, ok := im.shards[targetShardID][tag]; !ok {
-			im.shards[targetShardID][tag] = make([]uint32, 0, numToMove)
-		}
-		im.shards[targetShardID][tag] = append(im.shards[targetShardID][tag], movedIDs...)
+		targetIDs, _ := w.get(targetShardID, tag)
+		w.set(targetShardID, tag, appendIDs(targetIDs, movedIDs...))
 
 		// 更新移动计数
 		moved += numToMove
@@ -1748,7 +2142,7 @@ func (im *OptimizedIndexManager) MeasureQueryPerformance(benchmarkQueries []inte
 	im.statusMutex.Lock()
 	if im.isUpdating {
 		im.statusMutex.Unlock()
-		return 0, fmt.Errorf("index is already updating")
+		return 0, ErrIndexBusy
 	}
 	im.isUpdating = true
 	im.progress = 0
@@ -1759,7 +2153,7 @@ func (im *OptimizedIndexManager) MeasureQueryPerformance(benchmarkQueries []inte
 		im.statusMutex.Lock()
 		im.isUpdating = false
 		im.progress = 100
-		im.lastUpdateTime = time.Now()
+		im.lastUpdateTime = im.now()
 		im.statusMutex.Unlock()
 	}()
 
@@ -1823,7 +2217,7 @@ func (im *OptimizedIndexManager) AsyncOptimizeIndex() <-chan error {
 	im.statusMutex.Lock()
 	if im.isUpdating {
 		im.statusMutex.Unlock()
-		resultCh <- fmt.Errorf("index is already updating")
+		resultCh <- ErrIndexBusy
 		close(resultCh)
 		return resultCh
 	}
@@ -1837,7 +2231,7 @@ func (im *OptimizedIndexManager) AsyncOptimizeIndex() <-chan error {
 			im.statusMutex.Lock()
 			im.isUpdating = false
 			im.progress = 100
-			im.lastUpdateTime = time.Now()
+			im.lastUpdateTime = im.now()
 			im.statusMutex.Unlock()
 
 			close(resultCh)
@@ -1856,7 +2250,7 @@ func (im *OptimizedIndexManager) GetOptimizationStats() *OptimizationStats {
 	return &OptimizationStats{
 		SizeBefore:                  im.memoryUsage,
 		SizeAfter:                   im.memoryUsage,
-		ExecutionTime:               time.Since(im.lastUpdateTime),
+		ExecutionTime:               im.now().Sub(im.lastUpdateTime),
 		OptimizedItems:              int(im.indexedCount),
 		CompressionRatio:            im.compressionRatio,
 		PrefixTreeNodes:             im.countPrefixTreeNodes(),
@@ -1869,6 +2263,9 @@ func (im *OptimizedIndexManager) GetOptimizationStats() *OptimizationStats {
 // countPrefixTreeNodes 计算前缀树节点数
 func (im *OptimizedIndexManager) countPrefixTreeNodes() int {
 	count := 0
+	im.prefixMutex.Lock()
+	defer im.prefixMutex.Unlock()
+
 	for _, root := range im.prefixTrees {
 		if root != nil {
 			count += im.countNodesRecursive(root)
@@ -1894,6 +2291,9 @@ func (im *OptimizedIndexManager) countNodesRecursive(node *PrefixNode) int {
 // calculatePrefixTreeDepth 计算前缀树深度
 func (im *OptimizedIndexManager) calculatePrefixTreeDepth() int {
 	maxDepth := 0
+	im.prefixMutex.Lock()
+	defer im.prefixMutex.Unlock()
+
 	for _, root := range im.prefixTrees {
 		if root != nil {
 			depth := im.calculateDepthRecursive(root)
@@ -2,9 +2,11 @@
 package index
 
 import (
+	"cmp"
 	"errors"
 	"fmt"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -39,6 +41,13 @@ const (
 	OpEndsWith   OperatorType = "endswith"   // 以...结束
 	OpMatches    OperatorType = "matches"    // 正则匹配
 
+	// 地理位置操作符
+	OpWithinRadius OperatorType = "within_radius" // 在圆形区域内
+	OpInBBox       OperatorType = "in_bbox"       // 在矩形区域内
+
+	// 向量操作符
+	OpNear OperatorType = "near" // 最相似的k个向量
+
 	// 逻辑操作符
 	OpAnd OperatorType = "and" // 逻辑与
 	OpOr  OperatorType = "or"  // 逻辑或
@@ -62,7 +71,11 @@ const (
 	TypeFloat   FieldType = "float"
 	TypeBoolean FieldType = "boolean"
 	TypeDate    FieldType = "date"
-	TypeTag     FieldType = "tag" // 标签类型（对应uint32）
+	TypeTag     FieldType = "tag"    // 标签类型（对应uint32）
+	TypeGeo     FieldType = "geo"    // 地理位置（GeoPoint或 "纬度,经度" 字符串）
+	TypeVector  FieldType = "vector" // 向量（[]float32或[]float64，near条件的值为VectorQuery）
+
+	TypeSubquery FieldType = "subquery" // 子查询结果（值为*Subquery）
 )
 
 // QueryCondition 查询条件
@@ -108,6 +121,9 @@ type Query struct {
 
 	// IncludeDeleted 是否包含已删除项
 	IncludeDeleted bool
+
+	// Select 结果中返回的字段，"*"表示所有字段；为空时只返回ID
+	Select []string
 }
 
 // QueryResult 查询结果
@@ -118,10 +134,25 @@ type QueryResult struct {
 	// TotalCount 总数（不考虑分页）
 	TotalCount int
 
+	// HasMore 分页之后是否还有更多结果
+	HasMore bool
+
+	// Rows 设置了Select时每个ID选择的字段值，与IDs顺序相同
+	Rows []QueryRow
+
 	// ExecutionTime 执行时间
 	ExecutionTime time.Duration
 }
 
+// QueryRow 投影查询结果中的一行
+type QueryRow struct {
+	// ID 查询到的ID
+	ID uint32
+
+	// Values 选择的字段值，不存在的字段不出现
+	Values map[string]interface{}
+}
+
 // MetadataProvider 元数据提供器接口
 type MetadataProvider interface {
 	// GetMetadataForID 获取指定ID的元数据
@@ -172,6 +203,41 @@ func (mp *DefaultMetadataProvider) GetAllIDs() ([]uint32, error) {
 	return ids, nil
 }
 
+// BatchMetadataProvider 可以一次获取多个ID元数据的元数据提供器，
+// 执行器据此为投影查询批量获取选择的字段
+type BatchMetadataProvider interface {
+	// GetMetadataForIDs 获取多个ID的元数据，fields不为空时只返回这些字段；没有元数据的ID不出现在结果中
+	GetMetadataForIDs(ids []uint32, fields []string) (map[uint32]map[string]interface{}, error)
+}
+
+// DeletionChecker 可以判断ID是否已删除的元数据提供器，
+// 执行器据此在查询未设置IncludeDeleted时过滤已删除项
+type DeletionChecker interface {
+	// IsDeleted 是否已删除
+	IsDeleted(id uint32) bool
+}
+
+// CandidateProvider 可以为字符串条件缩小候选范围的元数据提供器（如维护了三元组索引），
+// 执行器只检查返回的候选ID，候选必须包含所有可能匹配的ID
+type CandidateProvider interface {
+	// StringCandidates 返回字段可能满足字符串条件的ID（升序），无法缩小范围时返回false
+	StringCandidates(field string, operator OperatorType, value string) ([]uint32, bool)
+}
+
+// GeoCandidateProvider 可以为地理位置条件缩小候选范围的元数据提供器（如维护了地理位置索引），
+// 执行器只检查返回的候选ID，候选必须包含位置在区域内的所有ID
+type GeoCandidateProvider interface {
+	// GeoCandidates 返回字段位置可能在区域内的ID（升序），无法缩小范围时返回false
+	GeoCandidates(field string, box GeoBox) ([]uint32, bool)
+}
+
+// VectorProvider 维护了向量索引的元数据提供器，执行器用它求值near条件；
+// 没有实现该接口时执行器逐个比较字段值中的向量（余弦距离）
+type VectorProvider interface {
+	// Nearest 返回字段中与vector最相似的k个ID，按距离从近到远排列
+	Nearest(field string, vector []float32, k int) ([]VectorMatch, error)
+}
+
 // QueryExecutor 查询执行器接口
 type QueryExecutor interface {
 	// Execute 执行查询
@@ -181,6 +247,9 @@ type QueryExecutor interface {
 	ParseQueryString(queryStr string) (*Query, error)
 }
 
+// TagResolver 将标签条件中的名称解析为标签，如 "tag:meta==author"
+type TagResolver func(name string) (uint32, bool)
+
 // DefaultQueryExecutor 默认查询执行器实现
 type DefaultQueryExecutor struct {
 	// 索引管理器
@@ -188,6 +257,9 @@ type DefaultQueryExecutor struct {
 
 	// 元数据提供器
 	metadataProvider MetadataProvider
+
+	// 标签名称解析，为nil时标签条件只接受数字
+	tagResolver TagResolver
 }
 
 // NewQueryExecutor 创建查询执行器
@@ -208,6 +280,25 @@ func NewQueryExecutorWithMetadataProvider(indexManager IndexManager, metadataPro
 	}
 }
 
+// SetTagResolver 设置标签名称解析，之后标签条件的值可以是名称。需在执行查询前设置
+func (qe *DefaultQueryExecutor) SetTagResolver(resolver TagResolver) {
+	qe.tagResolver = resolver
+}
+
+// resolveTag 解析标签条件的值，先按数字解析，再按名称解析
+func (qe *DefaultQueryExecutor) resolveTag(valueStr string) (uint32, error) {
+	tag, err := strconv.ParseUint(valueStr, 10, 32)
+	if err == nil {
+		return uint32(tag), nil
+	}
+	if qe.tagResolver != nil {
+		if tag, ok := qe.tagResolver(valueStr); ok {
+			return tag, nil
+		}
+	}
+	return 0, err
+}
+
 // Execute 执行查询
 func (qe *DefaultQueryExecutor) Execute(query *Query) (*QueryResult, error) {
 	if query == nil || query.RootCondition == nil {
@@ -223,6 +314,17 @@ func (qe *DefaultQueryExecutor) Execute(query *Query) (*QueryResult, error) {
 		return nil, err
 	}
 
+	// 过滤已删除项
+	if checker, ok := qe.metadataProvider.(DeletionChecker); ok && !query.IncludeDeleted {
+		kept := make([]uint32, 0, len(ids))
+		for _, id := range ids {
+			if !checker.IsDeleted(id) {
+				kept = append(kept, id)
+			}
+		}
+		ids = kept
+	}
+
 	// 记录总数
 	totalCount := len(ids)
 
@@ -247,19 +349,86 @@ func (qe *DefaultQueryExecutor) Execute(query *Query) (*QueryResult, error) {
 		ids = ids[:query.Limit]
 	}
 
+	// 获取选择的字段
+	var rows []QueryRow
+	if len(query.Select) > 0 {
+		rows, err = qe.project(ids, query.Select)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &QueryResult{
 		IDs:           ids,
 		TotalCount:    totalCount,
+		HasMore:       max(query.Offset, 0)+len(ids) < totalCount,
+		Rows:          rows,
 		ExecutionTime: time.Since(startTime),
 	}, nil
 }
 
+// project 获取分页后每个ID选择的字段，元数据提供器支持时一次批量获取
+func (qe *DefaultQueryExecutor) project(ids []uint32, fields []string) ([]QueryRow, error) {
+	if slices.Contains(fields, "*") {
+		fields = nil
+	}
+
+	var metadata map[uint32]map[string]interface{}
+	if provider, ok := qe.metadataProvider.(BatchMetadataProvider); ok {
+		var err error
+		if metadata, err = provider.GetMetadataForIDs(ids, fields); err != nil {
+			return nil, err
+		}
+	} else {
+		metadata = make(map[uint32]map[string]interface{}, len(ids))
+		for _, id := range ids {
+			values, err := qe.metadataProvider.GetMetadataForID(id)
+			if errors.Is(err, ErrMetadataNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			metadata[id] = selectFields(values, fields)
+		}
+	}
+
+	rows := make([]QueryRow, len(ids))
+	for i, id := range ids {
+		rows[i] = QueryRow{ID: id, Values: metadata[id]}
+		if rows[i].Values == nil {
+			rows[i].Values = map[string]interface{}{}
+		}
+	}
+	return rows, nil
+}
+
+// selectFields 返回只包含选择字段的元数据，fields为空时返回全部字段
+func selectFields(metadata map[string]interface{}, fields []string) map[string]interface{} {
+	if len(fields) == 0 {
+		return metadata
+	}
+	selected := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		if value, ok := metadata[field]; ok {
+			selected[field] = value
+		}
+	}
+	return selected
+}
+
 // ParseQueryString 解析查询字符串
 func (qe *DefaultQueryExecutor) ParseQueryString(queryStr string) (*Query, error) {
 	if queryStr == "" {
 		return nil, ErrInvalidQuery
 	}
 
+	// 子查询中可以包含分号，先替换为占位符
+	queryStr, subqueries, err := extractSubqueries(queryStr)
+	if err != nil {
+		return nil, err
+	}
+
 	// 分割查询字符串
 	parts := strings.Split(queryStr, ";")
 
@@ -300,6 +469,29 @@ func (qe *DefaultQueryExecutor) ParseQueryString(queryStr string) (*Query, error
 			continue
 		}
 
+		// 解析是否包含已删除项
+		if strings.HasPrefix(part, "deleted:") {
+			switch mode := strings.TrimSpace(strings.TrimPrefix(part, "deleted:")); mode {
+			case "include":
+				query.IncludeDeleted = true
+			case "exclude":
+				query.IncludeDeleted = false
+			default:
+				return nil, fmt.Errorf("无效的deleted值: %s", mode)
+			}
+			continue
+		}
+
+		// 解析选择的字段
+		if strings.HasPrefix(part, "select:") {
+			for _, field := range strings.Split(strings.TrimPrefix(part, "select:"), ",") {
+				if field = strings.TrimSpace(field); field != "" {
+					query.Select = append(query.Select, field)
+				}
+			}
+			continue
+		}
+
 		// 解析排序
 		if strings.HasPrefix(part, "sort:") {
 			sortStr := strings.TrimPrefix(part, "sort:")
@@ -312,6 +504,9 @@ func (qe *DefaultQueryExecutor) ParseQueryString(queryStr string) (*Query, error
 		if err != nil {
 			return nil, err
 		}
+		if err := qe.resolveSubqueries(condition, subqueries); err != nil {
+			return nil, err
+		}
 		query.RootCondition = condition
 	}
 
@@ -358,27 +553,54 @@ func (qe *DefaultQueryExecutor) parseSortString(sortStr string) []*QuerySort {
 	return sorts
 }
 
+// 字符串操作符的查询语法，如 name contains foo、path matches ^/a/.*
+var stringOperatorPattern = regexp.MustCompile(`^(\S+)\s+(contains|startswith|endswith|matches)\s+(.+)$`)
+
+// geoOperatorPattern 地理位置操作符的查询语法，如 location within_radius 31.23,121.47,5km、
+// location in_bbox 30.5,120.8,31.5,122（最小纬度,最小经度,最大纬度,最大经度，也可以是geohash）
+var geoOperatorPattern = regexp.MustCompile(`^(\S+)\s+(within_radius|in_bbox)\s+(.+)$`)
+
+// betweenPattern between条件的查询语法
+var betweenPattern = regexp.MustCompile(`^(.*?)\s+between\s+(.*?)\s+and\s+(.*?)$`)
+
 // 解析条件字符串
 func (qe *DefaultQueryExecutor) parseConditionString(condStr string) (*QueryCondition, error) {
+	// not只作用于紧随其后的单个条件，not a==1 and b==2 等价于 (not a==1) and b==2
+	if rest, ok := strings.CutPrefix(condStr, "not "); ok && !hasLogicalOperator(rest) {
+		child, err := qe.parseConditionString(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, err
+		}
+		return &QueryCondition{
+			Operator: OpNot,
+			Children: []*QueryCondition{child},
+		}, nil
+	}
+
 	// 检查是否是exists操作符
 	if existsMatch := regexp.MustCompile(`^exists\s+(.*?)$`).FindStringSubmatch(condStr); len(existsMatch) == 2 {
 		return qe.parseExistsCondition(existsMatch[1])
 	}
 
 	// 检查是否是between操作符
-	if betweenMatch := regexp.MustCompile(`^(.*?)\s+between\s+(.*?)\s+and\s+(.*?)$`).FindStringSubmatch(condStr); len(betweenMatch) == 4 {
+	if betweenMatch := betweenPattern.FindStringSubmatch(condStr); len(betweenMatch) == 4 {
 		return qe.parseBetweenCondition(betweenMatch[1], betweenMatch[2], betweenMatch[3])
 	}
 
-	// 检查是否是集合操作符
-	if inMatch := regexp.MustCompile(`^(.*?)\s+in\s+\[(.*?)\]$`).FindStringSubmatch(condStr); len(inMatch) == 3 {
-		return qe.parseInCondition(inMatch[1], inMatch[2], false)
+	// 检查是否是子查询条件
+	if match := subqueryConditionPattern.FindStringSubmatch(condStr); len(match) == 4 {
+		return parseSubqueryCondition(match)
 	}
 
+	// 检查是否是集合操作符
 	if notInMatch := regexp.MustCompile(`^(.*?)\s+not\s+in\s+\[(.*?)\]$`).FindStringSubmatch(condStr); len(notInMatch) == 3 {
 		return qe.parseInCondition(notInMatch[1], notInMatch[2], true)
 	}
 
+	if inMatch := regexp.MustCompile(`^(.*?)\s+in\s+\[(.*?)\]$`).FindStringSubmatch(condStr); len(inMatch) == 3 {
+		return qe.parseInCondition(inMatch[1], inMatch[2], false)
+	}
+
 	// 检查是否包含逻辑操作符
 	if strings.Contains(condStr, " and ") {
 		return qe.parseLogicalCondition(condStr, OpAnd)
@@ -390,6 +612,14 @@ func (qe *DefaultQueryExecutor) parseConditionString(condStr string) (*QueryCond
 	return qe.parseSimpleCondition(condStr)
 }
 
+// hasLogicalOperator 判断条件字符串是否包含and/or连接的多个条件（between中的and除外）
+func hasLogicalOperator(condStr string) bool {
+	if strings.Contains(condStr, " or ") {
+		return true
+	}
+	return strings.Contains(condStr, " and ") && !betweenPattern.MatchString(condStr)
+}
+
 // 解析逻辑条件
 func (qe *DefaultQueryExecutor) parseLogicalCondition(condStr string, operator OperatorType) (*QueryCondition, error) {
 	var separator string
@@ -434,6 +664,32 @@ func (qe *DefaultQueryExecutor) parseLogicalCondition(condStr string, operator O
 
 // parseSimpleCondition 解析简单条件
 func (qe *DefaultQueryExecutor) parseSimpleCondition(condStr string) (*QueryCondition, error) {
+	// 地理位置操作符
+	if match := geoOperatorPattern.FindStringSubmatch(condStr); len(match) == 4 {
+		return parseGeoCondition(strings.TrimPrefix(match[1], "geo:"), OperatorType(match[2]), strings.TrimSpace(match[3]))
+	}
+
+	// 最近邻操作符
+	if match := nearOperatorPattern.FindStringSubmatch(condStr); len(match) == 4 {
+		return parseNearCondition(match[1], match[2], match[3])
+	}
+
+	// 字符串操作符
+	if match := stringOperatorPattern.FindStringSubmatch(condStr); len(match) == 4 {
+		value, _ := unquote(strings.TrimSpace(match[3]))
+		if match[2] == string(OpMatches) {
+			if _, err := regexp.Compile(value); err != nil {
+				return nil, fmt.Errorf("%w: 无效的正则表达式: %v", ErrSyntaxError, err)
+			}
+		}
+		return &QueryCondition{
+			Field:     match[1],
+			FieldType: TypeString,
+			Operator:  OperatorType(match[2]),
+			Value:     value,
+		}, nil
+	}
+
 	// 查找操作符
 	var operator OperatorType
 	var operatorStr string
@@ -471,13 +727,27 @@ func (qe *DefaultQueryExecutor) parseSimpleCondition(condStr string) (*QueryCond
 	}
 
 	field := strings.TrimSpace(parts[0])
-	value := strings.TrimSpace(parts[1])
+	value, quoted := unquote(strings.TrimSpace(parts[1]))
 
-	// 解析字段类型
+	// 解析字段类型，带引号的值总是字符串
 	var fieldType FieldType
-	if strings.HasPrefix(field, "tag:") {
+	if quoted {
+		fieldType = TypeString
+	} else if strings.HasPrefix(field, "tag:") {
 		fieldType = TypeTag
 		field = strings.TrimPrefix(field, "tag:")
+	} else if strings.HasPrefix(field, "int:") {
+		fieldType = TypeInteger
+		field = strings.TrimPrefix(field, "int:")
+	} else if strings.HasPrefix(field, "float:") {
+		fieldType = TypeFloat
+		field = strings.TrimPrefix(field, "float:")
+	} else if strings.HasPrefix(field, "bool:") {
+		fieldType = TypeBoolean
+		field = strings.TrimPrefix(field, "bool:")
+	} else if strings.HasPrefix(field, "date:") {
+		fieldType = TypeDate
+		field = strings.TrimPrefix(field, "date:")
 	} else {
 		// 根据值推断类型
 		if _, err := strconv.Atoi(value); err == nil {
@@ -550,11 +820,7 @@ func (qe *DefaultQueryExecutor) parseInCondition(fieldStr, valuesStr string, isN
 		switch fieldType {
 		case TypeString:
 			// 去除字符串的引号（如果有）
-			if (strings.HasPrefix(valueStr, "'") && strings.HasSuffix(valueStr, "'")) ||
-				(strings.HasPrefix(valueStr, "\"") && strings.HasSuffix(valueStr, "\"")) {
-				valueStr = valueStr[1 : len(valueStr)-1]
-			}
-			value = valueStr
+			value, _ = unquote(valueStr)
 		case TypeInteger:
 			value, err = strconv.ParseInt(valueStr, 10, 64)
 		case TypeFloat:
@@ -579,11 +845,11 @@ func (qe *DefaultQueryExecutor) parseInCondition(fieldStr, valuesStr string, isN
 				}
 			}
 		case TypeTag:
-			// 解析标签（uint32）
-			var tagVal uint64
-			tagVal, err = strconv.ParseUint(valueStr, 10, 32)
+			// 解析标签（uint32），也可以是标签名称
+			var tagVal uint32
+			tagVal, err = qe.resolveTag(valueStr)
 			if err == nil {
-				value = uint32(tagVal)
+				value = tagVal
 			}
 		}
 
@@ -653,13 +919,34 @@ func (qe *DefaultQueryExecutor) evaluateCondition(condition *QueryCondition) ([]
 			return nil, ErrInvalidQuery
 		}
 
-		// 对子条件求反
-		// TODO: 实现求反操作（需要知道所有可能的ID）
-		return nil, fmt.Errorf("暂不支持逻辑非操作")
+		// 对子条件求反：从所有ID中去掉满足子条件的ID
+		matched, err := qe.evaluateCondition(condition.Children[0])
+		if err != nil {
+			return nil, err
+		}
+		allIDs, err := qe.metadataProvider.GetAllIDs()
+		if err != nil {
+			return nil, err
+		}
+		return qe.difference(allIDs, matched), nil
+	}
+
+	// 处理子查询条件
+	if condition.FieldType == TypeSubquery {
+		return qe.evaluateSubqueryCondition(condition)
+	}
+
+	// 处理最近邻条件
+	if condition.Operator == OpNear {
+		return qe.evaluateNearCondition(condition)
 	}
 
 	// 处理标签条件
 	if condition.FieldType == TypeTag {
+		if qe.indexManager == nil {
+			return nil, fmt.Errorf("%w: 未配置索引管理器，无法查询标签", ErrUnsupportedOperator)
+		}
+
 		// 特殊字段处理
 		if condition.Field == "type" && condition.Operator == OpEqual {
 			// 对于type字段，需要将值从int转为对应的标签ID
@@ -667,10 +954,10 @@ func (qe *DefaultQueryExecutor) evaluateCondition(condition *QueryCondition) ([]
 			case int:
 				// 将type=1转为tag=1000，type=2转为tag=1001，以此类推
 				tag := uint32(1000 + v - 1)
-				return qe.indexManager.FindByTag(tag)
+				return qe.findByTag(tag)
 			case int64:
 				tag := uint32(1000 + int(v) - 1)
-				return qe.indexManager.FindByTag(tag)
+				return qe.findByTag(tag)
 			default:
 				return nil, fmt.Errorf("无效的type值类型: %T", condition.Value)
 			}
@@ -680,10 +967,10 @@ func (qe *DefaultQueryExecutor) evaluateCondition(condition *QueryCondition) ([]
 			case int:
 				// 将category=10转为tag=2010，以此类推
 				tag := uint32(2000 + v)
-				return qe.indexManager.FindByTag(tag)
+				return qe.findByTag(tag)
 			case int64:
 				tag := uint32(2000 + int(v))
-				return qe.indexManager.FindByTag(tag)
+				return qe.findByTag(tag)
 			default:
 				return nil, fmt.Errorf("无效的category值类型: %T", condition.Value)
 			}
@@ -691,11 +978,11 @@ func (qe *DefaultQueryExecutor) evaluateCondition(condition *QueryCondition) ([]
 			// 普通标签等于查询
 			switch v := condition.Value.(type) {
 			case uint32:
-				return qe.indexManager.FindByTag(v)
+				return qe.findByTag(v)
 			case int64:
-				return qe.indexManager.FindByTag(uint32(v))
+				return qe.findByTag(uint32(v))
 			case int:
-				return qe.indexManager.FindByTag(uint32(v))
+				return qe.findByTag(uint32(v))
 			default:
 				return nil, fmt.Errorf("无效的标签值类型: %T", condition.Value)
 			}
@@ -711,6 +998,15 @@ func (qe *DefaultQueryExecutor) evaluateCondition(condition *QueryCondition) ([]
 	return qe.evaluateMetadataCondition(condition)
 }
 
+// findByTag 查找带有标签的ID，没有该标签的索引时返回空结果
+func (qe *DefaultQueryExecutor) findByTag(tag uint32) ([]uint32, error) {
+	ids, err := qe.indexManager.FindByTag(tag)
+	if errors.Is(err, ErrIndexNotFound) {
+		return []uint32{}, nil
+	}
+	return ids, err
+}
+
 // evaluateTagInCondition 评估标签的In条件
 func (qe *DefaultQueryExecutor) evaluateTagInCondition(condition *QueryCondition) ([]uint32, error) {
 	values, ok := condition.Value.([]interface{})
@@ -734,7 +1030,7 @@ func (qe *DefaultQueryExecutor) evaluateTagInCondition(condition *QueryCondition
 		}
 
 		// 查询标签
-		tagIDs, err := qe.indexManager.FindByTag(tag)
+		tagIDs, err := qe.findByTag(tag)
 		if err != nil {
 			return nil, err
 		}
@@ -771,12 +1067,30 @@ func (qe *DefaultQueryExecutor) evaluateTagInCondition(condition *QueryCondition
 
 // evaluateMetadataCondition 评估元数据查询条件
 func (qe *DefaultQueryExecutor) evaluateMetadataCondition(condition *QueryCondition) ([]uint32, error) {
-	// 获取所有ID
-	allIDs, err := qe.metadataProvider.GetAllIDs()
+	// 获取候选ID，字符串和地理位置条件可由元数据提供器的索引缩小范围
+	allIDs, err := qe.candidateIDs(condition)
 	if err != nil {
 		return nil, err
 	}
 
+	// 正则表达式只编译一次
+	if condition.FieldType == TypeString && condition.Operator == OpMatches {
+		pattern, ok := condition.Value.(string)
+		if !ok {
+			return nil, ErrInvalidValue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		condition = &QueryCondition{
+			Field:     condition.Field,
+			FieldType: condition.FieldType,
+			Operator:  condition.Operator,
+			Value:     re,
+		}
+	}
+
 	// 过滤满足条件的ID
 	var resultIDs []uint32
 
@@ -833,6 +1147,51 @@ func (qe *DefaultQueryExecutor) evaluateMetadataCondition(condition *QueryCondit
 	return resultIDs, nil
 }
 
+// evaluateNearCondition 评估最近邻条件，结果按距离从近到远排列。与其他条件用and组合时
+// 先取全部数据中最相似的k个再过滤，结果可能少于k个
+func (qe *DefaultQueryExecutor) evaluateNearCondition(condition *QueryCondition) ([]uint32, error) {
+	query, ok := condition.Value.(VectorQuery)
+	if !ok || query.K <= 0 {
+		return nil, ErrInvalidValue
+	}
+
+	var matches []VectorMatch
+	var err error
+	if provider, ok := qe.metadataProvider.(VectorProvider); ok {
+		matches, err = provider.Nearest(condition.Field, query.Vector, query.K)
+	} else {
+		matches, err = bruteForceNearest(qe.metadataProvider, condition.Field, query)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint32, len(matches))
+	for i, match := range matches {
+		ids[i] = match.ID
+	}
+	return ids, nil
+}
+
+// candidateIDs 返回需要检查元数据条件的ID
+func (qe *DefaultQueryExecutor) candidateIDs(condition *QueryCondition) ([]uint32, error) {
+	if provider, ok := qe.metadataProvider.(GeoCandidateProvider); ok && condition.FieldType == TypeGeo {
+		if box, isArea := geoConditionBounds(condition); isArea {
+			if ids, narrowed := provider.GeoCandidates(condition.Field, box); narrowed {
+				return ids, nil
+			}
+		}
+	}
+	if provider, ok := qe.metadataProvider.(CandidateProvider); ok && condition.FieldType == TypeString {
+		if value, isString := condition.Value.(string); isString {
+			if ids, narrowed := provider.StringCandidates(condition.Field, condition.Operator, value); narrowed {
+				return ids, nil
+			}
+		}
+	}
+	return qe.metadataProvider.GetAllIDs()
+}
+
 // matchInCondition 判断值是否满足集合条件
 func (qe *DefaultQueryExecutor) matchInCondition(condition *QueryCondition, value interface{}) (bool, error) {
 	values, ok := condition.Value.([]interface{})
@@ -908,6 +1267,8 @@ func (qe *DefaultQueryExecutor) matchCondition(condition *QueryCondition, value
 		return qe.matchBooleanCondition(condition, value)
 	case TypeDate:
 		return qe.matchDateCondition(condition, value)
+	case TypeGeo:
+		return matchGeoCondition(condition, value)
 	default:
 		return false, ErrInvalidFieldType
 	}
@@ -921,6 +1282,10 @@ func (qe *DefaultQueryExecutor) matchStringCondition(condition *QueryCondition,
 		strValue = fmt.Sprintf("%v", value)
 	}
 
+	if re, ok := condition.Value.(*regexp.Regexp); ok && condition.Operator == OpMatches {
+		return re.MatchString(strValue), nil
+	}
+
 	condValue, ok := condition.Value.(string)
 	if !ok {
 		return false, ErrInvalidValue
@@ -1225,6 +1590,14 @@ func (qe *DefaultQueryExecutor) union(a, b []uint32) []uint32 {
 	return result
 }
 
+// unquote 去除字符串两端成对的单引号或双引号，返回是否带引号
+func unquote(s string) (string, bool) {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1], true
+	}
+	return s, false
+}
+
 // parseExistsCondition 解析 exists 条件
 func (qe *DefaultQueryExecutor) parseExistsCondition(fieldStr string) (*QueryCondition, error) {
 	fieldStr = strings.TrimSpace(fieldStr)
@@ -1344,12 +1717,12 @@ func (qe *DefaultQueryExecutor) parseValue(valueStr string, fieldType FieldType)
 		}
 		return t, err
 	case TypeTag:
-		// 对于标签类型，使用int作为存储类型，方便后续处理
-		intVal, err := strconv.Atoi(valueStr)
+		// 对于标签类型，使用int作为存储类型，方便后续处理；也可以是标签名称
+		tag, err := qe.resolveTag(valueStr)
 		if err != nil {
 			return nil, err
 		}
-		return intVal, nil
+		return int(tag), nil
 	default:
 		return nil, ErrInvalidFieldType
 	}
@@ -1585,19 +1958,77 @@ func (qe *DefaultQueryExecutor) applySorting(ids []uint32, sortCriteria []*Query
 	elements := make([]uint32, len(ids))
 	copy(elements, ids)
 
-	// 根据排序条件排序
-	sort.Slice(elements, func(i, j int) bool {
-		for _, sort := range sortCriteria {
-			if sort.Field == "id" {
-				if sort.Ascending {
-					return elements[i] < elements[j]
-				} else {
-					return elements[i] > elements[j]
+	// 预先取出排序字段的值，没有元数据的ID按字段不存在处理
+	values := make(map[uint32]map[string]interface{}, len(elements))
+	for _, sortBy := range sortCriteria {
+		if sortBy.Field == "id" {
+			continue
+		}
+		for _, id := range elements {
+			metadata, err := qe.metadataProvider.GetMetadataForID(id)
+			if err != nil && err != ErrMetadataNotFound {
+				return nil, err
+			}
+			values[id] = metadata
+		}
+		break
+	}
+
+	// 根据排序条件排序，所有字段都相同时按ID升序
+	sort.SliceStable(elements, func(i, j int) bool {
+		a, b := elements[i], elements[j]
+		for _, sortBy := range sortCriteria {
+			var c int
+			if sortBy.Field == "id" {
+				c = cmp.Compare(a, b)
+				if !sortBy.Ascending {
+					c = -c
 				}
+			} else {
+				c = compareFieldValues(values[a], values[b], sortBy.Field, sortBy.Ascending)
+			}
+			if c != 0 {
+				return c < 0
 			}
 		}
-		return elements[i] < elements[j]
+		return a < b
 	})
 
 	return elements, nil
 }
+
+// compareFieldValues 按排序方向比较两条元数据中的同一字段。无论升序降序，字段不存在的都排在最后；
+// 两个值都能转换为数字时按数值比较，时间按先后比较，其余按字符串比较
+func compareFieldValues(a, b map[string]interface{}, field string, ascending bool) int {
+	va, okA := a[field]
+	vb, okB := b[field]
+	switch {
+	case !okA && !okB:
+		return 0
+	case !okA:
+		return 1
+	case !okB:
+		return -1
+	}
+
+	c := compareValues(va, vb)
+	if !ascending {
+		c = -c
+	}
+	return c
+}
+
+// compareValues 比较两个字段值
+func compareValues(va, vb interface{}) int {
+	if ta, ok := va.(time.Time); ok {
+		if tb, ok := vb.(time.Time); ok {
+			return ta.Compare(tb)
+		}
+	}
+	if fa, err := strconv.ParseFloat(fmt.Sprint(va), 64); err == nil {
+		if fb, err := strconv.ParseFloat(fmt.Sprint(vb), 64); err == nil {
+			return cmp.Compare(fa, fb)
+		}
+	}
+	return strings.Compare(fmt.Sprint(va), fmt.Sprint(vb))
+}
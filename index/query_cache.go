@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/bpfs/fragmenta/clock"
 )
 
 // 定义缓存键结构
@@ -65,6 +67,9 @@ type ExtendedLRUQueryCache struct {
 
 	// 缓存过期时间（秒）
 	expiry int
+
+	// 判断过期使用的时钟，nil表示使用系统时钟
+	clock clock.Clock
 }
 
 // NewExtendedLRUQueryCache 创建新的LRU查询缓存
@@ -172,7 +177,7 @@ func (c *ExtendedLRUQueryCache) Get(query *Query) QueryPlan {
 		defer c.mutex.Unlock()
 
 		// 更新访问信息
-		item.accessTime = time.Now()
+		item.accessTime = c.now()
 		item.accessCount++
 
 		// 将节点移动到链表头部（最近使用）
@@ -207,7 +212,7 @@ func (c *ExtendedLRUQueryCache) Put(query *Query, plan QueryPlan) {
 		// 更新缓存项
 		item := element.Value.(*queryCacheItem)
 		item.plan = plan
-		item.accessTime = time.Now()
+		item.accessTime = c.now()
 		item.accessCount++
 
 		// 移动到链表头部
@@ -219,8 +224,8 @@ func (c *ExtendedLRUQueryCache) Put(query *Query, plan QueryPlan) {
 	item := &queryCacheItem{
 		key:         key,
 		plan:        plan,
-		accessTime:  time.Now(),
-		createTime:  time.Now(),
+		accessTime:  c.now(),
+		createTime:  c.now(),
 		accessCount: 1,
 	}
 
@@ -280,7 +285,7 @@ func (c *ExtendedLRUQueryCache) GetResult(plan QueryPlan) (*QueryResult, bool) {
 		c.mutex.Lock()
 		defer c.mutex.Unlock()
 
-		item.accessTime = time.Now()
+		item.accessTime = c.now()
 		item.accessCount++
 
 		// 将节点移动到链表头部
@@ -314,7 +319,7 @@ func (c *ExtendedLRUQueryCache) PutResult(plan QueryPlan, result *QueryResult) {
 		// 更新缓存项
 		item := element.Value.(*queryCacheItem)
 		item.result = result
-		item.accessTime = time.Now()
+		item.accessTime = c.now()
 		item.accessCount++
 
 		// 移动到链表头部
@@ -327,8 +332,8 @@ func (c *ExtendedLRUQueryCache) PutResult(plan QueryPlan, result *QueryResult) {
 		key:         key,
 		plan:        nil, // 这里只缓存结果，不缓存计划
 		result:      result,
-		accessTime:  time.Now(),
-		createTime:  time.Now(),
+		accessTime:  c.now(),
+		createTime:  c.now(),
 		accessCount: 1,
 	}
 
@@ -389,7 +394,7 @@ func (c *ExtendedLRUQueryCache) isExpired(item *queryCacheItem) bool {
 	}
 
 	expireTime := item.createTime.Add(time.Duration(c.expiry) * time.Second)
-	return time.Now().After(expireTime)
+	return c.now().After(expireTime)
 }
 
 // GetStats 获取缓存统计信息
@@ -413,6 +418,18 @@ func (c *ExtendedLRUQueryCache) GetStats() map[string]interface{} {
 	}
 }
 
+// now 返回时钟的当前时间
+func (c *ExtendedLRUQueryCache) now() time.Time {
+	return clock.OrSystem(c.clock).Now()
+}
+
+// SetClock 设置判断过期使用的时钟
+func (c *ExtendedLRUQueryCache) SetClock(clk clock.Clock) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.clock = clk
+}
+
 // SetExpiry 设置缓存过期时间（秒）
 func (c *ExtendedLRUQueryCache) SetExpiry(seconds int) {
 	c.mutex.Lock()
@@ -1,8 +1,12 @@
 package index
 
 import (
+	"reflect"
+	"sort"
 	"testing"
 	"time"
+
+	"github.com/bpfs/fragmenta/clock"
 )
 
 // TestLRUCacheBasic 测试LRU缓存基本功能
@@ -241,6 +245,8 @@ func TestLRUCacheExpiry(t *testing.T) {
 
 	// 手动设置字段
 	cache.expiry = 1
+	fakeClock := clock.NewFake(time.Now())
+	cache.SetClock(fakeClock)
 
 	// 创建测试查询和计划
 	query := &Query{
@@ -267,8 +273,8 @@ func TestLRUCacheExpiry(t *testing.T) {
 		t.Error("缓存应该立即命中")
 	}
 
-	// 等待2秒，应该过期
-	time.Sleep(time.Second * 2)
+	// 推进2秒，应该过期
+	fakeClock.Advance(2 * time.Second)
 
 	// 再次获取，应该未命中
 	if cache.Get(query) != nil {
@@ -327,3 +333,87 @@ func TestLRUCacheClear(t *testing.T) {
 		t.Errorf("缓存未命中统计错误: %v", stats["misses"])
 	}
 }
+
+// TestIndexResultCache 测试分片索引的查询结果缓存：命中、按标签失效和统计
+func TestIndexResultCache(t *testing.T) {
+	im, err := NewOptimizedIndexManager(&IndexConfig{NumShards: 4, MaxWorkers: 1, QueryCacheSize: 8})
+	if err != nil {
+		t.Fatalf("创建索引管理器失败: %v", err)
+	}
+	for id := uint32(1); id <= 10; id++ {
+		if err := im.AddIndex(1, id); err != nil {
+			t.Fatal(err)
+		}
+		if err := im.AddIndex(2, id*10); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	find := func(tag uint32) []uint32 {
+		t.Helper()
+		ids, err := im.FindByKey(tag)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		return ids
+	}
+
+	first := find(1)
+	find(2)
+	if got := find(1); !reflect.DeepEqual(got, first) {
+		t.Fatalf("缓存的结果不正确: %v", got)
+	}
+	if stats := im.GetQueryCacheStats(); stats.Hits != 1 || stats.Misses != 2 || stats.Entries != 2 {
+		t.Errorf("缓存统计不正确: %+v", stats)
+	}
+
+	// 返回的是副本，修改结果不影响缓存
+	ids, _ := im.FindByKey(1)
+	ids[0] = 999
+	if got := find(1); !reflect.DeepEqual(got, first) {
+		t.Fatalf("修改返回的结果不应影响缓存: %v", got)
+	}
+
+	// 修改标签1只使依赖标签1的条目失效
+	if _, err := im.FindCompound([]IndexQueryCondition{{Tag: 1, Operation: "eq"}, {Tag: 1, Operation: "range", Value: []uint32{3, 5}}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := im.AddIndex(1, 11); err != nil {
+		t.Fatal(err)
+	}
+	if got := find(1); len(got) != 11 {
+		t.Errorf("添加索引后应返回新结果: %v", got)
+	}
+	before := im.GetQueryCacheStats()
+	find(2)
+	if stats := im.GetQueryCacheStats(); stats.Hits != before.Hits+1 {
+		t.Errorf("其他标签的缓存不应失效: %+v", stats)
+	}
+	if before.Invalidations < 3 {
+		t.Errorf("失效统计不正确: %+v", before)
+	}
+	if err := im.RemoveIndex(1, 4); err != nil {
+		t.Fatal(err)
+	}
+	got, err := im.FindCompound([]IndexQueryCondition{{Tag: 1, Operation: "eq"}, {Tag: 1, Operation: "range", Value: []uint32{3, 5}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(got, func(i, j int) bool { return got[i] < got[j] })
+	if !reflect.DeepEqual(got, []uint32{3, 5}) {
+		t.Errorf("删除索引后复合查询应返回新结果: %v", got)
+	}
+
+	// 禁用缓存
+	im, err = NewOptimizedIndexManager(&IndexConfig{NumShards: 4, MaxWorkers: 1, QueryCacheSize: -1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	im.AddIndex(1, 1)
+	im.FindByKey(1)
+	im.FindByKey(1)
+	if stats := im.GetQueryCacheStats(); stats != (QueryCacheStats{}) {
+		t.Errorf("禁用缓存时不应有统计: %+v", stats)
+	}
+}
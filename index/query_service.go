@@ -0,0 +1,388 @@
+package index
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 块头字段在查询中的字段名，加上前缀以免与块属性重名
+const (
+	// FieldBlockID 块ID
+	FieldBlockID = "block.id"
+	// FieldBlockType 块类型
+	FieldBlockType = "block.type"
+	// FieldBlockSize 块数据大小（字节）
+	FieldBlockSize = "block.size"
+	// FieldBlockCreated 块创建时间
+	FieldBlockCreated = "block.created"
+	// FieldBlockDeleted 块是否在回收站中（布尔值）
+	FieldBlockDeleted = "block.deleted"
+)
+
+// QueryService 块查询服务
+// 把块属性索引、标签索引（IndexManager）和查询执行器组合在一起：块属性、块的类型化字段值
+// 和块头字段作为查询字段的元数据，tag:字段通过索引管理器查询。
+// 标记为已删除（在回收站中）的块保留所有索引，但默认不出现在查询结果中，见 Query.IncludeDeleted。
+// 块属性和字段值同时维护三元组索引和地理位置索引，contains、matches和地理位置条件先由索引缩小候选范围。
+// 向量类型的字段值（[]float32或[]float64）进入向量索引，near条件按向量索引求值。
+// 实现了fragmenta.BlockAttributeIndexer接口，由FragDB.StartQueryService创建并保持同步。
+type QueryService struct {
+	// attributes 块属性索引
+	attributes *AttributeIndex
+	// trigrams 块属性和字段值（按字符串形式）的三元组索引
+	trigrams *TrigramIndex
+	// geo 块属性和字段值中地理位置的索引
+	geo *GeoIndex
+	// vectors 字段值中向量的索引
+	vectors *VectorFields
+	// indexManager 标签索引
+	indexManager IndexManager
+	// executor 查询执行器
+	executor *DefaultQueryExecutor
+
+	// headers 已索引块的块头字段
+	headers map[uint32]blockFields
+	// values 块的类型化字段值（如按元数据模式解码的块元数据标签）
+	values map[uint32]map[string]interface{}
+	// deleted 标记为已删除的块
+	deleted map[uint32]struct{}
+	// mutex 保护headers、values和deleted，并保证三元组索引与属性和字段值一致
+	mutex sync.RWMutex
+}
+
+// blockFields 块头中可查询的字段
+type blockFields struct {
+	blockType uint8
+	size      uint32
+	created   time.Time
+}
+
+// NewQueryService 创建块查询服务，indexManager为nil时不支持标签条件
+func NewQueryService(indexManager IndexManager) *QueryService {
+	qs := &QueryService{
+		attributes:   NewAttributeIndex(),
+		trigrams:     NewTrigramIndex(),
+		geo:          NewGeoIndex(),
+		vectors:      NewVectorFields(nil),
+		indexManager: indexManager,
+		headers:      make(map[uint32]blockFields),
+		values:       make(map[uint32]map[string]interface{}),
+		deleted:      make(map[uint32]struct{}),
+	}
+	qs.executor = &DefaultQueryExecutor{indexManager: indexManager, metadataProvider: qs}
+	return qs
+}
+
+// SetTagResolver 设置标签名称解析，之后标签条件可以按名称引用标签。需在执行查询前设置
+func (qs *QueryService) SetTagResolver(resolver TagResolver) {
+	qs.executor.SetTagResolver(resolver)
+}
+
+// Attributes 返回查询服务维护的块属性索引
+func (qs *QueryService) Attributes() *AttributeIndex {
+	return qs.attributes
+}
+
+// Trigrams 返回查询服务维护的三元组索引
+func (qs *QueryService) Trigrams() *TrigramIndex {
+	return qs.trigrams
+}
+
+// Geo 返回查询服务维护的地理位置索引
+func (qs *QueryService) Geo() *GeoIndex {
+	return qs.geo
+}
+
+// Vectors 返回查询服务维护的向量索引
+func (qs *QueryService) Vectors() *VectorFields {
+	return qs.vectors
+}
+
+// IndexManager 返回查询服务使用的索引管理器
+func (qs *QueryService) IndexManager() IndexManager {
+	return qs.indexManager
+}
+
+// IndexBlock 索引块头字段
+func (qs *QueryService) IndexBlock(blockID uint32, blockType uint8, size uint32, created time.Time) error {
+	qs.mutex.Lock()
+	defer qs.mutex.Unlock()
+
+	qs.headers[blockID] = blockFields{blockType: blockType, size: size, created: created}
+	return nil
+}
+
+// IndexBlockValues 索引块的类型化字段值，替换该块之前的所有字段值。
+// 值可以是字符串、整数、浮点数、布尔值或time.Time，按值的类型比较
+func (qs *QueryService) IndexBlockValues(blockID uint32, values map[string]interface{}) error {
+	qs.mutex.Lock()
+	defer qs.mutex.Unlock()
+
+	if len(values) == 0 {
+		delete(qs.values, blockID)
+	} else {
+		copied := make(map[string]interface{}, len(values))
+		for key, value := range values {
+			copied[key] = value
+		}
+		qs.values[blockID] = copied
+	}
+	qs.indexFieldsLocked(blockID)
+	return nil
+}
+
+// MarkDeleted 标记或取消标记块已删除。已删除的块保留索引，只在查询设置了IncludeDeleted时返回
+func (qs *QueryService) MarkDeleted(blockID uint32, deleted bool) error {
+	qs.mutex.Lock()
+	defer qs.mutex.Unlock()
+
+	if deleted {
+		qs.deleted[blockID] = struct{}{}
+	} else {
+		delete(qs.deleted, blockID)
+	}
+	return nil
+}
+
+// IsDeleted 块是否标记为已删除
+func (qs *QueryService) IsDeleted(id uint32) bool {
+	qs.mutex.RLock()
+	defer qs.mutex.RUnlock()
+
+	_, ok := qs.deleted[id]
+	return ok
+}
+
+// RemoveBlock 移除块的块头字段、字段值、删除标记和属性索引，标签索引由维护标签的一方移除
+func (qs *QueryService) RemoveBlock(blockID uint32) error {
+	qs.mutex.Lock()
+	defer qs.mutex.Unlock()
+
+	delete(qs.headers, blockID)
+	delete(qs.values, blockID)
+	delete(qs.deleted, blockID)
+	qs.trigrams.RemoveBlock(blockID)
+	qs.geo.RemoveBlock(blockID)
+	qs.vectors.RemoveBlock(blockID)
+
+	return qs.attributes.RemoveBlockAttributes(blockID)
+}
+
+// IndexBlockAttributes 索引块的属性，替换该块之前的所有属性
+func (qs *QueryService) IndexBlockAttributes(blockID uint32, attributes map[string]string) error {
+	qs.mutex.Lock()
+	defer qs.mutex.Unlock()
+
+	if err := qs.attributes.IndexBlockAttributes(blockID, attributes); err != nil {
+		return err
+	}
+	qs.indexFieldsLocked(blockID)
+	return nil
+}
+
+// RemoveBlockAttributes 移除块的所有属性索引
+func (qs *QueryService) RemoveBlockAttributes(blockID uint32) error {
+	qs.mutex.Lock()
+	defer qs.mutex.Unlock()
+
+	if err := qs.attributes.RemoveBlockAttributes(blockID); err != nil {
+		return err
+	}
+	qs.indexFieldsLocked(blockID)
+	return nil
+}
+
+// indexFieldsLocked 按块当前的属性和字段值重建它的三元组索引、地理位置索引和向量索引（调用方需持有写锁）。
+// 字段值与查询时一样覆盖同名属性，非字符串值按字符串条件比较时的形式索引，
+// 地理位置条件能够匹配的值（GeoPoint和 "纬度,经度" 字符串）同时索引为位置，向量只进入向量索引
+func (qs *QueryService) indexFieldsLocked(blockID uint32) {
+	attributes := qs.attributes.GetAttributes(blockID)
+	values := qs.values[blockID]
+
+	fields := make(map[string]string, len(attributes)+len(values))
+	for key, value := range attributes {
+		fields[key] = value
+	}
+	var vectors map[string][]float32
+	for key, value := range values {
+		if vector, ok := toVector(value); ok {
+			if vectors == nil {
+				vectors = make(map[string][]float32)
+			}
+			vectors[key] = vector
+			delete(fields, key)
+			continue
+		}
+		if str, ok := value.(string); ok {
+			fields[key] = str
+		} else {
+			fields[key] = fmt.Sprintf("%v", value)
+		}
+	}
+	qs.trigrams.IndexBlockFields(blockID, fields)
+
+	var points map[string]GeoPoint
+	for key := range fields {
+		value, ok := values[key]
+		if !ok {
+			value = attributes[key]
+		}
+		if point, ok := toGeoPoint(value); ok {
+			if points == nil {
+				points = make(map[string]GeoPoint)
+			}
+			points[key] = point
+		}
+	}
+	qs.geo.IndexBlockPoints(blockID, points)
+	qs.vectors.IndexBlockVectors(blockID, vectors)
+}
+
+// isHeaderField 是否是块头字段，块头字段不在三元组索引和地理位置索引中
+func isHeaderField(field string) bool {
+	switch field {
+	case FieldBlockID, FieldBlockType, FieldBlockSize, FieldBlockCreated, FieldBlockDeleted:
+		return true
+	}
+	return false
+}
+
+// StringCandidates 按三元组索引返回字段可能满足字符串条件的块，块头字段不在索引中
+func (qs *QueryService) StringCandidates(field string, operator OperatorType, value string) ([]uint32, bool) {
+	if isHeaderField(field) {
+		return nil, false
+	}
+	return qs.trigrams.Candidates(field, operator, value)
+}
+
+// GeoCandidates 按地理位置索引返回字段位置可能在区域内的块
+func (qs *QueryService) GeoCandidates(field string, box GeoBox) ([]uint32, bool) {
+	if isHeaderField(field) {
+		return nil, false
+	}
+	return qs.geo.Candidates(field, box), true
+}
+
+// Nearest 按向量索引返回字段中与vector最相似的k个块
+func (qs *QueryService) Nearest(field string, vector []float32, k int) ([]VectorMatch, error) {
+	return qs.vectors.Nearest(field, vector, k)
+}
+
+// Query 解析并执行查询字符串，语法见 DefaultQueryExecutor.ParseQueryString，例如
+// "tenant==alpha and block.size>1024; sort: -block.created; limit: 10"。
+// 加上 "select: 字段1, 字段2"（或 "select: *"）时结果的Rows中包含每个块选择的字段值；
+// "字段 in (子查询)" 和 "字段 not in (子查询)" 按子查询的结果筛选（见 Subquery）；
+// "字段 near [0.1, 0.2, ...] 5" 返回字段向量与查询向量最相似的5个块，按相似度从高到低排列
+func (qs *QueryService) Query(queryString string) (*QueryResult, error) {
+	query, err := qs.executor.ParseQueryString(queryString)
+	if err != nil {
+		return nil, err
+	}
+	return qs.Execute(query)
+}
+
+// Execute 执行已解析的查询
+func (qs *QueryService) Execute(query *Query) (*QueryResult, error) {
+	return qs.executor.Execute(query)
+}
+
+// GetMetadataForID 获取块的可查询字段：块属性、字段值、块头字段和删除标记
+func (qs *QueryService) GetMetadataForID(id uint32) (map[string]interface{}, error) {
+	qs.mutex.RLock()
+	defer qs.mutex.RUnlock()
+	qs.attributes.mutex.RLock()
+	defer qs.attributes.mutex.RUnlock()
+
+	metadata := qs.metadataLocked(id, nil)
+	if metadata == nil {
+		return nil, ErrMetadataNotFound
+	}
+	return metadata, nil
+}
+
+// GetMetadataForIDs 一次获取多个块的可查询字段，fields不为空时只返回这些字段。
+// 整个批次只加一次锁，投影查询通过它获取选择的字段
+func (qs *QueryService) GetMetadataForIDs(ids []uint32, fields []string) (map[uint32]map[string]interface{}, error) {
+	qs.mutex.RLock()
+	defer qs.mutex.RUnlock()
+	qs.attributes.mutex.RLock()
+	defer qs.attributes.mutex.RUnlock()
+
+	var selected map[string]struct{}
+	if len(fields) > 0 {
+		selected = make(map[string]struct{}, len(fields))
+		for _, field := range fields {
+			selected[field] = struct{}{}
+		}
+	}
+
+	result := make(map[uint32]map[string]interface{}, len(ids))
+	for _, id := range ids {
+		if metadata := qs.metadataLocked(id, selected); metadata != nil {
+			result[id] = metadata
+		}
+	}
+	return result, nil
+}
+
+// metadataLocked 组合块的可查询字段，selected不为nil时只包含其中的字段，
+// 块没有任何字段时返回nil（调用方需持有mutex和属性索引的读锁）
+func (qs *QueryService) metadataLocked(id uint32, selected map[string]struct{}) map[string]interface{} {
+	fields, indexed := qs.headers[id]
+	values := qs.values[id]
+	attributes := qs.attributes.blocks[id]
+	if !indexed && attributes == nil && values == nil {
+		return nil
+	}
+
+	metadata := make(map[string]interface{}, len(attributes)+len(values)+5)
+	set := func(key string, value interface{}) {
+		if selected != nil {
+			if _, ok := selected[key]; !ok {
+				return
+			}
+		}
+		metadata[key] = value
+	}
+	for key, value := range attributes {
+		set(key, value)
+	}
+	for key, value := range values {
+		set(key, value)
+	}
+	if indexed {
+		_, deleted := qs.deleted[id]
+		set(FieldBlockID, id)
+		set(FieldBlockType, fields.blockType)
+		set(FieldBlockSize, fields.size)
+		set(FieldBlockCreated, fields.created)
+		set(FieldBlockDeleted, deleted)
+	}
+	return metadata
+}
+
+// GetAllIDs 获取所有已索引的块ID，按升序排列
+func (qs *QueryService) GetAllIDs() ([]uint32, error) {
+	qs.mutex.RLock()
+	set := make(map[uint32]struct{}, len(qs.headers))
+	for id := range qs.headers {
+		set[id] = struct{}{}
+	}
+	for id := range qs.values {
+		set[id] = struct{}{}
+	}
+	qs.mutex.RUnlock()
+
+	for _, id := range qs.attributes.BlockIDs() {
+		set[id] = struct{}{}
+	}
+
+	ids := make([]uint32, 0, len(set))
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
@@ -0,0 +1,276 @@
+package index
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestQueryService 测试块查询服务组合块属性、块头字段和标签索引
+func TestQueryService(t *testing.T) {
+	im, err := NewIndexManager(nil)
+	if err != nil {
+		t.Fatalf("创建索引管理器失败: %v", err)
+	}
+	qs := NewQueryService(im)
+
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	blocks := []struct {
+		id         uint32
+		blockType  uint8
+		size       uint32
+		attributes map[string]string
+	}{
+		{1, 1, 100, map[string]string{"name": "report.pdf", "owner": "alice"}},
+		{2, 2, 500, map[string]string{"name": "photo.png", "owner": "bob"}},
+		{3, 1, 300, map[string]string{"name": "notes.txt"}},
+		{4, 3, 50, nil},
+	}
+	for i, b := range blocks {
+		if err := qs.IndexBlock(b.id, b.blockType, b.size, created.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("索引块失败: %v", err)
+		}
+		if err := qs.IndexBlockAttributes(b.id, b.attributes); err != nil {
+			t.Fatalf("索引块属性失败: %v", err)
+		}
+		if b.blockType == 1 {
+			if err := im.IndexMetadata(b.id, []uint32{7}); err != nil {
+				t.Fatalf("索引标签失败: %v", err)
+			}
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []uint32
+	}{
+		{`name=="report.pdf"`, []uint32{1}},
+		{"name endswith .png", []uint32{2}},
+		{`name contains "o"`, []uint32{1, 2, 3}},
+		{"owner!=alice", []uint32{2}},
+		{"not exists owner", []uint32{3, 4}},
+		{"not owner in [alice, bob]", []uint32{3, 4}},
+		{"owner not in [alice]", []uint32{2}},
+		{"block.type==1 and not block.size<200", []uint32{3}},
+		{"tag:meta==7", []uint32{1, 3}},
+		{"date:block.created between 2025-01-01T01:00:00Z and 2025-01-01T02:00:00Z", []uint32{2, 3}},
+		{"exists block.id; sort: +block.size", []uint32{4, 1, 3, 2}},
+		{"exists block.id; sort: -owner", []uint32{2, 1, 3, 4}},
+	}
+	for _, tt := range tests {
+		result, err := qs.Query(tt.query)
+		if err != nil {
+			t.Errorf("查询 %q 失败: %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(result.IDs, tt.want) {
+			t.Errorf("查询 %q 结果不正确: 期望 %v，实际 %v", tt.query, tt.want, result.IDs)
+		}
+	}
+
+	// 重新索引块头字段后按新值查询，删除块后不再可查
+	if err := qs.IndexBlock(3, 2, 300, created); err != nil {
+		t.Fatalf("重新索引块失败: %v", err)
+	}
+	if err := qs.RemoveBlock(1); err != nil {
+		t.Fatalf("移除块失败: %v", err)
+	}
+	result, err := qs.Query("block.type==1 or owner==alice")
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if len(result.IDs) != 0 {
+		t.Errorf("更新后不应再有匹配的块: %v", result.IDs)
+	}
+
+	if _, err := qs.Query("name matches ("); err == nil {
+		t.Errorf("无效的正则表达式应返回错误")
+	}
+}
+
+// TestQueryServiceWithoutIndexManager 测试没有索引管理器时标签条件返回错误
+func TestQueryServiceWithoutIndexManager(t *testing.T) {
+	qs := NewQueryService(nil)
+	if err := qs.IndexBlock(1, 1, 10, time.Now()); err != nil {
+		t.Fatalf("索引块失败: %v", err)
+	}
+
+	if _, err := qs.Query("tag:meta==1"); err == nil {
+		t.Errorf("没有索引管理器时标签条件应返回错误")
+	}
+	result, err := qs.Query("block.size==10")
+	if err != nil || !reflect.DeepEqual(result.IDs, []uint32{1}) {
+		t.Errorf("块头字段查询结果不正确: %v, %v", result, err)
+	}
+}
+
+// TestQueryServiceBlockValues 测试按类型化字段值查询
+func TestQueryServiceBlockValues(t *testing.T) {
+	qs := NewQueryService(nil)
+
+	published := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	if err := qs.IndexBlockValues(1, map[string]interface{}{"meta.pages": int64(12), "meta.published": published}); err != nil {
+		t.Fatalf("索引字段值失败: %v", err)
+	}
+	if err := qs.IndexBlockValues(2, map[string]interface{}{"meta.pages": int64(3), "meta.author": "bob"}); err != nil {
+		t.Fatalf("索引字段值失败: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  []uint32
+	}{
+		{"meta.pages>5", []uint32{1}},
+		{"meta.author==bob", []uint32{2}},
+		{"date:meta.published>2025-02-01T00:00:00Z", []uint32{1}},
+		{"exists meta.pages; sort: +meta.pages", []uint32{2, 1}},
+	}
+	for _, tt := range tests {
+		result, err := qs.Query(tt.query)
+		if err != nil {
+			t.Errorf("查询 %q 失败: %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(result.IDs, tt.want) {
+			t.Errorf("查询 %q 结果不正确: 期望 %v，实际 %v", tt.query, tt.want, result.IDs)
+		}
+	}
+
+	// 替换和移除字段值
+	if err := qs.IndexBlockValues(1, nil); err != nil {
+		t.Fatalf("清除字段值失败: %v", err)
+	}
+	if err := qs.RemoveBlock(2); err != nil {
+		t.Fatalf("移除块失败: %v", err)
+	}
+	if ids, _ := qs.GetAllIDs(); len(ids) != 0 {
+		t.Errorf("清除后不应再有块: %v", ids)
+	}
+}
+
+// TestQueryServiceSelect 测试投影查询返回分页后每个块选择的字段值
+func TestQueryServiceSelect(t *testing.T) {
+	qs := NewQueryService(nil)
+	created := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	for id := uint32(1); id <= 3; id++ {
+		if err := qs.IndexBlock(id, 1, id*100, created); err != nil {
+			t.Fatal(err)
+		}
+		if err := qs.IndexBlockValues(id, map[string]interface{}{"meta.pages": int64(id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := qs.IndexBlockAttributes(2, map[string]string{"owner": "bob"}); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := qs.Query("block.size>100; sort: -block.size; limit: 1; select: meta.pages, owner, missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []QueryRow{{ID: 3, Values: map[string]interface{}{"meta.pages": int64(3)}}}
+	if !reflect.DeepEqual(result.Rows, want) || !result.HasMore {
+		t.Errorf("投影结果不正确: %+v", result)
+	}
+
+	result, err = qs.Query("owner==bob; select: *")
+	if err != nil || len(result.Rows) != 1 {
+		t.Fatalf("投影查询失败: %+v, %v", result, err)
+	}
+	if values := result.Rows[0].Values; values["owner"] != "bob" || values[FieldBlockSize] != uint32(200) || len(values) != 7 {
+		t.Errorf("select: * 应返回所有字段: %v", values)
+	}
+
+	// 没有select时不返回行
+	if result, _ := qs.Query("block.size>100"); result.Rows != nil {
+		t.Errorf("未选择字段时不应返回行: %+v", result.Rows)
+	}
+
+	// 元数据提供器不支持批量获取时逐个获取，没有元数据的ID返回空行
+	executor := NewQueryExecutor(createMockIndexManager())
+	query, err := executor.ParseQueryString("tag:type==1; limit: 2; select: name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = executor.Execute(query)
+	if err != nil || len(result.Rows) != 2 || result.Rows[1].ID != result.IDs[1] || len(result.Rows[1].Values) != 0 {
+		t.Errorf("逐个获取的投影结果不正确: %+v, %v", result, err)
+	}
+}
+
+// TestQueryServiceTagResolver 测试按名称引用标签
+func TestQueryServiceTagResolver(t *testing.T) {
+	im, err := NewIndexManager(nil)
+	if err != nil {
+		t.Fatalf("创建索引管理器失败: %v", err)
+	}
+	qs := NewQueryService(im)
+	qs.SetTagResolver(func(name string) (uint32, bool) {
+		if name == "author" {
+			return 7, true
+		}
+		return 0, false
+	})
+
+	for id := uint32(1); id <= 2; id++ {
+		if err := qs.IndexBlock(id, 1, 10, time.Now()); err != nil {
+			t.Fatalf("索引块失败: %v", err)
+		}
+	}
+	if err := im.IndexMetadata(2, []uint32{7}); err != nil {
+		t.Fatalf("索引标签失败: %v", err)
+	}
+
+	for _, query := range []string{"tag:meta==author", "tag:meta==7", "tag:meta in [author]"} {
+		result, err := qs.Query(query)
+		if err != nil || !reflect.DeepEqual(result.IDs, []uint32{2}) {
+			t.Errorf("查询 %q 结果不正确: %v, %v", query, result, err)
+		}
+	}
+	if _, err := qs.Query("tag:meta==unknown"); err == nil {
+		t.Errorf("未知的标签名称应返回错误")
+	}
+}
+
+// TestQueryServiceDeleted 测试已删除块的过滤
+func TestQueryServiceDeleted(t *testing.T) {
+	qs := NewQueryService(nil)
+	for id := uint32(1); id <= 3; id++ {
+		if err := qs.IndexBlock(id, 1, 10*id, time.Now()); err != nil {
+			t.Fatalf("索引块失败: %v", err)
+		}
+	}
+	if err := qs.MarkDeleted(2, true); err != nil {
+		t.Fatalf("标记删除失败: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  []uint32
+	}{
+		{"block.size>0", []uint32{1, 3}},
+		{"block.size>0; deleted: include", []uint32{1, 2, 3}},
+		{"bool:block.deleted==true; deleted: include", []uint32{2}},
+		{"not block.size==10", []uint32{3}},
+	}
+	for _, tt := range tests {
+		result, err := qs.Query(tt.query)
+		if err != nil {
+			t.Errorf("查询 %q 失败: %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(result.IDs, tt.want) || result.TotalCount != len(tt.want) {
+			t.Errorf("查询 %q 结果不正确: 期望 %v，实际 %v", tt.query, tt.want, result)
+		}
+	}
+	if _, err := qs.Query("block.size>0; deleted: maybe"); err == nil {
+		t.Errorf("无效的deleted值应返回错误")
+	}
+
+	if err := qs.MarkDeleted(2, false); err != nil {
+		t.Fatalf("取消删除标记失败: %v", err)
+	}
+	if result, _ := qs.Query("block.size>0"); len(result.IDs) != 3 {
+		t.Errorf("取消标记后应返回所有块: %v", result.IDs)
+	}
+}
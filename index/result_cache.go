@@ -0,0 +1,256 @@
+package index
+
+import (
+	"container/list"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultQueryCacheSize 索引查询结果缓存的默认条目数
+const DefaultQueryCacheSize = 256
+
+// QueryCacheStats 索引查询结果缓存的统计
+type QueryCacheStats struct {
+	// Capacity 缓存容量（条目数），0表示缓存已禁用
+	Capacity int
+	// Entries 当前缓存的条目数
+	Entries int
+	// Hits 命中次数
+	Hits int64
+	// Misses 未命中次数
+	Misses int64
+	// Invalidations 因索引修改而失效的条目数
+	Invalidations int64
+	// HitRate 命中率(0-1)
+	HitRate float64
+}
+
+// resultCacheEntry 缓存的查询结果
+type resultCacheEntry struct {
+	key  string
+	tags []uint32
+	ids  []uint32
+	err  error
+}
+
+// indexResultCache 按规范化的查询条件缓存索引查询结果（LRU淘汰）。
+// 每个条目记录它依赖的标签，标签的索引修改时只使相关条目失效。
+// 缓存对应一个索引视图版本，发布新视图时随之前进；查询只在自己的视图版本与缓存一致时
+// 读取或写入缓存，避免并发修改后使用或写入其他视图的结果。nil表示禁用缓存，所有方法均可在nil上调用
+type indexResultCache struct {
+	mutex    sync.Mutex
+	capacity int
+	lru      *list.List
+	entries  map[string]*list.Element
+	byTag    map[uint32]map[string]struct{}
+
+	// 条目所属的索引视图版本
+	gen uint64
+
+	hits          int64
+	misses        int64
+	invalidations int64
+}
+
+// newIndexResultCache 创建查询结果缓存，size为0时使用DefaultQueryCacheSize，小于0时返回nil（禁用）
+func newIndexResultCache(size int) *indexResultCache {
+	if size < 0 {
+		return nil
+	}
+	if size == 0 {
+		size = DefaultQueryCacheSize
+	}
+	return &indexResultCache{
+		capacity: size,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+		byTag:    make(map[uint32]map[string]struct{}),
+	}
+}
+
+// get 返回视图版本gen下缓存的结果副本
+func (c *indexResultCache) get(gen uint64, key string) ([]uint32, error, bool) {
+	if c == nil {
+		return nil, nil, false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok || c.gen != gen {
+		c.misses++
+		return nil, nil, false
+	}
+	c.hits++
+	c.lru.MoveToFront(element)
+	entry := element.Value.(*resultCacheEntry)
+	return copyIDs(entry.ids), entry.err, true
+}
+
+// put 缓存在视图版本gen中求值的查询结果，缓存已前进到其他版本时不缓存
+func (c *indexResultCache) put(gen uint64, key string, tags []uint32, ids []uint32, err error) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.gen != gen {
+		return
+	}
+	if element, ok := c.entries[key]; ok {
+		c.removeLocked(element)
+	}
+
+	entry := &resultCacheEntry{key: key, tags: tags, ids: copyIDs(ids), err: err}
+	c.entries[key] = c.lru.PushFront(entry)
+	for _, tag := range tags {
+		if c.byTag[tag] == nil {
+			c.byTag[tag] = make(map[string]struct{})
+		}
+		c.byTag[tag][key] = struct{}{}
+	}
+
+	for c.lru.Len() > c.capacity {
+		c.removeLocked(c.lru.Back())
+	}
+}
+
+// advance 发布视图版本gen后前进缓存，使依赖修改过的标签的条目失效
+func (c *indexResultCache) advance(gen uint64, tags map[uint32]struct{}) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.gen = gen
+	for tag := range tags {
+		for key := range c.byTag[tag] {
+			if element, ok := c.entries[key]; ok {
+				c.removeLocked(element)
+				c.invalidations++
+			}
+		}
+	}
+}
+
+// invalidateAll 重新加载索引、发布视图版本gen后使全部条目失效
+func (c *indexResultCache) invalidateAll(gen uint64) {
+	if c == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.gen = gen
+	c.invalidations += int64(c.lru.Len())
+	c.lru.Init()
+	c.entries = make(map[string]*list.Element)
+	c.byTag = make(map[uint32]map[string]struct{})
+}
+
+// stats 返回缓存统计
+func (c *indexResultCache) stats() QueryCacheStats {
+	if c == nil {
+		return QueryCacheStats{}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stats := QueryCacheStats{
+		Capacity:      c.capacity,
+		Entries:       c.lru.Len(),
+		Hits:          c.hits,
+		Misses:        c.misses,
+		Invalidations: c.invalidations,
+	}
+	if total := c.hits + c.misses; total > 0 {
+		stats.HitRate = float64(c.hits) / float64(total)
+	}
+	return stats
+}
+
+// removeLocked 删除条目，调用方需持有mutex
+func (c *indexResultCache) removeLocked(element *list.Element) {
+	entry := element.Value.(*resultCacheEntry)
+	c.lru.Remove(element)
+	delete(c.entries, entry.key)
+	for _, tag := range entry.tags {
+		if keys := c.byTag[tag]; keys != nil {
+			delete(keys, entry.key)
+			if len(keys) == 0 {
+				delete(c.byTag, tag)
+			}
+		}
+	}
+}
+
+// copyIDs 复制ID列表，保留nil
+func copyIDs(ids []uint32) []uint32 {
+	if ids == nil {
+		return nil
+	}
+	result := make([]uint32, len(ids))
+	copy(result, ids)
+	return result
+}
+
+// conditionCacheKey 返回单个查询条件的规范化缓存键，不支持的条件返回false
+func conditionCacheKey(condition IndexQueryCondition) (string, bool) {
+	switch condition.Operation {
+	case "eq":
+		return "eq:" + strconv.FormatUint(uint64(condition.Tag), 10), true
+	case "prefix":
+		prefix, ok := condition.Value.(string)
+		if !ok {
+			return "", false
+		}
+		return prefixCacheKey(condition.Tag, prefix), true
+	case "range":
+		bounds, ok := condition.Value.([]uint32)
+		if !ok || len(bounds) != 2 {
+			return "", false
+		}
+		return rangeCacheKey(condition.Tag, bounds[0], bounds[1]), true
+	default:
+		return "", false
+	}
+}
+
+// compoundCacheKey 返回复合查询的缓存键和依赖的标签，含有不支持的条件时返回false。
+// 结果的顺序取决于条件的顺序，因此键保留条件顺序
+func compoundCacheKey(conditions []IndexQueryCondition) (string, []uint32, bool) {
+	keys := make([]string, 0, len(conditions))
+	tags := make([]uint32, 0, len(conditions))
+	seen := make(map[uint32]bool, len(conditions))
+	for _, condition := range conditions {
+		key, ok := conditionCacheKey(condition)
+		if !ok {
+			return "", nil, false
+		}
+		keys = append(keys, key)
+		if !seen[condition.Tag] {
+			seen[condition.Tag] = true
+			tags = append(tags, condition.Tag)
+		}
+	}
+	return "and(" + strings.Join(keys, ",") + ")", tags, true
+}
+
+// prefixCacheKey 前缀查询的缓存键
+func prefixCacheKey(tag uint32, prefix string) string {
+	return fmt.Sprintf("prefix:%d:%q", tag, prefix)
+}
+
+// rangeCacheKey 范围查询的缓存键
+func rangeCacheKey(tag uint32, start, end uint32) string {
+	return fmt.Sprintf("range:%d:%d-%d", tag, start, end)
+}
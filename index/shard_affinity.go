@@ -0,0 +1,100 @@
+package index
+
+import (
+	"runtime"
+	"sync"
+)
+
+// ExecutionModel 分片索引的执行模型
+type ExecutionModel int
+
+const (
+	// ExecutionShared 调用者协程和共享的工作线程池直接操作分片，由分片锁协调并发
+	ExecutionShared ExecutionModel = iota
+	// ExecutionShardAffinity 每个分片由专属协程处理单条写入和异步更新队列中的任务。
+	// 专属协程独占一个操作系统线程，可以用 IndexConfig.ShardCPUs 绑定到CPU（如同一NUMA节点的CPU），
+	// 分片数据只在该线程上修改，同一分片的写入之间没有锁竞争。查询和涉及多个分片的批量写入仍在
+	// 调用者协程中执行，读视图语义不变
+	ExecutionShardAffinity
+)
+
+// DefaultMailboxSize 分片亲和模式下每个分片邮箱的默认容量
+const DefaultMailboxSize = 256
+
+// shardWorkers 分片专属协程，每个分片一个邮箱，邮箱已满时提交者阻塞
+type shardWorkers struct {
+	mutex     sync.RWMutex
+	closed    bool
+	mailboxes []chan func()
+	wg        sync.WaitGroup
+}
+
+// newShardWorkers 为每个分片启动专属协程，cpus不为空时分片i绑定到cpus[i%len(cpus)]
+func newShardWorkers(numShards, mailboxSize int, cpus []int) *shardWorkers {
+	if mailboxSize <= 0 {
+		mailboxSize = DefaultMailboxSize
+	}
+	w := &shardWorkers{mailboxes: make([]chan func(), numShards)}
+	for shardID := range w.mailboxes {
+		cpu := -1
+		if len(cpus) > 0 {
+			cpu = cpus[shardID%len(cpus)]
+		}
+		w.mailboxes[shardID] = make(chan func(), mailboxSize)
+		w.wg.Add(1)
+		go w.run(shardID, cpu)
+	}
+	return w
+}
+
+// run 在独占的操作系统线程上依次执行分片邮箱中的任务。协程结束时不解除线程绑定，
+// 绑定过CPU的线程随协程一起退出，不会回到运行时的线程池
+func (w *shardWorkers) run(shardID, cpu int) {
+	defer w.wg.Done()
+	runtime.LockOSThread()
+
+	if cpu >= 0 {
+		if err := pinThread(cpu); err != nil {
+			logger.Error("绑定分片线程到CPU失败", "shard", shardID, "cpu", cpu, "error", err)
+		}
+	}
+
+	for fn := range w.mailboxes[shardID] {
+		fn()
+	}
+}
+
+// submit 把任务放入分片的邮箱，已停止时在调用者协程中直接执行。
+// 提交者不能持有分片锁，否则可能与等待该锁的专属协程死锁
+func (w *shardWorkers) submit(shardID int, fn func()) {
+	w.mutex.RLock()
+	if w.closed {
+		w.mutex.RUnlock()
+		fn()
+		return
+	}
+	w.mailboxes[shardID] <- fn
+	w.mutex.RUnlock()
+}
+
+// call 在分片的专属协程中执行fn并等待结果
+func (w *shardWorkers) call(shardID int, fn func() error) error {
+	done := make(chan error, 1)
+	w.submit(shardID, func() { done <- fn() })
+	return <-done
+}
+
+// stop 关闭邮箱，等待已提交的任务执行完毕
+func (w *shardWorkers) stop() {
+	w.mutex.Lock()
+	if w.closed {
+		w.mutex.Unlock()
+		return
+	}
+	w.closed = true
+	for _, mailbox := range w.mailboxes {
+		close(mailbox)
+	}
+	w.mutex.Unlock()
+	w.wg.Wait()
+}
@@ -0,0 +1,23 @@
+package index
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// maxAffinityCPUs sched_setaffinity掩码支持的CPU数
+const maxAffinityCPUs = 1024
+
+// pinThread 使用sched_setaffinity把当前线程绑定到cpu，调用者须已锁定操作系统线程
+func pinThread(cpu int) error {
+	if cpu < 0 || cpu >= maxAffinityCPUs {
+		return ErrInvalidValue
+	}
+	var mask [maxAffinityCPUs / 64]uint64
+	mask[cpu/64] |= 1 << (uint(cpu) % 64)
+	_, _, errno := syscall.RawSyscall(syscall.SYS_SCHED_SETAFFINITY, 0, unsafe.Sizeof(mask), uintptr(unsafe.Pointer(&mask)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package index
+
+import "errors"
+
+// pinThread 当前平台不支持绑定线程到CPU，分片协程仍独占操作系统线程
+func pinThread(cpu int) error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,76 @@
+package index
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestShardAffinityExecution 测试分片亲和执行模型下的同步写入、异步队列和关闭
+func TestShardAffinityExecution(t *testing.T) {
+	im, err := NewOptimizedIndexManager(&IndexConfig{
+		NumShards:      4,
+		MaxWorkers:     2,
+		ExecutionModel: ExecutionShardAffinity,
+		ShardCPUs:      []int{0},
+		MailboxSize:    4,
+	})
+	if err != nil {
+		t.Fatalf("创建索引管理器失败: %v", err)
+	}
+
+	// 并发的同步写入由各分片的专属协程串行执行
+	var wg sync.WaitGroup
+	for g := uint32(0); g < 8; g++ {
+		wg.Add(1)
+		go func(g uint32) {
+			defer wg.Done()
+			for i := uint32(0); i < 50; i++ {
+				if err := im.AddIndex(1, g*50+i); err != nil {
+					t.Errorf("添加索引失败: %v", err)
+				}
+				im.FindByTag(1)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if found, _ := im.FindByTag(1); len(found) != 400 {
+		t.Fatalf("标签1的索引数为%d", len(found))
+	}
+	if err := im.RemoveIndex(1, 7); err != nil {
+		t.Fatalf("移除索引失败: %v", err)
+	}
+	if err := im.RemoveIndex(1, 7); err != ErrIndexNotFound {
+		t.Fatalf("重复移除应该返回ErrIndexNotFound，实际为%v", err)
+	}
+
+	// 异步队列的任务交给分片的专属协程
+	for id := uint32(0); id < 100; id++ {
+		if err := im.AsyncAddIndex(2, id); err != nil {
+			t.Fatalf("入队失败: %v", err)
+		}
+	}
+	im.processUpdateQueue()
+	deadline := time.Now().Add(10 * time.Second)
+	for im.GetStatus().ActiveWorkers > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("分片协程没有处理完异步任务")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if found, _ := im.FindByTag(2); len(found) != 100 {
+		t.Fatalf("标签2的索引数为%d", len(found))
+	}
+
+	// 关闭后写入在调用者协程中执行
+	if err := im.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+	if err := im.AddIndex(3, 1); err != nil {
+		t.Fatalf("关闭后添加索引失败: %v", err)
+	}
+	if found, _ := im.FindByTag(3); !slices.Equal(found, []uint32{1}) {
+		t.Fatalf("标签3的索引为%v", found)
+	}
+}
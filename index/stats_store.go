@@ -0,0 +1,213 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/bpfs/fragmenta/vfs"
+)
+
+// DefaultStatsHistory 统计存储默认保留的样本数
+const DefaultStatsHistory = 256
+
+// queryLatencyWindow 计算查询延迟百分位数时保留的最近查询数
+const queryLatencyWindow = 1024
+
+// minTrendSamples 计算趋势至少需要的样本数，样本分为较早和较近两半比较
+const minTrendSamples = 4
+
+// StatsSample 某一时刻的索引统计，由 DefaultIndexOptimizer 在优化和分析时记录
+type StatsSample struct {
+	// Time 记录时间
+	Time time.Time `json:"time"`
+	// IndexedItems 已索引项目数
+	IndexedItems int `json:"indexed_items"`
+	// MemoryUsage 内存使用量(字节)
+	MemoryUsage int64 `json:"memory_usage"`
+	// CompressionRatio 压缩率（百分比）
+	CompressionRatio float64 `json:"compression_ratio"`
+	// ShardBalance 分片平衡度 (0-1，1表示完全平衡)
+	ShardBalance float64 `json:"shard_balance"`
+	// QueryP50 查询延迟中位数
+	QueryP50 time.Duration `json:"query_p50"`
+	// QueryP95 查询延迟95百分位数
+	QueryP95 time.Duration `json:"query_p95"`
+	// QueryP99 查询延迟99百分位数
+	QueryP99 time.Duration `json:"query_p99"`
+}
+
+// StatsTrend 统计历史的趋势，比较较早一半与较近一半样本的平均值
+type StatsTrend struct {
+	// Samples 参与计算的样本数
+	Samples int
+	// Span 最早与最近样本的时间跨度
+	Span time.Duration
+	// ItemsGrowth 已索引项目数的相对变化，0.5表示增长50%
+	ItemsGrowth float64
+	// CompressionRatioChange 压缩率的变化（百分点）
+	CompressionRatioChange float64
+	// ShardBalanceChange 分片平衡度的变化
+	ShardBalanceChange float64
+	// QueryP95Change 查询P95延迟的相对变化，0.5表示变慢50%
+	QueryP95Change float64
+}
+
+// StatsStore 持久化的索引统计历史，保存在独立的小文件中（通常放在索引文件旁边），
+// 进程重启后保留，供 DefaultIndexOptimizer 根据趋势而不是单个时间点给出建议。
+// 只保留最近的若干个样本
+type StatsStore struct {
+	path  string
+	fs    vfs.FS
+	limit int
+
+	mu      sync.Mutex
+	samples []StatsSample
+}
+
+// OpenStatsStore 打开统计存储，文件不存在时从空历史开始。fsys为nil时使用操作系统文件系统，
+// limit不大于0时使用DefaultStatsHistory
+func OpenStatsStore(path string, fsys vfs.FS, limit int) (*StatsStore, error) {
+	if limit <= 0 {
+		limit = DefaultStatsHistory
+	}
+	s := &StatsStore{path: path, fs: vfs.OrOS(fsys), limit: limit}
+
+	data, err := s.fs.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.samples); err != nil {
+		return nil, fmt.Errorf("%w: stats %s: %v", ErrIndexCorrupted, path, err)
+	}
+	s.trim()
+	return s, nil
+}
+
+// Record 追加样本并写入文件，超过保留数时丢弃最早的样本
+func (s *StatsStore) Record(sample StatsSample) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.samples = append(s.samples, sample)
+	s.trim()
+
+	data, err := json.Marshal(s.samples)
+	if err != nil {
+		return err
+	}
+	// 先写临时文件再重命名，写入中断不会损坏已有的历史
+	tmp := s.path + ".tmp"
+	if err := s.fs.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return s.fs.Rename(tmp, s.path)
+}
+
+// Samples 按记录顺序返回保留的样本
+func (s *StatsStore) Samples() []StatsSample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return slices.Clone(s.samples)
+}
+
+// Trend 计算保留样本的趋势，样本少于4个时返回nil
+func (s *StatsStore) Trend() *StatsTrend {
+	return computeTrend(s.Samples())
+}
+
+// trim 只保留最近limit个样本，调用方需持有mu
+func (s *StatsStore) trim() {
+	if extra := len(s.samples) - s.limit; extra > 0 {
+		s.samples = slices.Delete(s.samples, 0, extra)
+	}
+}
+
+// computeTrend 比较较早一半与较近一半样本的平均值
+func computeTrend(samples []StatsSample) *StatsTrend {
+	if len(samples) < minTrendSamples {
+		return nil
+	}
+	half := len(samples) / 2
+	older, newer := averageSample(samples[:half]), averageSample(samples[len(samples)-half:])
+
+	return &StatsTrend{
+		Samples:                len(samples),
+		Span:                   samples[len(samples)-1].Time.Sub(samples[0].Time),
+		ItemsGrowth:            relativeChange(float64(older.IndexedItems), float64(newer.IndexedItems)),
+		CompressionRatioChange: newer.CompressionRatio - older.CompressionRatio,
+		ShardBalanceChange:     newer.ShardBalance - older.ShardBalance,
+		QueryP95Change:         relativeChange(float64(older.QueryP95), float64(newer.QueryP95)),
+	}
+}
+
+// averageSample 返回样本各项的平均值
+func averageSample(samples []StatsSample) StatsSample {
+	var avg StatsSample
+	var items, p95 float64
+	for _, s := range samples {
+		items += float64(s.IndexedItems)
+		avg.CompressionRatio += s.CompressionRatio
+		avg.ShardBalance += s.ShardBalance
+		p95 += float64(s.QueryP95)
+	}
+	n := float64(len(samples))
+	avg.IndexedItems = int(items / n)
+	avg.CompressionRatio /= n
+	avg.ShardBalance /= n
+	avg.QueryP95 = time.Duration(p95 / n)
+	return avg
+}
+
+// relativeChange 返回从before到after的相对变化，before为0时返回0
+func relativeChange(before, after float64) float64 {
+	if before == 0 {
+		return 0
+	}
+	return (after - before) / before
+}
+
+// latencyWindow 最近若干次查询的延迟，用于计算百分位数
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+// record 记录一次查询延迟，超过窗口大小时覆盖最早的记录
+func (w *latencyWindow) record(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.samples) < queryLatencyWindow {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % queryLatencyWindow
+}
+
+// percentile 返回窗口内延迟的百分位数，没有记录时返回0
+func (w *latencyWindow) percentile(p float64) time.Duration {
+	w.mu.Lock()
+	sorted := slices.Clone(w.samples)
+	w.mu.Unlock()
+
+	if len(sorted) == 0 {
+		return 0
+	}
+	slices.Sort(sorted)
+	if p <= 0 {
+		return sorted[0]
+	}
+	if p >= 100 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[int(float64(len(sorted)-1)*p/100)]
+}
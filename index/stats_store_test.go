@@ -0,0 +1,157 @@
+package index
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bpfs/fragmenta/vfs"
+)
+
+// TestStatsStore 测试统计历史在重新打开后保留、超过保留数时丢弃最早的样本，以及趋势计算
+func TestStatsStore(t *testing.T) {
+	fsys := vfs.NewMem(nil)
+	store, err := OpenStatsStore("/index.stats", fsys, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Trend() != nil {
+		t.Error("empty store should have no trend")
+	}
+
+	start := time.Unix(1700000000, 0)
+	for i := range 8 {
+		err := store.Record(StatsSample{
+			Time:             start.Add(time.Duration(i) * time.Hour),
+			IndexedItems:     1000 * (i + 1),
+			CompressionRatio: 40 - float64(i)*5,
+			ShardBalance:     1 - float64(i)*0.1,
+			QueryP95:         time.Duration(i+1) * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reopened, err := OpenStatsStore("/index.stats", fsys, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := reopened.Samples()
+	if len(samples) != 6 || samples[0].IndexedItems != 3000 || samples[5].IndexedItems != 8000 {
+		t.Fatalf("samples after reopen: %+v", samples)
+	}
+
+	trend := reopened.Trend()
+	if trend == nil || trend.Samples != 6 || trend.Span != 5*time.Hour {
+		t.Fatalf("trend: %+v", trend)
+	}
+	if trend.ShardBalanceChange >= 0 || trend.CompressionRatioChange >= 0 || trend.QueryP95Change <= 0 || trend.ItemsGrowth <= 0 {
+		t.Errorf("trend direction: %+v", trend)
+	}
+
+	if err := fsys.WriteFile("/broken.stats", []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenStatsStore("/broken.stats", fsys, 0); !errors.Is(err, ErrIndexCorrupted) {
+		t.Errorf("corrupted stats: %v", err)
+	}
+}
+
+// TestLatencyWindow 测试查询延迟百分位数和窗口覆盖
+func TestLatencyWindow(t *testing.T) {
+	var w latencyWindow
+	if w.percentile(50) != 0 {
+		t.Error("empty window should report 0")
+	}
+	for i := 1; i <= 100; i++ {
+		w.record(time.Duration(i) * time.Millisecond)
+	}
+	if got := w.percentile(50); got != 50*time.Millisecond {
+		t.Errorf("p50 = %v", got)
+	}
+	if got := w.percentile(100); got != 100*time.Millisecond {
+		t.Errorf("p100 = %v", got)
+	}
+
+	for range queryLatencyWindow {
+		w.record(time.Second)
+	}
+	if got := w.percentile(0); got != time.Second {
+		t.Errorf("old latencies not overwritten, p0 = %v", got)
+	}
+}
+
+// TestOptimizerStatsHistory 测试优化器记录统计历史，并根据趋势给出建议
+func TestOptimizerStatsHistory(t *testing.T) {
+	fsys := vfs.NewMem(nil)
+	store, err := OpenStatsStore("/index.stats", fsys, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 之前的进程记录的历史：分片越来越不平衡，查询越来越慢
+	start := time.Now().Add(-time.Hour)
+	for i := range 6 {
+		err := store.Record(StatsSample{
+			Time:         start.Add(time.Duration(i) * time.Minute),
+			ShardBalance: 1 - float64(i)*0.2,
+			QueryP95:     time.Duration(1<<i) * time.Microsecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	im, err := NewOptimizedIndexManager(&IndexConfig{NumShards: 4, MaxWorkers: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer im.Close()
+	for id := uint32(0); id < 100; id++ {
+		if err := im.AddIndex(id%5, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for tag := uint32(0); tag < 5; tag++ {
+		if _, err := im.FindByKey(tag); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	optimizer := NewDefaultIndexOptimizer(&OptimizationConfig{CompressionLevel: 1, StatsStore: store})
+	if err := optimizer.OptimizeIndex(im); err != nil {
+		t.Fatal(err)
+	}
+	report, err := optimizer.AnalyzeIndexPerformance(im)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	history := optimizer.StatsHistory()
+	if len(history) != 8 {
+		t.Fatalf("history length %d", len(history))
+	}
+	if last := history[len(history)-1]; last.IndexedItems != 100 {
+		t.Errorf("last sample: %+v", last)
+	}
+	if report.Trend == nil || report.Trend.Samples != 8 {
+		t.Fatalf("trend: %+v", report.Trend)
+	}
+
+	var balance bool
+	for _, r := range report.Recommendations {
+		balance = balance || strings.Contains(r, "重新平衡分片")
+	}
+	if !balance {
+		t.Errorf("missing trend recommendation: %v", report.Recommendations)
+	}
+
+	reopened, err := OpenStatsStore("/index.stats", fsys, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reopened.Samples()) != 8 {
+		t.Errorf("history not persisted: %d samples", len(reopened.Samples()))
+	}
+}
@@ -0,0 +1,207 @@
+package index
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SubqueryIDField in子查询条件中表示ID本身的字段名，如 id in (tag:type==2)
+const SubqueryIDField = "id"
+
+// Subquery in条件中的子查询，外层条件字段的值需要（或者not in时不能）出现在子查询的结果中
+type Subquery struct {
+	// Query 子查询，可以带排序和分页
+	Query *Query
+
+	// Field 子查询结果中参与匹配的字段，为空时使用结果ID
+	Field string
+}
+
+// subqueryStartPattern 子查询的开始位置，如 meta.source in (
+var subqueryStartPattern = regexp.MustCompile(`\sin\s*\(`)
+
+// subqueryConditionPattern 子查询被替换为占位符之后的条件，如 meta.source not in (#0)
+var subqueryConditionPattern = regexp.MustCompile(`^(\S+)\s+(not\s+)?in\s+\(#(\d+)\)$`)
+
+// subqueryRef 解析时子查询条件的占位值，解析完成后替换为*Subquery
+type subqueryRef int
+
+// extractSubqueries 把查询字符串中 in (...) 形式的子查询替换为 (#序号) 占位符，返回替换后的字符串和子查询字符串。
+// 子查询内的括号需要成对出现，嵌套的子查询由子查询解析时处理
+func extractSubqueries(queryStr string) (string, []string, error) {
+	var subqueries []string
+	var b strings.Builder
+	rest := queryStr
+	for {
+		loc := subqueryStartPattern.FindStringIndex(rest)
+		if loc == nil {
+			break
+		}
+
+		// 找到匹配的右括号
+		open := loc[1] - 1
+		end := -1
+		depth := 0
+		for i := open; i < len(rest); i++ {
+			if rest[i] == '(' {
+				depth++
+			} else if rest[i] == ')' {
+				if depth--; depth == 0 {
+					end = i
+					break
+				}
+			}
+		}
+		if end < 0 {
+			return "", nil, fmt.Errorf("%w: 子查询缺少右括号", ErrSyntaxError)
+		}
+
+		b.WriteString(rest[:open])
+		b.WriteString("(#" + strconv.Itoa(len(subqueries)) + ")")
+		subqueries = append(subqueries, strings.TrimSpace(rest[open+1:end]))
+		rest = rest[end+1:]
+	}
+	b.WriteString(rest)
+	return b.String(), subqueries, nil
+}
+
+// parseSubqueryCondition 解析子查询条件，值先用占位符表示
+func parseSubqueryCondition(match []string) (*QueryCondition, error) {
+	index, err := strconv.Atoi(match[3])
+	if err != nil {
+		return nil, ErrSyntaxError
+	}
+	operator := OpIn
+	if match[2] != "" {
+		operator = OpNotIn
+	}
+	return &QueryCondition{
+		Field:     match[1],
+		FieldType: TypeSubquery,
+		Operator:  operator,
+		Value:     subqueryRef(index),
+	}, nil
+}
+
+// resolveSubqueries 解析子查询字符串，替换条件树中的占位符
+func (qe *DefaultQueryExecutor) resolveSubqueries(condition *QueryCondition, subqueryStrs []string) error {
+	if condition == nil {
+		return nil
+	}
+	for _, child := range condition.Children {
+		if err := qe.resolveSubqueries(child, subqueryStrs); err != nil {
+			return err
+		}
+	}
+
+	ref, ok := condition.Value.(subqueryRef)
+	if !ok || condition.FieldType != TypeSubquery {
+		return nil
+	}
+	if int(ref) >= len(subqueryStrs) {
+		return fmt.Errorf("%w: 无效的子查询", ErrSyntaxError)
+	}
+
+	query, err := qe.ParseQueryString(subqueryStrs[ref])
+	if err != nil {
+		return fmt.Errorf("子查询 %q: %w", subqueryStrs[ref], err)
+	}
+	if query.RootCondition == nil {
+		return fmt.Errorf("%w: 子查询缺少条件", ErrSyntaxError)
+	}
+
+	subquery := &Subquery{Query: query}
+	switch len(query.Select) {
+	case 0:
+	case 1:
+		if query.Select[0] == "*" {
+			return fmt.Errorf("%w: 子查询只能选择一个字段", ErrSyntaxError)
+		}
+		subquery.Field = query.Select[0]
+	default:
+		return fmt.Errorf("%w: 子查询只能选择一个字段", ErrSyntaxError)
+	}
+	condition.Value = subquery
+	return nil
+}
+
+// evaluateSubqueryCondition 评估子查询条件：先执行子查询，再筛选字段值在（或不在）子查询结果中的ID
+func (qe *DefaultQueryExecutor) evaluateSubqueryCondition(condition *QueryCondition) ([]uint32, error) {
+	subquery, ok := condition.Value.(*Subquery)
+	if !ok || subquery.Query == nil {
+		return nil, ErrInvalidValue
+	}
+
+	// 执行子查询
+	query := *subquery.Query
+	query.Select = nil
+	if subquery.Field != "" {
+		query.Select = []string{subquery.Field}
+	}
+	result, err := qe.Execute(&query)
+	if err != nil {
+		return nil, fmt.Errorf("子查询失败: %w", err)
+	}
+
+	keys := make(map[string]struct{}, len(result.IDs))
+	if subquery.Field == "" {
+		for _, id := range result.IDs {
+			keys[joinKey(id)] = struct{}{}
+		}
+	} else {
+		for _, row := range result.Rows {
+			if value, ok := row.Values[subquery.Field]; ok {
+				keys[joinKey(value)] = struct{}{}
+			}
+		}
+	}
+
+	allIDs, err := qe.metadataProvider.GetAllIDs()
+	if err != nil {
+		return nil, err
+	}
+	negate := condition.Operator == OpNotIn
+
+	// 直接比较ID
+	if condition.Field == SubqueryIDField {
+		resultIDs := make([]uint32, 0)
+		for _, id := range allIDs {
+			if _, in := keys[joinKey(id)]; in != negate {
+				resultIDs = append(resultIDs, id)
+			}
+		}
+		return resultIDs, nil
+	}
+
+	// 批量获取外层字段的值，没有该字段的ID不匹配
+	rows, err := qe.project(allIDs, []string{condition.Field})
+	if err != nil {
+		return nil, err
+	}
+	resultIDs := make([]uint32, 0)
+	for _, row := range rows {
+		value, ok := row.Values[condition.Field]
+		if !ok {
+			continue
+		}
+		if _, in := keys[joinKey(value)]; in != negate {
+			resultIDs = append(resultIDs, row.ID)
+		}
+	}
+	return resultIDs, nil
+}
+
+// joinKey 返回子查询匹配时比较的键，使uint32的ID、int64的字段值和数字字符串可以互相匹配
+func joinKey(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(value)
+	}
+}
@@ -0,0 +1,83 @@
+package index
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestQueryServiceSubquery 测试用子查询关联派生块和源块
+func TestQueryServiceSubquery(t *testing.T) {
+	im, err := NewIndexManager(nil)
+	if err != nil {
+		t.Fatalf("创建索引管理器失败: %v", err)
+	}
+	qs := NewQueryService(im)
+
+	// 源块带标签100，派生块带标签200并用meta.source记录源块ID
+	created := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	sources := []struct {
+		id    uint32
+		size  uint32
+		owner string
+	}{
+		{1, 100, "alice"},
+		{2, 300, "alice"},
+		{3, 200, "bob"},
+		{4, 50, "carol"},
+	}
+	for _, s := range sources {
+		if err := qs.IndexBlock(s.id, 1, s.size, created); err != nil {
+			t.Fatal(err)
+		}
+		if err := qs.IndexBlockAttributes(s.id, map[string]string{"owner": s.owner}); err != nil {
+			t.Fatal(err)
+		}
+		if err := im.IndexMetadata(s.id, []uint32{100}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, source := range []int64{1, 3, 2, 99} {
+		id := uint32(10 + i)
+		if err := qs.IndexBlockValues(id, map[string]interface{}{"meta.source": source}); err != nil {
+			t.Fatal(err)
+		}
+		if err := im.IndexMetadata(id, []uint32{200}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []uint32
+	}{
+		{"tag:t==200 and meta.source in (owner==alice)", []uint32{10, 12}},
+		{"meta.source not in (owner==alice)", []uint32{11, 13}},
+		{"id in (tag:t==200 and meta.source>1; select: meta.source)", []uint32{2, 3}},
+		{"tag:t==100 and id not in (tag:t==200; select: meta.source)", []uint32{4}},
+		{"meta.source in (owner==alice and id in (tag:t==100))", []uint32{10, 12}},
+		{"meta.source in (tag:t==100; sort: -block.size; limit: 1)", []uint32{12}},
+		{"meta.source in (owner matches ^(alice|carol)$); sort: -meta.source", []uint32{12, 10}},
+	}
+	for _, tt := range tests {
+		result, err := qs.Query(tt.query)
+		if err != nil {
+			t.Errorf("查询 %q 失败: %v", tt.query, err)
+			continue
+		}
+		if !reflect.DeepEqual(result.IDs, tt.want) {
+			t.Errorf("查询 %q 结果不正确: 期望 %v，实际 %v", tt.query, tt.want, result.IDs)
+		}
+	}
+
+	for _, query := range []string{
+		"meta.source in (owner==alice",
+		"id in (owner==alice; select: owner, block.size)",
+		"id in (owner==alice; select: *)",
+		"id in (limit: 1)",
+	} {
+		if _, err := qs.Query(query); err == nil {
+			t.Errorf("查询 %q 应返回错误", query)
+		}
+	}
+}
@@ -0,0 +1,802 @@
+package index
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSegmentSealed 向已封存的时间分段添加索引
+var ErrSegmentSealed = errors.New("time segment sealed")
+
+var _ IndexManager = (*TimeSeriesIndex)(nil)
+
+// 时间序列索引的默认配置
+const (
+	// DefaultTimePartition 默认的分段时长（按UTC自然日分段）
+	DefaultTimePartition = 24 * time.Hour
+	// DefaultSealDelay 分段结束后默认的封存延迟，延迟内仍接受迟到的事件
+	DefaultSealDelay = time.Hour
+)
+
+// TimeSeriesConfig 时间序列索引配置
+type TimeSeriesConfig struct {
+	// Partition 每个分段覆盖的时长，0表示DefaultTimePartition
+	Partition time.Duration
+	// Retention 保留时长，结束时间早于 当前时间-Retention 的分段整体删除，0表示永久保留
+	Retention time.Duration
+	// SealDelay 分段结束后多久封存，0表示DefaultSealDelay，负数表示结束后立即封存
+	SealDelay time.Duration
+	// Clock 当前时间，为nil时使用time.Now。AddIndex按当前时间记录事件
+	Clock func() time.Time
+	// IndexPath 索引文件路径，非空且文件存在时创建索引时加载
+	IndexPath string
+	// AutoSave UpdateIndices之后是否保存到IndexPath
+	AutoSave bool
+}
+
+// TimeSeriesStats 时间序列索引的统计
+type TimeSeriesStats struct {
+	// Segments 当前的分段数
+	Segments int
+	// SealedSegments 当前已封存的分段数
+	SealedSegments int
+	// DroppedSegments 因超出保留时长累计删除的分段数
+	DroppedSegments int64
+	// Entries 索引项总数
+	Entries int
+}
+
+// TimeSegmentInfo 时间分段的信息
+type TimeSegmentInfo struct {
+	// Start 分段开始时间（含）
+	Start time.Time
+	// End 分段结束时间（不含）
+	End time.Time
+	// Sealed 是否已封存
+	Sealed bool
+	// Items 分段中的ID数
+	Items int
+	// Entries 分段中的索引项（标签, ID）数
+	Entries int
+}
+
+// timeEntry 分段中的一个索引项
+type timeEntry struct {
+	ts int64
+	id uint32
+}
+
+// less 按时间和ID排序
+func (e timeEntry) less(other timeEntry) bool {
+	if e.ts != other.ts {
+		return e.ts < other.ts
+	}
+	return e.id < other.id
+}
+
+// timeSegment 一个时间分段，每个标签的索引项按时间排序
+type timeSegment struct {
+	// key 分段序号（开始时间 / 分段时长）
+	key int64
+	// sealed 已封存的分段不再接受新的索引项，只能移除
+	sealed bool
+	// postings 标签到按时间排序的索引项
+	postings map[uint32][]timeEntry
+	// items ID到事件时间的映射
+	items map[uint32]int64
+	// entries 索引项总数
+	entries int
+}
+
+// TimeSeriesIndex 按时间分段的标签索引
+// 每个ID代表一个带时间戳的事件，按事件时间落入固定时长的分段（默认每天一个）。
+// 时间范围查询只访问与范围重叠的分段；分段结束并超过封存延迟后封存（压缩存储，不再接受新事件）；
+// 超出保留时长的分段整体删除，删除代价与分段大小无关。实现了IndexManager接口，
+// 可以通过FragDB.SetIndexManager挂接，此时块的标签按写入时间分段
+type TimeSeriesIndex struct {
+	config    TimeSeriesConfig
+	partition int64
+
+	// segments 分段序号到分段的映射
+	segments map[int64]*timeSegment
+	// order 按时间排序的分段序号
+	order []int64
+
+	// nextMaintenance 下一次需要维护（进入新分段、封存或删除分段）的时间
+	nextMaintenance int64
+	droppedCount    int64
+	indexedCount    int
+	lastUpdateTime  time.Time
+
+	mutex sync.RWMutex
+}
+
+// NewTimeSeriesIndex 创建时间序列索引，config为nil时使用默认配置
+func NewTimeSeriesIndex(config *TimeSeriesConfig) (*TimeSeriesIndex, error) {
+	var cfg TimeSeriesConfig
+	if config != nil {
+		cfg = *config
+	}
+	if cfg.Partition == 0 {
+		cfg.Partition = DefaultTimePartition
+	}
+	if cfg.Partition < 0 || cfg.Retention < 0 {
+		return nil, fmt.Errorf("无效的分段时长或保留时长: %v, %v", cfg.Partition, cfg.Retention)
+	}
+	if cfg.SealDelay == 0 {
+		cfg.SealDelay = DefaultSealDelay
+	} else if cfg.SealDelay < 0 {
+		cfg.SealDelay = 0
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = time.Now
+	}
+
+	ts := &TimeSeriesIndex{
+		config:         cfg,
+		partition:      int64(cfg.Partition),
+		segments:       make(map[int64]*timeSegment),
+		lastUpdateTime: cfg.Clock(),
+	}
+	if cfg.IndexPath != "" {
+		if _, err := os.Stat(cfg.IndexPath); err == nil {
+			if err := ts.LoadIndex(cfg.IndexPath); err != nil {
+				logger.Error("加载时间序列索引失败", "error", err)
+				return nil, err
+			}
+		}
+	}
+	return ts, nil
+}
+
+// segmentKey 返回时间所在的分段序号
+func (ts *TimeSeriesIndex) segmentKey(nanos int64) int64 {
+	key := nanos / ts.partition
+	if nanos%ts.partition < 0 {
+		key--
+	}
+	return key
+}
+
+// segmentStart 返回分段的开始时间（Unix纳秒）
+func (ts *TimeSeriesIndex) segmentStart(key int64) int64 {
+	return key * ts.partition
+}
+
+// expiredLocked 分段是否已超出保留时长（调用方需持有锁）
+func (ts *TimeSeriesIndex) expiredLocked(key int64, now int64) bool {
+	return ts.config.Retention > 0 && ts.segmentStart(key+1) <= now-int64(ts.config.Retention)
+}
+
+// AddIndex 按当前时间添加索引，ID已在索引中时使用它原来的事件时间
+func (ts *TimeSeriesIndex) AddIndex(tag uint32, id uint32) error {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	now := ts.config.Clock().UnixNano()
+	ts.maintainLocked(now, false)
+
+	at := now
+	if segment := ts.findItemLocked(id); segment != nil {
+		at = segment.items[id]
+	}
+	return ts.addLocked(tag, id, at, now)
+}
+
+// AddIndexAt 按事件时间添加索引。同一ID的所有标签属于同一事件，ID已按其他时间索引时返回错误；
+// 事件时间所在的分段已封存时返回ErrSegmentSealed，已超出保留时长时忽略
+func (ts *TimeSeriesIndex) AddIndexAt(tag uint32, id uint32, at time.Time) error {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	now := ts.config.Clock().UnixNano()
+	ts.maintainLocked(now, false)
+
+	if segment := ts.findItemLocked(id); segment != nil && segment.items[id] != at.UnixNano() {
+		return fmt.Errorf("ID %d已按时间%v索引", id, time.Unix(0, segment.items[id]).UTC())
+	}
+	return ts.addLocked(tag, id, at.UnixNano(), now)
+}
+
+// addLocked 添加索引项（调用方需持有写锁）
+func (ts *TimeSeriesIndex) addLocked(tag uint32, id uint32, at int64, now int64) error {
+	key := ts.segmentKey(at)
+	if ts.expiredLocked(key, now) {
+		return nil
+	}
+
+	segment, ok := ts.segments[key]
+	if !ok {
+		segment = &timeSegment{
+			key:      key,
+			postings: make(map[uint32][]timeEntry),
+			items:    make(map[uint32]int64),
+		}
+		ts.segments[key] = segment
+		i := sort.Search(len(ts.order), func(i int) bool { return ts.order[i] >= key })
+		ts.order = append(ts.order, 0)
+		copy(ts.order[i+1:], ts.order[i:])
+		ts.order[i] = key
+	}
+	if segment.sealed {
+		return fmt.Errorf("%w: %v", ErrSegmentSealed, time.Unix(0, ts.segmentStart(key)).UTC())
+	}
+
+	entry := timeEntry{ts: at, id: id}
+	entries := segment.postings[tag]
+	i := sort.Search(len(entries), func(i int) bool { return !entries[i].less(entry) })
+	if i < len(entries) && entries[i] == entry {
+		return nil
+	}
+	entries = append(entries, timeEntry{})
+	copy(entries[i+1:], entries[i:])
+	entries[i] = entry
+	segment.postings[tag] = entries
+	segment.items[id] = at
+	segment.entries++
+	ts.indexedCount++
+	ts.lastUpdateTime = time.Unix(0, now)
+	return nil
+}
+
+// findItemLocked 查找ID所在的分段，从最新的分段开始（调用方需持有锁）
+func (ts *TimeSeriesIndex) findItemLocked(id uint32) *timeSegment {
+	for i := len(ts.order) - 1; i >= 0; i-- {
+		segment := ts.segments[ts.order[i]]
+		if _, ok := segment.items[id]; ok {
+			return segment
+		}
+	}
+	return nil
+}
+
+// RemoveIndex 移除索引，已封存的分段同样可以移除
+func (ts *TimeSeriesIndex) RemoveIndex(tag uint32, id uint32) error {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	ts.removeLocked(tag, id)
+	ts.lastUpdateTime = ts.config.Clock()
+	return nil
+}
+
+// removeLocked 移除索引项（调用方需持有写锁）
+func (ts *TimeSeriesIndex) removeLocked(tag uint32, id uint32) {
+	segment := ts.findItemLocked(id)
+	if segment == nil {
+		return
+	}
+
+	entry := timeEntry{ts: segment.items[id], id: id}
+	entries := segment.postings[tag]
+	i := sort.Search(len(entries), func(i int) bool { return !entries[i].less(entry) })
+	if i == len(entries) || entries[i] != entry {
+		return
+	}
+	entries = append(entries[:i], entries[i+1:]...)
+	if len(entries) == 0 {
+		delete(segment.postings, tag)
+	} else {
+		segment.postings[tag] = entries
+	}
+	segment.entries--
+	ts.indexedCount--
+
+	// ID没有其他标签时从分段中移除
+	for _, other := range segment.postings {
+		j := sort.Search(len(other), func(j int) bool { return !other[j].less(entry) })
+		if j < len(other) && other[j] == entry {
+			return
+		}
+	}
+	delete(segment.items, id)
+	if len(segment.items) == 0 {
+		ts.dropLocked(segment.key)
+	}
+}
+
+// dropLocked 删除整个分段（调用方需持有写锁）
+func (ts *TimeSeriesIndex) dropLocked(key int64) {
+	segment, ok := ts.segments[key]
+	if !ok {
+		return
+	}
+	delete(ts.segments, key)
+	i := sort.Search(len(ts.order), func(i int) bool { return ts.order[i] >= key })
+	ts.order = append(ts.order[:i], ts.order[i+1:]...)
+	ts.indexedCount -= segment.entries
+}
+
+// Maintain 封存已结束的分段并删除超出保留时长的分段，返回删除的分段数。
+// 写入时在需要封存或删除分段时自动执行，UpdateIndices和OptimizeIndex也会执行
+func (ts *TimeSeriesIndex) Maintain() int {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	return ts.maintainLocked(ts.config.Clock().UnixNano(), true)
+}
+
+// maintainLocked 执行维护，force为false时未到下一次维护时间则跳过（调用方需持有写锁）
+func (ts *TimeSeriesIndex) maintainLocked(now int64, force bool) int {
+	if !force && now < ts.nextMaintenance {
+		return 0
+	}
+
+	dropped := 0
+	for len(ts.order) > 0 && ts.expiredLocked(ts.order[0], now) {
+		ts.dropLocked(ts.order[0])
+		ts.droppedCount++
+		dropped++
+	}
+
+	// 下一次维护：进入下一个分段、最早的未封存分段到期封存或最早的分段过期，取最早者
+	next := ts.segmentStart(ts.segmentKey(now) + 1)
+	sealBefore := now - int64(ts.config.SealDelay)
+	for _, key := range ts.order {
+		segment := ts.segments[key]
+		if segment.sealed {
+			continue
+		}
+		if ts.segmentStart(key+1) > sealBefore {
+			if sealAt := ts.segmentStart(key+1) + int64(ts.config.SealDelay); sealAt < next {
+				next = sealAt
+			}
+			break
+		}
+		ts.sealLocked(segment)
+	}
+	if len(ts.order) > 0 && ts.config.Retention > 0 {
+		if expireAt := ts.segmentStart(ts.order[0]+1) + int64(ts.config.Retention); expireAt < next {
+			next = expireAt
+		}
+	}
+	ts.nextMaintenance = next
+	return dropped
+}
+
+// sealLocked 封存分段：压缩每个标签的索引项（调用方需持有写锁）
+func (ts *TimeSeriesIndex) sealLocked(segment *timeSegment) {
+	for tag, entries := range segment.postings {
+		compact := make([]timeEntry, len(entries))
+		copy(compact, entries)
+		segment.postings[tag] = compact
+	}
+	segment.sealed = true
+}
+
+// DropBefore 删除结束时间不晚于t的所有分段，返回删除的分段数
+func (ts *TimeSeriesIndex) DropBefore(t time.Time) int {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	dropped := 0
+	for len(ts.order) > 0 && ts.segmentStart(ts.order[0]+1) <= t.UnixNano() {
+		ts.dropLocked(ts.order[0])
+		ts.droppedCount++
+		dropped++
+	}
+	return dropped
+}
+
+// FindByTagInRange 查找事件时间在[start, end)内带有标签的ID，按事件时间排序。
+// 只访问与时间范围重叠的分段
+func (ts *TimeSeriesIndex) FindByTagInRange(tag uint32, start, end time.Time) ([]uint32, error) {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	return ts.collectLocked(tag, start.UnixNano(), end.UnixNano()), nil
+}
+
+// collectLocked 收集时间范围内带有标签的ID（调用方需持有锁）
+func (ts *TimeSeriesIndex) collectLocked(tag uint32, start, end int64) []uint32 {
+	now := ts.config.Clock().UnixNano()
+	first := sort.Search(len(ts.order), func(i int) bool { return ts.segmentStart(ts.order[i]+1) > start })
+
+	result := make([]uint32, 0)
+	for _, key := range ts.order[first:] {
+		if ts.segmentStart(key) >= end {
+			break
+		}
+		if ts.expiredLocked(key, now) {
+			continue
+		}
+		entries := ts.segments[key].postings[tag]
+		i := sort.Search(len(entries), func(i int) bool { return entries[i].ts >= start })
+		for ; i < len(entries) && entries[i].ts < end; i++ {
+			result = append(result, entries[i].id)
+		}
+	}
+	return result
+}
+
+// FindByKey 根据键查找，按事件时间排序
+func (ts *TimeSeriesIndex) FindByKey(tag uint32) ([]uint32, error) {
+	return ts.FindByTag(tag)
+}
+
+// FindByTag 根据标签查找所有未过期的ID，按事件时间排序，没有该标签时返回ErrIndexNotFound
+func (ts *TimeSeriesIndex) FindByTag(tag uint32) ([]uint32, error) {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	ids := ts.collectLocked(tag, -1<<63, 1<<63-1)
+	if len(ids) == 0 {
+		return nil, ErrIndexNotFound
+	}
+	return ids, nil
+}
+
+// FindByPattern 根据模式查找，与IndexManagerImpl相同返回所有标签的索引
+func (ts *TimeSeriesIndex) FindByPattern(pattern string) (map[uint32][]uint32, error) {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	tags := make(map[uint32]struct{})
+	for _, segment := range ts.segments {
+		for tag := range segment.postings {
+			tags[tag] = struct{}{}
+		}
+	}
+	result := make(map[uint32][]uint32, len(tags))
+	for tag := range tags {
+		if ids := ts.collectLocked(tag, -1<<63, 1<<63-1); len(ids) > 0 {
+			result[tag] = ids
+		}
+	}
+	return result, nil
+}
+
+// UpdateIndices 执行维护，启用自动保存时保存索引
+func (ts *TimeSeriesIndex) UpdateIndices() error {
+	ts.Maintain()
+	if ts.config.AutoSave && ts.config.IndexPath != "" {
+		return ts.SaveIndex(ts.config.IndexPath)
+	}
+	return nil
+}
+
+// GetStatus 获取索引状态，每个分段作为一个分片报告
+func (ts *TimeSeriesIndex) GetStatus() *IndexStatus {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	status := &IndexStatus{
+		TotalItems:     ts.indexedCount,
+		IndexedItems:   ts.indexedCount,
+		LastUpdateTime: ts.lastUpdateTime,
+		Progress:       100,
+	}
+	for i, key := range ts.order {
+		status.ShardStatus = append(status.ShardStatus, ShardStatus{
+			ShardID:   i,
+			ItemCount: int32(ts.segments[key].entries),
+		})
+	}
+	return status
+}
+
+// Segments 返回所有分段的信息，按时间排序
+func (ts *TimeSeriesIndex) Segments() []TimeSegmentInfo {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	infos := make([]TimeSegmentInfo, 0, len(ts.order))
+	for _, key := range ts.order {
+		segment := ts.segments[key]
+		infos = append(infos, TimeSegmentInfo{
+			Start:   time.Unix(0, ts.segmentStart(key)).UTC(),
+			End:     time.Unix(0, ts.segmentStart(key+1)).UTC(),
+			Sealed:  segment.sealed,
+			Items:   len(segment.items),
+			Entries: segment.entries,
+		})
+	}
+	return infos
+}
+
+// Stats 返回索引统计
+func (ts *TimeSeriesIndex) Stats() TimeSeriesStats {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	stats := TimeSeriesStats{
+		Segments:        len(ts.order),
+		DroppedSegments: ts.droppedCount,
+		Entries:         ts.indexedCount,
+	}
+	for _, segment := range ts.segments {
+		if segment.sealed {
+			stats.SealedSegments++
+		}
+	}
+	return stats
+}
+
+// timeSeriesFile 时间序列索引文件的格式
+type timeSeriesFile struct {
+	Partition      int64                   `json:"partition"`
+	Segments       []timeSeriesFileSegment `json:"segments"`
+	LastUpdateTime time.Time               `json:"last_update_time"`
+}
+
+// timeSeriesFileSegment 索引文件中的分段，索引项为 [事件时间, ID] 对
+type timeSeriesFileSegment struct {
+	Key      int64                  `json:"key"`
+	Sealed   bool                   `json:"sealed"`
+	Postings map[uint32][][2]uint64 `json:"postings"`
+}
+
+// SaveIndex 保存索引
+func (ts *TimeSeriesIndex) SaveIndex(path string) error {
+	ts.mutex.RLock()
+	file := timeSeriesFile{Partition: ts.partition, LastUpdateTime: ts.lastUpdateTime}
+	for _, key := range ts.order {
+		segment := ts.segments[key]
+		saved := timeSeriesFileSegment{Key: key, Sealed: segment.sealed, Postings: make(map[uint32][][2]uint64, len(segment.postings))}
+		for tag, entries := range segment.postings {
+			pairs := make([][2]uint64, len(entries))
+			for i, entry := range entries {
+				pairs[i] = [2]uint64{uint64(entry.ts), uint64(entry.id)}
+			}
+			saved.Postings[tag] = pairs
+		}
+		file.Segments = append(file.Segments, saved)
+	}
+	ts.mutex.RUnlock()
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		logger.Error("序列化时间序列索引失败", "error", err)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// LoadIndex 加载索引，文件的分段时长须与配置相同
+func (ts *TimeSeriesIndex) LoadIndex(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Error("读取时间序列索引失败", "error", err)
+		return err
+	}
+	var file timeSeriesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		logger.Error("解析时间序列索引失败", "error", err)
+		return fmt.Errorf("%w: %v", ErrIndexCorrupted, err)
+	}
+	if file.Partition != ts.partition {
+		return fmt.Errorf("%w: 分段时长%v与配置的%v不同", ErrIndexCorrupted, time.Duration(file.Partition), ts.config.Partition)
+	}
+
+	segments := make(map[int64]*timeSegment, len(file.Segments))
+	order := make([]int64, 0, len(file.Segments))
+	count := 0
+	for _, saved := range file.Segments {
+		segment := &timeSegment{
+			key:      saved.Key,
+			sealed:   saved.Sealed,
+			postings: make(map[uint32][]timeEntry, len(saved.Postings)),
+			items:    make(map[uint32]int64),
+		}
+		for tag, pairs := range saved.Postings {
+			entries := make([]timeEntry, len(pairs))
+			for i, pair := range pairs {
+				entries[i] = timeEntry{ts: int64(pair[0]), id: uint32(pair[1])}
+				if ts.segmentKey(entries[i].ts) != saved.Key {
+					return fmt.Errorf("%w: 索引项不在分段的时间范围内", ErrIndexCorrupted)
+				}
+				segment.items[entries[i].id] = entries[i].ts
+			}
+			sort.Slice(entries, func(i, j int) bool { return entries[i].less(entries[j]) })
+			segment.postings[tag] = entries
+			segment.entries += len(entries)
+		}
+		if _, ok := segments[saved.Key]; ok {
+			return fmt.Errorf("%w: 重复的分段", ErrIndexCorrupted)
+		}
+		segments[saved.Key] = segment
+		order = append(order, saved.Key)
+		count += segment.entries
+	}
+	sort.Slice(order, func(i, j int) bool { return order[i] < order[j] })
+
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	ts.segments = segments
+	ts.order = order
+	ts.indexedCount = count
+	ts.lastUpdateTime = file.LastUpdateTime
+	ts.maintainLocked(ts.config.Clock().UnixNano(), true)
+	return nil
+}
+
+// IndexMetadata 按当前时间索引ID的所有标签
+func (ts *TimeSeriesIndex) IndexMetadata(id uint32, tags []uint32) error {
+	for _, tag := range tags {
+		if err := ts.AddIndex(tag, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AsyncAddIndex 异步添加索引，当前实现是同步的
+func (ts *TimeSeriesIndex) AsyncAddIndex(tag uint32, id uint32) error {
+	return ts.AddIndex(tag, id)
+}
+
+// AsyncRemoveIndex 异步移除索引，当前实现是同步的
+func (ts *TimeSeriesIndex) AsyncRemoveIndex(tag uint32, id uint32) error {
+	return ts.RemoveIndex(tag, id)
+}
+
+// BatchAddIndices 批量添加索引
+func (ts *TimeSeriesIndex) BatchAddIndices(tags []uint32, ids []uint32) error {
+	if len(tags) != len(ids) {
+		return fmt.Errorf("%w: 标签和ID数组长度不匹配", ErrLengthMismatch)
+	}
+	for i := range tags {
+		if err := ts.AddIndex(tags[i], ids[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// BatchRemoveIndices 批量移除索引
+func (ts *TimeSeriesIndex) BatchRemoveIndices(tags []uint32, ids []uint32) error {
+	if len(tags) != len(ids) {
+		return fmt.Errorf("%w: 标签和ID数组长度不匹配", ErrLengthMismatch)
+	}
+
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+
+	for i := range tags {
+		ts.removeLocked(tags[i], ids[i])
+	}
+	ts.lastUpdateTime = ts.config.Clock()
+	return nil
+}
+
+// GetIndexMetadata 获取索引元数据，分片数为分段数
+func (ts *TimeSeriesIndex) GetIndexMetadata() *IndexMetadata {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	return &IndexMetadata{
+		Version:    "1.0",
+		ModifiedAt: ts.lastUpdateTime,
+		ItemCount:  ts.indexedCount,
+		ShardCount: len(ts.order),
+	}
+}
+
+// FindByTagInShard 在第shardID个分段（按时间排序）中查找标签
+func (ts *TimeSeriesIndex) FindByTagInShard(tag uint32, shardID int) ([]uint32, error) {
+	ts.mutex.RLock()
+	defer ts.mutex.RUnlock()
+
+	if shardID < 0 || shardID >= len(ts.order) {
+		return nil, ErrIndexNotFound
+	}
+	key := ts.order[shardID]
+	return ts.collectLocked(tag, ts.segmentStart(key), ts.segmentStart(key+1)), nil
+}
+
+// OptimizeIndex 执行维护
+func (ts *TimeSeriesIndex) OptimizeIndex() error {
+	ts.Maintain()
+	return nil
+}
+
+// GetPendingTaskCount 获取待处理任务数，当前实现是同步的
+func (ts *TimeSeriesIndex) GetPendingTaskCount() int {
+	return 0
+}
+
+// GetPrefixTree 按ID的十进制形式构建标签的前缀树
+func (ts *TimeSeriesIndex) GetPrefixTree(tag uint32) (*PrefixNode, error) {
+	ids, err := ts.FindByTag(tag)
+	if err != nil && !errors.Is(err, ErrIndexNotFound) {
+		return nil, err
+	}
+
+	root := &PrefixNode{Children: make(map[string]*PrefixNode)}
+	for _, id := range ids {
+		(&IndexManagerImpl{}).addToPrefixTree(root, strconv.FormatUint(uint64(id), 10), id)
+	}
+	return root, nil
+}
+
+// FindByPrefix 查找十进制形式以prefix开头的ID
+func (ts *TimeSeriesIndex) FindByPrefix(tag uint32, prefix string) ([]uint32, error) {
+	ids, err := ts.FindByTag(tag)
+	if err != nil {
+		return nil, nil
+	}
+	result := ids[:0]
+	for _, id := range ids {
+		if strings.HasPrefix(strconv.FormatUint(uint64(id), 10), prefix) {
+			result = append(result, id)
+		}
+	}
+	return result, nil
+}
+
+// FindByRange 查找在[start, end]范围内的ID，没有时返回ErrIndexNotFound
+func (ts *TimeSeriesIndex) FindByRange(tag uint32, start, end uint32) ([]uint32, error) {
+	ids, err := ts.FindByTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	result := ids[:0]
+	for _, id := range ids {
+		if id >= start && id <= end {
+			result = append(result, id)
+		}
+	}
+	if len(result) == 0 {
+		return nil, ErrIndexNotFound
+	}
+	return result, nil
+}
+
+// FindCompound 复合查询，条件之间取交集
+func (ts *TimeSeriesIndex) FindCompound(conditions []IndexQueryCondition) ([]uint32, error) {
+	if len(conditions) == 0 {
+		return nil, fmt.Errorf("%w: 没有提供查询条件", ErrNoConditions)
+	}
+
+	var result []uint32
+	for i, condition := range conditions {
+		var ids []uint32
+		var err error
+		switch condition.Operation {
+		case "eq":
+			ids, err = ts.FindByTag(condition.Tag)
+		case "prefix":
+			prefix, ok := condition.Value.(string)
+			if !ok {
+				return nil, fmt.Errorf("%w: 前缀值必须是字符串类型", ErrInvalidValue)
+			}
+			ids, err = ts.FindByPrefix(condition.Tag, prefix)
+		case "range":
+			bounds, ok := condition.Value.([]uint32)
+			if !ok || len(bounds) != 2 {
+				return nil, fmt.Errorf("%w: 范围值必须是包含两个uint32的数组", ErrInvalidValue)
+			}
+			ids, err = ts.FindByRange(condition.Tag, bounds[0], bounds[1])
+		default:
+			return nil, fmt.Errorf("不支持的操作类型: %s", condition.Operation)
+		}
+		if err != nil && !errors.Is(err, ErrIndexNotFound) {
+			return nil, err
+		}
+
+		if i == 0 {
+			result = ids
+			continue
+		}
+		set := make(map[uint32]struct{}, len(ids))
+		for _, id := range ids {
+			set[id] = struct{}{}
+		}
+		kept := make([]uint32, 0, len(result))
+		for _, id := range result {
+			if _, ok := set[id]; ok {
+				kept = append(kept, id)
+			}
+		}
+		result = kept
+	}
+	return result, nil
+}
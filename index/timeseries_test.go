@@ -0,0 +1,127 @@
+package index
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestTimeSeriesIndex 测试按天分段、范围查询、自动封存和按保留时长删除分段
+func TestTimeSeriesIndex(t *testing.T) {
+	base := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	now := base
+	ts, err := NewTimeSeriesIndex(&TimeSeriesConfig{
+		Retention: 3 * 24 * time.Hour,
+		Clock:     func() time.Time { return now },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 每天10个事件，每隔2小时一个；偶数ID另带标签2
+	id := uint32(0)
+	for day := 0; day < 3; day++ {
+		for hour := 0; hour < 20; hour += 2 {
+			id++
+			now = base.Add(time.Duration(day*24+hour) * time.Hour)
+			if err := ts.AddIndex(1, id); err != nil {
+				t.Fatal(err)
+			}
+			if id%2 == 0 {
+				if err := ts.AddIndex(2, id); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+
+	segments := ts.Segments()
+	if len(segments) != 3 || segments[0].Items != 10 || segments[0].Entries != 15 {
+		t.Fatalf("分段不正确: %+v", segments)
+	}
+	if !segments[0].Sealed || !segments[1].Sealed || segments[2].Sealed {
+		t.Errorf("已结束的分段应封存，当前分段不应封存: %+v", segments)
+	}
+
+	// 范围查询只返回范围内的事件，按时间排序
+	ids, err := ts.FindByTagInRange(1, base.Add(46*time.Hour), base.Add(52*time.Hour))
+	if err != nil || !reflect.DeepEqual(ids, []uint32{21, 22}) {
+		t.Errorf("跨分段的范围查询结果不正确: %v, %v", ids, err)
+	}
+	if ids, _ := ts.FindByTagInRange(2, base, base.Add(5*time.Hour)); !reflect.DeepEqual(ids, []uint32{2}) {
+		t.Errorf("范围查询结果不正确: %v", ids)
+	}
+	if ids, _ := ts.FindByTag(2); len(ids) != 15 || ids[0] != 2 || ids[14] != 30 {
+		t.Errorf("FindByTag结果不正确: %v", ids)
+	}
+
+	// 已封存的分段不接受新事件，但可以移除
+	if err := ts.AddIndexAt(1, 100, base.Add(time.Hour)); !errors.Is(err, ErrSegmentSealed) {
+		t.Errorf("向已封存的分段添加应返回ErrSegmentSealed: %v", err)
+	}
+	if err := ts.RemoveIndex(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := ts.FindByTagInRange(1, base, base.Add(3*time.Hour)); len(ids) != 1 || ids[0] != 2 {
+		t.Errorf("移除后的结果不正确: %v", ids)
+	}
+	if err := ts.AddIndexAt(1, 5, base.Add(50*time.Hour)); err == nil {
+		t.Error("同一ID按不同时间索引应返回错误")
+	}
+
+	// 保存并重新加载
+	path := filepath.Join(t.TempDir(), "ts.json")
+	if err := ts.SaveIndex(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := NewTimeSeriesIndex(&TimeSeriesConfig{IndexPath: path, Retention: 3 * 24 * time.Hour, Clock: func() time.Time { return now }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := ts.FindByTag(1)
+	if got, _ := loaded.FindByTag(1); !reflect.DeepEqual(got, want) || loaded.Stats().SealedSegments != 2 {
+		t.Errorf("重新加载的索引不正确: %v, %+v", got, loaded.Stats())
+	}
+
+	// 超出保留时长的分段在进入新分段时整体删除，删除前查询也不再返回
+	now = base.Add(4*24*time.Hour + time.Hour)
+	if ids, _ := ts.FindByTagInRange(1, base, base.Add(24*time.Hour)); len(ids) != 0 {
+		t.Errorf("过期分段不应出现在查询结果中: %v", ids)
+	}
+	if err := ts.AddIndex(1, 1000); err != nil {
+		t.Fatal(err)
+	}
+	stats := ts.Stats()
+	if stats.Segments != 3 || stats.DroppedSegments != 1 || stats.Entries != 31 {
+		t.Errorf("删除过期分段后的统计不正确: %+v", stats)
+	}
+	if dropped := ts.DropBefore(base.Add(3 * 24 * time.Hour)); dropped != 2 {
+		t.Errorf("DropBefore应删除2个分段，实际%d", dropped)
+	}
+	if ids, _ := ts.FindByTag(1); !reflect.DeepEqual(ids, []uint32{1000}) {
+		t.Errorf("删除分段后的结果不正确: %v", ids)
+	}
+}
+
+// BenchmarkTimeSeriesRecentRange 测试在60天的事件中查询最近一小时的事件，只访问最新的分段
+func BenchmarkTimeSeriesRecentRange(b *testing.B) {
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := base
+	ts, _ := NewTimeSeriesIndex(&TimeSeriesConfig{Clock: func() time.Time { return now }})
+	const days, perDay = 60, 2000
+	for i := 0; i < days*perDay; i++ {
+		now = base.Add(time.Duration(i) * 24 * time.Hour / perDay)
+		ts.AddIndex(1, uint32(i+1))
+	}
+	start := now.Add(-time.Hour)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ids, _ := ts.FindByTagInRange(1, start, now.Add(time.Nanosecond))
+		if len(ids) == 0 {
+			b.Fatal("结果为空")
+		}
+	}
+}
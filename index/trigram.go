@@ -0,0 +1,369 @@
+package index
+
+import (
+	"regexp/syntax"
+	"sync"
+	"unicode/utf8"
+)
+
+// 正则表达式分析的限制，超过时放弃精确字符串集合，退化为较宽松的三元组条件
+const (
+	// maxTrigramExactSet 精确字符串集合的最大大小
+	maxTrigramExactSet = 16
+	// maxTrigramClassSize 展开为精确字符串的字符类的最大字符数
+	maxTrigramClassSize = 8
+)
+
+// TrigramIndex 字符串字段的三元组索引
+// 维护 字段 -> 三元组(连续3个字节) -> 块ID集合 的倒排表。contains和matches条件先由
+// 查询字符串或正则表达式推导出匹配值必须包含的三元组，取得候选块后再逐个验证，
+// 避免对所有块执行正则匹配（类似codesearch）。索引只用于缩小候选范围，不影响结果。
+type TrigramIndex struct {
+	// postings 三元组倒排表
+	postings map[string]map[uint32]map[uint32]struct{}
+	// blocks 块ID到其已索引字段值的映射，用于替换和删除
+	blocks map[uint32]map[string]string
+	// mutex 并发保护
+	mutex sync.RWMutex
+}
+
+// NewTrigramIndex 创建三元组索引
+func NewTrigramIndex() *TrigramIndex {
+	return &TrigramIndex{
+		postings: make(map[string]map[uint32]map[uint32]struct{}),
+		blocks:   make(map[uint32]map[string]string),
+	}
+}
+
+// IndexBlockFields 索引块的字符串字段，替换该块之前的所有字段
+func (ti *TrigramIndex) IndexBlockFields(blockID uint32, fields map[string]string) {
+	ti.mutex.Lock()
+	defer ti.mutex.Unlock()
+
+	ti.removeLocked(blockID)
+
+	if len(fields) == 0 {
+		return
+	}
+
+	stored := make(map[string]string, len(fields))
+	for field, value := range fields {
+		stored[field] = value
+
+		trigrams, ok := ti.postings[field]
+		if !ok {
+			trigrams = make(map[uint32]map[uint32]struct{})
+			ti.postings[field] = trigrams
+		}
+		forEachTrigram(value, func(trigram uint32) {
+			ids, ok := trigrams[trigram]
+			if !ok {
+				ids = make(map[uint32]struct{})
+				trigrams[trigram] = ids
+			}
+			ids[blockID] = struct{}{}
+		})
+	}
+	ti.blocks[blockID] = stored
+}
+
+// RemoveBlock 移除块的所有字段
+func (ti *TrigramIndex) RemoveBlock(blockID uint32) {
+	ti.mutex.Lock()
+	defer ti.mutex.Unlock()
+
+	ti.removeLocked(blockID)
+}
+
+// removeLocked 移除块的字段（调用方需持有写锁）
+func (ti *TrigramIndex) removeLocked(blockID uint32) {
+	old, ok := ti.blocks[blockID]
+	if !ok {
+		return
+	}
+
+	for field, value := range old {
+		trigrams := ti.postings[field]
+		forEachTrigram(value, func(trigram uint32) {
+			delete(trigrams[trigram], blockID)
+			if len(trigrams[trigram]) == 0 {
+				delete(trigrams, trigram)
+			}
+		})
+		if len(trigrams) == 0 {
+			delete(ti.postings, field)
+		}
+	}
+	delete(ti.blocks, blockID)
+}
+
+// Candidates 返回字段值可能满足字符串条件的块，按块ID升序返回。
+// 只支持contains和matches条件，无法由条件推导出三元组（如查询字符串不足3个字节、
+// 正则表达式不区分大小写或可以匹配空串）时返回false，调用方需检查所有块
+func (ti *TrigramIndex) Candidates(field string, operator OperatorType, value string) ([]uint32, bool) {
+	var query *trigramQuery
+	switch operator {
+	case OpContains:
+		query = literalTrigramQuery(value)
+	case OpMatches:
+		re, err := syntax.Parse(value, syntax.Perl)
+		if err != nil {
+			return nil, false
+		}
+		query = regexpTrigramQuery(re)
+	default:
+		return nil, false
+	}
+	if query.op == trigramAll {
+		return nil, false
+	}
+
+	ti.mutex.RLock()
+	defer ti.mutex.RUnlock()
+
+	return sortedIDs(ti.evaluateLocked(ti.postings[field], query)), true
+}
+
+// evaluateLocked 计算三元组条件的候选块集合（调用方需持有读锁）
+func (ti *TrigramIndex) evaluateLocked(trigrams map[uint32]map[uint32]struct{}, query *trigramQuery) map[uint32]struct{} {
+	switch query.op {
+	case trigramAnd:
+		var result map[uint32]struct{}
+		for i, trigram := range query.trigrams {
+			ids := trigrams[trigram]
+			if i == 0 {
+				result = make(map[uint32]struct{}, len(ids))
+				for id := range ids {
+					result[id] = struct{}{}
+				}
+				continue
+			}
+			for id := range result {
+				if _, ok := ids[id]; !ok {
+					delete(result, id)
+				}
+			}
+		}
+		for _, sub := range query.subs {
+			ids := ti.evaluateLocked(trigrams, sub)
+			if result == nil {
+				result = ids
+				continue
+			}
+			for id := range result {
+				if _, ok := ids[id]; !ok {
+					delete(result, id)
+				}
+			}
+		}
+		return result
+	case trigramOr:
+		result := make(map[uint32]struct{})
+		for _, sub := range query.subs {
+			for id := range ti.evaluateLocked(trigrams, sub) {
+				result[id] = struct{}{}
+			}
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// forEachTrigram 遍历字符串中的所有三元组（按字节），重复的三元组会多次出现
+func forEachTrigram(s string, fn func(trigram uint32)) {
+	for i := 0; i+3 <= len(s); i++ {
+		fn(uint32(s[i])<<16 | uint32(s[i+1])<<8 | uint32(s[i+2]))
+	}
+}
+
+// trigramOp 三元组条件的类型
+type trigramOp int
+
+const (
+	// trigramAll 不限制候选（任何值都可能匹配）
+	trigramAll trigramOp = iota
+	// trigramAnd 必须包含所有三元组并满足所有子条件
+	trigramAnd
+	// trigramOr 满足任一子条件
+	trigramOr
+)
+
+// trigramQuery 匹配值必须满足的三元组条件
+type trigramQuery struct {
+	op       trigramOp
+	trigrams []uint32
+	subs     []*trigramQuery
+}
+
+// allTrigramQuery 返回不限制候选的条件
+func allTrigramQuery() *trigramQuery {
+	return &trigramQuery{op: trigramAll}
+}
+
+// literalTrigramQuery 返回包含字符串s的值必须满足的条件
+func literalTrigramQuery(s string) *trigramQuery {
+	if len(s) < 3 {
+		return allTrigramQuery()
+	}
+	query := &trigramQuery{op: trigramAnd}
+	seen := make(map[uint32]bool)
+	forEachTrigram(s, func(trigram uint32) {
+		if !seen[trigram] {
+			seen[trigram] = true
+			query.trigrams = append(query.trigrams, trigram)
+		}
+	})
+	return query
+}
+
+// andTrigramQuery 组合两个必须同时满足的条件
+func andTrigramQuery(a, b *trigramQuery) *trigramQuery {
+	if a.op == trigramAll {
+		return b
+	}
+	if b.op == trigramAll {
+		return a
+	}
+	return &trigramQuery{op: trigramAnd, subs: []*trigramQuery{a, b}}
+}
+
+// orTrigramQuery 组合满足其一即可的条件，任一条件不限制候选时整体不限制
+func orTrigramQuery(queries ...*trigramQuery) *trigramQuery {
+	for _, query := range queries {
+		if query.op == trigramAll {
+			return allTrigramQuery()
+		}
+	}
+	if len(queries) == 1 {
+		return queries[0]
+	}
+	return &trigramQuery{op: trigramOr, subs: queries}
+}
+
+// setTrigramQuery 返回包含集合中任一字符串的值必须满足的条件
+func setTrigramQuery(set []string) *trigramQuery {
+	queries := make([]*trigramQuery, 0, len(set))
+	for _, s := range set {
+		queries = append(queries, literalTrigramQuery(s))
+	}
+	return orTrigramQuery(queries...)
+}
+
+// regexpTrigramQuery 返回可以被正则表达式匹配的值必须满足的条件
+func regexpTrigramQuery(re *syntax.Regexp) *trigramQuery {
+	exact, query := analyzeRegexp(re)
+	if exact != nil {
+		query = andTrigramQuery(query, setTrigramQuery(exact))
+	}
+	return query
+}
+
+// analyzeRegexp 分析正则表达式节点，返回它能匹配的精确字符串集合（未知或过大时为nil）
+// 以及匹配的子串必须满足的三元组条件。连接节点的每一部分都是匹配子串的子串，
+// 因此各部分的条件可以直接取交集
+func analyzeRegexp(re *syntax.Regexp) ([]string, *trigramQuery) {
+	switch re.Op {
+	case syntax.OpEmptyMatch, syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText,
+		syntax.OpEndText, syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return []string{""}, allTrigramQuery()
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return nil, allTrigramQuery()
+		}
+		return []string{string(re.Rune)}, allTrigramQuery()
+	case syntax.OpCharClass:
+		return charClassStrings(re.Rune), allTrigramQuery()
+	case syntax.OpCapture:
+		return analyzeRegexp(re.Sub[0])
+	case syntax.OpConcat:
+		exact := []string{""}
+		query := allTrigramQuery()
+		for _, sub := range re.Sub {
+			subExact, subQuery := analyzeRegexp(sub)
+			query = andTrigramQuery(query, subQuery)
+			if exact != nil && subExact != nil && len(exact)*len(subExact) <= maxTrigramExactSet {
+				exact = crossStrings(exact, subExact)
+				continue
+			}
+			if exact != nil {
+				query = andTrigramQuery(query, setTrigramQuery(exact))
+			}
+			exact = subExact
+		}
+		return exact, query
+	case syntax.OpAlternate:
+		var exact []string
+		queries := make([]*trigramQuery, 0, len(re.Sub))
+		for _, sub := range re.Sub {
+			subExact, subQuery := analyzeRegexp(sub)
+			if exact != nil || len(queries) == 0 {
+				if subExact != nil && len(exact)+len(subExact) <= maxTrigramExactSet {
+					exact = append(exact, subExact...)
+				} else {
+					exact = nil
+				}
+			}
+			if subExact != nil {
+				subQuery = andTrigramQuery(subQuery, setTrigramQuery(subExact))
+			}
+			queries = append(queries, subQuery)
+		}
+		if exact != nil {
+			return exact, allTrigramQuery()
+		}
+		return nil, orTrigramQuery(queries...)
+	case syntax.OpQuest:
+		subExact, _ := analyzeRegexp(re.Sub[0])
+		if subExact != nil && len(subExact) < maxTrigramExactSet {
+			return append([]string{""}, subExact...), allTrigramQuery()
+		}
+		return nil, allTrigramQuery()
+	case syntax.OpPlus:
+		return nil, regexpTrigramQuery(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min == 0 {
+			return nil, allTrigramQuery()
+		}
+		return nil, regexpTrigramQuery(re.Sub[0])
+	default:
+		// 任意字符、星号重复等可以匹配任何内容
+		return nil, allTrigramQuery()
+	}
+}
+
+// charClassStrings 把较小的字符类展开为字符串集合，过大时返回nil
+func charClassStrings(ranges []rune) []string {
+	size := 0
+	for i := 0; i+1 < len(ranges); i += 2 {
+		size += int(ranges[i+1]-ranges[i]) + 1
+		if size > maxTrigramClassSize {
+			return nil
+		}
+	}
+	if size == 0 {
+		return nil
+	}
+
+	set := make([]string, 0, size)
+	for i := 0; i+1 < len(ranges); i += 2 {
+		for r := ranges[i]; r <= ranges[i+1]; r++ {
+			if !utf8.ValidRune(r) {
+				return nil
+			}
+			set = append(set, string(r))
+		}
+	}
+	return set
+}
+
+// crossStrings 返回两个字符串集合的连接积
+func crossStrings(a, b []string) []string {
+	result := make([]string, 0, len(a)*len(b))
+	for _, x := range a {
+		for _, y := range b {
+			result = append(result, x+y)
+		}
+	}
+	return result
+}
@@ -0,0 +1,133 @@
+package index
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// TestTrigramIndex 测试三元组索引缩小的候选范围包含所有匹配的块，并且能排除不匹配的块
+func TestTrigramIndex(t *testing.T) {
+	values := []string{
+		"report-2024.pdf", "report-2025.pdf", "invoice-2025.xlsx", "photo.jpg",
+		"Report-final.doc", "notes.txt", "archive.tar.gz", "abc", "ab", "",
+		"log-error-42", "log-warn-7", "中文文档.txt",
+	}
+	ti := NewTrigramIndex()
+	for i, value := range values {
+		ti.IndexBlockFields(uint32(i+1), map[string]string{"name": value})
+	}
+
+	tests := []struct {
+		operator OperatorType
+		value    string
+		narrowed bool
+	}{
+		{OpContains, "report", true},
+		{OpContains, "2025", true},
+		{OpContains, "ab", false},
+		{OpMatches, `report-\d+\.pdf`, true},
+		{OpMatches, `^(invoice|photo)\.`, true},
+		{OpMatches, `log-(error|warn)-`, true},
+		{OpMatches, `[rR]eport`, true},
+		{OpMatches, `(?i)report`, false},
+		{OpMatches, `.*`, false},
+		{OpMatches, `a?b*c`, false},
+		{OpMatches, `(tar)+\.gz`, true},
+		{OpMatches, `文档`, true},
+		{OpMatches, `x{2,}yzw`, true},
+	}
+	for _, tt := range tests {
+		var want []uint32
+		for i, value := range values {
+			var matched bool
+			if tt.operator == OpContains {
+				matched = strings.Contains(value, tt.value)
+			} else {
+				matched = regexp.MustCompile(tt.value).MatchString(value)
+			}
+			if matched {
+				want = append(want, uint32(i+1))
+			}
+		}
+
+		candidates, narrowed := ti.Candidates("name", tt.operator, tt.value)
+		if narrowed != tt.narrowed {
+			t.Errorf("%s %q: 是否缩小范围应为%v", tt.operator, tt.value, tt.narrowed)
+		}
+		if !narrowed {
+			continue
+		}
+		set := make(map[uint32]bool, len(candidates))
+		for _, id := range candidates {
+			set[id] = true
+		}
+		for _, id := range want {
+			if !set[id] {
+				t.Errorf("%s %q: 候选中缺少匹配的块%d（%q）", tt.operator, tt.value, id, values[id-1])
+			}
+		}
+		if len(candidates) >= len(values)/2 {
+			t.Errorf("%s %q: 候选范围过大: %v", tt.operator, tt.value, candidates)
+		}
+	}
+
+	// 替换和移除后不再返回旧值
+	ti.IndexBlockFields(1, map[string]string{"name": "summary.pdf"})
+	ti.RemoveBlock(2)
+	if ids, _ := ti.Candidates("name", OpContains, "report"); len(ids) != 0 {
+		t.Errorf("替换和移除后的候选不正确: %v", ids)
+	}
+	if ids, _ := ti.Candidates("other", OpContains, "report"); len(ids) != 0 {
+		t.Errorf("未索引的字段不应有候选: %v", ids)
+	}
+}
+
+// TestQueryServiceTrigram 测试查询服务的contains和matches条件使用三元组索引后结果不变
+func TestQueryServiceTrigram(t *testing.T) {
+	qs := NewQueryService(nil)
+	for i := 1; i <= 200; i++ {
+		if err := qs.IndexBlockAttributes(uint32(i), map[string]string{"path": fmt.Sprintf("/data/%s/file-%03d.bin", []string{"alpha", "beta", "gamma"}[i%3], i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := qs.IndexBlockValues(7, map[string]interface{}{"path": "/override/seven.txt", "pages": int64(1234)}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query string
+		want  []uint32
+	}{
+		{"path contains file-01", []uint32{10, 11, 12, 13, 14, 15, 16, 17, 18, 19}},
+		{`path matches ^/data/gamma/file-1[0-2]0\.bin$`, []uint32{110}},
+		{"path matches seven|file-200", []uint32{7, 200}},
+		{"path contains file-007", nil},
+		{"pages contains 123", []uint32{7}},
+		{"path matches (?i)SEVEN", []uint32{7}},
+	}
+	for _, tt := range tests {
+		result, err := qs.Query(tt.query)
+		if err != nil {
+			t.Errorf("查询 %q 失败: %v", tt.query, err)
+			continue
+		}
+		if len(result.IDs) != len(tt.want) || (len(tt.want) > 0 && !reflect.DeepEqual(result.IDs, tt.want)) {
+			t.Errorf("查询 %q 结果不正确: 期望 %v，实际 %v", tt.query, tt.want, result.IDs)
+		}
+	}
+
+	if ids, ok := qs.StringCandidates("path", OpContains, "file-01"); !ok || len(ids) != 10 {
+		t.Errorf("三元组索引应缩小候选范围: %v", ids)
+	}
+
+	// 移除属性后索引同步更新
+	if err := qs.RemoveBlockAttributes(120); err != nil {
+		t.Fatal(err)
+	}
+	if result, _ := qs.Query("path contains alpha/file-120"); len(result.IDs) != 0 {
+		t.Errorf("移除属性后不应再匹配: %v", result.IDs)
+	}
+}
@@ -4,6 +4,10 @@ package index
 import (
 	"sync"
 	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+	"github.com/bpfs/fragmenta/throttle"
+	"github.com/bpfs/fragmenta/vfs"
 )
 
 // IndexConfig 索引配置
@@ -30,6 +34,32 @@ type IndexConfig struct {
 	UpdateInterval int64
 	// 新增: 批量更新阈值
 	BatchThreshold int
+	// MaxQueueSize 异步更新队列（AsyncAddIndex、AsyncRemoveIndex）的最大任务数，0表示不限制
+	MaxQueueSize int
+	// QueueFullPolicy 异步更新队列已满时的处理方式，默认 QueueReject
+	QueueFullPolicy QueueFullPolicy
+	// PriorityAging 低优先级的异步更新等待超过该时间后按等待时间调度，0表示DefaultPriorityAging，负数表示只按优先级调度
+	PriorityAging time.Duration
+	// ExecutionModel 分片索引（OptimizedIndexManager）的执行模型，默认 ExecutionShared
+	ExecutionModel ExecutionModel
+	// ShardCPUs 分片亲和模式下专属协程绑定的CPU，分片i绑定ShardCPUs[i%len(ShardCPUs)]，为空表示不绑定
+	ShardCPUs []int
+	// MailboxSize 分片亲和模式下每个分片邮箱的容量，0表示DefaultMailboxSize
+	MailboxSize int
+	// Throttle 后台优化和重建共享的限速器，nil表示不限速
+	Throttle *throttle.Limiter
+	// QueryCacheSize 分片索引查询结果缓存的条目数，0表示DefaultQueryCacheSize，负数表示禁用
+	QueryCacheSize int
+	// TagFilterFalsePositiveRate 分片索引标签布隆过滤器的目标误判率，过滤器判定标签不存在时查询不扫描分片。
+	// 0表示DefaultTagFilterFalsePositiveRate，负数表示禁用
+	TagFilterFalsePositiveRate float64
+	// TagFilterCapacity 标签布隆过滤器按多少个不同标签分配空间，0表示DefaultTagFilterCapacity，
+	// 标签数超过容量时自动按两倍重建
+	TagFilterCapacity int
+	// Clock 更新时间和后台定时任务使用的时钟，nil表示使用系统时钟
+	Clock clock.Clock
+	// FS 读写索引文件使用的文件系统，nil表示使用操作系统文件系统
+	FS vfs.FS
 }
 
 // IndexStatus 索引状态
@@ -56,8 +86,28 @@ type IndexStatus struct {
 	MemoryUsage int64
 	// 新增: 分片状态
 	ShardStatus []ShardStatus
+	// QueueCapacity 异步更新队列的最大任务数，0表示不限制。队列深度见 PendingUpdates
+	QueueCapacity int
+	// QueuePeakDepth 异步更新队列的最大深度
+	QueuePeakDepth int
+	// QueueLatency 任务从入队到开始处理的平均等待时间
+	QueueLatency time.Duration
+	// QueueMaxLatency 任务从入队到开始处理的最长等待时间
+	QueueMaxLatency time.Duration
+	// RejectedUpdates 队列已满被拒绝的任务数
+	RejectedUpdates int64
 }
 
+// QueueFullPolicy 异步更新队列已满时的处理方式
+type QueueFullPolicy int
+
+const (
+	// QueueReject 返回 ErrQueueFull
+	QueueReject QueueFullPolicy = iota
+	// QueueBlock 阻塞调用者直到队列有空位
+	QueueBlock
+)
+
 // 新增: 分片状态
 type ShardStatus struct {
 	// 分片ID
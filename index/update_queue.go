@@ -0,0 +1,89 @@
+package index
+
+import "time"
+
+// UpdatePriority 异步索引更新的优先级类别，数值越小优先级越高
+type UpdatePriority int
+
+const (
+	// PriorityInteractive 交互操作的更新，AsyncAddIndex和AsyncRemoveIndex使用该类别
+	PriorityInteractive UpdatePriority = iota
+	// PriorityNormal 普通更新
+	PriorityNormal
+	// PriorityBulk 批量导入、重建等大量更新
+	PriorityBulk
+
+	numUpdatePriorities = int(PriorityBulk) + 1
+)
+
+// DefaultPriorityAging 低优先级任务等待超过该时间后不再让位于高优先级任务
+const DefaultPriorityAging = 5 * time.Second
+
+// PriorityUpdater 支持按优先级类别调度异步更新的索引管理器，OptimizedIndexManager实现该接口。
+// 更新总是进入异步更新队列，与 IndexConfig.AsyncUpdate 无关，队列已满时见 IndexConfig.QueueFullPolicy
+type PriorityUpdater interface {
+	// AsyncAddIndexWithPriority 以指定优先级异步添加索引
+	AsyncAddIndexWithPriority(tag uint32, id uint32, priority UpdatePriority) error
+	// AsyncRemoveIndexWithPriority 以指定优先级异步移除索引
+	AsyncRemoveIndexWithPriority(tag uint32, id uint32, priority UpdatePriority) error
+	// BatchAddIndicesWithPriority 以指定优先级异步批量添加索引
+	BatchAddIndicesWithPriority(tags []uint32, ids []uint32, priority UpdatePriority) error
+	// BatchRemoveIndicesWithPriority 以指定优先级异步批量移除索引
+	BatchRemoveIndicesWithPriority(tags []uint32, ids []uint32, priority UpdatePriority) error
+}
+
+// updateQueue 按优先级类别分组的更新队列，每个类别内先进先出
+type updateQueue struct {
+	classes [numUpdatePriorities][]*updateTaskInternal
+	size    int
+}
+
+// Len 返回队列中的任务数
+func (q *updateQueue) Len() int { return q.size }
+
+// push 添加任务，超出范围的优先级归入最近的类别
+func (q *updateQueue) push(task *updateTaskInternal) {
+	class := min(max(task.Priority, 0), numUpdatePriorities-1)
+	q.classes[class] = append(q.classes[class], task)
+	q.size++
+}
+
+// pop 取出下一个任务：等待超过aging的任务中等待最久的优先，防止低优先级任务饿死；
+// 否则取优先级最高的类别中最早的任务。aging不大于0表示只按优先级调度
+func (q *updateQueue) pop(now time.Time, aging time.Duration) *updateTaskInternal {
+	class := -1
+	if aging > 0 {
+		class = q.oldest(now, aging)
+	}
+	for c := 0; class < 0 && c < numUpdatePriorities; c++ {
+		if len(q.classes[c]) > 0 {
+			class = c
+		}
+	}
+	if class < 0 {
+		return nil
+	}
+
+	tasks := q.classes[class]
+	task := tasks[0]
+	tasks[0] = nil
+	q.classes[class] = tasks[1:]
+	q.size--
+	return task
+}
+
+// oldest 返回等待超过aging的类别中队首任务最早的类别
+func (q *updateQueue) oldest(now time.Time, aging time.Duration) int {
+	class := -1
+	for c, tasks := range q.classes {
+		if len(tasks) == 0 || now.Sub(tasks[0].Timestamp) < aging {
+			continue
+		}
+		if class < 0 || tasks[0].Timestamp.Before(q.classes[class][0].Timestamp) {
+			class = c
+		}
+	}
+	return class
+}
+
+var _ PriorityUpdater = (*OptimizedIndexManager)(nil)
@@ -0,0 +1,98 @@
+package index
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// TestUpdateQueueScheduling 测试更新队列按优先级类别调度，并且等待过久的任务不会饿死
+func TestUpdateQueueScheduling(t *testing.T) {
+	start := time.Unix(1000, 0)
+	var q updateQueue
+	push := func(id uint32, priority UpdatePriority, at time.Duration) {
+		q.push(&updateTaskInternal{ID: id, Priority: int(priority), Timestamp: start.Add(at)})
+	}
+	push(1, PriorityBulk, 0)
+	push(2, PriorityBulk, time.Millisecond)
+	push(3, PriorityNormal, 2*time.Millisecond)
+	push(4, PriorityInteractive, 3*time.Millisecond)
+	push(5, PriorityInteractive, 4*time.Millisecond)
+	push(6, UpdatePriority(99), 5*time.Millisecond) // 超出范围归入PriorityBulk
+
+	popAll := func(now time.Time, aging time.Duration) []uint32 {
+		var ids []uint32
+		for task := q.pop(now, aging); task != nil; task = q.pop(now, aging) {
+			ids = append(ids, task.ID)
+		}
+		return ids
+	}
+
+	// 没有任务等待过久时按类别调度，类别内先进先出
+	if got := popAll(start.Add(time.Second), 10*time.Second); !slices.Equal(got, []uint32{4, 5, 3, 1, 2, 6}) {
+		t.Fatalf("调度顺序为%v", got)
+	}
+	if q.Len() != 0 {
+		t.Fatalf("队列长度为%d", q.Len())
+	}
+
+	// 等待超过阈值的低优先级任务先于新的高优先级任务
+	push(1, PriorityBulk, 0)
+	push(2, PriorityInteractive, 9*time.Second)
+	push(3, PriorityBulk, 9*time.Second)
+	if got := popAll(start.Add(10*time.Second), 5*time.Second); !slices.Equal(got, []uint32{1, 2, 3}) {
+		t.Fatalf("防饿死调度顺序为%v", got)
+	}
+}
+
+// TestOptimizedIndexPriorityUpdates 测试按优先级的异步更新
+func TestOptimizedIndexPriorityUpdates(t *testing.T) {
+	im, err := NewOptimizedIndexManager(&IndexConfig{NumShards: 2, MaxWorkers: 1, MaxQueueSize: 4})
+	if err != nil {
+		t.Fatalf("创建索引管理器失败: %v", err)
+	}
+
+	// 拒绝模式下放不下的整批被拒绝
+	if err := im.BatchAddIndicesWithPriority([]uint32{1, 1, 1, 1, 1}, []uint32{1, 2, 3, 4, 5}, PriorityBulk); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("放不下的批量更新应该返回ErrQueueFull，实际为%v", err)
+	}
+	if im.GetPendingTaskCount() != 0 {
+		t.Fatal("被拒绝的批量更新不应该部分入队")
+	}
+
+	if err := im.BatchAddIndicesWithPriority([]uint32{1, 1, 1}, []uint32{1, 2, 3}, PriorityBulk); err != nil {
+		t.Fatalf("批量入队失败: %v", err)
+	}
+	if err := im.AsyncAddIndexWithPriority(2, 9, PriorityInteractive); err != nil {
+		t.Fatalf("入队失败: %v", err)
+	}
+	if err := im.BatchAddIndicesWithPriority([]uint32{1}, []uint32{1, 2}, PriorityBulk); !errors.Is(err, ErrLengthMismatch) {
+		t.Fatalf("长度不匹配时应该返回ErrLengthMismatch，实际为%v", err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for im.GetPendingTaskCount() > 0 || im.GetStatus().ActiveWorkers > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("队列中的任务没有全部处理")
+		}
+		im.processUpdateQueue()
+		time.Sleep(time.Millisecond)
+	}
+	if found, _ := im.FindByTag(1); len(found) != 3 {
+		t.Fatalf("标签1的索引为%v", found)
+	}
+	if found, _ := im.FindByTag(2); !slices.Equal(found, []uint32{9}) {
+		t.Fatalf("标签2的索引为%v", found)
+	}
+
+	if err := im.AsyncRemoveIndexWithPriority(2, 9, PriorityNormal); err != nil {
+		t.Fatalf("入队失败: %v", err)
+	}
+	if err := im.BatchRemoveIndicesWithPriority([]uint32{1}, []uint32{1}, PriorityBulk); err != nil {
+		t.Fatalf("入队失败: %v", err)
+	}
+	if im.GetPendingTaskCount() != 2 {
+		t.Fatalf("待处理任务数为%d", im.GetPendingTaskCount())
+	}
+}
@@ -0,0 +1,614 @@
+package index
+
+import (
+	"container/heap"
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 向量索引相关常量
+const (
+	// DefaultVectorM HNSW每层的最大邻居数（第0层为两倍）
+	DefaultVectorM = 16
+	// DefaultVectorEfConstruction 插入时搜索的候选数
+	DefaultVectorEfConstruction = 200
+	// DefaultVectorEfSearch 查询时搜索的候选数，小于k时取k
+	DefaultVectorEfSearch = 64
+	// DefaultNearK near条件没有指定数量时返回的最近邻个数
+	DefaultNearK = 10
+
+	// maxVectorLevel HNSW的最大层数
+	maxVectorLevel = 16
+)
+
+// VectorMetric 向量距离的度量方式
+type VectorMetric int
+
+const (
+	// MetricCosine 余弦距离（1-余弦相似度），向量在索引和查询时归一化
+	MetricCosine VectorMetric = iota
+	// MetricEuclidean 欧氏距离
+	MetricEuclidean
+)
+
+// VectorConfig 向量索引配置
+type VectorConfig struct {
+	// Dimension 向量维度，0表示由第一个向量决定
+	Dimension int
+	// Metric 距离度量，默认 MetricCosine
+	Metric VectorMetric
+	// M 每层的最大邻居数，0表示DefaultVectorM
+	M int
+	// EfConstruction 插入时搜索的候选数，0表示DefaultVectorEfConstruction
+	EfConstruction int
+	// EfSearch 查询时搜索的候选数，0表示DefaultVectorEfSearch
+	EfSearch int
+}
+
+// VectorMatch 最近邻查询的结果
+type VectorMatch struct {
+	// ID 向量所属的ID
+	ID uint32
+	// Distance 到查询向量的距离，越小越相似
+	Distance float32
+}
+
+// VectorQuery near条件的值
+type VectorQuery struct {
+	// Vector 查询向量
+	Vector []float32
+	// K 返回的最近邻个数
+	K int
+}
+
+// vectorNode HNSW图中的节点
+type vectorNode struct {
+	vector    []float32
+	level     int
+	neighbors [][]uint32 // 每层的邻居
+}
+
+// VectorIndex 向量相似度索引（HNSW近似最近邻），所有方法都可以并发调用。
+// 删除节点时用它的邻居互相补足连接，查询结果是近似的，召回率随EfSearch增大而提高
+type VectorIndex struct {
+	config   VectorConfig
+	nodes    map[uint32]*vectorNode
+	entry    uint32
+	maxLevel int
+	levelMul float64
+	rng      *rand.Rand
+	mutex    sync.RWMutex
+}
+
+// NewVectorIndex 创建向量索引，config为nil时使用默认配置
+func NewVectorIndex(config *VectorConfig) *VectorIndex {
+	var c VectorConfig
+	if config != nil {
+		c = *config
+	}
+	if c.M <= 0 {
+		c.M = DefaultVectorM
+	}
+	if c.EfConstruction <= 0 {
+		c.EfConstruction = DefaultVectorEfConstruction
+	}
+	if c.EfSearch <= 0 {
+		c.EfSearch = DefaultVectorEfSearch
+	}
+	return &VectorIndex{
+		config:   c,
+		nodes:    make(map[uint32]*vectorNode),
+		levelMul: 1 / math.Log(float64(max(c.M, 2))),
+		rng:      rand.New(rand.NewSource(1)),
+	}
+}
+
+// Len 返回已索引的向量数
+func (vi *VectorIndex) Len() int {
+	vi.mutex.RLock()
+	defer vi.mutex.RUnlock()
+	return len(vi.nodes)
+}
+
+// Dimension 返回向量维度，尚未确定时为0
+func (vi *VectorIndex) Dimension() int {
+	vi.mutex.RLock()
+	defer vi.mutex.RUnlock()
+	return vi.config.Dimension
+}
+
+// AddVector 添加或替换ID的向量
+func (vi *VectorIndex) AddVector(id uint32, vector []float32) error {
+	vi.mutex.Lock()
+	defer vi.mutex.Unlock()
+
+	prepared, err := vi.prepare(vector)
+	if err != nil {
+		return err
+	}
+	if vi.config.Dimension == 0 {
+		vi.config.Dimension = len(vector)
+	}
+	vi.removeLocked(id)
+	vi.insertLocked(id, prepared)
+	return nil
+}
+
+// RemoveVector 移除ID的向量，返回是否存在
+func (vi *VectorIndex) RemoveVector(id uint32) bool {
+	vi.mutex.Lock()
+	defer vi.mutex.Unlock()
+	return vi.removeLocked(id)
+}
+
+// FindNearest 返回与vector最相似的k个向量，按距离从近到远排列
+func (vi *VectorIndex) FindNearest(vector []float32, k int) ([]VectorMatch, error) {
+	if k <= 0 {
+		return nil, fmt.Errorf("%w: 最近邻个数必须大于0", ErrInvalidValue)
+	}
+
+	vi.mutex.RLock()
+	defer vi.mutex.RUnlock()
+
+	query, err := vi.prepare(vector)
+	if err != nil {
+		return nil, err
+	}
+	if len(vi.nodes) == 0 {
+		return nil, nil
+	}
+
+	entry := []uint32{vi.entry}
+	for level := vi.maxLevel; level > 0; level-- {
+		entry = []uint32{vi.searchLayer(query, entry, 1, level)[0].ID}
+	}
+	matches := vi.searchLayer(query, entry, max(vi.config.EfSearch, k), 0)
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches, nil
+}
+
+// prepare 检查向量的维度和取值，余弦度量下返回归一化的副本
+func (vi *VectorIndex) prepare(vector []float32) ([]float32, error) {
+	if len(vector) == 0 {
+		return nil, fmt.Errorf("%w: 向量不能为空", ErrInvalidValue)
+	}
+	if vi.config.Dimension != 0 && len(vector) != vi.config.Dimension {
+		return nil, fmt.Errorf("%w: 向量维度为%d，索引维度为%d", ErrInvalidValue, len(vector), vi.config.Dimension)
+	}
+
+	var norm float64
+	for _, v := range vector {
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return nil, fmt.Errorf("%w: 向量包含NaN或无穷大", ErrInvalidValue)
+		}
+		norm += float64(v) * float64(v)
+	}
+
+	prepared := slices.Clone(vector)
+	if vi.config.Metric == MetricCosine {
+		if norm == 0 {
+			return nil, fmt.Errorf("%w: 余弦度量下向量不能为零向量", ErrInvalidValue)
+		}
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range prepared {
+			prepared[i] *= scale
+		}
+	}
+	return prepared, nil
+}
+
+// distance 返回两个已准备好的向量之间的距离
+func (vi *VectorIndex) distance(a, b []float32) float32 {
+	return vectorDistance(vi.config.Metric, a, b)
+}
+
+// vectorDistance 按度量计算距离，余弦度量要求两个向量已归一化
+func vectorDistance(metric VectorMetric, a, b []float32) float32 {
+	var sum float32
+	if metric == MetricCosine {
+		for i := range a {
+			sum += a[i] * b[i]
+		}
+		return 1 - sum
+	}
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return float32(math.Sqrt(float64(sum)))
+}
+
+// maxNeighbors 返回某层的最大邻居数
+func (vi *VectorIndex) maxNeighbors(level int) int {
+	if level == 0 {
+		return 2 * vi.config.M
+	}
+	return vi.config.M
+}
+
+// randomLevel 按指数分布随机选择新节点的层数
+func (vi *VectorIndex) randomLevel() int {
+	level := int(-math.Log(1-vi.rng.Float64()) * vi.levelMul)
+	return min(level, maxVectorLevel)
+}
+
+// insertLocked 把节点插入图中（调用者持有写锁）
+func (vi *VectorIndex) insertLocked(id uint32, vector []float32) {
+	level := vi.randomLevel()
+	node := &vectorNode{vector: vector, level: level, neighbors: make([][]uint32, level+1)}
+	if len(vi.nodes) == 0 {
+		vi.nodes[id] = node
+		vi.entry = id
+		vi.maxLevel = level
+		return
+	}
+
+	// 从最高层贪心下降到新节点的层数
+	entry := []uint32{vi.entry}
+	for l := vi.maxLevel; l > level; l-- {
+		entry = []uint32{vi.searchLayer(vector, entry, 1, l)[0].ID}
+	}
+
+	// 在新节点的各层选择最近的邻居并建立双向连接
+	for l := min(level, vi.maxLevel); l >= 0; l-- {
+		found := vi.searchLayer(vector, entry, vi.config.EfConstruction, l)
+		neighbors := make([]uint32, 0, vi.config.M)
+		for _, match := range found[:min(len(found), vi.config.M)] {
+			neighbors = append(neighbors, match.ID)
+		}
+		node.neighbors[l] = neighbors
+		for _, neighbor := range neighbors {
+			vi.connect(neighbor, id, vector, l)
+		}
+
+		entry = entry[:0]
+		for _, match := range found {
+			entry = append(entry, match.ID)
+		}
+	}
+
+	vi.nodes[id] = node
+	if level > vi.maxLevel {
+		vi.entry = id
+		vi.maxLevel = level
+	}
+}
+
+// connect 添加from到to的连接，超过最大邻居数时只保留最近的邻居
+func (vi *VectorIndex) connect(from, to uint32, toVector []float32, level int) {
+	node := vi.nodes[from]
+	node.neighbors[level] = append(node.neighbors[level], to)
+	if len(node.neighbors[level]) > vi.maxNeighbors(level) {
+		vi.prune(node, level, map[uint32][]float32{to: toVector})
+	}
+}
+
+// prune 按到节点的距离保留最近的邻居，extra是尚未加入图中的节点的向量
+func (vi *VectorIndex) prune(node *vectorNode, level int, extra map[uint32][]float32) {
+	matches := make([]VectorMatch, 0, len(node.neighbors[level]))
+	for _, id := range node.neighbors[level] {
+		vector, ok := extra[id]
+		if !ok {
+			neighbor, exists := vi.nodes[id]
+			if !exists {
+				continue
+			}
+			vector = neighbor.vector
+		}
+		matches = append(matches, VectorMatch{ID: id, Distance: vi.distance(node.vector, vector)})
+	}
+	sortMatches(matches)
+
+	kept := node.neighbors[level][:0]
+	for _, match := range matches[:min(len(matches), vi.maxNeighbors(level))] {
+		kept = append(kept, match.ID)
+	}
+	node.neighbors[level] = kept
+}
+
+// removeLocked 从图中移除节点，用它的邻居互相补足被删除的连接（调用者持有写锁）
+func (vi *VectorIndex) removeLocked(id uint32) bool {
+	node, ok := vi.nodes[id]
+	if !ok {
+		return false
+	}
+	delete(vi.nodes, id)
+
+	for l, neighbors := range node.neighbors {
+		for _, neighborID := range neighbors {
+			neighbor, ok := vi.nodes[neighborID]
+			if !ok || neighbor.level < l {
+				continue
+			}
+			merged := slices.DeleteFunc(neighbor.neighbors[l], func(n uint32) bool { return n == id })
+			for _, other := range neighbors {
+				if other == neighborID || slices.Contains(merged, other) {
+					continue
+				}
+				if candidate, ok := vi.nodes[other]; ok && candidate.level >= l {
+					merged = append(merged, other)
+				}
+			}
+			neighbor.neighbors[l] = merged
+			if len(merged) > vi.maxNeighbors(l) {
+				vi.prune(neighbor, l, nil)
+			}
+		}
+	}
+
+	// 入口被删除时选择层数最高的节点作为新入口
+	if vi.entry == id {
+		vi.maxLevel = 0
+		first := true
+		for candidateID, candidate := range vi.nodes {
+			if first || candidate.level > vi.maxLevel || candidate.level == vi.maxLevel && candidateID < vi.entry {
+				vi.entry = candidateID
+				vi.maxLevel = candidate.level
+				first = false
+			}
+		}
+	}
+	return true
+}
+
+// searchLayer 在一层中从入口出发搜索最近的ef个节点，按距离从近到远返回
+func (vi *VectorIndex) searchLayer(query []float32, entries []uint32, ef, level int) []VectorMatch {
+	visited := make(map[uint32]struct{}, ef*4)
+	candidates := &matchHeap{}
+	results := &matchHeap{farthest: true}
+	for _, id := range entries {
+		node, ok := vi.nodes[id]
+		if !ok {
+			continue
+		}
+		visited[id] = struct{}{}
+		match := VectorMatch{ID: id, Distance: vi.distance(query, node.vector)}
+		heap.Push(candidates, match)
+		heap.Push(results, match)
+	}
+
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(VectorMatch)
+		if results.Len() >= ef && current.Distance > results.items[0].Distance {
+			break
+		}
+		for _, neighborID := range vi.nodes[current.ID].neighbors[level] {
+			if _, seen := visited[neighborID]; seen {
+				continue
+			}
+			visited[neighborID] = struct{}{}
+			neighbor, ok := vi.nodes[neighborID]
+			if !ok {
+				continue
+			}
+			distance := vi.distance(query, neighbor.vector)
+			if results.Len() < ef || distance < results.items[0].Distance {
+				match := VectorMatch{ID: neighborID, Distance: distance}
+				heap.Push(candidates, match)
+				heap.Push(results, match)
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	matches := results.items
+	sortMatches(matches)
+	return matches
+}
+
+// sortMatches 按距离从近到远排序，距离相同时按ID排序
+func sortMatches(matches []VectorMatch) {
+	sort.Slice(matches, func(i, j int) bool { return matches[i].less(matches[j]) })
+}
+
+// less 距离更近，距离相同时ID更小
+func (m VectorMatch) less(other VectorMatch) bool {
+	if m.Distance != other.Distance {
+		return m.Distance < other.Distance
+	}
+	return m.ID < other.ID
+}
+
+// matchHeap 按距离排序的堆，farthest为true时堆顶是最远的
+type matchHeap struct {
+	items    []VectorMatch
+	farthest bool
+}
+
+func (h *matchHeap) Len() int { return len(h.items) }
+
+func (h *matchHeap) Less(i, j int) bool {
+	if h.farthest {
+		return h.items[j].less(h.items[i])
+	}
+	return h.items[i].less(h.items[j])
+}
+
+func (h *matchHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *matchHeap) Push(x interface{}) { h.items = append(h.items, x.(VectorMatch)) }
+
+func (h *matchHeap) Pop() interface{} {
+	item := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return item
+}
+
+// VectorFields 按字段组织的向量索引，每个字段一个 VectorIndex
+type VectorFields struct {
+	// config 新字段的索引配置
+	config VectorConfig
+	// fields 字段到向量索引的映射
+	fields map[string]*VectorIndex
+	// blocks 块ID到其已索引向量字段的映射，用于替换和删除
+	blocks map[uint32][]string
+	// mutex 并发保护
+	mutex sync.RWMutex
+}
+
+// NewVectorFields 创建按字段组织的向量索引，config为nil时使用默认配置
+func NewVectorFields(config *VectorConfig) *VectorFields {
+	vf := &VectorFields{
+		fields: make(map[string]*VectorIndex),
+		blocks: make(map[uint32][]string),
+	}
+	if config != nil {
+		vf.config = *config
+	}
+	return vf
+}
+
+// IndexBlockVectors 索引块的向量字段，替换该块之前的所有向量。维度与字段不一致或取值无效的向量不被索引
+func (vf *VectorFields) IndexBlockVectors(blockID uint32, vectors map[string][]float32) {
+	vf.mutex.Lock()
+	defer vf.mutex.Unlock()
+
+	vf.removeLocked(blockID)
+	var fields []string
+	for field, vector := range vectors {
+		index, ok := vf.fields[field]
+		if !ok {
+			index = NewVectorIndex(&vf.config)
+			vf.fields[field] = index
+		}
+		if err := index.AddVector(blockID, vector); err != nil {
+			logger.Error("索引向量失败", "block", blockID, "field", field, "error", err)
+			continue
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) > 0 {
+		vf.blocks[blockID] = fields
+	}
+}
+
+// RemoveBlock 移除块的所有向量
+func (vf *VectorFields) RemoveBlock(blockID uint32) {
+	vf.mutex.Lock()
+	defer vf.mutex.Unlock()
+	vf.removeLocked(blockID)
+}
+
+// removeLocked 移除块的所有向量（调用方需持有写锁）
+func (vf *VectorFields) removeLocked(blockID uint32) {
+	for _, field := range vf.blocks[blockID] {
+		vf.fields[field].RemoveVector(blockID)
+	}
+	delete(vf.blocks, blockID)
+}
+
+// Field 返回字段的向量索引，字段没有向量时返回nil
+func (vf *VectorFields) Field(field string) *VectorIndex {
+	vf.mutex.RLock()
+	defer vf.mutex.RUnlock()
+	return vf.fields[field]
+}
+
+// Nearest 返回字段中与vector最相似的k个块，字段没有向量时返回空结果
+func (vf *VectorFields) Nearest(field string, vector []float32, k int) ([]VectorMatch, error) {
+	index := vf.Field(field)
+	if index == nil {
+		if k <= 0 {
+			return nil, fmt.Errorf("%w: 最近邻个数必须大于0", ErrInvalidValue)
+		}
+		return nil, nil
+	}
+	return index.FindNearest(vector, k)
+}
+
+// toVector 把字段值转换为向量，支持[]float32和[]float64
+func toVector(value interface{}) ([]float32, bool) {
+	switch v := value.(type) {
+	case []float32:
+		return v, len(v) > 0
+	case []float64:
+		vector := make([]float32, len(v))
+		for i, x := range v {
+			vector[i] = float32(x)
+		}
+		return vector, len(v) > 0
+	}
+	return nil, false
+}
+
+// nearOperatorPattern 最近邻操作符的查询语法，如 embedding near [0.12, -0.5, 0.33] 5，
+// 数量省略时为DefaultNearK
+var nearOperatorPattern = regexp.MustCompile(`^(\S+)\s+near\s+\[([^\]]*)\]\s*(\d+)?$`)
+
+// parseNearCondition 解析最近邻条件
+func parseNearCondition(field, vectorStr, kStr string) (*QueryCondition, error) {
+	var vector []float32
+	for _, part := range strings.Split(vectorStr, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: 无效的向量分量%q", ErrSyntaxError, part)
+		}
+		vector = append(vector, float32(v))
+	}
+
+	k := DefaultNearK
+	if kStr != "" {
+		n, err := strconv.Atoi(kStr)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("%w: 无效的最近邻个数%q", ErrSyntaxError, kStr)
+		}
+		k = n
+	}
+
+	return &QueryCondition{
+		Field:     field,
+		FieldType: TypeVector,
+		Operator:  OpNear,
+		Value:     VectorQuery{Vector: vector, K: k},
+	}, nil
+}
+
+// bruteForceNearest 逐个比较字段值中的向量（余弦距离），用于元数据提供器没有向量索引的情况
+func bruteForceNearest(provider MetadataProvider, field string, query VectorQuery) ([]VectorMatch, error) {
+	index := NewVectorIndex(nil)
+	normalized, err := index.prepare(query.Vector)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := provider.GetAllIDs()
+	if err != nil {
+		return nil, err
+	}
+	var matches []VectorMatch
+	for _, id := range ids {
+		metadata, err := provider.GetMetadataForID(id)
+		if err != nil {
+			if err == ErrMetadataNotFound {
+				continue
+			}
+			return nil, err
+		}
+		vector, ok := toVector(metadata[field])
+		if !ok || len(vector) != len(normalized) {
+			continue
+		}
+		prepared, err := index.prepare(vector)
+		if err != nil {
+			continue
+		}
+		matches = append(matches, VectorMatch{ID: id, Distance: vectorDistance(MetricCosine, normalized, prepared)})
+	}
+
+	sortMatches(matches)
+	if len(matches) > query.K {
+		matches = matches[:query.K]
+	}
+	return matches, nil
+}
@@ -0,0 +1,168 @@
+package index
+
+import (
+	"cmp"
+	"errors"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// randomVectors 生成可复现的随机向量
+func randomVectors(n, dim int, seed int64) [][]float32 {
+	rng := rand.New(rand.NewSource(seed))
+	vectors := make([][]float32, n)
+	for i := range vectors {
+		vectors[i] = make([]float32, dim)
+		for j := range vectors[i] {
+			vectors[i][j] = rng.Float32()*2 - 1
+		}
+	}
+	return vectors
+}
+
+// exactNearest 逐个比较返回最近的k个ID
+func exactNearest(metric VectorMetric, vectors map[uint32][]float32, query []float32, k int) []uint32 {
+	index := NewVectorIndex(&VectorConfig{Metric: metric})
+	q, _ := index.prepare(query)
+	var matches []VectorMatch
+	for id, vector := range vectors {
+		v, _ := index.prepare(vector)
+		matches = append(matches, VectorMatch{ID: id, Distance: vectorDistance(metric, q, v)})
+	}
+	sortMatches(matches)
+	ids := make([]uint32, 0, k)
+	for _, match := range matches[:k] {
+		ids = append(ids, match.ID)
+	}
+	return ids
+}
+
+// TestVectorIndex 测试HNSW索引的召回率、替换、删除和参数检查
+func TestVectorIndex(t *testing.T) {
+	for _, metric := range []VectorMetric{MetricCosine, MetricEuclidean} {
+		index := NewVectorIndex(&VectorConfig{Metric: metric})
+		vectors := make(map[uint32][]float32)
+		for i, vector := range randomVectors(1000, 16, 1) {
+			vectors[uint32(i)] = vector
+			if err := index.AddVector(uint32(i), vector); err != nil {
+				t.Fatalf("添加向量失败: %v", err)
+			}
+		}
+
+		// 删除一部分向量后仍然只返回存在的向量
+		for id := uint32(0); id < 1000; id += 3 {
+			if !index.RemoveVector(id) {
+				t.Fatalf("删除向量%d失败", id)
+			}
+			delete(vectors, id)
+		}
+		if index.Len() != len(vectors) {
+			t.Fatalf("向量数为%d，期望%d", index.Len(), len(vectors))
+		}
+
+		const k = 10
+		hits, total := 0, 0
+		for _, query := range randomVectors(50, 16, 2) {
+			matches, err := index.FindNearest(query, k)
+			if err != nil {
+				t.Fatalf("查询失败: %v", err)
+			}
+			if len(matches) != k || !slices.IsSortedFunc(matches, func(a, b VectorMatch) int { return cmp.Compare(a.Distance, b.Distance) }) {
+				t.Fatalf("结果数量或顺序不正确: %v", matches)
+			}
+			exact := exactNearest(metric, vectors, query, k)
+			for _, match := range matches {
+				if _, ok := vectors[match.ID]; !ok {
+					t.Fatalf("返回了已删除的向量%d", match.ID)
+				}
+				if slices.Contains(exact, match.ID) {
+					hits++
+				}
+			}
+			total += k
+		}
+		if recall := float64(hits) / float64(total); recall < 0.9 {
+			t.Errorf("度量%d的召回率为%.2f", metric, recall)
+		}
+	}
+
+	index := NewVectorIndex(nil)
+	if matches, err := index.FindNearest([]float32{1, 0}, 1); err != nil || matches != nil {
+		t.Fatalf("空索引应返回空结果: %v, %v", matches, err)
+	}
+	index.AddVector(1, []float32{1, 0})
+	index.AddVector(2, []float32{0, 1})
+	index.AddVector(1, []float32{0, -1}) // 替换
+	if matches, _ := index.FindNearest([]float32{0, -2}, 1); len(matches) != 1 || matches[0].ID != 1 {
+		t.Fatalf("替换后的查询结果不正确: %v", matches)
+	}
+	if index.Dimension() != 2 {
+		t.Fatalf("维度为%d", index.Dimension())
+	}
+	for _, bad := range [][]float32{{1, 2, 3}, {0, 0}, nil} {
+		if err := index.AddVector(3, bad); !errors.Is(err, ErrInvalidValue) {
+			t.Errorf("无效向量%v应返回ErrInvalidValue: %v", bad, err)
+		}
+	}
+	if _, err := index.FindNearest([]float32{1, 0}, 0); !errors.Is(err, ErrInvalidValue) {
+		t.Errorf("k为0应返回ErrInvalidValue: %v", err)
+	}
+}
+
+// TestNearCondition 测试查询执行器和查询服务的near条件
+func TestNearCondition(t *testing.T) {
+	vectors := map[uint32][]float32{1: {1, 0.1, 0}, 2: {0.9, 0.3, 0}, 3: {0, 0.1, 1}, 4: {0, 1, 0.1}}
+
+	// 没有向量索引的元数据提供器逐个比较
+	provider := NewMockMetadataProvider()
+	service := NewQueryService(nil)
+	for id, vector := range vectors {
+		kind := "animal"
+		if id > 2 {
+			kind = "other"
+		}
+		provider.AddMetadata(id, map[string]interface{}{"embedding": vector, "kind": kind})
+		service.IndexBlockValues(id, map[string]interface{}{"embedding": vector, "kind": kind})
+	}
+	executor := NewQueryExecutorWithMetadataProvider(nil, provider)
+
+	tests := []struct {
+		query string
+		want  []uint32
+	}{
+		{"embedding near [1, 0.2, 0] 2", []uint32{1, 2}},
+		{"embedding near [0, 0, 1]", []uint32{3, 4, 1, 2}},
+		{"embedding near [0, 0.1, 1] 3 and kind==other", []uint32{3, 4}},
+	}
+	for _, tt := range tests {
+		query, err := executor.ParseQueryString(tt.query)
+		if err != nil {
+			t.Fatalf("解析 %q 失败: %v", tt.query, err)
+		}
+		result, err := executor.Execute(query)
+		if err != nil || !slices.Equal(result.IDs, tt.want) {
+			t.Errorf("执行器查询 %q 结果为%v（%v），期望%v", tt.query, result, err, tt.want)
+		}
+
+		result, err = service.Query(tt.query)
+		if err != nil || !slices.Equal(result.IDs, tt.want) {
+			t.Errorf("查询服务查询 %q 结果为%v（%v），期望%v", tt.query, result, err, tt.want)
+		}
+	}
+
+	// 删除块后不再返回
+	service.RemoveBlock(1)
+	if result, _ := service.Query("embedding near [1, 0.2, 0] 1"); !slices.Equal(result.IDs, []uint32{2}) {
+		t.Errorf("删除块后的查询结果为%v", result.IDs)
+	}
+	if service.Vectors().Field("embedding").Len() != 3 {
+		t.Errorf("删除块后向量数不正确")
+	}
+
+	for _, bad := range []string{"embedding near [1, x] 2", "embedding near [1, 0] 0"} {
+		if _, err := service.Query(bad); !errors.Is(err, ErrSyntaxError) {
+			t.Errorf("查询 %q 应返回ErrSyntaxError: %v", bad, err)
+		}
+	}
+}
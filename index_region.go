@@ -0,0 +1,132 @@
+package fragmenta
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"sort"
+)
+
+// 索引区常量
+const (
+	// IndexRegionMagic 索引区魔数 "FIDX"
+	IndexRegionMagic uint32 = 0x46494458
+	// IndexRegionVersion 索引区版本
+	IndexRegionVersion uint16 = 1
+
+	// IndexSectionMerkle 索引区中的Merkle树叶子哈希（见 GetRootHash）
+	IndexSectionMerkle uint16 = 0x0001
+)
+
+// 索引区紧跟在元数据区之后，提交时与元数据区一起重写（位置和大小记录在文件头的IndexOffset和IndexSize中）。
+// 索引区只保存可以由块数据重新计算的内容：块区增长时新块会覆盖旧的索引区，
+// 因此打开文件时立即读入，校验失败时丢弃并在使用时重新计算。
+// 格式: 魔数 | 版本 | 段数量 | 段(类型 | 长度 | 数据)... | CRC32
+
+// loadIndexRegion 打开文件时读取索引区中的各段，索引区无效时返回nil
+func (f *FragmentaImpl) loadIndexRegion() map[uint16][]byte {
+	if f.header.IndexSize == 0 {
+		return nil
+	}
+
+	region := make([]byte, f.header.IndexSize)
+	if _, err := f.file.ReadAt(region, int64(f.header.IndexOffset)); err != nil {
+		logger.Warn("读取索引区失败，将重新计算", "offset", f.header.IndexOffset, "error", err)
+		return nil
+	}
+	sections, err := decodeIndexRegion(region)
+	if err != nil {
+		logger.Warn("索引区无效，将重新计算", "offset", f.header.IndexOffset, "error", err)
+		return nil
+	}
+	return sections
+}
+
+// flushIndexRegion 在元数据区之后重写索引区，在提交时刷新元数据后调用
+func (f *FragmentaImpl) flushIndexRegion() error {
+	end := f.header.MetadataOffset + f.header.MetadataSize
+	dirty := f.merkleDirty()
+	if !dirty && (f.header.IndexSize == 0 || f.header.IndexOffset == end) {
+		return nil
+	}
+
+	sections := make(map[uint16][]byte)
+	if section := f.encodeMerkleSection(); section != nil {
+		sections[IndexSectionMerkle] = section
+	}
+	if len(sections) == 0 {
+		f.header.IndexOffset = 0
+		f.header.IndexSize = 0
+		return nil
+	}
+
+	region := encodeIndexRegion(sections)
+	if _, err := f.file.WriteAt(region, int64(end)); err != nil {
+		logger.Error("写入索引区失败", "offset", end, "error", err)
+		return err
+	}
+	f.header.IndexOffset = end
+	f.header.IndexSize = uint64(len(region))
+	if end+f.header.IndexSize > f.header.TotalSize {
+		f.header.TotalSize = end + f.header.IndexSize
+	}
+	f.merkleFlushed()
+	return nil
+}
+
+// encodeIndexRegion 编码索引区
+func encodeIndexRegion(sections map[uint16][]byte) []byte {
+	types := make([]uint16, 0, len(sections))
+	size := 8 + 4
+	for sectionType, data := range sections {
+		types = append(types, sectionType)
+		size += 6 + len(data)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+
+	buf := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(buf, IndexRegionMagic)
+	binary.BigEndian.PutUint16(buf[4:], IndexRegionVersion)
+	binary.BigEndian.PutUint16(buf[6:], uint16(len(types)))
+	for _, sectionType := range types {
+		buf = binary.BigEndian.AppendUint16(buf, sectionType)
+		buf = binary.BigEndian.AppendUint32(buf, uint32(len(sections[sectionType])))
+		buf = append(buf, sections[sectionType]...)
+	}
+	return binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(buf))
+}
+
+// decodeIndexRegion 解析索引区，忽略不认识的段
+func decodeIndexRegion(region []byte) (map[uint16][]byte, error) {
+	if len(region) < 12 {
+		return nil, fmt.Errorf("%w: 索引区不完整", ErrInvalidFragmenta)
+	}
+	body := region[:len(region)-4]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(region[len(body):]) {
+		return nil, fmt.Errorf("%w: 索引区校验和不匹配", ErrInvalidFragmenta)
+	}
+	if binary.BigEndian.Uint32(body) != IndexRegionMagic {
+		return nil, fmt.Errorf("%w: 索引区魔数错误", ErrInvalidFragmenta)
+	}
+	if binary.BigEndian.Uint16(body[4:]) > IndexRegionVersion {
+		return nil, ErrUnsupportedVersion
+	}
+
+	count := int(binary.BigEndian.Uint16(body[6:]))
+	sections := make(map[uint16][]byte, count)
+	rest := body[8:]
+	for i := 0; i < count; i++ {
+		if len(rest) < 6 {
+			return nil, fmt.Errorf("%w: 索引区段不完整", ErrInvalidFragmenta)
+		}
+		sectionType := binary.BigEndian.Uint16(rest)
+		size := binary.BigEndian.Uint32(rest[2:])
+		rest = rest[6:]
+		if uint64(size) > uint64(len(rest)) {
+			return nil, fmt.Errorf("%w: 索引区段不完整", ErrInvalidFragmenta)
+		}
+		sections[sectionType] = rest[:size]
+		rest = rest[size:]
+	}
+	return sections, nil
+}
@@ -0,0 +1,325 @@
+package fragmenta
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// InspectReport 存储文件的检查报告，可直接序列化为JSON，用于批量审计
+type InspectReport struct {
+	Path        string           `json:"path"`
+	FileSize    int64            `json:"fileSize"`
+	InspectedAt time.Time        `json:"inspectedAt"`
+	Header      HeaderReport     `json:"header"`
+	Regions     []RegionReport   `json:"regions"`
+	Metadata    MetadataReport   `json:"metadata"`
+	Blocks      BlockReport      `json:"blocks"`
+	Index       IndexReport      `json:"index"`
+	Encryption  EncryptionReport `json:"encryption"`
+	Problems    []string         `json:"problems"` // 发现的结构问题，为空表示未发现问题
+}
+
+// HeaderReport 文件头字段
+type HeaderReport struct {
+	Magic            string    `json:"magic"`
+	Version          string    `json:"version"`
+	Flags            uint16    `json:"flags"`
+	StorageMode      string    `json:"storageMode"`
+	Created          time.Time `json:"created"`
+	LastModified     time.Time `json:"lastModified"`
+	TotalSize        uint64    `json:"totalSize"`
+	UserDefinedID    string    `json:"userDefinedId,omitempty"`
+	Generation       uint64    `json:"generation"`
+	ShadowHeader     bool      `json:"shadowHeader"`               // 文件保留了影子文件头
+	Deterministic    bool      `json:"deterministic,omitempty"`    // 文件以确定性模式创建
+	ContentAddressed bool      `json:"contentAddressed,omitempty"` // 文件以内容寻址模式创建
+	Recovered        bool      `json:"recovered"`                  // 主文件头无效或过期，报告来自影子文件头
+}
+
+// RegionReport 文件中的一个区域
+type RegionReport struct {
+	Name   string `json:"name"`
+	Offset uint64 `json:"offset"`
+	Size   uint64 `json:"size"`
+}
+
+// MetadataReport 元数据统计
+type MetadataReport struct {
+	Count      int `json:"count"`
+	SystemTags int `json:"systemTags"`
+	AppTags    int `json:"appTags"`
+	UserTags   int `json:"userTags"`
+	ValueBytes int `json:"valueBytes"`
+}
+
+// BlockReport 数据块统计
+type BlockReport struct {
+	Count       int               `json:"count"`
+	DataBytes   uint64            `json:"dataBytes"`
+	Chained     int               `json:"chained"` // 属于块链的块数
+	Checksummed int               `json:"checksummed"`
+	Compressed  int               `json:"compressed"`
+	ByType      map[string]int    `json:"byType"`
+	ByTier      map[string]int    `json:"byTier"`
+	BySize      []HistogramBucket `json:"bySize"`
+}
+
+// HistogramBucket 块大小直方图中的一个区间，包含大小不超过UpperBound的块，最后一个区间UpperBound为0表示无上限
+type HistogramBucket struct {
+	UpperBound uint64 `json:"upperBound"`
+	Count      int    `json:"count"`
+	Bytes      uint64 `json:"bytes"`
+}
+
+// IndexReport 索引区位置。VerifyIndices 尚未实现，在此之前不报告索引条目数和完整性
+type IndexReport struct {
+	Offset uint64 `json:"offset"`
+	Size   uint64 `json:"size"`
+}
+
+// EncryptionReport 加密状态，块数据是否加密以块头为准
+type EncryptionReport struct {
+	// EncryptionFlag 文件头中的 FeatureEncryption 标志，只是应用的声明，不表示块数据已加密
+	EncryptionFlag  bool `json:"encryptionFlag"`
+	EncryptedBlocks int  `json:"encryptedBlocks"`
+	PlainBlocks     int  `json:"plainBlocks"`
+}
+
+// 块层级，按块大小划分：不超过InlineBlockThreshold为inline，不超过DefaultBlockSize为standard，其余为large
+const (
+	TierInline   = "inline"
+	TierStandard = "standard"
+	TierLarge    = "large"
+)
+
+// sizeBuckets 块大小直方图的区间上界
+var sizeBuckets = []uint64{64, 512, 4 << 10, 64 << 10, 1 << 20, 16 << 20}
+
+// Inspect 只读检查存储文件并生成报告
+// 结构问题（区域越界、重叠等）记录在报告的Problems中，只有文件无法打开时返回错误
+func Inspect(path string) (*InspectReport, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &FragmentaImpl{
+		path:          path,
+		file:          file,
+		isOpen:        true,
+		readOnly:      true,
+		metadataCache: make(map[uint16][]byte),
+		blockCache:    make(map[uint32][]byte),
+	}
+	defer file.Close()
+
+	if err := f.readHeader(); err != nil {
+		return nil, fmt.Errorf("读取文件头失败: %w", err)
+	}
+	if err := f.validateHeader(); err != nil {
+		return nil, fmt.Errorf("验证文件头失败: %w", err)
+	}
+	if err := f.initializeComponents(); err != nil {
+		return nil, fmt.Errorf("初始化组件失败: %w", err)
+	}
+
+	report := &InspectReport{
+		Path:        path,
+		FileSize:    stat.Size(),
+		InspectedAt: time.Now(),
+		Problems:    []string{},
+	}
+	report.inspectHeader(&f.header)
+	if f.headerRecovered {
+		report.Header.Recovered = true
+		report.problem("主文件头无效或已过期，已使用影子文件头")
+	} else if report.Header.ShadowHeader {
+		if _, err := f.readHeaderSlot(ShadowHeaderOffset); err != nil {
+			report.problem("影子文件头无效: %v", err)
+		}
+	}
+
+	metadata, err := f.ListMetadata()
+	if err != nil {
+		report.problem("读取元数据失败: %v", err)
+	}
+	report.inspectMetadata(metadata)
+
+	blocks, err := f.ListBlocks()
+	if err != nil {
+		report.problem("列出数据块失败: %v", err)
+	}
+	report.inspectBlocks(blocks)
+
+	return report, nil
+}
+
+// inspectHeader 记录文件头字段和区域，并检查区域是否越界或重叠
+func (r *InspectReport) inspectHeader(h *FragmentaHeader) {
+	r.Header = HeaderReport{
+		Magic:            fmt.Sprintf("0x%08X", h.Magic),
+		Version:          versionString(h.Version),
+		Flags:            h.Flags,
+		StorageMode:      storageModeName(h.StorageMode),
+		Created:          time.Unix(0, h.Timestamp),
+		LastModified:     time.Unix(0, h.LastModified),
+		TotalSize:        h.TotalSize,
+		Generation:       h.Generation,
+		ShadowHeader:     h.Flags&FlagShadowHeader != 0,
+		Deterministic:    h.Flags&FlagDeterministic != 0,
+		ContentAddressed: h.Flags&FlagContentAddressed != 0,
+	}
+	if h.UserDefinedID != [16]byte{} {
+		r.Header.UserDefinedID = hex.EncodeToString(h.UserDefinedID[:])
+	}
+
+	headerSize := HeaderSlotSize
+	if r.Header.ShadowHeader {
+		headerSize = HeaderSize
+	}
+	r.Regions = []RegionReport{
+		{Name: "header", Offset: 0, Size: headerSize},
+		{Name: "metadata", Offset: h.MetadataOffset, Size: h.MetadataSize},
+		{Name: "blocks", Offset: h.BlockOffset, Size: h.BlockSize},
+		{Name: "index", Offset: h.IndexOffset, Size: h.IndexSize},
+	}
+	r.Index.Offset = h.IndexOffset
+	r.Index.Size = h.IndexSize
+	r.Encryption.EncryptionFlag = h.Flags&FlagEncrypted != 0
+
+	// 空区域不参与越界和重叠检查
+	used := make([]RegionReport, 0, len(r.Regions))
+	for _, region := range r.Regions {
+		if region.Size == 0 {
+			continue
+		}
+		if end := region.Offset + region.Size; end > uint64(r.FileSize) {
+			r.problem("%s区超出文件末尾: %d > %d", region.Name, end, r.FileSize)
+		}
+		used = append(used, region)
+	}
+	sort.Slice(used, func(i, j int) bool { return used[i].Offset < used[j].Offset })
+	for i := 1; i < len(used); i++ {
+		if prev := used[i-1]; prev.Offset+prev.Size > used[i].Offset {
+			r.problem("%s区与%s区重叠", prev.Name, used[i].Name)
+		}
+	}
+}
+
+// inspectMetadata 统计元数据
+func (r *InspectReport) inspectMetadata(metadata map[uint16][]byte) {
+	for tag, value := range metadata {
+		r.Metadata.Count++
+		r.Metadata.ValueBytes += len(value)
+		switch {
+		case IsSystemTag(tag):
+			r.Metadata.SystemTags++
+		case IsAppTag(tag):
+			r.Metadata.AppTags++
+		default:
+			r.Metadata.UserTags++
+		}
+	}
+}
+
+// inspectBlocks 统计数据块的类型、层级、大小分布和加密状态
+func (r *InspectReport) inspectBlocks(blocks []*BlockHeader) {
+	r.Blocks.ByType = make(map[string]int)
+	r.Blocks.ByTier = make(map[string]int)
+	r.Blocks.BySize = make([]HistogramBucket, len(sizeBuckets)+1)
+	for i, bound := range sizeBuckets {
+		r.Blocks.BySize[i].UpperBound = bound
+	}
+
+	for _, block := range blocks {
+		size := uint64(block.Size)
+		r.Blocks.Count++
+		r.Blocks.DataBytes += size
+		r.Blocks.ByType[blockTypeName(block.BlockType)]++
+		r.Blocks.ByTier[blockTier(block.Size)]++
+
+		bucket := sort.Search(len(sizeBuckets), func(i int) bool { return size <= sizeBuckets[i] })
+		r.Blocks.BySize[bucket].Count++
+		r.Blocks.BySize[bucket].Bytes += size
+
+		if block.PreviousBlock != 0 || block.NextBlock != 0 {
+			r.Blocks.Chained++
+		}
+		if block.Flags&BlockFlagChecksum != 0 {
+			r.Blocks.Checksummed++
+		}
+		if block.Flags&BlockFlagCompressed != 0 {
+			r.Blocks.Compressed++
+		}
+		if block.Flags&BlockFlagEncrypted != 0 || block.BlockType == EncryptedBlockType {
+			r.Encryption.EncryptedBlocks++
+		} else {
+			r.Encryption.PlainBlocks++
+		}
+	}
+}
+
+// problem 记录一个结构问题
+func (r *InspectReport) problem(format string, args ...interface{}) {
+	r.Problems = append(r.Problems, fmt.Sprintf(format, args...))
+}
+
+// blockTier 返回块所属的层级
+func blockTier(size uint32) string {
+	switch {
+	case size <= InlineBlockThreshold:
+		return TierInline
+	case size <= DefaultBlockSize:
+		return TierStandard
+	default:
+		return TierLarge
+	}
+}
+
+// storageModeName 返回存储模式名称
+func storageModeName(mode uint8) string {
+	switch mode {
+	case ContainerMode:
+		return "container"
+	case DirectoryMode:
+		return "directory"
+	case HybridMode:
+		return "hybrid"
+	default:
+		return fmt.Sprintf("unknown(%d)", mode)
+	}
+}
+
+// blockTypeName 返回块类型名称
+func blockTypeName(blockType uint8) string {
+	switch blockType {
+	case NormalBlockType:
+		return "normal"
+	case MetadataBlockType:
+		return "metadata"
+	case IndexBlockType:
+		return "index"
+	case DeltaBlockType:
+		return "delta"
+	case XORBlockType:
+		return "xor"
+	case CompressionBlockType:
+		return "compressed"
+	case EncryptedBlockType:
+		return "encrypted"
+	case IndirectBlockType:
+		return "indirect"
+	case SystemBlockType:
+		return "system"
+	default:
+		return fmt.Sprintf("0x%02X", blockType)
+	}
+}
@@ -0,0 +1,82 @@
+package fragmenta
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestInspect 测试检查报告的内容和JSON序列化
+func TestInspect(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "inspect.frag")
+
+	f, err := CreateFragmenta(path, nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	first, err := f.WriteBlock([]byte("small"), &BlockOptions{Checksum: true})
+	if err != nil {
+		t.Fatalf("写入数据块失败: %v", err)
+	}
+	if _, err := f.WriteBlock(bytes.Repeat([]byte("x"), 2000), &BlockOptions{AppendToBlockID: first}); err != nil {
+		t.Fatalf("写入数据块失败: %v", err)
+	}
+	if _, err := f.WriteBlock(bytes.Repeat([]byte("y"), 10000), &BlockOptions{BlockType: EncryptedBlockType}); err != nil {
+		t.Fatalf("写入数据块失败: %v", err)
+	}
+	if err := f.SetMetadata(UserTag(1), []byte("user")); err != nil {
+		t.Fatalf("设置元数据失败: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+
+	report, err := Inspect(path)
+	if err != nil {
+		t.Fatalf("检查文件失败: %v", err)
+	}
+
+	if report.Header.StorageMode != "container" || report.Header.Version != "1.1" {
+		t.Errorf("文件头不正确: %+v", report.Header)
+	}
+	if len(report.Problems) != 0 {
+		t.Errorf("不应发现结构问题: %v", report.Problems)
+	}
+	if report.Blocks.Count != 3 || report.Blocks.DataBytes != 12005 || report.Blocks.Chained != 2 || report.Blocks.Checksummed != 1 {
+		t.Errorf("块统计不正确: %+v", report.Blocks)
+	}
+	if report.Blocks.ByTier[TierInline] != 1 || report.Blocks.ByTier[TierStandard] != 1 || report.Blocks.ByTier[TierLarge] != 1 {
+		t.Errorf("块层级统计不正确: %v", report.Blocks.ByTier)
+	}
+	if report.Blocks.BySize[0].Count != 1 || report.Blocks.BySize[2].Count != 1 || report.Blocks.BySize[3].Count != 1 {
+		t.Errorf("块大小直方图不正确: %+v", report.Blocks.BySize)
+	}
+	if report.Encryption.EncryptedBlocks != 1 || report.Encryption.PlainBlocks != 2 {
+		t.Errorf("加密状态不正确: %+v", report.Encryption)
+	}
+	if report.Metadata.UserTags != 1 || report.Metadata.SystemTags != 3 {
+		t.Errorf("元数据统计不正确: %+v", report.Metadata)
+	}
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		t.Fatalf("序列化报告失败: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("解析报告失败: %v", err)
+	}
+	if blocks, ok := decoded["blocks"].(map[string]interface{}); !ok || blocks["count"] != float64(3) {
+		t.Errorf("JSON报告不正确: %s", data)
+	}
+
+	// 区域越界
+	if err := os.Truncate(path, report.FileSize-10); err != nil {
+		t.Fatalf("截断文件失败: %v", err)
+	}
+	if report, err := Inspect(path); err != nil || len(report.Problems) == 0 {
+		t.Errorf("截断的文件应报告结构问题: %v, %v", report, err)
+	}
+}
@@ -1,7 +1,13 @@
 package fragmenta
 
 import (
+	"context"
 	"io"
+	"io/fs"
+	"time"
+
+	"github.com/bpfs/fragmenta/index"
+	"github.com/bpfs/fragmenta/storage"
 )
 
 // FragDB 定义了格式的主要接口
@@ -10,6 +16,14 @@ type FragDB interface {
 	Close() error
 	Commit() error
 	GetHeader() *FragmentaHeader
+	IsDeterministic() bool
+	IsContentAddressed() bool
+
+	// 文件头中的用户定义标识和特性标志
+	GetUserDefinedID() [16]byte
+	SetUserDefinedID(id [16]byte) error
+	Features() FeatureFlags
+	SetFeature(flag FeatureFlags, enabled bool) error
 
 	// 元数据操作
 	SetMetadata(tag uint16, value []byte) error
@@ -18,15 +32,128 @@ type FragDB interface {
 	BatchMetadataOp(batch *BatchMetadataOperation) error
 	ListMetadata() (map[uint16][]byte, error)
 
+	// 类型化元数据，按元数据模式校验和编码
+	MetadataSchema() *MetadataSchema
+	SetMetadataString(tag uint16, value string) error
+	GetMetadataString(tag uint16) (string, error)
+	SetMetadataInt64(tag uint16, value int64) error
+	GetMetadataInt64(tag uint16) (int64, error)
+	SetMetadataTime(tag uint16, value time.Time) error
+	GetMetadataTime(tag uint16) (time.Time, error)
+
+	// 元数据历史
+	EnableMetadataHistory(options MetadataHistoryOptions) error
+	DisableMetadataHistory() error
+	GetMetadataAt(tag uint16, t time.Time) ([]byte, error)
+	ListMetadataVersions(tag uint16) ([]MetadataVersion, error)
+
+	// 用户标签分配，名称和标签的对应关系保存在文件中
+	AllocateUserTag(name string) (uint16, error)
+	LookupUserTag(name string) (uint16, bool)
+	UserTags() (map[string]uint16, error)
+
+	// 元数据过期
+	SetMetadataWithTTL(tag uint16, value []byte, ttl time.Duration) error
+	SetMetadataExpiration(tag uint16, expiresAt time.Time) error
+	MetadataExpiration(tag uint16) (time.Time, bool)
+	ExpireMetadata() (int, error)
+	StartMetadataSweeper(interval time.Duration) error
+	StopMetadataSweeper()
+
+	// 回收站，启用后删除的块和元数据可以恢复
+	EnableTrash(options TrashOptions) error
+	DisableTrash() error
+	ListTrash() ([]TrashEntry, error)
+	RestoreBlock(blockID uint32) error
+	RestoreMetadata(tag uint16) error
+	PurgeTrash() (int, error)
+
+	// 保留策略（WORM），保留中的块不能删除，需要挂接支持保留策略的块数据存储
+	SetBlockRetention(blockID uint32, until time.Time) error
+	SetBlockLegalHold(blockID uint32, hold bool) error
+
+	// 按对象销毁数据密钥（crypto-erase），需要挂接支持对象数据密钥的块数据存储
+	CryptoErase(ctx context.Context, objectID string) error
+
+	// 从块数据存储的备份流恢复满足查询的块，需要挂接支持备份恢复的块数据存储
+	RestoreFromBackup(ctx context.Context, r io.Reader, query string, opts *storage.RestoreOptions) (*storage.RestoreResult, error)
+
+	// 后台作业：按查询选择块并逐块处理，支持检查点、进度、限速和从检查点继续
+	StartJob(ctx context.Context, job Job) error
+	PauseJob(name string) error
+	WaitJob(ctx context.Context, name string) (*JobProgress, error)
+	JobStatus(name string) (*JobProgress, error)
+	ListJobs() ([]JobProgress, error)
+	RemoveJob(name string) error
+	RewriteStoredBlock(ctx context.Context, blockID uint32) (int64, error)
+
+	// 事务，覆盖元数据和块操作
+	BeginTx() (*Tx, error)
+
+	// 带身份的元数据操作，设置 AccessAuthorizer 后检查上下文中身份的权限
+	SetAccessAuthorizer(authorizer AccessAuthorizer)
+	SetMetadataContext(ctx context.Context, tag uint16, value []byte) error
+	GetMetadataContext(ctx context.Context, tag uint16) ([]byte, error)
+	DeleteMetadataContext(ctx context.Context, tag uint16) error
+	BatchMetadataOpContext(ctx context.Context, batch *BatchMetadataOperation) error
+	ListMetadataContext(ctx context.Context) (map[uint16][]byte, error)
+
 	// 内容操作
 	WriteBlock(data []byte, options *BlockOptions) (uint32, error)
 	ReadBlock(blockID uint32) ([]byte, error)
-	WriteFromReader(reader io.Reader, options *BlockOptions) error
-	ReadToWriter(writer io.Writer) error
+	DeleteBlock(blockID uint32) error
+	LinkBlocks(sourceID, targetID uint32) error
+	GetBlockInfo(blockID uint32) (*BlockHeader, error)
+	ListBlocks() ([]*BlockHeader, error)
+	WriteFromReader(reader io.Reader, options *BlockOptions) (*ObjectHandle, error)
+	ReadToWriter(ctx context.Context, blockID uint32, writer io.Writer) (int64, error)
+	ImportDirectory(ctx context.Context, srcPath string, opts *ImportOptions) (*ImportResult, error)
+	ExportArchive(ctx context.Context, w io.Writer, format ArchiveFormat, query string) (*ExportResult, error)
+	LookupContent(hash ContentHash) (uint32, error)
+	GetContentHash(blockID uint32) (ContentHash, error)
+
+	// 可验证的同步
+	MerkleTree() (*MerkleTree, error)
+	GetRootHash() (MerkleHash, error)
+	GetProof(blockID uint32) (*MerkleProof, error)
+
+	// 增量同步，FragDB本身也可以作为同步目标
+	SyncTarget
+	SyncTo(ctx context.Context, remote SyncTarget, opts *SyncOptions) (*SyncReport, error)
+
+	// 块属性操作
+	GetBlockAttributes(blockID uint32) (map[string]string, error)
+	SetBlockAttributes(blockID uint32, attributes map[string]string) error
+	FindBlocksByAttribute(key, value string) ([]uint32, error)
+	SetAttributeIndexer(indexer BlockAttributeIndexer) error
+
+	// 外部组件
+	SetBlockStore(store BlockStore) error
+	SetIndexManager(indexManager index.IndexManager) error
+
+	// 审计
+	SetAuditRecorder(recorder AuditRecorder)
+
+	// 块签名操作
+	SetBlockSigner(signer BlockSigner)
+	SignBlock(blockID uint32, keyID string) error
+	VerifyBlock(blockID uint32) error
+	GetBlockSignature(blockID uint32) (*BlockSignature, error)
+
+	// 命名空间操作
+	Namespace() (*Namespace, error)
+	FS() (fs.FS, error)
 
 	// 查询操作
 	QueryByTag(tag uint16, value []byte) ([]interface{}, error)
 	QueryMetadata(query *MetadataQuery) (*QueryResult, error)
+	Query(queryString string) (*QueryResult, error)
+
+	// 命名查询，保存在文件中
+	RegisterView(name, queryTemplate string) error
+	UnregisterView(name string) error
+	Views() (map[string]string, error)
+	ExecuteView(name string, params map[string]interface{}) (*QueryResult, error)
 
 	// 索引操作
 	VerifyIndices() (*IndexStatus, error)
@@ -37,6 +164,9 @@ type FragDB interface {
 	ConvertToDirectoryMode() error
 	ConvertToContainerMode() error
 	OptimizeStorage() error
+
+	// 运维
+	HealthCheck(ctx context.Context, opts *HealthCheckOptions) *HealthReport
 }
 
 // Fragmenta 是FragDB接口的别名，用于内部实现
@@ -83,6 +213,18 @@ type BlockManager interface {
 	// GetBlockInfo 获取块信息
 	GetBlockInfo(blockID uint32) (*BlockHeader, error)
 
+	// ListBlocks 按块ID顺序列出所有有效块
+	ListBlocks() []*BlockHeader
+
+	// GetBlockAttributes 获取块属性
+	GetBlockAttributes(blockID uint32) (map[string]string, error)
+
+	// SetBlockAttributes 替换块的全部属性
+	SetBlockAttributes(blockID uint32, attributes map[string]string) error
+
+	// FindBlocksByAttribute 查找具有指定属性值的块
+	FindBlocksByAttribute(key, value string) ([]uint32, error)
+
 	// OptimizeBlocks 优化块存储
 	OptimizeBlocks() error
 }
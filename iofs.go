@@ -0,0 +1,300 @@
+package fragmenta
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sync"
+)
+
+// namespaceFS 命名空间的只读io/fs视图
+// 可直接用于fs.WalkDir、http.FS、template.ParseFS以及testing/fstest
+type namespaceFS struct {
+	ns *Namespace
+}
+
+var (
+	_ fs.FS         = (*namespaceFS)(nil)
+	_ fs.StatFS     = (*namespaceFS)(nil)
+	_ fs.ReadDirFS  = (*namespaceFS)(nil)
+	_ fs.ReadFileFS = (*namespaceFS)(nil)
+)
+
+// NewNamespaceFS 返回命名空间的只读io/fs视图
+// 名称遵循io/fs约定：不带前导斜杠，"."表示根目录
+func NewNamespaceFS(ns *Namespace) fs.FS {
+	return &namespaceFS{ns: ns}
+}
+
+// Open 打开文件或目录
+func (nfs *namespaceFS) Open(name string) (fs.File, error) {
+	p, err := fsPath("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := nfs.stat("open", name, p)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &namespaceDir{fsys: nfs, name: name, path: p, info: info}, nil
+	}
+	return &namespaceFile{fsys: nfs, name: name, path: p, info: info}, nil
+}
+
+// Stat 获取文件信息
+func (nfs *namespaceFS) Stat(name string) (fs.FileInfo, error) {
+	p, err := fsPath("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return nfs.stat("stat", name, p)
+}
+
+// ReadDir 列出目录，按名称排序
+func (nfs *namespaceFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	p, err := fsPath("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return nfs.readDir(name, p)
+}
+
+// ReadFile 读取文件的全部内容
+func (nfs *namespaceFS) ReadFile(name string) ([]byte, error) {
+	p, err := fsPath("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := nfs.ns.ReadFile(p)
+	if err != nil {
+		return nil, toFSError("readfile", name, err)
+	}
+	return data, nil
+}
+
+// stat 获取文件信息，根目录的名称为"."
+func (nfs *namespaceFS) stat(op, name, p string) (fs.FileInfo, error) {
+	info, err := nfs.ns.Stat(p)
+	if err != nil {
+		return nil, toFSError(op, name, err)
+	}
+	if p == "/" {
+		return rootInfo{info}, nil
+	}
+	return info, nil
+}
+
+// readDir 列出目录项
+func (nfs *namespaceFS) readDir(name, p string) ([]fs.DirEntry, error) {
+	dentries, err := nfs.ns.ReadDir(p)
+	if err != nil {
+		return nil, toFSError("readdir", name, err)
+	}
+
+	entries := make([]fs.DirEntry, 0, len(dentries))
+	for _, dentry := range dentries {
+		info, err := nfs.ns.Stat(path.Join(p, dentry.Name))
+		if err != nil {
+			// 列出期间被删除的项直接跳过
+			continue
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(info))
+	}
+	return entries, nil
+}
+
+// namespaceFile 打开的常规文件，实现io.Seeker和io.ReaderAt以支持http.FileServer
+type namespaceFile struct {
+	fsys   *namespaceFS
+	name   string
+	path   string
+	info   fs.FileInfo
+	offset int64
+	closed bool
+	mutex  sync.Mutex
+}
+
+// Stat 返回打开时的文件信息
+func (f *namespaceFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+// Read 从当前偏移量读取
+func (f *namespaceFile) Read(buf []byte) (int, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+	if len(buf) == 0 {
+		return 0, nil
+	}
+
+	n, err := f.fsys.ns.ReadAt(f.path, buf, f.offset)
+	f.offset += int64(n)
+	if err != nil && err != io.EOF {
+		return n, toFSError("read", f.name, err)
+	}
+	return n, err
+}
+
+// ReadAt 从off偏移处读取，不改变当前偏移量
+func (f *namespaceFile) ReadAt(buf []byte, off int64) (int, error) {
+	f.mutex.Lock()
+	closed := f.closed
+	f.mutex.Unlock()
+
+	if closed {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	n, err := f.fsys.ns.ReadAt(f.path, buf, off)
+	if err != nil && err != io.EOF {
+		return n, toFSError("read", f.name, err)
+	}
+	return n, err
+}
+
+// Seek 移动偏移量
+func (f *namespaceFile) Seek(offset int64, whence int) (int64, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		info, err := f.fsys.ns.Stat(f.path)
+		if err != nil {
+			return 0, toFSError("seek", f.name, err)
+		}
+		offset += info.Size()
+	default:
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	f.offset = offset
+	return offset, nil
+}
+
+// Close 关闭文件
+func (f *namespaceFile) Close() error {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
+
+// namespaceDir 打开的目录
+type namespaceDir struct {
+	fsys    *namespaceFS
+	name    string
+	path    string
+	info    fs.FileInfo
+	entries []fs.DirEntry // 第一次ReadDir时加载
+	pos     int
+	closed  bool
+	mutex   sync.Mutex
+}
+
+// Stat 返回打开时的目录信息
+func (d *namespaceDir) Stat() (fs.FileInfo, error) {
+	return d.info, nil
+}
+
+// Read 目录不能读取
+func (d *namespaceDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: ErrIsDirectory}
+}
+
+// ReadDir 列出目录项，n>0时分批返回，读完时返回io.EOF
+func (d *namespaceDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.closed {
+		return nil, &fs.PathError{Op: "readdir", Path: d.name, Err: fs.ErrClosed}
+	}
+	if d.entries == nil {
+		entries, err := d.fsys.readDir(d.name, d.path)
+		if err != nil {
+			return nil, err
+		}
+		d.entries = entries
+	}
+
+	remaining := d.entries[d.pos:]
+	if n <= 0 {
+		d.pos = len(d.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if len(remaining) > n {
+		remaining = remaining[:n]
+	}
+	d.pos += len(remaining)
+	return remaining, nil
+}
+
+// Close 关闭目录
+func (d *namespaceDir) Close() error {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	if d.closed {
+		return &fs.PathError{Op: "close", Path: d.name, Err: fs.ErrClosed}
+	}
+	d.closed = true
+	return nil
+}
+
+// rootInfo 按io/fs约定将根目录命名为"."
+type rootInfo struct {
+	fs.FileInfo
+}
+
+// Name 返回"."
+func (rootInfo) Name() string { return "." }
+
+// fsPath 校验io/fs名称并转换为命名空间的绝对路径
+func fsPath(op, name string) (string, error) {
+	if !fs.ValidPath(name) {
+		return "", &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return "/", nil
+	}
+	return "/" + name, nil
+}
+
+// toFSError 将命名空间错误转换为io/fs错误
+func toFSError(op, name string, err error) error {
+	switch {
+	case errors.Is(err, ErrPathNotFound), errors.Is(err, ErrNotDirectory) && op != "readdir":
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	case errors.Is(err, ErrInvalidPath):
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	default:
+		return &fs.PathError{Op: op, Path: name, Err: err}
+	}
+}
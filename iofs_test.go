@@ -0,0 +1,86 @@
+package fragmenta
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+// TestNamespaceFS 测试命名空间的io/fs视图
+func TestNamespaceFS(t *testing.T) {
+	f := newTestFragmenta(t)
+
+	ns, err := f.Namespace()
+	if err != nil {
+		t.Fatalf("获取命名空间失败: %v", err)
+	}
+	if err := ns.MkdirAll("/site/assets", 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	files := map[string]string{
+		"/site/index.html":    "<h1>fragmenta</h1>",
+		"/site/assets/app.js": "console.log('ok')",
+		"/notes.txt":          "plain text",
+	}
+	for p, content := range files {
+		if err := ns.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatalf("写入文件%s失败: %v", p, err)
+		}
+	}
+	if _, err := ns.Mkdir("/empty", 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+
+	fsys, err := f.FS()
+	if err != nil {
+		t.Fatalf("获取io/fs视图失败: %v", err)
+	}
+
+	// 标准库的一致性检查覆盖Open/Stat/ReadDir/ReadFile/Seek等行为
+	if err := fstest.TestFS(fsys, "site/index.html", "site/assets/app.js", "notes.txt", "empty"); err != nil {
+		t.Fatalf("io/fs一致性检查失败: %v", err)
+	}
+
+	var walked []string
+	err = fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		walked = append(walked, p)
+		return nil
+	})
+	if err != nil || len(walked) != 7 || walked[0] != "." || walked[len(walked)-1] != "site/index.html" {
+		t.Errorf("WalkDir结果不正确: %v, %v", walked, err)
+	}
+
+	if _, err := fs.Stat(fsys, "missing.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("不存在的文件应返回fs.ErrNotExist, 实际%v", err)
+	}
+	if _, err := fs.ReadFile(fsys, "/notes.txt"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("带前导斜杠的名称应返回fs.ErrInvalid, 实际%v", err)
+	}
+
+	// 通过http.FileServer提供文件，支持范围请求
+	sub, err := fs.Sub(fsys, "site")
+	if err != nil {
+		t.Fatalf("获取子目录视图失败: %v", err)
+	}
+	server := httptest.NewServer(http.FileServer(http.FS(sub)))
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/assets/app.js", nil)
+	req.Header.Set("Range", "bytes=0-6")
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("请求失败: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent || string(body) != "console" {
+		t.Errorf("http.FileServer范围读取结果不正确: %d %q", resp.StatusCode, body)
+	}
+}
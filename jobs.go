@@ -0,0 +1,527 @@
+package fragmenta
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bpfs/fragmenta/throttle"
+)
+
+const (
+	// DefaultJobCheckpointInterval 默认每处理多少个块保存一次作业检查点
+	DefaultJobCheckpointInterval = 100
+
+	// MaxJobNameSize 作业名称的最大长度（字节）
+	MaxJobNameSize = 64
+
+	// jobTableVersion 作业表的编码版本
+	jobTableVersion uint8 = 1
+
+	// maxJobErrorSize 作业表中保存的错误信息的最大长度（字节）
+	maxJobErrorSize = 1024
+)
+
+// JobState 后台作业的状态
+type JobState uint8
+
+const (
+	// JobRunning 正在运行
+	JobRunning JobState = iota + 1
+	// JobPaused 已暂停（PauseJob、ctx取消或关闭文件），再次 StartJob 时从检查点继续
+	JobPaused
+	// JobCompleted 已处理完所有选中的块
+	JobCompleted
+)
+
+// String 返回状态名称
+func (s JobState) String() string {
+	switch s {
+	case JobRunning:
+		return "running"
+	case JobPaused:
+		return "paused"
+	case JobCompleted:
+		return "completed"
+	default:
+		return fmt.Sprintf("JobState(%d)", uint8(s))
+	}
+}
+
+// JobStep 处理作业选中的一个块，返回处理的字节数，用于进度和限速。
+// 返回错误时块计为失败，作业继续处理后面的块
+type JobStep func(ctx context.Context, blockID uint32) (int64, error)
+
+// Job 由查询选择块、对每个块执行Step的后台作业，例如修改存储管理器的变换管道后
+// 用 RewriteStoredBlock 重新压缩 "codec==gzip" 的块，或者轮换默认密钥后重新加密所有块
+type Job struct {
+	// Name 作业名称，检查点和进度按名称保存
+	Name string
+
+	// Query 选择块的查询，语法见Query。选中的块按ID升序处理
+	Query string
+
+	// Step 处理一个块
+	Step JobStep
+
+	// Throttle 按处理的字节数和块数限速，为nil时不限速
+	Throttle *throttle.Limiter
+
+	// CheckpointInterval 每处理多少个块保存一次检查点并提交，0表示 DefaultJobCheckpointInterval
+	CheckpointInterval int
+}
+
+// JobProgress 后台作业的进度，保存在TagJobs中，重新打开文件后仍可查询
+type JobProgress struct {
+	// Name 作业名称
+	Name string
+
+	// Query 选择块的查询
+	Query string
+
+	// State 作业状态
+	State JobState
+
+	// Total 选中的块数，从检查点继续时为已处理的块数加上剩余的块数
+	Total int
+
+	// Processed 已处理的块数，包括失败的块
+	Processed int
+
+	// Failed 处理失败的块数
+	Failed int
+
+	// Bytes 已处理的字节数
+	Bytes int64
+
+	// Checkpoint 最近处理的块ID，从检查点继续时跳过不大于它的块
+	Checkpoint uint32
+
+	// LastError 最近一次处理失败的原因
+	LastError string
+
+	// StartedAt 作业开始时间（从检查点继续不改变）
+	StartedAt time.Time
+
+	// UpdatedAt 进度最近更新的时间
+	UpdatedAt time.Time
+}
+
+// jobRunner 作业及其运行状态，字段由jobMutex保护
+type jobRunner struct {
+	job      Job
+	progress JobProgress
+
+	// 运行中的作业的取消函数和结束信号，未运行时为nil
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// StartJob 在后台运行作业。同名作业已暂停且查询相同时从检查点继续，跳过ID不大于检查点的块；
+// 否则重新执行查询从头开始。同名作业正在运行时返回ErrJobRunning。
+// 作业每处理 CheckpointInterval 个块保存一次检查点并提交，进程退出后重新打开文件再次 StartJob 即可继续。
+// ctx取消时作业暂停。需要先调用 StartQueryService
+func (f *FragmentaImpl) StartJob(ctx context.Context, job Job) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	if err := validateFieldName(job.Name); err != nil {
+		return err
+	}
+	if len(job.Name) > MaxJobNameSize {
+		return fmt.Errorf("%w: 作业名称超过%d字节", ErrInvalidArgument, MaxJobNameSize)
+	}
+	if job.Step == nil {
+		return fmt.Errorf("%w: 作业没有处理步骤", ErrInvalidArgument)
+	}
+
+	f.jobMutex.Lock()
+	defer f.jobMutex.Unlock()
+
+	if err := f.loadJobsLocked(); err != nil {
+		return err
+	}
+	saved, ok := f.jobs[job.Name]
+	if ok && saved.cancel != nil {
+		return fmt.Errorf("%w: %s", ErrJobRunning, job.Name)
+	}
+
+	result, err := f.Query(job.Query)
+	if err != nil {
+		return err
+	}
+	ids := make([]uint32, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		ids = append(ids, entry.BlockID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	now := f.now()
+	progress := JobProgress{Name: job.Name, Query: job.Query, StartedAt: now}
+	if ok && saved.progress.State == JobPaused && saved.progress.Query == job.Query {
+		progress = saved.progress
+		ids = ids[sort.Search(len(ids), func(i int) bool { return ids[i] > progress.Checkpoint }):]
+	}
+	progress.State = JobRunning
+	progress.Total = progress.Processed + len(ids)
+	progress.UpdatedAt = now
+
+	runCtx, cancel := context.WithCancel(ctx)
+	runner := &jobRunner{job: job, progress: progress, cancel: cancel, done: make(chan struct{})}
+	f.jobs[job.Name] = runner
+	if err := f.saveJobsLocked(); err != nil {
+		cancel()
+		if ok {
+			f.jobs[job.Name] = saved
+		} else {
+			delete(f.jobs, job.Name)
+		}
+		return err
+	}
+
+	go f.runJob(runCtx, runner, ids)
+	logger.Info("已启动后台作业", "name", job.Name, "blocks", len(ids), "resumed", progress.Processed > 0)
+	return nil
+}
+
+// PauseJob 暂停作业并等待正在处理的块完成，保存检查点。作业不在运行时不做任何事
+func (f *FragmentaImpl) PauseJob(name string) error {
+	f.jobMutex.Lock()
+	if err := f.loadJobsLocked(); err != nil {
+		f.jobMutex.Unlock()
+		return err
+	}
+	runner, ok := f.jobs[name]
+	if !ok {
+		f.jobMutex.Unlock()
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	cancel, done := runner.cancel, runner.done
+	f.jobMutex.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+	return nil
+}
+
+// WaitJob 等待作业结束（完成或暂停），返回最终进度。ctx取消时返回ctx.Err()，作业继续运行
+func (f *FragmentaImpl) WaitJob(ctx context.Context, name string) (*JobProgress, error) {
+	f.jobMutex.Lock()
+	if err := f.loadJobsLocked(); err != nil {
+		f.jobMutex.Unlock()
+		return nil, err
+	}
+	runner, ok := f.jobs[name]
+	if !ok {
+		f.jobMutex.Unlock()
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	done := runner.done
+	f.jobMutex.Unlock()
+
+	if done != nil {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return f.JobStatus(name)
+}
+
+// JobStatus 返回作业的进度，包括之前运行中保存的作业
+func (f *FragmentaImpl) JobStatus(name string) (*JobProgress, error) {
+	f.jobMutex.Lock()
+	defer f.jobMutex.Unlock()
+
+	if err := f.loadJobsLocked(); err != nil {
+		return nil, err
+	}
+	runner, ok := f.jobs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	progress := runner.progress
+	return &progress, nil
+}
+
+// ListJobs 返回所有作业的进度，按名称排序
+func (f *FragmentaImpl) ListJobs() ([]JobProgress, error) {
+	f.jobMutex.Lock()
+	defer f.jobMutex.Unlock()
+
+	if err := f.loadJobsLocked(); err != nil {
+		return nil, err
+	}
+	jobs := make([]JobProgress, 0, len(f.jobs))
+	for _, runner := range f.jobs {
+		jobs = append(jobs, runner.progress)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs, nil
+}
+
+// RemoveJob 删除已结束作业的进度和检查点，作业正在运行时返回ErrJobRunning
+func (f *FragmentaImpl) RemoveJob(name string) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+
+	f.jobMutex.Lock()
+	defer f.jobMutex.Unlock()
+
+	if err := f.loadJobsLocked(); err != nil {
+		return err
+	}
+	runner, ok := f.jobs[name]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrJobNotFound, name)
+	}
+	if runner.cancel != nil {
+		return fmt.Errorf("%w: %s", ErrJobRunning, name)
+	}
+	delete(f.jobs, name)
+	if err := f.saveJobsLocked(); err != nil {
+		f.jobs[name] = runner
+		return err
+	}
+	return nil
+}
+
+// RewriteStoredBlock 从块数据存储读取块并原样写回，存储管理器按当前的变换管道、分类策略和密钥重新编码，
+// 可以直接作为作业的Step。没有设置块数据存储时返回ErrInvalidOperation
+func (f *FragmentaImpl) RewriteStoredBlock(ctx context.Context, blockID uint32) (int64, error) {
+	store := f.getBlockStore()
+	if store == nil {
+		return 0, fmt.Errorf("%w: 没有设置块数据存储", ErrInvalidOperation)
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	data, err := store.ReadBlock(blockID)
+	if err != nil {
+		return 0, err
+	}
+	if err := store.WriteBlock(blockID, data); err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+// runJob 依次处理选中的块，定期保存检查点，结束时记录完成或暂停
+func (f *FragmentaImpl) runJob(ctx context.Context, runner *jobRunner, ids []uint32) {
+	defer close(runner.done)
+
+	interval := runner.job.CheckpointInterval
+	if interval <= 0 {
+		interval = DefaultJobCheckpointInterval
+	}
+	remaining := ids
+	for i, id := range ids {
+		if ctx.Err() != nil {
+			break
+		}
+		n, err := runner.job.Step(ctx, id)
+		if err != nil && ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+			// 取消打断的块不计入进度，继续时重新处理
+			break
+		}
+		remaining = ids[i+1:]
+
+		f.jobMutex.Lock()
+		progress := &runner.progress
+		progress.Processed++
+		progress.Bytes += n
+		progress.Checkpoint = id
+		progress.UpdatedAt = f.now()
+		if err != nil {
+			progress.Failed++
+			progress.LastError = truncateJobError(err.Error())
+			logger.Warn("作业处理块失败", "name", runner.job.Name, "blockID", id, "error", err)
+		}
+		f.jobMutex.Unlock()
+
+		if (i+1)%interval == 0 && len(remaining) > 0 {
+			f.checkpointJobs()
+		}
+		if err := runner.job.Throttle.Wait(ctx, n); err != nil {
+			break
+		}
+	}
+
+	f.jobMutex.Lock()
+	runner.progress.State = JobPaused
+	if len(remaining) == 0 {
+		runner.progress.State = JobCompleted
+	}
+	runner.progress.UpdatedAt = f.now()
+	progress := runner.progress
+	f.jobMutex.Unlock()
+
+	// 保存检查点之后才标记为未运行，关闭文件时等待到这里
+	f.checkpointJobs()
+	f.jobMutex.Lock()
+	runner.cancel()
+	runner.cancel, runner.done = nil, nil
+	f.jobMutex.Unlock()
+	logger.Info("后台作业已结束", "name", progress.Name, "state", progress.State,
+		"processed", progress.Processed, "failed", progress.Failed)
+}
+
+// checkpointJobs 保存作业表并提交，使检查点在进程退出后仍然有效
+func (f *FragmentaImpl) checkpointJobs() {
+	f.jobMutex.Lock()
+	err := f.saveJobsLocked()
+	f.jobMutex.Unlock()
+	if err == nil {
+		err = f.Commit()
+	}
+	if err != nil {
+		logger.Error("保存作业检查点失败", "error", err)
+	}
+}
+
+// stopJobs 暂停所有运行中的作业并等待它们结束，关闭文件前调用
+func (f *FragmentaImpl) stopJobs() {
+	f.jobMutex.Lock()
+	var running []*jobRunner
+	for _, runner := range f.jobs {
+		if runner.cancel != nil {
+			running = append(running, runner)
+		}
+	}
+	f.jobMutex.Unlock()
+
+	for _, runner := range running {
+		f.jobMutex.Lock()
+		cancel, done := runner.cancel, runner.done
+		f.jobMutex.Unlock()
+		if cancel != nil {
+			cancel()
+			<-done
+		}
+	}
+}
+
+// loadJobsLocked 首次使用时从TagJobs加载作业表，之前运行中的作业视为已暂停，调用方需持有jobMutex
+func (f *FragmentaImpl) loadJobsLocked() error {
+	if f.jobs != nil {
+		return nil
+	}
+
+	data, err := f.metadataManager.GetMetadata(TagJobs)
+	if err == ErrMetadataNotFound {
+		f.jobs = make(map[string]*jobRunner)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	jobs, err := decodeJobs(data)
+	if err != nil {
+		logger.Error("加载作业表失败", "error", err)
+		return err
+	}
+	f.jobs = make(map[string]*jobRunner, len(jobs))
+	for _, progress := range jobs {
+		if progress.State == JobRunning {
+			progress.State = JobPaused
+		}
+		f.jobs[progress.Name] = &jobRunner{progress: progress}
+	}
+	return nil
+}
+
+// saveJobsLocked 把作业表写入TagJobs，调用方需持有jobMutex
+func (f *FragmentaImpl) saveJobsLocked() error {
+	jobs := make([]JobProgress, 0, len(f.jobs))
+	for _, runner := range f.jobs {
+		jobs = append(jobs, runner.progress)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return f.setMetadata(TagJobs, encodeJobs(jobs))
+}
+
+// truncateJobError 截断过长的错误信息
+func truncateJobError(message string) string {
+	if len(message) > maxJobErrorSize {
+		return message[:maxJobErrorSize]
+	}
+	return message
+}
+
+// encodeJobs 编码作业表
+// 格式: 版本 | 数量 | 记录...，记录为 名称长度(1) 名称 | 查询长度(2) 查询 | 状态(1) | 总数(4) | 已处理(4) |
+// 失败(4) | 字节数(8) | 检查点(4) | 开始时间(8) | 更新时间(8) | 错误长度(2) 错误
+func encodeJobs(jobs []JobProgress) []byte {
+	buf := make([]byte, 3, 3+len(jobs)*128)
+	buf[0] = jobTableVersion
+	binary.BigEndian.PutUint16(buf[1:], uint16(len(jobs)))
+	for _, job := range jobs {
+		buf = append(buf, uint8(len(job.Name)))
+		buf = append(buf, job.Name...)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(job.Query)))
+		buf = append(buf, job.Query...)
+		buf = append(buf, uint8(job.State))
+		buf = binary.BigEndian.AppendUint32(buf, uint32(job.Total))
+		buf = binary.BigEndian.AppendUint32(buf, uint32(job.Processed))
+		buf = binary.BigEndian.AppendUint32(buf, uint32(job.Failed))
+		buf = binary.BigEndian.AppendUint64(buf, uint64(job.Bytes))
+		buf = binary.BigEndian.AppendUint32(buf, job.Checkpoint)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(job.StartedAt.UnixNano()))
+		buf = binary.BigEndian.AppendUint64(buf, uint64(job.UpdatedAt.UnixNano()))
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(job.LastError)))
+		buf = append(buf, job.LastError...)
+	}
+	return buf
+}
+
+// decodeJobs 解码作业表
+func decodeJobs(data []byte) ([]JobProgress, error) {
+	if len(data) < 3 || data[0] != jobTableVersion {
+		return nil, fmt.Errorf("%w: 无效的作业表", ErrIndexCorruption)
+	}
+
+	count := int(binary.BigEndian.Uint16(data[1:]))
+	truncated := fmt.Errorf("%w: 作业表被截断", ErrIndexCorruption)
+	jobs := make([]JobProgress, 0, count)
+	data = data[3:]
+	for i := 0; i < count; i++ {
+		var job JobProgress
+		if len(data) < 1 || len(data) < 3+int(data[0]) {
+			return nil, truncated
+		}
+		job.Name = string(data[1 : 1+data[0]])
+		data = data[1+len(job.Name):]
+		size := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+size+43 {
+			return nil, truncated
+		}
+		job.Query = string(data[2 : 2+size])
+		data = data[2+size:]
+
+		job.State = JobState(data[0])
+		job.Total = int(binary.BigEndian.Uint32(data[1:]))
+		job.Processed = int(binary.BigEndian.Uint32(data[5:]))
+		job.Failed = int(binary.BigEndian.Uint32(data[9:]))
+		job.Bytes = int64(binary.BigEndian.Uint64(data[13:]))
+		job.Checkpoint = binary.BigEndian.Uint32(data[21:])
+		job.StartedAt = time.Unix(0, int64(binary.BigEndian.Uint64(data[25:])))
+		job.UpdatedAt = time.Unix(0, int64(binary.BigEndian.Uint64(data[33:])))
+		size = int(binary.BigEndian.Uint16(data[41:]))
+		data = data[43:]
+		if len(data) < size {
+			return nil, truncated
+		}
+		job.LastError = string(data[:size])
+		data = data[size:]
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
@@ -0,0 +1,182 @@
+package fragmenta
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bpfs/fragmenta/storage"
+	"github.com/bpfs/fragmenta/throttle"
+)
+
+// TestJobCheckpointResume 测试作业暂停后保存检查点，重新打开文件后从检查点继续
+func TestJobCheckpointResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.frag")
+	f, err := CreateFragmenta(path, nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+
+	// 重新打开后按块头字段选择块
+	var large []uint32
+	for _, size := range []int{200, 10, 300, 400, 20, 500, 600} {
+		id, err := f.WriteBlock(make([]byte, size), nil)
+		if err != nil {
+			t.Fatalf("写入块失败: %v", err)
+		}
+		if size >= 100 {
+			large = append(large, id)
+		}
+	}
+	if err := f.StartQueryService(); err != nil {
+		t.Fatalf("启动查询服务失败: %v", err)
+	}
+
+	// 处理两个块后取消，作业暂停
+	ctx, cancel := context.WithCancel(context.Background())
+	var seen []uint32
+	job := Job{
+		Name:  "reprocess",
+		Query: "block.size>=100; sort: -block.id",
+		Step: func(_ context.Context, id uint32) (int64, error) {
+			seen = append(seen, id)
+			if len(seen) == 2 {
+				cancel()
+			}
+			return 10, nil
+		},
+		Throttle:           throttle.New(0, 1000),
+		CheckpointInterval: 1,
+	}
+	if err := f.StartJob(ctx, job); err != nil {
+		t.Fatalf("启动作业失败: %v", err)
+	}
+	progress, err := f.WaitJob(context.Background(), "reprocess")
+	if err != nil {
+		t.Fatalf("等待作业失败: %v", err)
+	}
+	if progress.State != JobPaused || progress.Processed != 2 || progress.Checkpoint != large[1] || progress.Total != len(large) {
+		t.Fatalf("暂停后的进度不正确: %+v", progress)
+	}
+	if !reflect.DeepEqual(seen, large[:2]) {
+		t.Errorf("应按块ID升序处理: %v", seen)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+
+	f, err = OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer f.Close()
+	if err := f.StartQueryService(); err != nil {
+		t.Fatalf("启动查询服务失败: %v", err)
+	}
+	if progress, err := f.JobStatus("reprocess"); err != nil || progress.State != JobPaused || progress.Bytes != 20 {
+		t.Fatalf("重新打开后的作业进度不正确: %+v, %v", progress, err)
+	}
+
+	// 从检查点继续，失败的块计入进度但不中断作业
+	seen = nil
+	job.Step = func(_ context.Context, id uint32) (int64, error) {
+		seen = append(seen, id)
+		if id == large[3] {
+			return 0, errors.New("codec unavailable")
+		}
+		return 10, nil
+	}
+	if err := f.StartJob(context.Background(), job); err != nil {
+		t.Fatalf("继续作业失败: %v", err)
+	}
+	progress, err = f.WaitJob(context.Background(), "reprocess")
+	if err != nil {
+		t.Fatalf("等待作业失败: %v", err)
+	}
+	if !reflect.DeepEqual(seen, large[2:]) {
+		t.Errorf("应从检查点之后继续: %v", seen)
+	}
+	if progress.State != JobCompleted || progress.Processed != len(large) || progress.Failed != 1 ||
+		progress.Bytes != 40 || progress.LastError != "codec unavailable" {
+		t.Errorf("完成后的进度不正确: %+v", progress)
+	}
+
+	// 已完成的作业再次启动时从头开始
+	seen = nil
+	if err := f.StartJob(context.Background(), job); err != nil {
+		t.Fatalf("重新运行作业失败: %v", err)
+	}
+	if _, err := f.WaitJob(context.Background(), "reprocess"); err != nil || len(seen) != len(large) {
+		t.Errorf("重新运行应处理所有块: %v, %v", seen, err)
+	}
+
+	if _, err := f.JobStatus("missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Errorf("不存在的作业应返回ErrJobNotFound: %v", err)
+	}
+	if err := f.RemoveJob("reprocess"); err != nil {
+		t.Fatalf("删除作业失败: %v", err)
+	}
+	if jobs, err := f.ListJobs(); err != nil || len(jobs) != 0 {
+		t.Errorf("删除后不应再有作业: %v, %v", jobs, err)
+	}
+}
+
+// TestJobRewriteStoredBlock 测试修改存储管理器的变换管道后用作业重新编码选中的块
+func TestJobRewriteStoredBlock(t *testing.T) {
+	tempDir := t.TempDir()
+	f, err := CreateFragmenta(filepath.Join(tempDir, "test.frag"), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	defer f.Close()
+
+	sm, err := storage.NewStorageManager(&storage.StorageConfig{
+		Type:      storage.StorageTypeContainer,
+		Path:      filepath.Join(tempDir, "container.db"),
+		BlockSize: 4096,
+	})
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+	t.Cleanup(func() { sm.Close() })
+	if err := f.SetBlockStore(sm); err != nil {
+		t.Fatalf("设置块数据存储失败: %v", err)
+	}
+
+	data := []byte(strings.Repeat("compressible ", 100))
+	ids := make(map[string]uint32)
+	for _, codec := range []string{"none", "legacy"} {
+		id, err := f.WriteBlock(data, &BlockOptions{Attributes: map[string]string{"codec": codec}})
+		if err != nil {
+			t.Fatalf("写入块失败: %v", err)
+		}
+		ids[codec] = id
+	}
+	if err := f.StartQueryService(); err != nil {
+		t.Fatalf("启动查询服务失败: %v", err)
+	}
+
+	if err := sm.SetTransformPipeline(&storage.GzipTransform{}); err != nil {
+		t.Fatalf("设置变换管道失败: %v", err)
+	}
+	if err := f.StartJob(context.Background(), Job{Name: "recompress", Query: "codec==legacy", Step: f.RewriteStoredBlock}); err != nil {
+		t.Fatalf("启动作业失败: %v", err)
+	}
+	progress, err := f.WaitJob(context.Background(), "recompress")
+	if err != nil || progress.State != JobCompleted || progress.Processed != 1 || progress.Bytes != int64(len(data)) {
+		t.Fatalf("作业进度不正确: %+v, %v", progress, err)
+	}
+
+	for codec, want := range map[string]string{"legacy": "gzip", "none": ""} {
+		names, err := sm.BlockTransforms(ids[codec])
+		if err != nil || strings.Join(names, ",") != want {
+			t.Errorf("%s块的变换: %v, %v", codec, names, err)
+		}
+	}
+	if got, err := f.ReadBlock(ids["legacy"]); err != nil || string(got) != string(data) {
+		t.Errorf("重新编码后读取失败: %v", err)
+	}
+}
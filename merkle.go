@@ -0,0 +1,423 @@
+package fragmenta
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"sort"
+)
+
+// MerkleHash Merkle树节点的哈希（SHA-256）
+type MerkleHash [sha256.Size]byte
+
+// String 返回十六进制形式
+func (h MerkleHash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// MerkleNode Merkle树中覆盖一段块ID的节点
+type MerkleNode struct {
+	Hash    MerkleHash // 节点哈希，没有块时为零值
+	Leaves  int        // 节点下的块数
+	BlockID uint32     // 节点下只有一个块时为该块的ID
+}
+
+// MerkleSource 可以按位置获取Merkle树节点的数据源，通常是本地的 MerkleTree 或远程副本的客户端
+type MerkleSource interface {
+	// MerkleNode 返回深度为depth、块ID的前depth位为prefix的节点
+	MerkleNode(depth int, prefix uint32) (MerkleNode, error)
+}
+
+// MerkleProof 块在Merkle树中的存在证明
+type MerkleProof struct {
+	BlockID  uint32       // 块ID
+	Leaf     MerkleHash   // 块的叶子哈希（见 MerkleLeafHash）
+	Siblings []MerkleHash // 从根节点向下每一层的兄弟节点哈希
+}
+
+// Verify 检查证明能否推导出根哈希
+func (p *MerkleProof) Verify(root MerkleHash) bool {
+	if len(p.Siblings) > 32 {
+		return false
+	}
+	hash := p.Leaf
+	for depth := len(p.Siblings) - 1; depth >= 0; depth-- {
+		if merkleBit(p.BlockID, depth) == 0 {
+			hash = merkleBranch(hash, p.Siblings[depth])
+		} else {
+			hash = merkleBranch(p.Siblings[depth], hash)
+		}
+	}
+	return hash == root
+}
+
+// MerkleLeafHash 计算块的叶子哈希，覆盖块ID、块类型、块链中的下一个块和数据的SHA-256
+func MerkleLeafHash(blockID uint32, blockType uint8, nextBlock uint32, data []byte) MerkleHash {
+	return merkleLeaf(blockID, blockType, nextBlock, sha256.Sum256(data))
+}
+
+// merkleLeaf 由数据哈希计算叶子哈希
+func merkleLeaf(blockID uint32, blockType uint8, nextBlock uint32, dataHash [sha256.Size]byte) MerkleHash {
+	var buf [10 + sha256.Size]byte
+	buf[0] = 0x00
+	binary.BigEndian.PutUint32(buf[1:], blockID)
+	buf[5] = blockType
+	binary.BigEndian.PutUint32(buf[6:], nextBlock)
+	copy(buf[10:], dataHash[:])
+	return sha256.Sum256(buf[:])
+}
+
+// merkleBranch 计算内部节点哈希
+func merkleBranch(left, right MerkleHash) MerkleHash {
+	var buf [1 + 2*sha256.Size]byte
+	buf[0] = 0x01
+	copy(buf[1:], left[:])
+	copy(buf[1+sha256.Size:], right[:])
+	return sha256.Sum256(buf[:])
+}
+
+// merkleBit 块ID从高位起第depth位
+func merkleBit(blockID uint32, depth int) uint32 {
+	return (blockID >> (31 - depth)) & 1
+}
+
+// merkleKey 节点位置
+type merkleKey struct {
+	depth  int
+	prefix uint32
+}
+
+// MerkleTree 某一时刻容器内容的Merkle树快照。
+// 树按块ID的二进制位划分：深度为d的节点覆盖前d位相同的所有块ID，左子节点为下一位是0的块，右子节点为1的块。
+// 只有一个块的子树的哈希就是该块的叶子哈希，没有块的子树哈希为零值，其余节点哈希为
+// SHA-256(0x01 | 左子节点哈希 | 右子节点哈希)。节点位置只取决于块ID，
+// 因此两个副本可以从根节点开始逐层比较，只下探哈希不同的子树（见 DiffMerkle）。
+// 系统块和回收站中的块不在树中
+type MerkleTree struct {
+	ids    []uint32
+	leaves []MerkleHash
+	nodes  map[merkleKey]MerkleNode
+}
+
+// newMerkleTree 由按块ID升序排列的叶子构造树
+func newMerkleTree(ids []uint32, leaves []MerkleHash) *MerkleTree {
+	t := &MerkleTree{ids: ids, leaves: leaves, nodes: make(map[merkleKey]MerkleNode)}
+	t.node(0, 0, 0, len(ids))
+	return t
+}
+
+// Root 返回根哈希
+func (t *MerkleTree) Root() MerkleHash {
+	return t.nodes[merkleKey{}].Hash
+}
+
+// Len 返回树中的块数
+func (t *MerkleTree) Len() int {
+	return len(t.ids)
+}
+
+// Contains 块是否在树中
+func (t *MerkleTree) Contains(blockID uint32) bool {
+	i := sort.Search(len(t.ids), func(i int) bool { return t.ids[i] >= blockID })
+	return i < len(t.ids) && t.ids[i] == blockID
+}
+
+// MerkleNode 返回深度为depth（0到32）、块ID的前depth位为prefix的节点
+func (t *MerkleTree) MerkleNode(depth int, prefix uint32) (MerkleNode, error) {
+	if depth < 0 || depth > 32 || (depth < 32 && uint64(prefix) >= 1<<depth) {
+		return MerkleNode{}, fmt.Errorf("%w: 无效的节点位置 %d/%d", ErrInvalidArgument, depth, prefix)
+	}
+	if node, ok := t.nodes[merkleKey{depth, prefix}]; ok {
+		return node, nil
+	}
+	lo, hi := merkleRange(depth, prefix)
+	start := sort.Search(len(t.ids), func(i int) bool { return uint64(t.ids[i]) >= lo })
+	end := sort.Search(len(t.ids), func(i int) bool { return uint64(t.ids[i]) >= hi })
+	return t.node(depth, prefix, start, end), nil
+}
+
+// Proof 返回块的存在证明，块不在树中时返回ErrBlockNotFound
+func (t *MerkleTree) Proof(blockID uint32) (*MerkleProof, error) {
+	proof := &MerkleProof{BlockID: blockID}
+	var prefix uint32
+	for depth := 0; ; depth++ {
+		node, _ := t.MerkleNode(depth, prefix)
+		if node.Leaves == 0 || (node.Leaves == 1 && node.BlockID != blockID) {
+			return nil, ErrBlockNotFound
+		}
+		if node.Leaves == 1 {
+			proof.Leaf = node.Hash
+			return proof, nil
+		}
+
+		bit := merkleBit(blockID, depth)
+		sibling, _ := t.MerkleNode(depth+1, prefix<<1|(bit^1))
+		proof.Siblings = append(proof.Siblings, sibling.Hash)
+		prefix = prefix<<1 | bit
+	}
+}
+
+// node 计算并缓存节点，ids[start:end]是节点覆盖的块
+func (t *MerkleTree) node(depth int, prefix uint32, start, end int) MerkleNode {
+	key := merkleKey{depth, prefix}
+	if node, ok := t.nodes[key]; ok {
+		return node
+	}
+
+	var node MerkleNode
+	switch end - start {
+	case 0:
+	case 1:
+		node = MerkleNode{Hash: t.leaves[start], Leaves: 1, BlockID: t.ids[start]}
+	default:
+		// 块ID互不相同，两个以上的块一定在32层之内分开
+		_, mid := merkleRange(depth+1, prefix<<1)
+		split := start + sort.Search(end-start, func(i int) bool { return uint64(t.ids[start+i]) >= mid })
+		left := t.node(depth+1, prefix<<1, start, split)
+		right := t.node(depth+1, prefix<<1|1, split, end)
+		node = MerkleNode{Hash: merkleBranch(left.Hash, right.Hash), Leaves: end - start}
+	}
+	t.nodes[key] = node
+	return node
+}
+
+// merkleRange 节点覆盖的块ID范围[lo, hi)
+func merkleRange(depth int, prefix uint32) (uint64, uint64) {
+	shift := 32 - depth
+	lo := uint64(prefix) << shift
+	return lo, lo + 1<<shift
+}
+
+// DiffMerkle 比较两棵Merkle树，返回内容不同或只在一方存在的块ID（升序）。
+// 只访问哈希不同的子树，远程副本只需要按需提供节点
+func DiffMerkle(local, remote MerkleSource) ([]uint32, error) {
+	diff := make(map[uint32]struct{})
+	var walk func(depth int, prefix uint32) error
+	walk = func(depth int, prefix uint32) error {
+		a, err := local.MerkleNode(depth, prefix)
+		if err != nil {
+			return err
+		}
+		b, err := remote.MerkleNode(depth, prefix)
+		if err != nil {
+			return err
+		}
+		if a.Hash == b.Hash {
+			return nil
+		}
+		if (a.Leaves <= 1 && b.Leaves <= 1) || depth == 32 {
+			if a.Leaves == 1 {
+				diff[a.BlockID] = struct{}{}
+			}
+			if b.Leaves == 1 {
+				diff[b.BlockID] = struct{}{}
+			}
+			return nil
+		}
+		if err := walk(depth+1, prefix<<1); err != nil {
+			return err
+		}
+		return walk(depth+1, prefix<<1|1)
+	}
+	if err := walk(0, 0); err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint32, 0, len(diff))
+	for id := range diff {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// blockHash 缓存的块数据哈希，块ID被重用时大小通常不同，据此发现过期的缓存
+type blockHash struct {
+	size uint32
+	hash [sha256.Size]byte
+}
+
+// MerkleTree 返回当前内容的Merkle树快照。块数据的哈希在写入时计算并保存在索引区中，
+// 缺少哈希的块（例如旧版本写入的块）在首次构造时读取并计算
+func (f *FragmentaImpl) MerkleTree() (*MerkleTree, error) {
+	headers, err := f.ListBlocks()
+	if err != nil {
+		return nil, err
+	}
+
+	f.merkleMutex.Lock()
+	defer f.merkleMutex.Unlock()
+
+	ids := make([]uint32, 0, len(headers))
+	leaves := make([]MerkleHash, 0, len(headers))
+	for _, header := range headers {
+		if header.BlockType == SystemBlockType {
+			continue
+		}
+
+		hash, err := f.blockHashLocked(header)
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, header.BlockID)
+		leaves = append(leaves, merkleLeaf(header.BlockID, header.BlockType, header.NextBlock, hash))
+	}
+	f.pruneBlockHashesLocked()
+
+	return newMerkleTree(ids, leaves), nil
+}
+
+// blockHashLocked 返回块数据的哈希，没有缓存或缓存过期时读取块数据计算，调用方需持有merkleMutex
+func (f *FragmentaImpl) blockHashLocked(header *BlockHeader) ([sha256.Size]byte, error) {
+	if f.blockHashes == nil {
+		f.blockHashes = make(map[uint32]blockHash)
+	}
+
+	cached, ok := f.blockHashes[header.BlockID]
+	if !ok || cached.size != header.Size {
+		data, err := f.readBlock(header.BlockID)
+		if err != nil {
+			logger.Error("读取块数据失败，无法计算Merkle树", "blockID", header.BlockID, "error", err)
+			return [sha256.Size]byte{}, err
+		}
+		cached = blockHash{size: uint32(len(data)), hash: sha256.Sum256(data)}
+		f.blockHashes[header.BlockID] = cached
+		f.markMerkleChangedLocked()
+	}
+	return cached.hash, nil
+}
+
+// pruneBlockHashesLocked 删除不再存在的块的哈希，回收站中的块保留，调用方需持有merkleMutex
+func (f *FragmentaImpl) pruneBlockHashesLocked() {
+	headers := f.blockManager.ListBlocks()
+	if len(f.blockHashes) <= len(headers) {
+		return
+	}
+	exists := make(map[uint32]struct{}, len(headers))
+	for _, header := range headers {
+		exists[header.BlockID] = struct{}{}
+	}
+	for blockID := range f.blockHashes {
+		if _, ok := exists[blockID]; !ok {
+			delete(f.blockHashes, blockID)
+			f.markMerkleChangedLocked()
+		}
+	}
+}
+
+// GetRootHash 返回当前内容的Merkle树根哈希（见 MerkleTree）
+func (f *FragmentaImpl) GetRootHash() (MerkleHash, error) {
+	tree, err := f.MerkleTree()
+	if err != nil {
+		return MerkleHash{}, err
+	}
+	return tree.Root(), nil
+}
+
+// GetProof 返回块在当前Merkle树中的存在证明，可以用 MerkleProof.Verify 对照根哈希验证
+func (f *FragmentaImpl) GetProof(blockID uint32) (*MerkleProof, error) {
+	tree, err := f.MerkleTree()
+	if err != nil {
+		return nil, err
+	}
+	return tree.Proof(blockID)
+}
+
+// recordBlockHash 写入块时记录数据哈希
+func (f *FragmentaImpl) recordBlockHash(blockID uint32, data []byte) {
+	hash := blockHash{size: uint32(len(data)), hash: sha256.Sum256(data)}
+
+	f.merkleMutex.Lock()
+	defer f.merkleMutex.Unlock()
+
+	if f.blockHashes == nil {
+		f.blockHashes = make(map[uint32]blockHash)
+	}
+	f.blockHashes[blockID] = hash
+	f.markMerkleChangedLocked()
+}
+
+// forgetBlockHash 块删除后丢弃数据哈希
+func (f *FragmentaImpl) forgetBlockHash(blockID uint32) {
+	f.merkleMutex.Lock()
+	defer f.merkleMutex.Unlock()
+
+	if _, ok := f.blockHashes[blockID]; ok {
+		delete(f.blockHashes, blockID)
+		f.markMerkleChangedLocked()
+	}
+}
+
+// markMerkleChangedLocked 标记块数据哈希需要写入索引区，调用方需持有merkleMutex
+func (f *FragmentaImpl) markMerkleChangedLocked() {
+	f.merkleChanged = true
+	if !f.readOnly {
+		f.isDirty.Store(true)
+	}
+}
+
+// merkleDirty 块数据哈希是否有未写入索引区的修改
+func (f *FragmentaImpl) merkleDirty() bool {
+	f.merkleMutex.Lock()
+	defer f.merkleMutex.Unlock()
+	return f.merkleChanged
+}
+
+// merkleFlushed 索引区写入后清除修改标记
+func (f *FragmentaImpl) merkleFlushed() {
+	f.merkleMutex.Lock()
+	defer f.merkleMutex.Unlock()
+	f.merkleChanged = false
+}
+
+// encodeMerkleSection 编码索引区中的块数据哈希段，没有哈希时返回nil
+// 格式: 数量 | 记录(块ID | 数据大小 | 数据哈希)...
+func (f *FragmentaImpl) encodeMerkleSection() []byte {
+	f.merkleMutex.Lock()
+	defer f.merkleMutex.Unlock()
+
+	if len(f.blockHashes) == 0 {
+		return nil
+	}
+	ids := make([]uint32, 0, len(f.blockHashes))
+	for blockID := range f.blockHashes {
+		ids = append(ids, blockID)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	buf := make([]byte, 4, 4+len(ids)*(8+sha256.Size))
+	binary.BigEndian.PutUint32(buf, uint32(len(ids)))
+	for _, blockID := range ids {
+		hash := f.blockHashes[blockID]
+		buf = binary.BigEndian.AppendUint32(buf, blockID)
+		buf = binary.BigEndian.AppendUint32(buf, hash.size)
+		buf = append(buf, hash.hash[:]...)
+	}
+	return buf
+}
+
+// loadMerkleSection 打开文件时加载索引区中的块数据哈希，段无效时忽略
+func (f *FragmentaImpl) loadMerkleSection(section []byte) {
+	const recordSize = 8 + sha256.Size
+	if len(section) < 4 {
+		return
+	}
+	count := binary.BigEndian.Uint32(section)
+	if uint64(count)*recordSize != uint64(len(section)-4) {
+		logger.Warn("索引区中的块数据哈希段无效，将重新计算")
+		return
+	}
+
+	f.merkleMutex.Lock()
+	defer f.merkleMutex.Unlock()
+
+	f.blockHashes = make(map[uint32]blockHash, count)
+	for rest := section[4:]; len(rest) > 0; rest = rest[recordSize:] {
+		var hash blockHash
+		hash.size = binary.BigEndian.Uint32(rest[4:])
+		copy(hash.hash[:], rest[8:recordSize])
+		f.blockHashes[binary.BigEndian.Uint32(rest)] = hash
+	}
+}
@@ -0,0 +1,156 @@
+package fragmenta
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// TestMerkleTree 测试Merkle根哈希、存在证明、索引区持久化和副本比较
+func TestMerkleTree(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.frag")
+	f, err := CreateFragmenta(path, nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	var ids []uint32
+	for i := 0; i < 20; i++ {
+		id, err := f.WriteBlock([]byte(fmt.Sprintf("block-%d", i)), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if err := f.LinkBlocks(ids[0], ids[1]); err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := f.GetRootHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		proof, err := f.GetProof(id)
+		if err != nil {
+			t.Fatalf("获取块%d的证明失败: %v", id, err)
+		}
+		if !proof.Verify(root) {
+			t.Errorf("块%d的证明验证失败", id)
+		}
+		header, _ := f.GetBlockInfo(id)
+		data, _ := f.ReadBlock(id)
+		if proof.Leaf != MerkleLeafHash(id, header.BlockType, header.NextBlock, data) {
+			t.Errorf("块%d的叶子哈希不正确", id)
+		}
+	}
+	proof, _ := f.GetProof(ids[3])
+	proof.Leaf[0] ^= 1
+	if proof.Verify(root) {
+		t.Error("篡改的证明不应通过验证")
+	}
+	if _, err := f.GetProof(9999); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("不存在的块应返回ErrBlockNotFound: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开后从索引区加载块数据哈希
+	f, err = OpenFragmenta(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.GetHeader().IndexSize == 0 || len(f.(*FragmentaImpl).blockHashes) != len(ids) {
+		t.Fatalf("索引区应保存块数据哈希: %d, %d", f.GetHeader().IndexSize, len(f.(*FragmentaImpl).blockHashes))
+	}
+	if got, _ := f.GetRootHash(); got != root {
+		t.Error("重新打开后根哈希应不变")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if report, err := Inspect(path); err != nil || len(report.Problems) != 0 {
+		t.Errorf("检查文件结构失败: %v, %v", report, err)
+	}
+
+	// 复制出副本后分别修改，比较得到不同的块
+	data, _ := os.ReadFile(path)
+	replicaPath := filepath.Join(dir, "b.frag")
+	if err := os.WriteFile(replicaPath, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	a, _ := OpenFragmenta(path)
+	defer a.Close()
+	b, _ := OpenFragmenta(replicaPath)
+	defer b.Close()
+
+	a.DeleteBlock(ids[5])
+	a.DeleteBlock(ids[7])
+	a.WriteBlock([]byte("changed"), nil)
+	b.WriteBlock([]byte("extra block"), nil)
+	b.WriteBlock([]byte("another extra block"), nil)
+
+	ta, err := a.MerkleTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tb, err := b.MerkleTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ta.Root() == tb.Root() {
+		t.Fatal("修改后的副本根哈希应不同")
+	}
+	diff, err := DiffMerkle(ta, tb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := differingBlocks(t, a, b); !reflect.DeepEqual(diff, expected) {
+		t.Errorf("副本比较结果不正确: %v, 期望 %v", diff, expected)
+	}
+	if diff, _ := DiffMerkle(ta, ta); len(diff) != 0 {
+		t.Errorf("相同的树不应有差异: %v", diff)
+	}
+}
+
+// differingBlocks 逐块比较两个文件，返回内容不同或只在一方存在的块ID
+func differingBlocks(t *testing.T, a, b Fragmenta) []uint32 {
+	t.Helper()
+
+	contents := func(f Fragmenta) map[uint32][]byte {
+		headers, _ := f.ListBlocks()
+		result := make(map[uint32][]byte)
+		for _, header := range headers {
+			if header.BlockType == SystemBlockType {
+				continue
+			}
+			data, err := f.ReadBlock(header.BlockID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result[header.BlockID] = data
+		}
+		return result
+	}
+	ca, cb := contents(a), contents(b)
+
+	var ids []uint32
+	for id, data := range ca {
+		if other, ok := cb[id]; !ok || !bytes.Equal(other, data) {
+			ids = append(ids, id)
+		}
+	}
+	for id := range cb {
+		if _, ok := ca[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
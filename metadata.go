@@ -3,6 +3,7 @@ package fragmenta
 import (
 	"encoding/binary"
 	"io"
+	"sort"
 	"sync"
 	"time"
 )
@@ -19,6 +20,7 @@ type metadataManagerImpl struct {
 	mutex        sync.RWMutex
 	isDirty      bool
 	lastModified time.Time
+	clock        func() time.Time // 写入文件头的时间戳来源，确定性模式下返回固定时间
 
 	// 格式信息
 	fragmentaHeader *FragmentaHeader
@@ -34,6 +36,7 @@ func NewMetadataManager(header *FragmentaHeader, file io.ReadWriteSeeker) Metada
 		tagIndices:      make(map[uint16][]uint32),
 		fragmentaHeader: header,
 		lastModified:    time.Now(),
+		clock:           time.Now,
 		file:            file,
 	}
 
@@ -142,14 +145,14 @@ func (mm *metadataManagerImpl) SetMetadata(tag uint16, data []byte) error {
 	// 如果是内置标签，需要特殊处理
 	if tag == TagLastModified {
 		// 更新最后修改时间
-		mm.fragmentaHeader.LastModified = time.Now().UnixNano()
+		mm.fragmentaHeader.LastModified = mm.clock().UnixNano()
 	} else if tag == TagCreateTime && mm.fragmentaHeader.Timestamp == 0 {
 		// 如果是创建时间且头部时间戳未设置，则更新头部时间戳
 		var timestamp int64
 		if len(data) >= 8 {
 			timestamp = DecodeInt64(data)
 		} else {
-			timestamp = time.Now().UnixNano()
+			timestamp = mm.clock().UnixNano()
 		}
 		mm.fragmentaHeader.Timestamp = timestamp
 	}
@@ -356,6 +359,13 @@ func (mm *metadataManagerImpl) QueryMetadata(query *MetadataQuery) (*QueryResult
 	return result, nil
 }
 
+// markDirty 标记元数据需要在下次Flush时重写
+func (mm *metadataManagerImpl) markDirty() {
+	mm.mutex.Lock()
+	mm.isDirty = true
+	mm.mutex.Unlock()
+}
+
 // Flush 将元数据刷新到磁盘
 func (mm *metadataManagerImpl) Flush() error {
 	mm.mutex.Lock()
@@ -366,7 +376,7 @@ func (mm *metadataManagerImpl) Flush() error {
 	}
 
 	// 更新最后修改时间
-	mm.lastModified = time.Now()
+	mm.lastModified = mm.clock()
 
 	// 将元数据更新到头部
 	mm.fragmentaHeader.LastModified = mm.lastModified.UnixNano()
@@ -396,8 +406,15 @@ func (mm *metadataManagerImpl) Flush() error {
 		return err
 	}
 
-	// 写入每个元数据项
-	for metaTag, metaData := range mm.metadata {
+	// 按标签顺序写入每个元数据项，相同的元数据总是生成相同的元数据区
+	tags := make([]uint16, 0, len(mm.metadata))
+	for tag := range mm.metadata {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	for _, metaTag := range tags {
+		metaData := mm.metadata[metaTag]
 		// 写入标签
 		err = binary.Write(mm.file, binary.BigEndian, metaTag)
 		if err != nil {
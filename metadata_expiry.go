@@ -0,0 +1,344 @@
+package fragmenta
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultMetadataSweepInterval 后台清理过期元数据的默认间隔
+	DefaultMetadataSweepInterval = time.Minute
+
+	// metadataExpiryTableVersion 元数据过期时间表的编码版本
+	metadataExpiryTableVersion uint8 = 1
+)
+
+// SetMetadataWithTTL 设置元数据，ttl之后过期。
+// 过期的元数据不再能读取、列出或查询到，由 ExpireMetadata 或后台清理（见 StartMetadataSweeper）删除。
+// 确定性模式下返回ErrNondeterministic，可以改用 SetMetadataExpiration 设置固定的过期时间
+func (f *FragmentaImpl) SetMetadataWithTTL(tag uint16, value []byte, ttl time.Duration) error {
+	if err := f.checkNondeterministic("SetMetadataWithTTL"); err != nil {
+		return err
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("%w: 过期时间必须大于0", ErrInvalidArgument)
+	}
+	if err := f.SetMetadata(tag, value); err != nil {
+		return err
+	}
+	return f.SetMetadataExpiration(tag, time.Now().Add(ttl))
+}
+
+// SetMetadataExpiration 设置已有元数据的过期时间，零值取消过期。
+// 过期时间保存在TagMetadataExpiry中，随Commit持久化；之后再设置或删除该元数据时过期时间被清除
+func (f *FragmentaImpl) SetMetadataExpiration(tag uint16, expiresAt time.Time) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	if IsReservedTag(tag) {
+		return ErrProtectedMetadata
+	}
+
+	f.expiryMutex.Lock()
+	defer f.expiryMutex.Unlock()
+
+	if err := f.loadExpirationsLocked(); err != nil {
+		return err
+	}
+	if _, err := f.metadataManager.GetMetadata(tag); err != nil {
+		return err
+	}
+
+	old, existed := f.expirations[tag]
+	if expiresAt.IsZero() {
+		if !existed {
+			return nil
+		}
+		delete(f.expirations, tag)
+	} else {
+		f.expirations[tag] = expiresAt
+	}
+
+	if err := f.saveExpirationsLocked(); err != nil {
+		if existed {
+			f.expirations[tag] = old
+		} else {
+			delete(f.expirations, tag)
+		}
+		return err
+	}
+	return nil
+}
+
+// MetadataExpiration 返回元数据的过期时间，未设置过期时间时返回false
+func (f *FragmentaImpl) MetadataExpiration(tag uint16) (time.Time, bool) {
+	f.expiryMutex.Lock()
+	defer f.expiryMutex.Unlock()
+
+	if err := f.loadExpirationsLocked(); err != nil {
+		return time.Time{}, false
+	}
+	expiresAt, ok := f.expirations[tag]
+	return expiresAt, ok
+}
+
+// ExpireMetadata 删除所有已过期的元数据，返回删除的项数。
+// 删除与 DeleteMetadata 一样记录元数据历史和审计，但不进入回收站
+func (f *FragmentaImpl) ExpireMetadata() (int, error) {
+	if f.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	f.expiryMutex.Lock()
+	if err := f.loadExpirationsLocked(); err != nil {
+		f.expiryMutex.Unlock()
+		return 0, err
+	}
+
+	now := time.Now()
+	var expired []uint16
+	for tag, expiresAt := range f.expirations {
+		if !now.Before(expiresAt) {
+			expired = append(expired, tag)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool { return expired[i] < expired[j] })
+
+	var firstErr error
+	removed := expired[:0]
+	for _, tag := range expired {
+		if err := f.metadataManager.DeleteMetadata(tag); err != nil && err != ErrMetadataNotFound {
+			logger.Error("删除过期元数据失败", "tag", tag, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		delete(f.expirations, tag)
+		removed = append(removed, tag)
+	}
+	if len(removed) > 0 {
+		f.isDirty.Store(true)
+		if err := f.saveExpirationsLocked(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	f.expiryMutex.Unlock()
+
+	// 记录修改时会清除过期时间，需在释放expiryMutex之后
+	for _, tag := range removed {
+		f.recordMetadataChange(auditMetadataDelete, tag, nil)
+	}
+	if len(removed) > 0 {
+		logger.Info("已删除过期元数据", "count", len(removed))
+	}
+	return len(removed), firstErr
+}
+
+// StartMetadataSweeper 启动后台协程，按指定间隔调用 ExpireMetadata。
+// interval 不大于0时使用DefaultMetadataSweepInterval；已启动时不做任何事。Close时自动停止。
+// 确定性模式下返回ErrNondeterministic
+func (f *FragmentaImpl) StartMetadataSweeper(interval time.Duration) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	if err := f.checkNondeterministic("StartMetadataSweeper"); err != nil {
+		return err
+	}
+	if interval <= 0 {
+		interval = DefaultMetadataSweepInterval
+	}
+
+	f.sweeperMutex.Lock()
+	defer f.sweeperMutex.Unlock()
+
+	if f.sweeperStopCh != nil {
+		return nil
+	}
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	f.sweeperStopCh = stopCh
+	f.sweeperDoneCh = doneCh
+
+	go f.metadataSweepLoop(interval, stopCh, doneCh)
+
+	logger.Info("已启动过期元数据后台清理", "interval", interval)
+	return nil
+}
+
+// StopMetadataSweeper 停止后台清理协程，并等待正在进行的一轮结束
+func (f *FragmentaImpl) StopMetadataSweeper() {
+	f.sweeperMutex.Lock()
+	stopCh := f.sweeperStopCh
+	doneCh := f.sweeperDoneCh
+	f.sweeperStopCh = nil
+	f.sweeperDoneCh = nil
+	f.sweeperMutex.Unlock()
+
+	if stopCh == nil {
+		return
+	}
+
+	close(stopCh)
+	<-doneCh
+}
+
+// metadataSweepLoop 后台清理循环
+func (f *FragmentaImpl) metadataSweepLoop(interval time.Duration, stopCh <-chan struct{}, doneCh chan<- struct{}) {
+	defer close(doneCh)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := f.ExpireMetadata(); err != nil {
+				logger.Error("后台清理过期元数据失败", "error", err)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// isMetadataExpired 元数据是否已过期（尚未被删除）
+func (f *FragmentaImpl) isMetadataExpired(tag uint16) bool {
+	f.expiryMutex.Lock()
+	defer f.expiryMutex.Unlock()
+
+	if err := f.loadExpirationsLocked(); err != nil {
+		return false
+	}
+	expiresAt, ok := f.expirations[tag]
+	return ok && !time.Now().Before(expiresAt)
+}
+
+// expiredMetadata 返回已过期但尚未删除的标签集合，没有时返回nil
+func (f *FragmentaImpl) expiredMetadata() map[uint16]struct{} {
+	f.expiryMutex.Lock()
+	defer f.expiryMutex.Unlock()
+
+	if err := f.loadExpirationsLocked(); err != nil {
+		return nil
+	}
+
+	var expired map[uint16]struct{}
+	now := time.Now()
+	for tag, expiresAt := range f.expirations {
+		if now.Before(expiresAt) {
+			continue
+		}
+		if expired == nil {
+			expired = make(map[uint16]struct{})
+		}
+		expired[tag] = struct{}{}
+	}
+	return expired
+}
+
+// clearMetadataExpiration 元数据被设置或删除后清除它的过期时间
+func (f *FragmentaImpl) clearMetadataExpiration(tag uint16) {
+	if IsReservedTag(tag) {
+		return
+	}
+
+	f.expiryMutex.Lock()
+	defer f.expiryMutex.Unlock()
+
+	if err := f.loadExpirationsLocked(); err != nil {
+		logger.Warn("加载元数据过期时间表失败", "tag", tag, "error", err)
+		return
+	}
+	if _, ok := f.expirations[tag]; !ok {
+		return
+	}
+
+	delete(f.expirations, tag)
+	if err := f.saveExpirationsLocked(); err != nil {
+		logger.Warn("保存元数据过期时间表失败", "tag", tag, "error", err)
+	}
+}
+
+// loadExpirationsLocked 首次使用时从TagMetadataExpiry加载过期时间表，调用方需持有expiryMutex
+func (f *FragmentaImpl) loadExpirationsLocked() error {
+	if f.expirations != nil {
+		return nil
+	}
+
+	data, err := f.metadataManager.GetMetadata(TagMetadataExpiry)
+	if err == ErrMetadataNotFound {
+		f.expirations = make(map[uint16]time.Time)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	expirations, err := decodeMetadataExpirations(data)
+	if err != nil {
+		logger.Error("加载元数据过期时间表失败", "error", err)
+		return err
+	}
+	f.expirations = expirations
+	return nil
+}
+
+// saveExpirationsLocked 保存过期时间表，表为空时删除TagMetadataExpiry。调用方需持有expiryMutex
+func (f *FragmentaImpl) saveExpirationsLocked() error {
+	if len(f.expirations) == 0 {
+		if err := f.metadataManager.DeleteMetadata(TagMetadataExpiry); err != nil && err != ErrMetadataNotFound {
+			logger.Error("删除元数据过期时间表失败", "error", err)
+			return err
+		}
+		f.isDirty.Store(true)
+		return nil
+	}
+
+	if err := f.setMetadata(TagMetadataExpiry, encodeMetadataExpirations(f.expirations)); err != nil {
+		logger.Error("保存元数据过期时间表失败", "error", err)
+		return err
+	}
+	return nil
+}
+
+// encodeMetadataExpirations 编码过期时间表
+// 格式: 版本 | 数量 | 记录...，记录为 标签 | 过期时间（Unix纳秒），按标签排序
+func encodeMetadataExpirations(expirations map[uint16]time.Time) []byte {
+	tags := make([]uint16, 0, len(expirations))
+	for tag := range expirations {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	buf := make([]byte, 3, 3+len(tags)*10)
+	buf[0] = metadataExpiryTableVersion
+	binary.BigEndian.PutUint16(buf[1:], uint16(len(tags)))
+	for _, tag := range tags {
+		buf = binary.BigEndian.AppendUint16(buf, tag)
+		buf = binary.BigEndian.AppendUint64(buf, uint64(expirations[tag].UnixNano()))
+	}
+	return buf
+}
+
+// decodeMetadataExpirations 解码过期时间表
+func decodeMetadataExpirations(data []byte) (map[uint16]time.Time, error) {
+	if len(data) < 3 || data[0] != metadataExpiryTableVersion {
+		return nil, fmt.Errorf("%w: 无效的元数据过期时间表", ErrIndexCorruption)
+	}
+
+	count := int(binary.BigEndian.Uint16(data[1:]))
+	if len(data) != 3+count*10 {
+		return nil, fmt.Errorf("%w: 元数据过期时间表长度不符", ErrIndexCorruption)
+	}
+
+	expirations := make(map[uint16]time.Time, count)
+	for data = data[3:]; len(data) > 0; data = data[10:] {
+		tag := binary.BigEndian.Uint16(data)
+		expirations[tag] = time.Unix(0, int64(binary.BigEndian.Uint64(data[2:])))
+	}
+	return expirations, nil
+}
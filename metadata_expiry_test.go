@@ -0,0 +1,95 @@
+package fragmenta
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestMetadataExpiry 测试元数据过期
+func TestMetadataExpiry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.frag")
+	f, err := CreateFragmenta(path, nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+
+	marker := UserTag(1)
+	if err := f.SetMetadataWithTTL(marker, []byte("processing"), time.Hour); err != nil {
+		t.Fatalf("设置元数据失败: %v", err)
+	}
+	f.SetMetadata(TagTitle, []byte("title"))
+	if err := f.SetMetadataExpiration(TagTitle, time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("设置过期时间失败: %v", err)
+	}
+	if err := f.SetMetadataExpiration(TagFlags, time.Now()); !errors.Is(err, ErrProtectedMetadata) {
+		t.Errorf("保留标签不能设置过期时间: %v", err)
+	}
+
+	// 过期后不可见
+	if _, err := f.GetMetadata(TagTitle); !errors.Is(err, ErrMetadataNotFound) {
+		t.Errorf("过期的元数据不应可读: %v", err)
+	}
+	if metadata, _ := f.ListMetadata(); metadata[TagTitle] != nil || metadata[marker] == nil {
+		t.Errorf("元数据列表不正确: %v", metadata)
+	}
+	if entries, _ := f.QueryByTag(TagTitle, []byte("title")); len(entries) != 0 {
+		t.Errorf("查询不应返回过期的元数据: %v", entries)
+	}
+	if expiresAt, ok := f.MetadataExpiration(marker); !ok || time.Until(expiresAt) < 59*time.Minute {
+		t.Errorf("过期时间不正确: %v, %v", expiresAt, ok)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+
+	// 过期时间随文件保存
+	f, err = OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer f.Close()
+
+	if _, ok := f.MetadataExpiration(marker); !ok {
+		t.Errorf("重新打开后过期时间应保留")
+	}
+	if n, err := f.ExpireMetadata(); err != nil || n != 1 {
+		t.Errorf("应删除1项过期元数据: %d, %v", n, err)
+	}
+	if _, ok := f.MetadataExpiration(TagTitle); ok {
+		t.Errorf("删除过期元数据后应清除过期时间")
+	}
+	if n, _ := f.ExpireMetadata(); n != 0 {
+		t.Errorf("过期元数据应已被删除: %d", n)
+	}
+
+	// 重新设置清除过期时间
+	f.SetMetadata(marker, []byte("done"))
+	if _, ok := f.MetadataExpiration(marker); ok {
+		t.Errorf("重新设置后过期时间应被清除")
+	}
+	if _, err := f.GetMetadata(TagMetadataExpiry); !errors.Is(err, ErrMetadataNotFound) {
+		t.Errorf("没有过期时间时不应有过期时间表: %v", err)
+	}
+
+	// 后台清理
+	if err := f.SetMetadataWithTTL(marker, []byte("temp"), 10*time.Millisecond); err != nil {
+		t.Fatalf("设置元数据失败: %v", err)
+	}
+	if err := f.StartMetadataSweeper(5 * time.Millisecond); err != nil {
+		t.Fatalf("启动后台清理失败: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, ok := f.MetadataExpiration(marker); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("后台清理未删除过期元数据")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	f.StopMetadataSweeper()
+}
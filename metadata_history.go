@@ -0,0 +1,378 @@
+package fragmenta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// 元数据历史表常量
+const (
+	// MetadataHistoryMagic 元数据历史表魔数 "FHIS"
+	MetadataHistoryMagic uint32 = 0x46484953
+	// MetadataHistoryVersion 元数据历史表版本
+	MetadataHistoryVersion uint16 = 1
+)
+
+// MetadataHistoryOptions 元数据历史的保留策略
+type MetadataHistoryOptions struct {
+	MaxVersions int           // 每个标签最多保留的版本数，0表示不限制
+	MaxAge      time.Duration // 版本的最长保留时间，0表示不限制；每个标签的最新版本总是保留
+}
+
+// MetadataVersion 元数据的一个历史版本
+type MetadataVersion struct {
+	Value     []byte    // 修改后的值，删除时为nil
+	Deleted   bool      // 是否是删除操作
+	Timestamp time.Time // 修改时间
+}
+
+// metadataHistory 元数据历史表
+type metadataHistory struct {
+	options  MetadataHistoryOptions
+	versions map[uint16][]MetadataVersion
+	dirty    bool
+}
+
+// EnableMetadataHistory 启用元数据历史，或修改已启用历史的保留策略。
+// 启用后每次设置或删除元数据（保留标签除外）都保存一个带时间戳的版本，可以用 GetMetadataAt 读取
+// 过去某一时刻的值、用 ListMetadataVersions 列出版本。启用时为当前所有元数据保存初始版本。
+// 历史表保存在系统块中（位置记录在TagMetadataHistory），随Commit持久化，重新打开文件后继续生效
+func (f *FragmentaImpl) EnableMetadataHistory(options MetadataHistoryOptions) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	if options.MaxVersions < 0 || options.MaxAge < 0 {
+		return fmt.Errorf("%w: 保留版本数和保留时间不能为负数", ErrInvalidArgument)
+	}
+
+	f.historyMutex.Lock()
+	defer f.historyMutex.Unlock()
+
+	if err := f.loadHistoryLocked(); err != nil {
+		return err
+	}
+
+	if f.history == nil {
+		metadata, err := f.metadataManager.ListMetadata()
+		if err != nil {
+			return err
+		}
+
+		now := f.now()
+		f.history = &metadataHistory{versions: make(map[uint16][]MetadataVersion)}
+		for tag, value := range metadata {
+			if IsReservedTag(tag) {
+				continue
+			}
+			f.history.versions[tag] = []MetadataVersion{{Value: append([]byte(nil), value...), Timestamp: now}}
+		}
+		logger.Info("已启用元数据历史", "tags", len(f.history.versions))
+	}
+
+	f.history.options = options
+	for tag := range f.history.versions {
+		f.history.prune(tag, f.now())
+	}
+	f.history.dirty = true
+	f.isDirty.Store(true)
+	return nil
+}
+
+// DisableMetadataHistory 停用元数据历史并丢弃已保存的所有版本
+func (f *FragmentaImpl) DisableMetadataHistory() error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+
+	f.historyMutex.Lock()
+	defer f.historyMutex.Unlock()
+
+	if err := f.loadHistoryLocked(); err != nil {
+		return err
+	}
+	if f.history == nil {
+		return nil
+	}
+
+	if err := f.metadataManager.DeleteMetadata(TagMetadataHistory); err != nil && err != ErrMetadataNotFound {
+		logger.Error("删除元数据历史表位置失败", "error", err)
+		return err
+	}
+	f.freeHistoryBlockLocked()
+	f.history = nil
+	f.isDirty.Store(true)
+
+	logger.Info("已停用元数据历史")
+	return nil
+}
+
+// GetMetadataAt 读取元数据在时刻t的值。t早于最早保留的版本，或当时元数据不存在或已删除时返回ErrMetadataNotFound
+func (f *FragmentaImpl) GetMetadataAt(tag uint16, t time.Time) ([]byte, error) {
+	f.historyMutex.Lock()
+	defer f.historyMutex.Unlock()
+
+	if err := f.loadHistoryLocked(); err != nil {
+		return nil, err
+	}
+	if f.history == nil {
+		return nil, ErrMetadataHistoryDisabled
+	}
+
+	versions := f.history.versions[tag]
+	i := sort.Search(len(versions), func(i int) bool { return versions[i].Timestamp.After(t) })
+	if i == 0 || versions[i-1].Deleted {
+		return nil, ErrMetadataNotFound
+	}
+	return append([]byte(nil), versions[i-1].Value...), nil
+}
+
+// ListMetadataVersions 列出元数据保留的所有版本，按时间从早到晚排列
+func (f *FragmentaImpl) ListMetadataVersions(tag uint16) ([]MetadataVersion, error) {
+	f.historyMutex.Lock()
+	defer f.historyMutex.Unlock()
+
+	if err := f.loadHistoryLocked(); err != nil {
+		return nil, err
+	}
+	if f.history == nil {
+		return nil, ErrMetadataHistoryDisabled
+	}
+
+	versions := make([]MetadataVersion, len(f.history.versions[tag]))
+	for i, version := range f.history.versions[tag] {
+		version.Value = append([]byte(nil), version.Value...)
+		versions[i] = version
+	}
+	return versions, nil
+}
+
+// recordMetadataVersion 启用元数据历史时保存元数据的新版本，保留标签不记录
+func (f *FragmentaImpl) recordMetadataVersion(tag uint16, value []byte, deleted bool) {
+	if IsReservedTag(tag) {
+		return
+	}
+
+	f.historyMutex.Lock()
+	defer f.historyMutex.Unlock()
+
+	if err := f.loadHistoryLocked(); err != nil {
+		logger.Warn("加载元数据历史失败，未记录版本", "tag", tag, "error", err)
+		return
+	}
+	if f.history == nil {
+		return
+	}
+
+	now := f.now()
+	version := MetadataVersion{Deleted: deleted, Timestamp: now}
+	if !deleted {
+		version.Value = append([]byte(nil), value...)
+	}
+	f.history.versions[tag] = append(f.history.versions[tag], version)
+	f.history.prune(tag, now)
+	f.history.dirty = true
+}
+
+// prune 按保留策略删除标签的旧版本，最新版本总是保留
+func (h *metadataHistory) prune(tag uint16, now time.Time) {
+	versions := h.versions[tag]
+	drop := 0
+	if h.options.MaxVersions > 0 && len(versions) > h.options.MaxVersions {
+		drop = len(versions) - h.options.MaxVersions
+	}
+	if h.options.MaxAge > 0 {
+		cutoff := now.Add(-h.options.MaxAge)
+		for drop < len(versions)-1 && versions[drop].Timestamp.Before(cutoff) {
+			drop++
+		}
+	}
+	if drop > 0 {
+		h.versions[tag] = append([]MetadataVersion(nil), versions[drop:]...)
+	}
+}
+
+// loadHistoryLocked 首次使用时从TagMetadataHistory加载元数据历史表，未启用时f.history为nil。
+// 调用方需持有historyMutex
+func (f *FragmentaImpl) loadHistoryLocked() error {
+	if f.historyLoaded {
+		return nil
+	}
+
+	value, err := f.metadataManager.GetMetadata(TagMetadataHistory)
+	if err == ErrMetadataNotFound {
+		f.historyLoaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	blockID := uint32(DecodeInt64(value))
+	table, err := f.ReadBlock(blockID)
+	if err != nil {
+		logger.Error("读取元数据历史表失败", "blockID", blockID, "error", err)
+		return err
+	}
+	history, err := decodeMetadataHistory(table)
+	if err != nil {
+		logger.Error("解析元数据历史表失败", "blockID", blockID, "error", err)
+		return err
+	}
+
+	f.history = history
+	f.historyBlock = blockID
+	f.historyLoaded = true
+	return nil
+}
+
+// syncMetadataHistory 将有修改的元数据历史表写入新的系统块并更新TagMetadataHistory，在提交时调用
+func (f *FragmentaImpl) syncMetadataHistory() error {
+	f.historyMutex.Lock()
+	defer f.historyMutex.Unlock()
+
+	if f.history == nil || !f.history.dirty {
+		return nil
+	}
+
+	table, err := encodeMetadataHistory(f.history)
+	if err != nil {
+		return err
+	}
+
+	blockID, err := f.writeBlock(table, &BlockOptions{BlockType: SystemBlockType, Checksum: true})
+	if err != nil {
+		logger.Error("写入元数据历史表失败", "error", err)
+		return err
+	}
+	if err := f.setMetadata(TagMetadataHistory, EncodeInt64(int64(blockID))); err != nil {
+		logger.Error("更新元数据历史表位置失败", "error", err)
+		return err
+	}
+
+	f.freeHistoryBlockLocked()
+	f.historyBlock = blockID
+	f.history.dirty = false
+	return nil
+}
+
+// freeHistoryBlockLocked 释放旧的元数据历史表块，调用方需持有historyMutex
+func (f *FragmentaImpl) freeHistoryBlockLocked() {
+	if f.historyBlock == 0 {
+		return
+	}
+
+	// 直接由块管理器释放，与块签名表相同
+	if err := f.blockManager.DeleteBlock(f.historyBlock); err != nil {
+		logger.Warn("释放旧元数据历史表失败", "blockID", f.historyBlock, "error", err)
+	} else {
+		if err := f.unstoreBlock(f.historyBlock); err != nil {
+			logger.Warn("从块存储删除旧元数据历史表失败", "blockID", f.historyBlock, "error", err)
+		}
+		if err := f.queryRemoveBlock(f.historyBlock); err != nil {
+			logger.Warn("移除旧元数据历史表的查询索引失败", "blockID", f.historyBlock, "error", err)
+		}
+	}
+	f.historyBlock = 0
+}
+
+// encodeMetadataHistory 编码元数据历史表
+// 格式: 魔数 | 版本 | 最多版本数 | 最长保留时间 | 标签数量 |
+// 标签记录(标签 | 版本数量 | 版本记录(时间戳 | 删除标志 | 值长度 | 值)...)...
+func encodeMetadataHistory(history *metadataHistory) ([]byte, error) {
+	tags := make([]uint16, 0, len(history.versions))
+	for tag := range history.versions {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	buf := new(bytes.Buffer)
+	fields := []interface{}{
+		MetadataHistoryMagic, MetadataHistoryVersion,
+		uint32(history.options.MaxVersions), int64(history.options.MaxAge), uint32(len(tags)),
+	}
+	for _, tag := range tags {
+		versions := history.versions[tag]
+		fields = append(fields, tag, uint32(len(versions)))
+		for _, version := range versions {
+			var deleted uint8
+			if version.Deleted {
+				deleted = 1
+			}
+			fields = append(fields, version.Timestamp.UnixNano(), deleted, uint32(len(version.Value)), version.Value)
+		}
+	}
+
+	for _, field := range fields {
+		if err := binary.Write(buf, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("编码元数据历史表失败: %w", err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeMetadataHistory 解析元数据历史表
+func decodeMetadataHistory(table []byte) (*metadataHistory, error) {
+	r := bytes.NewReader(table)
+
+	var magic, maxVersions, count uint32
+	var version uint16
+	var maxAge int64
+	for _, field := range []interface{}{&magic, &version, &maxVersions, &maxAge, &count} {
+		if err := binary.Read(r, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("%w: 元数据历史表头不完整", ErrInvalidFragmenta)
+		}
+	}
+	if magic != MetadataHistoryMagic {
+		return nil, fmt.Errorf("%w: 元数据历史表魔数错误", ErrInvalidFragmenta)
+	}
+	if version > MetadataHistoryVersion {
+		return nil, ErrUnsupportedVersion
+	}
+
+	history := &metadataHistory{
+		options:  MetadataHistoryOptions{MaxVersions: int(maxVersions), MaxAge: time.Duration(maxAge)},
+		versions: make(map[uint16][]MetadataVersion, count),
+	}
+	for i := uint32(0); i < count; i++ {
+		var tag uint16
+		var n uint32
+		for _, field := range []interface{}{&tag, &n} {
+			if err := binary.Read(r, binary.BigEndian, field); err != nil {
+				return nil, fmt.Errorf("%w: 元数据历史记录不完整", ErrInvalidFragmenta)
+			}
+		}
+
+		versions := make([]MetadataVersion, 0, n)
+		for j := uint32(0); j < n; j++ {
+			var timestamp int64
+			var deleted uint8
+			var size uint32
+			for _, field := range []interface{}{&timestamp, &deleted, &size} {
+				if err := binary.Read(r, binary.BigEndian, field); err != nil {
+					return nil, fmt.Errorf("%w: 元数据版本记录不完整", ErrInvalidFragmenta)
+				}
+			}
+			if int64(size) > int64(r.Len()) {
+				return nil, fmt.Errorf("%w: 元数据版本记录不完整", ErrInvalidFragmenta)
+			}
+
+			v := MetadataVersion{Deleted: deleted != 0, Timestamp: time.Unix(0, timestamp)}
+			value := make([]byte, size)
+			if _, err := io.ReadFull(r, value); err != nil {
+				return nil, fmt.Errorf("%w: 元数据版本记录不完整", ErrInvalidFragmenta)
+			}
+			if !v.Deleted {
+				v.Value = value
+			}
+			versions = append(versions, v)
+		}
+		history.versions[tag] = versions
+	}
+
+	return history, nil
+}
@@ -0,0 +1,118 @@
+package fragmenta
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestMetadataHistory 测试元数据历史和按时间读取
+func TestMetadataHistory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.frag")
+	f, err := CreateFragmenta(path, nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+
+	if _, err := f.GetMetadataAt(TagTitle, time.Now()); !errors.Is(err, ErrMetadataHistoryDisabled) {
+		t.Errorf("未启用历史时应返回ErrMetadataHistoryDisabled: %v", err)
+	}
+
+	// 每次修改后记录时间点
+	tick := func() time.Time {
+		time.Sleep(2 * time.Millisecond)
+		now := time.Now()
+		time.Sleep(2 * time.Millisecond)
+		return now
+	}
+
+	f.SetMetadata(TagTitle, []byte("v1"))
+	if err := f.EnableMetadataHistory(MetadataHistoryOptions{}); err != nil {
+		t.Fatalf("启用元数据历史失败: %v", err)
+	}
+	t1 := tick()
+	f.SetMetadata(TagTitle, []byte("v2"))
+	t2 := tick()
+	f.DeleteMetadata(TagTitle)
+	t3 := tick()
+	f.SetMetadata(TagTitle, []byte("v3"))
+
+	check := func(at time.Time, want string) {
+		t.Helper()
+		value, err := f.GetMetadataAt(TagTitle, at)
+		if want == "" {
+			if !errors.Is(err, ErrMetadataNotFound) {
+				t.Errorf("读取 %v 时的值应返回ErrMetadataNotFound: %q, %v", at, value, err)
+			}
+			return
+		}
+		if err != nil || string(value) != want {
+			t.Errorf("读取 %v 时的值不正确: 期望 %q，实际 %q, %v", at, want, value, err)
+		}
+	}
+	check(t1, "v1")
+	check(t2, "v2")
+	check(t3, "")
+	check(time.Now(), "v3")
+	check(t1.Add(-time.Hour), "")
+
+	versions, err := f.ListMetadataVersions(TagTitle)
+	if err != nil || len(versions) != 4 || !versions[2].Deleted {
+		t.Fatalf("版本列表不正确: %+v, %v", versions, err)
+	}
+
+	// 保留标签不记录历史
+	if versions, _ := f.ListMetadataVersions(TagNamespace); len(versions) != 0 {
+		t.Errorf("保留标签不应记录历史: %v", versions)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+
+	// 历史随文件保存，重新打开后继续记录
+	f, err = OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer f.Close()
+
+	check(t2, "v2")
+	f.SetMetadata(TagTitle, []byte("v4"))
+	if versions, _ := f.ListMetadataVersions(TagTitle); len(versions) != 5 {
+		t.Errorf("重新打开后应继续记录版本: %d", len(versions))
+	}
+
+	// 按版本数保留
+	if err := f.EnableMetadataHistory(MetadataHistoryOptions{MaxVersions: 2}); err != nil {
+		t.Fatalf("修改保留策略失败: %v", err)
+	}
+	versions, _ = f.ListMetadataVersions(TagTitle)
+	if len(versions) != 2 || string(versions[1].Value) != "v4" {
+		t.Errorf("应只保留最近2个版本: %+v", versions)
+	}
+	check(t2, "")
+
+	// 按时间保留，最新版本总是保留
+	time.Sleep(2 * time.Millisecond)
+	if err := f.EnableMetadataHistory(MetadataHistoryOptions{MaxAge: time.Millisecond}); err != nil {
+		t.Fatalf("修改保留策略失败: %v", err)
+	}
+	if versions, _ := f.ListMetadataVersions(TagTitle); len(versions) != 1 || string(versions[0].Value) != "v4" {
+		t.Errorf("应只保留最新版本: %+v", versions)
+	}
+
+	if err := f.DisableMetadataHistory(); err != nil {
+		t.Fatalf("停用元数据历史失败: %v", err)
+	}
+	if _, err := f.ListMetadataVersions(TagTitle); !errors.Is(err, ErrMetadataHistoryDisabled) {
+		t.Errorf("停用后应返回ErrMetadataHistoryDisabled: %v", err)
+	}
+	if err := f.Commit(); err != nil {
+		t.Fatalf("提交失败: %v", err)
+	}
+	if _, err := f.GetMetadata(TagMetadataHistory); !errors.Is(err, ErrMetadataNotFound) {
+		t.Errorf("停用后不应再有元数据历史表: %v", err)
+	}
+}
@@ -0,0 +1,331 @@
+package fragmenta
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Migration 一个格式升级步骤，把文件从From版本升级到To版本
+// Apply在组件初始化之前调用，只能通过file和header访问文件；
+// 返回后框架把header.Version设为To，全部步骤完成后统一写入文件头
+type Migration struct {
+	From        uint16
+	To          uint16
+	Description string
+	Apply       func(file *os.File, header *FragmentaHeader) error
+}
+
+// MigrationOptions 迁移选项
+type MigrationOptions struct {
+	DryRun     bool   // 只生成迁移计划，不修改文件
+	Backup     bool   // 迁移前备份原文件，迁移失败时从备份恢复
+	BackupPath string // 备份文件路径，为空时使用"<文件>.v<主版本>.<次版本>.bak"
+}
+
+// MigrationReport 迁移结果
+type MigrationReport struct {
+	FromVersion uint16   `json:"fromVersion"`
+	ToVersion   uint16   `json:"toVersion"`
+	Steps       []string `json:"steps"` // 按执行顺序排列的步骤描述
+	BackupPath  string   `json:"backupPath,omitempty"`
+	DryRun      bool     `json:"dryRun"`
+}
+
+// DefaultMigrationOptions 返回打开文件时使用的迁移选项
+func DefaultMigrationOptions() *MigrationOptions {
+	return &MigrationOptions{Backup: true}
+}
+
+// migrations 已注册的迁移步骤，按From版本索引
+var (
+	migrations     = make(map[uint16]Migration)
+	migrationMutex sync.RWMutex
+)
+
+func init() {
+	RegisterMigration(Migration{
+		From:        0x0100,
+		To:          0x0101,
+		Description: "为影子文件头腾出空间",
+		Apply:       migrateShadowHeader,
+	})
+}
+
+// RegisterMigration 注册迁移步骤，每个版本只能有一个升级步骤
+func RegisterMigration(m Migration) error {
+	if m.To <= m.From || m.To > CurrentVersion || m.Apply == nil {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidMigration, versionString(m.From), versionString(m.To))
+	}
+
+	migrationMutex.Lock()
+	defer migrationMutex.Unlock()
+
+	if _, exists := migrations[m.From]; exists {
+		return fmt.Errorf("%w: 版本%s已注册升级步骤", ErrInvalidMigration, versionString(m.From))
+	}
+	migrations[m.From] = m
+	return nil
+}
+
+// ListMigrations 返回按起始版本排序的全部迁移步骤
+func ListMigrations() []Migration {
+	migrationMutex.RLock()
+	defer migrationMutex.RUnlock()
+
+	result := make([]Migration, 0, len(migrations))
+	for _, m := range migrations {
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].From < result[j].From })
+	return result
+}
+
+// PlanMigration 返回把指定版本升级到当前版本所需的步骤
+// 没有升级路径时，不低于MinSupportedVersion的版本可以原样打开，返回空计划；否则返回ErrUnsupportedVersion
+func PlanMigration(version uint16) ([]Migration, error) {
+	if version > CurrentVersion {
+		return nil, ErrUnsupportedVersion
+	}
+
+	migrationMutex.RLock()
+	defer migrationMutex.RUnlock()
+
+	var plan []Migration
+	for v := version; v < CurrentVersion; {
+		m, ok := migrations[v]
+		if !ok {
+			if version >= MinSupportedVersion {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("%w: 没有从%s升级的路径", ErrUnsupportedVersion, versionString(v))
+		}
+		plan = append(plan, m)
+		v = m.To
+	}
+	return plan, nil
+}
+
+// MigrateFile 把存储文件升级到当前版本
+func MigrateFile(path string, options *MigrationOptions) (*MigrationReport, error) {
+	if options == nil {
+		options = DefaultMigrationOptions()
+	}
+
+	if options.DryRun {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		f := &FragmentaImpl{path: path, file: file, readOnly: true}
+		if err := f.readHeader(); err != nil {
+			return nil, err
+		}
+		if err := f.validateHeader(); err != nil {
+			return nil, err
+		}
+		report, err := f.migrate(options)
+		if err != nil || report != nil {
+			return report, err
+		}
+		return &MigrationReport{FromVersion: f.header.Version, ToVersion: f.header.Version, DryRun: true}, nil
+	}
+
+	f, report, err := openExisting(path, &OpenOptions{Migration: options})
+	if err != nil {
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	if report == nil {
+		if f.header.Version < CurrentVersion {
+			return nil, fmt.Errorf("%w: 文件需要从%s升级", ErrReadOnly, versionString(f.header.Version))
+		}
+		report = &MigrationReport{FromVersion: f.header.Version, ToVersion: f.header.Version}
+	}
+	return report, nil
+}
+
+// migrate 执行迁移计划并写入文件头，无需迁移时返回nil
+// 调用方需在组件初始化之前调用
+func (f *FragmentaImpl) migrate(options *MigrationOptions) (*MigrationReport, error) {
+	plan, err := PlanMigration(f.header.Version)
+	if err != nil || len(plan) == 0 {
+		return nil, err
+	}
+
+	report := &MigrationReport{
+		FromVersion: f.header.Version,
+		ToVersion:   plan[len(plan)-1].To,
+		DryRun:      options.DryRun,
+	}
+	for _, m := range plan {
+		report.Steps = append(report.Steps, fmt.Sprintf("%s -> %s: %s", versionString(m.From), versionString(m.To), m.Description))
+	}
+	if options.DryRun {
+		return report, nil
+	}
+	if f.readOnly {
+		if report.FromVersion >= MinSupportedVersion {
+			logger.Warn("只读文件无法升级，按原版本打开", "path", f.path, "version", versionString(report.FromVersion))
+			return nil, nil
+		}
+		return nil, fmt.Errorf("%w: 文件需要从%s升级", ErrReadOnly, versionString(report.FromVersion))
+	}
+
+	var backup *os.File
+	if options.Backup {
+		report.BackupPath = options.BackupPath
+		if report.BackupPath == "" {
+			report.BackupPath = fmt.Sprintf("%s.v%s.bak", f.path, versionString(report.FromVersion))
+		}
+		if backup, err = f.backupTo(report.BackupPath); err != nil {
+			logger.Error("备份文件失败", "path", report.BackupPath, "error", err)
+			return nil, err
+		}
+		defer backup.Close()
+	}
+
+	header := f.header
+	for _, m := range plan {
+		if err = m.Apply(f.file, &header); err != nil {
+			logger.Error("迁移失败", "from", versionString(m.From), "to", versionString(m.To), "error", err)
+			break
+		}
+		header.Version = m.To
+	}
+	if err == nil {
+		f.header = header
+		err = f.writeHeader()
+	}
+
+	if err != nil {
+		if backup != nil {
+			if restoreErr := f.restoreFrom(backup); restoreErr != nil {
+				logger.Error("从备份恢复失败", "path", report.BackupPath, "error", restoreErr)
+				return nil, fmt.Errorf("迁移失败: %w，从备份恢复也失败: %v", err, restoreErr)
+			}
+		}
+		return nil, fmt.Errorf("迁移失败: %w", err)
+	}
+
+	logger.Debug("文件已升级", "path", f.path, "from", versionString(report.FromVersion), "to", versionString(report.ToVersion))
+	return report, nil
+}
+
+// backupTo 把文件完整复制到备份路径，返回打开的备份文件
+func (f *FragmentaImpl) backupTo(path string) (*os.File, error) {
+	backup, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := f.file.Stat()
+	if err == nil {
+		_, err = io.Copy(backup, io.NewSectionReader(f.file, 0, stat.Size()))
+	}
+	if err == nil {
+		err = backup.Sync()
+	}
+	if err != nil {
+		backup.Close()
+		return nil, err
+	}
+	return backup, nil
+}
+
+// restoreFrom 用备份内容覆盖文件
+func (f *FragmentaImpl) restoreFrom(backup *os.File) error {
+	stat, err := backup.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(io.NewOffsetWriter(f.file, 0), io.NewSectionReader(backup, 0, stat.Size())); err != nil {
+		return err
+	}
+	if err := f.file.Truncate(stat.Size()); err != nil {
+		return err
+	}
+	if err := f.file.Sync(); err != nil {
+		return err
+	}
+	return f.readHeader()
+}
+
+// migrateShadowHeader 1.0 -> 1.1：旧文件的元数据区或块区占用了影子文件头槽位，
+// 把块区整体后移到HeaderSize，元数据区和索引区依次放在块区之后，然后设置FlagShadowHeader
+func migrateShadowHeader(file *os.File, header *FragmentaHeader) error {
+	if header.Flags&FlagShadowHeader != 0 {
+		return nil
+	}
+
+	// 元数据区和索引区可能被后移的块区覆盖，先读入内存
+	metadata := make([]byte, header.MetadataSize)
+	if _, err := file.ReadAt(metadata, int64(header.MetadataOffset)); err != nil {
+		return fmt.Errorf("读取元数据区失败: %w", err)
+	}
+	index := make([]byte, header.IndexSize)
+	if _, err := file.ReadAt(index, int64(header.IndexOffset)); err != nil {
+		return fmt.Errorf("读取索引区失败: %w", err)
+	}
+
+	end := HeaderSize
+	if header.BlockOffset > 0 {
+		if header.BlockOffset < HeaderSize {
+			if err := moveRegion(file, header.BlockOffset, HeaderSize, header.BlockSize); err != nil {
+				return fmt.Errorf("移动块区失败: %w", err)
+			}
+			header.BlockOffset = HeaderSize
+		}
+		end = header.BlockOffset + header.BlockSize
+	}
+
+	header.MetadataOffset = end
+	if _, err := file.WriteAt(metadata, int64(end)); err != nil {
+		return fmt.Errorf("写入元数据区失败: %w", err)
+	}
+	end += header.MetadataSize
+
+	if header.IndexSize > 0 {
+		header.IndexOffset = end
+		if _, err := file.WriteAt(index, int64(end)); err != nil {
+			return fmt.Errorf("写入索引区失败: %w", err)
+		}
+		end += header.IndexSize
+	}
+
+	if end > header.TotalSize {
+		header.TotalSize = end
+	}
+	header.Flags |= FlagShadowHeader
+	return file.Sync()
+}
+
+// moveRegion 把size字节从from移动到更大的偏移to，从尾部开始分段复制以处理重叠
+func moveRegion(file *os.File, from, to, size uint64) error {
+	buf := make([]byte, 64<<10)
+	for remaining := size; remaining > 0; {
+		n := uint64(len(buf))
+		if n > remaining {
+			n = remaining
+		}
+		remaining -= n
+		if _, err := file.ReadAt(buf[:n], int64(from+remaining)); err != nil {
+			return err
+		}
+		if _, err := file.WriteAt(buf[:n], int64(to+remaining)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// versionString 格式化版本号
+func versionString(version uint16) string {
+	return fmt.Sprintf("%d.%d", version>>8, version&0xFF)
+}
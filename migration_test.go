@@ -0,0 +1,135 @@
+package fragmenta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+// makeLegacyFile 把测试文件改写为1.0版本的布局：单个文件头，块区和元数据区紧跟在256字节之后
+func makeLegacyFile(t *testing.T, path string) {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("读取文件失败: %v", err)
+	}
+	header, err := decodeHeader(data[:headerRecordSize])
+	if err != nil {
+		t.Fatalf("解码文件头失败: %v", err)
+	}
+
+	blocks := data[header.BlockOffset : header.BlockOffset+header.BlockSize]
+	metadata := data[header.MetadataOffset : header.MetadataOffset+header.MetadataSize]
+
+	header.Version = 0x0100
+	header.Flags &^= FlagShadowHeader
+	header.CheckSum = [32]byte{}
+	header.Generation = 0
+	header.BlockOffset = HeaderSlotSize
+	header.MetadataOffset = HeaderSlotSize + uint64(len(blocks))
+	header.IndexOffset = 0 // 1.0版本不写索引区
+	header.IndexSize = 0
+	header.TotalSize = header.MetadataOffset + header.MetadataSize
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, header)
+	buf.Write(make([]byte, int(HeaderSlotSize)-buf.Len()))
+	buf.Write(blocks)
+	buf.Write(metadata)
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+}
+
+// TestMigrateLegacyFile 测试打开1.0版本文件时自动升级
+func TestMigrateLegacyFile(t *testing.T) {
+	path := createHeaderTestFile(t)
+	makeLegacyFile(t, path)
+	legacy, _ := os.ReadFile(path)
+
+	// 只生成计划，不修改文件
+	report, err := MigrateFile(path, &MigrationOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("生成迁移计划失败: %v", err)
+	}
+	if report.FromVersion != 0x0100 || report.ToVersion != CurrentVersion || len(report.Steps) != 1 {
+		t.Errorf("迁移计划不正确: %+v", report)
+	}
+	if data, _ := os.ReadFile(path); !bytes.Equal(data, legacy) {
+		t.Errorf("试运行不应修改文件")
+	}
+
+	// 只读文件按原版本打开
+	os.Chmod(path, 0444)
+	f, err := OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开只读文件失败: %v", err)
+	}
+	if f.GetHeader().Version != 0x0100 {
+		t.Errorf("只读文件不应升级")
+	}
+	f.Close()
+	os.Chmod(path, 0644)
+
+	impl := checkHeaderTestFile(t, path)
+	if impl.header.Version != CurrentVersion || impl.header.Flags&FlagShadowHeader == 0 {
+		t.Errorf("文件头未升级: %+v", impl.header)
+	}
+	if impl.header.BlockOffset != HeaderSize {
+		t.Errorf("块区应后移到%d: %d", HeaderSize, impl.header.BlockOffset)
+	}
+	impl.Close()
+
+	if backup, err := os.ReadFile(path + ".v1.0.bak"); err != nil || !bytes.Equal(backup, legacy) {
+		t.Errorf("备份文件不正确: %v", err)
+	}
+
+	impl = checkHeaderTestFile(t, path)
+	if version, err := impl.GetMetadata(TagVersion); err != nil || DecodeInt64(version) != int64(CurrentVersion) {
+		t.Errorf("版本元数据未更新: %v, %v", version, err)
+	}
+	impl.Close()
+
+	inspect, err := Inspect(path)
+	if err != nil || len(inspect.Problems) != 0 {
+		t.Errorf("升级后的文件不应有结构问题: %v, %v", inspect, err)
+	}
+
+	// 已是当前版本时无需迁移
+	report, err = MigrateFile(path, &MigrationOptions{})
+	if err != nil || len(report.Steps) != 0 {
+		t.Errorf("当前版本不应迁移: %+v, %v", report, err)
+	}
+}
+
+// TestMigrationRegistry 测试迁移注册和计划
+func TestMigrationRegistry(t *testing.T) {
+	if err := RegisterMigration(Migration{From: 0x0100, To: 0x0101, Apply: migrateShadowHeader}); !errors.Is(err, ErrInvalidMigration) {
+		t.Errorf("重复注册应失败: %v", err)
+	}
+	if err := RegisterMigration(Migration{From: 0x0101, To: 0x0100, Apply: migrateShadowHeader}); !errors.Is(err, ErrInvalidMigration) {
+		t.Errorf("降级步骤应被拒绝: %v", err)
+	}
+	if err := RegisterMigration(Migration{From: 0x00FF, To: 0x0100}); !errors.Is(err, ErrInvalidMigration) {
+		t.Errorf("缺少Apply应被拒绝: %v", err)
+	}
+
+	if plan, err := PlanMigration(0x0100); err != nil || len(plan) != 1 || plan[0].To != 0x0101 {
+		t.Errorf("迁移计划不正确: %v, %v", plan, err)
+	}
+	if plan, err := PlanMigration(CurrentVersion); err != nil || len(plan) != 0 {
+		t.Errorf("当前版本不需要迁移: %v, %v", plan, err)
+	}
+	if _, err := PlanMigration(CurrentVersion + 1); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("更新的版本应不受支持: %v", err)
+	}
+	if _, err := PlanMigration(0x00FF); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("没有升级路径的旧版本应不受支持: %v", err)
+	}
+	if len(ListMigrations()) == 0 {
+		t.Errorf("应包含内置迁移步骤")
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !unix
+
+package fragmenta
+
+import (
+	"errors"
+	"os"
+)
+
+// mmapFile 当前平台不支持内存映射
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	return nil, errors.New("当前平台不支持mmap")
+}
+
+// munmapFile 当前平台不支持内存映射
+func munmapFile(data []byte) error {
+	return nil
+}
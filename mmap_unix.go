@@ -0,0 +1,18 @@
+//go:build unix
+
+package fragmenta
+
+import (
+	"os"
+	"syscall"
+)
+
+// mmapFile 以只读方式映射文件的前size字节
+func mmapFile(file *os.File, size int64) ([]byte, error) {
+	return syscall.Mmap(int(file.Fd()), 0, int(size), syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// munmapFile 解除映射
+func munmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
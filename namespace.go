@@ -0,0 +1,1067 @@
+package fragmenta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 命名空间常量
+const (
+	// NamespaceMagic 命名空间表魔数 "FDNS"
+	NamespaceMagic uint32 = 0x46444E53
+	// NamespaceVersion 命名空间表版本
+	NamespaceVersion uint16 = 1
+	// RootInodeID 根目录的inode编号
+	RootInodeID uint32 = 1
+	// MaxNameLength 单个路径分量的最大长度（字节）
+	MaxNameLength = 255
+)
+
+// inode类型
+const (
+	// InodeTypeFile 常规文件
+	InodeTypeFile uint8 = 1
+	// InodeTypeDir 目录
+	InodeTypeDir uint8 = 2
+)
+
+// Inode 命名空间中的文件或目录节点
+// 文件内容按块大小切分后存放在一条块链中，Blocks按顺序记录链上的块ID
+type Inode struct {
+	ID         uint32      // inode编号
+	Parent     uint32      // 父目录的inode编号（根目录指向自身）
+	Name       string      // 在父目录中的名称
+	Type       uint8       // inode类型
+	Mode       os.FileMode // 权限模式
+	UID        uint32      // 所有者用户ID
+	GID        uint32      // 所有者组ID
+	Size       int64       // 文件大小
+	Blocks     []uint32    // 文件内容所在的块链
+	CreatedAt  int64       // 创建时间戳（纳秒）
+	ModifiedAt int64       // 修改时间戳（纳秒）
+	AccessedAt int64       // 访问时间戳（纳秒）
+}
+
+// IsDir 是否是目录
+func (i *Inode) IsDir() bool {
+	return i.Type == InodeTypeDir
+}
+
+// clone 复制inode，避免调用方修改内部状态
+func (i *Inode) clone() *Inode {
+	c := *i
+	c.Blocks = append([]uint32(nil), i.Blocks...)
+	return &c
+}
+
+// inodeInfo 以os.FileInfo的形式描述inode
+type inodeInfo struct {
+	inode *Inode
+}
+
+// Name 返回名称，根目录为"/"
+func (fi inodeInfo) Name() string {
+	if fi.inode.ID == RootInodeID {
+		return "/"
+	}
+	return fi.inode.Name
+}
+
+// Size 返回文件大小
+func (fi inodeInfo) Size() int64 { return fi.inode.Size }
+
+// Mode 返回文件模式，目录带有os.ModeDir
+func (fi inodeInfo) Mode() os.FileMode {
+	if fi.inode.IsDir() {
+		return os.ModeDir | fi.inode.Mode.Perm()
+	}
+	return fi.inode.Mode.Perm()
+}
+
+// ModTime 返回修改时间
+func (fi inodeInfo) ModTime() time.Time { return time.Unix(0, fi.inode.ModifiedAt) }
+
+// IsDir 是否是目录
+func (fi inodeInfo) IsDir() bool { return fi.inode.IsDir() }
+
+// Sys 返回底层的*Inode
+func (fi inodeInfo) Sys() interface{} { return fi.inode }
+
+// Dentry 目录项
+type Dentry struct {
+	Name  string // 名称
+	Inode uint32 // inode编号
+	Type  uint8  // inode类型
+}
+
+// NamespaceBackend 命名空间依赖的块和元数据操作，FragDB满足此接口
+type NamespaceBackend interface {
+	WriteBlock(data []byte, options *BlockOptions) (uint32, error)
+	ReadBlock(blockID uint32) ([]byte, error)
+	DeleteBlock(blockID uint32) error
+	LinkBlocks(sourceID, targetID uint32) error
+	SetMetadata(tag uint16, value []byte) error
+	GetMetadata(tag uint16) ([]byte, error)
+}
+
+// namespaceClock 后端可选实现的时钟，提供inode的时间戳（FragDB确定性模式下为固定时间）
+type namespaceClock interface {
+	now() time.Time
+}
+
+// namespaceBackend FragmentaImpl作为命名空间存储后端时的包装，允许写入保留的TagNamespace，删除块不经过回收站
+type namespaceBackend struct {
+	*FragmentaImpl
+}
+
+// WriteBlock 写入数据块，不按内容去重：命名空间会链接和释放自己写入的块
+func (b namespaceBackend) WriteBlock(data []byte, options *BlockOptions) (uint32, error) {
+	return b.writeBlock(data, options)
+}
+
+// SetMetadata 设置元数据，不检查保留标签
+func (b namespaceBackend) SetMetadata(tag uint16, value []byte) error {
+	return b.setMetadata(tag, value)
+}
+
+// DeleteBlock 立即删除块，命名空间不再引用的块不进入回收站
+func (b namespaceBackend) DeleteBlock(blockID uint32) error {
+	return b.deleteBlock(blockID)
+}
+
+// Namespace 基于块的文件/目录命名空间
+// 维护inode表和目录项，文件内容映射到块链。命名空间表通过Sync写入一个系统块，
+// 其块ID记录在TagNamespace元数据中。
+type Namespace struct {
+	backend   NamespaceBackend
+	chunkSize int
+	clock     func() time.Time
+
+	inodes    map[uint32]*Inode
+	children  map[uint32]map[string]uint32 // 目录inode -> 名称 -> 子inode
+	nextInode uint32
+
+	tableBlock uint32 // 当前命名空间表所在的块ID
+	dirty      bool
+
+	mutex sync.RWMutex
+}
+
+// NewNamespace 创建或加载命名空间
+// chunkSize 为文件内容切分的块大小，为0时使用DefaultBlockSize；加载已有命名空间时使用表中记录的块大小
+func NewNamespace(backend NamespaceBackend, chunkSize uint32) (*Namespace, error) {
+	if chunkSize == 0 {
+		chunkSize = DefaultBlockSize
+	}
+
+	ns := &Namespace{
+		backend:   backend,
+		chunkSize: int(chunkSize),
+		inodes:    make(map[uint32]*Inode),
+		children:  make(map[uint32]map[string]uint32),
+		clock:     time.Now,
+	}
+	if c, ok := backend.(namespaceClock); ok {
+		ns.clock = c.now
+	}
+
+	value, err := backend.GetMetadata(TagNamespace)
+	if err == ErrMetadataNotFound {
+		// 新的命名空间只有根目录
+		now := ns.clock().UnixNano()
+		ns.inodes[RootInodeID] = &Inode{
+			ID:         RootInodeID,
+			Parent:     RootInodeID,
+			Type:       InodeTypeDir,
+			Mode:       os.ModeDir | 0755,
+			CreatedAt:  now,
+			ModifiedAt: now,
+			AccessedAt: now,
+		}
+		ns.children[RootInodeID] = make(map[string]uint32)
+		ns.nextInode = RootInodeID + 1
+		ns.dirty = true
+		return ns, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ns.tableBlock = uint32(DecodeInt64(value))
+	table, err := backend.ReadBlock(ns.tableBlock)
+	if err != nil {
+		logger.Error("读取命名空间表失败", "blockID", ns.tableBlock, "error", err)
+		return nil, err
+	}
+	if err := ns.decodeTable(table); err != nil {
+		logger.Error("解析命名空间表失败", "blockID", ns.tableBlock, "error", err)
+		return nil, err
+	}
+
+	return ns, nil
+}
+
+// Lookup 查找路径对应的inode
+func (ns *Namespace) Lookup(p string) (*Inode, error) {
+	ns.mutex.RLock()
+	defer ns.mutex.RUnlock()
+
+	inode, err := ns.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	return inode.clone(), nil
+}
+
+// Stat 返回路径对应的文件信息，Sys()返回*Inode的副本
+func (ns *Namespace) Stat(p string) (os.FileInfo, error) {
+	inode, err := ns.Lookup(p)
+	if err != nil {
+		return nil, err
+	}
+	return inodeInfo{inode: inode}, nil
+}
+
+// Mkdir 创建目录，父目录必须存在
+func (ns *Namespace) Mkdir(p string, mode os.FileMode) (*Inode, error) {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	inode, err := ns.create(p, InodeTypeDir, os.ModeDir|mode.Perm())
+	if err != nil {
+		return nil, err
+	}
+	return inode.clone(), nil
+}
+
+// MkdirAll 创建目录及其所有不存在的上级目录
+func (ns *Namespace) MkdirAll(p string, mode os.FileMode) error {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	clean, err := cleanPath(p)
+	if err != nil {
+		return err
+	}
+
+	current := ns.inodes[RootInodeID]
+	for _, name := range splitPath(clean) {
+		if len(name) > MaxNameLength {
+			return fmt.Errorf("%w: 名称超过%d字节", ErrInvalidPath, MaxNameLength)
+		}
+		childID, ok := ns.children[current.ID][name]
+		if ok {
+			current = ns.inodes[childID]
+			if !current.IsDir() {
+				return fmt.Errorf("%w: %s", ErrNotDirectory, p)
+			}
+			continue
+		}
+		current = ns.link(current, name, InodeTypeDir, os.ModeDir|mode.Perm())
+	}
+
+	return nil
+}
+
+// CreateFile 创建空文件，路径已存在时返回ErrPathExists
+func (ns *Namespace) CreateFile(p string, mode os.FileMode) (*Inode, error) {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	inode, err := ns.create(p, InodeTypeFile, mode.Perm())
+	if err != nil {
+		return nil, err
+	}
+	return inode.clone(), nil
+}
+
+// ReadDir 列出目录内容，按名称排序
+func (ns *Namespace) ReadDir(p string) ([]Dentry, error) {
+	ns.mutex.RLock()
+	defer ns.mutex.RUnlock()
+
+	dir, err := ns.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	if !dir.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrNotDirectory, p)
+	}
+
+	entries := make([]Dentry, 0, len(ns.children[dir.ID]))
+	for name, id := range ns.children[dir.ID] {
+		entries = append(entries, Dentry{Name: name, Inode: id, Type: ns.inodes[id].Type})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+
+	return entries, nil
+}
+
+// ReadFile 读取文件的全部内容
+func (ns *Namespace) ReadFile(p string) ([]byte, error) {
+	ns.mutex.RLock()
+	defer ns.mutex.RUnlock()
+
+	inode, err := ns.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	if inode.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrIsDirectory, p)
+	}
+
+	data := make([]byte, 0, inode.Size)
+	for _, blockID := range inode.Blocks {
+		chunk, err := ns.backend.ReadBlock(blockID)
+		if err != nil {
+			logger.Error("读取文件块失败", "path", p, "blockID", blockID, "error", err)
+			return nil, err
+		}
+		data = append(data, chunk...)
+	}
+
+	return data, nil
+}
+
+// WriteFile 以data替换文件内容，文件不存在时创建
+// 新内容先写入新的块链，成功后再释放旧的块链
+func (ns *Namespace) WriteFile(p string, data []byte, mode os.FileMode) error {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	inode, err := ns.resolve(p)
+	if errors.Is(err, ErrPathNotFound) {
+		inode, err = ns.create(p, InodeTypeFile, mode.Perm())
+	}
+	if err != nil {
+		return err
+	}
+	if inode.IsDir() {
+		return fmt.Errorf("%w: %s", ErrIsDirectory, p)
+	}
+
+	blocks, err := ns.writeChain(data)
+	if err != nil {
+		logger.Error("写入文件块链失败", "path", p, "error", err)
+		return err
+	}
+
+	old := inode.Blocks
+	inode.Blocks = blocks
+	inode.Size = int64(len(data))
+	inode.ModifiedAt = ns.clock().UnixNano()
+	ns.dirty = true
+
+	ns.freeChain(old)
+	return nil
+}
+
+// Rename 移动或重命名文件/目录
+// 目标是文件时被替换；目标是空目录且源也是目录时被替换
+func (ns *Namespace) Rename(oldPath, newPath string) error {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	src, err := ns.resolve(oldPath)
+	if err != nil {
+		return err
+	}
+	if src.ID == RootInodeID {
+		return fmt.Errorf("%w: 不能移动根目录", ErrInvalidPath)
+	}
+
+	parent, name, err := ns.resolveParent(newPath)
+	if err != nil {
+		return err
+	}
+
+	// 目录不能移动到自身或其子目录下
+	if src.IsDir() {
+		for id := parent.ID; ; id = ns.inodes[id].Parent {
+			if id == src.ID {
+				return fmt.Errorf("%w: 不能将%s移动到其子目录%s", ErrInvalidPath, oldPath, newPath)
+			}
+			if id == RootInodeID {
+				break
+			}
+		}
+	}
+
+	if targetID, ok := ns.children[parent.ID][name]; ok {
+		if targetID == src.ID {
+			return nil
+		}
+		target := ns.inodes[targetID]
+		switch {
+		case target.IsDir() && !src.IsDir():
+			return fmt.Errorf("%w: %s", ErrIsDirectory, newPath)
+		case !target.IsDir() && src.IsDir():
+			return fmt.Errorf("%w: %s", ErrNotDirectory, newPath)
+		case target.IsDir() && len(ns.children[targetID]) > 0:
+			return fmt.Errorf("%w: %s", ErrDirectoryNotEmpty, newPath)
+		}
+		ns.unlink(target)
+	}
+
+	now := ns.clock().UnixNano()
+	oldParent := ns.inodes[src.Parent]
+	delete(ns.children[oldParent.ID], src.Name)
+	oldParent.ModifiedAt = now
+
+	src.Parent = parent.ID
+	src.Name = name
+	ns.children[parent.ID][name] = src.ID
+	parent.ModifiedAt = now
+	ns.dirty = true
+
+	return nil
+}
+
+// Unlink 删除文件并释放其块链
+func (ns *Namespace) Unlink(p string) error {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	inode, err := ns.resolve(p)
+	if err != nil {
+		return err
+	}
+	if inode.IsDir() {
+		return fmt.Errorf("%w: %s", ErrIsDirectory, p)
+	}
+
+	ns.unlink(inode)
+	return nil
+}
+
+// Rmdir 删除空目录
+func (ns *Namespace) Rmdir(p string) error {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	inode, err := ns.resolve(p)
+	if err != nil {
+		return err
+	}
+	if !inode.IsDir() {
+		return fmt.Errorf("%w: %s", ErrNotDirectory, p)
+	}
+	if inode.ID == RootInodeID {
+		return fmt.Errorf("%w: 不能删除根目录", ErrInvalidPath)
+	}
+	if len(ns.children[inode.ID]) > 0 {
+		return fmt.Errorf("%w: %s", ErrDirectoryNotEmpty, p)
+	}
+
+	ns.unlink(inode)
+	return nil
+}
+
+// RemoveAll 删除文件或整个目录树并释放所有块链，路径不存在时返回nil
+func (ns *Namespace) RemoveAll(p string) error {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	inode, err := ns.resolve(p)
+	if errors.Is(err, ErrPathNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if inode.ID == RootInodeID {
+		return fmt.Errorf("%w: 不能删除根目录", ErrInvalidPath)
+	}
+
+	ns.unlinkTree(inode)
+	return nil
+}
+
+// ReadAt 从文件的off偏移处读取数据到buf，读到文件末尾时返回io.EOF
+func (ns *Namespace) ReadAt(p string, buf []byte, off int64) (int, error) {
+	ns.mutex.RLock()
+	defer ns.mutex.RUnlock()
+
+	inode, err := ns.resolveFile(p)
+	if err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, fmt.Errorf("%w: 偏移量为负数", ErrInvalidArgument)
+	}
+
+	n := 0
+	for n < len(buf) && off+int64(n) < inode.Size {
+		pos := off + int64(n)
+		index := int(pos / int64(ns.chunkSize))
+		chunk, err := ns.backend.ReadBlock(inode.Blocks[index])
+		if err != nil {
+			logger.Error("读取文件块失败", "path", p, "blockID", inode.Blocks[index], "error", err)
+			return n, err
+		}
+
+		inner := int(pos % int64(ns.chunkSize))
+		if inner >= len(chunk) {
+			return n, fmt.Errorf("%w: 文件块%d长度不足", ErrIndexCorruption, inode.Blocks[index])
+		}
+		remaining := inode.Size - pos
+		limit := len(buf)
+		if int64(limit-n) > remaining {
+			limit = n + int(remaining)
+		}
+		n += copy(buf[n:limit], chunk[inner:])
+	}
+
+	if n < len(buf) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt 在文件的off偏移处写入数据，必要时扩展文件，空洞以零填充
+// 只重写受影响的块，新块写入成功后才替换块链中的旧块
+func (ns *Namespace) WriteAt(p string, data []byte, off int64) (int, error) {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	inode, err := ns.resolveFile(p)
+	if err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, fmt.Errorf("%w: 偏移量为负数", ErrInvalidArgument)
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	newSize := off + int64(len(data))
+	if newSize < inode.Size {
+		newSize = inode.Size
+	}
+	if err := ns.rewriteRange(inode, data, off, newSize); err != nil {
+		logger.Error("写入文件失败", "path", p, "offset", off, "error", err)
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+// Truncate 将文件截断或以零扩展到size字节
+func (ns *Namespace) Truncate(p string, size int64) error {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	inode, err := ns.resolveFile(p)
+	if err != nil {
+		return err
+	}
+	if size < 0 {
+		return fmt.Errorf("%w: 文件大小为负数", ErrInvalidArgument)
+	}
+
+	switch {
+	case size == inode.Size:
+		return nil
+	case size > inode.Size:
+		err = ns.rewriteRange(inode, nil, inode.Size, size)
+	default:
+		err = ns.shrink(inode, size)
+	}
+	if err != nil {
+		logger.Error("截断文件失败", "path", p, "size", size, "error", err)
+	}
+	return err
+}
+
+// Chmod 修改权限位，保留文件类型位
+func (ns *Namespace) Chmod(p string, mode os.FileMode) error {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	inode, err := ns.resolve(p)
+	if err != nil {
+		return err
+	}
+
+	inode.Mode = inode.Mode&^os.ModePerm | mode.Perm()
+	ns.dirty = true
+	return nil
+}
+
+// Chown 修改所有者
+func (ns *Namespace) Chown(p string, uid, gid uint32) error {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	inode, err := ns.resolve(p)
+	if err != nil {
+		return err
+	}
+
+	inode.UID = uid
+	inode.GID = gid
+	ns.dirty = true
+	return nil
+}
+
+// Chtimes 修改访问时间和修改时间，零值表示不修改
+func (ns *Namespace) Chtimes(p string, atime, mtime time.Time) error {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	inode, err := ns.resolve(p)
+	if err != nil {
+		return err
+	}
+
+	if !atime.IsZero() {
+		inode.AccessedAt = atime.UnixNano()
+	}
+	if !mtime.IsZero() {
+		inode.ModifiedAt = mtime.UnixNano()
+	}
+	ns.dirty = true
+	return nil
+}
+
+// Sync 将命名空间表写入新的系统块，并更新TagNamespace元数据
+func (ns *Namespace) Sync() error {
+	ns.mutex.Lock()
+	defer ns.mutex.Unlock()
+
+	if !ns.dirty {
+		return nil
+	}
+
+	table, err := ns.encodeTable()
+	if err != nil {
+		return err
+	}
+
+	blockID, err := ns.backend.WriteBlock(table, &BlockOptions{BlockType: SystemBlockType, Checksum: true})
+	if err != nil {
+		logger.Error("写入命名空间表失败", "error", err)
+		return err
+	}
+	if err := ns.backend.SetMetadata(TagNamespace, EncodeInt64(int64(blockID))); err != nil {
+		logger.Error("更新命名空间表位置失败", "error", err)
+		return err
+	}
+
+	if ns.tableBlock != 0 {
+		if err := ns.backend.DeleteBlock(ns.tableBlock); err != nil {
+			logger.Warn("释放旧命名空间表失败", "blockID", ns.tableBlock, "error", err)
+		}
+	}
+	ns.tableBlock = blockID
+	ns.dirty = false
+
+	return nil
+}
+
+// 内部方法（调用方需持有锁）
+
+// resolve 解析路径
+func (ns *Namespace) resolve(p string) (*Inode, error) {
+	clean, err := cleanPath(p)
+	if err != nil {
+		return nil, err
+	}
+
+	current := ns.inodes[RootInodeID]
+	for _, name := range splitPath(clean) {
+		if !current.IsDir() {
+			return nil, fmt.Errorf("%w: %s", ErrNotDirectory, p)
+		}
+		childID, ok := ns.children[current.ID][name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrPathNotFound, p)
+		}
+		current = ns.inodes[childID]
+	}
+
+	return current, nil
+}
+
+// resolveParent 解析路径的父目录，返回父目录inode和最后一个路径分量
+func (ns *Namespace) resolveParent(p string) (*Inode, string, error) {
+	clean, err := cleanPath(p)
+	if err != nil {
+		return nil, "", err
+	}
+	if clean == "/" {
+		return nil, "", fmt.Errorf("%w: %s", ErrInvalidPath, p)
+	}
+
+	dir, name := path.Split(clean)
+	if len(name) > MaxNameLength {
+		return nil, "", fmt.Errorf("%w: 名称超过%d字节", ErrInvalidPath, MaxNameLength)
+	}
+
+	parent, err := ns.resolve(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	if !parent.IsDir() {
+		return nil, "", fmt.Errorf("%w: %s", ErrNotDirectory, dir)
+	}
+
+	return parent, name, nil
+}
+
+// create 在父目录下创建新的inode
+func (ns *Namespace) create(p string, inodeType uint8, mode os.FileMode) (*Inode, error) {
+	parent, name, err := ns.resolveParent(p)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := ns.children[parent.ID][name]; ok {
+		return nil, fmt.Errorf("%w: %s", ErrPathExists, p)
+	}
+
+	return ns.link(parent, name, inodeType, mode), nil
+}
+
+// link 分配inode并加入父目录
+func (ns *Namespace) link(parent *Inode, name string, inodeType uint8, mode os.FileMode) *Inode {
+	now := ns.clock().UnixNano()
+	inode := &Inode{
+		ID:         ns.nextInode,
+		Parent:     parent.ID,
+		Name:       name,
+		Type:       inodeType,
+		Mode:       mode,
+		CreatedAt:  now,
+		ModifiedAt: now,
+		AccessedAt: now,
+	}
+	ns.nextInode++
+
+	ns.inodes[inode.ID] = inode
+	ns.children[parent.ID][name] = inode.ID
+	if inodeType == InodeTypeDir {
+		ns.children[inode.ID] = make(map[string]uint32)
+	}
+	parent.ModifiedAt = now
+	ns.dirty = true
+
+	return inode
+}
+
+// unlink 从父目录移除inode并释放其块链
+func (ns *Namespace) unlink(inode *Inode) {
+	parent := ns.inodes[inode.Parent]
+	delete(ns.children[parent.ID], inode.Name)
+	parent.ModifiedAt = ns.clock().UnixNano()
+
+	delete(ns.inodes, inode.ID)
+	delete(ns.children, inode.ID)
+	ns.dirty = true
+
+	ns.freeChain(inode.Blocks)
+}
+
+// unlinkTree 先删除目录下的所有子项，再删除目录本身
+func (ns *Namespace) unlinkTree(inode *Inode) {
+	for _, childID := range ns.children[inode.ID] {
+		ns.unlinkTree(ns.inodes[childID])
+	}
+	ns.unlink(inode)
+}
+
+// resolveFile 解析路径并确认是常规文件
+func (ns *Namespace) resolveFile(p string) (*Inode, error) {
+	inode, err := ns.resolve(p)
+	if err != nil {
+		return nil, err
+	}
+	if inode.IsDir() {
+		return nil, fmt.Errorf("%w: %s", ErrIsDirectory, p)
+	}
+	return inode, nil
+}
+
+// rewriteRange 将data写入off偏移处并把文件扩展到newSize，重写受影响的块
+// 从min(off, 原大小)所在的块开始重写，确保扩展产生的空洞以零填充
+func (ns *Namespace) rewriteRange(inode *Inode, data []byte, off, newSize int64) error {
+	chunkSize := int64(ns.chunkSize)
+	start := off
+	if inode.Size < start {
+		start = inode.Size
+	}
+	first := int(start / chunkSize)
+	last := int((newSize - 1) / chunkSize)
+
+	written := make([]uint32, 0, last-first+1)
+	for index := first; index <= last; index++ {
+		chunkStart := int64(index) * chunkSize
+		chunkLen := newSize - chunkStart
+		if chunkLen > chunkSize {
+			chunkLen = chunkSize
+		}
+
+		buf := make([]byte, chunkLen)
+		if index < len(inode.Blocks) {
+			old, err := ns.backend.ReadBlock(inode.Blocks[index])
+			if err != nil {
+				ns.freeChain(written)
+				return err
+			}
+			copy(buf, old)
+		}
+
+		// 覆盖与本块重叠的写入数据
+		if lo, hi := max(off, chunkStart), min(off+int64(len(data)), chunkStart+chunkLen); lo < hi {
+			copy(buf[lo-chunkStart:hi-chunkStart], data[lo-off:hi-off])
+		}
+
+		blockID, err := ns.backend.WriteBlock(buf, &BlockOptions{BlockType: NormalBlockType, Checksum: true})
+		if err != nil {
+			ns.freeChain(written)
+			return err
+		}
+		written = append(written, blockID)
+	}
+
+	var replaced []uint32
+	if first < len(inode.Blocks) {
+		end := min(last+1, len(inode.Blocks))
+		replaced = append(replaced, inode.Blocks[first:end]...)
+	}
+
+	blocks := append([]uint32(nil), inode.Blocks[:first]...)
+	blocks = append(blocks, written...)
+	if last+1 < len(inode.Blocks) {
+		blocks = append(blocks, inode.Blocks[last+1:]...)
+	}
+
+	// 先释放旧块，删除时块链会跳过它们，然后再链接新块
+	ns.freeChain(replaced)
+	ns.relink(blocks, first, last+1)
+
+	inode.Blocks = blocks
+	inode.Size = newSize
+	inode.ModifiedAt = ns.clock().UnixNano()
+	ns.dirty = true
+
+	return nil
+}
+
+// shrink 将文件截断到size字节
+func (ns *Namespace) shrink(inode *Inode, size int64) error {
+	chunkSize := int64(ns.chunkSize)
+	keep := int((size + chunkSize - 1) / chunkSize)
+
+	blocks := append([]uint32(nil), inode.Blocks[:keep]...)
+	replaced := append([]uint32(nil), inode.Blocks[keep:]...)
+
+	// 最后一个块只保留部分数据时需要重写
+	if tail := size % chunkSize; tail != 0 {
+		old, err := ns.backend.ReadBlock(blocks[keep-1])
+		if err != nil {
+			return err
+		}
+		blockID, err := ns.backend.WriteBlock(append([]byte(nil), old[:tail]...), &BlockOptions{BlockType: NormalBlockType, Checksum: true})
+		if err != nil {
+			return err
+		}
+		replaced = append(replaced, blocks[keep-1])
+		blocks[keep-1] = blockID
+	}
+
+	ns.freeChain(replaced)
+	if keep > 0 {
+		ns.relink(blocks, keep-1, keep)
+	}
+
+	inode.Blocks = blocks
+	inode.Size = size
+	inode.ModifiedAt = ns.clock().UnixNano()
+	ns.dirty = true
+
+	return nil
+}
+
+// relink 重新链接块链中[from, to)范围内的块及其相邻块
+func (ns *Namespace) relink(blocks []uint32, from, to int) {
+	for i := max(from, 1); i <= to && i < len(blocks); i++ {
+		if err := ns.backend.LinkBlocks(blocks[i-1], blocks[i]); err != nil {
+			logger.Warn("链接文件块失败", "sourceID", blocks[i-1], "targetID", blocks[i], "error", err)
+		}
+	}
+}
+
+// writeChain 将数据按块大小切分写入一条新的块链
+func (ns *Namespace) writeChain(data []byte) ([]uint32, error) {
+	blocks := make([]uint32, 0, (len(data)+ns.chunkSize-1)/ns.chunkSize)
+
+	for offset := 0; offset < len(data); offset += ns.chunkSize {
+		end := offset + ns.chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		chunk := append([]byte(nil), data[offset:end]...)
+		blockID, err := ns.backend.WriteBlock(chunk, &BlockOptions{BlockType: NormalBlockType, Checksum: true})
+		if err != nil {
+			ns.freeChain(blocks)
+			return nil, err
+		}
+
+		if len(blocks) > 0 {
+			if err := ns.backend.LinkBlocks(blocks[len(blocks)-1], blockID); err != nil {
+				ns.freeChain(append(blocks, blockID))
+				return nil, err
+			}
+		}
+		blocks = append(blocks, blockID)
+	}
+
+	return blocks, nil
+}
+
+// freeChain 释放块链，失败只记录日志
+func (ns *Namespace) freeChain(blocks []uint32) {
+	for _, blockID := range blocks {
+		if err := ns.backend.DeleteBlock(blockID); err != nil {
+			logger.Warn("释放文件块失败", "blockID", blockID, "error", err)
+		}
+	}
+}
+
+// encodeTable 编码命名空间表
+// 格式: 魔数 | 版本 | 块大小 | 下一个inode编号 | inode数量 | inode记录...
+func (ns *Namespace) encodeTable() ([]byte, error) {
+	ids := make([]uint32, 0, len(ns.inodes))
+	for id := range ns.inodes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	buf := new(bytes.Buffer)
+	fields := []interface{}{NamespaceMagic, NamespaceVersion, uint32(ns.chunkSize), ns.nextInode, uint32(len(ids))}
+	for _, id := range ids {
+		inode := ns.inodes[id]
+		fields = append(fields,
+			inode.ID, inode.Parent, inode.Type, uint32(inode.Mode), inode.UID, inode.GID,
+			inode.Size, inode.CreatedAt, inode.ModifiedAt, inode.AccessedAt,
+			uint16(len(inode.Name)), []byte(inode.Name),
+			uint32(len(inode.Blocks)), inode.Blocks)
+	}
+
+	for _, field := range fields {
+		if err := binary.Write(buf, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("编码命名空间表失败: %w", err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeTable 解析命名空间表并重建目录项
+func (ns *Namespace) decodeTable(table []byte) error {
+	r := bytes.NewReader(table)
+
+	var magic, chunkSize, count uint32
+	var version uint16
+	for _, field := range []interface{}{&magic, &version, &chunkSize, &ns.nextInode, &count} {
+		if err := binary.Read(r, binary.BigEndian, field); err != nil {
+			return fmt.Errorf("%w: 命名空间表头不完整", ErrInvalidFragmenta)
+		}
+	}
+	if magic != NamespaceMagic {
+		return fmt.Errorf("%w: 命名空间表魔数错误", ErrInvalidFragmenta)
+	}
+	if version > NamespaceVersion {
+		return ErrUnsupportedVersion
+	}
+	if chunkSize == 0 {
+		return fmt.Errorf("%w: 命名空间块大小为0", ErrInvalidFragmenta)
+	}
+	ns.chunkSize = int(chunkSize)
+
+	for i := uint32(0); i < count; i++ {
+		inode := &Inode{}
+		var mode uint32
+		var nameLen uint16
+		for _, field := range []interface{}{
+			&inode.ID, &inode.Parent, &inode.Type, &mode, &inode.UID, &inode.GID,
+			&inode.Size, &inode.CreatedAt, &inode.ModifiedAt, &inode.AccessedAt, &nameLen,
+		} {
+			if err := binary.Read(r, binary.BigEndian, field); err != nil {
+				return fmt.Errorf("%w: inode记录不完整", ErrInvalidFragmenta)
+			}
+		}
+		inode.Mode = os.FileMode(mode)
+
+		name := make([]byte, nameLen)
+		if err := binary.Read(r, binary.BigEndian, name); err != nil {
+			return fmt.Errorf("%w: inode名称不完整", ErrInvalidFragmenta)
+		}
+		inode.Name = string(name)
+
+		var blockCount uint32
+		if err := binary.Read(r, binary.BigEndian, &blockCount); err != nil {
+			return fmt.Errorf("%w: inode块链不完整", ErrInvalidFragmenta)
+		}
+		if int64(blockCount)*4 > int64(r.Len()) {
+			return fmt.Errorf("%w: inode块链长度错误", ErrInvalidFragmenta)
+		}
+		inode.Blocks = make([]uint32, blockCount)
+		if err := binary.Read(r, binary.BigEndian, inode.Blocks); err != nil {
+			return fmt.Errorf("%w: inode块链不完整", ErrInvalidFragmenta)
+		}
+
+		ns.inodes[inode.ID] = inode
+		if inode.IsDir() {
+			ns.children[inode.ID] = make(map[string]uint32)
+		}
+	}
+
+	root, ok := ns.inodes[RootInodeID]
+	if !ok || !root.IsDir() {
+		return fmt.Errorf("%w: 命名空间缺少根目录", ErrInvalidFragmenta)
+	}
+
+	for id, inode := range ns.inodes {
+		if id == RootInodeID {
+			continue
+		}
+		entries, ok := ns.children[inode.Parent]
+		if !ok {
+			return fmt.Errorf("%w: inode %d的父目录%d不存在", ErrInvalidFragmenta, id, inode.Parent)
+		}
+		entries[inode.Name] = id
+	}
+
+	return nil
+}
+
+// cleanPath 规范化绝对路径
+func cleanPath(p string) (string, error) {
+	if !strings.HasPrefix(p, "/") {
+		return "", fmt.Errorf("%w: 必须是绝对路径: %q", ErrInvalidPath, p)
+	}
+	if strings.IndexByte(p, 0) >= 0 {
+		return "", fmt.Errorf("%w: 路径包含NUL字符", ErrInvalidPath)
+	}
+	return path.Clean(p), nil
+}
+
+// splitPath 将规范化的路径拆分为路径分量
+func splitPath(clean string) []string {
+	if clean == "/" {
+		return nil
+	}
+	return strings.Split(clean[1:], "/")
+}
@@ -0,0 +1,185 @@
+package fragmenta
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+)
+
+// newTestFragmenta 在临时文件中创建Fragmenta实例
+func newTestFragmenta(t *testing.T) *FragmentaImpl {
+	t.Helper()
+
+	tempFile, err := os.CreateTemp("", "fragdb-ns-*.bin")
+	if err != nil {
+		t.Fatalf("创建临时文件失败: %v", err)
+	}
+	tempFile.Close()
+	t.Cleanup(func() { os.Remove(tempFile.Name()) })
+
+	f, err := CreateFragmenta(tempFile.Name(), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	impl := f.(*FragmentaImpl)
+	t.Cleanup(func() { impl.file.Close() })
+
+	return impl
+}
+
+// TestNamespaceOperations 测试命名空间的基本文件和目录操作
+func TestNamespaceOperations(t *testing.T) {
+	f := newTestFragmenta(t)
+
+	ns, err := NewNamespace(f, 16)
+	if err != nil {
+		t.Fatalf("创建命名空间失败: %v", err)
+	}
+
+	if err := ns.MkdirAll("/docs/reports", 0755); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	if _, err := ns.Mkdir("/docs", 0755); !errors.Is(err, ErrPathExists) {
+		t.Errorf("重复创建目录应返回ErrPathExists, 实际%v", err)
+	}
+	if _, err := ns.Mkdir("/missing/dir", 0755); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("父目录不存在时应返回ErrPathNotFound, 实际%v", err)
+	}
+
+	// 超过块大小的文件被切分为块链
+	content := []byte("this content spans several sixteen byte blocks")
+	if err := ns.WriteFile("/docs/reports/q1.txt", content, 0644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	inode, err := ns.Lookup("/docs/reports/q1.txt")
+	if err != nil {
+		t.Fatalf("查找文件失败: %v", err)
+	}
+	if inode.Size != int64(len(content)) || len(inode.Blocks) != 3 {
+		t.Errorf("文件大小或块链长度不正确: size=%d blocks=%d", inode.Size, len(inode.Blocks))
+	}
+	header, err := f.blockManager.GetBlockInfo(inode.Blocks[0])
+	if err != nil || header.NextBlock != inode.Blocks[1] {
+		t.Errorf("块链未正确链接: %+v, %v", header, err)
+	}
+
+	data, err := ns.ReadFile("/docs/reports/q1.txt")
+	if err != nil || !bytes.Equal(data, content) {
+		t.Errorf("读取的文件内容不正确: %q, %v", data, err)
+	}
+
+	// 覆盖写入释放旧块链
+	if err := ns.WriteFile("/docs/reports/q1.txt", []byte("short"), 0644); err != nil {
+		t.Fatalf("覆盖文件失败: %v", err)
+	}
+	if _, err := f.ReadBlock(inode.Blocks[2]); err == nil {
+		t.Errorf("旧块链应被释放")
+	}
+
+	if _, err := ns.CreateFile("/docs/readme.md", 0644); err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	entries, err := ns.ReadDir("/docs")
+	if err != nil {
+		t.Fatalf("列出目录失败: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Name != "readme.md" || entries[1].Name != "reports" || entries[1].Type != InodeTypeDir {
+		t.Errorf("目录内容不正确: %+v", entries)
+	}
+
+	// 重命名
+	if err := ns.Rename("/docs/reports/q1.txt", "/docs/q1.txt"); err != nil {
+		t.Fatalf("重命名文件失败: %v", err)
+	}
+	if data, _ := ns.ReadFile("/docs/q1.txt"); string(data) != "short" {
+		t.Errorf("重命名后内容不正确: %q", data)
+	}
+	if _, err := ns.Lookup("/docs/reports/q1.txt"); !errors.Is(err, ErrPathNotFound) {
+		t.Errorf("重命名后旧路径应不存在, 实际%v", err)
+	}
+	if err := ns.Rename("/docs", "/docs/reports/docs"); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("目录不能移动到其子目录下, 实际%v", err)
+	}
+	if err := ns.Rename("/docs/q1.txt", "/docs/reports"); !errors.Is(err, ErrIsDirectory) {
+		t.Errorf("文件不能覆盖目录, 实际%v", err)
+	}
+	if err := ns.Rename("/docs/q1.txt", "/docs/readme.md"); err != nil {
+		t.Fatalf("重命名覆盖文件失败: %v", err)
+	}
+
+	// 删除
+	if err := ns.Unlink("/docs/reports"); !errors.Is(err, ErrIsDirectory) {
+		t.Errorf("Unlink目录应返回ErrIsDirectory, 实际%v", err)
+	}
+	if err := ns.Rmdir("/docs"); !errors.Is(err, ErrDirectoryNotEmpty) {
+		t.Errorf("删除非空目录应返回ErrDirectoryNotEmpty, 实际%v", err)
+	}
+	if err := ns.Unlink("/docs/readme.md"); err != nil {
+		t.Fatalf("删除文件失败: %v", err)
+	}
+	if err := ns.Rmdir("/docs/reports"); err != nil {
+		t.Fatalf("删除目录失败: %v", err)
+	}
+	if entries, _ := ns.ReadDir("/docs"); len(entries) != 0 {
+		t.Errorf("目录应为空: %+v", entries)
+	}
+
+	if _, err := ns.Lookup("relative/path"); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("相对路径应返回ErrInvalidPath, 实际%v", err)
+	}
+}
+
+// TestNamespaceSync 测试命名空间表的持久化和加载
+func TestNamespaceSync(t *testing.T) {
+	f := newTestFragmenta(t)
+
+	ns, err := f.Namespace()
+	if err != nil {
+		t.Fatalf("获取命名空间失败: %v", err)
+	}
+	if err := ns.MkdirAll("/a/b", 0700); err != nil {
+		t.Fatalf("创建目录失败: %v", err)
+	}
+	if err := ns.WriteFile("/a/b/data.bin", []byte("payload"), 0600); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	if err := ns.Sync(); err != nil {
+		t.Fatalf("同步命名空间失败: %v", err)
+	}
+	firstTable := ns.tableBlock
+
+	// 再次同步会写入新表并释放旧表
+	if _, err := ns.CreateFile("/a/empty", 0644); err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	if err := ns.Sync(); err != nil {
+		t.Fatalf("同步命名空间失败: %v", err)
+	}
+	if value, err := f.GetMetadata(TagNamespace); err != nil || uint32(DecodeInt64(value)) != ns.tableBlock {
+		t.Fatalf("应记录新的命名空间表位置: %v", err)
+	}
+	if _, err := f.ReadBlock(firstTable); err == nil {
+		t.Errorf("旧的命名空间表应被释放")
+	}
+
+	loaded, err := NewNamespace(f, 0)
+	if err != nil {
+		t.Fatalf("加载命名空间失败: %v", err)
+	}
+	data, err := loaded.ReadFile("/a/b/data.bin")
+	if err != nil || string(data) != "payload" {
+		t.Errorf("加载后文件内容不正确: %q, %v", data, err)
+	}
+	inode, err := loaded.Lookup("/a/b")
+	if err != nil || !inode.IsDir() || inode.Mode.Perm() != 0700 {
+		t.Errorf("加载后目录信息不正确: %+v, %v", inode, err)
+	}
+	entries, _ := loaded.ReadDir("/a")
+	if len(entries) != 2 || entries[0].Name != "b" || entries[1].Name != "empty" {
+		t.Errorf("加载后目录内容不正确: %+v", entries)
+	}
+	if _, err := loaded.CreateFile("/a/new", 0644); err != nil {
+		t.Errorf("加载后应能继续分配inode: %v", err)
+	}
+}
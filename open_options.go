@@ -0,0 +1,101 @@
+package fragmenta
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// VerifyLevel 打开文件时的完整性校验级别，文件头的校验和始终校验
+type VerifyLevel uint8
+
+const (
+	// VerifyChecksums 读取块时校验块的校验和，默认级别
+	VerifyChecksums VerifyLevel = iota
+	// VerifyNone 读取块时不校验块的校验和
+	VerifyNone
+	// VerifyFull 打开时读取所有块，校验块的校验和以及索引区中保存的块数据哈希，之后与VerifyChecksums相同
+	VerifyFull
+)
+
+// OpenOptions 打开现有文件的选项，零值与 OpenFragmenta 相同
+type OpenOptions struct {
+	ReadOnly       bool              // 只读打开，不修复文件头也不升级版本，写操作返回ErrReadOnly
+	Verify         VerifyLevel       // 完整性校验级别
+	BlockCacheSize int64             // 块数据缓存的最大字节数，0使用DefaultBlockCacheSize，负数不缓存
+	NoIndexPreload bool              // 打开时不读入索引区，Merkle树的块数据哈希在首次使用时重新计算
+	Mmap           bool              // 通过内存映射读取块数据，只支持只读打开，平台不支持时使用普通读取
+	Migration      *MigrationOptions // 版本升级选项，为nil时使用DefaultMigrationOptions
+}
+
+// OpenFragmentaWithOptions 按打开选项打开现有格式文件，options为nil时与OpenFragmenta相同
+func OpenFragmentaWithOptions(path string, options *OpenOptions) (Fragmenta, error) {
+	if options == nil {
+		options = &OpenOptions{}
+	}
+	fragmenta, _, err := openExisting(path, options)
+	if err != nil {
+		return nil, err
+	}
+	return fragmenta, nil
+}
+
+// applyOpenOptions 组件初始化后应用缓存、校验和内存映射选项，VerifyFull时校验所有块
+func (f *FragmentaImpl) applyOpenOptions(options *OpenOptions, size int64) error {
+	if bm, ok := f.blockManager.(*blockManagerImpl); ok {
+		switch {
+		case options.BlockCacheSize > 0:
+			bm.cacheLimit = options.BlockCacheSize
+		case options.BlockCacheSize < 0:
+			bm.cacheLimit = 0
+		}
+		bm.verifyChecksums = options.Verify != VerifyNone
+
+		if options.Mmap && size > 0 {
+			mapped, err := mmapFile(f.file, size)
+			if err != nil {
+				logger.Warn("映射文件失败，使用普通读取", "path", f.path, "error", err)
+			} else {
+				bm.mapped = mapped
+			}
+		}
+	}
+
+	if options.Verify == VerifyFull {
+		return f.verifyBlocks()
+	}
+	return nil
+}
+
+// verifyBlocks 读取所有块，校验块的校验和以及索引区中保存的块数据哈希
+func (f *FragmentaImpl) verifyBlocks() error {
+	for _, header := range f.blockManager.ListBlocks() {
+		data, err := f.readBlock(header.BlockID)
+		if err != nil {
+			if !errors.Is(err, ErrCorrupted) {
+				err = fmt.Errorf("%w: 读取块%d失败: %w", ErrCorrupted, header.BlockID, err)
+			}
+			return err
+		}
+
+		f.merkleMutex.Lock()
+		cached, ok := f.blockHashes[header.BlockID]
+		f.merkleMutex.Unlock()
+		if ok && cached.size == header.Size && cached.hash != sha256.Sum256(data) {
+			return fmt.Errorf("%w: 块%d的数据与索引区中的哈希不符", ErrCorrupted, header.BlockID)
+		}
+	}
+	return nil
+}
+
+// unmap 解除块数据的内存映射
+func (f *FragmentaImpl) unmap() {
+	bm, ok := f.blockManager.(*blockManagerImpl)
+	if !ok || bm.mapped == nil {
+		return
+	}
+	if err := munmapFile(bm.mapped); err != nil {
+		logger.Warn("解除文件映射失败", "path", f.path, "error", err)
+	}
+	bm.mapped = nil
+}
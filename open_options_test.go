@@ -0,0 +1,102 @@
+package fragmenta
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestOpenOptions 测试只读、内存映射、缓存大小、索引预加载和完整性校验级别
+func TestOpenOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "options.frag")
+	f, err := CreateFragmenta(path, nil)
+	if err != nil {
+		t.Fatalf("创建文件失败: %v", err)
+	}
+	var ids []uint32
+	for i := 0; i < 4; i++ {
+		id, err := f.WriteBlock(bytes.Repeat([]byte{byte('a' + i)}, 100), nil)
+		if err != nil {
+			t.Fatalf("写入块失败: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	root, err := f.GetRootHash()
+	if err != nil {
+		t.Fatalf("计算根哈希失败: %v", err)
+	}
+	offset := f.(*FragmentaImpl).blockManager.(*blockManagerImpl).offsets[ids[2]] + BlockHeaderSize
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	if _, err := OpenFragmentaWithOptions(path, &OpenOptions{Mmap: true}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("mmap不支持读写打开: %v", err)
+	}
+
+	// 只读打开并通过内存映射读取，缓存只能容纳一个块
+	f, err = OpenFragmentaWithOptions(path, &OpenOptions{ReadOnly: true, Mmap: true, BlockCacheSize: 150})
+	if err != nil {
+		t.Fatalf("只读打开失败: %v", err)
+	}
+	for i, id := range ids {
+		data, err := f.ReadBlock(id)
+		if err != nil || !bytes.Equal(data, bytes.Repeat([]byte{byte('a' + i)}, 100)) {
+			t.Errorf("读取块%d不正确: %v", id, err)
+		}
+	}
+	if bm := f.(*FragmentaImpl).blockManager.(*blockManagerImpl); bm.cacheBytes > 150 || len(bm.blockCache) != 1 {
+		t.Errorf("块缓存超出容量: %d字节, %d项", bm.cacheBytes, len(bm.blockCache))
+	}
+	if _, err := f.WriteBlock([]byte("x"), nil); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("只读打开时写入应返回ErrReadOnly: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭失败: %v", err)
+	}
+
+	// 不预加载索引区时根哈希在使用时重新计算
+	f, err = OpenFragmentaWithOptions(path, &OpenOptions{ReadOnly: true, NoIndexPreload: true})
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	if f.(*FragmentaImpl).blockHashes != nil {
+		t.Error("不应预加载块数据哈希")
+	}
+	if got, err := f.GetRootHash(); err != nil || got != root {
+		t.Errorf("重新计算的根哈希不一致: %v", err)
+	}
+	f.Close()
+
+	// 破坏一个块的数据
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.WriteAt([]byte{'z'}, int64(offset)); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	if _, err := OpenFragmentaWithOptions(path, &OpenOptions{ReadOnly: true, Verify: VerifyFull}); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("完整校验应发现损坏的块: %v", err)
+	}
+	f, err = OpenFragmentaWithOptions(path, &OpenOptions{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	if _, err := f.ReadBlock(ids[2]); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("默认级别读取损坏的块应返回ErrCorrupted: %v", err)
+	}
+	f.Close()
+	f, err = OpenFragmentaWithOptions(path, &OpenOptions{ReadOnly: true, Verify: VerifyNone})
+	if err != nil {
+		t.Fatalf("打开失败: %v", err)
+	}
+	if data, err := f.ReadBlock(ids[2]); err != nil || data[0] != 'z' {
+		t.Errorf("不校验时应返回块数据: %v", err)
+	}
+	f.Close()
+}
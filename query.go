@@ -0,0 +1,150 @@
+package fragmenta
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/bpfs/fragmenta/index"
+)
+
+// StartQueryService 启动查询服务
+// 创建块查询服务并索引现有块的块头字段和属性，之后块的写入、删除和属性修改都会同步到查询服务；
+// tag:条件查询块的元数据标签（见 SetIndexManager）。重复调用不做任何事
+func (f *FragmentaImpl) StartQueryService() error {
+	// 加载回收站可能读取块数据存储，需在持有componentMutex之前完成
+	trashed := f.trashedBlocks()
+
+	f.componentMutex.Lock()
+	defer f.componentMutex.Unlock()
+
+	if f.queryService != nil {
+		return nil
+	}
+
+	im, err := f.indexManagerLocked()
+	if err != nil {
+		return err
+	}
+
+	service := index.NewQueryService(im)
+	service.SetTagResolver(f.resolveTagName)
+	headers := f.blockManager.ListBlocks()
+	for _, header := range headers {
+		if err := indexQueryBlock(service, header); err != nil {
+			logger.Error("索引块失败", "blockID", header.BlockID, "error", err)
+			return err
+		}
+
+		if _, ok := trashed[header.BlockID]; ok {
+			if err := service.MarkDeleted(header.BlockID, true); err != nil {
+				return err
+			}
+		}
+
+		if values := f.blockValues[header.BlockID]; len(values) > 0 {
+			if err := service.IndexBlockValues(header.BlockID, values); err != nil {
+				return err
+			}
+		}
+
+		attributes, err := f.blockManager.GetBlockAttributes(header.BlockID)
+		if err != nil {
+			return err
+		}
+		if len(attributes) > 0 {
+			if err := service.IndexBlockAttributes(header.BlockID, attributes); err != nil {
+				return err
+			}
+		}
+	}
+
+	f.queryService = service
+	logger.Info("查询服务已启动", "blocks", len(headers))
+	return nil
+}
+
+// Query 执行块查询，返回满足条件的块。查询语法为"条件; sort: 字段; limit: N; offset: N"，
+// 条件可以引用块属性、块头字段（block.id、block.type、block.size、block.created、block.deleted）和
+// 元数据模式中注册的块元数据标签（meta.<名称>，见 MetadataSchema）；标签条件可以用
+// AllocateUserTag分配的名称或元数据模式中的名称引用标签（tag:meta==<名称>）。例如
+// "tenant==alpha and block.size>1024; sort: -block.created; limit: 10"。
+// 结果不包含回收站中的块，加上 "deleted: include" 时包含（见 EnableTrash）；
+// 加上 "select: 字段1, 字段2" 时每个结果条目的Values包含选择的字段值。
+// "字段 in (子查询)" 条件要求字段值出现在子查询的结果ID中（子查询带 "select: 字段" 时为该字段的值，
+// 字段为id时比较块ID本身），例如 "meta.source in (owner==alice)" 查找源块属于alice的派生块。
+// 向量类型（MetadataTypeVector）的元数据标签可以用 "meta.embedding near [0.1, 0.2, ...] 5"
+// 查找最相似的5个块，结果按相似度从高到低排列。
+// 需要先调用 StartQueryService
+func (f *FragmentaImpl) Query(queryString string) (*QueryResult, error) {
+	service := f.getQueryService()
+	if service == nil {
+		return nil, ErrQueryServiceNotStarted
+	}
+
+	start := time.Now()
+	result, err := service.Query(queryString)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidQuery, err)
+	}
+
+	entries := make([]ResultEntry, len(result.IDs))
+	for i, id := range result.IDs {
+		entries[i] = ResultEntry{BlockID: id}
+	}
+	for i, row := range result.Rows {
+		entries[i].Values = row.Values
+	}
+
+	return &QueryResult{
+		Entries:     entries,
+		TotalCount:  uint32(result.TotalCount),
+		ReturnCount: uint32(len(entries)),
+		HasMore:     result.HasMore,
+		QueryTime:   uint32(time.Since(start).Milliseconds()),
+	}, nil
+}
+
+// getQueryService 返回已启动的查询服务，未启动时返回nil
+func (f *FragmentaImpl) getQueryService() *index.QueryService {
+	f.componentMutex.RLock()
+	defer f.componentMutex.RUnlock()
+
+	return f.queryService
+}
+
+// queryIndexBlock 将新写入的块同步到查询服务
+func (f *FragmentaImpl) queryIndexBlock(blockID uint32) error {
+	service := f.getQueryService()
+	if service == nil {
+		return nil
+	}
+
+	header, err := f.blockManager.GetBlockInfo(blockID)
+	if err != nil {
+		return err
+	}
+	if err := indexQueryBlock(service, header); err != nil {
+		logger.Error("更新查询索引失败", "blockID", blockID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// queryRemoveBlock 从查询服务中移除已删除的块
+func (f *FragmentaImpl) queryRemoveBlock(blockID uint32) error {
+	service := f.getQueryService()
+	if service == nil {
+		return nil
+	}
+
+	if err := service.RemoveBlock(blockID); err != nil {
+		logger.Error("移除查询索引失败", "blockID", blockID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// indexQueryBlock 索引块头中可查询的字段
+func indexQueryBlock(service *index.QueryService, header *BlockHeader) error {
+	return service.IndexBlock(header.BlockID, header.BlockType, header.Size, time.Unix(0, header.Timestamp))
+}
@@ -0,0 +1,130 @@
+package fragmenta
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// queryBlockIDs 提取查询结果中的块ID
+func queryBlockIDs(result *QueryResult) []uint32 {
+	ids := make([]uint32, 0, len(result.Entries))
+	for _, entry := range result.Entries {
+		ids = append(ids, entry.BlockID)
+	}
+	return ids
+}
+
+// TestQueryService 测试查询服务：启动时索引已有块，之后的写入、属性修改和删除同步到查询服务
+func TestQueryService(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "fragdb-query-*.bin")
+	if err != nil {
+		t.Fatalf("创建临时文件失败: %v", err)
+	}
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	f, err := CreateFragmenta(tempFile.Name(), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	defer f.(*FragmentaImpl).file.Close()
+
+	if _, err := f.Query("tenant==alpha"); !errors.Is(err, ErrQueryServiceNotStarted) {
+		t.Fatalf("查询服务未启动时应返回ErrQueryServiceNotStarted，实际: %v", err)
+	}
+
+	// 启动查询服务前写入的块
+	id1, err := f.WriteBlock(make([]byte, 100), &BlockOptions{
+		BlockType:  1,
+		Attributes: map[string]string{AttrTenant: "alpha", AttrContentType: "text/plain"},
+	})
+	if err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+
+	if err := f.StartQueryService(); err != nil {
+		t.Fatalf("启动查询服务失败: %v", err)
+	}
+	if err := f.StartQueryService(); err != nil {
+		t.Fatalf("重复启动查询服务失败: %v", err)
+	}
+
+	id2, err := f.WriteBlock(make([]byte, 2000), &BlockOptions{
+		BlockType:  2,
+		Attributes: map[string]string{AttrTenant: "beta", AttrContentType: "image/png"},
+	})
+	if err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	id3, err := f.WriteBlock(make([]byte, 3000), &BlockOptions{
+		BlockType:  1,
+		Attributes: map[string]string{AttrTenant: "alpha", AttrContentType: "image/jpeg"},
+	})
+	if err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	id4, err := f.WriteBlock(make([]byte, 10), nil)
+	if err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		want  []uint32
+	}{
+		{"属性等于", "tenant==alpha", []uint32{id1, id3}},
+		{"块头字段比较", "block.size>=2000", []uint32{id2, id3}},
+		{"前缀匹配", "content-type startswith image/", []uint32{id2, id3}},
+		{"正则匹配", `content-type matches ^image/(png|gif)$`, []uint32{id2}},
+		{"逻辑与", "tenant==alpha and block.size>1000", []uint32{id3}},
+		{"逻辑或", "tenant==beta or block.size<50", []uint32{id2, id4}},
+		{"逻辑非", "not tenant==alpha", []uint32{id2, id4}},
+		{"集合", "tenant in [beta, gamma]", []uint32{id2}},
+		{"字段存在", "exists tenant", []uint32{id1, id2, id3}},
+		{"范围", "int:block.size between 50 and 2500", []uint32{id1, id2}},
+		{"块类型", "block.type==1", []uint32{id1, id3}},
+		{"按字段降序", "exists tenant; sort: -block.size", []uint32{id3, id2, id1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := f.Query(tt.query)
+			if err != nil {
+				t.Fatalf("查询失败: %v", err)
+			}
+			if got := queryBlockIDs(result); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("查询结果不正确: 期望 %v，实际 %v", tt.want, got)
+			}
+		})
+	}
+
+	// 分页
+	result, err := f.Query("exists block.id; sort: +id; offset: 1; limit: 2")
+	if err != nil {
+		t.Fatalf("分页查询失败: %v", err)
+	}
+	if !reflect.DeepEqual(queryBlockIDs(result), []uint32{id2, id3}) || result.TotalCount != 4 || !result.HasMore {
+		t.Errorf("分页结果不正确: %v, 总数 %d, HasMore %v", queryBlockIDs(result), result.TotalCount, result.HasMore)
+	}
+
+	// 修改属性和删除块后查询结果随之变化
+	if err := f.SetBlockAttributes(id1, map[string]string{AttrTenant: "beta"}); err != nil {
+		t.Fatalf("设置块属性失败: %v", err)
+	}
+	if err := f.DeleteBlock(id3); err != nil {
+		t.Fatalf("删除块失败: %v", err)
+	}
+	result, err = f.Query("tenant==alpha or block.type==1")
+	if err != nil {
+		t.Fatalf("查询失败: %v", err)
+	}
+	if got := queryBlockIDs(result); !reflect.DeepEqual(got, []uint32{id1}) {
+		t.Errorf("更新后的查询结果不正确: %v", got)
+	}
+
+	if _, err := f.Query("tenant ?? alpha"); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("无效查询应返回ErrInvalidQuery，实际: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package fragmenta
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/bpfs/fragmenta/storage"
+)
+
+// restoreStore 支持从备份流恢复的块数据存储（storage.StorageManagerImpl）
+type restoreStore interface {
+	RestoreFrom(ctx context.Context, r io.Reader, opts *storage.RestoreOptions) (*storage.RestoreResult, error)
+}
+
+// RestoreFromBackup 从块数据存储的备份流（见 storage.StorageManagerImpl.BackupTo）恢复满足查询的块，
+// 例如按属性或元数据标签选出一个租户的块（"tenant==alpha"、"tag:meta==<名称>"），查询语法见 Query。
+// query为空时不按查询过滤；不为空时需要先调用 StartQueryService，没有匹配的块时不读取备份流。
+// 块按原ID恢复，文件中的块头和属性不变；opts中的其他过滤条件同时生效，opts.IDs被查询结果替换。
+// 整个备份流校验通过后才写入存储。需要通过 SetBlockStore 挂接存储管理器，否则返回ErrInvalidOperation
+func (f *FragmentaImpl) RestoreFromBackup(ctx context.Context, r io.Reader, query string, opts *storage.RestoreOptions) (*storage.RestoreResult, error) {
+	var restoreOpts storage.RestoreOptions
+	if opts != nil {
+		restoreOpts = *opts
+	}
+	if f.readOnly && !restoreOpts.VerifyOnly {
+		return nil, ErrReadOnly
+	}
+	store, ok := f.getBlockStore().(restoreStore)
+	if !ok {
+		return nil, fmt.Errorf("%w: 块数据存储不支持从备份恢复", ErrInvalidOperation)
+	}
+
+	if query != "" {
+		result, err := f.Query(query)
+		if err != nil {
+			return nil, err
+		}
+		if len(result.Entries) == 0 {
+			return &storage.RestoreResult{}, nil
+		}
+		restoreOpts.IDs = make([]uint32, len(result.Entries))
+		for i, entry := range result.Entries {
+			restoreOpts.IDs[i] = entry.BlockID
+		}
+	}
+	return store.RestoreFrom(ctx, r, &restoreOpts)
+}
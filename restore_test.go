@@ -0,0 +1,84 @@
+package fragmenta
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/bpfs/fragmenta/storage"
+)
+
+// TestRestoreFromBackup 测试按查询从块数据存储的备份中只恢复一个租户的块
+func TestRestoreFromBackup(t *testing.T) {
+	tempDir := t.TempDir()
+	f, err := CreateFragmenta(filepath.Join(tempDir, "test.frag"), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	defer f.Close()
+
+	sm, err := storage.NewStorageManager(&storage.StorageConfig{
+		Type:      storage.StorageTypeContainer,
+		Path:      filepath.Join(tempDir, "container.db"),
+		BlockSize: 4096,
+	})
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+	t.Cleanup(func() { sm.Close() })
+	if err := f.SetBlockStore(sm); err != nil {
+		t.Fatalf("设置块数据存储失败: %v", err)
+	}
+
+	blocks := make(map[uint32]string)
+	for _, tenant := range []string{"alpha", "beta", "alpha"} {
+		data := "data of " + tenant
+		id, err := f.WriteBlock([]byte(data), &BlockOptions{Attributes: map[string]string{"tenant": tenant}})
+		if err != nil {
+			t.Fatalf("写入块失败: %v", err)
+		}
+		blocks[id] = tenant
+	}
+	if err := f.StartQueryService(); err != nil {
+		t.Fatalf("启动查询服务失败: %v", err)
+	}
+
+	var backup bytes.Buffer
+	if _, err := sm.BackupTo(context.Background(), &backup); err != nil {
+		t.Fatalf("备份失败: %v", err)
+	}
+
+	// 存储中的块数据损坏
+	for id := range blocks {
+		if err := sm.WriteBlock(id, []byte("damaged")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := f.RestoreFromBackup(context.Background(), bytes.NewReader(backup.Bytes()), "tenant==alpha", &storage.RestoreOptions{Overwrite: true})
+	if err != nil {
+		t.Fatalf("恢复失败: %v", err)
+	}
+	if result.Restored != 2 || result.Filtered != 1 {
+		t.Errorf("恢复结果不正确: %+v", result)
+	}
+	for id, tenant := range blocks {
+		want := "damaged"
+		if tenant == "alpha" {
+			want = "data of alpha"
+		}
+		if data, err := f.ReadBlock(id); err != nil || string(data) != want {
+			t.Errorf("块%d(%s): %q, %v", id, tenant, data, err)
+		}
+	}
+
+	// 没有匹配的块时不恢复
+	if result, err := f.RestoreFromBackup(context.Background(), bytes.NewReader(backup.Bytes()), "tenant==gamma", nil); err != nil || result.Restored != 0 {
+		t.Errorf("没有匹配的块时不应恢复: %+v, %v", result, err)
+	}
+	if _, err := f.RestoreFromBackup(context.Background(), bytes.NewReader(backup.Bytes()), "tenant ?? alpha", nil); !errors.Is(err, ErrInvalidQuery) {
+		t.Errorf("无效查询应返回ErrInvalidQuery: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package fragmenta
+
+import (
+	"fmt"
+	"time"
+)
+
+// retentionStore 支持保留策略的块数据存储（storage.StorageManagerImpl）
+type retentionStore interface {
+	SetRetention(id uint32, until time.Time) error
+	SetLegalHold(id uint32, hold bool) error
+	CheckDeletable(id uint32) error
+	RetainedBlocks() []uint32
+}
+
+// SetBlockRetention 设置块的保留期限（WORM），期限之前块不能删除（包括移入回收站和 PurgeTrash），
+// 也不能转换存储模式。期限只能延长。保留策略由块数据存储记录，需要通过 SetBlockStore 挂接
+// 支持保留策略的存储管理器，否则返回ErrInvalidOperation
+func (f *FragmentaImpl) SetBlockRetention(blockID uint32, until time.Time) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	store, err := f.retentionStore()
+	if err != nil {
+		return err
+	}
+	return store.SetRetention(blockID, until)
+}
+
+// SetBlockLegalHold 设置或解除块的法律保留，解除之前块不能删除，见 SetBlockRetention
+func (f *FragmentaImpl) SetBlockLegalHold(blockID uint32, hold bool) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	store, err := f.retentionStore()
+	if err != nil {
+		return err
+	}
+	return store.SetLegalHold(blockID, hold)
+}
+
+// retentionStore 返回支持保留策略的块数据存储
+func (f *FragmentaImpl) retentionStore() (retentionStore, error) {
+	store, ok := f.getBlockStore().(retentionStore)
+	if !ok {
+		return nil, fmt.Errorf("%w: 块数据存储不支持保留策略", ErrInvalidOperation)
+	}
+	return store, nil
+}
+
+// checkRetention 块处于保留中时返回ErrRetained，没有支持保留策略的块数据存储时不检查
+func (f *FragmentaImpl) checkRetention(blockID uint32) error {
+	if store, ok := f.getBlockStore().(retentionStore); ok {
+		return store.CheckDeletable(blockID)
+	}
+	return nil
+}
+
+// checkConvertRetention 有块处于保留中时返回ErrRetained，转换存储模式会重写所有块
+func (f *FragmentaImpl) checkConvertRetention() error {
+	store, ok := f.getBlockStore().(retentionStore)
+	if !ok {
+		return nil
+	}
+	if retained := store.RetainedBlocks(); len(retained) > 0 {
+		return fmt.Errorf("%w: %d个块处于保留中，不能转换存储模式", ErrRetained, len(retained))
+	}
+	return nil
+}
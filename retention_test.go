@@ -0,0 +1,76 @@
+package fragmenta
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bpfs/fragmenta/storage"
+)
+
+// TestBlockRetention 测试保留中的块不能删除、不会被PurgeTrash清除，存储模式也不能转换
+func TestBlockRetention(t *testing.T) {
+	tempDir := t.TempDir()
+	f, err := CreateFragmenta(filepath.Join(tempDir, "test.frag"), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	defer f.Close()
+
+	blockID, err := f.WriteBlock([]byte("archived"), nil)
+	if err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	if err := f.SetBlockLegalHold(blockID, true); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("没有块数据存储时应返回ErrInvalidOperation: %v", err)
+	}
+
+	sm, err := storage.NewStorageManager(&storage.StorageConfig{
+		Type:      storage.StorageTypeContainer,
+		Path:      filepath.Join(tempDir, "container.db"),
+		BlockSize: 1024,
+	})
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+	// 在格式文件关闭之后关闭，关闭时提交的回收站表写入块数据存储
+	t.Cleanup(func() { sm.Close() })
+	if err := f.SetBlockStore(sm); err != nil {
+		t.Fatalf("设置块数据存储失败: %v", err)
+	}
+
+	if err := f.SetBlockRetention(blockID, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("设置保留期限失败: %v", err)
+	}
+	if err := f.DeleteBlock(blockID); !errors.Is(err, ErrRetained) {
+		t.Errorf("保留中的块不应能删除: %v", err)
+	}
+	if err := f.ConvertToDirectoryMode(); !errors.Is(err, ErrRetained) {
+		t.Errorf("有保留中的块时不应能转换存储模式: %v", err)
+	}
+
+	// 移入回收站之后才设置的法律保留也阻止清除
+	other, err := f.WriteBlock([]byte("evidence"), nil)
+	if err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	if err := f.EnableTrash(TrashOptions{}); err != nil {
+		t.Fatalf("启用回收站失败: %v", err)
+	}
+	if err := f.DeleteBlock(other); err != nil {
+		t.Fatalf("删除块失败: %v", err)
+	}
+	if err := f.SetBlockLegalHold(other, true); err != nil {
+		t.Fatalf("设置法律保留失败: %v", err)
+	}
+	if n, err := f.PurgeTrash(); err != nil || n != 0 {
+		t.Errorf("法律保留中的块不应被清除: %d, %v", n, err)
+	}
+	if err := f.SetBlockLegalHold(other, false); err != nil {
+		t.Fatalf("解除法律保留失败: %v", err)
+	}
+	if n, err := f.PurgeTrash(); err != nil || n != 1 {
+		t.Errorf("解除法律保留后应清除: %d, %v", n, err)
+	}
+}
@@ -0,0 +1,457 @@
+package fragmenta
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/bpfs/fragmenta/index"
+)
+
+// MetadataType 元数据值的类型
+type MetadataType uint8
+
+const (
+	// MetadataTypeBytes 原始字节，不做校验
+	MetadataTypeBytes MetadataType = iota
+	// MetadataTypeString UTF-8字符串
+	MetadataTypeString
+	// MetadataTypeInt64 8字节大端整数（与EncodeInt64相同）
+	MetadataTypeInt64
+	// MetadataTypeTime Unix纳秒时间戳，编码与MetadataTypeInt64相同
+	MetadataTypeTime
+	// MetadataTypeGeo 地理位置（index.GeoPoint），纬度和经度各为8字节大端float64
+	MetadataTypeGeo
+	// MetadataTypeVector 向量（[]float32，如嵌入向量），每个分量为4字节大端float32，按 near 条件查询
+	MetadataTypeVector
+)
+
+// String 返回类型名称
+func (t MetadataType) String() string {
+	switch t {
+	case MetadataTypeBytes:
+		return "bytes"
+	case MetadataTypeString:
+		return "string"
+	case MetadataTypeInt64:
+		return "int64"
+	case MetadataTypeTime:
+		return "time"
+	case MetadataTypeGeo:
+		return "geo"
+	case MetadataTypeVector:
+		return "vector"
+	default:
+		return fmt.Sprintf("MetadataType(%d)", uint8(t))
+	}
+}
+
+// MetadataFieldPrefix 块元数据标签在查询服务中的字段名前缀
+const MetadataFieldPrefix = "meta."
+
+// MetadataField 元数据模式中注册的标签
+type MetadataField struct {
+	Tag  uint16       // 元数据标签
+	Name string       // 字段名，块元数据标签在查询中的字段为 MetadataFieldPrefix+Name
+	Type MetadataType // 值的类型
+}
+
+// MetadataSchema 元数据模式注册表，记录标签的名称和值类型
+// 注册的标签在写入时校验编码（文件元数据和块的元数据标签），块的元数据标签按类型解码后
+// 自动索引到查询服务，可以用 "meta.<名称>" 字段查询。系统标签已预先注册
+type MetadataSchema struct {
+	fields map[uint16]MetadataField
+	names  map[string]uint16
+	mutex  sync.RWMutex
+}
+
+// systemMetadataFields 预先注册的系统标签
+var systemMetadataFields = []MetadataField{
+	{TagVersion, "version", MetadataTypeInt64},
+	{TagCreateTime, "create-time", MetadataTypeTime},
+	{TagLastModified, "last-modified", MetadataTypeTime},
+	{TagTitle, "title", MetadataTypeString},
+	{TagDescription, "description", MetadataTypeString},
+	{TagAuthor, "author", MetadataTypeString},
+	{TagContentType, "content-type", MetadataTypeString},
+	{TagContentSize, "content-size", MetadataTypeInt64},
+	{TagFragmentaType, "fragmenta-type", MetadataTypeString},
+	{TagFlags, "flags", MetadataTypeBytes},
+	{TagNamespace, "namespace", MetadataTypeInt64},
+	{TagBlockSignatures, "block-signatures", MetadataTypeInt64},
+	{TagUserTags, "user-tags", MetadataTypeBytes},
+	{TagMetadataHistory, "metadata-history", MetadataTypeInt64},
+	{TagTrash, "trash", MetadataTypeInt64},
+	{TagMetadataExpiry, "metadata-expiry", MetadataTypeBytes},
+	{TagQueryViews, "query-views", MetadataTypeBytes},
+	{TagJobs, "jobs", MetadataTypeBytes},
+}
+
+// NewMetadataSchema 创建包含系统标签的元数据模式
+func NewMetadataSchema() *MetadataSchema {
+	schema := &MetadataSchema{
+		fields: make(map[uint16]MetadataField, len(systemMetadataFields)),
+		names:  make(map[string]uint16, len(systemMetadataFields)),
+	}
+	for _, field := range systemMetadataFields {
+		schema.fields[field.Tag] = field
+		schema.names[field.Name] = field.Tag
+	}
+	return schema
+}
+
+// Register 注册标签。重复注册相同的定义不做任何事，标签或名称已用于其他定义时返回ErrInvalidArgument
+func (s *MetadataSchema) Register(field MetadataField) error {
+	if err := validateFieldName(field.Name); err != nil {
+		return err
+	}
+	if field.Type > MetadataTypeVector {
+		return fmt.Errorf("%w: 未知的元数据类型%d", ErrInvalidArgument, field.Type)
+	}
+	if IsSystemTag(field.Tag) {
+		return fmt.Errorf("%w: 系统标签范围保留给格式自身", ErrInvalidArgument)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if existing, ok := s.fields[field.Tag]; ok {
+		if existing == field {
+			return nil
+		}
+		return fmt.Errorf("%w: 标签0x%04X已注册为%s(%s)", ErrInvalidArgument, field.Tag, existing.Name, existing.Type)
+	}
+	if tag, ok := s.names[field.Name]; ok {
+		return fmt.Errorf("%w: 名称%q已用于标签0x%04X", ErrInvalidArgument, field.Name, tag)
+	}
+
+	s.fields[field.Tag] = field
+	s.names[field.Name] = field.Tag
+	return nil
+}
+
+// Field 查找已注册的标签
+func (s *MetadataSchema) Field(tag uint16) (MetadataField, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	field, ok := s.fields[tag]
+	return field, ok
+}
+
+// Lookup 按名称查找已注册的标签
+func (s *MetadataSchema) Lookup(name string) (MetadataField, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	tag, ok := s.names[name]
+	if !ok {
+		return MetadataField{}, false
+	}
+	return s.fields[tag], true
+}
+
+// Fields 返回所有已注册的标签，按标签排序
+func (s *MetadataSchema) Fields() []MetadataField {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	fields := make([]MetadataField, 0, len(s.fields))
+	for _, field := range s.fields {
+		fields = append(fields, field)
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Tag < fields[j].Tag })
+	return fields
+}
+
+// Validate 检查值是否符合标签注册的类型，未注册的标签总是有效
+func (s *MetadataSchema) Validate(tag uint16, data []byte) error {
+	field, ok := s.Field(tag)
+	if !ok {
+		return nil
+	}
+	_, err := decodeMetadataValue(field.Type, data)
+	if err != nil {
+		return fmt.Errorf("%w: 标签0x%04X(%s): %v", ErrMetadataType, tag, field.Name, err)
+	}
+	return nil
+}
+
+// Encode 按标签注册的类型编码值，值的Go类型须为string、int64、time.Time、index.GeoPoint、[]float32或[]byte
+func (s *MetadataSchema) Encode(tag uint16, value interface{}) ([]byte, error) {
+	field, ok := s.Field(tag)
+	if !ok {
+		return nil, fmt.Errorf("%w: 标签0x%04X未注册", ErrInvalidArgument, tag)
+	}
+	return encodeMetadataValue(field.Type, value)
+}
+
+// Decode 按标签注册的类型解码值，返回string、int64、time.Time、index.GeoPoint、[]float32或[]byte
+func (s *MetadataSchema) Decode(tag uint16, data []byte) (interface{}, error) {
+	field, ok := s.Field(tag)
+	if !ok {
+		return nil, fmt.Errorf("%w: 标签0x%04X未注册", ErrInvalidArgument, tag)
+	}
+	value, err := decodeMetadataValue(field.Type, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 标签0x%04X(%s): %v", ErrMetadataType, tag, field.Name, err)
+	}
+	return value, nil
+}
+
+// indexValues 解码块的元数据标签中已注册的非字节类型标签，返回查询字段名到值的映射
+func (s *MetadataSchema) indexValues(metadataTags map[uint16][]byte) map[string]interface{} {
+	var values map[string]interface{}
+	for tag, data := range metadataTags {
+		field, ok := s.Field(tag)
+		if !ok || field.Type == MetadataTypeBytes {
+			continue
+		}
+		value, err := decodeMetadataValue(field.Type, data)
+		if err != nil {
+			continue
+		}
+		if values == nil {
+			values = make(map[string]interface{})
+		}
+		values[MetadataFieldPrefix+field.Name] = value
+	}
+	return values
+}
+
+// validateFieldName 检查字段名，只允许字母、数字和 - _ . 以便在查询字符串中使用
+func validateFieldName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: 元数据字段名不能为空", ErrInvalidArgument)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return fmt.Errorf("%w: 元数据字段名%q包含无效字符%q", ErrInvalidArgument, name, r)
+		}
+	}
+	return nil
+}
+
+// encodeMetadataValue 按类型编码值
+func encodeMetadataValue(typ MetadataType, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case string:
+		if typ == MetadataTypeString {
+			if !utf8.ValidString(v) {
+				return nil, fmt.Errorf("%w: 无效的UTF-8字符串", ErrMetadataType)
+			}
+			return []byte(v), nil
+		}
+	case int64:
+		if typ == MetadataTypeInt64 {
+			return EncodeInt64(v), nil
+		}
+	case time.Time:
+		if typ == MetadataTypeTime {
+			return EncodeInt64(v.UnixNano()), nil
+		}
+	case index.GeoPoint:
+		if typ == MetadataTypeGeo {
+			if !v.Valid() {
+				return nil, fmt.Errorf("%w: 经纬度超出范围: %s", ErrMetadataType, v)
+			}
+			data := binary.BigEndian.AppendUint64(nil, math.Float64bits(v.Lat))
+			return binary.BigEndian.AppendUint64(data, math.Float64bits(v.Lon)), nil
+		}
+	case []float32:
+		if typ == MetadataTypeVector {
+			if len(v) == 0 {
+				return nil, fmt.Errorf("%w: 向量不能为空", ErrMetadataType)
+			}
+			data := make([]byte, 0, 4*len(v))
+			for _, x := range v {
+				data = binary.BigEndian.AppendUint32(data, math.Float32bits(x))
+			}
+			return data, nil
+		}
+	case []byte:
+		if typ == MetadataTypeBytes {
+			return append([]byte(nil), v...), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %T不能编码为%s", ErrMetadataType, value, typ)
+}
+
+// decodeMetadataValue 按类型解码值
+func decodeMetadataValue(typ MetadataType, data []byte) (interface{}, error) {
+	switch typ {
+	case MetadataTypeString:
+		if !utf8.Valid(data) {
+			return nil, fmt.Errorf("无效的UTF-8字符串")
+		}
+		return string(data), nil
+	case MetadataTypeInt64, MetadataTypeTime:
+		if len(data) != 8 {
+			return nil, fmt.Errorf("%s值应为8字节，实际%d字节", typ, len(data))
+		}
+		if typ == MetadataTypeTime {
+			return time.Unix(0, DecodeInt64(data)), nil
+		}
+		return DecodeInt64(data), nil
+	case MetadataTypeGeo:
+		if len(data) != 16 {
+			return nil, fmt.Errorf("%s值应为16字节，实际%d字节", typ, len(data))
+		}
+		point := index.GeoPoint{
+			Lat: math.Float64frombits(binary.BigEndian.Uint64(data)),
+			Lon: math.Float64frombits(binary.BigEndian.Uint64(data[8:])),
+		}
+		if !point.Valid() {
+			return nil, fmt.Errorf("经纬度超出范围: %s", point)
+		}
+		return point, nil
+	case MetadataTypeVector:
+		if len(data) == 0 || len(data)%4 != 0 {
+			return nil, fmt.Errorf("%s值应为4字节的非零整数倍，实际%d字节", typ, len(data))
+		}
+		vector := make([]float32, len(data)/4)
+		for i := range vector {
+			vector[i] = math.Float32frombits(binary.BigEndian.Uint32(data[4*i:]))
+		}
+		return vector, nil
+	default:
+		return append([]byte(nil), data...), nil
+	}
+}
+
+// MetadataSchema 返回文件的元数据模式注册表
+func (f *FragmentaImpl) MetadataSchema() *MetadataSchema {
+	f.schemaOnce.Do(func() {
+		f.schema = NewMetadataSchema()
+	})
+	return f.schema
+}
+
+// SetMetadataString 设置字符串类型的元数据
+func (f *FragmentaImpl) SetMetadataString(tag uint16, value string) error {
+	return f.setTypedMetadata(tag, MetadataTypeString, value)
+}
+
+// GetMetadataString 获取字符串类型的元数据
+func (f *FragmentaImpl) GetMetadataString(tag uint16) (string, error) {
+	value, err := f.getTypedMetadata(tag, MetadataTypeString)
+	if err != nil {
+		return "", err
+	}
+	return value.(string), nil
+}
+
+// SetMetadataInt64 设置整数类型的元数据
+func (f *FragmentaImpl) SetMetadataInt64(tag uint16, value int64) error {
+	return f.setTypedMetadata(tag, MetadataTypeInt64, value)
+}
+
+// GetMetadataInt64 获取整数类型的元数据
+func (f *FragmentaImpl) GetMetadataInt64(tag uint16) (int64, error) {
+	value, err := f.getTypedMetadata(tag, MetadataTypeInt64)
+	if err != nil {
+		return 0, err
+	}
+	return value.(int64), nil
+}
+
+// SetMetadataTime 设置时间类型的元数据
+func (f *FragmentaImpl) SetMetadataTime(tag uint16, value time.Time) error {
+	return f.setTypedMetadata(tag, MetadataTypeTime, value)
+}
+
+// GetMetadataTime 获取时间类型的元数据
+func (f *FragmentaImpl) GetMetadataTime(tag uint16) (time.Time, error) {
+	value, err := f.getTypedMetadata(tag, MetadataTypeTime)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return value.(time.Time), nil
+}
+
+// setTypedMetadata 编码并设置元数据，标签注册为其他类型时返回ErrMetadataType
+func (f *FragmentaImpl) setTypedMetadata(tag uint16, typ MetadataType, value interface{}) error {
+	if err := f.checkMetadataType(tag, typ); err != nil {
+		return err
+	}
+
+	data, err := encodeMetadataValue(typ, value)
+	if err != nil {
+		return err
+	}
+	return f.SetMetadata(tag, data)
+}
+
+// getTypedMetadata 获取并解码元数据，标签注册为其他类型时返回ErrMetadataType
+func (f *FragmentaImpl) getTypedMetadata(tag uint16, typ MetadataType) (interface{}, error) {
+	if err := f.checkMetadataType(tag, typ); err != nil {
+		return nil, err
+	}
+
+	data, err := f.GetMetadata(tag)
+	if err != nil {
+		return nil, err
+	}
+	value, err := decodeMetadataValue(typ, data)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 标签0x%04X: %v", ErrMetadataType, tag, err)
+	}
+	return value, nil
+}
+
+// checkMetadataType 检查标签注册的类型
+func (f *FragmentaImpl) checkMetadataType(tag uint16, typ MetadataType) error {
+	field, ok := f.MetadataSchema().Field(tag)
+	if ok && field.Type != typ {
+		return fmt.Errorf("%w: 标签0x%04X(%s)注册为%s，不是%s", ErrMetadataType, tag, field.Name, field.Type, typ)
+	}
+	return nil
+}
+
+// validateBlockMetadataTags 校验块的元数据标签中已注册标签的值
+func (f *FragmentaImpl) validateBlockMetadataTags(metadataTags map[uint16][]byte) error {
+	schema := f.MetadataSchema()
+	for tag, data := range metadataTags {
+		if err := schema.Validate(tag, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateBatch 校验批量操作：不能修改保留标签，已注册标签的值须符合类型，整数、时间和地理位置类型的标签不能附加
+func (f *FragmentaImpl) validateBatch(batch *BatchMetadataOperation) error {
+	if batch == nil {
+		return nil
+	}
+
+	schema := f.MetadataSchema()
+	for _, op := range batch.Operations {
+		if IsReservedTag(op.Tag) {
+			return ErrProtectedMetadata
+		}
+
+		switch op.Operation {
+		case 0:
+			if err := schema.Validate(op.Tag, op.Value); err != nil {
+				return err
+			}
+		case 2:
+			field, ok := schema.Field(op.Tag)
+			if !ok {
+				continue
+			}
+			if field.Type == MetadataTypeInt64 || field.Type == MetadataTypeTime || field.Type == MetadataTypeGeo || field.Type == MetadataTypeVector {
+				return fmt.Errorf("%w: 标签0x%04X(%s)是%s类型，不能附加", ErrMetadataType, op.Tag, field.Name, field.Type)
+			}
+			if err := schema.Validate(op.Tag, op.Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
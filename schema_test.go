@@ -0,0 +1,209 @@
+package fragmenta
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bpfs/fragmenta/index"
+)
+
+// TestMetadataSchema 测试元数据模式的注册、校验和类型化读写
+func TestMetadataSchema(t *testing.T) {
+	f, err := CreateFragmenta(filepath.Join(t.TempDir(), "test.frag"), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	defer f.Close()
+
+	schema := f.MetadataSchema()
+	pages := UserTag(1)
+	if err := schema.Register(MetadataField{Tag: pages, Name: "pages", Type: MetadataTypeInt64}); err != nil {
+		t.Fatalf("注册标签失败: %v", err)
+	}
+	if err := schema.Register(MetadataField{Tag: pages, Name: "pages", Type: MetadataTypeInt64}); err != nil {
+		t.Errorf("重复注册相同的定义应成功: %v", err)
+	}
+	if err := schema.Register(MetadataField{Tag: pages, Name: "pages", Type: MetadataTypeString}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("标签已注册为其他类型应返回ErrInvalidArgument: %v", err)
+	}
+	if err := schema.Register(MetadataField{Tag: UserTag(2), Name: "title", Type: MetadataTypeString}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("名称已被使用应返回ErrInvalidArgument: %v", err)
+	}
+	if err := schema.Register(MetadataField{Tag: UserTag(3), Name: "bad name", Type: MetadataTypeString}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("无效的名称应返回ErrInvalidArgument: %v", err)
+	}
+	if field, ok := schema.Lookup("pages"); !ok || field.Tag != pages {
+		t.Errorf("按名称查找标签失败: %+v", field)
+	}
+
+	// 类型化读写
+	if err := f.SetMetadataInt64(pages, 42); err != nil {
+		t.Fatalf("设置整数元数据失败: %v", err)
+	}
+	if n, err := f.GetMetadataInt64(pages); err != nil || n != 42 {
+		t.Errorf("读取整数元数据不正确: %d, %v", n, err)
+	}
+	if err := f.SetMetadataString(TagTitle, "schema"); err != nil {
+		t.Fatalf("设置字符串元数据失败: %v", err)
+	}
+	if s, err := f.GetMetadataString(TagTitle); err != nil || s != "schema" {
+		t.Errorf("读取字符串元数据不正确: %q, %v", s, err)
+	}
+	created, err := f.GetMetadataTime(TagCreateTime)
+	if err != nil || time.Since(created) > time.Minute {
+		t.Errorf("读取创建时间不正确: %v, %v", created, err)
+	}
+
+	// 类型不符
+	if err := f.SetMetadataString(pages, "many"); !errors.Is(err, ErrMetadataType) {
+		t.Errorf("按其他类型设置应返回ErrMetadataType: %v", err)
+	}
+	if _, err := f.GetMetadataTime(TagTitle); !errors.Is(err, ErrMetadataType) {
+		t.Errorf("按其他类型读取应返回ErrMetadataType: %v", err)
+	}
+	if err := f.SetMetadata(pages, []byte("abc")); !errors.Is(err, ErrMetadataType) {
+		t.Errorf("写入编码错误的值应返回ErrMetadataType: %v", err)
+	}
+	if err := f.SetMetadata(TagTitle, []byte{0xff, 0xfe}); !errors.Is(err, ErrMetadataType) {
+		t.Errorf("写入无效的UTF-8字符串应返回ErrMetadataType: %v", err)
+	}
+	batch := &BatchMetadataOperation{Operations: []MetadataOperation{{Operation: 2, Tag: pages, Value: []byte{1}}}}
+	if err := f.BatchMetadataOp(batch); !errors.Is(err, ErrMetadataType) {
+		t.Errorf("附加整数标签应返回ErrMetadataType: %v", err)
+	}
+	if n, _ := f.GetMetadataInt64(pages); n != 42 {
+		t.Errorf("校验失败的写入不应生效: %d", n)
+	}
+
+	// 未注册的标签按请求的类型读写
+	if err := f.SetMetadataTime(UserTag(9), created); err != nil {
+		t.Fatalf("设置未注册标签失败: %v", err)
+	}
+	if got, err := f.GetMetadataTime(UserTag(9)); err != nil || !got.Equal(created) {
+		t.Errorf("读取未注册标签不正确: %v, %v", got, err)
+	}
+}
+
+// TestMetadataSchemaIndexing 测试注册的块元数据标签自动索引到查询服务
+func TestMetadataSchemaIndexing(t *testing.T) {
+	f, err := CreateFragmenta(filepath.Join(t.TempDir(), "test.frag"), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	defer f.Close()
+
+	pages, published := UserTag(1), UserTag(2)
+	f.MetadataSchema().Register(MetadataField{Tag: pages, Name: "pages", Type: MetadataTypeInt64})
+	f.MetadataSchema().Register(MetadataField{Tag: published, Name: "published", Type: MetadataTypeTime})
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	write := func(n int64, days int) uint32 {
+		id, err := f.WriteBlock([]byte("doc"), &BlockOptions{Checksum: true, MetadataTags: map[uint16][]byte{
+			pages:     EncodeInt64(n),
+			published: EncodeInt64(base.AddDate(0, 0, days).UnixNano()),
+			TagAuthor: []byte("alice"),
+		}})
+		if err != nil {
+			t.Fatalf("写入块失败: %v", err)
+		}
+		return id
+	}
+
+	// 查询服务启动前写入的块在启动时索引
+	short := write(3, 0)
+	if err := f.StartQueryService(); err != nil {
+		t.Fatalf("启动查询服务失败: %v", err)
+	}
+	long := write(120, 30)
+
+	tests := []struct {
+		query string
+		want  []uint32
+	}{
+		{"meta.pages>10", []uint32{long}},
+		{"meta.author==alice; sort: -meta.pages", []uint32{long, short}},
+		{"date:meta.published<2025-01-15T00:00:00Z", []uint32{short}},
+	}
+	for _, tt := range tests {
+		result, err := f.Query(tt.query)
+		if err != nil {
+			t.Errorf("查询 %q 失败: %v", tt.query, err)
+			continue
+		}
+		ids := make([]uint32, len(result.Entries))
+		for i, entry := range result.Entries {
+			ids[i] = entry.BlockID
+		}
+		if !reflect.DeepEqual(ids, tt.want) {
+			t.Errorf("查询 %q 结果不正确: 期望 %v，实际 %v", tt.query, tt.want, ids)
+		}
+	}
+
+	if _, err := f.WriteBlock([]byte("bad"), &BlockOptions{MetadataTags: map[uint16][]byte{pages: []byte("x")}}); !errors.Is(err, ErrMetadataType) {
+		t.Errorf("块元数据标签编码错误应返回ErrMetadataType: %v", err)
+	}
+
+	if err := f.DeleteBlock(long); err != nil {
+		t.Fatalf("删除块失败: %v", err)
+	}
+	if result, _ := f.Query("meta.pages>10"); len(result.Entries) != 0 {
+		t.Errorf("删除的块不应再可查: %v", result.Entries)
+	}
+
+	// 地理位置类型的标签按拍摄位置查询
+	location := UserTag(3)
+	if err := f.MetadataSchema().Register(MetadataField{Tag: location, Name: "location", Type: MetadataTypeGeo}); err != nil {
+		t.Fatalf("注册地理位置标签失败: %v", err)
+	}
+	shanghai, err := f.MetadataSchema().Encode(location, index.GeoPoint{Lat: 31.2304, Lon: 121.4737})
+	if err != nil {
+		t.Fatalf("编码地理位置失败: %v", err)
+	}
+	photo, err := f.WriteBlock([]byte("photo"), &BlockOptions{MetadataTags: map[uint16][]byte{location: shanghai}})
+	if err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	for query, want := range map[string]int{
+		"meta.location within_radius 31.22,121.48,5km":  1,
+		"meta.location within_radius 39.90,116.40,50km": 0,
+		"meta.location in_bbox 30,120,32,122":           1,
+	} {
+		result, err := f.Query(query)
+		if err != nil || len(result.Entries) != want || (want == 1 && result.Entries[0].BlockID != photo) {
+			t.Errorf("查询 %q 结果不正确: %v, %v", query, result, err)
+		}
+	}
+	if _, err := f.MetadataSchema().Encode(location, index.GeoPoint{Lat: 91}); !errors.Is(err, ErrMetadataType) {
+		t.Errorf("超出范围的位置应返回ErrMetadataType: %v", err)
+	}
+
+	// 向量类型的标签按相似度查询
+	embedding := UserTag(4)
+	if err := f.MetadataSchema().Register(MetadataField{Tag: embedding, Name: "embedding", Type: MetadataTypeVector}); err != nil {
+		t.Fatalf("注册向量标签失败: %v", err)
+	}
+	vectors := map[string][]float32{"cat": {1, 0.1, 0}, "dog": {0.9, 0.3, 0}, "car": {0, 0.1, 1}}
+	ids := make(map[string]uint32)
+	for name, vector := range vectors {
+		data, err := f.MetadataSchema().Encode(embedding, vector)
+		if err != nil {
+			t.Fatalf("编码向量失败: %v", err)
+		}
+		if ids[name], err = f.WriteBlock([]byte(name), &BlockOptions{MetadataTags: map[uint16][]byte{embedding: data}}); err != nil {
+			t.Fatalf("写入块失败: %v", err)
+		}
+	}
+	result, err := f.Query("meta.embedding near [1, 0.2, 0] 2")
+	if err != nil {
+		t.Fatalf("最近邻查询失败: %v", err)
+	}
+	if len(result.Entries) != 2 || result.Entries[0].BlockID != ids["cat"] || result.Entries[1].BlockID != ids["dog"] {
+		t.Errorf("最近邻查询结果不正确: %v", result.Entries)
+	}
+	if _, err := f.MetadataSchema().Encode(embedding, []float32{}); !errors.Is(err, ErrMetadataType) {
+		t.Errorf("空向量应返回ErrMetadataType: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package security
+
+import (
+	"context"
+	"strconv"
+)
+
+// subjectKey 上下文中保存主体的键
+type subjectKey struct{}
+
+// WithSubject 返回附带主体身份的上下文。存储管理器和元数据管理器只对附带身份的上下文做授权检查
+func WithSubject(ctx context.Context, subject Subject) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// SubjectFromContext 获取上下文中的主体身份
+func SubjectFromContext(ctx context.Context) (Subject, bool) {
+	if ctx == nil {
+		return Subject{}, false
+	}
+	subject, ok := ctx.Value(subjectKey{}).(Subject)
+	return subject, ok
+}
+
+// Authorizer 授权检查接口
+type Authorizer interface {
+	// Authorize 检查上下文中的主体是否可以对资源执行操作，上下文中没有主体时不做检查，
+	// 拒绝时返回 *PermissionError，errors.Is可以匹配 ErrPermissionDenied
+	Authorize(ctx context.Context, resource Resource, operation Operation) error
+}
+
+// NewBlockResource 创建数据块资源，资源ID为十进制块ID
+func NewBlockResource(blockID uint32) Resource {
+	return NewResource(strconv.FormatUint(uint64(blockID), 10), BlockResource, nil)
+}
+
+// NewMetadataResource 创建元数据资源，资源ID为十进制标签值，
+// 权限可以用 "4096-8191" 这样的范围模式覆盖一段标签
+func NewMetadataResource(tag uint16) Resource {
+	return NewResource(strconv.Itoa(int(tag)), MetadataResource, nil)
+}
+
+// Authorize 检查上下文中的主体是否可以对资源执行操作，上下文中没有主体时不做检查
+func (m *AccessControlManager) Authorize(ctx context.Context, resource Resource, operation Operation) error {
+	subject, ok := SubjectFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	allowed, err := m.CheckAccess(ctx, subject, resource, operation)
+	if err != nil {
+		return err
+	}
+	if allowed {
+		return nil
+	}
+
+	m.mu.RLock()
+	audit := m.audit
+	m.mu.RUnlock()
+	if audit != nil {
+		audit.Append(AuditAccessDenied, subject.ID, map[string]string{
+			"resource":  string(resource.Type) + ":" + resource.ID,
+			"operation": string(operation),
+		})
+	}
+	return &PermissionError{Subject: subject.ID, Operation: operation, Resource: resource}
+}
+
+// AuthorizeMetadata 检查元数据标签访问，operation为操作名称（read、write、delete），
+// 供不依赖安全包的元数据管理器使用
+func (m *AccessControlManager) AuthorizeMetadata(ctx context.Context, operation string, tag uint16) error {
+	return m.Authorize(ctx, NewMetadataResource(tag), Operation(operation))
+}
+
+// SetAuditRecorder 设置审计记录器，被拒绝的访问会被记录
+func (m *AccessControlManager) SetAuditRecorder(recorder AuditRecorder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.audit = recorder
+}
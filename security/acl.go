@@ -3,9 +3,12 @@ package security
 import (
 	"context"
 	"errors"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/bpfs/fragmenta/clock"
 )
 
 // 常见错误定义
@@ -24,6 +27,12 @@ var (
 
 	// ErrInvalidPolicy 表示无效的策略
 	ErrInvalidPolicy = errors.New("invalid policy")
+
+	// ErrEntryNotFound 表示访问控制条目不存在
+	ErrEntryNotFound = errors.New("entry not found")
+
+	// ErrDuplicateEntry 表示访问控制条目已存在
+	ErrDuplicateEntry = errors.New("duplicate entry")
 )
 
 // ResourceType 资源类型
@@ -173,6 +182,9 @@ type DefaultACLManager struct {
 
 	// 互斥锁保护并发访问
 	mutex sync.RWMutex
+
+	// 时钟，用于条目的创建时间和过期判断，为nil时使用系统时钟
+	clock clock.Clock
 }
 
 // NewDefaultACLManager 创建默认的访问控制列表管理器
@@ -182,10 +194,18 @@ func NewDefaultACLManager() *DefaultACLManager {
 	}
 }
 
+// SetClock 设置时钟，为nil时使用系统时钟
+func (m *DefaultACLManager) SetClock(c clock.Clock) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.clock = c
+}
+
 // AddEntry 添加访问控制条目
 func (m *DefaultACLManager) AddEntry(ctx context.Context, entry *ACLEntry) error {
 	if entry == nil {
-		return errors.New("entry cannot be nil")
+		return invalidArgument("entry cannot be nil")
 	}
 
 	// 验证条目有效性
@@ -193,18 +213,18 @@ func (m *DefaultACLManager) AddEntry(ctx context.Context, entry *ACLEntry) error
 		return err
 	}
 
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
 	// 设置创建时间（如果未设置）
 	if entry.CreatedAt.IsZero() {
-		entry.CreatedAt = time.Now()
+		entry.CreatedAt = clock.OrSystem(m.clock).Now()
 	}
 
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
 	// 检查是否已存在相同条目
 	for _, e := range m.entries {
 		if entriesEqual(e, entry) {
-			return errors.New("duplicate entry")
+			return ErrDuplicateEntry
 		}
 	}
 
@@ -216,7 +236,7 @@ func (m *DefaultACLManager) AddEntry(ctx context.Context, entry *ACLEntry) error
 // RemoveEntry 移除访问控制条目
 func (m *DefaultACLManager) RemoveEntry(ctx context.Context, entry *ACLEntry) error {
 	if entry == nil {
-		return errors.New("entry cannot be nil")
+		return invalidArgument("entry cannot be nil")
 	}
 
 	m.mutex.Lock()
@@ -231,13 +251,13 @@ func (m *DefaultACLManager) RemoveEntry(ctx context.Context, entry *ACLEntry) er
 		}
 	}
 
-	return errors.New("entry not found")
+	return ErrEntryNotFound
 }
 
 // UpdateEntry 更新访问控制条目
 func (m *DefaultACLManager) UpdateEntry(ctx context.Context, entry *ACLEntry) error {
 	if entry == nil {
-		return errors.New("entry cannot be nil")
+		return invalidArgument("entry cannot be nil")
 	}
 
 	// 验证条目有效性
@@ -259,7 +279,7 @@ func (m *DefaultACLManager) UpdateEntry(ctx context.Context, entry *ACLEntry) er
 		}
 	}
 
-	return errors.New("entry not found")
+	return ErrEntryNotFound
 }
 
 // CheckAccess 检查是否允许访问
@@ -275,16 +295,22 @@ func (m *DefaultACLManager) CheckAccess(ctx context.Context, subject Subject, re
 		return false, ErrInvalidOperation
 	}
 
+	return m.decide(subject, resource, operation) == AllowPolicy, nil
+}
+
+// decide 返回匹配条目给出的决定：存在匹配的拒绝条目时为 DenyPolicy，
+// 只有允许条目时为 AllowPolicy，没有匹配条目时为空
+func (m *DefaultACLManager) decide(subject Subject, resource Resource, operation Operation) Policy {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
-	// 默认情况下，拒绝访问
-	isAllowed := false
+	var decision Policy
+	now := clock.OrSystem(m.clock).Now()
 
-	// 先检查明确的拒绝规则（拒绝规则优先级高于允许规则）
+	// 拒绝规则优先级高于允许规则
 	for _, entry := range m.entries {
 		// 跳过过期的条目
-		if entry.ExpiresAt != nil && time.Now().After(*entry.ExpiresAt) {
+		if entry.ExpiresAt != nil && now.After(*entry.ExpiresAt) {
 			continue
 		}
 
@@ -300,17 +326,17 @@ func (m *DefaultACLManager) CheckAccess(ctx context.Context, subject Subject, re
 
 			// 如果是拒绝策略，直接拒绝访问
 			if entry.Policy == DenyPolicy {
-				return false, nil
+				return DenyPolicy
 			}
 
 			// 如果是允许策略，标记为允许（但继续检查是否有更高优先级的拒绝规则）
 			if entry.Policy == AllowPolicy {
-				isAllowed = true
+				decision = AllowPolicy
 			}
 		}
 	}
 
-	return isAllowed, nil
+	return decision
 }
 
 // ListEntries 列出符合条件的访问控制条目
@@ -319,10 +345,11 @@ func (m *DefaultACLManager) ListEntries(ctx context.Context, subject *Subject, r
 	defer m.mutex.RUnlock()
 
 	result := make([]*ACLEntry, 0)
+	now := clock.OrSystem(m.clock).Now()
 
 	for _, entry := range m.entries {
 		// 跳过过期的条目
-		if entry.ExpiresAt != nil && time.Now().After(*entry.ExpiresAt) {
+		if entry.ExpiresAt != nil && now.After(*entry.ExpiresAt) {
 			continue
 		}
 
@@ -467,6 +494,14 @@ func matchResourceID(pattern, resourceID string) bool {
 		return true
 	}
 
+	// 数值范围匹配（例如 "4096-8191" 匹配该范围内的元数据标签或块ID）
+	if low, high, ok := strings.Cut(pattern, "-"); ok {
+		min, err1 := strconv.ParseUint(low, 0, 64)
+		max, err2 := strconv.ParseUint(high, 0, 64)
+		id, err3 := strconv.ParseUint(resourceID, 10, 64)
+		return err1 == nil && err2 == nil && err3 == nil && id >= min && id <= max
+	}
+
 	return false
 }
 
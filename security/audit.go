@@ -0,0 +1,447 @@
+package security
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// 审计操作名称
+const (
+	AuditKeyGenerate       = "key.generate"
+	AuditKeyImport         = "key.import"
+	AuditKeyDelete         = "key.delete"
+	AuditKeyRotate         = "key.rotate"
+	AuditKeyAutoRotate     = "key.auto_rotate"
+	AuditKeySetDefault     = "key.set_default"
+	AuditObjectErase       = "key.crypto_erase"
+	AuditCertificateImport = "key.import_certificate"
+	AuditKeyStoreUnlock    = "keystore.unlock"
+	AuditKeyStoreLock      = "keystore.lock"
+	AuditEncryptionEnable  = "encryption.enable"
+	AuditEncryptionDisable = "encryption.disable"
+	AuditAlgorithmChange   = "encryption.algorithm"
+	AuditMetadataSet       = "metadata.set"
+	AuditMetadataDelete    = "metadata.delete"
+	AuditAccessDenied      = "access.denied"
+
+	// AuditCheckpoint 签名检查点，签名覆盖检查点自身的哈希，也就覆盖了之前的整条哈希链
+	AuditCheckpoint = "audit.checkpoint"
+)
+
+var (
+	// ErrAuditTampered 审计日志内容被修改
+	ErrAuditTampered = errors.New("audit log has been tampered with")
+
+	// ErrAuditTruncated 审计日志被截断
+	ErrAuditTruncated = errors.New("audit log has been truncated")
+)
+
+// AuditRecorder 记录安全相关操作
+type AuditRecorder interface {
+	// Append 追加一条审计记录，subject为操作对象（密钥ID、文件路径等）
+	Append(action, subject string, details map[string]string) error
+}
+
+// AuditRecord 审计记录，每条记录包含上一条记录的哈希，构成哈希链
+type AuditRecord struct {
+	// Seq 序号，从1开始连续递增
+	Seq uint64 `json:"seq"`
+
+	// Time 记录时间
+	Time time.Time `json:"time"`
+
+	// Action 操作名称
+	Action string `json:"action"`
+
+	// Subject 操作对象
+	Subject string `json:"subject,omitempty"`
+
+	// Details 操作详情
+	Details map[string]string `json:"details,omitempty"`
+
+	// PrevHash 上一条记录的哈希
+	PrevHash []byte `json:"prev_hash"`
+
+	// Hash 本条记录的哈希，不包含签名
+	Hash []byte `json:"hash"`
+
+	// Signature 检查点对Hash的签名
+	Signature []byte `json:"signature,omitempty"`
+}
+
+// computeHash 计算记录哈希
+func (r *AuditRecord) computeHash() []byte {
+	content, _ := json.Marshal(struct {
+		Seq      uint64            `json:"seq"`
+		Time     int64             `json:"time"`
+		Action   string            `json:"action"`
+		Subject  string            `json:"subject"`
+		Details  map[string]string `json:"details"`
+		PrevHash []byte            `json:"prev_hash"`
+	}{r.Seq, r.Time.UnixNano(), r.Action, r.Subject, r.Details, r.PrevHash})
+	sum := sha256.Sum256(content)
+	return sum[:]
+}
+
+// auditHead 最近一个检查点，保存在日志旁的 .head 文件中，用于发现日志尾部被截断
+type auditHead struct {
+	Seq       uint64 `json:"seq"`
+	Hash      []byte `json:"hash"`
+	Signature []byte `json:"signature"`
+}
+
+// AuditLogOptions 审计日志选项
+type AuditLogOptions struct {
+	// Signer 签名提供者，为nil时只维护哈希链，不生成签名检查点
+	Signer SignatureProvider
+
+	// Algorithm 签名算法
+	Algorithm string
+
+	// SigningKey 签名私钥（HMAC算法为对称密钥）
+	SigningKey []byte
+
+	// CheckpointEvery 每追加多少条记录生成一个检查点，默认100
+	CheckpointEvery int
+
+	// CheckpointInterval 距上一个检查点超过该时间且有新记录时生成检查点，0表示不按时间
+	CheckpointInterval time.Duration
+
+	// Sync 每条记录写入后同步到磁盘
+	Sync bool
+}
+
+// AuditLog 只追加、带哈希链和定期签名检查点的审计日志，每行一条JSON记录
+type AuditLog struct {
+	path    string
+	options AuditLogOptions
+
+	file     *os.File
+	lastSeq  uint64
+	lastHash []byte
+
+	// 上一个检查点之后追加的记录数
+	sinceCheckpoint int
+
+	stop chan struct{}
+	done chan struct{}
+	mu   sync.Mutex
+}
+
+// OpenAuditLog 打开或创建审计日志，已有日志从最后一条记录继续
+func OpenAuditLog(path string, options AuditLogOptions) (*AuditLog, error) {
+	if options.Signer != nil && (options.Algorithm == "" || len(options.SigningKey) == 0) {
+		return nil, errors.New("audit log signer requires algorithm and signing key")
+	}
+	if options.CheckpointEvery <= 0 {
+		options.CheckpointEvery = 100
+	}
+
+	l := &AuditLog{path: path, options: options}
+	err := readAuditLog(path, func(r *AuditRecord) error {
+		l.lastSeq, l.lastHash = r.Seq, r.Hash
+		if r.Action == AuditCheckpoint {
+			l.sinceCheckpoint = 0
+		} else {
+			l.sinceCheckpoint++
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	l.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	if options.Signer != nil && options.CheckpointInterval > 0 {
+		l.stop = make(chan struct{})
+		l.done = make(chan struct{})
+		go l.checkpointLoop()
+	}
+	return l, nil
+}
+
+// Append 追加一条审计记录
+func (l *AuditLog) Append(action, subject string, details map[string]string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.appendLocked(action, subject, details, false); err != nil {
+		return err
+	}
+	l.sinceCheckpoint++
+	if l.options.Signer != nil && l.sinceCheckpoint >= l.options.CheckpointEvery {
+		return l.checkpointLocked()
+	}
+	return nil
+}
+
+// Checkpoint 立即生成签名检查点，没有新记录时不生成
+func (l *AuditLog) Checkpoint() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.options.Signer == nil {
+		return errors.New("audit log has no signer")
+	}
+	if l.sinceCheckpoint == 0 {
+		return nil
+	}
+	return l.checkpointLocked()
+}
+
+// Close 生成最后一个检查点并关闭日志
+func (l *AuditLog) Close() error {
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	var err error
+	if l.options.Signer != nil && l.sinceCheckpoint > 0 {
+		err = l.checkpointLocked()
+	}
+	if closeErr := l.file.Close(); err == nil {
+		err = closeErr
+	}
+	l.file = nil
+	return err
+}
+
+// Verify 用公钥（HMAC算法为对称密钥）验证日志
+func (l *AuditLog) Verify(ctx context.Context, publicKey []byte) (*AuditReport, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return VerifyAuditLog(ctx, l.path, l.options.Signer, l.options.Algorithm, publicKey)
+}
+
+// checkpointLoop 按时间间隔生成检查点
+func (l *AuditLog) checkpointLoop() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.options.CheckpointInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			l.Checkpoint()
+		}
+	}
+}
+
+// appendLocked 写入一条记录，调用方需持有锁
+func (l *AuditLog) appendLocked(action, subject string, details map[string]string, sign bool) (*AuditRecord, error) {
+	if l.file == nil {
+		return nil, errors.New("audit log is closed")
+	}
+
+	r := &AuditRecord{
+		Seq:      l.lastSeq + 1,
+		Time:     time.Now().UTC(),
+		Action:   action,
+		Subject:  subject,
+		Details:  details,
+		PrevHash: l.lastHash,
+	}
+	r.Hash = r.computeHash()
+
+	if sign {
+		signature, err := l.options.Signer.Sign(context.Background(), l.options.Algorithm, l.options.SigningKey, r.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign audit checkpoint: %w", err)
+		}
+		r.Signature = signature
+	}
+
+	line, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return nil, fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if l.options.Sync || sign {
+		if err := l.file.Sync(); err != nil {
+			return nil, fmt.Errorf("failed to sync audit log: %w", err)
+		}
+	}
+
+	l.lastSeq, l.lastHash = r.Seq, r.Hash
+	return r, nil
+}
+
+// checkpointLocked 追加签名检查点并更新 .head 文件，调用方需持有锁
+func (l *AuditLog) checkpointLocked() error {
+	r, err := l.appendLocked(AuditCheckpoint, "", map[string]string{"algorithm": l.options.Algorithm}, true)
+	if err != nil {
+		return err
+	}
+	l.sinceCheckpoint = 0
+
+	data, err := json.Marshal(auditHead{Seq: r.Seq, Hash: r.Hash, Signature: r.Signature})
+	if err != nil {
+		return err
+	}
+	tempPath := l.path + ".head.tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write audit head: %w", err)
+	}
+	if err := os.Rename(tempPath, l.path+".head"); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write audit head: %w", err)
+	}
+	return nil
+}
+
+// AuditReport 审计日志验证结果
+type AuditReport struct {
+	// Records 记录总数（含检查点）
+	Records int
+
+	// Checkpoints 检查点数
+	Checkpoints int
+
+	// LastSeq 最后一条记录的序号
+	LastSeq uint64
+
+	// LastCheckpointSeq 最后一个检查点的序号
+	LastCheckpointSeq uint64
+
+	// Unsigned 最后一个检查点之后尚未被签名覆盖的记录数
+	Unsigned int
+}
+
+// VerifyAuditLog 验证审计日志的哈希链和检查点签名，并用 .head 文件检查日志是否被截断。
+// verifier为nil时只验证哈希链
+func VerifyAuditLog(ctx context.Context, path string, verifier SignatureProvider, algorithm string, publicKey []byte) (*AuditReport, error) {
+	report := &AuditReport{}
+	var prevHash []byte
+	checkpoints := make(map[uint64][]byte)
+
+	err := readAuditLog(path, func(r *AuditRecord) error {
+		if r.Seq != report.LastSeq+1 {
+			return fmt.Errorf("%w: record %d follows %d", ErrAuditTampered, r.Seq, report.LastSeq)
+		}
+		if !bytes.Equal(r.PrevHash, prevHash) {
+			return fmt.Errorf("%w: record %d does not chain to previous record", ErrAuditTampered, r.Seq)
+		}
+		if !bytes.Equal(r.Hash, r.computeHash()) {
+			return fmt.Errorf("%w: record %d hash mismatch", ErrAuditTampered, r.Seq)
+		}
+
+		report.Records++
+		report.Unsigned++
+		if r.Action == AuditCheckpoint {
+			if verifier != nil {
+				if err := verifyAuditSignature(ctx, verifier, algorithm, publicKey, r.Hash, r.Signature); err != nil {
+					return fmt.Errorf("%w: checkpoint %d: %v", ErrAuditTampered, r.Seq, err)
+				}
+			}
+			checkpoints[r.Seq] = r.Hash
+			report.Checkpoints++
+			report.LastCheckpointSeq = r.Seq
+			report.Unsigned = 0
+		}
+		report.LastSeq, prevHash = r.Seq, r.Hash
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return report, err
+	}
+
+	// 检查点之后的记录被删掉时哈希链仍然完整，需要对照 .head 文件
+	data, headErr := os.ReadFile(path + ".head")
+	switch {
+	case errors.Is(headErr, os.ErrNotExist):
+		if report.Checkpoints > 0 {
+			return report, fmt.Errorf("%w: head file missing", ErrAuditTruncated)
+		}
+	case headErr != nil:
+		return report, fmt.Errorf("failed to read audit head: %w", headErr)
+	default:
+		var head auditHead
+		if err := json.Unmarshal(data, &head); err != nil {
+			return report, fmt.Errorf("%w: invalid head file", ErrAuditTampered)
+		}
+		if verifier != nil {
+			if err := verifyAuditSignature(ctx, verifier, algorithm, publicKey, head.Hash, head.Signature); err != nil {
+				return report, fmt.Errorf("%w: head: %v", ErrAuditTampered, err)
+			}
+		}
+		hash, ok := checkpoints[head.Seq]
+		if !ok {
+			return report, fmt.Errorf("%w: checkpoint %d missing, log ends at %d", ErrAuditTruncated, head.Seq, report.LastSeq)
+		}
+		if !bytes.Equal(hash, head.Hash) {
+			return report, fmt.Errorf("%w: checkpoint %d does not match head", ErrAuditTampered, head.Seq)
+		}
+	}
+
+	return report, nil
+}
+
+// verifyAuditSignature 验证检查点签名
+func verifyAuditSignature(ctx context.Context, verifier SignatureProvider, algorithm string, publicKey, hash, signature []byte) error {
+	if len(signature) == 0 {
+		return errors.New("missing signature")
+	}
+	valid, err := verifier.Verify(ctx, algorithm, publicKey, hash, signature)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// readAuditLog 逐条读取审计日志，最后一行不完整视为被截断
+func readAuditLog(path string, fn func(r *AuditRecord) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				return fmt.Errorf("%w: incomplete last record", ErrAuditTruncated)
+			}
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read audit log: %w", err)
+		}
+
+		var r AuditRecord
+		if err := json.Unmarshal(line, &r); err != nil {
+			return fmt.Errorf("%w: malformed record: %v", ErrAuditTampered, err)
+		}
+		if err := fn(&r); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// CertificateType 证书链条目的类型，与密钥保存在同一密钥库中
+const CertificateType KeyType = "CERTIFICATE"
+
+var (
+	// ErrCertificateNotFound 密钥对没有导入证书
+	ErrCertificateNotFound = errors.New("certificate not found")
+
+	// ErrCertificateKeyMismatch 证书的公钥与密钥对不匹配
+	ErrCertificateKeyMismatch = errors.New("certificate public key does not match key pair")
+
+	// ErrUntrustedCertificate 证书链无法验证到受信任的CA
+	ErrUntrustedCertificate = errors.New("certificate is not trusted")
+)
+
+// certificateEntryID 密钥对证书链在密钥库中的ID
+func certificateEntryID(privateKeyID string) string {
+	return "cert-" + privateKeyID
+}
+
+// CreateCSR 用密钥对的私钥生成证书签名请求，返回PEM编码的CSR
+func (km *DefaultKeyManager) CreateCSR(ctx context.Context, privateKeyID string, template *x509.CertificateRequest) ([]byte, error) {
+	if template == nil {
+		return nil, invalidArgument("CSR template cannot be nil")
+	}
+
+	signer, err := km.privateKeySigner(ctx, privateKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.CreateCertificateRequest(rand.Reader, template, signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CSR: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// ImportCertificate 为密钥对导入PEM编码的证书链，第一张证书必须是该密钥对的证书，
+// 其余为中间证书。再次导入时替换原有证书链
+func (km *DefaultKeyManager) ImportCertificate(ctx context.Context, privateKeyID string, certPEM []byte) error {
+	chain, err := ParseCertificateChain(certPEM)
+	if err != nil {
+		return err
+	}
+
+	signer, err := km.privateKeySigner(ctx, privateKeyID)
+	if err != nil {
+		return err
+	}
+	leaf := chain[0]
+	if pub, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !pub.Equal(leaf.PublicKey) {
+		return ErrCertificateKeyMismatch
+	}
+
+	entry := &KeyEntry{
+		Key: encodeCertificateChain(chain),
+		Metadata: map[string]string{
+			"type":           string(CertificateType),
+			"private_key_id": privateKeyID,
+			"subject":        leaf.Subject.String(),
+			"issuer":         leaf.Issuer.String(),
+			"serial":         leaf.SerialNumber.String(),
+		},
+		CreatedAt: time.Now(),
+		ExpiresAt: leaf.NotAfter,
+	}
+	data, err := serializeKeyEntry(entry)
+	if err != nil {
+		return fmt.Errorf("failed to serialize certificate: %w", err)
+	}
+	if err := km.storage.Store(ctx, certificateEntryID(privateKeyID), data); err != nil {
+		return err
+	}
+
+	km.record(AuditCertificateImport, privateKeyID, map[string]string{"subject": leaf.Subject.String(), "serial": leaf.SerialNumber.String()})
+	return nil
+}
+
+// ExportCertificate 导出密钥对的PEM编码证书链
+func (km *DefaultKeyManager) ExportCertificate(ctx context.Context, privateKeyID string) ([]byte, error) {
+	data, err := km.storage.Retrieve(ctx, certificateEntryID(privateKeyID))
+	if err != nil {
+		if exists, _ := km.KeyExists(ctx, certificateEntryID(privateKeyID)); !exists {
+			return nil, fmt.Errorf("%w: %s", ErrCertificateNotFound, privateKeyID)
+		}
+		return nil, fmt.Errorf("failed to retrieve certificate: %w", err)
+	}
+
+	entry, err := deserializeKeyEntry(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize certificate: %w", err)
+	}
+	return entry.Key, nil
+}
+
+// GetCertificateChain 获取密钥对的证书链，第一张为密钥对自身的证书
+func (km *DefaultKeyManager) GetCertificateChain(ctx context.Context, privateKeyID string) ([]*x509.Certificate, error) {
+	certPEM, err := km.ExportCertificate(ctx, privateKeyID)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCertificateChain(certPEM)
+}
+
+// privateKeySigner 读取私钥并转换为 crypto.Signer，硬件密钥从设备中查找
+func (km *DefaultKeyManager) privateKeySigner(ctx context.Context, privateKeyID string) (crypto.Signer, error) {
+	entry, err := km.RetrieveKeyEntry(ctx, privateKeyID)
+	if err != nil {
+		return nil, err
+	}
+	if IsHardwareKey(entry) {
+		return km.hardwareSigner(ctx, entry)
+	}
+	return parsePrivateKeySigner(KeyType(entry.Metadata["type"]), entry.Key)
+}
+
+// parsePrivateKeySigner 按密钥类型解析私钥，格式与 GenerateKeyPair 一致
+func parsePrivateKeySigner(keyType KeyType, keyData []byte) (crypto.Signer, error) {
+	switch keyType {
+	case ED25519PrivateKey:
+		return ParseEd25519PrivateKey(keyData)
+	case RSAPrivateKey, ECPrivateKey:
+		key, err := x509.ParsePKCS8PrivateKey(keyData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, errors.New("private key cannot sign")
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("key type %s is not a private key", keyType)
+	}
+}
+
+// ParseCertificateChain 解析PEM编码的证书链，忽略其他类型的PEM块
+func ParseCertificateChain(certPEM []byte) ([]*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	for rest := certPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		chain = append(chain, cert)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("no certificate found in PEM data")
+	}
+	return chain, nil
+}
+
+// encodeCertificateChain 将证书链编码为PEM
+func encodeCertificateChain(chain []*x509.Certificate) []byte {
+	var buf bytes.Buffer
+	for _, cert := range chain {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	}
+	return buf.Bytes()
+}
+
+// TrustStore 受信任的CA证书集合，用于验证证书链
+type TrustStore struct {
+	// 根证书
+	roots *x509.CertPool
+
+	// 额外的中间证书
+	intermediates *x509.CertPool
+
+	// 要求的扩展密钥用途，为空时不限制
+	keyUsages []x509.ExtKeyUsage
+}
+
+// NewTrustStore 用PEM编码的CA证书创建信任库
+func NewTrustStore(caPEM ...[]byte) (*TrustStore, error) {
+	ts := &TrustStore{
+		roots:         x509.NewCertPool(),
+		intermediates: x509.NewCertPool(),
+		keyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}
+	for _, data := range caPEM {
+		if err := ts.AddRoots(data); err != nil {
+			return nil, err
+		}
+	}
+	return ts, nil
+}
+
+// LoadTrustStore 从PEM文件加载CA证书
+func LoadTrustStore(paths ...string) (*TrustStore, error) {
+	ts, _ := NewTrustStore()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		if err := ts.AddRoots(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return ts, nil
+}
+
+// AddRoots 添加受信任的根证书
+func (ts *TrustStore) AddRoots(caPEM []byte) error {
+	chain, err := ParseCertificateChain(caPEM)
+	if err != nil {
+		return err
+	}
+	for _, cert := range chain {
+		ts.roots.AddCert(cert)
+	}
+	return nil
+}
+
+// AddIntermediates 添加中间证书，签名中未附带完整证书链时使用
+func (ts *TrustStore) AddIntermediates(certPEM []byte) error {
+	chain, err := ParseCertificateChain(certPEM)
+	if err != nil {
+		return err
+	}
+	for _, cert := range chain {
+		ts.intermediates.AddCert(cert)
+	}
+	return nil
+}
+
+// SetKeyUsages 设置证书必须具备的扩展密钥用途
+func (ts *TrustStore) SetKeyUsages(usages ...x509.ExtKeyUsage) {
+	ts.keyUsages = usages
+}
+
+// Verify 验证证书链能否追溯到受信任的根证书，chain第一张为待验证的证书，
+// at为零值时使用当前时间
+func (ts *TrustStore) Verify(chain []*x509.Certificate, at time.Time) error {
+	if len(chain) == 0 {
+		return fmt.Errorf("%w: empty certificate chain", ErrUntrustedCertificate)
+	}
+
+	intermediates := ts.intermediates.Clone()
+	for _, cert := range chain[1:] {
+		intermediates.AddCert(cert)
+	}
+	keyUsages := ts.keyUsages
+	if len(keyUsages) == 0 {
+		keyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+
+	_, err := chain[0].Verify(x509.VerifyOptions{
+		Roots:         ts.roots,
+		Intermediates: intermediates,
+		CurrentTime:   at,
+		KeyUsages:     keyUsages,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUntrustedCertificate, err)
+	}
+	return nil
+}
+
+// SignWithCertificate 用私钥签名，并在 SignedData 中附带证书链以便验证方识别签名者
+func (p *DefaultSignatureProvider) SignWithCertificate(ctx context.Context, algorithm string, privateKey []byte, chain []*x509.Certificate, data []byte) ([]byte, error) {
+	if len(chain) == 0 {
+		return nil, invalidArgument("certificate chain cannot be empty")
+	}
+	if info, exists := p.algorithms[algorithm]; exists && info.KeyType == SymmetricKey {
+		return nil, fmt.Errorf("algorithm %s cannot be used with certificates", algorithm)
+	}
+
+	signature, err := p.Sign(ctx, algorithm, privateKey, data)
+	if err != nil {
+		return nil, err
+	}
+	return attachCertificates(signature, chain)
+}
+
+// attachCertificates 在签名数据中附带证书链
+func attachCertificates(signature []byte, chain []*x509.Certificate) ([]byte, error) {
+	if len(chain) == 0 {
+		return nil, invalidArgument("certificate chain cannot be empty")
+	}
+
+	var signedData SignedData
+	if err := json.Unmarshal(signature, &signedData); err != nil {
+		return nil, fmt.Errorf("failed to deserialize signed data: %w", err)
+	}
+	for _, cert := range chain {
+		signedData.Certificates = append(signedData.Certificates, cert.Raw)
+	}
+	return json.Marshal(&signedData)
+}
+
+// VerifyWithTrust 用签名中附带的证书验证签名，证书链必须能追溯到信任库中的CA，
+// 验证通过时返回签名者证书
+func (p *DefaultSignatureProvider) VerifyWithTrust(ctx context.Context, trust *TrustStore, data []byte, signature []byte) (*x509.Certificate, error) {
+	if trust == nil {
+		return nil, invalidArgument("trust store cannot be nil")
+	}
+
+	var signedData SignedData
+	if err := json.Unmarshal(signature, &signedData); err != nil {
+		return nil, fmt.Errorf("failed to deserialize signed data: %w", err)
+	}
+	if len(signedData.Certificates) == 0 {
+		return nil, fmt.Errorf("%w: signature carries no certificate", ErrUntrustedCertificate)
+	}
+
+	chain := make([]*x509.Certificate, 0, len(signedData.Certificates))
+	for _, der := range signedData.Certificates {
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		chain = append(chain, cert)
+	}
+	if err := trust.Verify(chain, time.Time{}); err != nil {
+		return nil, err
+	}
+
+	publicKey, err := marshalSignaturePublicKey(chain[0].PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	valid, err := p.Verify(ctx, signedData.Algorithm, publicKey, data, signature)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, errors.New("signature verification failed")
+	}
+	return chain[0], nil
+}
+
+// marshalSignaturePublicKey 将公钥编码为签名提供者使用的格式：Ed25519为原始公钥，其他为PKIX
+func marshalSignaturePublicKey(publicKey crypto.PublicKey) ([]byte, error) {
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		return key, nil
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return x509.MarshalPKIXPublicKey(key)
+	default:
+		return nil, fmt.Errorf("unsupported certificate public key type %T", publicKey)
+	}
+}
+
+// defaultSignatureAlgorithm 按私钥类型选择签名算法
+func defaultSignatureAlgorithm(signer crypto.Signer) (SignatureAlgorithmName, error) {
+	switch key := signer.Public().(type) {
+	case ed25519.PublicKey:
+		return ED25519, nil
+	case *rsa.PublicKey:
+		return RSA_PSS_SHA256, nil
+	case *ecdsa.PublicKey:
+		switch key.Curve.Params().BitSize {
+		case 256:
+			return ECDSA_P256_SHA256, nil
+		case 384:
+			return ECDSA_P384_SHA384, nil
+		}
+	}
+	return "", fmt.Errorf("no signature algorithm for key type %T", signer.Public())
+}
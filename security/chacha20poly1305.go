@@ -0,0 +1,326 @@
+package security
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// ChaCha20-Poly1305（RFC 8439）和XChaCha20-Poly1305（draft-irtf-cfrg-xchacha）的纯Go实现。
+// 不依赖AES硬件指令，适合没有AES-NI的ARM设备
+
+const (
+	// chachaKeySize 密钥长度
+	chachaKeySize = 32
+
+	// chachaNonceSize ChaCha20-Poly1305随机数长度
+	chachaNonceSize = 12
+
+	// xchachaNonceSize XChaCha20-Poly1305随机数长度，足够长，可以安全地使用随机数
+	xchachaNonceSize = 24
+
+	// poly1305TagSize 认证标签长度
+	poly1305TagSize = 16
+
+	// chachaMaxPlaintext 32位块计数器能加密的最大长度
+	chachaMaxPlaintext = (1<<32 - 1) * 64
+)
+
+var errChaChaOpen = errors.New("chacha20poly1305: message authentication failed")
+
+// chachaAEAD ChaCha20-Poly1305 AEAD
+type chachaAEAD struct {
+	key      [8]uint32
+	extended bool
+}
+
+// newChaCha20Poly1305 创建ChaCha20-Poly1305，随机数为12字节
+func newChaCha20Poly1305(key []byte) (cipher.AEAD, error) {
+	return newChaChaAEAD(key, false)
+}
+
+// newXChaCha20Poly1305 创建XChaCha20-Poly1305，随机数为24字节
+func newXChaCha20Poly1305(key []byte) (cipher.AEAD, error) {
+	return newChaChaAEAD(key, true)
+}
+
+func newChaChaAEAD(key []byte, extended bool) (cipher.AEAD, error) {
+	if len(key) != chachaKeySize {
+		return nil, errors.New("chacha20poly1305: bad key length")
+	}
+	a := &chachaAEAD{extended: extended}
+	for i := range a.key {
+		a.key[i] = binary.LittleEndian.Uint32(key[i*4:])
+	}
+	return a, nil
+}
+
+// NonceSize 随机数长度
+func (a *chachaAEAD) NonceSize() int {
+	if a.extended {
+		return xchachaNonceSize
+	}
+	return chachaNonceSize
+}
+
+// Overhead 密文比明文多出的长度
+func (a *chachaAEAD) Overhead() int {
+	return poly1305TagSize
+}
+
+// Seal 加密并认证明文，结果追加到dst
+func (a *chachaAEAD) Seal(dst, nonce, plaintext, additionalData []byte) []byte {
+	if len(nonce) != a.NonceSize() {
+		panic("chacha20poly1305: bad nonce length passed to Seal")
+	}
+	if uint64(len(plaintext)) > chachaMaxPlaintext {
+		panic("chacha20poly1305: plaintext too large")
+	}
+
+	key, n := a.subkey(nonce)
+	ret, out := sliceForAppend(dst, len(plaintext)+poly1305TagSize)
+
+	var polyKey [64]byte
+	chachaBlock(&polyKey, &key, &n, 0)
+	chachaXOR(out[:len(plaintext)], plaintext, &key, &n, 1)
+
+	tag := chachaPolyTag(polyKey[:32], additionalData, out[:len(plaintext)])
+	copy(out[len(plaintext):], tag[:])
+	return ret
+}
+
+// Open 验证并解密密文，结果追加到dst
+func (a *chachaAEAD) Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error) {
+	if len(nonce) != a.NonceSize() {
+		panic("chacha20poly1305: bad nonce length passed to Open")
+	}
+	if len(ciphertext) < poly1305TagSize || uint64(len(ciphertext)-poly1305TagSize) > chachaMaxPlaintext {
+		return nil, errChaChaOpen
+	}
+
+	key, n := a.subkey(nonce)
+	tag := ciphertext[len(ciphertext)-poly1305TagSize:]
+	ciphertext = ciphertext[:len(ciphertext)-poly1305TagSize]
+
+	var polyKey [64]byte
+	chachaBlock(&polyKey, &key, &n, 0)
+	expected := chachaPolyTag(polyKey[:32], additionalData, ciphertext)
+	if subtle.ConstantTimeCompare(expected[:], tag) != 1 {
+		return nil, errChaChaOpen
+	}
+
+	ret, out := sliceForAppend(dst, len(ciphertext))
+	chachaXOR(out, ciphertext, &key, &n, 1)
+	return ret, nil
+}
+
+// subkey 返回ChaCha20使用的密钥和12字节随机数。XChaCha20用HChaCha20和随机数前16字节派生子密钥，
+// 随机数为4个零字节加原随机数后8字节
+func (a *chachaAEAD) subkey(nonce []byte) ([8]uint32, [3]uint32) {
+	if !a.extended {
+		return a.key, [3]uint32{
+			binary.LittleEndian.Uint32(nonce[0:]),
+			binary.LittleEndian.Uint32(nonce[4:]),
+			binary.LittleEndian.Uint32(nonce[8:]),
+		}
+	}
+	return hChaCha20(&a.key, nonce[:16]), [3]uint32{
+		0,
+		binary.LittleEndian.Uint32(nonce[16:]),
+		binary.LittleEndian.Uint32(nonce[20:]),
+	}
+}
+
+// chachaPolyTag 计算AEAD认证标签：
+// AAD | 填充 | 密文 | 填充 | AAD长度(8字节小端) | 密文长度(8字节小端)
+func chachaPolyTag(key, additionalData, ciphertext []byte) [poly1305TagSize]byte {
+	var p poly1305
+	p.init(key)
+	p.update(additionalData, true)
+	p.update(ciphertext, true)
+
+	var lengths [16]byte
+	binary.LittleEndian.PutUint64(lengths[0:], uint64(len(additionalData)))
+	binary.LittleEndian.PutUint64(lengths[8:], uint64(len(ciphertext)))
+	p.update(lengths[:], false)
+	return p.sum()
+}
+
+// sliceForAppend 扩展in，返回扩展后的整个切片和新增部分
+func sliceForAppend(in []byte, n int) (head, tail []byte) {
+	if total := len(in) + n; cap(in) >= total {
+		head = in[:total]
+	} else {
+		head = make([]byte, total)
+		copy(head, in)
+	}
+	tail = head[len(in):]
+	return
+}
+
+// ChaCha20
+
+// chachaConstants "expand 32-byte k"
+var chachaConstants = [4]uint32{0x61707865, 0x3320646e, 0x79622d32, 0x6b206574}
+
+func quarterRound(a, b, c, d uint32) (uint32, uint32, uint32, uint32) {
+	a += b
+	d = bits.RotateLeft32(d^a, 16)
+	c += d
+	b = bits.RotateLeft32(b^c, 12)
+	a += b
+	d = bits.RotateLeft32(d^a, 8)
+	c += d
+	b = bits.RotateLeft32(b^c, 7)
+	return a, b, c, d
+}
+
+// chachaRounds 对状态执行20轮（10次列轮和对角轮）
+func chachaRounds(x *[16]uint32) {
+	for i := 0; i < 10; i++ {
+		x[0], x[4], x[8], x[12] = quarterRound(x[0], x[4], x[8], x[12])
+		x[1], x[5], x[9], x[13] = quarterRound(x[1], x[5], x[9], x[13])
+		x[2], x[6], x[10], x[14] = quarterRound(x[2], x[6], x[10], x[14])
+		x[3], x[7], x[11], x[15] = quarterRound(x[3], x[7], x[11], x[15])
+
+		x[0], x[5], x[10], x[15] = quarterRound(x[0], x[5], x[10], x[15])
+		x[1], x[6], x[11], x[12] = quarterRound(x[1], x[6], x[11], x[12])
+		x[2], x[7], x[8], x[13] = quarterRound(x[2], x[7], x[8], x[13])
+		x[3], x[4], x[9], x[14] = quarterRound(x[3], x[4], x[9], x[14])
+	}
+}
+
+// chachaBlock 生成计数器为counter的64字节密钥流块
+func chachaBlock(out *[64]byte, key *[8]uint32, nonce *[3]uint32, counter uint32) {
+	var state [16]uint32
+	copy(state[0:4], chachaConstants[:])
+	copy(state[4:12], key[:])
+	state[12] = counter
+	copy(state[13:16], nonce[:])
+
+	x := state
+	chachaRounds(&x)
+	for i := range x {
+		binary.LittleEndian.PutUint32(out[i*4:], x[i]+state[i])
+	}
+}
+
+// chachaXOR 用从counter开始的密钥流加密或解密src
+func chachaXOR(dst, src []byte, key *[8]uint32, nonce *[3]uint32, counter uint32) {
+	var block [64]byte
+	for len(src) > 0 {
+		chachaBlock(&block, key, nonce, counter)
+		n := subtle.XORBytes(dst, src, block[:])
+		dst, src = dst[n:], src[n:]
+		counter++
+	}
+}
+
+// hChaCha20 从密钥和16字节随机数派生XChaCha20子密钥
+func hChaCha20(key *[8]uint32, nonce []byte) [8]uint32 {
+	var x [16]uint32
+	copy(x[0:4], chachaConstants[:])
+	copy(x[4:12], key[:])
+	for i := 0; i < 4; i++ {
+		x[12+i] = binary.LittleEndian.Uint32(nonce[i*4:])
+	}
+
+	chachaRounds(&x)
+	return [8]uint32{x[0], x[1], x[2], x[3], x[12], x[13], x[14], x[15]}
+}
+
+// Poly1305
+
+// poly1305 一次性消息认证码，累加器h为130位，用三个64位字保存
+type poly1305 struct {
+	h [3]uint64
+	r [2]uint64
+	s [2]uint64
+}
+
+func (p *poly1305) init(key []byte) {
+	p.r[0] = binary.LittleEndian.Uint64(key[0:]) & 0x0FFFFFFC0FFFFFFF
+	p.r[1] = binary.LittleEndian.Uint64(key[8:]) & 0x0FFFFFFC0FFFFFFC
+	p.s[0] = binary.LittleEndian.Uint64(key[16:])
+	p.s[1] = binary.LittleEndian.Uint64(key[24:])
+}
+
+// update 处理消息。pad为true时最后不足16字节的分组补零到16字节（AEAD的填充方式），
+// 否则按Poly1305的规则在末尾补1
+func (p *poly1305) update(msg []byte, pad bool) {
+	h0, h1, h2 := p.h[0], p.h[1], p.h[2]
+	r0, r1 := p.r[0], p.r[1]
+
+	for len(msg) > 0 {
+		var block [poly1305TagSize]byte
+		n := copy(block[:], msg)
+		msg = msg[n:]
+
+		// 完整分组在第129位补1；短分组在消息之后补1（AEAD的填充方式则直接补零为完整分组）
+		hibit := uint64(1)
+		if n < poly1305TagSize && !pad {
+			block[n] = 1
+			hibit = 0
+		}
+
+		var c uint64
+		h0, c = bits.Add64(h0, binary.LittleEndian.Uint64(block[0:]), 0)
+		h1, c = bits.Add64(h1, binary.LittleEndian.Uint64(block[8:]), c)
+		h2 += c + hibit
+
+		// h = h * r mod 2^130-5，r经过截断，h2不超过7，乘积不会溢出
+		h0r0hi, h0r0lo := bits.Mul64(h0, r0)
+		h1r0hi, h1r0lo := bits.Mul64(h1, r0)
+		h2r0hi, h2r0lo := bits.Mul64(h2, r0)
+		h0r1hi, h0r1lo := bits.Mul64(h0, r1)
+		h1r1hi, h1r1lo := bits.Mul64(h1, r1)
+		_, h2r1lo := bits.Mul64(h2, r1)
+
+		m1lo, c := bits.Add64(h1r0lo, h0r1lo, 0)
+		m1hi, _ := bits.Add64(h1r0hi, h0r1hi, c)
+		m2lo, c := bits.Add64(h2r0lo, h1r1lo, 0)
+		m2hi, _ := bits.Add64(h2r0hi, h1r1hi, c)
+
+		t0 := h0r0lo
+		t1, c := bits.Add64(m1lo, h0r0hi, 0)
+		t2, c := bits.Add64(m2lo, m1hi, c)
+		t3, _ := bits.Add64(h2r1lo, m2hi, c)
+
+		// 2^130 ≡ 5，高位部分c乘以5 = c*4 + c
+		h0, h1, h2 = t0, t1, t2&3
+		cclo, cchi := t2&^3, t3
+		h0, c = bits.Add64(h0, cclo, 0)
+		h1, c = bits.Add64(h1, cchi, c)
+		h2 += c
+		cclo, cchi = cclo>>2|cchi<<62, cchi>>2
+		h0, c = bits.Add64(h0, cclo, 0)
+		h1, c = bits.Add64(h1, cchi, c)
+		h2 += c
+
+		p.h[0], p.h[1], p.h[2] = h0, h1, h2
+	}
+}
+
+// sum 计算标签：h mod 2^130-5 加上s，取低128位
+func (p *poly1305) sum() [poly1305TagSize]byte {
+	h0, h1, h2 := p.h[0], p.h[1], p.h[2]
+
+	// h >= p 时减去p
+	t0, b := bits.Sub64(h0, 0xFFFFFFFFFFFFFFFB, 0)
+	t1, b := bits.Sub64(h1, 0xFFFFFFFFFFFFFFFF, b)
+	_, b = bits.Sub64(h2, 3, b)
+	mask := b - 1
+	h0 = h0&^mask | t0&mask
+	h1 = h1&^mask | t1&mask
+
+	var c uint64
+	h0, c = bits.Add64(h0, p.s[0], 0)
+	h1, _ = bits.Add64(h1, p.s[1], c)
+
+	var tag [poly1305TagSize]byte
+	binary.LittleEndian.PutUint64(tag[0:], h0)
+	binary.LittleEndian.PutUint64(tag[8:], h1)
+	return tag
+}
@@ -30,6 +30,9 @@ type algorithmInfo struct {
 	Description string
 	Encrypt     encryptFunc
 	Decrypt     decryptFunc
+
+	// NewAEAD 对称算法的AEAD构造函数，用于加密块信封
+	NewAEAD func(key []byte) (cipher.AEAD, error)
 }
 
 // NewDefaultEncryptionProvider 创建默认加密提供者
@@ -53,6 +56,7 @@ func (p *DefaultEncryptionProvider) registerAlgorithms() {
 		Description: "AES-256-GCM",
 		Encrypt:     p.encryptAES,
 		Decrypt:     p.decryptAES,
+		NewAEAD:     newAESGCM,
 	}
 
 	p.algorithms[string(AES256CTR)] = &algorithmInfo{
@@ -61,14 +65,25 @@ func (p *DefaultEncryptionProvider) registerAlgorithms() {
 		Description: "AES-256-CTR",
 		Encrypt:     p.encryptAES,
 		Decrypt:     p.decryptAES,
+		NewAEAD:     newAESGCM,
 	}
 
 	p.algorithms[string(ChaCha20Poly1305)] = &algorithmInfo{
 		Type:        SymmetricEncryption,
 		KeySize:     256,
 		Description: "ChaCha20-Poly1305",
-		Encrypt:     p.encryptAES, // 临时使用AES实现
-		Decrypt:     p.decryptAES, // 临时使用AES实现
+		Encrypt:     p.encryptAEAD,
+		Decrypt:     p.decryptAEAD,
+		NewAEAD:     newChaCha20Poly1305,
+	}
+
+	p.algorithms[string(XChaCha20Poly1305)] = &algorithmInfo{
+		Type:        SymmetricEncryption,
+		KeySize:     256,
+		Description: "XChaCha20-Poly1305 (24-byte random nonce)",
+		Encrypt:     p.encryptAEAD,
+		Decrypt:     p.decryptAEAD,
+		NewAEAD:     newXChaCha20Poly1305,
 	}
 
 	// 非对称加密算法
@@ -176,11 +191,22 @@ func generateDeterministicNonce(blockID uint32, size int) []byte {
 	return nonce
 }
 
-// 辅助函数：创建ChaCha20-Poly1305
-func newChaCha20Poly1305(key []byte) (cipher.AEAD, error) {
-	// 在实际项目中，我们会使用golang.org/x/crypto/chacha20poly1305
-	// 这里简化为假实现
-	return nil, errors.New("ChaCha20-Poly1305 not implemented in this example")
+// newAESGCM 创建AES-GCM（encryptAES同样只支持GCM模式）
+func newAESGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AES cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// randomNonce 生成指定长度的随机数
+func randomNonce(size int) ([]byte, error) {
+	nonce := make([]byte, size)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return nonce, nil
 }
 
 // encryptAES 使用AES加密数据
@@ -267,6 +293,58 @@ func (p *DefaultEncryptionProvider) decryptAES(ctx context.Context, algorithm st
 	return plaintext, nil
 }
 
+// encryptAEAD 使用算法注册的AEAD加密数据
+func (p *DefaultEncryptionProvider) encryptAEAD(ctx context.Context, algorithm string, key []byte, plaintext []byte, aad []byte) ([]byte, error) {
+	aead, err := p.blockAEAD(EncryptionAlgorithm(algorithm), key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomNonce(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	resultData, err := serializeEncryptedData(&encryptedData{
+		Algorithm:  algorithm,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, aad),
+		IV:         nonce,
+		AAD:        aad,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize encrypted data: %w", err)
+	}
+	return resultData, nil
+}
+
+// decryptAEAD 使用算法注册的AEAD解密数据
+func (p *DefaultEncryptionProvider) decryptAEAD(ctx context.Context, algorithm string, key []byte, ciphertext []byte, aad []byte) ([]byte, error) {
+	encData, err := deserializeEncryptedData(ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deserialize encrypted data: %w", err)
+	}
+	if encData.Algorithm != algorithm {
+		return nil, fmt.Errorf("algorithm mismatch: expected %s, got %s", algorithm, encData.Algorithm)
+	}
+	if aad != nil && !bytes.Equal(encData.AAD, aad) {
+		return nil, errors.New("authentication data (AAD) mismatch")
+	}
+
+	aead, err := p.blockAEAD(EncryptionAlgorithm(algorithm), key)
+	if err != nil {
+		return nil, err
+	}
+	if len(encData.IV) != aead.NonceSize() {
+		return nil, errors.New("invalid nonce size")
+	}
+
+	plaintext, err := aead.Open(nil, encData.IV, encData.Ciphertext, encData.AAD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+	}
+	return plaintext, nil
+}
+
 // encryptRSA 使用RSA加密数据
 func (p *DefaultEncryptionProvider) encryptRSA(ctx context.Context, algorithm string, key []byte, plaintext []byte, aad []byte) ([]byte, error) {
 	// 解析公钥
@@ -394,7 +472,7 @@ type encryptedData struct {
 // 序列化加密数据
 func serializeEncryptedData(data *encryptedData) ([]byte, error) {
 	if data == nil {
-		return nil, errors.New("encrypted data cannot be nil")
+		return nil, invalidArgument("encrypted data cannot be nil")
 	}
 
 	// 将字节数组转换为base64编码的字符串
@@ -433,7 +511,7 @@ func serializeEncryptedData(data *encryptedData) ([]byte, error) {
 // 反序列化加密数据
 func deserializeEncryptedData(data []byte) (*encryptedData, error) {
 	if len(data) == 0 {
-		return nil, errors.New("data cannot be empty")
+		return nil, invalidArgument("data cannot be empty")
 	}
 
 	// 反序列化JSON
@@ -0,0 +1,201 @@
+package security
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// 加密块信封格式（大端序）：
+//
+//	magic "FENV" | version(1) | 算法名长度(1) 算法名 | 密钥ID长度(2) 密钥ID | 随机数长度(1) 随机数 | 块ID(4) | 密文
+//
+// 块ID同时作为AEAD的关联数据，密文包含认证标签。信封记录了解密所需的全部参数，
+// 修改默认算法或默认密钥后旧块仍可解密，同一存储中可以混用多种算法。
+const (
+	// blockEnvelopeMagic 信封魔数
+	blockEnvelopeMagic = "FENV"
+
+	// BlockEnvelopeVersion 当前信封版本
+	BlockEnvelopeVersion = 1
+)
+
+// ErrInvalidEnvelope 加密块信封格式错误
+var ErrInvalidEnvelope = errors.New("invalid encrypted block envelope")
+
+// BlockEnvelope 加密块信封
+type BlockEnvelope struct {
+	// Version 信封版本
+	Version uint8
+
+	// Algorithm 加密算法
+	Algorithm EncryptionAlgorithm
+
+	// KeyID 加密使用的密钥ID
+	KeyID string
+
+	// Nonce 随机数
+	Nonce []byte
+
+	// BlockID 块ID，作为关联数据参与认证
+	BlockID uint32
+
+	// Ciphertext 密文（含认证标签）
+	Ciphertext []byte
+}
+
+// IsBlockEnvelope 判断数据是否以信封魔数开头，旧版本写入的加密块返回false
+func IsBlockEnvelope(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(blockEnvelopeMagic))
+}
+
+// Marshal 序列化信封
+func (e *BlockEnvelope) Marshal() ([]byte, error) {
+	if len(e.Algorithm) > 0xff || len(e.KeyID) > 0xffff || len(e.Nonce) > 0xff {
+		return nil, fmt.Errorf("%w: field too long", ErrInvalidEnvelope)
+	}
+
+	size := len(blockEnvelopeMagic) + 1 + 1 + len(e.Algorithm) + 2 + len(e.KeyID) + 1 + len(e.Nonce) + 4 + len(e.Ciphertext)
+	buf := make([]byte, 0, size)
+	buf = append(buf, blockEnvelopeMagic...)
+	buf = append(buf, e.Version)
+	buf = append(buf, byte(len(e.Algorithm)))
+	buf = append(buf, e.Algorithm...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(e.KeyID)))
+	buf = append(buf, e.KeyID...)
+	buf = append(buf, byte(len(e.Nonce)))
+	buf = append(buf, e.Nonce...)
+	buf = binary.BigEndian.AppendUint32(buf, e.BlockID)
+	buf = append(buf, e.Ciphertext...)
+	return buf, nil
+}
+
+// ParseBlockEnvelope 解析信封，返回的字段引用data
+func ParseBlockEnvelope(data []byte) (*BlockEnvelope, error) {
+	if !IsBlockEnvelope(data) {
+		return nil, fmt.Errorf("%w: bad magic", ErrInvalidEnvelope)
+	}
+	r := envelopeReader{data: data[len(blockEnvelopeMagic):]}
+
+	e := &BlockEnvelope{Version: r.byte()}
+	if r.err == nil && e.Version != BlockEnvelopeVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidEnvelope, e.Version)
+	}
+	e.Algorithm = EncryptionAlgorithm(r.bytes(int(r.byte())))
+	e.KeyID = string(r.bytes(int(r.uint16())))
+	e.Nonce = r.bytes(int(r.byte()))
+	e.BlockID = r.uint32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	e.Ciphertext = r.data
+	return e, nil
+}
+
+// AAD 返回认证使用的关联数据
+func (e *BlockEnvelope) AAD() []byte {
+	return blockAAD(e.BlockID)
+}
+
+// blockAAD 块ID的大端编码，作为块加密的关联数据
+func blockAAD(blockID uint32) []byte {
+	aad := make([]byte, 4)
+	binary.BigEndian.PutUint32(aad, blockID)
+	return aad
+}
+
+// envelopeReader 顺序读取信封字段，长度不足时记录错误
+type envelopeReader struct {
+	data []byte
+	err  error
+}
+
+func (r *envelopeReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < n {
+		r.err = fmt.Errorf("%w: truncated", ErrInvalidEnvelope)
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+func (r *envelopeReader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *envelopeReader) uint16() uint16 {
+	if b := r.bytes(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *envelopeReader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+// blockCipher 支持加密块信封的加密提供者
+type blockCipher interface {
+	sealBlock(algorithm EncryptionAlgorithm, keyID string, key []byte, blockID uint32, plaintext []byte) (*BlockEnvelope, error)
+	openBlock(e *BlockEnvelope, key []byte) ([]byte, error)
+}
+
+// sealBlock 用指定算法和密钥加密块数据并封装为信封
+func (p *DefaultEncryptionProvider) sealBlock(algorithm EncryptionAlgorithm, keyID string, key []byte, blockID uint32, plaintext []byte) (*BlockEnvelope, error) {
+	aead, err := p.blockAEAD(algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomNonce(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlockEnvelope{
+		Version:    BlockEnvelopeVersion,
+		Algorithm:  algorithm,
+		KeyID:      keyID,
+		Nonce:      nonce,
+		BlockID:    blockID,
+		Ciphertext: aead.Seal(nil, nonce, plaintext, blockAAD(blockID)),
+	}, nil
+}
+
+// openBlock 解密信封中的块数据
+func (p *DefaultEncryptionProvider) openBlock(e *BlockEnvelope, key []byte) ([]byte, error) {
+	aead, err := p.blockAEAD(e.Algorithm, key)
+	if err != nil {
+		return nil, err
+	}
+	if len(e.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("%w: invalid nonce size", ErrInvalidEnvelope)
+	}
+
+	plaintext, err := aead.Open(nil, e.Nonce, e.Ciphertext, e.AAD())
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt block %d: %w", e.BlockID, err)
+	}
+	return plaintext, nil
+}
+
+// blockAEAD 返回对称算法的AEAD实现
+func (p *DefaultEncryptionProvider) blockAEAD(algorithm EncryptionAlgorithm, key []byte) (cipher.AEAD, error) {
+	info, exists := p.algorithms[string(algorithm)]
+	if !exists || info.NewAEAD == nil {
+		return nil, fmt.Errorf("unsupported block encryption algorithm: %s", algorithm)
+	}
+	return info.NewAEAD(key)
+}
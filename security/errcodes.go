@@ -0,0 +1,29 @@
+package security
+
+import "github.com/bpfs/fragmenta/errcode"
+
+// init 登记安全模块错误的错误码
+func init() {
+	errcode.Register(ErrKeyNotFound, "security.key_not_found", "密钥不存在", "key not found")
+	errcode.Register(ErrKeyExpired, "security.key_expired", "密钥已过期", "key has expired")
+	errcode.Register(ErrInvalidArgument, "security.invalid_argument", "参数为空或不合法", "invalid argument")
+	errcode.Register(ErrPermissionDenied, "security.permission_denied", "权限不足", "permission denied")
+	errcode.Register(ErrInvalidSubject, "security.invalid_subject", "无效的主体", "invalid subject")
+	errcode.Register(ErrInvalidResource, "security.invalid_resource", "无效的资源", "invalid resource")
+	errcode.Register(ErrInvalidOperation, "security.invalid_operation", "无效的操作", "invalid operation")
+	errcode.Register(ErrInvalidPolicy, "security.invalid_policy", "无效的策略", "invalid policy")
+	errcode.Register(ErrEntryNotFound, "security.entry_not_found", "条目不存在", "entry not found")
+	errcode.Register(ErrDuplicateEntry, "security.duplicate_entry", "条目已存在", "duplicate entry")
+	errcode.Register(ErrCertificateNotFound, "security.certificate_not_found", "证书不存在", "certificate not found")
+	errcode.Register(ErrCertificateKeyMismatch, "security.certificate_key_mismatch", "证书公钥与密钥对不匹配", "certificate public key does not match key pair")
+	errcode.Register(ErrUntrustedCertificate, "security.untrusted_certificate", "证书不受信任", "certificate is not trusted")
+	errcode.Register(ErrKeyNotExportable, "security.key_not_exportable", "私钥保存在硬件令牌中，不能导出", "private key is held by a hardware token and cannot be exported")
+	errcode.Register(ErrNoHardwareToken, "security.no_hardware_token", "未配置硬件令牌", "no hardware token configured")
+	errcode.Register(ErrPKCS11Unavailable, "security.pkcs11_unavailable", "未启用PKCS#11支持", "pkcs11 support is not compiled in")
+	errcode.Register(ErrKeyStoreLocked, "security.key_store_locked", "密钥库已锁定", "key store is locked")
+	errcode.Register(ErrInvalidPassphrase, "security.invalid_passphrase", "口令错误", "invalid passphrase")
+	errcode.Register(ErrUnwrappedRecord, "security.unwrapped_record", "安全存储记录未经密钥提供者包装", "secure storage record is not wrapped by key provider")
+	errcode.Register(ErrAuditTampered, "security.audit_tampered", "审计日志已被篡改", "audit log has been tampered with")
+	errcode.Register(ErrAuditTruncated, "security.audit_truncated", "审计日志已被截断", "audit log has been truncated")
+	errcode.Register(ErrInvalidEnvelope, "security.invalid_envelope", "无效的加密块信封", "invalid encrypted block envelope")
+}
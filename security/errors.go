@@ -0,0 +1,57 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 密钥和参数相关的错误定义，权限、证书、审计等错误见各自的文件
+var (
+	// ErrKeyNotFound 表示密钥不存在
+	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrKeyExpired 表示密钥已过期
+	ErrKeyExpired = errors.New("key has expired")
+
+	// ErrInvalidArgument 表示参数为空或不合法
+	ErrInvalidArgument = errors.New("invalid argument")
+)
+
+// KeyError 密钥操作失败，记录出错的密钥ID。
+// errors.Is可以匹配Err包装的错误，例如 ErrKeyNotFound、ErrKeyExpired
+type KeyError struct {
+	KeyID string
+	Err   error
+}
+
+// Error 实现error接口
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("key %s: %v", e.KeyID, e.Err)
+}
+
+// Unwrap 返回底层错误
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// PermissionError 主体对资源的操作被拒绝，errors.Is可以匹配 ErrPermissionDenied
+type PermissionError struct {
+	Subject   string
+	Operation Operation
+	Resource  Resource
+}
+
+// Error 实现error接口
+func (e *PermissionError) Error() string {
+	return fmt.Sprintf("%v: %s cannot %s %s %s", ErrPermissionDenied, e.Subject, e.Operation, e.Resource.Type, e.Resource.ID)
+}
+
+// Unwrap 返回 ErrPermissionDenied
+func (e *PermissionError) Unwrap() error {
+	return ErrPermissionDenied
+}
+
+// invalidArgument 返回包装了 ErrInvalidArgument 的错误
+func invalidArgument(message string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidArgument, message)
+}
@@ -0,0 +1,125 @@
+package security
+
+import (
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 只通过事件回调发出、不写入审计日志的事件。这些事件可能非常频繁（每次读取加密块都会访问密钥），
+// 写入哈希链审计日志的代价太高，需要的话由回调自行采样或聚合
+const (
+	// EventKeyAccess 读取密钥
+	EventKeyAccess = "key.access"
+
+	// EventDecryptFailure 解密失败（密钥错误、数据被篡改、信封格式错误等）
+	EventDecryptFailure = "decrypt.failure"
+
+	// EventSignatureInvalid 签名验证失败
+	EventSignatureInvalid = "signature.invalid"
+)
+
+// SecurityEvent 安全事件。审计日志记录的操作（见 Audit* 常量）同样以事件发出，Type 与审计操作名称相同
+type SecurityEvent struct {
+	// Type 事件类型
+	Type string `json:"type"`
+
+	// Time 事件时间
+	Time time.Time `json:"time"`
+
+	// Subject 事件对象（密钥ID、密钥库路径等）
+	Subject string `json:"subject,omitempty"`
+
+	// Details 事件详情
+	Details map[string]string `json:"details,omitempty"`
+
+	// Error 失败事件的错误信息
+	Error string `json:"error,omitempty"`
+}
+
+// SecurityEventHook 安全事件回调。回调在触发事件的操作中同步调用，
+// 应尽快返回，耗时的处理（如发送到SIEM）需要自行异步进行
+type SecurityEventHook func(event SecurityEvent)
+
+// hookSet 已注册的回调，注册时返回注销函数
+type hookSet[T any] struct {
+	mu    sync.RWMutex
+	hooks map[uint64]T
+	next  uint64
+}
+
+// add 注册回调，返回注销函数
+func (h *hookSet[T]) add(hook T) func() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.hooks == nil {
+		h.hooks = make(map[uint64]T)
+	}
+	id := h.next
+	h.next++
+	h.hooks[id] = hook
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.hooks, id)
+	}
+}
+
+// snapshot 返回当前注册的回调，按注册顺序排列
+func (h *hookSet[T]) snapshot() []T {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	ids := make([]uint64, 0, len(h.hooks))
+	for id := range h.hooks {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	hooks := make([]T, len(ids))
+	for i, id := range ids {
+		hooks[i] = h.hooks[id]
+	}
+	return hooks
+}
+
+// eventHooks 已注册的事件回调，安全管理器和密钥管理器共享同一组回调
+type eventHooks struct {
+	hookSet[SecurityEventHook]
+}
+
+func newEventHooks() *eventHooks {
+	return &eventHooks{}
+}
+
+// emit 把事件发给所有回调，h为nil时不做任何事
+func (h *eventHooks) emit(eventType, subject string, details map[string]string, err error) {
+	if h == nil {
+		return
+	}
+
+	hooks := h.snapshot()
+	if len(hooks) == 0 {
+		return
+	}
+
+	event := SecurityEvent{Type: eventType, Time: time.Now().UTC(), Subject: subject, Details: details}
+	if err != nil {
+		event.Error = err.Error()
+	}
+	for _, hook := range hooks {
+		hook(event)
+	}
+}
+
+// AddEventHook 注册安全事件回调，返回注销函数。密钥管理器的事件（密钥生成、读取、删除等）
+// 也会发给回调
+func (sm *DefaultSecurityManager) AddEventHook(hook SecurityEventHook) (remove func()) {
+	return sm.events.add(hook)
+}
+
+// emitBlockFailure 发出与数据块相关的失败事件
+func (sm *DefaultSecurityManager) emitBlockFailure(eventType, keyID string, blockID uint32, err error) {
+	sm.events.emit(eventType, keyID, map[string]string{"block_id": strconv.FormatUint(uint64(blockID), 10)}, err)
+}
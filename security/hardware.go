@@ -0,0 +1,222 @@
+package security
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// HardwareToken 硬件密钥设备（HSM、智能卡、TPM等）。私钥在设备内生成且不能导出，
+// 签名和解密通过设备返回的 crypto.Signer（RSA密钥通常同时实现 crypto.Decrypter）完成。
+// PKCS#11设备由 NewPKCS11Token 提供，TPM可以用 go-tpm 的密钥句柄适配为该接口
+type HardwareToken interface {
+	// Name 设备名称，记录在密钥元数据中
+	Name() string
+
+	// GenerateKey 在设备内生成密钥对，label为设备内的密钥标签
+	GenerateKey(ctx context.Context, label string, keyType KeyType, size int) (crypto.Signer, error)
+
+	// FindKey 按标签查找设备内的密钥
+	FindKey(ctx context.Context, label string) (crypto.Signer, error)
+
+	// DeleteKey 删除设备内的密钥
+	DeleteKey(ctx context.Context, label string) error
+}
+
+// 硬件密钥的元数据键
+const (
+	// hardwareTokenMetadata 私钥所在设备的名称
+	hardwareTokenMetadata = "hardware_token"
+
+	// hardwareLabelMetadata 私钥在设备内的标签
+	hardwareLabelMetadata = "hardware_label"
+)
+
+var (
+	// ErrKeyNotExportable 私钥保存在硬件设备中，不能读取或导出
+	ErrKeyNotExportable = errors.New("private key is held by a hardware token and cannot be exported")
+
+	// ErrNoHardwareToken 没有设置硬件密钥设备
+	ErrNoHardwareToken = errors.New("no hardware token configured")
+)
+
+// SetHardwareToken 设置硬件密钥设备
+func (km *DefaultKeyManager) SetHardwareToken(token HardwareToken) {
+	km.tokenMutex.Lock()
+	km.token = token
+	km.tokenMutex.Unlock()
+}
+
+// hardwareToken 返回当前的硬件密钥设备，一次操作只读取一次，中途替换设备不影响进行中的操作
+func (km *DefaultKeyManager) hardwareToken() HardwareToken {
+	km.tokenMutex.RLock()
+	defer km.tokenMutex.RUnlock()
+	return km.token
+}
+
+// GenerateHardwareKeyPair 在硬件设备内生成密钥对。密钥库只保存公钥和指向设备内私钥的记录，
+// 私钥ID可以像普通密钥对一样用于签名、生成CSR和导入证书，但 GetKey/ExportKey 返回 ErrKeyNotExportable
+func (km *DefaultKeyManager) GenerateHardwareKeyPair(ctx context.Context, keyType KeyType, options *KeyOptions) (*AsymmetricKeyPair, error) {
+	token := km.hardwareToken()
+	if token == nil {
+		return nil, ErrNoHardwareToken
+	}
+	if options == nil {
+		options = &KeyOptions{Type: keyType}
+	}
+	if options.Size == 0 {
+		switch keyType {
+		case RSAPrivateKey:
+			options.Size = 2048
+		case ECPrivateKey, ED25519PrivateKey:
+			options.Size = 256
+		}
+	}
+
+	timestamp := km.now().UnixNano()
+	randomStr := generateRandomString(8)
+	publicKeyType := publicKeyTypeOf(keyType)
+	privateKeyID := fmt.Sprintf("%s-%d-%s", keyType, timestamp, randomStr)
+	publicKeyID := fmt.Sprintf("%s-%d-%s", publicKeyType, timestamp, randomStr)
+
+	signer, err := token.GenerateKey(ctx, privateKeyID, keyType, options.Size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key pair on %s: %w", token.Name(), err)
+	}
+	publicKeyBytes, err := marshalSignaturePublicKey(signer.Public())
+	if err != nil {
+		token.DeleteKey(ctx, privateKeyID)
+		return nil, err
+	}
+
+	metadata := func(keyType KeyType) map[string]string {
+		m := map[string]string{
+			"type":      string(keyType),
+			"size":      fmt.Sprintf("%d", options.Size),
+			"timestamp": fmt.Sprintf("%d", timestamp),
+			"has_pair":  "true",
+		}
+		for k, v := range options.Metadata {
+			m[k] = v
+		}
+		setKeyUsage(m, options.Usage)
+		return m
+	}
+	privateEntry := &KeyEntry{Metadata: metadata(keyType), CreatedAt: km.now()}
+	privateEntry.Metadata["public_key_id"] = publicKeyID
+	privateEntry.Metadata[hardwareTokenMetadata] = token.Name()
+	privateEntry.Metadata[hardwareLabelMetadata] = privateKeyID
+	publicEntry := &KeyEntry{Key: publicKeyBytes, Metadata: metadata(publicKeyType), CreatedAt: privateEntry.CreatedAt}
+	publicEntry.Metadata["private_key_id"] = privateKeyID
+
+	for id, entry := range map[string]*KeyEntry{privateKeyID: privateEntry, publicKeyID: publicEntry} {
+		serialized, err := serializeKeyEntry(entry)
+		if err == nil {
+			err = km.storage.Store(ctx, id, serialized)
+		}
+		if err != nil {
+			km.storage.Delete(ctx, privateKeyID)
+			km.storage.Delete(ctx, publicKeyID)
+			token.DeleteKey(ctx, privateKeyID)
+			return nil, fmt.Errorf("failed to store key entry: %w", err)
+		}
+	}
+
+	km.record(AuditKeyGenerate, privateKeyID, map[string]string{
+		"type":       string(keyType),
+		"public_key": publicKeyID,
+		"token":      token.Name(),
+	})
+	return &AsymmetricKeyPair{PrivateKeyID: privateKeyID, PublicKeyID: publicKeyID}, nil
+}
+
+// IsHardwareKey 判断密钥条目是否指向硬件设备中的私钥
+func IsHardwareKey(entry *KeyEntry) bool {
+	return entry != nil && entry.Metadata[hardwareTokenMetadata] != ""
+}
+
+// hardwareSigner 从硬件设备中查找密钥条目对应的私钥
+func (km *DefaultKeyManager) hardwareSigner(ctx context.Context, entry *KeyEntry) (crypto.Signer, error) {
+	token := km.hardwareToken()
+	if token == nil {
+		return nil, ErrNoHardwareToken
+	}
+	if name := entry.Metadata[hardwareTokenMetadata]; name != token.Name() {
+		return nil, fmt.Errorf("key is held by hardware token %s, configured token is %s", name, token.Name())
+	}
+	return token.FindKey(ctx, entry.Metadata[hardwareLabelMetadata])
+}
+
+// HardwareKeyProvider 用硬件设备中的RSA密钥包装数据密钥（RSA-OAEP-SHA256）。
+// 作为 SecurityConfig.KeyProvider 使用时，密钥库中的对称加密密钥只能在连接设备时解开
+type HardwareKeyProvider struct {
+	token     HardwareToken
+	label     string
+	publicKey *rsa.PublicKey
+	decrypter crypto.Decrypter
+}
+
+// NewHardwareKeyProvider 用设备中标签为label的RSA密钥创建密钥提供者，该密钥必须支持解密
+func NewHardwareKeyProvider(ctx context.Context, token HardwareToken, label string) (*HardwareKeyProvider, error) {
+	if token == nil {
+		return nil, ErrNoHardwareToken
+	}
+	signer, err := token.FindKey(ctx, label)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find hardware key %s: %w", label, err)
+	}
+	publicKey, ok := signer.Public().(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("hardware key provider requires an RSA key")
+	}
+	decrypter, ok := signer.(crypto.Decrypter)
+	if !ok {
+		return nil, errors.New("hardware key does not support decryption")
+	}
+
+	return &HardwareKeyProvider{
+		token:     token,
+		label:     label,
+		publicKey: publicKey,
+		decrypter: decrypter,
+	}, nil
+}
+
+// Name 提供者名称
+func (p *HardwareKeyProvider) Name() string {
+	return "hardware:" + p.token.Name()
+}
+
+// WrapKey 用设备密钥的公钥包装数据密钥，不需要访问设备
+func (p *HardwareKeyProvider) WrapKey(ctx context.Context, plaintext []byte) ([]byte, error) {
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, p.publicKey, plaintext, []byte(p.label))
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap key: %w", err)
+	}
+	return wrapped, nil
+}
+
+// UnwrapKey 由设备解包数据密钥
+func (p *HardwareKeyProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	plaintext, err := p.decrypter.Decrypt(rand.Reader, wrapped, &rsa.OAEPOptions{Hash: crypto.SHA256, Label: []byte(p.label)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap key on %s: %w", p.token.Name(), err)
+	}
+	return plaintext, nil
+}
+
+// keySignatureProvider 用 crypto.Signer 签名的签名提供者，Sign 忽略传入的私钥。
+// 供私钥不能导出的硬件密钥对审计日志检查点签名
+type keySignatureProvider struct {
+	*DefaultSignatureProvider
+	signer crypto.Signer
+}
+
+// Sign 用硬件密钥签名
+func (p *keySignatureProvider) Sign(ctx context.Context, algorithm string, _ []byte, data []byte) ([]byte, error) {
+	return p.SignWithSigner(ctx, algorithm, p.signer, data)
+}
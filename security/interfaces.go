@@ -33,6 +33,9 @@ type KeyManager interface {
 	// GetKey 获取密钥（可能从安全存储中获取）
 	GetKey(ctx context.Context, keyID string) ([]byte, error)
 
+	// GetKeySecret 获取密钥，返回的缓冲区 Close 时清零密钥
+	GetKeySecret(ctx context.Context, keyID string) (*SecretBuffer, error)
+
 	// DeleteKey 删除密钥
 	DeleteKey(ctx context.Context, keyID string) error
 
@@ -42,6 +45,9 @@ type KeyManager interface {
 	// ListKeys 列出所有密钥ID
 	ListKeys(ctx context.Context) ([]string, error)
 
+	// ListKeyEntries 按类型、用途和过期时间列出密钥及其元数据，支持分页
+	ListKeyEntries(ctx context.Context, filter *KeyFilter) (*KeyList, error)
+
 	// ImportKey 导入现有密钥
 	ImportKey(ctx context.Context, keyData []byte, options *KeyOptions) (string, error)
 
@@ -0,0 +1,195 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// usageMetadata 密钥用途的元数据键，多个用途以逗号分隔
+const usageMetadata = "usage"
+
+// KeyInfo 密钥清单中的一项，不含密钥材料
+type KeyInfo struct {
+	// ID 密钥ID
+	ID string
+
+	// Type 密钥类型
+	Type KeyType
+
+	// Size 密钥大小（比特）
+	Size int
+
+	// Usage 密钥用途，生成时未指定的按类型推断（见 KeyUsages）
+	Usage []KeyUsage
+
+	// Metadata 密钥元数据
+	Metadata map[string]string
+
+	// CreatedAt 创建时间
+	CreatedAt time.Time
+
+	// ExpiresAt 过期时间，零值表示不过期
+	ExpiresAt time.Time
+
+	// Hardware 私钥是否保存在硬件设备中
+	Hardware bool
+}
+
+// Expired 判断密钥在t时是否已过期
+func (k *KeyInfo) Expired(t time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !t.Before(k.ExpiresAt)
+}
+
+// KeyFilter 列出密钥的过滤条件，零值的条件不生效
+type KeyFilter struct {
+	// Types 只列出这些类型的密钥
+	Types []KeyType
+
+	// Usage 只列出具有该用途的密钥
+	Usage KeyUsage
+
+	// ExpiresAfter 只列出在该时间之后过期的密钥（包括不过期的密钥），
+	// 设为当前时间即排除已过期的密钥
+	ExpiresAfter time.Time
+
+	// ExpiresBefore 只列出在该时间之前过期的密钥（包括已过期的），不过期的密钥不列出。
+	// 设为当前时间加上提前量即可找出需要轮换的密钥
+	ExpiresBefore time.Time
+
+	// PageToken 上一页返回的 NextPageToken，为空时从头开始
+	PageToken string
+
+	// Limit 每页最多返回的条数，0表示不分页
+	Limit int
+}
+
+// KeyList 一页密钥清单
+type KeyList struct {
+	// Keys 按ID排序的密钥
+	Keys []KeyInfo
+
+	// NextPageToken 下一页的起点，为空表示没有更多密钥
+	NextPageToken string
+}
+
+// ListKeyEntries 按过滤条件列出密钥及其元数据，结果按ID排序。
+// 读取时密钥材料随即清零，返回的清单可以放心交给运维工具
+func (km *DefaultKeyManager) ListKeyEntries(ctx context.Context, filter *KeyFilter) (*KeyList, error) {
+	if filter == nil {
+		filter = &KeyFilter{}
+	}
+
+	ids, err := km.storage.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list keys: %w", err)
+	}
+	sort.Strings(ids)
+
+	list := &KeyList{}
+	for _, id := range ids {
+		if filter.PageToken != "" && id <= filter.PageToken {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		info, err := km.keyInfo(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key %s: %w", id, err)
+		}
+		if !filter.match(info) {
+			continue
+		}
+
+		// 已经取满一页且还有符合条件的密钥
+		if filter.Limit > 0 && len(list.Keys) == filter.Limit {
+			list.NextPageToken = list.Keys[len(list.Keys)-1].ID
+			break
+		}
+		list.Keys = append(list.Keys, *info)
+	}
+	return list, nil
+}
+
+// keyInfo 读取密钥条目的元数据，丢弃密钥材料
+func (km *DefaultKeyManager) keyInfo(ctx context.Context, keyID string) (*KeyInfo, error) {
+	data, err := km.storage.Retrieve(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(data)
+
+	entry, err := deserializeKeyEntry(data)
+	if err != nil {
+		return nil, err
+	}
+	wipe(entry.Key)
+
+	size, _ := strconv.Atoi(entry.Metadata["size"])
+	return &KeyInfo{
+		ID:        keyID,
+		Type:      KeyType(entry.Metadata["type"]),
+		Size:      size,
+		Usage:     KeyUsages(entry),
+		Metadata:  entry.Metadata,
+		CreatedAt: entry.CreatedAt,
+		ExpiresAt: entry.ExpiresAt,
+		Hardware:  IsHardwareKey(entry),
+	}, nil
+}
+
+// match 判断密钥是否符合过滤条件
+func (f *KeyFilter) match(info *KeyInfo) bool {
+	if len(f.Types) > 0 && !slices.Contains(f.Types, info.Type) {
+		return false
+	}
+	if f.Usage != "" && !slices.Contains(info.Usage, f.Usage) {
+		return false
+	}
+	if !f.ExpiresAfter.IsZero() && !info.ExpiresAt.IsZero() && !info.ExpiresAt.After(f.ExpiresAfter) {
+		return false
+	}
+	if !f.ExpiresBefore.IsZero() && (info.ExpiresAt.IsZero() || !info.ExpiresAt.Before(f.ExpiresBefore)) {
+		return false
+	}
+	return true
+}
+
+// KeyUsages 返回密钥条目的用途。生成或导入时通过 KeyOptions.Usage 指定的以指定为准，
+// 否则按类型推断：对称密钥用于加密，非对称密钥用于签名，证书没有用途
+func KeyUsages(entry *KeyEntry) []KeyUsage {
+	if usage := entry.Metadata[usageMetadata]; usage != "" {
+		var usages []KeyUsage
+		for _, u := range strings.Split(usage, ",") {
+			usages = append(usages, KeyUsage(u))
+		}
+		return usages
+	}
+
+	switch KeyType(entry.Metadata["type"]) {
+	case SymmetricKey, MasterKey, DerivedKey:
+		return []KeyUsage{EncryptionUsage}
+	case RSAPrivateKey, RSAPublicKey, ECPrivateKey, ECPublicKey, ED25519PrivateKey, ED25519PublicKey, AsymmetricKey:
+		return []KeyUsage{SigningUsage}
+	default:
+		return nil
+	}
+}
+
+// setKeyUsage 在元数据中记录密钥用途
+func setKeyUsage(metadata map[string]string, usages []KeyUsage) {
+	if len(usages) == 0 {
+		return
+	}
+	names := make([]string, len(usages))
+	for i, u := range usages {
+		names[i] = string(u)
+	}
+	metadata[usageMetadata] = strings.Join(names, ",")
+}
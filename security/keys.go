@@ -1,20 +1,42 @@
 package security
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"sort"
+	"sync"
 	"time"
+
+	"github.com/bpfs/fragmenta/clock"
 )
 
 // DefaultKeyManager 默认密钥管理器实现
 type DefaultKeyManager struct {
 	storage SecureStorage
+
+	// 审计记录器，为nil时不记录
+	audit AuditRecorder
+
+	// 硬件密钥设备，为nil时不支持硬件密钥。可以在使用中替换，读写都持有tokenMutex
+	token      HardwareToken
+	tokenMutex sync.RWMutex
+
+	// 事件回调，由安全管理器设置，为nil时不发出事件
+	events *eventHooks
+
+	// 时钟，用于密钥的创建时间和过期判断，为nil时使用系统时钟
+	clock clock.Clock
 }
 
 // NewDefaultKeyManager 创建默认密钥管理器
@@ -24,6 +46,29 @@ func NewDefaultKeyManager(storage SecureStorage) *DefaultKeyManager {
 	}
 }
 
+// SetAuditRecorder 设置审计记录器，密钥的生成、导入、删除和轮换都会被记录
+func (km *DefaultKeyManager) SetAuditRecorder(recorder AuditRecorder) {
+	km.audit = recorder
+}
+
+// SetClock 设置时钟，测试中可以用clock.Fake推进时间检查密钥过期
+func (km *DefaultKeyManager) SetClock(c clock.Clock) {
+	km.clock = c
+}
+
+// now 返回时钟的当前时间
+func (km *DefaultKeyManager) now() time.Time {
+	return clock.OrSystem(km.clock).Now()
+}
+
+// record 记录审计事件并发给事件回调。操作已经完成，审计写入失败不影响操作结果
+func (km *DefaultKeyManager) record(action, subject string, details map[string]string) {
+	if km.audit != nil {
+		km.audit.Append(action, subject, details)
+	}
+	km.events.emit(action, subject, details, nil)
+}
+
 // GenerateKey 生成新密钥
 func (km *DefaultKeyManager) GenerateKey(ctx context.Context, keyType KeyType, options *KeyOptions) (string, error) {
 	if options == nil {
@@ -36,7 +81,7 @@ func (km *DefaultKeyManager) GenerateKey(ctx context.Context, keyType KeyType, o
 	// 确定密钥大小
 	keySize := options.Size / 8 // 转换为字节
 	if keySize <= 0 {
-		return "", errors.New("invalid key size")
+		return "", invalidArgument("invalid key size")
 	}
 
 	// 生成随机密钥
@@ -47,7 +92,7 @@ func (km *DefaultKeyManager) GenerateKey(ctx context.Context, keyType KeyType, o
 	}
 
 	// 生成密钥ID
-	timestamp := time.Now().UnixNano()
+	timestamp := km.now().UnixNano()
 	keyID := fmt.Sprintf("%s-%d-%s", keyType, timestamp, generateRandomString(8))
 
 	// 准备密钥元数据
@@ -63,12 +108,14 @@ func (km *DefaultKeyManager) GenerateKey(ctx context.Context, keyType KeyType, o
 			metadata[k] = v
 		}
 	}
+	setKeyUsage(metadata, options.Usage)
+	setRotationPolicy(metadata, options.RotationPolicy)
 
 	// 创建密钥条目
 	keyEntry := &KeyEntry{
 		Key:       key,
 		Metadata:  metadata,
-		CreatedAt: time.Now(),
+		CreatedAt: km.now(),
 	}
 
 	// 如果有设置轮换策略，添加过期时间
@@ -76,11 +123,14 @@ func (km *DefaultKeyManager) GenerateKey(ctx context.Context, keyType KeyType, o
 		keyEntry.ExpiresAt = keyEntry.CreatedAt.Add(time.Duration(options.RotationPolicy.IntervalSeconds) * time.Second)
 	}
 
+	defer wipe(key)
+
 	// 序列化密钥条目
 	keyData, err := serializeKeyEntry(keyEntry)
 	if err != nil {
 		return "", err
 	}
+	defer wipe(keyData)
 
 	// 存储密钥
 	err = km.storage.Store(ctx, keyID, keyData)
@@ -88,13 +138,28 @@ func (km *DefaultKeyManager) GenerateKey(ctx context.Context, keyType KeyType, o
 		return "", err
 	}
 
+	km.record(AuditKeyGenerate, keyID, map[string]string{"type": string(keyType), "size": metadata["size"]})
 	return keyID, nil
 }
 
-// GetKey 获取密钥
+// GetKey 获取密钥。返回的切片归调用方所有，用完后应清零；只在内部使用密钥时优先用 GetKeySecret
 func (km *DefaultKeyManager) GetKey(ctx context.Context, keyID string) ([]byte, error) {
+	return km.loadKey(ctx, keyID)
+}
+
+// GetKeySecret 获取密钥，返回的缓冲区 Close 时清零密钥
+func (km *DefaultKeyManager) GetKeySecret(ctx context.Context, keyID string) (*SecretBuffer, error) {
+	key, err := km.loadKey(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	return NewSecretBuffer(key), nil
+}
+
+// loadKey 读取未过期的密钥，存储中读出的序列化数据随即清零
+func (km *DefaultKeyManager) loadKey(ctx context.Context, keyID string) ([]byte, error) {
 	if keyID == "" {
-		return nil, errors.New("keyID cannot be empty")
+		return nil, invalidArgument("keyID cannot be empty")
 	}
 
 	// 从存储中检索密钥数据
@@ -102,6 +167,7 @@ func (km *DefaultKeyManager) GetKey(ctx context.Context, keyID string) ([]byte,
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve key: %w", err)
 	}
+	defer wipe(keyData)
 
 	// 反序列化密钥条目
 	keyEntry, err := deserializeKeyEntry(keyData)
@@ -110,26 +176,47 @@ func (km *DefaultKeyManager) GetKey(ctx context.Context, keyID string) ([]byte,
 	}
 
 	// 检查密钥是否过期
-	if !keyEntry.ExpiresAt.IsZero() && time.Now().After(keyEntry.ExpiresAt) {
-		return nil, errors.New("key has expired")
+	if !keyEntry.ExpiresAt.IsZero() && km.now().After(keyEntry.ExpiresAt) {
+		return nil, &KeyError{KeyID: keyID, Err: ErrKeyExpired}
+	}
+	if IsHardwareKey(keyEntry) {
+		wipe(keyEntry.Key)
+		return nil, ErrKeyNotExportable
 	}
 
+	km.events.emit(EventKeyAccess, keyID, map[string]string{"type": keyEntry.Metadata["type"]}, nil)
 	return keyEntry.Key, nil
 }
 
 // DeleteKey 删除密钥
 func (km *DefaultKeyManager) DeleteKey(ctx context.Context, keyID string) error {
 	if keyID == "" {
-		return errors.New("keyID cannot be empty")
+		return invalidArgument("keyID cannot be empty")
 	}
 
-	return km.storage.Delete(ctx, keyID)
+	// 硬件密钥同时删除设备中的私钥
+	if entry, err := km.RetrieveKeyEntry(ctx, keyID); err == nil && IsHardwareKey(entry) {
+		token := km.hardwareToken()
+		if token == nil || token.Name() != entry.Metadata[hardwareTokenMetadata] {
+			return ErrNoHardwareToken
+		}
+		if err := token.DeleteKey(ctx, entry.Metadata[hardwareLabelMetadata]); err != nil {
+			return fmt.Errorf("failed to delete hardware key: %w", err)
+		}
+	}
+
+	if err := km.storage.Delete(ctx, keyID); err != nil {
+		return err
+	}
+
+	km.record(AuditKeyDelete, keyID, nil)
+	return nil
 }
 
 // RotateKey 轮换密钥
 func (km *DefaultKeyManager) RotateKey(ctx context.Context, oldKeyID string, options *KeyOptions) (string, error) {
 	if oldKeyID == "" {
-		return "", errors.New("oldKeyID cannot be empty")
+		return "", invalidArgument("oldKeyID cannot be empty")
 	}
 
 	// 获取旧密钥数据
@@ -137,14 +224,16 @@ func (km *DefaultKeyManager) RotateKey(ctx context.Context, oldKeyID string, opt
 	if err != nil {
 		return "", fmt.Errorf("failed to retrieve old key: %w", err)
 	}
+	defer wipe(oldKeyData)
 
 	// 反序列化旧密钥条目
 	oldKeyEntry, err := deserializeKeyEntry(oldKeyData)
 	if err != nil {
 		return "", fmt.Errorf("failed to deserialize old key entry: %w", err)
 	}
+	wipe(oldKeyEntry.Key)
 
-	// 如果没有提供选项，使用旧密钥的元数据
+	// 如果没有提供选项，使用旧密钥的元数据和轮换策略
 	if options == nil {
 		keyType := KeyType(oldKeyEntry.Metadata["type"])
 		size := 256 // 默认值
@@ -152,10 +241,16 @@ func (km *DefaultKeyManager) RotateKey(ctx context.Context, oldKeyID string, opt
 			fmt.Sscanf(sizeStr, "%d", &size)
 		}
 
+		metadata := make(map[string]string, len(oldKeyEntry.Metadata))
+		for k, v := range oldKeyEntry.Metadata {
+			metadata[k] = v
+		}
+		delete(metadata, rotatedToMetadata)
 		options = &KeyOptions{
-			Type:     keyType,
-			Size:     size,
-			Metadata: oldKeyEntry.Metadata,
+			Type:           keyType,
+			Size:           size,
+			Metadata:       metadata,
+			RotationPolicy: keyRotationPolicy(oldKeyEntry),
 		}
 	}
 
@@ -165,6 +260,14 @@ func (km *DefaultKeyManager) RotateKey(ctx context.Context, oldKeyID string, opt
 		return "", fmt.Errorf("failed to generate new key: %w", err)
 	}
 
+	// 在旧密钥上记录继任者，自动轮换不会再次轮换它
+	if err := km.updateEntry(ctx, oldKeyID, func(entry *KeyEntry) {
+		entry.Metadata[rotatedToMetadata] = newKeyID
+	}); err != nil {
+		return "", fmt.Errorf("failed to mark old key as rotated: %w", err)
+	}
+
+	km.record(AuditKeyRotate, oldKeyID, map[string]string{"new_key": newKeyID})
 	return newKeyID, nil
 }
 
@@ -176,15 +279,15 @@ func (km *DefaultKeyManager) ListKeys(ctx context.Context) ([]string, error) {
 // ImportKey 导入现有密钥
 func (km *DefaultKeyManager) ImportKey(ctx context.Context, keyData []byte, options *KeyOptions) (string, error) {
 	if len(keyData) == 0 {
-		return "", errors.New("keyData cannot be empty")
+		return "", invalidArgument("keyData cannot be empty")
 	}
 
 	if options == nil {
-		return "", errors.New("options cannot be nil for importing keys")
+		return "", invalidArgument("options cannot be nil for importing keys")
 	}
 
 	// 生成密钥ID
-	timestamp := time.Now().UnixNano()
+	timestamp := km.now().UnixNano()
 	keyID := fmt.Sprintf("%s-%d-%s", options.Type, timestamp, generateRandomString(8))
 
 	// 准备密钥元数据
@@ -201,12 +304,14 @@ func (km *DefaultKeyManager) ImportKey(ctx context.Context, keyData []byte, opti
 			metadata[k] = v
 		}
 	}
+	setKeyUsage(metadata, options.Usage)
+	setRotationPolicy(metadata, options.RotationPolicy)
 
 	// 创建密钥条目
 	keyEntry := &KeyEntry{
 		Key:       keyData,
 		Metadata:  metadata,
-		CreatedAt: time.Now(),
+		CreatedAt: km.now(),
 	}
 
 	// 如果有设置轮换策略，添加过期时间
@@ -219,6 +324,7 @@ func (km *DefaultKeyManager) ImportKey(ctx context.Context, keyData []byte, opti
 	if err != nil {
 		return "", err
 	}
+	defer wipe(serializedKeyEntry)
 
 	// 存储密钥
 	err = km.storage.Store(ctx, keyID, serializedKeyEntry)
@@ -226,13 +332,14 @@ func (km *DefaultKeyManager) ImportKey(ctx context.Context, keyData []byte, opti
 		return "", err
 	}
 
+	km.record(AuditKeyImport, keyID, map[string]string{"type": string(options.Type), "size": metadata["size"]})
 	return keyID, nil
 }
 
 // ExportKey 导出密钥
 func (km *DefaultKeyManager) ExportKey(ctx context.Context, keyID string) ([]byte, error) {
 	if keyID == "" {
-		return nil, errors.New("keyID cannot be empty")
+		return nil, invalidArgument("keyID cannot be empty")
 	}
 
 	// 简单实现，直接返回密钥
@@ -243,7 +350,7 @@ func (km *DefaultKeyManager) ExportKey(ctx context.Context, keyID string) ([]byt
 // KeyExists 检查密钥是否存在
 func (km *DefaultKeyManager) KeyExists(ctx context.Context, keyID string) (bool, error) {
 	if keyID == "" {
-		return false, errors.New("keyID cannot be empty")
+		return false, invalidArgument("keyID cannot be empty")
 	}
 
 	// 获取所有密钥ID
@@ -267,7 +374,15 @@ func (km *DefaultKeyManager) GenerateKeyPair(ctx context.Context, keyType KeyTyp
 	if options == nil {
 		options = &KeyOptions{
 			Type: keyType,
-			Size: 2048, // 默认RSA 2048位
+		}
+	}
+	if options.Size == 0 {
+		// 默认RSA 2048位，EC使用P-256
+		switch keyType {
+		case RSAPrivateKey:
+			options.Size = 2048
+		case ECPrivateKey, ED25519PrivateKey:
+			options.Size = 256
 		}
 	}
 
@@ -281,6 +396,9 @@ func (km *DefaultKeyManager) GenerateKeyPair(ctx context.Context, keyType KeyTyp
 	case ECPrivateKey:
 		// 生成EC密钥对
 		privateKeyBytes, publicKeyBytes, err = generateECKeyPair(options.Size)
+	case ED25519PrivateKey:
+		// 生成Ed25519密钥对
+		privateKeyBytes, publicKeyBytes, err = generateEd25519KeyPair()
 	default:
 		return nil, fmt.Errorf("unsupported key type for key pair generation: %s", keyType)
 	}
@@ -288,9 +406,10 @@ func (km *DefaultKeyManager) GenerateKeyPair(ctx context.Context, keyType KeyTyp
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate key pair: %w", err)
 	}
+	defer wipe(privateKeyBytes)
 
 	// 生成密钥ID的基础
-	timestamp := time.Now().UnixNano()
+	timestamp := km.now().UnixNano()
 	randomStr := generateRandomString(8)
 
 	// 创建私钥元数据
@@ -309,12 +428,7 @@ func (km *DefaultKeyManager) GenerateKeyPair(ctx context.Context, keyType KeyTyp
 	}
 
 	// 创建公钥元数据
-	var publicKeyType KeyType
-	if keyType == RSAPrivateKey {
-		publicKeyType = RSAPublicKey
-	} else {
-		publicKeyType = ECPublicKey
-	}
+	publicKeyType := publicKeyTypeOf(keyType)
 
 	publicKeyMetadata := map[string]string{
 		"type":      string(publicKeyType),
@@ -337,18 +451,20 @@ func (km *DefaultKeyManager) GenerateKeyPair(ctx context.Context, keyType KeyTyp
 	// 在元数据中记录对应的公钥/私钥ID
 	privateKeyMetadata["public_key_id"] = publicKeyID
 	publicKeyMetadata["private_key_id"] = privateKeyID
+	setKeyUsage(privateKeyMetadata, options.Usage)
+	setKeyUsage(publicKeyMetadata, options.Usage)
 
 	// 创建密钥条目
 	privateKeyEntry := &KeyEntry{
 		Key:       privateKeyBytes,
 		Metadata:  privateKeyMetadata,
-		CreatedAt: time.Now(),
+		CreatedAt: km.now(),
 	}
 
 	publicKeyEntry := &KeyEntry{
 		Key:       publicKeyBytes,
 		Metadata:  publicKeyMetadata,
-		CreatedAt: time.Now(),
+		CreatedAt: km.now(),
 	}
 
 	// 如果有设置轮换策略，添加过期时间
@@ -363,6 +479,7 @@ func (km *DefaultKeyManager) GenerateKeyPair(ctx context.Context, keyType KeyTyp
 	if err != nil {
 		return nil, fmt.Errorf("failed to serialize private key: %w", err)
 	}
+	defer wipe(serializedPrivateKey)
 
 	serializedPublicKey, err := serializeKeyEntry(publicKeyEntry)
 	if err != nil {
@@ -383,6 +500,7 @@ func (km *DefaultKeyManager) GenerateKeyPair(ctx context.Context, keyType KeyTyp
 		return nil, fmt.Errorf("failed to store public key: %w", err)
 	}
 
+	km.record(AuditKeyGenerate, privateKeyID, map[string]string{"type": string(keyType), "public_key": publicKeyID})
 	return &AsymmetricKeyPair{
 		PrivateKeyID: privateKeyID,
 		PublicKeyID:  publicKeyID,
@@ -392,7 +510,7 @@ func (km *DefaultKeyManager) GenerateKeyPair(ctx context.Context, keyType KeyTyp
 // GetPublicKey 从私钥ID获取对应的公钥ID
 func (km *DefaultKeyManager) GetPublicKey(ctx context.Context, privateKeyID string) (string, error) {
 	if privateKeyID == "" {
-		return "", errors.New("private key ID cannot be empty")
+		return "", invalidArgument("private key ID cannot be empty")
 	}
 
 	// 获取私钥数据
@@ -400,12 +518,14 @@ func (km *DefaultKeyManager) GetPublicKey(ctx context.Context, privateKeyID stri
 	if err != nil {
 		return "", fmt.Errorf("failed to retrieve private key: %w", err)
 	}
+	defer wipe(keyData)
 
 	// 反序列化私钥条目
 	keyEntry, err := deserializeKeyEntry(keyData)
 	if err != nil {
 		return "", fmt.Errorf("failed to deserialize key entry: %w", err)
 	}
+	wipe(keyEntry.Key)
 
 	// 从元数据获取公钥ID
 	publicKeyID, ok := keyEntry.Metadata["public_key_id"]
@@ -419,11 +539,11 @@ func (km *DefaultKeyManager) GetPublicKey(ctx context.Context, privateKeyID stri
 // ImportKeyPair 导入非对称密钥对
 func (km *DefaultKeyManager) ImportKeyPair(ctx context.Context, privateKeyData, publicKeyData []byte, options *KeyOptions) (*AsymmetricKeyPair, error) {
 	if options == nil {
-		return nil, errors.New("options cannot be nil for importing key pair")
+		return nil, invalidArgument("options cannot be nil for importing key pair")
 	}
 
 	if len(privateKeyData) == 0 || len(publicKeyData) == 0 {
-		return nil, errors.New("private key and public key data cannot be empty")
+		return nil, invalidArgument("private key and public key data cannot be empty")
 	}
 
 	// 验证密钥对类型
@@ -435,6 +555,9 @@ func (km *DefaultKeyManager) ImportKeyPair(ctx context.Context, privateKeyData,
 	case ECPrivateKey:
 		privateKeyType = ECPrivateKey
 		publicKeyType = ECPublicKey
+	case ED25519PrivateKey:
+		privateKeyType = ED25519PrivateKey
+		publicKeyType = ED25519PublicKey
 	default:
 		return nil, fmt.Errorf("unsupported key type for key pair import: %s", options.Type)
 	}
@@ -451,7 +574,7 @@ func (km *DefaultKeyManager) ImportKeyPair(ctx context.Context, privateKeyData,
 	}
 
 	// 生成密钥ID的基础
-	timestamp := time.Now().UnixNano()
+	timestamp := km.now().UnixNano()
 	randomStr := generateRandomString(8)
 
 	// 创建私钥元数据
@@ -493,18 +616,20 @@ func (km *DefaultKeyManager) ImportKeyPair(ctx context.Context, privateKeyData,
 	// 在元数据中记录对应的公钥/私钥ID
 	privateKeyMetadata["public_key_id"] = publicKeyID
 	publicKeyMetadata["private_key_id"] = privateKeyID
+	setKeyUsage(privateKeyMetadata, options.Usage)
+	setKeyUsage(publicKeyMetadata, options.Usage)
 
 	// 创建密钥条目
 	privateKeyEntry := &KeyEntry{
 		Key:       privateKeyData,
 		Metadata:  privateKeyMetadata,
-		CreatedAt: time.Now(),
+		CreatedAt: km.now(),
 	}
 
 	publicKeyEntry := &KeyEntry{
 		Key:       publicKeyData,
 		Metadata:  publicKeyMetadata,
-		CreatedAt: time.Now(),
+		CreatedAt: km.now(),
 	}
 
 	// 如果有设置轮换策略，添加过期时间
@@ -519,6 +644,7 @@ func (km *DefaultKeyManager) ImportKeyPair(ctx context.Context, privateKeyData,
 	if err != nil {
 		return nil, fmt.Errorf("failed to serialize private key: %w", err)
 	}
+	defer wipe(serializedPrivateKey)
 
 	serializedPublicKey, err := serializeKeyEntry(publicKeyEntry)
 	if err != nil {
@@ -539,16 +665,17 @@ func (km *DefaultKeyManager) ImportKeyPair(ctx context.Context, privateKeyData,
 		return nil, fmt.Errorf("failed to store public key: %w", err)
 	}
 
+	km.record(AuditKeyImport, privateKeyID, map[string]string{"type": string(options.Type), "public_key": publicKeyID})
 	return &AsymmetricKeyPair{
 		PrivateKeyID: privateKeyID,
 		PublicKeyID:  publicKeyID,
 	}, nil
 }
 
-// RetrieveKeyEntry 获取完整的密钥条目（包括元数据）
+// RetrieveKeyEntry 获取完整的密钥条目（包括元数据），条目中的密钥归调用方所有，用完后应清零
 func (km *DefaultKeyManager) RetrieveKeyEntry(ctx context.Context, keyID string) (*KeyEntry, error) {
 	if keyID == "" {
-		return nil, errors.New("key ID cannot be empty")
+		return nil, invalidArgument("key ID cannot be empty")
 	}
 
 	// 从存储中获取序列化的密钥数据
@@ -556,6 +683,7 @@ func (km *DefaultKeyManager) RetrieveKeyEntry(ctx context.Context, keyID string)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve key: %w", err)
 	}
+	defer wipe(serializedData)
 
 	// 反序列化密钥条目
 	keyEntry, err := deserializeKeyEntry(serializedData)
@@ -564,7 +692,7 @@ func (km *DefaultKeyManager) RetrieveKeyEntry(ctx context.Context, keyID string)
 	}
 
 	// 检查密钥是否已过期
-	if keyEntry.ExpiresAt.After(time.Time{}) && time.Now().After(keyEntry.ExpiresAt) {
+	if keyEntry.ExpiresAt.After(time.Time{}) && km.now().After(keyEntry.ExpiresAt) {
 		// 标记过期，但仍然返回
 		keyEntry.Metadata["expired"] = "true"
 	}
@@ -572,6 +700,31 @@ func (km *DefaultKeyManager) RetrieveKeyEntry(ctx context.Context, keyID string)
 	return keyEntry, nil
 }
 
+// updateEntry 修改并写回密钥条目
+func (km *DefaultKeyManager) updateEntry(ctx context.Context, keyID string, update func(entry *KeyEntry)) error {
+	data, err := km.storage.Retrieve(ctx, keyID)
+	if err != nil {
+		return err
+	}
+	entry, err := deserializeKeyEntry(data)
+	wipe(data)
+	if err != nil {
+		return err
+	}
+	defer wipe(entry.Key)
+	if entry.Metadata == nil {
+		entry.Metadata = make(map[string]string)
+	}
+
+	update(entry)
+	data, err = serializeKeyEntry(entry)
+	if err != nil {
+		return err
+	}
+	defer wipe(data)
+	return km.storage.Store(ctx, keyID, data)
+}
+
 // 辅助函数：生成随机字符串
 func generateRandomString(length int) string {
 	bytes := make([]byte, length/2+1)
@@ -579,26 +732,105 @@ func generateRandomString(length int) string {
 	return hex.EncodeToString(bytes)[:length]
 }
 
-// 辅助函数：序列化密钥条目
+// 密钥条目的二进制格式：魔数 + 版本 + 创建时间 + 过期时间（UnixNano，零值时间记为0）+
+// 元数据（数量uint16，键值各以uint16长度前缀，按键排序）+ 密钥（uint32长度前缀）。
+// 不经过 encoding/json，避免密钥以base64形式残留在JSON编码缓冲区中
+const (
+	keyEntryMagic   = "FKEY"
+	keyEntryVersion = 1
+)
+
+// 辅助函数：序列化密钥条目。结果包含密钥明文，调用方用完后应 wipe
 func serializeKeyEntry(entry *KeyEntry) ([]byte, error) {
-	return json.Marshal(entry)
+	if len(entry.Metadata) > 0xffff {
+		return nil, errors.New("too many key metadata entries")
+	}
+	names := make([]string, 0, len(entry.Metadata))
+	size := len(keyEntryMagic) + 1 + 8 + 8 + 2 + 4 + len(entry.Key)
+	for name, value := range entry.Metadata {
+		if len(name) > 0xffff || len(value) > 0xffff {
+			return nil, fmt.Errorf("key metadata %s too long", name)
+		}
+		names = append(names, name)
+		size += 4 + len(name) + len(value)
+	}
+	sort.Strings(names)
+
+	// 一次分配足够的空间，避免扩容时在旧缓冲区中留下密钥副本
+	buf := make([]byte, 0, size)
+	buf = append(buf, keyEntryMagic...)
+	buf = append(buf, keyEntryVersion)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(unixNano(entry.CreatedAt)))
+	buf = binary.BigEndian.AppendUint64(buf, uint64(unixNano(entry.ExpiresAt)))
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(names)))
+	for _, name := range names {
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(name)))
+		buf = append(buf, name...)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(entry.Metadata[name])))
+		buf = append(buf, entry.Metadata[name]...)
+	}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(entry.Key)))
+	return append(buf, entry.Key...), nil
 }
 
-// 辅助函数：反序列化密钥条目
+// 辅助函数：反序列化密钥条目。返回的条目不引用data，调用方可以随即 wipe(data)。
+// 旧版本以JSON保存的条目仍然可以读取，下次写入时改为二进制格式
 func deserializeKeyEntry(data []byte) (*KeyEntry, error) {
-	var entry KeyEntry
-	err := json.Unmarshal(data, &entry)
-	if err != nil {
-		return nil, err
+	if !bytes.HasPrefix(data, []byte(keyEntryMagic)) {
+		var entry KeyEntry
+		err := json.Unmarshal(data, &entry)
+		if err != nil {
+			return nil, err
+		}
+		return &entry, nil
+	}
+
+	r := envelopeReader{data: data[len(keyEntryMagic):]}
+	if version := r.byte(); r.err == nil && version != keyEntryVersion {
+		return nil, fmt.Errorf("unsupported key entry version %d", version)
+	}
+	entry := &KeyEntry{
+		CreatedAt: fromUnixNano(r.bytes(8)),
+		ExpiresAt: fromUnixNano(r.bytes(8)),
+		Metadata:  make(map[string]string),
 	}
-	return &entry, nil
+	for n := int(r.uint16()); n > 0 && r.err == nil; n-- {
+		name := string(r.bytes(int(r.uint16())))
+		entry.Metadata[name] = string(r.bytes(int(r.uint16())))
+	}
+	key := r.bytes(int(r.uint32()))
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid key entry: %w", r.err)
+	}
+	entry.Key = append([]byte(nil), key...)
+	return entry, nil
+}
+
+// unixNano 零值时间记为0
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano 解码 unixNano 的结果，b为nil（数据不足）时返回零值时间
+func fromUnixNano(b []byte) time.Time {
+	if len(b) != 8 {
+		return time.Time{}
+	}
+	n := int64(binary.BigEndian.Uint64(b))
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
 }
 
 // 辅助函数：生成RSA密钥对
 func generateRSAKeyPair(bits int) ([]byte, []byte, error) {
 	// 验证密钥大小
 	if bits < 2048 {
-		return nil, nil, errors.New("RSA key size must be at least 2048 bits")
+		return nil, nil, invalidArgument("RSA key size must be at least 2048 bits")
 	}
 
 	// 生成RSA私钥
@@ -622,10 +854,65 @@ func generateRSAKeyPair(bits int) ([]byte, []byte, error) {
 	return privateKeyBytes, publicKeyBytes, nil
 }
 
-// 辅助函数：生成EC密钥对
+// 辅助函数：生成EC密钥对，私钥为PKCS8格式，公钥为PKIX格式
 func generateECKeyPair(bits int) ([]byte, []byte, error) {
-	// 注意：标准库中没有直接支持ECIES，这里我们只提供函数框架
-	return nil, nil, errors.New("EC key pair generation not implemented in this example")
+	curve, err := ecCurve(bits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 生成EC私钥
+	privateKey, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate EC key: %w", err)
+	}
+
+	// 编码私钥为PKCS8格式
+	privateKeyBytes, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	// 编码公钥为PKIX格式
+	publicKeyBytes, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+
+	return privateKeyBytes, publicKeyBytes, nil
+}
+
+// 辅助函数：生成Ed25519密钥对，与签名提供者一致使用原始格式（私钥64字节，公钥32字节）
+func generateEd25519KeyPair() ([]byte, []byte, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate Ed25519 key: %w", err)
+	}
+	return privateKey, publicKey, nil
+}
+
+// 辅助函数：按密钥大小选择椭圆曲线
+func ecCurve(bits int) (elliptic.Curve, error) {
+	switch bits {
+	case 256:
+		return elliptic.P256(), nil
+	case 384:
+		return elliptic.P384(), nil
+	default:
+		return nil, fmt.Errorf("unsupported EC key size: %d (must be 256 or 384)", bits)
+	}
+}
+
+// 辅助函数：私钥类型对应的公钥类型
+func publicKeyTypeOf(keyType KeyType) KeyType {
+	switch keyType {
+	case RSAPrivateKey:
+		return RSAPublicKey
+	case ED25519PrivateKey:
+		return ED25519PublicKey
+	default:
+		return ECPublicKey
+	}
 }
 
 // 辅助函数：验证密钥对
@@ -668,8 +955,57 @@ func validateKeyPair(privateKeyData, publicKeyData []byte, keyType KeyType) (int
 		keySize = rsaPrivateKey.Size() * 8
 
 	case ECPrivateKey:
-		// 标准库中没有直接支持ECIES，这里需要实现EC密钥对验证
-		return 0, errors.New("EC key pair validation not implemented in this example")
+		// 解析EC私钥，支持PKCS8和SEC1格式
+		var ecPrivateKey *ecdsa.PrivateKey
+		if privateKey, err := x509.ParsePKCS8PrivateKey(privateKeyData); err == nil {
+			var ok bool
+			if ecPrivateKey, ok = privateKey.(*ecdsa.PrivateKey); !ok {
+				return 0, errors.New("private key is not an EC key")
+			}
+		} else if ecPrivateKey, err = x509.ParseECPrivateKey(privateKeyData); err != nil {
+			return 0, fmt.Errorf("invalid EC private key: %w", err)
+		}
+
+		// 解析EC公钥
+		publicKey, err := x509.ParsePKIXPublicKey(publicKeyData)
+		if err != nil {
+			return 0, fmt.Errorf("invalid EC public key: %w", err)
+		}
+
+		ecPublicKey, ok := publicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return 0, errors.New("public key is not an EC key")
+		}
+
+		// 只支持签名提供者使用的曲线
+		keySize = ecPrivateKey.Curve.Params().BitSize
+		if _, err := ecCurve(keySize); err != nil {
+			return 0, err
+		}
+
+		// 验证密钥对是否匹配
+		if !ecPrivateKey.PublicKey.Equal(ecPublicKey) {
+			return 0, errors.New("EC public key does not match private key")
+		}
+
+	case ED25519PrivateKey:
+		// 解析Ed25519私钥和公钥
+		edPrivateKey, err := ParseEd25519PrivateKey(privateKeyData)
+		if err != nil {
+			return 0, err
+		}
+		edPublicKey, err := ParseEd25519PublicKey(publicKeyData)
+		if err != nil {
+			return 0, err
+		}
+
+		// 验证密钥对是否匹配，私钥后32字节是公钥，还需由种子重新推导校验
+		derived := ed25519.NewKeyFromSeed(edPrivateKey.Seed())
+		if !derived.Equal(edPrivateKey) || !edPrivateKey.Public().(ed25519.PublicKey).Equal(edPublicKey) {
+			return 0, errors.New("Ed25519 public key does not match private key")
+		}
+
+		keySize = 256
 
 	default:
 		return 0, fmt.Errorf("unsupported key type: %s", keyType)
@@ -0,0 +1,373 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// KeyProvider 外部密钥管理服务。主密钥保存在服务内部不会离开服务，
+// 本地只保存经主密钥包装后的数据密钥
+type KeyProvider interface {
+	// Name 提供者名称，记录在包装后的数据中
+	Name() string
+
+	// WrapKey 用主密钥包装数据密钥
+	WrapKey(ctx context.Context, plaintext []byte) ([]byte, error)
+
+	// UnwrapKey 用主密钥解包数据密钥
+	UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// KMS提供者类型，与配置项 security.encryption.keySource 的取值对应
+const (
+	// KeySourceKeystore 本地密钥库，不使用外部密钥管理服务
+	KeySourceKeystore = "keystore"
+
+	// KeySourceAWSKMS AWS KMS
+	KeySourceAWSKMS = "aws-kms"
+
+	// KeySourceGCPKMS Google Cloud KMS
+	KeySourceGCPKMS = "gcp-kms"
+
+	// KeySourceVault HashiCorp Vault Transit 引擎
+	KeySourceVault = "vault"
+)
+
+// KMSConfig 外部密钥管理服务配置。访问凭据只从环境变量读取，不写入配置
+type KMSConfig struct {
+	// Provider 提供者类型
+	Provider string
+
+	// KeyID 主密钥标识：AWS为密钥ID或ARN，GCP为cryptoKey资源名，Vault为transit密钥名
+	KeyID string
+
+	// Region AWS区域
+	Region string
+
+	// Endpoint 服务地址，为空时使用各提供者的默认地址
+	Endpoint string
+
+	// Mount Vault transit 引擎挂载路径，默认 transit
+	Mount string
+}
+
+// NewKeyProvider 根据配置创建密钥提供者
+func NewKeyProvider(config KMSConfig) (KeyProvider, error) {
+	if config.KeyID == "" {
+		return nil, invalidArgument("kms key id cannot be empty")
+	}
+
+	switch config.Provider {
+	case KeySourceAWSKMS:
+		return NewAWSKMSProvider(config.KeyID, config.Region, config.Endpoint)
+	case KeySourceGCPKMS:
+		return NewGCPKMSProvider(config.KeyID, config.Endpoint)
+	case KeySourceVault:
+		return NewVaultTransitProvider(config.KeyID, config.Endpoint, config.Mount)
+	default:
+		return nil, fmt.Errorf("unsupported key provider: %s", config.Provider)
+	}
+}
+
+// 包装记录格式（大端序）：
+//
+//	magic "FKMS" | version(1) | 提供者名长度(1) 提供者名 | 包装密钥长度(2) 包装密钥 | 随机数(12) | 密文
+//
+// 每条记录使用独立的随机数据密钥以AES-256-GCM加密，数据密钥由 KeyProvider 包装，
+// 记录键名作为关联数据，防止记录在键之间被调换
+const (
+	// wrappedRecordMagic 包装记录魔数
+	wrappedRecordMagic = "FKMS"
+
+	// wrappedRecordVersion 包装记录版本
+	wrappedRecordVersion = 1
+
+	// wrappedNonceSize AES-GCM随机数长度
+	wrappedNonceSize = 12
+)
+
+// ErrUnwrappedRecord 安全存储中的记录没有经过密钥提供者包装
+var ErrUnwrappedRecord = errors.New("secure storage record is not wrapped by key provider")
+
+// WrappedSecureStorage 使用外部密钥提供者包装数据的安全存储。
+// 写入底层存储的只有密文和包装后的数据密钥，解密结果只缓存在内存中
+type WrappedSecureStorage struct {
+	// 底层存储
+	storage SecureStorage
+
+	// 密钥提供者
+	provider KeyProvider
+
+	// 解密结果缓存，避免每次读取都访问密钥管理服务
+	cache map[string][]byte
+
+	// 锁
+	mu sync.RWMutex
+}
+
+// NewWrappedSecureStorage 创建包装安全存储
+func NewWrappedSecureStorage(storage SecureStorage, provider KeyProvider) *WrappedSecureStorage {
+	ws := &WrappedSecureStorage{
+		storage:  storage,
+		provider: provider,
+		cache:    make(map[string][]byte),
+	}
+
+	// 提供者锁定时清除解密缓存
+	if lp, ok := provider.(lockableProvider); ok {
+		lp.onLock(ws.Purge)
+	}
+	return ws
+}
+
+// Store 加密数据并存储
+func (ws *WrappedSecureStorage) Store(ctx context.Context, key string, data []byte) error {
+	record, err := ws.seal(ctx, key, data)
+	if err != nil {
+		return err
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	wipe(ws.cache[key])
+	if err := ws.storage.Store(ctx, key, record); err != nil {
+		delete(ws.cache, key)
+		return err
+	}
+	ws.cache[key] = append([]byte(nil), data...)
+	return nil
+}
+
+// Retrieve 获取并解密数据
+func (ws *WrappedSecureStorage) Retrieve(ctx context.Context, key string) ([]byte, error) {
+	// 提供者已锁定时缓存也不可用
+	if lp, ok := ws.provider.(lockableProvider); ok {
+		if err := lp.touch(); err != nil {
+			ws.Purge()
+			return nil, err
+		}
+	}
+
+	// 缓存中的数据在覆盖和删除时会被清零，需要在锁内复制
+	ws.mu.RLock()
+	data, ok := ws.cache[key]
+	if ok {
+		data = append([]byte(nil), data...)
+	}
+	ws.mu.RUnlock()
+	if ok {
+		return data, nil
+	}
+
+	record, err := ws.storage.Retrieve(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	data, err = ws.open(ctx, key, record)
+	if err != nil {
+		return nil, err
+	}
+
+	result := append([]byte(nil), data...)
+	ws.mu.Lock()
+	wipe(ws.cache[key])
+	ws.cache[key] = data
+	ws.mu.Unlock()
+	return result, nil
+}
+
+// Delete 删除数据
+func (ws *WrappedSecureStorage) Delete(ctx context.Context, key string) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	wipe(ws.cache[key])
+	delete(ws.cache, key)
+	return ws.storage.Delete(ctx, key)
+}
+
+// List 列出存储的所有键
+func (ws *WrappedSecureStorage) List(ctx context.Context) ([]string, error) {
+	return ws.storage.List(ctx)
+}
+
+// Purge 清除内存中的解密缓存
+func (ws *WrappedSecureStorage) Purge() {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	for key, data := range ws.cache {
+		wipe(data)
+		delete(ws.cache, key)
+	}
+}
+
+// WrapExisting 将底层存储中尚未包装的记录改写为包装格式，用于从本地密钥库迁移，
+// 返回改写的记录数
+func (ws *WrappedSecureStorage) WrapExisting(ctx context.Context) (int, error) {
+	keys, err := ws.storage.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, key := range keys {
+		record, err := ws.storage.Retrieve(ctx, key)
+		if err != nil {
+			return n, err
+		}
+		if isWrappedRecord(record) {
+			continue
+		}
+		if err := ws.Store(ctx, key, record); err != nil {
+			return n, fmt.Errorf("failed to wrap record %s: %w", key, err)
+		}
+		n++
+	}
+	return n, nil
+}
+
+// seal 生成数据密钥加密数据，并用密钥提供者包装数据密钥
+func (ws *WrappedSecureStorage) seal(ctx context.Context, key string, data []byte) ([]byte, error) {
+	dek := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dek); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	defer wipe(dek)
+
+	wrapped, err := ws.provider.WrapKey(ctx, dek)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key with %s: %w", ws.provider.Name(), err)
+	}
+
+	name := ws.provider.Name()
+	if len(name) > 0xff || len(wrapped) > 0xffff {
+		return nil, errors.New("wrapped data key too long")
+	}
+
+	aead, err := newAESGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomNonce(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 0, len(wrappedRecordMagic)+2+len(name)+2+len(wrapped)+len(nonce)+len(data)+aead.Overhead())
+	buf = append(buf, wrappedRecordMagic...)
+	buf = append(buf, wrappedRecordVersion)
+	buf = append(buf, byte(len(name)))
+	buf = append(buf, name...)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(wrapped)))
+	buf = append(buf, wrapped...)
+	buf = append(buf, nonce...)
+	return aead.Seal(buf, nonce, data, []byte(key)), nil
+}
+
+// open 解包数据密钥并解密记录
+func (ws *WrappedSecureStorage) open(ctx context.Context, key string, record []byte) ([]byte, error) {
+	if !isWrappedRecord(record) {
+		return nil, fmt.Errorf("%w: %s", ErrUnwrappedRecord, key)
+	}
+
+	r := envelopeReader{data: record[len(wrappedRecordMagic):]}
+	if version := r.byte(); r.err == nil && version != wrappedRecordVersion {
+		return nil, fmt.Errorf("unsupported wrapped record version %d", version)
+	}
+	name := string(r.bytes(int(r.byte())))
+	wrapped := r.bytes(int(r.uint16()))
+	nonce := r.bytes(wrappedNonceSize)
+	if r.err != nil {
+		return nil, fmt.Errorf("invalid wrapped record %s: %w", key, r.err)
+	}
+	if name != ws.provider.Name() {
+		return nil, fmt.Errorf("record %s was wrapped by %s, not %s", key, name, ws.provider.Name())
+	}
+
+	dek, err := ws.provider.UnwrapKey(ctx, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key with %s: %w", name, err)
+	}
+	defer wipe(dek)
+
+	aead, err := newAESGCM(dek)
+	if err != nil {
+		return nil, err
+	}
+	data, err := aead.Open(nil, nonce, r.data, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt record %s: %w", key, err)
+	}
+	return data, nil
+}
+
+// isWrappedRecord 判断记录是否为包装格式
+func isWrappedRecord(record []byte) bool {
+	return bytes.HasPrefix(record, []byte(wrappedRecordMagic))
+}
+
+// kmsHTTPClient 访问密钥管理服务的默认HTTP客户端
+var kmsHTTPClient = &http.Client{Timeout: 30 * time.Second}
+
+// kmsError 密钥管理服务返回的错误
+type kmsError struct {
+	provider string
+	status   int
+	message  string
+}
+
+func (e *kmsError) Error() string {
+	return fmt.Sprintf("%s request failed with status %d: %s", e.provider, e.status, e.message)
+}
+
+// postJSON 向密钥管理服务发送JSON请求并解析响应，sign 用于在发送前设置认证信息
+func postJSON(ctx context.Context, client *http.Client, provider, url string, in, out interface{}, sign func(req *http.Request, body []byte) error) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if sign != nil {
+		if err := sign(req, body); err != nil {
+			return err
+		}
+	}
+
+	if client == nil {
+		client = kmsHTTPClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", provider, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read %s response: %w", provider, err)
+	}
+	if resp.StatusCode/100 != 2 {
+		return &kmsError{provider: provider, status: resp.StatusCode, message: strings.TrimSpace(string(data))}
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse %s response: %w", provider, err)
+	}
+	return nil
+}
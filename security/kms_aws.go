@@ -0,0 +1,192 @@
+package security
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// AWSKMSProvider 使用AWS KMS包装数据密钥。
+// 凭据从环境变量 AWS_ACCESS_KEY_ID、AWS_SECRET_ACCESS_KEY、AWS_SESSION_TOKEN 读取
+type AWSKMSProvider struct {
+	// KeyID 主密钥ID、别名或ARN
+	KeyID string
+
+	// Region 区域
+	Region string
+
+	// Endpoint 服务地址
+	Endpoint string
+
+	// AccessKeyID 访问密钥ID
+	AccessKeyID string
+
+	// SecretAccessKey 访问密钥
+	SecretAccessKey string
+
+	// SessionToken 临时凭据的会话令牌
+	SessionToken string
+
+	// Client HTTP客户端，为空时使用默认客户端
+	Client *http.Client
+
+	// now 签名时间，测试时可替换
+	now func() time.Time
+}
+
+// NewAWSKMSProvider 创建AWS KMS密钥提供者，region为空时读取 AWS_REGION
+func NewAWSKMSProvider(keyID, region, endpoint string) (*AWSKMSProvider, error) {
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		return nil, invalidArgument("aws kms region cannot be empty")
+	}
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://kms.%s.amazonaws.com", region)
+	}
+
+	p := &AWSKMSProvider{
+		KeyID:           keyID,
+		Region:          region,
+		Endpoint:        strings.TrimSuffix(endpoint, "/"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		now:             time.Now,
+	}
+	if p.AccessKeyID == "" || p.SecretAccessKey == "" {
+		return nil, errors.New("aws credentials not found in environment")
+	}
+	return p, nil
+}
+
+// Name 提供者名称
+func (p *AWSKMSProvider) Name() string {
+	return KeySourceAWSKMS
+}
+
+// WrapKey 调用KMS Encrypt包装数据密钥
+func (p *AWSKMSProvider) WrapKey(ctx context.Context, plaintext []byte) ([]byte, error) {
+	var resp struct {
+		CiphertextBlob []byte `json:"CiphertextBlob"`
+	}
+	in := map[string]interface{}{"KeyId": p.KeyID, "Plaintext": plaintext}
+	if err := p.call(ctx, "Encrypt", in, &resp); err != nil {
+		return nil, err
+	}
+	return resp.CiphertextBlob, nil
+}
+
+// UnwrapKey 调用KMS Decrypt解包数据密钥
+func (p *AWSKMSProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Plaintext []byte `json:"Plaintext"`
+	}
+	in := map[string]interface{}{"KeyId": p.KeyID, "CiphertextBlob": wrapped}
+	if err := p.call(ctx, "Decrypt", in, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Plaintext, nil
+}
+
+// call 发送签名后的KMS请求
+func (p *AWSKMSProvider) call(ctx context.Context, action string, in, out interface{}) error {
+	return postJSON(ctx, p.Client, p.Name(), p.Endpoint+"/", in, out, func(req *http.Request, body []byte) error {
+		req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+		req.Header.Set("X-Amz-Target", "TrentService."+action)
+		p.sign(req, body)
+		return nil
+	})
+}
+
+// sign 按 AWS Signature Version 4 为请求签名
+func (p *AWSKMSProvider) sign(req *http.Request, body []byte) {
+	now := time.Now
+	if p.now != nil {
+		now = p.now
+	}
+	t := now().UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if p.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", p.SessionToken)
+	}
+
+	// 规范请求头：host 加上所有 content-type 和 x-amz-* 头
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + p.Region + "/kms/aws4_request"
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+p.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, p.Region)
+	signingKey = hmacSHA256(signingKey, "kms")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		p.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// canonicalQuery 按键排序编码查询参数
+func canonicalQuery(values url.Values) string {
+	return strings.ReplaceAll(values.Encode(), "+", "%20")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,104 @@
+package security
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// VaultTransitProvider 使用HashiCorp Vault Transit引擎包装数据密钥。
+// 令牌从环境变量 VAULT_TOKEN 读取，地址为空时读取 VAULT_ADDR
+type VaultTransitProvider struct {
+	// KeyName transit密钥名
+	KeyName string
+
+	// Address Vault地址
+	Address string
+
+	// Mount transit引擎挂载路径
+	Mount string
+
+	// Token 访问令牌
+	Token string
+
+	// Namespace Vault企业版命名空间，读取 VAULT_NAMESPACE
+	Namespace string
+
+	// Client HTTP客户端，为空时使用默认客户端
+	Client *http.Client
+}
+
+// NewVaultTransitProvider 创建Vault Transit密钥提供者
+func NewVaultTransitProvider(keyName, address, mount string) (*VaultTransitProvider, error) {
+	if address == "" {
+		address = os.Getenv("VAULT_ADDR")
+	}
+	if address == "" {
+		return nil, invalidArgument("vault address cannot be empty")
+	}
+	if mount == "" {
+		mount = "transit"
+	}
+
+	p := &VaultTransitProvider{
+		KeyName:   keyName,
+		Address:   strings.TrimSuffix(address, "/"),
+		Mount:     strings.Trim(mount, "/"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+	}
+	if p.Token == "" {
+		return nil, errors.New("vault token not found in environment")
+	}
+	return p, nil
+}
+
+// Name 提供者名称
+func (p *VaultTransitProvider) Name() string {
+	return KeySourceVault
+}
+
+// WrapKey 调用transit加密接口包装数据密钥，返回 vault:v1:... 形式的密文
+func (p *VaultTransitProvider) WrapKey(ctx context.Context, plaintext []byte) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Ciphertext string `json:"ciphertext"`
+		} `json:"data"`
+	}
+	in := map[string]string{"plaintext": base64.StdEncoding.EncodeToString(plaintext)}
+	if err := p.call(ctx, "encrypt", in, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Data.Ciphertext == "" {
+		return nil, errors.New("vault returned empty ciphertext")
+	}
+	return []byte(resp.Data.Ciphertext), nil
+}
+
+// UnwrapKey 调用transit解密接口解包数据密钥
+func (p *VaultTransitProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var resp struct {
+		Data struct {
+			Plaintext string `json:"plaintext"`
+		} `json:"data"`
+	}
+	if err := p.call(ctx, "decrypt", map[string]string{"ciphertext": string(wrapped)}, &resp); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(resp.Data.Plaintext)
+}
+
+// call 发送带令牌的transit请求
+func (p *VaultTransitProvider) call(ctx context.Context, op string, in, out interface{}) error {
+	url := p.Address + "/v1/" + p.Mount + "/" + op + "/" + p.KeyName
+	return postJSON(ctx, p.Client, p.Name(), url, in, out, func(req *http.Request, body []byte) error {
+		req.Header.Set("X-Vault-Token", p.Token)
+		if p.Namespace != "" {
+			req.Header.Set("X-Vault-Namespace", p.Namespace)
+		}
+		return nil
+	})
+}
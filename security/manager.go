@@ -2,10 +2,16 @@ package security
 
 import (
 	"context"
+	"crypto"
+	"crypto/x509"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"sync"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+	"github.com/bpfs/fragmenta/vfs"
 )
 
 // DefaultSecurityManager 默认安全管理器实现
@@ -27,6 +33,35 @@ type DefaultSecurityManager struct {
 
 	// 初始化状态
 	initialized bool
+
+	// 口令密钥提供者，未启用密钥库加密时为nil
+	passphrase *PassphraseKeyProvider
+
+	// 包装后的密钥库
+	wrappedStorage *WrappedSecureStorage
+
+	// 受信任的CA
+	trustStore *TrustStore
+
+	// 签名提供者
+	signatureProvider *DefaultSignatureProvider
+
+	// 审计记录器，为nil时不记录
+	audit AuditRecorder
+
+	// 安全事件回调，与密钥管理器共享
+	events *eventHooks
+
+	// 自动轮换回调
+	rotationHooks hookSet[RotationHook]
+
+	// 轮换调度的取消函数和结束信号，未启动时为nil
+	rotationCancel context.CancelFunc
+	rotationDone   chan struct{}
+
+	// 对象ID到当前数据密钥ID，按需从密钥元数据中查找
+	objectMu   sync.Mutex
+	objectKeys map[string]string
 }
 
 // SecurityConfig 安全配置
@@ -42,6 +77,37 @@ type SecurityConfig struct {
 
 	// 自动生成密钥
 	AutoGenerateKey bool
+
+	// 外部密钥管理服务配置，Provider 为空或 keystore 时不使用
+	KMS KMSConfig
+
+	// 密钥提供者，设置后优先于 KMS 配置。密钥库中的密钥由提供者包装后才写入磁盘
+	KeyProvider KeyProvider
+
+	// 用口令派生的密钥加密密钥库，需要调用 Unlock 后才能使用密钥，不能与外部密钥提供者同时使用
+	EncryptKeyStore bool
+
+	// 解锁后空闲多久自动锁定，0表示不自动锁定
+	RelockTimeout time.Duration
+
+	// 受信任的CA证书文件（PEM），用于验证块签名中附带的证书链
+	TrustedCAFiles []string
+
+	// 硬件密钥设备（HSM、TPM等），设置后可以用 GenerateHardwareKeyPair 在设备内生成密钥对
+	HardwareToken HardwareToken
+
+	// 自动轮换的检查间隔，大于0时 Initialize 启动轮换调度、Shutdown 停止。
+	// 只轮换 RotationPolicy.AutoRotate 为true的对称密钥
+	RotationCheckInterval time.Duration
+
+	// 距离过期多久时轮换，0表示剩余有效期不足十分之一时轮换，最多取有效期的一半
+	RotationLeadTime time.Duration
+
+	// 时钟，用于密钥过期判断和轮换调度，为nil时使用系统时钟
+	Clock clock.Clock
+
+	// 密钥库所在的文件系统，为nil时使用操作系统的文件系统
+	FS vfs.FS
 }
 
 // NewDefaultSecurityManager 创建默认安全管理器
@@ -60,25 +126,94 @@ func NewDefaultSecurityManager(config *SecurityConfig) (*DefaultSecurityManager,
 	}
 
 	// 创建文件安全存储
-	secureStorage, err := NewFileSecureStorage(config.KeyStorePath)
+	fileStorage, err := NewFileSecureStorageFS(config.FS, config.KeyStorePath)
 	if err != nil {
 		return nil, fmt.Errorf("创建安全存储失败: %w", err)
 	}
+	var secureStorage SecureStorage = fileStorage
+
+	// 使用外部密钥管理服务时，密钥只以包装后的形式落盘
+	provider := config.KeyProvider
+	if provider == nil && config.KMS.Provider != "" && config.KMS.Provider != KeySourceKeystore {
+		if provider, err = NewKeyProvider(config.KMS); err != nil {
+			return nil, fmt.Errorf("创建密钥提供者失败: %w", err)
+		}
+	}
+	var passphrase *PassphraseKeyProvider
+	if config.EncryptKeyStore {
+		if provider != nil {
+			return nil, errors.New("密钥库加密不能与外部密钥提供者同时使用")
+		}
+		passphrase = NewPassphraseKeyProvider(config.KeyStorePath, config.RelockTimeout)
+		provider = passphrase
+	}
+	var wrappedStorage *WrappedSecureStorage
+	if provider != nil {
+		wrappedStorage = NewWrappedSecureStorage(fileStorage, provider)
+		secureStorage = wrappedStorage
+	}
 
 	// 创建密钥管理器
+	events := newEventHooks()
 	keyManager := NewDefaultKeyManager(secureStorage)
+	keyManager.events = events
+	keyManager.SetClock(config.Clock)
+	if config.HardwareToken != nil {
+		keyManager.SetHardwareToken(config.HardwareToken)
+	}
 
 	// 创建加密提供者
 	encryptionProvider := NewDefaultEncryptionProvider(keyManager)
 
+	// 加载受信任的CA
+	trustStore, err := LoadTrustStore(config.TrustedCAFiles...)
+	if err != nil {
+		return nil, fmt.Errorf("加载受信任的CA失败: %w", err)
+	}
+
 	return &DefaultSecurityManager{
 		encryptionProvider: encryptionProvider,
 		keyManager:         keyManager,
 		config:             config,
 		initialized:        false,
+		passphrase:         passphrase,
+		wrappedStorage:     wrappedStorage,
+		trustStore:         trustStore,
+		signatureProvider:  NewDefaultSignatureProvider(keyManager),
+		events:             events,
 	}, nil
 }
 
+// Unlock 用口令解锁密钥库。首次解锁时设置口令，并加密密钥库中已有的明文密钥
+func (sm *DefaultSecurityManager) Unlock(ctx context.Context, passphrase []byte) error {
+	if sm.passphrase == nil {
+		return errors.New("key store encryption is not enabled")
+	}
+	if err := sm.passphrase.Unlock(passphrase); err != nil {
+		sm.record(AuditKeyStoreUnlock, sm.config.KeyStorePath, map[string]string{"result": "failed"})
+		return err
+	}
+	sm.record(AuditKeyStoreUnlock, sm.config.KeyStorePath, nil)
+
+	if _, err := sm.wrappedStorage.WrapExisting(ctx); err != nil {
+		return fmt.Errorf("failed to encrypt existing keys: %w", err)
+	}
+	return nil
+}
+
+// Lock 锁定密钥库并清除内存中的密钥，之后的加解密返回 ErrKeyStoreLocked
+func (sm *DefaultSecurityManager) Lock() {
+	if sm.passphrase != nil && !sm.passphrase.IsLocked() {
+		sm.passphrase.Lock()
+		sm.record(AuditKeyStoreLock, sm.config.KeyStorePath, nil)
+	}
+}
+
+// IsLocked 返回密钥库是否已锁定，未启用密钥库加密时总是返回false
+func (sm *DefaultSecurityManager) IsLocked() bool {
+	return sm.passphrase != nil && sm.passphrase.IsLocked()
+}
+
 // Initialize 初始化安全管理器
 func (sm *DefaultSecurityManager) Initialize(ctx context.Context) error {
 	sm.mu.Lock()
@@ -118,6 +253,7 @@ func (sm *DefaultSecurityManager) Initialize(ctx context.Context) error {
 	}
 
 	sm.initialized = true
+	sm.startRotation()
 	return nil
 }
 
@@ -130,9 +266,12 @@ func (sm *DefaultSecurityManager) IsInitialized() bool {
 
 // Shutdown 关闭安全子系统
 func (sm *DefaultSecurityManager) Shutdown(ctx context.Context) error {
+	sm.stopRotation()
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 	sm.initialized = false
+	sm.Lock()
 	return nil
 }
 
@@ -146,32 +285,63 @@ func (sm *DefaultSecurityManager) GetKeyManager() KeyManager {
 	return sm.keyManager
 }
 
-// EncryptBlock 加密数据块
+// EncryptBlock 用默认密钥和默认算法加密数据块，输出加密块信封
 func (sm *DefaultSecurityManager) EncryptBlock(ctx context.Context, blockID uint32, data []byte) ([]byte, error) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
+	return sm.encryptBlockLocked(ctx, sm.defaultKeyID, blockID, data)
+}
+
+// EncryptBlockWithKey 用指定密钥和默认算法加密数据块，输出加密块信封
+func (sm *DefaultSecurityManager) EncryptBlockWithKey(ctx context.Context, keyID string, blockID uint32, data []byte) ([]byte, error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return sm.encryptBlockLocked(ctx, keyID, blockID, data)
+}
+
+// encryptBlockLocked 加密数据块，调用方需持有读锁
+func (sm *DefaultSecurityManager) encryptBlockLocked(ctx context.Context, keyID string, blockID uint32, data []byte) ([]byte, error) {
 	// 如果加密未启用，直接返回原始数据
 	if !sm.config.EncryptionEnabled {
 		return data, nil
 	}
 
-	// 获取默认密钥
-	keyData, err := sm.keyManager.GetKey(ctx, sm.defaultKeyID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get default key: %w", err)
+	sealer, ok := sm.encryptionProvider.(blockCipher)
+	if !ok {
+		return nil, errors.New("encryption provider does not support block envelopes")
 	}
 
-	// 准备额外的关联数据（AAD）
-	associatedData := make([]byte, 4)
-	binary.BigEndian.PutUint32(associatedData, blockID)
+	key, err := sm.keyManager.GetKeySecret(ctx, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key %s: %w", keyID, err)
+	}
+	defer key.Close()
 
-	// 对数据进行加密
-	return sm.encryptionProvider.Encrypt(ctx, string(sm.config.DefaultAlgorithm), keyData, data, associatedData)
+	envelope, err := sealer.sealBlock(sm.config.DefaultAlgorithm, keyID, key.Bytes(), blockID, data)
+	if err != nil {
+		return nil, err
+	}
+	return envelope.Marshal()
 }
 
-// DecryptBlock 解密数据块
+// DecryptBlock 解密数据块。信封格式按其中记录的密钥和算法解密，
+// 不带信封的旧格式数据使用默认密钥和默认算法。解密失败时发出 EventDecryptFailure 事件
 func (sm *DefaultSecurityManager) DecryptBlock(ctx context.Context, blockID uint32, data []byte) ([]byte, error) {
+	plaintext, err := sm.decryptBlock(ctx, blockID, data)
+	if err != nil {
+		keyID := sm.GetDefaultKey()
+		if envelope, parseErr := ParseBlockEnvelope(data); parseErr == nil {
+			keyID = envelope.KeyID
+		}
+		sm.emitBlockFailure(EventDecryptFailure, keyID, blockID, err)
+	}
+	return plaintext, err
+}
+
+// decryptBlock 解密数据块
+func (sm *DefaultSecurityManager) decryptBlock(ctx context.Context, blockID uint32, data []byte) ([]byte, error) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
@@ -180,25 +350,69 @@ func (sm *DefaultSecurityManager) DecryptBlock(ctx context.Context, blockID uint
 		return data, nil
 	}
 
+	if IsBlockEnvelope(data) {
+		envelope, err := ParseBlockEnvelope(data)
+		if err != nil {
+			return nil, err
+		}
+		if envelope.BlockID != blockID {
+			return nil, fmt.Errorf("%w: envelope belongs to block %d, not %d", ErrInvalidEnvelope, envelope.BlockID, blockID)
+		}
+
+		opener, ok := sm.encryptionProvider.(blockCipher)
+		if !ok {
+			return nil, errors.New("encryption provider does not support block envelopes")
+		}
+		key, err := sm.keyManager.GetKeySecret(ctx, envelope.KeyID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get key %s: %w", envelope.KeyID, err)
+		}
+		defer key.Close()
+		return opener.openBlock(envelope, key.Bytes())
+	}
+
 	// 获取默认密钥
-	keyData, err := sm.keyManager.GetKey(ctx, sm.defaultKeyID)
+	key, err := sm.keyManager.GetKeySecret(ctx, sm.defaultKeyID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get default key: %w", err)
 	}
+	defer key.Close()
 
-	// 准备额外的关联数据（AAD）
-	associatedData := make([]byte, 4)
-	binary.BigEndian.PutUint32(associatedData, blockID)
+	// 旧格式数据记录了算法，默认算法改变后仍按原算法解密
+	algorithm := string(sm.config.DefaultAlgorithm)
+	if legacy, err := deserializeEncryptedData(data); err == nil && legacy.Algorithm != "" {
+		algorithm = legacy.Algorithm
+	}
+	return sm.encryptionProvider.Decrypt(ctx, algorithm, key.Bytes(), data, blockAAD(blockID))
+}
 
-	// 对数据进行解密
-	return sm.encryptionProvider.Decrypt(ctx, string(sm.config.DefaultAlgorithm), keyData, data, associatedData)
+// SetDefaultAlgorithm 设置新加密块使用的算法，已有的块仍按各自信封中的算法解密
+func (sm *DefaultSecurityManager) SetDefaultAlgorithm(algorithm EncryptionAlgorithm) error {
+	if _, err := sm.encryptionProvider.GetAlgorithmInfo(context.Background(), string(algorithm)); err != nil {
+		return err
+	}
+
+	sm.mu.Lock()
+	previous := sm.config.DefaultAlgorithm
+	sm.config.DefaultAlgorithm = algorithm
+	sm.mu.Unlock()
+
+	if previous != algorithm {
+		sm.record(AuditAlgorithmChange, string(algorithm), map[string]string{"previous": string(previous)})
+	}
+	return nil
 }
 
 // SetDefaultKey 设置默认密钥
 func (sm *DefaultSecurityManager) SetDefaultKey(keyID string) {
 	sm.mu.Lock()
-	defer sm.mu.Unlock()
+	previous := sm.defaultKeyID
 	sm.defaultKeyID = keyID
+	sm.mu.Unlock()
+
+	if previous != keyID {
+		sm.record(AuditKeySetDefault, keyID, map[string]string{"previous": previous})
+	}
 }
 
 // GetDefaultKey 获取默认密钥
@@ -219,10 +433,11 @@ func (sm *DefaultSecurityManager) EncryptWithKey(ctx context.Context, keyID stri
 	}
 
 	// 获取密钥
-	keyData, err := sm.keyManager.GetKey(ctx, keyID)
+	key, err := sm.keyManager.GetKeySecret(ctx, keyID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get key: %w", err)
 	}
+	defer key.Close()
 
 	// 使用提供的选项或默认算法
 	algorithm := string(sm.config.DefaultAlgorithm)
@@ -241,7 +456,7 @@ func (sm *DefaultSecurityManager) EncryptWithKey(ctx context.Context, keyID stri
 	}
 
 	// 对数据进行加密
-	return sm.encryptionProvider.Encrypt(ctx, algorithm, keyData, data, aad)
+	return sm.encryptionProvider.Encrypt(ctx, algorithm, key.Bytes(), data, aad)
 }
 
 // DecryptWithKey 使用指定密钥解密数据
@@ -255,10 +470,12 @@ func (sm *DefaultSecurityManager) DecryptWithKey(ctx context.Context, keyID stri
 	}
 
 	// 获取密钥
-	keyData, err := sm.keyManager.GetKey(ctx, keyID)
+	key, err := sm.keyManager.GetKeySecret(ctx, keyID)
 	if err != nil {
+		sm.events.emit(EventDecryptFailure, keyID, nil, err)
 		return nil, fmt.Errorf("failed to get key: %w", err)
 	}
+	defer key.Close()
 
 	// 使用提供的选项或默认算法
 	algorithm := string(sm.config.DefaultAlgorithm)
@@ -277,5 +494,211 @@ func (sm *DefaultSecurityManager) DecryptWithKey(ctx context.Context, keyID stri
 	}
 
 	// 对数据进行解密
-	return sm.encryptionProvider.Decrypt(ctx, algorithm, keyData, data, aad)
+	plaintext, err := sm.encryptionProvider.Decrypt(ctx, algorithm, key.Bytes(), data, aad)
+	if err != nil {
+		sm.events.emit(EventDecryptFailure, keyID, map[string]string{"algorithm": algorithm}, err)
+	}
+	return plaintext, err
+}
+
+// GetTrustStore 获取受信任的CA，可用 AddRoots 追加CA证书
+func (sm *DefaultSecurityManager) GetTrustStore() *TrustStore {
+	return sm.trustStore
+}
+
+// SignBlockWithCertificate 用密钥对签名数据块，签名中附带该密钥对导入的证书链。
+// 签名覆盖块ID和数据，不能用于其他块
+func (sm *DefaultSecurityManager) SignBlockWithCertificate(ctx context.Context, privateKeyID string, blockID uint32, data []byte) ([]byte, error) {
+	km, ok := sm.keyManager.(*DefaultKeyManager)
+	if !ok {
+		return nil, errors.New("key manager does not support certificates")
+	}
+
+	chain, err := km.GetCertificateChain(ctx, privateKeyID)
+	if err != nil {
+		return nil, err
+	}
+	algorithm, signer, err := sm.signingKey(ctx, privateKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := sm.signatureProvider.SignWithSigner(ctx, algorithm, signer, blockSignedContent(blockID, data))
+	if err != nil {
+		return nil, err
+	}
+	return attachCertificates(signature, chain)
+}
+
+// SignBlock 用密钥签名数据块，返回分离签名。对称密钥使用HMAC-SHA256；
+// 密钥对按类型选择签名算法，导入过证书时附带证书链。签名覆盖块ID和数据
+func (sm *DefaultSecurityManager) SignBlock(ctx context.Context, keyID string, blockID uint32, data []byte) ([]byte, error) {
+	km, ok := sm.keyManager.(*DefaultKeyManager)
+	if !ok {
+		return nil, errors.New("key manager does not support signing with stored keys")
+	}
+
+	entry, err := km.RetrieveKeyEntry(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if KeyType(entry.Metadata["type"]) == SymmetricKey {
+		defer wipe(entry.Key)
+		return sm.signatureProvider.Sign(ctx, string(HMAC_SHA256), entry.Key, blockSignedContent(blockID, data))
+	}
+
+	if _, err := km.GetCertificateChain(ctx, keyID); err == nil {
+		return sm.SignBlockWithCertificate(ctx, keyID, blockID, data)
+	}
+	algorithm, signer, err := sm.signingKey(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	return sm.signatureProvider.SignWithSigner(ctx, algorithm, signer, blockSignedContent(blockID, data))
+}
+
+// VerifyBlock 用签名时使用的密钥验证数据块的分离签名，验证不通过时发出 EventSignatureInvalid 事件
+func (sm *DefaultSecurityManager) VerifyBlock(ctx context.Context, keyID string, blockID uint32, data []byte, signature []byte) (bool, error) {
+	valid, err := sm.verifyBlock(ctx, keyID, blockID, data, signature)
+	if err != nil || !valid {
+		sm.emitBlockFailure(EventSignatureInvalid, keyID, blockID, err)
+	}
+	return valid, err
+}
+
+// verifyBlock 验证数据块的分离签名
+func (sm *DefaultSecurityManager) verifyBlock(ctx context.Context, keyID string, blockID uint32, data []byte, signature []byte) (bool, error) {
+	km, ok := sm.keyManager.(*DefaultKeyManager)
+	if !ok {
+		return false, errors.New("key manager does not support signing with stored keys")
+	}
+
+	entry, err := km.RetrieveKeyEntry(ctx, keyID)
+	if err != nil {
+		return false, err
+	}
+	if KeyType(entry.Metadata["type"]) == SymmetricKey {
+		defer wipe(entry.Key)
+		return sm.signatureProvider.Verify(ctx, string(HMAC_SHA256), entry.Key, blockSignedContent(blockID, data), signature)
+	}
+
+	algorithm, _, err := sm.signingKey(ctx, keyID)
+	if err != nil {
+		return false, err
+	}
+	publicKeyID, err := km.GetPublicKey(ctx, keyID)
+	if err != nil {
+		return false, err
+	}
+	publicKey, err := km.GetKey(ctx, publicKeyID)
+	if err != nil {
+		return false, err
+	}
+	return sm.signatureProvider.Verify(ctx, algorithm, publicKey, blockSignedContent(blockID, data), signature)
+}
+
+// VerifyBlockSignature 验证数据块签名，证书链必须能追溯到受信任的CA，返回签名者证书。
+// 验证不通过时发出 EventSignatureInvalid 事件
+func (sm *DefaultSecurityManager) VerifyBlockSignature(ctx context.Context, blockID uint32, data []byte, signature []byte) (*x509.Certificate, error) {
+	signer, err := sm.signatureProvider.VerifyWithTrust(ctx, sm.trustStore, blockSignedContent(blockID, data), signature)
+	if err != nil {
+		sm.emitBlockFailure(EventSignatureInvalid, "", blockID, err)
+	}
+	return signer, err
+}
+
+// SetAuditRecorder 设置审计记录器，同时用于密钥管理器
+func (sm *DefaultSecurityManager) SetAuditRecorder(recorder AuditRecorder) {
+	sm.mu.Lock()
+	sm.audit = recorder
+	sm.mu.Unlock()
+
+	if km, ok := sm.keyManager.(*DefaultKeyManager); ok {
+		km.SetAuditRecorder(recorder)
+	}
+}
+
+// AuditRecorder 获取审计记录器，未设置时返回nil
+func (sm *DefaultSecurityManager) AuditRecorder() AuditRecorder {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.audit
+}
+
+// OpenAuditLog 打开审计日志并设为审计记录器，检查点用密钥对 privateKeyID 签名。
+// privateKeyID 为空时只维护哈希链。调用方负责关闭返回的日志
+func (sm *DefaultSecurityManager) OpenAuditLog(ctx context.Context, path string, privateKeyID string, options AuditLogOptions) (*AuditLog, error) {
+	if privateKeyID != "" {
+		algorithm, signer, err := sm.signingKey(ctx, privateKeyID)
+		if err != nil {
+			return nil, err
+		}
+		options.Signer = sm.signatureProvider
+		options.Algorithm = algorithm
+		options.SigningKey, err = sm.keyManager.GetKey(ctx, privateKeyID)
+		if errors.Is(err, ErrKeyNotExportable) {
+			// 硬件密钥由设备签名，SigningKey只作为占位
+			options.Signer = &keySignatureProvider{DefaultSignatureProvider: sm.signatureProvider, signer: signer}
+			options.SigningKey, err = []byte(privateKeyID), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	auditLog, err := OpenAuditLog(path, options)
+	if err != nil {
+		return nil, err
+	}
+	sm.SetAuditRecorder(auditLog)
+	return auditLog, nil
+}
+
+// VerifyAuditLog 验证由密钥对 privateKeyID 签名的审计日志
+func (sm *DefaultSecurityManager) VerifyAuditLog(ctx context.Context, path string, privateKeyID string) (*AuditReport, error) {
+	algorithm, _, err := sm.signingKey(ctx, privateKeyID)
+	if err != nil {
+		return nil, err
+	}
+	publicKeyID, err := sm.keyManager.GetPublicKey(ctx, privateKeyID)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, err := sm.keyManager.GetKey(ctx, publicKeyID)
+	if err != nil {
+		return nil, err
+	}
+	return VerifyAuditLog(ctx, path, sm.signatureProvider, algorithm, publicKey)
+}
+
+// signingKey 按私钥类型确定签名算法，返回算法和签名者（硬件密钥由设备签名）
+func (sm *DefaultSecurityManager) signingKey(ctx context.Context, privateKeyID string) (string, crypto.Signer, error) {
+	km, ok := sm.keyManager.(*DefaultKeyManager)
+	if !ok {
+		return "", nil, errors.New("key manager does not support signing with stored key pairs")
+	}
+	signer, err := km.privateKeySigner(ctx, privateKeyID)
+	if err != nil {
+		return "", nil, err
+	}
+	algorithm, err := defaultSignatureAlgorithm(signer)
+	if err != nil {
+		return "", nil, err
+	}
+	return string(algorithm), signer, nil
+}
+
+// record 记录审计事件并发给事件回调，审计写入失败不影响操作结果
+func (sm *DefaultSecurityManager) record(action, subject string, details map[string]string) {
+	if audit := sm.AuditRecorder(); audit != nil {
+		audit.Append(action, subject, details)
+	}
+	sm.events.emit(action, subject, details, nil)
+}
+
+// blockSignedContent 块签名覆盖的内容：块ID（大端序）+ 数据
+func blockSignedContent(blockID uint32, data []byte) []byte {
+	content := make([]byte, 0, 4+len(data))
+	content = append(content, blockAAD(blockID)...)
+	return append(content, data...)
 }
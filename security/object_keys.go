@@ -0,0 +1,124 @@
+package security
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// objectMetadata 对象数据密钥所属对象（或租户）的元数据键
+const objectMetadata = "object"
+
+// ObjectKey 返回对象（或租户）的数据密钥ID，没有时生成一个256位对称密钥。
+// 对象的数据密钥在元数据中记录对象ID，重新打开密钥库后仍能找到；轮换过的旧密钥不再用于加密
+func (sm *DefaultSecurityManager) ObjectKey(ctx context.Context, objectID string) (string, error) {
+	if objectID == "" {
+		return "", invalidArgument("objectID cannot be empty")
+	}
+
+	sm.objectMu.Lock()
+	defer sm.objectMu.Unlock()
+
+	if keyID, ok := sm.objectKeys[objectID]; ok {
+		return keyID, nil
+	}
+	keys, err := sm.objectKeyEntries(ctx, objectID)
+	if err != nil {
+		return "", err
+	}
+	for _, key := range keys {
+		if key.Metadata[rotatedToMetadata] == "" {
+			sm.cacheObjectKey(objectID, key.ID)
+			return key.ID, nil
+		}
+	}
+
+	keyID, err := sm.keyManager.GenerateKey(ctx, SymmetricKey, &KeyOptions{
+		Type:     SymmetricKey,
+		Size:     256,
+		Usage:    []KeyUsage{EncryptionUsage},
+		Metadata: map[string]string{objectMetadata: objectID},
+	})
+	if err != nil {
+		return "", err
+	}
+	sm.cacheObjectKey(objectID, keyID)
+	return keyID, nil
+}
+
+// EncryptObjectBlock 用对象的数据密钥加密数据块，输出加密块信封。
+// 信封记录了密钥ID，解密使用 DecryptBlock
+func (sm *DefaultSecurityManager) EncryptObjectBlock(ctx context.Context, objectID string, blockID uint32, data []byte) ([]byte, error) {
+	keyID, err := sm.ObjectKey(ctx, objectID)
+	if err != nil {
+		return nil, err
+	}
+	return sm.EncryptBlockWithKey(ctx, keyID, blockID, data)
+}
+
+// CryptoErase 销毁对象的全部数据密钥（包括轮换过的旧密钥），用这些密钥加密的块不需要重写即无法恢复，
+// 解密时返回 ErrKeyNotFound。销毁记入审计日志（AuditObjectErase）。对象没有数据密钥时返回 ErrKeyNotFound。
+// 之后再为该对象加密会生成新的数据密钥
+func (sm *DefaultSecurityManager) CryptoErase(ctx context.Context, objectID string) error {
+	if objectID == "" {
+		return invalidArgument("objectID cannot be empty")
+	}
+
+	sm.objectMu.Lock()
+	defer sm.objectMu.Unlock()
+
+	keys, err := sm.objectKeyEntries(ctx, objectID)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return &KeyError{KeyID: objectID, Err: fmt.Errorf("%w: object has no data key", ErrKeyNotFound)}
+	}
+
+	delete(sm.objectKeys, objectID)
+	erased := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if err := sm.keyManager.DeleteKey(ctx, key.ID); err != nil {
+			sm.recordErase(objectID, erased, err)
+			return fmt.Errorf("failed to erase key %s: %w", key.ID, err)
+		}
+		erased = append(erased, key.ID)
+	}
+	sm.recordErase(objectID, erased, nil)
+	return nil
+}
+
+// objectKeyEntries 列出对象的全部数据密钥，按ID排序（调用方持有objectMu）
+func (sm *DefaultSecurityManager) objectKeyEntries(ctx context.Context, objectID string) ([]KeyInfo, error) {
+	list, err := sm.keyManager.ListKeyEntries(ctx, &KeyFilter{Types: []KeyType{SymmetricKey}})
+	if err != nil {
+		return nil, err
+	}
+	var keys []KeyInfo
+	for _, key := range list.Keys {
+		if key.Metadata[objectMetadata] == objectID {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys, nil
+}
+
+// cacheObjectKey 记住对象当前的数据密钥（调用方持有objectMu）
+func (sm *DefaultSecurityManager) cacheObjectKey(objectID, keyID string) {
+	if sm.objectKeys == nil {
+		sm.objectKeys = make(map[string]string)
+	}
+	sm.objectKeys[objectID] = keyID
+}
+
+// recordErase 记录对象数据密钥的销毁结果，部分密钥删除失败时记录已销毁的密钥和错误
+func (sm *DefaultSecurityManager) recordErase(objectID string, erased []string, err error) {
+	details := map[string]string{"keys": strings.Join(erased, ","), "result": "ok"}
+	if err != nil {
+		details["result"] = "failed"
+		details["error"] = err.Error()
+	}
+	sm.record(AuditObjectErase, objectID, details)
+}
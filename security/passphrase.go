@@ -0,0 +1,294 @@
+package security
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrKeyStoreLocked 密钥库已锁定，需要先用口令解锁
+	ErrKeyStoreLocked = errors.New("key store is locked")
+
+	// ErrInvalidPassphrase 口令错误
+	ErrInvalidPassphrase = errors.New("invalid passphrase")
+)
+
+// KeySourcePassphrase 口令保护的本地密钥库
+const KeySourcePassphrase = "passphrase"
+
+// keyStoreParamsFile 密钥库目录中保存口令派生参数的文件，文件名不是十六进制，
+// 不会被 FileSecureStorage.List 当作密钥
+const keyStoreParamsFile = "keystore.params"
+
+// keyStoreCheck 用派生密钥加密的校验串，用于在解锁时验证口令
+const keyStoreCheck = "fragmenta-keystore"
+
+// 默认 scrypt 参数，派生一次约需32MB内存
+const (
+	defaultScryptN = 1 << 15
+	defaultScryptR = 8
+	defaultScryptP = 1
+)
+
+// keyStoreParams 口令派生参数
+type keyStoreParams struct {
+	// KDF 密钥派生函数
+	KDF string `json:"kdf"`
+
+	// N、R、P scrypt参数
+	N int `json:"n"`
+	R int `json:"r"`
+	P int `json:"p"`
+
+	// Salt 盐
+	Salt []byte `json:"salt"`
+
+	// Check 校验串密文（随机数+密文）
+	Check []byte `json:"check"`
+}
+
+// PassphraseKeyProvider 用口令派生的密钥包装数据密钥。派生密钥只保存在内存中，
+// 锁定或超过空闲时间后清除
+type PassphraseKeyProvider struct {
+	// 参数文件路径
+	paramsPath string
+
+	// 空闲多久后自动锁定，0表示不自动锁定
+	relockAfter time.Duration
+
+	// 派生密钥，锁定时为nil
+	kek []byte
+
+	// 自动锁定计时器
+	timer *time.Timer
+
+	// 锁定时调用的回调，用于清除解密缓存
+	lockHooks []func()
+
+	// 锁
+	mu sync.Mutex
+}
+
+// NewPassphraseKeyProvider 创建口令密钥提供者，参数文件保存在密钥库目录dir中
+func NewPassphraseKeyProvider(dir string, relockAfter time.Duration) *PassphraseKeyProvider {
+	return &PassphraseKeyProvider{
+		paramsPath:  filepath.Join(dir, keyStoreParamsFile),
+		relockAfter: relockAfter,
+	}
+}
+
+// Name 提供者名称
+func (p *PassphraseKeyProvider) Name() string {
+	return KeySourcePassphrase
+}
+
+// Initialized 返回是否已设置过口令
+func (p *PassphraseKeyProvider) Initialized() bool {
+	_, err := os.Stat(p.paramsPath)
+	return err == nil
+}
+
+// Unlock 用口令解锁。首次解锁时生成盐并以该口令初始化密钥库
+func (p *PassphraseKeyProvider) Unlock(passphrase []byte) error {
+	if len(passphrase) == 0 {
+		return fmt.Errorf("%w: passphrase cannot be empty", ErrInvalidPassphrase)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	params, err := p.loadParams()
+	if errors.Is(err, os.ErrNotExist) {
+		return p.initLocked(passphrase)
+	}
+	if err != nil {
+		return err
+	}
+
+	kek, err := scryptKey(passphrase, params.Salt, params.N, params.R, params.P, 32)
+	if err != nil {
+		return err
+	}
+	aead, err := newAESGCM(kek)
+	if err != nil {
+		return err
+	}
+	if len(params.Check) < aead.NonceSize() {
+		return errors.New("invalid key store params: check too short")
+	}
+	nonce, sealed := params.Check[:aead.NonceSize()], params.Check[aead.NonceSize():]
+	if check, err := aead.Open(nil, nonce, sealed, nil); err != nil || string(check) != keyStoreCheck {
+		return ErrInvalidPassphrase
+	}
+
+	p.setKeyLocked(kek)
+	return nil
+}
+
+// initLocked 生成参数文件并解锁，调用方需持有锁
+func (p *PassphraseKeyProvider) initLocked(passphrase []byte) error {
+	params := keyStoreParams{KDF: "scrypt", N: defaultScryptN, R: defaultScryptR, P: defaultScryptP, Salt: make([]byte, 16)}
+	if _, err := io.ReadFull(rand.Reader, params.Salt); err != nil {
+		return fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	kek, err := scryptKey(passphrase, params.Salt, params.N, params.R, params.P, 32)
+	if err != nil {
+		return err
+	}
+	aead, err := newAESGCM(kek)
+	if err != nil {
+		return err
+	}
+	nonce, err := randomNonce(aead.NonceSize())
+	if err != nil {
+		return err
+	}
+	params.Check = aead.Seal(nonce, nonce, []byte(keyStoreCheck), nil)
+
+	data, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return err
+	}
+	tempPath := p.paramsPath + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write key store params: %w", err)
+	}
+	if err := os.Rename(tempPath, p.paramsPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write key store params: %w", err)
+	}
+
+	p.setKeyLocked(kek)
+	return nil
+}
+
+// loadParams 读取参数文件
+func (p *PassphraseKeyProvider) loadParams() (*keyStoreParams, error) {
+	data, err := os.ReadFile(p.paramsPath)
+	if err != nil {
+		return nil, err
+	}
+	var params keyStoreParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return nil, fmt.Errorf("invalid key store params: %w", err)
+	}
+	if params.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported key derivation function: %s", params.KDF)
+	}
+	return &params, nil
+}
+
+// setKeyLocked 保存派生密钥并启动自动锁定计时器，调用方需持有锁
+func (p *PassphraseKeyProvider) setKeyLocked(kek []byte) {
+	wipe(p.kek)
+	p.kek = kek
+	if p.relockAfter > 0 {
+		if p.timer != nil {
+			p.timer.Stop()
+		}
+		p.timer = time.AfterFunc(p.relockAfter, p.Lock)
+	}
+}
+
+// Lock 锁定并清除内存中的派生密钥
+func (p *PassphraseKeyProvider) Lock() {
+	p.mu.Lock()
+	wipe(p.kek)
+	p.kek = nil
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	hooks := p.lockHooks
+	p.mu.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+}
+
+// IsLocked 返回是否已锁定
+func (p *PassphraseKeyProvider) IsLocked() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.kek == nil
+}
+
+// touch 检查是否已解锁并重置空闲计时
+func (p *PassphraseKeyProvider) touch() error {
+	_, err := p.key()
+	return err
+}
+
+// onLock 注册锁定回调
+func (p *PassphraseKeyProvider) onLock(hook func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lockHooks = append(p.lockHooks, hook)
+}
+
+// key 返回派生密钥的副本并重置空闲计时
+func (p *PassphraseKeyProvider) key() ([]byte, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.kek == nil {
+		return nil, ErrKeyStoreLocked
+	}
+	if p.timer != nil {
+		p.timer.Reset(p.relockAfter)
+	}
+	return append([]byte(nil), p.kek...), nil
+}
+
+// WrapKey 用派生密钥加密数据密钥，输出随机数+密文
+func (p *PassphraseKeyProvider) WrapKey(ctx context.Context, plaintext []byte) ([]byte, error) {
+	kek, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(kek)
+
+	aead, err := newAESGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomNonce(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// UnwrapKey 用派生密钥解密数据密钥
+func (p *PassphraseKeyProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	kek, err := p.key()
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(kek)
+
+	aead, err := newAESGCM(kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped key too short")
+	}
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], nil)
+}
+
+// lockableProvider 可以锁定的密钥提供者
+type lockableProvider interface {
+	touch() error
+	onLock(hook func())
+}
@@ -0,0 +1,42 @@
+package security
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrPKCS11Unavailable 没有以pkcs11构建标签编译，不能访问PKCS#11设备
+var ErrPKCS11Unavailable = errors.New("pkcs11 support is not compiled in")
+
+// PKCS11Config PKCS#11设备配置
+type PKCS11Config struct {
+	// Path PKCS#11模块（厂商提供的动态库）的路径
+	Path string
+
+	// TokenLabel 设备标签，用于选择槽位中的设备
+	TokenLabel string
+
+	// Pin 用户PIN
+	Pin string
+}
+
+// PKCS11Token 通过PKCS#11访问的硬件密钥设备，不再使用时应关闭以释放会话
+type PKCS11Token interface {
+	HardwareToken
+	io.Closer
+}
+
+// NewPKCS11Token 打开PKCS#11设备。设备通过cgo加载厂商模块，需要以pkcs11构建标签编译：
+//
+//	go build -tags pkcs11
+//
+// 支持RSA和ECDSA（P-256、P-384、P-521）密钥，不支持Ed25519
+func NewPKCS11Token(config PKCS11Config) (PKCS11Token, error) {
+	if config.Path == "" {
+		return nil, invalidArgument("pkcs11 module path cannot be empty")
+	}
+	if config.TokenLabel == "" {
+		return nil, invalidArgument("pkcs11 token label cannot be empty")
+	}
+	return openPKCS11Token(config)
+}
@@ -0,0 +1,96 @@
+//go:build pkcs11
+
+package security
+
+import (
+	"context"
+	"crypto"
+	"crypto/elliptic"
+	"fmt"
+
+	"github.com/ThalesIgnite/crypto11"
+)
+
+// crypto11Token 基于crypto11的PKCS#11设备。密钥对的CKA_ID和CKA_LABEL都使用密钥标签
+type crypto11Token struct {
+	ctx  *crypto11.Context
+	name string
+}
+
+// openPKCS11Token 加载PKCS#11模块并登录设备
+func openPKCS11Token(config PKCS11Config) (PKCS11Token, error) {
+	ctx, err := crypto11.Configure(&crypto11.Config{
+		Path:       config.Path,
+		TokenLabel: config.TokenLabel,
+		Pin:        config.Pin,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open pkcs11 token %s: %w", config.TokenLabel, err)
+	}
+	return &crypto11Token{ctx: ctx, name: "pkcs11:" + config.TokenLabel}, nil
+}
+
+// Name 设备名称
+func (t *crypto11Token) Name() string {
+	return t.name
+}
+
+// GenerateKey 在设备内生成密钥对
+func (t *crypto11Token) GenerateKey(ctx context.Context, label string, keyType KeyType, size int) (crypto.Signer, error) {
+	id := []byte(label)
+	switch keyType {
+	case RSAPrivateKey:
+		return t.ctx.GenerateRSAKeyPairWithLabel(id, id, size)
+	case ECPrivateKey:
+		var curve elliptic.Curve
+		switch size {
+		case 256:
+			curve = elliptic.P256()
+		case 384:
+			curve = elliptic.P384()
+		case 521:
+			curve = elliptic.P521()
+		default:
+			return nil, invalidArgument(fmt.Sprintf("unsupported EC key size %d", size))
+		}
+		return t.ctx.GenerateECDSAKeyPairWithLabel(id, id, curve)
+	default:
+		return nil, invalidArgument(fmt.Sprintf("key type %s is not supported by pkcs11 token", keyType))
+	}
+}
+
+// FindKey 按标签查找设备内的密钥对
+func (t *crypto11Token) FindKey(ctx context.Context, label string) (crypto.Signer, error) {
+	signer, err := t.find(label)
+	if err != nil {
+		return nil, err
+	}
+	return signer, nil
+}
+
+// DeleteKey 删除设备内的密钥对
+func (t *crypto11Token) DeleteKey(ctx context.Context, label string) error {
+	signer, err := t.find(label)
+	if err != nil {
+		return err
+	}
+	return signer.Delete()
+}
+
+// Close 关闭设备会话
+func (t *crypto11Token) Close() error {
+	return t.ctx.Close()
+}
+
+// find 按标签查找密钥对，找不到时返回 ErrKeyNotFound
+func (t *crypto11Token) find(label string) (crypto11.Signer, error) {
+	id := []byte(label)
+	signer, err := t.ctx.FindKeyPair(id, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find key %s on %s: %w", label, t.name, err)
+	}
+	if signer == nil {
+		return nil, fmt.Errorf("%w: %s on %s", ErrKeyNotFound, label, t.name)
+	}
+	return signer, nil
+}
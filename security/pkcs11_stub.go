@@ -0,0 +1,10 @@
+//go:build !pkcs11
+
+package security
+
+import "fmt"
+
+// openPKCS11Token 未启用pkcs11构建标签时不能打开设备
+func openPKCS11Token(config PKCS11Config) (PKCS11Token, error) {
+	return nil, fmt.Errorf("%w: 需要以-tags pkcs11编译", ErrPKCS11Unavailable)
+}
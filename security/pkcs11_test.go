@@ -0,0 +1,71 @@
+//go:build pkcs11
+
+package security
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+)
+
+// TestPKCS11Token 在真实的PKCS#11设备（如SoftHSM）上测试硬件密钥，
+// 设备由环境变量 FRAGMENTA_PKCS11_MODULE、FRAGMENTA_PKCS11_TOKEN、FRAGMENTA_PKCS11_PIN 指定
+func TestPKCS11Token(t *testing.T) {
+	module := os.Getenv("FRAGMENTA_PKCS11_MODULE")
+	if module == "" {
+		t.Skip("没有设置FRAGMENTA_PKCS11_MODULE")
+	}
+	token, err := NewPKCS11Token(PKCS11Config{
+		Path:       module,
+		TokenLabel: os.Getenv("FRAGMENTA_PKCS11_TOKEN"),
+		Pin:        os.Getenv("FRAGMENTA_PKCS11_PIN"),
+	})
+	if err != nil {
+		t.Fatalf("打开设备失败: %v", err)
+	}
+	defer token.Close()
+
+	tempDir, securityManager := setupTestEnvironment(t)
+	defer teardownTestEnvironment(tempDir, securityManager)
+	ctx := context.Background()
+	keyManager := securityManager.GetKeyManager().(*DefaultKeyManager)
+	keyManager.SetHardwareToken(token)
+
+	data := []byte("archived block")
+	for _, keyType := range []KeyType{ECPrivateKey, RSAPrivateKey} {
+		pair, err := keyManager.GenerateHardwareKeyPair(ctx, keyType, nil)
+		if err != nil {
+			t.Fatalf("在设备中生成%s密钥对失败: %v", keyType, err)
+		}
+		signature, err := securityManager.SignBlock(ctx, pair.PrivateKeyID, 5, data)
+		if err != nil {
+			t.Fatalf("%s硬件密钥签名失败: %v", keyType, err)
+		}
+		if valid, err := securityManager.VerifyBlock(ctx, pair.PrivateKeyID, 5, data, signature); err != nil || !valid {
+			t.Errorf("%s硬件密钥签名验证失败: %v, %v", keyType, valid, err)
+		}
+
+		if keyType == RSAPrivateKey {
+			provider, err := NewHardwareKeyProvider(ctx, token, pair.PrivateKeyID)
+			if err != nil {
+				t.Fatalf("创建硬件密钥提供者失败: %v", err)
+			}
+			wrapped, err := provider.WrapKey(ctx, data)
+			if err != nil {
+				t.Fatalf("包装密钥失败: %v", err)
+			}
+			if unwrapped, err := provider.UnwrapKey(ctx, wrapped); err != nil || !bytes.Equal(unwrapped, data) {
+				t.Errorf("解包密钥失败: %v", err)
+			}
+		}
+
+		if err := keyManager.DeleteKey(ctx, pair.PrivateKeyID); err != nil {
+			t.Fatalf("删除硬件密钥失败: %v", err)
+		}
+		if _, err := token.FindKey(ctx, pair.PrivateKeyID); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("删除密钥后设备中的私钥应被删除: %v", err)
+		}
+	}
+}
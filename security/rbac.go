@@ -2,10 +2,11 @@ package security
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/bpfs/fragmenta/clock"
 )
 
 // Role 角色定义
@@ -87,6 +88,9 @@ type DefaultRBACManager struct {
 
 	// 针对subject-role映射的互斥锁
 	subjectRoleMutex sync.RWMutex
+
+	// 时钟，用于角色的创建和更新时间，为nil时使用系统时钟
+	clock clock.Clock
 }
 
 // NewDefaultRBACManager 创建默认的RBAC管理器
@@ -97,13 +101,21 @@ func NewDefaultRBACManager() *DefaultRBACManager {
 	}
 }
 
+// SetClock 设置时钟，为nil时使用系统时钟
+func (m *DefaultRBACManager) SetClock(c clock.Clock) {
+	m.roleMutex.Lock()
+	defer m.roleMutex.Unlock()
+
+	m.clock = c
+}
+
 // CreateRole 创建角色
 func (m *DefaultRBACManager) CreateRole(ctx context.Context, role *Role) error {
 	if role == nil {
-		return errors.New("role cannot be nil")
+		return invalidArgument("role cannot be nil")
 	}
 	if role.ID == "" {
-		return errors.New("role ID cannot be empty")
+		return invalidArgument("role ID cannot be empty")
 	}
 
 	m.roleMutex.Lock()
@@ -115,7 +127,7 @@ func (m *DefaultRBACManager) CreateRole(ctx context.Context, role *Role) error {
 	}
 
 	// 设置创建和更新时间
-	now := time.Now()
+	now := clock.OrSystem(m.clock).Now()
 	role.CreatedAt = now
 	role.UpdatedAt = now
 
@@ -127,10 +139,10 @@ func (m *DefaultRBACManager) CreateRole(ctx context.Context, role *Role) error {
 // UpdateRole 更新角色
 func (m *DefaultRBACManager) UpdateRole(ctx context.Context, role *Role) error {
 	if role == nil {
-		return errors.New("role cannot be nil")
+		return invalidArgument("role cannot be nil")
 	}
 	if role.ID == "" {
-		return errors.New("role ID cannot be empty")
+		return invalidArgument("role ID cannot be empty")
 	}
 
 	m.roleMutex.Lock()
@@ -145,7 +157,7 @@ func (m *DefaultRBACManager) UpdateRole(ctx context.Context, role *Role) error {
 	// 保留创建时间
 	role.CreatedAt = existingRole.CreatedAt
 	// 更新修改时间
-	role.UpdatedAt = time.Now()
+	role.UpdatedAt = clock.OrSystem(m.clock).Now()
 
 	// 更新角色
 	m.roles[role.ID] = role
@@ -155,7 +167,7 @@ func (m *DefaultRBACManager) UpdateRole(ctx context.Context, role *Role) error {
 // DeleteRole 删除角色
 func (m *DefaultRBACManager) DeleteRole(ctx context.Context, roleID string) error {
 	if roleID == "" {
-		return errors.New("role ID cannot be empty")
+		return invalidArgument("role ID cannot be empty")
 	}
 
 	m.roleMutex.Lock()
@@ -189,7 +201,7 @@ func (m *DefaultRBACManager) DeleteRole(ctx context.Context, roleID string) erro
 // GetRole 获取角色
 func (m *DefaultRBACManager) GetRole(ctx context.Context, roleID string) (*Role, error) {
 	if roleID == "" {
-		return nil, errors.New("role ID cannot be empty")
+		return nil, invalidArgument("role ID cannot be empty")
 	}
 
 	m.roleMutex.RLock()
@@ -221,10 +233,10 @@ func (m *DefaultRBACManager) ListRoles(ctx context.Context) ([]*Role, error) {
 // AddRoleToSubject 为主体分配角色
 func (m *DefaultRBACManager) AddRoleToSubject(ctx context.Context, subjectID string, roleID string) error {
 	if subjectID == "" {
-		return errors.New("subject ID cannot be empty")
+		return invalidArgument("subject ID cannot be empty")
 	}
 	if roleID == "" {
-		return errors.New("role ID cannot be empty")
+		return invalidArgument("role ID cannot be empty")
 	}
 
 	// 验证角色是否存在
@@ -261,10 +273,10 @@ func (m *DefaultRBACManager) AddRoleToSubject(ctx context.Context, subjectID str
 // RemoveRoleFromSubject 移除主体的角色
 func (m *DefaultRBACManager) RemoveRoleFromSubject(ctx context.Context, subjectID string, roleID string) error {
 	if subjectID == "" {
-		return errors.New("subject ID cannot be empty")
+		return invalidArgument("subject ID cannot be empty")
 	}
 	if roleID == "" {
-		return errors.New("role ID cannot be empty")
+		return invalidArgument("role ID cannot be empty")
 	}
 
 	m.subjectRoleMutex.Lock()
@@ -304,7 +316,7 @@ func (m *DefaultRBACManager) RemoveRoleFromSubject(ctx context.Context, subjectI
 // GetSubjectRoles 获取主体的所有角色
 func (m *DefaultRBACManager) GetSubjectRoles(ctx context.Context, subjectID string) ([]string, error) {
 	if subjectID == "" {
-		return nil, errors.New("subject ID cannot be empty")
+		return nil, invalidArgument("subject ID cannot be empty")
 	}
 
 	m.subjectRoleMutex.RLock()
@@ -359,7 +371,7 @@ func (m *DefaultRBACManager) collectRoles(roleID string, result map[string]bool)
 // CheckPermission 检查主体是否拥有指定权限
 func (m *DefaultRBACManager) CheckPermission(ctx context.Context, subjectID string, resource Resource, operation Operation) (bool, error) {
 	if subjectID == "" {
-		return false, errors.New("subject ID cannot be empty")
+		return false, invalidArgument("subject ID cannot be empty")
 	}
 
 	// 获取主体的所有角色（包括继承关系）
@@ -450,6 +462,10 @@ func (r *Role) AddParentRole(parentRoleID string) {
 type AccessControlManager struct {
 	aclManager  ACLManager
 	rbacManager RBACManager
+
+	// 审计记录器，记录被拒绝的访问
+	audit AuditRecorder
+	mu    sync.RWMutex
 }
 
 // NewAccessControlManager 创建访问控制管理器
@@ -460,6 +476,16 @@ func NewAccessControlManager() *AccessControlManager {
 	}
 }
 
+// SetClock 设置ACL和RBAC管理器使用的时钟，为nil时使用系统时钟
+func (m *AccessControlManager) SetClock(c clock.Clock) {
+	if acl, ok := m.aclManager.(*DefaultACLManager); ok {
+		acl.SetClock(c)
+	}
+	if rbac, ok := m.rbacManager.(*DefaultRBACManager); ok {
+		rbac.SetClock(c)
+	}
+}
+
 // GetACLManager 获取ACL管理器
 func (m *AccessControlManager) GetACLManager() ACLManager {
 	return m.aclManager
@@ -471,15 +497,24 @@ func (m *AccessControlManager) GetRBACManager() RBACManager {
 }
 
 // CheckAccess 检查访问权限
-// 同时使用ACL和RBAC进行检查
+// 同时使用ACL和RBAC进行检查，ACL中明确的拒绝条目优先于角色权限
 func (m *AccessControlManager) CheckAccess(ctx context.Context, subject Subject, resource Resource, operation Operation) (bool, error) {
 	// 首先检查ACL
-	allowed, err := m.aclManager.CheckAccess(ctx, subject, resource, operation)
-	if err != nil {
-		return false, err
-	}
-	if allowed {
-		return true, nil // ACL允许访问
+	if acl, ok := m.aclManager.(*DefaultACLManager); ok {
+		switch acl.decide(subject, resource, operation) {
+		case DenyPolicy:
+			return false, nil // ACL明确拒绝访问
+		case AllowPolicy:
+			return true, nil // ACL允许访问
+		}
+	} else {
+		allowed, err := m.aclManager.CheckAccess(ctx, subject, resource, operation)
+		if err != nil {
+			return false, err
+		}
+		if allowed {
+			return true, nil // ACL允许访问
+		}
 	}
 
 	// 如果ACL未明确允许，检查RBAC权限
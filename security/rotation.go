@@ -0,0 +1,183 @@
+package security
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+)
+
+// 轮换策略和轮换状态的元数据键
+const (
+	// rotationIntervalMetadata 轮换间隔（秒），轮换出的新密钥沿用
+	rotationIntervalMetadata = "rotation_interval"
+
+	// autoRotateMetadata 是否由轮换调度自动轮换
+	autoRotateMetadata = "auto_rotate"
+
+	// rotatedToMetadata 已轮换的密钥记录继任密钥的ID
+	rotatedToMetadata = "rotated_to"
+)
+
+// RotationHook 密钥被自动轮换后调用，用于把旧密钥加密的数据用新密钥重新加密。
+// 回调在轮换调度的后台协程中同步调用，ctx在 Shutdown 时取消
+type RotationHook func(ctx context.Context, oldKeyID, newKeyID string) error
+
+// RotationResult 一个密钥的自动轮换结果
+type RotationResult struct {
+	// OldKeyID 被轮换的密钥
+	OldKeyID string
+
+	// NewKeyID 新密钥，轮换失败时为空
+	NewKeyID string
+
+	// Err 轮换失败的原因
+	Err error
+
+	// HookErrors 重新加密回调返回的错误，新密钥已经生效
+	HookErrors []error
+}
+
+// AddRotationHook 注册自动轮换回调，返回注销函数
+func (sm *DefaultSecurityManager) AddRotationHook(hook RotationHook) (remove func()) {
+	return sm.rotationHooks.add(hook)
+}
+
+// RotateDueKeys 轮换所有临近过期、轮换策略为自动轮换（RotationPolicy.AutoRotate）的对称密钥。
+// 默认密钥被轮换时新密钥成为默认密钥；随后依次调用轮换回调重新加密数据。
+// 每个密钥的结果记入审计日志（AuditKeyAutoRotate）并返回。轮换调度定期调用，也可以手动调用
+func (sm *DefaultSecurityManager) RotateDueKeys(ctx context.Context) ([]RotationResult, error) {
+	list, err := sm.keyManager.ListKeyEntries(ctx, &KeyFilter{Types: []KeyType{SymmetricKey}})
+	if err != nil {
+		return nil, err
+	}
+
+	var results []RotationResult
+	now := clock.OrSystem(sm.config.Clock).Now()
+	for i := range list.Keys {
+		key := &list.Keys[i]
+		if !rotationDue(key, now, sm.config.RotationLeadTime) {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return results, err
+		}
+
+		result := RotationResult{OldKeyID: key.ID}
+		result.NewKeyID, result.Err = sm.keyManager.RotateKey(ctx, key.ID, nil)
+		if result.Err == nil {
+			if sm.GetDefaultKey() == key.ID {
+				sm.SetDefaultKey(result.NewKeyID)
+			}
+			for _, hook := range sm.rotationHooks.snapshot() {
+				if err := hook(ctx, key.ID, result.NewKeyID); err != nil {
+					result.HookErrors = append(result.HookErrors, err)
+				}
+			}
+		}
+		sm.recordRotation(&result)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// recordRotation 记录自动轮换的结果
+func (sm *DefaultSecurityManager) recordRotation(result *RotationResult) {
+	details := map[string]string{"result": "ok"}
+	switch {
+	case result.Err != nil:
+		details["result"] = "failed"
+		details["error"] = result.Err.Error()
+	case len(result.HookErrors) > 0:
+		details["result"] = "reencrypt_failed"
+		details["error"] = errors.Join(result.HookErrors...).Error()
+	}
+	if result.NewKeyID != "" {
+		details["new_key"] = result.NewKeyID
+	}
+	sm.record(AuditKeyAutoRotate, result.OldKeyID, details)
+}
+
+// startRotation 启动轮换调度，调用方需持有锁。启动时立即检查一次，之后每隔 RotationCheckInterval 检查
+func (sm *DefaultSecurityManager) startRotation() {
+	interval := sm.config.RotationCheckInterval
+	if interval <= 0 || sm.rotationCancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	sm.rotationCancel = cancel
+	sm.rotationDone = done
+
+	go func() {
+		defer close(done)
+		ticker := clock.OrSystem(sm.config.Clock).NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, err := sm.RotateDueKeys(ctx); err != nil && ctx.Err() == nil {
+				// 密钥库锁定等原因无法检查，下次再试
+				sm.events.emit(AuditKeyAutoRotate, "", nil, err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C():
+			}
+		}
+	}()
+}
+
+// stopRotation 停止轮换调度并等待正在进行的轮换结束，调用方不能持有锁
+func (sm *DefaultSecurityManager) stopRotation() {
+	sm.mu.Lock()
+	cancel, done := sm.rotationCancel, sm.rotationDone
+	sm.rotationCancel, sm.rotationDone = nil, nil
+	sm.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// rotationDue 判断密钥是否需要自动轮换。lead为0时在剩余有效期不足十分之一时轮换；
+// lead最多取有效期的一半，否则新密钥刚生成就又需要轮换
+func rotationDue(key *KeyInfo, now time.Time, lead time.Duration) bool {
+	if key.Metadata[autoRotateMetadata] != "true" || key.Metadata[rotatedToMetadata] != "" || key.ExpiresAt.IsZero() {
+		return false
+	}
+	lifetime := key.ExpiresAt.Sub(key.CreatedAt)
+	if lead <= 0 {
+		lead = lifetime / 10
+	}
+	lead = min(lead, lifetime/2)
+	return !now.Before(key.ExpiresAt.Add(-lead))
+}
+
+// setRotationPolicy 在元数据中记录轮换策略，轮换时新密钥沿用
+func setRotationPolicy(metadata map[string]string, policy *RotationPolicy) {
+	if policy == nil || policy.IntervalSeconds <= 0 {
+		return
+	}
+	metadata[rotationIntervalMetadata] = strconv.FormatInt(policy.IntervalSeconds, 10)
+	if policy.AutoRotate {
+		metadata[autoRotateMetadata] = "true"
+	} else {
+		delete(metadata, autoRotateMetadata)
+	}
+}
+
+// keyRotationPolicy 从元数据中恢复轮换策略，没有记录时返回nil
+func keyRotationPolicy(entry *KeyEntry) *RotationPolicy {
+	interval, err := strconv.ParseInt(entry.Metadata[rotationIntervalMetadata], 10, 64)
+	if err != nil || interval <= 0 {
+		return nil
+	}
+	return &RotationPolicy{
+		IntervalSeconds: interval,
+		AutoRotate:      entry.Metadata[autoRotateMetadata] == "true",
+	}
+}
@@ -0,0 +1,118 @@
+package security
+
+import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+// scryptKey 按 RFC 7914 从口令派生密钥。N 为CPU/内存开销参数，必须是大于1的2的幂；
+// r 为块大小参数，p 为并行度参数
+func scryptKey(password, salt []byte, N, r, p, keyLen int) ([]byte, error) {
+	if N <= 1 || N&(N-1) != 0 {
+		return nil, errors.New("scrypt: N must be a power of 2 greater than 1")
+	}
+	if r <= 0 || p <= 0 || uint64(r)*uint64(p) >= 1<<30 || r > (1<<31-1)/128/p || r > (1<<31-1)/256 || N > (1<<31-1)/128/r {
+		return nil, errors.New("scrypt: parameters are too large")
+	}
+
+	blockWords := 32 * r
+	b, err := pbkdf2.Key(sha256.New, string(password), salt, 1, p*128*r)
+	if err != nil {
+		return nil, err
+	}
+
+	x := make([]uint32, blockWords)
+	y := make([]uint32, blockWords)
+	v := make([]uint32, blockWords*N)
+	for i := 0; i < p; i++ {
+		chunk := b[i*128*r : (i+1)*128*r]
+		for j := range x {
+			x[j] = binary.LittleEndian.Uint32(chunk[j*4:])
+		}
+		scryptROMix(x, y, v, N, r)
+		for j, w := range x {
+			binary.LittleEndian.PutUint32(chunk[j*4:], w)
+		}
+	}
+
+	return pbkdf2.Key(sha256.New, string(password), b, 1, keyLen)
+}
+
+// scryptROMix 对一个 128*r 字节的块执行 ROMix，y 和 v 为临时空间
+func scryptROMix(x, y, v []uint32, N, r int) {
+	blockWords := 32 * r
+	for i := 0; i < N; i++ {
+		copy(v[i*blockWords:], x)
+		scryptBlockMix(x, y, r)
+	}
+	for i := 0; i < N; i++ {
+		j := int(x[(2*r-1)*16] & uint32(N-1))
+		for k, w := range v[j*blockWords : (j+1)*blockWords] {
+			x[k] ^= w
+		}
+		scryptBlockMix(x, y, r)
+	}
+}
+
+// scryptBlockMix 执行 BlockMix，结果写回 b，y 为临时空间
+func scryptBlockMix(b, y []uint32, r int) {
+	var t [16]uint32
+	copy(t[:], b[(2*r-1)*16:])
+	for i := 0; i < 2*r; i++ {
+		for j := range t {
+			t[j] ^= b[i*16+j]
+		}
+		salsa208(&t)
+		// 偶数块放在前半部分，奇数块放在后半部分
+		copy(y[(i/2+(i%2)*r)*16:], t[:])
+	}
+	copy(b, y)
+}
+
+// salsa208 Salsa20/8 核心函数
+func salsa208(b *[16]uint32) {
+	x := *b
+	for i := 0; i < 8; i += 2 {
+		// 列变换
+		x[4] ^= bits.RotateLeft32(x[0]+x[12], 7)
+		x[8] ^= bits.RotateLeft32(x[4]+x[0], 9)
+		x[12] ^= bits.RotateLeft32(x[8]+x[4], 13)
+		x[0] ^= bits.RotateLeft32(x[12]+x[8], 18)
+		x[9] ^= bits.RotateLeft32(x[5]+x[1], 7)
+		x[13] ^= bits.RotateLeft32(x[9]+x[5], 9)
+		x[1] ^= bits.RotateLeft32(x[13]+x[9], 13)
+		x[5] ^= bits.RotateLeft32(x[1]+x[13], 18)
+		x[14] ^= bits.RotateLeft32(x[10]+x[6], 7)
+		x[2] ^= bits.RotateLeft32(x[14]+x[10], 9)
+		x[6] ^= bits.RotateLeft32(x[2]+x[14], 13)
+		x[10] ^= bits.RotateLeft32(x[6]+x[2], 18)
+		x[3] ^= bits.RotateLeft32(x[15]+x[11], 7)
+		x[7] ^= bits.RotateLeft32(x[3]+x[15], 9)
+		x[11] ^= bits.RotateLeft32(x[7]+x[3], 13)
+		x[15] ^= bits.RotateLeft32(x[11]+x[7], 18)
+
+		// 行变换
+		x[1] ^= bits.RotateLeft32(x[0]+x[3], 7)
+		x[2] ^= bits.RotateLeft32(x[1]+x[0], 9)
+		x[3] ^= bits.RotateLeft32(x[2]+x[1], 13)
+		x[0] ^= bits.RotateLeft32(x[3]+x[2], 18)
+		x[6] ^= bits.RotateLeft32(x[5]+x[4], 7)
+		x[7] ^= bits.RotateLeft32(x[6]+x[5], 9)
+		x[4] ^= bits.RotateLeft32(x[7]+x[6], 13)
+		x[5] ^= bits.RotateLeft32(x[4]+x[7], 18)
+		x[11] ^= bits.RotateLeft32(x[10]+x[9], 7)
+		x[8] ^= bits.RotateLeft32(x[11]+x[10], 9)
+		x[9] ^= bits.RotateLeft32(x[8]+x[11], 13)
+		x[10] ^= bits.RotateLeft32(x[9]+x[8], 18)
+		x[12] ^= bits.RotateLeft32(x[15]+x[14], 7)
+		x[13] ^= bits.RotateLeft32(x[12]+x[15], 9)
+		x[14] ^= bits.RotateLeft32(x[13]+x[12], 13)
+		x[15] ^= bits.RotateLeft32(x[14]+x[13], 18)
+	}
+	for i := range b {
+		b[i] += x[i]
+	}
+}
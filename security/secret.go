@@ -0,0 +1,57 @@
+package security
+
+import (
+	"crypto/subtle"
+	"runtime"
+)
+
+// SecretBuffer 保存密钥等敏感数据的缓冲区，Close 时清零。
+// 没有关闭的缓冲区在被垃圾回收时也会清零，但回收时间不确定，用完应尽快 Close
+type SecretBuffer struct {
+	data []byte
+}
+
+// NewSecretBuffer 用data创建缓冲区。缓冲区接管data，调用方不应再使用或修改它
+func NewSecretBuffer(data []byte) *SecretBuffer {
+	s := &SecretBuffer{data: data}
+	if len(data) > 0 {
+		runtime.AddCleanup(s, wipe, data)
+	}
+	return s
+}
+
+// Bytes 返回缓冲区中的数据，Close 之后返回nil。返回的切片与缓冲区共享内存，不要在 Close 之后继续持有
+func (s *SecretBuffer) Bytes() []byte {
+	if s == nil {
+		return nil
+	}
+	return s.data
+}
+
+// Len 返回数据长度
+func (s *SecretBuffer) Len() int {
+	if s == nil {
+		return 0
+	}
+	return len(s.data)
+}
+
+// Equal 以常量时间比较缓冲区中的数据与other
+func (s *SecretBuffer) Equal(other []byte) bool {
+	return subtle.ConstantTimeCompare(s.Bytes(), other) == 1
+}
+
+// Close 清零并释放数据，可以重复调用
+func (s *SecretBuffer) Close() error {
+	if s == nil {
+		return nil
+	}
+	wipe(s.data)
+	s.data = nil
+	return nil
+}
+
+// wipe 清零内存中的密钥
+func wipe(b []byte) {
+	clear(b)
+}
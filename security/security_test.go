@@ -3,13 +3,34 @@ package security
 import (
 	"bytes"
 	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/bpfs/fragmenta/clock"
 )
 
 // setupTestEnvironment 设置测试环境
@@ -185,6 +206,70 @@ func TestEncryptionDecryption(t *testing.T) {
 	}
 }
 
+// TestBlockEnvelope 测试加密块信封：记录密钥和算法，修改默认值后旧块仍可解密
+func TestBlockEnvelope(t *testing.T) {
+	tempDir, securityManager := setupTestEnvironment(t)
+	defer teardownTestEnvironment(tempDir, securityManager)
+
+	ctx := context.Background()
+	plaintext := generateRandomData(1000)
+	oldKey := securityManager.GetDefaultKey()
+
+	sealed, err := securityManager.EncryptBlock(ctx, 7, plaintext)
+	if err != nil {
+		t.Fatalf("加密数据块失败: %v", err)
+	}
+	envelope, err := ParseBlockEnvelope(sealed)
+	if err != nil {
+		t.Fatalf("解析信封失败: %v", err)
+	}
+	if envelope.KeyID != oldKey || envelope.Algorithm != AES256GCM || envelope.BlockID != 7 {
+		t.Errorf("信封字段不正确: %+v", envelope)
+	}
+	if _, err := securityManager.DecryptBlock(ctx, 8, sealed); !errors.Is(err, ErrInvalidEnvelope) {
+		t.Errorf("块ID不符应被拒绝: %v", err)
+	}
+	if _, err := ParseBlockEnvelope(sealed[:12]); !errors.Is(err, ErrInvalidEnvelope) {
+		t.Errorf("截断的信封应被拒绝: %v", err)
+	}
+
+	// 旧格式数据
+	keyData, _ := securityManager.GetKeyManager().GetKey(ctx, oldKey)
+	legacy, err := securityManager.GetEncryptionProvider().Encrypt(ctx, string(AES256GCM), keyData, plaintext, blockAAD(9))
+	if err != nil {
+		t.Fatalf("生成旧格式数据失败: %v", err)
+	}
+
+	// 旧格式数据不含密钥ID，只能用默认密钥解密，但会按其中记录的算法解密
+	if err := securityManager.SetDefaultAlgorithm(AES256CTR); err != nil {
+		t.Fatalf("设置默认算法失败: %v", err)
+	}
+	if decrypted, err := securityManager.DecryptBlock(ctx, 9, legacy); err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Errorf("旧格式数据解密失败: %v", err)
+	}
+
+	// 更换默认密钥和算法后写入的块与之前的块混合存放
+	newKey, err := securityManager.GetKeyManager().GenerateKey(ctx, SymmetricKey, &KeyOptions{Type: SymmetricKey, Size: 256})
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	securityManager.SetDefaultKey(newKey)
+	resealed, err := securityManager.EncryptBlock(ctx, 7, plaintext)
+	if err != nil {
+		t.Fatalf("加密数据块失败: %v", err)
+	}
+	if envelope, _ := ParseBlockEnvelope(resealed); envelope.KeyID != newKey || envelope.Algorithm != AES256CTR {
+		t.Errorf("新信封应使用新的默认值: %+v", envelope)
+	}
+
+	for name, data := range map[string][]byte{"旧密钥": sealed, "新密钥": resealed} {
+		decrypted, err := securityManager.DecryptBlock(ctx, 7, data)
+		if err != nil || !bytes.Equal(decrypted, plaintext) {
+			t.Errorf("%s数据解密失败: %v", name, err)
+		}
+	}
+}
+
 // TestStreamEncryptionDecryption 测试流式加密和解密
 func TestStreamEncryptionDecryption(t *testing.T) {
 	t.Skip("流式加密测试已被跳过，因为EncryptStream/DecryptStream方法已被移除")
@@ -296,6 +381,110 @@ func TestAlgorithmSupport(t *testing.T) {
 	}
 }
 
+// TestChaCha20Poly1305 用RFC 8439和XChaCha20草案的测试向量验证ChaCha20-Poly1305实现，
+// 并验证块信封可以使用ChaCha20算法
+func TestChaCha20Poly1305(t *testing.T) {
+	unhex := func(s string) []byte {
+		b, err := hex.DecodeString(strings.ReplaceAll(s, " ", ""))
+		if err != nil {
+			t.Fatalf("解析十六进制失败: %v", err)
+		}
+		return b
+	}
+
+	// RFC 8439 2.5.2
+	var mac poly1305
+	mac.init(unhex("85d6be7857556d337f4452fe42d506a80103808afb0db2fd4abff6af4149f51b"))
+	mac.update([]byte("Cryptographic Forum Research Group"), false)
+	if tag := mac.sum(); !bytes.Equal(tag[:], unhex("a8061dc1305136c6c22b8baf0c0127a9")) {
+		t.Errorf("Poly1305标签不正确: %x", tag)
+	}
+
+	// RFC 8439 2.8.2
+	key := unhex("808182838485868788898a8b8c8d8e8f909192939495969798999a9b9c9d9e9f")
+	nonce := unhex("070000004041424344454647")
+	aad := unhex("50515253c0c1c2c3c4c5c6c7")
+	plaintext := []byte("Ladies and Gentlemen of the class of '99: If I could offer you only one tip for the future, sunscreen would be it.")
+	expected := unhex("d31a8d34648e60db7b86afbc53ef7ec2a4aded51296e08fea9e2b5a736ee62d6" +
+		"3dbea45e8ca9671282fafb69da92728b1a71de0a9e060b2905d6a5b67ecd3b36" +
+		"92ddbd7f2d778b8c9803aee328091b58fab324e4fad675945585808b4831d7bc" +
+		"3ff4def08e4b7a9de576d26586cec64b6116" +
+		"1ae10b594f09e26a7e902ecbd0600691")
+
+	aead, err := newChaCha20Poly1305(key)
+	if err != nil {
+		t.Fatalf("创建ChaCha20-Poly1305失败: %v", err)
+	}
+	sealed := aead.Seal(nil, nonce, plaintext, aad)
+	if !bytes.Equal(sealed, expected) {
+		t.Fatalf("ChaCha20-Poly1305密文不正确: %x", sealed)
+	}
+	if opened, err := aead.Open(nil, nonce, sealed, aad); err != nil || !bytes.Equal(opened, plaintext) {
+		t.Errorf("ChaCha20-Poly1305解密失败: %v", err)
+	}
+	sealed[0] ^= 1
+	if _, err := aead.Open(nil, nonce, sealed, aad); err == nil {
+		t.Error("篡改后的密文不应通过认证")
+	}
+
+	// draft-irtf-cfrg-xchacha 2.2.1
+	var hkey [8]uint32
+	for i := range hkey {
+		hkey[i] = binary.LittleEndian.Uint32(unhex("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")[i*4:])
+	}
+	subkey := hChaCha20(&hkey, unhex("000000090000004a0000000031415927"))
+	subkeyBytes := make([]byte, 0, chachaKeySize)
+	for _, w := range subkey {
+		subkeyBytes = binary.LittleEndian.AppendUint32(subkeyBytes, w)
+	}
+	if !bytes.Equal(subkeyBytes, unhex("82413b4227b27bfed30e42508a877d73a0f9e4d58a74a853c12ec41326d3ecdc")) {
+		t.Errorf("HChaCha20子密钥不正确: %x", subkeyBytes)
+	}
+
+	// 两种算法都可以用于块信封
+	tempDir, securityManager := setupTestEnvironment(t)
+	defer teardownTestEnvironment(tempDir, securityManager)
+	ctx := context.Background()
+	data := generateRandomData(1000)
+
+	for _, algorithm := range []EncryptionAlgorithm{ChaCha20Poly1305, XChaCha20Poly1305} {
+		if err := securityManager.SetDefaultAlgorithm(algorithm); err != nil {
+			t.Fatalf("设置默认算法失败: %v", err)
+		}
+		block, err := securityManager.EncryptBlock(ctx, 3, data)
+		if err != nil {
+			t.Fatalf("加密数据块失败: %v", err)
+		}
+		envelope, err := ParseBlockEnvelope(block)
+		if err != nil || envelope.Algorithm != algorithm {
+			t.Fatalf("信封算法不正确: %v, %v", envelope, err)
+		}
+
+		// 切换默认算法后按信封中的算法解密
+		securityManager.SetDefaultAlgorithm(AES256GCM)
+		if decrypted, err := securityManager.DecryptBlock(ctx, 3, block); err != nil || !bytes.Equal(decrypted, data) {
+			t.Errorf("%s 数据块解密失败: %v", algorithm, err)
+		}
+
+		encrypted, err := securityManager.GetEncryptionProvider().Encrypt(ctx, string(algorithm), mustKey(t, securityManager), data, nil)
+		if err != nil {
+			t.Fatalf("%s 加密失败: %v", algorithm, err)
+		}
+		if decrypted, err := securityManager.GetEncryptionProvider().Decrypt(ctx, string(algorithm), mustKey(t, securityManager), encrypted, nil); err != nil || !bytes.Equal(decrypted, data) {
+			t.Errorf("%s 解密失败: %v", algorithm, err)
+		}
+	}
+}
+
+// mustKey 获取默认密钥
+func mustKey(t *testing.T, securityManager *DefaultSecurityManager) []byte {
+	key, err := securityManager.GetKeyManager().GetKey(context.Background(), securityManager.GetDefaultKey())
+	if err != nil {
+		t.Fatalf("获取默认密钥失败: %v", err)
+	}
+	return key
+}
+
 // TestSecureStorage 测试安全存储功能
 func TestSecureStorage(t *testing.T) {
 	tempDir, securityManager := setupTestEnvironment(t)
@@ -348,3 +537,1317 @@ func TestSecureStorage(t *testing.T) {
 		t.Fatal("数据应该已被删除，但仍然可以检索")
 	}
 }
+
+// fakeKMS 模拟密钥管理服务，包装结果是服务端保存的数据密钥编号
+type fakeKMS struct {
+	mu   sync.Mutex
+	keys [][]byte
+}
+
+func (f *fakeKMS) wrap(plaintext []byte) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.keys = append(f.keys, append([]byte(nil), plaintext...))
+	return strconv.Itoa(len(f.keys) - 1)
+}
+
+func (f *fakeKMS) unwrap(wrapped string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	i, err := strconv.Atoi(wrapped)
+	if err != nil || i < 0 || i >= len(f.keys) {
+		return nil, false
+	}
+	return f.keys[i], true
+}
+
+// TestKeyProviders 测试通过外部密钥管理服务包装密钥库
+func TestKeyProviders(t *testing.T) {
+	kms := &fakeKMS{}
+	mux := http.NewServeMux()
+
+	// Vault Transit
+	mux.HandleFunc("/v1/transit/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "vault-token" {
+			http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+			return
+		}
+		var req struct{ Plaintext, Ciphertext string }
+		json.NewDecoder(r.Body).Decode(&req)
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/app":
+			plaintext, _ := base64.StdEncoding.DecodeString(req.Plaintext)
+			fmt.Fprintf(w, `{"data":{"ciphertext":"vault:v1:%s"}}`, kms.wrap(plaintext))
+		case "/v1/transit/decrypt/app":
+			key, ok := kms.unwrap(strings.TrimPrefix(req.Ciphertext, "vault:v1:"))
+			if !ok {
+				http.Error(w, `{"errors":["invalid ciphertext"]}`, http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(w, `{"data":{"plaintext":%q}}`, base64.StdEncoding.EncodeToString(key))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	// Google Cloud KMS
+	gcpKey := "projects/p/locations/global/keyRings/r/cryptoKeys/k"
+	mux.HandleFunc("/v1/projects/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer gcp-token" {
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+		var req struct{ Plaintext, Ciphertext []byte }
+		json.NewDecoder(r.Body).Decode(&req)
+		switch r.URL.Path {
+		case "/v1/" + gcpKey + ":encrypt":
+			json.NewEncoder(w).Encode(map[string][]byte{"ciphertext": []byte(kms.wrap(req.Plaintext))})
+		case "/v1/" + gcpKey + ":decrypt":
+			key, ok := kms.unwrap(string(req.Ciphertext))
+			if !ok {
+				http.Error(w, "invalid ciphertext", http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string][]byte{"plaintext": key})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	// AWS KMS
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") ||
+			!strings.Contains(auth, "/us-east-1/kms/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-target, Signature=") {
+			http.Error(w, `{"__type":"IncompleteSignatureException"}`, http.StatusBadRequest)
+			return
+		}
+		var req struct {
+			KeyId                     string
+			Plaintext, CiphertextBlob []byte
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		if req.KeyId != "alias/app" {
+			http.Error(w, `{"__type":"NotFoundException"}`, http.StatusBadRequest)
+			return
+		}
+		switch r.Header.Get("X-Amz-Target") {
+		case "TrentService.Encrypt":
+			json.NewEncoder(w).Encode(map[string][]byte{"CiphertextBlob": []byte(kms.wrap(req.Plaintext))})
+		case "TrentService.Decrypt":
+			key, ok := kms.unwrap(string(req.CiphertextBlob))
+			if !ok {
+				http.Error(w, `{"__type":"InvalidCiphertextException"}`, http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string][]byte{"Plaintext": key})
+		default:
+			http.Error(w, `{"__type":"UnknownOperationException"}`, http.StatusBadRequest)
+		}
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Setenv("VAULT_TOKEN", "vault-token")
+	t.Setenv("GOOGLE_OAUTH_ACCESS_TOKEN", "gcp-token")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+
+	configs := []KMSConfig{
+		{Provider: KeySourceVault, KeyID: "app", Endpoint: server.URL},
+		{Provider: KeySourceGCPKMS, KeyID: gcpKey, Endpoint: server.URL},
+		{Provider: KeySourceAWSKMS, KeyID: "alias/app", Region: "us-east-1", Endpoint: server.URL},
+	}
+	for _, kmsConfig := range configs {
+		t.Run(kmsConfig.Provider, func(t *testing.T) {
+			ctx := context.Background()
+			config := &SecurityConfig{
+				EncryptionEnabled: true,
+				DefaultAlgorithm:  AES256GCM,
+				KeyStorePath:      filepath.Join(t.TempDir(), "keys"),
+				AutoGenerateKey:   true,
+				KMS:               kmsConfig,
+			}
+			securityManager, err := NewDefaultSecurityManager(config)
+			if err != nil {
+				t.Fatalf("创建安全管理器失败: %v", err)
+			}
+			if err := securityManager.Initialize(ctx); err != nil {
+				t.Fatalf("初始化安全管理器失败: %v", err)
+			}
+			keyID := securityManager.GetDefaultKey()
+			keyData, err := securityManager.GetKeyManager().GetKey(ctx, keyID)
+			if err != nil {
+				t.Fatalf("获取密钥失败: %v", err)
+			}
+
+			plaintext := []byte("envelope encryption with external kms")
+			encrypted, err := securityManager.EncryptBlock(ctx, 3, plaintext)
+			if err != nil {
+				t.Fatalf("加密失败: %v", err)
+			}
+
+			// 密钥库文件中只有包装后的记录，不含密钥明文
+			filepath.Walk(config.KeyStorePath, func(path string, info os.FileInfo, err error) error {
+				if err != nil || info.IsDir() {
+					return err
+				}
+				data, _ := os.ReadFile(path)
+				if !isWrappedRecord(data) || bytes.Contains(data, keyData) {
+					t.Errorf("密钥文件未被包装: %s", path)
+				}
+				return nil
+			})
+
+			// 新实例通过密钥管理服务解包密钥后解密
+			reopened, err := NewDefaultSecurityManager(config)
+			if err != nil {
+				t.Fatalf("创建安全管理器失败: %v", err)
+			}
+			if err := reopened.Initialize(ctx); err != nil {
+				t.Fatalf("初始化安全管理器失败: %v", err)
+			}
+			decrypted, err := reopened.DecryptBlock(ctx, 3, encrypted)
+			if err != nil || !bytes.Equal(decrypted, plaintext) {
+				t.Fatalf("重新打开后解密失败: %q, %v", decrypted, err)
+			}
+
+			// 没有包装的密钥库记录被拒绝
+			plain, _ := NewFileSecureStorage(filepath.Join(t.TempDir(), "plain"))
+			plain.Store(ctx, "legacy", []byte("legacy-key"))
+			provider, _ := NewKeyProvider(kmsConfig)
+			wrapped := NewWrappedSecureStorage(plain, provider)
+			if _, err := wrapped.Retrieve(ctx, "legacy"); !errors.Is(err, ErrUnwrappedRecord) {
+				t.Errorf("未包装的记录应被拒绝: %v", err)
+			}
+			if n, err := wrapped.WrapExisting(ctx); err != nil || n != 1 {
+				t.Fatalf("迁移记录失败: %d, %v", n, err)
+			}
+			if data, err := NewWrappedSecureStorage(plain, provider).Retrieve(ctx, "legacy"); err != nil || string(data) != "legacy-key" {
+				t.Errorf("迁移后读取记录失败: %q, %v", data, err)
+			}
+		})
+	}
+
+	// 凭据错误时返回服务端错误
+	t.Setenv("VAULT_TOKEN", "wrong")
+	provider, err := NewKeyProvider(configs[0])
+	if err != nil {
+		t.Fatalf("创建密钥提供者失败: %v", err)
+	}
+	if _, err := provider.WrapKey(context.Background(), []byte("key")); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("凭据错误时应返回403: %v", err)
+	}
+}
+
+// TestKeyStorePassphrase 测试口令加密密钥库的解锁、锁定和自动锁定
+func TestKeyStorePassphrase(t *testing.T) {
+	tempDir, plainManager := setupTestEnvironment(t)
+	defer teardownTestEnvironment(tempDir, plainManager)
+	ctx := context.Background()
+
+	// 先用明文密钥库加密一个块
+	plaintext := []byte("key store at rest")
+	encrypted, err := plainManager.EncryptBlock(ctx, 7, plaintext)
+	if err != nil {
+		t.Fatalf("加密失败: %v", err)
+	}
+
+	config := &SecurityConfig{
+		EncryptionEnabled: true,
+		DefaultAlgorithm:  AES256GCM,
+		KeyStorePath:      filepath.Join(tempDir, "keys"),
+		AutoGenerateKey:   true,
+		EncryptKeyStore:   true,
+		RelockTimeout:     200 * time.Millisecond,
+	}
+	securityManager, err := NewDefaultSecurityManager(config)
+	if err != nil {
+		t.Fatalf("创建安全管理器失败: %v", err)
+	}
+	securityManager.SetDefaultKey(plainManager.GetDefaultKey())
+	if !securityManager.IsLocked() {
+		t.Fatal("密钥库初始应处于锁定状态")
+	}
+	if _, err := securityManager.DecryptBlock(ctx, 7, encrypted); !errors.Is(err, ErrKeyStoreLocked) {
+		t.Fatalf("锁定时解密应返回ErrKeyStoreLocked: %v", err)
+	}
+
+	// 首次解锁设置口令并加密已有的密钥
+	if err := securityManager.Unlock(ctx, []byte("s3cret")); err != nil {
+		t.Fatalf("解锁失败: %v", err)
+	}
+	filepath.Walk(config.KeyStorePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Base(path) == keyStoreParamsFile {
+			return err
+		}
+		if data, _ := os.ReadFile(path); !isWrappedRecord(data) {
+			t.Errorf("密钥文件未加密: %s", path)
+		}
+		return nil
+	})
+	if decrypted, err := securityManager.DecryptBlock(ctx, 7, encrypted); err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("解锁后解密失败: %q, %v", decrypted, err)
+	}
+
+	// 锁定后清除内存中的密钥，错误的口令无法解锁
+	securityManager.Lock()
+	if _, err := securityManager.EncryptBlock(ctx, 8, plaintext); !errors.Is(err, ErrKeyStoreLocked) {
+		t.Errorf("锁定后加密应返回ErrKeyStoreLocked: %v", err)
+	}
+	if err := securityManager.Unlock(ctx, []byte("wrong")); !errors.Is(err, ErrInvalidPassphrase) {
+		t.Errorf("错误的口令应返回ErrInvalidPassphrase: %v", err)
+	}
+
+	// 新实例用相同口令解锁，空闲超时后自动锁定
+	reopened, err := NewDefaultSecurityManager(config)
+	if err != nil {
+		t.Fatalf("创建安全管理器失败: %v", err)
+	}
+	if err := reopened.Unlock(ctx, []byte("s3cret")); err != nil {
+		t.Fatalf("重新解锁失败: %v", err)
+	}
+	reopened.SetDefaultKey(plainManager.GetDefaultKey())
+	if decrypted, err := reopened.DecryptBlock(ctx, 7, encrypted); err != nil || !bytes.Equal(decrypted, plaintext) {
+		t.Fatalf("重新解锁后解密失败: %q, %v", decrypted, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !reopened.IsLocked() && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if !reopened.IsLocked() {
+		t.Error("空闲超时后应自动锁定")
+	}
+	if _, err := reopened.DecryptBlock(ctx, 7, encrypted); !errors.Is(err, ErrKeyStoreLocked) {
+		t.Errorf("自动锁定后解密应返回ErrKeyStoreLocked: %v", err)
+	}
+}
+
+// TestKeyPairSignature 测试EC和Ed25519密钥对生成、导入校验以及与签名提供者的往返
+func TestKeyPairSignature(t *testing.T) {
+	tempDir, securityManager := setupTestEnvironment(t)
+	defer teardownTestEnvironment(tempDir, securityManager)
+	ctx := context.Background()
+	keyManager := securityManager.GetKeyManager()
+	signer := NewDefaultSignatureProvider(keyManager)
+	data := []byte("signed block payload")
+
+	cases := []struct {
+		keyType   KeyType
+		size      int
+		algorithm SignatureAlgorithmName
+	}{
+		{ECPrivateKey, 256, ECDSA_P256_SHA256},
+		{ECPrivateKey, 384, ECDSA_P384_SHA384},
+		{ED25519PrivateKey, 0, ED25519},
+	}
+	var pairs [][2][]byte
+	for _, c := range cases {
+		pair, err := keyManager.GenerateKeyPair(ctx, c.keyType, &KeyOptions{Type: c.keyType, Size: c.size})
+		if err != nil {
+			t.Fatalf("生成%s密钥对失败: %v", c.algorithm, err)
+		}
+		privateKey, err := keyManager.GetKey(ctx, pair.PrivateKeyID)
+		if err != nil {
+			t.Fatalf("获取私钥失败: %v", err)
+		}
+		publicKey, err := keyManager.GetKey(ctx, pair.PublicKeyID)
+		if err != nil {
+			t.Fatalf("获取公钥失败: %v", err)
+		}
+		pairs = append(pairs, [2][]byte{privateKey, publicKey})
+
+		signature, err := signer.Sign(ctx, string(c.algorithm), privateKey, data)
+		if err != nil {
+			t.Fatalf("%s签名失败: %v", c.algorithm, err)
+		}
+		if ok, err := signer.Verify(ctx, string(c.algorithm), publicKey, data, signature); err != nil || !ok {
+			t.Errorf("%s验证签名失败: %v, %v", c.algorithm, ok, err)
+		}
+		if ok, _ := signer.Verify(ctx, string(c.algorithm), publicKey, []byte("tampered"), signature); ok {
+			t.Errorf("%s篡改后的数据不应通过验证", c.algorithm)
+		}
+
+		// 导出的密钥对可以重新导入，密钥大小由校验得出
+		imported, err := keyManager.ImportKeyPair(ctx, privateKey, publicKey, &KeyOptions{Type: c.keyType})
+		if err != nil {
+			t.Fatalf("导入%s密钥对失败: %v", c.algorithm, err)
+		}
+		wantSize := c.size
+		if wantSize == 0 {
+			wantSize = 256
+		}
+		entry, err := keyManager.(*DefaultKeyManager).RetrieveKeyEntry(ctx, imported.PrivateKeyID)
+		if err != nil || entry.Metadata["size"] != fmt.Sprint(wantSize) {
+			t.Errorf("导入的%s密钥大小不正确: %v, %v", c.algorithm, entry, err)
+		}
+	}
+
+	// 不匹配的密钥对和不支持的曲线被拒绝
+	if _, err := keyManager.ImportKeyPair(ctx, pairs[0][0], pairs[1][1], &KeyOptions{Type: ECPrivateKey}); err == nil {
+		t.Error("不同曲线的EC密钥对不应通过校验")
+	}
+	other, _, _ := generateEd25519KeyPair()
+	if _, err := keyManager.ImportKeyPair(ctx, other, pairs[2][1], &KeyOptions{Type: ED25519PrivateKey}); err == nil {
+		t.Error("不匹配的Ed25519密钥对不应通过校验")
+	}
+	if _, err := keyManager.GenerateKeyPair(ctx, ECPrivateKey, &KeyOptions{Type: ECPrivateKey, Size: 521}); err == nil {
+		t.Error("不支持的EC密钥大小应返回错误")
+	}
+}
+
+// testCA 测试用的证书颁发机构
+type testCA struct {
+	cert *x509.Certificate
+	key  crypto.Signer
+}
+
+// newTestCA 创建自签名根CA，parent不为nil时由parent签发中间CA
+func newTestCA(t *testing.T, name string, parent *testCA) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("生成CA密钥失败: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	issuer, issuerKey := template, crypto.Signer(key)
+	if parent != nil {
+		issuer, issuerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), issuerKey)
+	if err != nil {
+		t.Fatalf("创建CA证书失败: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key}
+}
+
+// issue 按CSR签发证书
+func (ca *testCA) issue(t *testing.T, csrPEM []byte) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		t.Fatalf("CSR格式不正确: %s", csrPEM)
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil || csr.CheckSignature() != nil {
+		t.Fatalf("CSR签名无效: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      csr.Subject,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, csr.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("签发证书失败: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return cert
+}
+
+// TestCertificates 测试CSR生成、证书导入导出以及带证书的块签名验证
+func TestCertificates(t *testing.T) {
+	tempDir, securityManager := setupTestEnvironment(t)
+	defer teardownTestEnvironment(tempDir, securityManager)
+	ctx := context.Background()
+	keyManager := securityManager.GetKeyManager().(*DefaultKeyManager)
+
+	root := newTestCA(t, "Test Root", nil)
+	intermediate := newTestCA(t, "Test Intermediate", root)
+	rootPEM := encodeCertificateChain([]*x509.Certificate{root.cert})
+	securityManager.GetTrustStore().AddRoots(rootPEM)
+
+	for _, keyType := range []KeyType{ECPrivateKey, ED25519PrivateKey} {
+		pair, err := keyManager.GenerateKeyPair(ctx, keyType, nil)
+		if err != nil {
+			t.Fatalf("生成密钥对失败: %v", err)
+		}
+		if _, err := securityManager.SignBlockWithCertificate(ctx, pair.PrivateKeyID, 1, nil); !errors.Is(err, ErrCertificateNotFound) {
+			t.Errorf("没有证书时应返回ErrCertificateNotFound: %v", err)
+		}
+
+		csr, err := keyManager.CreateCSR(ctx, pair.PrivateKeyID, &x509.CertificateRequest{
+			Subject: pkix.Name{CommonName: "signer-" + string(keyType), Organization: []string{"fragmenta"}},
+		})
+		if err != nil {
+			t.Fatalf("生成CSR失败: %v", err)
+		}
+		leaf := intermediate.issue(t, csr)
+		chainPEM := encodeCertificateChain([]*x509.Certificate{leaf, intermediate.cert})
+		if err := keyManager.ImportCertificate(ctx, pair.PrivateKeyID, chainPEM); err != nil {
+			t.Fatalf("导入证书失败: %v", err)
+		}
+		if exported, err := keyManager.ExportCertificate(ctx, pair.PrivateKeyID); err != nil || !bytes.Equal(exported, chainPEM) {
+			t.Errorf("导出的证书链不一致: %v", err)
+		}
+
+		// 签名附带证书链，验证时追溯到根CA并返回签名者证书
+		data := []byte("archived block")
+		signature, err := securityManager.SignBlockWithCertificate(ctx, pair.PrivateKeyID, 9, data)
+		if err != nil {
+			t.Fatalf("块签名失败: %v", err)
+		}
+		signer, err := securityManager.VerifyBlockSignature(ctx, 9, data, signature)
+		if err != nil || signer.Subject.CommonName != "signer-"+string(keyType) {
+			t.Fatalf("块签名验证失败: %v, %v", signer, err)
+		}
+		if _, err := securityManager.VerifyBlockSignature(ctx, 10, data, signature); err == nil {
+			t.Error("签名不应适用于其他块")
+		}
+		if _, err := securityManager.VerifyBlockSignature(ctx, 9, []byte("tampered"), signature); err == nil {
+			t.Error("篡改后的数据不应通过验证")
+		}
+
+		// 不信任该根CA的验证方拒绝签名
+		untrusted, _ := NewTrustStore(encodeCertificateChain([]*x509.Certificate{newTestCA(t, "Other Root", nil).cert}))
+		provider := NewDefaultSignatureProvider(keyManager)
+		if _, err := provider.VerifyWithTrust(ctx, untrusted, blockSignedContent(9, data), signature); !errors.Is(err, ErrUntrustedCertificate) {
+			t.Errorf("未受信任的证书应返回ErrUntrustedCertificate: %v", err)
+		}
+	}
+
+	// 证书公钥与密钥对不匹配时拒绝导入
+	other, err := keyManager.GenerateKeyPair(ctx, ECPrivateKey, nil)
+	if err != nil {
+		t.Fatalf("生成密钥对失败: %v", err)
+	}
+	otherCSR, _ := keyManager.CreateCSR(ctx, other.PrivateKeyID, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "other"}})
+	pair, _ := keyManager.GenerateKeyPair(ctx, ECPrivateKey, nil)
+	err = keyManager.ImportCertificate(ctx, pair.PrivateKeyID, encodeCertificateChain([]*x509.Certificate{root.issue(t, otherCSR)}))
+	if !errors.Is(err, ErrCertificateKeyMismatch) {
+		t.Errorf("公钥不匹配的证书应被拒绝: %v", err)
+	}
+}
+
+// TestSignBlock 测试用存储的密钥签名和验证数据块
+func TestSignBlock(t *testing.T) {
+	tempDir, securityManager := setupTestEnvironment(t)
+	defer teardownTestEnvironment(tempDir, securityManager)
+	ctx := context.Background()
+	keyManager := securityManager.GetKeyManager()
+
+	pair, err := keyManager.GenerateKeyPair(ctx, ED25519PrivateKey, nil)
+	if err != nil {
+		t.Fatalf("生成密钥对失败: %v", err)
+	}
+	symmetricID, err := keyManager.GenerateKey(ctx, SymmetricKey, nil)
+	if err != nil {
+		t.Fatalf("生成对称密钥失败: %v", err)
+	}
+
+	data := []byte("archived block")
+	for _, keyID := range []string{pair.PrivateKeyID, symmetricID} {
+		signature, err := securityManager.SignBlock(ctx, keyID, 7, data)
+		if err != nil {
+			t.Fatalf("块签名失败: %v", err)
+		}
+		if valid, err := securityManager.VerifyBlock(ctx, keyID, 7, data, signature); err != nil || !valid {
+			t.Fatalf("块签名验证失败: %v, %v", valid, err)
+		}
+		if valid, _ := securityManager.VerifyBlock(ctx, keyID, 8, data, signature); valid {
+			t.Error("签名不应适用于其他块")
+		}
+		if valid, _ := securityManager.VerifyBlock(ctx, keyID, 7, []byte("tampered"), signature); valid {
+			t.Error("篡改后的数据不应通过验证")
+		}
+	}
+
+	if _, err := securityManager.SignBlock(ctx, "missing", 7, data); err == nil {
+		t.Error("使用不存在的密钥签名应失败")
+	}
+}
+
+// memoryToken 在内存中保存私钥的硬件设备模拟
+type memoryToken struct {
+	keys map[string]crypto.Signer
+}
+
+func (m *memoryToken) Name() string { return "memory" }
+
+func (m *memoryToken) GenerateKey(ctx context.Context, label string, keyType KeyType, size int) (crypto.Signer, error) {
+	var key crypto.Signer
+	var err error
+	switch keyType {
+	case ECPrivateKey:
+		key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case RSAPrivateKey:
+		key, err = rsa.GenerateKey(rand.Reader, size)
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", keyType)
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.keys[label] = key
+	return key, nil
+}
+
+func (m *memoryToken) FindKey(ctx context.Context, label string) (crypto.Signer, error) {
+	key, ok := m.keys[label]
+	if !ok {
+		return nil, errors.New("key not found")
+	}
+	return key, nil
+}
+
+func (m *memoryToken) DeleteKey(ctx context.Context, label string) error {
+	delete(m.keys, label)
+	return nil
+}
+
+// TestHardwareKeys 测试私钥保存在硬件设备中的密钥对和密钥提供者
+func TestHardwareKeys(t *testing.T) {
+	tempDir, securityManager := setupTestEnvironment(t)
+	defer teardownTestEnvironment(tempDir, securityManager)
+	ctx := context.Background()
+	keyManager := securityManager.GetKeyManager().(*DefaultKeyManager)
+
+	if _, err := keyManager.GenerateHardwareKeyPair(ctx, ECPrivateKey, nil); !errors.Is(err, ErrNoHardwareToken) {
+		t.Errorf("没有设备时应返回ErrNoHardwareToken: %v", err)
+	}
+
+	token := &memoryToken{keys: make(map[string]crypto.Signer)}
+	keyManager.SetHardwareToken(token)
+	pair, err := keyManager.GenerateHardwareKeyPair(ctx, ECPrivateKey, nil)
+	if err != nil {
+		t.Fatalf("在设备中生成密钥对失败: %v", err)
+	}
+	if _, err := keyManager.GetKey(ctx, pair.PrivateKeyID); !errors.Is(err, ErrKeyNotExportable) {
+		t.Errorf("硬件私钥不应能读取: %v", err)
+	}
+	if _, err := keyManager.ExportKey(ctx, pair.PrivateKeyID); !errors.Is(err, ErrKeyNotExportable) {
+		t.Errorf("硬件私钥不应能导出: %v", err)
+	}
+
+	// 签名由设备完成，验证只需要公钥
+	data := []byte("archived block")
+	signature, err := securityManager.SignBlock(ctx, pair.PrivateKeyID, 5, data)
+	if err != nil {
+		t.Fatalf("硬件密钥签名失败: %v", err)
+	}
+	if valid, err := securityManager.VerifyBlock(ctx, pair.PrivateKeyID, 5, data, signature); err != nil || !valid {
+		t.Errorf("硬件密钥签名验证失败: %v, %v", valid, err)
+	}
+	if _, err := keyManager.CreateCSR(ctx, pair.PrivateKeyID, &x509.CertificateRequest{Subject: pkix.Name{CommonName: "hsm"}}); err != nil {
+		t.Errorf("硬件密钥生成CSR失败: %v", err)
+	}
+
+	// 审计日志检查点同样由设备签名
+	logPath := filepath.Join(tempDir, "audit.log")
+	auditLog, err := securityManager.OpenAuditLog(ctx, logPath, pair.PrivateKeyID, AuditLogOptions{})
+	if err != nil {
+		t.Fatalf("打开审计日志失败: %v", err)
+	}
+	auditLog.Append("test", "subject", nil)
+	if err := auditLog.Close(); err != nil {
+		t.Fatalf("关闭审计日志失败: %v", err)
+	}
+	if report, err := securityManager.VerifyAuditLog(ctx, logPath, pair.PrivateKeyID); err != nil || report.Checkpoints == 0 {
+		t.Errorf("硬件密钥签名的审计日志验证失败: %+v, %v", report, err)
+	}
+
+	if err := keyManager.DeleteKey(ctx, pair.PrivateKeyID); err != nil {
+		t.Fatalf("删除硬件密钥失败: %v", err)
+	}
+	if len(token.keys) != 0 {
+		t.Error("删除密钥后设备中的私钥应被删除")
+	}
+
+	// 用设备中的RSA密钥包装密钥库
+	if _, err := token.GenerateKey(ctx, "wrapping", RSAPrivateKey, 2048); err != nil {
+		t.Fatalf("生成包装密钥失败: %v", err)
+	}
+	provider, err := NewHardwareKeyProvider(ctx, token, "wrapping")
+	if err != nil {
+		t.Fatalf("创建硬件密钥提供者失败: %v", err)
+	}
+	wrapped, err := provider.WrapKey(ctx, data)
+	if err != nil {
+		t.Fatalf("包装密钥失败: %v", err)
+	}
+	if unwrapped, err := provider.UnwrapKey(ctx, wrapped); err != nil || !bytes.Equal(unwrapped, data) {
+		t.Errorf("解包密钥失败: %v", err)
+	}
+}
+
+// TestHardwareTokenReplace 测试使用硬件密钥时替换设备
+func TestHardwareTokenReplace(t *testing.T) {
+	tempDir, securityManager := setupTestEnvironment(t)
+	defer teardownTestEnvironment(tempDir, securityManager)
+	ctx := context.Background()
+	keyManager := securityManager.GetKeyManager().(*DefaultKeyManager)
+	token := &memoryToken{keys: make(map[string]crypto.Signer)}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			keyManager.SetHardwareToken(nil)
+			keyManager.SetHardwareToken(token)
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		if _, err := keyManager.GenerateHardwareKeyPair(ctx, ECPrivateKey, nil); err != nil && !errors.Is(err, ErrNoHardwareToken) {
+			t.Fatalf("在设备中生成密钥对失败: %v", err)
+		}
+	}
+	<-done
+}
+
+// TestPKCS11Config 测试PKCS#11设备配置的检查
+func TestPKCS11Config(t *testing.T) {
+	if _, err := NewPKCS11Token(PKCS11Config{TokenLabel: "fragmenta"}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("没有模块路径时应返回ErrInvalidArgument: %v", err)
+	}
+	if _, err := NewPKCS11Token(PKCS11Config{Path: "/nonexistent/libpkcs11.so"}); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("没有设备标签时应返回ErrInvalidArgument: %v", err)
+	}
+}
+
+// TestSecretBuffer 测试密钥缓冲区的清零和密钥条目的二进制格式
+func TestSecretBuffer(t *testing.T) {
+	data := []byte{1, 2, 3, 4}
+	secret := NewSecretBuffer(data)
+	if !secret.Equal([]byte{1, 2, 3, 4}) || secret.Equal([]byte{1, 2, 3}) || secret.Len() != 4 {
+		t.Fatal("缓冲区比较结果不正确")
+	}
+	secret.Close()
+	if !bytes.Equal(data, make([]byte, 4)) || secret.Bytes() != nil {
+		t.Fatalf("关闭后数据应被清零: %v", data)
+	}
+	if err := secret.Close(); err != nil {
+		t.Fatalf("重复关闭失败: %v", err)
+	}
+
+	ctx := context.Background()
+	storage, err := NewFileSecureStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建安全存储失败: %v", err)
+	}
+	km := NewDefaultKeyManager(storage)
+	keyID, err := km.GenerateKey(ctx, SymmetricKey, nil)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	key, err := km.GetKey(ctx, keyID)
+	if err != nil {
+		t.Fatalf("获取密钥失败: %v", err)
+	}
+
+	// 密钥条目不再以JSON保存
+	record, err := storage.Retrieve(ctx, keyID)
+	if err != nil {
+		t.Fatalf("读取密钥记录失败: %v", err)
+	}
+	if !bytes.HasPrefix(record, []byte(keyEntryMagic)) || bytes.Contains(record, []byte(base64.StdEncoding.EncodeToString(key))) {
+		t.Error("密钥记录应为二进制格式")
+	}
+
+	secret, err = km.GetKeySecret(ctx, keyID)
+	if err != nil {
+		t.Fatalf("获取密钥失败: %v", err)
+	}
+	if !secret.Equal(key) {
+		t.Error("GetKeySecret 与 GetKey 返回的密钥不一致")
+	}
+	secret.Close()
+
+	// 旧版本的JSON条目仍然可以读取
+	legacy, _ := json.Marshal(&KeyEntry{Key: key, Metadata: map[string]string{"type": string(SymmetricKey)}, CreatedAt: time.Now()})
+	if err := storage.Store(ctx, "legacy-key", legacy); err != nil {
+		t.Fatalf("写入旧格式密钥失败: %v", err)
+	}
+	if got, err := km.GetKey(ctx, "legacy-key"); err != nil || !bytes.Equal(got, key) {
+		t.Errorf("读取旧格式密钥失败: %v", err)
+	}
+
+	// 元数据和时间在序列化后保持不变
+	entry := &KeyEntry{
+		Key:       key,
+		Metadata:  map[string]string{"type": "symmetric", "note": "备注"},
+		CreatedAt: time.Unix(1700000000, 123),
+	}
+	serialized, err := serializeKeyEntry(entry)
+	if err != nil {
+		t.Fatalf("序列化密钥条目失败: %v", err)
+	}
+	decoded, err := deserializeKeyEntry(serialized)
+	if err != nil {
+		t.Fatalf("反序列化密钥条目失败: %v", err)
+	}
+	if _, err := deserializeKeyEntry(serialized[:len(serialized)-1]); err == nil {
+		t.Error("截断的密钥条目应解析失败")
+	}
+	wipe(serialized)
+	if !bytes.Equal(decoded.Key, key) || decoded.Metadata["note"] != "备注" || !decoded.CreatedAt.Equal(entry.CreatedAt) || !decoded.ExpiresAt.IsZero() {
+		t.Errorf("密钥条目反序列化结果不正确: %+v", decoded)
+	}
+}
+
+// TestListKeyEntries 测试按条件列出密钥
+func TestListKeyEntries(t *testing.T) {
+	ctx := context.Background()
+	storage, err := NewFileSecureStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建安全存储失败: %v", err)
+	}
+	km := NewDefaultKeyManager(storage)
+
+	encryptionKey, err := km.GenerateKey(ctx, SymmetricKey, nil)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	expiringKey, err := km.GenerateKey(ctx, SymmetricKey, &KeyOptions{
+		Type:           SymmetricKey,
+		Size:           256,
+		Usage:          []KeyUsage{EncryptionUsage, DeriveUsage},
+		RotationPolicy: &RotationPolicy{IntervalSeconds: 3600},
+	})
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	pair, err := km.GenerateKeyPair(ctx, ED25519PrivateKey, nil)
+	if err != nil {
+		t.Fatalf("生成密钥对失败: %v", err)
+	}
+
+	ids := func(list *KeyList) []string {
+		var ids []string
+		for _, key := range list.Keys {
+			ids = append(ids, key.ID)
+		}
+		return ids
+	}
+
+	all, err := km.ListKeyEntries(ctx, nil)
+	if err != nil {
+		t.Fatalf("列出密钥失败: %v", err)
+	}
+	if len(all.Keys) != 4 || all.NextPageToken != "" {
+		t.Fatalf("应列出全部4个密钥: %v", ids(all))
+	}
+	for _, key := range all.Keys {
+		if key.CreatedAt.IsZero() || key.Size == 0 || len(key.Usage) == 0 {
+			t.Errorf("密钥信息不完整: %+v", key)
+		}
+	}
+
+	list, _ := km.ListKeyEntries(ctx, &KeyFilter{Types: []KeyType{ED25519PrivateKey}})
+	if got := ids(list); len(got) != 1 || got[0] != pair.PrivateKeyID {
+		t.Errorf("按类型过滤结果不正确: %v", got)
+	}
+	list, _ = km.ListKeyEntries(ctx, &KeyFilter{Usage: DeriveUsage})
+	if got := ids(list); len(got) != 1 || got[0] != expiringKey {
+		t.Errorf("按用途过滤结果不正确: %v", got)
+	}
+	list, _ = km.ListKeyEntries(ctx, &KeyFilter{Usage: EncryptionUsage})
+	if got := ids(list); len(got) != 2 || !slices.Contains(got, encryptionKey) {
+		t.Errorf("对称密钥默认应用于加密: %v", got)
+	}
+	list, _ = km.ListKeyEntries(ctx, &KeyFilter{ExpiresBefore: time.Now().Add(2 * time.Hour)})
+	if got := ids(list); len(got) != 1 || got[0] != expiringKey {
+		t.Errorf("按到期时间过滤结果不正确: %v", got)
+	}
+	list, _ = km.ListKeyEntries(ctx, &KeyFilter{ExpiresAfter: time.Now().Add(2 * time.Hour)})
+	if got := ids(list); len(got) != 3 || slices.Contains(got, expiringKey) {
+		t.Errorf("排除即将到期密钥的结果不正确: %v", got)
+	}
+
+	// 分页遍历得到的结果与一次列出的一致
+	var paged []string
+	filter := &KeyFilter{Limit: 3}
+	for {
+		page, err := km.ListKeyEntries(ctx, filter)
+		if err != nil {
+			t.Fatalf("分页列出密钥失败: %v", err)
+		}
+		paged = append(paged, ids(page)...)
+		if page.NextPageToken == "" {
+			break
+		}
+		filter.PageToken = page.NextPageToken
+	}
+	if !slices.Equal(paged, ids(all)) {
+		t.Errorf("分页结果不一致: %v != %v", paged, ids(all))
+	}
+}
+
+// TestKeyRotationScheduler 测试轮换调度自动轮换临近过期的密钥
+func TestKeyRotationScheduler(t *testing.T) {
+	ctx := context.Background()
+	securityManager, err := NewDefaultSecurityManager(&SecurityConfig{
+		EncryptionEnabled:     true,
+		DefaultAlgorithm:      AES256GCM,
+		KeyStorePath:          t.TempDir(),
+		RotationCheckInterval: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("创建安全管理器失败: %v", err)
+	}
+	km := securityManager.GetKeyManager()
+
+	// 有效期1秒，剩余不足0.1秒时轮换
+	autoKey, err := km.GenerateKey(ctx, SymmetricKey, &KeyOptions{
+		Type:           SymmetricKey,
+		Size:           256,
+		RotationPolicy: &RotationPolicy{IntervalSeconds: 1, AutoRotate: true},
+	})
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	manualKey, err := km.GenerateKey(ctx, SymmetricKey, &KeyOptions{
+		Type:           SymmetricKey,
+		Size:           256,
+		RotationPolicy: &RotationPolicy{IntervalSeconds: 1},
+	})
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	securityManager.SetDefaultKey(autoKey)
+
+	rotated := make(chan [2]string, 16)
+	securityManager.AddRotationHook(func(ctx context.Context, oldKeyID, newKeyID string) error {
+		rotated <- [2]string{oldKeyID, newKeyID}
+		return errors.New("reencrypt failed")
+	})
+	var mu sync.Mutex
+	var outcomes []SecurityEvent
+	securityManager.AddEventHook(func(event SecurityEvent) {
+		if event.Type == AuditKeyAutoRotate {
+			mu.Lock()
+			outcomes = append(outcomes, event)
+			mu.Unlock()
+		}
+	})
+
+	if err := securityManager.Initialize(ctx); err != nil {
+		t.Fatalf("初始化安全管理器失败: %v", err)
+	}
+	var keys [2]string
+	select {
+	case keys = <-rotated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("密钥没有被自动轮换")
+	}
+	if err := securityManager.Shutdown(ctx); err != nil {
+		t.Fatalf("关闭安全管理器失败: %v", err)
+	}
+
+	if keys[0] != autoKey {
+		t.Fatalf("轮换的密钥不正确: %v", keys)
+	}
+	if securityManager.GetDefaultKey() == autoKey {
+		t.Error("默认密钥应切换为新密钥")
+	}
+	entry, err := km.(*DefaultKeyManager).RetrieveKeyEntry(ctx, keys[1])
+	if err != nil {
+		t.Fatalf("读取新密钥失败: %v", err)
+	}
+	if policy := keyRotationPolicy(entry); policy == nil || !policy.AutoRotate || entry.ExpiresAt.IsZero() {
+		t.Errorf("新密钥应沿用轮换策略: %v", entry.Metadata)
+	}
+	old, _ := km.(*DefaultKeyManager).RetrieveKeyEntry(ctx, autoKey)
+	if old.Metadata[rotatedToMetadata] != keys[1] {
+		t.Errorf("旧密钥应记录继任密钥: %v", old.Metadata)
+	}
+	if manual, _ := km.(*DefaultKeyManager).RetrieveKeyEntry(ctx, manualKey); manual.Metadata[rotatedToMetadata] != "" {
+		t.Error("未启用自动轮换的密钥不应被轮换")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(outcomes) == 0 || outcomes[0].Subject != autoKey || outcomes[0].Details["result"] != "reencrypt_failed" {
+		t.Errorf("轮换结果记录不正确: %+v", outcomes)
+	}
+}
+
+// TestSecurityEvents 测试安全事件回调
+func TestSecurityEvents(t *testing.T) {
+	tempDir, securityManager := setupTestEnvironment(t)
+	defer teardownTestEnvironment(tempDir, securityManager)
+	ctx := context.Background()
+
+	var mu sync.Mutex
+	var events []SecurityEvent
+	remove := securityManager.AddEventHook(func(event SecurityEvent) {
+		mu.Lock()
+		events = append(events, event)
+		mu.Unlock()
+	})
+	lastEvent := func(eventType string) *SecurityEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		for i := len(events) - 1; i >= 0; i-- {
+			if events[i].Type == eventType {
+				return &events[i]
+			}
+		}
+		return nil
+	}
+
+	keyID, err := securityManager.GetKeyManager().GenerateKey(ctx, SymmetricKey, nil)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	if event := lastEvent(AuditKeyGenerate); event == nil || event.Subject != keyID {
+		t.Errorf("应发出密钥生成事件: %+v", event)
+	}
+
+	sealed, err := securityManager.EncryptBlock(ctx, 4, []byte("block data"))
+	if err != nil {
+		t.Fatalf("加密数据块失败: %v", err)
+	}
+	if event := lastEvent(EventKeyAccess); event == nil || event.Subject != securityManager.GetDefaultKey() {
+		t.Errorf("应发出密钥读取事件: %+v", event)
+	}
+
+	sealed[len(sealed)-1] ^= 1
+	if _, err := securityManager.DecryptBlock(ctx, 4, sealed); err == nil {
+		t.Fatal("篡改后的数据块不应解密成功")
+	}
+	event := lastEvent(EventDecryptFailure)
+	if event == nil || event.Details["block_id"] != "4" || event.Subject != securityManager.GetDefaultKey() || event.Error == "" {
+		t.Errorf("解密失败事件不正确: %+v", event)
+	}
+
+	signature, err := securityManager.SignBlock(ctx, keyID, 4, []byte("block data"))
+	if err != nil {
+		t.Fatalf("块签名失败: %v", err)
+	}
+	if valid, _ := securityManager.VerifyBlock(ctx, keyID, 4, []byte("tampered"), signature); valid {
+		t.Fatal("篡改后的数据不应通过验证")
+	}
+	if event := lastEvent(EventSignatureInvalid); event == nil || event.Subject != keyID || event.Details["block_id"] != "4" {
+		t.Errorf("签名验证失败事件不正确: %+v", event)
+	}
+
+	// 注销后不再收到事件
+	remove()
+	mu.Lock()
+	count := len(events)
+	mu.Unlock()
+	securityManager.GetKeyManager().GenerateKey(ctx, SymmetricKey, nil)
+	if len(events) != count {
+		t.Error("注销回调后不应再收到事件")
+	}
+}
+
+// TestAuditLog 测试审计日志的哈希链、签名检查点以及篡改和截断检测
+func TestAuditLog(t *testing.T) {
+	tempDir, securityManager := setupTestEnvironment(t)
+	defer teardownTestEnvironment(tempDir, securityManager)
+	ctx := context.Background()
+	keyManager := securityManager.GetKeyManager()
+
+	pair, err := keyManager.GenerateKeyPair(ctx, ED25519PrivateKey, nil)
+	if err != nil {
+		t.Fatalf("生成审计签名密钥对失败: %v", err)
+	}
+
+	logPath := filepath.Join(tempDir, "audit.log")
+	auditLog, err := securityManager.OpenAuditLog(ctx, logPath, pair.PrivateKeyID, AuditLogOptions{CheckpointEvery: 3})
+	if err != nil {
+		t.Fatalf("打开审计日志失败: %v", err)
+	}
+
+	// 密钥操作由密钥管理器和安全管理器记录
+	keyID, err := keyManager.GenerateKey(ctx, SymmetricKey, nil)
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	securityManager.SetDefaultKey(keyID)
+	if _, err := keyManager.RotateKey(ctx, keyID, nil); err != nil {
+		t.Fatalf("轮换密钥失败: %v", err)
+	}
+	if err := keyManager.DeleteKey(ctx, keyID); err != nil {
+		t.Fatalf("删除密钥失败: %v", err)
+	}
+	if err := auditLog.Close(); err != nil {
+		t.Fatalf("关闭审计日志失败: %v", err)
+	}
+
+	// 重新打开后从最后一条记录继续
+	auditLog, err = securityManager.OpenAuditLog(ctx, logPath, pair.PrivateKeyID, AuditLogOptions{})
+	if err != nil {
+		t.Fatalf("重新打开审计日志失败: %v", err)
+	}
+	if err := auditLog.Append(AuditMetadataSet, "test.frag", map[string]string{"tag": "1"}); err != nil {
+		t.Fatalf("追加审计记录失败: %v", err)
+	}
+	if err := auditLog.Close(); err != nil {
+		t.Fatalf("关闭审计日志失败: %v", err)
+	}
+
+	report, err := securityManager.VerifyAuditLog(ctx, logPath, pair.PrivateKeyID)
+	if err != nil {
+		t.Fatalf("验证审计日志失败: %v", err)
+	}
+	if report.Unsigned != 0 || report.Checkpoints < 2 || report.LastCheckpointSeq != report.LastSeq {
+		t.Errorf("验证结果不符合预期: %+v", report)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("读取审计日志失败: %v", err)
+	}
+	lines := strings.SplitAfter(strings.TrimSuffix(string(data), "\n"), "\n")
+	var actions []string
+	for _, line := range lines {
+		var r AuditRecord
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatalf("解析审计记录失败: %v", err)
+		}
+		if r.Action != AuditCheckpoint {
+			actions = append(actions, r.Action)
+		}
+	}
+	want := []string{AuditKeyGenerate, AuditKeySetDefault, AuditKeyGenerate, AuditKeyRotate, AuditKeyDelete, AuditMetadataSet}
+	if strings.Join(actions, ",") != strings.Join(want, ",") {
+		t.Errorf("审计记录为 %v, 期望 %v", actions, want)
+	}
+
+	// 写入修改后的日志副本并验证
+	verifyCopy := func(name string, content string) error {
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("写入日志副本失败: %v", err)
+		}
+		head, err := os.ReadFile(logPath + ".head")
+		if err != nil {
+			t.Fatalf("读取检查点文件失败: %v", err)
+		}
+		if err := os.WriteFile(path+".head", head, 0600); err != nil {
+			t.Fatalf("写入检查点文件失败: %v", err)
+		}
+		_, err = securityManager.VerifyAuditLog(ctx, path, pair.PrivateKeyID)
+		return err
+	}
+
+	// 修改记录内容
+	tampered := strings.Replace(string(data), `"action":"key.delete"`, `"action":"key.import"`, 1)
+	if err := verifyCopy("tampered.log", tampered); !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("修改记录应被发现, 错误: %v", err)
+	}
+
+	// 删除中间的记录
+	removed := strings.Join(append(append([]string{}, lines[:2]...), lines[3:]...), "")
+	if err := verifyCopy("removed.log", removed); !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("删除中间记录应被发现, 错误: %v", err)
+	}
+
+	// 截掉尾部的记录，剩余部分的哈希链仍然完整
+	truncated := strings.Join(lines[:len(lines)-2], "")
+	if err := verifyCopy("truncated.log", truncated); !errors.Is(err, ErrAuditTruncated) {
+		t.Errorf("截断应被发现, 错误: %v", err)
+	}
+
+	// 用其他密钥验证签名
+	other, err := keyManager.GenerateKeyPair(ctx, ED25519PrivateKey, nil)
+	if err != nil {
+		t.Fatalf("生成密钥对失败: %v", err)
+	}
+	if _, err := securityManager.VerifyAuditLog(ctx, logPath, other.PrivateKeyID); !errors.Is(err, ErrAuditTampered) {
+		t.Errorf("其他密钥不应通过签名验证, 错误: %v", err)
+	}
+}
+
+// TestAccessControlAuthorize 测试按命名空间和标签范围授权、ACL拒绝优先以及上下文身份检查
+func TestAccessControlAuthorize(t *testing.T) {
+	ctx := context.Background()
+	acm := NewAccessControlManager()
+	rbac := acm.GetRBACManager()
+
+	editor := NewRole("editor", "Editor", "")
+	editor.AddPermission(FileResource, "/projects", ReadOperation, WriteOperation)
+	editor.AddPermission(MetadataResource, "0x1000-0x1fff", ReadOperation, WriteOperation, DeleteOperation)
+	if err := rbac.CreateRole(ctx, editor); err != nil {
+		t.Fatalf("创建角色失败: %v", err)
+	}
+	if err := rbac.AddRoleToSubject(ctx, "alice", "editor"); err != nil {
+		t.Fatalf("分配角色失败: %v", err)
+	}
+
+	recorder := &memoryAuditRecorder{}
+	acm.SetAuditRecorder(recorder)
+	alice := WithSubject(ctx, NewSubject("alice", UserSubject, nil))
+
+	cases := []struct {
+		resource  Resource
+		operation Operation
+		allowed   bool
+	}{
+		{NewResource("/projects/a/doc.txt", FileResource, nil), WriteOperation, true},
+		{NewResource("/projects", FileResource, nil), ReadOperation, true},
+		{NewResource("/projects-old/doc.txt", FileResource, nil), ReadOperation, false},
+		{NewResource("/projects/a/doc.txt", FileResource, nil), DeleteOperation, false},
+		{NewMetadataResource(0x1000), WriteOperation, true},
+		{NewMetadataResource(0x1fff), DeleteOperation, true},
+		{NewMetadataResource(0x2000), ReadOperation, false},
+		{NewBlockResource(7), ReadOperation, false},
+	}
+	for _, c := range cases {
+		err := acm.Authorize(alice, c.resource, c.operation)
+		if c.allowed && err != nil {
+			t.Errorf("%s %s:%s 应被允许: %v", c.operation, c.resource.Type, c.resource.ID, err)
+		}
+		if !c.allowed && !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("%s %s:%s 应被拒绝, 错误: %v", c.operation, c.resource.Type, c.resource.ID, err)
+		}
+	}
+	if len(recorder.actions) != 4 || recorder.actions[0] != AuditAccessDenied {
+		t.Errorf("被拒绝的访问应写入审计记录: %v", recorder.actions)
+	}
+
+	// 上下文中没有身份时不做检查
+	if err := acm.Authorize(ctx, NewBlockResource(7), DeleteOperation); err != nil {
+		t.Errorf("没有身份的上下文不应被拒绝: %v", err)
+	}
+
+	// ACL明确拒绝优先于角色权限
+	deny := NewACLEntry(NewSubject("alice", UserSubject, nil), NewMetadataResource(0x1234), WriteOperation, DenyPolicy)
+	if err := acm.GetACLManager().AddEntry(ctx, deny); err != nil {
+		t.Fatalf("添加ACL条目失败: %v", err)
+	}
+	if err := acm.Authorize(alice, NewMetadataResource(0x1234), WriteOperation); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("ACL拒绝应优先于角色权限, 错误: %v", err)
+	}
+	if err := acm.Authorize(alice, NewMetadataResource(0x1235), WriteOperation); err != nil {
+		t.Errorf("未被ACL拒绝的标签应被允许: %v", err)
+	}
+}
+
+// memoryAuditRecorder 在内存中记录审计操作
+type memoryAuditRecorder struct {
+	actions []string
+}
+
+func (r *memoryAuditRecorder) Append(action, subject string, details map[string]string) error {
+	r.actions = append(r.actions, action)
+	return nil
+}
+
+// TestTypedErrors 测试密钥过期、密钥不存在、参数错误和权限拒绝可以用errors.Is/As区分
+func TestTypedErrors(t *testing.T) {
+	ctx := context.Background()
+	storage, err := NewFileSecureStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("创建安全存储失败: %v", err)
+	}
+	fakeClock := clock.NewFake(time.Now())
+	km := NewDefaultKeyManager(storage)
+	km.SetClock(fakeClock)
+
+	keyID, err := km.GenerateKey(ctx, SymmetricKey, &KeyOptions{
+		Type:           SymmetricKey,
+		Size:           256,
+		RotationPolicy: &RotationPolicy{IntervalSeconds: 60},
+	})
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	fakeClock.Advance(2 * time.Minute)
+	_, err = km.GetKey(ctx, keyID)
+	var keyErr *KeyError
+	if !errors.Is(err, ErrKeyExpired) || !errors.As(err, &keyErr) || keyErr.KeyID != keyID {
+		t.Errorf("过期密钥应返回带密钥ID的ErrKeyExpired: %v", err)
+	}
+
+	if _, err := km.GetKey(ctx, "missing"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("不存在的密钥应返回ErrKeyNotFound: %v", err)
+	}
+	if _, err := km.GetKey(ctx, ""); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("空密钥ID应返回ErrInvalidArgument: %v", err)
+	}
+
+	acm := NewAccessControlManager()
+	bob := WithSubject(ctx, NewSubject("bob", UserSubject, nil))
+	err = acm.Authorize(bob, NewBlockResource(7), ReadOperation)
+	var permErr *PermissionError
+	if !errors.Is(err, ErrPermissionDenied) || !errors.As(err, &permErr) {
+		t.Fatalf("拒绝访问应返回PermissionError: %v", err)
+	}
+	if permErr.Subject != "bob" || permErr.Operation != ReadOperation || permErr.Resource.ID != "7" {
+		t.Errorf("PermissionError字段不正确: %+v", permErr)
+	}
+}
+
+// TestCryptoErase 测试按对象生成数据密钥，销毁后对象的块无法解密而其他对象不受影响
+func TestCryptoErase(t *testing.T) {
+	tempDir, securityManager := setupTestEnvironment(t)
+	defer teardownTestEnvironment(tempDir, securityManager)
+	ctx := context.Background()
+
+	var erased []SecurityEvent
+	securityManager.AddEventHook(func(event SecurityEvent) {
+		if event.Type == AuditObjectErase {
+			erased = append(erased, event)
+		}
+	})
+
+	keyA, err := securityManager.ObjectKey(ctx, "tenant-a")
+	if err != nil {
+		t.Fatalf("生成对象数据密钥失败: %v", err)
+	}
+	if again, _ := securityManager.ObjectKey(ctx, "tenant-a"); again != keyA {
+		t.Errorf("同一对象应使用同一数据密钥: %s, %s", keyA, again)
+	}
+	sealedA, err := securityManager.EncryptObjectBlock(ctx, "tenant-a", 1, []byte("data a"))
+	if err != nil {
+		t.Fatalf("加密对象数据块失败: %v", err)
+	}
+	sealedB, err := securityManager.EncryptObjectBlock(ctx, "tenant-b", 2, []byte("data b"))
+	if err != nil {
+		t.Fatalf("加密对象数据块失败: %v", err)
+	}
+	if envelope, _ := ParseBlockEnvelope(sealedA); envelope == nil || envelope.KeyID != keyA {
+		t.Errorf("信封应记录对象数据密钥: %+v", envelope)
+	}
+	if plain, err := securityManager.DecryptBlock(ctx, 1, sealedA); err != nil || string(plain) != "data a" {
+		t.Fatalf("解密对象数据块失败: %q, %v", plain, err)
+	}
+
+	// 轮换后旧密钥也一并销毁
+	rotated, err := securityManager.GetKeyManager().RotateKey(ctx, keyA, nil)
+	if err != nil {
+		t.Fatalf("轮换对象数据密钥失败: %v", err)
+	}
+	securityManager.objectKeys = nil
+	if current, _ := securityManager.ObjectKey(ctx, "tenant-a"); current != rotated {
+		t.Errorf("轮换后应使用新密钥: %s", current)
+	}
+
+	if err := securityManager.CryptoErase(ctx, "tenant-a"); err != nil {
+		t.Fatalf("销毁对象数据密钥失败: %v", err)
+	}
+	if _, err := securityManager.DecryptBlock(ctx, 1, sealedA); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("销毁后不应能解密: %v", err)
+	}
+	if plain, err := securityManager.DecryptBlock(ctx, 2, sealedB); err != nil || string(plain) != "data b" {
+		t.Errorf("其他对象不应受影响: %q, %v", plain, err)
+	}
+	wantKeys := []string{keyA, rotated}
+	slices.Sort(wantKeys)
+	if len(erased) != 1 || erased[0].Subject != "tenant-a" || erased[0].Details["keys"] != strings.Join(wantKeys, ",") {
+		t.Errorf("销毁事件不正确: %+v", erased)
+	}
+
+	if err := securityManager.CryptoErase(ctx, "tenant-a"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("没有数据密钥的对象应返回 ErrKeyNotFound: %v", err)
+	}
+	if fresh, err := securityManager.ObjectKey(ctx, "tenant-a"); err != nil || fresh == keyA || fresh == rotated {
+		t.Errorf("销毁后应生成新的数据密钥: %s, %v", fresh, err)
+	}
+}
@@ -1,6 +1,7 @@
 package security
 
 import (
+	"bytes"
 	"context"
 	"crypto"
 	"crypto/ecdsa"
@@ -110,6 +111,9 @@ type SignedData struct {
 
 	// 附加数据
 	AdditionalData []byte `json:"additional_data,omitempty"`
+
+	// 签名者证书链（DER编码），第一张为签名者证书
+	Certificates [][]byte `json:"certificates,omitempty"`
 }
 
 // signFunc 签名函数类型
@@ -251,6 +255,62 @@ func (p *DefaultSignatureProvider) Sign(ctx context.Context, algorithm string, p
 	return info.Sign(ctx, algorithm, privateKey, data)
 }
 
+// SignWithSigner 用 crypto.Signer 签名，私钥不离开签名者（如硬件设备）。
+// 签名格式与 Sign 相同，可以用 Verify 验证
+func (p *DefaultSignatureProvider) SignWithSigner(ctx context.Context, algorithm string, signer crypto.Signer, data []byte) ([]byte, error) {
+	info, exists := p.algorithms[algorithm]
+	if !exists {
+		return nil, fmt.Errorf("unsupported algorithm: %s", algorithm)
+	}
+	if info.KeyType == SymmetricKey {
+		return nil, fmt.Errorf("algorithm %s requires a symmetric key", algorithm)
+	}
+
+	var h crypto.Hash
+	var opts crypto.SignerOpts
+	switch SignatureAlgorithmName(algorithm) {
+	case RSA_PKCS1_SHA256, ECDSA_P256_SHA256:
+		h, opts = crypto.SHA256, crypto.SHA256
+	case RSA_PKCS1_SHA512:
+		h, opts = crypto.SHA512, crypto.SHA512
+	case ECDSA_P384_SHA384:
+		h, opts = crypto.SHA384, crypto.SHA384
+	case RSA_PSS_SHA256:
+		h = crypto.SHA256
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: h}
+	case RSA_PSS_SHA512:
+		h = crypto.SHA512
+		opts = &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: h}
+	case ED25519:
+		opts = crypto.Hash(0)
+	}
+
+	// Ed25519直接签名原始数据，其他算法签名数据哈希
+	digest := data
+	var hashed []byte
+	if h != 0 {
+		hasher := h.New()
+		hasher.Write(data)
+		hashed = hasher.Sum(nil)
+		digest = hashed
+	}
+
+	signature, err := signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign data: %w", err)
+	}
+
+	serialized, err := json.Marshal(&SignedData{
+		Algorithm: algorithm,
+		DataHash:  hashed,
+		Signature: signature,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize signed data: %w", err)
+	}
+	return serialized, nil
+}
+
 // Verify 验证数据签名
 func (p *DefaultSignatureProvider) Verify(ctx context.Context, algorithm string, publicKey []byte, data []byte, signature []byte) (bool, error) {
 	// 获取算法信息
@@ -471,14 +531,12 @@ func (p *DefaultSignatureProvider) verifyRSA(ctx context.Context, algorithm stri
 		return false, fmt.Errorf("unsupported RSA algorithm: %s", algorithm)
 	}
 
-	// 计算数据哈希（如果未提供）
-	var hashed []byte
-	if signedData.DataHash != nil {
-		hashed = signedData.DataHash
-	} else {
-		hasher := h.New()
-		hasher.Write(data)
-		hashed = hasher.Sum(nil)
+	// 计算数据哈希，签名中记录的哈希只用于校验，不能代替数据本身
+	hasher := h.New()
+	hasher.Write(data)
+	hashed := hasher.Sum(nil)
+	if signedData.DataHash != nil && !bytes.Equal(signedData.DataHash, hashed) {
+		return false, nil
 	}
 
 	// 验证签名
@@ -590,14 +648,12 @@ func (p *DefaultSignatureProvider) verifyECDSA(ctx context.Context, algorithm st
 		return false, fmt.Errorf("unsupported ECDSA algorithm: %s", algorithm)
 	}
 
-	// 计算数据哈希（如果未提供）
-	var hashed []byte
-	if signedData.DataHash != nil {
-		hashed = signedData.DataHash
-	} else {
-		hasher := h.New()
-		hasher.Write(data)
-		hashed = hasher.Sum(nil)
+	// 计算数据哈希，签名中记录的哈希只用于校验，不能代替数据本身
+	hasher := h.New()
+	hasher.Write(data)
+	hashed := hasher.Sum(nil)
+	if signedData.DataHash != nil && !bytes.Equal(signedData.DataHash, hashed) {
+		return false, nil
 	}
 
 	// 解析签名为r, s
@@ -4,11 +4,12 @@ import (
 	"context"
 	"encoding/hex"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
 	"sync"
+
+	"github.com/bpfs/fragmenta/vfs"
 )
 
 // FileSecureStorage 基于文件系统的安全存储
@@ -16,19 +17,30 @@ type FileSecureStorage struct {
 	// 存储根路径
 	rootPath string
 
+	// 文件系统
+	fsys vfs.FS
+
 	// 文件操作锁
 	fileLocks sync.Map
 }
 
 // NewFileSecureStorage 创建文件安全存储
 func NewFileSecureStorage(rootPath string) (*FileSecureStorage, error) {
+	return NewFileSecureStorageFS(vfs.OS, rootPath)
+}
+
+// NewFileSecureStorageFS 在指定的文件系统上创建文件安全存储，fsys为nil时使用操作系统的文件系统
+func NewFileSecureStorageFS(fsys vfs.FS, rootPath string) (*FileSecureStorage, error) {
+	fsys = vfs.OrOS(fsys)
+
 	// 确保存储目录存在
-	if err := os.MkdirAll(rootPath, 0700); err != nil {
+	if err := fsys.MkdirAll(rootPath, 0700); err != nil {
 		return nil, fmt.Errorf("failed to create directory: %w", err)
 	}
 
 	return &FileSecureStorage{
 		rootPath: rootPath,
+		fsys:     fsys,
 	}, nil
 }
 
@@ -49,20 +61,20 @@ func (fs *FileSecureStorage) Store(ctx context.Context, key string, data []byte)
 
 	// 确保目录存在
 	dirPath := filepath.Dir(filePath)
-	if err := os.MkdirAll(dirPath, 0700); err != nil {
+	if err := fs.fsys.MkdirAll(dirPath, 0700); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
 	// 以安全的方式写入文件
 	// 先写入临时文件，然后重命名，以确保原子性
 	tempPath := filePath + ".tmp"
-	if err := ioutil.WriteFile(tempPath, data, 0600); err != nil {
+	if err := fs.fsys.WriteFile(tempPath, data, 0600); err != nil {
 		return fmt.Errorf("failed to write temporary file: %w", err)
 	}
 
 	// 重命名文件
-	if err := os.Rename(tempPath, filePath); err != nil {
-		os.Remove(tempPath) // 清理临时文件
+	if err := fs.fsys.Rename(tempPath, filePath); err != nil {
+		fs.fsys.Remove(tempPath) // 清理临时文件
 		return fmt.Errorf("failed to rename file: %w", err)
 	}
 
@@ -85,10 +97,10 @@ func (fs *FileSecureStorage) Retrieve(ctx context.Context, key string) ([]byte,
 	defer lock.RUnlock()
 
 	// 读取文件
-	data, err := ioutil.ReadFile(filePath)
+	data, err := fs.fsys.ReadFile(filePath)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("key not found: %s", key)
+			return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
 		}
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
@@ -112,7 +124,7 @@ func (fs *FileSecureStorage) Delete(ctx context.Context, key string) error {
 	defer lock.Unlock()
 
 	// 删除文件
-	err := os.Remove(filePath)
+	err := fs.fsys.Remove(filePath)
 	if err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to delete file: %w", err)
 	}
@@ -125,22 +137,26 @@ func (fs *FileSecureStorage) List(ctx context.Context) ([]string, error) {
 	keys := []string{}
 
 	// 遍历存储目录
-	err := filepath.Walk(fs.rootPath, func(path string, info os.FileInfo, err error) error {
+	err := vfs.WalkDir(fs.fsys, fs.rootPath, func(path string, entry os.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
 
 		// 只处理文件
-		if !info.IsDir() && !strings.HasSuffix(path, ".tmp") {
+		if !entry.IsDir() && !strings.HasSuffix(path, ".tmp") {
 			// 获取相对路径
 			relPath, err := filepath.Rel(fs.rootPath, path)
 			if err != nil {
 				return err
 			}
 
-			// 获取键名
-			key := filepath.ToSlash(relPath)
-			keys = append(keys, key)
+			// 文件路径是键名十六进制编码后拆分的目录和文件名，还原出键名
+			key, err := hex.DecodeString(strings.ReplaceAll(filepath.ToSlash(relPath), "/", ""))
+			if err != nil {
+				// 不是由Store写入的文件
+				return nil
+			}
+			keys = append(keys, string(key))
 		}
 
 		return nil
@@ -18,6 +18,9 @@ const (
 	// ChaCha20Poly1305 ChaCha20-Poly1305加密
 	ChaCha20Poly1305 EncryptionAlgorithm = "ChaCha20-Poly1305"
 
+	// XChaCha20Poly1305 XChaCha20-Poly1305加密，24字节随机数
+	XChaCha20Poly1305 EncryptionAlgorithm = "XChaCha20-Poly1305"
+
 	// 非对称加密算法
 	// RSA2048 RSA-2048加密
 	RSA2048 EncryptionAlgorithm = "RSA-2048"
@@ -0,0 +1,323 @@
+package fragmenta
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// 块签名表常量
+const (
+	// SignatureTableMagic 块签名表魔数 "FSIG"
+	SignatureTableMagic uint32 = 0x46534947
+	// SignatureTableVersion 块签名表版本
+	SignatureTableVersion uint16 = 1
+)
+
+// BlockSigner 块签名接口，通常由安全层的安全管理器（security.DefaultSecurityManager）实现。
+// 签名需要覆盖块ID和数据，防止签名被挪用到其他块
+type BlockSigner interface {
+	// SignBlock 用密钥签名数据块，返回分离签名
+	SignBlock(ctx context.Context, keyID string, blockID uint32, data []byte) ([]byte, error)
+
+	// VerifyBlock 用密钥验证数据块的分离签名
+	VerifyBlock(ctx context.Context, keyID string, blockID uint32, data []byte, signature []byte) (bool, error)
+}
+
+// BlockSignature 数据块的分离签名
+type BlockSignature struct {
+	// BlockID 数据块ID
+	BlockID uint32
+
+	// KeyID 签名密钥ID
+	KeyID string
+
+	// SignedAt 签名时间
+	SignedAt time.Time
+
+	// Signature 签名数据
+	Signature []byte
+}
+
+// SetBlockSigner 设置块签名器
+func (f *FragmentaImpl) SetBlockSigner(signer BlockSigner) {
+	f.signatureMutex.Lock()
+	defer f.signatureMutex.Unlock()
+	f.signer = signer
+}
+
+// SignBlock 用密钥签名数据块，签名保存在块签名表中（位置记录在TagBlockSignatures），
+// 同一个块再次签名时替换原签名
+func (f *FragmentaImpl) SignBlock(blockID uint32, keyID string) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+
+	f.signatureMutex.Lock()
+	defer f.signatureMutex.Unlock()
+
+	if f.signer == nil {
+		return errors.New("block signer not set")
+	}
+	if err := f.loadSignaturesLocked(); err != nil {
+		return err
+	}
+
+	data, err := f.ReadBlock(blockID)
+	if err != nil {
+		return err
+	}
+	signature, err := f.signer.SignBlock(context.Background(), keyID, blockID, data)
+	if err != nil {
+		logger.Error("签名数据块失败", "blockID", blockID, "keyID", keyID, "error", err)
+		return err
+	}
+
+	previous := f.signatures[blockID]
+	f.signatures[blockID] = &BlockSignature{
+		BlockID:   blockID,
+		KeyID:     keyID,
+		SignedAt:  f.now(),
+		Signature: signature,
+	}
+	if err := f.saveSignaturesLocked(); err != nil {
+		if previous != nil {
+			f.signatures[blockID] = previous
+		} else {
+			delete(f.signatures, blockID)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// VerifyBlock 用签名时的密钥验证数据块的当前内容，没有签名时返回 ErrSignatureNotFound，
+// 内容或签名被修改时返回包装了 ErrSignatureInvalid 的错误
+func (f *FragmentaImpl) VerifyBlock(blockID uint32) error {
+	f.signatureMutex.Lock()
+	defer f.signatureMutex.Unlock()
+
+	if f.signer == nil {
+		return errors.New("block signer not set")
+	}
+	if err := f.loadSignaturesLocked(); err != nil {
+		return err
+	}
+
+	sig, ok := f.signatures[blockID]
+	if !ok {
+		return ErrSignatureNotFound
+	}
+
+	data, err := f.ReadBlock(blockID)
+	if err != nil {
+		return err
+	}
+	valid, err := f.signer.VerifyBlock(context.Background(), sig.KeyID, blockID, data, sig.Signature)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSignatureInvalid, err)
+	}
+	if !valid {
+		return fmt.Errorf("%w: 块 %d 的内容与签名不符", ErrSignatureInvalid, blockID)
+	}
+
+	return nil
+}
+
+// GetBlockSignature 获取数据块的签名，没有签名时返回 ErrSignatureNotFound
+func (f *FragmentaImpl) GetBlockSignature(blockID uint32) (*BlockSignature, error) {
+	f.signatureMutex.Lock()
+	defer f.signatureMutex.Unlock()
+
+	if err := f.loadSignaturesLocked(); err != nil {
+		return nil, err
+	}
+
+	sig, ok := f.signatures[blockID]
+	if !ok {
+		return nil, ErrSignatureNotFound
+	}
+
+	result := *sig
+	result.Signature = append([]byte(nil), sig.Signature...)
+	return &result, nil
+}
+
+// removeBlockSignature 删除数据块的签名，块被删除时调用
+func (f *FragmentaImpl) removeBlockSignature(blockID uint32) error {
+	f.signatureMutex.Lock()
+	defer f.signatureMutex.Unlock()
+
+	// 签名表本身所在的块不会有签名
+	if blockID == f.signatureBlock {
+		return nil
+	}
+	if err := f.loadSignaturesLocked(); err != nil {
+		return err
+	}
+
+	sig, ok := f.signatures[blockID]
+	if !ok {
+		return nil
+	}
+	delete(f.signatures, blockID)
+	if err := f.saveSignaturesLocked(); err != nil {
+		f.signatures[blockID] = sig
+		return err
+	}
+
+	return nil
+}
+
+// loadSignaturesLocked 首次使用时从TagBlockSignatures加载块签名表，调用方需持有signatureMutex
+func (f *FragmentaImpl) loadSignaturesLocked() error {
+	if f.signatures != nil {
+		return nil
+	}
+
+	value, err := f.GetMetadata(TagBlockSignatures)
+	if err == ErrMetadataNotFound {
+		f.signatures = make(map[uint32]*BlockSignature)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	blockID := uint32(DecodeInt64(value))
+	table, err := f.ReadBlock(blockID)
+	if err != nil {
+		logger.Error("读取块签名表失败", "blockID", blockID, "error", err)
+		return err
+	}
+	signatures, err := decodeSignatureTable(table)
+	if err != nil {
+		logger.Error("解析块签名表失败", "blockID", blockID, "error", err)
+		return err
+	}
+
+	f.signatures = signatures
+	f.signatureBlock = blockID
+	return nil
+}
+
+// saveSignaturesLocked 将块签名表写入新的系统块并更新TagBlockSignatures，调用方需持有signatureMutex
+func (f *FragmentaImpl) saveSignaturesLocked() error {
+	table, err := encodeSignatureTable(f.signatures)
+	if err != nil {
+		return err
+	}
+
+	blockID, err := f.writeBlock(table, &BlockOptions{BlockType: SystemBlockType, Checksum: true})
+	if err != nil {
+		logger.Error("写入块签名表失败", "error", err)
+		return err
+	}
+	if err := f.setMetadata(TagBlockSignatures, EncodeInt64(int64(blockID))); err != nil {
+		logger.Error("更新块签名表位置失败", "error", err)
+		return err
+	}
+
+	// 旧表直接由块管理器释放，不经过DeleteBlock，避免重入签名表
+	if f.signatureBlock != 0 {
+		if err := f.blockManager.DeleteBlock(f.signatureBlock); err != nil {
+			logger.Warn("释放旧块签名表失败", "blockID", f.signatureBlock, "error", err)
+		} else {
+			if err := f.unstoreBlock(f.signatureBlock); err != nil {
+				logger.Warn("从块存储删除旧块签名表失败", "blockID", f.signatureBlock, "error", err)
+			}
+			if err := f.queryRemoveBlock(f.signatureBlock); err != nil {
+				logger.Warn("移除旧块签名表的查询索引失败", "blockID", f.signatureBlock, "error", err)
+			}
+		}
+	}
+	f.signatureBlock = blockID
+
+	return nil
+}
+
+// encodeSignatureTable 编码块签名表
+// 格式: 魔数 | 版本 | 签名数量 | 签名记录(块ID | 签名时间 | 密钥ID长度 | 密钥ID | 签名长度 | 签名)...
+func encodeSignatureTable(signatures map[uint32]*BlockSignature) ([]byte, error) {
+	ids := make([]uint32, 0, len(signatures))
+	for id := range signatures {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	buf := new(bytes.Buffer)
+	fields := []interface{}{SignatureTableMagic, SignatureTableVersion, uint32(len(ids))}
+	for _, id := range ids {
+		sig := signatures[id]
+		if len(sig.KeyID) > 0xFFFF || len(sig.Signature) > 0xFFFF {
+			return nil, fmt.Errorf("块 %d 的密钥ID或签名过长", id)
+		}
+		fields = append(fields,
+			sig.BlockID, sig.SignedAt.UnixNano(),
+			uint16(len(sig.KeyID)), []byte(sig.KeyID),
+			uint16(len(sig.Signature)), sig.Signature)
+	}
+
+	for _, field := range fields {
+		if err := binary.Write(buf, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("编码块签名表失败: %w", err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeSignatureTable 解析块签名表
+func decodeSignatureTable(table []byte) (map[uint32]*BlockSignature, error) {
+	r := bytes.NewReader(table)
+
+	var magic, count uint32
+	var version uint16
+	for _, field := range []interface{}{&magic, &version, &count} {
+		if err := binary.Read(r, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("%w: 块签名表头不完整", ErrInvalidFragmenta)
+		}
+	}
+	if magic != SignatureTableMagic {
+		return nil, fmt.Errorf("%w: 块签名表魔数错误", ErrInvalidFragmenta)
+	}
+	if version > SignatureTableVersion {
+		return nil, ErrUnsupportedVersion
+	}
+
+	signatures := make(map[uint32]*BlockSignature, count)
+	for i := uint32(0); i < count; i++ {
+		sig := &BlockSignature{}
+		var signedAt int64
+		var keyLen, sigLen uint16
+		for _, field := range []interface{}{&sig.BlockID, &signedAt, &keyLen} {
+			if err := binary.Read(r, binary.BigEndian, field); err != nil {
+				return nil, fmt.Errorf("%w: 签名记录不完整", ErrInvalidFragmenta)
+			}
+		}
+		sig.SignedAt = time.Unix(0, signedAt)
+
+		keyID := make([]byte, keyLen)
+		if err := binary.Read(r, binary.BigEndian, keyID); err != nil {
+			return nil, fmt.Errorf("%w: 签名密钥ID不完整", ErrInvalidFragmenta)
+		}
+		sig.KeyID = string(keyID)
+
+		if err := binary.Read(r, binary.BigEndian, &sigLen); err != nil {
+			return nil, fmt.Errorf("%w: 签名记录不完整", ErrInvalidFragmenta)
+		}
+		sig.Signature = make([]byte, sigLen)
+		if err := binary.Read(r, binary.BigEndian, sig.Signature); err != nil {
+			return nil, fmt.Errorf("%w: 签名数据不完整", ErrInvalidFragmenta)
+		}
+
+		signatures[sig.BlockID] = sig
+	}
+
+	return signatures, nil
+}
@@ -0,0 +1,121 @@
+package fragmenta
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+)
+
+// mockBlockSigner 用HMAC-SHA256模拟块签名
+type mockBlockSigner struct {
+	keys map[string][]byte
+}
+
+func (m *mockBlockSigner) mac(keyID string, blockID uint32, data []byte) ([]byte, error) {
+	key, ok := m.keys[keyID]
+	if !ok {
+		return nil, errors.New("key not found")
+	}
+	h := hmac.New(sha256.New, key)
+	binary.Write(h, binary.BigEndian, blockID)
+	h.Write(data)
+	return h.Sum(nil), nil
+}
+
+func (m *mockBlockSigner) SignBlock(ctx context.Context, keyID string, blockID uint32, data []byte) ([]byte, error) {
+	return m.mac(keyID, blockID, data)
+}
+
+func (m *mockBlockSigner) VerifyBlock(ctx context.Context, keyID string, blockID uint32, data []byte, signature []byte) (bool, error) {
+	expected, err := m.mac(keyID, blockID, data)
+	if err != nil {
+		return false, err
+	}
+	return hmac.Equal(expected, signature), nil
+}
+
+// TestBlockSignatures 测试块签名的保存、验证、持久化和随块删除
+func TestBlockSignatures(t *testing.T) {
+	tempFile, err := os.CreateTemp("", "fragdb-signature-*.bin")
+	if err != nil {
+		t.Fatalf("创建临时文件失败: %v", err)
+	}
+	tempFile.Close()
+	defer os.Remove(tempFile.Name())
+
+	f, err := CreateFragmenta(tempFile.Name(), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	signer := &mockBlockSigner{keys: map[string][]byte{"archive": []byte("archive-key")}}
+	f.SetBlockSigner(signer)
+
+	blockID, err := f.WriteBlock([]byte("regulatory record"), nil)
+	if err != nil {
+		t.Fatalf("写入数据块失败: %v", err)
+	}
+	otherID, err := f.WriteBlock([]byte("unsigned record"), nil)
+	if err != nil {
+		t.Fatalf("写入数据块失败: %v", err)
+	}
+
+	if err := f.VerifyBlock(blockID); !errors.Is(err, ErrSignatureNotFound) {
+		t.Fatalf("未签名的块应返回ErrSignatureNotFound, 实际: %v", err)
+	}
+	if err := f.SignBlock(blockID, "missing"); err == nil {
+		t.Fatal("使用不存在的密钥签名应失败")
+	}
+	if err := f.SignBlock(blockID, "archive"); err != nil {
+		t.Fatalf("签名数据块失败: %v", err)
+	}
+	if err := f.VerifyBlock(blockID); err != nil {
+		t.Fatalf("验证签名失败: %v", err)
+	}
+
+	sig, err := f.GetBlockSignature(blockID)
+	if err != nil {
+		t.Fatalf("获取签名失败: %v", err)
+	}
+	if sig.BlockID != blockID || sig.KeyID != "archive" || len(sig.Signature) != sha256.Size || sig.SignedAt.IsZero() {
+		t.Errorf("签名内容不正确: %+v", sig)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+
+	// 重新打开后签名仍然有效
+	f, err = OpenFragmenta(tempFile.Name())
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer f.Close()
+	f.SetBlockSigner(signer)
+
+	if err := f.VerifyBlock(blockID); err != nil {
+		t.Fatalf("重新打开后验证签名失败: %v", err)
+	}
+	if _, err := f.GetBlockSignature(otherID); !errors.Is(err, ErrSignatureNotFound) {
+		t.Errorf("未签名的块应返回ErrSignatureNotFound, 实际: %v", err)
+	}
+
+	// 签名挪用到其他块时验证失败
+	impl := f.(*FragmentaImpl)
+	impl.signatures[otherID] = &BlockSignature{BlockID: otherID, KeyID: "archive", Signature: sig.Signature}
+	if err := f.VerifyBlock(otherID); !errors.Is(err, ErrSignatureInvalid) {
+		t.Errorf("挪用的签名应返回ErrSignatureInvalid, 实际: %v", err)
+	}
+	delete(impl.signatures, otherID)
+
+	// 删除块时一并删除签名
+	if err := f.DeleteBlock(blockID); err != nil {
+		t.Fatalf("删除数据块失败: %v", err)
+	}
+	if _, err := f.GetBlockSignature(blockID); !errors.Is(err, ErrSignatureNotFound) {
+		t.Errorf("删除块后签名应被删除, 实际: %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+
+	"github.com/bpfs/fragmenta/security"
+)
+
+// SetAuthorizer 设置授权检查。设置后 ReadBlockContext、WriteBlockContext 和
+// DeleteBlockContext 会检查上下文中附带的主体（security.WithSubject）对数据块的权限，
+// 不带上下文的方法和没有附带主体的上下文不做检查
+func (sm *StorageManagerImpl) SetAuthorizer(authorizer security.Authorizer) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.authorizer = authorizer
+}
+
+// authorize 检查上下文中的主体对数据块的权限
+func (sm *StorageManagerImpl) authorize(ctx context.Context, id uint32, operation security.Operation) error {
+	sm.mutex.RLock()
+	authorizer := sm.authorizer
+	sm.mutex.RUnlock()
+
+	if authorizer == nil {
+		return nil
+	}
+	return authorizer.Authorize(ctx, security.NewBlockResource(id), operation)
+}
+
+// WriteBlockContext 以上下文中的主体身份写入数据块，记入上下文中调用方标签的统计（见 WithCallerTag）
+func (sm *StorageManagerImpl) WriteBlockContext(ctx context.Context, id uint32, data []byte) error {
+	if err := sm.authorize(ctx, id, security.WriteOperation); err != nil {
+		return err
+	}
+	return sm.writeBlockKeyContext(ctx, NumericKey(id), data)
+}
+
+// ReadBlockContext 以上下文中的主体身份读取数据块，记入上下文中调用方标签的统计
+func (sm *StorageManagerImpl) ReadBlockContext(ctx context.Context, id uint32) ([]byte, error) {
+	if err := sm.authorize(ctx, id, security.ReadOperation); err != nil {
+		return nil, err
+	}
+	tag, start := sm.startCall(ctx)
+	data, err := sm.readBlock(id)
+	sm.trackCall(tag, callerRead, start, len(data), err)
+	return data, err
+}
+
+// DeleteBlockContext 以上下文中的主体身份删除数据块，记入上下文中调用方标签的统计
+func (sm *StorageManagerImpl) DeleteBlockContext(ctx context.Context, id uint32) error {
+	if err := sm.authorize(ctx, id, security.DeleteOperation); err != nil {
+		return err
+	}
+	return sm.deleteBlockKeyContext(ctx, NumericKey(id))
+}
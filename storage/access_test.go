@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bpfs/fragmenta/security"
+)
+
+// TestStorageAuthorization 测试按上下文中的主体检查数据块权限
+func TestStorageAuthorization(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "storage_access_test_*")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sm, err := NewStorageManager(&StorageConfig{
+		Type:      StorageTypeContainer,
+		Path:      filepath.Join(tempDir, "container.db"),
+		BlockSize: 1024,
+	})
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+	defer sm.Close()
+
+	ctx := context.Background()
+	acm := security.NewAccessControlManager()
+	reader := security.NewRole("reader", "Reader", "")
+	reader.AddPermission(security.BlockResource, "1-100", security.ReadOperation)
+	if err := acm.GetRBACManager().CreateRole(ctx, reader); err != nil {
+		t.Fatalf("创建角色失败: %v", err)
+	}
+	if err := acm.GetRBACManager().AddRoleToSubject(ctx, "bob", "reader"); err != nil {
+		t.Fatalf("分配角色失败: %v", err)
+	}
+	sm.SetAuthorizer(acm)
+
+	// 没有附带身份的上下文不做检查
+	if err := sm.WriteBlockContext(ctx, 1, []byte("data")); err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+
+	bob := security.WithSubject(ctx, security.NewSubject("bob", security.UserSubject, nil))
+	if data, err := sm.ReadBlockContext(bob, 1); err != nil || string(data) != "data" {
+		t.Errorf("读取块失败: %q, %v", data, err)
+	}
+	if err := sm.WriteBlockContext(bob, 2, []byte("data")); !errors.Is(err, security.ErrPermissionDenied) {
+		t.Errorf("没有写入权限应被拒绝, 错误: %v", err)
+	}
+	if err := sm.DeleteBlockContext(bob, 1); !errors.Is(err, security.ErrPermissionDenied) {
+		t.Errorf("没有删除权限应被拒绝, 错误: %v", err)
+	}
+	if _, err := sm.ReadBlockContext(bob, 101); !errors.Is(err, security.ErrPermissionDenied) {
+		t.Errorf("范围外的块应被拒绝, 错误: %v", err)
+	}
+}
@@ -0,0 +1,371 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"sort"
+	"sync"
+)
+
+const (
+	// backupMagic 备份流魔数 "FBAK"
+	backupMagic uint32 = 0x4642414B
+	// backupVersion 备份流格式版本
+	backupVersion uint16 = 1
+
+	// backupFlagEncrypted 块数据是安全管理器加密后的数据，恢复时需要相同的密钥
+	backupFlagEncrypted uint16 = 1 << 0
+
+	// backupRecordBlock 块记录
+	backupRecordBlock byte = 'B'
+	// backupRecordEnd 结束记录
+	backupRecordEnd byte = 'E'
+)
+
+// ErrBackupCorrupted 表示备份流格式错误或校验失败
+var ErrBackupCorrupted = fmt.Errorf("%w: 备份", ErrCorrupted)
+
+// BackupResult 备份结果
+type BackupResult struct {
+	// Blocks 备份的块数
+	Blocks int
+	// Bytes 备份的块数据字节数
+	Bytes int64
+	// Preserved 备份期间被覆盖或删除、按写时复制保留了备份开始时数据的块数
+	Preserved int
+}
+
+// backupSnapshot 进行中的备份：开始时的块和键，以及备份读取前被修改的块的原数据
+type backupSnapshot struct {
+	mu        sync.Mutex
+	pending   map[uint32]struct{}
+	preserved map[uint32][]byte
+	count     int
+}
+
+// BackupTo 把备份开始时存储中所有块的一致映像写入w，备份期间不阻塞写入。
+//
+// 开始时在写锁下记录块ID和键，之后逐块读取；备份读取之前被覆盖或删除的块，
+// 在写入或删除前把原数据保留在内存中（写时复制），因此内存占用取决于备份期间修改的块数据量。
+// 备份流与存储模式无关，块数据是存储中的原始数据（启用加密时为密文），每个块带有CRC32-C校验和，
+// 流末尾带有整个流的校验和。同一时间只能有一个备份，模式转换期间不能备份
+func (sm *StorageManagerImpl) BackupTo(ctx context.Context, w io.Writer) (*BackupResult, error) {
+	snapshot, ids, keys, encrypted, err := sm.beginBackup()
+	if err != nil {
+		return nil, err
+	}
+	defer sm.endBackup()
+
+	var flags uint16
+	if encrypted {
+		flags |= backupFlagEncrypted
+	}
+	out, err := newBackupWriter(w, flags, uint32(len(ids)))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &BackupResult{}
+	for i, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		data, err := sm.readBackupBlock(snapshot, id)
+		if errors.Is(err, ErrBlockNotFound) {
+			// 开始时列出但已不存在（如混合存储中写入失败的块），按不存在处理
+			continue
+		}
+		if err != nil {
+			logger.Error("备份读取块失败", "id", id, "error", err)
+			return nil, err
+		}
+		if err := out.write(id, keys[i], data); err != nil {
+			return nil, err
+		}
+		result.Blocks++
+		result.Bytes += int64(len(data))
+	}
+	if err := out.close(); err != nil {
+		return nil, err
+	}
+
+	snapshot.mu.Lock()
+	result.Preserved = snapshot.count
+	snapshot.mu.Unlock()
+	logger.Info("备份完成", "blocks", result.Blocks, "bytes", result.Bytes, "preserved", result.Preserved)
+	return result, nil
+}
+
+// beginBackup 在写锁下记录备份开始时的块ID和键
+func (sm *StorageManagerImpl) beginBackup() (*backupSnapshot, []uint32, []BlockKey, bool, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if sm.backup != nil {
+		return nil, nil, nil, false, fmt.Errorf("%w: 备份正在进行", ErrInvalidOperation)
+	}
+	if sm.convertDirty != nil {
+		return nil, nil, nil, false, fmt.Errorf("%w: 存储模式转换正在进行", ErrInvalidOperation)
+	}
+	ids, err := sm.blockIDs()
+	if err != nil {
+		return nil, nil, nil, false, err
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	snapshot := &backupSnapshot{
+		pending:   make(map[uint32]struct{}, len(ids)),
+		preserved: make(map[uint32][]byte),
+	}
+	keys := make([]BlockKey, len(ids))
+	for i, id := range ids {
+		snapshot.pending[id] = struct{}{}
+		keys[i] = sm.keyForIDLocked(id)
+	}
+	sm.backup = snapshot
+	return snapshot, ids, keys, sm.encryptionEnabled && sm.securityManager != nil, nil
+}
+
+// endBackup 结束备份，释放保留的数据
+func (sm *StorageManagerImpl) endBackup() {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.backup = nil
+}
+
+// readBackupBlock 读取块在备份开始时的原始数据
+func (sm *StorageManagerImpl) readBackupBlock(snapshot *backupSnapshot, id uint32) ([]byte, error) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	snapshot.mu.Lock()
+	defer snapshot.mu.Unlock()
+
+	delete(snapshot.pending, id)
+	if data, ok := snapshot.preserved[id]; ok {
+		delete(snapshot.preserved, id)
+		if data == nil {
+			return nil, ErrBlockNotFound
+		}
+		return data, nil
+	}
+	return sm.readBackend(id)
+}
+
+// preserveForBackup 备份尚未读取的块被覆盖、删除或移动前保留原数据（调用者持有写锁）
+func (sm *StorageManagerImpl) preserveForBackup(id uint32) {
+	snapshot := sm.backup
+	if snapshot == nil {
+		return
+	}
+	snapshot.mu.Lock()
+	defer snapshot.mu.Unlock()
+
+	if _, pending := snapshot.pending[id]; !pending {
+		return
+	}
+	if _, ok := snapshot.preserved[id]; ok {
+		return
+	}
+	data, err := sm.readBackend(id)
+	if err != nil {
+		logger.Warning("备份保留块数据失败", "id", id, "error", err)
+		data = nil
+	}
+	snapshot.preserved[id] = data
+	snapshot.count++
+}
+
+// backupWriter 写出备份流：头部、块记录、结束记录和整个流的校验和
+type backupWriter struct {
+	bw     *bufio.Writer
+	stream hash.Hash32
+	out    io.Writer
+	count  uint32
+}
+
+// newBackupWriter 写入备份流的头部，total为头部记录的块数
+func newBackupWriter(w io.Writer, flags uint16, total uint32) (*backupWriter, error) {
+	bw := bufio.NewWriter(w)
+	stream := crc32.New(metaIndexCRCTable)
+	out := &backupWriter{bw: bw, stream: stream, out: io.MultiWriter(bw, stream)}
+
+	header := make([]byte, 12)
+	binary.BigEndian.PutUint32(header[0:], backupMagic)
+	binary.BigEndian.PutUint16(header[4:], backupVersion)
+	binary.BigEndian.PutUint16(header[6:], flags)
+	binary.BigEndian.PutUint32(header[8:], total)
+	if _, err := out.out.Write(header); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// write 写入一个块记录
+func (w *backupWriter) write(id uint32, key BlockKey, data []byte) error {
+	if err := writeBackupRecord(w.out, id, key, data); err != nil {
+		return err
+	}
+	w.count++
+	return nil
+}
+
+// close 写入结束记录和整个流的校验和
+func (w *backupWriter) close() error {
+	end := make([]byte, 5)
+	end[0] = backupRecordEnd
+	binary.BigEndian.PutUint32(end[1:], w.count)
+	if _, err := w.out.Write(end); err != nil {
+		return err
+	}
+	if err := binary.Write(w.bw, binary.BigEndian, w.stream.Sum32()); err != nil {
+		return err
+	}
+	return w.bw.Flush()
+}
+
+// writeBackupRecord 写入一个块记录：类型、ID、键长度、键、数据长度、数据、CRC32-C
+func writeBackupRecord(w io.Writer, id uint32, key BlockKey, data []byte) error {
+	name := ""
+	if _, numeric := key.Numeric(); !numeric {
+		name = key.String()
+	}
+	head := make([]byte, 1+4+2+len(name)+4)
+	head[0] = backupRecordBlock
+	binary.BigEndian.PutUint32(head[1:], id)
+	binary.BigEndian.PutUint16(head[5:], uint16(len(name)))
+	copy(head[7:], name)
+	binary.BigEndian.PutUint32(head[7+len(name):], uint32(len(data)))
+
+	checksum := crc32.New(metaIndexCRCTable)
+	checksum.Write(head[1:])
+	checksum.Write(data)
+
+	if _, err := w.Write(head); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.BigEndian, checksum.Sum32())
+}
+
+// backupRecord 从备份流读取的块记录
+type backupRecord struct {
+	id   uint32
+	key  BlockKey
+	data []byte
+}
+
+// backupReader 按顺序读取并校验备份流
+type backupReader struct {
+	r      *bufio.Reader
+	stream hash.Hash32
+	in     io.Reader
+
+	flags uint16
+	total uint32
+	count uint32
+	done  bool
+}
+
+// newBackupReader 读取并校验备份流的头部
+func newBackupReader(r io.Reader) (*backupReader, error) {
+	br := &backupReader{r: bufio.NewReader(r), stream: crc32.New(metaIndexCRCTable)}
+	br.in = io.TeeReader(br.r, br.stream)
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(br.in, header); err != nil {
+		return nil, fmt.Errorf("%w: 读取头部失败: %v", ErrBackupCorrupted, err)
+	}
+	if binary.BigEndian.Uint32(header[0:]) != backupMagic {
+		return nil, fmt.Errorf("%w: 魔数不匹配", ErrBackupCorrupted)
+	}
+	if version := binary.BigEndian.Uint16(header[4:]); version != backupVersion {
+		return nil, fmt.Errorf("%w: 不支持的版本%d", ErrBackupCorrupted, version)
+	}
+	br.flags = binary.BigEndian.Uint16(header[6:])
+	br.total = binary.BigEndian.Uint32(header[8:])
+	return br, nil
+}
+
+// next 读取下一个块记录，流结束且校验通过时返回io.EOF
+func (br *backupReader) next() (*backupRecord, error) {
+	if br.done {
+		return nil, io.EOF
+	}
+	kind := make([]byte, 1)
+	if _, err := io.ReadFull(br.in, kind); err != nil {
+		return nil, fmt.Errorf("%w: 流意外结束: %v", ErrBackupCorrupted, err)
+	}
+
+	switch kind[0] {
+	case backupRecordBlock:
+		return br.readBlock()
+	case backupRecordEnd:
+		var count uint32
+		if err := binary.Read(br.in, binary.BigEndian, &count); err != nil {
+			return nil, fmt.Errorf("%w: 读取结束记录失败: %v", ErrBackupCorrupted, err)
+		}
+		sum := br.stream.Sum32()
+		var expected uint32
+		if err := binary.Read(br.r, binary.BigEndian, &expected); err != nil {
+			return nil, fmt.Errorf("%w: 读取校验和失败: %v", ErrBackupCorrupted, err)
+		}
+		if sum != expected {
+			return nil, fmt.Errorf("%w: 流校验和不匹配", ErrBackupCorrupted)
+		}
+		if count != br.count {
+			return nil, fmt.Errorf("%w: 块数不一致: 期望%d，实际%d", ErrBackupCorrupted, count, br.count)
+		}
+		br.done = true
+		return nil, io.EOF
+	default:
+		return nil, fmt.Errorf("%w: 未知的记录类型%q", ErrBackupCorrupted, kind[0])
+	}
+}
+
+// readBlock 读取并校验块记录的剩余部分
+func (br *backupReader) readBlock() (*backupRecord, error) {
+	checksum := crc32.New(metaIndexCRCTable)
+	in := io.TeeReader(br.in, checksum)
+
+	var head [6]byte
+	if _, err := io.ReadFull(in, head[:]); err != nil {
+		return nil, fmt.Errorf("%w: 读取块记录失败: %v", ErrBackupCorrupted, err)
+	}
+	rec := &backupRecord{id: binary.BigEndian.Uint32(head[0:])}
+	name := make([]byte, binary.BigEndian.Uint16(head[4:]))
+	if _, err := io.ReadFull(in, name); err != nil {
+		return nil, fmt.Errorf("%w: 读取块键失败: %v", ErrBackupCorrupted, err)
+	}
+	var size uint32
+	if err := binary.Read(in, binary.BigEndian, &size); err != nil {
+		return nil, fmt.Errorf("%w: 读取块大小失败: %v", ErrBackupCorrupted, err)
+	}
+	rec.data = make([]byte, size)
+	if _, err := io.ReadFull(in, rec.data); err != nil {
+		return nil, fmt.Errorf("%w: 读取块%d数据失败: %v", ErrBackupCorrupted, rec.id, err)
+	}
+	var expected uint32
+	if err := binary.Read(br.in, binary.BigEndian, &expected); err != nil {
+		return nil, fmt.Errorf("%w: 读取块%d校验和失败: %v", ErrBackupCorrupted, rec.id, err)
+	}
+	if checksum.Sum32() != expected {
+		return nil, fmt.Errorf("%w: 块%d校验和不匹配", ErrBackupCorrupted, rec.id)
+	}
+
+	if len(name) > 0 {
+		rec.key = BlockKey{name: string(name), id: rec.id, named: true}
+	} else {
+		rec.key = NumericKey(rec.id)
+	}
+	br.count++
+	return rec, nil
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+)
+
+// hookWriter 第一次写入时调用hook的写入器，用于在备份进行中修改存储
+type hookWriter struct {
+	buf  bytes.Buffer
+	hook func()
+}
+
+// Write 实现io.Writer
+func (w *hookWriter) Write(p []byte) (int, error) {
+	if w.hook != nil {
+		hook := w.hook
+		w.hook = nil
+		hook()
+	}
+	return w.buf.Write(p)
+}
+
+// TestBackupTo 测试备份期间的覆盖和删除不影响备份内容
+func TestBackupTo(t *testing.T) {
+	config := &StorageConfig{Type: StorageTypeDirectory, Path: filepath.Join(t.TempDir(), "data"), BlockSize: 4096}
+	sm, err := NewStorageManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Close()
+
+	original := make(map[uint32][]byte)
+	for id := uint32(1); id <= 50; id++ {
+		data := bytes.Repeat([]byte(fmt.Sprintf("block-%d;", id)), 200)
+		original[id] = data
+		if err := sm.WriteBlock(id, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sm.WriteBlockKey(StringKey("docs/readme"), []byte("readme")); err != nil {
+		t.Fatal(err)
+	}
+
+	w := &hookWriter{hook: func() {
+		if err := sm.WriteBlock(50, []byte("overwritten")); err != nil {
+			t.Error(err)
+		}
+		if err := sm.DeleteBlock(49); err != nil {
+			t.Error(err)
+		}
+		if err := sm.WriteBlock(51, []byte("new")); err != nil {
+			t.Error(err)
+		}
+		if _, err := sm.BackupTo(context.Background(), io.Discard); !errors.Is(err, ErrInvalidOperation) {
+			t.Errorf("concurrent backup: %v", err)
+		}
+	}}
+	result, err := sm.BackupTo(context.Background(), w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Blocks != 51 || result.Preserved != 2 {
+		t.Errorf("result: %+v", result)
+	}
+
+	br, err := newBackupReader(bytes.NewReader(w.buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := 0
+	for {
+		rec, err := br.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		seen++
+		if rec.key.String() == "docs/readme" {
+			if string(rec.data) != "readme" {
+				t.Errorf("string key data: %q", rec.data)
+			}
+			continue
+		}
+		if !bytes.Equal(rec.data, original[rec.id]) {
+			t.Errorf("block %d does not match the data at backup start", rec.id)
+		}
+	}
+	if seen != 51 {
+		t.Errorf("records = %d", seen)
+	}
+
+	// 损坏的流在读取时报告
+	corrupted := bytes.Clone(w.buf.Bytes())
+	corrupted[100] ^= 0xFF
+	br, err = newBackupReader(bytes.NewReader(corrupted))
+	if err == nil {
+		for err == nil {
+			_, err = br.next()
+		}
+	}
+	if !errors.Is(err, ErrBackupCorrupted) {
+		t.Errorf("corrupted stream: %v", err)
+	}
+}
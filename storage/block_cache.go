@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// blockCacheShards 块缓存的分片数，按块ID取模选择分片
+const blockCacheShards = 16
+
+// CacheEntry 缓存条目
+type CacheEntry struct {
+	BlockID     uint32
+	Data        []byte
+	AccessCount uint32
+	LastAccess  time.Time
+}
+
+// BlockCache 块缓存，按最近最少使用淘汰
+//
+// 缓存按块ID分成blockCacheShards个分片，每个分片有自己的锁和LRU链表。
+// 命中只锁定块所在的分片，读取不同块的协程互不等待，也不需要存储管理器的写锁。
+// 容量是所有分片的总和，超出时从插入分片的下一个分片开始轮流淘汰各分片最久未使用的条目，
+// 因此淘汰顺序是近似的全局LRU。所有方法都可以并发调用
+type BlockCache struct {
+	// Policy 淘汰策略，目前只支持lru，只在持有存储管理器写锁时修改
+	Policy string
+
+	maxSize atomic.Uint64
+	size    atomic.Uint64
+	shards  [blockCacheShards]blockCacheShard
+}
+
+// blockCacheShard 缓存分片
+type blockCacheShard struct {
+	mu      sync.Mutex
+	entries map[uint32]*list.Element // 元素的值为*CacheEntry
+	lru     *list.List               // 前端为最近使用
+}
+
+// newBlockCache 创建容量为maxSize字节的块缓存
+func newBlockCache(maxSize uint64, policy string) *BlockCache {
+	c := &BlockCache{Policy: policy}
+	c.maxSize.Store(maxSize)
+	for i := range c.shards {
+		c.shards[i].entries = make(map[uint32]*list.Element)
+		c.shards[i].lru = list.New()
+	}
+	return c
+}
+
+// shardIndex 返回块所在分片的下标
+func (c *BlockCache) shardIndex(id uint32) int {
+	return int(id % blockCacheShards)
+}
+
+// get 返回缓存的块数据并更新访问统计
+func (c *BlockCache) get(id uint32, now time.Time) ([]byte, bool) {
+	s := &c.shards[c.shardIndex(id)]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[id]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*CacheEntry)
+	entry.AccessCount++
+	entry.LastAccess = now
+	s.lru.MoveToFront(elem)
+	return entry.Data, true
+}
+
+// put 缓存块数据，超过容量的数据不缓存
+func (c *BlockCache) put(id uint32, data []byte, now time.Time) {
+	size := uint64(len(data))
+	if size > c.maxSize.Load() {
+		c.remove(id)
+		return
+	}
+
+	index := c.shardIndex(id)
+	s := &c.shards[index]
+	s.mu.Lock()
+	if elem, ok := s.entries[id]; ok {
+		entry := elem.Value.(*CacheEntry)
+		c.size.Add(size - uint64(len(entry.Data)))
+		entry.Data = data
+		entry.AccessCount++
+		entry.LastAccess = now
+		s.lru.MoveToFront(elem)
+	} else {
+		entry := &CacheEntry{BlockID: id, Data: data, AccessCount: 1, LastAccess: now}
+		s.entries[id] = s.lru.PushFront(entry)
+		c.size.Add(size)
+	}
+	s.mu.Unlock()
+
+	c.evict(index + 1)
+}
+
+// remove 删除缓存的块
+func (c *BlockCache) remove(id uint32) {
+	s := &c.shards[c.shardIndex(id)]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.entries[id]; ok {
+		c.removeLocked(s, elem)
+	}
+}
+
+// removeLocked 从分片删除条目（调用方需持有分片锁）
+func (c *BlockCache) removeLocked(s *blockCacheShard, elem *list.Element) {
+	entry := s.lru.Remove(elem).(*CacheEntry)
+	delete(s.entries, entry.BlockID)
+	c.size.Add(-uint64(len(entry.Data)))
+}
+
+// clear 清空缓存
+func (c *BlockCache) clear() {
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		for _, elem := range s.entries {
+			c.removeLocked(s, elem)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// setMaxSize 修改容量，缩小时立即淘汰超出的条目
+func (c *BlockCache) setMaxSize(maxSize uint64) {
+	c.maxSize.Store(maxSize)
+	c.evict(0)
+}
+
+// evict 从start分片开始轮流淘汰各分片最久未使用的条目，直到总大小不超过容量
+func (c *BlockCache) evict(start int) {
+	for i, empty := start, 0; c.size.Load() > c.maxSize.Load() && empty < blockCacheShards; i++ {
+		s := &c.shards[i%blockCacheShards]
+		s.mu.Lock()
+		if elem := s.lru.Back(); elem != nil {
+			c.removeLocked(s, elem)
+			empty = 0
+		} else {
+			empty++
+		}
+		s.mu.Unlock()
+	}
+}
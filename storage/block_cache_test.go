@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// TestBlockCache 测试块缓存的命中、覆盖、淘汰和缩容
+func TestBlockCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	cache := newBlockCache(100, "lru")
+	block := func(b byte) []byte { return bytes.Repeat([]byte{b}, 30) }
+
+	// 同一分片中的块按最近使用淘汰
+	for i := uint32(0); i < 3; i++ {
+		cache.put(i*blockCacheShards, block(byte(i)), now)
+	}
+	if _, ok := cache.get(0, now); !ok {
+		t.Fatal("块0应命中")
+	}
+	cache.put(3*blockCacheShards, block(3), now)
+	if _, ok := cache.get(blockCacheShards, now); ok {
+		t.Error("最久未使用的块应被淘汰")
+	}
+	if data, ok := cache.get(0, now); !ok || !bytes.Equal(data, block(0)) {
+		t.Errorf("最近访问的块不应被淘汰: %v", ok)
+	}
+	if size := cache.size.Load(); size != 90 {
+		t.Errorf("缓存大小不正确: %d", size)
+	}
+
+	// 覆盖已缓存的块只计算差值
+	cache.put(0, block(9)[:10], now)
+	if size := cache.size.Load(); size != 70 {
+		t.Errorf("覆盖后缓存大小不正确: %d", size)
+	}
+
+	// 超过容量的块不缓存，并删除旧数据
+	cache.put(0, bytes.Repeat([]byte{1}, 101), now)
+	if _, ok := cache.get(0, now); ok {
+		t.Error("超过容量的块不应缓存")
+	}
+
+	// 缩容时淘汰到不超过新容量，不同分片中的块也会被淘汰
+	cache.put(1, block(1), now)
+	cache.setMaxSize(40)
+	if size := cache.size.Load(); size > 40 {
+		t.Errorf("缩容后缓存大小应不超过40: %d", size)
+	}
+
+	cache.clear()
+	if size := cache.size.Load(); size != 0 {
+		t.Errorf("清空后缓存大小应为0: %d", size)
+	}
+}
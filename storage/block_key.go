@@ -0,0 +1,496 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/bpfs/fragmenta/vfs"
+)
+
+var (
+	// ErrInvalidBlockKey 表示块键无效（空字符串或超过 MaxBlockKeyLength）
+	ErrInvalidBlockKey = errors.New("无效的块键")
+
+	// ErrBlockKeyConflict 表示块ID已分配给字符串键，不能再按数字键写入或删除
+	ErrBlockKeyConflict = errors.New("块ID已被字符串键占用")
+
+	// ErrKeyTableCorrupted 表示块键表文件已损坏
+	ErrKeyTableCorrupted = fmt.Errorf("%w: 块键表", ErrCorrupted)
+)
+
+// MaxBlockKeyLength 字符串键的最大字节数
+const MaxBlockKeyLength = 0xFFFF
+
+// BlockKey 块键，可以是数字或字符串，所有存储模式都支持。
+//
+// 数字键就是uint32块ID，十进制形式的字符串（如"42"）与对应的数字键相同，
+// 因此已有的数字键存储（包括以十进制字符串为键的混合存储）不需要迁移即可按字符串访问。
+// 其他字符串键由存储管理器分配内部块ID：容器和目录存储按内部ID保存数据，
+// 混合存储直接以字符串为键。加密、缓存和块回调（见 BlockHook）使用内部ID
+type BlockKey struct {
+	name  string
+	id    uint32
+	named bool
+}
+
+// NumericKey 返回块ID对应的数字键
+func NumericKey(id uint32) BlockKey {
+	return BlockKey{id: id}
+}
+
+// StringKey 返回字符串键，十进制形式的uint32返回对应的数字键
+func StringKey(name string) BlockKey {
+	if id, ok := parseNumericKey(name); ok {
+		return NumericKey(id)
+	}
+	return BlockKey{name: name, named: true}
+}
+
+// Numeric 返回数字键的块ID，字符串键返回false
+func (k BlockKey) Numeric() (uint32, bool) {
+	return k.id, !k.named
+}
+
+// String 返回键的字符串形式，数字键为十进制，与混合存储中的键相同
+func (k BlockKey) String() string {
+	if k.named {
+		return k.name
+	}
+	return strconv.FormatUint(uint64(k.id), 10)
+}
+
+// parseNumericKey 解析规范的十进制块ID（没有前导零和符号）
+func parseNumericKey(s string) (uint32, bool) {
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || strconv.FormatUint(id, 10) != s {
+		return 0, false
+	}
+	return uint32(id), true
+}
+
+// 块键表文件格式（大端序），保存在存储路径旁边的 <Path>.keys，模式转换时保留:
+//
+//	magic(4) | version(2) | reserved(2) | count(4)
+//	count x [ id(4) | nameLen(2) | name(nameLen) ]
+//	crc32(4)  —— 对之前所有字节计算的CRC32-C校验和
+const (
+	// keyTableMagic 块键表魔数 "FBKT"
+	keyTableMagic uint32 = 0x46424B54
+	// keyTableVersion 块键表格式版本
+	keyTableVersion uint16 = 1
+)
+
+// keyTable 字符串键与内部块ID的映射，由存储管理器的锁保护
+type keyTable struct {
+	fs      vfs.FS
+	path    string // 为空时不持久化
+	durable bool
+
+	byName map[string]uint32
+	byID   map[uint32]string
+}
+
+// keyTablePath 返回存储路径对应的块键表路径
+func keyTablePath(storagePath string) string {
+	if storagePath == "" {
+		return ""
+	}
+	return storagePath + ".keys"
+}
+
+// loadKeyTable 加载块键表，文件不存在时返回空表
+func loadKeyTable(fsys vfs.FS, path string, durable bool) (*keyTable, error) {
+	t := &keyTable{
+		fs:      fsys,
+		path:    path,
+		durable: durable,
+		byName:  make(map[string]uint32),
+		byID:    make(map[uint32]string),
+	}
+	if path == "" {
+		return t, nil
+	}
+
+	data, err := fsys.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := t.decode(data); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// set 记录字符串键与块ID的映射
+func (t *keyTable) set(name string, id uint32) {
+	t.byName[name] = id
+	t.byID[id] = name
+}
+
+// remove 删除块ID的映射
+func (t *keyTable) remove(id uint32) {
+	if name, ok := t.byID[id]; ok {
+		delete(t.byName, name)
+		delete(t.byID, id)
+	}
+}
+
+// save 原子地写入块键表
+func (t *keyTable) save() error {
+	if t.path == "" {
+		return nil
+	}
+	return writeFileAtomic(t.fs, t.path, t.encode(), 0644, t.durable)
+}
+
+// encode 按ID顺序编码块键表
+func (t *keyTable) encode() []byte {
+	ids := make([]uint32, 0, len(t.byID))
+	for id := range t.byID {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, keyTableMagic)
+	binary.Write(&buf, binary.BigEndian, keyTableVersion)
+	binary.Write(&buf, binary.BigEndian, uint16(0))
+	binary.Write(&buf, binary.BigEndian, uint32(len(ids)))
+	for _, id := range ids {
+		name := t.byID[id]
+		binary.Write(&buf, binary.BigEndian, id)
+		binary.Write(&buf, binary.BigEndian, uint16(len(name)))
+		buf.WriteString(name)
+	}
+
+	checksum := crc32.Checksum(buf.Bytes(), metaIndexCRCTable)
+	binary.Write(&buf, binary.BigEndian, checksum)
+	return buf.Bytes()
+}
+
+// decode 解析块键表，校验失败时返回ErrKeyTableCorrupted
+func (t *keyTable) decode(data []byte) error {
+	// 头部12字节 + 校验和4字节
+	if len(data) < 16 {
+		return ErrKeyTableCorrupted
+	}
+	body := data[:len(data)-4]
+	if crc32.Checksum(body, metaIndexCRCTable) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+		return ErrKeyTableCorrupted
+	}
+
+	r := bytes.NewReader(body)
+	var magic, count uint32
+	var version, reserved uint16
+	binary.Read(r, binary.BigEndian, &magic)
+	binary.Read(r, binary.BigEndian, &version)
+	binary.Read(r, binary.BigEndian, &reserved)
+	binary.Read(r, binary.BigEndian, &count)
+	if magic != keyTableMagic {
+		return ErrKeyTableCorrupted
+	}
+	if version != keyTableVersion {
+		return fmt.Errorf("不支持的块键表版本: %d", version)
+	}
+	// 每个条目至少6字节，防止恶意的count导致过量分配
+	if uint64(count)*6 > uint64(r.Len()) {
+		return ErrKeyTableCorrupted
+	}
+
+	for i := uint32(0); i < count; i++ {
+		var id uint32
+		var nameLen uint16
+		if err := binary.Read(r, binary.BigEndian, &id); err != nil {
+			return ErrKeyTableCorrupted
+		}
+		if err := binary.Read(r, binary.BigEndian, &nameLen); err != nil {
+			return ErrKeyTableCorrupted
+		}
+		name := make([]byte, nameLen)
+		if _, err := io.ReadFull(r, name); err != nil {
+			return ErrKeyTableCorrupted
+		}
+		t.set(string(name), id)
+	}
+	if r.Len() != 0 {
+		return ErrKeyTableCorrupted
+	}
+	return nil
+}
+
+// WriteBlockKey 按块键写入块，字符串键第一次写入时分配内部块ID。成功后通知块回调
+func (sm *StorageManagerImpl) WriteBlockKey(key BlockKey, data []byte) error {
+	return sm.writeBlockKeyContext(context.Background(), key, data)
+}
+
+// writeBlockKeyContext 写入块并记入上下文中调用方标签的统计
+func (sm *StorageManagerImpl) writeBlockKeyContext(ctx context.Context, key BlockKey, data []byte) error {
+	tag, start := sm.startCall(ctx)
+	id, err := sm.writeBlock(key, data)
+	sm.trackCall(tag, callerWrite, start, len(data), err)
+	if err != nil {
+		return err
+	}
+	sm.emitWritten(id, data)
+	return nil
+}
+
+// ReadBlockKey 按块键读取块
+func (sm *StorageManagerImpl) ReadBlockKey(key BlockKey) ([]byte, error) {
+	id, err := sm.lookupKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return sm.ReadBlock(id)
+}
+
+// DeleteBlockKey 按块键删除块，字符串键的映射一并删除。成功后通知块回调
+func (sm *StorageManagerImpl) DeleteBlockKey(key BlockKey) error {
+	return sm.deleteBlockKeyContext(context.Background(), key)
+}
+
+// deleteBlockKeyContext 删除块并记入上下文中调用方标签的统计
+func (sm *StorageManagerImpl) deleteBlockKeyContext(ctx context.Context, key BlockKey) error {
+	tag, start := sm.startCall(ctx)
+	id, err := sm.deleteBlock(key, false)
+	sm.trackCall(tag, callerDelete, start, 0, err)
+	if err != nil {
+		return err
+	}
+	sm.emitDeleted(id)
+	return nil
+}
+
+// GetBlockInfoKey 按块键获取块信息
+func (sm *StorageManagerImpl) GetBlockInfoKey(key BlockKey) (*BlockInfo, error) {
+	id, err := sm.lookupKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return sm.GetBlockInfo(id)
+}
+
+// ListBlockKeys 列出所有块的键，按内部块ID排序
+func (sm *StorageManagerImpl) ListBlockKeys() ([]BlockKey, error) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	ids, err := sm.blockIDs()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	keys := make([]BlockKey, len(ids))
+	for i, id := range ids {
+		keys[i] = sm.keyForIDLocked(id)
+	}
+	return keys, nil
+}
+
+// KeyForID 返回内部块ID对应的键，用于把索引结果和块回调中的ID转换回块键
+func (sm *StorageManagerImpl) KeyForID(id uint32) BlockKey {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	return sm.keyForIDLocked(id)
+}
+
+// AssignBlockKey 为已有的数字键块指定字符串键，块ID和数据不变，用于把数字键存储迁移到有意义的字符串键。
+// 之后只能按字符串键写入和删除该块，按ID读取仍然可以。混合存储中的数据从十进制键移动到新键下
+func (sm *StorageManagerImpl) AssignBlockKey(id uint32, name string) error {
+	key := StringKey(name)
+	if _, numeric := key.Numeric(); numeric || len(name) == 0 || len(name) > MaxBlockKeyLength {
+		return fmt.Errorf("%w: %q", ErrInvalidBlockKey, name)
+	}
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if _, ok := sm.keys.byName[name]; ok {
+		return fmt.Errorf("%w: %q已存在", ErrInvalidBlockKey, name)
+	}
+	if _, ok := sm.keys.byID[id]; ok {
+		return fmt.Errorf("%w: %d", ErrBlockKeyConflict, id)
+	}
+	if !sm.backendHas(id) {
+		return ErrBlockNotFound
+	}
+
+	sm.preserveForBackup(id)
+	if sm.hybridStorage != nil {
+		// 按存储中的原始数据移动，加密的块不需要解密
+		data, err := sm.hybridStorage.ReadBlock(NumericKey(id).String())
+		if err != nil {
+			return err
+		}
+		if err := sm.checkWriteSpace(len(data)); err != nil {
+			return err
+		}
+		if err := sm.hybridStorage.WriteBlock(name, data); err != nil {
+			return sm.noteWriteError(err)
+		}
+		if err := sm.hybridStorage.DeleteBlock(NumericKey(id).String()); err != nil {
+			sm.hybridStorage.DeleteBlock(name)
+			return err
+		}
+	}
+
+	sm.keys.set(name, id)
+	sm.markConvertDirty(id)
+	sm.usage.rename(id, key)
+	return sm.keys.save()
+}
+
+// lookupKey 返回已有块键的内部ID，字符串键不存在时返回ErrBlockNotFound。
+// 混合存储中没有映射的字符串键在这里分配ID，需要短暂持有写锁
+func (sm *StorageManagerImpl) lookupKey(key BlockKey) (uint32, error) {
+	if id, ok := key.Numeric(); ok {
+		return id, nil
+	}
+	sm.mutex.RLock()
+	id, ok := sm.keys.byName[key.name]
+	hybrid := sm.hybridStorage != nil
+	sm.mutex.RUnlock()
+	if ok {
+		return id, nil
+	}
+	if !hybrid {
+		return 0, ErrBlockNotFound
+	}
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	return sm.resolveKey(key, false)
+}
+
+// resolveKey 返回写入或删除使用的内部ID（调用者持有写锁）。数字键的ID已被字符串键占用时返回
+// ErrBlockKeyConflict；字符串键不存在时，create为true则分配新的ID并保存块键表，否则返回ErrBlockNotFound
+func (sm *StorageManagerImpl) resolveKey(key BlockKey, create bool) (uint32, error) {
+	if id, ok := key.Numeric(); ok {
+		if name, owned := sm.keys.byID[id]; owned {
+			return 0, fmt.Errorf("%w: %d (%q)", ErrBlockKeyConflict, id, name)
+		}
+		return id, nil
+	}
+
+	if len(key.name) == 0 || len(key.name) > MaxBlockKeyLength {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidBlockKey, key.name)
+	}
+	if id, ok := sm.keys.byName[key.name]; ok {
+		return id, nil
+	}
+	if id, ok, err := sm.adoptHybridKey(key.name); ok || err != nil {
+		return id, err
+	}
+	if !create {
+		return 0, ErrBlockNotFound
+	}
+
+	id, err := sm.allocateKeyID()
+	if err != nil {
+		return 0, err
+	}
+	sm.keys.set(key.name, id)
+	if err := sm.keys.save(); err != nil {
+		sm.keys.remove(id)
+		return 0, err
+	}
+	return id, nil
+}
+
+// allocateKeyID 从最大的ID开始向下查找既没有映射也没有数据的块ID（调用者持有写锁）
+func (sm *StorageManagerImpl) allocateKeyID() (uint32, error) {
+	for id := uint32(0xFFFFFFFF); id > 0; id-- {
+		if _, ok := sm.keys.byID[id]; ok {
+			continue
+		}
+		if !sm.backendHas(id) {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: 没有可分配的块ID", ErrInvalidOperation)
+}
+
+// backendHas 返回当前存储中是否有该ID的块（调用者持有锁）
+func (sm *StorageManagerImpl) backendHas(id uint32) bool {
+	var err error
+	switch {
+	case sm.containerStorage != nil:
+		_, err = sm.containerStorage.GetBlockInfo(id)
+	case sm.directoryStorage != nil:
+		_, err = sm.directoryStorage.GetBlockInfo(id)
+	case sm.hybridStorage != nil:
+		_, _, err = sm.hybridStorage.GetBlockInfo(sm.backendKey(id))
+	default:
+		return false
+	}
+	return err == nil
+}
+
+// keyForIDLocked 返回内部块ID对应的键（调用者持有锁）
+func (sm *StorageManagerImpl) keyForIDLocked(id uint32) BlockKey {
+	if name, ok := sm.keys.byID[id]; ok {
+		return BlockKey{name: name, id: id, named: true}
+	}
+	return NumericKey(id)
+}
+
+// backendKey 返回混合存储中块的键：字符串键的块使用字符串，其他块使用十进制ID
+func (sm *StorageManagerImpl) backendKey(id uint32) string {
+	if name, ok := sm.keys.byID[id]; ok {
+		return name
+	}
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// hybridKeyID 返回混合存储中的键对应的内部块ID
+func (sm *StorageManagerImpl) hybridKeyID(key string) (uint32, bool) {
+	if id, ok := parseNumericKey(key); ok {
+		return id, true
+	}
+	id, ok := sm.keys.byName[key]
+	return id, ok
+}
+
+// loadKeys 加载存储路径旁边的块键表（调用者持有写锁或在初始化期间）
+func (sm *StorageManagerImpl) loadKeys() error {
+	keys, err := loadKeyTable(sm.fsys(), keyTablePath(sm.config.Path), sm.config.Durability != DurabilityNone)
+	if err != nil {
+		return err
+	}
+	sm.keys = keys
+	return nil
+}
+
+// adoptHybridKey 混合存储中有该字符串键的块但没有映射时分配内部ID，
+// 使直接通过 HybridStorage 写入的字符串键存储也可以由存储管理器访问（调用者持有写锁）。
+// 混合存储重新打开后无法列出已有的键，因此在第一次访问时分配
+func (sm *StorageManagerImpl) adoptHybridKey(name string) (uint32, bool, error) {
+	if sm.hybridStorage == nil {
+		return 0, false, nil
+	}
+	if _, _, err := sm.hybridStorage.GetBlockInfo(name); err != nil {
+		return 0, false, nil
+	}
+	id, err := sm.allocateKeyID()
+	if err != nil {
+		return 0, false, err
+	}
+	sm.keys.set(name, id)
+	if err := sm.keys.save(); err != nil {
+		sm.keys.remove(id)
+		return 0, false, err
+	}
+	logger.Info("已为混合存储中的字符串键分配块ID", "key", name, "id", id)
+	return id, true, nil
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestBlockKey 测试十进制字符串与数字键相同
+func TestBlockKey(t *testing.T) {
+	if StringKey("42") != NumericKey(42) {
+		t.Error(`StringKey("42") should equal NumericKey(42)`)
+	}
+	for _, name := range []string{"042", "+42", "4294967296", "users/alice", ""} {
+		if _, numeric := StringKey(name).Numeric(); numeric {
+			t.Errorf("%q should be a string key", name)
+		}
+		if got := StringKey(name).String(); got != name {
+			t.Errorf("String() = %q, want %q", got, name)
+		}
+	}
+	if got := NumericKey(7).String(); got != "7" {
+		t.Errorf("NumericKey(7).String() = %q", got)
+	}
+}
+
+// blockKeyStoragePath 返回存储模式对应的存储路径
+func blockKeyStoragePath(dir string, storageType StorageType) string {
+	if storageType == StorageTypeContainer {
+		return filepath.Join(dir, "data.db")
+	}
+	return filepath.Join(dir, "data")
+}
+
+// TestStorageManagerBlockKeys 测试三种存储模式下字符串键和数字键的读写、冲突检测和持久化
+func TestStorageManagerBlockKeys(t *testing.T) {
+	modes := map[string]StorageType{
+		"container": StorageTypeContainer,
+		"directory": StorageTypeDirectory,
+		"hybrid":    StorageTypeHybrid,
+	}
+	for name, storageType := range modes {
+		t.Run(name, func(t *testing.T) {
+			config := &StorageConfig{Type: storageType, Path: blockKeyStoragePath(t.TempDir(), storageType), BlockSize: 4096}
+			sm, err := NewStorageManager(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			alice := StringKey("users/alice")
+			if err := sm.WriteBlockKey(alice, []byte("alice")); err != nil {
+				t.Fatal(err)
+			}
+			if err := sm.WriteBlock(7, []byte("seven")); err != nil {
+				t.Fatal(err)
+			}
+			if err := sm.WriteBlockKey(StringKey(""), []byte("x")); !errors.Is(err, ErrInvalidBlockKey) {
+				t.Errorf("empty key: %v", err)
+			}
+
+			keys, err := sm.ListBlockKeys()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keys) != 2 || keys[0] != NumericKey(7) || keys[1].String() != "users/alice" {
+				t.Fatalf("keys: %v", keys)
+			}
+
+			// 字符串键的内部ID不能再按数字键写入
+			id, _ := keys[1].Numeric()
+			if err := sm.WriteBlock(id, []byte("other")); !errors.Is(err, ErrBlockKeyConflict) {
+				t.Errorf("numeric write to a named block: %v", err)
+			}
+			if data, err := sm.ReadBlock(id); err != nil || string(data) != "alice" {
+				t.Errorf("read by id: %q, %v", data, err)
+			}
+			if sm.KeyForID(id).String() != "users/alice" {
+				t.Errorf("KeyForID: %v", sm.KeyForID(id))
+			}
+			if storageType == StorageTypeHybrid {
+				if _, err := sm.hybridStorage.ReadBlock("users/alice"); err != nil {
+					t.Errorf("hybrid storage should use the string key natively: %v", err)
+				}
+			}
+			sm.Close()
+
+			// 重新打开后字符串键仍然有效
+			sm, err = NewStorageManager(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sm.Close()
+			if data, err := sm.ReadBlockKey(alice); err != nil || string(data) != "alice" {
+				t.Fatalf("read after reopen: %q, %v", data, err)
+			}
+			if data, err := sm.ReadBlockKey(StringKey("7")); err != nil || string(data) != "seven" {
+				t.Errorf("numeric key as string: %q, %v", data, err)
+			}
+
+			if err := sm.DeleteBlockKey(alice); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := sm.ReadBlockKey(alice); !errors.Is(err, ErrBlockNotFound) {
+				t.Errorf("read deleted key: %v", err)
+			}
+			if err := sm.DeleteBlockKey(alice); !errors.Is(err, ErrBlockNotFound) {
+				t.Errorf("delete deleted key: %v", err)
+			}
+			if err := sm.WriteBlock(id, []byte("reused")); err != nil {
+				t.Errorf("id should be free after deleting the string key: %v", err)
+			}
+		})
+	}
+}
+
+// TestAssignBlockKey 测试为已有的数字键块指定字符串键，以及模式转换后字符串键保留
+func TestAssignBlockKey(t *testing.T) {
+	config := &StorageConfig{Type: StorageTypeHybrid, Path: filepath.Join(t.TempDir(), "data"), BlockSize: 4096}
+	sm, err := NewStorageManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Close()
+
+	for id := uint32(1); id <= 3; id++ {
+		if err := sm.WriteBlock(id, bytes.Repeat([]byte{byte(id)}, 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sm.AssignBlockKey(2, "reports/2024"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.AssignBlockKey(3, "reports/2024"); !errors.Is(err, ErrInvalidBlockKey) {
+		t.Errorf("duplicate name: %v", err)
+	}
+	if err := sm.AssignBlockKey(9, "missing"); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("missing block: %v", err)
+	}
+	if err := sm.DeleteBlock(2); !errors.Is(err, ErrBlockKeyConflict) {
+		t.Errorf("numeric delete of a named block: %v", err)
+	}
+	if _, err := sm.hybridStorage.ReadBlock("2"); err == nil {
+		t.Error("hybrid data should move to the string key")
+	}
+
+	// 模式转换后按字符串键读取
+	if err := sm.ConvertType(StorageTypeContainer); err != nil {
+		t.Fatal(err)
+	}
+	data, err := sm.ReadBlockKey(StringKey("reports/2024"))
+	if err != nil || !bytes.Equal(data, bytes.Repeat([]byte{2}, 100)) {
+		t.Fatalf("read after convert: %v", err)
+	}
+	if err := sm.ConvertType(StorageTypeHybrid); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.hybridStorage.ReadBlock("reports/2024"); err != nil {
+		t.Errorf("string key after converting back to hybrid: %v", err)
+	}
+}
+
+// TestAdoptHybridKeys 测试直接通过混合存储写入的字符串键在打开存储管理器时分配ID
+func TestAdoptHybridKeys(t *testing.T) {
+	config := &StorageConfig{Type: StorageTypeHybrid, Path: filepath.Join(t.TempDir(), "data"), BlockSize: 4096}
+	hs, err := NewHybridStorage(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := hs.WriteBlock("legacy", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	if err := hs.WriteBlock("5", []byte("five")); err != nil {
+		t.Fatal(err)
+	}
+	hs.Close()
+
+	sm, err := NewStorageManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Close()
+	if data, err := sm.ReadBlockKey(StringKey("legacy")); err != nil || string(data) != "old" {
+		t.Errorf("adopted key: %q, %v", data, err)
+	}
+	if data, err := sm.ReadBlock(5); err != nil || string(data) != "five" {
+		t.Errorf("numeric key: %q, %v", data, err)
+	}
+}
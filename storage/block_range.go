@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+)
+
+// clampRange 检查大小为size的块中从offset开始、长度为length的范围，length小于0或超出块末尾时截断到块末尾。
+// offset小于0或大于size时返回 ErrInvalidRange，offset等于size时返回长度0
+func clampRange(size, offset, length int64) (int64, int64, error) {
+	if offset < 0 || offset > size {
+		return 0, 0, fmt.Errorf("%w: offset %d, size %d", ErrInvalidRange, offset, size)
+	}
+	if length < 0 || length > size-offset {
+		length = size - offset
+	}
+	return offset, length, nil
+}
+
+// sliceRange 返回data中范围对应部分的副本，用于只能整块读取的数据
+func sliceRange(data []byte, offset, length int64) ([]byte, error) {
+	offset, length, err := clampRange(int64(len(data)), offset, length)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Clone(data[offset : offset+length]), nil
+}
+
+// ReadBlockRange 只读取块的[offset, offset+length)部分，用于服务HTTP范围请求等大块的局部读取。
+// length小于0表示读到块末尾，超出块末尾的部分被截断；offset超过块大小时返回 ErrInvalidRange。
+// 容器和目录存储直接读取文件中需要的部分；启用加密或块经过变换（见 SetTransformPipeline）时需要还原整个块，退化为读取整块后截取。
+// 局部读取的数据不放入块缓存
+func (sm *StorageManagerImpl) ReadBlockRange(id uint32, offset, length int64) ([]byte, error) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	if sm.expiredLocked(id) {
+		return nil, ErrBlockNotFound
+	}
+
+	if data, ok := sm.blockCache.get(id, sm.clock().Now()); ok {
+		return sliceRange(data, offset, length)
+	}
+
+	if sm.encryptionEnabled && sm.securityManager != nil {
+		return sm.readDecodedRange(id, offset, length)
+	}
+
+	// 经过变换的块需要整块还原，先读取开头判断是否有变换信封
+	head, err := sm.readBackendRange(id, 0, int64(transformHeaderMin))
+	if err != nil {
+		return nil, err
+	}
+	if hasTransformMagic(head) {
+		return sm.readDecodedRange(id, offset, length)
+	}
+
+	data, err := sm.readBackendRange(id, offset, length)
+	if err != nil && err != ErrBlockNotFound {
+		logger.Error("读取数据块范围失败", "id", id, "offset", offset, "length", length, "error", err)
+	}
+	return data, err
+}
+
+// readDecodedRange 读取整块、解密并还原变换后截取范围，调用者持有锁
+func (sm *StorageManagerImpl) readDecodedRange(id uint32, offset, length int64) ([]byte, error) {
+	data, err := sm.readBackend(id)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = sm.decodeBlock(id, data); err != nil {
+		return nil, err
+	}
+	return sliceRange(data, offset, length)
+}
+
+// readBackendRange 从当前存储读取块原始数据的一部分（调用者持有锁）
+func (sm *StorageManagerImpl) readBackendRange(id uint32, offset, length int64) ([]byte, error) {
+	switch {
+	case sm.containerStorage != nil:
+		return sm.containerStorage.ReadBlockRange(id, offset, length)
+	case sm.directoryStorage != nil:
+		return sm.directoryStorage.ReadBlockRange(id, offset, length)
+	case sm.hybridStorage != nil:
+		return sm.hybridStorage.ReadBlockRange(sm.backendKey(id), offset, length)
+	default:
+		return nil, ErrInvalidMode
+	}
+}
+
+// ReadBlockKeyRange 按块键读取块的一部分，见 ReadBlockRange
+func (sm *StorageManagerImpl) ReadBlockKeyRange(key BlockKey, offset, length int64) ([]byte, error) {
+	id, err := sm.lookupKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return sm.ReadBlockRange(id, offset, length)
+}
+
+// ReadBlockRange 只读取块记录中需要的部分，见 StorageManagerImpl.ReadBlockRange
+func (cs *ContainerStorage) ReadBlockRange(id uint32, offset, length int64) ([]byte, error) {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+
+	recordOffset, ok := cs.BlockMap[id]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+
+	header, err := cs.readRecordHeader(recordOffset)
+	if err != nil {
+		return nil, err
+	}
+	if header.State != recordUsed || header.ID != id {
+		logger.Error("容器记录与分配表不一致", "id", id, "offset", recordOffset)
+		return nil, &CorruptedError{Block: id, Err: ErrInvalidContainer}
+	}
+
+	offset, length, err = clampRange(int64(header.Size), offset, length)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, length)
+	if _, err := cs.File.ReadAt(data, int64(recordOffset)+recordHeaderSize+offset); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ReadBlockRange 只读取块文件中需要的部分，块文件无法读取时从副本读取，见 StorageManagerImpl.ReadBlockRange
+func (ds *DirectoryStorage) ReadBlockRange(id uint32, offset, length int64) ([]byte, error) {
+	if err := ds.ensureBlockMap(); err != nil {
+		return nil, err
+	}
+
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+
+	filePath, ok := ds.BlockMap[id]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+
+	data, err := ds.fdCache.readRange(ds.fs, filePath, offset, length)
+	if err == nil || errors.Is(err, ErrInvalidRange) {
+		return data, err
+	}
+	if replica, ok := ds.readReplica(id, filePath); ok {
+		return sliceRange(replica, offset, length)
+	}
+	if os.IsNotExist(err) {
+		// 映射中存在但文件已丢失
+		return nil, ErrBlockNotFound
+	}
+	return nil, err
+}
+
+// ReadBlockRange 读取块的一部分，见 StorageManagerImpl.ReadBlockRange。
+// 启用加密时读取整块解密后截取
+func (hs *HybridStorage) ReadBlockRange(blockKey string, offset, length int64) ([]byte, error) {
+	hs.mutex.RLock()
+	encrypted := hs.encryptionEnabled && hs.securityManager != nil
+	hs.mutex.RUnlock()
+
+	if encrypted {
+		data, err := hs.ReadBlock(blockKey)
+		if err != nil {
+			return nil, err
+		}
+		return sliceRange(data, offset, length)
+	}
+
+	hs.mutex.RLock()
+	defer hs.mutex.RUnlock()
+
+	if data, ok := hs.InlineBlocks[blockKey]; ok {
+		hs.tracker.RecordAccess(blockKey, int64(len(data)), LocationInline)
+		return sliceRange(data, offset, length)
+	}
+
+	id := stringToID(blockKey)
+	location := LocationContainer
+	data, err := hs.Container.ReadBlockRange(id, offset, length)
+	if err == ErrBlockNotFound {
+		location = LocationDirectory
+		data, err = hs.Directory.ReadBlockRange(id, offset, length)
+		if err != nil && err != ErrBlockNotFound && !errors.Is(err, ErrInvalidRange) {
+			return nil, fmt.Errorf("从目录存储读取失败: %w", err)
+		}
+	} else if err != nil && !errors.Is(err, ErrInvalidRange) {
+		return nil, fmt.Errorf("从容器存储读取失败: %w", err)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hs.tracker.RecordAccess(blockKey, int64(len(data)), location)
+	return data, nil
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// TestReadBlockRange 测试三种存储模式下局部读取与整块读取一致，以及范围截断和越界
+func TestReadBlockRange(t *testing.T) {
+	modes := map[string]StorageType{
+		"container": StorageTypeContainer,
+		"directory": StorageTypeDirectory,
+		"hybrid":    StorageTypeHybrid,
+	}
+	data := make([]byte, 3<<20)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+
+	for name, storageType := range modes {
+		t.Run(name, func(t *testing.T) {
+			config := &StorageConfig{Type: storageType, Path: blockKeyStoragePath(t.TempDir(), storageType), BlockSize: 4096}
+			sm, err := NewStorageManager(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sm.Close()
+
+			if err := sm.WriteBlock(1, data); err != nil {
+				t.Fatal(err)
+			}
+			if err := sm.WriteBlock(2, []byte("small")); err != nil {
+				t.Fatal(err)
+			}
+			// 清空缓存，确保从存储读取
+			sm.blockCache.clear()
+
+			tests := []struct {
+				id             uint32
+				offset, length int64
+				want           []byte
+			}{
+				{1, 0, 4096, data[:4096]},
+				{1, 2 << 20, 4096, data[2<<20 : 2<<20+4096]},
+				{1, int64(len(data)) - 10, 100, data[len(data)-10:]},
+				{1, 1 << 20, -1, data[1<<20:]},
+				{1, int64(len(data)), 10, []byte{}},
+				{2, 1, 3, []byte("mal")},
+			}
+			for _, tt := range tests {
+				got, err := sm.ReadBlockRange(tt.id, tt.offset, tt.length)
+				if err != nil {
+					t.Fatalf("ReadBlockRange(%d, %d, %d): %v", tt.id, tt.offset, tt.length, err)
+				}
+				if !bytes.Equal(got, tt.want) {
+					t.Errorf("ReadBlockRange(%d, %d, %d) returned %d bytes, want %d", tt.id, tt.offset, tt.length, len(got), len(tt.want))
+				}
+			}
+
+			if _, err := sm.ReadBlockRange(1, int64(len(data))+1, 1); !errors.Is(err, ErrInvalidRange) {
+				t.Errorf("offset past end: %v", err)
+			}
+			if _, err := sm.ReadBlockRange(1, -1, 1); !errors.Is(err, ErrInvalidRange) {
+				t.Errorf("negative offset: %v", err)
+			}
+			if _, err := sm.ReadBlockRange(3, 0, 1); !errors.Is(err, ErrBlockNotFound) {
+				t.Errorf("missing block: %v", err)
+			}
+
+			// 缓存命中时返回副本
+			if _, err := sm.ReadBlock(2); err != nil {
+				t.Fatal(err)
+			}
+			got, err := sm.ReadBlockRange(2, 0, 2)
+			if err != nil || string(got) != "sm" {
+				t.Fatalf("cached range: %q, %v", got, err)
+			}
+			got[0] = 'X'
+			if cached, _ := sm.ReadBlock(2); string(cached) != "small" {
+				t.Errorf("range read must not alias the cache: %q", cached)
+			}
+		})
+	}
+}
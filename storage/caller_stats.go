@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// callerTagKey 上下文中调用方标签的键
+type callerTagKey struct{}
+
+// WithCallerTag 在上下文中附带调用方标签。多个子系统共用一个存储管理器时，
+// ReadBlockContext、WriteBlockContext 和 DeleteBlockContext 按标签分别统计操作数、字节数和延迟（见 CallerStats）
+func WithCallerTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, callerTagKey{}, tag)
+}
+
+// CallerTagFromContext 返回上下文中的调用方标签，没有附带时返回空字符串
+func CallerTagFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	tag, _ := ctx.Value(callerTagKey{}).(string)
+	return tag
+}
+
+// OpStats 一类操作的统计
+type OpStats struct {
+	// Count 操作次数，包括失败的操作
+	Count int64
+	// Errors 失败的次数
+	Errors int64
+	// Bytes 成功读写的字节数（未加密、未变换的块数据），删除为0
+	Bytes int64
+	// TotalLatency 累计延迟
+	TotalLatency time.Duration
+	// MaxLatency 最大延迟
+	MaxLatency time.Duration
+}
+
+// AvgLatency 返回平均延迟
+func (s OpStats) AvgLatency() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.TotalLatency / time.Duration(s.Count)
+}
+
+// CallerStats 一个调用方标签的读、写、删除统计
+type CallerStats struct {
+	Read   OpStats
+	Write  OpStats
+	Delete OpStats
+}
+
+// CallerReport 按调用方标签统计的操作。没有附带标签（或标签为空）的操作，包括不带上下文的方法，不统计
+type CallerReport struct {
+	// Since 统计开始的时间：打开存储管理器或上次 ResetCallerStats 的时间
+	Since time.Time
+	// Callers 调用方标签到统计
+	Callers map[string]CallerStats
+}
+
+// callerOp 统计的操作类型
+type callerOp int
+
+const (
+	callerRead callerOp = iota
+	callerWrite
+	callerDelete
+)
+
+// opCounters 一类操作的原子计数器，字段含义与 OpStats 相同，延迟以纳秒计
+type opCounters struct {
+	count        atomic.Int64
+	errors       atomic.Int64
+	bytes        atomic.Int64
+	totalLatency atomic.Int64
+	maxLatency   atomic.Int64
+}
+
+// add 记录一次操作
+func (c *opCounters) add(bytes int, latency time.Duration, err error) {
+	c.count.Add(1)
+	c.totalLatency.Add(int64(latency))
+	for {
+		current := c.maxLatency.Load()
+		if int64(latency) <= current || c.maxLatency.CompareAndSwap(current, int64(latency)) {
+			break
+		}
+	}
+	if err != nil {
+		c.errors.Add(1)
+		return
+	}
+	c.bytes.Add(int64(bytes))
+}
+
+// stats 返回计数器的当前值，各字段分别读取
+func (c *opCounters) stats() OpStats {
+	return OpStats{
+		Count:        c.count.Load(),
+		Errors:       c.errors.Load(),
+		Bytes:        c.bytes.Load(),
+		TotalLatency: time.Duration(c.totalLatency.Load()),
+		MaxLatency:   time.Duration(c.maxLatency.Load()),
+	}
+}
+
+// callerCounters 一个调用方标签的计数器，下标为callerOp
+type callerCounters [callerDelete + 1]opCounters
+
+// callerPeriod 一个统计周期：开始时间和调用方标签到*callerCounters的映射
+type callerPeriod struct {
+	since   time.Time
+	callers sync.Map
+}
+
+// callerTracker 按调用方标签累计操作统计，记录时不加锁，重置时整体替换统计周期
+type callerTracker struct {
+	period atomic.Pointer[callerPeriod]
+}
+
+// newCallerTracker 创建从since开始统计的调用方统计
+func newCallerTracker(since time.Time) *callerTracker {
+	t := &callerTracker{}
+	t.period.Store(&callerPeriod{since: since})
+	return t
+}
+
+// record 记录一次操作，空标签不记录
+func (t *callerTracker) record(tag string, op callerOp, bytes int, latency time.Duration, err error) {
+	if tag == "" {
+		return
+	}
+	period := t.period.Load()
+	counters, ok := period.callers.Load(tag)
+	if !ok {
+		counters, _ = period.callers.LoadOrStore(tag, &callerCounters{})
+	}
+	counters.(*callerCounters)[op].add(bytes, latency, err)
+}
+
+// snapshot 返回统计的副本，reset为true时从now开始重新统计。与record并发时，
+// 重置前刚开始的操作可能记入旧的统计周期而不出现在任何报告中
+func (t *callerTracker) snapshot(reset bool, now time.Time) *CallerReport {
+	period := t.period.Load()
+	if reset {
+		period = t.period.Swap(&callerPeriod{since: now})
+	}
+
+	report := &CallerReport{Since: period.since, Callers: make(map[string]CallerStats)}
+	period.callers.Range(func(key, value any) bool {
+		counters := value.(*callerCounters)
+		report.Callers[key.(string)] = CallerStats{
+			Read:   counters[callerRead].stats(),
+			Write:  counters[callerWrite].stats(),
+			Delete: counters[callerDelete].stats(),
+		}
+		return true
+	})
+	return report
+}
+
+// CallerStats 返回本次打开（或上次 ResetCallerStats）以来按调用方标签统计的操作
+func (sm *StorageManagerImpl) CallerStats() *CallerReport {
+	return sm.callers.snapshot(false, time.Time{})
+}
+
+// ResetCallerStats 返回按调用方标签统计的操作并清零，之后重新开始统计，用于按时间段采集
+func (sm *StorageManagerImpl) ResetCallerStats() *CallerReport {
+	return sm.callers.snapshot(true, sm.clock().Now())
+}
+
+// startCall 返回上下文中的调用方标签和操作的开始时间，没有标签时不读取时钟
+func (sm *StorageManagerImpl) startCall(ctx context.Context) (string, time.Time) {
+	tag := CallerTagFromContext(ctx)
+	if tag == "" {
+		return "", time.Time{}
+	}
+	return tag, sm.clock().Now()
+}
+
+// trackCall 把从start开始的一次操作记入调用方标签的统计，空标签不统计
+func (sm *StorageManagerImpl) trackCall(tag string, op callerOp, start time.Time, bytes int, err error) {
+	if tag == "" {
+		return
+	}
+	sm.callers.record(tag, op, bytes, sm.clock().Since(start), err)
+}
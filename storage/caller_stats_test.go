@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+)
+
+// TestCallerStats 测试按上下文中的调用方标签分别统计操作数、字节数和错误
+func TestCallerStats(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	sm, err := NewStorageManager(&StorageConfig{
+		Type:      StorageTypeContainer,
+		Path:      filepath.Join(t.TempDir(), "container.db"),
+		BlockSize: 4096,
+		Clock:     fake,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Close()
+
+	indexer := WithCallerTag(context.Background(), "indexer")
+	if CallerTagFromContext(indexer) != "indexer" || CallerTagFromContext(context.Background()) != "" {
+		t.Fatal("上下文中的调用方标签不正确")
+	}
+	if err := sm.WriteBlockContext(indexer, 1, make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.ReadBlockContext(indexer, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.ReadBlockContext(indexer, 99); err == nil {
+		t.Fatal("读取不存在的块应失败")
+	}
+	if err := sm.DeleteBlockContext(indexer, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// 不带上下文的方法和空标签不统计
+	if err := sm.WriteBlock(2, make([]byte, 50)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sm.ReadBlockContext(WithCallerTag(context.Background(), ""), 2); err != nil {
+		t.Fatal(err)
+	}
+
+	report := sm.CallerStats()
+	if !report.Since.Equal(start) || len(report.Callers) != 1 {
+		t.Fatalf("调用方统计不正确: %+v", report)
+	}
+	got := report.Callers["indexer"]
+	if got.Write.Count != 1 || got.Write.Bytes != 100 ||
+		got.Read.Count != 2 || got.Read.Errors != 1 || got.Read.Bytes != 100 ||
+		got.Delete.Count != 1 || got.Delete.Bytes != 0 {
+		t.Errorf("indexer的统计不正确: %+v", got)
+	}
+	if _, ok := report.Callers[""]; ok {
+		t.Errorf("未标记调用方的操作不应统计: %+v", report.Callers)
+	}
+
+	stats, err := sm.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Callers["indexer"] != got {
+		t.Errorf("GetStats应包含调用方统计: %+v", stats.Callers)
+	}
+
+	// 重置后从当前时间重新统计
+	fake.Advance(time.Minute)
+	if report := sm.ResetCallerStats(); report.Callers["indexer"] != got {
+		t.Errorf("重置应返回重置前的统计: %+v", report)
+	}
+	report = sm.CallerStats()
+	if !report.Since.Equal(start.Add(time.Minute)) || len(report.Callers) != 0 {
+		t.Errorf("重置后的统计不正确: %+v", report)
+	}
+}
+
+// TestOpStatsLatency 测试操作统计的延迟累计
+func TestOpStatsLatency(t *testing.T) {
+	var c opCounters
+	if c.stats().AvgLatency() != 0 {
+		t.Fatal("没有操作时平均延迟应为0")
+	}
+	c.add(10, time.Millisecond, nil)
+	c.add(20, 3*time.Millisecond, errors.New("failed"))
+	if s := c.stats(); s.Count != 2 || s.Errors != 1 || s.Bytes != 10 ||
+		s.MaxLatency != 3*time.Millisecond || s.AvgLatency() != 2*time.Millisecond {
+		t.Errorf("操作统计不正确: %+v", s)
+	}
+}
@@ -0,0 +1,447 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/bpfs/fragmenta/vfs"
+)
+
+// BlockTier 分类策略选择的存储层，只对混合存储生效
+type BlockTier uint8
+
+const (
+	// TierAuto 由混合存储按块大小和访问情况决定位置
+	TierAuto BlockTier = iota
+	// TierInline 固定为内联存储
+	TierInline
+	// TierContainer 固定为容器存储
+	TierContainer
+	// TierDirectory 固定为目录存储
+	TierDirectory
+)
+
+// String 返回存储层名称
+func (t BlockTier) String() string {
+	switch t {
+	case TierAuto:
+		return "Auto"
+	case TierInline:
+		return "Inline"
+	case TierContainer:
+		return "Container"
+	case TierDirectory:
+		return "Directory"
+	default:
+		return fmt.Sprintf("BlockTier(%d)", int(t))
+	}
+}
+
+// location 返回存储层对应的混合存储位置，TierAuto返回false
+func (t BlockTier) location() (StorageLocation, bool) {
+	switch t {
+	case TierInline:
+		return LocationInline, true
+	case TierContainer:
+		return LocationContainer, true
+	case TierDirectory:
+		return LocationDirectory, true
+	default:
+		return 0, false
+	}
+}
+
+// BlockPolicy 分类器为块选择的存储策略，零值表示不压缩、不加密、自动选择存储层、不过期
+type BlockPolicy struct {
+	// Compression 压缩变换，如 &GzipTransform{}，nil表示不压缩
+	Compression BlockTransform
+	// Encrypt 用安全管理器加密块（见 EncryptTransform），安全管理器需要实现 BlockEncrypter。
+	// 启用了全局加密（见 SetEncryptionEnabled）时所有块都会加密
+	Encrypt bool
+	// Object 块所属的对象或租户，不为空时用该对象的数据密钥加密（隐含 Encrypt），安全管理器需要实现 ObjectEncrypter。
+	// CryptoErase 销毁对象的数据密钥后，这些块不需要重写即无法恢复
+	Object string
+	// Tier 混合存储中块的存放位置，固定位置的块不参与重平衡
+	Tier BlockTier
+	// TTL 块的存活时间，0表示不过期。过期的块读取时返回 ErrBlockNotFound，由 PurgeExpired 删除
+	TTL time.Duration
+	// Retention 写入后的保留期限（见 StorageManagerImpl.SetRetention），0表示不保留
+	Retention time.Duration
+}
+
+// BlockClassInfo 分类器可用的块信息
+type BlockClassInfo struct {
+	// ID 内部块ID
+	ID uint32
+	// Key 块键，按命名空间或前缀组织的键可以用于区分数据类别
+	Key BlockKey
+	// Size 块大小
+	Size int
+	// ContentType 根据数据开头嗅探出的MIME类型（见 http.DetectContentType）
+	ContentType string
+	// Data 块数据，分类器不能修改
+	Data []byte
+}
+
+// BlockClassifier 在每次写入前为块选择存储策略（见 StorageManagerImpl.SetClassifier），
+// 在存储管理器的写锁下调用，不能访问存储管理器
+type BlockClassifier func(info *BlockClassInfo) BlockPolicy
+
+// blockPolicyEntry 需要持久化的块策略，只记录有固定存储层、过期时间或保留策略（见 SetRetention）的块
+type blockPolicyEntry struct {
+	tier        BlockTier
+	legalHold   bool
+	expiresAt   time.Time
+	retainUntil time.Time
+}
+
+// 块策略表文件格式（大端序），保存在存储路径旁的.policy文件中：
+//
+//	magic(4) | version(2) | reserved(2) | count(4)
+//	count x [ id(4) | tier(1) | flags(1) | expiresAt(8) | retainUntil(8) ]
+//	crc32(4)  —— 对之前所有字节计算的CRC32-C校验和
+//
+// 时间为Unix纳秒，0表示未设置；flags的最低位表示法律保留。版本1的条目没有flags和retainUntil
+const (
+	// policyTableMagic 块策略表魔数 "FBPT"
+	policyTableMagic uint32 = 0x46425054
+	// policyTableVersion 块策略表格式版本
+	policyTableVersion uint16 = 2
+	// policyEntrySizeV1 版本1每个条目的字节数
+	policyEntrySizeV1 = 13
+	// policyEntrySize 每个条目的字节数
+	policyEntrySize = 22
+	// policyFlagLegalHold 条目标志：法律保留
+	policyFlagLegalHold = 1
+)
+
+var (
+	// ErrPolicyTableCorrupted 表示块策略表文件已损坏
+	ErrPolicyTableCorrupted = errors.New("块策略表已损坏")
+
+	// errNotExpired 清理过期块时块已被重新写入，不再过期
+	errNotExpired = errors.New("块未过期")
+)
+
+// policyTable 块ID与持久化策略的映射，由存储管理器的锁保护
+type policyTable struct {
+	fs      vfs.FS
+	path    string // 为空时不持久化
+	durable bool
+
+	entries map[uint32]blockPolicyEntry
+}
+
+// policyTablePath 返回存储路径对应的块策略表路径
+func policyTablePath(storagePath string) string {
+	if storagePath == "" {
+		return ""
+	}
+	return storagePath + ".policy"
+}
+
+// loadPolicyTable 加载块策略表，文件不存在时返回空表
+func loadPolicyTable(fsys vfs.FS, path string, durable bool) (*policyTable, error) {
+	t := &policyTable{fs: fsys, path: path, durable: durable, entries: make(map[uint32]blockPolicyEntry)}
+	if path == "" {
+		return t, nil
+	}
+
+	data, err := fsys.ReadFile(path)
+	if os.IsNotExist(err) {
+		return t, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := t.decode(data); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// save 原子地写入块策略表
+func (t *policyTable) save() error {
+	if t.path == "" {
+		return nil
+	}
+	return writeFileAtomic(t.fs, t.path, t.encode(), 0644, t.durable)
+}
+
+// encode 按ID顺序编码块策略表
+func (t *policyTable) encode() []byte {
+	ids := make([]uint32, 0, len(t.entries))
+	for id := range t.entries {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, policyTableMagic)
+	binary.Write(&buf, binary.BigEndian, policyTableVersion)
+	binary.Write(&buf, binary.BigEndian, uint16(0))
+	binary.Write(&buf, binary.BigEndian, uint32(len(ids)))
+	for _, id := range ids {
+		entry := t.entries[id]
+		var flags byte
+		if entry.legalHold {
+			flags |= policyFlagLegalHold
+		}
+		binary.Write(&buf, binary.BigEndian, id)
+		buf.WriteByte(byte(entry.tier))
+		buf.WriteByte(flags)
+		binary.Write(&buf, binary.BigEndian, unixNano(entry.expiresAt))
+		binary.Write(&buf, binary.BigEndian, unixNano(entry.retainUntil))
+	}
+
+	checksum := crc32.Checksum(buf.Bytes(), metaIndexCRCTable)
+	binary.Write(&buf, binary.BigEndian, checksum)
+	return buf.Bytes()
+}
+
+// decode 解析块策略表，校验失败时返回ErrPolicyTableCorrupted
+func (t *policyTable) decode(data []byte) error {
+	// 头部12字节 + 校验和4字节
+	if len(data) < 16 {
+		return ErrPolicyTableCorrupted
+	}
+	body := data[:len(data)-4]
+	if crc32.Checksum(body, metaIndexCRCTable) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+		return ErrPolicyTableCorrupted
+	}
+	if binary.BigEndian.Uint32(body) != policyTableMagic {
+		return ErrPolicyTableCorrupted
+	}
+	size := policyEntrySize
+	switch version := binary.BigEndian.Uint16(body[4:]); version {
+	case 1:
+		size = policyEntrySizeV1
+	case policyTableVersion:
+	default:
+		return fmt.Errorf("不支持的块策略表版本: %d", version)
+	}
+	count := binary.BigEndian.Uint32(body[8:])
+	entries := body[12:]
+	if uint64(count)*uint64(size) != uint64(len(entries)) {
+		return ErrPolicyTableCorrupted
+	}
+
+	for i := range int(count) {
+		e := entries[i*size : (i+1)*size]
+		entry := blockPolicyEntry{tier: BlockTier(e[4])}
+		if size == policyEntrySizeV1 {
+			entry.expiresAt = fromUnixNano(binary.BigEndian.Uint64(e[5:]))
+		} else {
+			entry.legalHold = e[5]&policyFlagLegalHold != 0
+			entry.expiresAt = fromUnixNano(binary.BigEndian.Uint64(e[6:]))
+			entry.retainUntil = fromUnixNano(binary.BigEndian.Uint64(e[14:]))
+		}
+		t.entries[binary.BigEndian.Uint32(e)] = entry
+	}
+	return nil
+}
+
+// unixNano 返回时间的Unix纳秒，零值时间返回0
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+// fromUnixNano 把Unix纳秒转换为时间，0返回零值时间
+func fromUnixNano(ns uint64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(ns))
+}
+
+// SetClassifier 设置块分类器，之后每次写入按分类器返回的策略压缩、加密、选择存储层和过期时间，
+// nil表示所有块使用默认管道（见 SetTransformPipeline）且不过期。策略在块被覆盖写入时重新选择
+func (sm *StorageManagerImpl) SetClassifier(classifier BlockClassifier) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.classifier = classifier
+}
+
+// classifyLocked 调用分类器为块选择策略，没有分类器时返回nil（调用者持有写锁）
+func (sm *StorageManagerImpl) classifyLocked(id uint32, key BlockKey, data []byte) *BlockPolicy {
+	if sm.classifier == nil {
+		return nil
+	}
+	policy := sm.classifier(&BlockClassInfo{
+		ID:          id,
+		Key:         key,
+		Size:        len(data),
+		ContentType: http.DetectContentType(data),
+		Data:        data,
+	})
+	return &policy
+}
+
+// blockPipeline 返回按策略写入块时使用的变换：压缩、加密，之后是默认管道中的其他变换（如签名）。
+// policy为nil时使用默认管道（调用者持有写锁）
+func (sm *StorageManagerImpl) blockPipeline(policy *BlockPolicy) ([]BlockTransform, error) {
+	if policy == nil {
+		return sm.pipeline, nil
+	}
+	var pipeline []BlockTransform
+	if policy.Compression != nil {
+		if err := checkTransform(policy.Compression); err != nil {
+			return nil, err
+		}
+		sm.registerTransformLocked(policy.Compression)
+		pipeline = append(pipeline, policy.Compression)
+	}
+	if policy.Encrypt || policy.Object != "" {
+		encrypter, ok := sm.securityManager.(BlockEncrypter)
+		if !ok {
+			return nil, fmt.Errorf("%w: 安全管理器不支持按块加密", ErrInvalidOperation)
+		}
+		if _, ok := encrypter.(ObjectEncrypter); policy.Object != "" && !ok {
+			return nil, fmt.Errorf("%w: 安全管理器不支持对象数据密钥", ErrInvalidOperation)
+		}
+		pipeline = append(pipeline, &EncryptTransform{Encrypter: encrypter, Object: policy.Object})
+	}
+	for _, t := range sm.pipeline {
+		if !slices.ContainsFunc(pipeline, func(p BlockTransform) bool { return p.Name() == t.Name() }) {
+			pipeline = append(pipeline, t)
+		}
+	}
+	return pipeline, nil
+}
+
+// transformByName 查找读取时使用的变换：先查已注册的变换，再查内置的gzip和使用安全管理器的encrypt
+func (sm *StorageManagerImpl) transformByName(name string) (BlockTransform, bool) {
+	if t, ok := sm.transforms[name]; ok {
+		return t, true
+	}
+	switch name {
+	case "gzip":
+		return &GzipTransform{}, true
+	case "encrypt":
+		if encrypter, ok := sm.securityManager.(BlockEncrypter); ok {
+			return &EncryptTransform{Encrypter: encrypter}, true
+		}
+	}
+	return nil, false
+}
+
+// loadPolicies 加载存储路径旁边的块策略表，混合存储中固定存储层的块不参与重平衡
+// （调用者持有写锁或在初始化期间）
+func (sm *StorageManagerImpl) loadPolicies() error {
+	policies, err := loadPolicyTable(sm.fsys(), policyTablePath(sm.config.Path), sm.config.Durability != DurabilityNone)
+	if err != nil {
+		return err
+	}
+	sm.policies = policies
+	for id, entry := range policies.entries {
+		sm.pinTierLocked(id, entry.tier)
+	}
+	return nil
+}
+
+// pinTierLocked 在混合存储中固定或取消固定块的存储层，之后写入和重平衡都使用该位置（调用者持有写锁）
+func (sm *StorageManagerImpl) pinTierLocked(id uint32, tier BlockTier) {
+	if sm.hybridStorage == nil {
+		return
+	}
+	location, pinned := tier.location()
+	sm.hybridStorage.setPin(sm.backendKey(id), location, pinned)
+}
+
+// recordPolicyLocked 写入成功后保存块的存储层、过期时间和保留期限，policy为nil或没有需要持久化的策略时删除记录。
+// 保留中的块不能覆盖写入，因此不需要保留旧的保留策略（调用者持有写锁）
+func (sm *StorageManagerImpl) recordPolicyLocked(id uint32, policy *BlockPolicy) error {
+	var entry blockPolicyEntry
+	if policy != nil {
+		now := sm.clock().Now()
+		entry.tier = policy.Tier
+		if policy.TTL > 0 {
+			entry.expiresAt = now.Add(policy.TTL)
+		}
+		if policy.Retention > 0 {
+			entry.retainUntil = now.Add(policy.Retention)
+		}
+	}
+	old, existed := sm.policies.entries[id]
+	if entry == (blockPolicyEntry{}) {
+		if !existed {
+			return nil
+		}
+		delete(sm.policies.entries, id)
+	} else {
+		if existed && old == entry {
+			return nil
+		}
+		sm.policies.entries[id] = entry
+	}
+	return sm.policies.save()
+}
+
+// forgetPolicyLocked 删除块的策略记录（调用者持有写锁）
+func (sm *StorageManagerImpl) forgetPolicyLocked(id uint32) {
+	if _, ok := sm.policies.entries[id]; !ok {
+		return
+	}
+	delete(sm.policies.entries, id)
+	if err := sm.policies.save(); err != nil {
+		// 块已删除，残留的记录在块重新写入时被覆盖
+		logger.Warning("保存块策略表失败", "error", err)
+	}
+}
+
+// expiredLocked 返回块是否已过期（调用者持有锁）
+func (sm *StorageManagerImpl) expiredLocked(id uint32) bool {
+	entry, ok := sm.policies.entries[id]
+	return ok && !entry.expiresAt.IsZero() && !sm.clock().Now().Before(entry.expiresAt)
+}
+
+// BlockPolicyOf 返回块持久化的存储层和过期时间，没有记录时返回TierAuto和零值时间
+func (sm *StorageManagerImpl) BlockPolicyOf(id uint32) (BlockTier, time.Time) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	entry := sm.policies.entries[id]
+	return entry.tier, entry.expiresAt
+}
+
+// PurgeExpired 删除所有已过期的块并通知块回调，返回删除的块数。
+// 自动检查（见 StorageConfig.AutoConvertThreshold）启用时在后台定期执行
+func (sm *StorageManagerImpl) PurgeExpired() (int, error) {
+	sm.mutex.RLock()
+	var expired []BlockKey
+	for id := range sm.policies.entries {
+		if sm.expiredLocked(id) {
+			expired = append(expired, sm.keyForIDLocked(id))
+		}
+	}
+	sm.mutex.RUnlock()
+
+	purged := 0
+	var errs []error
+	for _, key := range expired {
+		id, err := sm.deleteBlock(key, true)
+		switch {
+		case err == nil:
+			purged++
+			sm.emitDeleted(id)
+		case errors.Is(err, errNotExpired), errors.Is(err, ErrBlockNotFound), errors.Is(err, ErrRetained):
+			// 块在检查之后被重新写入或已被删除，或仍在保留中
+		default:
+			errs = append(errs, fmt.Errorf("删除过期的块%s失败: %w", key, err))
+		}
+	}
+	if purged > 0 {
+		logger.Info("已删除过期的块", "count", purged)
+	}
+	return purged, errors.Join(errs...)
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+)
+
+// xorEncrypter 按字节异或的测试加密器
+type xorEncrypter struct{}
+
+func (xorEncrypter) EncryptBlock(_ context.Context, _ uint32, data []byte) ([]byte, error) {
+	out := bytes.Clone(data)
+	for i := range out {
+		out[i] ^= 0x5a
+	}
+	return out, nil
+}
+
+func (e xorEncrypter) DecryptBlock(ctx context.Context, id uint32, data []byte) ([]byte, error) {
+	return e.EncryptBlock(ctx, id, data)
+}
+
+// recordingHook 记录删除通知的测试回调
+type recordingHook struct {
+	deleted []uint32
+}
+
+func (h *recordingHook) BlockWritten(uint32, []byte) {}
+
+func (h *recordingHook) BlockDeleted(id uint32) { h.deleted = append(h.deleted, id) }
+
+// testClassifier 按块键前缀和内容类型选择策略
+func testClassifier(info *BlockClassInfo) BlockPolicy {
+	var policy BlockPolicy
+	name := info.Key.String()
+	if strings.HasPrefix(name, "secret/") {
+		policy.Encrypt = true
+	}
+	if strings.HasPrefix(info.ContentType, "text/") && info.Size > 64 {
+		policy.Compression = &GzipTransform{}
+	}
+	if strings.HasPrefix(name, "tmp/") {
+		policy.TTL = time.Hour
+	}
+	return policy
+}
+
+// TestClassifierPolicies 测试按分类策略加密、压缩和过期，策略在重新打开后保留
+func TestClassifierPolicies(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	config := &StorageConfig{
+		Type:       StorageTypeContainer,
+		Path:       filepath.Join(t.TempDir(), "blocks.db"),
+		BlockSize:  4096,
+		Clock:      fake,
+		Classifier: testClassifier,
+	}
+	sm, err := NewStorageManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SetSecurityManager(xorEncrypter{}); err != nil {
+		t.Fatal(err)
+	}
+
+	text := []byte(strings.Repeat("plain text ", 50))
+	blocks := map[string][]byte{
+		"secret/a": []byte("classified"),
+		"public/b": text,
+		"tmp/c":    []byte("scratch"),
+	}
+	for name, data := range blocks {
+		if err := sm.WriteBlockKey(StringKey(name), data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sm.blockCache.clear()
+
+	for name, want := range map[string]string{"secret/a": "encrypt", "public/b": "gzip", "tmp/c": ""} {
+		names, err := sm.BlockTransforms(mustLookup(t, sm, name))
+		if err != nil || strings.Join(names, ",") != want {
+			t.Errorf("%s transforms: %v, %v", name, names, err)
+		}
+	}
+	raw, _ := sm.readBackend(mustLookup(t, sm, "secret/a"))
+	if bytes.Contains(raw, []byte("classified")) {
+		t.Error("sensitive block stored in plaintext")
+	}
+	for name, data := range blocks {
+		if got, err := sm.ReadBlockKey(StringKey(name)); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("read %s: %v", name, err)
+		}
+	}
+	info, err := sm.GetBlockInfoKey(StringKey("tmp/c"))
+	if err != nil || !info.ExpiresAt.Equal(fake.Now().Add(time.Hour)) {
+		t.Errorf("expiry: %v, %v", info, err)
+	}
+
+	// 过期后不可读，清理时删除并通知回调
+	fake.Advance(2 * time.Hour)
+	if _, err := sm.ReadBlockKey(StringKey("tmp/c")); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("expired block readable: %v", err)
+	}
+	if err := sm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sm, err = NewStorageManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Close()
+	if err := sm.SetSecurityManager(xorEncrypter{}); err != nil {
+		t.Fatal(err)
+	}
+	deleted := &recordingHook{}
+	sm.AddBlockHook(deleted)
+	if _, err := sm.ReadBlockKey(StringKey("tmp/c")); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("expiry lost on reopen: %v", err)
+	}
+	if n, err := sm.PurgeExpired(); err != nil || n != 1 || len(deleted.deleted) != 1 {
+		t.Errorf("purge: %d, %v, hooks %v", n, err, deleted.deleted)
+	}
+	if _, err := sm.ReadBlockKey(StringKey("tmp/c")); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("purged block: %v", err)
+	}
+	if got, err := sm.ReadBlockKey(StringKey("secret/a")); err != nil || string(got) != "classified" {
+		t.Errorf("read encrypted block after reopen: %q, %v", got, err)
+	}
+
+	// 覆盖写入时重新分类，不再过期
+	sm.SetClassifier(nil)
+	if err := sm.WriteBlockKey(StringKey("tmp/d"), []byte("kept")); err != nil {
+		t.Fatal(err)
+	}
+	fake.Advance(24 * time.Hour)
+	if _, err := sm.ReadBlockKey(StringKey("tmp/d")); err != nil {
+		t.Errorf("unclassified block expired: %v", err)
+	}
+}
+
+// TestClassifierTier 测试混合存储按分类策略固定块的存储位置
+func TestClassifierTier(t *testing.T) {
+	sm, err := NewStorageManager(&StorageConfig{
+		Type:            StorageTypeHybrid,
+		Path:            filepath.Join(t.TempDir(), "hybrid"),
+		BlockSize:       4096,
+		InlineThreshold: 512,
+		Classifier: func(info *BlockClassInfo) BlockPolicy {
+			if strings.HasPrefix(info.Key.String(), "archive/") {
+				return BlockPolicy{Tier: TierDirectory}
+			}
+			return BlockPolicy{}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Close()
+
+	for _, name := range []string{"archive/x", "hot/y"} {
+		if err := sm.WriteBlockKey(StringKey(name), []byte("small")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]StorageType{"archive/x": StorageTypeDirectory, "hot/y": StorageTypeInline} {
+		_, location, err := sm.hybridStorage.GetBlockInfo(name)
+		if err != nil || location != want {
+			t.Errorf("%s location: %v, %v", name, location, err)
+		}
+	}
+	if tier, _ := sm.BlockPolicyOf(mustLookup(t, sm, "archive/x")); tier != TierDirectory {
+		t.Errorf("tier: %v", tier)
+	}
+	if !sm.hybridStorage.isPinned("archive/x") || sm.hybridStorage.isPinned("hot/y") {
+		t.Error("pins not recorded")
+	}
+
+	if err := sm.DeleteBlockKey(StringKey("archive/x")); err != nil {
+		t.Fatal(err)
+	}
+	if sm.hybridStorage.isPinned("archive/x") {
+		t.Error("pin kept after delete")
+	}
+}
+
+// mustLookup 返回块键对应的内部ID
+func mustLookup(t *testing.T, sm *StorageManagerImpl, name string) uint32 {
+	t.Helper()
+	id, err := sm.lookupKey(StringKey(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// stressStorageManager 用多个协程同时读写、删除和查询统计，
+// 在 -race 下运行时可以发现未加锁的共享状态
+func stressStorageManager(t *testing.T, sm *StorageManagerImpl) {
+	t.Helper()
+
+	const (
+		goroutines = 8
+		iterations = 200
+		blocks     = 32
+	)
+	block := func(id uint32, round int) []byte {
+		return bytes.Repeat([]byte(fmt.Sprintf("%d:%d;", id, round)), 16)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, goroutines)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iterations; i++ {
+				id := uint32((g*iterations + i) % blocks)
+				switch i % 5 {
+				case 0, 1:
+					if err := sm.WriteBlock(id, block(id, i)); err != nil {
+						errs <- fmt.Errorf("写入块%d失败: %w", id, err)
+						return
+					}
+				case 2, 3:
+					data, err := sm.ReadBlock(id)
+					if err != nil && !errors.Is(err, ErrBlockNotFound) {
+						errs <- fmt.Errorf("读取块%d失败: %w", id, err)
+						return
+					}
+					if err == nil && !bytes.HasPrefix(data, []byte(fmt.Sprintf("%d:", id))) {
+						errs <- fmt.Errorf("块%d数据不属于该块: %q", id, data[:8])
+						return
+					}
+				case 4:
+					if err := sm.DeleteBlock(id); err != nil && !errors.Is(err, ErrBlockNotFound) {
+						errs <- fmt.Errorf("删除块%d失败: %w", id, err)
+						return
+					}
+					if _, err := sm.GetStats(); err != nil {
+						errs <- fmt.Errorf("获取统计失败: %w", err)
+						return
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// TestStorageManagerConcurrentAccess 测试三种存储模式下并发读写删除的正确性
+func TestStorageManagerConcurrentAccess(t *testing.T) {
+	modes := map[string]StorageType{
+		"container": StorageTypeContainer,
+		"directory": StorageTypeDirectory,
+		"hybrid":    StorageTypeHybrid,
+	}
+	for name, storageType := range modes {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "data")
+			if storageType == StorageTypeContainer {
+				path = filepath.Join(dir, "data.db")
+			}
+			sm, err := NewStorageManager(&StorageConfig{
+				Type:        storageType,
+				Path:        path,
+				BlockSize:   4096,
+				CacheSize:   4096,
+				CachePolicy: "lru",
+			})
+			if err != nil {
+				t.Fatalf("创建存储管理器失败: %v", err)
+			}
+			defer sm.Close()
+
+			stressStorageManager(t, sm)
+		})
+	}
+}
+
+// BenchmarkStorageManagerParallelRead 测试64个协程并发读取缓存中的块的吞吐量
+func BenchmarkStorageManagerParallelRead(b *testing.B) {
+	const (
+		readers = 64
+		blocks  = 256
+	)
+	sm, err := NewStorageManager(&StorageConfig{
+		Type:        StorageTypeContainer,
+		Path:        filepath.Join(b.TempDir(), "data.db"),
+		BlockSize:   4096,
+		CacheSize:   1 << 20,
+		CachePolicy: "lru",
+	})
+	if err != nil {
+		b.Fatalf("创建存储管理器失败: %v", err)
+	}
+	defer sm.Close()
+
+	data := bytes.Repeat([]byte{0xAB}, 1024)
+	for id := uint32(0); id < blocks; id++ {
+		if err := sm.WriteBlock(id, data); err != nil {
+			b.Fatalf("写入块失败: %v", err)
+		}
+	}
+
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	var wg sync.WaitGroup
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := r; i < b.N; i += readers {
+				if _, err := sm.ReadBlock(uint32(i % blocks)); err != nil {
+					b.Errorf("读取块失败: %v", err)
+					return
+				}
+			}
+		}(r)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,698 @@
+// package storage 提供容器存储的实现，包括磁盘分配表与空闲空间管理
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sort"
+)
+
+// 容器文件格式（大端序）:
+//
+//	文件头(64字节):
+//	  magic(4) | version(2) | flags(2) | tableOffset(8) | tableSize(8) | dataEnd(8) | crc32(4) | 填充
+//	数据区（从64字节开始，直到dataEnd），由连续的记录组成，每条记录:
+//	  capacity(4) | size(4) | id(4) | state(1) | reserved(3) | data(capacity)
+//	分配表（位于dataEnd之后，仅在Flush时写入）:
+//	  magic(4) | blockCount(4) | blockCount x [id(4) | offset(8)]
+//	  freeCount(4) | freeCount x [offset(8) | capacity(4)] | crc32(4)
+//
+// 第一次修改时文件头中的tableOffset会被清零，异常退出后重新打开时通过扫描记录头重建分配表。
+// 释放的大记录保留记录头，数据部分在支持的文件系统上被打洞归还磁盘空间（读取为全零）。
+const (
+	// containerMagic 容器文件魔数 "FDCS"
+	containerMagic uint32 = 0x46444353
+	// containerVersion 容器文件格式版本
+	containerVersion uint16 = 1
+	// containerHeaderSize 容器文件头大小
+	containerHeaderSize = 64
+	// allocTableMagic 分配表魔数 "FDAT"
+	allocTableMagic uint32 = 0x46444154
+	// recordHeaderSize 记录头大小
+	recordHeaderSize = 16
+	// minSplitCapacity 拆分空闲区时剩余部分的最小容量，避免产生过多碎片
+	minSplitCapacity = 64
+)
+
+// 记录状态
+const (
+	recordUsed uint8 = 1
+	recordFree uint8 = 2
+)
+
+// 空闲空间分配策略
+const (
+	// AllocBestFit 最佳适配：选择能容纳数据的最小空闲区
+	AllocBestFit = "best-fit"
+	// AllocFirstFit 首次适配：选择偏移最小的可容纳空闲区
+	AllocFirstFit = "first-fit"
+)
+
+var (
+	// ErrInvalidContainer 表示文件不是有效的容器文件
+	ErrInvalidContainer = errors.New("无效的容器文件")
+
+	// containerCRCTable 容器校验表
+	containerCRCTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// FreeExtent 容器中的空闲区
+type FreeExtent struct {
+	// Offset 空闲记录的起始偏移（指向记录头）
+	Offset uint64
+	// Capacity 可用于数据的容量（不含记录头）
+	Capacity uint32
+}
+
+// recordHeader 容器记录头
+type recordHeader struct {
+	Capacity uint32
+	Size     uint32
+	ID       uint32
+	State    uint8
+}
+
+// encode 编码记录头
+func (h *recordHeader) encode() []byte {
+	buf := make([]byte, recordHeaderSize)
+	binary.BigEndian.PutUint32(buf[0:4], h.Capacity)
+	binary.BigEndian.PutUint32(buf[4:8], h.Size)
+	binary.BigEndian.PutUint32(buf[8:12], h.ID)
+	buf[12] = h.State
+	return buf
+}
+
+// decodeRecordHeader 解码记录头
+func decodeRecordHeader(buf []byte) recordHeader {
+	return recordHeader{
+		Capacity: binary.BigEndian.Uint32(buf[0:4]),
+		Size:     binary.BigEndian.Uint32(buf[4:8]),
+		ID:       binary.BigEndian.Uint32(buf[8:12]),
+		State:    buf[12],
+	}
+}
+
+// WriteBlock 写入块
+func (cs *ContainerStorage) WriteBlock(id uint32, data []byte) error {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if err := cs.markDirty(); err != nil {
+		return err
+	}
+
+	size := uint32(len(data))
+
+	// 块已存在且容量足够时原地覆盖
+	if offset, ok := cs.BlockMap[id]; ok {
+		header, err := cs.readRecordHeader(offset)
+		if err != nil {
+			return err
+		}
+		if header.Capacity >= size {
+			header.Size = size
+			if err := cs.writeRecord(offset, header, data); err != nil {
+				return err
+			}
+			cs.updateStats()
+			return cs.syncAfterWrite()
+		}
+
+		// 容量不足，释放旧空间后重新分配
+		if err := cs.freeRecord(offset, header.Capacity); err != nil {
+			return err
+		}
+		delete(cs.BlockMap, id)
+	}
+
+	offset, capacity, err := cs.allocateSpace(size)
+	if err != nil {
+		return err
+	}
+
+	header := recordHeader{Capacity: capacity, Size: size, ID: id, State: recordUsed}
+	if err := cs.writeRecord(offset, header, data); err != nil {
+		return err
+	}
+
+	cs.BlockMap[id] = offset
+	cs.updateStats()
+	return cs.syncAfterWrite()
+}
+
+// ReadBlock 读取块
+func (cs *ContainerStorage) ReadBlock(id uint32) ([]byte, error) {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+
+	offset, ok := cs.BlockMap[id]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+
+	header, err := cs.readRecordHeader(offset)
+	if err != nil {
+		return nil, err
+	}
+	if header.State != recordUsed || header.ID != id {
+		logger.Error("容器记录与分配表不一致", "id", id, "offset", offset)
+		return nil, &CorruptedError{Block: id, Err: ErrInvalidContainer}
+	}
+
+	data := make([]byte, header.Size)
+	if _, err := cs.File.ReadAt(data, int64(offset)+recordHeaderSize); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// DeleteBlock 删除块
+func (cs *ContainerStorage) DeleteBlock(id uint32) error {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	offset, ok := cs.BlockMap[id]
+	if !ok {
+		return ErrBlockNotFound
+	}
+
+	if err := cs.markDirty(); err != nil {
+		return err
+	}
+
+	header, err := cs.readRecordHeader(offset)
+	if err != nil {
+		return err
+	}
+
+	if err := cs.freeRecord(offset, header.Capacity); err != nil {
+		return err
+	}
+
+	delete(cs.BlockMap, id)
+	cs.updateStats()
+	return cs.syncAfterWrite()
+}
+
+// GetBlockInfo 获取块信息
+func (cs *ContainerStorage) GetBlockInfo(id uint32) (*BlockInfo, error) {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+
+	offset, ok := cs.BlockMap[id]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+
+	header, err := cs.readRecordHeader(offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlockInfo{
+		ID:     id,
+		Size:   header.Size,
+		Offset: offset,
+	}, nil
+}
+
+// Optimize 优化存储：合并相邻空闲区并截断文件末尾的空闲空间
+func (cs *ContainerStorage) Optimize() error {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if len(cs.FreeSpaceList) == 0 {
+		return nil
+	}
+
+	if err := cs.markDirty(); err != nil {
+		return err
+	}
+
+	if err := cs.coalesceFreeSpace(); err != nil {
+		return err
+	}
+
+	cs.updateStats()
+	return nil
+}
+
+// Flush 将分配表写入容器文件
+func (cs *ContainerStorage) Flush() error {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	return cs.flushLocked()
+}
+
+// Close 持久化分配表并关闭容器文件
+func (cs *ContainerStorage) Close() error {
+	cs.durability.close()
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if cs.File == nil {
+		return nil
+	}
+
+	err := cs.flushLocked()
+	if closeErr := cs.File.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	cs.File = nil
+	return err
+}
+
+// flushLocked 写入分配表和文件头（调用方需持有写锁）
+func (cs *ContainerStorage) flushLocked() error {
+	if !cs.dirty {
+		return nil
+	}
+
+	table := cs.encodeAllocTable()
+
+	// 分配表紧跟在数据区之后，并截断之后的旧内容
+	if _, err := cs.File.WriteAt(table, int64(cs.dataEnd)); err != nil {
+		logger.Error("写入分配表失败", "error", err)
+		return err
+	}
+	if err := cs.File.Truncate(int64(cs.dataEnd) + int64(len(table))); err != nil {
+		logger.Error("截断容器文件失败", "error", err)
+		return err
+	}
+	durable := cs.durability.syncOnFlush()
+	if durable {
+		if err := cs.File.Sync(); err != nil {
+			logger.Error("同步容器文件失败", "error", err)
+			return err
+		}
+	}
+
+	// 分配表落盘后再更新文件头
+	if err := cs.writeContainerHeader(cs.dataEnd, uint64(len(table))); err != nil {
+		return err
+	}
+	if durable {
+		if err := cs.File.Sync(); err != nil {
+			logger.Error("同步容器文件头失败", "error", err)
+			return err
+		}
+	}
+
+	cs.dirty = false
+	return nil
+}
+
+// syncAfterWrite always-fsync级别下在每次修改后同步记录数据（调用方需持有写锁）
+// 磁盘上的分配表此时已失效，异常退出后通过扫描记录头恢复
+func (cs *ContainerStorage) syncAfterWrite() error {
+	if !cs.durability.syncOnWrite() {
+		return nil
+	}
+	if err := cs.File.Sync(); err != nil {
+		logger.Error("同步容器文件失败", "error", err)
+		return err
+	}
+	return nil
+}
+
+// syncData periodic级别的后台同步
+func (cs *ContainerStorage) syncData() error {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if cs.File == nil {
+		return nil
+	}
+	return cs.File.Sync()
+}
+
+// markDirty 标记分配表已修改；第一次修改时使磁盘上的分配表失效
+func (cs *ContainerStorage) markDirty() error {
+	if cs.dirty {
+		return nil
+	}
+
+	if err := cs.writeContainerHeader(0, 0); err != nil {
+		return err
+	}
+	// 丢弃数据区之后的旧分配表，重建时可以一直扫描到文件末尾
+	if err := cs.File.Truncate(int64(cs.dataEnd)); err != nil {
+		logger.Error("截断容器文件失败", "error", err)
+		return err
+	}
+	cs.dirty = true
+	return nil
+}
+
+// writeContainerHeader 写入文件头
+func (cs *ContainerStorage) writeContainerHeader(tableOffset, tableSize uint64) error {
+	buf := make([]byte, containerHeaderSize)
+	binary.BigEndian.PutUint32(buf[0:4], containerMagic)
+	binary.BigEndian.PutUint16(buf[4:6], containerVersion)
+	binary.BigEndian.PutUint64(buf[8:16], tableOffset)
+	binary.BigEndian.PutUint64(buf[16:24], tableSize)
+	binary.BigEndian.PutUint64(buf[24:32], cs.dataEnd)
+	binary.BigEndian.PutUint32(buf[32:36], crc32.Checksum(buf[:32], containerCRCTable))
+
+	if _, err := cs.File.WriteAt(buf, 0); err != nil {
+		logger.Error("写入容器文件头失败", "error", err)
+		return err
+	}
+	return nil
+}
+
+// load 从已有文件加载分配表，分配表无效时扫描数据区重建
+func (cs *ContainerStorage) load(fileSize int64) error {
+	if fileSize < containerHeaderSize {
+		return ErrInvalidContainer
+	}
+
+	buf := make([]byte, containerHeaderSize)
+	if _, err := cs.File.ReadAt(buf, 0); err != nil {
+		logger.Error("读取容器文件头失败", "error", err)
+		return err
+	}
+
+	if binary.BigEndian.Uint32(buf[0:4]) != containerMagic {
+		return ErrInvalidContainer
+	}
+	if version := binary.BigEndian.Uint16(buf[4:6]); version != containerVersion {
+		return fmt.Errorf("不支持的容器格式版本: %d", version)
+	}
+
+	headerValid := binary.BigEndian.Uint32(buf[32:36]) == crc32.Checksum(buf[:32], containerCRCTable)
+	tableOffset := binary.BigEndian.Uint64(buf[8:16])
+	tableSize := binary.BigEndian.Uint64(buf[16:24])
+
+	if headerValid && tableOffset >= containerHeaderSize && tableSize > 0 &&
+		tableOffset+tableSize <= uint64(fileSize) {
+		table := make([]byte, tableSize)
+		if _, err := cs.File.ReadAt(table, int64(tableOffset)); err == nil {
+			if err := cs.decodeAllocTable(table); err == nil {
+				cs.dataEnd = tableOffset
+				return nil
+			}
+		}
+	}
+
+	logger.Warn("容器分配表无效，将扫描数据区重建", "path", cs.Path)
+
+	if err := cs.rebuildByScan(uint64(fileSize)); err != nil {
+		return err
+	}
+
+	// 重建结果写回磁盘
+	cs.dirty = true
+	return cs.flushLocked()
+}
+
+// rebuildByScan 扫描数据区记录头重建分配表
+func (cs *ContainerStorage) rebuildByScan(end uint64) error {
+	cs.BlockMap = make(map[uint32]uint64)
+	cs.FreeSpaceList = []FreeExtent{}
+
+	offset := uint64(containerHeaderSize)
+	buf := make([]byte, recordHeaderSize)
+	for offset+recordHeaderSize <= end {
+		if _, err := cs.File.ReadAt(buf, int64(offset)); err != nil {
+			break
+		}
+		header := decodeRecordHeader(buf)
+
+		next := offset + recordHeaderSize + uint64(header.Capacity)
+		valid := (header.State == recordUsed || header.State == recordFree) &&
+			header.Size <= header.Capacity && next <= end
+		if !valid {
+			// 数据区末尾的不完整记录（写入过程中断），截断丢弃
+			logger.Warn("容器数据区存在不完整记录，已截断", "offset", offset)
+			break
+		}
+
+		if header.State == recordUsed {
+			if prev, dup := cs.BlockMap[header.ID]; dup {
+				// 重复的块记录（覆盖写入过程中断），保留偏移较大的新记录
+				cs.FreeSpaceList = append(cs.FreeSpaceList, FreeExtent{Offset: prev, Capacity: cs.recordCapacity(prev)})
+			}
+			cs.BlockMap[header.ID] = offset
+		} else {
+			cs.FreeSpaceList = append(cs.FreeSpaceList, FreeExtent{Offset: offset, Capacity: header.Capacity})
+		}
+
+		offset = next
+	}
+
+	cs.dataEnd = offset
+	return cs.coalesceFreeSpace()
+}
+
+// recordCapacity 读取记录容量，失败时返回0
+func (cs *ContainerStorage) recordCapacity(offset uint64) uint32 {
+	header, err := cs.readRecordHeader(offset)
+	if err != nil {
+		return 0
+	}
+	return header.Capacity
+}
+
+// encodeAllocTable 编码分配表
+func (cs *ContainerStorage) encodeAllocTable() []byte {
+	var buf bytes.Buffer
+
+	ids := make([]uint32, 0, len(cs.BlockMap))
+	for id := range cs.BlockMap {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	binary.Write(&buf, binary.BigEndian, allocTableMagic)
+	binary.Write(&buf, binary.BigEndian, uint32(len(ids)))
+	for _, id := range ids {
+		binary.Write(&buf, binary.BigEndian, id)
+		binary.Write(&buf, binary.BigEndian, cs.BlockMap[id])
+	}
+
+	binary.Write(&buf, binary.BigEndian, uint32(len(cs.FreeSpaceList)))
+	for _, extent := range cs.FreeSpaceList {
+		binary.Write(&buf, binary.BigEndian, extent.Offset)
+		binary.Write(&buf, binary.BigEndian, extent.Capacity)
+	}
+
+	binary.Write(&buf, binary.BigEndian, crc32.Checksum(buf.Bytes(), containerCRCTable))
+	return buf.Bytes()
+}
+
+// decodeAllocTable 解码分配表
+func (cs *ContainerStorage) decodeAllocTable(data []byte) error {
+	if len(data) < 16 {
+		return ErrInvalidContainer
+	}
+
+	body := data[:len(data)-4]
+	if crc32.Checksum(body, containerCRCTable) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+		return ErrInvalidContainer
+	}
+
+	r := bytes.NewReader(body)
+	var magic, blockCount uint32
+	binary.Read(r, binary.BigEndian, &magic)
+	if magic != allocTableMagic {
+		return ErrInvalidContainer
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &blockCount); err != nil || uint64(blockCount)*12 > uint64(r.Len()) {
+		return ErrInvalidContainer
+	}
+	blockMap := make(map[uint32]uint64, blockCount)
+	for i := uint32(0); i < blockCount; i++ {
+		var id uint32
+		var offset uint64
+		if err := binary.Read(r, binary.BigEndian, &id); err != nil {
+			return ErrInvalidContainer
+		}
+		if err := binary.Read(r, binary.BigEndian, &offset); err != nil {
+			return ErrInvalidContainer
+		}
+		blockMap[id] = offset
+	}
+
+	var freeCount uint32
+	if err := binary.Read(r, binary.BigEndian, &freeCount); err != nil || uint64(freeCount)*12 != uint64(r.Len()) {
+		return ErrInvalidContainer
+	}
+	freeList := make([]FreeExtent, 0, freeCount)
+	for i := uint32(0); i < freeCount; i++ {
+		var extent FreeExtent
+		binary.Read(r, binary.BigEndian, &extent.Offset)
+		binary.Read(r, binary.BigEndian, &extent.Capacity)
+		freeList = append(freeList, extent)
+	}
+
+	cs.BlockMap = blockMap
+	cs.FreeSpaceList = freeList
+	return nil
+}
+
+// readRecordHeader 读取记录头
+func (cs *ContainerStorage) readRecordHeader(offset uint64) (recordHeader, error) {
+	buf := make([]byte, recordHeaderSize)
+	if _, err := cs.File.ReadAt(buf, int64(offset)); err != nil {
+		logger.Error("读取记录头失败", "offset", offset, "error", err)
+		return recordHeader{}, err
+	}
+	return decodeRecordHeader(buf), nil
+}
+
+// writeRecord 写入记录头和数据
+func (cs *ContainerStorage) writeRecord(offset uint64, header recordHeader, data []byte) error {
+	buf := make([]byte, recordHeaderSize+len(data))
+	copy(buf, header.encode())
+	copy(buf[recordHeaderSize:], data)
+
+	if _, err := cs.File.WriteAt(buf, int64(offset)); err != nil {
+		logger.Error("写入记录失败", "offset", offset, "error", err)
+		return err
+	}
+	return nil
+}
+
+// allocateSpace 为指定大小的数据分配空间，返回记录偏移和记录容量
+func (cs *ContainerStorage) allocateSpace(size uint32) (uint64, uint32, error) {
+	index := cs.findFreeExtent(size)
+	if index < 0 {
+		// 没有合适的空闲区，在数据区末尾分配
+		offset := cs.dataEnd
+		cs.dataEnd += recordHeaderSize + uint64(size)
+		return offset, size, nil
+	}
+
+	extent := cs.FreeSpaceList[index]
+	cs.FreeSpaceList = append(cs.FreeSpaceList[:index], cs.FreeSpaceList[index+1:]...)
+
+	// 剩余空间足够大时拆分为新的空闲区
+	if extent.Capacity-size >= recordHeaderSize+minSplitCapacity {
+		remainder := FreeExtent{
+			Offset:   extent.Offset + recordHeaderSize + uint64(size),
+			Capacity: extent.Capacity - size - recordHeaderSize,
+		}
+		header := recordHeader{Capacity: remainder.Capacity, State: recordFree}
+		if _, err := cs.File.WriteAt(header.encode(), int64(remainder.Offset)); err != nil {
+			logger.Error("写入空闲记录失败", "error", err)
+			return 0, 0, err
+		}
+		cs.insertFreeExtent(remainder)
+		return extent.Offset, size, nil
+	}
+
+	return extent.Offset, extent.Capacity, nil
+}
+
+// findFreeExtent 按分配策略查找可容纳size的空闲区，未找到返回-1
+func (cs *ContainerStorage) findFreeExtent(size uint32) int {
+	best := -1
+	for i, extent := range cs.FreeSpaceList {
+		if extent.Capacity < size {
+			continue
+		}
+		if cs.AllocPolicy == AllocFirstFit {
+			// 空闲列表按偏移有序
+			return i
+		}
+		if best < 0 || extent.Capacity < cs.FreeSpaceList[best].Capacity {
+			best = i
+		}
+	}
+	return best
+}
+
+// freeRecord 将记录标记为空闲并加入空闲列表
+func (cs *ContainerStorage) freeRecord(offset uint64, capacity uint32) error {
+	header := recordHeader{Capacity: capacity, State: recordFree}
+	if _, err := cs.File.WriteAt(header.encode(), int64(offset)); err != nil {
+		logger.Error("标记空闲记录失败", "offset", offset, "error", err)
+		return err
+	}
+
+	cs.insertFreeExtent(FreeExtent{Offset: offset, Capacity: capacity})
+	if err := cs.coalesceFreeSpace(); err != nil {
+		return err
+	}
+
+	// 位于数据区末尾的记录已随截断释放
+	cs.punchFreedRecord(offset, capacity)
+	return nil
+}
+
+// insertFreeExtent 按偏移顺序插入空闲区
+func (cs *ContainerStorage) insertFreeExtent(extent FreeExtent) {
+	i := sort.Search(len(cs.FreeSpaceList), func(i int) bool {
+		return cs.FreeSpaceList[i].Offset >= extent.Offset
+	})
+	cs.FreeSpaceList = append(cs.FreeSpaceList, FreeExtent{})
+	copy(cs.FreeSpaceList[i+1:], cs.FreeSpaceList[i:])
+	cs.FreeSpaceList[i] = extent
+}
+
+// coalesceFreeSpace 合并相邻的空闲区，并回收位于数据区末尾的空闲区
+func (cs *ContainerStorage) coalesceFreeSpace() error {
+	if len(cs.FreeSpaceList) == 0 {
+		return nil
+	}
+
+	sort.Slice(cs.FreeSpaceList, func(i, j int) bool {
+		return cs.FreeSpaceList[i].Offset < cs.FreeSpaceList[j].Offset
+	})
+
+	merged := cs.FreeSpaceList[:1]
+	for _, extent := range cs.FreeSpaceList[1:] {
+		last := &merged[len(merged)-1]
+		end := last.Offset + recordHeaderSize + uint64(last.Capacity)
+		combined := uint64(last.Capacity) + recordHeaderSize + uint64(extent.Capacity)
+		if end == extent.Offset && combined <= uint64(^uint32(0)) {
+			last.Capacity = uint32(combined)
+			header := recordHeader{Capacity: last.Capacity, State: recordFree}
+			if _, err := cs.File.WriteAt(header.encode(), int64(last.Offset)); err != nil {
+				logger.Error("合并空闲记录失败", "error", err)
+				return err
+			}
+			continue
+		}
+		merged = append(merged, extent)
+	}
+
+	// 末尾的空闲区直接归还给未分配区域，同时截断文件，避免残留数据在重建时被误识别为记录
+	if last := merged[len(merged)-1]; last.Offset+recordHeaderSize+uint64(last.Capacity) == cs.dataEnd {
+		cs.dataEnd = last.Offset
+		merged = merged[:len(merged)-1]
+		if err := cs.File.Truncate(int64(cs.dataEnd)); err != nil {
+			logger.Error("截断容器文件失败", "error", err)
+			return err
+		}
+	}
+
+	cs.FreeSpaceList = merged
+	return nil
+}
+
+// updateStats 根据分配表更新统计信息
+func (cs *ContainerStorage) updateStats() {
+	var freeSpace uint64
+	for _, extent := range cs.FreeSpaceList {
+		freeSpace += recordHeaderSize + uint64(extent.Capacity)
+	}
+
+	cs.Stats.TotalBlocks = uint32(len(cs.BlockMap))
+	cs.Stats.TotalSize = cs.dataEnd
+	cs.Stats.FreeSpace = freeSpace
+	cs.Stats.UsedSpace = cs.dataEnd - containerHeaderSize - freeSpace
+	if cs.dataEnd > containerHeaderSize {
+		cs.Stats.FragmentationRatio = float64(freeSpace) / float64(cs.dataEnd-containerHeaderSize)
+	} else {
+		cs.Stats.FragmentationRatio = 0
+	}
+}
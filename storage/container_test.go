@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestContainerStoragePersistence 测试容器存储分配表的持久化与重建
+func TestContainerStoragePersistence(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "container_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := &StorageConfig{Path: filepath.Join(tempDir, "test.container")}
+
+	cs, err := NewContainerStorage(config)
+	if err != nil {
+		t.Fatalf("创建容器存储失败: %v", err)
+	}
+
+	blocks := map[uint32][]byte{
+		1:  []byte("first block"),
+		2:  bytes.Repeat([]byte{0xCD}, 4096),
+		42: []byte("block forty-two"),
+	}
+	for id, data := range blocks {
+		if err := cs.WriteBlock(id, data); err != nil {
+			t.Fatalf("写入块%d失败: %v", id, err)
+		}
+	}
+	if err := cs.Close(); err != nil {
+		t.Fatalf("关闭容器存储失败: %v", err)
+	}
+
+	verify := func(cs *ContainerStorage) {
+		t.Helper()
+		for id, expected := range blocks {
+			data, err := cs.ReadBlock(id)
+			if err != nil {
+				t.Fatalf("读取块%d失败: %v", id, err)
+			}
+			if !bytes.Equal(data, expected) {
+				t.Errorf("块%d数据不匹配", id)
+			}
+		}
+		if cs.Stats.TotalBlocks != uint32(len(blocks)) {
+			t.Errorf("块数统计不正确: 期望%d, 实际%d", len(blocks), cs.Stats.TotalBlocks)
+		}
+	}
+
+	// 重新打开，应从分配表加载
+	reopened, err := NewContainerStorage(config)
+	if err != nil {
+		t.Fatalf("重新打开容器存储失败: %v", err)
+	}
+	verify(reopened)
+
+	// 修改后未关闭（模拟崩溃），应通过扫描记录重建
+	blocks[3] = []byte("written before crash")
+	if err := reopened.WriteBlock(3, blocks[3]); err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	delete(blocks, 1)
+	if err := reopened.DeleteBlock(1); err != nil {
+		t.Fatalf("删除块失败: %v", err)
+	}
+	reopened.File.Close()
+
+	crashed, err := NewContainerStorage(config)
+	if err != nil {
+		t.Fatalf("崩溃后打开容器存储失败: %v", err)
+	}
+	verify(crashed)
+	if _, err := crashed.ReadBlock(1); err != ErrBlockNotFound {
+		t.Errorf("已删除的块不应被重建: %v", err)
+	}
+	if err := crashed.Close(); err != nil {
+		t.Fatalf("关闭容器存储失败: %v", err)
+	}
+
+	// 损坏分配表，应通过扫描重建
+	raw, err := os.ReadFile(config.Path)
+	if err != nil {
+		t.Fatalf("读取容器文件失败: %v", err)
+	}
+	tableOffset := binary.BigEndian.Uint64(raw[8:16])
+	raw[tableOffset+6] ^= 0xFF
+	if err := os.WriteFile(config.Path, raw, 0644); err != nil {
+		t.Fatalf("写入损坏的容器文件失败: %v", err)
+	}
+
+	corrupted, err := NewContainerStorage(config)
+	if err != nil {
+		t.Fatalf("打开分配表损坏的容器失败: %v", err)
+	}
+	defer corrupted.Close()
+	verify(corrupted)
+}
+
+// TestContainerStorageHoleReuse 测试空闲空间的复用与分配策略
+func TestContainerStorageHoleReuse(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "container_hole_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// 布局: [1:1000] [2:100] [3:300] [4:100]，删除1和3后留下两个空洞
+	setup := func(policy string) *ContainerStorage {
+		t.Helper()
+		cs, err := NewContainerStorage(&StorageConfig{
+			Path:             filepath.Join(tempDir, policy+".container"),
+			AllocationPolicy: policy,
+		})
+		if err != nil {
+			t.Fatalf("创建容器存储失败: %v", err)
+		}
+		for i, size := range []int{1000, 100, 300, 100} {
+			id := uint32(i + 1)
+			if err := cs.WriteBlock(id, bytes.Repeat([]byte{byte(id)}, size)); err != nil {
+				t.Fatalf("写入块%d失败: %v", id, err)
+			}
+		}
+		for _, id := range []uint32{1, 3} {
+			if err := cs.DeleteBlock(id); err != nil {
+				t.Fatalf("删除块%d失败: %v", id, err)
+			}
+		}
+		if len(cs.FreeSpaceList) != 2 {
+			t.Fatalf("应有2个空闲区, 实际%d", len(cs.FreeSpaceList))
+		}
+		return cs
+	}
+
+	tests := []struct {
+		policy   string
+		expected int // 新块应放入的空闲区下标
+	}{
+		{AllocBestFit, 1},
+		{AllocFirstFit, 0},
+	}
+
+	for _, tt := range tests {
+		cs := setup(tt.policy)
+		holes := append([]FreeExtent(nil), cs.FreeSpaceList...)
+		sizeBefore := cs.Stats.TotalSize
+
+		data := bytes.Repeat([]byte{0x55}, 250)
+		if err := cs.WriteBlock(5, data); err != nil {
+			t.Fatalf("[%s] 写入块失败: %v", tt.policy, err)
+		}
+		if cs.BlockMap[5] != holes[tt.expected].Offset {
+			t.Errorf("[%s] 新块位置不正确: 期望%d, 实际%d", tt.policy, holes[tt.expected].Offset, cs.BlockMap[5])
+		}
+		if cs.Stats.TotalSize != sizeBefore {
+			t.Errorf("[%s] 复用空洞时数据区不应增长", tt.policy)
+		}
+
+		got, err := cs.ReadBlock(5)
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("[%s] 读取复用空洞的块失败: %v", tt.policy, err)
+		}
+
+		// 删除末尾的块后，末尾空闲区应被回收
+		if err := cs.DeleteBlock(4); err != nil {
+			t.Fatalf("[%s] 删除块失败: %v", tt.policy, err)
+		}
+		if cs.Stats.TotalSize >= sizeBefore {
+			t.Errorf("[%s] 末尾空闲区应被回收", tt.policy)
+		}
+
+		if err := cs.Close(); err != nil {
+			t.Fatalf("[%s] 关闭容器存储失败: %v", tt.policy, err)
+		}
+	}
+
+	if _, err := NewContainerStorage(&StorageConfig{
+		Path:             filepath.Join(tempDir, "invalid.container"),
+		AllocationPolicy: "worst-fit",
+	}); err == nil {
+		t.Errorf("不支持的分配策略应返回错误")
+	}
+}
+
+// TestHoleRange 测试打洞范围向内对齐到文件系统块
+func TestHoleRange(t *testing.T) {
+	tests := []struct {
+		offset, length uint64
+		start, size    uint64
+	}{
+		{0, 8192, 0, 8192},
+		{80, 8192, 4096, 4096},
+		{80, 4096, 4096, 0},
+		{4096, 10000, 4096, 8192},
+	}
+	for _, tt := range tests {
+		if start, size := holeRange(tt.offset, tt.length); start != tt.start || size != tt.size {
+			t.Errorf("holeRange(%d, %d) = %d, %d, 期望 %d, %d", tt.offset, tt.length, start, size, tt.start, tt.size)
+		}
+	}
+}
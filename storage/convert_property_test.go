@@ -0,0 +1,216 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bpfs/fragmenta/throttle"
+)
+
+// convertModes 参与转换测试的存储模式
+var convertModes = []StorageType{StorageTypeContainer, StorageTypeDirectory, StorageTypeHybrid}
+
+// convertModel 随机生成的存储内容，记录每个块应有的数据
+type convertModel struct {
+	blocks  map[uint32][]byte
+	deleted map[uint32]bool
+}
+
+// randomConvertModel 在存储中写入随机的块：ID分布稀疏，大小覆盖内联、容器和目录存储的区间，
+// 并随机覆盖和删除部分块
+func randomConvertModel(t *testing.T, rng *rand.Rand, sm *StorageManagerImpl) *convertModel {
+	t.Helper()
+
+	model := &convertModel{blocks: make(map[uint32][]byte), deleted: make(map[uint32]bool)}
+	sizes := []int{1, 100, 512, 513, 4096, 100 << 10}
+	if rng.Intn(4) == 0 {
+		sizes = append(sizes, 1<<20+1)
+	}
+	for i, n := 0, 5+rng.Intn(20); i < n; i++ {
+		id := uint32(rng.Intn(64))
+		if rng.Intn(3) == 0 {
+			id = rng.Uint32()
+		}
+		data := make([]byte, sizes[rng.Intn(len(sizes))]+rng.Intn(100))
+		rng.Read(data)
+		if err := sm.WriteBlock(id, data); err != nil {
+			t.Fatalf("写入块%d失败: %v", id, err)
+		}
+		model.blocks[id] = data
+		delete(model.deleted, id)
+
+		if len(model.blocks) > 1 && rng.Intn(5) == 0 {
+			for victim := range model.blocks {
+				if err := sm.DeleteBlock(victim); err != nil {
+					t.Fatalf("删除块%d失败: %v", victim, err)
+				}
+				delete(model.blocks, victim)
+				model.deleted[victim] = true
+				break
+			}
+		}
+	}
+	return model
+}
+
+// verify 检查存储中的块与模型逐字节一致，已删除的块不存在，统计与块一致
+func (m *convertModel) verify(t *testing.T, sm *StorageManagerImpl, stage string) {
+	t.Helper()
+
+	var total uint64
+	for id, want := range m.blocks {
+		got, err := sm.ReadBlock(id)
+		if err != nil {
+			t.Errorf("%s: 读取块%d失败: %v", stage, id, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: 块%d的数据不一致（%d字节，期望%d字节）", stage, id, len(got), len(want))
+		}
+		if info, err := sm.GetBlockInfo(id); err != nil || info.Size != uint32(len(want)) {
+			t.Errorf("%s: 块%d的信息不正确: %+v, %v", stage, id, info, err)
+		}
+		total += uint64(len(want))
+	}
+	for id := range m.deleted {
+		if _, err := sm.ReadBlock(id); !errors.Is(err, ErrBlockNotFound) {
+			t.Errorf("%s: 已删除的块%d应不存在: %v", stage, id, err)
+		}
+	}
+
+	stats, err := sm.GetStats()
+	if err != nil {
+		t.Fatalf("%s: 获取统计失败: %v", stage, err)
+	}
+	if stats.TotalBlocks != uint32(len(m.blocks)) || stats.UsedSpace < total {
+		t.Errorf("%s: 统计不一致: 块数%d，已用空间%d，期望%d和至少%d", stage, stats.TotalBlocks, stats.UsedSpace, len(m.blocks), total)
+	}
+}
+
+// TestConvertTypeProperties 随机生成存储内容，在所有模式之间转换（包括转换回原模式和重新打开），
+// 检查块数据逐字节一致、已删除的块不会复活、统计与块一致
+func TestConvertTypeProperties(t *testing.T) {
+	seeds := 8
+	if testing.Short() {
+		seeds = 2
+	}
+
+	for _, from := range convertModes {
+		for _, to := range convertModes {
+			if from == to {
+				continue
+			}
+			for seed := int64(1); seed <= int64(seeds); seed++ {
+				t.Run(fmt.Sprintf("%d-%d/%d", from, to, seed), func(t *testing.T) {
+					rng := rand.New(rand.NewSource(seed*10 + int64(from)*3 + int64(to)))
+					config := &StorageConfig{
+						Type:            from,
+						Path:            filepath.Join(t.TempDir(), "store"),
+						BlockSize:       4096,
+						InlineThreshold: 512,
+					}
+					sm, err := NewStorageManager(config)
+					if err != nil {
+						t.Fatalf("创建存储失败: %v", err)
+					}
+					defer func() { sm.Close() }()
+
+					model := randomConvertModel(t, rng, sm)
+					model.verify(t, sm, "转换前")
+
+					if err := sm.ConvertType(to); err != nil {
+						t.Fatalf("转换失败: %v", err)
+					}
+					model.verify(t, sm, "转换后")
+
+					// 转换后继续写入的块同样保存在新模式中
+					extra := randomConvertModel(t, rng, sm)
+					for id := range extra.blocks {
+						delete(model.deleted, id)
+					}
+					for id, data := range extra.blocks {
+						model.blocks[id] = data
+					}
+					for id := range extra.deleted {
+						delete(model.blocks, id)
+						model.deleted[id] = true
+					}
+					model.verify(t, sm, "转换后写入")
+
+					if err := sm.ConvertType(from); err != nil {
+						t.Fatalf("转换回原模式失败: %v", err)
+					}
+					model.verify(t, sm, "转换回原模式")
+
+					// 混合存储的内联块只保存在内存中，只检查容器和目录模式重新打开后的内容
+					if from == StorageTypeHybrid {
+						return
+					}
+					if err := sm.Close(); err != nil {
+						t.Fatalf("关闭存储失败: %v", err)
+					}
+					if sm, err = NewStorageManager(config); err != nil {
+						t.Fatalf("重新打开存储失败: %v", err)
+					}
+					model.verify(t, sm, "重新打开")
+				})
+			}
+		}
+	}
+}
+
+// TestConvertTypeConcurrentWrites 限速转换期间并发写入和删除块，转换完成后这些修改都应保留
+func TestConvertTypeConcurrentWrites(t *testing.T) {
+	for _, to := range []StorageType{StorageTypeDirectory, StorageTypeHybrid} {
+		t.Run(fmt.Sprintf("%d", to), func(t *testing.T) {
+			sm, err := NewStorageManager(&StorageConfig{
+				Type:            StorageTypeContainer,
+				Path:            filepath.Join(t.TempDir(), "store"),
+				BlockSize:       4096,
+				InlineThreshold: 512,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sm.Close()
+
+			rng := rand.New(rand.NewSource(int64(to)))
+			model := randomConvertModel(t, rng, sm)
+
+			done := make(chan error, 1)
+			go func() {
+				// 每秒只允许复制约10个块，保证写入与复制交错
+				done <- sm.convertType(to, throttle.New(0, 10))
+			}()
+
+			for i := 0; i < 50; i++ {
+				id := uint32(1000 + i%10)
+				if i%4 == 3 {
+					if err := sm.DeleteBlock(id); err != nil && !errors.Is(err, ErrBlockNotFound) {
+						t.Fatal(err)
+					}
+					delete(model.blocks, id)
+					model.deleted[id] = true
+				} else {
+					data := bytes.Repeat([]byte{byte(i)}, 100+i*50)
+					if err := sm.WriteBlock(id, data); err != nil {
+						t.Fatal(err)
+					}
+					model.blocks[id] = data
+					delete(model.deleted, id)
+				}
+				time.Sleep(time.Millisecond)
+			}
+
+			if err := <-done; err != nil {
+				t.Fatalf("转换失败: %v", err)
+			}
+			model.verify(t, sm, "并发转换后")
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// CryptoErase 销毁对象（或租户）的数据密钥，分类策略中 Object 为该对象的块不需要重写即无法恢复，
+// 之后读取返回解密错误。同时清空块缓存，避免缓存的明文仍可读取。安全管理器需要实现 ObjectEncrypter，
+// 销毁由安全管理器记入审计日志
+func (sm *StorageManagerImpl) CryptoErase(ctx context.Context, objectID string) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	encrypter, ok := sm.securityManager.(ObjectEncrypter)
+	if !ok {
+		return fmt.Errorf("%w: 安全管理器不支持对象数据密钥", ErrInvalidOperation)
+	}
+	if err := encrypter.CryptoErase(ctx, objectID); err != nil {
+		return err
+	}
+	sm.blockCache.clear()
+	logger.Info("已销毁对象的数据密钥", "object", objectID)
+	return nil
+}
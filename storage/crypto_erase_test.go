@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bpfs/fragmenta/security"
+)
+
+// TestCryptoErase 测试按分类策略用租户的数据密钥加密，销毁后该租户的块无法读取而其他块不受影响
+func TestCryptoErase(t *testing.T) {
+	dir := t.TempDir()
+	secMgr, err := security.NewDefaultSecurityManager(&security.SecurityConfig{
+		EncryptionEnabled: true,
+		DefaultAlgorithm:  security.AES256GCM,
+		KeyStorePath:      filepath.Join(dir, "keys"),
+		AutoGenerateKey:   true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := secMgr.Initialize(ctx); err != nil {
+		t.Fatal(err)
+	}
+	defer secMgr.Shutdown(ctx)
+
+	sm, err := NewStorageManager(&StorageConfig{
+		Type:      StorageTypeContainer,
+		Path:      filepath.Join(dir, "blocks.db"),
+		BlockSize: 4096,
+		Classifier: func(info *BlockClassInfo) BlockPolicy {
+			tenant, _, _ := strings.Cut(info.Key.String(), "/")
+			return BlockPolicy{Object: tenant}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Close()
+	if err := sm.CryptoErase(ctx, "a"); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("erase without object encrypter: %v", err)
+	}
+	if err := sm.SetSecurityManager(secMgr); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"a/1", "a/2", "b/1"} {
+		if err := sm.WriteBlockKey(StringKey(name), []byte("data "+name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if names, _ := sm.BlockTransforms(mustLookup(t, sm, "a/1")); strings.Join(names, ",") != "encrypt" {
+		t.Errorf("transforms: %v", names)
+	}
+	if got, err := sm.ReadBlockKey(StringKey("a/2")); err != nil || string(got) != "data a/2" {
+		t.Fatalf("read before erase: %q, %v", got, err)
+	}
+
+	if err := sm.CryptoErase(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a/1", "a/2"} {
+		if _, err := sm.ReadBlockKey(StringKey(name)); !errors.Is(err, security.ErrKeyNotFound) {
+			t.Errorf("%s readable after erase: %v", name, err)
+		}
+	}
+	if got, err := sm.ReadBlockKey(StringKey("b/1")); err != nil || string(got) != "data b/1" {
+		t.Errorf("other tenant: %q, %v", got, err)
+	}
+}
@@ -0,0 +1,373 @@
+package storage
+
+import (
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bpfs/fragmenta/vfs"
+)
+
+const (
+	// DefaultDiskCacheSize 本地磁盘缓存的默认容量
+	DefaultDiskCacheSize int64 = 1 << 30
+
+	// diskCacheMagic 缓存文件的魔数（"FRDC"）
+	diskCacheMagic uint32 = 0x46524443
+
+	// diskCacheHeaderSize 缓存文件头：魔数 | CRC32
+	diskCacheHeaderSize = 8
+
+	// diskCacheExt 缓存文件扩展名
+	diskCacheExt = ".blk"
+)
+
+// BlockBackend 远程或慢速的块数据存储，例如对象存储的客户端
+type BlockBackend interface {
+	WriteBlock(id uint32, data []byte) error
+	ReadBlock(id uint32) ([]byte, error)
+	DeleteBlock(id uint32) error
+}
+
+// DiskCacheOptions 本地磁盘缓存的选项
+type DiskCacheOptions struct {
+	Dir      string // 缓存目录，不存在时创建
+	MaxBytes int64  // 缓存的块数据总大小上限，0表示DefaultDiskCacheSize
+	Sync     bool   // 写入缓存文件后同步到磁盘
+}
+
+// DiskCacheStats 本地磁盘缓存的统计
+type DiskCacheStats struct {
+	Entries   int   // 缓存的块数
+	Bytes     int64 // 缓存的块数据大小
+	Hits      int64 // 命中次数
+	Misses    int64 // 未命中次数
+	Evictions int64 // 淘汰的块数
+	Corrupted int64 // 校验失败而丢弃的缓存文件数
+}
+
+// CachedStore 在远程块存储前加一层本地磁盘缓存（通常在SSD上）
+// 读取时先查缓存，未命中时从后端读取并写入缓存；写入先写后端再更新缓存，删除同时删除缓存。
+// 缓存按最近最少使用淘汰，总大小不超过MaxBytes。每个块保存为一个带CRC32的文件，
+// 通过临时文件加重命名写入，崩溃后重新打开时丢弃残留的临时文件，校验失败的文件在读取时丢弃并回源。
+// CachedStore 可以作为FragDB的块数据存储（见 SetBlockStore）
+type CachedStore struct {
+	backend BlockBackend
+	dir     string
+	max     int64
+	sync    bool
+
+	mu      sync.Mutex
+	entries map[uint32]*diskCacheEntry
+	lru     *list.List // 前端为最近使用
+	bytes   int64
+	writes  uint64 // 写入和删除的次数，回源期间有写入时不缓存读到的旧数据
+	stats   DiskCacheStats
+}
+
+// diskCacheEntry 缓存的块
+type diskCacheEntry struct {
+	id   uint32
+	size int64
+	elem *list.Element
+}
+
+// NewCachedStore 创建带本地磁盘缓存的块存储，加载缓存目录中已有的缓存文件
+func NewCachedStore(backend BlockBackend, options *DiskCacheOptions) (*CachedStore, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("%w: 后端不能为空", ErrInvalidOperation)
+	}
+	if options == nil || options.Dir == "" {
+		return nil, fmt.Errorf("%w: 未指定缓存目录", ErrInvalidOperation)
+	}
+
+	maxBytes := options.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultDiskCacheSize
+	}
+	if err := os.MkdirAll(options.Dir, 0755); err != nil {
+		return nil, err
+	}
+
+	c := &CachedStore{
+		backend: backend,
+		dir:     options.Dir,
+		max:     maxBytes,
+		sync:    options.Sync,
+		entries: make(map[uint32]*diskCacheEntry),
+		lru:     list.New(),
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// load 扫描缓存目录，按修改时间恢复淘汰顺序，删除残留的临时文件和不完整的缓存文件
+func (c *CachedStore) load() error {
+	dirEntries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return err
+	}
+
+	type cached struct {
+		id      uint32
+		size    int64
+		modTime time.Time
+	}
+	var files []cached
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if dirEntry.IsDir() {
+			continue
+		}
+		if strings.Contains(name, diskCacheExt+".tmp-") {
+			os.Remove(filepath.Join(c.dir, name))
+			continue
+		}
+		id, ok := parseDiskCacheName(name)
+		if !ok {
+			continue
+		}
+		info, err := dirEntry.Info()
+		if err != nil || info.Size() < diskCacheHeaderSize {
+			os.Remove(filepath.Join(c.dir, name))
+			continue
+		}
+		files = append(files, cached{id: id, size: info.Size() - diskCacheHeaderSize, modTime: info.ModTime()})
+	}
+
+	// 最早使用的放在后端
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+	for _, file := range files {
+		entry := &diskCacheEntry{id: file.id, size: file.size}
+		entry.elem = c.lru.PushBack(entry)
+		c.entries[file.id] = entry
+		c.bytes += file.size
+	}
+	c.evictLocked()
+
+	if len(files) > 0 {
+		logger.Info("已加载本地磁盘缓存", "dir", c.dir, "entries", len(c.entries), "bytes", c.bytes)
+	}
+	return nil
+}
+
+// ReadBlock 读取块数据，未命中缓存时从后端读取并写入缓存
+func (c *CachedStore) ReadBlock(id uint32) ([]byte, error) {
+	if data, ok := c.readCached(id); ok {
+		return data, nil
+	}
+
+	c.mu.Lock()
+	c.stats.Misses++
+	writes := c.writes
+	c.mu.Unlock()
+
+	data, err := c.backend.ReadBlock(id)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.writes == writes {
+		c.putLocked(id, data)
+	}
+	return data, nil
+}
+
+// WriteBlock 写入后端，成功后更新缓存
+func (c *CachedStore) WriteBlock(id uint32, data []byte) error {
+	// 先删除旧的缓存，写入后端失败或崩溃时不会读到旧数据
+	c.mu.Lock()
+	c.writes++
+	c.removeLocked(id)
+	c.mu.Unlock()
+
+	if err := c.backend.WriteBlock(id, data); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.putLocked(id, data)
+	return nil
+}
+
+// DeleteBlock 删除缓存和后端中的块
+func (c *CachedStore) DeleteBlock(id uint32) error {
+	c.mu.Lock()
+	c.writes++
+	c.removeLocked(id)
+	c.mu.Unlock()
+
+	return c.backend.DeleteBlock(id)
+}
+
+// Invalidate 丢弃块的缓存，后端中的块被其他途径修改时调用
+func (c *CachedStore) Invalidate(id uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writes++
+	c.removeLocked(id)
+}
+
+// Purge 清空缓存，不影响后端
+func (c *CachedStore) Purge() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.writes++
+	var firstErr error
+	for id := range c.entries {
+		if err := c.removeLocked(id); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// Stats 返回缓存统计
+func (c *CachedStore) Stats() DiskCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = len(c.entries)
+	stats.Bytes = c.bytes
+	return stats
+}
+
+// readCached 从缓存读取块，文件损坏时丢弃缓存
+func (c *CachedStore) readCached(id uint32) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+
+	path := c.path(id)
+	raw, err := os.ReadFile(path)
+	if err == nil {
+		var data []byte
+		data, err = decodeDiskCacheFile(raw)
+		if err == nil {
+			c.lru.MoveToFront(entry.elem)
+			c.stats.Hits++
+			// 修改时间记录使用顺序，重新打开时据此恢复淘汰顺序
+			now := time.Now()
+			os.Chtimes(path, now, now)
+			return data, true
+		}
+		c.stats.Corrupted++
+	}
+
+	logger.Warn("本地磁盘缓存文件无效，已丢弃", "blockID", id, "error", err)
+	c.removeLocked(id)
+	return nil, false
+}
+
+// putLocked 写入缓存并按容量淘汰，超过容量的块不缓存。调用方需持有mu
+func (c *CachedStore) putLocked(id uint32, data []byte) {
+	size := int64(len(data))
+	if size > c.max {
+		return
+	}
+
+	if err := writeFileAtomic(vfs.OS, c.path(id), encodeDiskCacheFile(data), 0644, c.sync); err != nil {
+		logger.Warn("写入本地磁盘缓存失败", "blockID", id, "error", err)
+		c.removeLocked(id)
+		return
+	}
+
+	if entry, ok := c.entries[id]; ok {
+		c.bytes += size - entry.size
+		entry.size = size
+		c.lru.MoveToFront(entry.elem)
+	} else {
+		entry := &diskCacheEntry{id: id, size: size}
+		entry.elem = c.lru.PushFront(entry)
+		c.entries[id] = entry
+		c.bytes += size
+	}
+	c.evictLocked()
+}
+
+// evictLocked 淘汰最近最少使用的块，直到总大小不超过容量。调用方需持有mu
+func (c *CachedStore) evictLocked() {
+	for c.bytes > c.max {
+		back := c.lru.Back()
+		if back == nil {
+			return
+		}
+		c.removeLocked(back.Value.(*diskCacheEntry).id)
+		c.stats.Evictions++
+	}
+}
+
+// removeLocked 删除块的缓存文件和记录。调用方需持有mu
+func (c *CachedStore) removeLocked(id uint32) error {
+	entry, ok := c.entries[id]
+	if !ok {
+		return nil
+	}
+	c.lru.Remove(entry.elem)
+	delete(c.entries, id)
+	c.bytes -= entry.size
+
+	if err := os.Remove(c.path(id)); err != nil && !os.IsNotExist(err) {
+		logger.Warn("删除本地磁盘缓存文件失败", "blockID", id, "error", err)
+		return err
+	}
+	return nil
+}
+
+// path 块的缓存文件路径
+func (c *CachedStore) path(id uint32) string {
+	return filepath.Join(c.dir, fmt.Sprintf("%08x%s", id, diskCacheExt))
+}
+
+// parseDiskCacheName 从缓存文件名解析块ID
+func parseDiskCacheName(name string) (uint32, bool) {
+	hex, ok := strings.CutSuffix(name, diskCacheExt)
+	if !ok || len(hex) != 8 {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(id), true
+}
+
+// encodeDiskCacheFile 编码缓存文件: 魔数 | CRC32 | 数据
+func encodeDiskCacheFile(data []byte) []byte {
+	buf := make([]byte, diskCacheHeaderSize, diskCacheHeaderSize+len(data))
+	binary.BigEndian.PutUint32(buf, diskCacheMagic)
+	binary.BigEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(data))
+	return append(buf, data...)
+}
+
+// decodeDiskCacheFile 解码缓存文件并校验CRC32
+func decodeDiskCacheFile(raw []byte) ([]byte, error) {
+	if len(raw) < diskCacheHeaderSize || binary.BigEndian.Uint32(raw) != diskCacheMagic {
+		return nil, fmt.Errorf("%w: 无效的缓存文件头", ErrCorrupted)
+	}
+	data := raw[diskCacheHeaderSize:]
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(raw[4:]) {
+		return nil, fmt.Errorf("%w: 缓存文件校验和不匹配", ErrCorrupted)
+	}
+	return data, nil
+}
@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// memoryBackend 记录读取次数的内存块存储
+type memoryBackend struct {
+	mu     sync.Mutex
+	blocks map[uint32][]byte
+	reads  int
+}
+
+func (b *memoryBackend) WriteBlock(id uint32, data []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.blocks[id] = append([]byte(nil), data...)
+	return nil
+}
+
+func (b *memoryBackend) ReadBlock(id uint32) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.reads++
+	data, ok := b.blocks[id]
+	if !ok {
+		return nil, ErrBlockNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (b *memoryBackend) DeleteBlock(id uint32) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.blocks, id)
+	return nil
+}
+
+// TestCachedStore 测试本地磁盘缓存的回源、淘汰、损坏恢复和重新打开
+func TestCachedStore(t *testing.T) {
+	dir := t.TempDir()
+	backend := &memoryBackend{blocks: make(map[uint32][]byte)}
+	for id := uint32(1); id <= 4; id++ {
+		backend.blocks[id] = bytes.Repeat([]byte{byte(id)}, 100)
+	}
+
+	cache, err := NewCachedStore(backend, &DiskCacheOptions{Dir: dir, MaxBytes: 300})
+	if err != nil {
+		t.Fatalf("创建缓存失败: %v", err)
+	}
+
+	// 第一次读取回源，第二次命中
+	for i := 0; i < 2; i++ {
+		data, err := cache.ReadBlock(1)
+		if err != nil || !bytes.Equal(data, backend.blocks[1]) {
+			t.Fatalf("读取块失败: %v", err)
+		}
+	}
+	if backend.reads != 1 {
+		t.Errorf("第二次读取应命中缓存: reads=%d", backend.reads)
+	}
+
+	// 超过容量时淘汰最近最少使用的块2
+	for _, id := range []uint32{2, 3, 1, 4} {
+		cache.ReadBlock(id)
+	}
+	stats := cache.Stats()
+	if stats.Entries != 3 || stats.Bytes != 300 || stats.Evictions != 1 {
+		t.Errorf("缓存统计不正确: %+v", stats)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "00000002.blk")); !os.IsNotExist(err) {
+		t.Error("淘汰的块应删除缓存文件")
+	}
+
+	// 写入同时更新后端和缓存
+	if err := cache.WriteBlock(3, []byte("updated")); err != nil {
+		t.Fatal(err)
+	}
+	reads := backend.reads
+	if data, _ := cache.ReadBlock(3); string(data) != "updated" || backend.reads != reads {
+		t.Errorf("写入后应从缓存读到新数据: %q", data)
+	}
+	if string(backend.blocks[3]) != "updated" {
+		t.Error("写入应同步到后端")
+	}
+
+	// 删除同时删除缓存
+	if err := cache.DeleteBlock(4); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cache.ReadBlock(4); err != ErrBlockNotFound {
+		t.Errorf("删除后读取应返回ErrBlockNotFound: %v", err)
+	}
+
+	// 损坏的缓存文件被丢弃并回源
+	os.WriteFile(filepath.Join(dir, "00000001.blk"), []byte("garbage-garbage"), 0644)
+	reads = backend.reads
+	if data, err := cache.ReadBlock(1); err != nil || !bytes.Equal(data, backend.blocks[1]) || backend.reads != reads+1 {
+		t.Errorf("损坏的缓存应回源: %v", err)
+	}
+	if cache.Stats().Corrupted != 1 {
+		t.Errorf("应记录损坏的缓存文件: %+v", cache.Stats())
+	}
+
+	// 重新打开时恢复缓存并清理残留的临时文件
+	os.WriteFile(filepath.Join(dir, "00000009.blk.tmp-123"), []byte("partial"), 0644)
+	reopened, err := NewCachedStore(backend, &DiskCacheOptions{Dir: dir, MaxBytes: 300})
+	if err != nil {
+		t.Fatalf("重新打开缓存失败: %v", err)
+	}
+	if stats := reopened.Stats(); stats.Entries != cache.Stats().Entries || stats.Bytes != cache.Stats().Bytes {
+		t.Errorf("重新打开后的缓存不一致: %+v", stats)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "00000009.blk.tmp-123")); !os.IsNotExist(err) {
+		t.Error("应删除残留的临时文件")
+	}
+	reads = backend.reads
+	if data, _ := reopened.ReadBlock(3); string(data) != "updated" || backend.reads != reads {
+		t.Error("重新打开后应命中缓存")
+	}
+
+	if err := reopened.Purge(); err != nil || reopened.Stats().Entries != 0 {
+		t.Errorf("清空缓存失败: %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+	"github.com/bpfs/fragmenta/vfs"
+)
+
+const (
+	// defaultMinFreeSpace 默认的最小可用磁盘空间，低于该值时进入只读降级模式
+	defaultMinFreeSpace = 64 << 20
+	// defaultDiskCheckInterval 默认的磁盘空间检查间隔
+	defaultDiskCheckInterval = 5 * time.Second
+)
+
+// diskGuard 磁盘空间守卫：写入前按缓存的可用空间检查，空间不足时进入只读降级模式，
+// 拒绝写入而不是在写到一半时遇到ENOSPC。降级期间每隔检查间隔重新获取可用空间，
+// 恢复到最小可用空间的两倍以上后自动恢复写入。nil diskGuard不做任何检查
+type diskGuard struct {
+	path     string
+	minFree  uint64
+	interval time.Duration
+	clock    clock.Clock
+
+	mu        sync.Mutex
+	available uint64
+	checked   time.Time
+	degraded  bool
+}
+
+// newDiskGuard 按存储配置创建磁盘空间守卫，禁用、使用非操作系统文件系统或平台不支持时返回nil
+func newDiskGuard(config *StorageConfig) *diskGuard {
+	if config.DisableDiskGuard || (config.FS != nil && config.FS != vfs.OS) {
+		return nil
+	}
+	g := &diskGuard{
+		path:     filepath.Dir(config.Path),
+		minFree:  config.MinFreeSpace,
+		interval: config.DiskCheckInterval,
+		clock:    clock.OrSystem(config.Clock),
+	}
+	if g.minFree == 0 {
+		g.minFree = defaultMinFreeSpace
+	}
+	if g.interval <= 0 {
+		g.interval = defaultDiskCheckInterval
+	}
+	if _, err := GetDiskSpace(g.path); errors.Is(err, errors.ErrUnsupported) {
+		return nil
+	}
+	return g
+}
+
+// refreshLocked 重新获取可用空间并更新降级状态（调用方需持有锁）
+func (g *diskGuard) refreshLocked(now time.Time) {
+	space, err := GetDiskSpace(g.path)
+	if err != nil {
+		// 无法获取时保持原状态，写入失败时仍会通过 noteNoSpace 降级
+		logger.Warning("获取磁盘空间失败", "path", g.path, "error", err)
+		return
+	}
+	g.available, g.checked = space.Available, now
+
+	switch {
+	case !g.degraded && g.available < g.minFree:
+		g.degraded = true
+		logger.Error("磁盘空间不足，存储进入只读降级模式", "path", g.path, "available", g.available, "minFree", g.minFree)
+	case g.degraded && g.available >= 2*g.minFree:
+		g.degraded = false
+		logger.Info("磁盘空间已恢复，存储恢复写入", "path", g.path, "available", g.available)
+	}
+}
+
+// admit 检查是否可以写入size字节，降级时返回 ErrDegradedReadOnly。
+// 距上次检查超过间隔，或未降级且写入后会低于最小可用空间时重新获取可用空间
+func (g *diskGuard) admit(size uint64) error {
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// 降级期间只按间隔检查，避免每次写入都获取可用空间
+	now := g.clock.Now()
+	if now.Sub(g.checked) >= g.interval || (!g.degraded && g.available < size+g.minFree) {
+		g.refreshLocked(now)
+	}
+	if !g.degraded && g.available < size+g.minFree {
+		g.degraded = true
+		logger.Error("写入后磁盘可用空间将低于下限，存储进入只读降级模式", "path", g.path, "available", g.available, "size", size)
+	}
+	if g.degraded {
+		return fmt.Errorf("%w: 可用%d字节，下限%d字节", ErrDegradedReadOnly, g.available, g.minFree)
+	}
+	// 在下次检查前按已接受的写入估算可用空间
+	g.available -= size
+	return nil
+}
+
+// noteNoSpace 写入遇到磁盘空间不足时立即进入降级模式
+func (g *diskGuard) noteNoSpace() {
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.degraded {
+		g.degraded = true
+		g.available = 0
+		g.checked = g.clock.Now()
+		logger.Error("写入时磁盘空间不足，存储进入只读降级模式", "path", g.path)
+	}
+}
+
+// isDegraded 返回是否处于降级模式，距上次检查超过间隔时重新获取可用空间
+func (g *diskGuard) isDegraded() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if now := g.clock.Now(); now.Sub(g.checked) >= g.interval {
+		g.refreshLocked(now)
+	}
+	return g.degraded
+}
+
+// Degraded 返回存储是否因磁盘空间不足处于只读降级模式。降级期间写入、模式转换返回
+// ErrDegradedReadOnly，读取和删除不受影响；可用空间恢复到下限的两倍以上后自动恢复写入
+func (sm *StorageManagerImpl) Degraded() bool {
+	return sm.diskGuard.isDegraded()
+}
+
+// checkWriteSpace 写入前检查磁盘空间（调用者持有写锁）
+func (sm *StorageManagerImpl) checkWriteSpace(size int) error {
+	return sm.diskGuard.admit(uint64(size))
+}
+
+// noteWriteError 写入失败且原因是磁盘空间不足时进入降级模式，返回包装后的错误
+func (sm *StorageManagerImpl) noteWriteError(err error) error {
+	err = wrapNoSpace(err)
+	if errors.Is(err, ErrQuota) {
+		sm.diskGuard.noteNoSpace()
+	}
+	return err
+}
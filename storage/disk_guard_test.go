@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+)
+
+// TestDiskGuardDegradedMode 测试可用空间低于下限时只读降级，空间恢复后自动恢复写入
+func TestDiskGuardDegradedMode(t *testing.T) {
+	if _, err := GetDiskSpace(t.TempDir()); err != nil {
+		t.Skipf("当前平台不支持获取磁盘空间: %v", err)
+	}
+
+	fake := clock.NewFake(time.Unix(1700000000, 0))
+	config := &StorageConfig{
+		Type:              StorageTypeContainer,
+		Path:              filepath.Join(t.TempDir(), "data.db"),
+		BlockSize:         4096,
+		Clock:             fake,
+		MinFreeSpace:      1 << 62,
+		DiskCheckInterval: time.Minute,
+	}
+	sm, err := NewStorageManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Close()
+
+	if err := sm.WriteBlock(1, []byte("data")); !errors.Is(err, ErrDegradedReadOnly) {
+		t.Fatalf("write below the free space limit: %v", err)
+	}
+	if !sm.Degraded() {
+		t.Error("storage should be degraded")
+	}
+	if err := sm.ConvertType(StorageTypeDirectory); !errors.Is(err, ErrDegradedReadOnly) {
+		t.Errorf("convert while degraded: %v", err)
+	}
+
+	// 空间恢复后，下次检查时恢复写入
+	sm.diskGuard.mu.Lock()
+	sm.diskGuard.minFree = 1
+	sm.diskGuard.mu.Unlock()
+	if err := sm.WriteBlock(1, []byte("data")); !errors.Is(err, ErrDegradedReadOnly) {
+		t.Errorf("write before the next check: %v", err)
+	}
+	fake.Advance(time.Minute)
+	if err := sm.WriteBlock(1, []byte("data")); err != nil {
+		t.Fatalf("write after space recovered: %v", err)
+	}
+	if sm.Degraded() {
+		t.Error("storage should leave degraded mode")
+	}
+
+	// 写入遇到ENOSPC时立即降级，读取和删除不受影响
+	if err := sm.noteWriteError(syscall.ENOSPC); !errors.Is(err, ErrQuota) {
+		t.Errorf("ENOSPC should wrap ErrQuota: %v", err)
+	}
+	if err := sm.WriteBlock(2, []byte("more")); !errors.Is(err, ErrDegradedReadOnly) {
+		t.Errorf("write after ENOSPC: %v", err)
+	}
+	if data, err := sm.ReadBlock(1); err != nil || string(data) != "data" {
+		t.Errorf("read while degraded: %q, %v", data, err)
+	}
+	if err := sm.DeleteBlock(1); err != nil {
+		t.Errorf("delete while degraded: %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+package storage
+
+// DiskSpace 路径所在文件系统的空间（字节）
+type DiskSpace struct {
+	// Total 文件系统总容量
+	Total uint64
+	// Free 空闲空间，包括只有特权用户可以使用的保留空间
+	Free uint64
+	// Available 当前用户可以使用的空闲空间
+	Available uint64
+}
+
+// AvailableRatio 返回可用空间占总容量的比例，总容量未知时返回1
+func (s *DiskSpace) AvailableRatio() float64 {
+	if s.Total == 0 {
+		return 1
+	}
+	return float64(s.Available) / float64(s.Total)
+}
+
+// GetDiskSpace 返回path所在文件系统的空间，当前平台不支持时返回包装 errors.ErrUnsupported 的错误
+func GetDiskSpace(path string) (*DiskSpace, error) {
+	return diskSpace(path)
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd && !windows
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// diskSpace 当前平台不支持获取文件系统空间
+func diskSpace(path string) (*DiskSpace, error) {
+	return nil, fmt.Errorf("%w: 获取磁盘空间", errors.ErrUnsupported)
+}
@@ -0,0 +1,19 @@
+//go:build linux || darwin || freebsd
+
+package storage
+
+import "syscall"
+
+// diskSpace 通过statfs获取文件系统空间
+func diskSpace(path string) (*DiskSpace, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return nil, err
+	}
+	bsize := uint64(st.Bsize)
+	return &DiskSpace{
+		Total:     uint64(st.Blocks) * bsize,
+		Free:      uint64(st.Bfree) * bsize,
+		Available: uint64(st.Bavail) * bsize,
+	}, nil
+}
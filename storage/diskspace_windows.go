@@ -0,0 +1,27 @@
+package storage
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// procGetDiskFreeSpaceEx kernel32中的GetDiskFreeSpaceExW
+var procGetDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// diskSpace 通过GetDiskFreeSpaceExW获取卷的空间
+func diskSpace(path string) (*DiskSpace, error) {
+	name, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	var available, total, free uint64
+	ok, _, callErr := procGetDiskFreeSpaceEx.Call(
+		uintptr(unsafe.Pointer(name)),
+		uintptr(unsafe.Pointer(&available)),
+		uintptr(unsafe.Pointer(&total)),
+		uintptr(unsafe.Pointer(&free)))
+	if ok == 0 {
+		return nil, callErr
+	}
+	return &DiskSpace{Total: total, Free: free, Available: available}, nil
+}
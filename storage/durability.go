@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+	"github.com/bpfs/fragmenta/vfs"
+)
+
+// 持久化级别，控制容器和目录存储何时调用fsync
+const (
+	// DurabilityAlways 每次写入和删除后同步，返回即已落盘
+	DurabilityAlways = "always-fsync"
+	// DurabilityOnCommit 只在Flush/Close时同步（默认），异常退出可能丢失上次提交后的修改
+	DurabilityOnCommit = "fsync-on-commit"
+	// DurabilityPeriodic 后台按SyncInterval周期同步数据，Flush/Close时也同步
+	DurabilityPeriodic = "periodic"
+	// DurabilityNone 从不主动同步，由操作系统决定何时写回
+	DurabilityNone = "none"
+)
+
+// defaultSyncInterval periodic模式默认的同步间隔
+const defaultSyncInterval = time.Second
+
+// durability 存储后端的持久化策略
+type durability struct {
+	mode     string
+	interval time.Duration
+	clock    clock.Clock
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newDurability 根据配置创建持久化策略
+func newDurability(config *StorageConfig) (*durability, error) {
+	d := &durability{mode: config.Durability, interval: config.SyncInterval, clock: clock.OrSystem(config.Clock)}
+	switch d.mode {
+	case "":
+		d.mode = DurabilityOnCommit
+	case DurabilityAlways, DurabilityOnCommit, DurabilityPeriodic, DurabilityNone:
+	default:
+		return nil, fmt.Errorf("不支持的持久化级别: %s", d.mode)
+	}
+	if d.interval <= 0 {
+		d.interval = defaultSyncInterval
+	}
+	return d, nil
+}
+
+// syncOnWrite 每次修改后是否同步
+func (d *durability) syncOnWrite() bool {
+	return d.mode == DurabilityAlways
+}
+
+// syncOnFlush Flush/Close时是否同步
+func (d *durability) syncOnFlush() bool {
+	return d.mode != DurabilityNone
+}
+
+// start periodic模式下启动后台同步，其他模式不做任何事
+func (d *durability) start(syncFn func() error) {
+	if d.mode != DurabilityPeriodic || d.stop != nil {
+		return
+	}
+
+	d.stop = make(chan struct{})
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+
+		ticker := d.clock.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C():
+				if err := syncFn(); err != nil {
+					logger.Warn("周期同步失败", "error", err)
+				}
+			case <-d.stop:
+				return
+			}
+		}
+	}()
+}
+
+// close 停止后台同步并等待其退出，调用方不能持有syncFn需要的锁
+func (d *durability) close() {
+	if d.stop == nil {
+		return
+	}
+	close(d.stop)
+	d.wg.Wait()
+	d.stop = nil
+}
+
+// syncPath 同步文件或目录，部分平台不支持对目录Sync，目录同步失败时忽略
+func syncPath(fsys vfs.FS, path string, isDir bool) error {
+	f, err := fsys.Open(path)
+	if err != nil {
+		if isDir {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	if err := f.Sync(); err != nil && !isDir {
+		return err
+	}
+	return nil
+}
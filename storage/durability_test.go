@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestDurabilityModes 测试各持久化级别下容器和目录存储都能正常读写和重新打开
+func TestDurabilityModes(t *testing.T) {
+	modes := []string{"", DurabilityAlways, DurabilityOnCommit, DurabilityPeriodic, DurabilityNone}
+	data := bytes.Repeat([]byte("durable"), 100)
+
+	for _, mode := range modes {
+		dir := t.TempDir()
+		containerConfig := &StorageConfig{Path: filepath.Join(dir, "test.container"), Durability: mode, SyncInterval: 10 * time.Millisecond}
+		directoryConfig := &StorageConfig{Path: filepath.Join(dir, "blocks"), Durability: mode, SyncInterval: 10 * time.Millisecond}
+
+		cs, err := NewContainerStorage(containerConfig)
+		if err != nil {
+			t.Fatalf("[%s] 创建容器存储失败: %v", mode, err)
+		}
+		ds, err := NewDirectoryStorage(directoryConfig)
+		if err != nil {
+			t.Fatalf("[%s] 创建目录存储失败: %v", mode, err)
+		}
+
+		for _, s := range []interface {
+			WriteBlock(uint32, []byte) error
+			DeleteBlock(uint32) error
+			Close() error
+		}{cs, ds} {
+			if err := s.WriteBlock(1, data); err != nil {
+				t.Fatalf("[%s] 写入块失败: %v", mode, err)
+			}
+			if err := s.WriteBlock(2, data[:10]); err != nil {
+				t.Fatalf("[%s] 写入块失败: %v", mode, err)
+			}
+			if err := s.DeleteBlock(2); err != nil {
+				t.Fatalf("[%s] 删除块失败: %v", mode, err)
+			}
+		}
+
+		switch mode {
+		case DurabilityAlways, DurabilityNone:
+			if len(ds.unsynced) != 0 {
+				t.Errorf("[%s] 不应记录待同步的块文件: %d", mode, len(ds.unsynced))
+			}
+		case DurabilityPeriodic:
+			deadline := time.Now().Add(2 * time.Second)
+			for {
+				ds.mutex.RLock()
+				pending := len(ds.unsynced)
+				ds.mutex.RUnlock()
+				if pending == 0 {
+					break
+				}
+				if time.Now().After(deadline) {
+					t.Fatalf("[%s] 后台同步未执行", mode)
+				}
+				time.Sleep(5 * time.Millisecond)
+			}
+		default:
+			if len(ds.unsynced) != 1 {
+				t.Errorf("[%s] 应等待提交时同步: %d", mode, len(ds.unsynced))
+			}
+		}
+
+		if err := cs.Close(); err != nil {
+			t.Fatalf("[%s] 关闭容器存储失败: %v", mode, err)
+		}
+		if err := ds.Close(); err != nil {
+			t.Fatalf("[%s] 关闭目录存储失败: %v", mode, err)
+		}
+
+		cs, err = NewContainerStorage(containerConfig)
+		if err != nil {
+			t.Fatalf("[%s] 重新打开容器存储失败: %v", mode, err)
+		}
+		ds, err = NewDirectoryStorage(directoryConfig)
+		if err != nil {
+			t.Fatalf("[%s] 重新打开目录存储失败: %v", mode, err)
+		}
+		for name, read := range map[string]func(uint32) ([]byte, error){"容器": cs.ReadBlock, "目录": ds.ReadBlock} {
+			if got, err := read(1); err != nil || !bytes.Equal(got, data) {
+				t.Errorf("[%s] %s存储数据不正确: %v", mode, name, err)
+			}
+			if _, err := read(2); err != ErrBlockNotFound {
+				t.Errorf("[%s] %s存储中已删除的块应不存在: %v", mode, name, err)
+			}
+		}
+		cs.Close()
+		ds.Close()
+	}
+
+	if _, err := NewContainerStorage(&StorageConfig{Path: filepath.Join(t.TempDir(), "bad"), Durability: "sometimes"}); err == nil {
+		t.Errorf("不支持的持久化级别应返回错误")
+	}
+}
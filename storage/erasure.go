@@ -0,0 +1,584 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+)
+
+const (
+	// DefaultErasureDataShards 默认的数据分片数
+	DefaultErasureDataShards = 4
+	// DefaultErasureParityShards 默认的校验分片数
+	DefaultErasureParityShards = 2
+
+	// erasureShardMagic 分片头魔数（"FREC"）
+	erasureShardMagic uint32 = 0x46524543
+	// erasureShardVersion 分片头版本
+	erasureShardVersion uint8 = 1
+	// erasureShardHeaderSize 分片头大小
+	erasureShardHeaderSize = 28
+)
+
+// ErrErasureDataLost 可用分片少于数据分片数，块无法恢复
+var ErrErasureDataLost = errors.New("纠删码分片不足，无法恢复块")
+
+// ErasureOptions 纠删码存储的选项
+type ErasureOptions struct {
+	DataShards     int           // 数据分片数k，0表示DefaultErasureDataShards
+	ParityShards   int           // 校验分片数m，最多可丢失m个分片，0表示DefaultErasureParityShards
+	MinSize        int           // 小于该大小的块不切分，按k=1编码（相当于m+1份副本），0表示所有块都切分
+	RepairInterval time.Duration // 大于0时启动后台修复（见 StartRepair）
+	Clock          clock.Clock   // 写入时间和后台修复使用的时钟，nil表示使用系统时钟
+}
+
+// ShardLocation 纠删码分片的位置
+type ShardLocation struct {
+	Index     int  // 分片序号，小于数据分片数的是数据分片
+	Target    int  // 所在目标的序号
+	Parity    bool // 是否为校验分片
+	Available bool // 分片是否可读且完整
+}
+
+// ErasureRepairReport 一轮纠删码修复的结果
+type ErasureRepairReport struct {
+	// StartTime 开始时间
+	StartTime time.Time
+	// Duration 用时
+	Duration time.Duration
+	// Checked 检查的块数
+	Checked int
+	// Repaired 重建并写回的分片数
+	Repaired int
+	// Lost 分片不足无法恢复的块
+	Lost []uint32
+	// Errors 修复过程中的错误
+	Errors []error
+}
+
+// BlockLister 能列出所有块ID的存储，纠删码修复通过它发现需要检查的块
+type BlockLister interface {
+	ListBlockIDs() ([]uint32, error)
+}
+
+// ErasureStore 以Reed-Solomon纠删码保存块：每个块切分为k个数据分片并计算m个校验分片，
+// 分片分别写入不同的目标（不同目录上的DirectoryStorage或对象存储的不同前缀），
+// 任意m个目标丢失时仍能读出数据，存储开销为(k+m)/k，低于完整副本。适合较大的冷数据块。
+// 块的第i个分片保存在目标 (块ID+i) % 目标数 上，键为块ID；每个分片带有记录编码参数、
+// 数据大小、校验和及写入代数的分片头，读取时只使用最新一代的分片
+type ErasureStore struct {
+	targets []BlockBackend
+	k, m    int
+	minSize int
+	clock   clock.Clock
+
+	mu      sync.Mutex
+	codecs  map[int]*reedSolomon // 按数据分片数缓存的编码器
+	lastGen int64
+
+	// 后台修复，由repairMutex保护
+	repairStopCh chan struct{}
+	repairDoneCh chan struct{}
+	lastRepair   *ErasureRepairReport
+	repairMutex  sync.Mutex
+}
+
+// erasureShard 解析后的分片
+type erasureShard struct {
+	k, m       int
+	index      int
+	size       int
+	dataCRC    uint32
+	generation int64
+	payload    []byte
+}
+
+// NewErasureStore 创建纠删码存储，目标数不少于k+m
+func NewErasureStore(targets []BlockBackend, options *ErasureOptions) (*ErasureStore, error) {
+	if options == nil {
+		options = &ErasureOptions{}
+	}
+	k := options.DataShards
+	if k <= 0 {
+		k = DefaultErasureDataShards
+	}
+	m := options.ParityShards
+	if m <= 0 {
+		m = DefaultErasureParityShards
+	}
+	if k+m > 255 {
+		return nil, fmt.Errorf("%w: 分片总数%d超过255", ErrInvalidOperation, k+m)
+	}
+	if len(targets) < k+m {
+		return nil, fmt.Errorf("%w: 目标数%d少于分片总数%d", ErrInvalidOperation, len(targets), k+m)
+	}
+	for i, target := range targets {
+		if target == nil {
+			return nil, fmt.Errorf("%w: 目标%d为空", ErrInvalidOperation, i)
+		}
+	}
+
+	es := &ErasureStore{
+		targets: targets,
+		k:       k,
+		m:       m,
+		minSize: options.MinSize,
+		clock:   clock.OrSystem(options.Clock),
+		codecs:  make(map[int]*reedSolomon),
+	}
+	if options.RepairInterval > 0 {
+		es.StartRepair(options.RepairInterval)
+	}
+	return es, nil
+}
+
+// WriteBlock 编码块并写入所有分片，至少k个分片写入成功时返回成功，缺少的分片由修复补齐
+func (es *ErasureStore) WriteBlock(id uint32, data []byte) error {
+	k := es.k
+	if len(data) < es.minSize {
+		k = 1
+	}
+	codec, err := es.codec(k)
+	if err != nil {
+		return err
+	}
+
+	shards := codec.encode(data)
+	generation := es.nextGeneration()
+	dataCRC := crc32.ChecksumIEEE(data)
+
+	written := 0
+	var firstErr error
+	for i, payload := range shards {
+		shard := &erasureShard{k: k, m: es.m, index: i, size: len(data), dataCRC: dataCRC, generation: generation, payload: payload}
+		if err := es.targets[es.target(id, i)].WriteBlock(id, encodeErasureShard(shard)); err != nil {
+			logger.Warn("写入纠删码分片失败", "id", id, "shard", i, "error", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		written++
+	}
+	if written < k {
+		logger.Error("写入纠删码分片的数量不足", "id", id, "written", written, "required", k)
+		return fmt.Errorf("%w: 只写入了%d个分片: %w", ErrErasureDataLost, written, firstErr)
+	}
+
+	// 切分方式改变后，原来多出的分片位置不再使用
+	for i := len(shards); i < es.k+es.m; i++ {
+		es.targets[es.target(id, i)].DeleteBlock(id)
+	}
+	return nil
+}
+
+// ReadBlock 读取块，缺失或损坏的分片用其余分片重建
+func (es *ErasureStore) ReadBlock(id uint32) ([]byte, error) {
+	shards, found := es.readShards(id)
+	if !found {
+		return nil, ErrBlockNotFound
+	}
+	data, _, err := es.decode(id, shards)
+	return data, err
+}
+
+// DeleteBlock 删除块的所有分片
+func (es *ErasureStore) DeleteBlock(id uint32) error {
+	deleted := 0
+	var firstErr error
+	for i := 0; i < es.k+es.m; i++ {
+		err := es.targets[es.target(id, i)].DeleteBlock(id)
+		switch {
+		case err == nil:
+			deleted++
+		case !errors.Is(err, ErrBlockNotFound) && firstErr == nil:
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	if deleted == 0 {
+		return ErrBlockNotFound
+	}
+	return nil
+}
+
+// GetBlockInfo 获取块信息，Shards记录每个分片的位置和是否可用
+func (es *ErasureStore) GetBlockInfo(id uint32) (*BlockInfo, error) {
+	shards, found := es.readShards(id)
+	if !found {
+		return nil, ErrBlockNotFound
+	}
+	latest := latestErasureShard(shards)
+	if latest == nil {
+		return nil, ErrErasureDataLost
+	}
+
+	checksum := binary.BigEndian.AppendUint32(nil, latest.dataCRC)
+	info := &BlockInfo{
+		ID:        id,
+		Size:      uint32(latest.size),
+		CreatedAt: time.Unix(0, latest.generation),
+		UpdatedAt: time.Unix(0, latest.generation),
+		Checksum:  checksum,
+	}
+	for i := 0; i < latest.k+latest.m; i++ {
+		shard := shards[i]
+		info.Shards = append(info.Shards, ShardLocation{
+			Index:     i,
+			Target:    es.target(id, i),
+			Parity:    i >= latest.k,
+			Available: shard != nil && shard.generation == latest.generation,
+		})
+	}
+	return info, nil
+}
+
+// ListBlockIDs 列出目标中出现的所有块ID，至少需要一个目标实现BlockLister
+func (es *ErasureStore) ListBlockIDs() ([]uint32, error) {
+	seen := make(map[uint32]struct{})
+	listed := false
+	for _, target := range es.targets {
+		lister, ok := target.(BlockLister)
+		if !ok {
+			continue
+		}
+		ids, err := lister.ListBlockIDs()
+		if err != nil {
+			logger.Warn("列出纠删码目标中的块失败", "error", err)
+			continue
+		}
+		listed = true
+		for _, id := range ids {
+			seen[id] = struct{}{}
+		}
+	}
+	if !listed {
+		return nil, fmt.Errorf("%w: 没有可列出块的目标", ErrInvalidOperation)
+	}
+
+	ids := make([]uint32, 0, len(seen))
+	for id := range seen {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+// RepairBlock 重建块缺失、损坏或过期的分片并写回，返回写回的分片数
+func (es *ErasureStore) RepairBlock(id uint32) (int, error) {
+	shards, found := es.readShards(id)
+	if !found {
+		return 0, ErrBlockNotFound
+	}
+	_, rebuilt, err := es.decode(id, shards)
+	if err != nil {
+		return 0, err
+	}
+
+	repaired := 0
+	for i, shard := range rebuilt {
+		if existing := shards[i]; existing != nil && existing.generation == shard.generation {
+			continue
+		}
+		if err := es.targets[es.target(id, i)].WriteBlock(id, encodeErasureShard(shard)); err != nil {
+			logger.Warn("写回纠删码分片失败", "id", id, "shard", i, "error", err)
+			return repaired, err
+		}
+		repaired++
+	}
+	return repaired, nil
+}
+
+// Repair 检查所有块（见 ListBlockIDs）并重建缺失的分片
+func (es *ErasureStore) Repair() (*ErasureRepairReport, error) {
+	return es.repair(context.Background())
+}
+
+// repair 执行一轮修复，ctx取消时剩余的块留到下一轮
+func (es *ErasureStore) repair(ctx context.Context) (*ErasureRepairReport, error) {
+	report := &ErasureRepairReport{StartTime: es.clock.Now()}
+	ids, err := es.ListBlockIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if ctx.Err() != nil {
+			break
+		}
+		repaired, err := es.RepairBlock(id)
+		report.Checked++
+		report.Repaired += repaired
+		switch {
+		case errors.Is(err, ErrErasureDataLost):
+			report.Lost = append(report.Lost, id)
+		case errors.Is(err, ErrBlockNotFound):
+			// 修复期间被删除
+		case err != nil:
+			report.Errors = append(report.Errors, fmt.Errorf("修复块%d失败: %w", id, err))
+		}
+	}
+	report.Duration = es.clock.Since(report.StartTime)
+
+	es.repairMutex.Lock()
+	es.lastRepair = report
+	es.repairMutex.Unlock()
+
+	if report.Repaired > 0 || len(report.Lost) > 0 || len(report.Errors) > 0 {
+		logger.Info("纠删码修复完成",
+			"检查", report.Checked,
+			"修复分片", report.Repaired,
+			"丢失", len(report.Lost),
+			"错误", len(report.Errors))
+	}
+	return report, nil
+}
+
+// StartRepair 启动后台修复协程，按指定间隔执行Repair；已启动时不做任何事
+func (es *ErasureStore) StartRepair(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	es.repairMutex.Lock()
+	defer es.repairMutex.Unlock()
+
+	if es.repairStopCh != nil {
+		return
+	}
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	es.repairStopCh = stopCh
+	es.repairDoneCh = doneCh
+
+	go es.repairLoop(interval, stopCh, doneCh)
+
+	logger.Info("已启动纠删码后台修复", "interval", interval)
+}
+
+// StopRepair 停止后台修复协程，并等待正在进行的一轮结束
+func (es *ErasureStore) StopRepair() {
+	es.repairMutex.Lock()
+	stopCh := es.repairStopCh
+	doneCh := es.repairDoneCh
+	es.repairStopCh = nil
+	es.repairDoneCh = nil
+	es.repairMutex.Unlock()
+
+	if stopCh == nil {
+		return
+	}
+
+	close(stopCh)
+	<-doneCh
+}
+
+// repairLoop 后台修复循环
+func (es *ErasureStore) repairLoop(interval time.Duration, stopCh <-chan struct{}, doneCh chan<- struct{}) {
+	defer close(doneCh)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := es.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			if _, err := es.repair(ctx); err != nil {
+				logger.Error("纠删码后台修复失败", "error", err)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// GetLastRepairReport 获取最近一轮修复的结果，尚未执行过时返回nil
+func (es *ErasureStore) GetLastRepairReport() *ErasureRepairReport {
+	es.repairMutex.Lock()
+	defer es.repairMutex.Unlock()
+
+	return es.lastRepair
+}
+
+// Close 停止后台修复，不关闭目标
+func (es *ErasureStore) Close() error {
+	es.StopRepair()
+	return nil
+}
+
+// target 块的第i个分片所在目标的序号
+func (es *ErasureStore) target(id uint32, i int) int {
+	return int((id + uint32(i)) % uint32(len(es.targets)))
+}
+
+// codec 返回数据分片数为k的编码器
+func (es *ErasureStore) codec(k int) (*reedSolomon, error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	if codec, ok := es.codecs[k]; ok {
+		return codec, nil
+	}
+	codec, err := newReedSolomon(k, es.m)
+	if err != nil {
+		return nil, err
+	}
+	es.codecs[k] = codec
+	return codec, nil
+}
+
+// nextGeneration 返回单调递增的写入代数
+func (es *ErasureStore) nextGeneration() int64 {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	generation := es.clock.Now().UnixNano()
+	if generation <= es.lastGen {
+		generation = es.lastGen + 1
+	}
+	es.lastGen = generation
+	return generation
+}
+
+// readShards 读取块所有位置上的分片，无效的分片为nil；found表示至少有一个目标中存在该块
+func (es *ErasureStore) readShards(id uint32) ([]*erasureShard, bool) {
+	shards := make([]*erasureShard, es.k+es.m)
+	found := false
+	for i := range shards {
+		raw, err := es.targets[es.target(id, i)].ReadBlock(id)
+		if err != nil {
+			if !errors.Is(err, ErrBlockNotFound) {
+				logger.Warn("读取纠删码分片失败", "id", id, "shard", i, "error", err)
+			}
+			continue
+		}
+		found = true
+
+		shard, err := decodeErasureShard(raw)
+		if err != nil || shard.index != i || shard.m != es.m {
+			logger.Warn("纠删码分片无效", "id", id, "shard", i, "error", err)
+			continue
+		}
+		shards[i] = shard
+	}
+	return shards, found
+}
+
+// decode 用最新一代的分片恢复数据，同时返回该代完整的分片
+func (es *ErasureStore) decode(id uint32, shards []*erasureShard) ([]byte, []*erasureShard, error) {
+	latest := latestErasureShard(shards)
+	if latest == nil {
+		return nil, nil, ErrErasureDataLost
+	}
+	codec, err := es.codec(latest.k)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	size := codec.shardSize(latest.size)
+	payloads := make([][]byte, latest.k+latest.m)
+	for i := range payloads {
+		if shard := shards[i]; shard != nil && shard.generation == latest.generation && shard.k == latest.k {
+			payloads[i] = shard.payload
+		}
+	}
+	if err := codec.reconstruct(payloads, size); err != nil {
+		if errors.Is(err, errTooFewShards) {
+			logger.Error("纠删码分片不足", "id", id)
+			return nil, nil, ErrErasureDataLost
+		}
+		return nil, nil, err
+	}
+
+	data := make([]byte, 0, size*latest.k)
+	for i := 0; i < latest.k; i++ {
+		data = append(data, payloads[i]...)
+	}
+	data = data[:latest.size]
+	if crc32.ChecksumIEEE(data) != latest.dataCRC {
+		logger.Error("纠删码恢复的数据校验失败", "id", id)
+		return nil, nil, &CorruptedError{Block: id, Err: fmt.Errorf("%w: 数据校验和不匹配", ErrErasureDataLost)}
+	}
+
+	rebuilt := make([]*erasureShard, len(payloads))
+	for i, payload := range payloads {
+		shard := *latest
+		shard.index = i
+		shard.payload = payload
+		rebuilt[i] = &shard
+	}
+	return data, rebuilt, nil
+}
+
+// latestErasureShard 返回写入代数最大的分片
+func latestErasureShard(shards []*erasureShard) *erasureShard {
+	var latest *erasureShard
+	for _, shard := range shards {
+		if shard != nil && (latest == nil || shard.generation > latest.generation) {
+			latest = shard
+		}
+	}
+	return latest
+}
+
+// encodeErasureShard 编码分片
+// 格式: 魔数 | 版本 | k | m | 序号 | 数据大小 | 数据CRC32 | 写入代数 | 分片CRC32 | 分片数据
+func encodeErasureShard(shard *erasureShard) []byte {
+	buf := make([]byte, erasureShardHeaderSize, erasureShardHeaderSize+len(shard.payload))
+	binary.BigEndian.PutUint32(buf, erasureShardMagic)
+	buf[4] = erasureShardVersion
+	buf[5] = byte(shard.k)
+	buf[6] = byte(shard.m)
+	buf[7] = byte(shard.index)
+	binary.BigEndian.PutUint32(buf[8:], uint32(shard.size))
+	binary.BigEndian.PutUint32(buf[12:], shard.dataCRC)
+	binary.BigEndian.PutUint64(buf[16:], uint64(shard.generation))
+	binary.BigEndian.PutUint32(buf[24:], crc32.ChecksumIEEE(shard.payload))
+	return append(buf, shard.payload...)
+}
+
+// decodeErasureShard 解码并校验分片
+func decodeErasureShard(raw []byte) (*erasureShard, error) {
+	if len(raw) < erasureShardHeaderSize || binary.BigEndian.Uint32(raw) != erasureShardMagic || raw[4] != erasureShardVersion {
+		return nil, fmt.Errorf("%w: 无效的分片头", ErrCorrupted)
+	}
+	shard := &erasureShard{
+		k:          int(raw[5]),
+		m:          int(raw[6]),
+		index:      int(raw[7]),
+		size:       int(binary.BigEndian.Uint32(raw[8:])),
+		dataCRC:    binary.BigEndian.Uint32(raw[12:]),
+		generation: int64(binary.BigEndian.Uint64(raw[16:])),
+		payload:    raw[erasureShardHeaderSize:],
+	}
+	if shard.k == 0 || shard.index >= shard.k+shard.m {
+		return nil, fmt.Errorf("%w: 无效的分片参数", ErrCorrupted)
+	}
+	if crc32.ChecksumIEEE(shard.payload) != binary.BigEndian.Uint32(raw[24:]) {
+		return nil, fmt.Errorf("%w: 分片校验和不匹配", ErrCorrupted)
+	}
+	if len(shard.payload) != (shard.size+shard.k-1)/shard.k {
+		return nil, fmt.Errorf("%w: 分片大小不符", ErrCorrupted)
+	}
+	return shard, nil
+}
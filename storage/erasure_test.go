@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestReedSolomonReconstruct 测试丢失任意m个分片后都能恢复数据
+func TestReedSolomonReconstruct(t *testing.T) {
+	rs, err := newReedSolomon(4, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := make([]byte, 1001)
+	rand.New(rand.NewSource(1)).Read(data)
+	shards := rs.encode(data)
+	size := rs.shardSize(len(data))
+
+	for a := 0; a < 7; a++ {
+		for b := a + 1; b < 7; b++ {
+			for c := b + 1; c < 7; c++ {
+				damaged := make([][]byte, len(shards))
+				copy(damaged, shards)
+				damaged[a], damaged[b], damaged[c] = nil, nil, nil
+				if err := rs.reconstruct(damaged, size); err != nil {
+					t.Fatalf("丢失分片%d,%d,%d后重建失败: %v", a, b, c, err)
+				}
+				for i := range shards {
+					if !bytes.Equal(damaged[i], shards[i]) {
+						t.Fatalf("丢失分片%d,%d,%d后分片%d重建错误", a, b, c, i)
+					}
+				}
+			}
+		}
+	}
+
+	damaged := make([][]byte, len(shards))
+	copy(damaged[:3], shards)
+	if err := rs.reconstruct(damaged, size); !errors.Is(err, errTooFewShards) {
+		t.Errorf("分片不足时应返回errTooFewShards: %v", err)
+	}
+}
+
+// TestErasureStore 测试纠删码存储的读写、分片丢失时的读取和修复
+func TestErasureStore(t *testing.T) {
+	root := t.TempDir()
+	targets := make([]BlockBackend, 6)
+	dirs := make([]*DirectoryStorage, 6)
+	for i := range targets {
+		ds, err := NewDirectoryStorage(&StorageConfig{Path: filepath.Join(root, fmt.Sprintf("disk%d", i))})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ds.Close()
+		targets[i], dirs[i] = ds, ds
+	}
+
+	if _, err := NewErasureStore(targets[:5], &ErasureOptions{DataShards: 4, ParityShards: 2}); err == nil {
+		t.Error("目标数少于分片总数时应失败")
+	}
+	es, err := NewErasureStore(targets, &ErasureOptions{DataShards: 4, ParityShards: 2, MinSize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer es.Close()
+
+	rng := rand.New(rand.NewSource(2))
+	blocks := make(map[uint32][]byte)
+	for id := uint32(1); id <= 8; id++ {
+		blocks[id] = make([]byte, 500*int(id)+3)
+		rng.Read(blocks[id])
+		if err := es.WriteBlock(id, blocks[id]); err != nil {
+			t.Fatalf("写入块%d失败: %v", id, err)
+		}
+	}
+	// 小块不切分
+	blocks[9] = []byte("small")
+	if err := es.WriteBlock(9, blocks[9]); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := es.GetBlockInfo(3)
+	if err != nil || info.Size != uint32(len(blocks[3])) || len(info.Shards) != 6 {
+		t.Fatalf("块信息不正确: %+v, %v", info, err)
+	}
+	for i, shard := range info.Shards {
+		if shard.Target != (3+i)%6 || shard.Parity != (i >= 4) || !shard.Available {
+			t.Errorf("分片%d的位置不正确: %+v", i, shard)
+		}
+	}
+	if info, err := es.GetBlockInfo(9); err != nil || len(info.Shards) != 3 {
+		t.Errorf("小块应有1个数据分片和2个校验分片: %+v, %v", info, err)
+	}
+
+	// 丢失一个目标并损坏另一个目标中的分片（块9的分片不在目标0上）
+	for _, id := range []uint32{1, 2, 3, 4, 5, 6, 7, 8, 9} {
+		dirs[0].DeleteBlock(id)
+	}
+	if err := os.WriteFile(dirs[1].BlockMap[5], []byte("garbage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for id, data := range blocks {
+		if got, err := es.ReadBlock(id); err != nil || !bytes.Equal(got, data) {
+			t.Fatalf("丢失两个分片后应能读取块%d: %v", id, err)
+		}
+	}
+	if info, err := es.GetBlockInfo(5); err != nil || info.Shards[(1+6-5)%6].Available {
+		t.Errorf("损坏的分片应标记为不可用: %+v, %v", info, err)
+	}
+
+	report, err := es.Repair()
+	if err != nil || report.Checked != 9 || report.Repaired != 9 || len(report.Lost) != 0 {
+		t.Fatalf("修复结果不正确: %+v, %v", report, err)
+	}
+	if es.GetLastRepairReport() != report {
+		t.Error("应记录最近一轮修复的结果")
+	}
+	for id := range blocks {
+		info, err := es.GetBlockInfo(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, shard := range info.Shards {
+			if !shard.Available {
+				t.Errorf("修复后块%d的分片%d应可用", id, shard.Index)
+			}
+		}
+	}
+
+	// 覆盖写入后只使用新一代的分片
+	if err := es.WriteBlock(4, []byte("short")); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := es.ReadBlock(4); err != nil || string(got) != "short" {
+		t.Errorf("覆盖写入后读取错误: %q, %v", got, err)
+	}
+
+	// 丢失超过m个分片时无法恢复
+	for i := 0; i < 3; i++ {
+		targets[es.target(2, i)].DeleteBlock(2)
+	}
+	if _, err := es.ReadBlock(2); !errors.Is(err, ErrErasureDataLost) {
+		t.Errorf("分片不足时应返回ErrErasureDataLost: %v", err)
+	}
+
+	if err := es.DeleteBlock(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := es.ReadBlock(1); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("删除后应返回ErrBlockNotFound: %v", err)
+	}
+}
@@ -0,0 +1,28 @@
+package storage
+
+import "github.com/bpfs/fragmenta/errcode"
+
+// init 登记存储层错误的错误码，ErrPermission和ErrKeyExpired由security包登记
+func init() {
+	errcode.Register(ErrInvalidMode, "storage.invalid_mode", "无效的存储模式", "invalid storage mode")
+	errcode.Register(ErrInvalidOperation, "storage.invalid_operation", "无效的操作", "invalid operation")
+	errcode.Register(ErrBlockNotFound, "storage.block_not_found", "块不存在", "block not found")
+	errcode.Register(ErrCorrupted, "storage.corrupted", "数据已损坏", "data is corrupted")
+	errcode.Register(ErrInvalidRange, "storage.invalid_range", "无效的读取范围", "requested range is not satisfiable")
+	errcode.Register(ErrQuota, "storage.quota", "存储空间不足", "out of disk space or quota exceeded")
+	errcode.Register(ErrDegradedReadOnly, "storage.degraded_read_only", "磁盘空间不足，存储处于只读降级模式", "disk is nearly full; storage is in read-only degraded mode")
+	errcode.Register(ErrInvalidContainer, "storage.invalid_container", "无效的容器文件", "invalid container file")
+	errcode.Register(ErrMetaIndexCorrupted, "storage.meta_index_corrupted", "块映射索引已损坏", "block map index is corrupted")
+	errcode.Register(ErrErasureDataLost, "storage.erasure_data_lost", "纠删码分片不足，无法恢复块", "not enough erasure shards to recover the block")
+	errcode.Register(ErrWorkerPoolClosed, "storage.worker_pool_closed", "工作池已关闭", "worker pool is closed")
+	errcode.Register(ErrWorkerQueueFull, "storage.worker_queue_full", "工作池等待队列已满", "worker pool queue is full")
+	errcode.Register(ErrKeyInUse, "storage.key_in_use", "密钥仍被数据块引用", "key is still referenced by blocks")
+	errcode.Register(ErrInvalidBlockKey, "storage.invalid_block_key", "无效的块键", "invalid block key")
+	errcode.Register(ErrBlockKeyConflict, "storage.block_key_conflict", "块ID已被字符串键占用", "block ID is owned by a string key")
+	errcode.Register(ErrBackupCorrupted, "storage.backup_corrupted", "备份流已损坏", "backup stream is corrupted")
+	errcode.Register(ErrUnknownTransform, "storage.unknown_transform", "块使用的变换未注册", "block uses a transform that is not registered")
+	errcode.Register(ErrSignatureInvalid, "storage.signature_invalid", "块签名校验失败", "block signature verification failed")
+	errcode.Register(ErrPolicyTableCorrupted, "storage.policy_table_corrupted", "块策略表已损坏", "block policy table is corrupted")
+	errcode.Register(ErrRetained, "storage.retained", "块处于保留期或法律保留中", "block is under retention or legal hold")
+	errcode.Register(ErrKeyTableCorrupted, "storage.key_table_corrupted", "块键表已损坏", "block key table is corrupted")
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"github.com/bpfs/fragmenta/security"
+)
+
+// 错误定义，容器、纠删码、工作池等专用错误见各自的文件
+var (
+	// ErrInvalidMode 表示存储模式无效
+	ErrInvalidMode = errors.New("无效的存储模式")
+
+	// ErrInvalidOperation 表示操作无效
+	ErrInvalidOperation = errors.New("无效的操作")
+
+	// ErrBlockNotFound 表示请求的块不存在
+	ErrBlockNotFound = errors.New("块不存在")
+
+	// ErrCorrupted 表示存储的数据校验失败或结构不一致，见 CorruptedError
+	ErrCorrupted = errors.New("数据已损坏")
+
+	// ErrInvalidRange 表示读取范围超出块的大小，见 StorageManagerImpl.ReadBlockRange
+	ErrInvalidRange = errors.New("无效的读取范围")
+
+	// ErrQuota 表示磁盘空间不足或超出磁盘配额
+	ErrQuota = errors.New("存储空间不足")
+
+	// ErrDegradedReadOnly 表示磁盘空间不足，存储处于只读降级模式，空间恢复后自动恢复写入
+	ErrDegradedReadOnly = errors.New("磁盘空间不足，存储处于只读降级模式")
+
+	// ErrPermission 表示主体对数据块的操作被拒绝，与 security.ErrPermissionDenied 相同
+	ErrPermission = security.ErrPermissionDenied
+
+	// ErrKeyExpired 表示加密块使用的密钥已过期，与 security.ErrKeyExpired 相同
+	ErrKeyExpired = security.ErrKeyExpired
+)
+
+// CorruptedError 块的数据已损坏。errors.Is可以匹配 ErrCorrupted 和Err包装的错误
+type CorruptedError struct {
+	Block uint32
+	Err   error
+}
+
+// Error 实现error接口
+func (e *CorruptedError) Error() string {
+	return fmt.Sprintf("块%d%v: %v", e.Block, ErrCorrupted, e.Err)
+}
+
+// Unwrap 返回 ErrCorrupted 和底层错误
+func (e *CorruptedError) Unwrap() []error {
+	return []error{ErrCorrupted, e.Err}
+}
+
+// wrapNoSpace 把磁盘空间不足和超出磁盘配额的错误包装为 ErrQuota，其他错误原样返回
+func wrapNoSpace(err error) error {
+	if errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT) {
+		return fmt.Errorf("%w: %w", ErrQuota, err)
+	}
+	return err
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// TestCorruptedError 测试容器记录与分配表不一致时返回带块ID的CorruptedError
+func TestCorruptedError(t *testing.T) {
+	cs, err := NewContainerStorage(&StorageConfig{Path: filepath.Join(t.TempDir(), "test.container")})
+	if err != nil {
+		t.Fatalf("创建容器存储失败: %v", err)
+	}
+	defer cs.Close()
+
+	for id := uint32(1); id <= 2; id++ {
+		if err := cs.WriteBlock(id, []byte("data")); err != nil {
+			t.Fatalf("写入块%d失败: %v", id, err)
+		}
+	}
+	cs.BlockMap[1], cs.BlockMap[2] = cs.BlockMap[2], cs.BlockMap[1]
+
+	_, err = cs.ReadBlock(1)
+	var corrupted *CorruptedError
+	if !errors.Is(err, ErrCorrupted) || !errors.Is(err, ErrInvalidContainer) || !errors.As(err, &corrupted) || corrupted.Block != 1 {
+		t.Errorf("记录不一致时应返回块1的CorruptedError: %v", err)
+	}
+	if !errors.Is(ErrMetaIndexCorrupted, ErrCorrupted) {
+		t.Error("ErrMetaIndexCorrupted应匹配ErrCorrupted")
+	}
+}
+
+// TestWrapNoSpace 测试磁盘空间不足和超出配额包装为ErrQuota，并保留原始错误
+func TestWrapNoSpace(t *testing.T) {
+	for _, errno := range []syscall.Errno{syscall.ENOSPC, syscall.EDQUOT} {
+		err := wrapNoSpace(&os.PathError{Op: "write", Path: "block", Err: errno})
+		if !errors.Is(err, ErrQuota) || !errors.Is(err, errno) {
+			t.Errorf("%v应包装为ErrQuota: %v", errno, err)
+		}
+	}
+	if err := wrapNoSpace(os.ErrClosed); errors.Is(err, ErrQuota) || err != os.ErrClosed {
+		t.Errorf("其他错误应原样返回: %v", err)
+	}
+	if err := wrapNoSpace(nil); err != nil {
+		t.Errorf("nil应原样返回: %v", err)
+	}
+}
@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"container/list"
+	"io"
+	"sync"
+
+	"github.com/bpfs/fragmenta/vfs"
+)
+
+// FDCache 只读文件描述符缓存，按路径缓存打开的块文件，按最近最少使用淘汰
+// 被淘汰或失效的文件在最后一个读取者释放后才关闭。
+// 写入、删除或移动块文件前必须调用Invalidate，否则读取者可能继续读到旧文件。
+// nil FDCache或容量为0时每次读取都重新打开文件。
+type FDCache struct {
+	mu      sync.Mutex
+	size    int
+	entries map[string]*fdEntry
+	lru     *list.List // 前端为最近使用
+	closed  bool
+}
+
+// fdEntry 缓存的文件
+type fdEntry struct {
+	path    string
+	file    vfs.File
+	refs    int
+	removed bool // 已从缓存移除，最后一个读取者释放后关闭
+	elem    *list.Element
+}
+
+// NewFDCache 创建容量为size的文件描述符缓存
+func NewFDCache(size int) *FDCache {
+	if size < 0 {
+		size = 0
+	}
+	return &FDCache{
+		size:    size,
+		entries: make(map[string]*fdEntry),
+		lru:     list.New(),
+	}
+}
+
+// ReadFile 读取整个文件，优先使用缓存的文件描述符
+func (c *FDCache) ReadFile(path string) ([]byte, error) {
+	return c.readFile(vfs.OS, path)
+}
+
+// readFile 从fsys读取整个文件
+func (c *FDCache) readFile(fsys vfs.FS, path string) ([]byte, error) {
+	entry, err := c.acquire(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return fsys.ReadFile(path)
+	}
+	defer c.release(entry)
+
+	info, err := entry.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, info.Size())
+	n, err := entry.file.ReadAt(data, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+// readRange 从fsys读取文件的[offset, offset+length)部分，length小于0表示读到文件末尾，
+// 超出文件末尾的部分被截断；offset超过文件大小时返回 ErrInvalidRange
+func (c *FDCache) readRange(fsys vfs.FS, path string, offset, length int64) ([]byte, error) {
+	entry, err := c.acquire(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	var file vfs.File
+	if entry != nil {
+		defer c.release(entry)
+		file = entry.file
+	} else {
+		if file, err = fsys.Open(path); err != nil {
+			return nil, err
+		}
+		defer file.Close()
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset, length, err = clampRange(info.Size(), offset, length)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, length)
+	n, err := file.ReadAt(data, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return data[:n], nil
+}
+
+// acquire 获取路径对应的缓存文件并增加引用，缓存不可用时返回nil
+func (c *FDCache) acquire(fsys vfs.FS, path string) (*fdEntry, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed || c.size == 0 {
+		return nil, nil
+	}
+
+	if entry, ok := c.entries[path]; ok {
+		entry.refs++
+		c.lru.MoveToFront(entry.elem)
+		return entry, nil
+	}
+
+	// 打开文件期间持有锁，保证与Invalidate互斥，不会缓存已被替换的文件
+	file, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	entry := &fdEntry{path: path, file: file, refs: 1}
+	entry.elem = c.lru.PushFront(entry)
+	c.entries[path] = entry
+	c.evictLocked()
+	return entry, nil
+}
+
+// release 释放引用，已移除的文件在引用归零时关闭
+func (c *FDCache) release(entry *fdEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry.refs--
+	if entry.removed && entry.refs == 0 {
+		entry.file.Close()
+	}
+}
+
+// removeLocked 从缓存移除条目，没有读取者时立即关闭（调用方需持有锁）
+func (c *FDCache) removeLocked(entry *fdEntry) {
+	delete(c.entries, entry.path)
+	c.lru.Remove(entry.elem)
+	entry.removed = true
+	if entry.refs == 0 {
+		entry.file.Close()
+	}
+}
+
+// evictLocked 淘汰超出容量的最久未使用条目（调用方需持有锁）
+func (c *FDCache) evictLocked() {
+	for c.lru.Len() > c.size {
+		c.removeLocked(c.lru.Back().Value.(*fdEntry))
+	}
+}
+
+// Invalidate 使路径对应的缓存失效
+func (c *FDCache) Invalidate(path string) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[path]; ok {
+		c.removeLocked(entry)
+	}
+}
+
+// Resize 调整缓存容量，超出部分立即淘汰
+func (c *FDCache) Resize(size int) {
+	if size < 0 {
+		size = 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.size = size
+	c.evictLocked()
+}
+
+// Len 返回缓存的文件数
+func (c *FDCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.lru.Len()
+}
+
+// Close 关闭所有缓存的文件，之后的读取不再使用缓存
+func (c *FDCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.closed = true
+	for c.lru.Len() > 0 {
+		c.removeLocked(c.lru.Back().Value.(*fdEntry))
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bpfs/fragmenta/config"
+)
+
+// TestFDCache 测试缓存淘汰和失效
+func TestFDCache(t *testing.T) {
+	dir := t.TempDir()
+	paths := make([]string, 3)
+	for i := range paths {
+		paths[i] = filepath.Join(dir, string(rune('a'+i)))
+		os.WriteFile(paths[i], []byte(paths[i]), 0644)
+	}
+
+	cache := NewFDCache(2)
+	for _, path := range paths {
+		data, err := cache.ReadFile(path)
+		if err != nil || string(data) != path {
+			t.Fatalf("读取文件失败: %q, %v", data, err)
+		}
+	}
+	if cache.Len() != 2 {
+		t.Errorf("缓存应淘汰到容量2: %d", cache.Len())
+	}
+
+	// 失效后读到新内容
+	cache.Invalidate(paths[2])
+	os.WriteFile(paths[2], []byte("updated"), 0644)
+	if data, _ := cache.ReadFile(paths[2]); string(data) != "updated" {
+		t.Errorf("失效后应读到新内容: %q", data)
+	}
+
+	if _, err := cache.ReadFile(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("不存在的文件应返回IsNotExist: %v", err)
+	}
+
+	cache.Resize(0)
+	if cache.Len() != 0 {
+		t.Errorf("容量为0时不应缓存: %d", cache.Len())
+	}
+	if data, err := cache.ReadFile(paths[0]); err != nil || string(data) != paths[0] {
+		t.Errorf("不缓存时也应能读取: %q, %v", data, err)
+	}
+	cache.Close()
+}
+
+// TestDirectoryStorageSharedResources 测试目录存储使用共享资源，并随配置变更调整
+func TestDirectoryStorageSharedResources(t *testing.T) {
+	cfg := config.NewDefaultConfigManager().GetDefaultConfig()
+	cfg.Performance.Parallelism.MaxWorkers = 2
+	cfg.Performance.IO.FDCacheSize = 4
+	resources := NewPerformanceResources(cfg.Performance)
+
+	storageConfig := &StorageConfig{Path: t.TempDir()}
+	resources.Configure(storageConfig)
+	ds, err := NewDirectoryStorage(storageConfig)
+	if err != nil {
+		t.Fatalf("创建目录存储失败: %v", err)
+	}
+
+	for id := uint32(1); id <= 8; id++ {
+		if err := ds.WriteBlock(id, bytes.Repeat([]byte{byte(id)}, 100)); err != nil {
+			t.Fatalf("写入块失败: %v", err)
+		}
+	}
+	for id := uint32(1); id <= 8; id++ {
+		if data, err := ds.ReadBlock(id); err != nil || data[0] != byte(id) {
+			t.Fatalf("读取块失败: %v", err)
+		}
+	}
+	if resources.FDCache.Len() != 4 {
+		t.Errorf("缓存文件数应为4: %d", resources.FDCache.Len())
+	}
+
+	// 覆盖写入后读到新内容
+	ds.WriteBlock(8, []byte("new"))
+	if data, _ := ds.ReadBlock(8); string(data) != "new" {
+		t.Errorf("覆盖后应读到新内容: %q", data)
+	}
+	if err := ds.DeleteBlock(7); err != nil {
+		t.Fatalf("删除块失败: %v", err)
+	}
+	if _, err := ds.ReadBlock(7); err != ErrBlockNotFound {
+		t.Errorf("删除后应找不到块: %v", err)
+	}
+
+	// 并行扫描重建
+	if err := ds.RebuildBlockMap(); err != nil {
+		t.Fatalf("重建块映射失败: %v", err)
+	}
+	if ds.Stats.TotalBlocks != 7 || ds.Stats.UsedSpace != 6*100+3 {
+		t.Errorf("重建后统计不正确: %+v", ds.Stats)
+	}
+
+	// 热更新
+	newCfg := *cfg
+	newCfg.Performance.Parallelism.MaxWorkers = 8
+	newCfg.Performance.Parallelism.WorkQueueLength = 16
+	newCfg.Performance.IO.FDCacheSize = 1
+	newCfg.Performance.Throttle.BackgroundBytesPerSecond = 1 << 20
+	resources.OnConfigChange(cfg, &newCfg)
+	if workers, queue := resources.Workers.Size(); workers != 8 || queue != 16 {
+		t.Errorf("工作池未调整: %d, %d", workers, queue)
+	}
+	if resources.FDCache.Len() > 1 {
+		t.Errorf("缓存未缩容: %d", resources.FDCache.Len())
+	}
+	if bps, _ := resources.Throttle.Limits(); bps != 1<<20 {
+		t.Errorf("限速未调整: %d", bps)
+	}
+
+	if err := ds.Close(); err != nil {
+		t.Fatalf("关闭目录存储失败: %v", err)
+	}
+	if resources.FDCache.Len() != 0 {
+		t.Errorf("关闭后应释放本存储的缓存文件: %d", resources.FDCache.Len())
+	}
+	resources.Close()
+}
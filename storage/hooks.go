@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"slices"
+	"sync"
+)
+
+// BlockHook 块写入和删除回调，用于在存储之外维护派生数据（如 index.AutoIndexer 自动维护索引）。
+// 回调在写入或删除成功、存储管理器释放锁之后同步调用，可以读取存储；应尽快返回，
+// 耗时的处理需要自行异步进行
+type BlockHook interface {
+	// BlockWritten 块已写入，data为加密前的数据，回调不能修改
+	BlockWritten(id uint32, data []byte)
+
+	// BlockDeleted 块已删除
+	BlockDeleted(id uint32)
+}
+
+// blockHooks 已注册的块回调，注册时返回注销函数
+type blockHooks struct {
+	mu    sync.RWMutex
+	hooks map[uint64]BlockHook
+	next  uint64
+}
+
+// add 注册回调，返回注销函数
+func (h *blockHooks) add(hook BlockHook) func() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.hooks == nil {
+		h.hooks = make(map[uint64]BlockHook)
+	}
+	id := h.next
+	h.next++
+	h.hooks[id] = hook
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.hooks, id)
+	}
+}
+
+// snapshot 按注册顺序返回当前的回调
+func (h *blockHooks) snapshot() []BlockHook {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if len(h.hooks) == 0 {
+		return nil
+	}
+	ids := make([]uint64, 0, len(h.hooks))
+	for id := range h.hooks {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	hooks := make([]BlockHook, len(ids))
+	for i, id := range ids {
+		hooks[i] = h.hooks[id]
+	}
+	return hooks
+}
+
+// AddBlockHook 注册块写入和删除回调，返回注销函数。回调按注册顺序调用
+func (sm *StorageManagerImpl) AddBlockHook(hook BlockHook) (remove func()) {
+	return sm.blockHooks.add(hook)
+}
+
+// emitWritten 通知回调块已写入，调用时不能持有 sm.mutex
+func (sm *StorageManagerImpl) emitWritten(id uint32, data []byte) {
+	for _, hook := range sm.blockHooks.snapshot() {
+		hook.BlockWritten(id, data)
+	}
+}
+
+// emitDeleted 通知回调块已删除，调用时不能持有 sm.mutex
+func (sm *StorageManagerImpl) emitDeleted(id uint32) {
+	for _, hook := range sm.blockHooks.snapshot() {
+		hook.BlockDeleted(id)
+	}
+}
@@ -4,6 +4,7 @@ package storage
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 )
@@ -164,14 +165,29 @@ type HybridStorageExtendedStats struct {
 
 // NewHybridStorage 创建一个新的混合存储
 func NewHybridStorage(config *StorageConfig) (*HybridStorage, error) {
+	// 创建访问跟踪器和存储策略
+	strategyConfig := newHybridStrategyConfig(config)
+	factory := &StorageStrategyFactory{}
+	strategy, err := factory.CreateStrategy(strategyConfig)
+	if err != nil {
+		return nil, fmt.Errorf("创建存储策略失败: %w", err)
+	}
+
 	// 创建目录存储
 	dirStorage, err := NewDirectoryStorage(&StorageConfig{
-		Type:         StorageTypeDirectory,
-		Path:         config.Path + "/directory",
-		BlockSize:    config.BlockSize,
-		CacheSize:    config.CacheSize / 2, // 均分缓存
-		CachePolicy:  config.CachePolicy,
-		DedupEnabled: config.DedupEnabled,
+		Type:            StorageTypeDirectory,
+		Path:            config.Path + "/directory",
+		BlockSize:       config.BlockSize,
+		CacheSize:       config.CacheSize / 2, // 均分缓存
+		CachePolicy:     config.CachePolicy,
+		DedupEnabled:    config.DedupEnabled,
+		DirectoryLayout: config.DirectoryLayout,
+		Durability:      config.Durability,
+		SyncInterval:    config.SyncInterval,
+		Workers:         config.Workers,
+		FDCache:         config.FDCache,
+		Clock:           config.Clock,
+		FS:              config.FS,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("创建目录存储失败: %w", err)
@@ -185,16 +201,20 @@ func NewHybridStorage(config *StorageConfig) (*HybridStorage, error) {
 		CacheSize:    config.CacheSize / 2, // 均分缓存
 		CachePolicy:  config.CachePolicy,
 		DedupEnabled: config.DedupEnabled,
+		Durability:   config.Durability,
+		SyncInterval: config.SyncInterval,
+		Clock:        config.Clock,
+		FS:           config.FS,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("创建容器存储失败: %w", err)
 	}
 
-	// 初始化统计信息
+	// 初始化统计信息，重新打开时计入容器和目录存储中已有的块（内联块只保存在内存中）
 	stats := &StorageStats{
-		TotalBlocks: 0,
-		TotalSize:   0,
-		UsedSpace:   0,
+		TotalBlocks: containerStorage.Stats.TotalBlocks + dirStorage.Stats.TotalBlocks,
+		TotalSize:   containerStorage.Stats.UsedSpace + dirStorage.Stats.UsedSpace,
+		UsedSpace:   containerStorage.Stats.UsedSpace + dirStorage.Stats.UsedSpace,
 		FreeSpace:   0,
 	}
 
@@ -204,14 +224,99 @@ func NewHybridStorage(config *StorageConfig) (*HybridStorage, error) {
 		Container:         containerStorage,
 		Directory:         dirStorage,
 		InlineBlocks:      make(map[string][]byte),
+		blockKeys:         make(map[string]struct{}),
 		Stats:             stats,
 		mutex:             sync.RWMutex{},
 		securityManager:   nil,
 		encryptionEnabled: false,
+		tracker:           NewAccessTracker(strategyConfig),
+		strategy:          strategy,
+	}
+
+	// 启用自动平衡时启动后台重平衡
+	if config.AutoBalanceEnabled {
+		hs.StartAutoRebalance(config.RebalanceInterval)
 	}
+
 	return hs, nil
 }
 
+// newHybridStrategyConfig 根据存储配置生成策略配置，未设置的字段使用默认值
+func newHybridStrategyConfig(config *StorageConfig) *StrategyConfig {
+	strategyConfig := NewDefaultStrategyConfig()
+
+	if config.StrategyName != "" {
+		strategyConfig.StrategyName = config.StrategyName
+	}
+	if config.InlineThreshold > 0 {
+		strategyConfig.InlineThreshold = int64(config.InlineThreshold)
+	}
+	if config.HotBlockThreshold > 0 {
+		strategyConfig.HotBlockThreshold = int(config.HotBlockThreshold)
+	}
+	if config.ColdBlockTimeMinutes > 0 {
+		strategyConfig.ColdBlockTimeMinutes = int(config.ColdBlockTimeMinutes)
+	}
+	if config.PerformanceTarget != "" {
+		strategyConfig.PerformanceTarget = PerformanceTarget(config.PerformanceTarget)
+	}
+	strategyConfig.AutoBalanceEnabled = config.AutoBalanceEnabled
+	strategyConfig.Clock = config.Clock
+	if scorer, ok := config.StrategyParams["scorer"].(PlacementScorer); ok {
+		strategyConfig.Scorer = scorer
+	}
+
+	return strategyConfig
+}
+
+// storageTypeToLocation 将存储类型转换为策略使用的存储位置
+func storageTypeToLocation(storageType StorageType) StorageLocation {
+	switch storageType {
+	case StorageTypeInline:
+		return LocationInline
+	case StorageTypeContainer:
+		return LocationContainer
+	default:
+		return LocationDirectory
+	}
+}
+
+// locationToStorageType 将策略使用的存储位置转换为存储类型
+func locationToStorageType(location StorageLocation) StorageType {
+	switch location {
+	case LocationInline:
+		return StorageTypeInline
+	case LocationContainer:
+		return StorageTypeContainer
+	default:
+		return StorageTypeDirectory
+	}
+}
+
+// setPin 固定或取消固定块的存储位置，之后的写入使用该位置，重平衡跳过该块。
+// 只影响之后的写入，不移动已写入的数据
+func (hs *HybridStorage) setPin(blockKey string, location StorageLocation, pinned bool) {
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+
+	if !pinned {
+		delete(hs.pins, blockKey)
+		return
+	}
+	if hs.pins == nil {
+		hs.pins = make(map[string]StorageLocation)
+	}
+	hs.pins[blockKey] = location
+}
+
+// isPinned 返回块的存储位置是否已固定
+func (hs *HybridStorage) isPinned(blockKey string) bool {
+	hs.mutex.RLock()
+	defer hs.mutex.RUnlock()
+	_, ok := hs.pins[blockKey]
+	return ok
+}
+
 // WriteBlock 写入数据块
 func (hs *HybridStorage) WriteBlock(blockKey string, data []byte) error {
 	hs.mutex.Lock()
@@ -227,9 +332,11 @@ func (hs *HybridStorage) WriteBlock(blockKey string, data []byte) error {
 		}
 	}
 
-	// 确定存储位置
+	// 确定存储位置，固定了位置的块直接写入该位置
 	var location StorageType
-	if len(writeData) <= int(hs.Config.InlineThreshold) {
+	if pinned, ok := hs.pins[blockKey]; ok {
+		location = locationToStorageType(pinned)
+	} else if len(writeData) <= int(hs.Config.InlineThreshold) {
 		location = StorageTypeInline
 	} else if len(writeData) >= 1024*1024 { // 大于1MB的数据
 		location = StorageTypeDirectory
@@ -238,7 +345,9 @@ func (hs *HybridStorage) WriteBlock(blockKey string, data []byte) error {
 	}
 
 	// 删除可能存在的旧数据
-	hs.deleteBlockInternal(blockKey)
+	if oldSize, ok := hs.deleteBlockInternal(blockKey); ok {
+		hs.removeStats(blockKey, oldSize)
+	}
 
 	// 根据位置执行实际存储
 	switch location {
@@ -262,28 +371,69 @@ func (hs *HybridStorage) WriteBlock(blockKey string, data []byte) error {
 	}
 
 	// 更新统计信息
+	hs.blockKeys[blockKey] = struct{}{}
 	hs.Stats.TotalBlocks++
 	hs.Stats.TotalSize += uint64(len(writeData))
+	hs.Stats.UsedSpace = hs.Stats.TotalSize
+
+	// 记录访问情况
+	hs.tracker.RecordAccess(blockKey, int64(len(writeData)), storageTypeToLocation(location))
 
 	return nil
 }
 
-// deleteBlockInternal 内部删除方法，不加锁
-func (hs *HybridStorage) deleteBlockInternal(blockKey string) {
+// deleteBlockInternal 内部删除方法，不加锁，返回被删除块的大小以及块是否存在
+func (hs *HybridStorage) deleteBlockInternal(blockKey string) (uint64, bool) {
 	// 检查并删除内联块
-	if _, ok := hs.InlineBlocks[blockKey]; ok {
+	if data, ok := hs.InlineBlocks[blockKey]; ok {
 		delete(hs.InlineBlocks, blockKey)
-		return
+		return uint64(len(data)), true
 	}
 
 	// 转换ID
 	id := stringToID(blockKey)
 
 	// 尝试从容器存储删除
-	_ = hs.Container.DeleteBlock(id)
+	var size uint64
+	existed := false
+	if info, err := hs.Container.GetBlockInfo(id); err == nil && hs.Container.DeleteBlock(id) == nil {
+		size, existed = uint64(info.Size), true
+	}
 
 	// 尝试从目录存储删除
-	_ = hs.Directory.DeleteBlock(id)
+	if info, err := hs.Directory.GetBlockInfo(id); err == nil && hs.Directory.DeleteBlock(id) == nil {
+		size, existed = size+uint64(info.Size), true
+	}
+	return size, existed
+}
+
+// removeStats 从统计信息中移除一个块，不加锁
+func (hs *HybridStorage) removeStats(blockKey string, size uint64) {
+	delete(hs.blockKeys, blockKey)
+	hs.Stats.TotalBlocks--
+	if size > hs.Stats.TotalSize {
+		size = hs.Stats.TotalSize
+	}
+	hs.Stats.TotalSize -= size
+	hs.Stats.UsedSpace = hs.Stats.TotalSize
+}
+
+// ListBlockKeys 列出所有块键。块键经哈希后存入容器和目录存储，无法从中还原，
+// 因此重新打开后已有的块不在列表中，此时返回错误而不是不完整的列表
+func (hs *HybridStorage) ListBlockKeys() ([]string, error) {
+	hs.mutex.RLock()
+	defer hs.mutex.RUnlock()
+
+	if uint32(len(hs.blockKeys)) != hs.Stats.TotalBlocks {
+		return nil, fmt.Errorf("混合存储中有%d个块的键未知，无法列出", hs.Stats.TotalBlocks-uint32(len(hs.blockKeys)))
+	}
+
+	keys := make([]string, 0, len(hs.blockKeys))
+	for key := range hs.blockKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
 }
 
 // ReadBlock 读取数据块
@@ -293,6 +443,7 @@ func (hs *HybridStorage) ReadBlock(blockKey string) ([]byte, error) {
 
 	var data []byte
 	var err error
+	location := LocationInline
 
 	// 首先检查内联块
 	if encryptedData, ok := hs.InlineBlocks[blockKey]; ok {
@@ -305,6 +456,7 @@ func (hs *HybridStorage) ReadBlock(blockKey string) ([]byte, error) {
 		data, err = hs.Container.ReadBlock(id)
 		if err == nil {
 			// 成功从容器存储读取
+			location = LocationContainer
 		} else if err != ErrBlockNotFound {
 			return nil, fmt.Errorf("从容器存储读取失败: %w", err)
 		} else {
@@ -312,6 +464,7 @@ func (hs *HybridStorage) ReadBlock(blockKey string) ([]byte, error) {
 			data, err = hs.Directory.ReadBlock(id)
 			if err == nil {
 				// 成功从目录存储读取
+				location = LocationDirectory
 			} else if err != ErrBlockNotFound {
 				return nil, fmt.Errorf("从目录存储读取失败: %w", err)
 			} else {
@@ -321,6 +474,9 @@ func (hs *HybridStorage) ReadBlock(blockKey string) ([]byte, error) {
 		}
 	}
 
+	// 记录访问情况
+	hs.tracker.RecordAccess(blockKey, int64(len(data)), location)
+
 	// 解密数据（如果启用）
 	if hs.encryptionEnabled && hs.securityManager != nil {
 		decryptedData, err := hs.DecryptBlock(blockKey, data)
@@ -339,9 +495,10 @@ func (hs *HybridStorage) DeleteBlock(blockKey string) error {
 	defer hs.mutex.Unlock()
 
 	// 检查并删除内联块
-	if _, ok := hs.InlineBlocks[blockKey]; ok {
+	if data, ok := hs.InlineBlocks[blockKey]; ok {
 		delete(hs.InlineBlocks, blockKey)
-		hs.Stats.TotalBlocks--
+		hs.removeStats(blockKey, uint64(len(data)))
+		hs.tracker.RemoveRecord(blockKey)
 		return nil
 	}
 
@@ -349,18 +506,22 @@ func (hs *HybridStorage) DeleteBlock(blockKey string) error {
 	id := stringToID(blockKey)
 
 	// 尝试从容器存储删除
+	size := hs.tierBlockSize(hs.Container.GetBlockInfo(id))
 	err := hs.Container.DeleteBlock(id)
 	if err == nil {
-		hs.Stats.TotalBlocks--
+		hs.removeStats(blockKey, size)
+		hs.tracker.RemoveRecord(blockKey)
 		return nil
 	} else if err != ErrBlockNotFound {
 		return fmt.Errorf("从容器存储删除失败: %w", err)
 	}
 
 	// 尝试从目录存储删除
+	size = hs.tierBlockSize(hs.Directory.GetBlockInfo(id))
 	err = hs.Directory.DeleteBlock(id)
 	if err == nil {
-		hs.Stats.TotalBlocks--
+		hs.removeStats(blockKey, size)
+		hs.tracker.RemoveRecord(blockKey)
 		return nil
 	} else if err != ErrBlockNotFound {
 		return fmt.Errorf("从目录存储删除失败: %w", err)
@@ -369,6 +530,14 @@ func (hs *HybridStorage) DeleteBlock(blockKey string) error {
 	return ErrBlockNotFound
 }
 
+// tierBlockSize 返回容器或目录存储中块的大小，块不存在时为0
+func (hs *HybridStorage) tierBlockSize(info *BlockInfo, err error) uint64 {
+	if err != nil {
+		return 0
+	}
+	return uint64(info.Size)
+}
+
 // GetBlockInfo 获取块信息
 func (hs *HybridStorage) GetBlockInfo(blockKey string) (*BlockInfo, StorageType, error) {
 	hs.mutex.RLock()
@@ -423,6 +592,20 @@ func (hs *HybridStorage) Optimize() error {
 	return nil
 }
 
+// Close 停止后台重平衡并关闭子存储
+func (hs *HybridStorage) Close() error {
+	hs.StopAutoRebalance()
+
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+
+	err := hs.Container.Close()
+	if closeErr := hs.Directory.Close(); closeErr != nil && err == nil {
+		err = closeErr
+	}
+	return err
+}
+
 // GetHybridStats 获取混合存储统计信息
 func (hs *HybridStorage) GetHybridStats() *HybridStorageExtendedStats {
 	hs.mutex.RLock()
@@ -453,6 +636,38 @@ func (hs *HybridStorage) GetHybridStats() *HybridStorageExtendedStats {
 	return stats
 }
 
+// GetStorageDistributionAnalysis 获取存储分布分析
+// 根据访问跟踪器记录的块位置和当前存储策略，计算各存储位置的占比、效率评分和优化建议
+func (hs *HybridStorage) GetStorageDistributionAnalysis() *DistributionAnalysis {
+	return hs.currentStrategy().AnalyzeDistribution(hs.tracker)
+}
+
+// ExportAccessHistory 导出访问历史数据集，可用于离线训练放置模型
+func (hs *HybridStorage) ExportAccessHistory() []AccessHistoryEntry {
+	return hs.tracker.ExportHistory()
+}
+
+// SetStorageStrategy 替换当前的存储策略，例如使用外部评分的ScoredStrategy
+func (hs *HybridStorage) SetStorageStrategy(strategy StorageStrategy) error {
+	if strategy == nil {
+		return fmt.Errorf("存储策略不能为空")
+	}
+
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+
+	hs.strategy = strategy
+	return nil
+}
+
+// currentStrategy 返回当前的存储策略
+func (hs *HybridStorage) currentStrategy() StorageStrategy {
+	hs.mutex.RLock()
+	defer hs.mutex.RUnlock()
+
+	return hs.strategy
+}
+
 // GetPerformanceMetrics 获取性能指标
 func (hs *HybridStorage) GetPerformanceMetrics() *HybridStoragePerformanceMetrics {
 	// 简化实现，返回一个带有基本数据的指标对象
@@ -505,10 +720,9 @@ func (hs *HybridStorage) SetEncryptionEnabled(enabled bool) error {
 	oldState := hs.encryptionEnabled
 	hs.encryptionEnabled = enabled
 
-	// 如果需要，这里可以触发加密状态变更事件通知
+	// 记录加密状态变更
 	if oldState != enabled {
-		// 实际项目中可能需要实现事件通知机制
-		// notifyEncryptionStateChanged(oldState, enabled)
+		recordEncryptionChange(hs.securityManager, hs.Config.Path, enabled)
 	}
 
 	return nil
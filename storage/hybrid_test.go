@@ -132,3 +132,70 @@ func TestHybridStorage(t *testing.T) {
 		t.Errorf("写入计数不正确: 期望 >= 2, 实际 %d", metrics.WriteCount)
 	}
 }
+
+// TestHybridStorageDistributionAnalysis 测试混合存储的存储分布分析
+func TestHybridStorageDistributionAnalysis(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "hybrid_distribution_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	hs, err := NewHybridStorage(&StorageConfig{
+		Type:            StorageTypeHybrid,
+		Path:            tempDir,
+		InlineThreshold: 1024,
+		StrategyName:    "simple",
+	})
+	if err != nil {
+		t.Fatalf("初始化混合存储失败: %v", err)
+	}
+
+	// 空存储的分析结果
+	analysis := hs.GetStorageDistributionAnalysis()
+	if analysis.TotalBlocks != 0 {
+		t.Errorf("空存储总块数应为0, 实际%d", analysis.TotalBlocks)
+	}
+
+	// 2个内联块、1个容器块、1个目录块
+	blocks := map[string]int{
+		"inline1":   100,
+		"inline2":   512,
+		"container": 64 * 1024,
+		"directory": 2 * 1024 * 1024,
+	}
+	for key, size := range blocks {
+		if err := hs.WriteBlock(key, make([]byte, size)); err != nil {
+			t.Fatalf("写入块%s失败: %v", key, err)
+		}
+	}
+
+	analysis = hs.GetStorageDistributionAnalysis()
+	if analysis.TotalBlocks != 4 {
+		t.Fatalf("总块数不正确: 期望4, 实际%d", analysis.TotalBlocks)
+	}
+	if analysis.InlineBlocks != 2 || analysis.ContainerBlocks != 1 || analysis.DirectoryBlocks != 1 {
+		t.Errorf("各位置块数不正确: 内联%d, 容器%d, 目录%d",
+			analysis.InlineBlocks, analysis.ContainerBlocks, analysis.DirectoryBlocks)
+	}
+	if analysis.PercentageInline != 0.5 {
+		t.Errorf("内联块比例不正确: 期望0.5, 实际%f", analysis.PercentageInline)
+	}
+
+	// 删除块后分析结果应同步更新
+	if err := hs.DeleteBlock("inline1"); err != nil {
+		t.Fatalf("删除块失败: %v", err)
+	}
+	analysis = hs.GetStorageDistributionAnalysis()
+	if analysis.TotalBlocks != 3 || analysis.InlineBlocks != 1 {
+		t.Errorf("删除后分析结果不正确: 总块数%d, 内联%d", analysis.TotalBlocks, analysis.InlineBlocks)
+	}
+
+	// 不支持的策略名称应返回错误
+	if _, err := NewHybridStorage(&StorageConfig{
+		Path:         tempDir + "/invalid",
+		StrategyName: "unknown",
+	}); err == nil {
+		t.Errorf("不支持的策略名称应返回错误")
+	}
+}
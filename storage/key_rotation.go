@@ -0,0 +1,598 @@
+// key_rotation.go 密钥轮换：记录每个块使用的密钥，把旧密钥加密的块重新加密，没有块引用后才删除旧密钥
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/bpfs/fragmenta/security"
+	"github.com/bpfs/fragmenta/throttle"
+	"github.com/bpfs/fragmenta/vfs"
+)
+
+var (
+	// ErrKeyInUse 密钥仍被数据块引用，不能删除
+	ErrKeyInUse = errors.New("密钥仍被数据块引用")
+
+	// errReencryptConflict 重新加密期间块被改写，放弃写回读到的旧数据
+	errReencryptConflict = errors.New("重新加密期间块已被改写")
+)
+
+// KeyRotatorOptions 密钥轮换器选项
+type KeyRotatorOptions struct {
+	// StatePath 块与密钥对应关系的保存路径
+	StatePath string
+
+	// LazyReencrypt 读取到旧密钥加密的块时在后台把它重新加密
+	LazyReencrypt bool
+
+	// Throttle 批量重新加密使用的后台限速，可为nil
+	Throttle *throttle.Limiter
+}
+
+// KeyRotator 替代安全管理器接入存储管理器，加密时记录块使用的密钥，解密时按记录选择密钥
+type KeyRotator struct {
+	storage  StorageManager
+	security security.SecurityManager
+	keys     security.KeyManager
+	options  KeyRotatorOptions
+
+	mu sync.Mutex
+
+	// 持久化的状态
+	state keyRotationState
+
+	// 状态是否有未保存的修改
+	dirty bool
+
+	// 读取时发现仍使用旧密钥的块，重新加密时优先处理
+	stale map[uint32]struct{}
+
+	// 正在重新加密的块
+	pending map[uint32]*reencryptTicket
+
+	// 后台重新加密队列
+	lazyQueue chan uint32
+	lazyDone  chan struct{}
+	closed    bool
+
+	// 注销安全管理器自动轮换回调，安全管理器不支持自动轮换时为nil
+	removeRotationHook func()
+}
+
+// keyRotationState 保存到StatePath的状态
+type keyRotationState struct {
+	// 新写入的块使用的密钥
+	CurrentKey string `json:"currentKey"`
+
+	// 已被轮换、等待没有块引用后删除的密钥
+	Retiring []string `json:"retiring,omitempty"`
+
+	// 块ID到密钥ID
+	Blocks map[uint32]string `json:"blocks"`
+}
+
+// reencryptTicket 重新加密一个块时读到的明文，用于发现期间的并发写入
+type reencryptTicket struct {
+	data     []byte
+	conflict bool
+}
+
+// NewKeyRotator 创建密钥轮换器并把它设为存储管理器的安全管理器，同时启用加密
+// 首次创建时使用安全管理器的默认密钥作为当前密钥；之前已加密的块在第一次读取时记录所用密钥
+func NewKeyRotator(sm StorageManager, secMgr security.SecurityManager, options KeyRotatorOptions) (*KeyRotator, error) {
+	if sm == nil || secMgr == nil {
+		return nil, fmt.Errorf("存储管理器和安全管理器不能为空")
+	}
+	if options.StatePath == "" {
+		return nil, fmt.Errorf("未指定密钥轮换状态路径")
+	}
+
+	r := &KeyRotator{
+		storage:  sm,
+		security: secMgr,
+		keys:     secMgr.GetKeyManager(),
+		options:  options,
+		state:    keyRotationState{Blocks: make(map[uint32]string)},
+		stale:    make(map[uint32]struct{}),
+		pending:  make(map[uint32]*reencryptTicket),
+	}
+
+	data, err := os.ReadFile(options.StatePath)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &r.state); err != nil {
+			return nil, fmt.Errorf("解析密钥轮换状态失败: %w", err)
+		}
+		if r.state.Blocks == nil {
+			r.state.Blocks = make(map[uint32]string)
+		}
+	case os.IsNotExist(err):
+		if defaults, ok := secMgr.(interface{ GetDefaultKey() string }); ok {
+			r.state.CurrentKey = defaults.GetDefaultKey()
+		}
+		r.dirty = true
+	default:
+		return nil, fmt.Errorf("读取密钥轮换状态失败: %w", err)
+	}
+	if r.state.CurrentKey == "" {
+		return nil, fmt.Errorf("安全管理器没有默认密钥")
+	}
+	r.syncDefaultKey()
+
+	if err := r.Save(); err != nil {
+		return nil, err
+	}
+	if err := sm.SetSecurityManager(r); err != nil {
+		return nil, fmt.Errorf("设置安全管理器失败: %w", err)
+	}
+	if err := sm.SetEncryptionEnabled(true); err != nil {
+		return nil, fmt.Errorf("启用加密失败: %w", err)
+	}
+
+	if options.LazyReencrypt {
+		r.lazyQueue = make(chan uint32, 256)
+		r.lazyDone = make(chan struct{})
+		go r.lazyLoop()
+	}
+
+	// 安全管理器自动轮换当前密钥时跟随切换
+	if scheduler, ok := secMgr.(interface {
+		AddRotationHook(hook security.RotationHook) func()
+	}); ok {
+		r.removeRotationHook = scheduler.AddRotationHook(r.adoptRotatedKey)
+	}
+	return r, nil
+}
+
+// EncryptBlock 使用当前密钥加密块并记录所用密钥
+func (r *KeyRotator) EncryptBlock(ctx context.Context, blockID uint32, data []byte) ([]byte, error) {
+	r.mu.Lock()
+	if ticket := r.pending[blockID]; ticket != nil {
+		if !bytes.Equal(ticket.data, data) {
+			ticket.conflict = true
+		} else if ticket.conflict {
+			r.mu.Unlock()
+			return nil, errReencryptConflict
+		}
+	}
+	keyID := r.state.CurrentKey
+	r.mu.Unlock()
+
+	var ciphertext []byte
+	var err error
+	if sealer, ok := r.security.(blockKeyEncrypter); ok {
+		ciphertext, err = sealer.EncryptBlockWithKey(ctx, keyID, blockID, data)
+	} else {
+		ciphertext, err = r.security.EncryptWithKey(ctx, keyID, data, blockEncryptionOptions(blockID))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.recordLocked(blockID, keyID)
+	r.mu.Unlock()
+	return ciphertext, nil
+}
+
+// blockKeyEncrypter 能用指定密钥输出加密块信封的安全管理器
+type blockKeyEncrypter interface {
+	EncryptBlockWithKey(ctx context.Context, keyID string, blockID uint32, data []byte) ([]byte, error)
+}
+
+// DecryptBlock 解密块并记录所用密钥。加密块信封自带密钥ID；旧格式的块先用记录的密钥，
+// 记录缺失或不符时依次尝试当前密钥和待删除的旧密钥
+func (r *KeyRotator) DecryptBlock(ctx context.Context, blockID uint32, data []byte) ([]byte, error) {
+	if security.IsBlockEnvelope(data) {
+		envelope, err := security.ParseBlockEnvelope(data)
+		if err != nil {
+			return nil, err
+		}
+		plaintext, err := r.security.DecryptBlock(ctx, blockID, data)
+		if err != nil {
+			return nil, err
+		}
+		r.recordDecrypted(blockID, envelope.KeyID)
+		return plaintext, nil
+	}
+
+	r.mu.Lock()
+	candidates := make([]string, 0, len(r.state.Retiring)+2)
+	if keyID, ok := r.state.Blocks[blockID]; ok {
+		candidates = append(candidates, keyID)
+	}
+	candidates = append(candidates, r.state.CurrentKey)
+	candidates = append(candidates, r.state.Retiring...)
+	r.mu.Unlock()
+
+	var firstErr error
+	tried := make(map[string]bool, len(candidates))
+	for _, keyID := range candidates {
+		if tried[keyID] {
+			continue
+		}
+		tried[keyID] = true
+
+		plaintext, err := r.security.DecryptWithKey(ctx, keyID, data, blockEncryptionOptions(blockID))
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		r.recordDecrypted(blockID, keyID)
+		return plaintext, nil
+	}
+	return nil, firstErr
+}
+
+// recordDecrypted 记录解密块所用的密钥，旧密钥加密的块加入重新加密队列
+func (r *KeyRotator) recordDecrypted(blockID uint32, keyID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.recordLocked(blockID, keyID)
+	if keyID != r.state.CurrentKey {
+		r.stale[blockID] = struct{}{}
+		if r.lazyQueue != nil && !r.closed {
+			select {
+			case r.lazyQueue <- blockID:
+			default:
+				// 队列已满，留在stale中等待Reencrypt处理
+			}
+		}
+	}
+}
+
+// recordLocked 记录块使用的密钥，调用方需持有锁
+func (r *KeyRotator) recordLocked(blockID uint32, keyID string) {
+	if r.state.Blocks[blockID] != keyID {
+		r.state.Blocks[blockID] = keyID
+		r.dirty = true
+	}
+	if keyID == r.state.CurrentKey {
+		delete(r.stale, blockID)
+	}
+}
+
+// blockEncryptionOptions 以块ID作为关联数据，用于不支持信封的安全管理器
+func blockEncryptionOptions(blockID uint32) *security.EncryptionOptions {
+	aad := make([]byte, 4)
+	binary.BigEndian.PutUint32(aad, blockID)
+	return &security.EncryptionOptions{AdditionalData: aad}
+}
+
+// AuditRecorder 返回被包装的安全管理器的审计记录器
+func (r *KeyRotator) AuditRecorder() security.AuditRecorder {
+	if m, ok := r.security.(interface{ AuditRecorder() security.AuditRecorder }); ok {
+		return m.AuditRecorder()
+	}
+	return nil
+}
+
+// CurrentKey 返回新写入的块使用的密钥
+func (r *KeyRotator) CurrentKey() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.state.CurrentKey
+}
+
+// KeyReferences 返回每个密钥被多少个块引用
+func (r *KeyRotator) KeyReferences() map[string]int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	refs := make(map[string]int)
+	for _, keyID := range r.state.Blocks {
+		refs[keyID]++
+	}
+	return refs
+}
+
+// Pending 返回仍使用旧密钥的块数
+func (r *KeyRotator) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	n := 0
+	for _, keyID := range r.state.Blocks {
+		if keyID != r.state.CurrentKey {
+			n++
+		}
+	}
+	return n
+}
+
+// Rotate 生成新密钥作为当前密钥，旧密钥进入待删除列表
+// 之后写入的块使用新密钥，已有的块由Reencrypt或后台重新加密迁移
+func (r *KeyRotator) Rotate(ctx context.Context, options *security.KeyOptions) (string, error) {
+	r.mu.Lock()
+	oldKeyID := r.state.CurrentKey
+	r.mu.Unlock()
+
+	newKeyID, err := r.keys.RotateKey(ctx, oldKeyID, options)
+	if err != nil {
+		return "", fmt.Errorf("轮换密钥失败: %w", err)
+	}
+
+	r.mu.Lock()
+	r.state.CurrentKey = newKeyID
+	r.state.Retiring = append(r.state.Retiring, oldKeyID)
+	r.dirty = true
+	r.mu.Unlock()
+
+	r.syncDefaultKey()
+	if err := r.Save(); err != nil {
+		return "", err
+	}
+
+	logger.Info("密钥已轮换", "旧密钥", oldKeyID, "新密钥", newKeyID)
+	return newKeyID, nil
+}
+
+// adoptRotatedKey 安全管理器自动轮换了当前密钥时，把新密钥设为当前密钥并重新加密旧块
+func (r *KeyRotator) adoptRotatedKey(ctx context.Context, oldKeyID, newKeyID string) error {
+	r.mu.Lock()
+	if r.closed || oldKeyID != r.state.CurrentKey {
+		r.mu.Unlock()
+		return nil
+	}
+	r.state.CurrentKey = newKeyID
+	r.state.Retiring = append(r.state.Retiring, oldKeyID)
+	r.dirty = true
+	r.mu.Unlock()
+
+	r.syncDefaultKey()
+	if err := r.Save(); err != nil {
+		return err
+	}
+
+	logger.Info("密钥已自动轮换", "旧密钥", oldKeyID, "新密钥", newKeyID)
+	_, err := r.Reencrypt(ctx, 0)
+	return err
+}
+
+// syncDefaultKey 让安全管理器的默认密钥与当前密钥一致
+func (r *KeyRotator) syncDefaultKey() {
+	if defaults, ok := r.security.(interface{ SetDefaultKey(keyID string) }); ok {
+		defaults.SetDefaultKey(r.CurrentKey())
+	}
+}
+
+// Reencrypt 把最多limit个仍使用旧密钥的块用当前密钥重新加密，limit<=0时处理全部
+// 读取时发现的旧块优先处理。完成后保存状态并删除不再被引用的旧密钥，返回重新加密的块数
+func (r *KeyRotator) Reencrypt(ctx context.Context, limit int) (int, error) {
+	ids := r.staleBlocks()
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	done := 0
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			r.Save()
+			return done, err
+		}
+		reencrypted, err := r.reencryptBlock(ctx, id)
+		if err != nil {
+			r.Save()
+			return done, fmt.Errorf("重新加密块%d失败: %w", id, err)
+		}
+		if reencrypted {
+			done++
+		}
+	}
+
+	if err := r.Save(); err != nil {
+		return done, err
+	}
+	if _, err := r.RetireUnusedKeys(ctx); err != nil {
+		return done, err
+	}
+	return done, nil
+}
+
+// staleBlocks 返回仍使用旧密钥的块，读取时发现的排在前面
+func (r *KeyRotator) staleBlocks() []uint32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := make([]uint32, 0, len(r.state.Blocks))
+	for id, keyID := range r.state.Blocks {
+		if keyID != r.state.CurrentKey {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		_, si := r.stale[ids[i]]
+		_, sj := r.stale[ids[j]]
+		if si != sj {
+			return si
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// reencryptBlock 读出块并写回，写回时EncryptBlock使用当前密钥
+func (r *KeyRotator) reencryptBlock(ctx context.Context, id uint32) (bool, error) {
+	data, err := r.storage.ReadBlock(id)
+	if errors.Is(err, ErrBlockNotFound) {
+		// 块已删除
+		r.mu.Lock()
+		delete(r.state.Blocks, id)
+		delete(r.stale, id)
+		r.dirty = true
+		r.mu.Unlock()
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	if r.state.Blocks[id] == r.state.CurrentKey {
+		// 读取期间已被改写
+		r.mu.Unlock()
+		return false, nil
+	}
+	r.pending[id] = &reencryptTicket{data: data}
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		delete(r.pending, id)
+		r.mu.Unlock()
+	}()
+
+	if err := r.options.Throttle.Wait(ctx, 2*int64(len(data))); err != nil {
+		return false, err
+	}
+	if err := r.storage.WriteBlock(id, data); err != nil {
+		if errors.Is(err, errReencryptConflict) {
+			// 并发写入已用当前密钥写入新数据
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// lazyLoop 后台重新加密读取时发现的旧块
+func (r *KeyRotator) lazyLoop() {
+	defer close(r.lazyDone)
+	for id := range r.lazyQueue {
+		if _, err := r.reencryptBlock(context.Background(), id); err != nil {
+			logger.Warn("后台重新加密块失败", "id", id, "error", err)
+		}
+	}
+}
+
+// RetireUnusedKeys 删除待删除列表中已没有块引用的密钥，返回删除的密钥ID
+// 存储中的块数多于已记录的块数时，可能有未记录密钥的旧块，不删除任何密钥
+func (r *KeyRotator) RetireUnusedKeys(ctx context.Context) ([]string, error) {
+	stats, err := r.storage.GetStats()
+	if err != nil {
+		return nil, fmt.Errorf("获取存储统计失败: %w", err)
+	}
+
+	r.mu.Lock()
+	if int(stats.TotalBlocks) > len(r.state.Blocks) {
+		r.mu.Unlock()
+		logger.Warn("存在未记录密钥的块，暂不删除旧密钥", "总块数", stats.TotalBlocks, "已记录", len(r.state.Blocks))
+		return nil, nil
+	}
+	refs := make(map[string]int)
+	for _, keyID := range r.state.Blocks {
+		refs[keyID]++
+	}
+	var unused []string
+	for _, keyID := range r.state.Retiring {
+		if refs[keyID] == 0 {
+			unused = append(unused, keyID)
+		}
+	}
+	r.mu.Unlock()
+
+	if len(unused) == 0 {
+		return nil, nil
+	}
+
+	// 先保存块与密钥的对应关系，再删除密钥
+	if err := r.Save(); err != nil {
+		return nil, err
+	}
+
+	var retired []string
+	for _, keyID := range unused {
+		if err := r.RetireKey(ctx, keyID); err != nil {
+			if errors.Is(err, ErrKeyInUse) {
+				continue
+			}
+			return retired, err
+		}
+		retired = append(retired, keyID)
+	}
+	return retired, nil
+}
+
+// RetireKey 删除一个不再被任何块引用的旧密钥，当前密钥和仍被引用的密钥返回ErrKeyInUse
+func (r *KeyRotator) RetireKey(ctx context.Context, keyID string) error {
+	r.mu.Lock()
+	if keyID == r.state.CurrentKey {
+		r.mu.Unlock()
+		return fmt.Errorf("%w: %s是当前密钥", ErrKeyInUse, keyID)
+	}
+	for id, used := range r.state.Blocks {
+		if used == keyID {
+			r.mu.Unlock()
+			return fmt.Errorf("%w: %s仍被块%d引用", ErrKeyInUse, keyID, id)
+		}
+	}
+	r.mu.Unlock()
+
+	if err := r.keys.DeleteKey(ctx, keyID); err != nil {
+		return fmt.Errorf("删除密钥失败: %w", err)
+	}
+
+	r.mu.Lock()
+	for i, retiring := range r.state.Retiring {
+		if retiring == keyID {
+			r.state.Retiring = append(r.state.Retiring[:i], r.state.Retiring[i+1:]...)
+			r.dirty = true
+			break
+		}
+	}
+	r.mu.Unlock()
+
+	logger.Info("旧密钥已删除", "密钥", keyID)
+	return r.Save()
+}
+
+// Save 保存块与密钥的对应关系
+func (r *KeyRotator) Save() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.dirty {
+		return nil
+	}
+	data, err := json.Marshal(&r.state)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(vfs.OS, r.options.StatePath, data, 0600, true); err != nil {
+		return fmt.Errorf("保存密钥轮换状态失败: %w", err)
+	}
+	r.dirty = false
+	return nil
+}
+
+// Close 停止后台重新加密并保存状态，不关闭存储管理器
+func (r *KeyRotator) Close() error {
+	if r.removeRotationHook != nil {
+		r.removeRotationHook()
+	}
+
+	r.mu.Lock()
+	closed := r.closed
+	r.closed = true
+	if !closed && r.lazyQueue != nil {
+		close(r.lazyQueue)
+	}
+	r.mu.Unlock()
+
+	if !closed && r.lazyQueue != nil {
+		<-r.lazyDone
+	}
+	return r.Save()
+}
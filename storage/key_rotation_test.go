@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+	"github.com/bpfs/fragmenta/security"
+)
+
+// TestKeyRotator 测试密钥轮换后重新加密已有块并删除旧密钥
+func TestKeyRotator(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	securityManager, err := security.NewDefaultSecurityManager(&security.SecurityConfig{
+		EncryptionEnabled: true,
+		DefaultAlgorithm:  security.AES256GCM,
+		KeyStorePath:      filepath.Join(dir, "keys"),
+		AutoGenerateKey:   true,
+	})
+	if err != nil {
+		t.Fatalf("创建安全管理器失败: %v", err)
+	}
+	if err := securityManager.Initialize(ctx); err != nil {
+		t.Fatalf("初始化安全管理器失败: %v", err)
+	}
+	keyManager := securityManager.GetKeyManager()
+
+	storageConfig := &StorageConfig{
+		Type:        StorageTypeContainer,
+		Path:        filepath.Join(dir, "data.db"),
+		BlockSize:   4096,
+		CacheSize:   1 << 20,
+		CachePolicy: "lru",
+	}
+	statePath := filepath.Join(dir, "keys.json")
+
+	// open 重新打开存储，使读取绕过块缓存走解密路径
+	open := func(lazy bool) (StorageManager, *KeyRotator) {
+		sm, err := NewStorageManager(storageConfig)
+		if err != nil {
+			t.Fatalf("创建存储管理器失败: %v", err)
+		}
+		rotator, err := NewKeyRotator(sm, securityManager, KeyRotatorOptions{StatePath: statePath, LazyReencrypt: lazy})
+		if err != nil {
+			t.Fatalf("创建密钥轮换器失败: %v", err)
+		}
+		return sm, rotator
+	}
+	block := func(id uint32) []byte {
+		return []byte(fmt.Sprintf("block-%d-payload", id))
+	}
+
+	sm, rotator := open(false)
+	oldKey := rotator.CurrentKey()
+	for id := uint32(1); id <= 5; id++ {
+		if err := sm.WriteBlock(id, block(id)); err != nil {
+			t.Fatalf("写入块失败: %v", err)
+		}
+	}
+
+	newKey, err := rotator.Rotate(ctx, nil)
+	if err != nil {
+		t.Fatalf("轮换密钥失败: %v", err)
+	}
+	if err := sm.WriteBlock(6, block(6)); err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	refs := rotator.KeyReferences()
+	if refs[oldKey] != 5 || refs[newKey] != 1 {
+		t.Errorf("密钥引用计数不正确: %v", refs)
+	}
+	if err := rotator.RetireKey(ctx, oldKey); !errors.Is(err, ErrKeyInUse) {
+		t.Errorf("仍被引用的密钥不应被删除: %v", err)
+	}
+	rotator.Close()
+	sm.Close()
+
+	// 读取旧块时在后台重新加密
+	sm, rotator = open(true)
+	if data, err := sm.ReadBlock(2); err != nil || !bytes.Equal(data, block(2)) {
+		t.Fatalf("读取旧密钥加密的块失败: %q, %v", data, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for rotator.Pending() != 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if pending := rotator.Pending(); pending != 4 {
+		t.Errorf("后台重新加密后应剩4个旧块: %d", pending)
+	}
+
+	// 批量重新加密剩余的块，旧密钥随后被删除
+	n, err := rotator.Reencrypt(ctx, 0)
+	if err != nil || n != 4 {
+		t.Fatalf("批量重新加密失败: %d, %v", n, err)
+	}
+	if exists, _ := keyManager.KeyExists(ctx, oldKey); exists {
+		t.Errorf("没有块引用的旧密钥应被删除")
+	}
+	rotator.Close()
+	sm.Close()
+
+	sm, rotator = open(false)
+	defer sm.Close()
+	defer rotator.Close()
+	for id := uint32(1); id <= 6; id++ {
+		if data, err := sm.ReadBlock(id); err != nil || !bytes.Equal(data, block(id)) {
+			t.Errorf("删除旧密钥后读取块%d失败: %q, %v", id, data, err)
+		}
+	}
+	if refs := rotator.KeyReferences(); refs[newKey] != 6 || len(refs) != 1 {
+		t.Errorf("所有块应使用新密钥: %v", refs)
+	}
+}
+
+// TestKeyRotatorAutoRotation 测试安全管理器自动轮换当前密钥后，轮换器切换密钥并重新加密已有块
+func TestKeyRotatorAutoRotation(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+	fakeClock := clock.NewFake(time.Now())
+
+	securityManager, err := security.NewDefaultSecurityManager(&security.SecurityConfig{
+		EncryptionEnabled: true,
+		DefaultAlgorithm:  security.AES256GCM,
+		KeyStorePath:      filepath.Join(dir, "keys"),
+		Clock:             fakeClock,
+	})
+	if err != nil {
+		t.Fatalf("创建安全管理器失败: %v", err)
+	}
+	keyManager := securityManager.GetKeyManager()
+	oldKey, err := keyManager.GenerateKey(ctx, security.SymmetricKey, &security.KeyOptions{
+		Type:           security.SymmetricKey,
+		Size:           256,
+		RotationPolicy: &security.RotationPolicy{IntervalSeconds: 1, AutoRotate: true},
+	})
+	if err != nil {
+		t.Fatalf("生成密钥失败: %v", err)
+	}
+	securityManager.SetDefaultKey(oldKey)
+
+	sm, err := NewStorageManager(&StorageConfig{
+		Type:        StorageTypeContainer,
+		Path:        filepath.Join(dir, "data.db"),
+		BlockSize:   4096,
+		CacheSize:   1 << 20,
+		CachePolicy: "lru",
+	})
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+	defer sm.Close()
+	rotator, err := NewKeyRotator(sm, securityManager, KeyRotatorOptions{StatePath: filepath.Join(dir, "keys.json")})
+	if err != nil {
+		t.Fatalf("创建密钥轮换器失败: %v", err)
+	}
+	defer rotator.Close()
+	for id := uint32(1); id <= 3; id++ {
+		if err := sm.WriteBlock(id, []byte(fmt.Sprintf("block-%d", id))); err != nil {
+			t.Fatalf("写入块失败: %v", err)
+		}
+	}
+
+	// 推进时钟使密钥进入轮换窗口（剩余有效期不足十分之一）
+	results, err := securityManager.RotateDueKeys(ctx)
+	if err != nil || len(results) != 0 {
+		t.Fatalf("密钥未到轮换窗口时不应轮换: %+v, %v", results, err)
+	}
+	fakeClock.Advance(950 * time.Millisecond)
+	if results, err = securityManager.RotateDueKeys(ctx); err != nil {
+		t.Fatalf("自动轮换失败: %v", err)
+	}
+	if len(results) != 1 || results[0].Err != nil || len(results[0].HookErrors) != 0 {
+		t.Fatalf("自动轮换结果不正确: %+v", results)
+	}
+
+	newKey := results[0].NewKeyID
+	if rotator.CurrentKey() != newKey || rotator.Pending() != 0 {
+		t.Errorf("轮换器应切换到新密钥并重新加密全部块: %s, %d", rotator.CurrentKey(), rotator.Pending())
+	}
+	if exists, _ := keyManager.KeyExists(ctx, oldKey); exists {
+		t.Error("重新加密后旧密钥应被删除")
+	}
+}
@@ -0,0 +1,331 @@
+// package storage 提供目录存储的分层布局与布局迁移
+package storage
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+	"github.com/bpfs/fragmenta/vfs"
+)
+
+// DirectoryLayout 目录存储的块文件分层布局
+// 块文件路径形如 blocks/ab/cd/<id>.blk，其中每一层目录名取自块ID哈希值的十六进制表示
+type DirectoryLayout struct {
+	// Levels 分层级数，0表示所有块文件直接放在blocks目录下
+	Levels int
+	// Width 每层目录名的十六进制字符数（每层最多16^Width个子目录）
+	Width int
+}
+
+// DefaultDirectoryLayout 默认布局：两级、每级256个子目录
+var DefaultDirectoryLayout = DirectoryLayout{Levels: 2, Width: 2}
+
+// FlatDirectoryLayout 平铺布局：所有块文件直接放在blocks目录下
+var FlatDirectoryLayout = DirectoryLayout{Levels: 0, Width: 0}
+
+// blockFileSuffix 块文件扩展名
+const blockFileSuffix = ".blk"
+
+// Validate 验证布局参数
+func (l DirectoryLayout) Validate() error {
+	if l.Levels < 0 {
+		return fmt.Errorf("无效的目录分层级数: %d", l.Levels)
+	}
+	if l.Levels == 0 {
+		return nil
+	}
+	if l.Width < 1 || l.Width > 4 {
+		return fmt.Errorf("无效的目录名宽度: %d（有效范围1-4）", l.Width)
+	}
+	// 哈希值共8个十六进制字符
+	if l.Levels*l.Width > 8 {
+		return fmt.Errorf("目录分层过深: %d级x%d字符超过哈希长度", l.Levels, l.Width)
+	}
+	return nil
+}
+
+// String 返回布局的字符串表示
+func (l DirectoryLayout) String() string {
+	if l.Levels == 0 {
+		return "flat"
+	}
+	return fmt.Sprintf("%dx%d", l.Levels, l.Width)
+}
+
+// RelativePath 返回块文件相对于blocks目录的路径
+func (l DirectoryLayout) RelativePath(id uint32) string {
+	name := blockFileName(id)
+	if l.Levels == 0 {
+		return name
+	}
+
+	hash := fmt.Sprintf("%08x", hashBlockID(id))
+	parts := make([]string, 0, l.Levels+1)
+	for i := 0; i < l.Levels; i++ {
+		parts = append(parts, hash[i*l.Width:(i+1)*l.Width])
+	}
+	parts = append(parts, name)
+
+	return filepath.Join(parts...)
+}
+
+// resolveDirectoryLayout 从配置中解析目录布局，未配置时使用默认布局
+func resolveDirectoryLayout(config *StorageConfig) (DirectoryLayout, error) {
+	if config == nil || config.DirectoryLayout == nil {
+		return DefaultDirectoryLayout, nil
+	}
+
+	layout := *config.DirectoryLayout
+	if err := layout.Validate(); err != nil {
+		return DirectoryLayout{}, err
+	}
+	return layout, nil
+}
+
+// hashBlockID 计算块ID的哈希值，用于将块均匀分散到各个子目录
+func hashBlockID(id uint32) uint32 {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], id)
+
+	h := fnv.New32a()
+	h.Write(buf[:])
+	return h.Sum32()
+}
+
+// blockFileName 返回块文件名
+func blockFileName(id uint32) string {
+	return fmt.Sprintf("%08x", id) + blockFileSuffix
+}
+
+// parseBlockFileName 从块文件名中解析块ID
+func parseBlockFileName(name string) (uint32, bool) {
+	if !strings.HasSuffix(name, blockFileSuffix) {
+		return 0, false
+	}
+
+	hexID := strings.TrimSuffix(name, blockFileSuffix)
+	if len(hexID) != 8 {
+		return 0, false
+	}
+
+	id, err := strconv.ParseUint(hexID, 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	return uint32(id), true
+}
+
+// scanBlockFiles 递归扫描blocks目录，返回块ID到文件路径的映射
+// 扫描与布局无关，可以识别任意历史布局下的块文件
+func scanBlockFiles(fsys vfs.FS, blocksPath string) (map[uint32]string, error) {
+	result := make(map[uint32]string)
+
+	err := vfs.WalkDir(fsys, blocksPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		id, ok := parseBlockFileName(d.Name())
+		if !ok {
+			return nil
+		}
+
+		if existing, dup := result[id]; dup {
+			logger.Warn("发现重复的块文件", "id", id, "保留", existing, "忽略", path)
+			return nil
+		}
+		result[id] = path
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// LayoutMigrationReport 布局迁移报告
+type LayoutMigrationReport struct {
+	// From 迁移前布局的描述（扫描得到时为"scan"）
+	From string
+	// To 迁移后的布局
+	To DirectoryLayout
+	// TotalBlocks 扫描到的块文件数
+	TotalBlocks int
+	// MovedBlocks 实际移动的块文件数
+	MovedBlocks int
+	// SkippedBlocks 已处于目标位置的块文件数
+	SkippedBlocks int
+	// RemovedDirs 清理的空目录数
+	RemovedDirs int
+	// Errors 迁移过程中的错误
+	Errors []error
+	// Duration 迁移用时
+	Duration time.Duration
+}
+
+// MigrateDirectoryLayout 将目录存储中的块文件迁移到新的分层布局
+// basePath 为目录存储的根路径（包含blocks子目录）。函数扫描所有块文件，
+// 将不在目标位置的文件重命名到新路径，并清理迁移后留下的空目录。
+// 迁移期间不得有其他进程访问该目录存储；迁移后meta.idx会被删除并在下次打开时重建。
+func MigrateDirectoryLayout(basePath string, layout DirectoryLayout) (*LayoutMigrationReport, error) {
+	return migrateDirectoryLayout(vfs.OS, basePath, layout)
+}
+
+// migrateDirectoryLayout 通过fsys迁移目录存储的布局
+func migrateDirectoryLayout(fsys vfs.FS, basePath string, layout DirectoryLayout) (*LayoutMigrationReport, error) {
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+
+	blocksPath := filepath.Join(basePath, "blocks")
+	if _, err := fsys.Stat(blocksPath); err != nil {
+		logger.Error("访问块目录失败", "path", blocksPath, "error", err)
+		return nil, err
+	}
+
+	files, err := scanBlockFiles(fsys, blocksPath)
+	if err != nil {
+		logger.Error("扫描块文件失败", "error", err)
+		return nil, err
+	}
+
+	report, _ := migrateBlockFiles(fsys, clock.System, blocksPath, files, layout)
+
+	// 块路径已改变，删除旧的块映射索引，下次打开时通过扫描重建
+	metaPath := filepath.Join(basePath, "meta.idx")
+	if err := fsys.Remove(metaPath); err != nil && !os.IsNotExist(err) {
+		logger.Error("删除块映射索引失败", "path", metaPath, "error", err)
+		return report, err
+	}
+
+	return report, nil
+}
+
+// migrateBlockFiles 按照新布局移动块文件，返回迁移报告和迁移后的块路径映射
+func migrateBlockFiles(fsys vfs.FS, c clock.Clock, blocksPath string, files map[uint32]string, layout DirectoryLayout) (*LayoutMigrationReport, map[uint32]string) {
+	start := c.Now()
+	report := &LayoutMigrationReport{
+		From:        "scan",
+		To:          layout,
+		TotalBlocks: len(files),
+	}
+
+	newPaths := make(map[uint32]string, len(files))
+	for id, oldPath := range files {
+		newPath := filepath.Join(blocksPath, layout.RelativePath(id))
+		if filepath.Clean(oldPath) == newPath {
+			newPaths[id] = newPath
+			report.SkippedBlocks++
+			continue
+		}
+
+		if err := fsys.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("创建目录失败(ID=%d): %w", id, err))
+			newPaths[id] = oldPath
+			continue
+		}
+
+		if err := fsys.Rename(oldPath, newPath); err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("移动块文件失败(ID=%d): %w", id, err))
+			newPaths[id] = oldPath
+			continue
+		}
+
+		newPaths[id] = newPath
+		report.MovedBlocks++
+	}
+
+	report.RemovedDirs = removeEmptyDirs(fsys, blocksPath)
+	report.Duration = c.Since(start)
+
+	logger.Info("目录布局迁移完成",
+		"目标布局", layout.String(),
+		"总块数", report.TotalBlocks,
+		"移动", report.MovedBlocks,
+		"跳过", report.SkippedBlocks,
+		"错误", len(report.Errors))
+
+	return report, newPaths
+}
+
+// removeEmptyDirs 自底向上删除root下的空目录（不删除root本身），返回删除的目录数
+func removeEmptyDirs(fsys vfs.FS, root string) int {
+	removed := 0
+
+	entries, err := fsys.ReadDir(root)
+	if err != nil {
+		return 0
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		dir := filepath.Join(root, entry.Name())
+		removed += removeEmptyDirs(fsys, dir)
+
+		children, err := fsys.ReadDir(dir)
+		if err == nil && len(children) == 0 {
+			if fsys.Remove(dir) == nil {
+				removed++
+			}
+		}
+	}
+
+	return removed
+}
+
+// MigrateLayout 将当前目录存储迁移到新布局，并同步更新块映射
+func (ds *DirectoryStorage) MigrateLayout(layout DirectoryLayout) (*LayoutMigrationReport, error) {
+	if err := layout.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := ds.ensureBlockMap(); err != nil {
+		return nil, err
+	}
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	ds.markDirty()
+
+	// 以磁盘上的实际文件为准
+	files, err := scanBlockFiles(ds.fs, ds.BlocksPath)
+	if err != nil {
+		logger.Error("扫描块文件失败", "error", err)
+		return nil, err
+	}
+
+	for _, path := range files {
+		ds.fdCache.Invalidate(path)
+	}
+
+	report, newPaths := migrateBlockFiles(ds.fs, ds.clock, ds.BlocksPath, files, layout)
+	report.From = ds.Layout.String()
+	ds.migrateReplicasLocked(layout, report)
+
+	for id, path := range newPaths {
+		ds.BlockMap[id] = path
+	}
+	ds.Layout = layout
+
+	if err := ds.flushLocked(); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestDirectoryLayout 测试目录存储的分层布局
+func TestDirectoryLayout(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "directory_layout_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// 无效布局应被拒绝
+	invalid := []DirectoryLayout{
+		{Levels: -1, Width: 2},
+		{Levels: 2, Width: 0},
+		{Levels: 3, Width: 3},
+	}
+	for _, layout := range invalid {
+		if err := layout.Validate(); err == nil {
+			t.Errorf("布局%+v应验证失败", layout)
+		}
+	}
+
+	// 默认布局为两级分层
+	ds, err := NewDirectoryStorage(&StorageConfig{Path: tempDir})
+	if err != nil {
+		t.Fatalf("创建目录存储失败: %v", err)
+	}
+	if ds.Layout != DefaultDirectoryLayout {
+		t.Fatalf("默认布局不正确: %v", ds.Layout)
+	}
+
+	data := []byte("layout test data")
+	if err := ds.WriteBlock(42, data); err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+
+	rel, err := filepath.Rel(ds.BlocksPath, ds.BlockMap[42])
+	if err != nil {
+		t.Fatalf("计算相对路径失败: %v", err)
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	if len(parts) != 3 || len(parts[0]) != 2 || len(parts[1]) != 2 {
+		t.Errorf("块路径不符合两级布局: %s", rel)
+	}
+
+	// 平铺布局
+	flatDir := filepath.Join(tempDir, "flat")
+	flat, err := NewDirectoryStorage(&StorageConfig{Path: flatDir, DirectoryLayout: &FlatDirectoryLayout})
+	if err != nil {
+		t.Fatalf("创建平铺目录存储失败: %v", err)
+	}
+	if err := flat.WriteBlock(7, data); err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	if filepath.Dir(flat.BlockMap[7]) != flat.BlocksPath {
+		t.Errorf("平铺布局的块不应位于子目录: %s", flat.BlockMap[7])
+	}
+}
+
+// TestDirectoryLayoutMigration 测试目录布局迁移
+func TestDirectoryLayoutMigration(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "directory_migration_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	ds, err := NewDirectoryStorage(&StorageConfig{Path: tempDir, DirectoryLayout: &FlatDirectoryLayout})
+	if err != nil {
+		t.Fatalf("创建目录存储失败: %v", err)
+	}
+
+	blocks := make(map[uint32][]byte)
+	for id := uint32(1); id <= 50; id++ {
+		blocks[id] = bytes.Repeat([]byte{byte(id)}, int(id))
+		if err := ds.WriteBlock(id, blocks[id]); err != nil {
+			t.Fatalf("写入块%d失败: %v", id, err)
+		}
+	}
+
+	target := DirectoryLayout{Levels: 2, Width: 1}
+	report, err := ds.MigrateLayout(target)
+	if err != nil {
+		t.Fatalf("迁移布局失败: %v", err)
+	}
+	if report.TotalBlocks != 50 || report.MovedBlocks != 50 || len(report.Errors) != 0 {
+		t.Fatalf("迁移报告不正确: %+v", report)
+	}
+	if ds.Layout != target {
+		t.Errorf("迁移后布局未更新: %v", ds.Layout)
+	}
+
+	for id, expected := range blocks {
+		data, err := ds.ReadBlock(id)
+		if err != nil {
+			t.Fatalf("迁移后读取块%d失败: %v", id, err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Errorf("迁移后块%d数据不匹配", id)
+		}
+	}
+
+	// 再次迁移到默认布局（离线工具），旧的一级目录应被清理
+	report, err = MigrateDirectoryLayout(tempDir, DefaultDirectoryLayout)
+	if err != nil {
+		t.Fatalf("离线迁移失败: %v", err)
+	}
+	if report.MovedBlocks+report.SkippedBlocks != 50 {
+		t.Errorf("离线迁移块数不正确: %+v", report)
+	}
+	if report.RemovedDirs == 0 {
+		t.Errorf("离线迁移未清理空目录")
+	}
+
+	files, err := scanBlockFiles(ds.fs, ds.BlocksPath)
+	if err != nil {
+		t.Fatalf("扫描块文件失败: %v", err)
+	}
+	for id, path := range files {
+		expected := filepath.Join(ds.BlocksPath, DefaultDirectoryLayout.RelativePath(id))
+		if path != expected {
+			t.Errorf("块%d位置不正确: 期望%s, 实际%s", id, expected, path)
+		}
+	}
+}
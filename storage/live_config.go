@@ -0,0 +1,297 @@
+package storage
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/bpfs/fragmenta/config"
+)
+
+// 配置项的处理结果
+const (
+	// SettingApplied 已在运行中的存储上生效
+	SettingApplied = "applied"
+	// SettingDeferred 需要显式操作（如ConvertType）或重新打开存储后生效
+	SettingDeferred = "deferred"
+	// SettingRejected 无法用于已存在的存储
+	SettingRejected = "rejected"
+)
+
+// SettingChange 单个配置项的变更及处理结果
+type SettingChange struct {
+	Setting string      `json:"setting"` // 配置项路径，如"storage.blockStrategy.blockSize"
+	Old     interface{} `json:"old"`
+	New     interface{} `json:"new"`
+	Result  string      `json:"result"`
+	Reason  string      `json:"reason,omitempty"`
+}
+
+// LiveConfigReport 一次配置变更的处理报告
+type LiveConfigReport struct {
+	Time    time.Time       `json:"time"`
+	Changes []SettingChange `json:"changes"`
+}
+
+// Filter 返回指定处理结果的变更
+func (r *LiveConfigReport) Filter(result string) []SettingChange {
+	var changes []SettingChange
+	for _, change := range r.Changes {
+		if change.Result == result {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// String 返回报告摘要
+func (r *LiveConfigReport) String() string {
+	return fmt.Sprintf("已生效%d项，延后%d项，拒绝%d项",
+		len(r.Filter(SettingApplied)), len(r.Filter(SettingDeferred)), len(r.Filter(SettingRejected)))
+}
+
+// supportedCachePolicies 块缓存支持的淘汰策略
+var supportedCachePolicies = map[string]bool{"lru": true}
+
+// LiveConfigAdapter 把动态配置变更应用到运行中的存储管理器
+// 缓存大小、缓存策略、自动转换阈值和共享性能资源即时生效；
+// 存储模式延后到调用ConvertType时生效；块大小和存储路径无法修改，只记录在报告中。
+// 实现config.ConfigChangeListener，可直接注册到DynamicConfigManager。
+type LiveConfigAdapter struct {
+	manager   *StorageManagerImpl
+	resources *PerformanceResources // 可为nil
+
+	mu         sync.Mutex
+	lastReport *LiveConfigReport
+	deferred   map[string]SettingChange
+
+	// OnReport 每次处理完配置变更后调用，可为nil
+	OnReport func(report *LiveConfigReport)
+}
+
+// NewLiveConfigAdapter 创建配置适配器，resources为存储使用的共享性能资源，可为nil
+func NewLiveConfigAdapter(manager *StorageManagerImpl, resources *PerformanceResources) *LiveConfigAdapter {
+	return &LiveConfigAdapter{
+		manager:   manager,
+		resources: resources,
+		deferred:  make(map[string]SettingChange),
+	}
+}
+
+// OnConfigChange 实现config.ConfigChangeListener
+func (a *LiveConfigAdapter) OnConfigChange(oldConfig, newConfig *config.Config) {
+	a.Apply(oldConfig, newConfig)
+}
+
+// Apply 应用配置变更并返回处理报告
+// 可以即时生效的配置项与存储当前值比较；不能即时生效的配置项只在oldConfig和newConfig不同时报告
+func (a *LiveConfigAdapter) Apply(oldConfig, newConfig *config.Config) *LiveConfigReport {
+	report := &LiveConfigReport{Time: time.Now()}
+	if newConfig == nil {
+		return report
+	}
+
+	a.mu.Lock()
+	a.applyStorage(report, oldConfig, newConfig)
+	a.applyPerformance(report, oldConfig, newConfig)
+
+	for _, change := range report.Changes {
+		if change.Result == SettingDeferred {
+			a.deferred[change.Setting] = change
+		} else {
+			delete(a.deferred, change.Setting)
+		}
+	}
+	a.lastReport = report
+	onReport := a.OnReport
+	a.mu.Unlock()
+
+	for _, change := range report.Changes {
+		if change.Result == SettingApplied {
+			logger.Info("配置已生效", "setting", change.Setting, "old", change.Old, "new", change.New)
+		} else {
+			logger.Warn("配置未生效", "setting", change.Setting, "result", change.Result, "reason", change.Reason)
+		}
+	}
+	if onReport != nil {
+		onReport(report)
+	}
+	return report
+}
+
+// LastReport 返回最近一次的处理报告，尚未处理过变更时返回nil
+func (a *LiveConfigAdapter) LastReport() *LiveConfigReport {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return a.lastReport
+}
+
+// Deferred 返回尚未生效的延后变更
+func (a *LiveConfigAdapter) Deferred() []SettingChange {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	changes := make([]SettingChange, 0, len(a.deferred))
+	for _, change := range a.deferred {
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// applyStorage 处理存储策略相关的配置项
+func (a *LiveConfigAdapter) applyStorage(report *LiveConfigReport, oldConfig, newConfig *config.Config) {
+	sm := a.manager
+	live := sm.LiveSettings()
+	policy := newConfig.Storage
+
+	// 块缓存大小
+	if size := uint64(max(policy.BlockStrategy.BlockCacheSize, 0)); size != live.CacheSize {
+		sm.SetCacheSize(size)
+		report.add("storage.blockStrategy.blockCacheSize", live.CacheSize, size, SettingApplied, "")
+	}
+
+	// 块缓存策略
+	if cachePolicy := policy.CacheStrategy.CachePolicy; cachePolicy != "" && cachePolicy != live.CachePolicy {
+		if supportedCachePolicies[cachePolicy] {
+			sm.SetCachePolicy(cachePolicy)
+			report.add("storage.cacheStrategy.cachePolicy", live.CachePolicy, cachePolicy, SettingApplied, "")
+		} else {
+			report.add("storage.cacheStrategy.cachePolicy", live.CachePolicy, cachePolicy, SettingRejected, "不支持的缓存策略")
+		}
+	}
+
+	// 自动转换阈值
+	if threshold := uint64(max(policy.AutoConvertThreshold, 0)); threshold != live.AutoConvertThreshold {
+		sm.SetAutoConvertThreshold(threshold)
+		report.add("storage.autoConvertThreshold", live.AutoConvertThreshold, threshold, SettingApplied, "")
+	}
+
+	// 存储模式需要迁移全部数据，不在通知中执行
+	if oldConfig == nil || oldConfig.Storage.Mode != policy.Mode {
+		if mode, ok := storageTypeForMode(policy.Mode); !ok {
+			report.add("storage.mode", live.Type, policy.Mode, SettingRejected, "未知的存储模式")
+		} else if mode != live.Type {
+			report.add("storage.mode", live.Type, mode, SettingDeferred, "需要调用ConvertType迁移数据后生效")
+		}
+	}
+
+	// 块大小和存储路径决定已有数据的布局
+	if oldConfig != nil && oldConfig.Storage.BlockStrategy.BlockSize != policy.BlockStrategy.BlockSize {
+		report.add("storage.blockStrategy.blockSize", oldConfig.Storage.BlockStrategy.BlockSize, policy.BlockStrategy.BlockSize,
+			SettingRejected, "块大小只能在创建存储时指定")
+	}
+	if oldConfig != nil && oldConfig.System.RootPath != newConfig.System.RootPath {
+		report.add("system.rootPath", oldConfig.System.RootPath, newConfig.System.RootPath,
+			SettingRejected, "无法移动运行中的存储，请关闭后在新路径重新打开")
+	}
+}
+
+// applyPerformance 处理共享性能资源相关的配置项
+func (a *LiveConfigAdapter) applyPerformance(report *LiveConfigReport, oldConfig, newConfig *config.Config) {
+	if oldConfig == nil {
+		oldConfig = &config.Config{}
+	}
+	oldPerf, newPerf := oldConfig.Performance, newConfig.Performance
+	changes := []SettingChange{
+		{Setting: "performance.parallelism.maxWorkers", Old: oldPerf.Parallelism.MaxWorkers, New: newPerf.Parallelism.MaxWorkers},
+		{Setting: "performance.parallelism.workQueueLength", Old: oldPerf.Parallelism.WorkQueueLength, New: newPerf.Parallelism.WorkQueueLength},
+		{Setting: "performance.io.fdCacheSize", Old: oldPerf.IO.FDCacheSize, New: newPerf.IO.FDCacheSize},
+		{Setting: "performance.throttle.backgroundBytesPerSecond", Old: oldPerf.Throttle.BackgroundBytesPerSecond, New: newPerf.Throttle.BackgroundBytesPerSecond},
+		{Setting: "performance.throttle.backgroundIOPS", Old: oldPerf.Throttle.BackgroundIOPS, New: newPerf.Throttle.BackgroundIOPS},
+	}
+
+	changed := false
+	for _, change := range changes {
+		if change.Old == change.New {
+			continue
+		}
+		changed = true
+		if a.resources != nil {
+			report.add(change.Setting, change.Old, change.New, SettingApplied, "")
+		} else {
+			report.add(change.Setting, change.Old, change.New, SettingRejected, "存储未使用共享性能资源")
+		}
+	}
+
+	if changed && a.resources != nil {
+		a.resources.OnConfigChange(oldConfig, newConfig)
+	}
+}
+
+// add 添加一项变更
+func (r *LiveConfigReport) add(setting string, oldValue, newValue interface{}, result, reason string) {
+	r.Changes = append(r.Changes, SettingChange{
+		Setting: setting,
+		Old:     oldValue,
+		New:     newValue,
+		Result:  result,
+		Reason:  reason,
+	})
+}
+
+// storageTypeForMode 把配置中的存储模式转换为存储类型
+func storageTypeForMode(mode config.StorageMode) (StorageType, bool) {
+	switch mode {
+	case config.ContainerMode:
+		return StorageTypeContainer, true
+	case config.DirectoryMode:
+		return StorageTypeDirectory, true
+	case config.HybridMode:
+		return StorageTypeHybrid, true
+	default:
+		return 0, false
+	}
+}
+
+// LiveSettings 可在运行时修改的存储设置
+type LiveSettings struct {
+	Type                 StorageType
+	CacheSize            uint64
+	CachePolicy          string
+	AutoConvertThreshold uint64
+}
+
+// LiveSettings 返回存储管理器当前的运行时设置
+func (sm *StorageManagerImpl) LiveSettings() LiveSettings {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	return LiveSettings{
+		Type:                 sm.config.Type,
+		CacheSize:            sm.blockCache.maxSize.Load(),
+		CachePolicy:          sm.blockCache.Policy,
+		AutoConvertThreshold: sm.config.AutoConvertThreshold,
+	}
+}
+
+// SetCacheSize 修改块缓存容量，缩小时立即淘汰超出的条目
+func (sm *StorageManagerImpl) SetCacheSize(size uint64) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.config.CacheSize = size
+	sm.blockCache.setMaxSize(size)
+}
+
+// SetCachePolicy 修改块缓存淘汰策略
+func (sm *StorageManagerImpl) SetCachePolicy(policy string) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.config.CachePolicy = policy
+	sm.blockCache.Policy = policy
+}
+
+// SetAutoConvertThreshold 修改自动转换阈值，0表示关闭自动转换
+// 从关闭改为开启时启动自动检查协程
+func (sm *StorageManagerImpl) SetAutoConvertThreshold(threshold uint64) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.config.AutoConvertThreshold = threshold
+	if threshold > 0 && !sm.autoCheckStarted {
+		sm.autoCheckStarted = true
+		go sm.startAutoCheck()
+	}
+}
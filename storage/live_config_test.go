@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/bpfs/fragmenta/config"
+)
+
+// TestLiveConfigAdapter 测试配置变更应用到运行中的存储管理器
+func TestLiveConfigAdapter(t *testing.T) {
+	resources := NewPerformanceResources(config.PerformanceConfig{})
+	defer resources.Close()
+
+	storageConfig := &StorageConfig{
+		Type:        StorageTypeContainer,
+		Path:        filepath.Join(t.TempDir(), "live.dat"),
+		BlockSize:   4096,
+		CacheSize:   1 << 20,
+		CachePolicy: "lru",
+	}
+	resources.Configure(storageConfig)
+	sm, err := NewStorageManager(storageConfig)
+	if err != nil {
+		t.Fatalf("创建存储管理器失败: %v", err)
+	}
+	defer sm.Close()
+
+	for id := uint32(1); id <= 4; id++ {
+		if err := sm.WriteBlock(id, make([]byte, 1000)); err != nil {
+			t.Fatalf("写入块失败: %v", err)
+		}
+	}
+
+	manager := config.NewDefaultConfigManager()
+	adapter := NewLiveConfigAdapter(sm, resources)
+	manager.RegisterConfigChangeListener(adapter)
+
+	base := manager.GetDefaultConfig()
+	base.Storage.Mode = config.ContainerMode
+	base.Storage.AutoConvertThreshold = 0
+	base.Storage.BlockStrategy.BlockCacheSize = 1 << 20
+	if err := manager.ApplyConfig(context.Background(), base); err != nil {
+		t.Fatalf("应用配置失败: %v", err)
+	}
+	for _, change := range adapter.LastReport().Changes {
+		if change.Result != SettingApplied {
+			t.Errorf("与存储一致的配置不应被拒绝或延后: %+v", change)
+		}
+	}
+
+	next := *base
+	next.Storage.BlockStrategy.BlockCacheSize = 2000
+	next.Storage.BlockStrategy.BlockSize = 8192
+	next.Storage.Mode = config.DirectoryMode
+	next.Storage.CacheStrategy.CachePolicy = "random"
+	next.System.RootPath = "/elsewhere"
+	next.Performance.Parallelism.MaxWorkers = 3
+	next.Performance.IO.FDCacheSize = 7
+	// 未知的缓存策略通不过配置验证，直接交给适配器以检查它自己的拒绝逻辑
+	report := adapter.Apply(base, &next)
+	results := make(map[string]string)
+	for _, change := range report.Changes {
+		results[change.Setting] = change.Result
+	}
+	expected := map[string]string{
+		"storage.blockStrategy.blockCacheSize": SettingApplied,
+		"storage.blockStrategy.blockSize":      SettingRejected,
+		"storage.mode":                         SettingDeferred,
+		"storage.cacheStrategy.cachePolicy":    SettingRejected,
+		"system.rootPath":                      SettingRejected,
+		"performance.parallelism.maxWorkers":   SettingApplied,
+		"performance.io.fdCacheSize":           SettingApplied,
+	}
+	for setting, result := range expected {
+		if results[setting] != result {
+			t.Errorf("%s 应为%s: %s (%s)", setting, result, results[setting], report)
+		}
+	}
+
+	live := sm.LiveSettings()
+	if live.CacheSize != 2000 || sm.blockCache.size.Load() > 2000 {
+		t.Errorf("缓存未缩容: %+v, %d", live, sm.blockCache.size.Load())
+	}
+	if live.Type != StorageTypeContainer {
+		t.Errorf("存储模式不应在通知中转换: %v", live.Type)
+	}
+	if workers, _ := resources.Workers.Size(); workers != 3 {
+		t.Errorf("工作池未调整: %d", workers)
+	}
+	if deferred := adapter.Deferred(); len(deferred) != 1 || deferred[0].Setting != "storage.mode" {
+		t.Errorf("延后变更不正确: %+v", deferred)
+	}
+
+	// 开启自动转换
+	enabled := next
+	enabled.Storage.AutoConvertThreshold = 1 << 30
+	adapter.Apply(&next, &enabled)
+	if !sm.autoCheckStarted || sm.LiveSettings().AutoConvertThreshold != 1<<30 {
+		t.Errorf("自动转换未开启")
+	}
+}
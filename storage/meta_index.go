@@ -0,0 +1,421 @@
+// package storage 提供目录存储块映射(meta.idx)的持久化
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/bpfs/fragmenta/vfs"
+)
+
+// meta.idx 文件格式（大端序）:
+//
+//	magic(4) | version(2) | reserved(2) | count(4)
+//	count x [ id(4) | size(4) | pathLen(2) | path(pathLen) ]
+//	crc32(4)  —— 对之前所有字节计算的CRC32-C校验和
+//
+// path 为块文件相对于blocks目录的路径，使用'/'分隔，目录整体移动后索引依然有效。
+const (
+	// metaIndexMagic meta.idx魔数 "FDMI"
+	metaIndexMagic uint32 = 0x46444D49
+	// metaIndexVersion meta.idx格式版本
+	metaIndexVersion uint16 = 1
+)
+
+var (
+	// ErrMetaIndexCorrupted 表示meta.idx文件已损坏
+	ErrMetaIndexCorrupted = fmt.Errorf("%w: 块映射索引", ErrCorrupted)
+
+	// metaIndexCRCTable CRC32-C校验表
+	metaIndexCRCTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// metaIndexEntry 块映射索引条目
+type metaIndexEntry struct {
+	ID   uint32
+	Size uint32
+	Path string
+}
+
+// encodeMetaIndex 将块映射条目编码为meta.idx格式
+func encodeMetaIndex(entries []metaIndexEntry) ([]byte, error) {
+	var buf bytes.Buffer
+
+	binary.Write(&buf, binary.BigEndian, metaIndexMagic)
+	binary.Write(&buf, binary.BigEndian, metaIndexVersion)
+	binary.Write(&buf, binary.BigEndian, uint16(0))
+	binary.Write(&buf, binary.BigEndian, uint32(len(entries)))
+
+	for _, entry := range entries {
+		if len(entry.Path) > 0xFFFF {
+			return nil, fmt.Errorf("块文件路径过长(ID=%d)", entry.ID)
+		}
+		binary.Write(&buf, binary.BigEndian, entry.ID)
+		binary.Write(&buf, binary.BigEndian, entry.Size)
+		binary.Write(&buf, binary.BigEndian, uint16(len(entry.Path)))
+		buf.WriteString(entry.Path)
+	}
+
+	checksum := crc32.Checksum(buf.Bytes(), metaIndexCRCTable)
+	binary.Write(&buf, binary.BigEndian, checksum)
+
+	return buf.Bytes(), nil
+}
+
+// decodeMetaIndex 解析meta.idx内容，校验失败时返回ErrMetaIndexCorrupted
+func decodeMetaIndex(data []byte) ([]metaIndexEntry, error) {
+	// 头部12字节 + 校验和4字节
+	if len(data) < 16 {
+		return nil, ErrMetaIndexCorrupted
+	}
+
+	body := data[:len(data)-4]
+	expected := binary.BigEndian.Uint32(data[len(data)-4:])
+	if crc32.Checksum(body, metaIndexCRCTable) != expected {
+		return nil, ErrMetaIndexCorrupted
+	}
+
+	r := bytes.NewReader(body)
+	var magic uint32
+	var version, reserved uint16
+	var count uint32
+	binary.Read(r, binary.BigEndian, &magic)
+	binary.Read(r, binary.BigEndian, &version)
+	binary.Read(r, binary.BigEndian, &reserved)
+	binary.Read(r, binary.BigEndian, &count)
+
+	if magic != metaIndexMagic {
+		return nil, ErrMetaIndexCorrupted
+	}
+	if version != metaIndexVersion {
+		return nil, fmt.Errorf("不支持的块映射索引版本: %d", version)
+	}
+
+	// 每个条目至少10字节，防止恶意的count导致过量分配
+	if uint64(count)*10 > uint64(r.Len()) {
+		return nil, ErrMetaIndexCorrupted
+	}
+
+	entries := make([]metaIndexEntry, 0, count)
+	for i := uint32(0); i < count; i++ {
+		var entry metaIndexEntry
+		var pathLen uint16
+		if err := binary.Read(r, binary.BigEndian, &entry.ID); err != nil {
+			return nil, ErrMetaIndexCorrupted
+		}
+		if err := binary.Read(r, binary.BigEndian, &entry.Size); err != nil {
+			return nil, ErrMetaIndexCorrupted
+		}
+		if err := binary.Read(r, binary.BigEndian, &pathLen); err != nil {
+			return nil, ErrMetaIndexCorrupted
+		}
+		path := make([]byte, pathLen)
+		if _, err := io.ReadFull(r, path); err != nil {
+			return nil, ErrMetaIndexCorrupted
+		}
+		entry.Path = string(path)
+		entries = append(entries, entry)
+	}
+
+	if r.Len() != 0 {
+		return nil, ErrMetaIndexCorrupted
+	}
+
+	return entries, nil
+}
+
+// writeFileAtomic 原子地写入文件：先写入同目录下的临时文件，再重命名覆盖目标文件
+// durable为true时在重命名前同步临时文件，并在重命名后同步目录
+func writeFileAtomic(fsys vfs.FS, path string, data []byte, perm os.FileMode, durable bool) error {
+	dir := filepath.Dir(path)
+	tmp, err := fsys.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	w := bufio.NewWriter(tmp)
+	if _, err := w.Write(data); err != nil {
+		tmp.Close()
+		fsys.Remove(tmpPath)
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		fsys.Remove(tmpPath)
+		return err
+	}
+	if durable {
+		if err := tmp.Sync(); err != nil {
+			tmp.Close()
+			fsys.Remove(tmpPath)
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		fsys.Remove(tmpPath)
+		return err
+	}
+	if err := fsys.Chmod(tmpPath, perm); err != nil {
+		fsys.Remove(tmpPath)
+		return err
+	}
+	if err := fsys.Rename(tmpPath, path); err != nil {
+		fsys.Remove(tmpPath)
+		return err
+	}
+
+	// 同步目录，确保重命名持久化
+	if durable {
+		syncPath(fsys, dir, true)
+	}
+
+	return nil
+}
+
+// loadMetaIndex 从meta.idx加载块映射
+// 索引缺失或损坏时不返回错误，而是标记为需要重建，由第一次访问时扫描块目录完成
+func (ds *DirectoryStorage) loadMetaIndex() error {
+	data, err := ds.fs.ReadFile(ds.MetaPath)
+	if os.IsNotExist(err) {
+		ds.needsRebuild = true
+		return nil
+	}
+	if err != nil {
+		logger.Error("读取块映射索引失败", "path", ds.MetaPath, "error", err)
+		return err
+	}
+
+	entries, err := decodeMetaIndex(data)
+	if err != nil {
+		logger.Warn("块映射索引无效，将通过扫描重建", "path", ds.MetaPath, "error", err)
+		ds.needsRebuild = true
+		return nil
+	}
+
+	ds.BlockMap = make(map[uint32]string, len(entries))
+	ds.Stats.TotalBlocks = 0
+	ds.Stats.UsedSpace = 0
+	for _, entry := range entries {
+		ds.BlockMap[entry.ID] = filepath.Join(ds.BlocksPath, filepath.FromSlash(entry.Path))
+		ds.Stats.TotalBlocks++
+		ds.Stats.UsedSpace += uint64(entry.Size)
+	}
+
+	return nil
+}
+
+// ensureBlockMap 确保块映射可用，必要时通过扫描块目录重建
+func (ds *DirectoryStorage) ensureBlockMap() error {
+	ds.mutex.RLock()
+	needsRebuild := ds.needsRebuild
+	ds.mutex.RUnlock()
+
+	if !needsRebuild {
+		return nil
+	}
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	if !ds.needsRebuild {
+		return nil
+	}
+	return ds.rebuildBlockMapLocked()
+}
+
+// RebuildBlockMap 扫描块目录重建块映射，并写入新的meta.idx
+func (ds *DirectoryStorage) RebuildBlockMap() error {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	return ds.rebuildBlockMapLocked()
+}
+
+// rebuildBlockMapLocked 扫描块目录重建块映射（调用方需持有写锁）
+func (ds *DirectoryStorage) rebuildBlockMapLocked() error {
+	files, err := scanBlockFiles(ds.fs, ds.BlocksPath)
+	if err != nil {
+		logger.Error("扫描块目录失败", "path", ds.BlocksPath, "error", err)
+		return err
+	}
+
+	ids := make([]uint32, 0, len(files))
+	for id := range files {
+		ids = append(ids, id)
+	}
+	sizes := ds.statBlockFiles(len(ids), func(i int) string { return files[ids[i]] })
+
+	ds.BlockMap = make(map[uint32]string, len(files))
+	ds.Stats.TotalBlocks = 0
+	ds.Stats.UsedSpace = 0
+	for i, id := range ids {
+		if sizes[i] < 0 {
+			continue
+		}
+		ds.BlockMap[id] = files[id]
+		ds.Stats.TotalBlocks++
+		ds.Stats.UsedSpace += uint64(sizes[i])
+	}
+	ds.recoverFromReplicasLocked()
+
+	ds.needsRebuild = false
+	ds.dirty = true
+
+	logger.Info("已通过扫描重建块映射", "path", ds.BlocksPath, "块数", len(ds.BlockMap))
+
+	return ds.flushLocked()
+}
+
+// statBlockFiles 通过共享工作池并行获取n个块文件的大小，无法访问的文件大小为-1
+func (ds *DirectoryStorage) statBlockFiles(n int, path func(i int) string) []int64 {
+	sizes := make([]int64, n)
+	ds.workers.Map(n, func(i int) error {
+		sizes[i] = -1
+		if info, err := ds.fs.Stat(path(i)); err == nil {
+			sizes[i] = info.Size()
+		}
+		return nil
+	})
+	return sizes
+}
+
+// markDirty 标记块映射已修改
+// 第一次修改时删除磁盘上的meta.idx，保证异常退出后重新打开时会通过扫描重建，
+// 而不是加载一份过期的映射
+func (ds *DirectoryStorage) markDirty() {
+	if ds.dirty {
+		return
+	}
+	ds.dirty = true
+
+	if err := ds.fs.Remove(ds.MetaPath); err != nil && !os.IsNotExist(err) {
+		logger.Warn("删除过期块映射索引失败", "path", ds.MetaPath, "error", err)
+	}
+}
+
+// Flush 将块映射持久化到meta.idx
+func (ds *DirectoryStorage) Flush() error {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	return ds.flushLocked()
+}
+
+// flushLocked 将块映射持久化到meta.idx（调用方需持有写锁）
+func (ds *DirectoryStorage) flushLocked() error {
+	if !ds.dirty || ds.needsRebuild {
+		return nil
+	}
+
+	entries := make([]metaIndexEntry, 0, len(ds.BlockMap))
+	paths := make([]string, 0, len(ds.BlockMap))
+	for id, path := range ds.BlockMap {
+		rel, err := filepath.Rel(ds.BlocksPath, path)
+		if err != nil {
+			logger.Error("计算块文件相对路径失败", "id", id, "error", err)
+			return err
+		}
+
+		entries = append(entries, metaIndexEntry{
+			ID:   id,
+			Path: filepath.ToSlash(rel),
+		})
+		paths = append(paths, path)
+	}
+
+	sizes := ds.statBlockFiles(len(paths), func(i int) string { return paths[i] })
+	for i := range entries {
+		if sizes[i] > 0 {
+			entries[i].Size = uint32(sizes[i])
+		}
+	}
+
+	// 按ID排序，保证相同内容生成相同的文件
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+
+	data, err := encodeMetaIndex(entries)
+	if err != nil {
+		logger.Error("编码块映射索引失败", "error", err)
+		return err
+	}
+
+	// 块文件先于引用它们的索引落盘
+	if ds.durability.syncOnFlush() {
+		if err := ds.syncBlocksLocked(); err != nil {
+			logger.Error("同步块文件失败", "error", err)
+			return err
+		}
+	}
+
+	if err := writeFileAtomic(ds.fs, ds.MetaPath, data, 0644, ds.durability.syncOnFlush()); err != nil {
+		logger.Error("写入块映射索引失败", "path", ds.MetaPath, "error", err)
+		return err
+	}
+
+	ds.dirty = false
+	return nil
+}
+
+// blockWritten 按持久化级别同步刚写入的块文件，或记录下来等待下次同步（调用方需持有写锁）
+func (ds *DirectoryStorage) blockWritten(path string) error {
+	switch {
+	case ds.durability.syncOnWrite():
+		if err := syncPath(ds.fs, path, false); err != nil {
+			logger.Error("同步块文件失败", "path", path, "error", err)
+			return err
+		}
+		return syncPath(ds.fs, filepath.Dir(path), true)
+	case ds.durability.syncOnFlush():
+		ds.unsynced[path] = struct{}{}
+	}
+	return nil
+}
+
+// syncBlocksLocked 同步上次同步后写入的块文件及其所在目录（调用方需持有写锁）
+func (ds *DirectoryStorage) syncBlocksLocked() error {
+	dirs := make(map[string]struct{})
+	for path := range ds.unsynced {
+		if err := syncPath(ds.fs, path, false); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		dirs[filepath.Dir(path)] = struct{}{}
+	}
+	for dir := range dirs {
+		syncPath(ds.fs, dir, true)
+	}
+	ds.unsynced = make(map[string]struct{})
+	return nil
+}
+
+// syncBlocks periodic级别的后台同步
+func (ds *DirectoryStorage) syncBlocks() error {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	return ds.syncBlocksLocked()
+}
+
+// Close 关闭目录存储，持久化块映射
+func (ds *DirectoryStorage) Close() error {
+	ds.StopReplicaRepair()
+	ds.durability.close()
+
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	// 文件描述符缓存可能被其他存储共享，只释放本存储的文件
+	for _, path := range ds.BlockMap {
+		ds.fdCache.Invalidate(path)
+	}
+	return ds.flushLocked()
+}
@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestDirectoryStoragePersistence 测试目录存储块映射的持久化与重建
+func TestDirectoryStoragePersistence(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "meta_index_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	config := &StorageConfig{Path: tempDir}
+
+	ds, err := NewDirectoryStorage(config)
+	if err != nil {
+		t.Fatalf("创建目录存储失败: %v", err)
+	}
+
+	blocks := map[uint32][]byte{
+		1:   []byte("first block"),
+		2:   bytes.Repeat([]byte{0xAB}, 4096),
+		100: []byte("block one hundred"),
+	}
+	for id, data := range blocks {
+		if err := ds.WriteBlock(id, data); err != nil {
+			t.Fatalf("写入块%d失败: %v", id, err)
+		}
+	}
+	if err := ds.Close(); err != nil {
+		t.Fatalf("关闭目录存储失败: %v", err)
+	}
+	if _, err := os.Stat(ds.MetaPath); err != nil {
+		t.Fatalf("关闭后meta.idx不存在: %v", err)
+	}
+
+	// 重新打开，应从meta.idx加载映射
+	verify := func(ds *DirectoryStorage) {
+		t.Helper()
+		for id, expected := range blocks {
+			data, err := ds.ReadBlock(id)
+			if err != nil {
+				t.Fatalf("读取块%d失败: %v", id, err)
+			}
+			if !bytes.Equal(data, expected) {
+				t.Errorf("块%d数据不匹配", id)
+			}
+		}
+		if ds.Stats.TotalBlocks != uint32(len(blocks)) {
+			t.Errorf("块数统计不正确: 期望%d, 实际%d", len(blocks), ds.Stats.TotalBlocks)
+		}
+	}
+
+	reopened, err := NewDirectoryStorage(config)
+	if err != nil {
+		t.Fatalf("重新打开目录存储失败: %v", err)
+	}
+	if reopened.needsRebuild {
+		t.Errorf("meta.idx有效时不应需要重建")
+	}
+	verify(reopened)
+
+	// 修改后未关闭（模拟崩溃），meta.idx应已失效
+	blocks[3] = []byte("written before crash")
+	if err := reopened.WriteBlock(3, blocks[3]); err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	if _, err := os.Stat(reopened.MetaPath); !os.IsNotExist(err) {
+		t.Errorf("修改后过期的meta.idx应被删除")
+	}
+
+	crashed, err := NewDirectoryStorage(config)
+	if err != nil {
+		t.Fatalf("崩溃后打开目录存储失败: %v", err)
+	}
+	if !crashed.needsRebuild {
+		t.Errorf("meta.idx缺失时应标记为需要重建")
+	}
+	verify(crashed)
+
+	// 损坏的meta.idx应触发重建
+	data, err := os.ReadFile(crashed.MetaPath)
+	if err != nil {
+		t.Fatalf("重建后meta.idx应被写入: %v", err)
+	}
+	data[len(data)/2] ^= 0xFF
+	if err := os.WriteFile(crashed.MetaPath, data, 0644); err != nil {
+		t.Fatalf("写入损坏的meta.idx失败: %v", err)
+	}
+
+	corrupted, err := NewDirectoryStorage(config)
+	if err != nil {
+		t.Fatalf("打开损坏索引的目录存储失败: %v", err)
+	}
+	if !corrupted.needsRebuild {
+		t.Errorf("meta.idx损坏时应标记为需要重建")
+	}
+	verify(corrupted)
+}
+
+// TestMetaIndexCodec 测试meta.idx编解码
+func TestMetaIndexCodec(t *testing.T) {
+	entries := []metaIndexEntry{
+		{ID: 1, Size: 10, Path: "ab/cd/00000001.blk"},
+		{ID: 0xFFFFFFFF, Size: 0, Path: "ffffffff.blk"},
+	}
+
+	data, err := encodeMetaIndex(entries)
+	if err != nil {
+		t.Fatalf("编码失败: %v", err)
+	}
+
+	decoded, err := decodeMetaIndex(data)
+	if err != nil {
+		t.Fatalf("解码失败: %v", err)
+	}
+	if len(decoded) != len(entries) {
+		t.Fatalf("条目数不匹配: 期望%d, 实际%d", len(entries), len(decoded))
+	}
+	for i := range entries {
+		if decoded[i] != entries[i] {
+			t.Errorf("条目%d不匹配: 期望%+v, 实际%+v", i, entries[i], decoded[i])
+		}
+	}
+
+	// 截断的数据应被识别为损坏
+	for _, n := range []int{0, 8, len(data) - 1} {
+		if _, err := decodeMetaIndex(data[:n]); err == nil {
+			t.Errorf("截断到%d字节的数据应解码失败", n)
+		}
+	}
+}
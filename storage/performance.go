@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"github.com/bpfs/fragmenta/config"
+	"github.com/bpfs/fragmenta/throttle"
+)
+
+// PerformanceResources 按config.Performance创建、可由多个存储实例共享的资源
+// 实现config.ConfigChangeListener，注册到DynamicConfigManager后配置变更会即时生效。
+type PerformanceResources struct {
+	Workers  *WorkerPool
+	FDCache  *FDCache
+	Throttle *throttle.Limiter
+}
+
+// NewPerformanceResources 根据性能配置创建共享资源
+func NewPerformanceResources(cfg config.PerformanceConfig) *PerformanceResources {
+	return &PerformanceResources{
+		Workers:  NewWorkerPool(cfg.Parallelism.MaxWorkers, cfg.Parallelism.WorkQueueLength),
+		FDCache:  NewFDCache(cfg.IO.FDCacheSize),
+		Throttle: cfg.Throttle.NewLimiter(),
+	}
+}
+
+// Configure 让存储配置使用这些共享资源
+func (r *PerformanceResources) Configure(storageConfig *StorageConfig) {
+	storageConfig.Workers = r.Workers
+	storageConfig.FDCache = r.FDCache
+	storageConfig.BackgroundThrottle = r.Throttle
+}
+
+// OnConfigChange 按新配置调整工作池、文件描述符缓存和限速器
+func (r *PerformanceResources) OnConfigChange(oldConfig, newConfig *config.Config) {
+	if newConfig == nil {
+		return
+	}
+	perf := newConfig.Performance
+
+	r.Workers.Resize(perf.Parallelism.MaxWorkers, perf.Parallelism.WorkQueueLength)
+	r.FDCache.Resize(perf.IO.FDCacheSize)
+	r.Throttle.SetLimits(perf.Throttle.BackgroundBytesPerSecond, perf.Throttle.BackgroundIOPS)
+
+	logger.Debug("已应用性能配置",
+		"maxWorkers", perf.Parallelism.MaxWorkers,
+		"workQueueLength", perf.Parallelism.WorkQueueLength,
+		"fdCacheSize", perf.IO.FDCacheSize)
+}
+
+// Close 关闭工作池和文件描述符缓存，调用前应先关闭使用它们的存储
+func (r *PerformanceResources) Close() error {
+	r.Workers.Close()
+	return r.FDCache.Close()
+}
@@ -0,0 +1,174 @@
+// package storage 提供访问历史导出与基于外部评分的放置策略
+package storage
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// AccessHistoryEntry 访问历史数据集中的一条样本
+type AccessHistoryEntry struct {
+	// BlockKey 块的键
+	BlockKey string
+	// AccessCount 访问次数
+	AccessCount int
+	// FirstAccessTime 首次访问时间
+	FirstAccessTime time.Time
+	// LastAccessTime 最后访问时间
+	LastAccessTime time.Time
+	// AgeSeconds 导出时距首次访问的秒数
+	AgeSeconds float64
+	// RecencySeconds 导出时距最后访问的秒数
+	RecencySeconds float64
+	// Size 块大小
+	Size int64
+	// Location 当前存储位置
+	Location StorageLocation
+	// HourOfWeekCounts 按一周中的小时统计的访问次数
+	HourOfWeekCounts [HoursPerWeek]uint32
+}
+
+// ExportHistory 导出所有块的访问历史，按块键排序
+func (at *AccessTracker) ExportHistory() []AccessHistoryEntry {
+	at.mutex.RLock()
+	defer at.mutex.RUnlock()
+
+	now := at.config.now()
+	entries := make([]AccessHistoryEntry, 0, len(at.records))
+	for _, record := range at.records {
+		entries = append(entries, AccessHistoryEntry{
+			BlockKey:         record.BlockKey,
+			AccessCount:      record.AccessCount,
+			FirstAccessTime:  record.FirstAccessTime,
+			LastAccessTime:   record.LastAccessTime,
+			AgeSeconds:       now.Sub(record.FirstAccessTime).Seconds(),
+			RecencySeconds:   now.Sub(record.LastAccessTime).Seconds(),
+			Size:             record.Size,
+			Location:         record.CurrentLocation,
+			HourOfWeekCounts: record.HourOfWeekCounts,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].BlockKey < entries[j].BlockKey
+	})
+
+	return entries
+}
+
+// WriteAccessHistoryCSV 以CSV格式写出访问历史数据集
+// 列依次为: block_key, access_count, first_access, last_access, age_seconds,
+// recency_seconds, size, location, h0 ... h167
+func WriteAccessHistoryCSV(w io.Writer, entries []AccessHistoryEntry) error {
+	cw := csv.NewWriter(w)
+
+	header := []string{"block_key", "access_count", "first_access", "last_access",
+		"age_seconds", "recency_seconds", "size", "location"}
+	for h := 0; h < HoursPerWeek; h++ {
+		header = append(header, "h"+strconv.Itoa(h))
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	row := make([]string, 0, len(header))
+	for _, entry := range entries {
+		row = row[:0]
+		row = append(row,
+			entry.BlockKey,
+			strconv.Itoa(entry.AccessCount),
+			entry.FirstAccessTime.UTC().Format(time.RFC3339),
+			entry.LastAccessTime.UTC().Format(time.RFC3339),
+			strconv.FormatFloat(entry.AgeSeconds, 'f', 0, 64),
+			strconv.FormatFloat(entry.RecencySeconds, 'f', 0, 64),
+			strconv.FormatInt(entry.Size, 10),
+			entry.Location.String(),
+		)
+		for _, count := range entry.HourOfWeekCounts {
+			row = append(row, strconv.FormatUint(uint64(count), 10))
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// PlacementScores 各存储位置的评分，分数越高越适合
+type PlacementScores map[StorageLocation]float64
+
+// PlacementScorer 外部评分回调，例如调用离线训练的模型
+// 返回ok为false时表示无法给出评分，由回退策略决定
+type PlacementScorer func(blockKey string, size int64, accessRecord *BlockAccessRecord) (scores PlacementScores, ok bool)
+
+// ScoredStrategy 基于外部评分的放置策略
+type ScoredStrategy struct {
+	config   *StrategyConfig
+	scorer   PlacementScorer
+	fallback StorageStrategy
+}
+
+// NewScoredStrategy 创建基于外部评分的放置策略
+// fallback 在评分回调无法给出结果时使用，为nil时使用自适应策略
+func NewScoredStrategy(config *StrategyConfig, scorer PlacementScorer, fallback StorageStrategy) *ScoredStrategy {
+	if fallback == nil {
+		fallback = NewAdaptiveStrategy(config)
+	}
+	return &ScoredStrategy{
+		config:   config,
+		scorer:   scorer,
+		fallback: fallback,
+	}
+}
+
+// DecideLocation 决定块的存储位置
+// 选择评分最高的位置；超过内联阈值的块不会被放入内联存储
+func (s *ScoredStrategy) DecideLocation(blockKey string, size int64, accessRecord *BlockAccessRecord) StorageDecision {
+	scores, ok := s.scorer(blockKey, size, accessRecord)
+	if !ok || len(scores) == 0 {
+		return s.fallback.DecideLocation(blockKey, size, accessRecord)
+	}
+
+	best := StorageLocation(-1)
+	var bestScore float64
+	// 按固定顺序遍历，分数相同时结果稳定
+	for _, location := range []StorageLocation{LocationInline, LocationContainer, LocationDirectory} {
+		score, exists := scores[location]
+		if !exists {
+			continue
+		}
+		if location == LocationInline && size > s.config.InlineThreshold {
+			continue
+		}
+		if best < 0 || score > bestScore {
+			best = location
+			bestScore = score
+		}
+	}
+
+	if best < 0 {
+		return s.fallback.DecideLocation(blockKey, size, accessRecord)
+	}
+
+	return StorageDecision{
+		Location: best,
+		Reason:   fmt.Sprintf("外部评分选择%s(score=%.3f)", best, bestScore),
+		Score:    bestScore,
+	}
+}
+
+// AnalyzeDistribution 分析存储分布情况，委托给回退策略
+func (s *ScoredStrategy) AnalyzeDistribution(tracker *AccessTracker) *DistributionAnalysis {
+	return s.fallback.AnalyzeDistribution(tracker)
+}
+
+// Name 返回策略名称
+func (s *ScoredStrategy) Name() string {
+	return "scored"
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"testing"
+)
+
+// TestAccessHistoryExport 测试访问历史数据集导出
+func TestAccessHistoryExport(t *testing.T) {
+	tracker := NewAccessTracker(NewDefaultStrategyConfig())
+	tracker.RecordAccess("b", 2048, LocationContainer)
+	tracker.RecordAccess("a", 100, LocationInline)
+	tracker.RecordAccess("b", 0, LocationContainer)
+
+	entries := tracker.ExportHistory()
+	if len(entries) != 2 {
+		t.Fatalf("导出条目数不正确: 期望2, 实际%d", len(entries))
+	}
+	if entries[0].BlockKey != "a" || entries[1].BlockKey != "b" {
+		t.Errorf("导出条目应按块键排序")
+	}
+
+	b := entries[1]
+	if b.AccessCount != 2 || b.Size != 2048 || b.Location != LocationContainer {
+		t.Errorf("条目内容不正确: %+v", b)
+	}
+	var total uint32
+	for _, count := range b.HourOfWeekCounts {
+		total += count
+	}
+	if total != 2 {
+		t.Errorf("按小时统计的访问次数之和应为2, 实际%d", total)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteAccessHistoryCSV(&buf, entries); err != nil {
+		t.Fatalf("写出CSV失败: %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("解析CSV失败: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("CSV行数不正确: 期望3, 实际%d", len(rows))
+	}
+	if len(rows[0]) != 8+HoursPerWeek {
+		t.Errorf("CSV列数不正确: %d", len(rows[0]))
+	}
+	if rows[2][0] != "b" || rows[2][1] != "2" || rows[2][7] != "Container" {
+		t.Errorf("CSV数据行不正确: %v", rows[2][:8])
+	}
+}
+
+// TestScoredStrategy 测试基于外部评分的放置策略
+func TestScoredStrategy(t *testing.T) {
+	config := NewDefaultStrategyConfig()
+	config.StrategyName = "scored"
+
+	// 没有评分回调时工厂应返回错误
+	factory := &StorageStrategyFactory{}
+	if _, err := factory.CreateStrategy(config); err == nil {
+		t.Errorf("缺少评分回调时应返回错误")
+	}
+
+	config.Scorer = func(blockKey string, size int64, record *BlockAccessRecord) (PlacementScores, bool) {
+		switch blockKey {
+		case "prefer-inline":
+			return PlacementScores{LocationInline: 0.9, LocationContainer: 0.5}, true
+		case "prefer-directory":
+			return PlacementScores{LocationContainer: 0.2, LocationDirectory: 0.8}, true
+		default:
+			return nil, false
+		}
+	}
+	strategy, err := factory.CreateStrategy(config)
+	if err != nil {
+		t.Fatalf("创建策略失败: %v", err)
+	}
+
+	if d := strategy.DecideLocation("prefer-directory", 4096, nil); d.Location != LocationDirectory || d.Score != 0.8 {
+		t.Errorf("应选择评分最高的目录存储, 实际%v(%.2f)", d.Location, d.Score)
+	}
+	// 超过内联阈值的块不能放入内联存储
+	if d := strategy.DecideLocation("prefer-inline", 4096, nil); d.Location != LocationContainer {
+		t.Errorf("超过内联阈值时应选择次优位置, 实际%v", d.Location)
+	}
+	if d := strategy.DecideLocation("prefer-inline", 100, nil); d.Location != LocationInline {
+		t.Errorf("未超过内联阈值时应选择内联存储, 实际%v", d.Location)
+	}
+	// 无评分时使用回退策略
+	if d := strategy.DecideLocation("unknown", 2*1024*1024, nil); d.Location != LocationDirectory {
+		t.Errorf("无评分时应使用回退策略, 实际%v", d.Location)
+	}
+}
+
+// TestHybridStorageScoredRebalance 测试混合存储使用外部评分进行重平衡
+func TestHybridStorageScoredRebalance(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "hybrid_scored_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var scorer PlacementScorer = func(blockKey string, size int64, record *BlockAccessRecord) (PlacementScores, bool) {
+		return PlacementScores{LocationDirectory: 1}, true
+	}
+
+	hs, err := NewHybridStorage(&StorageConfig{
+		Type:              StorageTypeHybrid,
+		Path:              tempDir,
+		InlineThreshold:   1024,
+		StrategyName:      "scored",
+		StrategyParams:    map[string]interface{}{"scorer": scorer},
+		HotBlockThreshold: 1,
+	})
+	if err != nil {
+		t.Fatalf("初始化混合存储失败: %v", err)
+	}
+	defer hs.Close()
+
+	if err := hs.WriteBlock("block", make([]byte, 8*1024)); err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+
+	report, err := hs.Rebalance()
+	if err != nil {
+		t.Fatalf("重平衡失败: %v", err)
+	}
+	if len(report.Moves) != 1 || report.Moves[0].To != LocationDirectory {
+		t.Fatalf("应根据外部评分迁移到目录存储: %+v", report.Moves)
+	}
+
+	history := hs.ExportAccessHistory()
+	if len(history) != 1 || history[0].Location != LocationDirectory {
+		t.Errorf("导出的访问历史应反映迁移后的位置: %+v", history)
+	}
+
+	if err := hs.SetStorageStrategy(nil); err == nil {
+		t.Errorf("设置空策略应返回错误")
+	}
+}
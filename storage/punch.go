@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"errors"
+	"os"
+)
+
+// defaultHolePunchThreshold 默认的打洞阈值，释放容量不小于该值的记录时立即归还磁盘空间
+const defaultHolePunchThreshold = 64 << 10
+
+// holeAlignment 打洞范围对齐的文件系统块大小，不足一个块的部分只会被清零，不会释放空间
+const holeAlignment = 4096
+
+// errHolePunchUnsupported 平台或文件系统不支持打洞
+var errHolePunchUnsupported = errors.New("hole punching not supported")
+
+// holeRange 把[offset, offset+length)向内对齐到holeAlignment，范围不足一个块时返回length为0
+func holeRange(offset, length uint64) (uint64, uint64) {
+	start := (offset + holeAlignment - 1) / holeAlignment * holeAlignment
+	end := (offset + length) / holeAlignment * holeAlignment
+	if end <= start {
+		return start, 0
+	}
+	return start, end - start
+}
+
+// punchFreedRecord 释放空闲记录数据部分占用的磁盘空间，记录头保留以便扫描重建
+// 不支持打洞时关闭该功能，空间等待整理时回收；打洞失败不影响删除结果
+func (cs *ContainerStorage) punchFreedRecord(offset uint64, capacity uint32) {
+	if !cs.holePunch || capacity < cs.holePunchThreshold || offset >= cs.dataEnd {
+		return
+	}
+
+	start, length := holeRange(offset+recordHeaderSize, uint64(capacity))
+	if length == 0 {
+		return
+	}
+
+	// 注入的文件系统（见 StorageConfig.FS）中的文件不支持打洞
+	err := errHolePunchUnsupported
+	if file, ok := cs.File.(*os.File); ok {
+		err = punchHole(file, int64(start), int64(length))
+	}
+	switch {
+	case err == nil:
+		cs.Stats.HolePunchedBytes += length
+	case errors.Is(err, errHolePunchUnsupported):
+		logger.Debug("文件系统不支持打洞，删除的空间将在整理时回收", "path", cs.Path)
+		cs.holePunch = false
+	default:
+		logger.Warn("释放磁盘空间失败", "offset", start, "length", length, "error", err)
+	}
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// fcntlPunchHole fcntl的F_PUNCHHOLE命令
+const fcntlPunchHole = 99
+
+// fpunchhole F_PUNCHHOLE的参数
+type fpunchhole struct {
+	flags    uint32
+	reserved uint32
+	offset   int64
+	length   int64
+}
+
+// punchHole 使用fcntl(F_PUNCHHOLE)释放文件中的一段空间（APFS），文件大小不变
+func punchHole(file *os.File, offset, length int64) error {
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	arg := fpunchhole{offset: offset, length: length}
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_FCNTL, fd, fcntlPunchHole, uintptr(unsafe.Pointer(&arg)))
+	})
+	if err != nil {
+		return err
+	}
+
+	switch errno {
+	case 0:
+		return nil
+	case syscall.ENOTSUP, syscall.EINVAL:
+		// HFS+等文件系统不支持F_PUNCHHOLE
+		return errHolePunchUnsupported
+	}
+	return errno
+}
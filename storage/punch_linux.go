@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"os"
+	"syscall"
+)
+
+// fallocate模式标志
+const (
+	fallocKeepSize  = 0x01 // FALLOC_FL_KEEP_SIZE
+	fallocPunchHole = 0x02 // FALLOC_FL_PUNCH_HOLE
+)
+
+// punchHole 使用fallocate(FALLOC_FL_PUNCH_HOLE)释放文件中的一段空间，文件大小不变
+func punchHole(file *os.File, offset, length int64) error {
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var punchErr error
+	err = conn.Control(func(fd uintptr) {
+		punchErr = syscall.Fallocate(int(fd), fallocPunchHole|fallocKeepSize, offset, length)
+	})
+	if err != nil {
+		return err
+	}
+
+	switch punchErr {
+	case syscall.EOPNOTSUPP, syscall.ENOSYS:
+		return errHolePunchUnsupported
+	}
+	return punchErr
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// allocatedBytes 返回文件实际占用的磁盘空间
+func allocatedBytes(t *testing.T, path string) int64 {
+	t.Helper()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("获取文件信息失败: %v", err)
+	}
+	return info.Sys().(*syscall.Stat_t).Blocks * 512
+}
+
+// TestContainerHolePunch 测试删除大块时立即释放磁盘空间，文件大小和其他块不受影响
+func TestContainerHolePunch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "punch.container")
+	cs, err := NewContainerStorage(&StorageConfig{Path: path})
+	if err != nil {
+		t.Fatalf("创建容器存储失败: %v", err)
+	}
+	defer cs.Close()
+
+	large := bytes.Repeat([]byte{0xAB}, 1<<20)
+	tail := []byte("tail block")
+	if err := cs.WriteBlock(1, large); err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	if err := cs.WriteBlock(2, tail); err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	if err := cs.File.Sync(); err != nil {
+		t.Fatalf("同步文件失败: %v", err)
+	}
+
+	sizeBefore := cs.Stats.TotalSize
+	allocatedBefore := allocatedBytes(t, path)
+
+	if err := cs.DeleteBlock(1); err != nil {
+		t.Fatalf("删除块失败: %v", err)
+	}
+	if !cs.holePunch {
+		t.Skip("文件系统不支持打洞")
+	}
+
+	if cs.Stats.HolePunchedBytes < 1<<20-2*holeAlignment {
+		t.Errorf("打洞字节数不正确: %d", cs.Stats.HolePunchedBytes)
+	}
+	if cs.Stats.TotalSize != sizeBefore {
+		t.Errorf("打洞不应改变数据区大小: %d -> %d", sizeBefore, cs.Stats.TotalSize)
+	}
+	if allocated := allocatedBytes(t, path); allocatedBefore-allocated < 1<<19 {
+		t.Errorf("磁盘占用应减少: %d -> %d", allocatedBefore, allocated)
+	}
+
+	if data, err := cs.ReadBlock(2); err != nil || !bytes.Equal(data, tail) {
+		t.Errorf("相邻块应不受影响: %q, %v", data, err)
+	}
+
+	// 打洞后的空闲区可以重新分配
+	if err := cs.WriteBlock(3, large[:4096]); err != nil {
+		t.Fatalf("重用空闲区失败: %v", err)
+	}
+	if data, err := cs.ReadBlock(3); err != nil || !bytes.Equal(data, large[:4096]) {
+		t.Errorf("重用空闲区的数据不正确: %v", err)
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !windows
+
+package storage
+
+import "os"
+
+// punchHole 当前平台不支持打洞，删除的空间在整理时回收
+func punchHole(file *os.File, offset, length int64) error {
+	return errHolePunchUnsupported
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// DeviceIoControl控制码
+const (
+	fsctlSetSparse   = 0x000900C4 // FSCTL_SET_SPARSE
+	fsctlSetZeroData = 0x000980C8 // FSCTL_SET_ZERO_DATA
+)
+
+// errorInvalidFunction 文件系统不支持该控制码（如FAT32）
+const errorInvalidFunction syscall.Errno = 1
+
+// fileZeroDataInformation FSCTL_SET_ZERO_DATA的参数
+type fileZeroDataInformation struct {
+	fileOffset      int64
+	beyondFinalZero int64
+}
+
+// punchHole 把文件设为稀疏文件并用FSCTL_SET_ZERO_DATA释放一段空间（NTFS、ReFS），文件大小不变
+func punchHole(file *os.File, offset, length int64) error {
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var punchErr error
+	err = conn.Control(func(fd uintptr) {
+		handle := syscall.Handle(fd)
+		var returned uint32
+		if punchErr = syscall.DeviceIoControl(handle, fsctlSetSparse, nil, 0, nil, 0, &returned, nil); punchErr != nil {
+			return
+		}
+		info := fileZeroDataInformation{fileOffset: offset, beyondFinalZero: offset + length}
+		punchErr = syscall.DeviceIoControl(handle, fsctlSetZeroData,
+			(*byte)(unsafe.Pointer(&info)), uint32(unsafe.Sizeof(info)), nil, 0, &returned, nil)
+	})
+	if err != nil {
+		return err
+	}
+
+	if punchErr == errorInvalidFunction {
+		return errHolePunchUnsupported
+	}
+	return punchErr
+}
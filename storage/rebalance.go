@@ -0,0 +1,287 @@
+// package storage 提供混合存储的后台重平衡
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+)
+
+const (
+	// DefaultRebalanceInterval 默认的重平衡间隔
+	DefaultRebalanceInterval = 5 * time.Minute
+	// DefaultRebalanceMaxMoves 默认每轮最多迁移的块数
+	DefaultRebalanceMaxMoves = 100
+	// DefaultRebalanceMaxBytes 默认每轮最多迁移的字节数
+	DefaultRebalanceMaxBytes int64 = 64 * 1024 * 1024
+)
+
+// BlockMove 一次块迁移的记录
+type BlockMove struct {
+	BlockKey string
+	From     StorageLocation
+	To       StorageLocation
+	Size     int64
+	Reason   string
+}
+
+// RebalanceReport 一轮重平衡的结果
+type RebalanceReport struct {
+	// StartTime 开始时间
+	StartTime time.Time
+	// Duration 用时
+	Duration time.Duration
+	// Candidates 参与评估的热块和冷块数量
+	Candidates int
+	// Moves 实际完成的迁移
+	Moves []BlockMove
+	// MovedBytes 迁移的总字节数
+	MovedBytes int64
+	// Deferred 因速率限制或停止推迟到下一轮的迁移数量
+	Deferred int
+	// Errors 迁移过程中的错误
+	Errors []error
+}
+
+// rebalanceLimits 返回每轮迁移的块数和字节数上限
+func (hs *HybridStorage) rebalanceLimits() (int, int64) {
+	maxMoves := hs.Config.RebalanceMaxMoves
+	if maxMoves <= 0 {
+		maxMoves = DefaultRebalanceMaxMoves
+	}
+	maxBytes := hs.Config.RebalanceMaxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultRebalanceMaxBytes
+	}
+	return maxMoves, maxBytes
+}
+
+// StartAutoRebalance 启动后台重平衡协程，按指定间隔执行Rebalance
+// interval 不大于0时使用配置中的间隔，未配置时使用DefaultRebalanceInterval
+func (hs *HybridStorage) StartAutoRebalance(interval time.Duration) {
+	if interval <= 0 {
+		interval = hs.Config.RebalanceInterval
+	}
+	if interval <= 0 {
+		interval = DefaultRebalanceInterval
+	}
+
+	hs.rebalanceMutex.Lock()
+	defer hs.rebalanceMutex.Unlock()
+
+	if hs.rebalanceStopCh != nil {
+		return
+	}
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	hs.rebalanceStopCh = stopCh
+	hs.rebalanceDoneCh = doneCh
+
+	go hs.autoRebalanceLoop(interval, stopCh, doneCh)
+
+	logger.Info("已启动混合存储后台重平衡", "interval", interval)
+}
+
+// StopAutoRebalance 停止后台重平衡协程，并等待正在进行的一轮结束
+func (hs *HybridStorage) StopAutoRebalance() {
+	hs.rebalanceMutex.Lock()
+	stopCh := hs.rebalanceStopCh
+	doneCh := hs.rebalanceDoneCh
+	hs.rebalanceStopCh = nil
+	hs.rebalanceDoneCh = nil
+	hs.rebalanceMutex.Unlock()
+
+	if stopCh == nil {
+		return
+	}
+
+	close(stopCh)
+	<-doneCh
+}
+
+// autoRebalanceLoop 后台重平衡循环
+func (hs *HybridStorage) autoRebalanceLoop(interval time.Duration, stopCh <-chan struct{}, doneCh chan<- struct{}) {
+	defer close(doneCh)
+
+	// 停止时取消正在进行的一轮，避免在限速等待中阻塞
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := clock.OrSystem(hs.Config.Clock).NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			if _, err := hs.rebalance(ctx); err != nil {
+				logger.Error("后台重平衡失败", "error", err)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// GetLastRebalanceReport 获取最近一轮重平衡的结果，尚未执行过时返回nil
+func (hs *HybridStorage) GetLastRebalanceReport() *RebalanceReport {
+	hs.rebalanceMutex.Lock()
+	defer hs.rebalanceMutex.Unlock()
+
+	return hs.lastRebalance
+}
+
+// Rebalance 执行一轮重平衡
+// 对访问跟踪器中的热块和冷块调用存储策略的DecideLocation，
+// 将位置与决策不一致的块迁移到新位置。每轮迁移的块数和字节数受配置限制，
+// 超出限制的迁移推迟到下一轮。迁移的数据量计入配置的BackgroundThrottle。
+func (hs *HybridStorage) Rebalance() (*RebalanceReport, error) {
+	return hs.rebalance(context.Background())
+}
+
+// rebalance 执行一轮重平衡，ctx取消时剩余的迁移推迟到下一轮
+func (hs *HybridStorage) rebalance(ctx context.Context) (*RebalanceReport, error) {
+	report := &RebalanceReport{StartTime: clock.OrSystem(hs.Config.Clock).Now()}
+	maxMoves, maxBytes := hs.rebalanceLimits()
+
+	// 刷新热块和冷块集合，长时间未访问的块也能被识别为冷块
+	hs.tracker.RefreshStatus()
+
+	hot := hs.tracker.GetHotBlocks()
+	cold := hs.tracker.GetColdBlocks()
+	sort.Strings(hot)
+	sort.Strings(cold)
+	candidates := append(hot, cold...)
+	report.Candidates = len(candidates)
+	strategy := hs.currentStrategy()
+
+	for _, blockKey := range candidates {
+		record := hs.tracker.GetBlockAccessRecord(blockKey)
+		if record == nil || hs.isPinned(blockKey) {
+			continue
+		}
+
+		decision := strategy.DecideLocation(blockKey, record.Size, record)
+		if decision.Location == record.CurrentLocation {
+			continue
+		}
+
+		// 速率限制
+		if len(report.Moves) >= maxMoves || report.MovedBytes+record.Size > maxBytes {
+			report.Deferred++
+			continue
+		}
+		// 读旧位置和写新位置各计一次
+		if err := hs.Config.BackgroundThrottle.Wait(ctx, 2*record.Size); err != nil {
+			report.Deferred++
+			continue
+		}
+
+		size, err := hs.migrateBlock(blockKey, record.CurrentLocation, decision.Location)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("迁移块%s失败: %w", blockKey, err))
+			continue
+		}
+
+		move := BlockMove{
+			BlockKey: blockKey,
+			From:     record.CurrentLocation,
+			To:       decision.Location,
+			Size:     size,
+			Reason:   decision.Reason,
+		}
+		report.Moves = append(report.Moves, move)
+		report.MovedBytes += size
+
+		logger.Debug("重平衡迁移块", "key", blockKey, "from", move.From, "to", move.To, "reason", move.Reason)
+	}
+
+	report.Duration = clock.OrSystem(hs.Config.Clock).Since(report.StartTime)
+
+	hs.rebalanceMutex.Lock()
+	hs.lastRebalance = report
+	hs.rebalanceMutex.Unlock()
+
+	if len(report.Moves) > 0 || len(report.Errors) > 0 || report.Deferred > 0 {
+		logger.Info("混合存储重平衡完成",
+			"候选", report.Candidates,
+			"迁移", len(report.Moves),
+			"字节", report.MovedBytes,
+			"推迟", report.Deferred,
+			"错误", len(report.Errors),
+			"用时", report.Duration)
+	}
+
+	return report, nil
+}
+
+// migrateBlock 将块的原始数据（可能已加密）从一个存储位置移动到另一个位置，返回数据大小
+func (hs *HybridStorage) migrateBlock(blockKey string, from, to StorageLocation) (int64, error) {
+	hs.mutex.Lock()
+	defer hs.mutex.Unlock()
+
+	id := stringToID(blockKey)
+
+	var data []byte
+	var err error
+	switch from {
+	case LocationInline:
+		var ok bool
+		if data, ok = hs.InlineBlocks[blockKey]; !ok {
+			err = ErrBlockNotFound
+		}
+	case LocationContainer:
+		data, err = hs.Container.ReadBlock(id)
+	case LocationDirectory:
+		data, err = hs.Directory.ReadBlock(id)
+	default:
+		err = fmt.Errorf("未知的存储位置: %v", from)
+	}
+	if err != nil {
+		if err == ErrBlockNotFound {
+			// 块已被删除或覆盖，访问记录已过期
+			hs.tracker.RemoveRecord(blockKey)
+		}
+		return 0, err
+	}
+
+	// 先写入新位置，再删除旧位置，避免中途失败导致数据丢失
+	switch to {
+	case LocationInline:
+		hs.InlineBlocks[blockKey] = data
+	case LocationContainer:
+		err = hs.Container.WriteBlock(id, data)
+	case LocationDirectory:
+		err = hs.Directory.WriteBlock(id, data)
+	default:
+		err = fmt.Errorf("未知的存储位置: %v", to)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	switch from {
+	case LocationInline:
+		delete(hs.InlineBlocks, blockKey)
+	case LocationContainer:
+		err = hs.Container.DeleteBlock(id)
+	case LocationDirectory:
+		err = hs.Directory.DeleteBlock(id)
+	}
+	if err != nil {
+		logger.Warn("删除迁移前的块失败", "key", blockKey, "location", from, "error", err)
+	}
+
+	hs.tracker.UpdateLocation(blockKey, to)
+	return int64(len(data)), nil
+}
@@ -0,0 +1,241 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+	"github.com/bpfs/fragmenta/throttle"
+	"github.com/bpfs/fragmenta/vfs"
+)
+
+// TestHybridStorageRebalance 测试混合存储重平衡与速率限制
+func TestHybridStorageRebalance(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "hybrid_rebalance_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// 简单策略会把所有超过内联阈值的块放入目录存储
+	hs, err := NewHybridStorage(&StorageConfig{
+		Type:              StorageTypeHybrid,
+		Path:              tempDir,
+		InlineThreshold:   1024,
+		StrategyName:      "simple",
+		HotBlockThreshold: 2,
+		RebalanceMaxMoves: 1,
+	})
+	if err != nil {
+		t.Fatalf("初始化混合存储失败: %v", err)
+	}
+	defer hs.Close()
+
+	blocks := map[string][]byte{
+		"block-a": bytes.Repeat([]byte{0xAA}, 64*1024),
+		"block-b": bytes.Repeat([]byte{0xBB}, 32*1024),
+	}
+	for key, data := range blocks {
+		if err := hs.WriteBlock(key, data); err != nil {
+			t.Fatalf("写入块%s失败: %v", key, err)
+		}
+		if _, location, _ := hs.GetBlockInfo(key); location != StorageTypeContainer {
+			t.Fatalf("块%s应写入容器存储, 实际%v", key, location)
+		}
+		// 多次读取使其成为热块
+		for i := 0; i < 2; i++ {
+			if _, err := hs.ReadBlock(key); err != nil {
+				t.Fatalf("读取块%s失败: %v", key, err)
+			}
+		}
+	}
+
+	// 第一轮受速率限制只迁移一个块
+	report, err := hs.Rebalance()
+	if err != nil {
+		t.Fatalf("重平衡失败: %v", err)
+	}
+	if len(report.Moves) != 1 || report.Deferred != 1 {
+		t.Fatalf("第一轮应迁移1个块并推迟1个, 实际迁移%d, 推迟%d", len(report.Moves), report.Deferred)
+	}
+	if report.Moves[0].From != LocationContainer || report.Moves[0].To != LocationDirectory {
+		t.Errorf("迁移方向不正确: %v -> %v", report.Moves[0].From, report.Moves[0].To)
+	}
+
+	// 第二轮迁移剩余的块
+	report, err = hs.Rebalance()
+	if err != nil {
+		t.Fatalf("重平衡失败: %v", err)
+	}
+	if len(report.Moves) != 1 || report.Deferred != 0 {
+		t.Fatalf("第二轮应迁移1个块, 实际迁移%d, 推迟%d", len(report.Moves), report.Deferred)
+	}
+	if hs.GetLastRebalanceReport() != report {
+		t.Errorf("最近一轮的报告不正确")
+	}
+
+	for key, expected := range blocks {
+		if _, location, _ := hs.GetBlockInfo(key); location != StorageTypeDirectory {
+			t.Errorf("块%s应已迁移到目录存储, 实际%v", key, location)
+		}
+		data, err := hs.ReadBlock(key)
+		if err != nil {
+			t.Fatalf("读取迁移后的块%s失败: %v", key, err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Errorf("迁移后块%s数据不匹配", key)
+		}
+	}
+
+	analysis := hs.GetStorageDistributionAnalysis()
+	if analysis.DirectoryBlocks != 2 {
+		t.Errorf("分布分析应反映迁移结果: 目录块%d", analysis.DirectoryBlocks)
+	}
+
+	// 位置已符合策略时不再迁移
+	report, _ = hs.Rebalance()
+	if len(report.Moves) != 0 {
+		t.Errorf("已平衡时不应迁移, 实际迁移%d", len(report.Moves))
+	}
+}
+
+// TestHybridStorageAutoRebalance 测试后台重平衡的启动与停止
+func TestHybridStorageAutoRebalance(t *testing.T) {
+	tempDir, err := os.MkdirTemp("", "hybrid_auto_rebalance_test")
+	if err != nil {
+		t.Fatalf("创建临时目录失败: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	hs, err := NewHybridStorage(&StorageConfig{
+		Type:               StorageTypeHybrid,
+		Path:               tempDir,
+		InlineThreshold:    1024,
+		StrategyName:       "simple",
+		HotBlockThreshold:  1,
+		AutoBalanceEnabled: true,
+		RebalanceInterval:  10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("初始化混合存储失败: %v", err)
+	}
+
+	if err := hs.WriteBlock("hot", make([]byte, 8*1024)); err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, location, _ := hs.GetBlockInfo("hot"); location == StorageTypeDirectory {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("后台重平衡未在规定时间内迁移块")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := hs.Close(); err != nil {
+		t.Fatalf("关闭混合存储失败: %v", err)
+	}
+	// 重复停止应是安全的
+	hs.StopAutoRebalance()
+}
+
+// TestHybridStorageColdBlocksVirtualTime 使用手动时钟和内存文件系统测试冷块迁移，不需要真实等待
+func TestHybridStorageColdBlocksVirtualTime(t *testing.T) {
+	c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	hs, err := NewHybridStorage(&StorageConfig{
+		Type:                 StorageTypeHybrid,
+		Path:                 "/virtual/hybrid",
+		InlineThreshold:      1024,
+		StrategyName:         "adaptive",
+		HotBlockThreshold:    5,
+		ColdBlockTimeMinutes: 30,
+		AutoBalanceEnabled:   true,
+		RebalanceInterval:    time.Hour,
+		Clock:                c,
+		FS:                   vfs.NewMem(c),
+	})
+	if err != nil {
+		t.Fatalf("初始化混合存储失败: %v", err)
+	}
+	defer hs.Close()
+	// 等待后台重平衡的定时器创建后再推进时间
+	c.BlockUntil(1)
+
+	data := bytes.Repeat([]byte{0xCC}, 8*1024)
+	if err := hs.WriteBlock("cold", data); err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	if _, err := os.Stat("/virtual/hybrid"); !os.IsNotExist(err) {
+		t.Fatalf("内存文件系统中的存储不应写入磁盘: %v", err)
+	}
+
+	// 未超过冷块时间时不迁移
+	c.Advance(29 * time.Minute)
+	if report, _ := hs.Rebalance(); len(report.Moves) != 0 {
+		t.Fatalf("未变冷的块不应迁移: %+v", report.Moves)
+	}
+
+	// 推进到后台重平衡触发时块已变冷，迁移到目录存储
+	c.Advance(31 * time.Minute)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, location, _ := hs.GetBlockInfo("cold"); location == StorageTypeDirectory {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("后台重平衡未迁移冷块: %+v", hs.GetLastRebalanceReport())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if report := hs.GetLastRebalanceReport(); report == nil || !report.StartTime.Equal(c.Now()) {
+		t.Errorf("重平衡报告的时间应来自手动时钟: %+v", report)
+	}
+	if got, err := hs.ReadBlock("cold"); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("迁移后读取块失败: %v", err)
+	}
+}
+
+// TestHybridStorageRebalanceThrottle 测试重平衡受后台限速器约束，取消时剩余迁移推迟
+func TestHybridStorageRebalanceThrottle(t *testing.T) {
+	limiter := throttle.New(1024, 0)
+	hs, err := NewHybridStorage(&StorageConfig{
+		Type:               StorageTypeHybrid,
+		Path:               t.TempDir(),
+		InlineThreshold:    1024,
+		StrategyName:       "simple",
+		HotBlockThreshold:  2,
+		BackgroundThrottle: limiter,
+	})
+	if err != nil {
+		t.Fatalf("初始化混合存储失败: %v", err)
+	}
+	defer hs.Close()
+
+	for _, key := range []string{"block-a", "block-b"} {
+		if err := hs.WriteBlock(key, bytes.Repeat([]byte{0xAA}, 16*1024)); err != nil {
+			t.Fatalf("写入块%s失败: %v", key, err)
+		}
+		for i := 0; i < 2; i++ {
+			hs.ReadBlock(key)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	report, err := hs.rebalance(ctx)
+	if err != nil {
+		t.Fatalf("重平衡失败: %v", err)
+	}
+	if len(report.Moves) != 0 || report.Deferred != 2 {
+		t.Errorf("超出限速的迁移应推迟: 迁移%d, 推迟%d", len(report.Moves), report.Deferred)
+	}
+	if limiter.Waited() == 0 {
+		t.Errorf("限速器应记录等待时间")
+	}
+}
@@ -0,0 +1,219 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// GF(2^8)上的运算，本原多项式 x^8+x^4+x^3+x^2+1 (0x11d)
+var (
+	gfExp      [510]byte
+	gfLog      [256]byte
+	gfMulTable [256][256]byte
+)
+
+func init() {
+	x := 1
+	for i := 0; i < 255; i++ {
+		gfExp[i] = byte(x)
+		gfLog[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < len(gfExp); i++ {
+		gfExp[i] = gfExp[i-255]
+	}
+
+	for a := 1; a < 256; a++ {
+		for b := 1; b < 256; b++ {
+			gfMulTable[a][b] = gfExp[int(gfLog[a])+int(gfLog[b])]
+		}
+	}
+}
+
+// gfInv 求a的乘法逆元，a不能为0
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// gfMulAdd dst ^= c*src
+func gfMulAdd(dst, src []byte, c byte) {
+	if c == 0 {
+		return
+	}
+	table := &gfMulTable[c]
+	for i, v := range src {
+		dst[i] ^= table[v]
+	}
+}
+
+// errTooFewShards 可用分片少于数据分片数，无法重建
+var errTooFewShards = errors.New("可用分片不足")
+
+// reedSolomon 系统Reed-Solomon编码：k个数据分片加m个校验分片，任意k个分片可以恢复数据
+// 编码矩阵上部为单位矩阵，下部为Cauchy矩阵，任意k行组成的子矩阵都可逆
+type reedSolomon struct {
+	k, m   int
+	matrix [][]byte // (k+m)×k 编码矩阵
+}
+
+// newReedSolomon 创建k+m的编码器，k+m不超过256
+func newReedSolomon(k, m int) (*reedSolomon, error) {
+	if k <= 0 || m < 0 || k+m > 256 {
+		return nil, fmt.Errorf("%w: 无效的分片数 %d+%d", ErrInvalidOperation, k, m)
+	}
+
+	matrix := make([][]byte, k+m)
+	for i := 0; i < k; i++ {
+		matrix[i] = make([]byte, k)
+		matrix[i][i] = 1
+	}
+	// Cauchy矩阵元素 1/(x_i+y_j)，x_i=k+i 与 y_j=j 互不相同
+	for i := 0; i < m; i++ {
+		row := make([]byte, k)
+		for j := 0; j < k; j++ {
+			row[j] = gfInv(byte(k+i) ^ byte(j))
+		}
+		matrix[k+i] = row
+	}
+	return &reedSolomon{k: k, m: m, matrix: matrix}, nil
+}
+
+// shardSize 数据长度为n时每个分片的大小
+func (rs *reedSolomon) shardSize(n int) int {
+	return (n + rs.k - 1) / rs.k
+}
+
+// encode 把数据切分为k个数据分片（末尾补零）并计算m个校验分片
+func (rs *reedSolomon) encode(data []byte) [][]byte {
+	size := rs.shardSize(len(data))
+	shards := make([][]byte, rs.k+rs.m)
+	for i := 0; i < rs.k; i++ {
+		shard := make([]byte, size)
+		if start := i * size; start < len(data) {
+			copy(shard, data[start:])
+		}
+		shards[i] = shard
+	}
+	for i := rs.k; i < rs.k+rs.m; i++ {
+		shards[i] = make([]byte, size)
+		for j := 0; j < rs.k; j++ {
+			gfMulAdd(shards[i], shards[j], rs.matrix[i][j])
+		}
+	}
+	return shards
+}
+
+// reconstruct 用任意k个分片重建缺失（为nil）的分片，所有非nil分片大小必须为size
+func (rs *reedSolomon) reconstruct(shards [][]byte, size int) error {
+	if len(shards) != rs.k+rs.m {
+		return fmt.Errorf("%w: 分片数%d不等于%d", ErrInvalidOperation, len(shards), rs.k+rs.m)
+	}
+
+	// 选择前k个可用分片
+	rows := make([]int, 0, rs.k)
+	for i, shard := range shards {
+		if shard == nil {
+			continue
+		}
+		if len(shard) != size {
+			return fmt.Errorf("%w: 分片%d的大小不一致", ErrInvalidOperation, i)
+		}
+		if len(rows) < rs.k {
+			rows = append(rows, i)
+		}
+	}
+	if len(rows) < rs.k {
+		return errTooFewShards
+	}
+
+	// 数据分片缺失时用所选分片对应的编码矩阵子矩阵的逆矩阵恢复
+	dataMissing := false
+	for i := 0; i < rs.k; i++ {
+		if shards[i] == nil {
+			dataMissing = true
+			break
+		}
+	}
+	if dataMissing {
+		sub := make([][]byte, rs.k)
+		for r, row := range rows {
+			sub[r] = append([]byte(nil), rs.matrix[row]...)
+		}
+		inverse, err := gfInvertMatrix(sub)
+		if err != nil {
+			return err
+		}
+
+		for i := 0; i < rs.k; i++ {
+			if shards[i] != nil {
+				continue
+			}
+			shard := make([]byte, size)
+			for r, row := range rows {
+				gfMulAdd(shard, shards[row], inverse[i][r])
+			}
+			shards[i] = shard
+		}
+	}
+
+	// 由数据分片重新计算缺失的校验分片
+	for i := rs.k; i < rs.k+rs.m; i++ {
+		if shards[i] != nil {
+			continue
+		}
+		shard := make([]byte, size)
+		for j := 0; j < rs.k; j++ {
+			gfMulAdd(shard, shards[j], rs.matrix[i][j])
+		}
+		shards[i] = shard
+	}
+	return nil
+}
+
+// gfInvertMatrix 用高斯-约当消元求方阵的逆，会修改输入
+func gfInvertMatrix(matrix [][]byte) ([][]byte, error) {
+	n := len(matrix)
+	inverse := make([][]byte, n)
+	for i := range inverse {
+		inverse[i] = make([]byte, n)
+		inverse[i][i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := -1
+		for row := col; row < n; row++ {
+			if matrix[row][col] != 0 {
+				pivot = row
+				break
+			}
+		}
+		if pivot < 0 {
+			return nil, errors.New("编码矩阵不可逆")
+		}
+		matrix[col], matrix[pivot] = matrix[pivot], matrix[col]
+		inverse[col], inverse[pivot] = inverse[pivot], inverse[col]
+
+		// 主元归一
+		if c := matrix[col][col]; c != 1 {
+			scale := gfInv(c)
+			for j := 0; j < n; j++ {
+				matrix[col][j] = gfMulTable[scale][matrix[col][j]]
+				inverse[col][j] = gfMulTable[scale][inverse[col][j]]
+			}
+		}
+
+		// 消去其他行的该列
+		for row := 0; row < n; row++ {
+			if row == col || matrix[row][col] == 0 {
+				continue
+			}
+			c := matrix[row][col]
+			gfMulAdd(matrix[row], matrix[col], c)
+			gfMulAdd(inverse[row], inverse[col], c)
+		}
+	}
+	return inverse, nil
+}
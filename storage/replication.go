@@ -0,0 +1,412 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultReplicaRepairInterval 默认的后台副本修复间隔
+const DefaultReplicaRepairInterval = 10 * time.Minute
+
+// ReplicaRepairReport 一轮副本修复的结果
+type ReplicaRepairReport struct {
+	// StartTime 开始时间
+	StartTime time.Time
+	// Duration 用时
+	Duration time.Duration
+	// Checked 检查的块数
+	Checked int
+	// Repaired 补齐或重写的块文件数（含主块目录中的文件）
+	Repaired int
+	// RepairedBytes 补齐的总字节数
+	RepairedBytes int64
+	// Lost 所有副本都无法读取的块
+	Lost []uint32
+	// Errors 修复过程中的错误
+	Errors []error
+}
+
+// initReplicas 按配置准备副本根目录下的blocks目录
+func (ds *DirectoryStorage) initReplicas(config *StorageConfig) error {
+	ds.copies = 1
+	ds.throttle = config.BackgroundThrottle
+	ds.underReplicated = make(map[uint32]struct{})
+
+	if config.ReplicationFactor <= 1 {
+		return nil
+	}
+	if config.ReplicationFactor > 1+len(config.ReplicaPaths) {
+		return fmt.Errorf("%w: 复制份数%d超过可用的根目录数%d", ErrInvalidOperation, config.ReplicationFactor, 1+len(config.ReplicaPaths))
+	}
+
+	roots := map[string]bool{filepath.Clean(config.Path): true}
+	for _, root := range config.ReplicaPaths {
+		if root == "" || roots[filepath.Clean(root)] {
+			return fmt.Errorf("%w: 副本根目录为空或重复: %q", ErrInvalidOperation, root)
+		}
+		roots[filepath.Clean(root)] = true
+
+		blocksPath := filepath.Join(root, "blocks")
+		if err := ds.fs.MkdirAll(blocksPath, 0755); err != nil {
+			logger.Error("创建副本目录失败", "path", blocksPath, "error", err)
+			return err
+		}
+		ds.replicas = append(ds.replicas, blocksPath)
+	}
+	ds.copies = config.ReplicationFactor
+	return nil
+}
+
+// replicaPaths 返回块在副本根目录中的路径，与主块目录中的相对路径相同
+// 块ID决定使用哪些副本根目录，使副本均匀分布在各根目录上
+func (ds *DirectoryStorage) replicaPaths(id uint32, path string) []string {
+	if ds.copies <= 1 {
+		return nil
+	}
+
+	rel, err := filepath.Rel(ds.BlocksPath, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = ds.Layout.RelativePath(id)
+	}
+
+	paths := make([]string, 0, ds.copies-1)
+	for k := 0; k < ds.copies-1; k++ {
+		root := ds.replicas[(id+uint32(k))%uint32(len(ds.replicas))]
+		paths = append(paths, filepath.Join(root, rel))
+	}
+	return paths
+}
+
+// writeReplicasLocked 写入块的所有副本，返回成功写入的份数；失败的块等待后台修复（调用方需持有写锁）
+func (ds *DirectoryStorage) writeReplicasLocked(id uint32, path string, data []byte) int {
+	written := 0
+	for _, replica := range ds.replicaPaths(id, path) {
+		err := ds.fs.MkdirAll(filepath.Dir(replica), 0755)
+		if err == nil {
+			err = ds.fs.WriteFile(replica, data, 0644)
+		}
+		if err == nil {
+			err = ds.blockWritten(replica)
+		}
+		if err != nil {
+			logger.Warn("写入块副本失败，等待修复", "id", id, "path", replica, "error", err)
+			ds.markUnderReplicated(id)
+			continue
+		}
+		written++
+	}
+	return written
+}
+
+// removeReplicasLocked 删除块的所有副本（调用方需持有写锁）
+func (ds *DirectoryStorage) removeReplicasLocked(id uint32, path string) {
+	for _, replica := range ds.replicaPaths(id, path) {
+		if err := ds.fs.Remove(replica); err != nil && !os.IsNotExist(err) {
+			logger.Warn("删除块副本失败", "id", id, "path", replica, "error", err)
+		}
+		delete(ds.unsynced, replica)
+	}
+
+	ds.replicaMutex.Lock()
+	delete(ds.underReplicated, id)
+	ds.replicaMutex.Unlock()
+}
+
+// readReplica 主块目录中的文件无法读取时从副本读取，并标记该块等待修复
+func (ds *DirectoryStorage) readReplica(id uint32, path string) ([]byte, bool) {
+	for _, replica := range ds.replicaPaths(id, path) {
+		data, err := ds.fs.ReadFile(replica)
+		if err != nil {
+			continue
+		}
+		logger.Warn("块文件无法读取，已使用副本", "id", id, "path", path, "replica", replica)
+		ds.markUnderReplicated(id)
+		return data, true
+	}
+	return nil, false
+}
+
+// statReplica 主块目录中的文件无法访问时获取副本的文件信息
+func (ds *DirectoryStorage) statReplica(id uint32, path string) (os.FileInfo, bool) {
+	for _, replica := range ds.replicaPaths(id, path) {
+		if info, err := ds.fs.Stat(replica); err == nil {
+			return info, true
+		}
+	}
+	return nil, false
+}
+
+// markUnderReplicated 记录缺少副本的块
+func (ds *DirectoryStorage) markUnderReplicated(id uint32) {
+	ds.replicaMutex.Lock()
+	defer ds.replicaMutex.Unlock()
+
+	ds.underReplicated[id] = struct{}{}
+}
+
+// takeUnderReplicated 取出并清空已知缺少副本的块
+func (ds *DirectoryStorage) takeUnderReplicated() map[uint32]struct{} {
+	ds.replicaMutex.Lock()
+	defer ds.replicaMutex.Unlock()
+
+	taken := ds.underReplicated
+	ds.underReplicated = make(map[uint32]struct{})
+	return taken
+}
+
+// recoverFromReplicasLocked 重建块映射时加入只存在于副本中的块（例如更换了主磁盘），
+// 映射到主块目录中的对应路径，读取时使用副本，等待修复写回（调用方需持有写锁）
+func (ds *DirectoryStorage) recoverFromReplicasLocked() {
+	for _, replicaRoot := range ds.replicas {
+		files, err := scanBlockFiles(ds.fs, replicaRoot)
+		if err != nil {
+			logger.Warn("扫描副本目录失败", "path", replicaRoot, "error", err)
+			continue
+		}
+
+		for id, replica := range files {
+			if _, ok := ds.BlockMap[id]; ok {
+				continue
+			}
+			rel, err := filepath.Rel(replicaRoot, replica)
+			if err != nil {
+				continue
+			}
+			info, err := ds.fs.Stat(replica)
+			if err != nil {
+				continue
+			}
+
+			ds.BlockMap[id] = filepath.Join(ds.BlocksPath, rel)
+			ds.Stats.TotalBlocks++
+			ds.Stats.UsedSpace += uint64(info.Size())
+			ds.markUnderReplicated(id)
+		}
+	}
+}
+
+// migrateReplicasLocked 将副本目录迁移到新布局，错误追加到报告中（调用方需持有写锁）
+func (ds *DirectoryStorage) migrateReplicasLocked(layout DirectoryLayout, report *LayoutMigrationReport) {
+	for _, replicaRoot := range ds.replicas {
+		files, err := scanBlockFiles(ds.fs, replicaRoot)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Errorf("扫描副本目录失败(%s): %w", replicaRoot, err))
+			continue
+		}
+		replicaReport, _ := migrateBlockFiles(ds.fs, ds.clock, replicaRoot, files, layout)
+		report.Errors = append(report.Errors, replicaReport.Errors...)
+	}
+}
+
+// RepairReplicas 检查所有块的副本，补齐缺失或大小不一致的副本
+// 来源优先使用主块目录中的文件；写入失败或读取时使用了副本的块会重写所有副本。
+// 更换磁盘后调用（或等待后台修复）即可恢复复制份数。修复的数据量计入配置的BackgroundThrottle
+func (ds *DirectoryStorage) RepairReplicas() (*ReplicaRepairReport, error) {
+	return ds.repairReplicas(context.Background())
+}
+
+// repairReplicas 执行一轮副本修复，ctx取消时剩余的块留到下一轮
+func (ds *DirectoryStorage) repairReplicas(ctx context.Context) (*ReplicaRepairReport, error) {
+	report := &ReplicaRepairReport{StartTime: ds.clock.Now()}
+	if ds.copies <= 1 {
+		return report, nil
+	}
+	if err := ds.ensureBlockMap(); err != nil {
+		return nil, err
+	}
+
+	ds.mutex.RLock()
+	ids := make([]uint32, 0, len(ds.BlockMap))
+	for id := range ds.BlockMap {
+		ids = append(ids, id)
+	}
+	ds.mutex.RUnlock()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	suspect := ds.takeUnderReplicated()
+
+	for i, id := range ids {
+		if ctx.Err() != nil {
+			// 未检查的可疑块留到下一轮
+			for _, rest := range ids[i:] {
+				if _, ok := suspect[rest]; ok {
+					ds.markUnderReplicated(rest)
+				}
+			}
+			break
+		}
+
+		_, rewrite := suspect[id]
+		repaired, bytes, lost, err := ds.repairBlock(id, rewrite)
+		report.Checked++
+		report.Repaired += repaired
+		report.RepairedBytes += bytes
+		if lost {
+			report.Lost = append(report.Lost, id)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, err)
+			ds.markUnderReplicated(id)
+		}
+
+		if bytes > 0 {
+			ds.throttle.Wait(ctx, bytes)
+		}
+	}
+
+	report.Duration = ds.clock.Since(report.StartTime)
+
+	ds.repairMutex.Lock()
+	ds.lastRepair = report
+	ds.repairMutex.Unlock()
+
+	if report.Repaired > 0 || len(report.Lost) > 0 || len(report.Errors) > 0 {
+		logger.Info("副本修复完成",
+			"检查", report.Checked,
+			"修复", report.Repaired,
+			"字节", report.RepairedBytes,
+			"丢失", len(report.Lost),
+			"错误", len(report.Errors))
+	}
+	return report, nil
+}
+
+// repairBlock 补齐一个块的副本，rewrite为true时重写除来源外的所有位置
+func (ds *DirectoryStorage) repairBlock(id uint32, rewrite bool) (repaired int, bytes int64, lost bool, err error) {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	path, ok := ds.BlockMap[id]
+	if !ok {
+		return 0, 0, false, nil
+	}
+	locations := append([]string{path}, ds.replicaPaths(id, path)...)
+
+	// 选择第一个可读的位置作为来源
+	source := -1
+	var data []byte
+	for i, location := range locations {
+		if data, err = ds.fs.ReadFile(location); err == nil {
+			source = i
+			break
+		}
+	}
+	if source < 0 {
+		logger.Error("块的所有副本都无法读取", "id", id)
+		return 0, 0, true, nil
+	}
+
+	for i, location := range locations {
+		if i == source {
+			continue
+		}
+		if !rewrite {
+			if info, statErr := ds.fs.Stat(location); statErr == nil && info.Size() == int64(len(data)) {
+				continue
+			}
+		}
+
+		if err := ds.fs.MkdirAll(filepath.Dir(location), 0755); err != nil {
+			return repaired, bytes, false, fmt.Errorf("创建目录失败(ID=%d): %w", id, err)
+		}
+		if i == 0 {
+			ds.fdCache.Invalidate(location)
+		}
+		if err := ds.fs.WriteFile(location, data, 0644); err != nil {
+			return repaired, bytes, false, fmt.Errorf("写入块副本失败(ID=%d): %w", id, err)
+		}
+		if err := ds.blockWritten(location); err != nil {
+			return repaired, bytes, false, err
+		}
+		repaired++
+		bytes += int64(len(data))
+	}
+	return repaired, bytes, false, nil
+}
+
+// StartReplicaRepair 启动后台副本修复协程，按指定间隔执行RepairReplicas
+// interval 不大于0时使用DefaultReplicaRepairInterval；未启用复制或已启动时不做任何事
+func (ds *DirectoryStorage) StartReplicaRepair(interval time.Duration) {
+	if ds.copies <= 1 {
+		return
+	}
+	if interval <= 0 {
+		interval = DefaultReplicaRepairInterval
+	}
+
+	ds.repairMutex.Lock()
+	defer ds.repairMutex.Unlock()
+
+	if ds.repairStopCh != nil {
+		return
+	}
+
+	stopCh := make(chan struct{})
+	doneCh := make(chan struct{})
+	ds.repairStopCh = stopCh
+	ds.repairDoneCh = doneCh
+
+	go ds.replicaRepairLoop(interval, stopCh, doneCh)
+
+	logger.Info("已启动后台副本修复", "interval", interval, "copies", ds.copies)
+}
+
+// StopReplicaRepair 停止后台副本修复协程，并等待正在进行的一轮结束
+func (ds *DirectoryStorage) StopReplicaRepair() {
+	ds.repairMutex.Lock()
+	stopCh := ds.repairStopCh
+	doneCh := ds.repairDoneCh
+	ds.repairStopCh = nil
+	ds.repairDoneCh = nil
+	ds.repairMutex.Unlock()
+
+	if stopCh == nil {
+		return
+	}
+
+	close(stopCh)
+	<-doneCh
+}
+
+// replicaRepairLoop 后台副本修复循环
+func (ds *DirectoryStorage) replicaRepairLoop(interval time.Duration, stopCh <-chan struct{}, doneCh chan<- struct{}) {
+	defer close(doneCh)
+
+	// 停止时取消正在进行的一轮，避免在限速等待中阻塞
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	ticker := ds.clock.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C():
+			if _, err := ds.repairReplicas(ctx); err != nil {
+				logger.Error("后台副本修复失败", "error", err)
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// GetLastReplicaRepairReport 获取最近一轮副本修复的结果，尚未执行过时返回nil
+func (ds *DirectoryStorage) GetLastReplicaRepairReport() *ReplicaRepairReport {
+	ds.repairMutex.Lock()
+	defer ds.repairMutex.Unlock()
+
+	return ds.lastRepair
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestDirectoryStorageReplication 测试目录存储的多副本写入、读取回退和更换磁盘后的修复
+func TestDirectoryStorageReplication(t *testing.T) {
+	root := t.TempDir()
+	primary := filepath.Join(root, "disk1")
+	config := &StorageConfig{
+		Path:                  primary,
+		ReplicaPaths:          []string{filepath.Join(root, "disk2"), filepath.Join(root, "disk3")},
+		ReplicationFactor:     2,
+		ReplicaRepairInterval: -1,
+	}
+
+	ds, err := NewDirectoryStorage(config)
+	if err != nil {
+		t.Fatalf("创建目录存储失败: %v", err)
+	}
+
+	blocks := make(map[uint32][]byte)
+	for id := uint32(1); id <= 6; id++ {
+		blocks[id] = bytes.Repeat([]byte{byte(id)}, 100*int(id))
+		if err := ds.WriteBlock(id, blocks[id]); err != nil {
+			t.Fatalf("写入块%d失败: %v", id, err)
+		}
+		// 每个块在主块目录和一个副本根目录中各有一份
+		if replicas := ds.replicaPaths(id, ds.BlockMap[id]); len(replicas) != 1 {
+			t.Fatalf("块%d的副本数不正确: %v", id, replicas)
+		} else if data, err := os.ReadFile(replicas[0]); err != nil || !bytes.Equal(data, blocks[id]) {
+			t.Fatalf("块%d的副本内容不正确: %v", id, err)
+		}
+	}
+
+	// 主块目录中的文件丢失时从副本读取
+	os.Remove(ds.BlockMap[3])
+	if data, err := ds.ReadBlock(3); err != nil || !bytes.Equal(data, blocks[3]) {
+		t.Fatalf("应从副本读取块3: %v", err)
+	}
+	if info, err := ds.GetBlockInfo(3); err != nil || info.Size != 300 {
+		t.Errorf("应从副本获取块3的信息: %v", err)
+	}
+	report, err := ds.RepairReplicas()
+	if err != nil || report.Repaired != 1 || report.Checked != 6 {
+		t.Fatalf("修复结果不正确: %+v, %v", report, err)
+	}
+	if _, err := os.Stat(ds.BlockMap[3]); err != nil {
+		t.Errorf("修复后主块目录中应有块3: %v", err)
+	}
+
+	// 删除同时删除副本
+	replica := ds.replicaPaths(6, ds.BlockMap[6])[0]
+	if err := ds.DeleteBlock(6); err != nil {
+		t.Fatal(err)
+	}
+	delete(blocks, 6)
+	if _, err := os.Stat(replica); !os.IsNotExist(err) {
+		t.Error("删除块后副本应被删除")
+	}
+	if err := ds.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 更换主磁盘：主根目录整个丢失，重新打开后从副本恢复
+	if err := os.RemoveAll(primary); err != nil {
+		t.Fatal(err)
+	}
+	ds, err = NewDirectoryStorage(config)
+	if err != nil {
+		t.Fatalf("重新打开目录存储失败: %v", err)
+	}
+	defer ds.Close()
+
+	for id, expected := range blocks {
+		if data, err := ds.ReadBlock(id); err != nil || !bytes.Equal(data, expected) {
+			t.Errorf("更换磁盘后读取块%d失败: %v", id, err)
+		}
+	}
+	report, err = ds.RepairReplicas()
+	if err != nil || report.Repaired != len(blocks) || len(report.Lost) != 0 {
+		t.Fatalf("更换磁盘后的修复结果不正确: %+v, %v", report, err)
+	}
+	for id, expected := range blocks {
+		if data, err := os.ReadFile(ds.BlockMap[id]); err != nil || !bytes.Equal(data, expected) {
+			t.Errorf("块%d未写回主块目录: %v", id, err)
+		}
+	}
+	if report, _ := ds.RepairReplicas(); report.Repaired != 0 {
+		t.Errorf("副本已完整时不应再修复: %+v", report)
+	}
+	if ds.GetLastReplicaRepairReport() == nil {
+		t.Error("应记录最近一轮修复的结果")
+	}
+
+	// 复制份数超过根目录数
+	_, err = NewDirectoryStorage(&StorageConfig{Path: filepath.Join(root, "x"), ReplicationFactor: 2})
+	if !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("复制份数超过根目录数应返回ErrInvalidOperation: %v", err)
+	}
+}
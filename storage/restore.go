@@ -0,0 +1,281 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// RestoreOptions 恢复选项，零值恢复备份中的所有块并跳过已存在的块
+type RestoreOptions struct {
+	// Namespaces 只恢复这些命名空间（见 BlockNamespace）中的块，为空表示不按命名空间过滤
+	Namespaces []string
+	// Prefixes 只恢复键以其中任一前缀开头的块，为空表示不按前缀过滤
+	Prefixes []string
+	// IDs 只恢复备份中这些ID的块，为空表示不按ID过滤。按查询或标签恢复时由
+	// fragmenta.FragmentaImpl.RestoreFromBackup 填入查询结果
+	IDs []uint32
+	// Filter 只恢复返回true的块，与其他条件同时满足时才恢复，nil表示不过滤
+	Filter func(key BlockKey, size int) bool
+	// Overwrite 覆盖存储中已存在的块，否则跳过
+	Overwrite bool
+	// VerifyOnly 只读取并校验备份流，不写入存储
+	VerifyOnly bool
+}
+
+// RestoreResult 恢复结果
+type RestoreResult struct {
+	// Restored 恢复的块数，VerifyOnly时为校验通过且满足过滤条件的块数
+	Restored int
+	// Bytes 恢复的块数据字节数
+	Bytes int64
+	// Filtered 不满足过滤条件的块数
+	Filtered int
+	// Existing 已存在而跳过的块数
+	Existing int
+}
+
+// restoreFilter 恢复的过滤条件
+type restoreFilter struct {
+	opts *RestoreOptions
+	ids  map[uint32]bool
+}
+
+// newRestoreFilter 按恢复选项创建过滤条件
+func newRestoreFilter(opts *RestoreOptions) *restoreFilter {
+	filter := &restoreFilter{opts: opts}
+	if len(opts.IDs) > 0 {
+		filter.ids = make(map[uint32]bool, len(opts.IDs))
+		for _, id := range opts.IDs {
+			filter.ids[id] = true
+		}
+	}
+	return filter
+}
+
+// matches 返回块是否满足过滤条件
+func (f *restoreFilter) matches(rec *backupRecord) bool {
+	opts := f.opts
+	if f.ids != nil && !f.ids[rec.id] {
+		return false
+	}
+	if len(opts.Namespaces) > 0 && !slices.Contains(opts.Namespaces, BlockNamespace(rec.key)) {
+		return false
+	}
+	name := rec.key.String()
+	if len(opts.Prefixes) > 0 && !slices.ContainsFunc(opts.Prefixes, func(prefix string) bool {
+		return strings.HasPrefix(name, prefix)
+	}) {
+		return false
+	}
+	return opts.Filter == nil || opts.Filter(rec.key, len(rec.data))
+}
+
+// RestoreFrom 从 BackupTo 写出的备份流恢复块，可以只恢复满足过滤条件的块（如一个租户的命名空间，
+// 或按查询选出的块ID）。
+//
+// 先读取并校验整个备份流：每个块的CRC32-C和流末尾的整体校验和，满足过滤条件的块暂存在临时文件中。
+// 全部校验通过后才写入存储，校验失败时返回 ErrBackupCorrupted，存储不变。
+// 块按原始数据写入，启用加密的备份需要存储使用相同的安全管理器，且块保持原来的ID。
+// 字符串键尽量使用备份中的ID，ID已被占用时分配新的ID（仅限未加密的备份）。
+// opts为nil时恢复所有块并跳过已存在的块
+func (sm *StorageManagerImpl) RestoreFrom(ctx context.Context, r io.Reader, opts *RestoreOptions) (*RestoreResult, error) {
+	if opts == nil {
+		opts = &RestoreOptions{}
+	}
+	br, err := newBackupReader(r)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := br.flags&backupFlagEncrypted != 0
+
+	if !opts.VerifyOnly {
+		sm.mutex.RLock()
+		storeEncrypted := sm.encryptionEnabled && sm.securityManager != nil
+		sm.mutex.RUnlock()
+		if encrypted != storeEncrypted {
+			return nil, fmt.Errorf("%w: 备份加密状态(%v)与存储(%v)不一致", ErrInvalidOperation, encrypted, storeEncrypted)
+		}
+	}
+
+	result := &RestoreResult{}
+	staged, err := sm.stageRestore(ctx, br, newRestoreFilter(opts), opts.VerifyOnly, result)
+	if staged != nil {
+		defer func() {
+			staged.Close()
+			os.Remove(staged.Name())
+		}()
+	}
+	if err != nil {
+		logger.Error("校验备份失败", "error", err)
+		return result, err
+	}
+	if opts.VerifyOnly {
+		return result, nil
+	}
+
+	if _, err := staged.Seek(0, io.SeekStart); err != nil {
+		return result, err
+	}
+	if br, err = newBackupReader(staged); err != nil {
+		return result, err
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+		rec, err := br.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			logger.Error("读取暂存的备份失败", "restored", result.Restored, "error", err)
+			return result, err
+		}
+
+		id, written, err := sm.restoreBlock(rec, encrypted, opts.Overwrite)
+		if err != nil {
+			logger.Error("恢复块失败", "id", rec.id, "key", rec.key.String(), "error", err)
+			return result, err
+		}
+		if !written {
+			result.Existing++
+			continue
+		}
+		result.Restored++
+		result.Bytes += int64(len(rec.data))
+		sm.emitRestored(id, rec.data, encrypted)
+	}
+
+	logger.Info("恢复完成", "restored", result.Restored, "filtered", result.Filtered, "existing", result.Existing)
+	return result, nil
+}
+
+// stageRestore 读取并校验整个备份流，统计不满足过滤条件的块。verifyOnly时只统计满足条件的块，
+// 否则把它们写入临时文件，返回的文件是只包含这些块的备份流，由调用者关闭并删除
+func (sm *StorageManagerImpl) stageRestore(ctx context.Context, br *backupReader, filter *restoreFilter, verifyOnly bool, result *RestoreResult) (*os.File, error) {
+	var staged *os.File
+	var out *backupWriter
+	if !verifyOnly {
+		var err error
+		if staged, err = os.CreateTemp("", "fragmenta-restore-*"); err != nil {
+			return nil, err
+		}
+		if out, err = newBackupWriter(staged, br.flags, 0); err != nil {
+			return staged, err
+		}
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return staged, err
+		}
+		rec, err := br.next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return staged, err
+		}
+		if !filter.matches(rec) {
+			result.Filtered++
+			continue
+		}
+		if verifyOnly {
+			result.Restored++
+			result.Bytes += int64(len(rec.data))
+			continue
+		}
+		if err := out.write(rec.id, rec.key, rec.data); err != nil {
+			return staged, err
+		}
+	}
+
+	if out != nil {
+		return staged, out.close()
+	}
+	return staged, nil
+}
+
+// restoreBlock 在写锁下确定块ID并写入块的原始数据，块已存在且不覆盖时返回false
+func (sm *StorageManagerImpl) restoreBlock(rec *backupRecord, encrypted, overwrite bool) (uint32, bool, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	id, err := sm.restoreKeyID(rec)
+	if err != nil {
+		return 0, false, err
+	}
+	if encrypted && id != rec.id {
+		return 0, false, fmt.Errorf("%w: 加密块%d需要保持原ID，但键%q已使用%d", ErrBlockKeyConflict, rec.id, rec.key.String(), id)
+	}
+	if sm.backendHas(id) && !overwrite {
+		return id, false, nil
+	}
+	if err := sm.checkRetentionLocked(id); err != nil {
+		return 0, false, err
+	}
+
+	if err := sm.checkWriteSpace(len(rec.data)); err != nil {
+		return 0, false, err
+	}
+	if _, numeric := rec.key.Numeric(); !numeric {
+		if _, mapped := sm.keys.byName[rec.key.name]; !mapped {
+			sm.keys.set(rec.key.name, id)
+			if err := sm.keys.save(); err != nil {
+				sm.keys.remove(id)
+				return 0, false, err
+			}
+		}
+	}
+
+	sm.preserveForBackup(id)
+	prevSize, existed := sm.prevUsageSize(id)
+	if err := sm.writeBackend(id, rec.data); err != nil {
+		return 0, false, sm.noteWriteError(err)
+	}
+	sm.markConvertDirty(id)
+	sm.blockCache.remove(id)
+	sm.usage.record(id, sm.keyForIDLocked(id), uint64(len(rec.data)), prevSize, existed)
+	return id, true, nil
+}
+
+// restoreKeyID 返回恢复块使用的ID（调用者持有写锁）。数字键使用原ID，被字符串键占用时返回
+// ErrBlockKeyConflict；字符串键已存在时使用已有的映射，否则尽量使用原ID
+func (sm *StorageManagerImpl) restoreKeyID(rec *backupRecord) (uint32, error) {
+	if _, numeric := rec.key.Numeric(); numeric {
+		return sm.resolveKey(rec.key, false)
+	}
+	if len(rec.key.name) > MaxBlockKeyLength {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidBlockKey, rec.key.name)
+	}
+	if id, ok := sm.keys.byName[rec.key.name]; ok {
+		return id, nil
+	}
+	if _, owned := sm.keys.byID[rec.id]; !owned && !sm.backendHas(rec.id) {
+		return rec.id, nil
+	}
+	return sm.allocateKeyID()
+}
+
+// emitRestored 通知块回调恢复的块，加密的块读取解密后的数据
+func (sm *StorageManagerImpl) emitRestored(id uint32, data []byte, encrypted bool) {
+	if len(sm.blockHooks.snapshot()) == 0 {
+		return
+	}
+	if encrypted {
+		plain, err := sm.ReadBlock(id)
+		if err != nil {
+			if !errors.Is(err, ErrBlockNotFound) {
+				logger.Warning("读取恢复的块失败，未通知块回调", "id", id, "error", err)
+			}
+			return
+		}
+		data = plain
+	}
+	sm.emitWritten(id, data)
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestRestoreFrom 测试按命名空间部分恢复、跳过已存在的块和校验失败
+func TestRestoreFrom(t *testing.T) {
+	dir := t.TempDir()
+	src, err := NewStorageManager(&StorageConfig{Type: StorageTypeContainer, Path: filepath.Join(dir, "src.db"), BlockSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+
+	blocks := map[string]string{
+		"acme/a":   "alpha",
+		"acme/b":   "beta",
+		"globex/c": "gamma",
+	}
+	for key, value := range blocks {
+		if err := src.WriteBlockKey(StringKey(key), []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := src.WriteBlock(5, []byte("five")); err != nil {
+		t.Fatal(err)
+	}
+	var backup bytes.Buffer
+	if _, err := src.BackupTo(context.Background(), &backup); err != nil {
+		t.Fatal(err)
+	}
+
+	dst, err := NewStorageManager(&StorageConfig{Type: StorageTypeHybrid, Path: filepath.Join(dir, "dst"), BlockSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	result, err := dst.RestoreFrom(context.Background(), bytes.NewReader(backup.Bytes()), &RestoreOptions{Namespaces: []string{"acme"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Restored != 2 || result.Filtered != 2 {
+		t.Errorf("result: %+v", result)
+	}
+	for _, key := range []string{"acme/a", "acme/b"} {
+		if data, err := dst.ReadBlockKey(StringKey(key)); err != nil || string(data) != blocks[key] {
+			t.Errorf("%s: %q, %v", key, data, err)
+		}
+	}
+	if _, err := dst.ReadBlockKey(StringKey("globex/c")); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("filtered block restored: %v", err)
+	}
+
+	// 已存在的块默认跳过
+	if err := dst.WriteBlockKey(StringKey("acme/a"), []byte("changed")); err != nil {
+		t.Fatal(err)
+	}
+	result, err = dst.RestoreFrom(context.Background(), bytes.NewReader(backup.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Restored != 2 || result.Existing != 2 {
+		t.Errorf("full restore: %+v", result)
+	}
+	if data, _ := dst.ReadBlockKey(StringKey("acme/a")); string(data) != "changed" {
+		t.Errorf("existing block overwritten: %q", data)
+	}
+	if data, _ := dst.ReadBlock(5); string(data) != "five" {
+		t.Errorf("numeric block: %q", data)
+	}
+
+	// 块数据损坏时在写入前停止
+	corrupted := bytes.Clone(backup.Bytes())
+	i := bytes.Index(corrupted, []byte("gamma"))
+	corrupted[i] = 'G'
+	fresh, err := NewStorageManager(&StorageConfig{Type: StorageTypeDirectory, Path: filepath.Join(dir, "fresh"), BlockSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fresh.Close()
+	if _, err := fresh.RestoreFrom(context.Background(), bytes.NewReader(corrupted), &RestoreOptions{VerifyOnly: true}); !errors.Is(err, ErrBackupCorrupted) {
+		t.Errorf("verify corrupted backup: %v", err)
+	}
+	if _, err := fresh.RestoreFrom(context.Background(), bytes.NewReader(corrupted), nil); !errors.Is(err, ErrBackupCorrupted) {
+		t.Errorf("restore corrupted backup: %v", err)
+	}
+	if _, err := fresh.ReadBlockKey(StringKey("globex/c")); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("corrupted block written: %v", err)
+	}
+}
+
+// TestRestoreVerifiesBeforeWriting 测试流末尾的校验和不匹配时不写入任何块，以及按块ID恢复
+func TestRestoreVerifiesBeforeWriting(t *testing.T) {
+	dir := t.TempDir()
+	sm, err := NewStorageManager(&StorageConfig{Type: StorageTypeContainer, Path: filepath.Join(dir, "blocks.db"), BlockSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Close()
+
+	for id, value := range map[uint32]string{1: "one", 2: "two", 3: "three"} {
+		if err := sm.WriteBlock(id, []byte(value)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var backup bytes.Buffer
+	if _, err := sm.BackupTo(context.Background(), &backup); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []uint32{1, 2} {
+		if err := sm.WriteBlock(id, []byte("changed")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 块记录都有效，只有流末尾的校验和损坏
+	corrupted := bytes.Clone(backup.Bytes())
+	corrupted[len(corrupted)-1] ^= 0xFF
+	result, err := sm.RestoreFrom(context.Background(), bytes.NewReader(corrupted), &RestoreOptions{Overwrite: true})
+	if !errors.Is(err, ErrBackupCorrupted) {
+		t.Fatalf("应返回ErrBackupCorrupted: %v", err)
+	}
+	if result.Restored != 0 {
+		t.Errorf("校验失败前不应写入块: %+v", result)
+	}
+	for _, id := range []uint32{1, 2} {
+		if data, _ := sm.ReadBlock(id); string(data) != "changed" {
+			t.Errorf("块%d被损坏的备份覆盖: %q", id, data)
+		}
+	}
+
+	// 只恢复选中的块
+	result, err = sm.RestoreFrom(context.Background(), bytes.NewReader(backup.Bytes()), &RestoreOptions{IDs: []uint32{2}, Overwrite: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Restored != 1 || result.Filtered != 2 {
+		t.Errorf("result: %+v", result)
+	}
+	for id, want := range map[uint32]string{1: "changed", 2: "two"} {
+		if data, _ := sm.ReadBlock(id); string(data) != want {
+			t.Errorf("块%d: %q, 期望%q", id, data, want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRetained 表示块处于保留期或法律保留中，不能删除、覆盖或转换存储模式
+var ErrRetained = errors.New("块处于保留期或法律保留中")
+
+// SetRetention 设置块的保留期限（WORM），期限之前块不能删除或覆盖写入，存储也不能转换模式。
+// 期限只能延长，早于已设置的期限时返回 ErrRetained。保留期限记录在块策略表中，重新打开后继续生效
+func (sm *StorageManagerImpl) SetRetention(id uint32, until time.Time) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if !sm.backendHas(id) {
+		return ErrBlockNotFound
+	}
+	entry := sm.policies.entries[id]
+	if until.Before(entry.retainUntil) {
+		return fmt.Errorf("%w: 块%d的保留期限%v不能缩短", ErrRetained, id, entry.retainUntil)
+	}
+	entry.retainUntil = until
+	return sm.savePolicyEntryLocked(id, entry)
+}
+
+// SetLegalHold 设置或解除块的法律保留。法律保留没有期限，解除之前块不能删除或覆盖写入，
+// 与保留期限相互独立
+func (sm *StorageManagerImpl) SetLegalHold(id uint32, hold bool) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if !sm.backendHas(id) {
+		return ErrBlockNotFound
+	}
+	entry := sm.policies.entries[id]
+	if entry.legalHold == hold {
+		return nil
+	}
+	entry.legalHold = hold
+	if err := sm.savePolicyEntryLocked(id, entry); err != nil {
+		return err
+	}
+	logger.Info("已修改块的法律保留", "id", id, "hold", hold)
+	return nil
+}
+
+// RetainedBlocks 返回处于保留期或法律保留中的块ID
+func (sm *StorageManagerImpl) RetainedBlocks() []uint32 {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	var ids []uint32
+	for id := range sm.policies.entries {
+		if sm.retainedLocked(id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// CheckDeletable 检查块是否可以删除，处于保留中时返回 ErrRetained
+func (sm *StorageManagerImpl) CheckDeletable(id uint32) error {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+	return sm.checkRetentionLocked(id)
+}
+
+// savePolicyEntryLocked 保存块的策略记录，恢复到零值时删除记录（调用者持有写锁）
+func (sm *StorageManagerImpl) savePolicyEntryLocked(id uint32, entry blockPolicyEntry) error {
+	old, existed := sm.policies.entries[id]
+	if entry == (blockPolicyEntry{}) {
+		delete(sm.policies.entries, id)
+	} else {
+		sm.policies.entries[id] = entry
+	}
+	if err := sm.policies.save(); err != nil {
+		if existed {
+			sm.policies.entries[id] = old
+		} else {
+			delete(sm.policies.entries, id)
+		}
+		return err
+	}
+	return nil
+}
+
+// retainedLocked 返回块是否处于保留期或法律保留中（调用者持有锁）
+func (sm *StorageManagerImpl) retainedLocked(id uint32) bool {
+	entry, ok := sm.policies.entries[id]
+	return ok && (entry.legalHold || sm.clock().Now().Before(entry.retainUntil))
+}
+
+// checkRetentionLocked 块处于保留中时返回 ErrRetained（调用者持有锁）
+func (sm *StorageManagerImpl) checkRetentionLocked(id uint32) error {
+	if !sm.retainedLocked(id) {
+		return nil
+	}
+	entry := sm.policies.entries[id]
+	if entry.legalHold {
+		return fmt.Errorf("%w: 块%d处于法律保留中", ErrRetained, id)
+	}
+	return fmt.Errorf("%w: 块%d保留至%v", ErrRetained, id, entry.retainUntil)
+}
+
+// checkConvertRetentionLocked 有块处于保留中时返回 ErrRetained，模式转换需要重写所有块（调用者持有锁）
+func (sm *StorageManagerImpl) checkConvertRetentionLocked() error {
+	for id := range sm.policies.entries {
+		if sm.retainedLocked(id) {
+			return fmt.Errorf("%w: 块%d处于保留中，不能转换存储模式", ErrRetained, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+)
+
+// TestRetention 测试保留期限和法律保留阻止删除、覆盖和模式转换，并在重新打开后保留
+func TestRetention(t *testing.T) {
+	fake := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	config := &StorageConfig{Type: StorageTypeContainer, Path: filepath.Join(t.TempDir(), "blocks.db"), BlockSize: 4096, Clock: fake}
+	sm, err := NewStorageManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := uint32(1); id <= 2; id++ {
+		if err := sm.WriteBlock(id, []byte("record")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	until := fake.Now().Add(24 * time.Hour)
+	if err := sm.SetRetention(1, until); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SetLegalHold(2, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.SetRetention(3, until); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("retention on missing block: %v", err)
+	}
+	if err := sm.SetRetention(1, until.Add(-time.Hour)); !errors.Is(err, ErrRetained) {
+		t.Errorf("shortened retention: %v", err)
+	}
+
+	for id := uint32(1); id <= 2; id++ {
+		if err := sm.DeleteBlock(id); !errors.Is(err, ErrRetained) {
+			t.Errorf("delete block %d: %v", id, err)
+		}
+		if err := sm.WriteBlock(id, []byte("changed")); !errors.Is(err, ErrRetained) {
+			t.Errorf("overwrite block %d: %v", id, err)
+		}
+	}
+	if err := sm.ConvertType(StorageTypeDirectory); !errors.Is(err, ErrRetained) {
+		t.Errorf("convert: %v", err)
+	}
+	info, err := sm.GetBlockInfo(1)
+	if err != nil || !info.RetainUntil.Equal(until) || info.LegalHold {
+		t.Errorf("block 1 info: %+v, %v", info, err)
+	}
+	if info, _ := sm.GetBlockInfo(2); !info.LegalHold {
+		t.Errorf("block 2 info: %+v", info)
+	}
+	if err := sm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sm, err = NewStorageManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Close()
+	if len(sm.RetainedBlocks()) != 2 {
+		t.Errorf("retained after reopen: %v", sm.RetainedBlocks())
+	}
+
+	// 保留期过后可以删除，法律保留解除后可以删除
+	fake.Advance(25 * time.Hour)
+	if err := sm.DeleteBlock(1); err != nil {
+		t.Errorf("delete after retention: %v", err)
+	}
+	if err := sm.DeleteBlock(2); !errors.Is(err, ErrRetained) {
+		t.Errorf("legal hold expired with time: %v", err)
+	}
+	if err := sm.SetLegalHold(2, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.DeleteBlock(2); err != nil {
+		t.Errorf("delete after hold released: %v", err)
+	}
+}
+
+// TestPolicyTableV1 测试读取没有保留策略字段的版本1块策略表
+func TestPolicyTableV1(t *testing.T) {
+	expires := time.Unix(0, 1700000000000000000)
+	table := &policyTable{entries: map[uint32]blockPolicyEntry{7: {tier: TierDirectory, expiresAt: expires}}}
+	data := table.encode()
+
+	// 转换为版本1格式：去掉flags和retainUntil
+	v1 := append([]byte(nil), data[:12]...)
+	v1[5] = 1
+	entry := data[12 : 12+policyEntrySize]
+	v1 = append(v1, entry[:5]...)
+	v1 = append(v1, entry[6:14]...)
+	v1 = binary.BigEndian.AppendUint32(v1, crc32.Checksum(v1, metaIndexCRCTable))
+
+	loaded := &policyTable{entries: make(map[uint32]blockPolicyEntry)}
+	if err := loaded.decode(v1); err != nil {
+		t.Fatal(err)
+	}
+	got := loaded.entries[7]
+	if got.tier != TierDirectory || !got.expiresAt.Equal(expires) || !got.retainUntil.IsZero() || got.legalHold {
+		t.Errorf("v1 entry: %+v", got)
+	}
+}
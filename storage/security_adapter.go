@@ -36,6 +36,9 @@ type StorageSecurityConfig struct {
 
 	// 自动生成密钥
 	AutoGenerateKey bool
+
+	// 外部密钥管理服务配置，设置后密钥库中的密钥由服务包装
+	KMS security.KMSConfig
 }
 
 // DefaultStorageSecurityConfig 返回默认存储安全配置
@@ -122,6 +125,7 @@ func CreateSecureStorageManager(storageConfig *StorageConfig, securityConfig *St
 		DefaultAlgorithm:  security.AES256GCM,
 		KeyStorePath:      securityConfig.KeyStorePath,
 		AutoGenerateKey:   securityConfig.AutoGenerateKey,
+		KMS:               securityConfig.KMS,
 	}
 
 	securityManager, err := security.NewDefaultSecurityManager(secConfig)
@@ -155,6 +159,7 @@ func GetStorageSecurityAdapter(storageManager StorageManager, securityConfig *St
 		DefaultAlgorithm:  security.AES256GCM,
 		KeyStorePath:      securityConfig.KeyStorePath,
 		AutoGenerateKey:   securityConfig.AutoGenerateKey,
+		KMS:               securityConfig.KMS,
 	}
 
 	securityManager, err := security.NewDefaultSecurityManager(secConfig)
@@ -210,3 +215,23 @@ func (a *StorageSecurityAdapter) Close() error {
 	// 关闭存储管理器
 	return a.storageManager.Close()
 }
+
+// recordEncryptionChange 将加密开关变更写入安全管理器的审计日志，安全管理器未设置审计记录器时忽略
+func recordEncryptionChange(securityManager interface{}, path string, enabled bool) {
+	m, ok := securityManager.(interface{ AuditRecorder() security.AuditRecorder })
+	if !ok {
+		return
+	}
+	recorder := m.AuditRecorder()
+	if recorder == nil {
+		return
+	}
+
+	action := security.AuditEncryptionDisable
+	if enabled {
+		action = security.AuditEncryptionEnable
+	}
+	if err := recorder.Append(action, path, nil); err != nil {
+		logger.Error("写入审计日志失败", "action", action, "error", err)
+	}
+}
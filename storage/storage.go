@@ -9,21 +9,17 @@ import (
 	"path/filepath"
 	"sync"
 	"time"
-)
-
-// 错误定义
-var (
-	// ErrInvalidMode 表示存储模式无效
-	ErrInvalidMode = errors.New("无效的存储模式")
-
-	// ErrInvalidOperation 表示操作无效
-	ErrInvalidOperation = errors.New("无效的操作")
 
-	// ErrBlockNotFound 表示请求的块不存在
-	ErrBlockNotFound = errors.New("块不存在")
+	"github.com/bpfs/fragmenta/clock"
+	"github.com/bpfs/fragmenta/security"
+	"github.com/bpfs/fragmenta/throttle"
+	"github.com/bpfs/fragmenta/vfs"
 )
 
 // StorageManagerImpl 存储管理器实现
+//
+// 所有导出方法都可以并发调用。ReadBlock之间共享读锁并发执行，缓存命中和填充只锁定
+// 块缓存的一个分片（见 BlockCache）；写入、删除、模式转换和运行时设置修改持有写锁，彼此串行
 type StorageManagerImpl struct {
 	// 配置
 	config *StorageConfig
@@ -33,6 +29,21 @@ type StorageManagerImpl struct {
 	directoryStorage *DirectoryStorage
 	hybridStorage    *HybridStorage
 
+	// 字符串块键与内部块ID的映射（见 BlockKey），由mutex保护
+	keys *keyTable
+
+	// 空间使用统计（见 Usage），由mutex保护
+	usage *usageTracker
+
+	// 按调用方标签的操作统计（见 CallerStats），记录时不加锁
+	callers *callerTracker
+
+	// 磁盘空间守卫（见 Degraded），禁用时为nil
+	diskGuard *diskGuard
+
+	// 进行中的备份（见 BackupTo），由mutex保护
+	backup *backupSnapshot
+
 	// 同步
 	mutex sync.RWMutex
 
@@ -40,13 +51,31 @@ type StorageManagerImpl struct {
 	blockCache *BlockCache
 
 	// 自动检查通道
-	autoCheckStopCh chan struct{}
+	autoCheckStopCh  chan struct{}
+	autoCheckStarted bool
+
+	// 模式转换期间被写入或删除的块，不为nil表示正在转换
+	convertDirty map[uint32]struct{}
 
 	// 安全管理器
 	securityManager interface{}
 
 	// 加密状态
 	encryptionEnabled bool
+
+	// 授权检查，只对 *Context 方法生效
+	authorizer security.Authorizer
+
+	// 块写入和删除回调
+	blockHooks blockHooks
+
+	// 写入管道和已注册的块数据变换（见 SetTransformPipeline），由mutex保护
+	pipeline   []BlockTransform
+	transforms map[string]BlockTransform
+
+	// 块分类器和持久化的块策略（见 SetClassifier），由mutex保护
+	classifier BlockClassifier
+	policies   *policyTable
 }
 
 // NewStorageManager 创建存储管理器
@@ -66,14 +95,16 @@ func NewStorageManager(config *StorageConfig) (*StorageManagerImpl, error) {
 
 	// 创建存储管理器
 	sm := &StorageManagerImpl{
-		config: config,
-		blockCache: &BlockCache{
-			Entries:     make(map[uint32]*CacheEntry),
-			MaxSize:     config.CacheSize,
-			CurrentSize: 0,
-			Policy:      config.CachePolicy,
-		},
+		config:          config,
+		blockCache:      newBlockCache(config.CacheSize, config.CachePolicy),
+		usage:           newUsageTracker(config.UsagePrefixes),
+		diskGuard:       newDiskGuard(config),
 		autoCheckStopCh: make(chan struct{}),
+		classifier:      config.Classifier,
+	}
+	sm.callers = newCallerTracker(sm.clock().Now())
+	if err := sm.SetTransformPipeline(config.Transforms...); err != nil {
+		return nil, err
 	}
 
 	// 根据存储模式初始化
@@ -101,9 +132,20 @@ func NewStorageManager(config *StorageConfig) (*StorageManagerImpl, error) {
 		logger.Error("无效的存储模式", "error", ErrInvalidMode)
 		return nil, ErrInvalidMode
 	}
+	if err := sm.loadKeys(); err != nil {
+		logger.Error("加载块键表失败", "error", err)
+		sm.closeBackend()
+		return nil, err
+	}
+	if err := sm.loadPolicies(); err != nil {
+		logger.Error("加载块策略表失败", "error", err)
+		sm.closeBackend()
+		return nil, err
+	}
 
 	// 启动自动检查协程
 	if config.AutoConvertThreshold > 0 {
+		sm.autoCheckStarted = true
 		go sm.startAutoCheck()
 	}
 
@@ -148,13 +190,21 @@ func (sm *StorageManagerImpl) Init(config *StorageConfig) error {
 		logger.Error("无效的存储模式", "error", ErrInvalidMode)
 		return ErrInvalidMode
 	}
+	if err := sm.loadKeys(); err != nil {
+		logger.Error("加载块键表失败", "error", err)
+		return err
+	}
+	if err := sm.loadPolicies(); err != nil {
+		logger.Error("加载块策略表失败", "error", err)
+		return err
+	}
 
 	// 初始化缓存
-	sm.blockCache = &BlockCache{
-		Entries:     make(map[uint32]*CacheEntry),
-		MaxSize:     config.CacheSize,
-		CurrentSize: 0,
-		Policy:      config.CachePolicy,
+	sm.blockCache = newBlockCache(config.CacheSize, config.CachePolicy)
+	sm.usage = newUsageTracker(config.UsagePrefixes)
+	sm.diskGuard = newDiskGuard(config)
+	if sm.callers == nil {
+		sm.callers = newCallerTracker(sm.clock().Now())
 	}
 
 	return nil
@@ -171,14 +221,21 @@ func (sm *StorageManagerImpl) Close() error {
 	// 关闭所有存储
 	var err error
 	if sm.containerStorage != nil {
-		if sm.containerStorage.File != nil {
-			err = sm.containerStorage.File.Close()
+		err = sm.containerStorage.Close()
+	}
+	if sm.directoryStorage != nil {
+		if closeErr := sm.directoryStorage.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	if sm.hybridStorage != nil {
+		if closeErr := sm.hybridStorage.Close(); closeErr != nil && err == nil {
+			err = closeErr
 		}
 	}
 
 	// 清理缓存
-	sm.blockCache.Entries = make(map[uint32]*CacheEntry)
-	sm.blockCache.CurrentSize = 0
+	sm.blockCache.clear()
 
 	return err
 }
@@ -210,6 +267,9 @@ func (sm *StorageManagerImpl) SetEncryptionEnabled(enabled bool) error {
 		return fmt.Errorf("未设置安全管理器，无法启用加密")
 	}
 
+	if sm.encryptionEnabled != enabled {
+		recordEncryptionChange(sm.securityManager, sm.config.Path, enabled)
+	}
 	sm.encryptionEnabled = enabled
 	return nil
 }
@@ -254,83 +314,83 @@ func (sm *StorageManagerImpl) DecryptBlock(id uint32, data []byte) ([]byte, erro
 	return data, fmt.Errorf("安全管理器不支持解密操作")
 }
 
-// WriteBlock 写入块
+// WriteBlock 写入块，成功后通知块回调（见 AddBlockHook）。
+// ID已分配给字符串键（见 BlockKey）时返回 ErrBlockKeyConflict
 func (sm *StorageManagerImpl) WriteBlock(id uint32, data []byte) error {
+	return sm.WriteBlockKey(NumericKey(id), data)
+}
+
+// writeBlock 在写锁下解析块键、加密并写入块，返回块的内部ID
+func (sm *StorageManagerImpl) writeBlock(key BlockKey, data []byte) (uint32, error) {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
-	// 加密数据（如果启用）
-	writeData := data
-	var err error
-	if sm.encryptionEnabled && sm.securityManager != nil {
-		// 直接使用安全管理器，而不是调用EncryptBlock（避免死锁）
-		if secMgr, ok := sm.securityManager.(interface {
-			EncryptBlock(ctx context.Context, blockID uint32, data []byte) ([]byte, error)
-		}); ok {
-			writeData, err = secMgr.EncryptBlock(context.Background(), id, data)
-			if err != nil {
-				logger.Error("加密数据失败", "error", err)
-				return err
-			}
-		} else {
-			logger.Warning("安全管理器不支持加密操作，将使用原始数据")
-		}
+	id, err := sm.resolveKey(key, true)
+	if err != nil {
+		return 0, err
 	}
-
-	// 根据存储模式写入
-	switch {
-	case sm.containerStorage != nil:
-		err = sm.containerStorage.WriteBlock(id, writeData)
-	case sm.directoryStorage != nil:
-		err = sm.directoryStorage.WriteBlock(id, writeData)
-	case sm.hybridStorage != nil:
-		// 将uint32 ID转换为string键
-		idKey := fmt.Sprintf("%d", id)
-		err = sm.hybridStorage.WriteBlock(idKey, writeData)
-	default:
-		err = ErrInvalidMode
+	if err := sm.checkRetentionLocked(id); err != nil {
+		return 0, err
 	}
 
+	// 按分类策略或默认管道变换并加密数据（如果启用）
+	policy := sm.classifyLocked(id, key, data)
+	pipeline, err := sm.blockPipeline(policy)
+	if err != nil {
+		return 0, err
+	}
+	writeData, err := sm.encodeBlock(id, data, pipeline)
 	if err != nil {
+		return 0, err
+	}
+
+	// 根据存储模式写入
+	if err := sm.checkWriteSpace(len(writeData)); err != nil {
+		return 0, err
+	}
+	sm.preserveForBackup(id)
+	prevSize, existed := sm.prevUsageSize(id)
+	if policy != nil {
+		sm.pinTierLocked(id, policy.Tier)
+	}
+	if err = sm.writeBackend(id, writeData); err != nil {
 		logger.Error("写入数据块失败", "error", err)
-		return err
+		return 0, sm.noteWriteError(err)
+	}
+	sm.markConvertDirty(id)
+	sm.usage.record(id, sm.keyForIDLocked(id), uint64(len(writeData)), prevSize, existed)
+	if err := sm.recordPolicyLocked(id, policy); err != nil {
+		logger.Error("保存块策略表失败", "id", id, "error", err)
+		return 0, err
 	}
 
 	// 更新缓存
 	sm.updateCache(id, data)
 
-	return nil
+	return id, nil
 }
 
 // ReadBlock 读取块
 func (sm *StorageManagerImpl) ReadBlock(id uint32) ([]byte, error) {
+	return sm.readBlock(id)
+}
+
+// readBlock 在读锁下读取块，不记入调用方统计
+func (sm *StorageManagerImpl) readBlock(id uint32) ([]byte, error) {
 	sm.mutex.RLock()
 	defer sm.mutex.RUnlock()
 
-	// 检查缓存
-	if entry, ok := sm.blockCache.Entries[id]; ok {
-		entry.AccessCount++
-		entry.LastAccess = time.Now()
-		return entry.Data, nil
+	if sm.expiredLocked(id) {
+		return nil, ErrBlockNotFound
 	}
 
-	// 从存储读取
-	var data []byte
-	var err error
-
-	switch {
-	case sm.containerStorage != nil:
-		data, err = sm.containerStorage.ReadBlock(id)
-	case sm.directoryStorage != nil:
-		data, err = sm.directoryStorage.ReadBlock(id)
-	case sm.hybridStorage != nil:
-		// 将uint32 ID转换为string键
-		idKey := fmt.Sprintf("%d", id)
-		data, err = sm.hybridStorage.ReadBlock(idKey)
-	default:
-		return nil, ErrInvalidMode
+	// 检查缓存，命中时只锁定块所在的缓存分片
+	if data, ok := sm.blockCache.get(id, sm.clock().Now()); ok {
+		return data, nil
 	}
 
+	// 从存储读取
+	data, err := sm.readBackend(id)
 	if err != nil {
 		if err != ErrBlockNotFound {
 			logger.Error("读取数据块失败", "error", err)
@@ -338,20 +398,9 @@ func (sm *StorageManagerImpl) ReadBlock(id uint32) ([]byte, error) {
 		return nil, err
 	}
 
-	// 解密数据（如果启用）
-	if sm.encryptionEnabled && sm.securityManager != nil {
-		// 直接使用安全管理器，而不是调用DecryptBlock（避免死锁）
-		if secMgr, ok := sm.securityManager.(interface {
-			DecryptBlock(ctx context.Context, blockID uint32, data []byte) ([]byte, error)
-		}); ok {
-			data, err = secMgr.DecryptBlock(context.Background(), id, data)
-			if err != nil {
-				logger.Error("解密数据失败", "error", err)
-				return nil, err
-			}
-		} else {
-			logger.Warning("安全管理器不支持解密操作，将使用原始数据")
-		}
+	// 解密并还原变换（如果有）
+	if data, err = sm.decodeBlock(id, data); err != nil {
+		return nil, err
 	}
 
 	// 更新缓存
@@ -360,27 +409,42 @@ func (sm *StorageManagerImpl) ReadBlock(id uint32) ([]byte, error) {
 	return data, nil
 }
 
-// DeleteBlock 删除块
+// DeleteBlock 删除块，成功后通知块回调（见 AddBlockHook）。
+// ID已分配给字符串键（见 BlockKey）时返回 ErrBlockKeyConflict
 func (sm *StorageManagerImpl) DeleteBlock(id uint32) error {
+	return sm.DeleteBlockKey(NumericKey(id))
+}
+
+// deleteBlock 在写锁下解析块键并删除块，字符串键的映射一并删除，返回块的内部ID。
+// expiredOnly为true时只删除已过期的块（见 PurgeExpired），块未过期时返回errNotExpired
+func (sm *StorageManagerImpl) deleteBlock(key BlockKey, expiredOnly bool) (uint32, error) {
 	sm.mutex.Lock()
 	defer sm.mutex.Unlock()
 
-	// 从缓存中删除
-	if _, ok := sm.blockCache.Entries[id]; ok {
-		delete(sm.blockCache.Entries, id)
+	id, err := sm.resolveKey(key, false)
+	if err != nil {
+		return 0, err
+	}
+	if expiredOnly && !sm.expiredLocked(id) {
+		return 0, errNotExpired
+	}
+	if err := sm.checkRetentionLocked(id); err != nil {
+		return 0, err
 	}
 
+	// 从缓存中删除
+	sm.blockCache.remove(id)
+
 	// 从存储中删除
-	var err error
+	sm.preserveForBackup(id)
+	prevSize, existed := sm.prevUsageSize(id)
 	switch {
 	case sm.containerStorage != nil:
 		err = sm.containerStorage.DeleteBlock(id)
 	case sm.directoryStorage != nil:
 		err = sm.directoryStorage.DeleteBlock(id)
 	case sm.hybridStorage != nil:
-		// 将uint32 ID转换为string键
-		idKey := fmt.Sprintf("%d", id)
-		err = sm.hybridStorage.DeleteBlock(idKey)
+		err = sm.hybridStorage.DeleteBlock(sm.backendKey(id))
 	default:
 		err = ErrInvalidMode
 	}
@@ -388,27 +452,56 @@ func (sm *StorageManagerImpl) DeleteBlock(id uint32) error {
 	if err != nil {
 		if err != ErrBlockNotFound {
 			logger.Error("删除数据块失败", "error", err)
+		} else {
+			sm.forgetPolicyLocked(id)
+		}
+		return 0, err
+	}
+	sm.markConvertDirty(id)
+	sm.usage.forget(id, prevSize, existed)
+	sm.pinTierLocked(id, TierAuto)
+	sm.forgetPolicyLocked(id)
+
+	// 删除字符串键的映射，之后再写入该键时重新分配ID
+	if _, numeric := key.Numeric(); !numeric {
+		sm.keys.remove(id)
+		if err := sm.keys.save(); err != nil {
+			// 块已删除，块键表中残留的映射指向不存在的块，不影响读写
+			logger.Warning("保存块键表失败", "error", err)
 		}
-		return err
 	}
 
-	return nil
+	return id, nil
 }
 
 // GetBlockInfo 获取块信息
 func (sm *StorageManagerImpl) GetBlockInfo(id uint32) (*BlockInfo, error) {
 	sm.mutex.RLock()
 	defer sm.mutex.RUnlock()
+	return sm.blockInfoLocked(id)
+}
 
+// blockInfoLocked 获取块信息（调用者持有锁）
+func (sm *StorageManagerImpl) blockInfoLocked(id uint32) (*BlockInfo, error) {
+	info, err := sm.backendBlockInfo(id)
+	if err == nil {
+		entry := sm.policies.entries[id]
+		info.ExpiresAt = entry.expiresAt
+		info.RetainUntil = entry.retainUntil
+		info.LegalHold = entry.legalHold
+	}
+	return info, err
+}
+
+// backendBlockInfo 从当前存储获取块信息（调用者持有锁）
+func (sm *StorageManagerImpl) backendBlockInfo(id uint32) (*BlockInfo, error) {
 	switch {
 	case sm.containerStorage != nil:
 		return sm.containerStorage.GetBlockInfo(id)
 	case sm.directoryStorage != nil:
 		return sm.directoryStorage.GetBlockInfo(id)
 	case sm.hybridStorage != nil:
-		// 将uint32 ID转换为string键
-		idKey := fmt.Sprintf("%d", id)
-		info, _, err := sm.hybridStorage.GetBlockInfo(idKey)
+		info, _, err := sm.hybridStorage.GetBlockInfo(sm.backendKey(id))
 		// 忽略location信息，符合接口定义
 		return info, err
 	default:
@@ -416,22 +509,25 @@ func (sm *StorageManagerImpl) GetBlockInfo(id uint32) (*BlockInfo, error) {
 	}
 }
 
-// GetStats 获取统计信息
+// GetStats 获取统计信息的副本，包括按调用方标签统计的操作（见 WithCallerTag）
 func (sm *StorageManagerImpl) GetStats() (*StorageStats, error) {
 	sm.mutex.RLock()
 	defer sm.mutex.RUnlock()
 
 	// 根据存储模式获取
+	var stats StorageStats
 	switch sm.config.Type {
 	case StorageTypeContainer:
-		return sm.containerStorage.Stats, nil
+		stats = *sm.containerStorage.Stats
 	case StorageTypeDirectory:
-		return sm.directoryStorage.Stats, nil
+		stats = *sm.directoryStorage.Stats
 	case StorageTypeHybrid:
-		return sm.hybridStorage.Stats, nil
+		stats = *sm.hybridStorage.Stats
 	default:
 		return nil, ErrInvalidMode
 	}
+	stats.Callers = sm.callers.snapshot(false, time.Time{}).Callers
+	return &stats, nil
 }
 
 // Optimize 优化存储
@@ -454,6 +550,14 @@ func (sm *StorageManagerImpl) Optimize() error {
 
 // ConvertType 转换存储模式
 func (sm *StorageManagerImpl) ConvertType(newType StorageType) error {
+	return sm.convertType(newType, nil)
+}
+
+// convertType 转换存储模式，limiter不为nil时按其限速复制块数据（用于后台自动转换）。
+// 块数据先复制到临时目录存储，期间的写入和删除照常进行并被记录；切换时在锁内重新复制这些块，
+// 关闭并删除旧存储的文件后在同一路径创建新存储，再把临时存储中的块写入新存储。
+// 块按存储中的原始数据复制，加密的块不需要解密
+func (sm *StorageManagerImpl) convertType(newType StorageType, limiter *throttle.Limiter) error {
 	// 首先验证新模式，不加锁
 	if newType != StorageTypeContainer &&
 		newType != StorageTypeDirectory &&
@@ -467,249 +571,315 @@ func (sm *StorageManagerImpl) ConvertType(newType StorageType) error {
 		sm.mutex.Unlock()
 		return nil
 	}
+	if sm.convertDirty != nil {
+		sm.mutex.Unlock()
+		return fmt.Errorf("存储模式转换正在进行")
+	}
+	if sm.backup != nil {
+		sm.mutex.Unlock()
+		return fmt.Errorf("%w: 备份正在进行", ErrInvalidOperation)
+	}
+	if err := sm.checkConvertRetentionLocked(); err != nil {
+		sm.mutex.Unlock()
+		return err
+	}
+
+	// 转换期间临时目录中保存一份全部数据
+	var used uint64
+	for _, count := range sm.tierUsage() {
+		used += count.Bytes
+	}
+	if err := sm.checkWriteSpace(int(used)); err != nil {
+		sm.mutex.Unlock()
+		return err
+	}
 
-	// 记录旧模式
+	// 记录旧模式，并开始记录转换期间修改的块
 	oldType := sm.config.Type
+	sm.convertDirty = make(map[uint32]struct{})
+	ids, err := sm.blockIDs()
 	sm.mutex.Unlock()
 
-	// 获取当前存储统计（必须在锁外调用以避免死锁）
-	stats, err := sm.GetStats()
-	if err != nil {
-		logger.Error("获取存储统计失败", "error", err)
-		return fmt.Errorf("获取存储统计失败: %w", err)
-	}
-
-	// 如果没有数据，直接变更类型并初始化新的存储（加锁）
-	if stats.TotalBlocks == 0 {
+	defer func() {
 		sm.mutex.Lock()
-		sm.config.Type = newType
-
-		// 根据新类型初始化相应的存储
-		var initErr error
-		switch newType {
-		case StorageTypeContainer:
-			sm.containerStorage, initErr = sm.initContainerStorage()
-		case StorageTypeDirectory:
-			sm.directoryStorage, initErr = sm.initDirectoryStorage()
-		case StorageTypeHybrid:
-			sm.hybridStorage, initErr = sm.initHybridStorage()
-		}
-
-		if initErr != nil {
-			// 初始化失败，回滚类型
-			sm.config.Type = oldType
-			sm.mutex.Unlock()
-			logger.Error("初始化新存储失败", "error", initErr)
-			return fmt.Errorf("初始化新存储失败: %w", initErr)
-		}
-
+		sm.convertDirty = nil
 		sm.mutex.Unlock()
-		logger.Info("存储为空，直接转换模式", "旧模式", oldType, "新模式", newType)
-		return nil
-	}
+	}()
 
-	// 如果是目录模式，检查并处理文件/目录冲突
-	if newType == StorageTypeDirectory {
-		// 检查路径是否为文件
-		fileInfo, err := os.Stat(sm.config.Path)
-		if err == nil && !fileInfo.IsDir() {
-			// 删除文件之前先取得锁，确保没有其他操作正在访问文件
-			sm.mutex.Lock()
-			// 再次检查类型，防止并发修改
-			if sm.config.Type == oldType {
-				sm.mutex.Unlock()
-				// 是文件，需要删除
-				err = os.Remove(sm.config.Path)
-				if err != nil {
-					logger.Error("删除已存在的存储文件失败", "path", sm.config.Path, "error", err)
-					return fmt.Errorf("删除已存在的存储文件失败: %w", err)
-				}
-				logger.Info("已删除旧的存储文件，准备创建目录", "path", sm.config.Path)
-			} else {
-				sm.mutex.Unlock()
-				// 类型已经被其他goroutine修改，返回
-				return nil
-			}
-		}
+	if err != nil {
+		logger.Error("列出存储中的块失败", "error", err)
+		return fmt.Errorf("列出存储中的块失败: %w", err)
 	}
 
 	// 创建临时目录存储转换数据
-	tempDir, err := os.MkdirTemp("", "storage_convert_*")
+	tempDir, err := sm.fsys().MkdirTemp("", "storage_convert_*")
 	if err != nil {
 		logger.Error("创建临时目录失败", "error", err)
 		return fmt.Errorf("创建临时目录失败: %w", err)
 	}
-	defer os.RemoveAll(tempDir)
+	keepTemp := false
+	defer func() {
+		if !keepTemp {
+			sm.fsys().RemoveAll(tempDir)
+		}
+	}()
 
 	logger.Info("开始转换存储模式", "从", oldType, "到", newType, "临时目录", tempDir)
 
-	// 设置临时存储配置
-	tempConfig := &StorageConfig{
-		Type:                 StorageTypeDirectory, // 使用目录模式作为中间转换格式
-		Path:                 tempDir,
-		BlockSize:            sm.config.BlockSize,
-		AutoConvertThreshold: 0, // 禁用自动转换
-		InlineThreshold:      sm.config.InlineThreshold,
-		DedupEnabled:         sm.config.DedupEnabled,
-		CacheSize:            sm.config.CacheSize,
-		CachePolicy:          sm.config.CachePolicy,
-	}
-
-	// 创建临时存储管理器（不会启动自动检查）
-	tempSM, err := NewStorageManager(tempConfig)
+	// 临时存储使用目录模式作为中间转换格式，不需要同步到磁盘
+	tempStorage, err := NewDirectoryStorage(&StorageConfig{
+		Type:                  StorageTypeDirectory,
+		Path:                  tempDir,
+		BlockSize:             sm.config.BlockSize,
+		DirectoryLayout:       sm.config.DirectoryLayout,
+		Durability:            DurabilityNone,
+		ReplicaRepairInterval: -1,
+		Clock:                 sm.config.Clock,
+		FS:                    sm.config.FS,
+	})
 	if err != nil {
-		logger.Error("创建临时存储管理器失败", "error", err)
-		return fmt.Errorf("创建临时存储管理器失败: %w", err)
-	}
-	defer tempSM.Close()
-
-	// 通过ID范围复制数据
-	maxBlockID := uint32(stats.TotalBlocks * 2) // 使用足够大的范围
-
-	blocksCopied := 0
-	for id := uint32(0); id < maxBlockID && blocksCopied < int(stats.TotalBlocks); id++ {
-		data, err := sm.ReadBlock(id)
+		logger.Error("创建临时存储失败", "error", err)
+		return fmt.Errorf("创建临时存储失败: %w", err)
+	}
+	defer tempStorage.Close()
+
+	// 复制块到临时存储，期间不阻塞读写
+	for _, id := range ids {
+		sm.mutex.RLock()
+		data, err := sm.readBackend(id)
+		sm.mutex.RUnlock()
+		if errors.Is(err, ErrBlockNotFound) {
+			// 复制期间被删除，切换时按记录处理
+			continue
+		}
 		if err != nil {
-			// 块不存在，继续
-			if errors.Is(err, ErrBlockNotFound) {
-				continue
-			}
 			logger.Error("读取块数据失败", "id", id, "error", err)
-			continue
+			return fmt.Errorf("读取块%d失败: %w", id, err)
 		}
 
-		// 写入临时存储
-		err = tempSM.WriteBlock(id, data)
-		if err != nil {
+		limiter.Wait(context.Background(), int64(len(data)))
+		if err := tempStorage.WriteBlock(id, data); err != nil {
 			logger.Error("写入临时存储失败", "id", id, "error", err)
-			continue
+			return fmt.Errorf("写入临时存储失败: %w", err)
 		}
-
-		blocksCopied++
 	}
 
-	logger.Info("已复制块到临时存储", "总块数", stats.TotalBlocks, "实际复制", blocksCopied)
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
 
-	// 初始化新类型的存储
-	var newStorage interface{}
-	var initErr error
+	// 再次检查类型，防止并发修改
+	if sm.config.Type != oldType {
+		return fmt.Errorf("存储类型已被其他线程修改")
+	}
 
-	// 根据新类型初始化相应的存储
-	switch newType {
-	case StorageTypeContainer:
-		newStorage, initErr = sm.initContainerStorage()
-	case StorageTypeDirectory:
-		// 需要创建目录的场景
-		if oldType == StorageTypeContainer && newType == StorageTypeDirectory {
-			if err := os.MkdirAll(sm.config.Path, 0755); err != nil {
-				logger.Error("创建存储目录失败", "error", err)
-				return fmt.Errorf("创建存储目录失败: %w", err)
+	// 重新复制转换期间写入或删除的块
+	for id := range sm.convertDirty {
+		data, err := sm.readBackend(id)
+		switch {
+		case errors.Is(err, ErrBlockNotFound):
+			if err := tempStorage.DeleteBlock(id); err != nil && !errors.Is(err, ErrBlockNotFound) {
+				return fmt.Errorf("从临时存储删除块%d失败: %w", id, err)
+			}
+		case err != nil:
+			return fmt.Errorf("读取块%d失败: %w", id, err)
+		default:
+			if err := tempStorage.WriteBlock(id, data); err != nil {
+				return fmt.Errorf("写入临时存储失败: %w", err)
 			}
 		}
-		newStorage, initErr = sm.initDirectoryStorage()
-	case StorageTypeHybrid:
-		newStorage, initErr = sm.initHybridStorage()
 	}
 
-	if initErr != nil {
-		logger.Error("初始化新存储失败", "error", initErr)
-		return fmt.Errorf("初始化新存储失败: %w", initErr)
+	ids, err = tempStorage.ListBlockIDs()
+	if err != nil {
+		return fmt.Errorf("列出临时存储中的块失败: %w", err)
 	}
 
-	// 更新存储类型（加锁）
-	sm.mutex.Lock()
-	// 再次检查类型，防止并发修改
-	if sm.config.Type != oldType {
-		sm.mutex.Unlock()
-		return fmt.Errorf("存储类型已被其他线程修改")
+	// 关闭旧存储并删除其文件，新存储使用同一路径
+	if err := sm.closeBackend(); err != nil {
+		logger.Warning("关闭旧存储失败", "error", err)
+	}
+	sm.containerStorage, sm.directoryStorage, sm.hybridStorage = nil, nil, nil
+	keepTemp = true
+	if oldType == StorageTypeContainer {
+		err = sm.fsys().Remove(sm.config.Path)
+	} else {
+		err = sm.fsys().RemoveAll(sm.config.Path)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		logger.Error("删除旧存储失败", "path", sm.config.Path, "error", err)
+		return fmt.Errorf("删除旧存储失败，数据保存在%s: %w", tempDir, err)
 	}
 
-	// 更新存储管理器的存储实例
+	// 初始化新类型的存储
+	var initErr error
 	switch newType {
 	case StorageTypeContainer:
-		sm.containerStorage = newStorage.(*ContainerStorage)
+		sm.containerStorage, initErr = sm.initContainerStorage()
 	case StorageTypeDirectory:
-		sm.directoryStorage = newStorage.(*DirectoryStorage)
+		sm.directoryStorage, initErr = sm.initDirectoryStorage()
 	case StorageTypeHybrid:
-		sm.hybridStorage = newStorage.(*HybridStorage)
+		if initErr = sm.fsys().MkdirAll(sm.config.Path, 0755); initErr == nil {
+			sm.hybridStorage, initErr = sm.initHybridStorage()
+		}
+		if initErr == nil {
+			for id, entry := range sm.policies.entries {
+				sm.pinTierLocked(id, entry.tier)
+			}
+		}
+	}
+	if initErr != nil {
+		logger.Error("初始化新存储失败", "error", initErr, "临时目录", tempDir)
+		return fmt.Errorf("初始化新存储失败，数据保存在%s: %w", tempDir, initErr)
 	}
-
-	// 更新类型
 	sm.config.Type = newType
-	sm.mutex.Unlock()
 
 	// 从临时存储复制回主存储
-	restoredBlocks := 0
-	for id := uint32(0); id < maxBlockID; id++ {
-		data, err := tempSM.ReadBlock(id)
-		if err != nil {
-			// 块不存在，继续
-			if errors.Is(err, ErrBlockNotFound) {
-				continue
-			}
-			logger.Error("从临时存储读取块失败", "id", id, "error", err)
-			continue
+	for _, id := range ids {
+		data, err := tempStorage.ReadBlock(id)
+		if err == nil {
+			err = sm.writeBackend(id, data)
 		}
-
-		err = sm.WriteBlock(id, data)
 		if err != nil {
-			logger.Error("写回主存储失败", "id", id, "error", err)
-			continue
+			logger.Error("写回主存储失败", "id", id, "error", err, "临时目录", tempDir)
+			return fmt.Errorf("写回块%d失败，数据保存在%s: %w", id, tempDir, err)
 		}
-		restoredBlocks++
 	}
 
+	restored, err := sm.blockIDs()
+	if err == nil && len(restored) != len(ids) {
+		err = fmt.Errorf("块数不一致: 期望%d，实际%d", len(ids), len(restored))
+	}
+	if err != nil {
+		logger.Error("校验转换结果失败", "error", err, "临时目录", tempDir)
+		return fmt.Errorf("校验转换结果失败，数据保存在%s: %w", tempDir, err)
+	}
+	keepTemp = false
+
 	logger.Info("存储模式转换成功",
 		"旧模式", oldType,
 		"新模式", newType,
-		"块数", blocksCopied,
-		"恢复块数", restoredBlocks)
+		"块数", len(ids))
 
 	return nil
 }
 
-// 内部辅助方法
+// clock 返回配置的时钟
+func (sm *StorageManagerImpl) clock() clock.Clock {
+	return clock.OrSystem(sm.config.Clock)
+}
 
-// NewContainerStorage 创建新的容器存储
-func NewContainerStorage(config *StorageConfig) (*ContainerStorage, error) {
-	if config.Path == "" {
-		return nil, errors.New("path not specified")
+// fsys 返回配置的文件系统
+func (sm *StorageManagerImpl) fsys() vfs.FS {
+	return vfs.OrOS(sm.config.FS)
+}
+
+// markConvertDirty 在模式转换期间记录被修改的块（调用者持有写锁）
+func (sm *StorageManagerImpl) markConvertDirty(id uint32) {
+	if sm.convertDirty != nil {
+		sm.convertDirty[id] = struct{}{}
+	}
+}
+
+// readBackend 从当前存储读取块的原始数据（调用者持有锁）
+func (sm *StorageManagerImpl) readBackend(id uint32) ([]byte, error) {
+	switch {
+	case sm.containerStorage != nil:
+		return sm.containerStorage.ReadBlock(id)
+	case sm.directoryStorage != nil:
+		return sm.directoryStorage.ReadBlock(id)
+	case sm.hybridStorage != nil:
+		return sm.hybridStorage.ReadBlock(sm.backendKey(id))
+	default:
+		return nil, ErrInvalidMode
 	}
+}
 
-	// 检查文件是否存在
-	_, err := os.Stat(config.Path)
-	if os.IsNotExist(err) {
-		// 创建新文件
-		file, err := os.Create(config.Path)
+// writeBackend 向当前存储写入块的原始数据（调用者持有写锁）
+func (sm *StorageManagerImpl) writeBackend(id uint32, data []byte) error {
+	switch {
+	case sm.containerStorage != nil:
+		return sm.containerStorage.WriteBlock(id, data)
+	case sm.directoryStorage != nil:
+		return sm.directoryStorage.WriteBlock(id, data)
+	case sm.hybridStorage != nil:
+		return sm.hybridStorage.WriteBlock(sm.backendKey(id), data)
+	default:
+		return ErrInvalidMode
+	}
+}
+
+// blockIDs 列出当前存储中的所有块ID（调用者持有锁）
+func (sm *StorageManagerImpl) blockIDs() ([]uint32, error) {
+	switch {
+	case sm.containerStorage != nil:
+		cs := sm.containerStorage
+		cs.mutex.RLock()
+		defer cs.mutex.RUnlock()
+		ids := make([]uint32, 0, len(cs.BlockMap))
+		for id := range cs.BlockMap {
+			ids = append(ids, id)
+		}
+		return ids, nil
+	case sm.directoryStorage != nil:
+		return sm.directoryStorage.ListBlockIDs()
+	case sm.hybridStorage != nil:
+		keys, err := sm.hybridStorage.ListBlockKeys()
 		if err != nil {
-			logger.Error("创建新文件失败", "error", err)
 			return nil, err
 		}
-
-		cs := &ContainerStorage{
-			Path:          config.Path,
-			File:          file,
-			BlockMap:      make(map[uint32]uint64),
-			FreeSpaceList: []interface{}{},
-			Stats: &StorageStats{
-				TotalBlocks:        0,
-				TotalSize:          0,
-				UsedSpace:          0,
-				FreeSpace:          0,
-				FragmentationRatio: 0.0,
-			},
+		ids := make([]uint32, 0, len(keys))
+		for _, key := range keys {
+			id, ok := sm.hybridKeyID(key)
+			if !ok {
+				return nil, fmt.Errorf("%w: %s", ErrInvalidBlockKey, key)
+			}
+			ids = append(ids, id)
 		}
+		return ids, nil
+	default:
+		return nil, ErrInvalidMode
+	}
+}
+
+// closeBackend 关闭当前存储（调用者持有写锁）
+func (sm *StorageManagerImpl) closeBackend() error {
+	switch {
+	case sm.containerStorage != nil:
+		return sm.containerStorage.Close()
+	case sm.directoryStorage != nil:
+		return sm.directoryStorage.Close()
+	case sm.hybridStorage != nil:
+		return sm.hybridStorage.Close()
+	default:
+		return nil
+	}
+}
 
-		return cs, nil
-	} else if err != nil {
-		logger.Error("检查文件是否存在失败", "error", err)
+// 内部辅助方法
+
+// NewContainerStorage 创建或打开容器存储
+func NewContainerStorage(config *StorageConfig) (*ContainerStorage, error) {
+	if config.Path == "" {
+		return nil, errors.New("path not specified")
+	}
+
+	policy := config.AllocationPolicy
+	switch policy {
+	case "":
+		policy = AllocBestFit
+	case AllocBestFit, AllocFirstFit:
+	default:
+		return nil, fmt.Errorf("不支持的空间分配策略: %s", policy)
+	}
+
+	durability, err := newDurability(config)
+	if err != nil {
 		return nil, err
 	}
 
-	// 打开现有文件
-	file, err := os.OpenFile(config.Path, os.O_RDWR, 0)
+	file, err := vfs.OrOS(config.FS).OpenFile(config.Path, os.O_RDWR|os.O_CREATE, 0644)
 	if err != nil {
-		logger.Error("打开现有文件失败", "error", err)
+		logger.Error("打开容器文件失败", "error", err)
 		return nil, err
 	}
 
@@ -717,19 +887,39 @@ func NewContainerStorage(config *StorageConfig) (*ContainerStorage, error) {
 		Path:          config.Path,
 		File:          file,
 		BlockMap:      make(map[uint32]uint64),
-		FreeSpaceList: []interface{}{},
-		Stats: &StorageStats{
-			TotalBlocks:        0,
-			TotalSize:          0,
-			UsedSpace:          0,
-			FreeSpace:          0,
-			FragmentationRatio: 0.0,
-		},
+		FreeSpaceList: []FreeExtent{},
+		AllocPolicy:   policy,
+		dataEnd:       containerHeaderSize,
+		Stats:         &StorageStats{},
+
+		holePunch:          !config.DisableHolePunch,
+		holePunchThreshold: config.HolePunchThreshold,
+		durability:         durability,
+	}
+	if cs.holePunchThreshold == 0 {
+		cs.holePunchThreshold = defaultHolePunchThreshold
 	}
 
-	// 加载块映射
-	// 实际实现应从文件中加载
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		logger.Error("获取容器文件信息失败", "error", err)
+		return nil, err
+	}
+
+	if info.Size() == 0 {
+		// 新文件，写入空的文件头
+		if err := cs.writeContainerHeader(0, 0); err != nil {
+			file.Close()
+			return nil, err
+		}
+	} else if err := cs.load(info.Size()); err != nil {
+		file.Close()
+		return nil, err
+	}
 
+	cs.updateStats()
+	cs.durability.start(cs.syncData)
 	return cs, nil
 }
 
@@ -739,8 +929,20 @@ func NewDirectoryStorage(config *StorageConfig) (*DirectoryStorage, error) {
 		return nil, errors.New("path not specified")
 	}
 
+	layout, err := resolveDirectoryLayout(config)
+	if err != nil {
+		logger.Error("目录布局配置无效", "error", err)
+		return nil, err
+	}
+
+	durability, err := newDurability(config)
+	if err != nil {
+		return nil, err
+	}
+
 	// 确保目录存在
-	err := os.MkdirAll(config.Path, 0755)
+	fsys := vfs.OrOS(config.FS)
+	err = fsys.MkdirAll(config.Path, 0755)
 	if err != nil {
 		logger.Error("创建目录失败", "error", err)
 		return nil, err
@@ -748,14 +950,14 @@ func NewDirectoryStorage(config *StorageConfig) (*DirectoryStorage, error) {
 
 	// 创建子目录
 	blocksPath := filepath.Join(config.Path, "blocks")
-	err = os.MkdirAll(blocksPath, 0755)
+	err = fsys.MkdirAll(blocksPath, 0755)
 	if err != nil {
 		logger.Error("创建子目录失败", "error", err)
 		return nil, err
 	}
 
 	tempPath := filepath.Join(config.Path, "temp")
-	err = os.MkdirAll(tempPath, 0755)
+	err = fsys.MkdirAll(tempPath, 0755)
 	if err != nil {
 		logger.Error("创建临时目录失败", "error", err)
 		return nil, err
@@ -767,6 +969,7 @@ func NewDirectoryStorage(config *StorageConfig) (*DirectoryStorage, error) {
 		BlocksPath: blocksPath,
 		TempPath:   tempPath,
 		BlockMap:   make(map[uint32]string),
+		Layout:     layout,
 		Stats: &StorageStats{
 			TotalBlocks:        0,
 			TotalSize:          0,
@@ -774,11 +977,28 @@ func NewDirectoryStorage(config *StorageConfig) (*DirectoryStorage, error) {
 			FreeSpace:          0,
 			FragmentationRatio: 0.0,
 		},
+		durability: durability,
+		unsynced:   make(map[string]struct{}),
+		fdCache:    config.FDCache,
+		workers:    config.Workers,
+		fs:         fsys,
+		clock:      clock.OrSystem(config.Clock),
+	}
+
+	if err := ds.initReplicas(config); err != nil {
+		logger.Error("副本配置无效", "error", err)
+		return nil, err
 	}
 
 	// 加载块映射
-	// 实际实现应从meta.idx文件中加载
+	if err := ds.loadMetaIndex(); err != nil {
+		return nil, err
+	}
 
+	ds.durability.start(ds.syncBlocks)
+	if config.ReplicaRepairInterval >= 0 {
+		ds.StartReplicaRepair(config.ReplicaRepairInterval)
+	}
 	return ds, nil
 }
 
@@ -804,84 +1024,11 @@ func (sm *StorageManagerImpl) initHybridStorage() (*HybridStorage, error) {
 
 // updateCache 更新缓存
 func (sm *StorageManagerImpl) updateCache(id uint32, data []byte) {
-	// 检查缓存空间
-	if uint64(len(data)) > sm.blockCache.MaxSize {
-		return // 数据过大，不缓存
-	}
-
-	// 如果已存在，先移除
-	if entry, ok := sm.blockCache.Entries[id]; ok {
-		sm.blockCache.CurrentSize -= uint64(len(entry.Data))
-	}
-
-	// 需要清理缓存
-	if sm.blockCache.CurrentSize+uint64(len(data)) > sm.blockCache.MaxSize {
-		sm.evictCache(uint64(len(data)))
-	}
-
-	// 添加到缓存
-	sm.blockCache.Entries[id] = &CacheEntry{
-		BlockID:     id,
-		Data:        data,
-		AccessCount: 1,
-		LastAccess:  time.Now(),
-	}
-	sm.blockCache.CurrentSize += uint64(len(data))
-}
-
-// evictCache 清理缓存
-func (sm *StorageManagerImpl) evictCache(requiredSpace uint64) {
-	// 简单LRU实现
-	if sm.blockCache.Policy == "lru" {
-		// 按最后访问时间排序
-		type cacheItem struct {
-			id         uint32
-			lastAccess time.Time
-			size       uint64
-		}
-
-		items := make([]cacheItem, 0, len(sm.blockCache.Entries))
-		for id, entry := range sm.blockCache.Entries {
-			items = append(items, cacheItem{
-				id:         id,
-				lastAccess: entry.LastAccess,
-				size:       uint64(len(entry.Data)),
-			})
-		}
-
-		// 按访问时间排序
-		for i := 0; i < len(items)-1; i++ {
-			for j := i + 1; j < len(items); j++ {
-				if items[i].lastAccess.After(items[j].lastAccess) {
-					items[i], items[j] = items[j], items[i]
-				}
-			}
-		}
-
-		// 从最旧的开始移除
-		spaceFreed := uint64(0)
-		for _, item := range items {
-			if spaceFreed >= requiredSpace {
-				break
-			}
-
-			entry, ok := sm.blockCache.Entries[item.id]
-			if ok {
-				spaceFreed += uint64(len(entry.Data))
-				sm.blockCache.CurrentSize -= uint64(len(entry.Data))
-				delete(sm.blockCache.Entries, item.id)
-			}
-		}
-	}
+	sm.blockCache.put(id, data, sm.clock().Now())
 }
 
 // checkAndAutoConvert 检查是否需要自动转换存储模式
 func (sm *StorageManagerImpl) checkAndAutoConvert() {
-	// 仅当配置了自动转换阈值时才检查
-	if sm.config.AutoConvertThreshold <= 0 {
-		return
-	}
-
 	// 获取当前统计信息（获取读锁）
 	sm.mutex.RLock()
 	stats, err := sm.getStatsNoLock()
@@ -889,6 +1036,11 @@ func (sm *StorageManagerImpl) checkAndAutoConvert() {
 	threshold := sm.config.AutoConvertThreshold
 	sm.mutex.RUnlock()
 
+	// 仅当配置了自动转换阈值时才检查，阈值可能在运行时被关闭
+	if threshold <= 0 {
+		return
+	}
+
 	if err != nil {
 		logger.Error("获取存储统计信息失败", "error", err)
 		return
@@ -907,7 +1059,12 @@ func (sm *StorageManagerImpl) checkAndAutoConvert() {
 			"原因", reason)
 
 		// 执行转换（转换函数会加自己的锁）
-		err = sm.ConvertType(recommendedMode)
+		err = sm.convertType(recommendedMode, sm.config.BackgroundThrottle)
+		if errors.Is(err, ErrRetained) {
+			// 保留期过后的检查中再转换
+			logger.Info("有块处于保留中，推迟自动转换存储模式", "error", err)
+			return
+		}
 		if err != nil {
 			logger.Error("自动转换存储模式失败", "error", err)
 			return
@@ -989,12 +1146,12 @@ func (sm *StorageManagerImpl) startAutoCheck() {
 	// 设置检查间隔，根据存储大小自动调整
 	checkInterval := 30 * time.Second
 
-	ticker := time.NewTicker(checkInterval)
+	ticker := sm.clock().NewTicker(checkInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-ticker.C:
+		case <-ticker.C():
 			// 获取统计信息
 			stats, err := sm.GetStats()
 			if err != nil {
@@ -1012,10 +1169,12 @@ func (sm *StorageManagerImpl) startAutoCheck() {
 			}
 			ticker.Reset(checkInterval)
 
-			// 在非IO高峰期检查是否需要转换模式
-			sm.mutex.Lock()
+			// 检查是否需要转换模式，checkAndAutoConvert和转换过程自行加锁
 			sm.checkAndAutoConvert()
-			sm.mutex.Unlock()
+
+			if _, err := sm.PurgeExpired(); err != nil {
+				logger.Error("自动检查删除过期的块失败", "error", err)
+			}
 
 		case <-sm.autoCheckStopCh:
 			return
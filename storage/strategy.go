@@ -6,6 +6,8 @@ import (
 	"sort"
 	"sync"
 	"time"
+
+	"github.com/bpfs/fragmenta/clock"
 )
 
 // StorageLocation 表示块存储的位置类型
@@ -70,6 +72,15 @@ type StrategyConfig struct {
 	AutoBalanceEnabled bool
 	// StrategyName 策略名称
 	StrategyName string
+	// Scorer 外部评分回调，仅用于"scored"策略
+	Scorer PlacementScorer
+	// Clock 判断冷块和计算评分使用的时钟，nil表示使用系统时钟
+	Clock clock.Clock
+}
+
+// now 返回策略使用的当前时间
+func (c *StrategyConfig) now() time.Time {
+	return clock.OrSystem(c.Clock).Now()
 }
 
 // NewDefaultStrategyConfig 创建默认的策略配置
@@ -98,6 +109,16 @@ type BlockAccessRecord struct {
 	Size int64
 	// CurrentLocation 是当前存储位置
 	CurrentLocation StorageLocation
+	// HourOfWeekCounts 按一周中的小时(周日0点为0)统计的访问次数，用于捕捉周期性访问模式
+	HourOfWeekCounts [HoursPerWeek]uint32
+}
+
+// HoursPerWeek 一周的小时数
+const HoursPerWeek = 7 * 24
+
+// hourOfWeek 返回时间在一周中的小时序号
+func hourOfWeek(t time.Time) int {
+	return int(t.Weekday())*24 + t.Hour()
 }
 
 // IsHot 判断块是否是热块
@@ -105,16 +126,16 @@ func (r *BlockAccessRecord) IsHot(threshold int) bool {
 	return r.AccessCount >= threshold
 }
 
-// IsCold 判断块是否是冷块
-func (r *BlockAccessRecord) IsCold(thresholdMinutes int) bool {
-	return time.Since(r.LastAccessTime) > time.Duration(thresholdMinutes)*time.Minute
+// IsCold 判断块在now时是否是冷块
+func (r *BlockAccessRecord) IsCold(now time.Time, thresholdMinutes int) bool {
+	return now.Sub(r.LastAccessTime) > time.Duration(thresholdMinutes)*time.Minute
 }
 
-// GetScore 获取块的重要性评分
+// GetScore 获取块在now时的重要性评分
 // 综合考虑访问频率和最近性，返回0-1.0的分数
-func (r *BlockAccessRecord) GetScore() float64 {
+func (r *BlockAccessRecord) GetScore(now time.Time) float64 {
 	// 基础分数：考虑访问次数（正相关）和最后访问时间（反相关）
-	timeFactor := 1.0 - float64(time.Since(r.LastAccessTime))/float64(24*time.Hour)
+	timeFactor := 1.0 - float64(now.Sub(r.LastAccessTime))/float64(24*time.Hour)
 	if timeFactor < 0 {
 		timeFactor = 0
 	}
@@ -157,7 +178,7 @@ func (at *AccessTracker) RecordAccess(blockKey string, size int64, location Stor
 	at.mutex.Lock()
 	defer at.mutex.Unlock()
 
-	now := time.Now()
+	now := at.config.now()
 	record, exists := at.records[blockKey]
 
 	if !exists {
@@ -169,11 +190,13 @@ func (at *AccessTracker) RecordAccess(blockKey string, size int64, location Stor
 			Size:            size,
 			CurrentLocation: location,
 		}
+		record.HourOfWeekCounts[hourOfWeek(now)]++
 		at.records[blockKey] = record
 	} else {
 		record.AccessCount++
 		record.LastAccessTime = now
 		record.CurrentLocation = location
+		record.HourOfWeekCounts[hourOfWeek(now)]++
 		if size > 0 {
 			record.Size = size
 		}
@@ -194,6 +217,16 @@ func (at *AccessTracker) UpdateLocation(blockKey string, location StorageLocatio
 	}
 }
 
+// RemoveRecord 删除块的访问记录
+func (at *AccessTracker) RemoveRecord(blockKey string) {
+	at.mutex.Lock()
+	defer at.mutex.Unlock()
+
+	delete(at.records, blockKey)
+	delete(at.hotBlocks, blockKey)
+	delete(at.coldBlocks, blockKey)
+}
+
 // GetBlockAccessRecord 获取块的访问记录
 func (at *AccessTracker) GetBlockAccessRecord(blockKey string) *BlockAccessRecord {
 	at.mutex.RLock()
@@ -203,12 +236,13 @@ func (at *AccessTracker) GetBlockAccessRecord(blockKey string) *BlockAccessRecor
 	if exists {
 		// 返回副本以避免并发访问问题
 		return &BlockAccessRecord{
-			BlockKey:        record.BlockKey,
-			AccessCount:     record.AccessCount,
-			LastAccessTime:  record.LastAccessTime,
-			FirstAccessTime: record.FirstAccessTime,
-			Size:            record.Size,
-			CurrentLocation: record.CurrentLocation,
+			BlockKey:         record.BlockKey,
+			AccessCount:      record.AccessCount,
+			LastAccessTime:   record.LastAccessTime,
+			FirstAccessTime:  record.FirstAccessTime,
+			Size:             record.Size,
+			CurrentLocation:  record.CurrentLocation,
+			HourOfWeekCounts: record.HourOfWeekCounts,
 		}
 	}
 
@@ -251,7 +285,7 @@ func (at *AccessTracker) updateHotAndColdStatus(blockKey string, record *BlockAc
 	}
 
 	// 冷块判断
-	if record.IsCold(at.config.ColdBlockTimeMinutes) {
+	if record.IsCold(at.config.now(), at.config.ColdBlockTimeMinutes) {
 		at.coldBlocks[blockKey] = struct{}{}
 	} else {
 		delete(at.coldBlocks, blockKey)
@@ -274,11 +308,12 @@ func (at *AccessTracker) CleanupRecords(maxRecords, keepRecords int) {
 		score float64
 	}
 
+	now := at.config.now()
 	scoredRecords := make([]scoredRecord, 0, len(at.records))
 	for key, record := range at.records {
 		scoredRecords = append(scoredRecords, scoredRecord{
 			key:   key,
-			score: record.GetScore(),
+			score: record.GetScore(now),
 		})
 	}
 
@@ -311,12 +346,20 @@ func (at *AccessTracker) rebuildHotAndColdSets() {
 			at.hotBlocks[key] = struct{}{}
 		}
 
-		if record.IsCold(at.config.ColdBlockTimeMinutes) {
+		if record.IsCold(at.config.now(), at.config.ColdBlockTimeMinutes) {
 			at.coldBlocks[key] = struct{}{}
 		}
 	}
 }
 
+// RefreshStatus 根据当前时间重新计算热块和冷块集合
+func (at *AccessTracker) RefreshStatus() {
+	at.mutex.Lock()
+	defer at.mutex.Unlock()
+
+	at.rebuildHotAndColdSets()
+}
+
 // CleanupColdBlocks 清理冷块记录中不再是冷块的记录
 func (at *AccessTracker) CleanupColdBlocks() {
 	at.mutex.Lock()
@@ -324,7 +367,7 @@ func (at *AccessTracker) CleanupColdBlocks() {
 
 	for key := range at.coldBlocks {
 		record, exists := at.records[key]
-		if !exists || !record.IsCold(at.config.ColdBlockTimeMinutes) {
+		if !exists || !record.IsCold(at.config.now(), at.config.ColdBlockTimeMinutes) {
 			delete(at.coldBlocks, key)
 		}
 	}
@@ -525,7 +568,7 @@ func (a *AdaptiveStrategy) DecideLocation(blockKey string, size int64, accessRec
 	}
 
 	// 冷块倾向于放入目录存储
-	if accessRecord.IsCold(a.config.ColdBlockTimeMinutes) {
+	if accessRecord.IsCold(a.config.now(), a.config.ColdBlockTimeMinutes) {
 		return StorageDecision{
 			Location: LocationDirectory,
 			Reason:   fmt.Sprintf("冷块(最后访问时间=%v)放入目录存储", accessRecord.LastAccessTime),
@@ -731,6 +774,11 @@ func (f *StorageStrategyFactory) CreateStrategy(config *StrategyConfig) (Storage
 		return NewSimpleThresholdStrategy(config), nil
 	case "adaptive":
 		return NewAdaptiveStrategy(config), nil
+	case "scored":
+		if config.Scorer == nil {
+			return nil, fmt.Errorf("scored strategy requires a scorer")
+		}
+		return NewScoredStrategy(config, config.Scorer, NewAdaptiveStrategy(config)), nil
 	default:
 		return nil, fmt.Errorf("unsupported strategy name: %s", config.StrategyName)
 	}
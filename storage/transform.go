@@ -0,0 +1,389 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// BlockTransform 块写入和读取路径上的数据变换，如压缩、加密、签名或自定义处理。
+// 写入时按管道顺序调用Apply，所用变换的名称记录在块中；读取时按记录逆序调用Revert，
+// 因此调整管道后旧块仍然可读，只要其用到的变换仍已注册（见 StorageManagerImpl.RegisterTransform）。
+// gzip和使用安全管理器的encrypt是内置的，不需要注册
+type BlockTransform interface {
+	// Name 变换名称，记录在块中用于读取时查找变换，不能为空且不超过255字节
+	Name() string
+
+	// Apply 写入时变换数据，不能修改data
+	Apply(ctx context.Context, id uint32, data []byte) ([]byte, error)
+
+	// Revert 读取时还原Apply的结果，不能修改data
+	Revert(ctx context.Context, id uint32, data []byte) ([]byte, error)
+}
+
+// 变换相关错误
+var (
+	// ErrUnknownTransform 表示块记录的变换没有注册，无法还原
+	ErrUnknownTransform = errors.New("块使用的变换未注册")
+
+	// ErrSignatureInvalid 表示块的签名校验失败，见 HMACTransform
+	ErrSignatureInvalid = errors.New("块签名校验失败")
+)
+
+// transformMagic 变换信封的魔数。信封格式：魔数、版本、变换数、
+// 各变换的名称（1字节长度+名称）、以上内容的CRC32-C，之后是变换后的数据
+var transformMagic = [4]byte{'F', 'G', 'T', 'X'}
+
+// transformVersion 变换信封的版本
+const transformVersion = 1
+
+// transformHeaderMin 最短信封头的长度（没有变换时）
+const transformHeaderMin = len(transformMagic) + 2 + 4
+
+// encodeTransformEnvelope 在变换后的数据前加上记录变换名称的信封头
+func encodeTransformEnvelope(names []string, payload []byte) []byte {
+	size := transformHeaderMin + len(payload)
+	for _, name := range names {
+		size += 1 + len(name)
+	}
+	buf := make([]byte, 0, size)
+	buf = append(buf, transformMagic[:]...)
+	buf = append(buf, transformVersion, byte(len(names)))
+	for _, name := range names {
+		buf = append(buf, byte(len(name)))
+		buf = append(buf, name...)
+	}
+	buf = binary.LittleEndian.AppendUint32(buf, crc32.Checksum(buf, metaIndexCRCTable))
+	return append(buf, payload...)
+}
+
+// hasTransformMagic 返回data是否以信封魔数和版本开头，用于决定局部读取是否需要读取整块
+func hasTransformMagic(data []byte) bool {
+	return len(data) >= len(transformMagic)+1 &&
+		bytes.Equal(data[:len(transformMagic)], transformMagic[:]) && data[len(transformMagic)] == transformVersion
+}
+
+// decodeTransformEnvelope 解析信封头，返回变换名称和变换后的数据。
+// 不是完整有效的信封头时ok为false，data按未经变换的旧格式块处理
+func decodeTransformEnvelope(data []byte) (names []string, payload []byte, ok bool) {
+	if len(data) < transformHeaderMin || !hasTransformMagic(data) {
+		return nil, nil, false
+	}
+	count := int(data[len(transformMagic)+1])
+	pos := len(transformMagic) + 2
+	names = make([]string, 0, count)
+	for range count {
+		if pos >= len(data) {
+			return nil, nil, false
+		}
+		n := int(data[pos])
+		pos++
+		if n == 0 || pos+n > len(data) {
+			return nil, nil, false
+		}
+		names = append(names, string(data[pos:pos+n]))
+		pos += n
+	}
+	if pos+4 > len(data) || binary.LittleEndian.Uint32(data[pos:]) != crc32.Checksum(data[:pos], metaIndexCRCTable) {
+		return nil, nil, false
+	}
+	return names, data[pos+4:], true
+}
+
+// checkTransform 检查变换名称是否可以记录在信封中
+func checkTransform(t BlockTransform) error {
+	if t == nil {
+		return fmt.Errorf("%w: nil transform", ErrInvalidOperation)
+	}
+	if name := t.Name(); name == "" || len(name) > 255 {
+		return fmt.Errorf("%w: transform name %q", ErrInvalidOperation, name)
+	}
+	return nil
+}
+
+// RegisterTransform 注册变换但不加入写入管道，用于读取以前用该变换写入的块。
+// 同名变换已注册时替换
+func (sm *StorageManagerImpl) RegisterTransform(t BlockTransform) error {
+	if err := checkTransform(t); err != nil {
+		return err
+	}
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	sm.registerTransformLocked(t)
+	return nil
+}
+
+// registerTransformLocked 注册变换，调用者持有写锁
+func (sm *StorageManagerImpl) registerTransformLocked(t BlockTransform) {
+	if sm.transforms == nil {
+		sm.transforms = make(map[string]BlockTransform)
+	}
+	sm.transforms[t.Name()] = t
+}
+
+// SetTransformPipeline 设置写入管道，之后写入的块依次经过transforms并记录所用变换，
+// 管道中的变换同时被注册。不传参数时清空管道，之后写入的块不再经过变换，已写入的块仍按记录还原。
+// 启用加密（见 SetEncryptionEnabled）时，加密在管道和信封之外进行；需要先加密再签名时，
+// 应把 EncryptTransform 放入管道而不是启用加密
+func (sm *StorageManagerImpl) SetTransformPipeline(transforms ...BlockTransform) error {
+	names := make(map[string]struct{}, len(transforms))
+	for _, t := range transforms {
+		if err := checkTransform(t); err != nil {
+			return err
+		}
+		if _, dup := names[t.Name()]; dup {
+			return fmt.Errorf("%w: duplicate transform %q", ErrInvalidOperation, t.Name())
+		}
+		names[t.Name()] = struct{}{}
+	}
+	if len(transforms) > 255 {
+		return fmt.Errorf("%w: too many transforms", ErrInvalidOperation)
+	}
+
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+	for _, t := range transforms {
+		sm.registerTransformLocked(t)
+	}
+	sm.pipeline = append([]BlockTransform(nil), transforms...)
+	return nil
+}
+
+// TransformPipeline 返回当前写入管道中各变换的名称
+func (sm *StorageManagerImpl) TransformPipeline() []string {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	names := make([]string, len(sm.pipeline))
+	for i, t := range sm.pipeline {
+		names[i] = t.Name()
+	}
+	return names
+}
+
+// BlockTransforms 返回写入块时记录的变换名称（按写入时的应用顺序），未经变换的块返回空
+func (sm *StorageManagerImpl) BlockTransforms(id uint32) ([]string, error) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	data, err := sm.readBackend(id)
+	if err != nil {
+		return nil, err
+	}
+	if data, err = sm.decryptLocked(id, data); err != nil {
+		return nil, err
+	}
+	names, _, _ := decodeTransformEnvelope(data)
+	return names, nil
+}
+
+// encodeBlock 依次应用pipeline中的变换、加上信封并加密（如果启用），返回写入存储的数据。
+// pipeline为空时不加信封，与没有变换管道时的格式相同；但数据本身以信封魔数开头时加上没有变换的信封，
+// 避免读取时被误当作信封解析。调用者持有写锁
+func (sm *StorageManagerImpl) encodeBlock(id uint32, data []byte, pipeline []BlockTransform) ([]byte, error) {
+	if len(pipeline) > 0 || hasTransformMagic(data) {
+		names := make([]string, len(pipeline))
+		for i, t := range pipeline {
+			out, err := t.Apply(context.Background(), id, data)
+			if err != nil {
+				logger.Error("块数据变换失败", "id", id, "transform", t.Name(), "error", err)
+				return nil, err
+			}
+			data = out
+			names[i] = t.Name()
+		}
+		data = encodeTransformEnvelope(names, data)
+	}
+	return sm.encryptLocked(id, data)
+}
+
+// decodeBlock 解密（如果启用）并按信封中记录的变换逆序还原块数据，调用者持有锁
+func (sm *StorageManagerImpl) decodeBlock(id uint32, data []byte) ([]byte, error) {
+	data, err := sm.decryptLocked(id, data)
+	if err != nil {
+		return nil, err
+	}
+	names, payload, ok := decodeTransformEnvelope(data)
+	if !ok {
+		return data, nil
+	}
+	for i := len(names) - 1; i >= 0; i-- {
+		t, found := sm.transformByName(names[i])
+		if !found {
+			return nil, fmt.Errorf("%w: block %d: %s", ErrUnknownTransform, id, names[i])
+		}
+		if payload, err = t.Revert(context.Background(), id, payload); err != nil {
+			logger.Error("还原块数据变换失败", "id", id, "transform", names[i], "error", err)
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+// encryptLocked 启用加密时用安全管理器加密数据，调用者持有锁。
+// 直接使用安全管理器，而不是调用EncryptBlock（避免死锁）
+func (sm *StorageManagerImpl) encryptLocked(id uint32, data []byte) ([]byte, error) {
+	if !sm.encryptionEnabled || sm.securityManager == nil {
+		return data, nil
+	}
+	secMgr, ok := sm.securityManager.(interface {
+		EncryptBlock(ctx context.Context, blockID uint32, data []byte) ([]byte, error)
+	})
+	if !ok {
+		logger.Warning("安全管理器不支持加密操作，将使用原始数据")
+		return data, nil
+	}
+	encrypted, err := secMgr.EncryptBlock(context.Background(), id, data)
+	if err != nil {
+		logger.Error("加密数据失败", "error", err)
+		return nil, err
+	}
+	return encrypted, nil
+}
+
+// decryptLocked 启用加密时用安全管理器解密数据，调用者持有锁
+func (sm *StorageManagerImpl) decryptLocked(id uint32, data []byte) ([]byte, error) {
+	if !sm.encryptionEnabled || sm.securityManager == nil {
+		return data, nil
+	}
+	secMgr, ok := sm.securityManager.(interface {
+		DecryptBlock(ctx context.Context, blockID uint32, data []byte) ([]byte, error)
+	})
+	if !ok {
+		logger.Warning("安全管理器不支持解密操作，将使用原始数据")
+		return data, nil
+	}
+	decrypted, err := secMgr.DecryptBlock(context.Background(), id, data)
+	if err != nil {
+		logger.Error("解密数据失败", "error", err)
+		return nil, err
+	}
+	return decrypted, nil
+}
+
+// GzipTransform gzip压缩变换，名称为"gzip"
+type GzipTransform struct {
+	// Level 压缩级别，0表示 gzip.DefaultCompression
+	Level int
+}
+
+// Name 实现 BlockTransform
+func (t *GzipTransform) Name() string { return "gzip" }
+
+// Apply 压缩数据
+func (t *GzipTransform) Apply(_ context.Context, _ uint32, data []byte) ([]byte, error) {
+	level := t.Level
+	if level == 0 {
+		level = gzip.DefaultCompression
+	}
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, level)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Revert 解压数据，数据不是有效的gzip流时返回 CorruptedError
+func (t *GzipTransform) Revert(_ context.Context, id uint32, data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, &CorruptedError{Block: id, Err: err}
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return nil, &CorruptedError{Block: id, Err: err}
+	}
+	return out, nil
+}
+
+// BlockEncrypter 按块加解密数据，security.SecurityManager 和 KeyRotator 都实现了该接口
+type BlockEncrypter interface {
+	EncryptBlock(ctx context.Context, blockID uint32, data []byte) ([]byte, error)
+	DecryptBlock(ctx context.Context, blockID uint32, data []byte) ([]byte, error)
+}
+
+// ObjectEncrypter 用对象（或租户）的数据密钥加密块，销毁数据密钥即可使对象的块无法恢复，
+// security.DefaultSecurityManager 实现了该接口。解密使用 BlockEncrypter.DecryptBlock
+type ObjectEncrypter interface {
+	EncryptObjectBlock(ctx context.Context, objectID string, blockID uint32, data []byte) ([]byte, error)
+	CryptoErase(ctx context.Context, objectID string) error
+}
+
+// EncryptTransform 把加密作为管道中的一步，名称为"encrypt"。
+// Object 不为空时用该对象的数据密钥加密，Encrypter 需要实现 ObjectEncrypter
+type EncryptTransform struct {
+	Encrypter BlockEncrypter
+	Object    string
+}
+
+// Name 实现 BlockTransform
+func (t *EncryptTransform) Name() string { return "encrypt" }
+
+// Apply 加密数据
+func (t *EncryptTransform) Apply(ctx context.Context, id uint32, data []byte) ([]byte, error) {
+	if t.Object == "" {
+		return t.Encrypter.EncryptBlock(ctx, id, data)
+	}
+	encrypter, ok := t.Encrypter.(ObjectEncrypter)
+	if !ok {
+		return nil, fmt.Errorf("%w: 加密器不支持对象数据密钥", ErrInvalidOperation)
+	}
+	return encrypter.EncryptObjectBlock(ctx, t.Object, id, data)
+}
+
+// Revert 解密数据
+func (t *EncryptTransform) Revert(ctx context.Context, id uint32, data []byte) ([]byte, error) {
+	return t.Encrypter.DecryptBlock(ctx, id, data)
+}
+
+// HMACTransform HMAC-SHA256签名变换，名称为"hmac-sha256"。签名覆盖块ID和数据，
+// 追加在数据之后；读取时校验失败返回包装了 ErrSignatureInvalid 的 CorruptedError
+type HMACTransform struct {
+	Key []byte
+}
+
+// Name 实现 BlockTransform
+func (t *HMACTransform) Name() string { return "hmac-sha256" }
+
+// sum 计算块ID和数据的签名
+func (t *HMACTransform) sum(id uint32, data []byte) []byte {
+	mac := hmac.New(sha256.New, t.Key)
+	var idBuf [4]byte
+	binary.BigEndian.PutUint32(idBuf[:], id)
+	mac.Write(idBuf[:])
+	mac.Write(data)
+	return mac.Sum(nil)
+}
+
+// Apply 在数据后追加签名
+func (t *HMACTransform) Apply(_ context.Context, id uint32, data []byte) ([]byte, error) {
+	out := make([]byte, 0, len(data)+sha256.Size)
+	out = append(out, data...)
+	return append(out, t.sum(id, data)...), nil
+}
+
+// Revert 校验并去掉签名
+func (t *HMACTransform) Revert(_ context.Context, id uint32, data []byte) ([]byte, error) {
+	if len(data) < sha256.Size {
+		return nil, &CorruptedError{Block: id, Err: ErrSignatureInvalid}
+	}
+	payload, sig := data[:len(data)-sha256.Size], data[len(data)-sha256.Size:]
+	if !hmac.Equal(sig, t.sum(id, payload)) {
+		return nil, &CorruptedError{Block: id, Err: ErrSignatureInvalid}
+	}
+	return payload, nil
+}
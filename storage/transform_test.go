@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// reverseTransform 反转字节顺序的测试变换，用于检查管道顺序
+type reverseTransform struct{}
+
+func (reverseTransform) Name() string { return "reverse" }
+
+func (reverseTransform) Apply(_ context.Context, _ uint32, data []byte) ([]byte, error) {
+	out := bytes.Clone(data)
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, nil
+}
+
+func (t reverseTransform) Revert(ctx context.Context, id uint32, data []byte) ([]byte, error) {
+	return t.Apply(ctx, id, data)
+}
+
+// TestTransformPipeline 测试按管道写入、调整管道后读取旧块、局部读取和重新打开后未注册的变换
+func TestTransformPipeline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocks.db")
+	config := &StorageConfig{Type: StorageTypeContainer, Path: path, BlockSize: 4096}
+	sm, err := NewStorageManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain := []byte("legacy block")
+	if err := sm.WriteBlock(1, plain); err != nil {
+		t.Fatal(err)
+	}
+
+	signer := &HMACTransform{Key: []byte("secret")}
+	if err := sm.SetTransformPipeline(&GzipTransform{}, reverseTransform{}, signer); err != nil {
+		t.Fatal(err)
+	}
+	data := []byte(strings.Repeat("compressible ", 200))
+	if err := sm.WriteBlock(2, data); err != nil {
+		t.Fatal(err)
+	}
+	sm.blockCache.remove(2)
+
+	if got, err := sm.ReadBlock(2); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("read transformed block: %v", err)
+	}
+	if got, err := sm.ReadBlock(1); err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("read legacy block: %q, %v", got, err)
+	}
+	names, err := sm.BlockTransforms(2)
+	if err != nil || strings.Join(names, ",") != "gzip,reverse,hmac-sha256" {
+		t.Errorf("block transforms: %v, %v", names, err)
+	}
+	if names, _ := sm.BlockTransforms(1); len(names) != 0 {
+		t.Errorf("legacy block transforms: %v", names)
+	}
+	if info, err := sm.GetBlockInfo(2); err != nil || int(info.Size) >= len(data) {
+		t.Errorf("stored size %v not compressed: %v", info, err)
+	}
+
+	sm.blockCache.remove(2)
+	if got, err := sm.ReadBlockRange(2, 13, 12); err != nil || string(got) != "compressible" {
+		t.Errorf("range read: %q, %v", got, err)
+	}
+
+	// 清空管道后新块不再变换，旧块仍按记录还原
+	if err := sm.SetTransformPipeline(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.WriteBlock(3, []byte("after")); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := sm.BlockTransforms(3); len(names) != 0 {
+		t.Errorf("block written without pipeline: %v", names)
+	}
+	sm.blockCache.remove(2)
+	if got, err := sm.ReadBlock(2); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("read after pipeline cleared: %v", err)
+	}
+	if err := sm.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重新打开后没有注册用到的变换时无法读取
+	sm, err = NewStorageManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Close()
+	if _, err := sm.ReadBlock(2); !errors.Is(err, ErrUnknownTransform) {
+		t.Errorf("read with unregistered transforms: %v", err)
+	}
+	for _, tr := range []BlockTransform{&GzipTransform{}, reverseTransform{}, signer} {
+		if err := sm.RegisterTransform(tr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, err := sm.ReadBlock(2); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("read after registering: %v", err)
+	}
+	if len(sm.TransformPipeline()) != 0 {
+		t.Errorf("registered transforms joined pipeline: %v", sm.TransformPipeline())
+	}
+}
+
+// TestHMACTransform 测试签名校验失败和密钥不同时返回 ErrSignatureInvalid
+func TestHMACTransform(t *testing.T) {
+	ctx := context.Background()
+	signer := &HMACTransform{Key: []byte("k1")}
+	signed, err := signer.Apply(ctx, 7, []byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := signer.Revert(ctx, 7, signed); err != nil || string(got) != "payload" {
+		t.Fatalf("revert: %q, %v", got, err)
+	}
+
+	tampered := bytes.Clone(signed)
+	tampered[0] ^= 1
+	for name, check := range map[string]func() error{
+		"tampered": func() error { _, err := signer.Revert(ctx, 7, tampered); return err },
+		"other id": func() error { _, err := signer.Revert(ctx, 8, signed); return err },
+		"other key": func() error {
+			_, err := (&HMACTransform{Key: []byte("k2")}).Revert(ctx, 7, signed)
+			return err
+		},
+		"short": func() error { _, err := signer.Revert(ctx, 7, signed[:4]); return err },
+	} {
+		if err := check(); !errors.Is(err, ErrSignatureInvalid) || !errors.Is(err, ErrCorrupted) {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+// TestSetTransformPipelineInvalid 测试变换名称为空或重复时拒绝设置管道
+func TestSetTransformPipelineInvalid(t *testing.T) {
+	sm, err := NewStorageManager(&StorageConfig{Type: StorageTypeContainer, Path: filepath.Join(t.TempDir(), "blocks.db"), BlockSize: 4096})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Close()
+
+	if err := sm.SetTransformPipeline(&GzipTransform{}, &GzipTransform{Level: 1}); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("duplicate: %v", err)
+	}
+	if err := sm.SetTransformPipeline(nil); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("nil: %v", err)
+	}
+}
+
+// TestTransformMagicRawBlock 测试没有变换的块即使以有效的信封开头也原样读回
+func TestTransformMagicRawBlock(t *testing.T) {
+	for name, storageType := range map[string]StorageType{
+		"container": StorageTypeContainer,
+		"directory": StorageTypeDirectory,
+		"hybrid":    StorageTypeHybrid,
+	} {
+		t.Run(name, func(t *testing.T) {
+			config := &StorageConfig{Type: storageType, Path: blockKeyStoragePath(t.TempDir(), storageType), BlockSize: 4096}
+			sm, err := NewStorageManager(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// 记录了gzip变换的有效信封，以及没有变换的有效信封
+			blocks := map[uint32][]byte{
+				1: encodeTransformEnvelope([]string{"gzip"}, []byte("not gzip data")),
+				2: encodeTransformEnvelope(nil, []byte("payload")),
+			}
+			for id, data := range blocks {
+				if err := sm.WriteBlock(id, data); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := sm.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// 重新打开，避开块缓存
+			sm, err = NewStorageManager(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer sm.Close()
+			for id, data := range blocks {
+				got, err := sm.ReadBlock(id)
+				if err != nil || !bytes.Equal(got, data) {
+					t.Errorf("块%d应原样读回: %q, %v", id, got, err)
+				}
+				got, err = sm.ReadBlockRange(id, 2, 6)
+				if err != nil || !bytes.Equal(got, data[2:8]) {
+					t.Errorf("块%d的局部读取不正确: %q, %v", id, got, err)
+				}
+				if names, err := sm.BlockTransforms(id); err != nil || len(names) != 0 {
+					t.Errorf("块%d不应记录变换: %v, %v", id, names, err)
+				}
+			}
+		})
+	}
+}
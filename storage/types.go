@@ -2,12 +2,15 @@
 package storage
 
 import (
-	"encoding/binary"
-	"fmt"
-	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+	"github.com/bpfs/fragmenta/throttle"
+	"github.com/bpfs/fragmenta/vfs"
 )
 
 // StorageType 存储类型
@@ -42,6 +45,49 @@ type StorageConfig struct {
 	ColdBlockTimeMinutes       uint32                 // 冷块时间阈值(分钟)
 	PerformanceTarget          string                 // 性能目标："balanced","speed","space"
 	AutoBalanceEnabled         bool                   // 是否自动平衡存储分布
+	RebalanceInterval          time.Duration          // 后台重平衡间隔，0表示使用默认值
+	RebalanceMaxMoves          int                    // 每轮重平衡最多迁移的块数，0表示使用默认值
+	RebalanceMaxBytes          int64                  // 每轮重平衡最多迁移的字节数，0表示使用默认值
+	// 目录存储布局（nil表示使用默认的两级哈希分层布局）
+	DirectoryLayout *DirectoryLayout
+	// 容器空闲空间分配策略，"best-fit"(默认)或"first-fit"
+	AllocationPolicy string
+	// 持久化级别: "always-fsync"、"fsync-on-commit"(默认)、"periodic"或"none"
+	Durability string
+	// periodic级别的同步间隔，0表示使用默认值(1秒)
+	SyncInterval time.Duration
+	// 删除容量不小于该值的容器记录时立即打洞释放磁盘空间，0表示使用默认值(64KB)
+	HolePunchThreshold uint32
+	// 禁用打洞，删除的空间只在整理时回收
+	DisableHolePunch bool
+	// 可用磁盘空间低于该值时进入只读降级模式（见 StorageManagerImpl.Degraded），0表示使用默认值(64MB)
+	MinFreeSpace uint64
+	// 磁盘空间的检查间隔，0表示使用默认值(5秒)
+	DiskCheckInterval time.Duration
+	// 禁用磁盘空间检查，空间不足时写入直接返回 ErrQuota
+	DisableDiskGuard bool
+	// 后台任务（自动模式转换、重平衡）共享的限速器，nil表示不限速
+	BackgroundThrottle *throttle.Limiter
+	// 多个存储实例共享的工作池，用于并行扫描块文件，nil表示串行执行
+	Workers *WorkerPool
+	// 目录存储读取块文件时使用的文件描述符缓存，nil表示每次读取都打开文件
+	FDCache *FDCache
+	// 目录存储的副本根目录（通常在其他磁盘上），每个根目录下的blocks目录与主块目录结构相同
+	ReplicaPaths []string
+	// 每个块保存的份数（含主块目录），不大于1表示不复制，最多1+len(ReplicaPaths)
+	ReplicationFactor int
+	// 后台检查并补齐缺失副本的间隔，0表示使用默认值(10分钟)，负数表示不启动后台修复
+	ReplicaRepairInterval time.Duration
+	// 冷热块判断和后台定时任务使用的时钟，nil表示使用系统时钟
+	Clock clock.Clock
+	// 读写存储文件使用的文件系统，nil表示使用操作系统文件系统
+	FS vfs.FS
+	// 空间使用明细（见 StorageManagerImpl.Usage）中单独统计的块键前缀，如按租户或标签组织的键前缀
+	UsagePrefixes []string
+	// 块数据的写入管道，按顺序应用（见 StorageManagerImpl.SetTransformPipeline），为空表示不变换
+	Transforms []BlockTransform
+	// 块分类器，为每个块选择压缩、加密、存储层和过期时间（见 StorageManagerImpl.SetClassifier）
+	Classifier BlockClassifier
 }
 
 // StorageStats 存储统计信息
@@ -51,17 +97,25 @@ type StorageStats struct {
 	UsedSpace          uint64
 	FreeSpace          uint64
 	FragmentationRatio float64
+	HolePunchedBytes   uint64 // 本次打开后通过打洞归还文件系统的字节数（文件大小不变）
+
+	// 按调用方标签统计的操作（见 WithCallerTag），只由 StorageManagerImpl.GetStats 填充
+	Callers map[string]CallerStats
 }
 
 // BlockInfo 块信息
 type BlockInfo struct {
-	ID        uint32
-	Size      uint32
-	Offset    uint64
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Checksum  []byte
-	RefCount  uint32
+	ID          uint32
+	Size        uint32
+	Offset      uint64
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Checksum    []byte
+	RefCount    uint32
+	Shards      []ShardLocation // 纠删码分片的位置（见 ErasureStore），其他存储为空
+	ExpiresAt   time.Time       // 分类策略设置的过期时间（见 BlockPolicy.TTL），零值表示不过期
+	RetainUntil time.Time       // 保留期限（见 StorageManagerImpl.SetRetention），之前不能删除或覆盖
+	LegalHold   bool            // 是否处于法律保留中（见 StorageManagerImpl.SetLegalHold）
 }
 
 // BlockLocation 块位置
@@ -76,237 +130,25 @@ type BlockLocation struct {
 	IsInline bool
 }
 
-// CacheEntry 缓存条目
-type CacheEntry struct {
-	BlockID     uint32
-	Data        []byte
-	AccessCount uint32
-	LastAccess  time.Time
-}
-
-// BlockCache 块缓存
-type BlockCache struct {
-	Entries     map[uint32]*CacheEntry
-	MaxSize     uint64
-	CurrentSize uint64
-	Policy      string
-}
-
 // ContainerStorage 容器存储
 type ContainerStorage struct {
 	Path          string
-	File          *os.File
-	BlockMap      map[uint32]uint64
-	FreeSpaceList []interface{}
+	File          vfs.File
+	BlockMap      map[uint32]uint64 // 块ID到记录偏移的映射
+	FreeSpaceList []FreeExtent      // 按偏移排序的空闲区列表
+	AllocPolicy   string            // 空闲空间分配策略
 	mutex         sync.RWMutex
 	Stats         *StorageStats
-}
-
-// WriteBlock 写入块
-func (cs *ContainerStorage) WriteBlock(id uint32, data []byte) error {
-	cs.mutex.Lock()
-	defer cs.mutex.Unlock()
-
-	// 查找块是否已存在
-	if offset, ok := cs.BlockMap[id]; ok {
-		// 定位到块的位置
-		_, err := cs.File.Seek(int64(offset), io.SeekStart)
-		if err != nil {
-			return err
-		}
-
-		// 读取块大小
-		var oldSize uint32
-		err = binary.Read(cs.File, binary.BigEndian, &oldSize)
-		if err != nil {
-			return err
-		}
-
-		// 如果新数据大小和旧数据大小一样，可以直接覆盖
-		if uint32(len(data)) == oldSize {
-			// 回到块数据的起始位置
-			_, err = cs.File.Seek(int64(offset)+4, io.SeekStart)
-			if err != nil {
-				return err
-			}
-
-			// 写入数据
-			_, err = cs.File.Write(data)
-			return err
-		}
-
-		// 否则需要删除旧块，重新分配空间
-		// 将旧空间添加到空闲列表
-		// 实际实现应适当处理空闲空间管理
-		cs.Stats.UsedSpace -= uint64(oldSize + 4)
-		cs.Stats.FreeSpace += uint64(oldSize + 4)
-
-		// 重新分配空间
-		// 在文件末尾写入新块
-		newOffset, err := cs.allocateSpace(uint32(len(data)))
-		if err != nil {
-			return err
-		}
-
-		cs.BlockMap[id] = newOffset
-		return nil
-	}
-
-	// 分配新空间
-	newOffset, err := cs.allocateSpace(uint32(len(data)))
-	if err != nil {
-		return err
-	}
-
-	// 更新块映射
-	cs.BlockMap[id] = newOffset
-	cs.Stats.TotalBlocks++
-
-	return nil
-}
-
-// ReadBlock 读取块
-func (cs *ContainerStorage) ReadBlock(id uint32) ([]byte, error) {
-	cs.mutex.RLock()
-	defer cs.mutex.RUnlock()
-
-	// 查找块
-	offset, ok := cs.BlockMap[id]
-	if !ok {
-		return nil, ErrBlockNotFound
-	}
-
-	// 定位到块的位置
-	_, err := cs.File.Seek(int64(offset), io.SeekStart)
-	if err != nil {
-		return nil, err
-	}
-
-	// 读取块大小
-	var size uint32
-	err = binary.Read(cs.File, binary.BigEndian, &size)
-	if err != nil {
-		return nil, err
-	}
-
-	// 读取块数据
-	data := make([]byte, size)
-	_, err = io.ReadFull(cs.File, data)
-	if err != nil {
-		return nil, err
-	}
-
-	return data, nil
-}
-
-// DeleteBlock 删除块
-func (cs *ContainerStorage) DeleteBlock(id uint32) error {
-	cs.mutex.Lock()
-	defer cs.mutex.Unlock()
-
-	// 查找块
-	offset, ok := cs.BlockMap[id]
-	if !ok {
-		return ErrBlockNotFound
-	}
-
-	// 定位到块的位置
-	_, err := cs.File.Seek(int64(offset), io.SeekStart)
-	if err != nil {
-		return err
-	}
-
-	// 读取块大小
-	var size uint32
-	err = binary.Read(cs.File, binary.BigEndian, &size)
-	if err != nil {
-		return err
-	}
-
-	// 更新统计信息
-	cs.Stats.UsedSpace -= uint64(size + 4)
-	cs.Stats.FreeSpace += uint64(size + 4)
-	cs.Stats.TotalBlocks--
-
-	// 从映射中删除
-	delete(cs.BlockMap, id)
-
-	// 将空间添加到空闲列表
-	// 实际实现应适当处理空闲空间管理
-
-	return nil
-}
-
-// GetBlockInfo 获取块信息
-func (cs *ContainerStorage) GetBlockInfo(id uint32) (*BlockInfo, error) {
-	cs.mutex.RLock()
-	defer cs.mutex.RUnlock()
 
-	// 查找块
-	offset, ok := cs.BlockMap[id]
-	if !ok {
-		return nil, ErrBlockNotFound
-	}
-
-	// 定位到块的位置
-	_, err := cs.File.Seek(int64(offset), io.SeekStart)
-	if err != nil {
-		return nil, err
-	}
-
-	// 读取块大小
-	var size uint32
-	err = binary.Read(cs.File, binary.BigEndian, &size)
-	if err != nil {
-		return nil, err
-	}
-
-	// 创建块信息
-	info := &BlockInfo{
-		ID:     id,
-		Size:   size,
-		Offset: offset,
-	}
+	// 分配表持久化状态
+	dataEnd uint64 // 数据区结束位置，分配表紧随其后
+	dirty   bool   // 分配表自上次写入后已修改
 
-	return info, nil
-}
-
-// Optimize 优化存储
-func (cs *ContainerStorage) Optimize() error {
-	cs.mutex.Lock()
-	defer cs.mutex.Unlock()
+	// 打洞状态，检测到不支持时关闭
+	holePunch          bool
+	holePunchThreshold uint32
 
-	// 在实际实现中，应进行碎片整理等操作
-
-	return nil
-}
-
-// allocateSpace 分配空间
-func (cs *ContainerStorage) allocateSpace(size uint32) (uint64, error) {
-	// 简单实现：在文件末尾分配空间
-	offset, err := cs.File.Seek(0, io.SeekEnd)
-	if err != nil {
-		return 0, err
-	}
-
-	// 写入块大小
-	err = binary.Write(cs.File, binary.BigEndian, size)
-	if err != nil {
-		return 0, err
-	}
-
-	// 分配空间用于数据
-	zeros := make([]byte, size)
-	_, err = cs.File.Write(zeros)
-	if err != nil {
-		return 0, err
-	}
-
-	// 更新统计信息
-	cs.Stats.UsedSpace += uint64(size + 4)
-	cs.Stats.TotalSize += uint64(size + 4)
-
-	return uint64(offset), nil
+	durability *durability
 }
 
 // DirectoryStorage 目录存储
@@ -316,38 +158,85 @@ type DirectoryStorage struct {
 	BlocksPath string
 	TempPath   string
 	BlockMap   map[uint32]string
+	Layout     DirectoryLayout
 	mutex      sync.RWMutex
 	Stats      *StorageStats
+
+	// 块映射持久化状态
+	dirty        bool // 块映射自上次写入meta.idx后已修改
+	needsRebuild bool // meta.idx缺失或损坏，需要扫描块目录重建
+
+	durability *durability
+	unsynced   map[string]struct{} // 上次同步后写入的块文件
+
+	fdCache *FDCache    // 共享的文件描述符缓存
+	workers *WorkerPool // 共享的工作池
+	fs      vfs.FS
+	clock   clock.Clock
+
+	// 副本（见 StorageConfig.ReplicaPaths），未启用复制时replicas为空
+	replicas        []string            // 副本根目录下的blocks目录
+	copies          int                 // 每个块的份数（含主块目录）
+	throttle        *throttle.Limiter   // 后台修复副本使用的限速器
+	underReplicated map[uint32]struct{} // 已知缺少副本的块，由replicaMutex保护
+	replicaMutex    sync.Mutex
+
+	// 后台副本修复，由repairMutex保护
+	repairStopCh chan struct{}
+	repairDoneCh chan struct{}
+	lastRepair   *ReplicaRepairReport
+	repairMutex  sync.Mutex
 }
 
 // WriteBlock 写入块
 func (ds *DirectoryStorage) WriteBlock(id uint32, data []byte) error {
+	if err := ds.ensureBlockMap(); err != nil {
+		return err
+	}
+
 	ds.mutex.Lock()
 	defer ds.mutex.Unlock()
 
+	ds.markDirty()
+
 	// 创建块文件路径
 	filePath := ds.getBlockPath(id)
 
 	// 检查是否需要删除现有文件
 	if oldPath, ok := ds.BlockMap[id]; ok {
 		// 获取旧文件大小
-		info, err := os.Stat(oldPath)
+		info, err := ds.fs.Stat(oldPath)
 		if err == nil {
 			// 更新统计信息
 			ds.Stats.UsedSpace -= uint64(info.Size())
 		}
 
 		// 删除旧文件
-		_ = os.Remove(oldPath)
+		ds.fdCache.Invalidate(oldPath)
+		_ = ds.fs.Remove(oldPath)
+		delete(ds.unsynced, oldPath)
+		if oldPath != filePath {
+			ds.removeReplicasLocked(id, oldPath)
+		}
 	} else {
 		// 新块
 		ds.Stats.TotalBlocks++
 	}
 
 	// 写入块文件
-	err := os.WriteFile(filePath, data, 0644)
-	if err != nil {
-		return err
+	ds.fdCache.Invalidate(filePath)
+	err := ds.fs.WriteFile(filePath, data, 0644)
+	if err == nil {
+		err = ds.blockWritten(filePath)
+	}
+
+	// 写入副本，至少有一份写入成功时写入成功，缺少的份数由副本修复补齐
+	if replicas := ds.writeReplicasLocked(id, filePath, data); err != nil {
+		if replicas == 0 {
+			return err
+		}
+		logger.Warn("写入块文件失败，已写入副本", "id", id, "path", filePath, "error", err)
+		ds.markUnderReplicated(id)
 	}
 
 	// 更新映射和统计信息
@@ -359,6 +248,10 @@ func (ds *DirectoryStorage) WriteBlock(id uint32, data []byte) error {
 
 // ReadBlock 读取块
 func (ds *DirectoryStorage) ReadBlock(id uint32) ([]byte, error) {
+	if err := ds.ensureBlockMap(); err != nil {
+		return nil, err
+	}
+
 	ds.mutex.RLock()
 	defer ds.mutex.RUnlock()
 
@@ -368,9 +261,16 @@ func (ds *DirectoryStorage) ReadBlock(id uint32) ([]byte, error) {
 		return nil, ErrBlockNotFound
 	}
 
-	// 读取块文件
-	data, err := os.ReadFile(filePath)
+	// 读取块文件，失败时尝试副本
+	data, err := ds.fdCache.readFile(ds.fs, filePath)
 	if err != nil {
+		if replica, ok := ds.readReplica(id, filePath); ok {
+			return replica, nil
+		}
+		if os.IsNotExist(err) {
+			// 映射中存在但文件已丢失
+			return nil, ErrBlockNotFound
+		}
 		return nil, err
 	}
 
@@ -379,6 +279,10 @@ func (ds *DirectoryStorage) ReadBlock(id uint32) ([]byte, error) {
 
 // DeleteBlock 删除块
 func (ds *DirectoryStorage) DeleteBlock(id uint32) error {
+	if err := ds.ensureBlockMap(); err != nil {
+		return err
+	}
+
 	ds.mutex.Lock()
 	defer ds.mutex.Unlock()
 
@@ -388,18 +292,26 @@ func (ds *DirectoryStorage) DeleteBlock(id uint32) error {
 		return ErrBlockNotFound
 	}
 
+	ds.markDirty()
+
 	// 获取文件大小
-	info, err := os.Stat(filePath)
+	info, err := ds.fs.Stat(filePath)
 	if err == nil {
 		// 更新统计信息
 		ds.Stats.UsedSpace -= uint64(info.Size())
 	}
 
 	// 删除文件
-	err = os.Remove(filePath)
-	if err != nil {
+	ds.fdCache.Invalidate(filePath)
+	err = ds.fs.Remove(filePath)
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
+	delete(ds.unsynced, filePath)
+	if ds.durability.syncOnWrite() {
+		syncPath(ds.fs, filepath.Dir(filePath), true)
+	}
+	ds.removeReplicasLocked(id, filePath)
 
 	// 从映射中删除
 	delete(ds.BlockMap, id)
@@ -410,6 +322,10 @@ func (ds *DirectoryStorage) DeleteBlock(id uint32) error {
 
 // GetBlockInfo 获取块信息
 func (ds *DirectoryStorage) GetBlockInfo(id uint32) (*BlockInfo, error) {
+	if err := ds.ensureBlockMap(); err != nil {
+		return nil, err
+	}
+
 	ds.mutex.RLock()
 	defer ds.mutex.RUnlock()
 
@@ -419,9 +335,17 @@ func (ds *DirectoryStorage) GetBlockInfo(id uint32) (*BlockInfo, error) {
 		return nil, ErrBlockNotFound
 	}
 
-	// 获取文件信息
-	info, err := os.Stat(filePath)
+	// 获取文件信息，主块目录中的文件无法访问时使用副本
+	info, err := ds.fs.Stat(filePath)
+	if err != nil {
+		if replica, ok := ds.statReplica(id, filePath); ok {
+			info, err = replica, nil
+		}
+	}
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrBlockNotFound
+		}
 		return nil, err
 	}
 
@@ -436,6 +360,23 @@ func (ds *DirectoryStorage) GetBlockInfo(id uint32) (*BlockInfo, error) {
 	return blockInfo, nil
 }
 
+// ListBlockIDs 列出所有块ID，按ID升序
+func (ds *DirectoryStorage) ListBlockIDs() ([]uint32, error) {
+	if err := ds.ensureBlockMap(); err != nil {
+		return nil, err
+	}
+
+	ds.mutex.RLock()
+	ids := make([]uint32, 0, len(ds.BlockMap))
+	for id := range ds.BlockMap {
+		ids = append(ids, id)
+	}
+	ds.mutex.RUnlock()
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
 // Optimize 优化存储
 func (ds *DirectoryStorage) Optimize() error {
 	// 在目录模式下，可能需要整理文件夹结构
@@ -444,17 +385,13 @@ func (ds *DirectoryStorage) Optimize() error {
 
 // getBlockPath 获取块文件路径
 func (ds *DirectoryStorage) getBlockPath(id uint32) string {
-	// 创建层次化的路径，避免单个目录下文件过多
-	dir1 := id % 256
-	dir2 := (id / 256) % 256
+	// 按照布局创建层次化的路径，避免单个目录下文件过多
+	filePath := filepath.Join(ds.BlocksPath, ds.Layout.RelativePath(id))
 
 	// 创建目录
-	dirPath := os.ExpandEnv(ds.BlocksPath + "/" +
-		fmt.Sprintf("%02x", dir1) + "/" + fmt.Sprintf("%02x", dir2))
-	os.MkdirAll(dirPath, 0755)
+	ds.fs.MkdirAll(filepath.Dir(filePath), 0755)
 
-	// 返回文件路径
-	return dirPath + "/" + fmt.Sprintf("%08x", id) + ".blk"
+	return filePath
 }
 
 // HybridStorage 混合存储
@@ -463,10 +400,24 @@ type HybridStorage struct {
 	Container         *ContainerStorage
 	Directory         *DirectoryStorage
 	InlineBlocks      map[string][]byte
+	blockKeys         map[string]struct{} // 所有块的键，用于列出块
 	mutex             sync.RWMutex
 	Stats             *StorageStats
 	securityManager   interface{} // 安全管理器引用
 	encryptionEnabled bool        // 加密状态标志
+
+	// 访问跟踪与存储策略
+	tracker  *AccessTracker
+	strategy StorageStrategy
+
+	// 分类策略固定了存储位置的块（见 BlockPolicy.Tier），由mutex保护
+	pins map[string]StorageLocation
+
+	// 后台重平衡
+	rebalanceMutex  sync.Mutex
+	rebalanceStopCh chan struct{}
+	rebalanceDoneCh chan struct{}
+	lastRebalance   *RebalanceReport
 }
 
 // PerformanceMetrics 性能指标
@@ -600,6 +551,7 @@ type StorageManager interface {
 	// 存储操作
 	WriteBlock(id uint32, data []byte) error
 	ReadBlock(id uint32) ([]byte, error)
+	ReadBlockRange(id uint32, offset, length int64) ([]byte, error)
 	DeleteBlock(id uint32) error
 	GetBlockInfo(id uint32) (*BlockInfo, error)
 
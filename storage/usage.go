@@ -0,0 +1,261 @@
+package storage
+
+import (
+	"maps"
+	"slices"
+	"strings"
+)
+
+// UsageCount 块数和字节数
+type UsageCount struct {
+	Blocks uint64
+	Bytes  uint64
+}
+
+// add 按符号累加一个块
+func (c *UsageCount) add(size uint64, sign int) {
+	if sign > 0 {
+		c.Blocks++
+		c.Bytes += size
+		return
+	}
+	c.Blocks--
+	c.Bytes -= min(size, c.Bytes)
+}
+
+// UsageReport 空间使用明细，用于多租户部署的计费。
+// 命名空间和前缀的统计在写入和删除时增量维护，各存储位置的统计取自子存储的计数器
+type UsageReport struct {
+	// Total 所有块写入存储的字节数（加密后）合计
+	Total UsageCount
+	// ByTier 各存储位置占用的空间，容器的字节数包括记录头和未用满的记录容量
+	ByTier map[StorageType]UsageCount
+	// ByNamespace 按命名空间统计：字符串键第一个"/"之前的部分，数字键和不含"/"的键属于""
+	ByNamespace map[string]UsageCount
+	// ByPrefix 按 StorageConfig.UsagePrefixes 中的键前缀统计，一个块可以计入多个前缀
+	ByPrefix map[string]UsageCount
+	// Unattributed 无法确定键的已有块，只出现在混合存储重新打开后（混合存储不保存原始键），
+	// 字节数取自混合存储的统计，包括子存储的记录开销。这些块被覆盖或删除时按块大小扣除
+	Unattributed UsageCount
+}
+
+// BlockNamespace 返回块键所属的命名空间，见 UsageReport.ByNamespace
+func BlockNamespace(key BlockKey) string {
+	if _, numeric := key.Numeric(); numeric {
+		return ""
+	}
+	namespace, _, found := strings.Cut(key.name, "/")
+	if !found {
+		return ""
+	}
+	return namespace
+}
+
+// usageRecord 已统计的块
+type usageRecord struct {
+	key  BlockKey
+	size uint64
+}
+
+// usageTracker 增量维护的空间使用统计，由 StorageManagerImpl.mutex 保护。
+// 第一次查询时从当前存储加载，之前的写入和删除不需要记录
+type usageTracker struct {
+	prefixes []string
+	seeded   bool
+
+	blocks       map[uint32]usageRecord
+	total        UsageCount
+	byNamespace  map[string]UsageCount
+	byPrefix     map[string]UsageCount
+	unattributed UsageCount
+}
+
+// newUsageTracker 创建按prefixes统计前缀的空间使用统计
+func newUsageTracker(prefixes []string) *usageTracker {
+	return &usageTracker{prefixes: slices.Clone(prefixes)}
+}
+
+// reset 丢弃已加载的统计，下次查询时重新加载
+func (u *usageTracker) reset() {
+	u.seeded = false
+	u.blocks, u.byNamespace, u.byPrefix = nil, nil, nil
+	u.total, u.unattributed = UsageCount{}, UsageCount{}
+}
+
+// apply 按符号把块计入各项统计
+func (u *usageTracker) apply(rec usageRecord, sign int) {
+	u.total.add(rec.size, sign)
+	namespace := BlockNamespace(rec.key)
+	count := u.byNamespace[namespace]
+	count.add(rec.size, sign)
+	if count.Blocks == 0 {
+		delete(u.byNamespace, namespace)
+	} else {
+		u.byNamespace[namespace] = count
+	}
+
+	name := rec.key.String()
+	for _, prefix := range u.prefixes {
+		if strings.HasPrefix(name, prefix) {
+			count := u.byPrefix[prefix]
+			count.add(rec.size, sign)
+			u.byPrefix[prefix] = count
+		}
+	}
+}
+
+// untracked 返回块是否可能是未归属的已有块，此时调用方需要在覆盖或删除前取得块的大小
+func (u *usageTracker) untracked(id uint32) bool {
+	if !u.seeded || u.unattributed.Blocks == 0 {
+		return false
+	}
+	_, ok := u.blocks[id]
+	return !ok
+}
+
+// forget 移除块的统计，块不在统计中时从未归属的已有块中扣除prevSize
+func (u *usageTracker) forget(id uint32, prevSize uint64, existed bool) {
+	if !u.seeded {
+		return
+	}
+	if rec, ok := u.blocks[id]; ok {
+		u.apply(rec, -1)
+		delete(u.blocks, id)
+	} else if existed && u.unattributed.Blocks > 0 {
+		u.unattributed.add(prevSize, -1)
+		u.total.add(prevSize, -1)
+	}
+}
+
+// record 记录块写入，替换块原来的统计
+func (u *usageTracker) record(id uint32, key BlockKey, size uint64, prevSize uint64, existed bool) {
+	if !u.seeded {
+		return
+	}
+	u.forget(id, prevSize, existed)
+	rec := usageRecord{key: key, size: size}
+	u.blocks[id] = rec
+	u.apply(rec, 1)
+}
+
+// rename 块的键改变后（见 AssignBlockKey）按新键重新统计
+func (u *usageTracker) rename(id uint32, key BlockKey) {
+	if rec, ok := u.blocks[id]; ok && u.seeded {
+		u.record(id, key, rec.size, 0, false)
+	}
+}
+
+// Usage 返回按存储位置、命名空间和键前缀分组的空间使用明细。
+// 第一次调用时扫描一次当前存储的块信息，之后随写入和删除增量更新
+func (sm *StorageManagerImpl) Usage() (*UsageReport, error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	if !sm.usage.seeded {
+		if err := sm.seedUsage(); err != nil {
+			return nil, err
+		}
+	}
+
+	u := sm.usage
+	report := &UsageReport{
+		Total:        u.total,
+		ByTier:       sm.tierUsage(),
+		ByNamespace:  maps.Clone(u.byNamespace),
+		ByPrefix:     make(map[string]UsageCount, len(u.prefixes)),
+		Unattributed: u.unattributed,
+	}
+	for _, prefix := range u.prefixes {
+		report.ByPrefix[prefix] = u.byPrefix[prefix]
+	}
+	return report, nil
+}
+
+// seedUsage 从当前存储加载空间使用统计（调用者持有写锁）。
+// 混合存储重新打开后无法列出块，已有的块计入 UsageReport.Unattributed
+func (sm *StorageManagerImpl) seedUsage() error {
+	u := sm.usage
+	u.reset()
+	u.blocks = make(map[uint32]usageRecord)
+	u.byNamespace = make(map[string]UsageCount)
+	u.byPrefix = make(map[string]UsageCount)
+
+	ids, err := sm.blockIDs()
+	if err != nil {
+		if sm.hybridStorage == nil {
+			return err
+		}
+		sm.hybridStorage.mutex.RLock()
+		u.unattributed = UsageCount{Blocks: uint64(sm.hybridStorage.Stats.TotalBlocks), Bytes: sm.hybridStorage.Stats.TotalSize}
+		sm.hybridStorage.mutex.RUnlock()
+		u.total = u.unattributed
+		u.seeded = true
+		logger.Warning("混合存储中有无法确定键的块，计入未归属用量", "blocks", u.unattributed.Blocks, "error", err)
+		return nil
+	}
+
+	for _, id := range ids {
+		info, err := sm.blockInfoLocked(id)
+		if err != nil {
+			return err
+		}
+		rec := usageRecord{key: sm.keyForIDLocked(id), size: uint64(info.Size)}
+		u.blocks[id] = rec
+		u.apply(rec, 1)
+	}
+	u.seeded = true
+	return nil
+}
+
+// prevUsageSize 在覆盖或删除块前返回未归属块的大小（调用者持有写锁），
+// 只在混合存储重新打开后的未归属块上读取块信息
+func (sm *StorageManagerImpl) prevUsageSize(id uint32) (uint64, bool) {
+	if !sm.usage.untracked(id) {
+		return 0, false
+	}
+	info, err := sm.blockInfoLocked(id)
+	if err != nil {
+		return 0, false
+	}
+	return uint64(info.Size), true
+}
+
+// tierUsage 返回各存储位置占用的空间，取自子存储维护的计数器（调用者持有锁）
+func (sm *StorageManagerImpl) tierUsage() map[StorageType]UsageCount {
+	tiers := make(map[StorageType]UsageCount)
+	switch {
+	case sm.containerStorage != nil:
+		tiers[StorageTypeContainer] = containerUsage(sm.containerStorage)
+	case sm.directoryStorage != nil:
+		tiers[StorageTypeDirectory] = directoryUsage(sm.directoryStorage)
+	case sm.hybridStorage != nil:
+		hs := sm.hybridStorage
+		hs.mutex.RLock()
+		var inline UsageCount
+		for _, data := range hs.InlineBlocks {
+			inline.add(uint64(len(data)), 1)
+		}
+		tiers[StorageTypeInline] = inline
+		tiers[StorageTypeContainer] = containerUsage(hs.Container)
+		tiers[StorageTypeDirectory] = directoryUsage(hs.Directory)
+		hs.mutex.RUnlock()
+	}
+	return tiers
+}
+
+// containerUsage 返回容器中的块数和已用空间
+func containerUsage(cs *ContainerStorage) UsageCount {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+	return UsageCount{Blocks: uint64(cs.Stats.TotalBlocks), Bytes: cs.Stats.UsedSpace}
+}
+
+// directoryUsage 返回目录存储中的块数和已用空间
+func directoryUsage(ds *DirectoryStorage) UsageCount {
+	if err := ds.ensureBlockMap(); err != nil {
+		logger.Warning("加载目录存储块映射失败", "error", err)
+	}
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+	return UsageCount{Blocks: uint64(ds.Stats.TotalBlocks), Bytes: ds.Stats.UsedSpace}
+}
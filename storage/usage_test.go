@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// TestStorageManagerUsage 测试空间使用明细按命名空间和前缀增量更新
+func TestStorageManagerUsage(t *testing.T) {
+	modes := map[string]StorageType{
+		"container": StorageTypeContainer,
+		"directory": StorageTypeDirectory,
+		"hybrid":    StorageTypeHybrid,
+	}
+	for name, storageType := range modes {
+		t.Run(name, func(t *testing.T) {
+			config := &StorageConfig{
+				Type:          storageType,
+				Path:          blockKeyStoragePath(t.TempDir(), storageType),
+				BlockSize:     4096,
+				UsagePrefixes: []string{"acme/", "acme/logs/", "globex/"},
+			}
+			sm, err := NewStorageManager(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// 查询前已有的块在第一次查询时加载
+			if err := sm.WriteBlock(1, make([]byte, 100)); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := sm.Usage(); err != nil {
+				t.Fatal(err)
+			}
+
+			writes := map[string]int{
+				"acme/logs/a":  300,
+				"acme/data":    200,
+				"globex/x":     50,
+				"unscoped-key": 10,
+			}
+			for key, size := range writes {
+				if err := sm.WriteBlockKey(StringKey(key), make([]byte, size)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			// 覆盖只计算新大小
+			if err := sm.WriteBlockKey(StringKey("acme/data"), make([]byte, 250)); err != nil {
+				t.Fatal(err)
+			}
+			if err := sm.DeleteBlockKey(StringKey("globex/x")); err != nil {
+				t.Fatal(err)
+			}
+
+			report, err := sm.Usage()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if report.Total != (UsageCount{Blocks: 4, Bytes: 660}) {
+				t.Errorf("total: %+v", report.Total)
+			}
+			if got := report.ByNamespace["acme"]; got != (UsageCount{Blocks: 2, Bytes: 550}) {
+				t.Errorf("namespace acme: %+v", got)
+			}
+			if got := report.ByNamespace[""]; got != (UsageCount{Blocks: 2, Bytes: 110}) {
+				t.Errorf("default namespace: %+v", got)
+			}
+			if _, ok := report.ByNamespace["globex"]; ok {
+				t.Error("empty namespace should be removed")
+			}
+			if got := report.ByPrefix["acme/logs/"]; got != (UsageCount{Blocks: 1, Bytes: 300}) {
+				t.Errorf("prefix acme/logs/: %+v", got)
+			}
+			if got := report.ByPrefix["acme/"]; got != (UsageCount{Blocks: 2, Bytes: 550}) {
+				t.Errorf("prefix acme/: %+v", got)
+			}
+			if got := report.ByPrefix["globex/"]; got != (UsageCount{}) {
+				t.Errorf("prefix globex/: %+v", got)
+			}
+
+			var tierBlocks uint64
+			for _, count := range report.ByTier {
+				tierBlocks += count.Blocks
+			}
+			if tierBlocks != 4 {
+				t.Errorf("tier blocks = %d, want 4: %+v", tierBlocks, report.ByTier)
+			}
+
+			// 指定字符串键后移动到新的命名空间
+			if err := sm.AssignBlockKey(1, "globex/legacy"); err != nil {
+				t.Fatal(err)
+			}
+			report, _ = sm.Usage()
+			if got := report.ByNamespace["globex"]; got != (UsageCount{Blocks: 1, Bytes: 100}) {
+				t.Errorf("namespace globex after assign: %+v", got)
+			}
+			sm.Close()
+		})
+	}
+}
+
+// TestUsageUnattributed 测试混合存储重新打开后已有的块计入未归属用量，删除时扣除
+func TestUsageUnattributed(t *testing.T) {
+	config := &StorageConfig{Type: StorageTypeHybrid, Path: filepath.Join(t.TempDir(), "data"), BlockSize: 4096}
+	sm, err := NewStorageManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for id := uint32(1); id <= 3; id++ {
+		if err := sm.WriteBlock(id, make([]byte, 100)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sm.Close()
+
+	sm, err = NewStorageManager(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sm.Close()
+
+	report, err := sm.Usage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 字节数包括子存储的记录开销
+	initial := report.Unattributed
+	if initial.Blocks != 3 || initial.Bytes < 300 || report.Total != initial {
+		t.Fatalf("unattributed: %+v, total: %+v", initial, report.Total)
+	}
+
+	if err := sm.DeleteBlock(2); err != nil {
+		t.Fatal(err)
+	}
+	if err := sm.WriteBlock(3, make([]byte, 40)); err != nil {
+		t.Fatal(err)
+	}
+	report, _ = sm.Usage()
+	if report.Unattributed != (UsageCount{Blocks: 1, Bytes: initial.Bytes - 200}) {
+		t.Errorf("unattributed after delete and overwrite: %+v", report.Unattributed)
+	}
+	if report.Total != (UsageCount{Blocks: 2, Bytes: initial.Bytes - 200 + 40}) {
+		t.Errorf("total: %+v", report.Total)
+	}
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrWorkerPoolClosed 工作池已关闭
+	ErrWorkerPoolClosed = errors.New("工作池已关闭")
+
+	// ErrWorkerQueueFull 工作池等待队列已满
+	ErrWorkerQueueFull = errors.New("工作池等待队列已满")
+)
+
+// WorkerPool 多个存储实例共享的工作池，限制同时执行的任务数和等待执行的任务数
+// 两个上限都可以在运行时通过Resize调整，调小时正在执行的任务不受影响。
+// nil WorkerPool表示不使用工作池，Map在调用方协程中串行执行。
+type WorkerPool struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	maxWorkers  int
+	queueLength int
+	running     int // 正在执行的任务数
+	pending     int // 已提交未完成的任务数，包括正在执行的
+	closed      bool
+
+	wg sync.WaitGroup
+}
+
+// NewWorkerPool 创建工作池，maxWorkers不大于0时为1，queueLength不大于0时为maxWorkers
+func NewWorkerPool(maxWorkers, queueLength int) *WorkerPool {
+	p := &WorkerPool{}
+	p.cond = sync.NewCond(&p.mu)
+	p.Resize(maxWorkers, queueLength)
+	return p
+}
+
+// Resize 调整并发数和等待队列长度
+func (p *WorkerPool) Resize(maxWorkers, queueLength int) {
+	if maxWorkers <= 0 {
+		maxWorkers = 1
+	}
+	if queueLength <= 0 {
+		queueLength = maxWorkers
+	}
+
+	p.mu.Lock()
+	p.maxWorkers = maxWorkers
+	p.queueLength = queueLength
+	p.mu.Unlock()
+
+	// 扩容后唤醒等待的任务
+	p.cond.Broadcast()
+}
+
+// Size 返回当前的并发数和等待队列长度
+func (p *WorkerPool) Size() (maxWorkers, queueLength int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.maxWorkers, p.queueLength
+}
+
+// Submit 提交任务，任务在有空闲工作者时异步执行
+// 工作者全忙且等待执行的任务已达队列长度时返回ErrWorkerQueueFull
+func (p *WorkerPool) Submit(task func()) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrWorkerPoolClosed
+	}
+	if p.pending >= p.maxWorkers+p.queueLength {
+		return ErrWorkerQueueFull
+	}
+
+	p.pending++
+	p.wg.Add(1)
+	go p.run(task)
+	return nil
+}
+
+// run 等待空闲工作者后执行任务
+func (p *WorkerPool) run(task func()) {
+	defer p.wg.Done()
+
+	p.mu.Lock()
+	for p.running >= p.maxWorkers {
+		p.cond.Wait()
+	}
+	p.running++
+	p.mu.Unlock()
+
+	defer func() {
+		p.mu.Lock()
+		p.running--
+		p.pending--
+		p.mu.Unlock()
+		p.cond.Broadcast()
+	}()
+
+	task()
+}
+
+// Map 并行执行fn(0)到fn(n-1)并等待全部完成，返回第一个错误
+// 工作池为nil、已关闭或队列已满时，任务在调用方协程中执行，不会丢弃
+func (p *WorkerPool) Map(n int, fn func(i int) error) error {
+	var (
+		wg       sync.WaitGroup
+		errMutex sync.Mutex
+		firstErr error
+	)
+	record := func(err error) {
+		if err == nil {
+			return
+		}
+		errMutex.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		errMutex.Unlock()
+	}
+
+	for i := 0; i < n; i++ {
+		i := i
+		if p != nil {
+			wg.Add(1)
+			if err := p.Submit(func() {
+				defer wg.Done()
+				record(fn(i))
+			}); err == nil {
+				continue
+			}
+			wg.Done()
+		}
+		record(fn(i))
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+// Close 停止接受新任务，并等待已提交的任务执行完毕
+func (p *WorkerPool) Close() {
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// TestWorkerPool 测试并发上限、队列上限和运行时调整
+func TestWorkerPool(t *testing.T) {
+	pool := NewWorkerPool(2, 2)
+
+	var running, peak int32
+	release := make(chan struct{})
+	var started sync.WaitGroup
+	task := func() {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		started.Done()
+		<-release
+		atomic.AddInt32(&running, -1)
+	}
+
+	// 2个任务执行，2个等待，第5个被拒绝
+	started.Add(2)
+	for i := 0; i < 4; i++ {
+		if err := pool.Submit(task); err != nil {
+			t.Fatalf("提交任务失败: %v", err)
+		}
+	}
+	started.Wait()
+	time.Sleep(20 * time.Millisecond)
+	if err := pool.Submit(task); !errors.Is(err, ErrWorkerQueueFull) {
+		t.Errorf("队列已满时应拒绝任务: %v", err)
+	}
+	if atomic.LoadInt32(&peak) != 2 {
+		t.Errorf("并发数应为2: %d", peak)
+	}
+
+	// 扩容后等待的任务立即执行
+	started.Add(2)
+	pool.Resize(4, 4)
+	started.Wait()
+	if atomic.LoadInt32(&peak) != 4 {
+		t.Errorf("扩容后并发数应为4: %d", peak)
+	}
+	if workers, queue := pool.Size(); workers != 4 || queue != 4 {
+		t.Errorf("工作池大小不正确: %d, %d", workers, queue)
+	}
+
+	close(release)
+	pool.Close()
+	if err := pool.Submit(func() {}); !errors.Is(err, ErrWorkerPoolClosed) {
+		t.Errorf("关闭后应拒绝任务: %v", err)
+	}
+}
+
+// TestWorkerPoolMap 测试Map在工作池、队列已满和nil工作池下都执行全部任务
+func TestWorkerPoolMap(t *testing.T) {
+	for _, pool := range []*WorkerPool{NewWorkerPool(4, 100), NewWorkerPool(1, 1), nil} {
+		var count int32
+		errBoom := errors.New("boom")
+		err := pool.Map(100, func(i int) error {
+			atomic.AddInt32(&count, 1)
+			if i == 50 {
+				return errBoom
+			}
+			return nil
+		})
+		if !errors.Is(err, errBoom) {
+			t.Errorf("应返回任务错误: %v", err)
+		}
+		if count != 100 {
+			t.Errorf("应执行全部任务: %d", count)
+		}
+		if pool != nil {
+			pool.Close()
+		}
+	}
+}
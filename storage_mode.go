@@ -0,0 +1,178 @@
+package fragmenta
+
+import (
+	"os"
+
+	"github.com/bpfs/fragmenta/storage"
+)
+
+// BlockDirectorySuffix 目录模式下块数据目录的后缀，目录位于格式文件旁边
+const BlockDirectorySuffix = ".blocks"
+
+// BlockDirectory 返回格式文件在目录模式下的块数据目录
+func BlockDirectory(path string) string {
+	return path + BlockDirectorySuffix
+}
+
+// storageConverter 可以切换存储模式的块数据存储（storage.StorageManager）
+type storageConverter interface {
+	ConvertType(newType storage.StorageType) error
+}
+
+// ConvertToDirectoryMode 转换为目录模式
+// 目录模式下每个块的数据单独保存在块数据目录中（见 BlockDirectory），读写和删除都经过该目录。
+// 通过 SetBlockStore 挂接了存储管理器时，由存储管理器的 ConvertType 转换为目录存储，不再另建目录；
+// 挂接的其他块数据存储被块数据目录替换。
+// 格式文件仍保存完整的块区、元数据区和索引区，不认识目录模式的旧版本也能打开并读取所有块
+func (f *FragmentaImpl) ConvertToDirectoryMode() error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	// 只有容器模式才能转换为目录模式
+	if f.header.StorageMode != ContainerMode {
+		return ErrInvalidOperation
+	}
+	if err := f.checkConvertRetention(); err != nil {
+		return err
+	}
+
+	if converter, ok := f.getBlockStore().(storageConverter); ok {
+		if err := converter.ConvertType(storage.StorageTypeDirectory); err != nil {
+			logger.Error("转换块数据存储为目录模式失败", "error", err)
+			return err
+		}
+	} else if err := f.attachBlockDirectory(); err != nil {
+		return err
+	}
+
+	return f.setStorageModeLocked(DirectoryMode)
+}
+
+// ConvertToContainerMode 转换为容器模式
+// 块数据重新只从格式文件读取，转换为目录模式时创建的块数据目录被删除；
+// 挂接的存储管理器由 ConvertType 转换回容器存储
+func (f *FragmentaImpl) ConvertToContainerMode() error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	// 只有目录模式才能转换为容器模式
+	if f.header.StorageMode != DirectoryMode {
+		return ErrInvalidOperation
+	}
+	if err := f.checkConvertRetention(); err != nil {
+		return err
+	}
+
+	if err := f.detachBlockDirectory(true); err != nil {
+		return err
+	}
+	if converter, ok := f.getBlockStore().(storageConverter); ok {
+		if err := converter.ConvertType(storage.StorageTypeContainer); err != nil {
+			logger.Error("转换块数据存储为容器模式失败", "error", err)
+			return err
+		}
+	}
+
+	return f.setStorageModeLocked(ContainerMode)
+}
+
+// setStorageModeLocked 更新文件头中的存储模式并提交，调用方需持有writeMutex
+func (f *FragmentaImpl) setStorageModeLocked(mode uint8) error {
+	old := f.header.StorageMode
+	f.header.StorageMode = mode
+	f.isDirty.Store(true)
+
+	if err := f.commitLocked(); err != nil {
+		f.header.StorageMode = old
+		logger.Error("保存存储模式失败", "mode", mode, "error", err)
+		return err
+	}
+
+	logger.Info("存储模式已转换", "from", old, "to", mode)
+	return nil
+}
+
+// attachBlockDirectory 打开块数据目录并挂接为块数据存储
+// 格式文件中有而目录中没有的块（目录被删除，或由不认识目录模式的版本写入）先复制到目录中
+func (f *FragmentaImpl) attachBlockDirectory() error {
+	sm, err := storage.NewStorageManager(&storage.StorageConfig{
+		Type:            storage.StorageTypeDirectory,
+		Path:            BlockDirectory(f.path),
+		BlockSize:       DefaultBlockSize,
+		InlineThreshold: InlineBlockThreshold,
+		CacheSize:       uint64(DefaultIndexCacheSize),
+		CachePolicy:     "lru",
+	})
+	if err != nil {
+		logger.Error("打开块数据目录失败", "path", BlockDirectory(f.path), "error", err)
+		return err
+	}
+
+	f.componentMutex.Lock()
+	defer f.componentMutex.Unlock()
+
+	for _, header := range f.blockManager.ListBlocks() {
+		if _, err := sm.GetBlockInfo(header.BlockID); err == nil {
+			continue
+		}
+
+		data, err := f.blockManager.ReadBlock(header.BlockID)
+		if err == nil {
+			err = sm.WriteBlock(header.BlockID, data)
+		}
+		if err != nil {
+			sm.Close()
+			logger.Error("复制数据块到块数据目录失败", "blockID", header.BlockID, "error", err)
+			return err
+		}
+	}
+
+	f.closeBlockDirectoryLocked()
+	f.blockStore = sm
+	f.blockDirectory = sm
+	return nil
+}
+
+// detachBlockDirectory 停止使用块数据目录，remove为true时同时删除目录
+func (f *FragmentaImpl) detachBlockDirectory(remove bool) error {
+	f.componentMutex.Lock()
+	defer f.componentMutex.Unlock()
+
+	if f.blockDirectory == nil {
+		return nil
+	}
+	f.blockStore = nil
+	if err := f.closeBlockDirectoryLocked(); err != nil {
+		return err
+	}
+
+	if remove {
+		if err := os.RemoveAll(BlockDirectory(f.path)); err != nil {
+			logger.Error("删除块数据目录失败", "path", BlockDirectory(f.path), "error", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// closeBlockDirectoryLocked 关闭块数据目录的存储管理器（调用方需持有componentMutex写锁）
+func (f *FragmentaImpl) closeBlockDirectoryLocked() error {
+	if f.blockDirectory == nil {
+		return nil
+	}
+
+	err := f.blockDirectory.Close()
+	f.blockDirectory = nil
+	if err != nil {
+		logger.Error("关闭块数据目录失败", "error", err)
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package fragmenta
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestConvertStorageMode 测试容器模式和目录模式之间的转换
+func TestConvertStorageMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.frag")
+
+	f, err := CreateFragmenta(path, nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	id1, err := f.WriteBlock([]byte("container block"), nil)
+	if err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	if err := f.SetMetadata(TagTitle, []byte("modes")); err != nil {
+		t.Fatalf("设置元数据失败: %v", err)
+	}
+
+	if err := f.ConvertToContainerMode(); !errors.Is(err, ErrInvalidOperation) {
+		t.Errorf("容器模式不能再转换为容器模式: %v", err)
+	}
+	if err := f.ConvertToDirectoryMode(); err != nil {
+		t.Fatalf("转换为目录模式失败: %v", err)
+	}
+	if f.GetHeader().StorageMode != DirectoryMode {
+		t.Errorf("文件头中的存储模式应为目录模式: %d", f.GetHeader().StorageMode)
+	}
+	if _, err := os.Stat(BlockDirectory(path)); err != nil {
+		t.Fatalf("转换后应创建块数据目录: %v", err)
+	}
+
+	id2, err := f.WriteBlock([]byte("directory block"), nil)
+	if err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+
+	// 重新打开后继续使用块数据目录，删除目录中的数据后读取失败
+	f, err = OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	impl := f.(*FragmentaImpl)
+	if impl.blockDirectory == nil {
+		t.Fatalf("目录模式的文件打开时应挂接块数据目录")
+	}
+	for id, want := range map[uint32]string{id1: "container block", id2: "directory block"} {
+		data, err := f.ReadBlock(id)
+		if err != nil || string(data) != want {
+			t.Errorf("读取块%d失败: %q, %v", id, data, err)
+		}
+	}
+	if data, err := impl.blockDirectory.ReadBlock(id2); err != nil || string(data) != "directory block" {
+		t.Errorf("块数据应保存在块数据目录中: %q, %v", data, err)
+	}
+
+	// 格式文件仍保存完整的块数据，不经过块数据目录也能读取
+	if data, err := impl.blockManager.ReadBlock(id2); err != nil || string(data) != "directory block" {
+		t.Errorf("格式文件中应保留块数据: %q, %v", data, err)
+	}
+
+	if err := f.ConvertToContainerMode(); err != nil {
+		t.Fatalf("转换为容器模式失败: %v", err)
+	}
+	if _, err := os.Stat(BlockDirectory(path)); !os.IsNotExist(err) {
+		t.Errorf("转换为容器模式后应删除块数据目录: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+
+	f, err = OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer f.Close()
+
+	if f.GetHeader().StorageMode != ContainerMode {
+		t.Errorf("重新打开后存储模式应为容器模式: %d", f.GetHeader().StorageMode)
+	}
+	if data, err := f.ReadBlock(id2); err != nil || string(data) != "directory block" {
+		t.Errorf("转换回容器模式后读取块失败: %q, %v", data, err)
+	}
+	if title, err := f.GetMetadata(TagTitle); err != nil || string(title) != "modes" {
+		t.Errorf("转换后元数据不正确: %q, %v", title, err)
+	}
+}
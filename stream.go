@@ -0,0 +1,189 @@
+package fragmenta
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+)
+
+// streamBufferSize 流式写出时每次写入writer的最大字节数，与io.Copy的缓冲区大小一致
+const streamBufferSize = 32 * 1024
+
+// WriteFromReader 将reader中的数据按DefaultBlockSize切分写入一条块链，返回对象的句柄
+// 每次只从reader读取一个块的数据，块之间通过块头的PreviousBlock/NextBlock链接并随块头保存，
+// 用 ReadToWriter(ctx, handle.FirstBlockID, writer) 读回。options应用于每个块，
+// 其中的元数据标签和块属性只设置在第一个块上；options.AppendToBlockID不为0时新块链接在该块之后。
+// 空的reader写入一个空块。写入失败时删除本次已写入的块。
+// 内容寻址模式下整个对象按内容寻址：已有相同内容的对象时释放本次写入的块，返回已有对象的句柄。
+// 与 WriteBlock 一样可以与其他块写入并发，整个写入期间与提交互斥
+func (f *FragmentaImpl) WriteFromReader(reader io.Reader, options *BlockOptions) (*ObjectHandle, error) {
+	if f.readOnly {
+		return nil, ErrReadOnly
+	}
+
+	f.writeMutex.RLock()
+	defer f.writeMutex.RUnlock()
+
+	var base BlockOptions
+	if options != nil {
+		base = *options
+	} else {
+		base = BlockOptions{BlockType: NormalBlockType, Checksum: true}
+	}
+
+	// 追加到已有块链的数据不是独立的对象，不按内容寻址
+	addressed := f.contentAddressable(&base)
+	hasher := sha256.New()
+	if addressed {
+		reader = io.TeeReader(reader, hasher)
+	}
+
+	handle := &ObjectHandle{}
+	var written []uint32
+	prev := base.AppendToBlockID
+
+	for {
+		chunk := make([]byte, DefaultBlockSize)
+		n, err := io.ReadFull(reader, chunk)
+		if err == io.EOF && len(written) > 0 {
+			break
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			logger.Error("读取数据失败", "error", err)
+			f.freeBlocks(written)
+			return nil, err
+		}
+
+		blockOptions := base
+		blockOptions.AppendToBlockID = prev
+		if len(written) > 0 {
+			blockOptions.MetadataTags = nil
+			blockOptions.Attributes = nil
+		}
+
+		blockID, writeErr := f.writeBlock(chunk[:n], &blockOptions)
+		if writeErr != nil {
+			logger.Error("写入数据块失败", "error", writeErr)
+			f.freeBlocks(written)
+			return nil, writeErr
+		}
+
+		written = append(written, blockID)
+		handle.Size += int64(n)
+		prev = blockID
+
+		// 读到末尾（包括不足一个块的最后一段）
+		if err != nil {
+			break
+		}
+	}
+
+	handle.FirstBlockID = written[0]
+	handle.LastBlockID = written[len(written)-1]
+	handle.BlockCount = uint32(len(written))
+
+	if addressed {
+		var hash ContentHash
+		copy(hash[:], hasher.Sum(nil))
+		return f.addressObject(handle, written, hash)
+	}
+	return handle, nil
+}
+
+// freeBlocks 删除写入失败时已写入的块，失败只记录日志
+func (f *FragmentaImpl) freeBlocks(blocks []uint32) {
+	for _, blockID := range blocks {
+		if err := f.deleteBlock(blockID); err != nil {
+			logger.Warn("删除数据块失败", "blockID", blockID, "error", err)
+		}
+	}
+}
+
+// ReadToWriter 将从blockID开始的块链按顺序写入writer，返回写入的字节数
+// 块链由块头的NextBlock链接（见 WriteFromReader、BlockOptions.AppendToBlockID 和 LinkBlocks），
+// 未链接的块只写出它自己。每次只在内存中保留一个块，写入按streamBufferSize分段；
+// ctx取消时在下一段写入前停止并返回ctx.Err()
+func (f *FragmentaImpl) ReadToWriter(ctx context.Context, blockID uint32, writer io.Writer) (int64, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var written int64
+	visited := make(map[uint32]struct{})
+
+	// 内容寻址的块链对象边写出边计算哈希，单块对象由ReadBlock校验
+	expected, verify := f.contentHash(blockID)
+	hasher := sha256.New()
+
+	for id := blockID; id != 0; {
+		if _, ok := visited[id]; ok {
+			logger.Error("块链形成环", "blockID", blockID, "repeated", id)
+			return written, fmt.Errorf("%w: block %d appears twice", ErrBrokenBlockChain, id)
+		}
+		visited[id] = struct{}{}
+
+		header, err := f.blockManager.GetBlockInfo(id)
+		if err != nil {
+			if id != blockID {
+				err = fmt.Errorf("%w: block %d: %w", ErrBrokenBlockChain, id, err)
+			}
+			logger.Error("读取块信息失败", "blockID", id, "error", err)
+			return written, err
+		}
+
+		data, err := f.ReadBlock(id)
+		if err != nil {
+			logger.Error("读取数据失败", "blockID", id, "error", err)
+			return written, err
+		}
+		if id == blockID && header.NextBlock == 0 {
+			verify = false
+		}
+		if verify {
+			hasher.Write(data)
+		}
+
+		n, err := writeChunks(ctx, writer, data)
+		written += n
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("写入数据失败", "blockID", id, "error", err)
+			}
+			return written, err
+		}
+
+		id = header.NextBlock
+	}
+
+	if verify && !bytes.Equal(hasher.Sum(nil), expected[:]) {
+		logger.Error("对象内容与内容哈希不符", "blockID", blockID, "hash", expected)
+		return written, fmt.Errorf("%w: block %d", ErrContentMismatch, blockID)
+	}
+	return written, nil
+}
+
+// writeChunks 将data按streamBufferSize分段写入writer，每段写入前检查ctx
+func writeChunks(ctx context.Context, writer io.Writer, data []byte) (int64, error) {
+	var written int64
+
+	for len(data) > 0 {
+		if err := ctx.Err(); err != nil {
+			return written, err
+		}
+
+		chunk := data[:min(len(data), streamBufferSize)]
+		n, err := writer.Write(chunk)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+		if n != len(chunk) {
+			return written, io.ErrShortWrite
+		}
+		data = data[n:]
+	}
+
+	return written, ctx.Err()
+}
@@ -0,0 +1,234 @@
+package fragmenta
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+	"sync"
+	"testing"
+	"testing/iotest"
+)
+
+// cancelWriter 在第一次写入后取消上下文
+type cancelWriter struct {
+	bytes.Buffer
+	cancel context.CancelFunc
+}
+
+func (w *cancelWriter) Write(p []byte) (int, error) {
+	w.cancel()
+	return w.Buffer.Write(p)
+}
+
+// TestReadToWriter 测试按块链流式读取
+func TestReadToWriter(t *testing.T) {
+	f, err := CreateFragmenta(filepath.Join(t.TempDir(), "test.frag"), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	defer f.Close()
+
+	parts := [][]byte{
+		[]byte("first-"),
+		bytes.Repeat([]byte("x"), 3*streamBufferSize+7),
+		[]byte("-last"),
+	}
+	var head, prev uint32
+	for _, part := range parts {
+		id, err := f.WriteBlock(part, &BlockOptions{Checksum: true, AppendToBlockID: prev})
+		if err != nil {
+			t.Fatalf("写入块失败: %v", err)
+		}
+		if head == 0 {
+			head = id
+		}
+		prev = id
+	}
+	single, err := f.WriteBlock([]byte("single"), nil)
+	if err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+
+	var buf bytes.Buffer
+	n, err := f.ReadToWriter(context.Background(), head, &buf)
+	if err != nil {
+		t.Fatalf("读取块链失败: %v", err)
+	}
+	want := bytes.Join(parts, nil)
+	if n != int64(len(want)) || !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("块链内容不正确: 写入%d字节，期望%d字节", n, len(want))
+	}
+
+	// 从链中间开始读取只写出后续的块
+	buf.Reset()
+	if _, err := f.ReadToWriter(context.Background(), prev, &buf); err != nil || buf.String() != "-last" {
+		t.Errorf("从链中间读取不正确: %q, %v", buf.String(), err)
+	}
+
+	buf.Reset()
+	if _, err := f.ReadToWriter(context.Background(), single, &buf); err != nil || buf.String() != "single" {
+		t.Errorf("读取单个块不正确: %q, %v", buf.String(), err)
+	}
+
+	if _, err := f.ReadToWriter(context.Background(), 9999, &buf); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("读取不存在的块应返回ErrBlockNotFound: %v", err)
+	}
+
+	// 写出第一段后取消，读取停止
+	ctx, cancel := context.WithCancel(context.Background())
+	writer := &cancelWriter{cancel: cancel}
+	n, err = f.ReadToWriter(ctx, head, writer)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("取消后应返回context.Canceled: %v", err)
+	}
+	if n != int64(writer.Len()) || n >= int64(len(want)) {
+		t.Errorf("取消后写入的字节数不正确: %d", n)
+	}
+
+	// 形成环的块链返回ErrBrokenBlockChain
+	if err := f.LinkBlocks(prev, head); err != nil {
+		t.Fatalf("链接块失败: %v", err)
+	}
+	if _, err := f.ReadToWriter(context.Background(), head, &bytes.Buffer{}); !errors.Is(err, ErrBrokenBlockChain) {
+		t.Errorf("块链形成环应返回ErrBrokenBlockChain: %v", err)
+	}
+}
+
+// TestWriteFromReader 测试分块写入和读回对象
+func TestWriteFromReader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.frag")
+	f, err := CreateFragmenta(path, nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+
+	data := make([]byte, 2*int(DefaultBlockSize)+100)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	handle, err := f.WriteFromReader(bytes.NewReader(data), &BlockOptions{
+		Checksum:   true,
+		Attributes: map[string]string{"content-type": "application/octet-stream"},
+	})
+	if err != nil {
+		t.Fatalf("写入对象失败: %v", err)
+	}
+	if handle.BlockCount != 3 || handle.Size != int64(len(data)) {
+		t.Errorf("对象句柄不正确: %+v", handle)
+	}
+
+	// 块属性只设置在第一个块上
+	if attrs, _ := f.GetBlockAttributes(handle.FirstBlockID); attrs["content-type"] != "application/octet-stream" {
+		t.Errorf("第一个块的属性不正确: %v", attrs)
+	}
+	if attrs, _ := f.GetBlockAttributes(handle.LastBlockID); len(attrs) != 0 {
+		t.Errorf("后续块不应有属性: %v", attrs)
+	}
+
+	empty, err := f.WriteFromReader(bytes.NewReader(nil), nil)
+	if err != nil || empty.BlockCount != 1 || empty.Size != 0 {
+		t.Fatalf("写入空对象失败: %+v, %v", empty, err)
+	}
+
+	// 读取失败时删除已写入的块
+	before, _ := f.ListBlocks()
+	failing := io.MultiReader(bytes.NewReader(data), iotest.ErrReader(errors.New("boom")))
+	if _, err := f.WriteFromReader(failing, nil); err == nil {
+		t.Errorf("读取失败时应返回错误")
+	}
+	if after, _ := f.ListBlocks(); len(after) != len(before) {
+		t.Errorf("写入失败后应删除已写入的块: %d -> %d", len(before), len(after))
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+
+	// 块链随块头保存，重新打开后仍能读回
+	f, err = OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer f.Close()
+
+	var buf bytes.Buffer
+	if _, err := f.ReadToWriter(context.Background(), handle.FirstBlockID, &buf); err != nil {
+		t.Fatalf("读取对象失败: %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("读回的对象内容不正确: %d字节", buf.Len())
+	}
+}
+
+// TestWriteFromReaderConcurrentCommit 测试流式写入与提交并发（ImportDirectory的并行导入即如此使用），用 -race 运行
+func TestWriteFromReaderConcurrentCommit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.frag")
+	f, err := CreateFragmenta(path, nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+
+	data := bytes.Repeat([]byte("stream"), int(DefaultBlockSize)/2)
+	errs := make(chan error, 5)
+
+	// 从第一个块开始，写入期间不断修改元数据并提交
+	done := make(chan struct{})
+	committed := make(chan struct{})
+	go func() {
+		defer close(committed)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			if err := f.SetMetadata(UserTag(1), []byte("commit")); err != nil {
+				errs <- err
+				return
+			}
+			if err := f.Commit(); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	var writers sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		writers.Add(1)
+		go func() {
+			defer writers.Done()
+			for j := 0; j < 5; j++ {
+				if _, err := f.WriteFromReader(iotest.OneByteReader(bytes.NewReader(data)), nil); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	writers.Wait()
+	close(done)
+	<-committed
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("并发写入失败: %v", err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+
+	f, err = OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer f.Close()
+	blocks, err := f.ListBlocks()
+	if err != nil || len(blocks) != 20*3 {
+		t.Errorf("重新打开后应有60个块，实际%d个: %v", len(blocks), err)
+	}
+}
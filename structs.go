@@ -22,7 +22,8 @@ type FragmentaHeader struct {
 	IndexSize      uint64   // 索引区大小
 	TotalSize      uint64   // 文件总大小
 	UserDefinedID  [16]byte // 用户定义的唯一标识
-	CheckSum       [32]byte // 校验和（SHA-256）
+	CheckSum       [32]byte // 校验和（SHA-256），计算时此字段置零，全零表示旧版本写入的未校验文件头
+	Generation     uint64   // 文件头代数，每次写入递增，打开时选择代数最大的有效副本
 }
 
 // BlockHeader 定义数据块头部结构
@@ -77,6 +78,19 @@ type FragmentaOptions struct {
 	IndexUpdateMode   uint8  // 索引更新模式
 	MaxIndexCacheSize uint32 // 最大索引缓存大小
 	DedupEnabled      bool   // 是否启用重复数据删除
+
+	Deterministic    *DeterministicOptions // 确定性构建模式，为nil时不启用
+	ContentAddressed bool                  // 内容寻址模式（见 LookupContent）
+}
+
+// DeterministicOptions 确定性构建模式的选项
+// 启用后相同的输入（相同顺序的写入操作）生成逐字节相同的文件：文件头、元数据、块头、
+// 元数据历史、回收站、命名空间和签名中的时间戳都固定为Timestamp，元数据区按标签顺序写入。
+// 模式记录在文件头标志中（FlagDeterministic），重新打开后继续生效。
+// 依赖当前时间的操作（SetMetadataWithTTL、StartMetadataSweeper）返回ErrNondeterministic；
+// 只支持容器模式
+type DeterministicOptions struct {
+	Timestamp time.Time // 固定的时间戳，零值表示Unix纪元
 }
 
 // StorageOptions 存储选项
@@ -102,6 +116,15 @@ type BlockOptions struct {
 	AppendToBlockID uint32            // 要附加到的块ID（如果使用链式存储）
 	PriorityClass   uint8             // 优先级类别（用于缓存和存储管理）
 	LifecyclePolicy uint8             // 生命周期策略
+	Attributes      map[string]string // 块属性（如content-type、origin、tenant），随块信息一起保存并可通过索引层查询
+}
+
+// ObjectHandle WriteFromReader写入的对象，对象的数据按顺序保存在一条块链中
+type ObjectHandle struct {
+	FirstBlockID uint32 // 块链的第一个块，用于 ReadToWriter
+	LastBlockID  uint32 // 块链的最后一个块，可作为AppendToBlockID继续追加
+	BlockCount   uint32 // 块数
+	Size         int64  // 数据总大小（字节）
 }
 
 // IndexStatus 索引状态信息
@@ -150,6 +173,8 @@ type ResultEntry struct {
 	MetadataID   uint16            // 元数据ID
 	MetadataData []byte            // 元数据内容
 	ExtraData    map[string][]byte // 额外数据
+
+	Values map[string]interface{} // 查询选择的字段值（见 select:）
 }
 
 // BatchMetadataOperation 批量元数据操作
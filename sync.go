@@ -0,0 +1,397 @@
+package fragmenta
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"time"
+
+	"github.com/bpfs/fragmenta/throttle"
+)
+
+// DefaultSyncCheckpointBytes 同步时每传输这么多字节提交一次目标副本
+const DefaultSyncCheckpointBytes int64 = 64 * 1024 * 1024
+
+// SyncTarget 增量同步的目标副本（见 SyncTo），FragmentaImpl 实现了该接口，
+// 远程副本可以由客户端把这些调用转发到对端的FragDB
+type SyncTarget interface {
+	// SyncNode 返回同步树中深度为depth、块ID的前depth位为prefix的节点，depth为0时按当前内容重新构造同步树
+	SyncNode(depth int, prefix uint32) (MerkleNode, error)
+
+	// SyncMetadata 返回全部元数据，包括系统标签
+	SyncMetadata() (map[uint16][]byte, error)
+
+	// ApplyBlock 按源的块头写入块，同ID的已有块被替换
+	ApplyBlock(header *BlockHeader, data []byte, attributes map[string]string) error
+
+	// RemoveBlock 删除源中已不存在的块
+	RemoveBlock(blockID uint32) error
+
+	// ApplyMetadata 设置和删除元数据，每次同步传输完块后调用一次
+	ApplyMetadata(set map[uint16][]byte, remove []uint16) error
+
+	// Commit 提交已同步的内容
+	Commit() error
+}
+
+// SyncOptions 增量同步选项
+type SyncOptions struct {
+	Limiter         *throttle.Limiter // 传输块数据的限速，为nil时不限速
+	CheckpointBytes int64             // 每传输这么多字节提交一次目标副本，0表示DefaultSyncCheckpointBytes
+}
+
+// SyncReport 增量同步结果
+type SyncReport struct {
+	Root            MerkleHash    // 同步开始时源的同步树根哈希，同步完成后目标的根哈希与之相同
+	BlocksSent      int           // 传输的块数
+	BytesSent       int64         // 传输的块数据字节数
+	BlocksRemoved   int           // 目标上删除的块数
+	MetadataSet     int           // 目标上设置的元数据项数
+	MetadataRemoved int           // 目标上删除的元数据项数
+	Checkpoints     int           // 传输过程中提交目标副本的次数
+	Duration        time.Duration // 同步耗时
+}
+
+// SyncTo 把当前内容增量同步到目标副本，用于让边缘副本与中心存储保持一致。
+// 同步树与 MerkleTree 的结构相同，但包含系统块和回收站中的块，叶子哈希还覆盖块属性。
+// 先逐层比较两边的同步树，只传输内容不同或目标缺少的块，再同步元数据，最后删除目标上多余的块。
+// 块按ID升序传输，每传输opts.CheckpointBytes字节提交一次目标副本；ctx取消或出错时提交已传输的块并返回错误，
+// 再次调用SyncTo时已经一致的子树不会重新传输，因此中断的同步可以继续。
+// 中断期间目标的元数据可能仍指向旧的块，应在同步完成后再使用目标副本。
+// 块数据按存储的原样传输，加密块的密钥不会传输；目标副本应以与源相同的选项创建
+func (f *FragmentaImpl) SyncTo(ctx context.Context, remote SyncTarget, opts *SyncOptions) (*SyncReport, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+	checkpoint := opts.CheckpointBytes
+	if checkpoint <= 0 {
+		checkpoint = DefaultSyncCheckpointBytes
+	}
+
+	start := time.Now()
+	report := &SyncReport{}
+	defer func() { report.Duration = time.Since(start) }()
+
+	tree, err := f.syncTree()
+	if err != nil {
+		return report, err
+	}
+	report.Root = tree.Root()
+
+	changed, err := DiffMerkle(tree, syncTargetSource{remote})
+	if err != nil {
+		logger.Error("比较同步树失败", "error", err)
+		return report, err
+	}
+
+	// 传输源中存在的块，只在目标上存在的块最后删除
+	var removed []uint32
+	var pending int64
+	for _, blockID := range changed {
+		if err := ctx.Err(); err != nil {
+			return report, f.syncCheckpoint(remote, err)
+		}
+
+		if !tree.Contains(blockID) {
+			removed = append(removed, blockID)
+			continue
+		}
+
+		// 构造同步树后被删除的块留给下次同步
+		header, err := f.blockManager.GetBlockInfo(blockID)
+		if err != nil {
+			continue
+		}
+		data, err := f.readBlock(blockID)
+		if err != nil {
+			logger.Error("读取同步块失败", "blockID", blockID, "error", err)
+			return report, f.syncCheckpoint(remote, err)
+		}
+		attributes, _ := f.blockManager.GetBlockAttributes(blockID)
+
+		if err := opts.Limiter.Wait(ctx, int64(len(data))); err != nil {
+			return report, f.syncCheckpoint(remote, err)
+		}
+		if err := remote.ApplyBlock(header, data, attributes); err != nil {
+			logger.Error("同步块失败", "blockID", blockID, "error", err)
+			return report, f.syncCheckpoint(remote, err)
+		}
+		report.BlocksSent++
+		report.BytesSent += int64(len(data))
+
+		pending += int64(len(data))
+		if pending >= checkpoint {
+			if err := remote.Commit(); err != nil {
+				return report, err
+			}
+			report.Checkpoints++
+			pending = 0
+		}
+	}
+
+	if err := f.syncMetadataTo(remote, report); err != nil {
+		return report, f.syncCheckpoint(remote, err)
+	}
+
+	for _, blockID := range removed {
+		if err := remote.RemoveBlock(blockID); err != nil && err != ErrBlockNotFound {
+			logger.Error("删除目标块失败", "blockID", blockID, "error", err)
+			return report, f.syncCheckpoint(remote, err)
+		}
+		report.BlocksRemoved++
+	}
+
+	if err := remote.Commit(); err != nil {
+		logger.Error("提交同步目标失败", "error", err)
+		return report, err
+	}
+	return report, nil
+}
+
+// syncMetadataTo 比较两边的元数据并在目标上设置和删除不同的项
+func (f *FragmentaImpl) syncMetadataTo(remote SyncTarget, report *SyncReport) error {
+	local, err := f.SyncMetadata()
+	if err != nil {
+		return err
+	}
+	current, err := remote.SyncMetadata()
+	if err != nil {
+		return err
+	}
+
+	set := make(map[uint16][]byte)
+	for tag, value := range local {
+		if old, ok := current[tag]; !ok || !bytes.Equal(old, value) {
+			set[tag] = value
+		}
+	}
+	var remove []uint16
+	for tag := range current {
+		if _, ok := local[tag]; !ok {
+			remove = append(remove, tag)
+		}
+	}
+	sort.Slice(remove, func(i, j int) bool { return remove[i] < remove[j] })
+
+	if err := remote.ApplyMetadata(set, remove); err != nil {
+		logger.Error("同步元数据失败", "error", err)
+		return err
+	}
+	report.MetadataSet = len(set)
+	report.MetadataRemoved = len(remove)
+	return nil
+}
+
+// syncCheckpoint 同步中断时提交目标上已传输的块，返回中断的原因
+func (f *FragmentaImpl) syncCheckpoint(remote SyncTarget, cause error) error {
+	if err := remote.Commit(); err != nil {
+		logger.Warn("提交同步目标失败", "error", err)
+	}
+	return cause
+}
+
+// syncTargetSource 把目标副本的同步树作为 MerkleSource
+type syncTargetSource struct {
+	target SyncTarget
+}
+
+// MerkleNode 实现 MerkleSource
+func (s syncTargetSource) MerkleNode(depth int, prefix uint32) (MerkleNode, error) {
+	return s.target.SyncNode(depth, prefix)
+}
+
+// SyncNode 实现 SyncTarget，depth为0时重新构造同步树，其余节点来自该快照
+func (f *FragmentaImpl) SyncNode(depth int, prefix uint32) (MerkleNode, error) {
+	f.syncMutex.Lock()
+	defer f.syncMutex.Unlock()
+
+	if depth == 0 || f.syncSnapshot == nil {
+		tree, err := f.syncTree()
+		if err != nil {
+			return MerkleNode{}, err
+		}
+		f.syncSnapshot = tree
+	}
+	return f.syncSnapshot.MerkleNode(depth, prefix)
+}
+
+// SyncMetadata 实现 SyncTarget，返回包括系统标签和已过期标签在内的全部元数据
+func (f *FragmentaImpl) SyncMetadata() (map[uint16][]byte, error) {
+	return f.metadataManager.ListMetadata()
+}
+
+// ApplyBlock 实现 SyncTarget，按源的块头写入块并更新块数据存储、属性索引和查询服务
+func (f *FragmentaImpl) ApplyBlock(header *BlockHeader, data []byte, attributes map[string]string) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	putter, ok := f.blockManager.(syncBlockPutter)
+	if !ok {
+		return ErrInvalidOperation
+	}
+
+	if err := putter.putBlock(header, data, attributes); err != nil {
+		logger.Error("写入同步块失败", "blockID", header.BlockID, "error", err)
+		return err
+	}
+	f.isDirty.Store(true)
+	f.recordBlockHash(header.BlockID, data)
+
+	if err := f.storeBlock(header.BlockID, data); err != nil {
+		return err
+	}
+	if err := f.indexAttributes(header.BlockID, attributes); err != nil {
+		return err
+	}
+	return f.queryIndexBlock(header.BlockID)
+}
+
+// RemoveBlock 实现 SyncTarget，删除块但不修改其他块的链接和块签名表，这些由同步的其他块和元数据决定
+func (f *FragmentaImpl) RemoveBlock(blockID uint32) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	putter, ok := f.blockManager.(syncBlockPutter)
+	if !ok {
+		return ErrInvalidOperation
+	}
+
+	if err := putter.removeBlock(blockID); err != nil {
+		return err
+	}
+	f.isDirty.Store(true)
+	f.forgetBlockHash(blockID)
+
+	if err := f.indexAttributes(blockID, nil); err != nil {
+		return err
+	}
+	if err := f.unstoreBlock(blockID); err != nil {
+		return err
+	}
+	if err := f.removeBlockTags(blockID); err != nil {
+		return err
+	}
+	return f.queryRemoveBlock(blockID)
+}
+
+// ApplyMetadata 实现 SyncTarget，直接设置和删除元数据（包括系统标签），
+// 然后丢弃从元数据和系统块加载的各种表，使它们在下次使用时按同步后的内容重新加载
+func (f *FragmentaImpl) ApplyMetadata(set map[uint16][]byte, remove []uint16) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+
+	for tag, value := range set {
+		if err := f.metadataManager.SetMetadata(tag, value); err != nil {
+			logger.Error("设置同步元数据失败", "tag", tag, "error", err)
+			return err
+		}
+	}
+	for _, tag := range remove {
+		if err := f.metadataManager.DeleteMetadata(tag); err != nil && err != ErrMetadataNotFound {
+			logger.Error("删除同步元数据失败", "tag", tag, "error", err)
+			return err
+		}
+	}
+	f.isDirty.Store(true)
+
+	f.resetLoadedTables()
+	return nil
+}
+
+// resetLoadedTables 丢弃首次使用时加载的表，未提交的修改也一并丢弃
+func (f *FragmentaImpl) resetLoadedTables() {
+	f.writeMutex.Lock()
+	f.namespace = nil
+	f.writeMutex.Unlock()
+
+	f.signatureMutex.Lock()
+	f.signatures, f.signatureBlock = nil, 0
+	f.signatureMutex.Unlock()
+
+	f.trashMutex.Lock()
+	f.trash, f.trashBlock, f.trashLoaded = nil, 0, false
+	f.trashMutex.Unlock()
+
+	f.contentMutex.Lock()
+	f.content, f.contentBlock = nil, 0
+	f.contentMutex.Unlock()
+
+	f.historyMutex.Lock()
+	f.history, f.historyBlock, f.historyLoaded = nil, 0, false
+	f.historyMutex.Unlock()
+
+	f.expiryMutex.Lock()
+	f.expirations = nil
+	f.expiryMutex.Unlock()
+
+	f.userTagMutex.Lock()
+	f.userTags = nil
+	f.userTagMutex.Unlock()
+
+	f.viewMutex.Lock()
+	f.views = nil
+	f.viewMutex.Unlock()
+}
+
+// syncBlockPutter 可以按给定块头写入和删除块的块管理器，供增量同步使用
+type syncBlockPutter interface {
+	putBlock(header *BlockHeader, data []byte, attributes map[string]string) error
+	removeBlock(blockID uint32) error
+}
+
+// syncTree 构造同步树，覆盖全部块（包括系统块和回收站中的块），有属性的块的叶子哈希还覆盖属性
+func (f *FragmentaImpl) syncTree() (*MerkleTree, error) {
+	headers := f.blockManager.ListBlocks()
+
+	f.merkleMutex.Lock()
+	defer f.merkleMutex.Unlock()
+
+	ids := make([]uint32, 0, len(headers))
+	leaves := make([]MerkleHash, 0, len(headers))
+	for _, header := range headers {
+		hash, err := f.blockHashLocked(header)
+		if err != nil {
+			return nil, err
+		}
+		leaf := merkleLeaf(header.BlockID, header.BlockType, header.NextBlock, hash)
+		if attributes, _ := f.blockManager.GetBlockAttributes(header.BlockID); len(attributes) > 0 {
+			leaf = syncAttributeLeaf(leaf, attributes)
+		}
+
+		ids = append(ids, header.BlockID)
+		leaves = append(leaves, leaf)
+	}
+	f.pruneBlockHashesLocked()
+
+	return newMerkleTree(ids, leaves), nil
+}
+
+// syncAttributeLeaf 把块属性合入叶子哈希: SHA-256(0x02 | 叶子哈希 | (键长度 | 键 | 值长度 | 值)...)，属性按键排序
+func syncAttributeLeaf(leaf MerkleHash, attributes map[string]string) MerkleHash {
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	h.Write([]byte{0x02})
+	h.Write(leaf[:])
+	for _, key := range keys {
+		value := attributes[key]
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(key))))
+		h.Write([]byte(key))
+		h.Write(binary.BigEndian.AppendUint32(nil, uint32(len(value))))
+		h.Write([]byte(value))
+	}
+
+	var result MerkleHash
+	h.Sum(result[:0])
+	return result
+}
@@ -0,0 +1,170 @@
+package fragmenta
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestSyncTo 测试增量同步：首次全量同步、只传输修改的块、删除多余的块，以及中断后继续
+func TestSyncTo(t *testing.T) {
+	dir := t.TempDir()
+	src, err := CreateFragmenta(filepath.Join(dir, "src.frag"), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	defer src.Close()
+	dstPath := filepath.Join(dir, "dst.frag")
+	dst, err := CreateFragmenta(dstPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []uint32
+	for i := 0; i < 20; i++ {
+		id, err := src.WriteBlock([]byte(fmt.Sprintf("block-%d", i)), &BlockOptions{
+			BlockType:  NormalBlockType,
+			Checksum:   true,
+			Attributes: map[string]string{"n": fmt.Sprint(i)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	if err := src.LinkBlocks(ids[0], ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.SetMetadata(0x1001, []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+	ns, err := src.Namespace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.MkdirAll("/docs", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.WriteFile("/docs/a.txt", []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 目标上只存在的块和元数据在同步后删除
+	if _, err := dst.WriteBlock([]byte("stale"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.SetMetadata(0x1002, []byte("stale")); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := src.SyncTo(context.Background(), dst, nil)
+	if err != nil {
+		t.Fatalf("同步失败: %v", err)
+	}
+	if report.BlocksSent < len(ids) || report.MetadataRemoved != 1 {
+		t.Errorf("首次同步结果不正确: %+v", report)
+	}
+	assertSynced(t, src, dst, report.Root)
+
+	// 再次同步不传输任何块
+	if report, err = src.SyncTo(context.Background(), dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	if report.BlocksSent != 0 || report.BlocksRemoved != 0 || report.MetadataSet != 0 {
+		t.Errorf("内容一致时不应传输: %+v", report)
+	}
+
+	// 修改一个块的属性并删除一个块，只传输变化的部分
+	if err := src.SetBlockAttributes(ids[5], map[string]string{"n": "changed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.DeleteBlock(ids[6]); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = src.SyncTo(context.Background(), dst, nil); err != nil {
+		t.Fatal(err)
+	}
+	if report.BlocksSent != 1 || report.BlocksRemoved != 1 {
+		t.Errorf("应只传输修改的块并删除多余的块: %+v", report)
+	}
+	assertSynced(t, src, dst, report.Root)
+
+	// 取消的同步不传输块，之后可以继续完成
+	for i := 0; i < 5; i++ {
+		if _, err := src.WriteBlock(bytes.Repeat([]byte{byte(i)}, 1000), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := src.SyncTo(ctx, dst, nil); !errors.Is(err, context.Canceled) {
+		t.Fatalf("取消的同步应返回context.Canceled: %v", err)
+	}
+	if report, err = src.SyncTo(context.Background(), dst, &SyncOptions{CheckpointBytes: 2000}); err != nil {
+		t.Fatal(err)
+	}
+	if report.BlocksSent != 5 || report.Checkpoints != 2 {
+		t.Errorf("继续同步的结果不正确: %+v", report)
+	}
+	assertSynced(t, src, dst, report.Root)
+
+	// 重新打开后目标内容不变
+	if err := dst.Close(); err != nil {
+		t.Fatal(err)
+	}
+	dst, err = OpenFragmenta(dstPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+	got, err := dst.(*FragmentaImpl).MerkleTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := src.MerkleTree()
+	if got.Root() != want.Root() {
+		t.Error("重新打开后目标的根哈希应与源相同")
+	}
+	dstNS, err := dst.Namespace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := dstNS.ReadFile("/docs/a.txt"); err != nil || string(data) != "hello" {
+		t.Errorf("目标上的文件内容不正确: %q, %v", data, err)
+	}
+}
+
+// assertSynced 检查目标与源的同步树、块和元数据一致
+func assertSynced(t *testing.T, src, dst FragDB, root MerkleHash) {
+	t.Helper()
+
+	if node, err := dst.SyncNode(0, 0); err != nil || node.Hash != root {
+		t.Fatalf("目标的同步树根哈希应与源相同: %v", err)
+	}
+	srcMeta, _ := src.SyncMetadata()
+	dstMeta, _ := dst.SyncMetadata()
+	if !reflect.DeepEqual(srcMeta, dstMeta) {
+		t.Errorf("元数据不一致: %v != %v", srcMeta, dstMeta)
+	}
+
+	blocks, _ := src.ListBlocks()
+	for _, header := range blocks {
+		want, _ := src.ReadBlock(header.BlockID)
+		got, err := dst.ReadBlock(header.BlockID)
+		if err != nil || !bytes.Equal(got, want) {
+			t.Errorf("块%d不一致: %v", header.BlockID, err)
+		}
+		wantAttrs, _ := src.GetBlockAttributes(header.BlockID)
+		gotAttrs, _ := dst.GetBlockAttributes(header.BlockID)
+		if len(wantAttrs) != 0 && !reflect.DeepEqual(wantAttrs, gotAttrs) {
+			t.Errorf("块%d的属性不一致: %v != %v", header.BlockID, gotAttrs, wantAttrs)
+		}
+	}
+}
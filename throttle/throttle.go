@@ -0,0 +1,141 @@
+// Package throttle 提供后台维护任务共享的令牌桶限速器
+//
+// 整理、模式转换、重平衡和索引重建等后台任务共享同一个Limiter，
+// 以限制它们合计占用的带宽(字节/秒)和IOPS，避免与前台读写争抢IO。
+package throttle
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter 按字节数和操作数两个维度限速的令牌桶
+// 桶容量为一秒的配额，超过容量的单次请求会透支，后续请求等待令牌补足。
+// nil Limiter表示不限速，所有方法都可以在nil上调用。
+type Limiter struct {
+	mu sync.Mutex
+
+	bytesPerSecond int64
+	opsPerSecond   int
+
+	byteTokens float64
+	opTokens   float64
+	last       time.Time
+
+	waited time.Duration // 累计等待时间
+}
+
+// New 创建限速器，bytesPerSecond或opsPerSecond不大于0表示该维度不限速
+func New(bytesPerSecond int64, opsPerSecond int) *Limiter {
+	l := &Limiter{last: time.Now()}
+	l.SetLimits(bytesPerSecond, opsPerSecond)
+	// 初始时桶是满的
+	l.byteTokens = float64(l.bytesPerSecond)
+	l.opTokens = float64(l.opsPerSecond)
+	return l
+}
+
+// SetLimits 修改限速，已透支的令牌保留，桶中多余的令牌按新容量截断
+func (l *Limiter) SetLimits(bytesPerSecond int64, opsPerSecond int) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	l.bytesPerSecond = max(bytesPerSecond, 0)
+	l.opsPerSecond = max(opsPerSecond, 0)
+	l.byteTokens = min(l.byteTokens, float64(l.bytesPerSecond))
+	l.opTokens = min(l.opTokens, float64(l.opsPerSecond))
+}
+
+// Limits 返回当前限速
+func (l *Limiter) Limits() (bytesPerSecond int64, opsPerSecond int) {
+	if l == nil {
+		return 0, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.bytesPerSecond, l.opsPerSecond
+}
+
+// Waited 返回累计因限速等待的时间
+func (l *Limiter) Waited() time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.waited
+}
+
+// Wait 为一次读写n字节的操作申请令牌，必要时阻塞，ctx取消时返回ctx.Err()
+// 取消时已申请的令牌不归还
+func (l *Limiter) Wait(ctx context.Context, n int64) error {
+	delay := l.reserve(n)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve 扣除令牌并返回需要等待的时间
+func (l *Limiter) reserve(n int64) time.Duration {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+
+	var delay time.Duration
+	if l.bytesPerSecond > 0 {
+		l.byteTokens -= float64(n)
+		delay = max(delay, deficit(l.byteTokens, float64(l.bytesPerSecond)))
+	}
+	if l.opsPerSecond > 0 {
+		l.opTokens--
+		delay = max(delay, deficit(l.opTokens, float64(l.opsPerSecond)))
+	}
+
+	l.waited += delay
+	return delay
+}
+
+// refill 按经过的时间补充令牌，调用方需持有mu
+func (l *Limiter) refill(now time.Time) {
+	elapsed := now.Sub(l.last).Seconds()
+	l.last = now
+	if elapsed <= 0 {
+		return
+	}
+
+	l.byteTokens = min(l.byteTokens+elapsed*float64(l.bytesPerSecond), float64(l.bytesPerSecond))
+	l.opTokens = min(l.opTokens+elapsed*float64(l.opsPerSecond), float64(l.opsPerSecond))
+}
+
+// deficit 返回令牌为负时补足所需的时间
+func deficit(tokens, rate float64) time.Duration {
+	if tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-tokens / rate * float64(time.Second))
+}
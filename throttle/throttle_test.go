@@ -0,0 +1,72 @@
+package throttle
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestLimiterBytes 测试按字节限速：一秒的突发配额用完后按速率等待
+func TestLimiterBytes(t *testing.T) {
+	l := New(1000, 0)
+
+	if delay := l.reserve(1000); delay != 0 {
+		t.Errorf("桶内令牌足够时不应等待: %v", delay)
+	}
+	if delay := l.reserve(500); delay < 400*time.Millisecond || delay > 600*time.Millisecond {
+		t.Errorf("透支500字节应等待约0.5秒: %v", delay)
+	}
+	if l.Waited() == 0 {
+		t.Errorf("应记录等待时间")
+	}
+}
+
+// TestLimiterOps 测试按操作数限速，取字节和操作两个维度中较长的等待
+func TestLimiterOps(t *testing.T) {
+	l := New(1<<30, 10)
+
+	for i := 0; i < 10; i++ {
+		l.reserve(1)
+	}
+	if delay := l.reserve(1); delay < 50*time.Millisecond {
+		t.Errorf("超过IOPS配额应等待: %v", delay)
+	}
+}
+
+// TestLimiterUnlimited 测试nil和未设置限速时不等待
+func TestLimiterUnlimited(t *testing.T) {
+	var nilLimiter *Limiter
+	if err := nilLimiter.Wait(context.Background(), 1<<40); err != nil {
+		t.Errorf("nil限速器不应返回错误: %v", err)
+	}
+	nilLimiter.SetLimits(1, 1)
+
+	l := New(0, 0)
+	if delay := l.reserve(1 << 40); delay != 0 {
+		t.Errorf("不限速时不应等待: %v", delay)
+	}
+}
+
+// TestLimiterWaitCancel 测试等待期间取消
+func TestLimiterWaitCancel(t *testing.T) {
+	l := New(1, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if err := l.Wait(ctx, 100); err != context.DeadlineExceeded {
+		t.Errorf("应返回超时错误: %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("取消后应立即返回")
+	}
+}
+
+// TestLimiterSetLimits 测试修改限速
+func TestLimiterSetLimits(t *testing.T) {
+	l := New(100, 0)
+	l.SetLimits(0, 5)
+	if bytes, ops := l.Limits(); bytes != 0 || ops != 5 {
+		t.Errorf("限速不正确: %d %d", bytes, ops)
+	}
+}
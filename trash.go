@@ -0,0 +1,574 @@
+package fragmenta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// 回收站表常量
+const (
+	// TrashMagic 回收站表魔数 "FTRS"
+	TrashMagic uint32 = 0x46545253
+	// TrashVersion 回收站表版本
+	TrashVersion uint16 = 1
+)
+
+// TrashOptions 回收站的保留策略
+type TrashOptions struct {
+	Retention time.Duration // 删除后至少保留的时间，PurgeTrash只清除超过该时间的项；0表示PurgeTrash清除所有项
+}
+
+// TrashEntry 回收站中的一项：一个块或一个元数据标签
+type TrashEntry struct {
+	BlockID   uint32    // 块ID，元数据项为0
+	Tag       uint16    // 元数据标签，块为0
+	Size      uint32    // 块数据或元数据值的大小
+	DeletedAt time.Time // 删除时间
+}
+
+// IsBlock 是否是块
+func (e TrashEntry) IsBlock() bool {
+	return e.BlockID != 0
+}
+
+// trashTable 回收站表
+type trashTable struct {
+	enabled  bool
+	options  TrashOptions
+	blocks   map[uint32]time.Time
+	metadata map[uint16]trashedMetadata
+	dirty    bool
+}
+
+// trashedMetadata 回收站中的元数据值
+type trashedMetadata struct {
+	value     []byte
+	deletedAt time.Time
+}
+
+// EnableTrash 启用回收站，或修改已启用回收站的保留策略。
+// 启用后 DeleteBlock 把块移入回收站：块的数据和索引保留，但读取、列出和查询都不再返回该块
+// （查询可以用 "deleted: include" 包含回收站中的块），可以用 RestoreBlock 恢复；
+// DeleteMetadata 和批量、事务中的元数据删除把删除前的值移入回收站，可以用 RestoreMetadata 恢复。
+// 回收站中的项由 PurgeTrash 按保留策略永久删除。
+// 回收站表保存在系统块中（位置记录在TagTrash），随Commit持久化，重新打开文件后继续生效
+func (f *FragmentaImpl) EnableTrash(options TrashOptions) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	if options.Retention < 0 {
+		return fmt.Errorf("%w: 保留时间不能为负数", ErrInvalidArgument)
+	}
+
+	f.trashMutex.Lock()
+	defer f.trashMutex.Unlock()
+
+	if err := f.loadTrashLocked(); err != nil {
+		return err
+	}
+	if f.trash == nil {
+		f.trash = &trashTable{
+			blocks:   make(map[uint32]time.Time),
+			metadata: make(map[uint16]trashedMetadata),
+		}
+		logger.Info("已启用回收站")
+	}
+
+	f.trash.enabled = true
+	f.trash.options = options
+	f.trash.dirty = true
+	f.isDirty.Store(true)
+	return nil
+}
+
+// DisableTrash 停用回收站，之后的删除立即生效。已在回收站中的项保留，仍可以恢复或清除
+func (f *FragmentaImpl) DisableTrash() error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+
+	f.trashMutex.Lock()
+	defer f.trashMutex.Unlock()
+
+	if err := f.loadTrashLocked(); err != nil {
+		return err
+	}
+	if f.trash == nil || !f.trash.enabled {
+		return nil
+	}
+
+	f.trash.enabled = false
+	f.trash.dirty = true
+	f.isDirty.Store(true)
+
+	logger.Info("已停用回收站", "blocks", len(f.trash.blocks), "metadata", len(f.trash.metadata))
+	return nil
+}
+
+// ListTrash 列出回收站中的块和元数据，按删除时间从早到晚排列
+func (f *FragmentaImpl) ListTrash() ([]TrashEntry, error) {
+	f.trashMutex.Lock()
+	defer f.trashMutex.Unlock()
+
+	if err := f.loadTrashLocked(); err != nil {
+		return nil, err
+	}
+	if f.trash == nil {
+		return nil, nil
+	}
+
+	entries := make([]TrashEntry, 0, len(f.trash.blocks)+len(f.trash.metadata))
+	for blockID, deletedAt := range f.trash.blocks {
+		entry := TrashEntry{BlockID: blockID, DeletedAt: deletedAt}
+		if header, err := f.blockManager.GetBlockInfo(blockID); err == nil {
+			entry.Size = header.Size
+		}
+		entries = append(entries, entry)
+	}
+	for tag, item := range f.trash.metadata {
+		entries = append(entries, TrashEntry{Tag: tag, Size: uint32(len(item.value)), DeletedAt: item.deletedAt})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].DeletedAt.Equal(entries[j].DeletedAt) {
+			return entries[i].DeletedAt.Before(entries[j].DeletedAt)
+		}
+		if entries[i].BlockID != entries[j].BlockID {
+			return entries[i].BlockID < entries[j].BlockID
+		}
+		return entries[i].Tag < entries[j].Tag
+	})
+	return entries, nil
+}
+
+// RestoreBlock 把块从回收站中恢复
+func (f *FragmentaImpl) RestoreBlock(blockID uint32) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+
+	f.trashMutex.Lock()
+	defer f.trashMutex.Unlock()
+
+	if err := f.loadTrashLocked(); err != nil {
+		return err
+	}
+	if f.trash == nil {
+		return ErrNotInTrash
+	}
+	if _, ok := f.trash.blocks[blockID]; !ok {
+		return ErrNotInTrash
+	}
+
+	f.restoreBlockFromTrashLocked(blockID)
+	logger.Info("已从回收站恢复数据块", "blockID", blockID)
+	return nil
+}
+
+// RestoreMetadata 把元数据从回收站中恢复。标签在删除后又被设置了新值时返回ErrInvalidOperation
+func (f *FragmentaImpl) RestoreMetadata(tag uint16) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+
+	f.trashMutex.Lock()
+	defer f.trashMutex.Unlock()
+
+	if err := f.loadTrashLocked(); err != nil {
+		return err
+	}
+	if f.trash == nil {
+		return ErrNotInTrash
+	}
+	item, ok := f.trash.metadata[tag]
+	if !ok {
+		return ErrNotInTrash
+	}
+
+	if _, err := f.metadataManager.GetMetadata(tag); err == nil {
+		return fmt.Errorf("%w: 标签0x%04X删除后已设置新值", ErrInvalidOperation, tag)
+	}
+	if err := f.SetMetadata(tag, item.value); err != nil {
+		return err
+	}
+
+	delete(f.trash.metadata, tag)
+	f.trash.dirty = true
+	return nil
+}
+
+// PurgeTrash 永久删除回收站中超过保留时间的项，返回删除的项数。处于保留期或法律保留中的块（见 SetBlockRetention）不删除
+func (f *FragmentaImpl) PurgeTrash() (int, error) {
+	if f.readOnly {
+		return 0, ErrReadOnly
+	}
+
+	f.trashMutex.Lock()
+	if err := f.loadTrashLocked(); err != nil {
+		f.trashMutex.Unlock()
+		return 0, err
+	}
+	if f.trash == nil {
+		f.trashMutex.Unlock()
+		return 0, nil
+	}
+
+	now := f.now()
+	expired := func(deletedAt time.Time) bool {
+		return f.trash.options.Retention == 0 || now.Sub(deletedAt) >= f.trash.options.Retention
+	}
+
+	purged := 0
+	for tag, item := range f.trash.metadata {
+		if expired(item.deletedAt) {
+			delete(f.trash.metadata, tag)
+			purged++
+		}
+	}
+	var blocks []uint32
+	for blockID, deletedAt := range f.trash.blocks {
+		// 处于保留中的块留在回收站中，保留期过后再清除
+		if expired(deletedAt) && f.checkRetention(blockID) == nil {
+			blocks = append(blocks, blockID)
+		}
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+	if purged > 0 {
+		f.trash.dirty = true
+		f.isDirty.Store(true)
+	}
+	f.trashMutex.Unlock()
+
+	// 删除块时会同步块签名等组件，它们可能读取块，因此不持有trashMutex
+	var firstErr error
+	for _, blockID := range blocks {
+		if err := f.deleteBlock(blockID); err != nil && err != ErrBlockNotFound {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		f.trashMutex.Lock()
+		delete(f.trash.blocks, blockID)
+		f.trash.dirty = true
+		f.trashMutex.Unlock()
+		purged++
+	}
+
+	if purged > 0 {
+		logger.Info("已清除回收站", "items", purged)
+	}
+	return purged, firstErr
+}
+
+// moveBlockToTrash 启用回收站时把块移入回收站，返回是否已移入。
+// 块已在回收站中时返回ErrBlockNotFound
+func (f *FragmentaImpl) moveBlockToTrash(blockID uint32) (bool, error) {
+	f.trashMutex.Lock()
+	defer f.trashMutex.Unlock()
+
+	if err := f.loadTrashLocked(); err != nil {
+		return false, err
+	}
+	if f.trash == nil {
+		return false, nil
+	}
+	if _, ok := f.trash.blocks[blockID]; ok {
+		return false, ErrBlockNotFound
+	}
+	if !f.trash.enabled {
+		return false, nil
+	}
+	if _, err := f.blockManager.GetBlockInfo(blockID); err != nil {
+		return false, err
+	}
+
+	f.trash.blocks[blockID] = f.now()
+	f.trash.dirty = true
+	f.isDirty.Store(true)
+
+	if service := f.getQueryService(); service != nil {
+		if err := service.MarkDeleted(blockID, true); err != nil {
+			logger.Warn("标记查询索引中的已删除块失败", "blockID", blockID, "error", err)
+		}
+	}
+	return true, nil
+}
+
+// restoreBlockFromTrashLocked 把块移出回收站，调用方需持有trashMutex
+func (f *FragmentaImpl) restoreBlockFromTrashLocked(blockID uint32) {
+	delete(f.trash.blocks, blockID)
+	f.trash.dirty = true
+	f.isDirty.Store(true)
+
+	if service := f.getQueryService(); service != nil {
+		if err := service.MarkDeleted(blockID, false); err != nil {
+			logger.Warn("取消查询索引中的删除标记失败", "blockID", blockID, "error", err)
+		}
+	}
+}
+
+// moveMetadataToTrash 启用回收站时保存被删除的元数据值，保留标签不保存
+func (f *FragmentaImpl) moveMetadataToTrash(tag uint16, value []byte) {
+	if IsReservedTag(tag) {
+		return
+	}
+
+	f.trashMutex.Lock()
+	defer f.trashMutex.Unlock()
+
+	if err := f.loadTrashLocked(); err != nil {
+		logger.Warn("加载回收站失败，元数据未移入回收站", "tag", tag, "error", err)
+		return
+	}
+	if f.trash == nil || !f.trash.enabled {
+		return
+	}
+
+	f.trash.metadata[tag] = trashedMetadata{value: append([]byte(nil), value...), deletedAt: f.now()}
+	f.trash.dirty = true
+}
+
+// isTrashed 块是否在回收站中
+func (f *FragmentaImpl) isTrashed(blockID uint32) bool {
+	f.trashMutex.Lock()
+	defer f.trashMutex.Unlock()
+
+	if err := f.loadTrashLocked(); err != nil {
+		logger.Warn("加载回收站失败", "error", err)
+		return false
+	}
+	if f.trash == nil {
+		return false
+	}
+	_, ok := f.trash.blocks[blockID]
+	return ok
+}
+
+// trashedBlocks 返回回收站中的块ID集合，回收站为空时返回nil
+func (f *FragmentaImpl) trashedBlocks() map[uint32]struct{} {
+	f.trashMutex.Lock()
+	defer f.trashMutex.Unlock()
+
+	if err := f.loadTrashLocked(); err != nil {
+		logger.Warn("加载回收站失败", "error", err)
+		return nil
+	}
+	if f.trash == nil || len(f.trash.blocks) == 0 {
+		return nil
+	}
+
+	blocks := make(map[uint32]struct{}, len(f.trash.blocks))
+	for blockID := range f.trash.blocks {
+		blocks[blockID] = struct{}{}
+	}
+	return blocks
+}
+
+// loadTrashLocked 首次使用时从TagTrash加载回收站表，从未启用时f.trash为nil。
+// 调用方需持有trashMutex
+func (f *FragmentaImpl) loadTrashLocked() error {
+	if f.trashLoaded {
+		return nil
+	}
+
+	value, err := f.metadataManager.GetMetadata(TagTrash)
+	if err == ErrMetadataNotFound {
+		f.trashLoaded = true
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	// 直接读取表所在的块，ReadBlock需要检查回收站
+	blockID := uint32(DecodeInt64(value))
+	table, err := f.readBlock(blockID)
+	if err != nil {
+		logger.Error("读取回收站表失败", "blockID", blockID, "error", err)
+		return err
+	}
+	trash, err := decodeTrashTable(table)
+	if err != nil {
+		logger.Error("解析回收站表失败", "blockID", blockID, "error", err)
+		return err
+	}
+
+	f.trash = trash
+	f.trashBlock = blockID
+	f.trashLoaded = true
+	return nil
+}
+
+// syncTrash 将有修改的回收站表写入新的系统块并更新TagTrash，在提交时调用。
+// 回收站已停用且为空时删除回收站表
+func (f *FragmentaImpl) syncTrash() error {
+	f.trashMutex.Lock()
+	defer f.trashMutex.Unlock()
+
+	if f.trash == nil || !f.trash.dirty {
+		return nil
+	}
+
+	if !f.trash.enabled && len(f.trash.blocks) == 0 && len(f.trash.metadata) == 0 {
+		if err := f.metadataManager.DeleteMetadata(TagTrash); err != nil && err != ErrMetadataNotFound {
+			logger.Error("删除回收站表位置失败", "error", err)
+			return err
+		}
+		f.freeTrashBlockLocked()
+		f.trash = nil
+		return nil
+	}
+
+	table, err := encodeTrashTable(f.trash)
+	if err != nil {
+		return err
+	}
+
+	blockID, err := f.writeBlock(table, &BlockOptions{BlockType: SystemBlockType, Checksum: true})
+	if err != nil {
+		logger.Error("写入回收站表失败", "error", err)
+		return err
+	}
+	if err := f.setMetadata(TagTrash, EncodeInt64(int64(blockID))); err != nil {
+		logger.Error("更新回收站表位置失败", "error", err)
+		return err
+	}
+
+	f.freeTrashBlockLocked()
+	f.trashBlock = blockID
+	f.trash.dirty = false
+	return nil
+}
+
+// freeTrashBlockLocked 释放旧的回收站表块，调用方需持有trashMutex
+func (f *FragmentaImpl) freeTrashBlockLocked() {
+	if f.trashBlock == 0 {
+		return
+	}
+
+	// 直接由块管理器释放，与块签名表相同
+	if err := f.blockManager.DeleteBlock(f.trashBlock); err != nil {
+		logger.Warn("释放旧回收站表失败", "blockID", f.trashBlock, "error", err)
+	} else {
+		if err := f.unstoreBlock(f.trashBlock); err != nil {
+			logger.Warn("从块存储删除旧回收站表失败", "blockID", f.trashBlock, "error", err)
+		}
+		if err := f.queryRemoveBlock(f.trashBlock); err != nil {
+			logger.Warn("移除旧回收站表的查询索引失败", "blockID", f.trashBlock, "error", err)
+		}
+	}
+	f.trashBlock = 0
+}
+
+// encodeTrashTable 编码回收站表
+// 格式: 魔数 | 版本 | 启用标志 | 保留时间 | 块数量 | 块记录(块ID | 删除时间)... |
+// 元数据数量 | 元数据记录(标签 | 删除时间 | 值长度 | 值)...
+func encodeTrashTable(trash *trashTable) ([]byte, error) {
+	blocks := make([]uint32, 0, len(trash.blocks))
+	for blockID := range trash.blocks {
+		blocks = append(blocks, blockID)
+	}
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i] < blocks[j] })
+
+	tags := make([]uint16, 0, len(trash.metadata))
+	for tag := range trash.metadata {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	var enabled uint8
+	if trash.enabled {
+		enabled = 1
+	}
+
+	fields := []interface{}{
+		TrashMagic, TrashVersion, enabled, int64(trash.options.Retention), uint32(len(blocks)),
+	}
+	for _, blockID := range blocks {
+		fields = append(fields, blockID, trash.blocks[blockID].UnixNano())
+	}
+	fields = append(fields, uint32(len(tags)))
+	for _, tag := range tags {
+		item := trash.metadata[tag]
+		fields = append(fields, tag, item.deletedAt.UnixNano(), uint32(len(item.value)), item.value)
+	}
+
+	buf := new(bytes.Buffer)
+	for _, field := range fields {
+		if err := binary.Write(buf, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("编码回收站表失败: %w", err)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decodeTrashTable 解析回收站表
+func decodeTrashTable(table []byte) (*trashTable, error) {
+	r := bytes.NewReader(table)
+
+	var magic, blockCount uint32
+	var version uint16
+	var enabled uint8
+	var retention int64
+	for _, field := range []interface{}{&magic, &version, &enabled, &retention, &blockCount} {
+		if err := binary.Read(r, binary.BigEndian, field); err != nil {
+			return nil, fmt.Errorf("%w: 回收站表头不完整", ErrInvalidFragmenta)
+		}
+	}
+	if magic != TrashMagic {
+		return nil, fmt.Errorf("%w: 回收站表魔数错误", ErrInvalidFragmenta)
+	}
+	if version > TrashVersion {
+		return nil, ErrUnsupportedVersion
+	}
+
+	trash := &trashTable{
+		enabled:  enabled != 0,
+		options:  TrashOptions{Retention: time.Duration(retention)},
+		blocks:   make(map[uint32]time.Time, blockCount),
+		metadata: make(map[uint16]trashedMetadata),
+	}
+	for i := uint32(0); i < blockCount; i++ {
+		var blockID uint32
+		var deletedAt int64
+		for _, field := range []interface{}{&blockID, &deletedAt} {
+			if err := binary.Read(r, binary.BigEndian, field); err != nil {
+				return nil, fmt.Errorf("%w: 回收站块记录不完整", ErrInvalidFragmenta)
+			}
+		}
+		trash.blocks[blockID] = time.Unix(0, deletedAt)
+	}
+
+	var tagCount uint32
+	if err := binary.Read(r, binary.BigEndian, &tagCount); err != nil {
+		return nil, fmt.Errorf("%w: 回收站表不完整", ErrInvalidFragmenta)
+	}
+	for i := uint32(0); i < tagCount; i++ {
+		var tag uint16
+		var deletedAt int64
+		var size uint32
+		for _, field := range []interface{}{&tag, &deletedAt, &size} {
+			if err := binary.Read(r, binary.BigEndian, field); err != nil {
+				return nil, fmt.Errorf("%w: 回收站元数据记录不完整", ErrInvalidFragmenta)
+			}
+		}
+		if int64(size) > int64(r.Len()) {
+			return nil, fmt.Errorf("%w: 回收站元数据记录不完整", ErrInvalidFragmenta)
+		}
+
+		value := make([]byte, size)
+		if _, err := io.ReadFull(r, value); err != nil {
+			return nil, fmt.Errorf("%w: 回收站元数据记录不完整", ErrInvalidFragmenta)
+		}
+		trash.metadata[tag] = trashedMetadata{value: value, deletedAt: time.Unix(0, deletedAt)}
+	}
+
+	return trash, nil
+}
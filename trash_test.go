@@ -0,0 +1,142 @@
+package fragmenta
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestTrash 测试回收站的删除、恢复和清除
+func TestTrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.frag")
+	f, err := CreateFragmenta(path, nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+
+	if err := f.EnableTrash(TrashOptions{}); err != nil {
+		t.Fatalf("启用回收站失败: %v", err)
+	}
+	first, _ := f.WriteBlock([]byte("first"), &BlockOptions{Attributes: map[string]string{"tenant": "alpha"}})
+	second, _ := f.WriteBlock([]byte("second"), &BlockOptions{Attributes: map[string]string{"tenant": "alpha"}})
+	f.SetMetadata(TagTitle, []byte("title"))
+	if err := f.StartQueryService(); err != nil {
+		t.Fatalf("启动查询服务失败: %v", err)
+	}
+
+	if err := f.DeleteBlock(first); err != nil {
+		t.Fatalf("删除数据块失败: %v", err)
+	}
+	if err := f.DeleteMetadata(TagTitle); err != nil {
+		t.Fatalf("删除元数据失败: %v", err)
+	}
+
+	// 回收站中的块不可见
+	if _, err := f.ReadBlock(first); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("回收站中的块不应可读: %v", err)
+	}
+	if _, err := f.GetBlockInfo(first); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("回收站中的块不应有块信息: %v", err)
+	}
+	if err := f.DeleteBlock(first); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("重复删除应返回ErrBlockNotFound: %v", err)
+	}
+	if found, _ := f.FindBlocksByAttribute("tenant", "alpha"); len(found) != 1 || found[0] != second {
+		t.Errorf("属性查找不应包含回收站中的块: %v", found)
+	}
+	if result, err := f.Query("tenant==alpha"); err != nil || result.TotalCount != 1 {
+		t.Errorf("查询不应包含回收站中的块: %+v, %v", result, err)
+	}
+	if result, err := f.Query("tenant==alpha; deleted: include"); err != nil || result.TotalCount != 2 {
+		t.Errorf("deleted: include 应包含回收站中的块: %+v, %v", result, err)
+	}
+
+	trash, err := f.ListTrash()
+	if err != nil || len(trash) != 2 || !trash[0].IsBlock() || trash[0].BlockID != first || trash[0].Size != 5 || trash[1].Tag != TagTitle {
+		t.Fatalf("回收站内容不正确: %+v, %v", trash, err)
+	}
+
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+
+	// 回收站随文件保存
+	f, err = OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer f.Close()
+
+	blocks, _ := f.ListBlocks()
+	for _, header := range blocks {
+		if header.BlockID == first {
+			t.Errorf("块列表不应包含回收站中的块")
+		}
+	}
+	if trash, _ := f.ListTrash(); len(trash) != 2 {
+		t.Fatalf("重新打开后回收站内容不正确: %+v", trash)
+	}
+
+	if err := f.RestoreBlock(first); err != nil {
+		t.Fatalf("恢复数据块失败: %v", err)
+	}
+	if data, err := f.ReadBlock(first); err != nil || string(data) != "first" {
+		t.Errorf("恢复的块内容不正确: %q, %v", data, err)
+	}
+	if err := f.RestoreBlock(first); !errors.Is(err, ErrNotInTrash) {
+		t.Errorf("重复恢复应返回ErrNotInTrash: %v", err)
+	}
+	if err := f.RestoreMetadata(TagTitle); err != nil {
+		t.Fatalf("恢复元数据失败: %v", err)
+	}
+	if value, _ := f.GetMetadata(TagTitle); string(value) != "title" {
+		t.Errorf("恢复的元数据不正确: %q", value)
+	}
+
+	// 事务中的删除同样进入回收站
+	f.DeleteBlock(first)
+	tx, _ := f.BeginTx()
+	tx.DeleteBlock(second)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	if _, err := f.ReadBlock(second); !errors.Is(err, ErrBlockNotFound) {
+		t.Errorf("事务删除的块应在回收站中: %v", err)
+	}
+
+	// 未超过保留时间的项不清除
+	if err := f.EnableTrash(TrashOptions{Retention: time.Hour}); err != nil {
+		t.Fatalf("修改保留策略失败: %v", err)
+	}
+	if n, err := f.PurgeTrash(); err != nil || n != 0 {
+		t.Errorf("不应清除未过期的项: %d, %v", n, err)
+	}
+	if err := f.EnableTrash(TrashOptions{}); err != nil {
+		t.Fatalf("修改保留策略失败: %v", err)
+	}
+	if n, err := f.PurgeTrash(); err != nil || n != 2 {
+		t.Errorf("应清除回收站中的所有项: %d, %v", n, err)
+	}
+	if err := f.RestoreBlock(second); !errors.Is(err, ErrNotInTrash) {
+		t.Errorf("清除后不能恢复: %v", err)
+	}
+
+	// 停用后删除立即生效，回收站为空时提交后删除回收站表
+	if err := f.DisableTrash(); err != nil {
+		t.Fatalf("停用回收站失败: %v", err)
+	}
+	third, _ := f.WriteBlock([]byte("third"), nil)
+	if err := f.DeleteBlock(third); err != nil {
+		t.Fatalf("删除数据块失败: %v", err)
+	}
+	if trash, _ := f.ListTrash(); len(trash) != 0 {
+		t.Errorf("停用后不应再进入回收站: %+v", trash)
+	}
+	if err := f.Commit(); err != nil {
+		t.Fatalf("提交失败: %v", err)
+	}
+	if _, err := f.GetMetadata(TagTrash); !errors.Is(err, ErrMetadataNotFound) {
+		t.Errorf("停用且为空后不应再有回收站表: %v", err)
+	}
+}
@@ -0,0 +1,314 @@
+package fragmenta
+
+// 事务操作类型
+const (
+	txSetMetadata uint8 = iota
+	txDeleteMetadata
+	txWriteBlock
+	txSetBlockAttributes
+	txDeleteBlock
+)
+
+// Tx 元数据和块操作的事务
+// 操作先在事务中排队，Commit时执行并提交到文件：任一操作或提交失败时撤销所有已执行的操作，
+// 文件保持事务开始提交前的状态。块删除在其他操作之后执行，因此事务中写入的块不会复用被删除块的ID。
+// 提交期间持有写锁，与Commit、存储模式转换和其他事务的提交互斥；不经过事务的直接写入不受隔离。
+// 启用回收站时，事务中删除的块和元数据与 DeleteBlock、DeleteMetadata 一样移入回收站。
+// Tx不能在多个goroutine中同时使用
+type Tx struct {
+	f        *FragmentaImpl
+	ops      []txOp
+	blockIDs []uint32
+	done     bool
+
+	// deletedMetadata 提交时被删除的元数据删除前的值，提交成功后移入回收站
+	deletedMetadata map[uint16][]byte
+}
+
+// txOp 事务中排队的操作
+type txOp struct {
+	kind       uint8
+	tag        uint16
+	value      []byte
+	blockID    uint32
+	options    *BlockOptions
+	attributes map[string]string
+}
+
+// restorableBlockDeleter 可以撤销块删除的块管理器
+type restorableBlockDeleter interface {
+	deleteBlockRestorable(blockID uint32) (func() error, error)
+}
+
+// BeginTx 开始一个事务
+func (f *FragmentaImpl) BeginTx() (*Tx, error) {
+	if f.readOnly {
+		return nil, ErrReadOnly
+	}
+	return &Tx{f: f}, nil
+}
+
+// SetMetadata 在事务中设置元数据，不能设置保留标签，值按元数据模式校验
+func (tx *Tx) SetMetadata(tag uint16, value []byte) error {
+	if IsReservedTag(tag) {
+		return ErrProtectedMetadata
+	}
+	if err := tx.f.MetadataSchema().Validate(tag, value); err != nil {
+		return err
+	}
+	return tx.add(txOp{kind: txSetMetadata, tag: tag, value: append([]byte(nil), value...)})
+}
+
+// DeleteMetadata 在事务中删除元数据，不能删除保留标签
+func (tx *Tx) DeleteMetadata(tag uint16) error {
+	if IsReservedTag(tag) {
+		return ErrProtectedMetadata
+	}
+	return tx.add(txOp{kind: txDeleteMetadata, tag: tag})
+}
+
+// WriteBlock 在事务中写入数据块，返回该块在事务写入中的序号，
+// 提交后通过 BlockIDs 获取分配的块ID
+func (tx *Tx) WriteBlock(data []byte, options *BlockOptions) (int, error) {
+	if options != nil {
+		if err := ValidateBlockAttributes(options.Attributes); err != nil {
+			return 0, err
+		}
+		if err := tx.f.validateBlockMetadataTags(options.MetadataTags); err != nil {
+			return 0, err
+		}
+		copied := *options
+		options = &copied
+	}
+
+	index := 0
+	for _, op := range tx.ops {
+		if op.kind == txWriteBlock {
+			index++
+		}
+	}
+
+	err := tx.add(txOp{kind: txWriteBlock, value: append([]byte(nil), data...), options: options})
+	return index, err
+}
+
+// SetBlockAttributes 在事务中替换已有块的全部属性
+func (tx *Tx) SetBlockAttributes(blockID uint32, attributes map[string]string) error {
+	if err := ValidateBlockAttributes(attributes); err != nil {
+		return err
+	}
+	return tx.add(txOp{kind: txSetBlockAttributes, blockID: blockID, attributes: copyAttributes(attributes)})
+}
+
+// DeleteBlock 在事务中删除已有的数据块
+func (tx *Tx) DeleteBlock(blockID uint32) error {
+	return tx.add(txOp{kind: txDeleteBlock, blockID: blockID})
+}
+
+// BlockIDs 返回事务中写入的块的ID，按写入顺序排列，提交成功前为空
+func (tx *Tx) BlockIDs() []uint32 {
+	return append([]uint32(nil), tx.blockIDs...)
+}
+
+// Rollback 放弃事务中排队的所有操作
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.ops = nil
+	return nil
+}
+
+// Commit 执行事务中的操作并提交到文件，失败时撤销已执行的操作并返回错误。
+// 无论成功与否，提交后事务都不能再使用
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+
+	f := tx.f
+	if f.readOnly {
+		return ErrReadOnly
+	}
+
+	f.writeMutex.Lock()
+	defer f.writeMutex.Unlock()
+
+	var (
+		undo     []func() error
+		blockIDs []uint32
+		deleted  []uint32
+	)
+	rollback := func(cause error) error {
+		for i := len(undo) - 1; i >= 0; i-- {
+			if err := undo[i](); err != nil {
+				logger.Error("撤销事务操作失败", "error", err)
+			}
+		}
+		f.isDirty.Store(true)
+		logger.Error("事务提交失败，已回滚", "operations", len(tx.ops), "error", cause)
+		return cause
+	}
+
+	// 先执行块删除以外的操作，再执行块删除
+	for _, deletes := range []bool{false, true} {
+		for _, op := range tx.ops {
+			if (op.kind == txDeleteBlock) != deletes {
+				continue
+			}
+
+			revert, blockID, err := tx.apply(op)
+			if err != nil {
+				return rollback(err)
+			}
+			undo = append(undo, revert)
+
+			switch {
+			case op.kind == txWriteBlock:
+				blockIDs = append(blockIDs, blockID)
+			case op.kind == txDeleteBlock && blockID != 0:
+				deleted = append(deleted, blockID)
+			}
+		}
+	}
+
+	if err := f.commitLocked(); err != nil {
+		return rollback(err)
+	}
+	tx.blockIDs = blockIDs
+
+	// 提交成功后再同步被删除块的索引、块数据存储和签名，并记录元数据修改
+	for _, blockID := range deleted {
+		if err := f.blockDeleted(blockID); err != nil {
+			logger.Warn("同步已删除块失败", "blockID", blockID, "error", err)
+		}
+	}
+	for _, op := range tx.ops {
+		switch op.kind {
+		case txSetMetadata:
+			f.recordMetadataChange(auditMetadataSet, op.tag, op.value)
+		case txDeleteMetadata:
+			if value, ok := tx.deletedMetadata[op.tag]; ok {
+				f.moveMetadataToTrash(op.tag, value)
+			}
+			f.recordMetadataChange(auditMetadataDelete, op.tag, nil)
+		}
+	}
+
+	return nil
+}
+
+// add 将操作加入事务
+func (tx *Tx) add(op txOp) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.ops = append(tx.ops, op)
+	return nil
+}
+
+// apply 执行一个事务操作，返回撤销该操作的函数。写入块时同时返回分配的块ID，
+// 删除块时同时返回被立即删除的块ID（块移入回收站时为0）
+func (tx *Tx) apply(op txOp) (func() error, uint32, error) {
+	f := tx.f
+
+	switch op.kind {
+	case txSetMetadata, txDeleteMetadata:
+		old, err := f.metadataManager.GetMetadata(op.tag)
+		existed := err == nil
+		if err != nil && err != ErrMetadataNotFound {
+			return nil, 0, err
+		}
+
+		if op.kind == txSetMetadata {
+			err = f.metadataManager.SetMetadata(op.tag, op.value)
+		} else {
+			err = f.metadataManager.DeleteMetadata(op.tag)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		f.isDirty.Store(true)
+
+		if op.kind == txDeleteMetadata && existed {
+			if tx.deletedMetadata == nil {
+				tx.deletedMetadata = make(map[uint16][]byte)
+			}
+			if _, ok := tx.deletedMetadata[op.tag]; !ok {
+				tx.deletedMetadata[op.tag] = old
+			}
+		}
+
+		return func() error {
+			if existed {
+				return f.metadataManager.SetMetadata(op.tag, old)
+			}
+			return f.metadataManager.DeleteMetadata(op.tag)
+		}, 0, nil
+
+	case txWriteBlock:
+		blockID, created, err := f.writeBlockOrDuplicate(op.value, op.options)
+		if err != nil {
+			if created {
+				// 块已写入但同步外部组件失败
+				if delErr := f.deleteBlock(blockID); delErr != nil {
+					logger.Error("删除写入失败的块失败", "blockID", blockID, "error", delErr)
+				}
+			}
+			return nil, 0, err
+		}
+		if !created {
+			// 内容寻址模式下返回了已有的块，撤销时不能删除
+			return func() error { return nil }, blockID, nil
+		}
+		return func() error {
+			return f.deleteBlock(blockID)
+		}, blockID, nil
+
+	case txSetBlockAttributes:
+		old, err := f.blockManager.GetBlockAttributes(op.blockID)
+		if err != nil {
+			return nil, 0, err
+		}
+		if err := f.SetBlockAttributes(op.blockID, op.attributes); err != nil {
+			return nil, 0, err
+		}
+
+		return func() error {
+			return f.SetBlockAttributes(op.blockID, old)
+		}, 0, nil
+
+	case txDeleteBlock:
+		if err := f.checkRetention(op.blockID); err != nil {
+			return nil, 0, err
+		}
+		moved, err := f.moveBlockToTrash(op.blockID)
+		if err != nil {
+			return nil, 0, err
+		}
+		if moved {
+			return func() error {
+				f.trashMutex.Lock()
+				defer f.trashMutex.Unlock()
+				f.restoreBlockFromTrashLocked(op.blockID)
+				return nil
+			}, 0, nil
+		}
+
+		deleter, ok := f.blockManager.(restorableBlockDeleter)
+		if !ok {
+			return nil, 0, ErrInvalidOperation
+		}
+		restore, err := deleter.deleteBlockRestorable(op.blockID)
+		if err != nil {
+			return nil, 0, err
+		}
+		f.isDirty.Store(true)
+
+		return restore, op.blockID, nil
+	}
+
+	return nil, 0, ErrInvalidOperation
+}
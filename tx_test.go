@@ -0,0 +1,154 @@
+package fragmenta
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// TestTxCommit 测试事务提交
+func TestTxCommit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.frag")
+	f, err := CreateFragmenta(path, nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+
+	keep, _ := f.WriteBlock([]byte("keep"), nil)
+	drop, _ := f.WriteBlock([]byte("drop"), nil)
+
+	tx, err := f.BeginTx()
+	if err != nil {
+		t.Fatalf("开始事务失败: %v", err)
+	}
+	tx.SetMetadata(TagTitle, []byte("tx"))
+	tx.WriteBlock([]byte("new-1"), nil)
+	tx.WriteBlock([]byte("new-2"), &BlockOptions{Checksum: true, Attributes: map[string]string{"tenant": "alpha"}})
+	tx.SetBlockAttributes(keep, map[string]string{"state": "kept"})
+	tx.DeleteBlock(drop)
+
+	// 提交前不生效
+	if _, err := f.GetMetadata(TagTitle); !errors.Is(err, ErrMetadataNotFound) {
+		t.Errorf("提交前元数据不应生效: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("提交事务失败: %v", err)
+	}
+	if err := tx.Commit(); !errors.Is(err, ErrTxDone) {
+		t.Errorf("重复提交应返回ErrTxDone: %v", err)
+	}
+	ids := tx.BlockIDs()
+	if len(ids) != 2 {
+		t.Fatalf("事务应写入2个块: %v", ids)
+	}
+	if found, _ := f.FindBlocksByAttribute("tenant", "alpha"); len(found) != 1 || found[0] != ids[1] {
+		t.Errorf("事务写入的块属性不正确: %v", found)
+	}
+	if attrs, _ := f.GetBlockAttributes(keep); attrs["state"] != "kept" {
+		t.Errorf("事务设置的块属性不正确: %v", attrs)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+
+	f, err = OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer f.Close()
+
+	if title, err := f.GetMetadata(TagTitle); err != nil || string(title) != "tx" {
+		t.Errorf("事务设置的元数据不正确: %q, %v", title, err)
+	}
+	if data, err := f.ReadBlock(ids[1]); err != nil || string(data) != "new-2" {
+		t.Errorf("事务写入的块不正确: %q, %v", data, err)
+	}
+	if _, err := f.ReadBlock(drop); err == nil {
+		t.Errorf("事务删除的块不应存在")
+	}
+}
+
+// TestTxRollbackOnError 测试事务中的操作失败时撤销所有操作
+func TestTxRollbackOnError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.frag")
+	f, err := CreateFragmenta(path, nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+
+	if err := f.SetMetadata(TagTitle, []byte("before")); err != nil {
+		t.Fatalf("设置元数据失败: %v", err)
+	}
+	head, _ := f.WriteBlock([]byte("head"), nil)
+	middle, _ := f.WriteBlock([]byte("middle"), &BlockOptions{
+		Checksum:        true,
+		AppendToBlockID: head,
+		Attributes:      map[string]string{"tenant": "alpha"},
+	})
+	tail, _ := f.WriteBlock([]byte("tail"), &BlockOptions{Checksum: true, AppendToBlockID: middle})
+	if err := f.Commit(); err != nil {
+		t.Fatalf("提交失败: %v", err)
+	}
+	before, _ := f.ListBlocks()
+
+	tx, _ := f.BeginTx()
+	tx.SetMetadata(TagTitle, []byte("after"))
+	tx.SetMetadata(TagDescription, []byte("new"))
+	tx.WriteBlock([]byte("new"), nil)
+	tx.SetBlockAttributes(middle, map[string]string{"tenant": "beta"})
+	tx.DeleteBlock(middle)
+	tx.DeleteBlock(9999)
+
+	if err := tx.Commit(); !errors.Is(err, ErrBlockNotFound) {
+		t.Fatalf("删除不存在的块应使事务失败: %v", err)
+	}
+	if tx.BlockIDs() != nil {
+		t.Errorf("失败的事务不应返回块ID: %v", tx.BlockIDs())
+	}
+
+	if title, _ := f.GetMetadata(TagTitle); string(title) != "before" {
+		t.Errorf("元数据应恢复为事务前的值: %q", title)
+	}
+	if _, err := f.GetMetadata(TagDescription); !errors.Is(err, ErrMetadataNotFound) {
+		t.Errorf("事务新增的元数据应被撤销: %v", err)
+	}
+	if after, _ := f.ListBlocks(); len(after) != len(before) {
+		t.Errorf("事务写入的块应被撤销: %d -> %d", len(before), len(after))
+	}
+	if found, _ := f.FindBlocksByAttribute("tenant", "alpha"); len(found) != 1 || found[0] != middle {
+		t.Errorf("块属性应恢复: %v", found)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+
+	// 撤销的删除在文件中也被清除
+	f, err = OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer f.Close()
+
+	if data, err := f.ReadBlock(middle); err != nil || string(data) != "middle" {
+		t.Errorf("撤销删除的块应可读取: %q, %v", data, err)
+	}
+	if header, err := f.GetBlockInfo(head); err != nil || header.NextBlock != middle {
+		t.Errorf("块链应恢复: %+v, %v", header, err)
+	}
+	if header, err := f.GetBlockInfo(tail); err != nil || header.PreviousBlock != middle {
+		t.Errorf("块链应恢复: %+v, %v", header, err)
+	}
+
+	tx, _ = f.BeginTx()
+	tx.SetMetadata(TagTitle, []byte("discarded"))
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("回滚事务失败: %v", err)
+	}
+	if err := tx.Commit(); !errors.Is(err, ErrTxDone) {
+		t.Errorf("回滚后提交应返回ErrTxDone: %v", err)
+	}
+	if title, _ := f.GetMetadata(TagTitle); string(title) != "before" {
+		t.Errorf("回滚的事务不应生效: %q", title)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/binary"
 	"errors"
 	"math"
+
+	"github.com/bpfs/fragmenta/storage"
 )
 
 // ===== 错误常量 =====
@@ -32,6 +34,56 @@ var (
 	ErrReadOnly = errors.New("operation not allowed in read-only mode")
 	// ErrIndexCorruption 索引损坏
 	ErrIndexCorruption = errors.New("index corruption detected")
+	// ErrPathNotFound 路径不存在
+	ErrPathNotFound = errors.New("path not found")
+	// ErrPathExists 路径已存在
+	ErrPathExists = errors.New("path already exists")
+	// ErrNotDirectory 不是目录
+	ErrNotDirectory = errors.New("not a directory")
+	// ErrIsDirectory 是目录
+	ErrIsDirectory = errors.New("is a directory")
+	// ErrDirectoryNotEmpty 目录非空
+	ErrDirectoryNotEmpty = errors.New("directory not empty")
+	// ErrInvalidPath 无效的路径
+	ErrInvalidPath = errors.New("invalid path")
+	// ErrHeaderChecksum 文件头校验和不匹配
+	ErrHeaderChecksum = errors.New("header checksum mismatch")
+	// ErrInvalidMigration 无效的迁移步骤
+	ErrInvalidMigration = errors.New("invalid migration")
+	// ErrSignatureNotFound 块没有签名
+	ErrSignatureNotFound = errors.New("block signature not found")
+	// ErrSignatureInvalid 块签名验证失败
+	ErrSignatureInvalid = errors.New("block signature invalid")
+	// ErrQueryServiceNotStarted 查询服务未启动
+	ErrQueryServiceNotStarted = errors.New("query service not started")
+	// ErrViewNotFound 命名查询不存在
+	ErrViewNotFound = errors.New("view not found")
+	// ErrJobNotFound 后台作业不存在
+	ErrJobNotFound = errors.New("job not found")
+	// ErrJobRunning 同名的后台作业正在运行
+	ErrJobRunning = errors.New("job is running")
+	// ErrBrokenBlockChain 块链的链接不一致（链接到不存在的块或形成环）
+	ErrBrokenBlockChain = errors.New("broken block chain")
+	// ErrTxDone 事务已提交或已回滚
+	ErrTxDone = errors.New("transaction already committed or rolled back")
+	// ErrMetadataType 元数据值与元数据模式中注册的类型不符
+	ErrMetadataType = errors.New("metadata type mismatch")
+	// ErrMetadataHistoryDisabled 未启用元数据历史
+	ErrMetadataHistoryDisabled = errors.New("metadata history not enabled")
+	// ErrNotInTrash 块或元数据不在回收站中
+	ErrNotInTrash = errors.New("not in trash")
+
+	// ErrNondeterministic 操作依赖当前时间，不能在确定性模式下使用
+	ErrNondeterministic = errors.New("operation is not allowed in deterministic mode")
+
+	// ErrContentMismatch 内容寻址的对象读出的数据与其内容哈希不符
+	ErrContentMismatch = errors.New("content does not match its hash")
+
+	// ErrCorrupted 块数据校验失败，与 storage.ErrCorrupted 相同
+	ErrCorrupted = storage.ErrCorrupted
+
+	// ErrRetained 块处于保留期或法律保留中，与 storage.ErrRetained 相同
+	ErrRetained = storage.ErrRetained
 )
 
 // ===== 魔数和版本常量 =====
@@ -41,10 +93,19 @@ const (
 	MagicNumber uint32 = 0x44654653 // "DeFS"
 
 	// CurrentVersion 当前格式版本
-	CurrentVersion uint16 = 0x0100 // 1.0
+	CurrentVersion uint16 = 0x0101 // 1.1
 
 	// MinSupportedVersion 最小支持版本
 	MinSupportedVersion uint16 = 0x0100 // 1.0
+
+	// HeaderSlotSize 单个文件头槽位的大小
+	HeaderSlotSize uint64 = 256
+
+	// ShadowHeaderOffset 影子文件头的偏移，仅在设置FlagShadowHeader时使用
+	ShadowHeaderOffset uint64 = HeaderSlotSize
+
+	// HeaderSize 文件头区域大小（主文件头和影子文件头），元数据区默认紧跟其后
+	HeaderSize uint64 = 2 * HeaderSlotSize
 )
 
 // ===== 存储模式常量 =====
@@ -98,6 +159,33 @@ const (
 	// TagFlags 标志
 	TagFlags uint16 = 0x000A
 
+	// TagNamespace 命名空间表所在的块ID
+	TagNamespace uint16 = 0x000B
+
+	// TagBlockSignatures 块签名表所在的块ID
+	TagBlockSignatures uint16 = 0x000C
+
+	// TagUserTags 用户标签名称表（见 AllocateUserTag）
+	TagUserTags uint16 = 0x000D
+
+	// TagMetadataHistory 元数据历史表所在的块ID（见 EnableMetadataHistory）
+	TagMetadataHistory uint16 = 0x000E
+
+	// TagTrash 回收站表所在的块ID（见 EnableTrash）
+	TagTrash uint16 = 0x000F
+
+	// TagMetadataExpiry 元数据过期时间表（见 SetMetadataWithTTL）
+	TagMetadataExpiry uint16 = 0x0010
+
+	// TagContentTable 内容寻址表所在的块ID（见 FragmentaOptions.ContentAddressed）
+	TagContentTable uint16 = 0x0011
+
+	// TagQueryViews 命名查询表（见 RegisterView）
+	TagQueryViews uint16 = 0x0012
+
+	// TagJobs 后台作业的检查点和进度（见 StartJob）
+	TagJobs uint16 = 0x0013
+
 	// 应用元数据标签 (0x0100-0x0FFF)
 
 	// TagApp1 应用1
@@ -127,6 +215,20 @@ func IsAppTag(tag uint16) bool {
 	return tag >= 0x0100 && tag < 0x1000
 }
 
+// IsReservedTag 检查是否是保留标签。保留标签由格式自身维护，不能通过SetMetadata等接口修改或删除；
+// 系统标签中只有标题、描述、作者、内容类型和内容大小可以由应用写入
+func IsReservedTag(tag uint16) bool {
+	if !IsSystemTag(tag) {
+		return false
+	}
+	switch tag {
+	case TagTitle, TagDescription, TagAuthor, TagContentType, TagContentSize:
+		return false
+	default:
+		return true
+	}
+}
+
 // ===== 文件标志常量 =====
 
 const (
@@ -147,6 +249,15 @@ const (
 
 	// FlagTempFile 临时文件
 	FlagTempFile uint16 = 0x0020
+
+	// FlagShadowHeader 文件在ShadowHeaderOffset处保留了影子文件头
+	FlagShadowHeader uint16 = 0x0040
+
+	// FlagDeterministic 文件以确定性模式创建，写入的时间戳固定为文件头的创建时间（见 DeterministicOptions）
+	FlagDeterministic uint16 = 0x0080
+
+	// FlagContentAddressed 文件以内容寻址模式创建，相同内容的对象只保存一份（见 FragmentaOptions.ContentAddressed）
+	FlagContentAddressed uint16 = 0x0100
 )
 
 // ===== 块类型常量 =====
@@ -180,6 +291,22 @@ const (
 	SystemBlockType uint8 = 0xFF
 )
 
+// ===== 块标志常量 =====
+
+const (
+	// BlockFlagCompressed 块数据已压缩
+	BlockFlagCompressed uint8 = 0x01
+
+	// BlockFlagEncrypted 块数据已加密
+	BlockFlagEncrypted uint8 = 0x02
+
+	// BlockFlagChecksum 块头中的校验和有效，读取时校验
+	BlockFlagChecksum uint8 = 0x04
+
+	// BlockFlagDeleted 块已删除，空间等待OptimizeBlocks回收
+	BlockFlagDeleted uint8 = 0x08
+)
+
 // ===== 索引更新模式常量 =====
 
 const (
@@ -243,6 +370,9 @@ const (
 
 	// DefaultIndexCacheSize 默认索引缓存大小
 	DefaultIndexCacheSize uint32 = 1024 * 1024 // 1MB
+
+	// DefaultBlockCacheSize 默认块数据缓存大小
+	DefaultBlockCacheSize int64 = 64 * 1024 * 1024 // 64MB
 )
 
 // ===== 编码解码工具函数 =====
@@ -0,0 +1,174 @@
+package fragmenta
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+const (
+	// MaxUserTagNameSize 用户标签名称的最大长度（字节）
+	MaxUserTagNameSize = 64
+
+	// allocatedTagBase AllocateUserTag分配的第一个标签，位于UserTag可表示的范围之后，
+	// 不会与应用直接使用UserTag(id)选择的标签冲突
+	allocatedTagBase uint16 = 0x2000
+
+	// userTagTableVersion 用户标签名称表的编码版本
+	userTagTableVersion uint8 = 1
+)
+
+// AllocateUserTag 为名称分配一个用户标签，名称和标签的对应关系保存在TagUserTags中，随Commit持久化。
+// 名称已分配时返回原来的标签。分配的标签可以用 LookupUserTag 按名称查找，
+// 在Query的标签条件中也可以直接使用名称，如 "tag:meta==<名称>"
+func (f *FragmentaImpl) AllocateUserTag(name string) (uint16, error) {
+	if f.readOnly {
+		return 0, ErrReadOnly
+	}
+	if err := validateFieldName(name); err != nil {
+		return 0, err
+	}
+	if len(name) > MaxUserTagNameSize {
+		return 0, fmt.Errorf("%w: 用户标签名称超过%d字节", ErrInvalidArgument, MaxUserTagNameSize)
+	}
+
+	f.userTagMutex.Lock()
+	defer f.userTagMutex.Unlock()
+
+	if err := f.loadUserTagsLocked(); err != nil {
+		return 0, err
+	}
+	if tag, ok := f.userTags[name]; ok {
+		return tag, nil
+	}
+
+	// 跳过已分配的标签和已有元数据的标签
+	used := make(map[uint16]bool, len(f.userTags))
+	for _, tag := range f.userTags {
+		used[tag] = true
+	}
+	tag := allocatedTagBase
+	for {
+		if !used[tag] {
+			if _, err := f.metadataManager.GetMetadata(tag); err == ErrMetadataNotFound {
+				break
+			}
+		}
+		if tag == 0xFFFF {
+			return 0, fmt.Errorf("%w: 没有可分配的用户标签", ErrStorageLimitExceeded)
+		}
+		tag++
+	}
+
+	f.userTags[name] = tag
+	if err := f.setMetadata(TagUserTags, encodeUserTags(f.userTags)); err != nil {
+		delete(f.userTags, name)
+		logger.Error("保存用户标签名称表失败", "name", name, "error", err)
+		return 0, err
+	}
+
+	logger.Info("已分配用户标签", "name", name, "tag", tag)
+	return tag, nil
+}
+
+// LookupUserTag 按名称查找AllocateUserTag分配的标签
+func (f *FragmentaImpl) LookupUserTag(name string) (uint16, bool) {
+	f.userTagMutex.Lock()
+	defer f.userTagMutex.Unlock()
+
+	if err := f.loadUserTagsLocked(); err != nil {
+		return 0, false
+	}
+	tag, ok := f.userTags[name]
+	return tag, ok
+}
+
+// UserTags 返回所有已分配的用户标签名称和标签
+func (f *FragmentaImpl) UserTags() (map[string]uint16, error) {
+	f.userTagMutex.Lock()
+	defer f.userTagMutex.Unlock()
+
+	if err := f.loadUserTagsLocked(); err != nil {
+		return nil, err
+	}
+	result := make(map[string]uint16, len(f.userTags))
+	for name, tag := range f.userTags {
+		result[name] = tag
+	}
+	return result, nil
+}
+
+// resolveTagName 将查询中的标签名称解析为标签：先查找分配的用户标签，再查找元数据模式中注册的名称
+func (f *FragmentaImpl) resolveTagName(name string) (uint32, bool) {
+	if tag, ok := f.LookupUserTag(name); ok {
+		return uint32(tag), true
+	}
+	if field, ok := f.MetadataSchema().Lookup(name); ok {
+		return uint32(field.Tag), true
+	}
+	return 0, false
+}
+
+// loadUserTagsLocked 首次使用时从TagUserTags加载用户标签名称表，调用方需持有userTagMutex
+func (f *FragmentaImpl) loadUserTagsLocked() error {
+	if f.userTags != nil {
+		return nil
+	}
+
+	data, err := f.metadataManager.GetMetadata(TagUserTags)
+	if err == ErrMetadataNotFound {
+		f.userTags = make(map[string]uint16)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	tags, err := decodeUserTags(data)
+	if err != nil {
+		logger.Error("加载用户标签名称表失败", "error", err)
+		return err
+	}
+	f.userTags = tags
+	return nil
+}
+
+// encodeUserTags 编码用户标签名称表
+// 格式: 版本 | 数量 | 记录...，记录为 标签 | 名称长度 | 名称，按标签排序
+func encodeUserTags(tags map[string]uint16) []byte {
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return tags[names[i]] < tags[names[j]] })
+
+	buf := make([]byte, 3, 3+len(names)*8)
+	buf[0] = userTagTableVersion
+	binary.BigEndian.PutUint16(buf[1:], uint16(len(names)))
+	for _, name := range names {
+		buf = binary.BigEndian.AppendUint16(buf, tags[name])
+		buf = append(buf, uint8(len(name)))
+		buf = append(buf, name...)
+	}
+	return buf
+}
+
+// decodeUserTags 解码用户标签名称表
+func decodeUserTags(data []byte) (map[string]uint16, error) {
+	if len(data) < 3 || data[0] != userTagTableVersion {
+		return nil, fmt.Errorf("%w: 无效的用户标签名称表", ErrIndexCorruption)
+	}
+
+	count := int(binary.BigEndian.Uint16(data[1:]))
+	tags := make(map[string]uint16, count)
+	data = data[3:]
+	for i := 0; i < count; i++ {
+		if len(data) < 3 || len(data) < 3+int(data[2]) {
+			return nil, fmt.Errorf("%w: 用户标签名称表被截断", ErrIndexCorruption)
+		}
+		size := int(data[2])
+		tags[string(data[3:3+size])] = binary.BigEndian.Uint16(data)
+		data = data[3+size:]
+	}
+	return tags, nil
+}
@@ -0,0 +1,125 @@
+package fragmenta
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// TestReservedTags 测试保留标签不能被应用修改
+func TestReservedTags(t *testing.T) {
+	f, err := CreateFragmenta(filepath.Join(t.TempDir(), "test.frag"), nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+	defer f.Close()
+
+	created, _ := f.GetMetadata(TagCreateTime)
+	for _, tag := range []uint16{TagCreateTime, TagVersion, TagNamespace, TagUserTags, 0x00F0} {
+		if err := f.SetMetadata(tag, EncodeInt64(1)); !errors.Is(err, ErrProtectedMetadata) {
+			t.Errorf("设置保留标签0x%04X应返回ErrProtectedMetadata: %v", tag, err)
+		}
+		if err := f.DeleteMetadata(tag); !errors.Is(err, ErrProtectedMetadata) {
+			t.Errorf("删除保留标签0x%04X应返回ErrProtectedMetadata: %v", tag, err)
+		}
+	}
+	batch := &BatchMetadataOperation{Operations: []MetadataOperation{{Operation: 0, Tag: TagCreateTime, Value: EncodeInt64(1)}}}
+	if err := f.BatchMetadataOp(batch); !errors.Is(err, ErrProtectedMetadata) {
+		t.Errorf("批量设置保留标签应返回ErrProtectedMetadata: %v", err)
+	}
+	tx, _ := f.BeginTx()
+	if err := tx.SetMetadata(TagLastModified, EncodeInt64(1)); !errors.Is(err, ErrProtectedMetadata) {
+		t.Errorf("事务设置保留标签应返回ErrProtectedMetadata: %v", err)
+	}
+	if value, _ := f.GetMetadata(TagCreateTime); !reflect.DeepEqual(value, created) {
+		t.Errorf("保留标签不应被修改")
+	}
+
+	// 应用可写的系统标签和应用、用户标签
+	for _, tag := range []uint16{TagTitle, TagAuthor, TagApp1, UserTag(1)} {
+		if err := f.SetMetadata(tag, []byte("ok")); err != nil {
+			t.Errorf("设置标签0x%04X失败: %v", tag, err)
+		}
+	}
+
+	// 命名空间仍可维护TagNamespace
+	ns, err := f.Namespace()
+	if err != nil {
+		t.Fatalf("加载命名空间失败: %v", err)
+	}
+	if err := ns.WriteFile("/a.txt", []byte("a"), 0o644); err != nil {
+		t.Fatalf("写入文件失败: %v", err)
+	}
+	if err := f.Commit(); err != nil {
+		t.Fatalf("提交失败: %v", err)
+	}
+	if _, err := f.GetMetadata(TagNamespace); err != nil {
+		t.Errorf("命名空间应记录TagNamespace: %v", err)
+	}
+}
+
+// TestAllocateUserTag 测试按名称分配用户标签
+func TestAllocateUserTag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.frag")
+	f, err := CreateFragmenta(path, nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+
+	// 已有元数据的标签不会被分配
+	if err := f.SetMetadata(allocatedTagBase, []byte("taken")); err != nil {
+		t.Fatalf("设置元数据失败: %v", err)
+	}
+	project, err := f.AllocateUserTag("project")
+	if err != nil {
+		t.Fatalf("分配用户标签失败: %v", err)
+	}
+	if project == allocatedTagBase || !IsUserTag(project) {
+		t.Errorf("分配的标签不正确: 0x%04X", project)
+	}
+	owner, _ := f.AllocateUserTag("owner")
+	if again, _ := f.AllocateUserTag("project"); again != project || owner == project {
+		t.Errorf("重复分配应返回原来的标签: 0x%04X 0x%04X 0x%04X", project, again, owner)
+	}
+	if _, err := f.AllocateUserTag("bad name"); !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("无效的名称应返回ErrInvalidArgument: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+
+	// 名称表随文件保存
+	f, err = OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer f.Close()
+
+	if tag, ok := f.LookupUserTag("owner"); !ok || tag != owner {
+		t.Errorf("重新打开后查找用户标签失败: 0x%04X, %v", tag, ok)
+	}
+	tags, err := f.UserTags()
+	if err != nil || !reflect.DeepEqual(tags, map[string]uint16{"project": project, "owner": owner}) {
+		t.Errorf("用户标签列表不正确: %v, %v", tags, err)
+	}
+
+	// 查询中按名称引用标签
+	id, err := f.WriteBlock([]byte("doc"), &BlockOptions{Checksum: true, MetadataTags: map[uint16][]byte{owner: []byte("alice")}})
+	if err != nil {
+		t.Fatalf("写入块失败: %v", err)
+	}
+	if err := f.StartQueryService(); err != nil {
+		t.Fatalf("启动查询服务失败: %v", err)
+	}
+	for _, query := range []string{"tag:meta==owner", "tag:meta==" + strconv.Itoa(int(owner))} {
+		result, err := f.Query(query)
+		if err != nil || len(result.Entries) != 1 || result.Entries[0].BlockID != id {
+			t.Errorf("查询 %q 结果不正确: %v, %v", query, result, err)
+		}
+	}
+	if result, err := f.Query("tag:meta==project"); err != nil || len(result.Entries) != 0 {
+		t.Errorf("查询 tag:meta==project 不应有结果: %v, %v", result, err)
+	}
+}
@@ -0,0 +1,555 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+)
+
+// errNotDir 路径中的某一级不是目录
+var errNotDir = errors.New("not a directory")
+
+// errIsDir 对目录执行只适用于文件的操作
+var errIsDir = errors.New("is a directory")
+
+// errNotEmpty 删除非空目录
+var errNotEmpty = errors.New("directory not empty")
+
+// Mem 内存文件系统，用于测试。路径按filepath.Clean规范化，根目录总是存在
+type Mem struct {
+	mu    sync.Mutex
+	clock clock.Clock
+	nodes map[string]*memNode
+	seq   uint64 // CreateTemp的序号
+}
+
+// memNode 内存中的文件或目录
+type memNode struct {
+	dir     bool
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// NewMem 创建内存文件系统，c为nil时修改时间使用系统时间
+func NewMem(c clock.Clock) *Mem {
+	return &Mem{clock: clock.OrSystem(c), nodes: make(map[string]*memNode)}
+}
+
+// clean 规范化路径
+func clean(name string) string {
+	return filepath.Clean(name)
+}
+
+// isRoot 路径是否为根目录
+func isRoot(name string) bool {
+	return name == "." || name == string(filepath.Separator) || filepath.Dir(name) == name
+}
+
+// lookup 查找节点，根目录返回一个目录节点（调用者持有锁）
+func (m *Mem) lookup(name string) (*memNode, bool) {
+	if isRoot(name) {
+		return &memNode{dir: true, mode: fs.ModeDir | 0755}, true
+	}
+	node, ok := m.nodes[name]
+	return node, ok
+}
+
+// checkParent 检查父目录存在（调用者持有锁）
+func (m *Mem) checkParent(op, name string) error {
+	parent, ok := m.lookup(filepath.Dir(name))
+	if !ok {
+		return &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	if !parent.dir {
+		return &fs.PathError{Op: op, Path: name, Err: errNotDir}
+	}
+	return nil
+}
+
+// Open 以只读方式打开文件或目录
+func (m *Mem) Open(name string) (File, error) {
+	return m.OpenFile(name, os.O_RDONLY, 0)
+}
+
+// OpenFile 打开文件，支持O_CREATE、O_EXCL、O_TRUNC和O_APPEND
+func (m *Mem) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.openFile(name, flag, perm)
+}
+
+// openFile 打开文件（调用者持有锁）
+func (m *Mem) openFile(name string, flag int, perm fs.FileMode) (File, error) {
+	path := clean(name)
+	node, ok := m.lookup(path)
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+
+	switch {
+	case ok && flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrExist}
+	case ok && node.dir && writable:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: errIsDir}
+	case !ok && flag&os.O_CREATE == 0:
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	case !ok:
+		if err := m.checkParent("open", path); err != nil {
+			return nil, err
+		}
+		node = &memNode{mode: perm.Perm(), modTime: m.clock.Now()}
+		m.nodes[path] = node
+	}
+
+	if flag&os.O_TRUNC != 0 && writable {
+		node.data = nil
+		node.modTime = m.clock.Now()
+	}
+	return &memFile{fs: m, node: node, name: name, flag: flag}, nil
+}
+
+// CreateTemp 在dir中创建新文件，pattern中最后一个"*"替换为序号，dir为空时使用os.TempDir()
+func (m *Mem) CreateTemp(dir, pattern string) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name, err := m.tempName(dir, pattern)
+	if err != nil {
+		return nil, err
+	}
+	return m.openFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+}
+
+// MkdirTemp 在dir中创建新目录，命名规则与CreateTemp相同
+func (m *Mem) MkdirTemp(dir, pattern string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name, err := m.tempName(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	m.nodes[clean(name)] = &memNode{dir: true, mode: fs.ModeDir | 0700, modTime: m.clock.Now()}
+	return name, nil
+}
+
+// tempName 生成dir中不存在的临时名称，必要时创建dir（调用者持有锁）
+func (m *Mem) tempName(dir, pattern string) (string, error) {
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if err := m.mkdirAll(clean(dir), 0700); err != nil {
+		return "", err
+	}
+
+	prefix, suffix := pattern, ""
+	if i := strings.LastIndex(pattern, "*"); i >= 0 {
+		prefix, suffix = pattern[:i], pattern[i+1:]
+	}
+	for {
+		m.seq++
+		name := filepath.Join(dir, prefix+strconv.FormatUint(m.seq, 10)+suffix)
+		if _, ok := m.nodes[clean(name)]; !ok {
+			return name, nil
+		}
+	}
+}
+
+// ReadFile 读取整个文件
+func (m *Mem) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, ok := m.lookup(clean(name))
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if node.dir {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: errIsDir}
+	}
+	return append([]byte(nil), node.data...), nil
+}
+
+// WriteFile 写入整个文件，文件不存在时以perm创建
+func (m *Mem) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, err := m.openFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	f := file.(*memFile)
+	f.node.data = append([]byte(nil), data...)
+	return nil
+}
+
+// Stat 返回文件信息
+func (m *Mem) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path := clean(name)
+	node, ok := m.lookup(path)
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+	}
+	return node.info(filepath.Base(path)), nil
+}
+
+// ReadDir 按名称顺序列出目录中的条目
+func (m *Mem) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path := clean(name)
+	node, ok := m.lookup(path)
+	if !ok {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if !node.dir {
+		return nil, &fs.PathError{Op: "readdirent", Path: name, Err: errNotDir}
+	}
+
+	var entries []fs.DirEntry
+	for child, childNode := range m.nodes {
+		if filepath.Dir(child) == path && child != path {
+			entries = append(entries, fs.FileInfoToDirEntry(childNode.info(filepath.Base(child))))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// MkdirAll 创建目录及其所有父目录
+func (m *Mem) MkdirAll(path string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.mkdirAll(clean(path), perm)
+}
+
+// mkdirAll 创建目录（调用者持有锁）
+func (m *Mem) mkdirAll(path string, perm fs.FileMode) error {
+	if isRoot(path) {
+		return nil
+	}
+	if node, ok := m.nodes[path]; ok {
+		if !node.dir {
+			return &fs.PathError{Op: "mkdir", Path: path, Err: errNotDir}
+		}
+		return nil
+	}
+	if err := m.mkdirAll(filepath.Dir(path), perm); err != nil {
+		return err
+	}
+	m.nodes[path] = &memNode{dir: true, mode: fs.ModeDir | perm.Perm(), modTime: m.clock.Now()}
+	return nil
+}
+
+// Remove 删除文件或空目录
+func (m *Mem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path := clean(name)
+	node, ok := m.nodes[path]
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	if node.dir && m.hasChildren(path) {
+		return &fs.PathError{Op: "remove", Path: name, Err: errNotEmpty}
+	}
+	delete(m.nodes, path)
+	return nil
+}
+
+// RemoveAll 删除路径及其下的所有内容，路径不存在时不返回错误
+func (m *Mem) RemoveAll(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path = clean(path)
+	for name := range m.nodes {
+		if name == path || isUnder(name, path) {
+			delete(m.nodes, name)
+		}
+	}
+	return nil
+}
+
+// Rename 重命名文件或目录，目标文件已存在时被替换
+func (m *Mem) Rename(oldpath, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	from, to := clean(oldpath), clean(newpath)
+	node, ok := m.nodes[from]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	if err := m.checkParent("rename", to); err != nil {
+		return err
+	}
+	if target, ok := m.nodes[to]; ok && target.dir != node.dir {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrExist}
+	}
+
+	if node.dir {
+		moved := make(map[string]*memNode)
+		for name, child := range m.nodes {
+			if isUnder(name, from) {
+				moved[to+name[len(from):]] = child
+				delete(m.nodes, name)
+			}
+		}
+		for name, child := range moved {
+			m.nodes[name] = child
+		}
+	}
+	delete(m.nodes, from)
+	m.nodes[to] = node
+	return nil
+}
+
+// Chmod 修改权限位
+func (m *Mem) Chmod(name string, mode fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, ok := m.nodes[clean(name)]
+	if !ok {
+		return &fs.PathError{Op: "chmod", Path: name, Err: fs.ErrNotExist}
+	}
+	node.mode = node.mode&fs.ModeType | mode.Perm()
+	return nil
+}
+
+// Chtimes 修改修改时间，访问时间不记录
+func (m *Mem) Chtimes(name string, atime, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	node, ok := m.nodes[clean(name)]
+	if !ok {
+		return &fs.PathError{Op: "chtimes", Path: name, Err: fs.ErrNotExist}
+	}
+	node.modTime = mtime
+	return nil
+}
+
+// hasChildren 目录下是否有条目（调用者持有锁）
+func (m *Mem) hasChildren(path string) bool {
+	for name := range m.nodes {
+		if isUnder(name, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// isUnder name是否位于目录dir之下
+func isUnder(name, dir string) bool {
+	if isRoot(dir) {
+		return !isRoot(name)
+	}
+	return strings.HasPrefix(name, dir+string(filepath.Separator))
+}
+
+// info 返回节点的文件信息（调用者持有锁）
+func (n *memNode) info(name string) fs.FileInfo {
+	return &memInfo{name: name, size: int64(len(n.data)), mode: n.mode, modTime: n.modTime}
+}
+
+// memInfo 内存文件的信息
+type memInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i *memInfo) Name() string       { return i.name }
+func (i *memInfo) Size() int64        { return i.size }
+func (i *memInfo) Mode() fs.FileMode  { return i.mode }
+func (i *memInfo) ModTime() time.Time { return i.modTime }
+func (i *memInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *memInfo) Sys() any           { return nil }
+
+// memFile 打开的内存文件，读写位置属于句柄，数据属于节点
+type memFile struct {
+	fs     *Mem
+	node   *memNode
+	name   string
+	flag   int
+	offset int64
+	closed bool
+}
+
+// check 检查句柄可用（调用者持有锁）
+func (f *memFile) check(op string, write bool) error {
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+	if f.node.dir {
+		return &fs.PathError{Op: op, Path: f.name, Err: errIsDir}
+	}
+	if write && f.flag&(os.O_WRONLY|os.O_RDWR) == 0 {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrPermission}
+	}
+	if !write && f.flag&os.O_WRONLY != 0 {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrPermission}
+	}
+	return nil
+}
+
+func (f *memFile) Name() string { return f.name }
+
+func (f *memFile) Read(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	n, err := f.readAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memFile) ReadAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+	return f.readAt(p, off)
+}
+
+// readAt 从off处读取（调用者持有锁）
+func (f *memFile) readAt(p []byte, off int64) (int, error) {
+	if err := f.check("read", false); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if off >= int64(len(f.node.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.node.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.flag&os.O_APPEND != 0 {
+		f.offset = int64(len(f.node.data))
+	}
+	n, err := f.writeAt(p, f.offset)
+	f.offset += int64(n)
+	return n, err
+}
+
+func (f *memFile) WriteAt(p []byte, off int64) (int, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.flag&os.O_APPEND != 0 {
+		return 0, &fs.PathError{Op: "writeat", Path: f.name, Err: errors.New("file opened with O_APPEND")}
+	}
+	return f.writeAt(p, off)
+}
+
+// writeAt 在off处写入，必要时扩展文件（调用者持有锁）
+func (f *memFile) writeAt(p []byte, off int64) (int, error) {
+	if err := f.check("write", true); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if end := off + int64(len(p)); end > int64(len(f.node.data)) {
+		f.node.data = append(f.node.data, make([]byte, end-int64(len(f.node.data)))...)
+	}
+	copy(f.node.data[off:], p)
+	f.node.modTime = f.fs.clock.Now()
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrClosed}
+	}
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += int64(len(f.node.data))
+	}
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: fs.ErrClosed}
+	}
+	return f.node.info(filepath.Base(f.name)), nil
+}
+
+// Sync 内存文件不需要同步，目录也可以同步
+func (f *memFile) Sync() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "sync", Path: f.name, Err: fs.ErrClosed}
+	}
+	return nil
+}
+
+func (f *memFile) Truncate(size int64) error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if err := f.check("truncate", true); err != nil {
+		return err
+	}
+	if size < 0 {
+		return &fs.PathError{Op: "truncate", Path: f.name, Err: fs.ErrInvalid}
+	}
+	if size <= int64(len(f.node.data)) {
+		f.node.data = f.node.data[:size]
+	} else {
+		f.node.data = append(f.node.data, make([]byte, size-int64(len(f.node.data)))...)
+	}
+	f.node.modTime = f.fs.clock.Now()
+	return nil
+}
+
+func (f *memFile) Close() error {
+	f.fs.mu.Lock()
+	defer f.fs.mu.Unlock()
+
+	if f.closed {
+		return &fs.PathError{Op: "close", Path: f.name, Err: fs.ErrClosed}
+	}
+	f.closed = true
+	return nil
+}
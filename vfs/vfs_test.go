@@ -0,0 +1,156 @@
+package vfs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bpfs/fragmenta/clock"
+)
+
+// TestFilesystems 在操作系统文件系统和内存文件系统上执行相同的操作，检查结果一致
+func TestFilesystems(t *testing.T) {
+	filesystems := map[string]struct {
+		fs   FS
+		root string
+	}{
+		"os":  {OS, t.TempDir()},
+		"mem": {NewMem(nil), "/data"},
+	}
+
+	for name, tc := range filesystems {
+		t.Run(name, func(t *testing.T) {
+			fsys, root := tc.fs, tc.root
+			dir := filepath.Join(root, "a", "b")
+			if err := fsys.MkdirAll(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			path := filepath.Join(dir, "file")
+			if _, err := fsys.Open(path); !errors.Is(err, fs.ErrNotExist) || !os.IsNotExist(err) {
+				t.Errorf("打开不存在的文件应返回ErrNotExist: %v", err)
+			}
+			if err := fsys.WriteFile(filepath.Join(root, "missing", "file"), nil, 0644); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("父目录不存在时应返回ErrNotExist: %v", err)
+			}
+
+			// 随机读写、截断和追加
+			file, err := fsys.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := file.WriteAt([]byte("world"), 6); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := file.WriteAt([]byte("hello "), 0); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 8)
+			if n, err := file.ReadAt(buf, 6); n != 5 || err != io.EOF || string(buf[:n]) != "world" {
+				t.Errorf("ReadAt结果不正确: %d, %v, %q", n, err, buf[:n])
+			}
+			if err := file.Truncate(5); err != nil {
+				t.Fatal(err)
+			}
+			if info, err := file.Stat(); err != nil || info.Size() != 5 || info.Name() != "file" {
+				t.Errorf("截断后的文件信息不正确: %v, %v", info, err)
+			}
+			if err := file.Sync(); err != nil {
+				t.Fatal(err)
+			}
+			file.Close()
+
+			appendFile, err := fsys.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			appendFile.Write([]byte("!"))
+			appendFile.Close()
+			if data, err := fsys.ReadFile(path); err != nil || string(data) != "hello!" {
+				t.Errorf("追加后的内容不正确: %q, %v", data, err)
+			}
+
+			// 临时文件、重命名和列目录
+			tmp, err := fsys.CreateTemp(dir, "file.tmp-*")
+			if err != nil {
+				t.Fatal(err)
+			}
+			tmp.Write([]byte("new"))
+			tmp.Close()
+			if err := fsys.Chmod(tmp.Name(), 0640); err != nil {
+				t.Fatal(err)
+			}
+			if err := fsys.Rename(tmp.Name(), path); err != nil {
+				t.Fatal(err)
+			}
+			if data, _ := fsys.ReadFile(path); string(data) != "new" {
+				t.Errorf("重命名后的内容不正确: %q", data)
+			}
+			mtime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+			if err := fsys.Chtimes(path, mtime, mtime); err != nil {
+				t.Fatal(err)
+			}
+			if info, _ := fsys.Stat(path); !info.ModTime().Equal(mtime) || info.Mode().Perm() != 0640 {
+				t.Errorf("文件信息不正确: %v, %v", info.ModTime(), info.Mode())
+			}
+
+			fsys.WriteFile(filepath.Join(dir, "another"), []byte("x"), 0644)
+			entries, err := fsys.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name())
+			}
+			if !reflect.DeepEqual(names, []string{"another", "file"}) {
+				t.Errorf("目录条目不正确: %v", names)
+			}
+
+			// 移动目录后原路径不存在
+			moved := filepath.Join(root, "moved")
+			if err := fsys.Rename(filepath.Join(root, "a"), moved); err != nil {
+				t.Fatal(err)
+			}
+			if data, err := fsys.ReadFile(filepath.Join(moved, "b", "file")); err != nil || string(data) != "new" {
+				t.Errorf("移动目录后读取失败: %q, %v", data, err)
+			}
+			if _, err := fsys.Stat(dir); !os.IsNotExist(err) {
+				t.Errorf("移动后原目录应不存在: %v", err)
+			}
+
+			if err := fsys.Remove(moved); err == nil {
+				t.Error("删除非空目录应失败")
+			}
+			if err := fsys.RemoveAll(moved); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := fsys.Stat(filepath.Join(moved, "b")); !os.IsNotExist(err) {
+				t.Errorf("RemoveAll后子目录应不存在: %v", err)
+			}
+			if err := fsys.RemoveAll(moved); err != nil {
+				t.Errorf("删除不存在的路径不应失败: %v", err)
+			}
+		})
+	}
+}
+
+// TestMemModTime 测试内存文件系统使用注入的时钟记录修改时间
+func TestMemModTime(t *testing.T) {
+	c := clock.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	fsys := NewMem(c)
+	fsys.WriteFile("/f", []byte("a"), 0644)
+
+	c.Advance(time.Hour)
+	file, _ := fsys.OpenFile("/f", os.O_RDWR, 0)
+	file.WriteAt([]byte("b"), 1)
+	file.Close()
+
+	if info, _ := fsys.Stat("/f"); !info.ModTime().Equal(c.Now()) {
+		t.Errorf("修改时间不正确: %v", info.ModTime())
+	}
+}
@@ -0,0 +1,288 @@
+package fragmenta
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxViewNameSize 命名查询名称的最大长度（字节）
+	MaxViewNameSize = 64
+
+	// MaxViewQuerySize 命名查询模板的最大长度（字节）
+	MaxViewQuerySize = 4096
+
+	// viewTableVersion 命名查询表的编码版本
+	viewTableVersion uint8 = 1
+)
+
+// viewQueryKeywords 命名查询参数中不能出现的查询关键字，避免参数改变查询的结构
+var viewQueryKeywords = map[string]bool{"and": true, "or": true, "not": true, "in": true, "between": true}
+
+// RegisterView 注册命名查询，名称已存在时替换原来的查询。查询模板使用Query的语法，
+// 可以用 ${参数} 引用执行时传入的参数，如 "owner==${owner} and block.size>${min}; sort: -block.created"。
+// 命名查询保存在TagQueryViews中，随Commit持久化
+func (f *FragmentaImpl) RegisterView(name, queryTemplate string) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+	if err := validateFieldName(name); err != nil {
+		return err
+	}
+	if len(name) > MaxViewNameSize {
+		return fmt.Errorf("%w: 命名查询名称超过%d字节", ErrInvalidArgument, MaxViewNameSize)
+	}
+	if strings.TrimSpace(queryTemplate) == "" {
+		return fmt.Errorf("%w: 命名查询不能为空", ErrInvalidArgument)
+	}
+	if len(queryTemplate) > MaxViewQuerySize {
+		return fmt.Errorf("%w: 命名查询超过%d字节", ErrInvalidArgument, MaxViewQuerySize)
+	}
+	if _, err := viewParams(queryTemplate); err != nil {
+		return err
+	}
+
+	f.viewMutex.Lock()
+	defer f.viewMutex.Unlock()
+
+	if err := f.loadViewsLocked(); err != nil {
+		return err
+	}
+	old, existed := f.views[name]
+	f.views[name] = queryTemplate
+	if err := f.setMetadata(TagQueryViews, encodeViews(f.views)); err != nil {
+		if existed {
+			f.views[name] = old
+		} else {
+			delete(f.views, name)
+		}
+		logger.Error("保存命名查询失败", "name", name, "error", err)
+		return err
+	}
+
+	logger.Info("已注册命名查询", "name", name)
+	return nil
+}
+
+// UnregisterView 删除命名查询
+func (f *FragmentaImpl) UnregisterView(name string) error {
+	if f.readOnly {
+		return ErrReadOnly
+	}
+
+	f.viewMutex.Lock()
+	defer f.viewMutex.Unlock()
+
+	if err := f.loadViewsLocked(); err != nil {
+		return err
+	}
+	old, ok := f.views[name]
+	if !ok {
+		return ErrViewNotFound
+	}
+	delete(f.views, name)
+	if err := f.setMetadata(TagQueryViews, encodeViews(f.views)); err != nil {
+		f.views[name] = old
+		logger.Error("删除命名查询失败", "name", name, "error", err)
+		return err
+	}
+
+	logger.Info("已删除命名查询", "name", name)
+	return nil
+}
+
+// Views 返回所有命名查询的名称和查询模板
+func (f *FragmentaImpl) Views() (map[string]string, error) {
+	f.viewMutex.Lock()
+	defer f.viewMutex.Unlock()
+
+	if err := f.loadViewsLocked(); err != nil {
+		return nil, err
+	}
+	result := make(map[string]string, len(f.views))
+	for name, query := range f.views {
+		result[name] = query
+	}
+	return result, nil
+}
+
+// ExecuteView 用参数替换命名查询中的 ${参数} 后执行查询。参数必须与查询模板引用的参数一致；
+// 参数值按原样代入（时间使用RFC3339格式），不能包含分号、括号、引号或and/or/not等查询关键字。
+// 需要先调用 StartQueryService
+func (f *FragmentaImpl) ExecuteView(name string, params map[string]interface{}) (*QueryResult, error) {
+	f.viewMutex.Lock()
+	err := f.loadViewsLocked()
+	queryTemplate, ok := f.views[name]
+	f.viewMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrViewNotFound
+	}
+
+	queryString, err := expandView(queryTemplate, params)
+	if err != nil {
+		return nil, err
+	}
+	return f.Query(queryString)
+}
+
+// viewParams 返回查询模板引用的参数名称
+func viewParams(queryTemplate string) ([]string, error) {
+	var names []string
+	_, err := replaceViewParams(queryTemplate, func(name string) (string, error) {
+		names = append(names, name)
+		return "", nil
+	})
+	return names, err
+}
+
+// expandView 用参数替换查询模板中的 ${参数}
+func expandView(queryTemplate string, params map[string]interface{}) (string, error) {
+	used := make(map[string]bool, len(params))
+	queryString, err := replaceViewParams(queryTemplate, func(name string) (string, error) {
+		value, ok := params[name]
+		if !ok {
+			return "", fmt.Errorf("%w: 缺少命名查询参数%s", ErrInvalidArgument, name)
+		}
+		used[name] = true
+		return formatViewParam(name, value)
+	})
+	if err != nil {
+		return "", err
+	}
+	for name := range params {
+		if !used[name] {
+			return "", fmt.Errorf("%w: 命名查询没有参数%s", ErrInvalidArgument, name)
+		}
+	}
+	return queryString, nil
+}
+
+// replaceViewParams 把查询模板中的每个 ${参数} 替换为replace返回的字符串
+func replaceViewParams(queryTemplate string, replace func(name string) (string, error)) (string, error) {
+	var b strings.Builder
+	rest := queryTemplate
+	for {
+		start := strings.Index(rest, "${")
+		if start < 0 {
+			break
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("%w: 命名查询参数缺少右括号", ErrInvalidArgument)
+		}
+		name := rest[start+2 : start+end]
+		if err := validateFieldName(name); err != nil {
+			return "", fmt.Errorf("%w: 无效的命名查询参数%q", ErrInvalidArgument, name)
+		}
+		value, err := replace(name)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(rest[:start])
+		b.WriteString(value)
+		rest = rest[start+end+1:]
+	}
+	b.WriteString(rest)
+	return b.String(), nil
+}
+
+// formatViewParam 把参数值格式化为查询字符串中的值，拒绝可能改变查询结构的值
+func formatViewParam(name string, value interface{}) (string, error) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case time.Time:
+		s = v.Format(time.RFC3339Nano)
+	case []byte:
+		s = string(v)
+	default:
+		s = fmt.Sprint(v)
+	}
+
+	if s == "" || strings.ContainsAny(s, ";()[]\"'\r\n") {
+		return "", fmt.Errorf("%w: 命名查询参数%s的值%q无效", ErrInvalidArgument, name, s)
+	}
+	for _, word := range strings.Fields(s) {
+		if viewQueryKeywords[strings.ToLower(word)] {
+			return "", fmt.Errorf("%w: 命名查询参数%s的值%q包含查询关键字", ErrInvalidArgument, name, s)
+		}
+	}
+	return s, nil
+}
+
+// loadViewsLocked 首次使用时从TagQueryViews加载命名查询表，调用方需持有viewMutex
+func (f *FragmentaImpl) loadViewsLocked() error {
+	if f.views != nil {
+		return nil
+	}
+
+	data, err := f.metadataManager.GetMetadata(TagQueryViews)
+	if err == ErrMetadataNotFound {
+		f.views = make(map[string]string)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	views, err := decodeViews(data)
+	if err != nil {
+		logger.Error("加载命名查询表失败", "error", err)
+		return err
+	}
+	f.views = views
+	return nil
+}
+
+// encodeViews 编码命名查询表
+// 格式: 版本 | 数量 | 记录...，记录为 名称长度 | 名称 | 查询长度 | 查询，按名称排序
+func encodeViews(views map[string]string) []byte {
+	names := make([]string, 0, len(views))
+	for name := range views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := make([]byte, 3, 3+len(names)*64)
+	buf[0] = viewTableVersion
+	binary.BigEndian.PutUint16(buf[1:], uint16(len(names)))
+	for _, name := range names {
+		buf = append(buf, uint8(len(name)))
+		buf = append(buf, name...)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(views[name])))
+		buf = append(buf, views[name]...)
+	}
+	return buf
+}
+
+// decodeViews 解码命名查询表
+func decodeViews(data []byte) (map[string]string, error) {
+	if len(data) < 3 || data[0] != viewTableVersion {
+		return nil, fmt.Errorf("%w: 无效的命名查询表", ErrIndexCorruption)
+	}
+
+	count := int(binary.BigEndian.Uint16(data[1:]))
+	views := make(map[string]string, count)
+	data = data[3:]
+	for i := 0; i < count; i++ {
+		if len(data) < 1 || len(data) < 3+int(data[0]) {
+			return nil, fmt.Errorf("%w: 命名查询表被截断", ErrIndexCorruption)
+		}
+		name := string(data[1 : 1+data[0]])
+		data = data[1+len(name):]
+		size := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+size {
+			return nil, fmt.Errorf("%w: 命名查询表被截断", ErrIndexCorruption)
+		}
+		views[name] = string(data[2 : 2+size])
+		data = data[2+size:]
+	}
+	return views, nil
+}
@@ -0,0 +1,91 @@
+package fragmenta
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// TestViews 测试注册、执行和删除命名查询，命名查询随文件保存
+func TestViews(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.frag")
+	f, err := CreateFragmenta(path, nil)
+	if err != nil {
+		t.Fatalf("创建Fragmenta格式文件失败: %v", err)
+	}
+
+	if err := f.RegisterView("large-by-tenant", "tenant==${tenant} and block.size>=${min}; sort: -block.size"); err != nil {
+		t.Fatalf("注册命名查询失败: %v", err)
+	}
+	if err := f.RegisterView("all", "exists tenant"); err != nil {
+		t.Fatalf("注册命名查询失败: %v", err)
+	}
+	for _, tt := range []struct{ name, query string }{
+		{"bad name", "exists tenant"},
+		{"empty", " "},
+		{"unclosed", "tenant==${tenant"},
+		{"bad-param", "tenant==${a b}"},
+	} {
+		if err := f.RegisterView(tt.name, tt.query); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("注册命名查询 %s 应返回ErrInvalidArgument: %v", tt.name, err)
+		}
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("关闭文件失败: %v", err)
+	}
+
+	f, err = OpenFragmenta(path)
+	if err != nil {
+		t.Fatalf("打开文件失败: %v", err)
+	}
+	defer f.Close()
+
+	views, err := f.Views()
+	if err != nil || len(views) != 2 || views["all"] != "exists tenant" {
+		t.Fatalf("重新打开后命名查询不正确: %v, %v", views, err)
+	}
+
+	var ids []uint32
+	for i, tenant := range []string{"alpha", "alpha", "beta"} {
+		id, err := f.WriteBlock(make([]byte, 100*(i+1)), &BlockOptions{Attributes: map[string]string{AttrTenant: tenant}})
+		if err != nil {
+			t.Fatalf("写入块失败: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := f.StartQueryService(); err != nil {
+		t.Fatalf("启动查询服务失败: %v", err)
+	}
+
+	result, err := f.ExecuteView("large-by-tenant", map[string]interface{}{"tenant": "alpha", "min": 100})
+	if err != nil || !reflect.DeepEqual(queryBlockIDs(result), []uint32{ids[1], ids[0]}) {
+		t.Errorf("执行命名查询结果不正确: %v, %v", result, err)
+	}
+	if result, err := f.ExecuteView("all", nil); err != nil || len(result.Entries) != 3 {
+		t.Errorf("执行无参数的命名查询结果不正确: %v, %v", result, err)
+	}
+
+	// 参数不一致或者可能改变查询结构时返回错误
+	for _, params := range []map[string]interface{}{
+		{"tenant": "alpha"},
+		{"tenant": "alpha", "min": 1, "max": 2},
+		{"tenant": "alpha or tenant==beta", "min": 1},
+		{"tenant": "alpha; limit: 1", "min": 1},
+		{"tenant": "", "min": 1},
+	} {
+		if _, err := f.ExecuteView("large-by-tenant", params); !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("参数 %v 应返回ErrInvalidArgument: %v", params, err)
+		}
+	}
+
+	if err := f.UnregisterView("all"); err != nil {
+		t.Fatalf("删除命名查询失败: %v", err)
+	}
+	if _, err := f.ExecuteView("all", nil); !errors.Is(err, ErrViewNotFound) {
+		t.Errorf("删除后执行应返回ErrViewNotFound: %v", err)
+	}
+	if err := f.UnregisterView("all"); !errors.Is(err, ErrViewNotFound) {
+		t.Errorf("重复删除应返回ErrViewNotFound: %v", err)
+	}
+}